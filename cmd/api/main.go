@@ -3,21 +3,44 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
+	"github.com/mikedewar/stablerisk/internal/api"
 	"github.com/mikedewar/stablerisk/internal/api/handlers"
 	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/archive"
+	"github.com/mikedewar/stablerisk/internal/bus"
 	"github.com/mikedewar/stablerisk/internal/config"
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/internal/diagnostics"
+	"github.com/mikedewar/stablerisk/internal/enrichment"
+	"github.com/mikedewar/stablerisk/internal/features"
 	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/internal/health"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/internal/migrate"
+	"github.com/mikedewar/stablerisk/internal/notify"
+	"github.com/mikedewar/stablerisk/internal/ratelimit"
+	"github.com/mikedewar/stablerisk/internal/reports"
 	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/internal/security/crypto"
+	"github.com/mikedewar/stablerisk/internal/siem"
+	"github.com/mikedewar/stablerisk/internal/tracing"
+	"github.com/mikedewar/stablerisk/internal/webhook"
 	"github.com/mikedewar/stablerisk/internal/websocket"
+	"github.com/mikedewar/stablerisk/migrations"
+	"github.com/mikedewar/stablerisk/pkg/models"
 	"github.com/mikedewar/stablerisk/pkg/utils"
 	"go.uber.org/zap"
 )
@@ -25,6 +48,9 @@ import (
 const version = "1.0.0"
 
 func main() {
+	verifyAudit := flag.Bool("verify-audit", false, "verify the audit log hash chain, print the report and exit (status 1 if it is broken)")
+	flag.Parse()
+
 	// Load configuration
 	cfg, err := config.Load("")
 	if err != nil {
@@ -38,6 +64,14 @@ func main() {
 		Format:     cfg.Logging.Format,
 		OutputPath: cfg.Logging.OutputPath,
 		ErrorPath:  cfg.Logging.ErrorPath,
+		Rotation: utils.RotationConfig{
+			MaxSizeMB:  cfg.Logging.MaxSizeMB,
+			MaxAge:     cfg.Logging.MaxAge,
+			MaxBackups: cfg.Logging.MaxBackups,
+			Compress:   cfg.Logging.Compress,
+		},
+		SampleInitial:    cfg.Logging.SamplingInitial,
+		SampleThereafter: cfg.Logging.SamplingThereafter,
 	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
@@ -48,19 +82,100 @@ func main() {
 	logger.Info("Starting StableRisk API Server",
 		zap.String("version", version))
 
+	// Export traces when enabled; queued spans are flushed on exit
+	if cfg.Monitoring.TracingEnabled {
+		shutdownTracing := tracing.Init(tracing.Config{
+			ServiceName: "stablerisk-api",
+			Endpoint:    cfg.Monitoring.TracingEndpoint,
+			SampleRatio: cfg.Monitoring.TracingSampleRatio,
+		}, logger)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				logger.Warn("Failed to flush traces", zap.Error(err))
+			}
+		}()
+	}
+
 	// Connect to database
-	db, err := connectDatabase(cfg.Database, logger)
+	db, err := connectDatabase(cfg.Database, cfg.Monitoring.SlowQueryThreshold, logger)
 	if err != nil {
 		logger.Fatal("Failed to connect to database", zap.Error(err))
 	}
 	defer db.Close()
 
+	// Initialize audit logger. Its entries are written in batches, so
+	// migrations it records are chained once their tables exist.
+	auditLogger := security.NewAuditLogger(db, security.AuditLoggerConfig{
+		SecretKey:      cfg.Security.HMACKey,
+		BatchSize:      100,
+		FlushInterval:  5 * time.Second,
+		AnchorInterval: cfg.Security.AuditAnchorInterval,
+	}, logger)
+	defer auditLogger.Close()
+
+	// `api migrate [up|status|baseline VERSION]` manages the schema and exits
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(db, auditLogger, flag.Args()[1:], logger); err != nil {
+			fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+			auditLogger.Close()
+			db.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Bring the schema up to date before anything queries it
+	if cfg.Database.AutoMigrate {
+		if err := autoMigrate(db, auditLogger, logger); err != nil {
+			auditLogger.Close()
+			logger.Fatal("Failed to migrate database", zap.Error(err))
+		}
+	}
+
 	// Initialize Raphtory client
+	raphtoryTLS, err := security.ClientTLSConfig(security.ClientTLSFiles{
+		CertFile: cfg.Raphtory.TLSCertFile,
+		KeyFile:  cfg.Raphtory.TLSKeyFile,
+		CAFile:   cfg.Raphtory.TLSCAFile,
+	}, logger)
+	if err != nil {
+		logger.Fatal("Failed to load Raphtory TLS configuration", zap.Error(err))
+	}
 	raphtoryClient := graph.NewRaphtoryClient(graph.RaphtoryConfig{
-		BaseURL:    cfg.Raphtory.BaseURL,
-		Timeout:    cfg.Raphtory.Timeout,
-		MaxRetries: 3,
-		RetryDelay: 1 * time.Second,
+		BaseURL:          cfg.Raphtory.BaseURL,
+		Timeout:          cfg.Raphtory.Timeout,
+		MaxRetries:       cfg.Raphtory.MaxRetries,
+		RetryDelay:       cfg.Raphtory.RetryDelay,
+		FailureThreshold: cfg.Raphtory.CircuitFailureThreshold,
+		OpenTimeout:      cfg.Raphtory.CircuitOpenTimeout,
+		Transport:        cfg.Raphtory.Transport,
+		GraphName:        cfg.Raphtory.GraphName,
+		TLS:              raphtoryTLS,
+	}, logger)
+
+	// Feature flags gating experimental capabilities
+	featureFlags := newFeatureFlags(context.Background(), cfg.Features, db, logger)
+
+	// Initialize anomaly detector for on-demand runs
+	anomalyDetector := detection.NewAnomalyDetector(newDetectorConfig(cfg.Detection), raphtoryClient, logger)
+	anomalyDetector.SetFeatureFlags(featureFlags)
+	if cfg.Detection.LabelsEnabled {
+		anomalyDetector.SetAddressLabels(newAddressLabels(context.Background(), cfg.Detection, db, logger))
+	}
+	if cfg.Enrichment.Enabled {
+		anomalyDetector.SetEnricher(newEnricher(cfg.Enrichment, enrichment.NewStore(db), logger))
+	}
+	// Settings saved through the API override the file configuration
+	detectionSettings := detection.NewSettingsStore(db, logger)
+	if err := detectionSettings.Sync(context.Background(), anomalyDetector); err != nil {
+		logger.Error("Failed to load detection settings, using the file configuration", zap.Error(err))
+	}
+	go detectionSettings.Watch(context.Background(), anomalyDetector, cfg.Detection.ConfigRefreshInterval)
+	detectionJobs := detection.NewJobManager(anomalyDetector, detection.JobManagerConfig{
+		MaxConcurrent: cfg.Detection.MaxConcurrentRuns,
+		Timeout:       cfg.Detection.RunTimeout,
 	}, logger)
 
 	// Initialize JWT manager
@@ -72,37 +187,415 @@ func main() {
 		RefreshTokenExpiry: cfg.Security.RefreshTokenExpiry,
 	})
 
-	// Initialize audit logger
-	auditLogger := security.NewAuditLogger(db, security.AuditLoggerConfig{
-		SecretKey:     cfg.Security.HMACKey,
-		BatchSize:     100,
-		FlushInterval: 5 * time.Second,
-	}, logger)
-	defer auditLogger.Close()
+	// Initialize password policy
+	passwordManager := security.NewPasswordManager(security.PasswordConfig{
+		MinLength: cfg.Security.PasswordMinLength,
+		Algorithm: cfg.Security.PasswordAlgorithm,
+		HashCost:  cfg.Security.PasswordHashCost,
+		Argon2: security.Argon2Params{
+			Memory:      uint32(cfg.Security.PasswordArgon2Memory),
+			Iterations:  uint32(cfg.Security.PasswordArgon2Iterations),
+			Parallelism: uint8(cfg.Security.PasswordArgon2Parallelism),
+		},
+		ResetExpiry: cfg.Security.PasswordResetExpiry,
+	})
+
+	if *verifyAudit {
+		if !verifyAuditChain(auditLogger, logger) {
+			auditLogger.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Encrypt sensitive fields at rest, bringing existing values under the
+	// current key in the background
+	fieldCipher, err := crypto.NewCipher(crypto.CipherConfig{
+		Key:          cfg.Security.EncryptionKey,
+		PreviousKeys: cfg.Security.PreviousEncryptionKeys,
+		IndexKey:     cfg.Security.HMACKey,
+	})
+	if err != nil {
+		logger.Fatal("Failed to initialize field encryption", zap.Error(err))
+	}
+	go func() {
+		if _, err := security.EncryptFields(context.Background(), db, fieldCipher, logger); err != nil {
+			logger.Error("Failed to encrypt existing field values", zap.Error(err))
+		}
+	}()
+
+	// Initialize brute-force protection for logins
+	loginGuard := security.NewLoginGuard(db, security.LoginGuardConfig{
+		MaxFailures:   cfg.Security.LoginMaxFailures,
+		Lockout:       cfg.Security.LoginLockout,
+		IPMaxFailures: cfg.Security.LoginIPMaxFailures,
+		IPWindow:      cfg.Security.LoginIPWindow,
+	}, auditLogger, logger)
 
 	// Initialize WebSocket hub
-	hub := websocket.NewHub(logger)
+	hub := websocket.NewHub(websocket.HubConfig{
+		MaxConnections:        cfg.Server.WebSocketMaxConnections,
+		MaxConnectionsPerUser: cfg.Server.WebSocketMaxConnectionsPerUser,
+		BroadcastWorkers:      cfg.Server.WebSocketBroadcastWorkers,
+	}, logger)
 	hub.Start()
 	defer hub.Stop()
 
+	// Tell admins connected over WebSocket about failed detection runs and
+	// the Raphtory circuit breaker
+	anomalyDetector.SetRunRecorder(&broadcastingRunRecorder{
+		RunRecorder: detection.NewRunStore(db, logger),
+		hub:         hub,
+	})
+	raphtoryClient.OnCircuitStateChange(func(from, to graph.CircuitState) {
+		hub.BroadcastOperational("raphtory_circuit", map[string]interface{}{
+			"from": from,
+			"to":   to,
+		})
+	})
+
+	// Alert on outliers matching the notification rules
+	var alertRouter *notify.Router
+	if cfg.Notify.Enabled {
+		notifyCtx, stopNotifying := context.WithCancel(context.Background())
+		defer stopNotifying()
+		alertRouter = newAlertRouter(notifyCtx, cfg.Notify, db, logger.With(zap.String("component", "notify")))
+		alertRouter.Start()
+		defer alertRouter.Stop()
+	}
+
+	// Post outliers and resolved incidents to organizations' webhooks
+	var webhookDispatcher *webhook.Dispatcher
+	if cfg.Webhooks.Enabled {
+		webhookDispatcher = webhook.NewDispatcher(db, webhook.Config{
+			MaxRetries:    cfg.Webhooks.MaxRetries,
+			RetryDelay:    cfg.Webhooks.RetryDelay,
+			MaxRetryDelay: cfg.Webhooks.MaxRetryDelay,
+			Timeout:       cfg.Webhooks.Timeout,
+			Workers:       cfg.Webhooks.Workers,
+			QueueSize:     cfg.Webhooks.QueueSize,
+
+			AllowPrivateAddresses: cfg.Webhooks.AllowPrivateAddresses,
+		}, logger.With(zap.String("component", "webhooks")))
+		webhookDispatcher.SetCipher(fieldCipher)
+		webhookDispatcher.Start()
+		defer webhookDispatcher.Stop()
+	}
+
+	// Forward outliers and audit log entries to the SIEM
+	var siemExporter *siem.Exporter
+	if cfg.SIEM.Enabled {
+		siemExporter = newSIEMExporter(cfg.SIEM, logger.With(zap.String("component", "siem")))
+		siemExporter.Start()
+		defer siemExporter.Stop()
+		auditLogger.SetWrittenHook(siemExporter.Audit)
+		defer auditLogger.SetWrittenHook(nil)
+	}
+
+	// Broadcast outliers from the detector service over the bus, and those
+	// from the in-process detector, such as manual runs
+	go func() {
+		for outlier := range anomalyDetector.Outliers() {
+			hub.BroadcastOutlier(outlier)
+			if alertRouter != nil {
+				alertRouter.Route(outlier)
+			}
+			if webhookDispatcher != nil {
+				webhookDispatcher.Outlier(outlier)
+			}
+			if siemExporter != nil {
+				siemExporter.Outlier(outlier)
+			}
+		}
+	}()
+	if cfg.Bus.Enabled {
+		busConn, err := bus.Connect(context.Background(), bus.Config{
+			URL:            cfg.Bus.URL,
+			Token:          cfg.Bus.Token,
+			Name:           "stablerisk-api",
+			Stream:         cfg.Bus.Stream,
+			PublishTimeout: cfg.Bus.PublishTimeout,
+			ReconnectWait:  cfg.Bus.ReconnectWait,
+		}, logger.With(zap.String("component", "bus")))
+		if err != nil {
+			logger.Fatal("Failed to connect to message bus", zap.Error(err))
+		}
+		defer busConn.Close()
+
+		// Relay broadcasts this instance makes to the other instances' clients
+		if cfg.Bus.WebSocketBackplane {
+			if err := hub.SetBackplane(bus.NewBackplane(busConn)); err != nil {
+				logger.Fatal("Failed to subscribe to WebSocket broadcasts", zap.Error(err))
+			}
+		}
+
+		// Every API instance broadcasts to its own WebSocket clients, so no
+		// queue group, and the outliers are not relayed
+		err = busConn.Subscribe(bus.SubjectOutliers, "", func(subject string, data []byte) {
+			var outlier models.Outlier
+			if err := json.Unmarshal(data, &outlier); err != nil {
+				logger.Error("Failed to decode outlier from bus", zap.Error(err))
+				return
+			}
+			hub.BroadcastLocal("outlier", outlier, websocket.AudienceViewer)
+		})
+		if err != nil {
+			logger.Fatal("Failed to subscribe to outliers", zap.Error(err))
+		}
+
+		// One API instance alerts on each of the detector service's outliers
+		if alertRouter != nil {
+			err = busConn.Subscribe(bus.SubjectOutliers, "stablerisk-notify", func(subject string, data []byte) {
+				var outlier models.Outlier
+				if err := json.Unmarshal(data, &outlier); err != nil {
+					logger.Error("Failed to decode outlier from bus", zap.Error(err))
+					return
+				}
+				alertRouter.Route(outlier)
+			})
+			if err != nil {
+				logger.Fatal("Failed to subscribe to outliers for alerting", zap.Error(err))
+			}
+		}
+
+		// Likewise one API instance posts each of them to webhooks
+		if webhookDispatcher != nil {
+			err = busConn.Subscribe(bus.SubjectOutliers, "stablerisk-webhooks", func(subject string, data []byte) {
+				var outlier models.Outlier
+				if err := json.Unmarshal(data, &outlier); err != nil {
+					logger.Error("Failed to decode outlier from bus", zap.Error(err))
+					return
+				}
+				webhookDispatcher.Outlier(outlier)
+			})
+			if err != nil {
+				logger.Fatal("Failed to subscribe to outliers for webhooks", zap.Error(err))
+			}
+		}
+
+		// And one exports each of them to the SIEM
+		if siemExporter != nil {
+			err = busConn.Subscribe(bus.SubjectOutliers, "stablerisk-siem", func(subject string, data []byte) {
+				var outlier models.Outlier
+				if err := json.Unmarshal(data, &outlier); err != nil {
+					logger.Error("Failed to decode outlier from bus", zap.Error(err))
+					return
+				}
+				siemExporter.Outlier(outlier)
+			})
+			if err != nil {
+				logger.Fatal("Failed to subscribe to outliers for SIEM export", zap.Error(err))
+			}
+		}
+
+		// Stream the monitor's transactions to clients subscribed to them
+		err = busConn.Subscribe(bus.SubjectTransactions, "", func(subject string, data []byte) {
+			var tx models.Transaction
+			if err := json.Unmarshal(data, &tx); err != nil {
+				logger.Error("Failed to decode transaction from bus", zap.Error(err))
+				return
+			}
+			hub.BroadcastTransaction(tx)
+		})
+		if err != nil {
+			logger.Fatal("Failed to subscribe to transactions", zap.Error(err))
+		}
+	}
+
+	// Role permissions, cached from the database
+	roleStore := security.NewRoleStore(db, security.RoleStoreConfig{
+		CacheTTL: cfg.Security.RoleCacheTTL,
+	}, logger)
+
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db, jwtManager, logger)
+	authHandler := handlers.NewAuthHandler(db, jwtManager, passwordManager, logger)
+	authHandler.SetLoginGuard(loginGuard)
+	authHandler.SetCipher(fieldCipher)
+	userHandler := handlers.NewUserHandler(db, passwordManager, logger)
+	userHandler.SetCipher(fieldCipher)
+	apiKeyHandler := handlers.NewAPIKeyHandler(db, roleStore, logger)
+	roleHandler := handlers.NewRoleHandler(roleStore, logger)
+	organizationHandler := handlers.NewOrganizationHandler(db, logger)
+	auditHandler := handlers.NewAuditHandler(db, auditLogger, logger)
+
+	// Move audit logs past retention to the archive store
+	if cfg.Security.AuditRetentionDays > 0 {
+		auditStore, err := archive.NewStore(cfg.Archive.Backend, archive.S3Config{
+			Endpoint:        cfg.Archive.Endpoint,
+			Region:          cfg.Archive.Region,
+			Bucket:          cfg.Archive.Bucket,
+			AccessKeyID:     cfg.Archive.AccessKeyID,
+			SecretAccessKey: cfg.Archive.SecretAccessKey,
+			Timeout:         cfg.Archive.Timeout,
+		}, cfg.Archive.Directory)
+		if err != nil {
+			logger.Fatal("Failed to create audit archive store", zap.Error(err))
+		}
+		auditArchiver := security.NewAuditArchiver(db, auditStore, auditLogger, security.AuditArchiverConfig{
+			Retention: time.Duration(cfg.Security.AuditRetentionDays) * 24 * time.Hour,
+			Prefix:    cfg.Security.AuditArchivePrefix,
+		}, logger.With(zap.String("component", "audit_archive")))
+		auditHandler.SetArchiver(auditArchiver)
+
+		archiveCtx, stopArchiving := context.WithCancel(context.Background())
+		defer stopArchiving()
+		go auditArchiver.Run(archiveCtx, cfg.Security.AuditArchiveInterval)
+	}
+
+	// Archive old acknowledged outliers out of default listings
+	if cfg.Detection.OutlierArchiveAfterDays > 0 {
+		severities := make([]models.Severity, len(cfg.Detection.OutlierArchiveSeverities))
+		for i, severity := range cfg.Detection.OutlierArchiveSeverities {
+			severities[i] = models.Severity(severity)
+		}
+		outlierArchiver := detection.NewOutlierArchiver(db, detection.OutlierArchiverConfig{
+			After:      time.Duration(cfg.Detection.OutlierArchiveAfterDays) * 24 * time.Hour,
+			Severities: severities,
+		}, logger.With(zap.String("component", "outlier_archive")))
+
+		outlierArchiveCtx, stopOutlierArchiving := context.WithCancel(context.Background())
+		defer stopOutlierArchiving()
+		go outlierArchiver.Run(outlierArchiveCtx, cfg.Detection.OutlierArchiveInterval)
+	}
+
+	// Email yesterday's summary each day through the alert SMTP server
+	reportGenerator := reports.NewGenerator(db, logger)
+	if cfg.Reports.Daily.Enabled {
+		mailer := notify.NewEmailNotifier(notify.EmailConfig{
+			Host:        cfg.Notify.Email.Host,
+			Port:        cfg.Notify.Email.Port,
+			ImplicitTLS: cfg.Notify.Email.ImplicitTLS,
+			Username:    cfg.Notify.Email.Username,
+			Password:    cfg.Notify.Email.Password,
+			From:        cfg.Notify.Email.From,
+			Timeout:     cfg.Notify.Email.Timeout,
+		}, logger.With(zap.String("component", "reports")))
+		reportScheduler := reports.NewScheduler(db, reportGenerator, mailer, reports.SchedulerConfig{
+			OrgID:        cfg.Reports.Daily.OrgID,
+			SendAt:       cfg.Reports.Daily.SendAfter(),
+			Recipients:   cfg.Reports.Daily.Recipients,
+			AttachPDF:    cfg.Reports.Daily.AttachPDF,
+			DashboardURL: cfg.Notify.DashboardURL,
+			Interval:     cfg.Reports.Daily.CheckInterval,
+			MaxAttempts:  cfg.Reports.Daily.MaxAttempts,
+		}, logger.With(zap.String("component", "reports")))
+
+		reportCtx, stopReports := context.WithCancel(context.Background())
+		defer stopReports()
+		go reportScheduler.Run(reportCtx)
+	}
+
 	outlierHandler := handlers.NewOutlierHandler(db, logger)
+	outlierHandler.SetCipher(fieldCipher)
+	outlierHandler.SetAuditLogger(auditLogger)
+	outlierHandler.SetAcknowledgeHook(func(orgID string, outlier models.Outlier) {
+		// Alerts for the shared detections page the default organization,
+		// which operates the instance, so only its triage closes them
+		if alertRouter != nil && (outlier.OrgID != "" || orgID == models.DefaultOrganizationID) {
+			alertRouter.Resolve(outlier)
+		}
+		if webhookDispatcher != nil {
+			webhookDispatcher.Resolved(orgID, outlier)
+		}
+	})
 	statisticsHandler := handlers.NewStatisticsHandler(db, raphtoryClient, logger)
+	reportHandler := handlers.NewReportHandler(reportGenerator, cfg.Notify.DashboardURL, logger)
+	issuerEventHandler := handlers.NewIssuerEventHandler(db, logger)
+	graphHandler := handlers.NewGraphHandler(db, raphtoryClient, logger)
+	transactionHandler := handlers.NewTransactionHandler(raphtoryClient, logger)
+	transactionHandler.SetAddressLabels(db)
+	addressHandler := handlers.NewAddressHandler(db, raphtoryClient, outlierHandler, logger)
+	if cfg.Enrichment.Enabled {
+		addressHandler.SetScreenings(enrichment.NewStore(db))
+	}
+	sarHandler := handlers.NewSARHandler(db, raphtoryClient, outlierHandler, logger)
+	sarHandler.SetAuditLogger(auditLogger)
+	watchlistHandler := handlers.NewWatchlistHandler(db, logger)
+	webhookHandler := handlers.NewWebhookHandler(db, logger)
+	webhookHandler.SetCipher(fieldCipher)
+	webhookHandler.SetAllowInsecureURLs(cfg.Webhooks.AllowInsecureURLs)
+	webhookHandler.SetAllowPrivateAddresses(cfg.Webhooks.AllowPrivateAddresses)
+	labelHandler := handlers.NewLabelHandler(db, logger)
+	featureHandler := handlers.NewFeatureHandler(featureFlags, logger)
 	healthHandler := handlers.NewHealthHandler(db, raphtoryClient, version, logger)
+
+	// Share the hub's status, and report every service's components, such
+	// as TronGrid ingestion and the detection loop, in /health
+	statusRegistry := health.NewRegistry(db, health.RegistryConfig{
+		StaleAfter: cfg.Monitoring.StatusStaleAfter,
+	}, logger)
+	healthHandler.SetStatusRegistry(statusRegistry)
+	statusCtx, stopStatus := context.WithCancel(context.Background())
+	defer stopStatus()
+	go statusRegistry.Publish(statusCtx, cfg.Monitoring.StatusInterval, "websocket", hubHealth(hub))
 	wsHandler := handlers.NewWebSocketHandler(hub, jwtManager, logger)
+	wsHandler.SetRoles(roleStore)
+	detectionHandler := handlers.NewDetectionHandler(db, detectionJobs, map[models.OutlierType]float64{
+		models.OutlierTypeZScore: cfg.Detection.ZScoreThreshold,
+		models.OutlierTypeIQR:    cfg.Detection.IQRMultiplier,
+		models.OutlierTypeDBSCAN: cfg.Detection.DBSCANEpsilon,
+	}, logger)
+	detectionHandler.SetSettingsStore(detectionSettings, anomalyDetector)
 
 	// Initialize middleware
 	authMiddleware := middleware.NewAuthMiddleware(jwtManager, logger)
+	authMiddleware.SetAPIKeys(security.NewAPIKeyManager(db, security.APIKeyConfig{
+		DefaultRateLimit: cfg.Security.APIKeyRateLimit,
+	}, logger))
 	rbacMiddleware := middleware.NewRBACMiddleware(logger)
+	rbacMiddleware.SetRoles(roleStore)
 	auditMiddleware := middleware.NewAuditMiddleware(auditLogger, logger)
+	// Outlier triage and watchlist mutations answer a retried
+	// Idempotency-Key from the first response instead of repeating it
+	idempotent := middleware.Idempotency(security.NewIdempotencyStore(db, security.IdempotencyConfig{
+		TTL: cfg.Security.IdempotencyTTL,
+	}, logger), logger)
+
+	// Rate limit each route group per IP and per user, in Redis when
+	// limits are shared across instances
+	var limiter ratelimit.Limiter = ratelimit.NewMemoryLimiter()
+	if cfg.RateLimit.Enabled && cfg.RateLimit.Backend == "redis" {
+		redisLimiter, err := ratelimit.NewRedisLimiter(ratelimit.RedisConfig{
+			URL:     cfg.RateLimit.RedisURL,
+			Prefix:  cfg.RateLimit.RedisPrefix,
+			Timeout: cfg.RateLimit.Timeout,
+		})
+		if err != nil {
+			logger.Fatal("Failed to create Redis rate limiter", zap.Error(err))
+		}
+		defer redisLimiter.Close()
+		limiter = redisLimiter
+	}
+	rateLimit := func(group string, rule config.RateLimitRule) gin.HandlerFunc {
+		limits := middleware.RateLimitConfig{Group: group}
+		if cfg.RateLimit.Enabled {
+			limits.PerIP = ratelimit.Rule{PerMinute: rule.PerIP, Burst: rule.PerIPBurst}
+			limits.PerUser = ratelimit.Rule{PerMinute: rule.PerUser, Burst: rule.PerUserBurst}
+		}
+		return middleware.RateLimit(limiter, limits, logger)
+	}
 
 	// Setup Gin
 	gin.SetMode(gin.ReleaseMode) // Production mode
 
 	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logger.Fatal("Failed to set trusted proxies", zap.Error(err))
+	}
 	router.Use(gin.Recovery())
-	router.Use(corsMiddleware())
+	router.Use(middleware.RequestID())
+	router.Use(middleware.Tracing())
+	router.Use(middleware.Metrics())
+	router.Use(middleware.SlowRequests(cfg.Monitoring.SlowRequestThreshold, logger))
+	router.Use(middleware.SecurityHeaders(middleware.SecurityHeadersConfig{
+		HSTSMaxAge:            cfg.Server.HSTSMaxAge,
+		ContentSecurityPolicy: cfg.Server.ContentSecurityPolicy,
+	}))
+	router.Use(middleware.CORS(middleware.CORSConfig{
+		AllowedOrigins: cfg.Server.CORSAllowedOrigins,
+		AllowedMethods: cfg.Server.CORSAllowedMethods,
+		MaxAge:         cfg.Server.CORSMaxAge,
+	}))
 
 	// Public routes
 	public := router.Group("/api/v1")
@@ -113,33 +606,183 @@ func main() {
 		router.GET("/liveness", healthHandler.GetLiveness)
 
 		// Authentication
-		public.POST("/auth/login", authHandler.Login)
-		public.POST("/auth/refresh", authHandler.RefreshToken)
+		auth := public.Group("/auth", rateLimit("auth", cfg.RateLimit.Auth))
+		auth.POST("/login", authHandler.Login)
+		auth.POST("/refresh", authHandler.RefreshToken)
+		auth.POST("/password/reset", authHandler.ResetPassword)
 	}
 
 	// Protected routes (require authentication)
 	protected := router.Group("/api/v1")
 	protected.Use(auditMiddleware.Log())
 	protected.Use(authMiddleware.Authenticate())
+	api := protected.Group("", rateLimit("api", cfg.RateLimit.API)) // Every route but outliers
 	{
-		// User profile
-		protected.GET("/auth/profile", authHandler.GetProfile)
+		// User profile (users only, not API keys)
+		api.GET("/auth/profile", rbacMiddleware.RequireUser(), authHandler.GetProfile)
+		api.POST("/auth/password", rbacMiddleware.RequireUser(), authHandler.ChangePassword)
+
+		// Outliers (all authenticated users, and API keys scoped to read:outliers)
+		outliers := protected.Group("/outliers", rateLimit("outliers", cfg.RateLimit.Outliers))
+		outliers.GET("", rbacMiddleware.RequirePermission(middleware.PermissionReadOutliers), outlierHandler.ListOutliers)
+		outliers.GET("/:id", rbacMiddleware.RequirePermission(middleware.PermissionReadOutliers), outlierHandler.GetOutlier)
 
-		// Outliers (all authenticated users can read)
-		protected.GET("/outliers", rbacMiddleware.RequireViewer(), outlierHandler.ListOutliers)
-		protected.GET("/outliers/:id", rbacMiddleware.RequireViewer(), outlierHandler.GetOutlier)
+		// Acknowledge outliers (analysts and admins, and API keys scoped to write:outliers)
+		outliers.POST("/:id/acknowledge", rbacMiddleware.RequirePermission(middleware.PermissionWriteOutliers), idempotent, outlierHandler.AcknowledgeOutlier)
+		outliers.POST("/acknowledge", rbacMiddleware.RequirePermission(middleware.PermissionWriteOutliers), idempotent, outlierHandler.BulkAcknowledgeOutliers)
 
-		// Acknowledge outliers (analysts and admins only)
-		protected.POST("/outliers/:id/acknowledge", rbacMiddleware.RequireAnalyst(), outlierHandler.AcknowledgeOutlier)
+		// Triage status workflow and its history
+		outliers.PATCH("/:id/status", rbacMiddleware.RequirePermission(middleware.PermissionWriteOutliers), idempotent, outlierHandler.UpdateOutlierStatus)
+		outliers.GET("/:id/history", rbacMiddleware.RequirePermission(middleware.PermissionReadOutliers), outlierHandler.GetOutlierStatusHistory)
+
+		// Assign outliers to analysts; list a queue with ?assigned_to=me
+		outliers.POST("/:id/assign", rbacMiddleware.RequirePermission(middleware.PermissionWriteOutliers), idempotent, outlierHandler.AssignOutlier)
+
+		// Archive outliers out of default listings; list them with ?archived=true
+		outliers.POST("/:id/archive", rbacMiddleware.RequirePermission(middleware.PermissionWriteOutliers), idempotent, outlierHandler.ArchiveOutlier)
+		outliers.POST("/archive", rbacMiddleware.RequirePermission(middleware.PermissionWriteOutliers), idempotent, outlierHandler.BulkArchiveOutliers)
+
+		// On-demand detection runs
+		api.POST("/detection/run", rbacMiddleware.RequirePermission(middleware.PermissionTriggerDetection), detectionHandler.RunDetection)
+		api.GET("/detection/run/:id", rbacMiddleware.RequirePermission(middleware.PermissionTriggerDetection), detectionHandler.GetDetectionJob)
+
+		// Detection run history
+		api.GET("/detection/runs", rbacMiddleware.RequirePermission(middleware.PermissionReadStatistics), detectionHandler.ListDetectionRuns)
+
+		// Detection tuning report from analyst feedback
+		api.GET("/detection/tuning", rbacMiddleware.RequirePermission(middleware.PermissionWriteOutliers), detectionHandler.GetTuningReport)
+
+		// Detection thresholds, windows and enabled detectors, applied without a restart
+		api.GET("/detection/config", rbacMiddleware.RequirePermission(middleware.PermissionManageSystem), detectionHandler.GetDetectionConfig)
+		api.PUT("/detection/config", rbacMiddleware.RequirePermission(middleware.PermissionManageSystem), detectionHandler.UpdateDetectionConfig)
 
 		// Statistics
-		protected.GET("/statistics", rbacMiddleware.RequireViewer(), statisticsHandler.GetStatistics)
-		protected.GET("/statistics/trends", rbacMiddleware.RequireViewer(), statisticsHandler.GetOutlierTrends)
+		api.GET("/statistics", rbacMiddleware.RequirePermission(middleware.PermissionReadStatistics), statisticsHandler.GetStatistics)
+		api.GET("/statistics/trends", rbacMiddleware.RequirePermission(middleware.PermissionReadStatistics), statisticsHandler.GetOutlierTrends)
+
+		// Daily digest reports
+		api.GET("/reports/daily", rbacMiddleware.RequirePermission(middleware.PermissionReadStatistics), reportHandler.GetDailyReport)
+
+		// Suspicious activity report drafts for compliance
+		api.GET("/reports/sar", rbacMiddleware.RequirePermission(middleware.PermissionExportSAR), sarHandler.GetSARDraft)
+
+		// Issuer blacklist, issue and redeem events
+		api.GET("/issuer-events", rbacMiddleware.RequirePermission(middleware.PermissionReadTransactions), issuerEventHandler.ListIssuerEvents)
+
+		// Transactions, read from the graph
+		api.GET("/transactions", rbacMiddleware.RequirePermission(middleware.PermissionReadTransactions), transactionHandler.ListTransactions)
+		api.GET("/transactions/:hash", rbacMiddleware.RequirePermission(middleware.PermissionReadTransactions), transactionHandler.GetTransaction)
+
+		// Everything known about an address
+		api.GET("/addresses/:address", rbacMiddleware.RequirePermission(middleware.PermissionReadOutliers), addressHandler.GetAddressProfile)
+
+		// GraphQL over outliers, transactions, addresses and statistics.
+		// Each field checks the permission of the route it mirrors.
+		if cfg.Server.GraphQLEnabled {
+			graphQLHandler := handlers.NewGraphQLHandler(db, raphtoryClient, outlierHandler, rbacMiddleware, logger)
+			graphQLHandler.SetLimits(cfg.Server.GraphQLMaxDepth, cfg.Server.GraphQLMaxResolves)
+			api.POST("/graphql", graphQLHandler.Query)
+			api.GET("/graphql/schema", graphQLHandler.GetSchema)
+		}
+
+		// Watchlists, alerted on by the detector
+		watchlists := api.Group("/watchlists")
+		{
+			watchlists.GET("", rbacMiddleware.RequirePermission(middleware.PermissionReadOutliers), watchlistHandler.ListWatchlists)
+			watchlists.POST("", rbacMiddleware.RequirePermission(middleware.PermissionWriteOutliers), idempotent, watchlistHandler.CreateWatchlist)
+			watchlists.GET("/:id", rbacMiddleware.RequirePermission(middleware.PermissionReadOutliers), watchlistHandler.GetWatchlist)
+			watchlists.PATCH("/:id", rbacMiddleware.RequirePermission(middleware.PermissionWriteOutliers), idempotent, watchlistHandler.UpdateWatchlist)
+			watchlists.DELETE("/:id", rbacMiddleware.RequirePermission(middleware.PermissionWriteOutliers), idempotent, watchlistHandler.DeleteWatchlist)
+			watchlists.POST("/:id/entries", rbacMiddleware.RequirePermission(middleware.PermissionWriteOutliers), idempotent, watchlistHandler.AddWatchlistEntry)
+			watchlists.PUT("/:id/entries/:entry_id", rbacMiddleware.RequirePermission(middleware.PermissionWriteOutliers), idempotent, watchlistHandler.UpdateWatchlistEntry)
+			watchlists.DELETE("/:id/entries/:entry_id", rbacMiddleware.RequirePermission(middleware.PermissionWriteOutliers), idempotent, watchlistHandler.RemoveWatchlistEntry)
+		}
+
+		// Webhooks the organization's events are posted to
+		if cfg.Webhooks.Enabled {
+			webhooks := api.Group("/webhooks")
+			{
+				webhooks.GET("", rbacMiddleware.RequirePermission(middleware.PermissionManageWebhooks), webhookHandler.ListWebhooks)
+				webhooks.POST("", rbacMiddleware.RequirePermission(middleware.PermissionManageWebhooks), idempotent, webhookHandler.CreateWebhook)
+				webhooks.GET("/:id", rbacMiddleware.RequirePermission(middleware.PermissionManageWebhooks), webhookHandler.GetWebhook)
+				webhooks.PATCH("/:id", rbacMiddleware.RequirePermission(middleware.PermissionManageWebhooks), idempotent, webhookHandler.UpdateWebhook)
+				webhooks.DELETE("/:id", rbacMiddleware.RequirePermission(middleware.PermissionManageWebhooks), idempotent, webhookHandler.DeleteWebhook)
+				webhooks.POST("/:id/rotate-secret", rbacMiddleware.RequirePermission(middleware.PermissionManageWebhooks), idempotent, webhookHandler.RotateWebhookSecret)
+				webhooks.GET("/:id/deliveries", rbacMiddleware.RequirePermission(middleware.PermissionManageWebhooks), webhookHandler.ListWebhookDeliveries)
+			}
+		}
+
+		// Known-entity address labels
+		labels := api.Group("/labels")
+		{
+			labels.GET("", rbacMiddleware.RequirePermission(middleware.PermissionReadOutliers), labelHandler.ListLabels)
+			labels.POST("/import", rbacMiddleware.RequirePermission(middleware.PermissionWriteOutliers), labelHandler.ImportLabels)
+			labels.GET("/:address", rbacMiddleware.RequirePermission(middleware.PermissionReadOutliers), labelHandler.GetLabel)
+			labels.PUT("/:address", rbacMiddleware.RequirePermission(middleware.PermissionWriteOutliers), labelHandler.SetLabel)
+			labels.DELETE("/:address", rbacMiddleware.RequirePermission(middleware.PermissionWriteOutliers), labelHandler.DeleteLabel)
+		}
+
+		// Transaction graph around an address
+		api.GET("/graph/subgraph", rbacMiddleware.RequirePermission(middleware.PermissionReadTransactions), graphHandler.GetSubgraph)
+
+		// User management
+		api.GET("/users", rbacMiddleware.RequirePermission(middleware.PermissionReadUsers), userHandler.ListUsers)
+		api.POST("/users", rbacMiddleware.RequirePermission(middleware.PermissionManageUsers), userHandler.CreateUser)
+		api.GET("/users/:id", rbacMiddleware.RequirePermission(middleware.PermissionReadUsers), userHandler.GetUser)
+		api.PUT("/users/:id", rbacMiddleware.RequirePermission(middleware.PermissionManageUsers), userHandler.UpdateUser)
+		api.DELETE("/users/:id", rbacMiddleware.RequirePermission(middleware.PermissionManageUsers), userHandler.DeleteUser)
+		api.POST("/users/:id/password-reset", rbacMiddleware.RequirePermission(middleware.PermissionManageUsers), userHandler.IssuePasswordReset)
+
+		// Roles and their permissions
+		api.GET("/roles", rbacMiddleware.RequirePermission(middleware.PermissionReadUsers), roleHandler.ListRoles)
+		api.POST("/roles", rbacMiddleware.RequirePermission(middleware.PermissionManageSystem), roleHandler.CreateRole)
+		api.GET("/roles/:name", rbacMiddleware.RequirePermission(middleware.PermissionReadUsers), roleHandler.GetRole)
+		api.PUT("/roles/:name", rbacMiddleware.RequirePermission(middleware.PermissionManageSystem), roleHandler.UpdateRole)
+		api.DELETE("/roles/:name", rbacMiddleware.RequirePermission(middleware.PermissionManageSystem), roleHandler.DeleteRole)
+
+		// Organizations; only the default organization manages them
+		api.GET("/organization", organizationHandler.GetCurrentOrganization)
+		api.GET("/organizations", rbacMiddleware.RequirePermission(middleware.PermissionManageSystem), organizationHandler.ListOrganizations)
+		api.POST("/organizations", rbacMiddleware.RequirePermission(middleware.PermissionManageSystem), organizationHandler.CreateOrganization)
+
+		// API keys for automated consumers
+		api.GET("/api-keys", rbacMiddleware.RequirePermission(middleware.PermissionManageUsers), apiKeyHandler.ListAPIKeys)
+		api.POST("/api-keys", rbacMiddleware.RequirePermission(middleware.PermissionManageUsers), apiKeyHandler.CreateAPIKey)
+		api.GET("/api-keys/:id", rbacMiddleware.RequirePermission(middleware.PermissionManageUsers), apiKeyHandler.GetAPIKey)
+		api.PUT("/api-keys/:id", rbacMiddleware.RequirePermission(middleware.PermissionManageUsers), apiKeyHandler.UpdateAPIKey)
+		api.DELETE("/api-keys/:id", rbacMiddleware.RequirePermission(middleware.PermissionManageUsers), apiKeyHandler.DeleteAPIKey)
+
+		// Feature flags
+		api.GET("/features", rbacMiddleware.RequirePermission(middleware.PermissionReadOutliers), featureHandler.ListFeatures)
+		api.GET("/features/:name", rbacMiddleware.RequirePermission(middleware.PermissionReadOutliers), featureHandler.GetFeature)
+		api.PUT("/features/:name", rbacMiddleware.RequirePermission(middleware.PermissionManageSystem), featureHandler.SetFeature)
+		api.DELETE("/features/:name", rbacMiddleware.RequirePermission(middleware.PermissionManageSystem), featureHandler.ResetFeature)
+
+		// Audit log
+		api.GET("/audit", rbacMiddleware.RequirePermission(middleware.PermissionReadAudit), auditHandler.ListAuditLogs)
+		api.GET("/audit/export", rbacMiddleware.RequirePermission(middleware.PermissionReadAudit), auditHandler.ExportAuditLogs)
+		api.GET("/audit/verify", rbacMiddleware.RequirePermission(middleware.PermissionReadAudit), auditHandler.VerifyAuditChain)
+		api.GET("/audit/archives", rbacMiddleware.RequirePermission(middleware.PermissionReadAudit), auditHandler.ListAuditArchives)
+		api.POST("/audit/archive", rbacMiddleware.RequirePermission(middleware.PermissionManageSystem), auditHandler.ArchiveAuditLogs)
+
+		// WebSocket clients connected to this instance, and closing them
+		api.GET("/admin/ws/connections", rbacMiddleware.RequirePermission(middleware.PermissionManageSystem), wsHandler.ListConnections)
+		api.DELETE("/admin/ws/connections", rbacMiddleware.RequirePermission(middleware.PermissionManageSystem), wsHandler.DisconnectUserConnections)
+		api.DELETE("/admin/ws/connections/:id", rbacMiddleware.RequirePermission(middleware.PermissionManageSystem), wsHandler.DisconnectConnection)
 
 		// WebSocket (authenticated)
 		router.GET("/api/v1/ws", wsHandler.HandleWebSocket)
 	}
 
+	// API documentation, generated from the routes registered above
+	openAPIHandler := handlers.NewOpenAPIHandler(router.Routes, version, logger)
+	router.GET("/api/v1/openapi.json", openAPIHandler.GetOpenAPI)
+	if cfg.Server.SwaggerUIEnabled {
+		openAPIHandler.SetSwaggerUI(cfg.Server.SwaggerUIAssetsURL)
+		router.GET("/api/v1/docs", openAPIHandler.GetSwaggerUI)
+		router.GET("/api/v1/docs/init.js", openAPIHandler.GetSwaggerUIInit)
+	}
+
 	// Start HTTP server
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Server.APIPort),
@@ -149,16 +792,54 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// Serve HTTPS when enabled, reloading the certificate when it is renewed
+	if cfg.Security.TLSEnabled {
+		certReloader, err := security.NewCertReloader(security.CertReloaderConfig{
+			CertFile: cfg.Security.TLSCertFile,
+			KeyFile:  cfg.Security.TLSKeyFile,
+		}, logger)
+		if err != nil {
+			logger.Fatal("Failed to load TLS certificate", zap.Error(err))
+		}
+		srv.TLSConfig = security.ServerTLSConfig(certReloader)
+	}
+
 	// Start server in goroutine
 	go func() {
 		logger.Info("API server listening",
-			zap.Int("port", cfg.Server.APIPort))
+			zap.Int("port", cfg.Server.APIPort),
+			zap.Bool("tls", cfg.Security.TLSEnabled))
 
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if srv.TLSConfig != nil {
+			// The certificate comes from TLSConfig
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Fatal("Failed to start server", zap.Error(err))
 		}
 	}()
 
+	// Serve pprof and expvar runtime state on a separate, private listener
+	if cfg.Monitoring.DiagnosticsEnabled {
+		diagnostics.Publish("websocket_hub", func() interface{} {
+			return map[string]interface{}{"clients": hub.ClientCount()}
+		})
+		diagnostics.Publish("detection_jobs", func() interface{} {
+			return map[string]interface{}{"running": detectionJobs.Running()}
+		})
+		diagnosticsServer := diagnostics.StartServer(cfg.Monitoring.DiagnosticsAddress, logger)
+		defer diagnosticsServer.Close()
+	}
+
+	// Serve Prometheus metrics on their own port
+	var metricsServer *http.Server
+	if cfg.Monitoring.Enabled {
+		metricsServer = metrics.StartServer(cfg.Monitoring.MetricsPort, nil, logger)
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -173,12 +854,418 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		logger.Error("Server forced to shutdown", zap.Error(err))
 	}
+	if metricsServer != nil {
+		metricsServer.Shutdown(ctx)
+	}
 
 	logger.Info("Server shutdown complete")
 }
 
+// newDetectorConfig maps detection settings onto the anomaly detector config
+// verifyAuditChain prints the audit chain report as JSON, returning whether
+// the chain is intact
+// broadcastingRunRecorder records detection runs and tells admins about
+// the ones that failed
+type broadcastingRunRecorder struct {
+	detection.RunRecorder
+	hub *websocket.Hub
+}
+
+// RecordRun implements detection.RunRecorder
+func (r *broadcastingRunRecorder) RecordRun(ctx context.Context, run *models.DetectionRun) error {
+	if run.Status == models.DetectionRunFailed {
+		r.hub.BroadcastOperational("detection_failed", map[string]interface{}{
+			"run_id":  run.ID,
+			"trigger": run.Trigger,
+			"error":   run.Error,
+		})
+	}
+	return r.RunRecorder.RecordRun(ctx, run)
+}
+
+// hubHealth reports the WebSocket hub's connected clients. The hub has no
+// failure state of its own, so it is always healthy while the API runs.
+func hubHealth(hub *websocket.Hub) health.CheckFunc {
+	return func(ctx context.Context) api.ServiceStatus {
+		return api.ServiceStatus{
+			Healthy: true,
+			Message: "ok",
+			Details: map[string]interface{}{"client_count": hub.ClientCount()},
+		}
+	}
+}
+
+func verifyAuditChain(auditLogger *security.AuditLogger, logger *zap.Logger) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	report, err := auditLogger.VerifyChain(ctx)
+	if err != nil {
+		logger.Error("Failed to verify audit chain", zap.Error(err))
+		return false
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+	return report.Valid
+}
+
+// newMigrator creates a migrator for the embedded Postgres migrations that
+// records those it applies in the audit log
+func newMigrator(db *sql.DB, auditLogger *security.AuditLogger, logger *zap.Logger) (*migrate.Migrator, error) {
+	fsys, err := fs.Sub(migrations.Postgres, "postgres")
+	if err != nil {
+		return nil, err
+	}
+	migrator, err := migrate.New(db, fsys, migrate.Config{AdvisoryLock: true}, logger)
+	if err != nil {
+		return nil, err
+	}
+	migrator.SetAuditLogger(auditLogger)
+	return migrator, nil
+}
+
+// autoMigrate applies the migrations the database has not run
+func autoMigrate(db *sql.DB, auditLogger *security.AuditLogger, logger *zap.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	migrator, err := newMigrator(db, auditLogger, logger)
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Info("Database schema is up to date",
+		zap.Int("applied", applied),
+		zap.Int("migrations", len(migrator.Migrations())))
+	return nil
+}
+
+// runMigrate runs the migrate subcommand: up (the default) applies pending
+// migrations, status lists them, and baseline VERSION records those up to
+// VERSION as applied without running them
+func runMigrate(db *sql.DB, auditLogger *security.AuditLogger, args []string, logger *zap.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	migrator, err := newMigrator(db, auditLogger, logger)
+	if err != nil {
+		return err
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migration(s)\n", applied)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			if status.Modified {
+				state += " (modified since)"
+			}
+			fmt.Printf("%-40s %s\n", status.Name, state)
+		}
+	case "baseline":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: migrate baseline VERSION")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		recorded, err := migrator.Baseline(ctx, version)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Recorded %d migration(s) as applied\n", recorded)
+	default:
+		return fmt.Errorf("unknown migrate command %q (want up, status or baseline)", command)
+	}
+	return nil
+}
+
+// newFeatureFlags creates the feature flags, loading those saved through
+// the API once before returning
+func newFeatureFlags(ctx context.Context, cfg config.FeaturesConfig, db *sql.DB, logger *zap.Logger) *features.Flags {
+	flags := features.New(db, features.Config{
+		Environment:     cfg.Environment,
+		Defaults:        cfg.Flags,
+		RefreshInterval: cfg.RefreshInterval,
+	}, logger)
+	if err := flags.Refresh(ctx); err != nil {
+		logger.Error("Failed to load feature flags, using the configured values", zap.Error(err))
+	}
+	go flags.Run(ctx)
+	return flags
+}
+
+// newAddressLabels creates the address label store detection applies to
+// outliers, loading the labels once before returning
+func newAddressLabels(ctx context.Context, cfg config.DetectionConfig, db *sql.DB, logger *zap.Logger) *detection.AddressLabels {
+	labelsConfig := detection.AddressLabelsConfig{RefreshInterval: cfg.LabelsRefreshInterval}
+	for _, category := range cfg.LabelExemptCategories {
+		labelsConfig.ExemptCategories = append(labelsConfig.ExemptCategories, models.LabelCategory(category))
+	}
+	for _, category := range cfg.LabelEscalateCategories {
+		labelsConfig.EscalateCategories = append(labelsConfig.EscalateCategories, models.LabelCategory(category))
+	}
+
+	labels := detection.NewAddressLabels(db, labelsConfig, logger)
+	if err := labels.Refresh(ctx); err != nil {
+		logger.Error("Failed to load address labels, retrying in the background", zap.Error(err))
+	}
+	go labels.Run(ctx)
+	return labels
+}
+
+// newEnricher creates the enricher screening outliers' addresses with the
+// configured chain-analytics API, caching screenings in screenings when it
+// is not nil
+func newEnricher(cfg config.EnrichmentConfig, screenings *enrichment.Store, logger *zap.Logger) *enrichment.Enricher {
+	provider, err := enrichment.NewHTTPProvider(enrichment.HTTPConfig{
+		Name:          cfg.Provider,
+		URL:           cfg.URL,
+		Body:          cfg.Body,
+		APIKeyHeader:  cfg.APIKeyHeader,
+		APIKey:        cfg.APIKey,
+		CategoryField: cfg.CategoryField,
+		RiskField:     cfg.RiskField,
+		EntityField:   cfg.EntityField,
+		Timeout:       cfg.Timeout,
+	})
+	if err != nil {
+		logger.Fatal("Invalid enrichment configuration", zap.Error(err))
+	}
+	return enrichment.NewEnricher(provider, screenings, enrichment.Config{
+		CacheTTL:     cfg.CacheTTL,
+		Concurrency:  cfg.Concurrency,
+		MaxAddresses: cfg.MaxAddresses,
+	}, logger.With(zap.String("component", "enrichment")))
+}
+
+// newAlertRouter creates the router sending outliers to notification
+// channels, loading watchlists first if a rule needs them. Batched email
+// digests are sent when ctx is done.
+func newAlertRouter(ctx context.Context, cfg config.NotifyConfig, db *sql.DB, logger *zap.Logger) *notify.Router {
+	rules := make([]notify.Rule, len(cfg.Rules))
+	watchlisted := false
+	for i, rule := range cfg.Rules {
+		rules[i] = notify.Rule{
+			Name:        rule.Name,
+			MinSeverity: models.Severity(rule.MinSeverity),
+			Watchlisted: rule.Watchlisted,
+			Channels:    rule.Channels,
+		}
+		for _, t := range rule.Types {
+			rules[i].Types = append(rules[i].Types, models.OutlierType(t))
+		}
+		watchlisted = watchlisted || rule.Watchlisted
+	}
+
+	retryPolicy := notify.RetryPolicy{MaxRetries: cfg.MaxRetries, RetryDelay: cfg.RetryDelay}
+	notifiers := []notify.Notifier{notify.NewLogNotifier(logger)}
+	if cfg.Email.Enabled {
+		recipients := make(map[models.Severity][]string, len(cfg.Email.Recipients))
+		for severity, addresses := range cfg.Email.Recipients {
+			recipients[models.Severity(severity)] = addresses
+		}
+		email := notify.NewEmailNotifier(notify.EmailConfig{
+			Host:              cfg.Email.Host,
+			Port:              cfg.Email.Port,
+			ImplicitTLS:       cfg.Email.ImplicitTLS,
+			Username:          cfg.Email.Username,
+			Password:          cfg.Email.Password,
+			From:              cfg.Email.From,
+			Recipients:        recipients,
+			DefaultRecipients: cfg.Email.DefaultRecipients,
+			DashboardURL:      cfg.DashboardURL,
+			BatchWindow:       cfg.Email.BatchWindow,
+			ImmediateSeverity: models.Severity(cfg.Email.ImmediateSeverity),
+			Retry:             retryPolicy,
+			Timeout:           cfg.Email.Timeout,
+		}, logger.With(zap.String("channel", "email")))
+		go email.Run(ctx)
+		notifiers = append(notifiers, email)
+	}
+	if cfg.PagerDuty.Enabled {
+		routingKeys := make(map[models.Severity]string, len(cfg.PagerDuty.RoutingKeys))
+		for severity, key := range cfg.PagerDuty.RoutingKeys {
+			routingKeys[models.Severity(severity)] = key
+		}
+		notifiers = append(notifiers, notify.NewPagerDutyNotifier(notify.PagerDutyConfig{
+			EventsURL:    cfg.PagerDuty.EventsURL,
+			RoutingKey:   cfg.PagerDuty.RoutingKey,
+			RoutingKeys:  routingKeys,
+			MinSeverity:  models.Severity(cfg.PagerDuty.MinSeverity),
+			DashboardURL: cfg.DashboardURL,
+			Timeout:      cfg.PagerDuty.Timeout,
+		}, logger.With(zap.String("channel", "pagerduty"))))
+	}
+	if cfg.Opsgenie.Enabled {
+		priorities := make(map[models.Severity]string, len(cfg.Opsgenie.Priorities))
+		for severity, priority := range cfg.Opsgenie.Priorities {
+			priorities[models.Severity(severity)] = priority
+		}
+		responders := make([]notify.OpsgenieResponder, len(cfg.Opsgenie.Responders))
+		for i, responder := range cfg.Opsgenie.Responders {
+			responders[i] = notify.OpsgenieResponder{Type: responder.Type, Name: responder.Name}
+		}
+		notifiers = append(notifiers, notify.NewOpsgenieNotifier(notify.OpsgenieConfig{
+			APIURL:       cfg.Opsgenie.APIURL,
+			APIKey:       cfg.Opsgenie.APIKey,
+			Responders:   responders,
+			Priorities:   priorities,
+			MinSeverity:  models.Severity(cfg.Opsgenie.MinSeverity),
+			DashboardURL: cfg.DashboardURL,
+			Timeout:      cfg.Opsgenie.Timeout,
+		}, logger.With(zap.String("channel", "opsgenie"))))
+	}
+	if cfg.Telegram.Enabled {
+		chats := make([]notify.TelegramChat, len(cfg.Telegram.Chats))
+		for i, chat := range cfg.Telegram.Chats {
+			chats[i] = notify.TelegramChat{ID: chat.ID, MinSeverity: models.Severity(chat.MinSeverity)}
+		}
+		notifiers = append(notifiers, notify.NewTelegramNotifier(notify.TelegramConfig{
+			APIURL:       cfg.Telegram.APIURL,
+			BotToken:     cfg.Telegram.BotToken,
+			Chats:        chats,
+			ChatRate:     ratelimit.Rule{PerMinute: cfg.Telegram.ChatRatePerMinute, Burst: cfg.Telegram.ChatRateBurst},
+			Rate:         ratelimit.Rule{PerMinute: cfg.Telegram.RatePerMinute, Burst: cfg.Telegram.RateBurst},
+			DashboardURL: cfg.DashboardURL,
+			Timeout:      cfg.Telegram.Timeout,
+		}, logger.With(zap.String("channel", "telegram"))))
+	}
+
+	router, err := notify.NewRouter(notify.RouterConfig{
+		Rules:       rules,
+		Retry:       retryPolicy,
+		DedupWindow: cfg.DedupWindow,
+		Throttle:    ratelimit.Rule{PerMinute: cfg.RatePerMinute, Burst: cfg.RateBurst},
+		QueueSize:   cfg.QueueSize,
+	}, notifiers, logger)
+	if err != nil {
+		logger.Fatal("Invalid notification rules", zap.Error(err))
+	}
+
+	if watchlisted {
+		watchlist := detection.NewWatchlistMatcher(db, detection.WatchlistConfig{}, logger)
+		if err := watchlist.Refresh(ctx); err != nil {
+			logger.Error("Failed to load watchlists, retrying in the background", zap.Error(err))
+		}
+		go watchlist.Run(ctx)
+		router.SetWatchlist(watchlist)
+	}
+	router.SetIncidents(detection.NewOutlierStore(db, logger))
+	return router
+}
+
+// newSIEMExporter creates the exporter forwarding outliers and audit log
+// entries to the SIEM
+func newSIEMExporter(cfg config.SIEMConfig, logger *zap.Logger) *siem.Exporter {
+	tlsConfig, err := security.ClientTLSConfig(security.ClientTLSFiles{
+		CertFile: cfg.TLSCertFile,
+		KeyFile:  cfg.TLSKeyFile,
+		CAFile:   cfg.TLSCAFile,
+	}, logger)
+	if err != nil {
+		logger.Fatal("Failed to load SIEM TLS configuration", zap.Error(err))
+	}
+
+	exporter, err := siem.NewExporter(siem.Config{
+		Transport: siem.Transport(cfg.Transport),
+		Network:   cfg.Network,
+		Address:   cfg.Address,
+		Facility:  cfg.Facility,
+		Hostname:  cfg.Hostname,
+		URL:       cfg.URL,
+		Headers:   cfg.Headers,
+		TLS:       tlsConfig,
+		Timeout:   cfg.Timeout,
+		Outliers: siem.EventConfig{
+			Enabled:     cfg.Outliers.Enabled,
+			Format:      siem.Format(cfg.Outliers.Format),
+			MinSeverity: models.Severity(cfg.Outliers.MinSeverity),
+		},
+		Audit: siem.EventConfig{
+			Enabled: cfg.Audit.Enabled,
+			Format:  siem.Format(cfg.Audit.Format),
+			Actions: cfg.Audit.Actions,
+		},
+		ProductVersion: version,
+		MaxRetries:     cfg.MaxRetries,
+		RetryDelay:     cfg.RetryDelay,
+		QueueSize:      cfg.QueueSize,
+		BatchSize:      cfg.BatchSize,
+	}, logger)
+	if err != nil {
+		logger.Fatal("Invalid SIEM configuration", zap.Error(err))
+	}
+	return exporter
+}
+
+func newDetectorConfig(cfg config.DetectionConfig) detection.AnomalyDetectorConfig {
+	return detection.AnomalyDetectorConfig{
+		Interval:        cfg.Interval,
+		MaxTransactions: cfg.MaxTransactions,
+		Shards:          cfg.Shards,
+		Workers:         cfg.Workers,
+		ZScoreConfig: detection.ZScoreConfig{
+			Threshold:      cfg.ZScoreThreshold,
+			MinDataPoints:  cfg.MinDataPoints,
+			WindowDuration: cfg.WindowDuration,
+		},
+		IQRConfig: detection.IQRConfig{
+			Multiplier:     cfg.IQRMultiplier,
+			MinDataPoints:  cfg.MinDataPoints,
+			WindowDuration: cfg.WindowDuration,
+			Streaming:      cfg.IQRStreaming,
+		},
+		DBSCANEnabled: cfg.DBSCANEnabled,
+		DBSCANConfig: detection.DBSCANConfig{
+			Epsilon:        cfg.DBSCANEpsilon,
+			MinPoints:      cfg.DBSCANMinPoints,
+			MinAddresses:   cfg.MinDataPoints,
+			MaxAddresses:   cfg.DBSCANMaxAddresses,
+			WindowDuration: cfg.WindowDuration,
+		},
+		PatternDetectorConfig: detection.PatternDetectorConfig{
+			CirculationWindow: cfg.CirculationWindow,
+			FanOutThreshold:   cfg.FanOutThreshold,
+			FanInThreshold:    cfg.FanInThreshold,
+			DormancyPeriod:    cfg.DormancyPeriod,
+			VelocityWindow:    cfg.VelocityWindow,
+			VelocityThreshold: cfg.VelocityThreshold,
+			IgnoreUnconfirmed: cfg.IgnoreUnconfirmed,
+			ClusterWindow:     cfg.ClusterWindow,
+			ClusterMinSize:    cfg.ClusterMinSize,
+			ClusterMinDensity: cfg.ClusterMinDensity,
+			FanWindow:         cfg.FanWindow,
+		},
+		IgnoreUnconfirmed: cfg.IgnoreUnconfirmed,
+		TagNodes:          cfg.TagGraphNodes,
+	}
+}
+
 // connectDatabase establishes database connection with retry logic
-func connectDatabase(cfg config.DatabaseConfig, logger *zap.Logger) (*sql.DB, error) {
+func connectDatabase(cfg config.DatabaseConfig, slowQueryThreshold time.Duration, logger *zap.Logger) (*sql.DB, error) {
 	dsn := fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Database, cfg.SSLMode,
@@ -189,7 +1276,7 @@ func connectDatabase(cfg config.DatabaseConfig, logger *zap.Logger) (*sql.DB, er
 
 	// Retry connection up to 5 times
 	for i := 0; i < 5; i++ {
-		db, err = sql.Open("postgres", dsn)
+		db, err = tracing.OpenDB("postgres", dsn, tracing.WithSlowQueryLog(slowQueryThreshold, logger))
 		if err != nil {
 			logger.Warn("Failed to open database connection",
 				zap.Error(err),
@@ -225,20 +1312,3 @@ func connectDatabase(cfg config.DatabaseConfig, logger *zap.Logger) (*sql.DB, er
 
 	return nil, fmt.Errorf("failed to connect to database after 5 attempts: %w", err)
 }
-
-// corsMiddleware adds CORS headers
-func corsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-
-		c.Next()
-	}
-}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/bus"
+	"github.com/mikedewar/stablerisk/internal/config"
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/internal/diagnostics"
+	"github.com/mikedewar/stablerisk/internal/enrichment"
+	"github.com/mikedewar/stablerisk/internal/features"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/internal/health"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/internal/sink"
+	"github.com/mikedewar/stablerisk/internal/tracing"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/mikedewar/stablerisk/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	serviceName = "stablerisk-detector"
+	version     = "0.1.0"
+)
+
+func main() {
+	// Load configuration
+	cfg, err := config.Load("")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize logger
+	logger, err := utils.NewLogger(utils.LoggerConfig{
+		Level:      cfg.Logging.Level,
+		Format:     cfg.Logging.Format,
+		OutputPath: cfg.Logging.OutputPath,
+		ErrorPath:  cfg.Logging.ErrorPath,
+		Rotation: utils.RotationConfig{
+			MaxSizeMB:  cfg.Logging.MaxSizeMB,
+			MaxAge:     cfg.Logging.MaxAge,
+			MaxBackups: cfg.Logging.MaxBackups,
+			Compress:   cfg.Logging.Compress,
+		},
+		SampleInitial:    cfg.Logging.SamplingInitial,
+		SampleThereafter: cfg.Logging.SamplingThereafter,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer logger.Sync()
+
+	logger.Info("Starting detector service",
+		zap.String("service", serviceName),
+		zap.String("version", version),
+		zap.Duration("interval", cfg.Detection.Interval),
+		zap.Bool("bus_enabled", cfg.Bus.Enabled))
+
+	// Export traces when enabled; queued spans are flushed on exit
+	if cfg.Monitoring.TracingEnabled {
+		shutdownTracing := tracing.Init(tracing.Config{
+			ServiceName: serviceName,
+			Endpoint:    cfg.Monitoring.TracingEndpoint,
+			SampleRatio: cfg.Monitoring.TracingSampleRatio,
+		}, logger)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				logger.Warn("Failed to flush traces", zap.Error(err))
+			}
+		}()
+	}
+
+	// Create context for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Initialize Raphtory client
+	raphtoryTLS, err := security.ClientTLSConfig(security.ClientTLSFiles{
+		CertFile: cfg.Raphtory.TLSCertFile,
+		KeyFile:  cfg.Raphtory.TLSKeyFile,
+		CAFile:   cfg.Raphtory.TLSCAFile,
+	}, logger)
+	if err != nil {
+		logger.Fatal("Failed to load Raphtory TLS configuration", zap.Error(err))
+	}
+	raphtoryClient := graph.NewRaphtoryClient(graph.RaphtoryConfig{
+		BaseURL:          cfg.Raphtory.BaseURL,
+		Timeout:          cfg.Raphtory.Timeout,
+		MaxRetries:       cfg.Raphtory.MaxRetries,
+		RetryDelay:       cfg.Raphtory.RetryDelay,
+		FailureThreshold: cfg.Raphtory.CircuitFailureThreshold,
+		OpenTimeout:      cfg.Raphtory.CircuitOpenTimeout,
+		Transport:        cfg.Raphtory.Transport,
+		GraphName:        cfg.Raphtory.GraphName,
+		TLS:              raphtoryTLS,
+	}, logger)
+
+	anomalyDetector := detection.NewAnomalyDetector(newDetectorConfig(cfg.Detection), raphtoryClient, logger)
+
+	// Record scheduled runs alongside the API's on-demand runs
+	db, err := openDatabase(cfg, logger)
+	if err != nil {
+		logger.Warn("Database unavailable, detection runs will not be recorded",
+			zap.Error(err))
+	} else {
+		defer db.Close()
+		anomalyDetector.SetRunRecorder(detection.NewRunStore(db, logger))
+		if cfg.Detection.LabelsEnabled {
+			anomalyDetector.SetAddressLabels(newAddressLabels(ctx, cfg.Detection, db, logger))
+		}
+		// Settings saved through the API override the file configuration
+		// and are applied between cycles as they change
+		detectionSettings := detection.NewSettingsStore(db, logger)
+		if err := detectionSettings.Sync(ctx, anomalyDetector); err != nil {
+			logger.Error("Failed to load detection settings, using the file configuration", zap.Error(err))
+		}
+		go detectionSettings.Watch(ctx, anomalyDetector, cfg.Detection.ConfigRefreshInterval)
+	}
+
+	// Screen outliers' addresses with a chain-analytics API, caching the
+	// screenings in memory only without the database
+	if cfg.Enrichment.Enabled {
+		var screenings *enrichment.Store
+		if db != nil {
+			screenings = enrichment.NewStore(db)
+		}
+		anomalyDetector.SetEnricher(newEnricher(cfg.Enrichment, screenings, logger))
+	}
+
+	// Feature flags gating experimental capabilities; without the database
+	// only the configured values apply
+	featureFlags := newFeatureFlags(ctx, cfg.Features, db, logger)
+	anomalyDetector.SetFeatureFlags(featureFlags)
+
+	// Publish outliers to the bus for the API to broadcast
+	if cfg.Bus.Enabled {
+		busConn, err := bus.Connect(ctx, bus.Config{
+			URL:            cfg.Bus.URL,
+			Token:          cfg.Bus.Token,
+			Name:           serviceName,
+			Stream:         cfg.Bus.Stream,
+			MaxAge:         cfg.Bus.MaxAge,
+			PublishTimeout: cfg.Bus.PublishTimeout,
+			ReconnectWait:  cfg.Bus.ReconnectWait,
+		}, logger.With(zap.String("component", "bus")))
+		if err != nil {
+			logger.Fatal("Failed to connect to message bus", zap.Error(err))
+		}
+		defer busConn.Close()
+
+		if err := busConn.EnsureStream(ctx); err != nil {
+			logger.Fatal("Failed to create message bus stream", zap.Error(err))
+		}
+		anomalyDetector.SetOutlierPublisher(busConn)
+
+		// Mirror recent transactions in memory so detection continues while Raphtory is down
+		if cfg.Detection.FallbackGraphEnabled {
+			fallback := graph.NewMemoryGraph(graph.MemoryGraphConfig{
+				Capacity:  cfg.Detection.FallbackGraphCapacity,
+				Retention: cfg.Detection.FallbackGraphRetention,
+			})
+			if err := feedFallbackGraph(busConn, fallback, logger); err != nil {
+				logger.Fatal("Failed to subscribe fallback graph to transactions", zap.Error(err))
+			}
+			anomalyDetector.SetFallbackGraph(fallback)
+		}
+
+		// Alert on watchlisted addresses as their transactions arrive
+		if cfg.Detection.WatchlistEnabled {
+			if db == nil {
+				logger.Warn("Watchlists need the database, watchlisted addresses will not be alerted on")
+			} else {
+				matcher := detection.NewWatchlistMatcher(db, detection.WatchlistConfig{
+					RefreshInterval: cfg.Detection.WatchlistRefreshInterval,
+				}, logger)
+				if err := matcher.Refresh(ctx); err != nil {
+					logger.Error("Failed to load watchlists, retrying in the background", zap.Error(err))
+				}
+				go matcher.Run(ctx)
+				if err := watchTransactions(ctx, busConn, matcher, featureFlags, logger); err != nil {
+					logger.Fatal("Failed to subscribe watchlists to transactions", zap.Error(err))
+				}
+			}
+		}
+	} else {
+		logger.Warn("Message bus disabled, outliers will only be logged")
+		if cfg.Detection.FallbackGraphEnabled {
+			logger.Warn("Fallback graph needs the message bus for transactions, detection will stop while Raphtory is down")
+		}
+		go logOutliers(ctx, anomalyDetector, logger)
+	}
+
+	if err := anomalyDetector.Start(ctx); err != nil {
+		logger.Fatal("Failed to start anomaly detector", zap.Error(err))
+	}
+
+	// Share the detection loop's status for the API health report
+	if db != nil {
+		statusRegistry := health.NewRegistry(db, health.RegistryConfig{
+			StaleAfter: cfg.Monitoring.StatusStaleAfter,
+		}, logger)
+		go statusRegistry.Publish(ctx, cfg.Monitoring.StatusInterval, "detection", detectionHealth(anomalyDetector, cfg.Detection.Interval))
+	}
+
+	// Serve pprof and expvar runtime state on a separate, private listener
+	if cfg.Monitoring.DiagnosticsEnabled {
+		diagnostics.Publish("detector", func() interface{} {
+			return map[string]interface{}{
+				"running":       anomalyDetector.IsRunning(),
+				"shard_timings": anomalyDetector.ShardTimings(),
+			}
+		})
+		diagnosticsServer := diagnostics.StartServer(cfg.Monitoring.DiagnosticsAddress, logger)
+		defer diagnosticsServer.Close()
+	}
+
+	// Serve Prometheus metrics
+	if cfg.Monitoring.Enabled {
+		metricsServer := metrics.StartServer(cfg.Monitoring.MetricsPort, nil, logger)
+		defer metricsServer.Close()
+	}
+
+	// Wait for shutdown signal
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	sig := <-sigChan
+	logger.Info("Received shutdown signal", zap.String("signal", sig.String()))
+
+	anomalyDetector.Stop()
+	cancel()
+
+	logger.Info("Detector service stopped")
+}
+
+// detectionHealth reports the detection loop: whether it is running, and
+// when and how its last cycle finished. The loop is unhealthy when stopped,
+// when its last cycle failed, or when no cycle has finished for three
+// intervals.
+func detectionHealth(anomalyDetector *detection.AnomalyDetector, interval time.Duration) health.CheckFunc {
+	started := time.Now()
+	return func(ctx context.Context) api.ServiceStatus {
+		status := anomalyDetector.CycleStatus()
+		details := map[string]interface{}{
+			"running":     status.Running,
+			"in_progress": status.InProgress,
+		}
+
+		lastFinished := started
+		if last := status.LastCycle; last != nil {
+			details["last_run_at"] = last.StartedAt.UTC()
+			details["last_run_status"] = last.Status
+			details["last_run_duration_ms"] = last.DurationMs
+			details["last_run_outliers"] = last.OutliersFound
+			if last.CompletedAt != nil {
+				lastFinished = *last.CompletedAt
+			}
+			if last.Status == models.DetectionRunFailed {
+				return api.ServiceStatus{Healthy: false, Message: "last detection cycle failed: " + last.Error, Details: details}
+			}
+		}
+
+		switch {
+		case !status.Running:
+			return api.ServiceStatus{Healthy: false, Message: "detection loop stopped", Details: details}
+		case time.Since(lastFinished) > 3*interval:
+			return api.ServiceStatus{Healthy: false, Message: "no detection cycle finished in " + (3 * interval).String(), Details: details}
+		}
+		return api.ServiceStatus{Healthy: true, Message: "ok", Details: details}
+	}
+}
+
+// logOutliers drains the detector's outlier channel when there is no bus to publish to
+func logOutliers(ctx context.Context, anomalyDetector *detection.AnomalyDetector, logger *zap.Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case outlier := <-anomalyDetector.Outliers():
+			logger.Info("Outlier detected",
+				zap.String("id", outlier.ID),
+				zap.String("type", string(outlier.Type)),
+				zap.String("severity", string(outlier.Severity)),
+				zap.String("address", outlier.Address))
+		}
+	}
+}
+
+// watchTransactions raises watchlist outliers for the monitor's transactions
+// while the watchlist_alerts flag is on. Detector instances share the
+// transactions through a queue group, so each hit is alerted on once.
+// Handlers run on the bus's read loop, which also reads publish
+// acknowledgements, so outliers are published from another goroutine.
+func watchTransactions(ctx context.Context, busConn *bus.Conn, matcher *detection.WatchlistMatcher, flags *features.Flags, logger *zap.Logger) error {
+	alerts := make(chan models.Outlier, 1000)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case outlier := <-alerts:
+				logger.Warn("Watchlisted address transacted",
+					zap.String("id", outlier.ID),
+					zap.String("address", outlier.Address),
+					zap.String("tx_hash", outlier.TransactionHash))
+				if err := busConn.PublishOutlier(ctx, outlier); err != nil {
+					logger.Error("Failed to publish watchlist outlier",
+						zap.Error(err),
+						zap.String("id", outlier.ID))
+				}
+			}
+		}
+	}()
+
+	return busConn.Subscribe(bus.SubjectTransactions, "stablerisk-watchlist", func(subject string, data []byte) {
+		if !flags.Enabled(features.WatchlistAlerts) {
+			return
+		}
+		var tx models.Transaction
+		if err := json.Unmarshal(data, &tx); err != nil {
+			logger.Error("Failed to decode transaction from bus", zap.Error(err))
+			return
+		}
+		for _, outlier := range matcher.Match(tx) {
+			select {
+			case alerts <- outlier:
+			default:
+				logger.Error("Watchlist alert queue full, dropping outlier",
+					zap.String("address", outlier.Address),
+					zap.String("tx_hash", outlier.TransactionHash))
+			}
+		}
+	})
+}
+
+// feedFallbackGraph keeps the in-memory graph in step with the monitor's
+// transactions, retractions and confirmations. Every detector instance keeps
+// its own copy, so no queue group.
+func feedFallbackGraph(busConn *bus.Conn, fallback *graph.MemoryGraph, logger *zap.Logger) error {
+	err := busConn.Subscribe(bus.SubjectTransactions, "", func(subject string, data []byte) {
+		var tx models.Transaction
+		if err := json.Unmarshal(data, &tx); err != nil {
+			logger.Error("Failed to decode transaction from bus", zap.Error(err))
+			return
+		}
+		fallback.Add(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = busConn.Subscribe(bus.SubjectRetractions, "", func(subject string, data []byte) {
+		var retraction sink.Retraction
+		if err := json.Unmarshal(data, &retraction); err != nil {
+			logger.Error("Failed to decode retraction from bus", zap.Error(err))
+			return
+		}
+		fallback.Retract(retraction.TxHash)
+	})
+	if err != nil {
+		return err
+	}
+
+	return busConn.Subscribe(bus.SubjectConfirmations, "", func(subject string, data []byte) {
+		var update models.ConfirmationUpdate
+		if err := json.Unmarshal(data, &update); err != nil {
+			logger.Error("Failed to decode confirmation from bus", zap.Error(err))
+			return
+		}
+		fallback.Confirm(update.TxHash)
+	})
+}
+
+// openDatabase connects to the configured Postgres database
+func openDatabase(cfg *config.Config, logger *zap.Logger) (*sql.DB, error) {
+	dsn := fmt.Sprintf(
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		cfg.Database.Host, cfg.Database.Port, cfg.Database.User,
+		cfg.Database.Password, cfg.Database.Database, cfg.Database.SSLMode,
+	)
+
+	db, err := tracing.OpenDB("postgres", dsn, tracing.WithSlowQueryLog(cfg.Monitoring.SlowQueryThreshold, logger))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return db, nil
+}
+
+// newFeatureFlags creates the feature flags, loading those saved through
+// the API once before returning
+func newFeatureFlags(ctx context.Context, cfg config.FeaturesConfig, db *sql.DB, logger *zap.Logger) *features.Flags {
+	flags := features.New(db, features.Config{
+		Environment:     cfg.Environment,
+		Defaults:        cfg.Flags,
+		RefreshInterval: cfg.RefreshInterval,
+	}, logger)
+	if err := flags.Refresh(ctx); err != nil {
+		logger.Error("Failed to load feature flags, using the configured values", zap.Error(err))
+	}
+	go flags.Run(ctx)
+	return flags
+}
+
+// newAddressLabels creates the address label store detection applies to
+// outliers, loading the labels once before returning
+func newAddressLabels(ctx context.Context, cfg config.DetectionConfig, db *sql.DB, logger *zap.Logger) *detection.AddressLabels {
+	labelsConfig := detection.AddressLabelsConfig{RefreshInterval: cfg.LabelsRefreshInterval}
+	for _, category := range cfg.LabelExemptCategories {
+		labelsConfig.ExemptCategories = append(labelsConfig.ExemptCategories, models.LabelCategory(category))
+	}
+	for _, category := range cfg.LabelEscalateCategories {
+		labelsConfig.EscalateCategories = append(labelsConfig.EscalateCategories, models.LabelCategory(category))
+	}
+
+	labels := detection.NewAddressLabels(db, labelsConfig, logger)
+	if err := labels.Refresh(ctx); err != nil {
+		logger.Error("Failed to load address labels, retrying in the background", zap.Error(err))
+	}
+	go labels.Run(ctx)
+	return labels
+}
+
+// newEnricher creates the enricher screening outliers' addresses with the
+// configured chain-analytics API, caching screenings in screenings when it
+// is not nil
+func newEnricher(cfg config.EnrichmentConfig, screenings *enrichment.Store, logger *zap.Logger) *enrichment.Enricher {
+	provider, err := enrichment.NewHTTPProvider(enrichment.HTTPConfig{
+		Name:          cfg.Provider,
+		URL:           cfg.URL,
+		Body:          cfg.Body,
+		APIKeyHeader:  cfg.APIKeyHeader,
+		APIKey:        cfg.APIKey,
+		CategoryField: cfg.CategoryField,
+		RiskField:     cfg.RiskField,
+		EntityField:   cfg.EntityField,
+		Timeout:       cfg.Timeout,
+	})
+	if err != nil {
+		logger.Fatal("Invalid enrichment configuration", zap.Error(err))
+	}
+	return enrichment.NewEnricher(provider, screenings, enrichment.Config{
+		CacheTTL:     cfg.CacheTTL,
+		Concurrency:  cfg.Concurrency,
+		MaxAddresses: cfg.MaxAddresses,
+	}, logger.With(zap.String("component", "enrichment")))
+}
+
+// newDetectorConfig maps detection settings onto the anomaly detector config
+func newDetectorConfig(cfg config.DetectionConfig) detection.AnomalyDetectorConfig {
+	return detection.AnomalyDetectorConfig{
+		Interval:        cfg.Interval,
+		MaxTransactions: cfg.MaxTransactions,
+		Shards:          cfg.Shards,
+		Workers:         cfg.Workers,
+		ZScoreConfig: detection.ZScoreConfig{
+			Threshold:      cfg.ZScoreThreshold,
+			MinDataPoints:  cfg.MinDataPoints,
+			WindowDuration: cfg.WindowDuration,
+		},
+		IQRConfig: detection.IQRConfig{
+			Multiplier:     cfg.IQRMultiplier,
+			MinDataPoints:  cfg.MinDataPoints,
+			WindowDuration: cfg.WindowDuration,
+			Streaming:      cfg.IQRStreaming,
+		},
+		DBSCANEnabled: cfg.DBSCANEnabled,
+		DBSCANConfig: detection.DBSCANConfig{
+			Epsilon:        cfg.DBSCANEpsilon,
+			MinPoints:      cfg.DBSCANMinPoints,
+			MinAddresses:   cfg.MinDataPoints,
+			MaxAddresses:   cfg.DBSCANMaxAddresses,
+			WindowDuration: cfg.WindowDuration,
+		},
+		PatternDetectorConfig: detection.PatternDetectorConfig{
+			CirculationWindow: cfg.CirculationWindow,
+			FanOutThreshold:   cfg.FanOutThreshold,
+			FanInThreshold:    cfg.FanInThreshold,
+			DormancyPeriod:    cfg.DormancyPeriod,
+			VelocityWindow:    cfg.VelocityWindow,
+			VelocityThreshold: cfg.VelocityThreshold,
+			IgnoreUnconfirmed: cfg.IgnoreUnconfirmed,
+			ClusterWindow:     cfg.ClusterWindow,
+			ClusterMinSize:    cfg.ClusterMinSize,
+			ClusterMinDensity: cfg.ClusterMinDensity,
+			FanWindow:         cfg.FanWindow,
+		},
+		IgnoreUnconfirmed: cfg.IgnoreUnconfirmed,
+		TagNodes:          cfg.TagGraphNodes,
+	}
+}
@@ -2,15 +2,35 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	_ "github.com/lib/pq"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/archive"
 	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/mikedewar/stablerisk/internal/blockchain/ethereum"
+	"github.com/mikedewar/stablerisk/internal/bus"
 	"github.com/mikedewar/stablerisk/internal/config"
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/internal/diagnostics"
 	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/internal/health"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/internal/sanctions"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/internal/sink"
+	"github.com/mikedewar/stablerisk/internal/tracing"
+	"github.com/mikedewar/stablerisk/pkg/models"
 	"github.com/mikedewar/stablerisk/pkg/utils"
 	"go.uber.org/zap"
 )
@@ -18,23 +38,55 @@ import (
 const (
 	serviceName = "stablerisk-monitor"
 	version     = "0.1.0"
+
+	// Sources that checkpoint only delivered transactions are acknowledged
+	// once the sinks have synced, at least this often...
+	deliverySyncInterval = 5 * time.Second
+	// ...or after this many transactions
+	deliverySyncBatch = 1000
 )
 
 func main() {
+	replayPath := flag.String("replay", "", "replay newline-delimited JSON TronEvents or transactions from `file` instead of polling")
+	replaySpeed := flag.Float64("replay-speed", 0, "replay at this multiple of the recorded pace (0 replays as fast as possible)")
+	replayRebase := flag.Bool("replay-rebase", false, "shift replayed timestamps so the first record is stamped now")
+	flag.Parse()
+
+	// Flags override the config file and environment
+	overrides := make(map[string]interface{})
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "replay":
+			overrides["ingestion.replay_path"] = *replayPath
+		case "replay-speed":
+			overrides["ingestion.replay_speed"] = *replaySpeed
+		case "replay-rebase":
+			overrides["ingestion.replay_rebase"] = *replayRebase
+		}
+	})
+
 	// Load configuration
-	cfg, err := config.Load("")
+	cfg, err := config.LoadWithOverrides("", overrides)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
 		os.Exit(1)
 	}
 
 	// Initialize logger
-	logger, err := utils.LoggerFromConfig(
-		cfg.Logging.Level,
-		cfg.Logging.Format,
-		cfg.Logging.OutputPath,
-		cfg.Logging.ErrorPath,
-	)
+	logger, err := utils.NewLogger(utils.LoggerConfig{
+		Level:      cfg.Logging.Level,
+		Format:     cfg.Logging.Format,
+		OutputPath: cfg.Logging.OutputPath,
+		ErrorPath:  cfg.Logging.ErrorPath,
+		Rotation: utils.RotationConfig{
+			MaxSizeMB:  cfg.Logging.MaxSizeMB,
+			MaxAge:     cfg.Logging.MaxAge,
+			MaxBackups: cfg.Logging.MaxBackups,
+			Compress:   cfg.Logging.Compress,
+		},
+		SampleInitial:    cfg.Logging.SamplingInitial,
+		SampleThereafter: cfg.Logging.SamplingThereafter,
+	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
 		os.Exit(1)
@@ -45,67 +97,345 @@ func main() {
 		zap.String("service", serviceName),
 		zap.String("version", version),
 		zap.String("trongrid_url", cfg.TronGrid.WebSocketURL),
-		zap.String("usdt_contract", cfg.TronGrid.USDTContract),
-		zap.String("raphtory_url", cfg.Raphtory.BaseURL))
+		zap.Int("contracts", len(cfg.TronGrid.MonitoredContracts())),
+		zap.String("raphtory_url", cfg.Raphtory.BaseURL),
+		zap.String("sinks", cfg.Sinks.Output))
+
+	// Export traces when enabled; queued spans are flushed on exit
+	if cfg.Monitoring.TracingEnabled {
+		shutdownTracing := tracing.Init(tracing.Config{
+			ServiceName: serviceName,
+			Endpoint:    cfg.Monitoring.TracingEndpoint,
+			SampleRatio: cfg.Monitoring.TracingSampleRatio,
+		}, logger)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				logger.Warn("Failed to flush traces", zap.Error(err))
+			}
+		}()
+	}
 
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Initialize Raphtory client
-	raphtoryClient := graph.NewRaphtoryClient(graph.RaphtoryConfig{
-		BaseURL:    cfg.Raphtory.BaseURL,
-		Timeout:    cfg.Raphtory.Timeout,
-		MaxRetries: cfg.Raphtory.MaxRetries,
-		RetryDelay: cfg.Raphtory.RetryDelay,
-	}, logger)
-
-	// Check Raphtory health
-	logger.Info("Checking Raphtory health...")
-	healthCtx, healthCancel := context.WithTimeout(ctx, 10*time.Second)
-	defer healthCancel()
-
-	if err := raphtoryClient.Health(healthCtx); err != nil {
-		logger.Warn("Raphtory health check failed, will continue anyway",
+	// Connect to the database. It backs the Postgres checkpoint store, the
+	// Raphtory outbox, issuer event history and invalidation of outliers
+	// whose transactions are reverted by a reorg.
+	db, err := openDatabase(cfg, logger)
+	if err != nil {
+		if cfg.TronGrid.CheckpointStore == "postgres" ||
+			(cfg.Ethereum.Enabled && cfg.Ethereum.CheckpointStore == "postgres") ||
+			(cfg.Sinks.UsesSink("raphtory") && cfg.Raphtory.OutboxEnabled) {
+			logger.Fatal("Failed to connect to database", zap.Error(err))
+		}
+		logger.Warn("Database unavailable, reorged outliers will not be invalidated",
 			zap.Error(err))
 	} else {
-		logger.Info("Raphtory service is healthy")
+		defer db.Close()
 	}
 
-	// Initialize TronGrid client
-	tronClient := blockchain.NewTronClient(blockchain.TronClientConfig{
-		APIKey:       cfg.TronGrid.APIKey,
-		WebSocketURL: cfg.TronGrid.WebSocketURL,
-		USDTContract: cfg.TronGrid.USDTContract,
-		PingInterval: cfg.TronGrid.PingInterval,
-		RetryConfig: blockchain.RetryConfig{
-			InitialDelay:   cfg.TronGrid.ReconnectDelay,
-			MaxDelay:       30 * time.Second,
-			MaxRetries:     cfg.TronGrid.MaxReconnects,
-			Multiplier:     2.0,
-			Jitter:         true,
-			CircuitTimeout: 5 * time.Minute,
-		},
-	}, logger)
+	// Deliver transactions to every configured sink
+	var sinks []sink.Sink
+	var raphtoryClient *graph.RaphtoryClient
+	if cfg.Sinks.UsesSink("raphtory") {
+		raphtoryTLS, err := security.ClientTLSConfig(security.ClientTLSFiles{
+			CertFile: cfg.Raphtory.TLSCertFile,
+			KeyFile:  cfg.Raphtory.TLSKeyFile,
+			CAFile:   cfg.Raphtory.TLSCAFile,
+		}, logger)
+		if err != nil {
+			logger.Fatal("Failed to load Raphtory TLS configuration", zap.Error(err))
+		}
+		raphtoryClient = graph.NewRaphtoryClient(graph.RaphtoryConfig{
+			BaseURL:          cfg.Raphtory.BaseURL,
+			Timeout:          cfg.Raphtory.Timeout,
+			MaxRetries:       cfg.Raphtory.MaxRetries,
+			RetryDelay:       cfg.Raphtory.RetryDelay,
+			FailureThreshold: cfg.Raphtory.CircuitFailureThreshold,
+			OpenTimeout:      cfg.Raphtory.CircuitOpenTimeout,
+			Transport:        cfg.Raphtory.Transport,
+			GraphName:        cfg.Raphtory.GraphName,
+			TLS:              raphtoryTLS,
+		}, logger)
+		sinks = append(sinks, newRaphtorySink(ctx, cfg, raphtoryClient, db, logger))
+	}
+	if cfg.Sinks.UsesSink("kafka") {
+		sinks = append(sinks, sink.NewKafkaSink(sink.KafkaConfig{
+			RestProxyURL: cfg.Sinks.Kafka.RestProxyURL,
+			Topic:        cfg.Sinks.Kafka.Topic,
+			Timeout:      cfg.Sinks.Kafka.Timeout,
+			Retry: sink.RetryPolicy{
+				MaxRetries: cfg.Sinks.Kafka.MaxRetries,
+				RetryDelay: cfg.Sinks.Kafka.RetryDelay,
+			},
+		}, logger.With(zap.String("sink", "kafka"))))
+		logger.Info("Producing transactions to Kafka",
+			zap.String("rest_proxy_url", cfg.Sinks.Kafka.RestProxyURL),
+			zap.String("topic", cfg.Sinks.Kafka.Topic))
+	}
+
+	// Publish to the message bus so other services consume the stream independently
+	var busConn *bus.Conn
+	if cfg.Bus.Enabled {
+		busConn, err = connectBus(ctx, cfg, logger)
+		if err != nil {
+			logger.Fatal("Failed to connect to message bus", zap.Error(err))
+		}
+		defer busConn.Close()
+
+		sinks = append(sinks, sink.NewBusSink(busConn, sink.RetryPolicy{
+			MaxRetries: cfg.Bus.MaxRetries,
+			RetryDelay: cfg.Bus.RetryDelay,
+		}, logger.With(zap.String("sink", "bus"))))
+	}
+
+	var outlierStore *detection.OutlierStore
+	var issuerEventStore *blockchain.IssuerEventStore
+	if db != nil {
+		outlierStore = detection.NewOutlierStore(db, logger)
+		issuerEventStore = blockchain.NewIssuerEventStore(db)
+	}
+
+	// Screen every ingested transaction against the sanctions lists
+	var screener *sanctions.Screener
+	var outlierPublisher detection.OutlierPublisher
+	if cfg.Sanctions.Enabled {
+		screener = newSanctionsScreener(cfg, logger)
+		if err := screener.Refresh(ctx); err != nil {
+			logger.Error("Failed to load sanctions lists, retrying at the next refresh", zap.Error(err))
+		}
+		go screener.Run(ctx)
+
+		if busConn != nil {
+			outlierPublisher = busConn
+		} else {
+			logger.Warn("Message bus disabled, sanctions hits will only be logged")
+		}
+	}
 
-	// Start TronGrid client
-	if err := tronClient.Start(); err != nil {
-		logger.Fatal("Failed to start TronGrid client", zap.Error(err))
+	// Report dependency and source health for Kubernetes probes
+	checker := health.NewChecker(version, logger)
+	if db != nil {
+		checker.Register("database", false, health.Ping(db.PingContext))
+	}
+	if raphtoryClient != nil {
+		checker.Register("raphtory", false, raphtoryHealth(raphtoryClient))
 	}
-	defer tronClient.Close()
 
-	logger.Info("TronGrid client started, listening for USDT transactions...")
+	// Share each source's status, with its lag, for the API health report
+	var statusRegistry *health.Registry
+	if db != nil {
+		statusRegistry = health.NewRegistry(db, health.RegistryConfig{
+			StaleAfter: cfg.Monitoring.StatusStaleAfter,
+		}, logger)
+	}
+
+	// Processors stop before the sinks close so nothing is sent after them
+	processCtx, stopProcessing := context.WithCancel(ctx)
+	var processors sync.WaitGroup
+	var sourcesLock sync.Mutex
+	namedSources := make(map[string]transactionSource)
+	startProcessor := func(name string, source transactionSource, tracker *blockchain.ConfirmationTracker) {
+		checker.Register(name, true, sourceHealth(source))
+		if statusRegistry != nil {
+			go statusRegistry.Publish(processCtx, cfg.Monitoring.StatusInterval, name, sourceHealth(source))
+		}
+		sourcesLock.Lock()
+		namedSources[name] = source
+		sourcesLock.Unlock()
+		processors.Add(1)
+		go func() {
+			defer processors.Done()
+			processTransactions(processCtx, name, source, tracker, sinks, outlierStore, issuerEventStore,
+				screener, outlierPublisher, logger)
+		}()
+	}
+
+	// Serve pprof and expvar runtime state on a separate, private listener
+	if cfg.Monitoring.DiagnosticsEnabled {
+		diagnostics.Publish("sources", func() interface{} {
+			sourcesLock.Lock()
+			defer sourcesLock.Unlock()
+			state := make(map[string]interface{}, len(namedSources))
+			for name, source := range namedSources {
+				state[name] = map[string]interface{}{
+					"status":        source.Status(),
+					"channel_depth": len(source.Transactions()),
+					"stats":         sourceCounters(source),
+				}
+			}
+			return state
+		})
+		diagnosticsServer := diagnostics.StartServer(cfg.Monitoring.DiagnosticsAddress, logger)
+		defer diagnosticsServer.Close()
+	}
+
+	// Serve Prometheus metrics alongside /health, /readiness and /liveness
+	if cfg.Monitoring.Enabled {
+		metricsServer := metrics.StartServer(cfg.Monitoring.MetricsPort, checker.Mux(), logger)
+		defer metricsServer.Close()
+	}
+
+	// Archive raw TronGrid pages so ingestion can be replayed and audited
+	var archiver *archive.Archiver
+	var eventArchiver blockchain.EventArchiver
+	if cfg.Archive.Enabled && cfg.Ingestion.ReplayPath == "" {
+		archiver, err = newArchiver(cfg, logger)
+		if err != nil {
+			logger.Fatal("Failed to create raw event archiver", zap.Error(err))
+		}
+		eventArchiver = archiver
+		go logArchiveStats(ctx, archiver, logger)
+	}
+
+	sources := make([]transactionSource, 0, len(cfg.TronGrid.MonitoredContracts())+1)
+	// Closed when every processor has returned by itself, which only a replay does
+	var sourcesDone chan struct{}
+
+	if cfg.Ingestion.ReplayPath != "" {
+		// Replay a recorded file through the pipeline instead of polling the chains
+		var replayContracts []blockchain.ReplayContract
+		for _, contract := range cfg.TronGrid.MonitoredContracts() {
+			replayContracts = append(replayContracts, blockchain.ReplayContract{
+				Address:  contract.Address,
+				Symbol:   contract.Symbol,
+				Decimals: contract.Decimals,
+			})
+		}
+
+		replay := blockchain.NewReplaySource(blockchain.ReplayConfig{
+			Path:      cfg.Ingestion.ReplayPath,
+			Speed:     cfg.Ingestion.ReplaySpeed,
+			Rebase:    cfg.Ingestion.ReplayRebase,
+			Contracts: replayContracts,
+		}, logger.With(zap.String("source", "replay")))
+
+		if err := replay.Start(); err != nil {
+			logger.Fatal("Failed to start replay", zap.Error(err))
+		}
+		sources = append(sources, replay)
+		startProcessor("replay", replay, newConfirmationTracker(cfg.TronGrid.ConfirmationDepth))
+
+		sourcesDone = make(chan struct{})
+		go func() {
+			processors.Wait()
+			close(sourcesDone)
+		}()
+	} else {
+		// Start one TronGrid poller per monitored contract
+		contracts := cfg.TronGrid.MonitoredContracts()
+		// Pollers share one API key, so they share one request budget
+		tronLimiter := blockchain.NewRateLimiter(cfg.TronGrid.RequestsPerSecond, int(cfg.TronGrid.RequestsPerSecond))
+		lagInterval := cfg.TronGrid.LagInterval
+		if lagInterval == 0 {
+			lagInterval = -1 // Zero in the config disables lag tracking
+		}
+		for _, contract := range contracts {
+			checkpointPath := cfg.TronGrid.CheckpointPath
+			if len(contracts) > 1 {
+				// Suffix each file with the token so pollers do not overwrite each other
+				ext := filepath.Ext(checkpointPath)
+				checkpointPath = strings.TrimSuffix(checkpointPath, ext) + "-" + strings.ToLower(contract.Symbol) + ext
+			}
+
+			gapThreshold := cfg.TronGrid.GapThreshold
+			if contract.GapThreshold > 0 {
+				gapThreshold = contract.GapThreshold
+			}
 
-	// Start transaction processor
-	go processTransactions(ctx, tronClient, raphtoryClient, logger)
+			tronClient := blockchain.NewTronClient(blockchain.TronClientConfig{
+				APIKey:        cfg.TronGrid.APIKey,
+				WebSocketURL:  cfg.TronGrid.WebSocketURL,
+				USDTContract:  contract.Address,
+				TokenSymbol:   contract.Symbol,
+				TokenDecimals: contract.Decimals,
+				PingInterval:  cfg.TronGrid.PingInterval,
+				RetryConfig: blockchain.RetryConfig{
+					InitialDelay:   cfg.TronGrid.ReconnectDelay,
+					MaxDelay:       30 * time.Second,
+					MaxRetries:     cfg.TronGrid.MaxReconnects,
+					Multiplier:     2.0,
+					Jitter:         true,
+					CircuitTimeout: 5 * time.Minute,
+				},
+				CheckpointStore: newCheckpointStore(cfg, cfg.TronGrid.CheckpointStore, contract.Address, checkpointPath, db, logger),
+				AwaitDelivery:   true,
+				MaxPagesPerPoll: cfg.TronGrid.MaxPagesPerPoll,
+				RateLimiter:     tronLimiter,
+				Backpressure:    newBackpressureConfig(cfg, "tron-"+strings.ToLower(contract.Symbol)),
+				GapThreshold:    gapThreshold,
+				BackfillGaps:    cfg.TronGrid.BackfillGaps,
+				DedupCacheSize:  cfg.TronGrid.DedupCacheSize,
+				Archiver:        eventArchiver,
+				LagInterval:     lagInterval,
+				// Confirmation depth is tracked on unconfirmed events
+				IncludeUnconfirmed: cfg.TronGrid.ConfirmationDepth > 0,
+			}, logger.With(zap.String("token", contract.Symbol)))
+
+			if err := tronClient.Start(); err != nil {
+				logger.Fatal("Failed to start TronGrid client",
+					zap.Error(err),
+					zap.String("token", contract.Symbol))
+			}
+			sources = append(sources, tronClient)
+
+			logger.Info("TronGrid client started, listening for transactions...",
+				zap.String("token", contract.Symbol),
+				zap.String("contract", contract.Address))
+
+			// Start transaction processor
+			startProcessor("tron:"+contract.Symbol, tronClient, newConfirmationTracker(cfg.TronGrid.ConfirmationDepth))
+		}
+
+		// Start the Ethereum ERC-20 poller
+		if cfg.Ethereum.Enabled {
+			var ethContracts []ethereum.Contract
+			for _, contract := range cfg.Ethereum.MonitoredContracts() {
+				ethContracts = append(ethContracts, ethereum.Contract{
+					Address:  contract.Address,
+					Symbol:   contract.Symbol,
+					Decimals: contract.Decimals,
+				})
+			}
+
+			ethClient := ethereum.NewClient(ethereum.ClientConfig{
+				RPCURL:          cfg.Ethereum.RPCURL,
+				Contracts:       ethContracts,
+				PollInterval:    cfg.Ethereum.PollInterval,
+				Confirmations:   cfg.Ethereum.Confirmations,
+				MaxBlockRange:   cfg.Ethereum.MaxBlockRange,
+				CheckpointStore: newCheckpointStore(cfg, cfg.Ethereum.CheckpointStore, "ethereum", cfg.Ethereum.CheckpointPath, db, logger),
+				AwaitDelivery:   true,
+				Backpressure:    newBackpressureConfig(cfg, "ethereum"),
+			}, logger.With(zap.String("chain", string(models.ChainEthereum))))
+
+			if err := ethClient.Start(); err != nil {
+				logger.Fatal("Failed to start Ethereum client", zap.Error(err))
+			}
+			sources = append(sources, ethClient)
+
+			logger.Info("Ethereum client started, listening for ERC-20 transfers...",
+				zap.Int("contracts", len(ethContracts)))
+
+			// The Ethereum client only emits logs below its confirmation depth
+			startProcessor("ethereum", ethClient, nil)
+		}
+	}
 
 	// Setup signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	// Wait for shutdown signal
-	sig := <-sigChan
-	logger.Info("Received shutdown signal", zap.String("signal", sig.String()))
+	// Wait for shutdown signal, or for a replay to finish
+	select {
+	case sig := <-sigChan:
+		logger.Info("Received shutdown signal", zap.String("signal", sig.String()))
+	case <-sourcesDone:
+		logger.Info("Replay complete")
+	}
 
 	// Graceful shutdown
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -113,9 +443,27 @@ func main() {
 
 	logger.Info("Shutting down gracefully...")
 
-	// Close TronGrid client
-	if err := tronClient.Close(); err != nil {
-		logger.Error("Error closing TronGrid client", zap.Error(err))
+	// Close blockchain clients
+	for _, source := range sources {
+		if err := source.Close(); err != nil {
+			logger.Error("Error closing blockchain client", zap.Error(err))
+		}
+	}
+
+	// Upload the pages the pollers already handed over
+	if archiver != nil {
+		if err := archiver.Close(shutdownCtx); err != nil {
+			logger.Error("Error closing raw event archiver", zap.Error(err))
+		}
+	}
+
+	// Deliver what the sinks have already buffered
+	stopProcessing()
+	processors.Wait()
+	for _, s := range sinks {
+		if err := s.Close(shutdownCtx); err != nil {
+			logger.Error("Error closing sink", zap.Error(err), zap.String("sink", s.Name()))
+		}
 	}
 
 	// Wait for shutdown to complete or timeout
@@ -127,59 +475,718 @@ func main() {
 	logger.Info("Monitor service stopped")
 }
 
-// processTransactions processes transactions from TronGrid and forwards them to Raphtory
-func processTransactions(ctx context.Context, tronClient *blockchain.TronClient,
-	raphtoryClient *graph.RaphtoryClient, logger *zap.Logger) {
+// openDatabase connects to the configured Postgres database
+func openDatabase(cfg *config.Config, logger *zap.Logger) (*sql.DB, error) {
+	dsn := fmt.Sprintf(
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		cfg.Database.Host, cfg.Database.Port, cfg.Database.User,
+		cfg.Database.Password, cfg.Database.Database, cfg.Database.SSLMode,
+	)
+
+	db, err := tracing.OpenDB("postgres", dsn, tracing.WithSlowQueryLog(cfg.Monitoring.SlowQueryThreshold, logger))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return db, nil
+}
+
+// connectBus connects to NATS and makes sure the JetStream stream exists
+func connectBus(ctx context.Context, cfg *config.Config, logger *zap.Logger) (*bus.Conn, error) {
+	conn, err := bus.Connect(ctx, bus.Config{
+		URL:            cfg.Bus.URL,
+		Token:          cfg.Bus.Token,
+		Name:           serviceName,
+		Stream:         cfg.Bus.Stream,
+		MaxAge:         cfg.Bus.MaxAge,
+		PublishTimeout: cfg.Bus.PublishTimeout,
+		ReconnectWait:  cfg.Bus.ReconnectWait,
+	}, logger.With(zap.String("component", "bus")))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.EnsureStream(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	logger.Info("Connected to message bus",
+		zap.String("url", cfg.Bus.URL),
+		zap.String("stream", cfg.Bus.Stream))
+	return conn, nil
+}
+
+// newArchiver creates the raw event archiver for the configured backend
+func newArchiver(cfg *config.Config, logger *zap.Logger) (*archive.Archiver, error) {
+	store, err := archive.NewStore(cfg.Archive.Backend, archive.S3Config{
+		Endpoint:        cfg.Archive.Endpoint,
+		Region:          cfg.Archive.Region,
+		Bucket:          cfg.Archive.Bucket,
+		AccessKeyID:     cfg.Archive.AccessKeyID,
+		SecretAccessKey: cfg.Archive.SecretAccessKey,
+		Timeout:         cfg.Archive.Timeout,
+	}, cfg.Archive.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Archiving raw events",
+		zap.String("backend", cfg.Archive.Backend),
+		zap.String("bucket", cfg.Archive.Bucket),
+		zap.String("prefix", cfg.Archive.Prefix))
+
+	return archive.NewArchiver(archive.Config{
+		Prefix:     cfg.Archive.Prefix,
+		QueueSize:  cfg.Archive.QueueSize,
+		MaxRetries: cfg.Archive.MaxRetries,
+		RetryDelay: cfg.Archive.RetryDelay,
+		Timeout:    cfg.Archive.Timeout,
+	}, store, logger.With(zap.String("component", "archive"))), nil
+}
+
+// logArchiveStats logs the archiver counters periodically
+func logArchiveStats(ctx context.Context, archiver *archive.Archiver, logger *zap.Logger) {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats := archiver.Stats()
+			logger.Info("Raw event archive statistics",
+				zap.Uint64("archived_batches", stats.Batches),
+				zap.Uint64("archived_events", stats.Events),
+				zap.Uint64("archived_bytes", stats.Bytes),
+				zap.Uint64("archive_retries", stats.Retries),
+				zap.Uint64("archive_failed", stats.Failed),
+				zap.Uint64("archive_dropped", stats.Dropped),
+				zap.Int("archive_queue_depth", stats.QueueDepth))
+		}
+	}
+}
+
+// newRaphtorySink starts the Raphtory forwarder and worker pool. Writes are
+// batched, and failures are buffered so an outage delays the graph instead
+// of leaving gaps.
+func newRaphtorySink(ctx context.Context, cfg *config.Config, raphtoryClient *graph.RaphtoryClient, db *sql.DB, logger *zap.Logger) *sink.RaphtorySink {
+	// Check Raphtory health
+	logger.Info("Checking Raphtory health...")
+	healthCtx, healthCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer healthCancel()
+
+	if err := raphtoryClient.Health(healthCtx); err != nil {
+		logger.Warn("Raphtory health check failed, will continue anyway",
+			zap.Error(err))
+	} else {
+		logger.Info("Raphtory service is healthy")
+	}
+
+	var outbox *graph.Outbox
+	if cfg.Raphtory.OutboxEnabled {
+		outbox = graph.NewOutbox(db)
+	} else {
+		logger.Warn("Raphtory outbox disabled, transactions will be lost while Raphtory is unavailable")
+	}
+	forwarder := graph.NewForwarder(graph.ForwarderConfig{
+		RetryInterval:    cfg.Raphtory.OutboxRetryInterval,
+		MaxRetryInterval: cfg.Raphtory.OutboxMaxRetryInterval,
+		MaxAttempts:      cfg.Raphtory.OutboxMaxAttempts,
+		BatchSize:        cfg.Raphtory.BatchSize,
+		FlushInterval:    cfg.Raphtory.BatchFlushInterval,
+	}, raphtoryClient, outbox, logger)
+	if err := forwarder.Start(ctx); err != nil {
+		logger.Fatal("Failed to start Raphtory forwarder", zap.Error(err))
+	}
+
+	// Forward from a pool of workers so one slow Raphtory call does not stall ingestion
+	pool := graph.NewForwardPool(graph.PoolConfig{
+		Workers:        cfg.Raphtory.Workers,
+		QueueSize:      cfg.Raphtory.QueueSize,
+		Timeout:        cfg.Raphtory.Timeout,
+		OrderByAddress: cfg.Raphtory.OrderByAddress,
+	}, forwarder, logger)
+	pool.Start(ctx)
+
+	return sink.NewRaphtorySink(pool, forwarder, sink.RetryPolicy{
+		MaxRetries: cfg.Sinks.Raphtory.MaxRetries,
+		RetryDelay: cfg.Sinks.Raphtory.RetryDelay,
+	}, logger.With(zap.String("sink", "raphtory")))
+}
+
+// newCheckpointStore creates a polling checkpoint store of the given type
+// (file, postgres or none). name identifies the poller in Postgres; path is
+// used by the file store.
+func newCheckpointStore(cfg *config.Config, store, name, path string, db *sql.DB, logger *zap.Logger) blockchain.CheckpointStore {
+	switch store {
+	case "file":
+		logger.Info("Using file checkpoint store",
+			zap.String("name", name),
+			zap.String("path", path))
+		return blockchain.NewFileCheckpointStore(path)
+
+	case "postgres":
+		logger.Info("Using Postgres checkpoint store",
+			zap.String("name", name),
+			zap.String("host", cfg.Database.Host))
+		return blockchain.NewPostgresCheckpointStore(db, name)
+
+	default:
+		logger.Warn("Checkpoint store disabled, polling position will not survive restarts",
+			zap.String("name", name))
+		return nil
+	}
+}
+
+// newBackpressureConfig builds the overflow handling for a client. name
+// selects the client's spill queue file.
+func newBackpressureConfig(cfg *config.Config, name string) blockchain.BackpressureConfig {
+	return blockchain.BackpressureConfig{
+		Strategy:     blockchain.OverflowStrategy(cfg.Ingestion.OverflowStrategy),
+		BlockTimeout: cfg.Ingestion.BlockTimeout,
+		SpillPath:    filepath.Join(cfg.Ingestion.SpillDir, name+".jsonl"),
+	}
+}
+
+// newConfirmationTracker creates a tracker for one source, or returns nil if
+// transactions are confirmed as soon as they are received
+func newConfirmationTracker(depth uint64) *blockchain.ConfirmationTracker {
+	if depth == 0 {
+		return nil
+	}
+	return blockchain.NewConfirmationTracker(depth)
+}
+
+// transactionSource is a blockchain client that emits transfers and reorg retractions
+type transactionSource interface {
+	Transactions() <-chan *models.Transaction
+	Retractions() <-chan string
+	Status() models.ConnectionStatus
+	IsConnected() bool
+	Close() error
+}
+
+// issuerEventSource is a client that also emits issuer administrative events
+type issuerEventSource interface {
+	IssuerEvents() <-chan *models.IssuerEvent
+}
+
+// issuerEvents returns the source's issuer event channel, or nil if it has none
+func issuerEvents(source transactionSource) <-chan *models.IssuerEvent {
+	if s, ok := source.(issuerEventSource); ok {
+		return s.IssuerEvents()
+	}
+	return nil
+}
+
+// finiteSource is a source that ends, such as a replay
+type finiteSource interface {
+	Done() <-chan struct{}
+}
+
+// finished returns a channel closed once the source has delivered everything,
+// or nil for sources that run until closed
+func finished(source transactionSource) <-chan struct{} {
+	if s, ok := source.(finiteSource); ok {
+		return s.Done()
+	}
+	return nil
+}
+
+// headSource is a client that reports the chain head independently of its
+// transactions
+type headSource interface {
+	Heads() <-chan uint64
+}
+
+// chainHeads returns the source's head channel, or nil if it has none
+func chainHeads(source transactionSource) <-chan uint64 {
+	if s, ok := source.(headSource); ok {
+		return s.Heads()
+	}
+	return nil
+}
+
+// deliverConfirmations delivers confirmation updates to every sink. It
+// returns the number of failed deliveries, and ctx's error if it was
+// cancelled.
+func deliverConfirmations(ctx context.Context, updates []models.ConfirmationUpdate, sinks []sink.Sink, logger *zap.Logger) (uint64, error) {
+	failed := uint64(0)
+	for _, update := range updates {
+		for _, s := range sinks {
+			if err := s.Confirm(ctx, update); err != nil {
+				if ctx.Err() != nil {
+					return failed, ctx.Err()
+				}
+				failed++
+				logger.Error("Failed to deliver confirmation",
+					zap.Error(err),
+					zap.String("sink", s.Name()),
+					zap.String("tx_hash", update.TxHash))
+			}
+		}
+	}
+	return failed, nil
+}
+
+// acknowledgingSource is a client that checkpoints only transactions the
+// consumer has acknowledged as delivered
+type acknowledgingSource interface {
+	Acknowledge(n int)
+}
+
+// acknowledging returns the source as an acknowledgingSource, or nil if it
+// checkpoints without waiting for delivery
+func acknowledging(source transactionSource) acknowledgingSource {
+	if s, ok := source.(acknowledgingSource); ok {
+		return s
+	}
+	return nil
+}
+
+// syncSinks waits for every sink to deliver what it has been sent, reporting
+// whether they all did
+func syncSinks(ctx context.Context, sinks []sink.Sink, logger *zap.Logger) bool {
+	for _, s := range sinks {
+		if err := s.Sync(ctx); err != nil {
+			if ctx.Err() == nil {
+				logger.Error("Failed to sync sink",
+					zap.Error(err),
+					zap.String("sink", s.Name()))
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// sourceStats returns client-specific polling counters for the statistics log
+func sourceStats(source transactionSource) []zap.Field {
+	switch client := source.(type) {
+	case *blockchain.TronClient:
+		stats := client.Stats()
+		return []zap.Field{
+			zap.Uint64("pages_fetched", stats.PagesFetched),
+			zap.Uint64("events_fetched", stats.EventsFetched),
+			zap.Uint64("truncated_polls", stats.TruncatedPolls),
+			zap.Uint64("rate_limited", stats.RateLimited),
+			zap.Uint64("gaps", stats.Gaps),
+			zap.Uint64("gap_blocks", stats.GapBlocks),
+			zap.Uint64("backfilled", stats.Backfilled),
+			zap.Uint64("duplicates", stats.Duplicates),
+			zap.Uint64("issuer_events", stats.IssuerEvents),
+			zap.Uint64("dropped", stats.Dropped),
+			zap.Uint64("spilled", stats.Spilled),
+			zap.Int("spill_depth", stats.SpillDepth),
+			zap.Uint64("head_block", stats.HeadBlock),
+			zap.Duration("lag", stats.Lag),
+			zap.Uint64("blocks_behind", stats.BlocksBehind),
+		}
+	case *blockchain.ReplaySource:
+		stats := client.Stats()
+		return []zap.Field{
+			zap.Uint64("lines_read", stats.Lines),
+			zap.Uint64("skipped", stats.Skipped),
+			zap.Uint64("duplicates", stats.Duplicates),
+		}
+	case *ethereum.Client:
+		stats := client.Stats()
+		return []zap.Field{
+			zap.Uint64("blocks_scanned", stats.BlocksScanned),
+			zap.Uint64("logs_fetched", stats.LogsFetched),
+			zap.Uint64("head_block", stats.HeadBlock),
+			zap.Uint64("dropped", stats.Dropped),
+			zap.Uint64("spilled", stats.Spilled),
+			zap.Int("spill_depth", stats.SpillDepth),
+		}
+	default:
+		return nil
+	}
+}
+
+// sourceCounters returns a source's stats struct for /debug/vars
+func sourceCounters(source transactionSource) interface{} {
+	switch client := source.(type) {
+	case *blockchain.TronClient:
+		return client.Stats()
+	case *blockchain.ReplaySource:
+		return client.Stats()
+	case *ethereum.Client:
+		return client.Stats()
+	default:
+		return nil
+	}
+}
+
+// sourceHealth reports a source's connection status along with its channel
+// depth and position. A source that is reconnecting is unhealthy.
+func sourceHealth(source transactionSource) health.CheckFunc {
+	return func(ctx context.Context) api.ServiceStatus {
+		status := source.Status()
+		details := map[string]interface{}{
+			"status":        status,
+			"channel_depth": len(source.Transactions()),
+		}
+
+		switch client := source.(type) {
+		case *blockchain.TronClient:
+			stats := client.Stats()
+			if last := client.LastTimestamp(); last > 0 {
+				details["last_event_timestamp"] = time.UnixMilli(last).UTC()
+			}
+			if stats.HeadBlock > 0 {
+				details["lag_seconds"] = stats.Lag.Seconds()
+				details["blocks_behind"] = stats.BlocksBehind
+			}
+		case *ethereum.Client:
+			stats := client.Stats()
+			details["last_block"] = client.LastBlock()
+			details["head_block"] = stats.HeadBlock
+		case *blockchain.ReplaySource:
+			details["lines_read"] = client.Stats().Lines
+		}
+
+		if !source.IsConnected() {
+			return api.ServiceStatus{Healthy: false, Message: string(status), Details: details}
+		}
+		return api.ServiceStatus{Healthy: true, Message: "ok", Details: details}
+	}
+}
+
+// raphtoryHealth pings Raphtory and reports the client's circuit breaker
+// state, so a breaker holding calls back shows up as unhealthy
+func raphtoryHealth(client *graph.RaphtoryClient) health.CheckFunc {
+	ping := health.Ping(client.Health)
+	return func(ctx context.Context) api.ServiceStatus {
+		status := ping(ctx)
+		status.Details = map[string]interface{}{"circuit": client.CircuitState()}
+		return status
+	}
+}
+
+// sinkStats returns sink-specific delivery counters for the statistics log
+func sinkStats(s sink.Sink) []zap.Field {
+	switch s := s.(type) {
+	case *sink.RaphtorySink:
+		poolStats := s.PoolStats()
+		return []zap.Field{
+			zap.Int("queue_depth", poolStats.QueueDepth),
+			zap.Int64("active_workers", poolStats.Active),
+			zap.Uint64("forward_errors", poolStats.Errors),
+			zap.Int64("outbox_depth", s.ForwarderStats().Depth),
+		}
+	case *sink.BusSink:
+		stats := s.Stats()
+		return []zap.Field{
+			zap.Uint64("bus_published", stats.Published),
+			zap.Uint64("bus_retracted", stats.Retracted),
+			zap.Uint64("bus_confirmed", stats.Confirmed),
+			zap.Uint64("bus_failed", stats.Failed),
+		}
+	case *sink.KafkaSink:
+		stats := s.Stats()
+		return []zap.Field{
+			zap.Uint64("kafka_published", stats.Published),
+			zap.Uint64("kafka_retracted", stats.Retracted),
+			zap.Uint64("kafka_confirmed", stats.Confirmed),
+			zap.Uint64("kafka_failed", stats.Failed),
+		}
+	default:
+		return nil
+	}
+}
+
+// processTransactions processes transactions from a blockchain client and delivers them to every sink.
+// With a confirmation tracker, transactions are sent unconfirmed and a confirmation update follows
+// once they are deep enough, either below a later transaction or below the head the source reports.
+func processTransactions(ctx context.Context, name string, source transactionSource, tracker *blockchain.ConfirmationTracker,
+	sinks []sink.Sink, outlierStore *detection.OutlierStore, issuerEventStore *blockchain.IssuerEventStore,
+	screener *sanctions.Screener, outlierPublisher detection.OutlierPublisher, logger *zap.Logger) {
+
+	// Nil for sources without issuer events, which never selects
+	issuerEventCh := issuerEvents(source)
+	var headCh <-chan uint64
+	if tracker != nil {
+		headCh = chainHeads(source)
+	}
+	finishedCh := finished(source)
+	channelDepth := metrics.ChannelDepth.WithLabelValues(name)
 
 	txCount := uint64(0)
 	errorCount := uint64(0)
+	retractCount := uint64(0)
 	startTime := time.Now()
 
 	// Log statistics periodically
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
 
+	// Received transactions are acknowledged once the sinks have synced, so
+	// the source's checkpoint never passes an undelivered transaction. With a
+	// tracker, it also stays behind the oldest transaction still waiting for
+	// confirmation, so a restart re-fetches it rather than losing its update.
+	acknowledger := acknowledging(source)
+	acked := uint64(0)
+	sinceSync := 0
+	var syncCh <-chan time.Time
+	if acknowledger != nil {
+		syncTicker := time.NewTicker(deliverySyncInterval)
+		defer syncTicker.Stop()
+		syncCh = syncTicker.C
+	}
+	acknowledge := func() {
+		sinceSync = 0
+		settled := txCount
+		if tracker != nil {
+			settled = tracker.Settled()
+		}
+		if settled > acked && syncSinks(ctx, sinks, logger) {
+			acknowledger.Acknowledge(int(settled - acked))
+			acked = settled
+		}
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			logger.Info("Transaction processor stopped")
 			return
 
-		case tx := <-tronClient.Transactions():
+		case <-finishedCh:
+			// Every record has been received and delivered
+			logger.Info("Transaction source finished",
+				zap.String("source", name),
+				zap.Uint64("total_transactions", txCount),
+				zap.Uint64("retractions", retractCount),
+				zap.Uint64("errors", errorCount))
+			return
+
+		case tx := <-source.Transactions():
 			txCount++
+			channelDepth.Set(float64(len(source.Transactions())))
+
+			var confirmed []models.ConfirmationUpdate
+			if tracker != nil {
+				confirmed = tracker.Track(tx)
+			}
 
 			// Log transaction
 			logger.Info("Transaction received",
 				zap.Uint64("count", txCount),
+				zap.String("chain", string(tx.Chain)),
+				zap.String("token", tx.Token),
 				zap.String("tx_hash", tx.TxHash),
 				zap.String("from", tx.From),
 				zap.String("to", tx.To),
 				zap.String("amount", tx.Amount.String()),
 				zap.Uint64("block", tx.BlockNumber),
+				zap.Bool("confirmed", tx.Confirmed),
 				zap.Time("timestamp", tx.Timestamp))
 
-			// Forward to Raphtory
-			forwardCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-			if err := raphtoryClient.AddTransaction(forwardCtx, tx); err != nil {
+			// Sinks block while their queues are full
+			for _, s := range sinks {
+				if err := s.Send(ctx, tx); err != nil {
+					if ctx.Err() != nil {
+						logger.Info("Transaction processor stopped")
+						return
+					}
+					errorCount++
+					logger.Error("Failed to deliver transaction",
+						zap.Error(err),
+						zap.String("sink", s.Name()),
+						zap.String("tx_hash", tx.TxHash))
+				}
+			}
+
+			if screener != nil {
+				if err := screenTransaction(ctx, *tx, screener, outlierPublisher, logger); err != nil {
+					if ctx.Err() != nil {
+						logger.Info("Transaction processor stopped")
+						return
+					}
+					errorCount++
+					logger.Error("Failed to publish sanctions outlier",
+						zap.Error(err),
+						zap.String("tx_hash", tx.TxHash))
+				}
+			}
+
+			// Confirmations follow the transaction that pushed the head past them
+			failed, err := deliverConfirmations(ctx, confirmed, sinks, logger)
+			errorCount += failed
+			if err != nil {
+				logger.Info("Transaction processor stopped")
+				return
+			}
+
+			if acknowledger != nil {
+				sinceSync++
+				if sinceSync >= deliverySyncBatch {
+					acknowledge()
+				}
+			}
+
+		case head := <-headCh:
+			// The head moves on while the source has no new transactions
+			failed, err := deliverConfirmations(ctx, tracker.Advance(head), sinks, logger)
+			errorCount += failed
+			if err != nil {
+				logger.Info("Transaction processor stopped")
+				return
+			}
+
+		case <-syncCh:
+			acknowledge()
+
+		case txHash := <-source.Retractions():
+			retractCount++
+			if tracker != nil {
+				tracker.Forget(txHash)
+			}
+			if err := retractTransaction(ctx, txHash, sinks, outlierStore, logger); err != nil {
+				if ctx.Err() != nil {
+					logger.Info("Transaction processor stopped")
+					return
+				}
 				errorCount++
-				logger.Error("Failed to add transaction to Raphtory",
+				logger.Error("Failed to retract reorged transaction",
 					zap.Error(err),
-					zap.String("tx_hash", tx.TxHash))
+					zap.String("tx_hash", txHash))
+			}
+
+		case event := <-issuerEventCh:
+			logger.Warn("Issuer event received",
+				zap.String("source", name),
+				zap.String("type", string(event.Type)),
+				zap.String("token", event.Token),
+				zap.String("tx_hash", event.TxHash),
+				zap.String("address", event.Address),
+				zap.String("amount", event.Amount.String()),
+				zap.Uint64("block", event.BlockNumber))
+
+			if issuerEventStore == nil {
+				continue
 			}
+			saveCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			err := issuerEventStore.Save(saveCtx, event)
 			cancel()
+			if err != nil {
+				errorCount++
+				logger.Error("Failed to save issuer event",
+					zap.Error(err),
+					zap.String("tx_hash", event.TxHash))
+			}
 
 		case <-ticker.C:
 			// Log statistics
 			elapsed := time.Since(startTime)
 			rate := float64(txCount) / elapsed.Seconds()
 
-			logger.Info("Transaction processing statistics",
+			fields := []zap.Field{
+				zap.String("source", name),
 				zap.Uint64("total_transactions", txCount),
+				zap.Uint64("retractions", retractCount),
 				zap.Uint64("errors", errorCount),
 				zap.Duration("uptime", elapsed),
 				zap.Float64("rate_per_second", rate),
-				zap.String("status", string(tronClient.Status())),
-				zap.Bool("connected", tronClient.IsConnected()))
+				zap.String("status", string(source.Status())),
+				zap.Bool("connected", source.IsConnected()),
+			}
+			fields = append(fields, sourceStats(source)...)
+			if tracker != nil {
+				confirmationStats := tracker.Stats()
+				fields = append(fields,
+					zap.Uint64("head_block", confirmationStats.Head),
+					zap.Int("unconfirmed", confirmationStats.Pending),
+					zap.Uint64("confirmed", confirmationStats.Confirmed))
+			}
+			for _, s := range sinks {
+				fields = append(fields, sinkStats(s)...)
+			}
+			logger.Info("Transaction processing statistics", fields...)
 		}
 	}
 }
+
+// newSanctionsScreener creates a screener for the configured sanctions lists
+func newSanctionsScreener(cfg *config.Config, logger *zap.Logger) *sanctions.Screener {
+	var loaders []sanctions.Loader
+	if cfg.Sanctions.OFACEnabled {
+		loaders = append(loaders, sanctions.NewOFACLoader(cfg.Sanctions.OFACURL, cfg.Sanctions.Timeout))
+	}
+	for _, list := range cfg.Sanctions.CSVLists {
+		loaders = append(loaders, sanctions.NewCSVLoader(list.Name, list.Source, cfg.Sanctions.Timeout))
+	}
+
+	return sanctions.NewScreener(sanctions.ScreenerConfig{
+		RefreshInterval: cfg.Sanctions.RefreshInterval,
+	}, loaders, logger.With(zap.String("component", "sanctions")))
+}
+
+// screenTransaction raises an outlier for each sanctioned side of tx,
+// publishing it when there is a publisher
+func screenTransaction(ctx context.Context, tx models.Transaction, screener *sanctions.Screener,
+	publisher detection.OutlierPublisher, logger *zap.Logger) error {
+
+	var errs []error
+	for _, outlier := range screener.Screen(tx) {
+		logger.Warn("Sanctioned address transacted",
+			zap.String("outlier_id", outlier.ID),
+			zap.String("address", outlier.Address),
+			zap.String("tx_hash", tx.TxHash),
+			zap.String("amount", tx.Amount.String()),
+			zap.Any("lists", outlier.Details["lists"]))
+
+		if publisher == nil {
+			continue
+		}
+		if err := publisher.PublishOutlier(ctx, outlier); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// retractTransaction reports a transaction reverted by a chain reorganisation
+// to every sink and invalidates any outliers raised against it. A sink that
+// fails does not stop the others.
+func retractTransaction(ctx context.Context, txHash string, sinks []sink.Sink,
+	outlierStore *detection.OutlierStore, logger *zap.Logger) error {
+
+	var errs []error
+	for _, s := range sinks {
+		if err := s.Retract(ctx, txHash); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if outlierStore == nil {
+		return errors.Join(errs...)
+	}
+
+	retractCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	count, err := outlierStore.InvalidateByTransaction(retractCtx, txHash, models.InvalidReasonChainReorg)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+
+	logger.Info("Reorged transaction retracted",
+		zap.String("tx_hash", txHash),
+		zap.Int64("outliers_invalidated", count))
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,712 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Params is a GraphQL request
+type Params struct {
+	Query         string
+	OperationName string
+	Variables     map[string]interface{} // As decoded from JSON
+	// Authorize reports whether the caller holds a field's Permission. Nil
+	// allows every field.
+	Authorize func(permission string) bool
+}
+
+// Error is a GraphQL error, reported in the response's errors list
+type Error struct {
+	Message   string        `json:"message"`
+	Locations []Location    `json:"locations,omitempty"`
+	Path      []interface{} `json:"path,omitempty"` // Response keys and list indexes
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Location is a position in the query
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Response is the result of a request. Data is only set once the request
+// is valid and execution starts; it may still be null, with errors saying
+// why.
+type Response struct {
+	Data     interface{}
+	Errors   []*Error
+	executed bool
+}
+
+// Executed reports whether the request was valid and execution started. A
+// request that was not executed has errors and no data.
+func (r *Response) Executed() bool {
+	return r.executed
+}
+
+// MarshalJSON encodes the response with data only once executed, per the
+// GraphQL specification
+func (r *Response) MarshalJSON() ([]byte, error) {
+	type withData struct {
+		Data   interface{} `json:"data"`
+		Errors []*Error    `json:"errors,omitempty"`
+	}
+	type withoutData struct {
+		Errors []*Error `json:"errors"`
+	}
+	if r.executed {
+		return json.Marshal(withData{Data: r.Data, Errors: r.Errors})
+	}
+	return json.Marshal(withoutData{Errors: r.Errors})
+}
+
+// Execute runs a query against the schema. Fields resolve in order, one at
+// a time.
+func (s *Schema) Execute(ctx context.Context, params Params) *Response {
+	doc, err := parse(params.Query)
+	if err != nil {
+		return &Response{Errors: []*Error{toError(err)}}
+	}
+
+	op, err := selectOperation(doc, params.OperationName)
+	if err != nil {
+		return &Response{Errors: []*Error{toError(err)}}
+	}
+
+	e := &executor{
+		schema:    s,
+		ctx:       ctx,
+		doc:       doc,
+		authorize: params.Authorize,
+		args:      make(map[*field]map[string]interface{}),
+	}
+	e.coerceVariables(op, params.Variables)
+	if len(e.errors) == 0 {
+		e.validateSelectionSet(s.Query, op.selectionSet, 1, make(map[string]bool))
+	}
+	if len(e.errors) > 0 {
+		return &Response{Errors: e.errors}
+	}
+
+	data, ok := e.selectionSet(s.Query, nil, op.selectionSet, nil)
+	resp := &Response{Errors: e.errors, executed: true}
+	if ok && !e.aborted {
+		resp.Data = data
+	}
+	return resp
+}
+
+// selectOperation picks the operation to run
+func selectOperation(doc *document, name string) (*operation, error) {
+	var op *operation
+	switch {
+	case name != "":
+		for _, candidate := range doc.operations {
+			if candidate.name == name {
+				op = candidate
+			}
+		}
+		if op == nil {
+			return nil, fmt.Errorf("unknown operation %q", name)
+		}
+	case len(doc.operations) > 1:
+		return nil, fmt.Errorf("operationName is required when the query has more than one operation")
+	default:
+		op = doc.operations[0]
+	}
+	if op.kind != "query" {
+		return nil, fmt.Errorf("only queries are supported, not %ss", op.kind)
+	}
+	return op, nil
+}
+
+func toError(err error) *Error {
+	if graphQLError, ok := err.(*Error); ok {
+		return graphQLError
+	}
+	return &Error{Message: err.Error()}
+}
+
+// executor holds the state of one request
+type executor struct {
+	schema    *Schema
+	ctx       context.Context
+	doc       *document
+	authorize func(string) bool
+
+	variables map[string]interface{}            // Values or defaults, by name
+	varTypes  map[string]Type                   // Declared types, by name
+	args      map[*field]map[string]interface{} // Coerced during validation
+	errors    []*Error
+	resolves  int
+	aborted   bool // MaxResolves was exceeded
+}
+
+func (e *executor) fail(f *field, path []interface{}, format string, args ...interface{}) {
+	err := &Error{Message: fmt.Sprintf(format, args...)}
+	if f != nil {
+		err.Locations = []Location{{Line: f.line, Column: f.column}}
+	}
+	if path != nil {
+		err.Path = append([]interface{}{}, path...)
+	}
+	e.errors = append(e.errors, err)
+}
+
+// coerceVariables checks the request's variables against the operation's
+// definitions
+func (e *executor) coerceVariables(op *operation, values map[string]interface{}) {
+	e.variables = make(map[string]interface{})
+	e.varTypes = make(map[string]Type)
+	for _, def := range op.variables {
+		t, err := e.inputType(def.typ)
+		if err != nil {
+			e.fail(nil, nil, "variable $%s: %v", def.name, err)
+			continue
+		}
+		e.varTypes[def.name] = t
+
+		value, ok := values[def.name]
+		if !ok {
+			if def.hasDefault {
+				e.variables[def.name] = def.defaultValue
+			} else if def.typ.nonNull {
+				e.fail(nil, nil, "variable $%s of type %s is required", def.name, def.typ)
+			}
+			continue
+		}
+		if _, err := e.coerce(t, value); err != nil {
+			e.fail(nil, nil, "variable $%s: %v", def.name, err)
+			continue
+		}
+		e.variables[def.name] = value
+	}
+}
+
+// inputType resolves a variable's declared type against the schema
+func (e *executor) inputType(ref *typeRef) (Type, error) {
+	var t Type
+	if ref.elem != nil {
+		elem, err := e.inputType(ref.elem)
+		if err != nil {
+			return nil, err
+		}
+		t = &List{Of: elem}
+	} else {
+		named, ok := e.schema.types[ref.name]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %s", ref.name)
+		}
+		if !isInputType(named) {
+			return nil, fmt.Errorf("%s is not an input type", ref.name)
+		}
+		t = named
+	}
+	if ref.nonNull {
+		t = &NonNull{Of: t}
+	}
+	return t, nil
+}
+
+// coerce converts a literal or JSON value to type t. Variables within it
+// are replaced by their values.
+func (e *executor) coerce(t Type, value interface{}) (interface{}, error) {
+	if name, ok := value.(variable); ok {
+		value = e.variables[string(name)]
+	}
+
+	if nonNull, ok := t.(*NonNull); ok {
+		if value == nil {
+			return nil, fmt.Errorf("expected %s, found null", t)
+		}
+		return e.coerce(nonNull.Of, value)
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	switch v := t.(type) {
+	case *List:
+		items, ok := value.([]interface{})
+		if !ok {
+			item, err := e.coerce(v.Of, value)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{item}, nil
+		}
+		coerced := make([]interface{}, len(items))
+		for i, item := range items {
+			var err error
+			if coerced[i], err = e.coerce(v.Of, item); err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+		return coerced, nil
+	case *Enum:
+		var s string
+		switch literal := value.(type) {
+		case enumValue:
+			s = string(literal)
+		case string:
+			s = literal
+		default:
+			return nil, fmt.Errorf("expected %s", v.Name)
+		}
+		if !v.valid(s) {
+			return nil, fmt.Errorf("%q is not a %s, expected one of %s", s, v.Name, strings.Join(v.Values, ", "))
+		}
+		return s, nil
+	case *Scalar:
+		value, err := number(value)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := value.(enumValue); ok {
+			return nil, fmt.Errorf("expected %s, found %s", v.Name, value)
+		}
+		parsed, err := v.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("%v for %s", err, v.Name)
+		}
+		return parsed, nil
+	}
+	return nil, fmt.Errorf("%s is not an input type", t)
+}
+
+// number converts numeric literals and JSON numbers to int where they are
+// whole, otherwise float64
+func number(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case intValue:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil || n < math.MinInt32 || n > math.MaxInt32 {
+			f, _ := strconv.ParseFloat(string(v), 64)
+			return f, nil
+		}
+		return int(n), nil
+	case floatValue:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", v)
+		}
+		return f, nil
+	case float64:
+		if v == math.Trunc(v) && v >= math.MinInt32 && v <= math.MaxInt32 {
+			return int(v), nil
+		}
+	}
+	return value, nil
+}
+
+// validateSelectionSet checks selections against obj, coercing each
+// field's arguments, before anything is resolved
+func (e *executor) validateSelectionSet(obj *Object, selections []selection, depth int, fragments map[string]bool) {
+	if e.schema.MaxDepth > 0 && depth > e.schema.MaxDepth {
+		e.fail(nil, nil, "query is nested deeper than the maximum depth of %d", e.schema.MaxDepth)
+		return
+	}
+
+	names := make(map[string]string) // Field name by response key
+	for _, sel := range selections {
+		switch s := sel.(type) {
+		case *field:
+			e.validateDirectives(s.directives)
+			if name, ok := names[s.responseKey()]; ok && name != s.name {
+				e.fail(s, nil, "fields %q and %q are both returned as %q; use an alias for one", name, s.name, s.responseKey())
+			}
+			names[s.responseKey()] = s.name
+			e.validateField(obj, s, depth, fragments)
+		case *fragmentSpread:
+			e.validateDirectives(s.directives)
+			f, ok := e.doc.fragments[s.name]
+			if !ok {
+				e.fail(nil, nil, "unknown fragment %q", s.name)
+				continue
+			}
+			if fragments[s.name] {
+				e.fail(nil, nil, "fragment %q spreads itself", s.name)
+				continue
+			}
+			if !e.typeCondition(obj, f.typeCondition) {
+				continue
+			}
+			fragments[s.name] = true
+			e.validateSelectionSet(obj, f.selectionSet, depth, fragments)
+			delete(fragments, s.name)
+		case *inlineFragment:
+			e.validateDirectives(s.directives)
+			if s.typeCondition != "" && !e.typeCondition(obj, s.typeCondition) {
+				continue
+			}
+			e.validateSelectionSet(obj, s.selectionSet, depth, fragments)
+		}
+	}
+}
+
+// typeCondition checks that a fragment on typeName may be spread in obj.
+// Without interfaces or unions, that needs the same type.
+func (e *executor) typeCondition(obj *Object, typeName string) bool {
+	if _, ok := e.schema.types[typeName]; !ok {
+		e.fail(nil, nil, "unknown type %q", typeName)
+		return false
+	}
+	if typeName != obj.Name {
+		e.fail(nil, nil, "fragment on %s cannot be spread within %s", typeName, obj.Name)
+		return false
+	}
+	return true
+}
+
+func (e *executor) validateField(obj *Object, f *field, depth int, fragments map[string]bool) {
+	if f.name == "__typename" {
+		if len(f.arguments) > 0 || f.selectionSet != nil {
+			e.fail(f, nil, "__typename takes no arguments or selections")
+		}
+		return
+	}
+
+	def := obj.field(f.name)
+	if def == nil {
+		e.fail(f, nil, "cannot query field %q on type %s", f.name, obj.Name)
+		return
+	}
+
+	args := make(map[string]interface{})
+	for _, name := range sortedKeys(f.arguments) {
+		if argument(def, name) == nil {
+			e.fail(f, nil, "unknown argument %q on field %s.%s", name, obj.Name, f.name)
+		}
+	}
+	for _, arg := range def.Args {
+		value, given := f.arguments[arg.Name]
+		if name, ok := value.(variable); ok {
+			if _, defined := e.varTypes[string(name)]; !defined {
+				e.fail(f, nil, "variable $%s is not defined", name)
+				continue
+			}
+			_, given = e.variables[string(name)]
+		}
+		if !given {
+			if arg.Default != nil {
+				args[arg.Name] = arg.Default
+			} else if _, required := arg.Type.(*NonNull); required {
+				e.fail(f, nil, "argument %q of type %s is required on field %s.%s", arg.Name, arg.Type, obj.Name, f.name)
+			}
+			continue
+		}
+		coerced, err := e.coerce(arg.Type, value)
+		if err != nil {
+			e.fail(f, nil, "argument %q on field %s.%s: %v", arg.Name, obj.Name, f.name, err)
+			continue
+		}
+		args[arg.Name] = coerced
+	}
+	e.args[f] = args
+
+	child, isObject := namedType(def.Type).(*Object)
+	switch {
+	case isObject && f.selectionSet == nil:
+		e.fail(f, nil, "field %q of type %s must have a selection of subfields", f.name, def.Type)
+	case !isObject && f.selectionSet != nil:
+		e.fail(f, nil, "field %q of type %s has no subfields to select", f.name, def.Type)
+	case isObject:
+		e.validateSelectionSet(child, f.selectionSet, depth+1, fragments)
+	}
+}
+
+// validateDirectives checks @skip and @include, the only directives
+func (e *executor) validateDirectives(directives []*directive) {
+	for _, d := range directives {
+		if d.name != "skip" && d.name != "include" {
+			e.fail(nil, nil, "unknown directive @%s", d.name)
+			continue
+		}
+		if _, err := e.directiveCondition(d); err != nil {
+			e.fail(nil, nil, "@%s: %v", d.name, err)
+		}
+	}
+}
+
+func (e *executor) directiveCondition(d *directive) (bool, error) {
+	value, err := e.coerce(&NonNull{Of: Boolean}, d.arguments["if"])
+	if err != nil {
+		return false, fmt.Errorf("if: %w", err)
+	}
+	return value.(bool), nil
+}
+
+// included applies @skip and @include
+func (e *executor) included(directives []*directive) bool {
+	for _, d := range directives {
+		condition, _ := e.directiveCondition(d)
+		if d.name == "skip" && condition || d.name == "include" && !condition {
+			return false
+		}
+	}
+	return true
+}
+
+func argument(def *Field, name string) *Argument {
+	for _, arg := range def.Args {
+		if arg.Name == name {
+			return arg
+		}
+	}
+	return nil
+}
+
+// namedType strips lists and non-null from t
+func namedType(t Type) Type {
+	for {
+		switch v := t.(type) {
+		case *List:
+			t = v.Of
+		case *NonNull:
+			t = v.Of
+		default:
+			return t
+		}
+	}
+}
+
+// collectFields groups the fields selected on obj by response key, in
+// order, expanding fragments
+func (e *executor) collectFields(selections []selection, keys *[]string, fields map[string][]*field, visited map[string]bool) {
+	for _, sel := range selections {
+		switch s := sel.(type) {
+		case *field:
+			if !e.included(s.directives) {
+				continue
+			}
+			key := s.responseKey()
+			if _, ok := fields[key]; !ok {
+				*keys = append(*keys, key)
+			}
+			fields[key] = append(fields[key], s)
+		case *fragmentSpread:
+			if visited[s.name] || !e.included(s.directives) {
+				continue
+			}
+			visited[s.name] = true
+			e.collectFields(e.doc.fragments[s.name].selectionSet, keys, fields, visited)
+		case *inlineFragment:
+			if e.included(s.directives) {
+				e.collectFields(s.selectionSet, keys, fields, visited)
+			}
+		}
+	}
+}
+
+// selectionSet resolves selections on an object. ok is false when a
+// non-null field was null, making the whole object null.
+func (e *executor) selectionSet(obj *Object, source interface{}, selections []selection, path []interface{}) (result *orderedMap, ok bool) {
+	var keys []string
+	fields := make(map[string][]*field)
+	e.collectFields(selections, &keys, fields, make(map[string]bool))
+
+	result = &orderedMap{values: make(map[string]interface{}, len(keys))}
+	for _, key := range keys {
+		f := fields[key][0]
+		fieldPath := append(path[:len(path):len(path)], key)
+
+		var value interface{}
+		if f.name == "__typename" {
+			value = obj.Name
+		} else {
+			if value, ok = e.resolveField(obj.field(f.name), fields[key], source, fieldPath); !ok {
+				return nil, false
+			}
+		}
+		result.keys = append(result.keys, key)
+		result.values[key] = value
+	}
+	return result, true
+}
+
+// resolveField resolves and completes one field
+func (e *executor) resolveField(def *Field, fields []*field, source interface{}, path []interface{}) (interface{}, bool) {
+	if e.aborted {
+		return nil, true
+	}
+	f := fields[0]
+
+	if def.Permission != "" && e.authorize != nil && !e.authorize(def.Permission) {
+		e.fail(f, path, "permission denied: %s requires the %s permission", f.name, def.Permission)
+		return nullable(def.Type)
+	}
+
+	var value interface{}
+	if def.Resolve != nil {
+		e.resolves++
+		if e.schema.MaxResolves > 0 && e.resolves > e.schema.MaxResolves {
+			e.aborted = true
+			e.fail(f, path, "query fetches more than the maximum of %d fields; narrow it or lower list limits", e.schema.MaxResolves)
+			return nil, true
+		}
+		var err error
+		value, err = def.Resolve(ResolveParams{Context: e.ctx, Source: source, Args: e.args[f]})
+		if err != nil {
+			e.fail(f, path, "%s", err.Error())
+			return nullable(def.Type)
+		}
+	} else {
+		value = defaultResolve(source, def.Name)
+	}
+
+	var selections []selection
+	for _, f := range fields {
+		selections = append(selections, f.selectionSet...)
+	}
+	return e.complete(def.Type, f, selections, value, path)
+}
+
+// nullable returns null for a field, and whether t allows it
+func nullable(t Type) (interface{}, bool) {
+	_, nonNull := t.(*NonNull)
+	return nil, !nonNull
+}
+
+// complete converts a resolved value to its response form by type
+func (e *executor) complete(t Type, f *field, selections []selection, value interface{}, path []interface{}) (interface{}, bool) {
+	if nonNull, ok := t.(*NonNull); ok {
+		if isNil(value) {
+			e.fail(f, path, "%s must not be null", f.responseKey())
+			return nil, false
+		}
+		completed, ok := e.complete(nonNull.Of, f, selections, value, path)
+		// A null here was already reported where it arose
+		return completed, ok && completed != nil
+	}
+	if isNil(value) {
+		return nil, true
+	}
+
+	v := reflect.ValueOf(value)
+	switch t := t.(type) {
+	case *List:
+		for v.Kind() == reflect.Pointer {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			e.fail(f, path, "%s: expected a list, got %T", f.responseKey(), value)
+			return nil, true
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			item, ok := e.complete(t.Of, f, selections, v.Index(i).Interface(), append(path[:len(path):len(path)], i))
+			if !ok {
+				return nil, true
+			}
+			items[i] = item
+		}
+		return items, true
+	case *Object:
+		result, ok := e.selectionSet(t, value, selections, path)
+		if !ok {
+			return nil, true
+		}
+		return result, true
+	case *Enum:
+		for v.Kind() == reflect.Pointer {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.String {
+			e.fail(f, path, "%s: %T is not a %s", f.responseKey(), value, t.Name)
+			return nil, true
+		}
+		if v.String() == "" {
+			return nil, true
+		}
+		if !t.valid(v.String()) {
+			e.fail(f, path, "%s: %q is not a %s", f.responseKey(), v.String(), t.Name)
+			return nil, true
+		}
+		return v.String(), true
+	case *Scalar:
+		if v.Kind() == reflect.Pointer {
+			value = v.Elem().Interface()
+		}
+		serialized, err := t.Serialize(value)
+		if err != nil {
+			e.fail(f, path, "%s: %v", f.responseKey(), err)
+			return nil, true
+		}
+		return serialized, true
+	}
+	return nil, true
+}
+
+// isNil reports whether a resolved value is null. Nil slices are empty
+// lists rather than null.
+func isNil(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Interface, reflect.Func:
+		return v.IsNil()
+	}
+	return false
+}
+
+// defaultResolve reads a field from a map or struct source
+func defaultResolve(source interface{}, name string) interface{} {
+	v := reflect.ValueOf(source)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			if value := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key())); value.IsValid() {
+				return value.Interface()
+			}
+		}
+	case reflect.Struct:
+		value := v.FieldByNameFunc(func(field string) bool { return strings.EqualFold(field, name) })
+		if value.IsValid() && value.CanInterface() {
+			return value.Interface()
+		}
+	}
+	return nil
+}
+
+// orderedMap is a response object, encoded with its fields in the order
+// they were selected
+type orderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		encodedKey, _ := json.Marshal(key)
+		b.Write(encodedKey)
+		b.WriteByte(':')
+		value, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,564 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// document is a parsed query document
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+// operation is a query, mutation or subscription
+type operation struct {
+	kind         string // query, mutation or subscription
+	name         string
+	variables    []*variableDefinition
+	selectionSet []selection
+}
+
+type variableDefinition struct {
+	name         string
+	typ          *typeRef
+	defaultValue interface{} // nil without a default
+	hasDefault   bool
+}
+
+// typeRef is a type as written in a variable definition
+type typeRef struct {
+	name    string   // Named type, when elem is nil
+	elem    *typeRef // List element type
+	nonNull bool
+}
+
+func (t *typeRef) String() string {
+	s := t.name
+	if t.elem != nil {
+		s = "[" + t.elem.String() + "]"
+	}
+	if t.nonNull {
+		s += "!"
+	}
+	return s
+}
+
+// selection is a *field, *fragmentSpread or *inlineFragment
+type selection interface{}
+
+type field struct {
+	alias        string
+	name         string
+	arguments    map[string]interface{}
+	directives   []*directive
+	selectionSet []selection
+	line, column int
+}
+
+// responseKey is the field's alias, or its name without one
+func (f *field) responseKey() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type fragmentSpread struct {
+	name       string
+	directives []*directive
+}
+
+type inlineFragment struct {
+	typeCondition string // Empty for the enclosing type
+	directives    []*directive
+	selectionSet  []selection
+}
+
+type fragment struct {
+	name          string
+	typeCondition string
+	directives    []*directive
+	selectionSet  []selection
+}
+
+type directive struct {
+	name      string
+	arguments map[string]interface{}
+}
+
+// Literal values are parsed to these types, along with string, bool, nil,
+// []interface{} and map[string]interface{}
+type (
+	variable   string // $name
+	enumValue  string
+	intValue   string // Parsed when coerced, so overflow is reported against the argument
+	floatValue string
+)
+
+// token kinds
+const (
+	tokenEOF = iota
+	tokenPunctuator
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind         int
+	value        string
+	line, column int
+}
+
+// parser is a recursive descent parser over a lexed query
+type parser struct {
+	source string
+	pos    int
+	line   int
+	lineAt int // Offset of the current line
+	tok    token
+}
+
+// parse parses a query document
+func parse(source string) (doc *document, err error) {
+	p := &parser{source: strings.TrimPrefix(source, "\ufeff"), line: 1}
+	defer func() {
+		if r := recover(); r != nil {
+			syntax, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, syntax
+		}
+	}()
+
+	p.next()
+	doc = &document{fragments: make(map[string]*fragment)}
+	for p.tok.kind != tokenEOF {
+		switch {
+		case p.peek("{"):
+			doc.operations = append(doc.operations, &operation{kind: "query", selectionSet: p.selectionSet()})
+		case p.tok.kind == tokenName && p.tok.value == "fragment":
+			f := p.fragmentDefinition()
+			if _, ok := doc.fragments[f.name]; ok {
+				p.fail("fragment %q is defined more than once", f.name)
+			}
+			doc.fragments[f.name] = f
+		case p.tok.kind == tokenName && (p.tok.value == "query" || p.tok.value == "mutation" || p.tok.value == "subscription"):
+			doc.operations = append(doc.operations, p.operationDefinition())
+		default:
+			p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, &Error{Message: "query has no operations"}
+	}
+	return doc, nil
+}
+
+func (p *parser) operationDefinition() *operation {
+	op := &operation{kind: p.tok.value}
+	p.next()
+	if p.tok.kind == tokenName {
+		op.name = p.name()
+	}
+	if p.skip("(") {
+		for !p.skip(")") {
+			op.variables = append(op.variables, p.variableDefinition())
+		}
+	}
+	p.directives()
+	op.selectionSet = p.selectionSet()
+	return op
+}
+
+func (p *parser) variableDefinition() *variableDefinition {
+	p.expect("$")
+	def := &variableDefinition{name: p.name()}
+	p.expect(":")
+	def.typ = p.typeRef()
+	if p.skip("=") {
+		def.defaultValue = p.value(true)
+		def.hasDefault = true
+	}
+	p.directives()
+	return def
+}
+
+func (p *parser) typeRef() *typeRef {
+	var t *typeRef
+	if p.skip("[") {
+		t = &typeRef{elem: p.typeRef()}
+		p.expect("]")
+	} else {
+		t = &typeRef{name: p.name()}
+	}
+	if p.skip("!") {
+		t.nonNull = true
+	}
+	return t
+}
+
+func (p *parser) fragmentDefinition() *fragment {
+	p.next() // fragment
+	f := &fragment{name: p.name()}
+	if f.name == "on" {
+		p.fail("fragments must not be named \"on\"")
+	}
+	p.keyword("on")
+	f.typeCondition = p.name()
+	f.directives = p.directives()
+	f.selectionSet = p.selectionSet()
+	return f
+}
+
+func (p *parser) selectionSet() []selection {
+	p.expect("{")
+	var selections []selection
+	for !p.skip("}") {
+		selections = append(selections, p.selection())
+	}
+	if len(selections) == 0 {
+		p.fail("selection sets must not be empty")
+	}
+	return selections
+}
+
+func (p *parser) selection() selection {
+	if p.skip("...") {
+		if p.tok.kind == tokenName && p.tok.value != "on" {
+			return &fragmentSpread{name: p.name(), directives: p.directives()}
+		}
+		inline := &inlineFragment{}
+		if p.tok.kind == tokenName {
+			p.next() // on
+			inline.typeCondition = p.name()
+		}
+		inline.directives = p.directives()
+		inline.selectionSet = p.selectionSet()
+		return inline
+	}
+
+	f := &field{line: p.tok.line, column: p.tok.column}
+	f.name = p.name()
+	if p.skip(":") {
+		f.alias, f.name = f.name, p.name()
+	}
+	f.arguments = p.arguments(false)
+	f.directives = p.directives()
+	if p.peek("{") {
+		f.selectionSet = p.selectionSet()
+	}
+	return f
+}
+
+func (p *parser) arguments(constant bool) map[string]interface{} {
+	if !p.skip("(") {
+		return nil
+	}
+	args := make(map[string]interface{})
+	for !p.skip(")") {
+		name := p.name()
+		if _, ok := args[name]; ok {
+			p.fail("argument %q is given more than once", name)
+		}
+		p.expect(":")
+		args[name] = p.value(constant)
+	}
+	return args
+}
+
+func (p *parser) directives() []*directive {
+	var directives []*directive
+	for p.skip("@") {
+		directives = append(directives, &directive{name: p.name(), arguments: p.arguments(false)})
+	}
+	return directives
+}
+
+// value parses a literal, or a variable unless constant
+func (p *parser) value(constant bool) interface{} {
+	tok := p.tok
+	switch tok.kind {
+	case tokenInt:
+		p.next()
+		return intValue(tok.value)
+	case tokenFloat:
+		p.next()
+		return floatValue(tok.value)
+	case tokenString:
+		p.next()
+		return tok.value
+	case tokenName:
+		p.next()
+		switch tok.value {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return enumValue(tok.value)
+	}
+
+	switch {
+	case p.skip("$"):
+		if constant {
+			p.fail("variables are not allowed here")
+		}
+		return variable(p.name())
+	case p.skip("["):
+		list := []interface{}{}
+		for !p.skip("]") {
+			list = append(list, p.value(constant))
+		}
+		return list
+	case p.skip("{"):
+		object := make(map[string]interface{})
+		for !p.skip("}") {
+			name := p.name()
+			p.expect(":")
+			object[name] = p.value(constant)
+		}
+		return object
+	}
+	p.unexpected()
+	return nil
+}
+
+// name consumes a name token
+func (p *parser) name() string {
+	if p.tok.kind != tokenName {
+		p.unexpected()
+	}
+	name := p.tok.value
+	p.next()
+	return name
+}
+
+// keyword consumes the name token value
+func (p *parser) keyword(value string) {
+	if p.tok.kind != tokenName || p.tok.value != value {
+		p.fail("expected %q, found %s", value, p.describe())
+	}
+	p.next()
+}
+
+// peek reports whether the current token is the punctuator value
+func (p *parser) peek(value string) bool {
+	return p.tok.kind == tokenPunctuator && p.tok.value == value
+}
+
+// skip consumes the punctuator value if it is next
+func (p *parser) skip(value string) bool {
+	if !p.peek(value) {
+		return false
+	}
+	p.next()
+	return true
+}
+
+// expect consumes the punctuator value
+func (p *parser) expect(value string) {
+	if !p.skip(value) {
+		p.fail("expected %q, found %s", value, p.describe())
+	}
+}
+
+func (p *parser) unexpected() {
+	p.fail("unexpected %s", p.describe())
+}
+
+func (p *parser) describe() string {
+	switch p.tok.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenString:
+		return "string " + strconv.Quote(p.tok.value)
+	default:
+		return strconv.Quote(p.tok.value)
+	}
+}
+
+// fail stops parsing with a syntax error at the current token
+func (p *parser) fail(format string, args ...interface{}) {
+	panic(&Error{
+		Message:   "syntax error: " + fmt.Sprintf(format, args...),
+		Locations: []Location{{Line: p.tok.line, Column: p.tok.column}},
+	})
+}
+
+// next lexes the next token, skipping whitespace, commas and comments
+func (p *parser) next() {
+	for p.pos < len(p.source) {
+		switch c := p.source[p.pos]; c {
+		case ' ', '\t', ',', '\r':
+			p.pos++
+			continue
+		case '\n':
+			p.pos++
+			p.line++
+			p.lineAt = p.pos
+			continue
+		case '#':
+			for p.pos < len(p.source) && p.source[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+		break
+	}
+
+	p.tok = token{line: p.line, column: p.pos - p.lineAt + 1}
+	if p.pos >= len(p.source) {
+		p.tok.kind = tokenEOF
+		return
+	}
+
+	start := p.pos
+	c := p.source[p.pos]
+	switch {
+	case strings.HasPrefix(p.source[p.pos:], "..."):
+		p.pos += 3
+		p.tok.kind, p.tok.value = tokenPunctuator, "..."
+	case strings.IndexByte("!$():=@[]{}|&", c) >= 0:
+		p.pos++
+		p.tok.kind, p.tok.value = tokenPunctuator, string(c)
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.source) && (p.source[p.pos] == '_' || isLetter(p.source[p.pos]) || isDigit(p.source[p.pos])) {
+			p.pos++
+		}
+		p.tok.kind, p.tok.value = tokenName, p.source[start:p.pos]
+	case c == '-' || isDigit(c):
+		p.number()
+	case c == '"':
+		p.string()
+	default:
+		r, _ := utf8.DecodeRuneInString(p.source[p.pos:])
+		p.tok.value = string(r)
+		p.fail("unexpected character %q", r)
+	}
+}
+
+// number lexes an int or float
+func (p *parser) number() {
+	start := p.pos
+	p.tok.kind = tokenInt
+	if p.source[p.pos] == '-' {
+		p.pos++
+	}
+	digits := p.digits()
+	if digits == 0 {
+		p.fail("invalid number")
+	}
+	if digits > 1 && p.source[start] == '0' || digits > 1 && p.source[start] == '-' && p.source[start+1] == '0' {
+		p.fail("numbers must not have leading zeros")
+	}
+	if p.pos < len(p.source) && p.source[p.pos] == '.' {
+		p.pos++
+		p.tok.kind = tokenFloat
+		if p.digits() == 0 {
+			p.fail("invalid number")
+		}
+	}
+	if p.pos < len(p.source) && (p.source[p.pos] == 'e' || p.source[p.pos] == 'E') {
+		p.pos++
+		p.tok.kind = tokenFloat
+		if p.pos < len(p.source) && (p.source[p.pos] == '+' || p.source[p.pos] == '-') {
+			p.pos++
+		}
+		if p.digits() == 0 {
+			p.fail("invalid number")
+		}
+	}
+	if p.pos < len(p.source) && (p.source[p.pos] == '_' || isLetter(p.source[p.pos]) || p.source[p.pos] == '.') {
+		p.fail("invalid number")
+	}
+	p.tok.value = p.source[start:p.pos]
+}
+
+func (p *parser) digits() int {
+	start := p.pos
+	for p.pos < len(p.source) && isDigit(p.source[p.pos]) {
+		p.pos++
+	}
+	return p.pos - start
+}
+
+// string lexes a quoted or block string
+func (p *parser) string() {
+	p.tok.kind = tokenString
+	if strings.HasPrefix(p.source[p.pos:], `"""`) {
+		p.pos += 3
+		end := strings.Index(p.source[p.pos:], `"""`)
+		if end < 0 {
+			p.fail("unterminated string")
+		}
+		raw := p.source[p.pos : p.pos+end]
+		p.line += strings.Count(raw, "\n")
+		if i := strings.LastIndexByte(raw, '\n'); i >= 0 {
+			p.lineAt = p.pos + i + 1
+		}
+		p.pos += end + 3
+		p.tok.value = strings.TrimSpace(raw)
+		return
+	}
+
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.source) || p.source[p.pos] == '\n' {
+			p.fail("unterminated string")
+		}
+		c := p.source[p.pos]
+		if c == '"' {
+			p.pos++
+			break
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			p.pos++
+			continue
+		}
+		if p.pos+1 >= len(p.source) {
+			p.fail("unterminated string")
+		}
+		escape := p.source[p.pos+1]
+		p.pos += 2
+		switch escape {
+		case '"', '\\', '/':
+			b.WriteByte(escape)
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			if p.pos+4 > len(p.source) {
+				p.fail("invalid unicode escape")
+			}
+			code, err := strconv.ParseUint(p.source[p.pos:p.pos+4], 16, 32)
+			if err != nil {
+				p.fail("invalid unicode escape")
+			}
+			b.WriteRune(rune(code))
+			p.pos += 4
+		default:
+			p.fail("invalid escape \\%c", escape)
+		}
+	}
+	p.tok.value = b.String()
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
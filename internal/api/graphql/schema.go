@@ -0,0 +1,465 @@
+// Package graphql executes GraphQL queries against a schema of Go
+// resolvers. It implements the query language without introspection,
+// mutations or subscriptions: objects, enums, scalars, lists and non-null
+// types, with variables, aliases, fragments and the @skip and @include
+// directives. The schema is published as SDL instead of introspection.
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type is a *Scalar, *Enum, *Object, *List or *NonNull
+type Type interface {
+	String() string // As written in SDL, e.g. [Outlier!]!
+}
+
+// Scalar is a leaf type serialized by a Go function
+type Scalar struct {
+	Name        string
+	Description string
+	// Serialize converts a resolved value to its JSON form
+	Serialize func(value interface{}) (interface{}, error)
+	// Parse converts an argument, as decoded from JSON or written in the
+	// query, to the value resolvers receive
+	Parse func(value interface{}) (interface{}, error)
+}
+
+func (s *Scalar) String() string { return s.Name }
+
+// Enum is a leaf type with a fixed set of string values
+type Enum struct {
+	Name        string
+	Description string
+	Values      []string
+}
+
+func (e *Enum) String() string { return e.Name }
+
+func (e *Enum) valid(value string) bool {
+	for _, v := range e.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Object is a type with fields, each resolved on its own
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*Field
+}
+
+func (o *Object) String() string { return o.Name }
+
+// field returns the named field, or nil
+func (o *Object) field(name string) *Field {
+	for _, f := range o.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// List is a list of another type
+type List struct {
+	Of Type
+}
+
+func (l *List) String() string { return "[" + l.Of.String() + "]" }
+
+// NonNull is another type that is never null
+type NonNull struct {
+	Of Type
+}
+
+func (n *NonNull) String() string { return n.Of.String() + "!" }
+
+// Field is a field of an object
+type Field struct {
+	Name        string
+	Description string
+	Type        Type
+	Args        []*Argument
+	// Permission, when set, is checked with the request's Authorize before
+	// the field is resolved. Without it the field resolves to null with an
+	// error.
+	Permission string
+	// Resolve returns the field's value. Without it the value is read from
+	// the parent: a map's key, or the struct field with the same name
+	// ignoring case.
+	Resolve func(p ResolveParams) (interface{}, error)
+}
+
+// Argument is an argument of a field
+type Argument struct {
+	Name        string
+	Description string
+	Type        Type        // A scalar or enum, or a list or non-null of one
+	Default     interface{} // Given to resolvers when the argument is left out
+}
+
+// ResolveParams are passed to a field's resolver
+type ResolveParams struct {
+	Context context.Context
+	Source  interface{}            // The parent object's value; nil for Query fields
+	Args    map[string]interface{} // Coerced arguments, with defaults applied
+}
+
+// Built-in scalars
+var (
+	String = &Scalar{
+		Name:      "String",
+		Serialize: serializeString,
+		Parse: func(value interface{}) (interface{}, error) {
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a string")
+			}
+			return s, nil
+		},
+	}
+	ID = &Scalar{
+		Name:      "ID",
+		Serialize: serializeString,
+		Parse: func(value interface{}) (interface{}, error) {
+			switch v := value.(type) {
+			case string:
+				return v, nil
+			case int:
+				return strconv.Itoa(v), nil
+			}
+			return nil, fmt.Errorf("expected an ID")
+		},
+	}
+	Int = &Scalar{
+		Name: "Int",
+		Serialize: func(value interface{}) (interface{}, error) {
+			v := reflect.ValueOf(value)
+			var n int64
+			switch v.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				n = v.Int()
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				if v.Uint() > math.MaxInt32 {
+					return nil, fmt.Errorf("%d does not fit in Int", v.Uint())
+				}
+				n = int64(v.Uint())
+			default:
+				return nil, fmt.Errorf("%T is not an Int", value)
+			}
+			if n < math.MinInt32 || n > math.MaxInt32 {
+				return nil, fmt.Errorf("%d does not fit in Int", n)
+			}
+			return n, nil
+		},
+		Parse: func(value interface{}) (interface{}, error) {
+			n, ok := value.(int)
+			if !ok || n < math.MinInt32 || n > math.MaxInt32 {
+				return nil, fmt.Errorf("expected a 32-bit integer")
+			}
+			return n, nil
+		},
+	}
+	Float = &Scalar{
+		Name: "Float",
+		Serialize: func(value interface{}) (interface{}, error) {
+			v := reflect.ValueOf(value)
+			switch v.Kind() {
+			case reflect.Float32, reflect.Float64:
+				f := v.Float()
+				if math.IsNaN(f) || math.IsInf(f, 0) {
+					return nil, fmt.Errorf("%v is not a Float", f)
+				}
+				return f, nil
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				return float64(v.Int()), nil
+			}
+			return nil, fmt.Errorf("%T is not a Float", value)
+		},
+		Parse: func(value interface{}) (interface{}, error) {
+			switch v := value.(type) {
+			case float64:
+				return v, nil
+			case int:
+				return float64(v), nil
+			}
+			return nil, fmt.Errorf("expected a number")
+		},
+	}
+	Boolean = &Scalar{
+		Name: "Boolean",
+		Serialize: func(value interface{}) (interface{}, error) {
+			b, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%T is not a Boolean", value)
+			}
+			return b, nil
+		},
+		Parse: func(value interface{}) (interface{}, error) {
+			b, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("expected a boolean")
+			}
+			return b, nil
+		},
+	}
+	// Time is an RFC 3339 timestamp. The zero time serializes as null.
+	Time = &Scalar{
+		Name:        "Time",
+		Description: "RFC 3339 timestamp",
+		Serialize: func(value interface{}) (interface{}, error) {
+			t, ok := value.(time.Time)
+			if !ok {
+				return nil, fmt.Errorf("%T is not a Time", value)
+			}
+			if t.IsZero() {
+				return nil, nil
+			}
+			return t.Format(time.RFC3339Nano), nil
+		},
+		Parse: func(value interface{}) (interface{}, error) {
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected an RFC 3339 timestamp")
+			}
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return nil, fmt.Errorf("expected an RFC 3339 timestamp")
+			}
+			return t, nil
+		},
+	}
+	// JSON is any JSON value, passed through as is
+	JSON = &Scalar{
+		Name:        "JSON",
+		Description: "Any JSON value",
+		Serialize:   func(value interface{}) (interface{}, error) { return value, nil },
+		Parse:       func(value interface{}) (interface{}, error) { return value, nil },
+	}
+)
+
+// serializeString serializes strings, and types with a string form such as
+// decimals, as String. The empty string serializes as itself.
+func serializeString(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+	if v := reflect.ValueOf(value); v.Kind() == reflect.String {
+		return v.String(), nil
+	}
+	return nil, fmt.Errorf("%T is not a String", value)
+}
+
+// Schema is a query type and the limits on queries against it
+type Schema struct {
+	Query *Object
+	// MaxDepth bounds how deeply selections nest, 0 for no limit
+	MaxDepth int
+	// MaxResolves bounds the fields with a Resolve function one request
+	// resolves, 0 for no limit. Those are the fields that fetch data.
+	MaxResolves int
+
+	types map[string]Type // Named types by name
+	order []string        // Named types in the order SDL prints them
+}
+
+// NewSchema checks a query type and the types it refers to
+func NewSchema(query *Object) (*Schema, error) {
+	s := &Schema{Query: query, types: make(map[string]Type)}
+	for _, scalar := range []*Scalar{String, ID, Int, Float, Boolean} {
+		s.types[scalar.Name] = scalar
+	}
+	if err := s.add(query); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// validName matches GraphQL names
+var validName = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+// add registers t and the types its fields and arguments refer to
+func (s *Schema) add(t Type) error {
+	switch v := t.(type) {
+	case *List:
+		return s.add(v.Of)
+	case *NonNull:
+		if _, ok := v.Of.(*NonNull); ok {
+			return fmt.Errorf("%s: non-null of non-null", v)
+		}
+		return s.add(v.Of)
+	}
+
+	name := t.String()
+	if !validName.MatchString(name) {
+		return fmt.Errorf("%q is not a valid type name", name)
+	}
+	if existing, ok := s.types[name]; ok {
+		if existing != t {
+			return fmt.Errorf("two types are named %s", name)
+		}
+		return nil
+	}
+	s.types[name] = t
+	s.order = append(s.order, name)
+
+	object, ok := t.(*Object)
+	if !ok {
+		return nil
+	}
+	if len(object.Fields) == 0 {
+		return fmt.Errorf("object %s has no fields", object.Name)
+	}
+	seen := make(map[string]bool)
+	for _, f := range object.Fields {
+		if seen[f.Name] {
+			return fmt.Errorf("object %s has two fields named %s", object.Name, f.Name)
+		}
+		seen[f.Name] = true
+		if !validName.MatchString(f.Name) {
+			return fmt.Errorf("%q is not a valid field name on %s", f.Name, object.Name)
+		}
+		if f.Type == nil {
+			return fmt.Errorf("field %s.%s has no type", object.Name, f.Name)
+		}
+		if err := s.add(f.Type); err != nil {
+			return err
+		}
+		for _, arg := range f.Args {
+			if !validName.MatchString(arg.Name) {
+				return fmt.Errorf("%q is not a valid argument name on %s.%s", arg.Name, object.Name, f.Name)
+			}
+			if !isInputType(arg.Type) {
+				return fmt.Errorf("argument %s of %s.%s must be a scalar or enum", arg.Name, object.Name, f.Name)
+			}
+			if err := s.add(arg.Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isInputType reports whether arguments and variables may be of type t
+func isInputType(t Type) bool {
+	switch v := t.(type) {
+	case *Scalar, *Enum:
+		return true
+	case *List:
+		return isInputType(v.Of)
+	case *NonNull:
+		return isInputType(v.Of)
+	}
+	return false
+}
+
+// SDL returns the schema in the GraphQL schema definition language
+func (s *Schema) SDL() string {
+	var b strings.Builder
+	builtin := map[string]bool{"String": true, "ID": true, "Int": true, "Float": true, "Boolean": true}
+
+	for i, name := range s.order {
+		if builtin[name] {
+			continue
+		}
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		switch t := s.types[name].(type) {
+		case *Scalar:
+			writeDescription(&b, "", t.Description)
+			fmt.Fprintf(&b, "scalar %s\n", t.Name)
+		case *Enum:
+			writeDescription(&b, "", t.Description)
+			fmt.Fprintf(&b, "enum %s {\n", t.Name)
+			for _, value := range t.Values {
+				fmt.Fprintf(&b, "  %s\n", value)
+			}
+			b.WriteString("}\n")
+		case *Object:
+			writeDescription(&b, "", t.Description)
+			fmt.Fprintf(&b, "type %s {\n", t.Name)
+			for _, f := range t.Fields {
+				writeDescription(&b, "  ", f.Description)
+				fmt.Fprintf(&b, "  %s", f.Name)
+				if len(f.Args) > 0 {
+					args := make([]string, len(f.Args))
+					for j, arg := range f.Args {
+						args[j] = arg.Name + ": " + arg.Type.String()
+						if arg.Default != nil {
+							args[j] += " = " + literal(arg.Type, arg.Default)
+						}
+					}
+					fmt.Fprintf(&b, "(%s)", strings.Join(args, ", "))
+				}
+				fmt.Fprintf(&b, ": %s\n", f.Type)
+			}
+			b.WriteString("}\n")
+		}
+	}
+	return b.String()
+}
+
+// writeDescription writes a description as a block string
+func writeDescription(b *strings.Builder, indent, description string) {
+	if description == "" {
+		return
+	}
+	if !strings.Contains(description, "\n") {
+		fmt.Fprintf(b, "%s%s\n", indent, strconv.Quote(description))
+		return
+	}
+	fmt.Fprintf(b, "%s\"\"\"\n", indent)
+	for _, line := range strings.Split(description, "\n") {
+		fmt.Fprintf(b, "%s%s\n", indent, line)
+	}
+	fmt.Fprintf(b, "%s\"\"\"\n", indent)
+}
+
+// literal writes a default value as a GraphQL literal of type t
+func literal(t Type, value interface{}) string {
+	switch v := t.(type) {
+	case *NonNull:
+		return literal(v.Of, value)
+	case *Enum:
+		return fmt.Sprint(value)
+	case *List:
+		items := reflect.ValueOf(value)
+		if items.Kind() != reflect.Slice {
+			return literal(v.Of, value)
+		}
+		written := make([]string, items.Len())
+		for i := range written {
+			written[i] = literal(v.Of, items.Index(i).Interface())
+		}
+		return "[" + strings.Join(written, ", ") + "]"
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+// sortedKeys returns a map's keys in order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/enrichment"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// AddressHandler handles address profile requests, combining the graph's
+// view of an address with its outliers and issuer events
+type AddressHandler struct {
+	db             *sql.DB
+	raphtoryClient *graph.RaphtoryClient
+	outliers       *OutlierHandler   // Scans outliers, decrypting their notes
+	screenings     *enrichment.Store // nil when addresses are not screened
+	logger         *zap.Logger
+}
+
+// NewAddressHandler creates a new address handler
+func NewAddressHandler(db *sql.DB, raphtoryClient *graph.RaphtoryClient, outliers *OutlierHandler, logger *zap.Logger) *AddressHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &AddressHandler{
+		db:             db,
+		raphtoryClient: raphtoryClient,
+		outliers:       outliers,
+		logger:         logger,
+	}
+}
+
+// SetScreenings adds chain-analytics providers' latest screening of an
+// address, from screenings, to its profile
+func (h *AddressHandler) SetScreenings(screenings *enrichment.Store) {
+	h.screenings = screenings
+}
+
+// errAddressNotFound is returned for an address nothing has heard of
+var errAddressNotFound = errors.New("address not found")
+
+// GetAddressProfile returns an address's graph activity, risk, recent
+// outliers, watchlist status and top counterparties. The profile is still
+// returned from the database while Raphtory is down, without the graph
+// fields.
+func (h *AddressHandler) GetAddressProfile(c *gin.Context) {
+	var req api.AddressProfileRequest
+
+	// Set defaults
+	req.Outliers = 10
+	req.Counterparties = 10
+
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid query parameters",
+		})
+		return
+	}
+
+	address := c.Param("address")
+	resp, err := h.profile(c, address, req.Outliers, req.Counterparties)
+	if errors.Is(err, errAddressNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Address not found",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to fetch address profile",
+			zap.Error(err),
+			zap.String("address", address))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch address profile",
+		})
+		return
+	}
+
+	jsonWithETag(c, resp, h.logger)
+}
+
+// profile builds an address's profile with up to outliers recent outliers
+// and counterparties top counterparties. It returns errAddressNotFound for
+// an address nothing has heard of.
+func (h *AddressHandler) profile(c *gin.Context, address string, outliers, counterparties int) (*api.AddressProfileResponse, error) {
+	resp := &api.AddressProfileResponse{
+		Address:        address,
+		RecentOutliers: []models.Outlier{},
+		Counterparties: []api.AddressCounterparty{},
+	}
+
+	info, neighborhood := h.graphProfile(c, address)
+	resp.GraphAvailable = info != nil
+	if info != nil {
+		resp.FirstSeen = unixTime(info.FirstSeen)
+		resp.LastSeen = unixTime(info.LastSeen)
+		resp.TransactionCount = info.TransactionCount
+		resp.SentCount = info.SentCount
+		resp.ReceivedCount = info.ReceivedCount
+		resp.TotalSent = info.TotalSent
+		resp.TotalReceived = info.TotalReceived
+		resp.Label, _ = info.Properties[graph.PropertyLabel].(string)
+		resp.Watchlist.Watchlisted, resp.Watchlist.Watchlist = watchlistTag(info.Properties[graph.PropertyWatchlist])
+	}
+
+	recent, err := h.recentOutliers(c, address, outliers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query address outliers: %w", err)
+	}
+	resp.RecentOutliers = recent
+
+	resp.Watchlist.BlacklistedAt, err = h.blacklistedAt(c.Request.Context(), address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query address blacklist events: %w", err)
+	}
+	resp.Watchlist.Blacklisted = resp.Watchlist.BlacklistedAt != nil
+
+	resp.Watchlist.Entries, err = h.watchlistEntries(c.Request.Context(), middleware.GetOrgID(c), address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query address watchlist entries: %w", err)
+	}
+	resp.Watchlist.Watchlisted = resp.Watchlist.Watchlisted || len(resp.Watchlist.Entries) > 0
+
+	labels, err := addressLabels(c.Request.Context(), h.db, []string{address})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query address label: %w", err)
+	}
+	if label, ok := labels[address]; ok {
+		resp.Entity = &label
+		resp.Label = label.Label
+	}
+
+	if h.screenings != nil {
+		resp.ExternalRisk, err = h.screenings.Latest(c.Request.Context(), address)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Nothing anywhere has heard of the address
+	if resp.GraphAvailable && info.TransactionCount == 0 && len(recent) == 0 &&
+		!resp.Watchlist.Blacklisted && !resp.Watchlist.Watchlisted && resp.Entity == nil && resp.ExternalRisk == nil {
+		return nil, errAddressNotFound
+	}
+
+	var neighbors []graph.Neighbor
+	if neighborhood != nil {
+		neighbors = topCounterparties(neighborhood.Neighbors, counterparties)
+		resp.CounterpartiesTruncated = neighborhood.Truncated
+	}
+
+	addresses := make([]string, 0, len(neighbors)+1)
+	addresses = append(addresses, address)
+	for _, neighbor := range neighbors {
+		addresses = append(addresses, neighbor.Address)
+	}
+	risks, err := addressRisks(c.Request.Context(), h.db, middleware.GetOrgID(c), addresses)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query address risk: %w", err)
+	}
+	labels, err = addressLabels(c.Request.Context(), h.db, addresses[1:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to query counterparty labels: %w", err)
+	}
+
+	risk := risks[address]
+	resp.OutlierCount = risk.count
+	resp.MaxSeverity = risk.maxSeverity
+	resp.RiskScore = risk.maxSeverity.RiskScore()
+
+	for _, neighbor := range neighbors {
+		risk := risks[neighbor.Address]
+		resp.Counterparties = append(resp.Counterparties, api.AddressCounterparty{
+			Address:          neighbor.Address,
+			TransactionCount: neighbor.SentCount + neighbor.ReceivedCount,
+			SentCount:        neighbor.SentCount,
+			ReceivedCount:    neighbor.ReceivedCount,
+			Sent:             neighbor.Sent,
+			Received:         neighbor.Received,
+			FirstSeen:        unixTime(neighbor.FirstSeen),
+			LastSeen:         unixTime(neighbor.LastSeen),
+			RiskScore:        risk.maxSeverity.RiskScore(),
+			MaxSeverity:      risk.maxSeverity,
+			Label:            labels[neighbor.Address].Label,
+			Category:         labels[neighbor.Address].Category,
+		})
+	}
+
+	return resp, nil
+}
+
+// graphProfile reads the address and its direct counterparties from
+// Raphtory. An address Raphtory has not seen has an empty NodeInfo. Both
+// are nil if Raphtory could not answer, which leaves the rest of the
+// profile usable.
+func (h *AddressHandler) graphProfile(c *gin.Context, address string) (*graph.NodeInfo, *graph.Neighborhood) {
+	info, err := h.raphtoryClient.GetNodeInfo(c.Request.Context(), address)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Warn("Failed to get node info from Raphtory, profile will omit graph fields",
+			zap.Error(err),
+			zap.String("address", address))
+		return nil, nil
+	}
+	if info == nil {
+		return &graph.NodeInfo{Address: address}, &graph.Neighborhood{Address: address}
+	}
+
+	neighborhood, err := h.raphtoryClient.GetNeighbors(c.Request.Context(), address, 1, graph.Window{})
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Warn("Failed to get counterparties from Raphtory, profile will omit them",
+			zap.Error(err),
+			zap.String("address", address))
+		return info, nil
+	}
+	return info, neighborhood
+}
+
+// recentOutliers returns the address's newest outliers in the caller's
+// organization
+func (h *AddressHandler) recentOutliers(c *gin.Context, address string, limit int) ([]models.Outlier, error) {
+	rows, err := h.db.QueryContext(c.Request.Context(),
+		`SELECT `+outlierColumns+` FROM `+outliersSeenBy("$1")+` WHERE address = $2 ORDER BY detected_at DESC LIMIT $3`,
+		middleware.GetOrgID(c), address, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	outliers := []models.Outlier{}
+	for rows.Next() {
+		outlier, err := h.outliers.scanOutlier(c, rows)
+		if err != nil {
+			return nil, err
+		}
+		outliers = append(outliers, *outlier)
+	}
+	return outliers, rows.Err()
+}
+
+// blacklistedAt returns when the token issuer blacklisted the address, or
+// nil if it has not, or has since removed it
+func (h *AddressHandler) blacklistedAt(ctx context.Context, address string) (*time.Time, error) {
+	var eventType models.IssuerEventType
+	var timestamp time.Time
+	err := h.db.QueryRowContext(ctx, `
+		SELECT type, timestamp
+		FROM issuer_events
+		WHERE address = $1 AND type IN ($2, $3)
+		ORDER BY timestamp DESC
+		LIMIT 1
+	`, address, models.IssuerEventBlacklisted, models.IssuerEventUnblacklisted).Scan(&eventType, &timestamp)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if eventType != models.IssuerEventBlacklisted {
+		return nil, nil
+	}
+	return &timestamp, nil
+}
+
+// watchlistEntries returns the unexpired entries for the address on an
+// organization's watchlists
+func (h *AddressHandler) watchlistEntries(ctx context.Context, orgID, address string) ([]models.WatchlistEntry, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT `+watchlistEntryColumns+`
+		FROM watchlist_entries e
+		JOIN watchlists w ON w.id = e.watchlist_id
+		WHERE e.address = $1 AND w.org_id = $2 AND (e.expires_at IS NULL OR e.expires_at > $3)
+		ORDER BY w.name
+	`, address, orgID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.WatchlistEntry
+	for rows.Next() {
+		entry, err := scanWatchlistEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, rows.Err()
+}
+
+// topCounterparties returns the limit neighbors with the most transactions,
+// ties broken by address
+func topCounterparties(neighbors []graph.Neighbor, limit int) []graph.Neighbor {
+	ranked := append([]graph.Neighbor(nil), neighbors...)
+	sort.Slice(ranked, func(i, j int) bool {
+		ci := ranked[i].SentCount + ranked[i].ReceivedCount
+		cj := ranked[j].SentCount + ranked[j].ReceivedCount
+		if ci != cj {
+			return ci > cj
+		}
+		return ranked[i].Address < ranked[j].Address
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+// watchlistTag reads the graph's watchlist tag, which is either a watchlist
+// name or true
+func watchlistTag(value interface{}) (bool, string) {
+	switch v := value.(type) {
+	case string:
+		return v != "", v
+	case bool:
+		return v, ""
+	default:
+		return false, ""
+	}
+}
@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// APIKeyHandler handles API key management requests
+type APIKeyHandler struct {
+	db     *sql.DB
+	roles  security.PermissionChecker
+	logger *zap.Logger
+}
+
+// NewAPIKeyHandler creates a new API key handler. roles decides which
+// scopes a key's owner may grant.
+func NewAPIKeyHandler(db *sql.DB, roles security.PermissionChecker, logger *zap.Logger) *APIKeyHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &APIKeyHandler{
+		db:     db,
+		roles:  roles,
+		logger: logger,
+	}
+}
+
+// ListAPIKeys returns the caller's organization's API keys, optionally
+// filtered by owner and active status. Keys themselves are never returned,
+// only their prefixes.
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	var req api.APIKeyListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid query parameters",
+		})
+		return
+	}
+
+	where := ` WHERE k.org_id = $1`
+	args := []interface{}{middleware.GetOrgID(c)}
+	if req.UserID != "" {
+		args = append(args, req.UserID)
+		where += fmt.Sprintf(` AND k.user_id = $%d`, len(args))
+	}
+	if req.Active != nil {
+		args = append(args, *req.Active)
+		where += fmt.Sprintf(` AND k.is_active = $%d`, len(args))
+	}
+
+	rows, err := h.db.QueryContext(c.Request.Context(), `SELECT `+security.APIKeyColumns+where+` ORDER BY k.created_at, k.id`, args...)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query API keys", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch API keys",
+		})
+		return
+	}
+	defer rows.Close()
+
+	apiKeys := []models.APIKey{}
+	for rows.Next() {
+		apiKey, err := security.ScanAPIKey(rows)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan API key", zap.Error(err))
+			continue
+		}
+		apiKeys = append(apiKeys, *apiKey)
+	}
+
+	c.JSON(http.StatusOK, api.APIKeyListResponse{
+		APIKeys: apiKeys,
+		Total:   len(apiKeys),
+	})
+}
+
+// GetAPIKey returns a single API key by ID
+func (h *APIKeyHandler) GetAPIKey(c *gin.Context) {
+	apiKey, err := h.getAPIKey(c.Request.Context(), middleware.GetOrgID(c), c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "API key not found",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to fetch API key",
+			zap.Error(err),
+			zap.String("api_key_id", c.Param("id")))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch API key",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, apiKey)
+}
+
+// CreateAPIKey creates an API key for an active user of the caller's
+// organization. The response carries the key, which is only stored hashed
+// and cannot be retrieved again.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req api.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = c.GetString("user_id")
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "expires_at must be in the future",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	orgID := middleware.GetOrgID(c)
+	if !h.checkScopes(c, orgID, req.UserID, req.Scopes) {
+		return
+	}
+
+	key, prefix, keyHash, err := security.GenerateAPIKey()
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to generate API key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to create API key",
+		})
+		return
+	}
+	scopes, _ := json.Marshal(req.Scopes)
+
+	var createdBy sql.NullString
+	if creator := c.GetString("user_id"); creator != "" {
+		createdBy = sql.NullString{String: creator, Valid: true}
+	}
+
+	id := uuid.New().String()
+	_, err = h.db.ExecContext(ctx, `
+		INSERT INTO api_keys (id, org_id, user_id, key_hash, key_prefix, name, scopes, rate_limit, expires_at, created_by, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, true)
+	`, id, orgID, req.UserID, keyHash, prefix, req.Name, string(scopes), req.RateLimit, req.ExpiresAt, createdBy)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to create API key",
+			zap.Error(err),
+			zap.String("user_id", req.UserID))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to create API key",
+		})
+		return
+	}
+
+	apiKey, err := h.getAPIKey(ctx, orgID, id)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to fetch created API key",
+			zap.Error(err),
+			zap.String("api_key_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch created API key",
+		})
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("API key created",
+		zap.String("api_key_id", id),
+		zap.String("user_id", apiKey.UserID),
+		zap.Strings("scopes", apiKey.Scopes),
+		zap.String("created_by", createdBy.String))
+
+	c.JSON(http.StatusCreated, api.CreateAPIKeyResponse{
+		APIKey: *apiKey,
+		Key:    key,
+	})
+}
+
+// UpdateAPIKey changes an API key's name, scopes, rate limit or active
+// status
+func (h *APIKeyHandler) UpdateAPIKey(c *gin.Context) {
+	var req api.UpdateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	h.update(c, req)
+}
+
+// DeleteAPIKey revokes an API key. Rows are kept so audit logs still
+// resolve to a key.
+func (h *APIKeyHandler) DeleteAPIKey(c *gin.Context) {
+	inactive := false
+	h.update(c, api.UpdateAPIKeyRequest{IsActive: &inactive})
+}
+
+// update applies an UpdateAPIKeyRequest to the key named in the path. It
+// refuses changes to keys whose owner's role grants permissions the caller
+// lacks.
+func (h *APIKeyHandler) update(c *gin.Context, req api.UpdateAPIKeyRequest) {
+	id := c.Param("id")
+	orgID := middleware.GetOrgID(c)
+	ctx := c.Request.Context()
+
+	apiKey, err := h.getAPIKey(ctx, orgID, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "API key not found",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to fetch API key",
+			zap.Error(err),
+			zap.String("api_key_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to update API key",
+		})
+		return
+	}
+
+	if !h.checkOwner(c, apiKey.Role) {
+		return
+	}
+
+	set := ``
+	args := []interface{}{}
+	if req.Name != nil {
+		args = append(args, *req.Name)
+		set += fmt.Sprintf(`, name = $%d`, len(args))
+	}
+	if req.Scopes != nil {
+		if !h.checkScopes(c, orgID, apiKey.UserID, *req.Scopes) {
+			return
+		}
+		scopes, _ := json.Marshal(*req.Scopes)
+		args = append(args, string(scopes))
+		set += fmt.Sprintf(`, scopes = $%d`, len(args))
+	}
+	if req.RateLimit != nil {
+		args = append(args, *req.RateLimit)
+		set += fmt.Sprintf(`, rate_limit = $%d`, len(args))
+	}
+	if req.IsActive != nil {
+		args = append(args, *req.IsActive)
+		set += fmt.Sprintf(`, is_active = $%d`, len(args))
+	}
+
+	if len(args) > 0 {
+		args = append(args, id, orgID)
+		query := `UPDATE api_keys SET ` + set[2:] + fmt.Sprintf(` WHERE id = $%d AND org_id = $%d`, len(args)-1, len(args))
+		if _, err := h.db.ExecContext(ctx, query, args...); err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to update API key",
+				zap.Error(err),
+				zap.String("api_key_id", id))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "internal_error",
+				"message": "Failed to update API key",
+			})
+			return
+		}
+	}
+
+	updated, err := h.getAPIKey(ctx, orgID, id)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to fetch updated API key",
+			zap.Error(err),
+			zap.String("api_key_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch updated API key",
+		})
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("API key updated",
+		zap.String("api_key_id", id),
+		zap.Strings("scopes", updated.Scopes),
+		zap.Bool("is_active", updated.IsActive),
+		zap.String("updated_by", c.GetString("user_id")))
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// checkScopes responds 400 and returns false unless userID is an active
+// user of the organization whose role grants every scope, and 403 unless
+// the caller's own role grants every scope and covers the owner's role
+func (h *APIKeyHandler) checkScopes(c *gin.Context, orgID, userID string, scopes []string) bool {
+	var role models.Role
+	err := h.db.QueryRowContext(c.Request.Context(), `
+		SELECT role FROM users WHERE id = $1 AND org_id = $2 AND is_active = true
+	`, userID, orgID).Scan(&role)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "API key owner not found or inactive",
+		})
+		return false
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to fetch API key owner",
+			zap.Error(err),
+			zap.String("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to check API key scopes",
+		})
+		return false
+	}
+
+	if len(scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "API keys need at least one scope",
+		})
+		return false
+	}
+	for _, scope := range scopes {
+		if !middleware.APIKeyScope(scope) || !h.roles.HasPermission(c.Request.Context(), role, scope) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": fmt.Sprintf("Scope %q is not available to API keys owned by a %s", scope, role),
+			})
+			return false
+		}
+	}
+
+	if !h.checkOwner(c, role) {
+		return false
+	}
+	var callerRole models.Role
+	err = h.db.QueryRowContext(c.Request.Context(), `
+		SELECT role FROM users WHERE id = $1
+	`, middleware.GetUserID(c)).Scan(&callerRole)
+	if err != nil && err != sql.ErrNoRows {
+		middleware.RequestLogger(c, h.logger).Error("Failed to fetch caller's role",
+			zap.Error(err),
+			zap.String("user_id", middleware.GetUserID(c)))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to check API key scopes",
+		})
+		return false
+	}
+	for _, scope := range scopes {
+		if callerRole == "" || !h.roles.HasPermission(c.Request.Context(), callerRole, scope) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "forbidden",
+				"message": fmt.Sprintf("Scope %q is a permission you do not have", scope),
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// checkOwner responds 403 and returns false unless the caller's own role
+// grants every permission the key owner's role does, so a lesser role
+// cannot mint, change or revoke a greater one's keys
+func (h *APIKeyHandler) checkOwner(c *gin.Context, role models.Role) bool {
+	_, covered, err := roleCovered(c, h.db, role)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to check role",
+			zap.Error(err),
+			zap.String("role", string(role)))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to check API key owner",
+		})
+		return false
+	}
+	if !covered {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "forbidden",
+			"message": fmt.Sprintf("API key owner's role %q grants permissions you do not have", role),
+		})
+		return false
+	}
+	return true
+}
+
+// getAPIKey loads an organization's API key by ID, returning sql.ErrNoRows
+// if there is none
+func (h *APIKeyHandler) getAPIKey(ctx context.Context, orgID, id string) (*models.APIKey, error) {
+	return security.ScanAPIKey(h.db.QueryRowContext(ctx, `
+		SELECT `+security.APIKeyColumns+` WHERE k.id = $1 AND k.org_id = $2
+	`, id, orgID))
+}
@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"go.uber.org/zap"
+)
+
+// AuditHandler handles audit log queries
+type AuditHandler struct {
+	db          *sql.DB
+	auditLogger *security.AuditLogger
+	archiver    *security.AuditArchiver
+	logger      *zap.Logger
+}
+
+// NewAuditHandler creates a new audit handler. auditLogger checks each
+// record's signature.
+func NewAuditHandler(db *sql.DB, auditLogger *security.AuditLogger, logger *zap.Logger) *AuditHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &AuditHandler{
+		db:          db,
+		auditLogger: auditLogger,
+		logger:      logger,
+	}
+}
+
+// SetArchiver enables on-demand archival of audit logs past retention
+func (h *AuditHandler) SetArchiver(archiver *security.AuditArchiver) {
+	h.archiver = archiver
+}
+
+// ListAuditLogs returns a paginated list of audit logs, newest first,
+// filtered by user, action, status and time range. Asked with Accept:
+// application/x-ndjson or ?stream=true, it streams every matching log as
+// NDJSON instead.
+func (h *AuditHandler) ListAuditLogs(c *gin.Context) {
+	req := api.AuditLogListRequest{Page: 1, Limit: 50}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid query parameters",
+		})
+		return
+	}
+
+	where, args := auditFilter(req)
+	if wantsStream(c) {
+		h.streamAuditLogs(c, where, args)
+		return
+	}
+
+	var total int
+	if err := h.db.QueryRowContext(c.Request.Context(), `SELECT COUNT(*) FROM audit_logs`+where, args...).Scan(&total); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to count audit logs", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch audit logs",
+		})
+		return
+	}
+
+	query := `SELECT ` + security.AuditLogColumns + ` FROM audit_logs` + where +
+		fmt.Sprintf(` ORDER BY timestamp DESC, sequence DESC, id LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2)
+	args = append(args, req.Limit, (req.Page-1)*req.Limit)
+
+	rows, err := h.db.QueryContext(c.Request.Context(), query, args...)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query audit logs", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch audit logs",
+		})
+		return
+	}
+	defer rows.Close()
+
+	logs := []api.AuditLogEntry{}
+	for rows.Next() {
+		entry, err := h.scanAuditLog(rows)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan audit log", zap.Error(err))
+			continue
+		}
+		logs = append(logs, *entry)
+	}
+
+	c.JSON(http.StatusOK, api.AuditLogListResponse{
+		Logs:       logs,
+		Total:      total,
+		Page:       req.Page,
+		Limit:      req.Limit,
+		TotalPages: int(math.Ceil(float64(total) / float64(req.Limit))),
+	})
+}
+
+// ExportAuditLogs streams every audit log matching the filters, oldest
+// first, as a CSV or JSON download
+func (h *AuditHandler) ExportAuditLogs(c *gin.Context) {
+	req := api.AuditLogListRequest{Format: "json"}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid query parameters",
+		})
+		return
+	}
+
+	where, args := auditFilter(req)
+	rows, err := h.db.QueryContext(c.Request.Context(),
+		`SELECT `+security.AuditLogColumns+` FROM audit_logs`+where+` ORDER BY timestamp, sequence, id`, args...)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query audit logs for export", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to export audit logs",
+		})
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("audit-%s.%s", time.Now().UTC().Format("20060102T150405Z"), req.Format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	// Headers are sent with the first row, so errors after that can only be
+	// logged
+	exported := 0
+	if req.Format == "csv" {
+		c.Header("Content-Type", "text/csv")
+		c.Status(http.StatusOK)
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"id", "timestamp", "user_id", "action", "resource", "status", "ip_address", "details", "signature", "sequence", "signature_valid"})
+		for rows.Next() {
+			entry, err := h.scanAuditLog(rows)
+			if err != nil {
+				middleware.RequestLogger(c, h.logger).Error("Failed to scan audit log", zap.Error(err))
+				continue
+			}
+			details, _ := json.Marshal(entry.Details)
+			w.Write([]string{
+				entry.ID,
+				entry.Timestamp.Format(time.RFC3339Nano),
+				entry.UserID,
+				entry.Action,
+				entry.Resource,
+				entry.Status,
+				entry.IPAddress,
+				string(details),
+				entry.Signature,
+				strconv.FormatInt(entry.Sequence, 10),
+				strconv.FormatBool(entry.SignatureValid),
+			})
+			exported++
+		}
+		w.Flush()
+	} else {
+		c.Header("Content-Type", "application/json")
+		c.Status(http.StatusOK)
+		enc := json.NewEncoder(c.Writer)
+		c.Writer.WriteString("[")
+		for rows.Next() {
+			entry, err := h.scanAuditLog(rows)
+			if err != nil {
+				middleware.RequestLogger(c, h.logger).Error("Failed to scan audit log", zap.Error(err))
+				continue
+			}
+			if exported > 0 {
+				c.Writer.WriteString(",")
+			}
+			enc.Encode(entry)
+			exported++
+		}
+		c.Writer.WriteString("]\n")
+	}
+
+	if err := rows.Err(); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Audit log export interrupted", zap.Error(err), zap.Int("exported", exported))
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Audit logs exported",
+		zap.String("format", req.Format),
+		zap.Int("count", exported),
+		zap.String("exported_by", c.GetString("user_id")))
+}
+
+// streamAuditLogs writes every audit log matching a filter, newest first,
+// as NDJSON
+func (h *AuditHandler) streamAuditLogs(c *gin.Context, where string, args []interface{}) {
+	rows, err := h.db.QueryContext(c.Request.Context(),
+		`SELECT `+security.AuditLogColumns+` FROM audit_logs`+where+` ORDER BY timestamp DESC, sequence DESC, id`, args...)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query audit logs", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch audit logs",
+		})
+		return
+	}
+	defer rows.Close()
+
+	stream := newNDJSONWriter(c)
+	for rows.Next() {
+		entry, err := h.scanAuditLog(rows)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan audit log", zap.Error(err))
+			continue
+		}
+		if err := stream.write(entry); err != nil {
+			middleware.RequestLogger(c, h.logger).Info("Audit log stream closed by client", zap.Int("streamed", stream.written))
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Audit log stream interrupted", zap.Error(err), zap.Int("streamed", stream.written))
+		stream.fail("Audit log stream interrupted")
+		return
+	}
+	stream.flush()
+
+	middleware.RequestLogger(c, h.logger).Info("Audit logs streamed",
+		zap.Int("count", stream.written),
+		zap.String("streamed_by", c.GetString("user_id")))
+}
+
+// VerifyAuditChain checks the audit log hash chain for altered, missing or
+// reordered records
+func (h *AuditHandler) VerifyAuditChain(c *gin.Context) {
+	report, err := h.auditLogger.VerifyChain(c.Request.Context())
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to verify audit chain", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to verify audit chain",
+		})
+		return
+	}
+
+	if !report.Valid {
+		middleware.RequestLogger(c, h.logger).Warn("Audit chain verification failed",
+			zap.Int("problems", len(report.Problems)),
+			zap.String("verified_by", c.GetString("user_id")))
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ArchiveAuditLogs archives audit logs past the retention period now,
+// rather than waiting for the next scheduled run
+func (h *AuditHandler) ArchiveAuditLogs(c *gin.Context) {
+	if h.archiver == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "conflict",
+			"message": "Audit log retention is not configured",
+		})
+		return
+	}
+
+	archives, err := h.archiver.Archive(c.Request.Context())
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to archive audit logs",
+			zap.Error(err),
+			zap.Int("archived", len(archives)))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to archive audit logs",
+		})
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Audit logs archived on request",
+		zap.Int("archives", len(archives)),
+		zap.String("requested_by", c.GetString("user_id")))
+
+	c.JSON(http.StatusOK, api.AuditArchiveListResponse{
+		Archives: archives,
+		Total:    len(archives),
+	})
+}
+
+// ListAuditArchives returns the manifests of archived audit logs
+func (h *AuditHandler) ListAuditArchives(c *gin.Context) {
+	archives, err := security.ListAuditArchives(c.Request.Context(), h.db)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to list audit archives", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch audit archives",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.AuditArchiveListResponse{
+		Archives: archives,
+		Total:    len(archives),
+	})
+}
+
+// scanAuditLog scans a row of security.AuditLogColumns and checks its
+// signature
+func (h *AuditHandler) scanAuditLog(row interface{ Scan(dest ...any) error }) (*api.AuditLogEntry, error) {
+	log, err := security.ScanAuditLog(row)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.AuditLogEntry{
+		ID:             log.ID,
+		Timestamp:      log.Timestamp,
+		UserID:         log.UserID,
+		Action:         log.Action,
+		Resource:       log.Resource,
+		Status:         log.Status,
+		IPAddress:      log.IPAddress,
+		Details:        log.Details,
+		Signature:      log.Signature,
+		Sequence:       log.Sequence,
+		SignatureValid: h.auditLogger.VerifySignature(log),
+	}, nil
+}
+
+// auditFilter builds the WHERE clause for an audit log query
+func auditFilter(req api.AuditLogListRequest) (string, []interface{}) {
+	where := ` WHERE 1=1`
+	args := []interface{}{}
+	if req.UserID != "" {
+		args = append(args, req.UserID)
+		where += fmt.Sprintf(` AND user_id = $%d`, len(args))
+	}
+	if req.Action != "" {
+		args = append(args, req.Action)
+		where += fmt.Sprintf(` AND action = $%d`, len(args))
+	}
+	if req.Status != "" {
+		args = append(args, req.Status)
+		where += fmt.Sprintf(` AND status = $%d`, len(args))
+	}
+	if req.From != nil {
+		args = append(args, req.From.UTC())
+		where += fmt.Sprintf(` AND timestamp >= $%d`, len(args))
+	}
+	if req.To != nil {
+		args = append(args, req.To.UTC())
+		where += fmt.Sprintf(` AND timestamp < $%d`, len(args))
+	}
+	return where, args
+}
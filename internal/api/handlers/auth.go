@@ -2,35 +2,55 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
 	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/internal/security/crypto"
 	"github.com/mikedewar/stablerisk/pkg/models"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // AuthHandler handles authentication requests
 type AuthHandler struct {
-	db         *sql.DB
-	jwtManager *security.JWTManager
-	logger     *zap.Logger
+	db              *sql.DB
+	jwtManager      *security.JWTManager
+	passwordManager *security.PasswordManager
+	loginGuard      *security.LoginGuard
+	fields          fieldCipher
+	logger          *zap.Logger
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(db *sql.DB, jwtManager *security.JWTManager, logger *zap.Logger) *AuthHandler {
+func NewAuthHandler(db *sql.DB, jwtManager *security.JWTManager, passwordManager *security.PasswordManager, logger *zap.Logger) *AuthHandler {
 	if logger == nil {
 		logger = zap.NewNop()
 	}
 
 	return &AuthHandler{
-		db:         db,
-		jwtManager: jwtManager,
-		logger:     logger,
+		db:              db,
+		jwtManager:      jwtManager,
+		passwordManager: passwordManager,
+		logger:          logger,
 	}
 }
 
+// SetLoginGuard enables brute-force protection on Login
+func (h *AuthHandler) SetLoginGuard(guard *security.LoginGuard) {
+	h.loginGuard = guard
+}
+
+// SetCipher decrypts user emails encrypted at rest
+func (h *AuthHandler) SetCipher(cipher *crypto.Cipher) {
+	h.fields = fieldCipher{cipher: cipher}
+}
+
 // Login handles user login
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req models.LoginRequest
@@ -42,14 +62,26 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	ip := c.ClientIP()
+	if h.loginGuard != nil {
+		if verdict, retryAfter := h.loginGuard.Check(c.Request.Context(), req.Username, ip); verdict != security.LoginAllowed {
+			middleware.RequestLogger(c, h.logger).Warn("Login refused by brute-force protection",
+				zap.String("username", req.Username),
+				zap.String("ip", ip))
+			refuseLogin(c, verdict, retryAfter)
+			return
+		}
+	}
+
 	// Query user from database
 	var user models.User
 	err := h.db.QueryRow(`
-		SELECT id, username, email, password_hash, role, created_at, updated_at, last_login, is_active
+		SELECT id, org_id, username, COALESCE(email, ''), password_hash, role, created_at, updated_at, last_login, is_active
 		FROM users
 		WHERE username = $1 AND is_active = true
 	`, req.Username).Scan(
 		&user.ID,
+		&user.OrgID,
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash,
@@ -59,19 +91,19 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		&user.LastLogin,
 		&user.IsActive,
 	)
+	if err == nil {
+		err = h.fields.decryptUser(&user)
+	}
 
 	if err == sql.ErrNoRows {
-		h.logger.Warn("Login failed: user not found",
+		middleware.RequestLogger(c, h.logger).Warn("Login failed: user not found",
 			zap.String("username", req.Username))
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":   "unauthorized",
-			"message": "Invalid username or password",
-		})
+		h.loginFailed(c, req.Username, ip)
 		return
 	}
 
 	if err != nil {
-		h.logger.Error("Database error during login",
+		middleware.RequestLogger(c, h.logger).Error("Database error during login",
 			zap.Error(err),
 			zap.String("username", req.Username))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -82,20 +114,22 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		h.logger.Warn("Login failed: invalid password",
+	if !h.passwordManager.Compare(user.PasswordHash, req.Password) {
+		middleware.RequestLogger(c, h.logger).Warn("Login failed: invalid password",
 			zap.String("username", req.Username))
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":   "unauthorized",
-			"message": "Invalid username or password",
-		})
+		h.loginFailed(c, req.Username, ip)
 		return
 	}
 
+	// Move the password to the configured algorithm and cost
+	if h.passwordManager.NeedsRehash(user.PasswordHash) {
+		h.rehashPassword(c, user.ID, user.PasswordHash, req.Password)
+	}
+
 	// Generate tokens
 	accessToken, err := h.jwtManager.GenerateAccessToken(&user)
 	if err != nil {
-		h.logger.Error("Failed to generate access token",
+		middleware.RequestLogger(c, h.logger).Error("Failed to generate access token",
 			zap.Error(err),
 			zap.String("user_id", user.ID))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -107,7 +141,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	refreshToken, err := h.jwtManager.GenerateRefreshToken(&user)
 	if err != nil {
-		h.logger.Error("Failed to generate refresh token",
+		middleware.RequestLogger(c, h.logger).Error("Failed to generate refresh token",
 			zap.Error(err),
 			zap.String("user_id", user.ID))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -122,12 +156,16 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		UPDATE users SET last_login = CURRENT_TIMESTAMP WHERE id = $1
 	`, user.ID)
 	if err != nil {
-		h.logger.Error("Failed to update last login",
+		middleware.RequestLogger(c, h.logger).Error("Failed to update last login",
 			zap.Error(err),
 			zap.String("user_id", user.ID))
 	}
 
-	h.logger.Info("User logged in successfully",
+	if h.loginGuard != nil {
+		h.loginGuard.RecordSuccess(c.Request.Context(), user.ID, ip)
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("User logged in successfully",
 		zap.String("user_id", user.ID),
 		zap.String("username", user.Username))
 
@@ -140,6 +178,65 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	})
 }
 
+// rehashPassword replaces a verified password's outdated hash. Failures
+// are logged and the login continues, as the old hash still works.
+func (h *AuthHandler) rehashPassword(c *gin.Context, userID, oldHash, password string) {
+	hash, err := h.passwordManager.Rehash(password)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Warn("Failed to rehash password",
+			zap.Error(err),
+			zap.String("user_id", userID))
+		return
+	}
+
+	// Leave the hash alone if the password changed meanwhile
+	_, err = h.db.Exec(`
+		UPDATE users SET password_hash = $1 WHERE id = $2 AND password_hash = $3
+	`, hash, userID, oldHash)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to store rehashed password",
+			zap.Error(err),
+			zap.String("user_id", userID))
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Password rehashed",
+		zap.String("user_id", userID))
+}
+
+// loginFailed records a failed login and responds 401, or 423 if the
+// failure locked the account
+func (h *AuthHandler) loginFailed(c *gin.Context, username, ip string) {
+	if h.loginGuard != nil && h.loginGuard.RecordFailure(c.Request.Context(), username, ip) {
+		refuseLogin(c, security.LoginLocked, h.loginGuard.Lockout())
+		return
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"error":   "unauthorized",
+		"message": "Invalid username or password",
+	})
+}
+
+// refuseLogin responds to a login blocked by the login guard, telling the
+// client when to retry
+func refuseLogin(c *gin.Context, verdict security.LoginVerdict, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	if verdict == security.LoginRateLimited {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":   "too_many_requests",
+			"message": "Too many failed login attempts, try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusLocked, gin.H{
+		"error":   "locked",
+		"message": "Account is temporarily locked after repeated failed logins",
+	})
+}
+
 // RefreshToken handles token refresh
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	var req models.RefreshTokenRequest
@@ -154,7 +251,7 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	// Validate refresh token
 	claims, err := h.jwtManager.ValidateToken(req.RefreshToken)
 	if err != nil {
-		h.logger.Warn("Invalid refresh token",
+		middleware.RequestLogger(c, h.logger).Warn("Invalid refresh token",
 			zap.Error(err))
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error":   "unauthorized",
@@ -165,12 +262,14 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 
 	// Query user to ensure still active
 	var user models.User
+	var passwordChangedAt sql.NullTime
 	err = h.db.QueryRow(`
-		SELECT id, username, email, role, created_at, updated_at, last_login, is_active
+		SELECT id, org_id, username, COALESCE(email, ''), role, created_at, updated_at, last_login, is_active, password_changed_at
 		FROM users
 		WHERE id = $1 AND is_active = true
 	`, claims.UserID).Scan(
 		&user.ID,
+		&user.OrgID,
 		&user.Username,
 		&user.Email,
 		&user.Role,
@@ -178,10 +277,14 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		&user.UpdatedAt,
 		&user.LastLogin,
 		&user.IsActive,
+		&passwordChangedAt,
 	)
+	if err == nil {
+		err = h.fields.decryptUser(&user)
+	}
 
 	if err == sql.ErrNoRows {
-		h.logger.Warn("Token refresh failed: user not found or inactive",
+		middleware.RequestLogger(c, h.logger).Warn("Token refresh failed: user not found or inactive",
 			zap.String("user_id", claims.UserID))
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error":   "unauthorized",
@@ -191,7 +294,7 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	}
 
 	if err != nil {
-		h.logger.Error("Database error during token refresh",
+		middleware.RequestLogger(c, h.logger).Error("Database error during token refresh",
 			zap.Error(err),
 			zap.String("user_id", claims.UserID))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -201,10 +304,28 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
+	// A password change or reset revokes the refresh tokens issued before
+	// it. iat has one-second precision, so those from the same second go too.
+	if passwordChangedAt.Valid {
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+		if issuedAt.Before(passwordChangedAt.Time.Truncate(time.Second).Add(time.Second)) {
+			middleware.RequestLogger(c, h.logger).Warn("Token refresh failed: issued before the password was changed",
+				zap.String("user_id", claims.UserID))
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "unauthorized",
+				"message": "Invalid or expired refresh token",
+			})
+			return
+		}
+	}
+
 	// Generate new access token
 	accessToken, err := h.jwtManager.GenerateAccessToken(&user)
 	if err != nil {
-		h.logger.Error("Failed to generate access token",
+		middleware.RequestLogger(c, h.logger).Error("Failed to generate access token",
 			zap.Error(err),
 			zap.String("user_id", user.ID))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -214,7 +335,7 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	h.logger.Debug("Token refreshed",
+	middleware.RequestLogger(c, h.logger).Debug("Token refreshed",
 		zap.String("user_id", user.ID))
 
 	c.JSON(http.StatusOK, gin.H{
@@ -236,11 +357,12 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 
 	var user models.User
 	err := h.db.QueryRow(`
-		SELECT id, username, email, role, created_at, updated_at, last_login, is_active
+		SELECT id, org_id, username, COALESCE(email, ''), role, created_at, updated_at, last_login, is_active
 		FROM users
 		WHERE id = $1
 	`, userID).Scan(
 		&user.ID,
+		&user.OrgID,
 		&user.Username,
 		&user.Email,
 		&user.Role,
@@ -249,6 +371,9 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 		&user.LastLogin,
 		&user.IsActive,
 	)
+	if err == nil {
+		err = h.fields.decryptUser(&user)
+	}
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{
@@ -259,7 +384,7 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 	}
 
 	if err != nil {
-		h.logger.Error("Database error fetching user profile",
+		middleware.RequestLogger(c, h.logger).Error("Database error fetching user profile",
 			zap.Error(err),
 			zap.String("user_id", userID))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -271,3 +396,204 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 
 	c.JSON(http.StatusOK, user)
 }
+
+// ChangePassword sets a new password for the current user after checking
+// their current one. Outstanding reset tokens and refresh tokens are revoked.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": "Authentication required",
+		})
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	var currentHash string
+	err := h.db.QueryRowContext(c.Request.Context(), `
+		SELECT password_hash FROM users WHERE id = $1 AND is_active = true
+	`, userID).Scan(&currentHash)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": "User not found or inactive",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Database error during password change",
+			zap.Error(err),
+			zap.String("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to change password",
+		})
+		return
+	}
+
+	if !h.passwordManager.Compare(currentHash, req.CurrentPassword) {
+		middleware.RequestLogger(c, h.logger).Warn("Password change failed: invalid current password",
+			zap.String("user_id", userID))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Current password is incorrect",
+		})
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "New password must differ from the current one",
+		})
+		return
+	}
+
+	if !h.setPassword(c, userID, req.NewPassword, nil) {
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Password changed",
+		zap.String("user_id", userID))
+
+	c.JSON(http.StatusOK, api.SuccessResponse{
+		Success: true,
+		Message: "Password changed",
+	})
+}
+
+// ResetPassword sets a new password using a one-time token issued by an
+// admin. Each token works once and only until it expires. Refresh tokens
+// issued before the reset are revoked.
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	var userID string
+	err := h.db.QueryRowContext(c.Request.Context(), `
+		SELECT t.user_id FROM password_reset_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > $2 AND u.is_active = true
+	`, security.HashResetToken(req.Token), time.Now().UTC()).Scan(&userID)
+	if err == sql.ErrNoRows {
+		middleware.RequestLogger(c, h.logger).Warn("Password reset failed: invalid or expired token")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid or expired reset token",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Database error during password reset",
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to reset password",
+		})
+		return
+	}
+
+	token := security.HashResetToken(req.Token)
+	if !h.setPassword(c, userID, req.NewPassword, &token) {
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Password reset with token",
+		zap.String("user_id", userID))
+
+	c.JSON(http.StatusOK, api.SuccessResponse{
+		Success: true,
+		Message: "Password reset",
+	})
+}
+
+// setPassword hashes password under the policy, stores it and revokes the
+// user's unused reset tokens and earlier refresh tokens, all in one
+// transaction. If redeem is set, that token must still be unused or
+// nothing changes. On failure it writes the error response and returns
+// false.
+func (h *AuthHandler) setPassword(c *gin.Context, userID, password string, redeem *string) bool {
+	hash, err := h.passwordManager.Hash(password)
+	if errors.Is(err, security.ErrPasswordTooShort) || errors.Is(err, security.ErrPasswordTooLong) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": err.Error(),
+		})
+		return false
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to hash password",
+			zap.Error(err),
+			zap.String("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to set password",
+		})
+		return false
+	}
+
+	ctx := c.Request.Context()
+	fail := func(err error) bool {
+		middleware.RequestLogger(c, h.logger).Error("Failed to set password",
+			zap.Error(err),
+			zap.String("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to set password",
+		})
+		return false
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if redeem != nil {
+		// A concurrent reset with the same token finds it already used
+		result, err := tx.ExecContext(ctx, `
+			UPDATE password_reset_tokens SET used_at = $1 WHERE token_hash = $2 AND used_at IS NULL
+		`, now, *redeem)
+		if err != nil {
+			return fail(err)
+		}
+		if redeemed, err := result.RowsAffected(); err == nil && redeemed == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": "Invalid or expired reset token",
+			})
+			return false
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users SET password_hash = $1, password_changed_at = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3
+	`, hash, now, userID); err != nil {
+		return fail(err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE password_reset_tokens SET used_at = $1 WHERE user_id = $2 AND used_at IS NULL
+	`, now, userID); err != nil {
+		return fail(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+	return true
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// DetectionHandler handles detection management requests
+type DetectionHandler struct {
+	db         *sql.DB
+	jobs       *detection.JobManager
+	thresholds map[models.OutlierType]float64
+	settings   *detection.SettingsStore   // nil when settings cannot be changed
+	detector   *detection.AnomalyDetector // Applies changed settings
+	logger     *zap.Logger
+}
+
+// syncRunTimeout bounds how long a synchronous run holds the request open
+// before falling back to returning the job ID (server write timeout is 15s)
+const syncRunTimeout = 10 * time.Second
+
+// NewDetectionHandler creates a new detection handler. thresholds holds the
+// currently configured threshold for each tunable detector type.
+func NewDetectionHandler(db *sql.DB, jobs *detection.JobManager, thresholds map[models.OutlierType]float64, logger *zap.Logger) *DetectionHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	if thresholds == nil {
+		thresholds = make(map[models.OutlierType]float64)
+	}
+
+	return &DetectionHandler{
+		db:         db,
+		jobs:       jobs,
+		thresholds: thresholds,
+		logger:     logger,
+	}
+}
+
+// GetTuningReport returns per-detector false positive rates and suggested
+// threshold adjustments derived from analyst feedback
+func (h *DetectionHandler) GetTuningReport(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > 365 {
+		days = 30
+	}
+
+	targetFPRate, err := strconv.ParseFloat(c.DefaultQuery("target_fp_rate", "0.2"), 64)
+	if err != nil || targetFPRate <= 0 || targetFPRate >= 1 {
+		targetFPRate = 0.2
+	}
+
+	minSamples, err := strconv.Atoi(c.DefaultQuery("min_samples", "10"))
+	if err != nil || minSamples < 1 {
+		minSamples = 10
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+
+	rows, err := h.db.QueryContext(c.Request.Context(), `
+		SELECT type, details, feedback
+		FROM `+outliersSeenBy("$1")+`
+		WHERE feedback IS NOT NULL AND detected_at >= $2
+	`, middleware.GetOrgID(c), since)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query outlier feedback",
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to build tuning report",
+		})
+		return
+	}
+	defer rows.Close()
+
+	var samples []detection.FeedbackSample
+	for rows.Next() {
+		var outlierType models.OutlierType
+		var detailsJSON []byte
+		var label models.FeedbackLabel
+
+		if err := rows.Scan(&outlierType, &detailsJSON, &label); err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan feedback row",
+				zap.Error(err))
+			continue
+		}
+
+		var details map[string]interface{}
+		if err := json.Unmarshal(detailsJSON, &details); err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to unmarshal outlier details",
+				zap.Error(err))
+		}
+
+		score, hasScore := detection.FeedbackScore(outlierType, details)
+		samples = append(samples, detection.FeedbackSample{
+			Type:     outlierType,
+			Label:    label,
+			Score:    score,
+			HasScore: hasScore,
+		})
+	}
+
+	report := detection.BuildTuningReport(samples, h.currentThresholds(), targetFPRate, minSamples)
+
+	c.JSON(http.StatusOK, gin.H{
+		"report": report,
+		"period": gin.H{
+			"start": since.Format(time.RFC3339),
+			"end":   time.Now().Format(time.RFC3339),
+			"days":  days,
+		},
+	})
+}
+
+// RunDetection runs anomaly detection on demand. By default the request waits
+// for the outliers; with async set, or if the run outlasts the sync timeout,
+// a job is returned for polling instead.
+func (h *DetectionHandler) RunDetection(c *gin.Context) {
+	var req api.DetectionRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	var opts detection.DetectOptions
+	if req.From != nil {
+		opts.StartTime = *req.From
+	}
+	if req.To != nil {
+		opts.EndTime = *req.To
+	}
+	if req.From != nil && req.To != nil && !req.From.Before(*req.To) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "from must be before to",
+		})
+		return
+	}
+	opts.Addresses = req.Addresses
+	opts.Token = req.Token
+
+	job, err := h.jobs.Submit(c.Request.Context(), opts, c.GetString("user_id"))
+	if errors.Is(err, detection.ErrTooManyJobs) {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":   "too_many_requests",
+			"message": "Too many detection runs in progress, try again later",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to submit detection job",
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to start detection",
+		})
+		return
+	}
+
+	if !req.Async {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), syncRunTimeout)
+		defer cancel()
+
+		if finished, ok := h.jobs.Wait(ctx, job.ID); ok {
+			job = finished
+		}
+	}
+
+	switch job.Status {
+	case detection.JobStatusCompleted, detection.JobStatusFailed:
+		c.JSON(http.StatusOK, job)
+	default:
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// GetDetectionJob returns the status and results of an on-demand detection run
+func (h *DetectionHandler) GetDetectionJob(c *gin.Context) {
+	id := c.Param("id")
+
+	job, ok := h.jobs.Get(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Detection job not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// ListDetectionRuns returns a paginated history of detection cycles
+func (h *DetectionHandler) ListDetectionRuns(c *gin.Context) {
+	var req api.DetectionRunListRequest
+
+	// Set defaults
+	req.Page = 1
+	req.Limit = 50
+
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid query parameters",
+		})
+		return
+	}
+
+	where := ` WHERE 1=1`
+	args := []interface{}{}
+
+	if req.Status != "" {
+		args = append(args, req.Status)
+		where += fmt.Sprintf(` AND status = $%d`, len(args))
+	}
+
+	if req.Trigger != "" {
+		args = append(args, req.Trigger)
+		where += fmt.Sprintf(` AND trigger = $%d`, len(args))
+	}
+
+	var total int
+	if err := h.db.QueryRowContext(c.Request.Context(), `SELECT COUNT(*) FROM detection_runs`+where, args...).Scan(&total); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to count detection runs",
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch detection runs",
+		})
+		return
+	}
+
+	query := `
+		SELECT id, trigger, triggered_by, status, started_at, completed_at,
+		       window_start, window_end, transactions_analyzed, outliers_found,
+		       duration_ms, detector_versions, error
+		FROM detection_runs` + where +
+		fmt.Sprintf(` ORDER BY started_at DESC LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2)
+	args = append(args, req.Limit, (req.Page-1)*req.Limit)
+
+	rows, err := h.db.QueryContext(c.Request.Context(), query, args...)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query detection runs",
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch detection runs",
+		})
+		return
+	}
+	defer rows.Close()
+
+	runs := []models.DetectionRun{}
+	for rows.Next() {
+		var run models.DetectionRun
+		var triggeredBy, runError sql.NullString
+		var completedAt sql.NullTime
+		var versionsJSON []byte
+
+		err := rows.Scan(
+			&run.ID,
+			&run.Trigger,
+			&triggeredBy,
+			&run.Status,
+			&run.StartedAt,
+			&completedAt,
+			&run.WindowStart,
+			&run.WindowEnd,
+			&run.TransactionsAnalyzed,
+			&run.OutliersFound,
+			&run.DurationMs,
+			&versionsJSON,
+			&runError,
+		)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan detection run row",
+				zap.Error(err))
+			continue
+		}
+
+		if err := json.Unmarshal(versionsJSON, &run.DetectorVersions); err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to unmarshal detector versions",
+				zap.Error(err))
+		}
+
+		// Parse nullable fields
+		if triggeredBy.Valid {
+			run.TriggeredBy = triggeredBy.String
+		}
+		if completedAt.Valid {
+			run.CompletedAt = &completedAt.Time
+		}
+		if runError.Valid {
+			run.Error = runError.String
+		}
+
+		runs = append(runs, run)
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(req.Limit)))
+
+	c.JSON(http.StatusOK, api.DetectionRunListResponse{
+		Runs:       runs,
+		Total:      total,
+		Page:       req.Page,
+		Limit:      req.Limit,
+		TotalPages: totalPages,
+	})
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// maxDetectionConfigBytes caps the size of a detection config update
+const maxDetectionConfigBytes = 64 << 10
+
+// SetSettingsStore lets the detection configuration be changed through the
+// API. Saved settings are applied to detector straight away; other
+// detectors pick them up from store.
+func (h *DetectionHandler) SetSettingsStore(store *detection.SettingsStore, detector *detection.AnomalyDetector) {
+	h.settings = store
+	h.detector = detector
+}
+
+// GetDetectionConfig returns the detection configuration: the one last
+// saved through the API, or else the file configuration
+func (h *DetectionHandler) GetDetectionConfig(c *gin.Context) {
+	resp, ok := h.detectionConfig(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// UpdateDetectionConfig saves the detection configuration and applies it
+// without a restart. Fields left out of the body keep their current value,
+// as do detectors left out of enabled.
+func (h *DetectionHandler) UpdateDetectionConfig(c *gin.Context) {
+	current, ok := h.detectionConfig(c)
+	if !ok {
+		return
+	}
+
+	badRequest := func(message string) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": message,
+		})
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxDetectionConfigBytes))
+	if err != nil {
+		badRequest("Invalid request body")
+		return
+	}
+	// Decoding over the current configuration leaves omitted fields as they are
+	updated := current.DetectionConfig
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&updated); err != nil {
+		badRequest("Invalid request body")
+		return
+	}
+	if updated.Enabled == nil {
+		updated.Enabled = current.Enabled
+	}
+
+	settings, err := detectionSettings(updated)
+	if err != nil {
+		badRequest(err.Error())
+		return
+	}
+	if err := settings.Validate(); err != nil {
+		badRequest(err.Error())
+		return
+	}
+
+	stored, err := h.settings.Save(c.Request.Context(), settings, c.GetString("user_id"))
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to save detection settings", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to save detection configuration",
+		})
+		return
+	}
+	// Saved settings reach this detector on its next sync even if this fails
+	if err := h.settings.Sync(c.Request.Context(), h.detector); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to apply detection settings", zap.Error(err))
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Detection configuration updated",
+		zap.Int("version", stored.Version),
+		zap.String("updated_by", stored.UpdatedBy))
+
+	c.JSON(http.StatusOK, storedDetectionConfig(stored))
+}
+
+// detectionConfig returns the configuration GetDetectionConfig reports,
+// responding with an error and false if it cannot
+func (h *DetectionHandler) detectionConfig(c *gin.Context) (*api.DetectionConfigResponse, bool) {
+	if h.settings == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error":   "not_implemented",
+			"message": "Detection configuration cannot be changed",
+		})
+		return nil, false
+	}
+
+	stored, err := h.settings.Load(c.Request.Context())
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to load detection settings", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch detection configuration",
+		})
+		return nil, false
+	}
+	if stored != nil {
+		return storedDetectionConfig(stored), true
+	}
+	return &api.DetectionConfigResponse{
+		DetectionConfig: apiDetectionConfig(h.detector.Settings()),
+		Source:          "file",
+	}, true
+}
+
+// currentThresholds returns the threshold in effect for each tunable
+// detector type
+func (h *DetectionHandler) currentThresholds() map[models.OutlierType]float64 {
+	if h.detector == nil {
+		return h.thresholds
+	}
+
+	settings := h.detector.Settings()
+	return map[models.OutlierType]float64{
+		models.OutlierTypeZScore: settings.ZScoreThreshold,
+		models.OutlierTypeIQR:    settings.IQRMultiplier,
+		models.OutlierTypeDBSCAN: settings.DBSCANEpsilon,
+	}
+}
+
+// storedDetectionConfig is the response for saved settings
+func storedDetectionConfig(stored *detection.StoredSettings) *api.DetectionConfigResponse {
+	updatedAt := stored.UpdatedAt
+	return &api.DetectionConfigResponse{
+		DetectionConfig: apiDetectionConfig(stored.Settings),
+		Source:          "database",
+		Version:         stored.Version,
+		UpdatedBy:       stored.UpdatedBy,
+		UpdatedAt:       &updatedAt,
+	}
+}
+
+// apiDetectionConfig converts settings to their API form
+func apiDetectionConfig(settings detection.Settings) api.DetectionConfig {
+	enabled := make(map[models.OutlierType]bool, len(detection.ConfigurableDetectors))
+	for _, outlierType := range detection.ConfigurableDetectors {
+		on, ok := settings.Enabled[outlierType]
+		enabled[outlierType] = on || !ok
+	}
+
+	return api.DetectionConfig{
+		Enabled:           enabled,
+		MinDataPoints:     settings.MinDataPoints,
+		WindowDuration:    settings.WindowDuration.String(),
+		ZScoreThreshold:   settings.ZScoreThreshold,
+		IQRMultiplier:     settings.IQRMultiplier,
+		DBSCANEpsilon:     settings.DBSCANEpsilon,
+		DBSCANMinPoints:   settings.DBSCANMinPoints,
+		CirculationWindow: settings.CirculationWindow.String(),
+		FanWindow:         settings.FanWindow.String(),
+		FanOutThreshold:   settings.FanOutThreshold,
+		FanInThreshold:    settings.FanInThreshold,
+		VelocityWindow:    settings.VelocityWindow.String(),
+		VelocityThreshold: settings.VelocityThreshold,
+		ClusterWindow:     settings.ClusterWindow.String(),
+		ClusterMinSize:    settings.ClusterMinSize,
+		ClusterMinDensity: settings.ClusterMinDensity,
+	}
+}
+
+// detectionSettings converts the API form to settings, parsing durations
+func detectionSettings(config api.DetectionConfig) (detection.Settings, error) {
+	settings := detection.Settings{
+		Enabled:           config.Enabled,
+		MinDataPoints:     config.MinDataPoints,
+		ZScoreThreshold:   config.ZScoreThreshold,
+		IQRMultiplier:     config.IQRMultiplier,
+		DBSCANEpsilon:     config.DBSCANEpsilon,
+		DBSCANMinPoints:   config.DBSCANMinPoints,
+		FanOutThreshold:   config.FanOutThreshold,
+		FanInThreshold:    config.FanInThreshold,
+		VelocityThreshold: config.VelocityThreshold,
+		ClusterMinSize:    config.ClusterMinSize,
+		ClusterMinDensity: config.ClusterMinDensity,
+	}
+
+	for _, duration := range []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"window_duration", config.WindowDuration, &settings.WindowDuration},
+		{"circulation_window", config.CirculationWindow, &settings.CirculationWindow},
+		{"fan_window", config.FanWindow, &settings.FanWindow},
+		{"velocity_window", config.VelocityWindow, &settings.VelocityWindow},
+		{"cluster_window", config.ClusterWindow, &settings.ClusterWindow},
+	} {
+		parsed, err := time.ParseDuration(duration.value)
+		if err != nil {
+			return settings, fmt.Errorf("%s is not a duration", duration.name)
+		}
+		*duration.dest = parsed
+	}
+	return settings, nil
+}
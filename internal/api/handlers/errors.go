@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"go.uber.org/zap"
+)
+
+// internalError logs err with fields and responds with a 500 carrying
+// message
+func internalError(c *gin.Context, logger *zap.Logger, err error, message string, fields ...zap.Field) {
+	middleware.RequestLogger(c, logger).Error(message, append([]zap.Field{zap.Error(err)}, fields...)...)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   "internal_error",
+		"message": message,
+	})
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"go.uber.org/zap"
+)
+
+// jsonWithETag writes obj as a 200 JSON response with an ETag hashed from
+// its encoding. A client whose If-None-Match already names that ETag gets
+// 304 Not Modified without a body, so dashboards polling an unchanged
+// resource do not download it again. Responses are marked private and
+// no-cache: clients keep them but must revalidate before each use.
+func jsonWithETag(c *gin.Context, obj interface{}, logger *zap.Logger) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		middleware.RequestLogger(c, logger).Error("Failed to encode response",
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to encode response",
+		})
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// etagMatches reports whether an If-None-Match header names etag, using
+// the weak comparison RFC 9110 requires for it
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/features"
+	"go.uber.org/zap"
+)
+
+// FeatureHandler handles feature flag requests. Flags gate experimental
+// capabilities so they can be rolled out one environment at a time.
+type FeatureHandler struct {
+	flags  *features.Flags
+	logger *zap.Logger
+}
+
+// NewFeatureHandler creates a new feature flag handler
+func NewFeatureHandler(flags *features.Flags, logger *zap.Logger) *FeatureHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &FeatureHandler{
+		flags:  flags,
+		logger: logger,
+	}
+}
+
+// ListFeatures returns every feature flag and whether it is active in this
+// environment
+func (h *FeatureHandler) ListFeatures(c *gin.Context) {
+	c.JSON(http.StatusOK, api.FeatureFlagListResponse{
+		Environment: h.flags.Environment(),
+		Flags:       h.flags.List(),
+	})
+}
+
+// GetFeature returns a feature flag
+func (h *FeatureHandler) GetFeature(c *gin.Context) {
+	flag, ok := h.flags.Lookup(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Feature flag not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, flag)
+}
+
+// SetFeature saves a feature flag, overriding its configured value
+func (h *FeatureHandler) SetFeature(c *gin.Context) {
+	var req api.SetFeatureFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+	for environment := range req.Environments {
+		if strings.TrimSpace(environment) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": "Environment names must not be empty",
+			})
+			return
+		}
+	}
+
+	name := c.Param("name")
+	flag, err := h.flags.Set(c.Request.Context(), name, *req.Enabled, req.Environments, c.GetString("user_id"))
+	if err != nil {
+		h.flagError(c, err, "Failed to save feature flag")
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Feature flag set",
+		zap.String("flag", name),
+		zap.Bool("enabled", flag.Enabled),
+		zap.Any("environments", flag.Environments),
+		zap.String("updated_by", flag.UpdatedBy))
+
+	c.JSON(http.StatusOK, flag)
+}
+
+// ResetFeature deletes a feature flag's saved value, returning it to its
+// configured value
+func (h *FeatureHandler) ResetFeature(c *gin.Context) {
+	name := c.Param("name")
+	flag, err := h.flags.Reset(c.Request.Context(), name)
+	if err != nil {
+		h.flagError(c, err, "Failed to reset feature flag")
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Feature flag reset",
+		zap.String("flag", name),
+		zap.String("reset_by", c.GetString("user_id")))
+
+	c.JSON(http.StatusOK, flag)
+}
+
+// flagError responds to an error saving or resetting a flag
+func (h *FeatureHandler) flagError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, features.ErrUnknownFlag):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Feature flag not found",
+		})
+	case errors.Is(err, features.ErrNoDatabase):
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error":   "not_implemented",
+			"message": "Feature flags cannot be changed",
+		})
+	default:
+		middleware.RequestLogger(c, h.logger).Error(message, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": message,
+		})
+	}
+}
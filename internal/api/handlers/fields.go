@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/mikedewar/stablerisk/internal/security/crypto"
+	"github.com/mikedewar/stablerisk/pkg/models"
+)
+
+// fieldCipher encrypts sensitive columns on write and decrypts them on
+// read. Without a cipher values are stored as they are, and plaintext
+// written before encryption was enabled always reads back unchanged.
+type fieldCipher struct {
+	cipher *crypto.Cipher
+}
+
+// encrypt returns value as it should be stored, NULL if it is empty
+func (f fieldCipher) encrypt(value string) (sql.NullString, error) {
+	if value == "" {
+		return sql.NullString{}, nil
+	}
+	if f.cipher == nil {
+		return sql.NullString{String: value, Valid: true}, nil
+	}
+
+	encrypted, err := f.cipher.Encrypt(value)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: encrypted, Valid: true}, nil
+}
+
+// decrypt returns the plaintext of a stored value
+func (f fieldCipher) decrypt(value string) (string, error) {
+	if f.cipher == nil {
+		if crypto.IsEncrypted(value) {
+			return "", fmt.Errorf("value is encrypted but no encryption key is configured")
+		}
+		return value, nil
+	}
+	return f.cipher.Decrypt(value)
+}
+
+// index returns the blind index stored alongside an encrypted value, NULL
+// if there is no cipher or value is empty
+func (f fieldCipher) index(value string) sql.NullString {
+	if f.cipher == nil {
+		return sql.NullString{}
+	}
+	index := f.cipher.BlindIndex(value)
+	return sql.NullString{String: index, Valid: index != ""}
+}
+
+// decryptUser decrypts the encrypted fields of a scanned user
+func (f fieldCipher) decryptUser(user *models.User) error {
+	email, err := f.decrypt(user.Email)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt email: %w", err)
+	}
+	user.Email = email
+	return nil
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// GraphHandler handles transaction graph requests
+type GraphHandler struct {
+	db             *sql.DB
+	raphtoryClient *graph.RaphtoryClient
+	logger         *zap.Logger
+}
+
+// NewGraphHandler creates a new graph handler
+func NewGraphHandler(db *sql.DB, raphtoryClient *graph.RaphtoryClient, logger *zap.Logger) *GraphHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &GraphHandler{
+		db:             db,
+		raphtoryClient: raphtoryClient,
+		logger:         logger,
+	}
+}
+
+// GetSubgraph returns the addresses within some hops of an address and the
+// transfers between them, with each address's risk from its outliers
+func (h *GraphHandler) GetSubgraph(c *gin.Context) {
+	var req api.SubgraphRequest
+
+	// Set defaults
+	req.Hops = 2
+
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid query parameters",
+		})
+		return
+	}
+	if req.From != nil && req.To != nil && !req.From.Before(*req.To) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "from must be before to",
+		})
+		return
+	}
+
+	var window graph.Window
+	if req.From != nil {
+		window.Start = *req.From
+	}
+	if req.To != nil {
+		window.End = *req.To
+	}
+
+	subgraph, err := h.raphtoryClient.GetSubgraph(c.Request.Context(), req.Address, req.Hops, window)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to get subgraph from Raphtory",
+			zap.Error(err),
+			zap.String("address", req.Address))
+		if errors.Is(err, graph.ErrRaphtoryUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":   "service_unavailable",
+				"message": "Graph service unavailable",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch subgraph",
+		})
+		return
+	}
+
+	addresses := make([]string, len(subgraph.Nodes))
+	for i, node := range subgraph.Nodes {
+		addresses[i] = node.Address
+	}
+	risks, err := addressRisks(c.Request.Context(), h.db, middleware.GetOrgID(c), addresses)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query address risk",
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch subgraph",
+		})
+		return
+	}
+
+	resp := api.SubgraphResponse{
+		Address:   req.Address,
+		Hops:      req.Hops,
+		From:      req.From,
+		To:        req.To,
+		Nodes:     make([]api.SubgraphNode, len(subgraph.Nodes)),
+		Edges:     make([]api.SubgraphEdge, len(subgraph.Edges)),
+		Truncated: subgraph.Truncated,
+	}
+	for i, node := range subgraph.Nodes {
+		risk := risks[node.Address]
+		resp.Nodes[i] = api.SubgraphNode{
+			ID:               node.Address,
+			Address:          node.Address,
+			Hop:              node.Hop,
+			TransactionCount: node.TransactionCount,
+			Sent:             node.Sent,
+			Received:         node.Received,
+			FirstSeen:        unixTime(node.FirstSeen),
+			LastSeen:         unixTime(node.LastSeen),
+			RiskScore:        risk.maxSeverity.RiskScore(),
+			OutlierCount:     risk.count,
+			MaxSeverity:      risk.maxSeverity,
+		}
+	}
+	for i, edge := range subgraph.Edges {
+		resp.Edges[i] = api.SubgraphEdge{
+			ID:               edge.From + "->" + edge.To,
+			Source:           edge.From,
+			Target:           edge.To,
+			TransactionCount: edge.TransactionCount,
+			Amount:           edge.Amount,
+			FirstSeen:        unixTime(edge.FirstSeen),
+			LastSeen:         unixTime(edge.LastSeen),
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+type addressRisk struct {
+	count       int
+	maxSeverity models.Severity
+}
+
+// addressRisks counts each address's outliers an organization sees that
+// have not been invalidated and finds the most severe
+func addressRisks(ctx context.Context, db *sql.DB, orgID string, addresses []string) (map[string]addressRisk, error) {
+	risks := make(map[string]addressRisk, len(addresses))
+	if len(addresses) == 0 {
+		return risks, nil
+	}
+
+	placeholders := make([]string, len(addresses))
+	args := []interface{}{orgID}
+	for i, address := range addresses {
+		args = append(args, address)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT address, severity, COUNT(*)
+		FROM outliers
+		WHERE `+visibleOutliers("$1")+` AND invalidated = false AND address IN (`+strings.Join(placeholders, ", ")+`)
+		GROUP BY address, severity
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var address string
+		var severity models.Severity
+		var count int
+		if err := rows.Scan(&address, &severity, &count); err != nil {
+			return nil, err
+		}
+
+		risk := risks[address]
+		risk.count += count
+		if severity.RiskScore() > risk.maxSeverity.RiskScore() {
+			risk.maxSeverity = severity
+		}
+		risks[address] = risk
+	}
+	return risks, rows.Err()
+}
+
+// unixTime converts Raphtory's Unix seconds, where 0 means unknown
+func unixTime(seconds int64) *time.Time {
+	if seconds == 0 {
+		return nil
+	}
+	t := time.Unix(seconds, 0).UTC()
+	return &t
+}
@@ -0,0 +1,814 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/graphql"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// maxGraphQLBody bounds the size of a GraphQL request
+const maxGraphQLBody = 1 << 20 // 1 MB
+
+// GraphQLHandler serves outliers, transactions, address profiles and
+// statistics through one GraphQL endpoint, so a screen can fetch nested
+// data, such as an outlier's transaction and its counterparties' profiles,
+// in one request. Each field checks the same permission as the REST route
+// it mirrors.
+type GraphQLHandler struct {
+	db             *sql.DB
+	raphtoryClient *graph.RaphtoryClient
+	outliers       *OutlierHandler // Scans outliers, decrypting their notes
+	addresses      *AddressHandler
+	statistics     *StatisticsHandler
+	rbac           *middleware.RBACMiddleware
+	schema         *graphql.Schema
+	logger         *zap.Logger
+}
+
+// NewGraphQLHandler creates a new GraphQL handler. Fields are authorized
+// with rbac.
+func NewGraphQLHandler(db *sql.DB, raphtoryClient *graph.RaphtoryClient, outliers *OutlierHandler, rbac *middleware.RBACMiddleware, logger *zap.Logger) *GraphQLHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	h := &GraphQLHandler{
+		db:             db,
+		raphtoryClient: raphtoryClient,
+		outliers:       outliers,
+		addresses:      NewAddressHandler(db, raphtoryClient, outliers, logger),
+		statistics:     NewStatisticsHandler(db, raphtoryClient, logger),
+		rbac:           rbac,
+		logger:         logger,
+	}
+	h.schema = h.newSchema()
+	return h
+}
+
+// SetLimits bounds how deeply queries nest and how many fields that fetch
+// data one query may resolve; 0 removes a limit
+func (h *GraphQLHandler) SetLimits(maxDepth, maxResolves int) {
+	h.schema.MaxDepth = maxDepth
+	h.schema.MaxResolves = maxResolves
+}
+
+// Query executes a GraphQL query. Invalid queries get a 400 with the
+// errors; once a query runs the response is a 200, with errors for any
+// fields that failed or were not permitted.
+func (h *GraphQLHandler) Query(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxGraphQLBody)
+
+	var req api.GraphQLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	state := &graphQLRequest{
+		c:            c,
+		profiles:     make(map[string]*api.AddressProfileResponse),
+		transactions: make(map[string]*models.Transaction),
+		labels:       make(map[string]*models.AddressLabel),
+	}
+	resp := h.schema.Execute(context.WithValue(c.Request.Context(), graphQLRequestKey{}, state), graphql.Params{
+		Query:         req.Query,
+		OperationName: req.OperationName,
+		Variables:     req.Variables,
+		Authorize: func(permission string) bool {
+			return h.rbac.HasPermission(c, middleware.Permission(permission))
+		},
+	})
+
+	if !resp.Executed() {
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetSchema returns the schema in the GraphQL schema definition language,
+// for client code generators
+func (h *GraphQLHandler) GetSchema(c *gin.Context) {
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(h.schema.SDL()))
+}
+
+// graphQLRequest is the state of one GraphQL request. Address profiles,
+// transactions and labels are fetched once per request however many times
+// a query asks for them.
+type graphQLRequest struct {
+	c            *gin.Context
+	profiles     map[string]*api.AddressProfileResponse // By address and list sizes; nil if not found
+	transactions map[string]*models.Transaction         // By hash; nil if not found
+	labels       map[string]*models.AddressLabel        // By address; nil if unlabeled
+}
+
+type graphQLRequestKey struct{}
+
+func requestState(ctx context.Context) *graphQLRequest {
+	return ctx.Value(graphQLRequestKey{}).(*graphQLRequest)
+}
+
+// fetchError logs a failed fetch and returns the error reported to the
+// client, which leaves out internal detail
+func (h *GraphQLHandler) fetchError(c *gin.Context, err error, message string, fields ...zap.Field) error {
+	switch {
+	case errors.Is(err, graph.ErrRaphtoryUnavailable):
+		return errors.New("graph service unavailable")
+	case errors.Is(err, graph.ErrRaphtoryUnsupported):
+		return errors.New("not supported by the configured graph transport")
+	}
+	middleware.RequestLogger(c, h.logger).Error("GraphQL: "+message, append(fields, zap.Error(err))...)
+	return errors.New(message)
+}
+
+// GraphQL types for the API's enums and values
+var (
+	graphQLDecimal = &graphql.Scalar{
+		Name:        "Decimal",
+		Description: "Exact decimal number, as a string",
+		Serialize: func(value interface{}) (interface{}, error) {
+			d, ok := value.(decimal.Decimal)
+			if !ok {
+				return nil, fmt.Errorf("%T is not a Decimal", value)
+			}
+			return d.String(), nil
+		},
+		Parse: func(value interface{}) (interface{}, error) {
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a decimal string")
+			}
+			d, err := decimal.NewFromString(s)
+			if err != nil {
+				return nil, fmt.Errorf("expected a decimal string")
+			}
+			return d, nil
+		},
+	}
+	graphQLSeverity = &graphql.Enum{
+		Name: "Severity",
+		Values: []string{string(models.SeverityLow), string(models.SeverityMedium),
+			string(models.SeverityHigh), string(models.SeverityCritical)},
+	}
+	graphQLOutlierType = &graphql.Enum{
+		Name: "OutlierType",
+		Values: []string{string(models.OutlierTypeZScore), string(models.OutlierTypeIQR),
+			string(models.OutlierTypePatternCirculation), string(models.OutlierTypePatternFanOut),
+			string(models.OutlierTypePatternFanIn), string(models.OutlierTypePatternDormant),
+			string(models.OutlierTypePatternVelocity), string(models.OutlierTypePatternCluster),
+			string(models.OutlierTypeDBSCAN), string(models.OutlierTypeWatchlist), string(models.OutlierTypeSanctions)},
+	}
+	graphQLOutlierStatus = &graphql.Enum{
+		Name: "OutlierStatus",
+		Values: []string{string(models.OutlierStatusOpen), string(models.OutlierStatusInvestigating),
+			string(models.OutlierStatusFalsePositive), string(models.OutlierStatusConfirmed)},
+	}
+	graphQLFeedback = &graphql.Enum{
+		Name:   "FeedbackLabel",
+		Values: []string{string(models.FeedbackTruePositive), string(models.FeedbackFalsePositive)},
+	}
+	graphQLChain = &graphql.Enum{
+		Name:   "Chain",
+		Values: []string{string(models.ChainTron), string(models.ChainEthereum)},
+	}
+	graphQLLabelCategory = func() *graphql.Enum {
+		enum := &graphql.Enum{Name: "LabelCategory"}
+		for _, category := range models.LabelCategories {
+			enum.Values = append(enum.Values, string(category))
+		}
+		return enum
+	}()
+)
+
+// nonNull marks a type as never null
+func nonNull(t graphql.Type) graphql.Type {
+	return &graphql.NonNull{Of: t}
+}
+
+// listOf is a non-null list of non-null t
+func listOf(t graphql.Type) graphql.Type {
+	return nonNull(&graphql.List{Of: nonNull(t)})
+}
+
+// profileArgs size an address profile's lists, as the REST query does
+func profileArgs() []*graphql.Argument {
+	return []*graphql.Argument{
+		{Name: "outliers", Type: graphql.Int, Default: 10, Description: "Recent outliers to include, up to 100"},
+		{Name: "counterparties", Type: graphql.Int, Default: 10, Description: "Top counterparties to include, up to 100"},
+	}
+}
+
+// pageArgs page a list
+func pageArgs() []*graphql.Argument {
+	return []*graphql.Argument{
+		{Name: "page", Type: graphql.Int, Default: 1},
+		{Name: "limit", Type: graphql.Int, Default: 50, Description: "Up to 100"},
+	}
+}
+
+// newSchema defines the GraphQL schema
+func (h *GraphQLHandler) newSchema() *graphql.Schema {
+	outlier := &graphql.Object{Name: "Outlier", Description: "An anomaly found by detection"}
+	transaction := &graphql.Object{Name: "Transaction", Description: "A stablecoin transfer, from the transaction graph"}
+	address := &graphql.Object{Name: "Address", Description: "An address's activity, risk and watchlist status"}
+	counterparty := &graphql.Object{Name: "Counterparty", Description: "An address that transacted directly with a profiled address. sent and received are from the profiled address's side."}
+
+	addressLabel := &graphql.Object{Name: "AddressLabel", Description: "A known entity behind an address", Fields: []*graphql.Field{
+		{Name: "address", Type: nonNull(graphql.String)},
+		{Name: "label", Type: nonNull(graphql.String)},
+		{Name: "category", Type: nonNull(graphQLLabelCategory)},
+		{Name: "source", Type: nonNull(graphql.String)},
+		{Name: "updatedBy", Type: graphql.String},
+		{Name: "updatedAt", Type: graphql.Time},
+	}}
+	watchlistEntry := &graphql.Object{Name: "WatchlistEntry", Fields: []*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID)},
+		{Name: "watchlistId", Type: nonNull(graphql.ID)},
+		{Name: "watchlistName", Type: graphql.String},
+		{Name: "address", Type: nonNull(graphql.String)},
+		{Name: "reason", Type: nonNull(graphql.String)},
+		{Name: "expiresAt", Type: graphql.Time, Description: "Null never expires"},
+		{Name: "addedBy", Type: graphql.String},
+		{Name: "addedAt", Type: graphql.Time},
+	}}
+	watchlistStatus := &graphql.Object{Name: "AddressWatchlistStatus", Fields: []*graphql.Field{
+		{Name: "watchlisted", Type: nonNull(graphql.Boolean)},
+		{Name: "watchlist", Type: graphql.String, Description: "Watchlist the address is tagged with in the graph"},
+		{Name: "entries", Type: listOf(watchlistEntry), Description: "Unexpired entries on the API's watchlists"},
+		{Name: "blacklisted", Type: nonNull(graphql.Boolean), Description: "Blacklisted by the token issuer"},
+		{Name: "blacklistedAt", Type: graphql.Time},
+	}}
+
+	profileField := func(name, description string, addressOf func(source interface{}) string) *graphql.Field {
+		return &graphql.Field{
+			Name:        name,
+			Description: description,
+			Type:        address,
+			Args:        profileArgs(),
+			Permission:  string(middleware.PermissionReadOutliers),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return h.resolveProfile(p, addressOf(p.Source))
+			},
+		}
+	}
+	labelField := func(name string, addressOf func(source interface{}) string) *graphql.Field {
+		return &graphql.Field{
+			Name:        name,
+			Description: "Known entity behind the address, if labeled",
+			Type:        addressLabel,
+			Permission:  string(middleware.PermissionReadOutliers),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return h.resolveLabel(p.Context, addressOf(p.Source))
+			},
+		}
+	}
+
+	outlier.Fields = []*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID)},
+		{Name: "detectedAt", Type: nonNull(graphql.Time)},
+		{Name: "type", Type: nonNull(graphQLOutlierType)},
+		{Name: "severity", Type: nonNull(graphQLSeverity)},
+		{Name: "status", Type: nonNull(graphQLOutlierStatus)},
+		{Name: "address", Type: nonNull(graphql.String)},
+		{Name: "transactionHash", Type: graphql.String},
+		{Name: "amount", Type: graphQLDecimal},
+		{Name: "zScore", Type: graphql.Float},
+		{Name: "details", Type: graphql.JSON},
+		{Name: "acknowledged", Type: nonNull(graphql.Boolean)},
+		{Name: "acknowledgedBy", Type: graphql.String},
+		{Name: "acknowledgedAt", Type: graphql.Time},
+		{Name: "notes", Type: graphql.String},
+		{Name: "feedback", Type: graphQLFeedback},
+		{Name: "assignedTo", Type: graphql.String},
+		{Name: "assignedBy", Type: graphql.String},
+		{Name: "assignedAt", Type: graphql.Time},
+		{Name: "invalidated", Type: nonNull(graphql.Boolean)},
+		{Name: "invalidatedAt", Type: graphql.Time},
+		{Name: "invalidReason", Type: graphql.String},
+		{Name: "archivedAt", Type: graphql.Time},
+		{Name: "archivedBy", Type: graphql.String},
+		{
+			Name:        "transaction",
+			Description: "The transaction that raised the outlier; null for pattern outliers without one",
+			Type:        transaction,
+			Permission:  string(middleware.PermissionReadTransactions),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return h.resolveTransaction(p.Context, sourceOutlier(p.Source).TransactionHash)
+			},
+		},
+		profileField("addressProfile", "Profile of the outlier's address", func(source interface{}) string {
+			return sourceOutlier(source).Address
+		}),
+	}
+
+	transaction.Fields = []*graphql.Field{
+		{Name: "txHash", Type: nonNull(graphql.String)},
+		{Name: "blockNumber", Type: nonNull(graphql.Int)},
+		{Name: "timestamp", Type: nonNull(graphql.Time)},
+		{Name: "from", Type: nonNull(graphql.String)},
+		{Name: "to", Type: nonNull(graphql.String)},
+		{Name: "amount", Type: nonNull(graphQLDecimal)},
+		{Name: "contract", Type: nonNull(graphql.String)},
+		{Name: "token", Type: graphql.String},
+		{Name: "chain", Type: graphQLChain},
+		{Name: "confirmed", Type: nonNull(graphql.Boolean)},
+		labelField("fromLabel", func(source interface{}) string { return source.(*models.Transaction).From }),
+		labelField("toLabel", func(source interface{}) string { return source.(*models.Transaction).To }),
+		profileField("fromProfile", "Profile of the sender", func(source interface{}) string {
+			return source.(*models.Transaction).From
+		}),
+		profileField("toProfile", "Profile of the receiver", func(source interface{}) string {
+			return source.(*models.Transaction).To
+		}),
+	}
+
+	counterparty.Fields = []*graphql.Field{
+		{Name: "address", Type: nonNull(graphql.String)},
+		{Name: "transactionCount", Type: nonNull(graphql.Int)},
+		{Name: "sentCount", Type: nonNull(graphql.Int)},
+		{Name: "receivedCount", Type: nonNull(graphql.Int)},
+		{Name: "sent", Type: nonNull(graphQLDecimal)},
+		{Name: "received", Type: nonNull(graphQLDecimal)},
+		{Name: "firstSeen", Type: graphql.Time},
+		{Name: "lastSeen", Type: graphql.Time},
+		{Name: "riskScore", Type: nonNull(graphql.Float)},
+		{Name: "maxSeverity", Type: graphQLSeverity},
+		{Name: "label", Type: graphql.String},
+		{Name: "category", Type: graphQLLabelCategory},
+		profileField("profile", "The counterparty's own profile", func(source interface{}) string {
+			return source.(api.AddressCounterparty).Address
+		}),
+	}
+
+	address.Fields = []*graphql.Field{
+		{Name: "address", Type: nonNull(graphql.String)},
+		{Name: "graphAvailable", Type: nonNull(graphql.Boolean), Description: "False when the graph fields could not be read from Raphtory"},
+		{Name: "firstSeen", Type: graphql.Time},
+		{Name: "lastSeen", Type: graphql.Time},
+		{Name: "transactionCount", Type: nonNull(graphql.Int)},
+		{Name: "sentCount", Type: nonNull(graphql.Int)},
+		{Name: "receivedCount", Type: nonNull(graphql.Int)},
+		{Name: "totalSent", Type: nonNull(graphql.Float)},
+		{Name: "totalReceived", Type: nonNull(graphql.Float)},
+		{Name: "label", Type: graphql.String, Description: "Known entity, from address labels or else the graph"},
+		{Name: "entity", Type: addressLabel},
+		{Name: "riskScore", Type: nonNull(graphql.Float), Description: "0 with no outliers, up to 1 for a critical one"},
+		{Name: "maxSeverity", Type: graphQLSeverity},
+		{Name: "outlierCount", Type: nonNull(graphql.Int), Description: "Outliers that have not been invalidated"},
+		{Name: "recentOutliers", Type: listOf(outlier), Description: "Newest first, including invalidated ones"},
+		{Name: "watchlist", Type: nonNull(watchlistStatus)},
+		{Name: "counterparties", Type: listOf(counterparty), Description: "Most transactions first"},
+		{Name: "counterpartiesTruncated", Type: nonNull(graphql.Boolean)},
+	}
+
+	outlierList := &graphql.Object{Name: "OutlierList", Fields: []*graphql.Field{
+		{Name: "outliers", Type: listOf(outlier)},
+		{Name: "total", Type: nonNull(graphql.Int)},
+		{Name: "page", Type: nonNull(graphql.Int)},
+		{Name: "limit", Type: nonNull(graphql.Int)},
+		{Name: "totalPages", Type: nonNull(graphql.Int)},
+	}}
+	transactionList := &graphql.Object{Name: "TransactionList", Fields: []*graphql.Field{
+		{Name: "transactions", Type: listOf(transaction)},
+		{Name: "total", Type: nonNull(graphql.Int)},
+		{Name: "page", Type: nonNull(graphql.Int)},
+		{Name: "limit", Type: nonNull(graphql.Int)},
+		{Name: "totalPages", Type: nonNull(graphql.Int)},
+	}}
+
+	severityCount := &graphql.Object{Name: "SeverityCount", Fields: []*graphql.Field{
+		{Name: "severity", Type: nonNull(graphQLSeverity)},
+		{Name: "count", Type: nonNull(graphql.Int)},
+	}}
+	typeCount := &graphql.Object{Name: "OutlierTypeCount", Fields: []*graphql.Field{
+		{Name: "type", Type: nonNull(graphQLOutlierType)},
+		{Name: "count", Type: nonNull(graphql.Int)},
+	}}
+	graphStats := &graphql.Object{Name: "GraphStats", Fields: []*graphql.Field{
+		{Name: "nodeCount", Type: nonNull(graphql.Int)},
+		{Name: "edgeCount", Type: nonNull(graphql.Int)},
+		{Name: "earliestTransaction", Type: graphql.Time},
+		{Name: "latestTransaction", Type: graphql.Time},
+	}}
+	addressVolume := &graphql.Object{Name: "AddressVolume", Fields: []*graphql.Field{
+		{Name: "address", Type: nonNull(graphql.String)},
+		{Name: "transactionCount", Type: nonNull(graphql.Int)},
+		{Name: "sent", Type: nonNull(graphQLDecimal)},
+		{Name: "received", Type: nonNull(graphQLDecimal)},
+		{Name: "volume", Type: nonNull(graphQLDecimal), Description: "Sent plus received"},
+	}}
+	activityStats := &graphql.Object{Name: "ActivityStats", Description: "Transfers over a recent window", Fields: []*graphql.Field{
+		{Name: "window", Type: nonNull(graphql.String)},
+		{Name: "start", Type: nonNull(graphql.Time)},
+		{Name: "end", Type: nonNull(graphql.Time)},
+		{Name: "transactionCount", Type: nonNull(graphql.Float)},
+		{Name: "transactionsPerSecond", Type: nonNull(graphql.Float)},
+		{Name: "activeAddresses", Type: nonNull(graphql.Int), Description: "Addresses that sent or received"},
+		{Name: "volume", Type: nonNull(graphQLDecimal), Description: "Total amount transferred"},
+		{Name: "topAddresses", Type: listOf(addressVolume), Description: "Most sent plus received first"},
+	}}
+	statistics := &graphql.Object{Name: "Statistics", Fields: []*graphql.Field{
+		{Name: "totalTransactions", Type: nonNull(graphql.Float), Description: "Transactions in the graph, as a Float since the count can exceed Int"},
+		{Name: "totalOutliers", Type: nonNull(graphql.Int)},
+		{Name: "outliersBySeverity", Type: listOf(severityCount), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			counts := p.Source.(api.StatisticsResponse).OutliersBySeverity
+			var list []map[string]interface{}
+			for severity, count := range counts {
+				list = append(list, map[string]interface{}{"severity": severity, "count": count})
+			}
+			sort.Slice(list, func(i, j int) bool {
+				return list[i]["severity"].(models.Severity).RiskScore() > list[j]["severity"].(models.Severity).RiskScore()
+			})
+			return list, nil
+		}},
+		{Name: "outliersByType", Type: listOf(typeCount), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			counts := p.Source.(api.StatisticsResponse).OutliersByType
+			var list []map[string]interface{}
+			for outlierType, count := range counts {
+				list = append(list, map[string]interface{}{"type": outlierType, "count": count})
+			}
+			sort.Slice(list, func(i, j int) bool {
+				return list[i]["type"].(models.OutlierType) < list[j]["type"].(models.OutlierType)
+			})
+			return list, nil
+		}},
+		{Name: "lastDetectionRun", Type: graphql.Time},
+		{Name: "detectionRunning", Type: nonNull(graphql.Boolean)},
+		{Name: "graph", Type: graphStats, Description: "Null while Raphtory is unavailable"},
+		{Name: "activity", Type: activityStats, Description: "Null while Raphtory is unavailable"},
+	}}
+
+	query := &graphql.Object{Name: "Query", Fields: []*graphql.Field{
+		{
+			Name:        "outliers",
+			Description: "Outliers matching every filter given, newest first unless sorted otherwise",
+			Type:        nonNull(outlierList),
+			Permission:  string(middleware.PermissionReadOutliers),
+			Args: append([]*graphql.Argument{
+				{Name: "type", Type: &graphql.List{Of: nonNull(graphQLOutlierType)}},
+				{Name: "severity", Type: &graphql.List{Of: nonNull(graphQLSeverity)}},
+				{Name: "status", Type: &graphql.List{Of: nonNull(graphQLOutlierStatus)}},
+				{Name: "address", Type: &graphql.List{Of: nonNull(graphql.String)}},
+				{Name: "assignedTo", Type: graphql.String, Description: `User ID, "me" or "none"`},
+				{Name: "acknowledged", Type: graphql.Boolean},
+				{Name: "invalidated", Type: graphql.Boolean},
+				{Name: "archived", Type: graphql.String, Description: `"false" for live outliers (the default), "true" for archived ones or "all"`},
+				{Name: "from", Type: graphql.Time},
+				{Name: "to", Type: graphql.Time},
+				{Name: "minAmount", Type: graphQLDecimal},
+				{Name: "maxAmount", Type: graphQLDecimal},
+				{Name: "sort", Type: graphql.String, Default: "-detected_at", Description: `detected_at, severity, amount or z_score; "-" prefix for descending`},
+			}, pageArgs()...),
+			Resolve: h.resolveOutliers,
+		},
+		{
+			Name:       "outlier",
+			Type:       outlier,
+			Permission: string(middleware.PermissionReadOutliers),
+			Args:       []*graphql.Argument{{Name: "id", Type: nonNull(graphql.ID)}},
+			Resolve:    h.resolveOutlier,
+		},
+		{
+			Name:        "transactions",
+			Description: "Transactions matching every filter given, newest first",
+			Type:        nonNull(transactionList),
+			Permission:  string(middleware.PermissionReadTransactions),
+			Args: append([]*graphql.Argument{
+				{Name: "address", Type: graphql.String, Description: "Sender or receiver"},
+				{Name: "from", Type: graphql.Time},
+				{Name: "to", Type: graphql.Time},
+				{Name: "minAmount", Type: graphQLDecimal},
+				{Name: "maxAmount", Type: graphQLDecimal},
+			}, pageArgs()...),
+			Resolve: h.resolveTransactions,
+		},
+		{
+			Name:       "transaction",
+			Type:       transaction,
+			Permission: string(middleware.PermissionReadTransactions),
+			Args:       []*graphql.Argument{{Name: "hash", Type: nonNull(graphql.String)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return h.resolveTransaction(p.Context, p.Args["hash"].(string))
+			},
+		},
+		{
+			Name:        "address",
+			Description: "An address's profile; null if nothing has heard of it",
+			Type:        address,
+			Permission:  string(middleware.PermissionReadOutliers),
+			Args:        append([]*graphql.Argument{{Name: "address", Type: nonNull(graphql.String)}}, profileArgs()...),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return h.resolveProfile(p, p.Args["address"].(string))
+			},
+		},
+		{
+			Name:       "statistics",
+			Type:       nonNull(statistics),
+			Permission: string(middleware.PermissionReadStatistics),
+			Args: []*graphql.Argument{
+				{Name: "window", Type: graphql.String, Default: "24h", Description: "Recent activity window, from 1m to 720h"},
+				{Name: "top", Type: graphql.Int, Default: 10, Description: "Top addresses by volume, up to 100"},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				window, err := activityWindow(p.Args["window"].(string))
+				if err != nil {
+					return nil, err
+				}
+				top := p.Args["top"].(int)
+				if top < 1 || top > 100 {
+					return nil, fmt.Errorf("top must be between 1 and 100")
+				}
+				return h.statistics.statistics(requestState(p.Context).c, window, top), nil
+			},
+		},
+	}}
+
+	schema, err := graphql.NewSchema(query)
+	if err != nil {
+		panic("invalid GraphQL schema: " + err.Error())
+	}
+	return schema
+}
+
+// sourceOutlier returns an Outlier field's source, which is a pointer when
+// fetched by ID and a value in lists
+func sourceOutlier(source interface{}) *models.Outlier {
+	if outlier, ok := source.(models.Outlier); ok {
+		return &outlier
+	}
+	return source.(*models.Outlier)
+}
+
+// pageArgValues reads and checks the page and limit arguments
+func pageArgValues(args map[string]interface{}) (page, limit int, err error) {
+	page, limit = args["page"].(int), args["limit"].(int)
+	if page < 1 {
+		return 0, 0, fmt.Errorf("page must be at least 1")
+	}
+	if limit < 1 || limit > 100 {
+		return 0, 0, fmt.Errorf("limit must be between 1 and 100")
+	}
+	return page, limit, nil
+}
+
+// stringArgs converts a list argument to strings
+func stringArgs(value interface{}) []string {
+	items, _ := value.([]interface{})
+	values := make([]string, len(items))
+	for i, item := range items {
+		values[i] = item.(string)
+	}
+	return values
+}
+
+// decimalArg formats an optional decimal argument as the REST filters take it
+func decimalArg(value interface{}) string {
+	if d, ok := value.(decimal.Decimal); ok {
+		return d.String()
+	}
+	return ""
+}
+
+// resolveOutliers lists outliers with the REST list's filters and sorts
+func (h *GraphQLHandler) resolveOutliers(p graphql.ResolveParams) (interface{}, error) {
+	c := requestState(p.Context).c
+	page, limit, err := pageArgValues(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	f := api.OutlierFilter{
+		Type:      stringArgs(p.Args["type"]),
+		Severity:  stringArgs(p.Args["severity"]),
+		Status:    stringArgs(p.Args["status"]),
+		Address:   stringArgs(p.Args["address"]),
+		MinAmount: decimalArg(p.Args["minAmount"]),
+		MaxAmount: decimalArg(p.Args["maxAmount"]),
+	}
+	f.AssignedTo, _ = p.Args["assignedTo"].(string)
+	f.Archived, _ = p.Args["archived"].(string)
+	if acknowledged, ok := p.Args["acknowledged"].(bool); ok {
+		f.Acknowledged = &acknowledged
+	}
+	if invalidated, ok := p.Args["invalidated"].(bool); ok {
+		f.Invalidated = &invalidated
+	}
+	for key, timestamp := range map[string]**time.Time{"from": &f.FromTimestamp, "to": &f.ToTimestamp} {
+		if t, ok := p.Args[key].(time.Time); ok {
+			*timestamp = &t
+		}
+	}
+
+	filter, err := outlierFilter(f, middleware.GetOrgID(c), middleware.GetUserID(c))
+	if err != nil {
+		return nil, err
+	}
+	order, ok := orderBy(p.Args["sort"].(string), outlierSortOrders)
+	if !ok {
+		return nil, fmt.Errorf("sort must be detected_at, severity, amount or z_score, prefixed with - for descending")
+	}
+
+	var total int
+	if err := h.db.QueryRowContext(p.Context, `SELECT COUNT(*) FROM `+outliersSeenBy("$1")+filter.clause(), filter.args...).Scan(&total); err != nil {
+		return nil, h.fetchError(c, err, "failed to count outliers")
+	}
+	pagination, args := filter.page(page, limit)
+	outliers, err := h.queryOutliers(c, `SELECT `+outlierColumns+` FROM `+outliersSeenBy("$1")+filter.clause()+order+pagination, args...)
+	if err != nil {
+		return nil, h.fetchError(c, err, "failed to fetch outliers")
+	}
+
+	return &api.OutlierListResponse{
+		Outliers:   outliers,
+		Total:      total,
+		Page:       page,
+		Limit:      limit,
+		TotalPages: int(math.Ceil(float64(total) / float64(limit))),
+	}, nil
+}
+
+// queryOutliers runs a query for outlierColumns
+func (h *GraphQLHandler) queryOutliers(c *gin.Context, query string, args ...interface{}) ([]models.Outlier, error) {
+	rows, err := h.db.QueryContext(c.Request.Context(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	outliers := []models.Outlier{}
+	for rows.Next() {
+		outlier, err := h.outliers.scanOutlier(c, rows)
+		if err != nil {
+			return nil, err
+		}
+		outliers = append(outliers, *outlier)
+	}
+	return outliers, rows.Err()
+}
+
+// resolveOutlier returns an outlier by ID, or null
+func (h *GraphQLHandler) resolveOutlier(p graphql.ResolveParams) (interface{}, error) {
+	c := requestState(p.Context).c
+	id := p.Args["id"].(string)
+	outlier, err := h.outliers.scanOutlier(c, h.db.QueryRowContext(p.Context,
+		`SELECT `+outlierColumns+` FROM `+outliersSeenBy("$1")+` WHERE id = $2`, middleware.GetOrgID(c), id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, h.fetchError(c, err, "failed to fetch outlier", zap.String("outlier_id", id))
+	}
+	return outlier, nil
+}
+
+// resolveTransactions lists transactions from Raphtory, fetching the
+// senders' and receivers' labels for the page at once
+func (h *GraphQLHandler) resolveTransactions(p graphql.ResolveParams) (interface{}, error) {
+	state := requestState(p.Context)
+	page, limit, err := pageArgValues(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	query := graph.TransactionQuery{Limit: limit, Offset: (page - 1) * limit}
+	query.Address, _ = p.Args["address"].(string)
+	if from, ok := p.Args["from"].(time.Time); ok {
+		query.Window.Start = from
+	}
+	if to, ok := p.Args["to"].(time.Time); ok {
+		query.Window.End = to
+	}
+	if !query.Window.Start.IsZero() && !query.Window.End.IsZero() && !query.Window.Start.Before(query.Window.End) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+	query.MinAmount, query.MaxAmount, err = parseAmountRange(decimalArg(p.Args["minAmount"]), decimalArg(p.Args["maxAmount"]))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := h.raphtoryClient.QueryTransactions(p.Context, query)
+	if err != nil {
+		return nil, h.fetchError(state.c, err, "failed to fetch transactions")
+	}
+
+	transactions := make([]*models.Transaction, len(result.Transactions))
+	var addresses []string
+	for i := range result.Transactions {
+		tx := &result.Transactions[i]
+		transactions[i] = tx
+		state.transactions[tx.TxHash] = tx
+		addresses = append(addresses, tx.From, tx.To)
+	}
+	if err := h.loadLabels(p.Context, addresses); err != nil {
+		return nil, h.fetchError(state.c, err, "failed to fetch address labels")
+	}
+
+	return map[string]interface{}{
+		"transactions": transactions,
+		"total":        result.Total,
+		"page":         page,
+		"limit":        limit,
+		"totalPages":   int(math.Ceil(float64(result.Total) / float64(limit))),
+	}, nil
+}
+
+// resolveTransaction returns a transaction by hash, or null
+func (h *GraphQLHandler) resolveTransaction(ctx context.Context, hash string) (interface{}, error) {
+	if hash == "" {
+		return nil, nil
+	}
+	state := requestState(ctx)
+	tx, ok := state.transactions[hash]
+	if !ok {
+		var err error
+		tx, err = h.raphtoryClient.GetTransaction(ctx, hash)
+		if err != nil {
+			return nil, h.fetchError(state.c, err, "failed to fetch transaction", zap.String("tx_hash", hash))
+		}
+		state.transactions[hash] = tx
+	}
+	if tx == nil {
+		return nil, nil
+	}
+	return tx, nil
+}
+
+// resolveProfile returns an address's profile, or null if nothing has
+// heard of it
+func (h *GraphQLHandler) resolveProfile(p graphql.ResolveParams, address string) (interface{}, error) {
+	state := requestState(p.Context)
+	outliers, counterparties := p.Args["outliers"].(int), p.Args["counterparties"].(int)
+	if outliers < 1 || outliers > 100 || counterparties < 1 || counterparties > 100 {
+		return nil, fmt.Errorf("outliers and counterparties must be between 1 and 100")
+	}
+
+	key := fmt.Sprintf("%s/%d/%d", address, outliers, counterparties)
+	profile, ok := state.profiles[key]
+	if !ok {
+		var err error
+		profile, err = h.addresses.profile(state.c, address, outliers, counterparties)
+		if err != nil && !errors.Is(err, errAddressNotFound) {
+			return nil, h.fetchError(state.c, err, "failed to fetch address profile", zap.String("address", address))
+		}
+		state.profiles[key] = profile
+	}
+	if profile == nil {
+		return nil, nil
+	}
+	return profile, nil
+}
+
+// resolveLabel returns an address's label, or null
+func (h *GraphQLHandler) resolveLabel(ctx context.Context, address string) (interface{}, error) {
+	state := requestState(ctx)
+	if err := h.loadLabels(ctx, []string{address}); err != nil {
+		return nil, h.fetchError(state.c, err, "failed to fetch address label", zap.String("address", address))
+	}
+	if label := state.labels[address]; label != nil {
+		return label, nil
+	}
+	return nil, nil
+}
+
+// loadLabels fetches the labels of addresses not already fetched
+func (h *GraphQLHandler) loadLabels(ctx context.Context, addresses []string) error {
+	state := requestState(ctx)
+	var missing []string
+	for _, address := range addresses {
+		if _, ok := state.labels[address]; !ok && address != "" {
+			missing = append(missing, address)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	labels, err := addressLabels(ctx, h.db, missing)
+	if err != nil {
+		return err
+	}
+	for _, address := range missing {
+		state.labels[address] = nil
+		if label, ok := labels[address]; ok {
+			state.labels[address] = &label
+		}
+	}
+	return nil
+}
@@ -8,7 +8,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
 	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/internal/health"
 	"go.uber.org/zap"
 )
 
@@ -16,6 +18,7 @@ import (
 type HealthHandler struct {
 	db             *sql.DB
 	raphtoryClient *graph.RaphtoryClient
+	registry       *health.Registry // nil reports only the API's own dependencies
 	version        string
 	logger         *zap.Logger
 }
@@ -38,7 +41,15 @@ func NewHealthHandler(db *sql.DB, raphtoryClient *graph.RaphtoryClient, version
 	}
 }
 
-// GetHealth returns the health status of the service and its dependencies
+// SetStatusRegistry adds the components other services report, such as
+// TronGrid ingestion and the detection loop, to the health report
+func (h *HealthHandler) SetStatusRegistry(registry *health.Registry) {
+	h.registry = registry
+}
+
+// GetHealth returns the health status of the service and its dependencies,
+// and of the components in the status registry. An unhealthy registry
+// component degrades the status without failing the check.
 func (h *HealthHandler) GetHealth(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
@@ -57,7 +68,7 @@ func (h *HealthHandler) GetHealth(c *gin.Context) {
 		dbHealthy = false
 		dbMessage = err.Error()
 		response.Status = "unhealthy"
-		h.logger.Error("Database health check failed", zap.Error(err))
+		middleware.RequestLogger(c, h.logger).Error("Database health check failed", zap.Error(err))
 	}
 	response.Services["database"] = api.ServiceStatus{
 		Healthy: dbHealthy,
@@ -71,11 +82,29 @@ func (h *HealthHandler) GetHealth(c *gin.Context) {
 		raphtoryHealthy = false
 		raphtoryMessage = err.Error()
 		response.Status = "degraded"
-		h.logger.Warn("Raphtory health check failed", zap.Error(err))
+		middleware.RequestLogger(c, h.logger).Warn("Raphtory health check failed", zap.Error(err))
 	}
 	response.Services["raphtory"] = api.ServiceStatus{
 		Healthy: raphtoryHealthy,
 		Message: raphtoryMessage,
+		Details: map[string]interface{}{"circuit": h.raphtoryClient.CircuitState()},
+	}
+
+	// Components reported by every service, including this one
+	if h.registry != nil {
+		components, err := h.registry.Components(ctx)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Warn("Failed to read component statuses", zap.Error(err))
+			components = map[string]api.ServiceStatus{
+				"status_registry": {Healthy: false, Message: err.Error()},
+			}
+		}
+		for name, status := range components {
+			response.Services[name] = status
+			if !status.Healthy && response.Status == "healthy" {
+				response.Status = "degraded"
+			}
+		}
 	}
 
 	// Determine HTTP status code
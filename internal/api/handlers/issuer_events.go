@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// IssuerEventHandler handles issuer event requests
+type IssuerEventHandler struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewIssuerEventHandler creates a new issuer event handler
+func NewIssuerEventHandler(db *sql.DB, logger *zap.Logger) *IssuerEventHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &IssuerEventHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// ListIssuerEvents returns a paginated list of issuer events, newest first
+func (h *IssuerEventHandler) ListIssuerEvents(c *gin.Context) {
+	var req api.IssuerEventListRequest
+
+	// Set defaults
+	req.Page = 1
+	req.Limit = 50
+
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid query parameters",
+		})
+		return
+	}
+
+	where := ` WHERE 1=1`
+	args := []interface{}{}
+
+	if req.Type != "" {
+		args = append(args, req.Type)
+		where += fmt.Sprintf(` AND type = $%d`, len(args))
+	}
+
+	if req.Address != "" {
+		args = append(args, req.Address)
+		where += fmt.Sprintf(` AND address = $%d`, len(args))
+	}
+
+	var total int
+	if err := h.db.QueryRowContext(c.Request.Context(), `SELECT COUNT(*) FROM issuer_events`+where, args...).Scan(&total); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to count issuer events",
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch issuer events",
+		})
+		return
+	}
+
+	query := `
+		SELECT id, tx_hash, type, address, amount, block_number, timestamp, contract, token, chain
+		FROM issuer_events` + where +
+		fmt.Sprintf(` ORDER BY timestamp DESC LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2)
+	args = append(args, req.Limit, (req.Page-1)*req.Limit)
+
+	rows, err := h.db.QueryContext(c.Request.Context(), query, args...)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query issuer events",
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch issuer events",
+		})
+		return
+	}
+	defer rows.Close()
+
+	events := []models.IssuerEvent{}
+	for rows.Next() {
+		var event models.IssuerEvent
+		var amount string
+
+		err := rows.Scan(
+			&event.ID,
+			&event.TxHash,
+			&event.Type,
+			&event.Address,
+			&amount,
+			&event.BlockNumber,
+			&event.Timestamp,
+			&event.Contract,
+			&event.Token,
+			&event.Chain,
+		)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan issuer event row",
+				zap.Error(err))
+			continue
+		}
+
+		event.Amount, _ = decimal.NewFromString(amount)
+		events = append(events, event)
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(req.Limit)))
+
+	c.JSON(http.StatusOK, api.IssuerEventListResponse{
+		Events:     events,
+		Total:      total,
+		Page:       req.Page,
+		Limit:      req.Limit,
+		TotalPages: totalPages,
+	})
+}
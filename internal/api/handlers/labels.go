@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// maxLabelImportBytes caps the size of an imported label CSV
+const maxLabelImportBytes = 32 << 20
+
+// defaultLabelSource is the source of labels set without one
+const defaultLabelSource = "manual"
+
+// LabelHandler handles address label requests. Labels name the known
+// entity behind an address, such as an exchange hot wallet or a mixer.
+type LabelHandler struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewLabelHandler creates a new label handler
+func NewLabelHandler(db *sql.DB, logger *zap.Logger) *LabelHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &LabelHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// ListLabels returns a paginated list of address labels, by address
+func (h *LabelHandler) ListLabels(c *gin.Context) {
+	var req api.AddressLabelListRequest
+
+	// Set defaults
+	req.Page = 1
+	req.Limit = 50
+
+	if err := c.ShouldBindQuery(&req); err != nil || (req.Category != "" && !req.Category.Valid()) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid query parameters",
+		})
+		return
+	}
+
+	q := &queryFilter{}
+	if req.Category != "" {
+		q.equal("category", req.Category)
+	}
+	if req.Source != "" {
+		q.equal("source", req.Source)
+	}
+	if req.Search != "" {
+		q.where("LOWER(label) LIKE " + q.arg("%"+strings.ToLower(req.Search)+"%"))
+	}
+
+	var total int
+	if err := h.db.QueryRowContext(c.Request.Context(),
+		`SELECT COUNT(*) FROM address_labels`+q.clause(), q.args...).Scan(&total); err != nil {
+		internalError(c, h.logger, err, "Failed to fetch address labels")
+		return
+	}
+
+	limit, args := q.page(req.Page, req.Limit)
+	rows, err := h.db.QueryContext(c.Request.Context(),
+		`SELECT `+addressLabelColumns+` FROM address_labels`+q.clause()+` ORDER BY address`+limit, args...)
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to fetch address labels")
+		return
+	}
+	defer rows.Close()
+
+	labels := []models.AddressLabel{}
+	for rows.Next() {
+		label, err := scanAddressLabel(rows)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan address label row", zap.Error(err))
+			continue
+		}
+		labels = append(labels, *label)
+	}
+
+	c.JSON(http.StatusOK, api.AddressLabelListResponse{
+		Labels:     labels,
+		Total:      total,
+		Page:       req.Page,
+		Limit:      req.Limit,
+		TotalPages: int(math.Ceil(float64(total) / float64(req.Limit))),
+	})
+}
+
+// GetLabel returns the label of an address
+func (h *LabelHandler) GetLabel(c *gin.Context) {
+	address := models.NormalizeAddress(c.Param("address"))
+	label, err := scanAddressLabel(h.db.QueryRowContext(c.Request.Context(),
+		`SELECT `+addressLabelColumns+` FROM address_labels WHERE address = $1`, address))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Address has no label",
+		})
+		return
+	}
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to fetch address label", zap.String("address", c.Param("address")))
+		return
+	}
+
+	c.JSON(http.StatusOK, label)
+}
+
+// SetLabel labels an address, replacing any label it had
+func (h *LabelHandler) SetLabel(c *gin.Context) {
+	var req api.SetAddressLabelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	label := models.AddressLabel{
+		Address:   models.NormalizeAddress(c.Param("address")),
+		Label:     strings.TrimSpace(req.Label),
+		Category:  req.Category,
+		Source:    strings.TrimSpace(req.Source),
+		UpdatedBy: c.GetString("user_id"),
+		UpdatedAt: time.Now().UTC(),
+	}
+	if label.Source == "" {
+		label.Source = defaultLabelSource
+	}
+	if err := validateAddressLabel(label); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := upsertAddressLabel(c.Request.Context(), h.db, label); err != nil {
+		internalError(c, h.logger, err, "Failed to save address label", zap.String("address", c.Param("address")))
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Address labeled",
+		zap.String("address", label.Address),
+		zap.String("label", label.Label),
+		zap.String("category", string(label.Category)),
+		zap.String("updated_by", label.UpdatedBy))
+
+	c.JSON(http.StatusOK, label)
+}
+
+// DeleteLabel removes the label of an address
+func (h *LabelHandler) DeleteLabel(c *gin.Context) {
+	address := models.NormalizeAddress(c.Param("address"))
+	result, err := h.db.ExecContext(c.Request.Context(), `DELETE FROM address_labels WHERE address = $1`, address)
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to delete address label", zap.String("address", c.Param("address")))
+		return
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Address has no label",
+		})
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Address label deleted",
+		zap.String("address", address),
+		zap.String("deleted_by", c.GetString("user_id")))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Address label deleted",
+	})
+}
+
+// ImportLabels upserts labels from a CSV request body with a header row.
+// address, label and category columns are required; a source column
+// overrides the source query parameter, which defaults to import. Invalid
+// rows are skipped and reported; the rest are saved together.
+func (h *LabelHandler) ImportLabels(c *gin.Context) {
+	defaultSource := strings.TrimSpace(c.DefaultQuery("source", "import"))
+	reader := csv.NewReader(http.MaxBytesReader(c.Writer, c.Request.Body, maxLabelImportBytes))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	badRequest := func(message string) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": message,
+		})
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		badRequest("Body must be CSV with a header row")
+		return
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))] = i
+	}
+	for _, required := range []string{"address", "label", "category"} {
+		if _, ok := columns[required]; !ok {
+			badRequest(fmt.Sprintf("CSV has no %s column", required))
+			return
+		}
+	}
+	field := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	resp := api.AddressLabelImportResponse{Skipped: []api.AddressLabelImportError{}}
+	var labels []models.AddressLabel
+	now := time.Now().UTC()
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			badRequest(fmt.Sprintf("CSV is larger than %d bytes", maxLabelImportBytes))
+			return
+		}
+		if err != nil {
+			badRequest(fmt.Sprintf("Invalid CSV at line %d", line))
+			return
+		}
+
+		label := models.AddressLabel{
+			Address:   models.NormalizeAddress(field(record, "address")),
+			Label:     field(record, "label"),
+			Category:  models.LabelCategory(strings.ToLower(field(record, "category"))),
+			Source:    field(record, "source"),
+			UpdatedBy: c.GetString("user_id"),
+			UpdatedAt: now,
+		}
+		if label.Source == "" {
+			label.Source = defaultSource
+		}
+		if err := validateAddressLabel(label); err != nil {
+			resp.Skipped = append(resp.Skipped, api.AddressLabelImportError{
+				Line:    line,
+				Address: label.Address,
+				Message: err.Error(),
+			})
+			continue
+		}
+		labels = append(labels, label)
+	}
+
+	tx, err := h.db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to import address labels")
+		return
+	}
+	defer tx.Rollback()
+	for _, label := range labels {
+		if err := upsertAddressLabel(c.Request.Context(), tx, label); err != nil {
+			internalError(c, h.logger, err, "Failed to import address labels")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		internalError(c, h.logger, err, "Failed to import address labels")
+		return
+	}
+	resp.Imported = len(labels)
+
+	middleware.RequestLogger(c, h.logger).Info("Address labels imported",
+		zap.Int("imported", resp.Imported),
+		zap.Int("skipped", len(resp.Skipped)),
+		zap.String("source", defaultSource),
+		zap.String("imported_by", c.GetString("user_id")))
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// addressLabelColumns are the columns scanAddressLabel reads
+const addressLabelColumns = `address, label, category, source, updated_by, updated_at`
+
+// scanAddressLabel scans a row of addressLabelColumns
+func scanAddressLabel(row interface{ Scan(dest ...any) error }) (*models.AddressLabel, error) {
+	var label models.AddressLabel
+	err := row.Scan(
+		&label.Address,
+		&label.Label,
+		&label.Category,
+		&label.Source,
+		&label.UpdatedBy,
+		&label.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &label, nil
+}
+
+// validateAddressLabel checks a label before it is saved
+func validateAddressLabel(label models.AddressLabel) error {
+	switch {
+	case label.Address == "":
+		return errors.New("address is required")
+	case len(label.Address) > 64:
+		return errors.New("address is longer than 64 characters")
+	case label.Label == "":
+		return errors.New("label is required")
+	case len(label.Label) > 200:
+		return errors.New("label is longer than 200 characters")
+	case !label.Category.Valid():
+		return fmt.Errorf("category %q is not one of the known categories", label.Category)
+	}
+	return nil
+}
+
+// upsertAddressLabel saves label, replacing any label the address had
+func upsertAddressLabel(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}, label models.AddressLabel) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO address_labels (address, label, category, source, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (address) DO UPDATE SET
+			label = EXCLUDED.label,
+			category = EXCLUDED.category,
+			source = EXCLUDED.source,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = EXCLUDED.updated_at
+	`, label.Address, label.Label, label.Category, label.Source, label.UpdatedBy, label.UpdatedAt)
+	return err
+}
+
+// addressLabels returns the labels of those addresses that have one, keyed
+// by the address as given
+func addressLabels(ctx context.Context, db *sql.DB, addresses []string) (map[string]models.AddressLabel, error) {
+	byNormalized := make(map[string][]string, len(addresses))
+	normalized := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		key := models.NormalizeAddress(address)
+		if _, ok := byNormalized[key]; !ok {
+			normalized = append(normalized, key)
+		}
+		byNormalized[key] = append(byNormalized[key], address)
+	}
+	labels := make(map[string]models.AddressLabel)
+	if len(normalized) == 0 {
+		return labels, nil
+	}
+
+	q := &queryFilter{}
+	q.in("address", normalized)
+	rows, err := db.QueryContext(ctx, `SELECT `+addressLabelColumns+` FROM address_labels`+q.clause(), q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		label, err := scanAddressLabel(rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range byNormalized[label.Address] {
+			labels[address] = *label
+		}
+	}
+	return labels, rows.Err()
+}
@@ -0,0 +1,735 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/graphql"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/api/openapi"
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/internal/reports"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// apiBasePath is where the documented API is served
+const apiBasePath = "/api/v1"
+
+// OpenAPIHandler serves the OpenAPI specification of the API, generated on
+// first request from the registered routes, and optionally Swagger UI
+type OpenAPIHandler struct {
+	routes    func() gin.RoutesInfo
+	version   string
+	assetsURL string // Swagger UI assets; empty disables the UI
+	logger    *zap.Logger
+
+	once sync.Once
+	spec []byte
+	err  error
+}
+
+// NewOpenAPIHandler creates a handler documenting the routes returned by
+// routes, typically a gin engine's Routes method
+func NewOpenAPIHandler(routes func() gin.RoutesInfo, version string, logger *zap.Logger) *OpenAPIHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &OpenAPIHandler{
+		routes:  routes,
+		version: version,
+		logger:  logger,
+	}
+}
+
+// SetSwaggerUI serves Swagger UI, loading its scripts and styles from
+// assetsURL, such as a swagger-ui-dist package on a CDN
+func (h *OpenAPIHandler) SetSwaggerUI(assetsURL string) {
+	h.assetsURL = strings.TrimSuffix(assetsURL, "/")
+}
+
+// GetOpenAPI returns the OpenAPI specification as JSON
+func (h *OpenAPIHandler) GetOpenAPI(c *gin.Context) {
+	h.once.Do(func() {
+		routes := h.routes()
+		for _, missing := range undocumentedRoutes(routes) {
+			h.logger.Warn("Route missing from the OpenAPI specification", zap.String("route", missing))
+		}
+		h.spec, h.err = json.Marshal(NewOpenAPIGenerator(h.version).Generate(routes))
+	})
+	if h.err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to generate OpenAPI specification", zap.Error(h.err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to generate OpenAPI specification",
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", h.spec)
+}
+
+// swaggerUIPage loads Swagger UI pointed at the specification
+var swaggerUIPage = template.Must(template.New("swagger-ui").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>StableRisk API</title>
+<link rel="stylesheet" href="{{.AssetsURL}}/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{.AssetsURL}}/swagger-ui-bundle.js"></script>
+<script src="` + apiBasePath + `/docs/init.js"></script>
+</body>
+</html>
+`))
+
+// GetSwaggerUI returns a Swagger UI page for the specification
+func (h *OpenAPIHandler) GetSwaggerUI(c *gin.Context) {
+	if h.assetsURL == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Swagger UI is disabled",
+		})
+		return
+	}
+
+	// The API's own policy forbids scripts; allow the UI's assets, the inline
+	// styles it renders with and calls back to the API
+	c.Header("Content-Security-Policy", fmt.Sprintf(
+		"default-src 'none'; script-src %[1]s 'self'; style-src %[1]s 'unsafe-inline'; img-src 'self' data:; connect-src 'self'; frame-ancestors 'none'",
+		h.assetsURL+"/"))
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := swaggerUIPage.Execute(c.Writer, struct{ AssetsURL string }{h.assetsURL}); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to render Swagger UI", zap.Error(err))
+	}
+}
+
+// swaggerUIInit starts Swagger UI. It is served rather than inlined so the
+// page's Content-Security-Policy needs no inline scripts.
+const swaggerUIInit = `window.ui = SwaggerUIBundle({
+  url: "` + apiBasePath + `/openapi.json",
+  dom_id: "#swagger-ui",
+  deepLinking: true,
+  persistAuthorization: true
+});
+`
+
+// GetSwaggerUIInit returns the script that starts Swagger UI
+func (h *OpenAPIHandler) GetSwaggerUIInit(c *gin.Context) {
+	c.Data(http.StatusOK, "application/javascript", []byte(swaggerUIInit))
+}
+
+// NewOpenAPIGenerator creates a generator documenting the API's operations
+func NewOpenAPIGenerator(version string) *openapi.Generator {
+	generator := openapi.NewGenerator(openapi.Info{
+		Title:   "StableRisk API",
+		Version: version,
+		Description: "Real-time USDT transaction monitoring and anomaly detection. " +
+			"Authenticate with a JWT from /auth/login, or an API key where operations accept one. " +
+			"Errors are returned as {\"error\": code, \"message\": text}.",
+	}, apiBasePath, apiOperations())
+
+	generator.Enum(models.SeverityLow, models.SeverityMedium, models.SeverityHigh, models.SeverityCritical)
+	generator.Enum(models.OutlierStatusOpen, models.OutlierStatusInvestigating,
+		models.OutlierStatusFalsePositive, models.OutlierStatusConfirmed)
+	generator.Enum(models.FeedbackTruePositive, models.FeedbackFalsePositive)
+	generator.Enum(models.OutlierTypeZScore, models.OutlierTypeIQR, models.OutlierTypePatternCirculation,
+		models.OutlierTypePatternFanOut, models.OutlierTypePatternFanIn, models.OutlierTypePatternDormant,
+		models.OutlierTypePatternVelocity, models.OutlierTypePatternCluster, models.OutlierTypeDBSCAN,
+		models.OutlierTypeWatchlist, models.OutlierTypeSanctions)
+	generator.Enum(models.DetectionRunScheduled, models.DetectionRunManual)
+	generator.Enum(models.DetectionRunRunning, models.DetectionRunCompleted, models.DetectionRunFailed)
+	generator.Enum(models.IssuerEventBlacklisted, models.IssuerEventUnblacklisted,
+		models.IssuerEventFundsDestroyed, models.IssuerEventIssue, models.IssuerEventRedeem)
+	generator.Enum(models.ChainTron, models.ChainEthereum)
+	categories := make([]interface{}, len(models.LabelCategories))
+	for i, category := range models.LabelCategories {
+		categories[i] = category
+	}
+	generator.Enum(categories...)
+	return generator
+}
+
+// undocumentedRoutes returns the API routes missing from apiOperations
+func undocumentedRoutes(routes gin.RoutesInfo) []string {
+	operations := apiOperations()
+	var missing []string
+	for _, route := range routes {
+		key := route.Method + " " + route.Path
+		if _, ok := operations[key]; !ok && strings.HasPrefix(route.Path, apiBasePath+"/") {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Shapes of responses that handlers build with gin.H
+type (
+	messageResponse struct {
+		Message string `json:"message"`
+	}
+	tokenRefreshResponse struct {
+		Token     string `json:"token"`
+		ExpiresIn int64  `json:"expires_in"` // Seconds
+	}
+	reportPeriod struct {
+		Start string `json:"start"`
+		End   string `json:"end"`
+		Days  int    `json:"days"`
+	}
+	tuningReportResponse struct {
+		Report *detection.TuningReport `json:"report"`
+		Period reportPeriod            `json:"period"`
+	}
+	graphQLResponse struct {
+		Data   map[string]interface{} `json:"data,omitempty"` // Absent when the query was invalid
+		Errors []graphql.Error        `json:"errors,omitempty"`
+	}
+)
+
+// apiOperations documents the API's routes by method and path
+func apiOperations() openapi.Operations {
+	permission := func(p middleware.Permission) string { return string(p) }
+	days := func(def int) openapi.Parameter {
+		return openapi.Parameter{Name: "days", In: "query", Type: 0, Default: def, Description: "Days back from now"}
+	}
+	stream := openapi.Parameter{Name: "stream", In: "query", Type: false,
+		Description: "Return every match as application/x-ndjson instead of a page (or send Accept: application/x-ndjson)"}
+	ifNoneMatch := openapi.Parameter{Name: "If-None-Match", In: "header", Type: "",
+		Description: "ETag of a copy the client holds; 304 Not Modified without a body if it is still current"}
+	idempotencyKey := openapi.Parameter{Name: middleware.IdempotencyKeyHeader, In: "header", Type: "",
+		Description: "Key making the request safe to retry: a repeat gets the first response, marked Idempotent-Replayed: true"}
+
+	operations := openapi.Operations{
+		// Authentication
+		"POST /api/v1/auth/login": {
+			Summary: "Log in", Tags: []string{"Authentication"}, Public: true,
+			Body: models.LoginRequest{}, Response: models.LoginResponse{},
+		},
+		"POST /api/v1/auth/refresh": {
+			Summary: "Refresh an access token", Tags: []string{"Authentication"}, Public: true,
+			Body: models.RefreshTokenRequest{}, Response: tokenRefreshResponse{},
+		},
+		"POST /api/v1/auth/password/reset": {
+			Summary: "Set a password with a reset token", Tags: []string{"Authentication"}, Public: true,
+			Body: models.ResetPasswordRequest{}, Response: api.SuccessResponse{},
+		},
+		"GET /api/v1/auth/profile": {
+			Summary: "Get the current user", Tags: []string{"Authentication"},
+			Response: models.User{},
+		},
+		"POST /api/v1/auth/password": {
+			Summary: "Change the current user's password", Tags: []string{"Authentication"},
+			Body: models.ChangePasswordRequest{}, Response: api.SuccessResponse{},
+		},
+
+		// Outliers
+		"GET /api/v1/outliers": {
+			Summary: "List outliers", Tags: []string{"Outliers"},
+			Permission: permission(middleware.PermissionReadOutliers),
+			Query:      api.OutlierListRequest{}, Params: []openapi.Parameter{stream},
+			Response: api.OutlierListResponse{},
+		},
+		"GET /api/v1/outliers/:id": {
+			Summary: "Get an outlier", Tags: []string{"Outliers"},
+			Permission: permission(middleware.PermissionReadOutliers),
+			Params:     []openapi.Parameter{ifNoneMatch},
+			Response:   models.Outlier{},
+		},
+		"POST /api/v1/outliers/:id/acknowledge": {
+			Summary: "Acknowledge an outlier", Tags: []string{"Outliers"},
+			Permission: permission(middleware.PermissionWriteOutliers),
+			Params:     []openapi.Parameter{idempotencyKey},
+			Body:       api.AcknowledgeOutlierRequest{}, Response: api.SuccessResponse{},
+		},
+		"POST /api/v1/outliers/acknowledge": {
+			Summary: "Acknowledge outliers in bulk", Tags: []string{"Outliers"},
+			Permission: permission(middleware.PermissionWriteOutliers),
+			Params:     []openapi.Parameter{idempotencyKey},
+			Body:       api.BulkAcknowledgeRequest{}, Response: api.BulkAcknowledgeResponse{},
+		},
+		"PATCH /api/v1/outliers/:id/status": {
+			Summary: "Move an outlier through triage", Tags: []string{"Outliers"},
+			Permission: permission(middleware.PermissionWriteOutliers),
+			Params:     []openapi.Parameter{idempotencyKey},
+			Body:       api.UpdateOutlierStatusRequest{}, Response: models.OutlierStatusChange{},
+		},
+		"GET /api/v1/outliers/:id/history": {
+			Summary: "Get an outlier's status history", Tags: []string{"Outliers"},
+			Permission: permission(middleware.PermissionReadOutliers),
+			Response:   api.OutlierStatusHistoryResponse{},
+		},
+		"POST /api/v1/outliers/:id/assign": {
+			Summary: "Assign an outlier", Tags: []string{"Outliers"},
+			Permission: permission(middleware.PermissionWriteOutliers),
+			Params:     []openapi.Parameter{idempotencyKey},
+			Body:       api.AssignOutlierRequest{}, Response: api.OutlierAssignment{},
+		},
+		"POST /api/v1/outliers/:id/archive": {
+			Summary: "Archive an outlier", Tags: []string{"Outliers"},
+			Permission: permission(middleware.PermissionWriteOutliers),
+			Params:     []openapi.Parameter{idempotencyKey},
+			Response:   api.SuccessResponse{},
+		},
+		"POST /api/v1/outliers/archive": {
+			Summary: "Archive outliers in bulk", Tags: []string{"Outliers"},
+			Permission: permission(middleware.PermissionWriteOutliers),
+			Params:     []openapi.Parameter{idempotencyKey},
+			Body:       api.BulkArchiveRequest{}, Response: api.BulkArchiveResponse{},
+		},
+
+		// Detection
+		"POST /api/v1/detection/run": {
+			Summary: "Run detection on demand", Tags: []string{"Detection"},
+			Permission: permission(middleware.PermissionTriggerDetection),
+			Body:       api.DetectionRunRequest{}, Status: http.StatusAccepted, Response: detection.DetectionJob{},
+		},
+		"GET /api/v1/detection/run/:id": {
+			Summary: "Get an on-demand detection run", Tags: []string{"Detection"},
+			Permission: permission(middleware.PermissionTriggerDetection),
+			Response:   detection.DetectionJob{},
+		},
+		"GET /api/v1/detection/runs": {
+			Summary: "List detection run history", Tags: []string{"Detection"},
+			Permission: permission(middleware.PermissionReadStatistics),
+			Query:      api.DetectionRunListRequest{}, Response: api.DetectionRunListResponse{},
+		},
+		"GET /api/v1/detection/tuning": {
+			Summary: "Get the detector tuning report", Tags: []string{"Detection"},
+			Permission: permission(middleware.PermissionWriteOutliers),
+			Params: []openapi.Parameter{
+				days(30),
+				{Name: "target_fp_rate", In: "query", Type: 0.0, Default: 0.2, Description: "Acceptable false positive rate"},
+				{Name: "min_samples", In: "query", Type: 0, Default: 10, Description: "Labeled outliers needed to recommend a threshold"},
+			},
+			Response: tuningReportResponse{},
+		},
+		"GET /api/v1/detection/config": {
+			Summary: "Get the detection configuration", Tags: []string{"Detection"},
+			Permission: permission(middleware.PermissionManageSystem),
+			Response:   api.DetectionConfigResponse{},
+		},
+		"PUT /api/v1/detection/config": {
+			Summary: "Update the detection configuration", Tags: []string{"Detection"},
+			Description: "Fields left out keep their current value. Applied without a restart.",
+			Permission:  permission(middleware.PermissionManageSystem),
+			Body:        api.DetectionConfig{}, Response: api.DetectionConfigResponse{},
+		},
+
+		// Statistics
+		"GET /api/v1/statistics": {
+			Summary: "Get statistics", Tags: []string{"Statistics"},
+			Permission: permission(middleware.PermissionReadStatistics),
+			Query:      api.StatisticsRequest{}, Params: []openapi.Parameter{ifNoneMatch},
+			Response: api.StatisticsResponse{},
+		},
+		"GET /api/v1/statistics/trends": {
+			Summary: "Get daily outlier counts by severity", Tags: []string{"Statistics"},
+			Permission: permission(middleware.PermissionReadStatistics),
+			Query:      api.OutlierTrendsRequest{}, Response: api.OutlierTrendsResponse{},
+		},
+		"GET /api/v1/reports/daily": {
+			Summary: "Get a daily report", Tags: []string{"Statistics"},
+			Description: "Summarises a UTC day's outliers: counts by severity and type, the most flagged addresses, the largest flagged transfers and the unacknowledged backlog. Returned as JSON, or HTML or PDF with format=html or format=pdf. The same report is emailed daily when reports.daily is enabled.",
+			Permission:  permission(middleware.PermissionReadStatistics),
+			Query:       api.DailyReportRequest{}, Response: reports.DailyReport{},
+		},
+		"GET /api/v1/reports/sar": {
+			Summary: "Draft a suspicious activity report", Tags: []string{"Statistics"},
+			Description: "Assembles a suspicious activity report draft for the incident an outlier belongs to (outlier_id) or for every outlier on an address (address): a narrative of the flagged patterns, the outliers, the address's transactions around them, its direct counterparties and analysts' notes. Returned as a PDF by default, a Word document with format=docx for compliance to edit, or JSON with format=json. Sections the graph could not provide are listed under gaps. Every export is audited.",
+			Permission:  permission(middleware.PermissionExportSAR),
+			Query:       api.SARDraftRequest{}, Response: reports.SARDraft{},
+		},
+
+		// Issuer events, transactions and addresses
+		"GET /api/v1/issuer-events": {
+			Summary: "List issuer events", Tags: []string{"Issuer Events"},
+			Permission: permission(middleware.PermissionReadTransactions),
+			Query:      api.IssuerEventListRequest{}, Response: api.IssuerEventListResponse{},
+		},
+		"GET /api/v1/transactions": {
+			Summary: "List transactions", Tags: []string{"Transactions"},
+			Permission: permission(middleware.PermissionReadTransactions),
+			Query:      api.TransactionListRequest{}, Response: api.TransactionListResponse{},
+		},
+		"GET /api/v1/transactions/:hash": {
+			Summary: "Get a transaction", Tags: []string{"Transactions"},
+			Permission: permission(middleware.PermissionReadTransactions),
+			Response:   models.Transaction{},
+		},
+		"GET /api/v1/addresses/:address": {
+			Summary: "Get an address profile", Tags: []string{"Addresses"},
+			Permission: permission(middleware.PermissionReadOutliers),
+			Query:      api.AddressProfileRequest{}, Params: []openapi.Parameter{ifNoneMatch},
+			Response: api.AddressProfileResponse{},
+		},
+
+		// GraphQL
+		"POST /api/v1/graphql": {
+			Summary: "Run a GraphQL query", Tags: []string{"GraphQL"}, APIKey: true,
+			Description: "Each field needs the permission of the REST route it mirrors: read:outliers, read:transactions " +
+				"or read:statistics. Fields the caller may not read are null, with an error. " +
+				"Served when server.graphql_enabled is set.",
+			Body: api.GraphQLRequest{}, Response: graphQLResponse{},
+		},
+		"GET /api/v1/graphql/schema": {
+			Summary: "Get the GraphQL schema", Tags: []string{"GraphQL"}, APIKey: true,
+			Description: "In the GraphQL schema definition language.",
+			Response:    "", ResponseType: "text/plain",
+		},
+
+		// Watchlists
+		"GET /api/v1/watchlists": {
+			Summary: "List watchlists", Tags: []string{"Watchlists"},
+			Permission: permission(middleware.PermissionReadOutliers),
+			Response:   api.WatchlistListResponse{},
+		},
+		"POST /api/v1/watchlists": {
+			Summary: "Create a watchlist", Tags: []string{"Watchlists"},
+			Permission: permission(middleware.PermissionWriteOutliers),
+			Params:     []openapi.Parameter{idempotencyKey},
+			Body:       api.CreateWatchlistRequest{}, Status: http.StatusCreated, Response: api.WatchlistResponse{},
+		},
+		"GET /api/v1/watchlists/:id": {
+			Summary: "Get a watchlist and its entries", Tags: []string{"Watchlists"},
+			Permission: permission(middleware.PermissionReadOutliers),
+			Query:      api.WatchlistRequest{}, Response: api.WatchlistResponse{},
+		},
+		"PATCH /api/v1/watchlists/:id": {
+			Summary: "Update a watchlist", Tags: []string{"Watchlists"},
+			Permission: permission(middleware.PermissionWriteOutliers),
+			Params:     []openapi.Parameter{idempotencyKey},
+			Body:       api.UpdateWatchlistRequest{}, Response: api.WatchlistResponse{},
+		},
+		"DELETE /api/v1/watchlists/:id": {
+			Summary: "Delete a watchlist", Tags: []string{"Watchlists"},
+			Permission: permission(middleware.PermissionWriteOutliers),
+			Params:     []openapi.Parameter{idempotencyKey},
+			Response:   messageResponse{},
+		},
+		"POST /api/v1/watchlists/:id/entries": {
+			Summary: "Add an address to a watchlist", Tags: []string{"Watchlists"},
+			Permission: permission(middleware.PermissionWriteOutliers),
+			Params:     []openapi.Parameter{idempotencyKey},
+			Body:       api.WatchlistEntryRequest{}, Status: http.StatusCreated, Response: models.WatchlistEntry{},
+		},
+		"PUT /api/v1/watchlists/:id/entries/:entry_id": {
+			Summary: "Update a watchlist entry", Tags: []string{"Watchlists"},
+			Permission: permission(middleware.PermissionWriteOutliers),
+			Params:     []openapi.Parameter{idempotencyKey},
+			Body:       api.WatchlistEntryRequest{}, Response: models.WatchlistEntry{},
+		},
+		"DELETE /api/v1/watchlists/:id/entries/:entry_id": {
+			Summary: "Remove an address from a watchlist", Tags: []string{"Watchlists"},
+			Permission: permission(middleware.PermissionWriteOutliers),
+			Params:     []openapi.Parameter{idempotencyKey},
+			Response:   messageResponse{},
+		},
+
+		// Webhooks
+		"GET /api/v1/webhooks": {
+			Summary: "List webhooks", Tags: []string{"Webhooks"},
+			Permission: permission(middleware.PermissionManageWebhooks),
+			Response:   api.WebhookListResponse{},
+		},
+		"POST /api/v1/webhooks": {
+			Summary: "Register a webhook", Tags: []string{"Webhooks"},
+			Description: "Returns the secret deliveries are signed with, which cannot be retrieved again.",
+			Permission:  permission(middleware.PermissionManageWebhooks),
+			Params:      []openapi.Parameter{idempotencyKey},
+			Body:        api.CreateWebhookRequest{}, Status: http.StatusCreated, Response: api.CreateWebhookResponse{},
+		},
+		"GET /api/v1/webhooks/:id": {
+			Summary: "Get a webhook", Tags: []string{"Webhooks"},
+			Permission: permission(middleware.PermissionManageWebhooks),
+			Response:   models.Webhook{},
+		},
+		"PATCH /api/v1/webhooks/:id": {
+			Summary: "Update a webhook", Tags: []string{"Webhooks"},
+			Permission: permission(middleware.PermissionManageWebhooks),
+			Params:     []openapi.Parameter{idempotencyKey},
+			Body:       api.UpdateWebhookRequest{}, Response: models.Webhook{},
+		},
+		"DELETE /api/v1/webhooks/:id": {
+			Summary: "Delete a webhook and its deliveries", Tags: []string{"Webhooks"},
+			Permission: permission(middleware.PermissionManageWebhooks),
+			Params:     []openapi.Parameter{idempotencyKey},
+			Response:   messageResponse{},
+		},
+		"POST /api/v1/webhooks/:id/rotate-secret": {
+			Summary: "Rotate a webhook's signing secret", Tags: []string{"Webhooks"},
+			Description: "Later deliveries, including retries, are signed with the new secret.",
+			Permission:  permission(middleware.PermissionManageWebhooks),
+			Params:      []openapi.Parameter{idempotencyKey},
+			Response:    api.CreateWebhookResponse{},
+		},
+		"GET /api/v1/webhooks/:id/deliveries": {
+			Summary: "List a webhook's recent deliveries", Tags: []string{"Webhooks"},
+			Permission: permission(middleware.PermissionManageWebhooks),
+			Query:      api.WebhookDeliveryListRequest{}, Response: api.WebhookDeliveryListResponse{},
+		},
+
+		// Address labels
+		"GET /api/v1/labels": {
+			Summary: "List address labels", Tags: []string{"Labels"},
+			Permission: permission(middleware.PermissionReadOutliers),
+			Query:      api.AddressLabelListRequest{}, Response: api.AddressLabelListResponse{},
+		},
+		"POST /api/v1/labels/import": {
+			Summary: "Import address labels from CSV", Tags: []string{"Labels"},
+			Description: "A header row names the address, label, category and optional source columns.",
+			Permission:  permission(middleware.PermissionWriteOutliers),
+			Params: []openapi.Parameter{
+				{Name: "source", In: "query", Type: "", Default: "import", Description: "Source of rows without a source column"},
+			},
+			Body: "", BodyType: "text/csv", Response: api.AddressLabelImportResponse{},
+		},
+		"GET /api/v1/labels/:address": {
+			Summary: "Get an address's label", Tags: []string{"Labels"},
+			Permission: permission(middleware.PermissionReadOutliers),
+			Response:   models.AddressLabel{},
+		},
+		"PUT /api/v1/labels/:address": {
+			Summary: "Label an address", Tags: []string{"Labels"},
+			Permission: permission(middleware.PermissionWriteOutliers),
+			Body:       api.SetAddressLabelRequest{}, Response: models.AddressLabel{},
+		},
+		"DELETE /api/v1/labels/:address": {
+			Summary: "Delete an address's label", Tags: []string{"Labels"},
+			Permission: permission(middleware.PermissionWriteOutliers),
+			Response:   messageResponse{},
+		},
+
+		// Graph
+		"GET /api/v1/graph/subgraph": {
+			Summary: "Get the transaction graph around an address", Tags: []string{"Graph"},
+			Permission: permission(middleware.PermissionReadTransactions),
+			Query:      api.SubgraphRequest{}, Response: api.SubgraphResponse{},
+		},
+
+		// Users
+		"GET /api/v1/users": {
+			Summary: "List users", Tags: []string{"Users"},
+			Permission: permission(middleware.PermissionReadUsers),
+			Query:      api.UserListRequest{}, Response: api.UserListResponse{},
+		},
+		"POST /api/v1/users": {
+			Summary: "Create a user", Tags: []string{"Users"},
+			Permission: permission(middleware.PermissionManageUsers),
+			Body:       api.CreateUserRequest{}, Status: http.StatusCreated, Response: models.User{},
+		},
+		"GET /api/v1/users/:id": {
+			Summary: "Get a user", Tags: []string{"Users"},
+			Permission: permission(middleware.PermissionReadUsers),
+			Response:   models.User{},
+		},
+		"PUT /api/v1/users/:id": {
+			Summary: "Update a user", Tags: []string{"Users"},
+			Permission: permission(middleware.PermissionManageUsers),
+			Body:       api.UpdateUserRequest{}, Response: models.User{},
+		},
+		"DELETE /api/v1/users/:id": {
+			Summary: "Deactivate a user", Tags: []string{"Users"},
+			Permission: permission(middleware.PermissionManageUsers),
+			Response:   models.User{},
+		},
+		"POST /api/v1/users/:id/password-reset": {
+			Summary: "Issue a password reset token", Tags: []string{"Users"},
+			Permission: permission(middleware.PermissionManageUsers),
+			Status:     http.StatusCreated, Response: api.PasswordResetResponse{},
+		},
+
+		// Roles
+		"GET /api/v1/roles": {
+			Summary: "List roles", Tags: []string{"Roles"},
+			Permission: permission(middleware.PermissionReadUsers),
+			Response:   api.RoleListResponse{},
+		},
+		"POST /api/v1/roles": {
+			Summary: "Create a role", Tags: []string{"Roles"},
+			Permission: permission(middleware.PermissionManageSystem),
+			Body:       api.CreateRoleRequest{}, Status: http.StatusCreated, Response: models.RoleDefinition{},
+		},
+		"GET /api/v1/roles/:name": {
+			Summary: "Get a role", Tags: []string{"Roles"},
+			Permission: permission(middleware.PermissionReadUsers),
+			Response:   models.RoleDefinition{},
+		},
+		"PUT /api/v1/roles/:name": {
+			Summary: "Update a role", Tags: []string{"Roles"},
+			Permission: permission(middleware.PermissionManageSystem),
+			Body:       api.UpdateRoleRequest{}, Response: models.RoleDefinition{},
+		},
+		"DELETE /api/v1/roles/:name": {
+			Summary: "Delete a role", Tags: []string{"Roles"},
+			Permission: permission(middleware.PermissionManageSystem),
+			Response:   messageResponse{},
+		},
+
+		// Organizations
+		"GET /api/v1/organization": {
+			Summary: "Get your organization", Tags: []string{"Organizations"},
+			Response: models.Organization{},
+		},
+		"GET /api/v1/organizations": {
+			Summary: "List organizations", Tags: []string{"Organizations"},
+			Description: "Only the default organization, which operates the instance, may list organizations.",
+			Permission:  permission(middleware.PermissionManageSystem),
+			Response:    api.OrganizationListResponse{},
+		},
+		"POST /api/v1/organizations": {
+			Summary: "Create an organization", Tags: []string{"Organizations"},
+			Description: "Create the new organization's first admin with POST /users and its org_id.",
+			Permission:  permission(middleware.PermissionManageSystem),
+			Body:        api.CreateOrganizationRequest{}, Status: http.StatusCreated, Response: models.Organization{},
+		},
+
+		// API keys
+		"GET /api/v1/api-keys": {
+			Summary: "List API keys", Tags: []string{"API Keys"},
+			Permission: permission(middleware.PermissionManageUsers),
+			Query:      api.APIKeyListRequest{}, Response: api.APIKeyListResponse{},
+		},
+		"POST /api/v1/api-keys": {
+			Summary: "Create an API key", Tags: []string{"API Keys"},
+			Description: "The key is returned once, in this response.",
+			Permission:  permission(middleware.PermissionManageUsers),
+			Body:        api.CreateAPIKeyRequest{}, Status: http.StatusCreated, Response: api.CreateAPIKeyResponse{},
+		},
+		"GET /api/v1/api-keys/:id": {
+			Summary: "Get an API key", Tags: []string{"API Keys"},
+			Permission: permission(middleware.PermissionManageUsers),
+			Response:   models.APIKey{},
+		},
+		"PUT /api/v1/api-keys/:id": {
+			Summary: "Update an API key", Tags: []string{"API Keys"},
+			Permission: permission(middleware.PermissionManageUsers),
+			Body:       api.UpdateAPIKeyRequest{}, Response: models.APIKey{},
+		},
+		"DELETE /api/v1/api-keys/:id": {
+			Summary: "Revoke an API key", Tags: []string{"API Keys"},
+			Permission: permission(middleware.PermissionManageUsers),
+			Response:   models.APIKey{},
+		},
+
+		// Feature flags
+		"GET /api/v1/features": {
+			Summary: "List feature flags", Tags: []string{"Features"},
+			Permission: permission(middleware.PermissionReadOutliers),
+			Response:   api.FeatureFlagListResponse{},
+		},
+		"GET /api/v1/features/:name": {
+			Summary: "Get a feature flag", Tags: []string{"Features"},
+			Permission: permission(middleware.PermissionReadOutliers),
+			Response:   models.FeatureFlag{},
+		},
+		"PUT /api/v1/features/:name": {
+			Summary: "Set a feature flag", Tags: []string{"Features"},
+			Permission: permission(middleware.PermissionManageSystem),
+			Body:       api.SetFeatureFlagRequest{}, Response: models.FeatureFlag{},
+		},
+		"DELETE /api/v1/features/:name": {
+			Summary: "Reset a feature flag to its configured value", Tags: []string{"Features"},
+			Permission: permission(middleware.PermissionManageSystem),
+			Response:   models.FeatureFlag{},
+		},
+
+		// Audit log
+		"GET /api/v1/audit": {
+			Summary: "List audit log entries", Tags: []string{"Audit"},
+			Permission: permission(middleware.PermissionReadAudit),
+			Query:      api.AuditLogListRequest{}, Params: []openapi.Parameter{stream},
+			Response: api.AuditLogListResponse{},
+		},
+		"GET /api/v1/audit/export": {
+			Summary: "Export audit log entries", Tags: []string{"Audit"},
+			Description: "Downloads every matching entry as JSON, or CSV with format=csv.",
+			Permission:  permission(middleware.PermissionReadAudit),
+			Query:       api.AuditLogListRequest{}, Response: []api.AuditLogEntry{},
+		},
+		"GET /api/v1/audit/verify": {
+			Summary: "Verify the audit log's signature chain", Tags: []string{"Audit"},
+			Permission: permission(middleware.PermissionReadAudit),
+			Response:   security.ChainReport{},
+		},
+		"GET /api/v1/audit/archives": {
+			Summary: "List audit log archives", Tags: []string{"Audit"},
+			Permission: permission(middleware.PermissionReadAudit),
+			Response:   api.AuditArchiveListResponse{},
+		},
+		"POST /api/v1/audit/archive": {
+			Summary: "Archive old audit log entries", Tags: []string{"Audit"},
+			Permission: permission(middleware.PermissionManageSystem),
+			Response:   api.AuditArchiveListResponse{},
+		},
+
+		// Documentation
+		"GET /api/v1/openapi.json": {
+			Summary: "Get this OpenAPI specification", Tags: []string{"Documentation"}, Public: true,
+			Response: map[string]interface{}{},
+		},
+		"GET /api/v1/docs": {
+			Summary: "Browse the API in Swagger UI", Tags: []string{"Documentation"}, Public: true,
+			Description: "Served when server.swagger_ui_enabled is set.",
+			Response:    "", ResponseType: "text/html",
+		},
+		"GET /api/v1/docs/init.js": {
+			Summary: "Get the script that starts Swagger UI", Tags: []string{"Documentation"}, Public: true,
+			Response: "", ResponseType: "application/javascript",
+		},
+
+		// WebSocket
+		"GET /api/v1/ws": {
+			Summary: "Stream outliers over a WebSocket", Tags: []string{"WebSocket"},
+			Description: "Upgrades to a WebSocket that receives each outlier as it is detected.",
+			Public:      true,
+			Params: []openapi.Parameter{
+				{Name: "token", In: "query", Type: "", Required: true, Description: "Access token from /auth/login"},
+			},
+			Status: http.StatusSwitchingProtocols, Response: api.WebSocketMessage{},
+		},
+		"GET /api/v1/admin/ws/connections": {
+			Summary: "List WebSocket connections", Tags: []string{"WebSocket"},
+			Description: "Lists the clients connected to the API instance serving the request.",
+			Permission:  permission(middleware.PermissionManageSystem),
+			Query:       api.WebSocketConnectionListRequest{}, Response: api.WebSocketConnectionListResponse{},
+		},
+		"DELETE /api/v1/admin/ws/connections": {
+			Summary: "Disconnect a user's WebSocket connections", Tags: []string{"WebSocket"},
+			Permission: permission(middleware.PermissionManageSystem),
+			Params: []openapi.Parameter{
+				{Name: "user_id", In: "query", Type: "", Required: true, Description: "User whose connections to close"},
+			},
+			Response: api.WebSocketDisconnectResponse{},
+		},
+		"DELETE /api/v1/admin/ws/connections/:id": {
+			Summary: "Disconnect a WebSocket connection", Tags: []string{"WebSocket"},
+			Permission: permission(middleware.PermissionManageSystem),
+			Response:   api.WebSocketDisconnectResponse{},
+		},
+	}
+
+	// Keys scoped to an operation's permission may call it
+	for key, operation := range operations {
+		for _, scope := range middleware.APIKeyPermissions {
+			if operation.Permission == string(scope) {
+				operation.APIKey = true
+				operations[key] = operation
+			}
+		}
+	}
+	return operations
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// OrganizationHandler handles organization requests. Every user belongs to
+// one organization and only sees its users, outliers, watchlists and API
+// keys; the default organization operates the instance and creates the
+// others.
+type OrganizationHandler struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewOrganizationHandler creates a new organization handler
+func NewOrganizationHandler(db *sql.DB, logger *zap.Logger) *OrganizationHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &OrganizationHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// GetCurrentOrganization returns the caller's organization
+func (h *OrganizationHandler) GetCurrentOrganization(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	org, err := h.getOrganization(c.Request.Context(), orgID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Organization not found",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to fetch organization",
+			zap.Error(err),
+			zap.String("org_id", orgID))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch organization",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+// ListOrganizations returns every organization, oldest first
+func (h *OrganizationHandler) ListOrganizations(c *gin.Context) {
+	rows, err := h.db.QueryContext(c.Request.Context(), `
+		SELECT id, name, created_at FROM organizations ORDER BY created_at, name
+	`)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query organizations", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch organizations",
+		})
+		return
+	}
+	defer rows.Close()
+
+	orgs := []models.Organization{}
+	for rows.Next() {
+		var org models.Organization
+		if err := rows.Scan(&org.ID, &org.Name, &org.CreatedAt); err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan organization", zap.Error(err))
+			continue
+		}
+		orgs = append(orgs, org)
+	}
+
+	c.JSON(http.StatusOK, api.OrganizationListResponse{Organizations: orgs})
+}
+
+// CreateOrganization creates an organization with no users
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	var req api.CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Organization name is required",
+		})
+		return
+	}
+
+	id := uuid.New().String()
+	result, err := h.db.ExecContext(c.Request.Context(), `
+		INSERT INTO organizations (id, name, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, id, name, time.Now().UTC())
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to create organization",
+			zap.Error(err),
+			zap.String("name", name))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to create organization",
+		})
+		return
+	}
+	if created, err := result.RowsAffected(); err == nil && created == 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "conflict",
+			"message": "An organization with that name already exists",
+		})
+		return
+	}
+
+	org, err := h.getOrganization(c.Request.Context(), id)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to fetch created organization",
+			zap.Error(err),
+			zap.String("org_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch created organization",
+		})
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Organization created",
+		zap.String("org_id", id),
+		zap.String("name", name),
+		zap.String("created_by", c.GetString("user_id")))
+
+	c.JSON(http.StatusCreated, org)
+}
+
+// getOrganization loads an organization by ID, returning sql.ErrNoRows if
+// there is none
+func (h *OrganizationHandler) getOrganization(ctx context.Context, id string) (*models.Organization, error) {
+	var org models.Organization
+	err := h.db.QueryRowContext(ctx, `
+		SELECT id, name, created_at FROM organizations WHERE id = $1
+	`, id).Scan(&org.ID, &org.Name, &org.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
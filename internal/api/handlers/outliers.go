@@ -1,14 +1,21 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"math"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/internal/security/crypto"
 	"github.com/mikedewar/stablerisk/pkg/models"
 	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
@@ -16,8 +23,11 @@ import (
 
 // OutlierHandler handles outlier-related requests
 type OutlierHandler struct {
-	db     *sql.DB
-	logger *zap.Logger
+	db            *sql.DB
+	fields        fieldCipher
+	auditLogger   *security.AuditLogger
+	onAcknowledge func(orgID string, outlier models.Outlier)
+	logger        *zap.Logger
 }
 
 // NewOutlierHandler creates a new outlier handler
@@ -32,7 +42,77 @@ func NewOutlierHandler(db *sql.DB, logger *zap.Logger) *OutlierHandler {
 	}
 }
 
-// ListOutliers returns a paginated list of outliers
+// SetCipher encrypts analyst notes at rest
+func (h *OutlierHandler) SetCipher(cipher *crypto.Cipher) {
+	h.fields = fieldCipher{cipher: cipher}
+}
+
+// SetAuditLogger records assignment changes in the audit log
+func (h *OutlierHandler) SetAuditLogger(auditLogger *security.AuditLogger) {
+	h.auditLogger = auditLogger
+}
+
+// SetAcknowledgeHook calls hook with each outlier acknowledged and the
+// organization that acknowledged it, once the acknowledgement is saved, so
+// alerts raised for it can be closed. hook gets the outlier's ID,
+// organization, type, severity and address.
+func (h *OutlierHandler) SetAcknowledgeHook(hook func(orgID string, outlier models.Outlier)) {
+	h.onAcknowledge = hook
+}
+
+// acknowledged passes outliers just acknowledged to the acknowledge hook
+func (h *OutlierHandler) acknowledged(c *gin.Context, ids ...string) {
+	if h.onAcknowledge == nil || len(ids) == 0 {
+		return
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	rows, err := h.db.QueryContext(c.Request.Context(), `
+		SELECT id, org_id, type, severity, address
+		FROM outliers
+		WHERE id IN (`+strings.Join(placeholders, ", ")+`)
+	`, args...)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to load acknowledged outliers",
+			zap.Error(err))
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var outlier models.Outlier
+		var orgID sql.NullString
+		if err := rows.Scan(&outlier.ID, &orgID, &outlier.Type, &outlier.Severity, &outlier.Address); err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan acknowledged outlier",
+				zap.Error(err))
+			return
+		}
+		outlier.OrgID = orgID.String
+		h.onAcknowledge(middleware.GetOrgID(c), outlier)
+	}
+}
+
+// outlierSortOrders are the orders ListOutliers accepts. Severity sorts by
+// rank rather than name, and ties fall back to the newest first.
+var outlierSortOrders = map[string]sortOrder{
+	"detected_at": {expression: "detected_at", tiebreak: "id"},
+	"severity": {
+		expression: fmt.Sprintf("CASE severity WHEN '%s' THEN 1 WHEN '%s' THEN 2 WHEN '%s' THEN 3 WHEN '%s' THEN 4 ELSE 0 END",
+			models.SeverityLow, models.SeverityMedium, models.SeverityHigh, models.SeverityCritical),
+		tiebreak: "detected_at DESC, id",
+	},
+	"amount":  {expression: "amount", tiebreak: "detected_at DESC, id"},
+	"z_score": {expression: "z_score", tiebreak: "detected_at DESC, id"},
+}
+
+// ListOutliers returns a paginated list of outliers, or streams every
+// matching outlier as NDJSON when asked with Accept: application/x-ndjson
+// or ?stream=true
 func (h *OutlierHandler) ListOutliers(c *gin.Context) {
 	var req api.OutlierListRequest
 
@@ -58,74 +138,92 @@ func (h *OutlierHandler) ListOutliers(c *gin.Context) {
 	}
 
 	// Build query
-	query := `
-		SELECT id, detected_at, type, severity, address, transaction_hash,
-		       amount, z_score, details, acknowledged, acknowledged_by, acknowledged_at, notes
-		FROM outliers
-		WHERE 1=1
-	`
-	args := []interface{}{}
-	argCount := 1
-
-	// Apply filters
-	if req.Type != "" {
-		query += ` AND type = $` + string(rune('0'+argCount))
-		args = append(args, req.Type)
-		argCount++
+	orgID := middleware.GetOrgID(c)
+	filter, err := outlierFilter(req.OutlierFilter, orgID, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": err.Error(),
+		})
+		return
 	}
-
-	if req.Severity != "" {
-		query += ` AND severity = $` + string(rune('0'+argCount))
-		args = append(args, req.Severity)
-		argCount++
+	if req.Sort == "" {
+		req.Sort = "-detected_at"
 	}
-
-	if req.Address != "" {
-		query += ` AND address = $` + string(rune('0'+argCount))
-		args = append(args, req.Address)
-		argCount++
+	order, ok := orderBy(req.Sort, outlierSortOrders)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "sort must be detected_at, severity, amount or z_score, prefixed with - for descending",
+		})
+		return
 	}
 
-	if req.Acknowledged != nil {
-		query += ` AND acknowledged = $` + string(rune('0'+argCount))
-		args = append(args, *req.Acknowledged)
-		argCount++
+	keyset := req.AfterID != "" || req.AfterDetectedAt != nil
+	if keyset {
+		if req.AfterID == "" || req.AfterDetectedAt == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": "after_id and after_detected_at must be given together",
+			})
+			return
+		}
+		if req.Sort != "detected_at" && req.Sort != "-detected_at" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": "after_id and after_detected_at need sort=detected_at or -detected_at",
+			})
+			return
+		}
 	}
 
-	if req.FromTimestamp != nil {
-		query += ` AND detected_at >= $` + string(rune('0'+argCount))
-		args = append(args, *req.FromTimestamp)
-		argCount++
+	// A stream sends every matching outlier, so needs no count
+	stream := wantsStream(c)
+	var total int
+	if !stream {
+		err = h.db.QueryRowContext(c.Request.Context(), `SELECT COUNT(*) FROM `+outliersSeenBy("$1")+filter.clause(), filter.args...).Scan(&total)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to count outliers",
+				zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "internal_error",
+				"message": "Failed to fetch outliers",
+			})
+			return
+		}
 	}
 
-	if req.ToTimestamp != nil {
-		query += ` AND detected_at <= $` + string(rune('0'+argCount))
-		args = append(args, *req.ToTimestamp)
-		argCount++
+	// A cursor continues after the last outlier of the previous page, which
+	// stays fast and consistent however deep the page and however many
+	// outliers arrive meanwhile. A stream given a cursor resumes after it.
+	if keyset {
+		after := "<"
+		if req.Sort == "detected_at" {
+			after = ">"
+		}
+		detectedAt := filter.arg(*req.AfterDetectedAt)
+		filter.where("(detected_at " + after + " " + detectedAt + " OR (detected_at = " + detectedAt + " AND id > " + filter.arg(req.AfterID) + "))")
 	}
+	query := `SELECT ` + outlierColumns + ` FROM ` + outliersSeenBy("$1") + filter.clause() + order
 
-	// Count total
-	countQuery := `SELECT COUNT(*) FROM (` + query + `) AS filtered`
-	var total int
-	err := h.db.QueryRow(countQuery, args...).Scan(&total)
-	if err != nil {
-		h.logger.Error("Failed to count outliers",
-			zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "internal_error",
-			"message": "Failed to fetch outliers",
-		})
+	if stream {
+		h.streamOutliers(c, query, filter.args)
 		return
 	}
 
-	// Add ordering and pagination
-	query += ` ORDER BY detected_at DESC LIMIT $` + string(rune('0'+argCount)) + ` OFFSET $` + string(rune('0'+argCount+1))
-	args = append(args, req.Limit, (req.Page-1)*req.Limit)
+	// Add pagination
+	var pagination string
+	var args []interface{}
+	if keyset {
+		pagination, args = filter.limit(req.Limit)
+	} else {
+		pagination, args = filter.page(req.Page, req.Limit)
+	}
 
 	// Query outliers
-	rows, err := h.db.Query(query, args...)
+	rows, err := h.db.QueryContext(c.Request.Context(), query+pagination, args...)
 	if err != nil {
-		h.logger.Error("Failed to query outliers",
+		middleware.RequestLogger(c, h.logger).Error("Failed to query outliers",
 			zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "internal_error",
@@ -137,159 +235,281 @@ func (h *OutlierHandler) ListOutliers(c *gin.Context) {
 
 	outliers := []models.Outlier{}
 	for rows.Next() {
-		var outlier models.Outlier
-		var amountStr string
-		var detailsJSON []byte
-		var acknowledgedBy, notes sql.NullString
-		var acknowledgedAt sql.NullTime
-		var zScore sql.NullFloat64
-
-		err := rows.Scan(
-			&outlier.ID,
-			&outlier.DetectedAt,
-			&outlier.Type,
-			&outlier.Severity,
-			&outlier.Address,
-			&outlier.TransactionHash,
-			&amountStr,
-			&zScore,
-			&detailsJSON,
-			&outlier.Acknowledged,
-			&acknowledgedBy,
-			&acknowledgedAt,
-			&notes,
-		)
+		outlier, err := h.scanOutlier(c, rows)
 		if err != nil {
-			h.logger.Error("Failed to scan outlier row",
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan outlier row",
 				zap.Error(err))
 			continue
 		}
-
-		// Parse amount
-		outlier.Amount, _ = decimal.NewFromString(amountStr)
-
-		// Parse z-score
-		if zScore.Valid {
-			outlier.ZScore = zScore.Float64
-		}
-
-		// Parse details
-		if err := json.Unmarshal(detailsJSON, &outlier.Details); err != nil {
-			h.logger.Error("Failed to unmarshal outlier details",
-				zap.Error(err))
-		}
-
-		// Parse nullable fields
-		if acknowledgedBy.Valid {
-			outlier.AcknowledgedBy = acknowledgedBy.String
-		}
-		if acknowledgedAt.Valid {
-			outlier.AcknowledgedAt = acknowledgedAt.Time
-		}
-		if notes.Valid {
-			outlier.Notes = notes.String
-		}
-
-		outliers = append(outliers, outlier)
+		outliers = append(outliers, *outlier)
 	}
 
 	// Calculate total pages
 	totalPages := int(math.Ceil(float64(total) / float64(req.Limit)))
 
-	c.JSON(http.StatusOK, api.OutlierListResponse{
+	response := api.OutlierListResponse{
 		Outliers:   outliers,
 		Total:      total,
 		Page:       req.Page,
 		Limit:      req.Limit,
 		TotalPages: totalPages,
-	})
+	}
+	// A full page may have more after it
+	if len(outliers) == req.Limit && (req.Sort == "detected_at" || req.Sort == "-detected_at") {
+		last := outliers[len(outliers)-1]
+		response.NextAfterID = last.ID
+		response.NextAfterDetectedAt = &last.DetectedAt
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-// GetOutlier returns a single outlier by ID
-func (h *OutlierHandler) GetOutlier(c *gin.Context) {
-	id := c.Param("id")
+// maxBulkAcknowledge bounds the outliers one bulk acknowledgement touches
+const maxBulkAcknowledge = 1000
 
-	var outlier models.Outlier
-	var amountStr string
-	var detailsJSON []byte
-	var acknowledgedBy, notes sql.NullString
-	var acknowledgedAt sql.NullTime
-	var zScore sql.NullFloat64
+// BulkAcknowledgeOutliers acknowledges a list of outliers, or every
+// unacknowledged outlier matching a filter, with the same notes and label.
+// All updates happen in one transaction and the result for each outlier is
+// returned. The audit middleware records the request as a single entry.
+func (h *OutlierHandler) BulkAcknowledgeOutliers(c *gin.Context) {
+	userID := c.GetString("user_id")
+	orgID := middleware.GetOrgID(c)
 
-	err := h.db.QueryRow(`
-		SELECT id, detected_at, type, severity, address, transaction_hash,
-		       amount, z_score, details, acknowledged, acknowledged_by, acknowledged_at, notes
-		FROM outliers
-		WHERE id = $1
-	`, id).Scan(
-		&outlier.ID,
-		&outlier.DetectedAt,
-		&outlier.Type,
-		&outlier.Severity,
-		&outlier.Address,
-		&outlier.TransactionHash,
-		&amountStr,
-		&zScore,
-		&detailsJSON,
-		&outlier.Acknowledged,
-		&acknowledgedBy,
-		&acknowledgedAt,
-		&notes,
-	)
+	var req api.BulkAcknowledgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+	if (len(req.IDs) == 0) == (req.Filter == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Give either ids or filter",
+		})
+		return
+	}
+	if len(req.IDs) > maxBulkAcknowledge {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": fmt.Sprintf("At most %d outliers can be acknowledged at once", maxBulkAcknowledge),
+		})
+		return
+	}
 
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error":   "not_found",
-			"message": "Outlier not found",
+	var filter queryFilter
+	if req.Filter != nil {
+		var err error
+		if filter, err = outlierFilter(*req.Filter, orgID, userID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": err.Error(),
+			})
+			return
+		}
+		filter.equal("acknowledged", false)
+	}
+
+	// Feedback label is optional; keep any existing label when omitted
+	label := sql.NullString{
+		String: string(req.Label),
+		Valid:  req.Label != "",
+	}
+
+	notes, err := h.fields.encrypt(req.Notes)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to encrypt outlier notes",
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to acknowledge outliers",
 		})
 		return
 	}
 
+	ctx := c.Request.Context()
+	tx, err := h.db.BeginTx(ctx, nil)
 	if err != nil {
-		h.logger.Error("Failed to query outlier",
-			zap.Error(err),
-			zap.String("outlier_id", id))
+		middleware.RequestLogger(c, h.logger).Error("Failed to begin bulk acknowledgement",
+			zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "internal_error",
-			"message": "Failed to fetch outlier",
+			"message": "Failed to acknowledge outliers",
 		})
 		return
 	}
+	defer tx.Rollback()
 
-	// Parse amount
-	outlier.Amount, _ = decimal.NewFromString(amountStr)
+	ids := req.IDs
+	if req.Filter != nil {
+		limit, args := filter.limit(maxBulkAcknowledge + 1)
+		ids, err = queryIDs(ctx, tx, `SELECT id FROM `+outliersSeenBy("$1")+filter.clause()+` ORDER BY detected_at, id`+limit, args...)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to select outliers to acknowledge",
+				zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "internal_error",
+				"message": "Failed to acknowledge outliers",
+			})
+			return
+		}
+		if len(ids) > maxBulkAcknowledge {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": fmt.Sprintf("More than %d outliers match the filter; narrow it", maxBulkAcknowledge),
+			})
+			return
+		}
+	}
 
-	// Parse z-score
-	if zScore.Valid {
-		outlier.ZScore = zScore.Float64
+	response := api.BulkAcknowledgeResponse{Results: make([]api.BulkAcknowledgeResult, 0, len(ids))}
+	now := time.Now()
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		var result sql.Result
+		err := startTriage(ctx, tx, orgID, id)
+		if err == nil {
+			result, err = tx.ExecContext(ctx, `
+				UPDATE outlier_triage
+				SET acknowledged = true,
+				    acknowledged_by = $1,
+				    acknowledged_at = $2,
+				    notes = $3,
+				    feedback = COALESCE($4, feedback)
+				WHERE outlier_id = $5 AND org_id = $6
+			`, userID, now, notes, label, id, orgID)
+		}
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to acknowledge outlier",
+				zap.Error(err),
+				zap.String("outlier_id", id))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "internal_error",
+				"message": "Failed to acknowledge outliers",
+			})
+			return
+		}
+
+		status := "acknowledged"
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			status = "not_found"
+		} else {
+			response.Acknowledged++
+		}
+		response.Results = append(response.Results, api.BulkAcknowledgeResult{ID: id, Status: status})
 	}
 
-	// Parse details
-	if err := json.Unmarshal(detailsJSON, &outlier.Details); err != nil {
-		h.logger.Error("Failed to unmarshal outlier details",
+	if err := tx.Commit(); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to commit bulk acknowledgement",
 			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to acknowledge outliers",
+		})
+		return
 	}
 
-	// Parse nullable fields
-	if acknowledgedBy.Valid {
-		outlier.AcknowledgedBy = acknowledgedBy.String
+	var acknowledgedIDs []string
+	for _, result := range response.Results {
+		if result.Status == "acknowledged" {
+			acknowledgedIDs = append(acknowledgedIDs, result.ID)
+		}
+	}
+	h.acknowledged(c, acknowledgedIDs...)
+
+	middleware.RequestLogger(c, h.logger).Info("Outliers acknowledged in bulk",
+		zap.Int("acknowledged", response.Acknowledged),
+		zap.Int("requested", len(response.Results)),
+		zap.String("user_id", userID),
+		zap.String("label", string(req.Label)))
+
+	c.JSON(http.StatusOK, response)
+}
+
+// maxBulkArchive bounds the outliers one bulk archival touches
+const maxBulkArchive = 1000
+
+// ArchiveOutlier archives an outlier. Archived outliers are kept, with
+// their triage history, but left out of listings unless asked for with
+// ?archived=true or ?archived=all.
+func (h *OutlierHandler) ArchiveOutlier(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetString("user_id")
+	orgID := middleware.GetOrgID(c)
+	ctx := c.Request.Context()
+
+	var result sql.Result
+	err := startTriage(ctx, h.db, orgID, id)
+	if err == nil {
+		result, err = h.db.ExecContext(ctx, `
+			UPDATE outlier_triage
+			SET archived_at = $1,
+			    archived_by = $2
+			WHERE outlier_id = $3 AND org_id = $4 AND archived_at IS NULL
+		`, time.Now(), userID, id, orgID)
 	}
-	if acknowledgedAt.Valid {
-		outlier.AcknowledgedAt = acknowledgedAt.Time
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to archive outlier",
+			zap.Error(err),
+			zap.String("outlier_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to archive outlier",
+		})
+		return
 	}
-	if notes.Valid {
-		outlier.Notes = notes.String
+
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		var archivedAt sql.NullTime
+		err := h.db.QueryRowContext(ctx, `
+			SELECT archived_at FROM outlier_triage WHERE outlier_id = $1 AND org_id = $2
+		`, id, orgID).Scan(&archivedAt)
+		switch {
+		case err == sql.ErrNoRows:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "not_found",
+				"message": "Outlier not found",
+			})
+		case err != nil:
+			middleware.RequestLogger(c, h.logger).Error("Failed to check outlier",
+				zap.Error(err),
+				zap.String("outlier_id", id))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "internal_error",
+				"message": "Failed to archive outlier",
+			})
+		default:
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "conflict",
+				"message": "Outlier is already archived",
+			})
+		}
+		return
 	}
 
-	c.JSON(http.StatusOK, outlier)
+	middleware.RequestLogger(c, h.logger).Info("Outlier archived",
+		zap.String("outlier_id", id),
+		zap.String("user_id", userID))
+
+	c.JSON(http.StatusOK, api.SuccessResponse{
+		Success: true,
+		Message: "Outlier archived successfully",
+	})
 }
 
-// AcknowledgeOutlier marks an outlier as acknowledged
-func (h *OutlierHandler) AcknowledgeOutlier(c *gin.Context) {
-	id := c.Param("id")
+// BulkArchiveOutliers archives a list of outliers, or every live outlier
+// matching a filter, in one transaction, returning the result for each
+// outlier
+func (h *OutlierHandler) BulkArchiveOutliers(c *gin.Context) {
 	userID := c.GetString("user_id")
+	orgID := middleware.GetOrgID(c)
 
-	var req api.AcknowledgeOutlierRequest
+	var req api.BulkArchiveRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "bad_request",
@@ -297,43 +517,915 @@ func (h *OutlierHandler) AcknowledgeOutlier(c *gin.Context) {
 		})
 		return
 	}
+	if (len(req.IDs) == 0) == (req.Filter == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Give either ids or filter",
+		})
+		return
+	}
+	if len(req.IDs) > maxBulkArchive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": fmt.Sprintf("At most %d outliers can be archived at once", maxBulkArchive),
+		})
+		return
+	}
 
-	// Update outlier
-	result, err := h.db.Exec(`
-		UPDATE outliers
-		SET acknowledged = true,
-		    acknowledged_by = $1,
-		    acknowledged_at = $2,
-		    notes = $3
-		WHERE id = $4
-	`, userID, time.Now(), req.Notes, id)
+	var filter queryFilter
+	if req.Filter != nil {
+		// Only live outliers can be archived, whatever the filter asks
+		f := *req.Filter
+		f.Archived = "false"
+		var err error
+		if filter, err = outlierFilter(f, orgID, userID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
 
+	ctx := c.Request.Context()
+	tx, err := h.db.BeginTx(ctx, nil)
 	if err != nil {
-		h.logger.Error("Failed to acknowledge outlier",
-			zap.Error(err),
-			zap.String("outlier_id", id))
+		middleware.RequestLogger(c, h.logger).Error("Failed to begin bulk archival",
+			zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "internal_error",
-			"message": "Failed to acknowledge outlier",
+			"message": "Failed to archive outliers",
 		})
 		return
 	}
+	defer tx.Rollback()
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error":   "not_found",
-			"message": "Outlier not found",
+	ids := req.IDs
+	if req.Filter != nil {
+		limit, args := filter.limit(maxBulkArchive + 1)
+		ids, err = queryIDs(ctx, tx, `SELECT id FROM `+outliersSeenBy("$1")+filter.clause()+` ORDER BY detected_at, id`+limit, args...)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to select outliers to archive",
+				zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "internal_error",
+				"message": "Failed to archive outliers",
+			})
+			return
+		}
+		if len(ids) > maxBulkArchive {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": fmt.Sprintf("More than %d outliers match the filter; narrow it", maxBulkArchive),
+			})
+			return
+		}
+	}
+
+	response := api.BulkArchiveResponse{Results: make([]api.BulkArchiveResult, 0, len(ids))}
+	now := time.Now()
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		var archivedAt sql.NullTime
+		err := startTriage(ctx, tx, orgID, id)
+		if err == nil {
+			err = tx.QueryRowContext(ctx, `
+				SELECT archived_at FROM outlier_triage WHERE outlier_id = $1 AND org_id = $2
+			`, id, orgID).Scan(&archivedAt)
+		}
+		if err == nil && !archivedAt.Valid {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE outlier_triage
+				SET archived_at = $1,
+				    archived_by = $2
+				WHERE outlier_id = $3 AND org_id = $4
+			`, now, userID, id, orgID)
+		}
+		if err != nil && err != sql.ErrNoRows {
+			middleware.RequestLogger(c, h.logger).Error("Failed to archive outlier",
+				zap.Error(err),
+				zap.String("outlier_id", id))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "internal_error",
+				"message": "Failed to archive outliers",
+			})
+			return
+		}
+
+		status := "archived"
+		switch {
+		case err == sql.ErrNoRows:
+			status = "not_found"
+		case archivedAt.Valid:
+			status = "already_archived"
+		default:
+			response.Archived++
+		}
+		response.Results = append(response.Results, api.BulkArchiveResult{ID: id, Status: status})
+	}
+
+	if err := tx.Commit(); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to commit bulk archival",
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to archive outliers",
 		})
 		return
 	}
 
-	h.logger.Info("Outlier acknowledged",
-		zap.String("outlier_id", id),
+	middleware.RequestLogger(c, h.logger).Info("Outliers archived in bulk",
+		zap.Int("archived", response.Archived),
+		zap.Int("requested", len(response.Results)),
 		zap.String("user_id", userID))
 
-	c.JSON(http.StatusOK, api.SuccessResponse{
-		Success: true,
-		Message: "Outlier acknowledged successfully",
-	})
+	c.JSON(http.StatusOK, response)
+}
+
+// queryIDs runs a query returning a single ID column
+func queryIDs(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// visibleOutliers is the condition selecting the outliers an organization
+// sees, given the placeholder of its ID: its own watchlist hits and the
+// shared detections, which belong to no organization
+func visibleOutliers(placeholder string) string {
+	return "(org_id = " + placeholder + " OR org_id IS NULL)"
+}
+
+// outliersSeenBy is the relation, named outliers, of the outliers the
+// organization whose ID is at placeholder sees, with its own triage of
+// each. Outliers it has not triaged are open, unacknowledged, unassigned
+// and unarchived, with no notes or feedback. Placeholder must be the
+// query's first, as SQLite numbers placeholders in order of appearance.
+func outliersSeenBy(placeholder string) string {
+	return `(SELECT o.id, o.detected_at, o.type, o.severity, o.address, o.transaction_hash,
+		o.amount, o.z_score, o.details, o.invalidated, o.invalidated_at, o.invalid_reason, o.org_id,
+		COALESCE(t.status, 'open') AS status, COALESCE(t.acknowledged, false) AS acknowledged,
+		t.acknowledged_by, t.acknowledged_at, t.notes, t.feedback,
+		t.assigned_to, t.assigned_by, t.assigned_at, t.archived_at, t.archived_by
+	FROM outliers o
+	LEFT JOIN outlier_triage t ON t.outlier_id = o.id AND t.org_id = ` + placeholder + `
+	WHERE o.org_id = ` + placeholder + ` OR o.org_id IS NULL) outliers`
+}
+
+// startTriage gives orgID an untriaged row in outlier_triage for an
+// outlier it sees, unless it has one already, so its triage can then be
+// updated in place. Outliers orgID does not see get none, so updates find
+// nothing.
+func startTriage(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}, orgID, id string) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO outlier_triage (outlier_id, org_id)
+		SELECT o.id, org.id FROM outliers o
+		JOIN organizations org ON org.id = $1
+		WHERE o.id = $2 AND (o.org_id = org.id OR o.org_id IS NULL)
+		ON CONFLICT (outlier_id, org_id) DO NOTHING
+	`, orgID, id)
+	return err
+}
+
+// outlierFilter builds the WHERE conditions for a filter on the outliers
+// an organization sees, read from outliersSeenBy("$1") with orgID as the
+// first argument, or returns an error describing the first invalid value.
+// userID is the requesting user, who assigned_to=me selects.
+func outlierFilter(f api.OutlierFilter, orgID, userID string) (queryFilter, error) {
+	var filter queryFilter
+	filter.arg(orgID)
+
+	severities := splitValues(f.Severity)
+	for _, severity := range severities {
+		if models.Severity(severity).RiskScore() == 0 {
+			return filter, fmt.Errorf("severity must be low, medium, high or critical")
+		}
+	}
+	statuses := splitValues(f.Status)
+	for _, status := range statuses {
+		if !models.OutlierStatus(status).Valid() {
+			return filter, fmt.Errorf("status must be open, investigating, false_positive or confirmed")
+		}
+	}
+	minAmount, maxAmount, err := parseAmountRange(f.MinAmount, f.MaxAmount)
+	if err != nil {
+		return filter, err
+	}
+
+	filter.in("type", splitValues(f.Type))
+	filter.in("severity", severities)
+	filter.in("address", splitValues(f.Address))
+	filter.in("status", statuses)
+	switch f.AssignedTo {
+	case "":
+	case "none":
+		filter.where("assigned_to IS NULL")
+	case "me":
+		if userID == "" {
+			return filter, fmt.Errorf("assigned_to=me needs a user")
+		}
+		filter.equal("assigned_to", userID)
+	default:
+		filter.equal("assigned_to", f.AssignedTo)
+	}
+	if f.Acknowledged != nil {
+		filter.equal("acknowledged", *f.Acknowledged)
+	}
+	if f.Invalidated != nil {
+		filter.equal("invalidated", *f.Invalidated)
+	}
+	// Archived outliers are left out unless asked for
+	switch f.Archived {
+	case "", "false":
+		filter.where("archived_at IS NULL")
+	case "true":
+		filter.where("archived_at IS NOT NULL")
+	case "all":
+	default:
+		return filter, fmt.Errorf("archived must be true, false or all")
+	}
+	if minAmount != nil {
+		filter.where("amount >= " + filter.arg(minAmount.String()))
+	}
+	if maxAmount != nil {
+		filter.where("amount <= " + filter.arg(maxAmount.String()))
+	}
+	if f.FromTimestamp != nil {
+		filter.where("detected_at >= " + filter.arg(*f.FromTimestamp))
+	}
+	if f.ToTimestamp != nil {
+		filter.where("detected_at <= " + filter.arg(*f.ToTimestamp))
+	}
+	return filter, nil
+}
+
+// parseAmountRange parses the optional min_amount and max_amount filters
+func parseAmountRange(min, max string) (minAmount, maxAmount *decimal.Decimal, err error) {
+	if min != "" {
+		amount, err := decimal.NewFromString(min)
+		if err != nil {
+			return nil, nil, fmt.Errorf("min_amount must be a number")
+		}
+		minAmount = &amount
+	}
+	if max != "" {
+		amount, err := decimal.NewFromString(max)
+		if err != nil {
+			return nil, nil, fmt.Errorf("max_amount must be a number")
+		}
+		maxAmount = &amount
+	}
+	if minAmount != nil && maxAmount != nil && minAmount.GreaterThan(*maxAmount) {
+		return nil, nil, fmt.Errorf("min_amount must not exceed max_amount")
+	}
+	return minAmount, maxAmount, nil
+}
+
+// GetOutlier returns a single outlier by ID
+func (h *OutlierHandler) GetOutlier(c *gin.Context) {
+	id := c.Param("id")
+
+	orgID := middleware.GetOrgID(c)
+	outlier, err := h.scanOutlier(c, h.db.QueryRowContext(c.Request.Context(),
+		`SELECT `+outlierColumns+` FROM `+outliersSeenBy("$1")+` WHERE id = $2`, orgID, id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Outlier not found",
+		})
+		return
+	}
+
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query outlier",
+			zap.Error(err),
+			zap.String("outlier_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch outlier",
+		})
+		return
+	}
+
+	jsonWithETag(c, outlier, h.logger)
+}
+
+// streamOutliers writes every outlier a query returns as NDJSON
+func (h *OutlierHandler) streamOutliers(c *gin.Context, query string, args []interface{}) {
+	rows, err := h.db.QueryContext(c.Request.Context(), query, args...)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query outliers",
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch outliers",
+		})
+		return
+	}
+	defer rows.Close()
+
+	stream := newNDJSONWriter(c)
+	for rows.Next() {
+		outlier, err := h.scanOutlier(c, rows)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan outlier row",
+				zap.Error(err))
+			continue
+		}
+		if err := stream.write(outlier); err != nil {
+			middleware.RequestLogger(c, h.logger).Info("Outlier stream closed by client",
+				zap.Int("streamed", stream.written))
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Outlier stream interrupted",
+			zap.Error(err),
+			zap.Int("streamed", stream.written))
+		stream.fail("Outlier stream interrupted")
+		return
+	}
+	stream.flush()
+
+	middleware.RequestLogger(c, h.logger).Info("Outliers streamed",
+		zap.Int("count", stream.written))
+}
+
+// outlierColumns are the columns scanOutlier reads
+const outlierColumns = `id, detected_at, type, severity, address, transaction_hash,
+	amount, z_score, details, status, acknowledged, acknowledged_by, acknowledged_at, notes, feedback,
+	assigned_to, assigned_by, assigned_at, invalidated, invalidated_at, invalid_reason,
+	archived_at, archived_by, org_id`
+
+// scanOutlier scans a row of outlierColumns, decrypting the notes
+func (h *OutlierHandler) scanOutlier(c *gin.Context, row interface{ Scan(dest ...any) error }) (*models.Outlier, error) {
+	var outlier models.Outlier
+	var amountStr string
+	var detailsJSON []byte
+	var acknowledgedBy, notes, feedback, assignedTo, assignedBy, invalidReason, archivedBy, orgID sql.NullString
+	var acknowledgedAt, assignedAt, invalidatedAt, archivedAt sql.NullTime
+	var zScore sql.NullFloat64
+
+	err := row.Scan(
+		&outlier.ID,
+		&outlier.DetectedAt,
+		&outlier.Type,
+		&outlier.Severity,
+		&outlier.Address,
+		&outlier.TransactionHash,
+		&amountStr,
+		&zScore,
+		&detailsJSON,
+		&outlier.Status,
+		&outlier.Acknowledged,
+		&acknowledgedBy,
+		&acknowledgedAt,
+		&notes,
+		&feedback,
+		&assignedTo,
+		&assignedBy,
+		&assignedAt,
+		&outlier.Invalidated,
+		&invalidatedAt,
+		&invalidReason,
+		&archivedAt,
+		&archivedBy,
+		&orgID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse amount
+	outlier.Amount, _ = decimal.NewFromString(amountStr)
+
+	// Parse z-score
+	if zScore.Valid {
+		outlier.ZScore = zScore.Float64
+	}
+
+	// Parse details
+	if err := json.Unmarshal(detailsJSON, &outlier.Details); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to unmarshal outlier details",
+			zap.Error(err),
+			zap.String("outlier_id", outlier.ID))
+	}
+
+	// Parse nullable fields
+	outlier.OrgID = orgID.String
+	outlier.AcknowledgedBy = acknowledgedBy.String
+	outlier.AcknowledgedAt = acknowledgedAt.Time
+	if notes.Valid {
+		if outlier.Notes, err = h.fields.decrypt(notes.String); err != nil {
+			return nil, fmt.Errorf("failed to decrypt notes of outlier %s: %w", outlier.ID, err)
+		}
+	}
+	outlier.Feedback = models.FeedbackLabel(feedback.String)
+	outlier.AssignedTo = assignedTo.String
+	outlier.AssignedBy = assignedBy.String
+	outlier.AssignedAt = assignedAt.Time
+	outlier.InvalidatedAt = invalidatedAt.Time
+	outlier.InvalidReason = invalidReason.String
+	outlier.ArchivedAt = archivedAt.Time
+	outlier.ArchivedBy = archivedBy.String
+
+	return &outlier, nil
+}
+
+// AcknowledgeOutlier marks an outlier as acknowledged
+func (h *OutlierHandler) AcknowledgeOutlier(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetString("user_id")
+	orgID := middleware.GetOrgID(c)
+
+	var req api.AcknowledgeOutlierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	// Feedback label is optional; keep any existing label when omitted
+	label := sql.NullString{
+		String: string(req.Label),
+		Valid:  req.Label != "",
+	}
+
+	notes, err := h.fields.encrypt(req.Notes)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to encrypt outlier notes",
+			zap.Error(err),
+			zap.String("outlier_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to acknowledge outlier",
+		})
+		return
+	}
+
+	// Update the organization's triage
+	ctx := c.Request.Context()
+	var result sql.Result
+	err = startTriage(ctx, h.db, orgID, id)
+	if err == nil {
+		result, err = h.db.ExecContext(ctx, `
+			UPDATE outlier_triage
+			SET acknowledged = true,
+			    acknowledged_by = $1,
+			    acknowledged_at = $2,
+			    notes = $3,
+			    feedback = COALESCE($4, feedback)
+			WHERE outlier_id = $5 AND org_id = $6
+		`, userID, time.Now(), notes, label, id, orgID)
+	}
+
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to acknowledge outlier",
+			zap.Error(err),
+			zap.String("outlier_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to acknowledge outlier",
+		})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Outlier not found",
+		})
+		return
+	}
+
+	h.acknowledged(c, id)
+
+	middleware.RequestLogger(c, h.logger).Info("Outlier acknowledged",
+		zap.String("outlier_id", id),
+		zap.String("user_id", userID),
+		zap.String("label", string(req.Label)))
+
+	c.JSON(http.StatusOK, api.SuccessResponse{
+		Success: true,
+		Message: "Outlier acknowledged successfully",
+	})
+}
+
+// UpdateOutlierStatus moves an outlier through the triage workflow and
+// records the change in its status history. Any status but open also
+// acknowledges the outlier, and closing it sets the matching feedback label,
+// so the acknowledged flag and the tuning report follow the workflow.
+func (h *OutlierHandler) UpdateOutlierStatus(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetString("user_id")
+	orgID := middleware.GetOrgID(c)
+
+	var req api.UpdateOutlierStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+	if !req.Status.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "status must be open, investigating, false_positive or confirmed",
+		})
+		return
+	}
+
+	notes, err := h.fields.encrypt(req.Notes)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to encrypt status notes",
+			zap.Error(err),
+			zap.String("outlier_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to update outlier status",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to begin status update",
+			zap.Error(err),
+			zap.String("outlier_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to update outlier status",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var current models.OutlierStatus
+	err = startTriage(ctx, tx, orgID, id)
+	if err == nil {
+		err = tx.QueryRowContext(ctx, `
+			SELECT status FROM outlier_triage WHERE outlier_id = $1 AND org_id = $2
+		`, id, orgID).Scan(&current)
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Outlier not found",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query outlier status",
+			zap.Error(err),
+			zap.String("outlier_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to update outlier status",
+		})
+		return
+	}
+	if !current.CanTransition(req.Status) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "conflict",
+			"message": fmt.Sprintf("An outlier cannot move from %s to %s", current, req.Status),
+		})
+		return
+	}
+
+	now := time.Now()
+	acknowledged := req.Status != models.OutlierStatusOpen
+	var acknowledgedBy sql.NullString
+	var acknowledgedAt sql.NullTime
+	if acknowledged {
+		acknowledgedBy = sql.NullString{String: userID, Valid: true}
+		acknowledgedAt = sql.NullTime{Time: now, Valid: true}
+	}
+	label := sql.NullString{
+		String: string(req.Status.FeedbackLabel()),
+		Valid:  req.Status.Closed(),
+	}
+
+	// Only update from the status the transition was checked against, so a
+	// concurrent change is reported rather than overwritten
+	result, err := tx.ExecContext(ctx, `
+		UPDATE outlier_triage
+		SET status = $1,
+		    acknowledged = $2,
+		    acknowledged_by = COALESCE(acknowledged_by, $3),
+		    acknowledged_at = COALESCE(acknowledged_at, $4),
+		    feedback = COALESCE($5, feedback)
+		WHERE outlier_id = $6 AND org_id = $7 AND status = $8
+	`, req.Status, acknowledged, acknowledgedBy, acknowledgedAt, label, id, orgID, current)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to update outlier status",
+			zap.Error(err),
+			zap.String("outlier_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to update outlier status",
+		})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "conflict",
+			"message": "Outlier status changed concurrently; reload and retry",
+		})
+		return
+	}
+
+	change := models.OutlierStatusChange{
+		ID:         uuid.New().String(),
+		OutlierID:  id,
+		FromStatus: current,
+		ToStatus:   req.Status,
+		ChangedBy:  userID,
+		ChangedAt:  now,
+		Notes:      req.Notes,
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO outlier_status_history (id, outlier_id, org_id, from_status, to_status, changed_by, changed_at, notes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, change.ID, id, orgID, current, req.Status, userID, now, notes); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to record outlier status change",
+			zap.Error(err),
+			zap.String("outlier_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to update outlier status",
+		})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to commit outlier status change",
+			zap.Error(err),
+			zap.String("outlier_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to update outlier status",
+		})
+		return
+	}
+
+	if current == models.OutlierStatusOpen && acknowledged {
+		h.acknowledged(c, id)
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Outlier status changed",
+		zap.String("outlier_id", id),
+		zap.String("from", string(current)),
+		zap.String("to", string(req.Status)),
+		zap.String("user_id", userID))
+
+	c.JSON(http.StatusOK, change)
+}
+
+// GetOutlierStatusHistory returns every status change the caller's
+// organization made to an outlier, oldest first
+func (h *OutlierHandler) GetOutlierStatusHistory(c *gin.Context) {
+	id := c.Param("id")
+	orgID := middleware.GetOrgID(c)
+	ctx := c.Request.Context()
+
+	response := api.OutlierStatusHistoryResponse{
+		OutlierID: id,
+		History:   []models.OutlierStatusChange{},
+	}
+	err := h.db.QueryRowContext(ctx, `
+		SELECT status FROM `+outliersSeenBy("$1")+` WHERE id = $2
+	`, orgID, id).Scan(&response.Status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Outlier not found",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query outlier status",
+			zap.Error(err),
+			zap.String("outlier_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch outlier history",
+		})
+		return
+	}
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, outlier_id, from_status, to_status, changed_by, changed_at, notes
+		FROM outlier_status_history
+		WHERE outlier_id = $1 AND org_id = $2
+		ORDER BY changed_at, id
+	`, id, orgID)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query outlier history",
+			zap.Error(err),
+			zap.String("outlier_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch outlier history",
+		})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var change models.OutlierStatusChange
+		var notes sql.NullString
+		if err := rows.Scan(&change.ID, &change.OutlierID, &change.FromStatus, &change.ToStatus,
+			&change.ChangedBy, &change.ChangedAt, &notes); err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan outlier history row",
+				zap.Error(err))
+			continue
+		}
+		if notes.Valid {
+			if change.Notes, err = h.fields.decrypt(notes.String); err != nil {
+				middleware.RequestLogger(c, h.logger).Error("Failed to decrypt status notes",
+					zap.Error(err),
+					zap.String("outlier_id", id))
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":   "internal_error",
+					"message": "Failed to fetch outlier history",
+				})
+				return
+			}
+		}
+		response.History = append(response.History, change)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AssignOutlier assigns an outlier to a user of its organization to
+// triage, reassigns it, or with no user unassigns it. Each change is
+// audited with the previous and new assignee.
+func (h *OutlierHandler) AssignOutlier(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetString("user_id")
+	orgID := middleware.GetOrgID(c)
+
+	var req api.AssignOutlierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if req.UserID != "" {
+		var active bool
+		err := h.db.QueryRowContext(ctx, `
+			SELECT is_active FROM users WHERE id = $1 AND org_id = $2
+		`, req.UserID, orgID).Scan(&active)
+		if err == sql.ErrNoRows || (err == nil && !active) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": "Assignee must be an active user",
+			})
+			return
+		}
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to query assignee",
+				zap.Error(err),
+				zap.String("assignee", req.UserID))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "internal_error",
+				"message": "Failed to assign outlier",
+			})
+			return
+		}
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to begin outlier assignment",
+			zap.Error(err),
+			zap.String("outlier_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to assign outlier",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var previous sql.NullString
+	err = startTriage(ctx, tx, orgID, id)
+	if err == nil {
+		err = tx.QueryRowContext(ctx, `
+			SELECT assigned_to FROM outlier_triage WHERE outlier_id = $1 AND org_id = $2
+		`, id, orgID).Scan(&previous)
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Outlier not found",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query outlier assignment",
+			zap.Error(err),
+			zap.String("outlier_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to assign outlier",
+		})
+		return
+	}
+
+	assignment := api.OutlierAssignment{
+		OutlierID:        id,
+		AssignedTo:       req.UserID,
+		PreviousAssignee: previous.String,
+		AssignedBy:       userID,
+		AssignedAt:       time.Now(),
+	}
+	assignedTo := sql.NullString{String: req.UserID, Valid: req.UserID != ""}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE outlier_triage
+		SET assigned_to = $1,
+		    assigned_by = $2,
+		    assigned_at = $3
+		WHERE outlier_id = $4 AND org_id = $5
+	`, assignedTo, userID, assignment.AssignedAt, id, orgID); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to assign outlier",
+			zap.Error(err),
+			zap.String("outlier_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to assign outlier",
+		})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to commit outlier assignment",
+			zap.Error(err),
+			zap.String("outlier_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to assign outlier",
+		})
+		return
+	}
+
+	action := "outlier_assigned"
+	switch {
+	case req.UserID == "":
+		action = "outlier_unassigned"
+	case previous.Valid && previous.String != req.UserID:
+		action = "outlier_reassigned"
+	}
+	h.audit(c, action, map[string]interface{}{
+		"outlier_id":        id,
+		"assigned_to":       req.UserID,
+		"previous_assignee": previous.String,
+	})
+
+	middleware.RequestLogger(c, h.logger).Info("Outlier assignment changed",
+		zap.String("outlier_id", id),
+		zap.String("assigned_to", req.UserID),
+		zap.String("previous_assignee", previous.String),
+		zap.String("user_id", userID))
+
+	c.JSON(http.StatusOK, assignment)
+}
+
+// audit records an outlier event with the request ID, if an audit logger
+// is set
+func (h *OutlierHandler) audit(c *gin.Context, action string, details map[string]interface{}) {
+	if h.auditLogger == nil {
+		return
+	}
+	if requestID := middleware.GetRequestID(c); requestID != "" {
+		details["request_id"] = requestID
+	}
+	h.auditLogger.Log(c.GetString("user_id"), action, c.Request.URL.Path, "200", c.ClientIP(), details)
 }
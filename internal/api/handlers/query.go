@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+)
+
+// queryFilter builds a WHERE clause with numbered placeholders. Column
+// names and SQL are always written in code; only values come from the
+// request, and they are always passed as arguments.
+type queryFilter struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg adds value to the arguments and returns its placeholder
+func (f *queryFilter) arg(value interface{}) string {
+	f.args = append(f.args, value)
+	return "$" + strconv.Itoa(len(f.args))
+}
+
+// where adds a condition, built with arg for any values
+func (f *queryFilter) where(condition string) {
+	f.conditions = append(f.conditions, condition)
+}
+
+// equal adds column = value
+func (f *queryFilter) equal(column string, value interface{}) {
+	f.where(column + " = " + f.arg(value))
+}
+
+// in adds column IN (values...), or nothing if there are no values
+func (f *queryFilter) in(column string, values []string) {
+	switch len(values) {
+	case 0:
+		return
+	case 1:
+		f.equal(column, values[0])
+		return
+	}
+
+	placeholders := make([]string, len(values))
+	for i, value := range values {
+		placeholders[i] = f.arg(value)
+	}
+	f.where(column + " IN (" + strings.Join(placeholders, ", ") + ")")
+}
+
+// clause returns the WHERE clause, or "" without conditions
+func (f *queryFilter) clause() string {
+	if len(f.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conditions, " AND ")
+}
+
+// page returns LIMIT and OFFSET for a page, with placeholders following
+// the filter's, and the arguments to run the query with
+func (f *queryFilter) page(page, limit int) (string, []interface{}) {
+	args := append(append([]interface{}{}, f.args...), limit, (page-1)*limit)
+	return " LIMIT $" + strconv.Itoa(len(args)-1) + " OFFSET $" + strconv.Itoa(len(args)), args
+}
+
+// limit returns LIMIT alone, for keyset pagination, and the arguments to
+// run the query with
+func (f *queryFilter) limit(limit int) (string, []interface{}) {
+	args := append(append([]interface{}{}, f.args...), limit)
+	return " LIMIT $" + strconv.Itoa(len(args)), args
+}
+
+// splitValues splits comma-separated values and drops blanks, so a filter
+// accepts ?severity=high,critical as well as ?severity=high&severity=critical
+func splitValues(values []string) []string {
+	var split []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				split = append(split, part)
+			}
+		}
+	}
+	return split
+}
+
+// sortOrder is one way a list may be sorted
+type sortOrder struct {
+	expression string // SQL to sort by, ascending
+	tiebreak   string // Appended after the direction so pages are stable
+}
+
+// orderBy returns the ORDER BY clause for sort, a key from orders with a
+// leading "-" for descending. ok is false for unknown keys, which never
+// reach the SQL.
+func orderBy(sort string, orders map[string]sortOrder) (clause string, ok bool) {
+	direction := " ASC"
+	if strings.HasPrefix(sort, "-") {
+		direction = " DESC"
+		sort = sort[1:]
+	}
+
+	order, ok := orders[sort]
+	if !ok {
+		return "", false
+	}
+	clause = " ORDER BY " + order.expression + direction
+	if order.tiebreak != "" {
+		clause += ", " + order.tiebreak
+	}
+	return clause, true
+}
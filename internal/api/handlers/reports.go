@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/reports"
+	"go.uber.org/zap"
+)
+
+// ReportHandler handles report requests
+type ReportHandler struct {
+	generator    *reports.Generator
+	dashboardURL string
+	logger       *zap.Logger
+}
+
+// NewReportHandler creates a new report handler. HTML reports link to the
+// dashboard at dashboardURL when set.
+func NewReportHandler(generator *reports.Generator, dashboardURL string, logger *zap.Logger) *ReportHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &ReportHandler{
+		generator:    generator,
+		dashboardURL: dashboardURL,
+		logger:       logger,
+	}
+}
+
+// GetDailyReport returns the caller's organization's report for a UTC day,
+// by default yesterday, as JSON, HTML or PDF. Today's report covers the day
+// so far.
+func (h *ReportHandler) GetDailyReport(c *gin.Context) {
+	var req api.DailyReportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid query parameters",
+		})
+		return
+	}
+
+	_, today, _ := reports.Day(time.Now())
+	date := today.AddDate(0, 0, -1)
+	if req.Date != "" {
+		parsed, err := time.Parse(reports.DateLayout, req.Date)
+		if err != nil || parsed.After(today) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": "date must be a day no later than today, as YYYY-MM-DD",
+			})
+			return
+		}
+		date = parsed
+	}
+
+	report, err := h.generator.Daily(c.Request.Context(), middleware.GetOrgID(c), date)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to generate daily report",
+			zap.String("date", date.Format(reports.DateLayout)),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to generate report",
+		})
+		return
+	}
+
+	switch req.Format {
+	case "html":
+		body, err := report.RenderHTML(h.dashboardURL)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to render daily report", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "internal_error",
+				"message": "Failed to render report",
+			})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", body)
+	case "pdf":
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="stablerisk-daily-%s.pdf"`, report.Date))
+		c.Data(http.StatusOK, "application/pdf", report.RenderPDF())
+	default:
+		c.JSON(http.StatusOK, report)
+	}
+}
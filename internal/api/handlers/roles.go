@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// roleNamePattern restricts role names to short lowercase identifiers
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// RoleHandler handles role and permission management requests
+type RoleHandler struct {
+	roles  *security.RoleStore
+	logger *zap.Logger
+}
+
+// NewRoleHandler creates a new role handler
+func NewRoleHandler(roles *security.RoleStore, logger *zap.Logger) *RoleHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &RoleHandler{
+		roles:  roles,
+		logger: logger,
+	}
+}
+
+// ListRoles returns every role with its permissions
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	roles, err := h.roles.ListRoles(c.Request.Context())
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to list roles", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch roles",
+		})
+		return
+	}
+
+	permissions := make([]string, len(middleware.Permissions))
+	for i, permission := range middleware.Permissions {
+		permissions[i] = string(permission)
+	}
+
+	c.JSON(http.StatusOK, api.RoleListResponse{
+		Roles:       roles,
+		Permissions: permissions,
+	})
+}
+
+// GetRole returns a single role by name
+func (h *RoleHandler) GetRole(c *gin.Context) {
+	h.respondRole(c, http.StatusOK, models.Role(c.Param("name")))
+}
+
+// CreateRole creates a custom role
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req api.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+	if !roleNamePattern.MatchString(string(req.Name)) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Role names are 2-32 lowercase letters, digits, '-' or '_', starting with a letter",
+		})
+		return
+	}
+	if !checkPermissions(c, req.Permissions) {
+		return
+	}
+
+	err := h.roles.CreateRole(c.Request.Context(), req.Name, req.Description, req.Permissions)
+	if errors.Is(err, security.ErrRoleExists) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "conflict",
+			"message": "Role already exists",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to create role",
+			zap.Error(err),
+			zap.String("role", string(req.Name)))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to create role",
+		})
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Role created",
+		zap.String("role", string(req.Name)),
+		zap.Strings("permissions", req.Permissions),
+		zap.String("created_by", c.GetString("user_id")))
+
+	h.respondRole(c, http.StatusCreated, req.Name)
+}
+
+// UpdateRole changes a role's description or permissions. The admin
+// role's permissions are fixed.
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	var req api.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	var permissions []string
+	if req.Permissions != nil {
+		if !checkPermissions(c, *req.Permissions) {
+			return
+		}
+		// A non-nil empty slice clears the role's permissions
+		permissions = append([]string{}, *req.Permissions...)
+	}
+
+	name := models.Role(c.Param("name"))
+	err := h.roles.UpdateRole(c.Request.Context(), name, req.Description, permissions)
+	if !h.respondError(c, err, "Failed to update role") {
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Role updated",
+		zap.String("role", string(name)),
+		zap.Strings("permissions", permissions),
+		zap.String("updated_by", c.GetString("user_id")))
+
+	h.respondRole(c, http.StatusOK, name)
+}
+
+// DeleteRole deletes a custom role that no user holds
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	name := models.Role(c.Param("name"))
+	err := h.roles.DeleteRole(c.Request.Context(), name)
+	if !h.respondError(c, err, "Failed to delete role") {
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Role deleted",
+		zap.String("role", string(name)),
+		zap.String("deleted_by", c.GetString("user_id")))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Role deleted",
+	})
+}
+
+// respondRole responds with the named role
+func (h *RoleHandler) respondRole(c *gin.Context, status int, name models.Role) {
+	role, err := h.roles.GetRole(c.Request.Context(), name)
+	if !h.respondError(c, err, "Failed to fetch role") {
+		return
+	}
+
+	c.JSON(status, role)
+}
+
+// respondError maps a role store error to a response, returning true if
+// there was no error
+func (h *RoleHandler) respondError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, security.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Role not found",
+		})
+	case errors.Is(err, security.ErrBuiltInRole):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "conflict",
+			"message": "Built-in roles cannot be deleted and the admin role's permissions cannot change",
+		})
+	case errors.Is(err, security.ErrRoleInUse):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "conflict",
+			"message": "Role is still assigned to users",
+		})
+	default:
+		middleware.RequestLogger(c, h.logger).Error(message,
+			zap.Error(err),
+			zap.String("role", c.Param("name")))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": message,
+		})
+	}
+	return false
+}
+
+// checkPermissions responds 400 and returns false if any permission is
+// unknown
+func checkPermissions(c *gin.Context, permissions []string) bool {
+	for _, permission := range permissions {
+		if !middleware.KnownPermission(permission) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": fmt.Sprintf("Unknown permission %q", permission),
+			})
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/internal/notify"
+	"github.com/mikedewar/stablerisk/internal/reports"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxSAROutliers bounds the outliers a draft lists
+	maxSAROutliers = 500
+	// maxSARTransactions bounds the transactions a draft lists
+	maxSARTransactions = 200
+	// sarActivityMargin widens the flagged activity on both sides when
+	// reading the subject's transactions and graph
+	sarActivityMargin = 24 * time.Hour
+)
+
+// docxContentType is the media type of a Word document
+const docxContentType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+// SARHandler drafts suspicious activity reports for compliance, from
+// outliers, the graph around them and analysts' notes
+type SARHandler struct {
+	db             *sql.DB
+	raphtoryClient *graph.RaphtoryClient
+	outliers       *OutlierHandler // Scans outliers, decrypting their notes
+	auditLogger    *security.AuditLogger
+	logger         *zap.Logger
+}
+
+// NewSARHandler creates a new SAR draft handler
+func NewSARHandler(db *sql.DB, raphtoryClient *graph.RaphtoryClient, outliers *OutlierHandler, logger *zap.Logger) *SARHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &SARHandler{
+		db:             db,
+		raphtoryClient: raphtoryClient,
+		outliers:       outliers,
+		logger:         logger,
+	}
+}
+
+// SetAuditLogger records every exported draft in the audit log
+func (h *SARHandler) SetAuditLogger(auditLogger *security.AuditLogger) {
+	h.auditLogger = auditLogger
+}
+
+// errNothingToReport is returned when a draft would have no outliers
+var errNothingToReport = errors.New("no outliers to report")
+
+// GetSARDraft returns a suspicious activity report draft as PDF, DOCX or
+// JSON, for the incident an outlier belongs to or for every outlier on an
+// address. The draft is still returned while Raphtory is down, listing the
+// transactions and graph snapshot as gaps.
+func (h *SARHandler) GetSARDraft(c *gin.Context) {
+	var req api.SARDraftRequest
+
+	// Set defaults
+	req.Format = "pdf"
+
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid query parameters",
+		})
+		return
+	}
+	if (req.OutlierID == "") == (req.Address == "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Exactly one of outlier_id and address is required",
+		})
+		return
+	}
+
+	draft, err := h.draft(c, req)
+	if errors.Is(err, errNothingToReport) {
+		message := "Outlier not found"
+		if req.Address != "" {
+			message = "No outliers found for the address"
+		}
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": message,
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to draft SAR",
+			zap.Error(err),
+			zap.String("outlier_id", req.OutlierID),
+			zap.String("address", req.Address))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to draft report",
+		})
+		return
+	}
+
+	var body []byte
+	contentType := "application/pdf"
+	switch req.Format {
+	case "docx":
+		contentType = docxContentType
+		body, err = draft.RenderDOCX()
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to render SAR draft", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "internal_error",
+				"message": "Failed to render report",
+			})
+			return
+		}
+	case "pdf":
+		body = draft.RenderPDF()
+	}
+
+	h.audit(c, draft, req.Format)
+	middleware.RequestLogger(c, h.logger).Info("SAR draft exported",
+		zap.String("reference", draft.Reference),
+		zap.String("subject", draft.Subject),
+		zap.Int("outliers", len(draft.Outliers)),
+		zap.String("format", req.Format))
+
+	if body == nil {
+		c.JSON(http.StatusOK, draft)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, draft.Reference, req.Format))
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// draft assembles a draft for the request. It returns errNothingToReport
+// for an unknown outlier or an address without outliers.
+func (h *SARHandler) draft(c *gin.Context, req api.SARDraftRequest) (*reports.SARDraft, error) {
+	orgID := middleware.GetOrgID(c)
+	now := time.Now().UTC()
+	draft := &reports.SARDraft{
+		Reference:   fmt.Sprintf("SAR-%s-%s", now.Format("20060102"), strings.ToUpper(uuid.New().String()[:8])),
+		OrgID:       orgID,
+		Subject:     req.Address,
+		GeneratedAt: now,
+		GeneratedBy: middleware.GetUsername(c),
+	}
+	if draft.GeneratedBy == "" {
+		draft.GeneratedBy = middleware.GetUserID(c)
+	}
+
+	var err error
+	if req.OutlierID != "" {
+		draft.Outliers, err = h.incidentOutliers(c, orgID, req.OutlierID)
+		if err != nil {
+			return nil, err
+		}
+		draft.Subject = draft.Outliers[0].Address
+		draft.IncidentKey = notify.IncidentKey(draft.Outliers[0])
+	} else {
+		draft.Outliers, err = h.queryOutliers(c, `
+			SELECT `+outlierColumns+` FROM `+outliersSeenBy("$1")+`
+			WHERE address = $2 AND invalidated = false
+			ORDER BY detected_at, id
+			LIMIT $3
+		`, orgID, req.Address, maxSAROutliers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query address outliers: %w", err)
+		}
+		if len(draft.Outliers) == 0 {
+			return nil, errNothingToReport
+		}
+	}
+	if len(draft.Outliers) == maxSAROutliers {
+		draft.Gaps = append(draft.Gaps, fmt.Sprintf("Only the first %d outliers are listed.", maxSAROutliers))
+	}
+	draft.ActivityFrom = draft.Outliers[0].DetectedAt.UTC()
+	draft.ActivityTo = draft.Outliers[len(draft.Outliers)-1].DetectedAt.UTC()
+
+	if draft.Notes, err = h.notes(c, orgID, draft.Outliers); err != nil {
+		return nil, fmt.Errorf("failed to collect analyst notes: %w", err)
+	}
+	if err := h.graphSnapshot(c, draft); err != nil {
+		return nil, err
+	}
+
+	draft.Narrate()
+	return draft, nil
+}
+
+// incidentOutliers returns the outliers of the incident an outlier belongs
+// to: those its organization sees of the same type on the same address, as
+// alerts group them, oldest first. An outlier without an address, or one
+// since invalidated, is an incident of its own.
+func (h *SARHandler) incidentOutliers(c *gin.Context, orgID, id string) ([]models.Outlier, error) {
+	outlier, err := h.outliers.scanOutlier(c, h.db.QueryRowContext(c.Request.Context(),
+		`SELECT `+outlierColumns+` FROM `+outliersSeenBy("$1")+` WHERE id = $2`, orgID, id))
+	if err == sql.ErrNoRows {
+		return nil, errNothingToReport
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outlier: %w", err)
+	}
+	if outlier.Address == "" || outlier.Invalidated {
+		return []models.Outlier{*outlier}, nil
+	}
+
+	outliers, err := h.queryOutliers(c, `
+		SELECT `+outlierColumns+` FROM `+outliersSeenBy("$1")+`
+		WHERE address = $2 AND type = $3 AND invalidated = false
+		ORDER BY detected_at, id
+		LIMIT $4
+	`, orgID, outlier.Address, outlier.Type, maxSAROutliers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incident outliers: %w", err)
+	}
+	return outliers, nil
+}
+
+// queryOutliers scans the outliers a query of outlierColumns returns
+func (h *SARHandler) queryOutliers(c *gin.Context, query string, args ...interface{}) ([]models.Outlier, error) {
+	rows, err := h.db.QueryContext(c.Request.Context(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var outliers []models.Outlier
+	for rows.Next() {
+		outlier, err := h.outliers.scanOutlier(c, rows)
+		if err != nil {
+			return nil, err
+		}
+		outliers = append(outliers, *outlier)
+	}
+	return outliers, rows.Err()
+}
+
+// notes collects the notes orgID's analysts left on the outliers when
+// acknowledging them or changing their status, oldest first
+func (h *SARHandler) notes(c *gin.Context, orgID string, outliers []models.Outlier) ([]reports.SARNote, error) {
+	notes := []reports.SARNote{}
+	placeholders := make([]string, len(outliers))
+	args := []interface{}{orgID}
+	for i, outlier := range outliers {
+		if outlier.Notes != "" {
+			notes = append(notes, reports.SARNote{
+				OutlierID: outlier.ID,
+				Author:    outlier.AcknowledgedBy,
+				At:        outlier.AcknowledgedAt,
+				Text:      outlier.Notes,
+			})
+		}
+		args = append(args, outlier.ID)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+
+	rows, err := h.db.QueryContext(c.Request.Context(), `
+		SELECT outlier_id, changed_by, changed_at, notes
+		FROM outlier_status_history
+		WHERE org_id = $1 AND outlier_id IN (`+strings.Join(placeholders, ", ")+`) AND notes IS NOT NULL
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var note reports.SARNote
+		var encrypted string
+		if err := rows.Scan(&note.OutlierID, &note.Author, &note.At, &encrypted); err != nil {
+			return nil, err
+		}
+		if note.Text, err = h.outliers.fields.decrypt(encrypted); err != nil {
+			return nil, fmt.Errorf("failed to decrypt status notes of outlier %s: %w", note.OutlierID, err)
+		}
+		if note.Text != "" {
+			notes = append(notes, note)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].At.Before(notes[j].At)
+	})
+	return notes, nil
+}
+
+// graphSnapshot fills in the subject's transactions and direct
+// counterparties around the flagged activity. Sections Raphtory cannot
+// provide are listed as gaps rather than failing the draft.
+func (h *SARHandler) graphSnapshot(c *gin.Context, draft *reports.SARDraft) error {
+	draft.Transactions = []models.Transaction{}
+	draft.Counterparties = []reports.SARCounterparty{}
+	draft.Flows = []reports.SARFlow{}
+	if draft.Subject == "" {
+		draft.Gaps = append(draft.Gaps, "The outlier has no address, so no transactions or graph snapshot are included.")
+		return nil
+	}
+
+	ctx := c.Request.Context()
+	window := graph.Window{
+		Start: draft.ActivityFrom.Add(-sarActivityMargin),
+		End:   draft.ActivityTo.Add(sarActivityMargin),
+	}
+
+	page, err := h.raphtoryClient.QueryTransactions(ctx, graph.TransactionQuery{
+		Window:  window,
+		Address: draft.Subject,
+		Limit:   maxSARTransactions,
+	})
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Warn("Failed to get transactions from Raphtory, SAR draft will omit them",
+			zap.Error(err),
+			zap.String("address", draft.Subject))
+		draft.Gaps = append(draft.Gaps, "Transactions could not be read from the graph.")
+	} else {
+		draft.Transactions = page.Transactions
+		if page.Total > len(page.Transactions) {
+			draft.Gaps = append(draft.Gaps, fmt.Sprintf("Only the newest %d of %d transactions are listed.",
+				len(page.Transactions), page.Total))
+		}
+	}
+
+	subgraph, err := h.raphtoryClient.GetSubgraph(ctx, draft.Subject, 1, window)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Warn("Failed to get subgraph from Raphtory, SAR draft will omit it",
+			zap.Error(err),
+			zap.String("address", draft.Subject))
+		draft.Gaps = append(draft.Gaps, "The graph snapshot could not be read from the graph.")
+		return nil
+	}
+
+	var addresses []string
+	for _, node := range subgraph.Nodes {
+		if node.Hop == 1 {
+			addresses = append(addresses, node.Address)
+		}
+	}
+	risks, err := addressRisks(ctx, h.db, draft.OrgID, addresses)
+	if err != nil {
+		return fmt.Errorf("failed to query counterparty risk: %w", err)
+	}
+
+	for _, node := range subgraph.Nodes {
+		if node.Hop != 1 {
+			continue
+		}
+		risk := risks[node.Address]
+		draft.Counterparties = append(draft.Counterparties, reports.SARCounterparty{
+			Address:          node.Address,
+			TransactionCount: node.TransactionCount,
+			Sent:             node.Sent,
+			Received:         node.Received,
+			Outliers:         risk.count,
+			HighestSeverity:  risk.maxSeverity,
+		})
+	}
+	sort.Slice(draft.Counterparties, func(i, j int) bool {
+		ci, cj := draft.Counterparties[i], draft.Counterparties[j]
+		if ci.TransactionCount != cj.TransactionCount {
+			return ci.TransactionCount > cj.TransactionCount
+		}
+		return ci.Address < cj.Address
+	})
+
+	for _, edge := range subgraph.Edges {
+		draft.Flows = append(draft.Flows, reports.SARFlow{
+			From:             edge.From,
+			To:               edge.To,
+			TransactionCount: edge.TransactionCount,
+			Amount:           edge.Amount,
+		})
+	}
+	draft.GraphTruncated = subgraph.Truncated
+	return nil
+}
+
+// audit records an exported draft, if an audit logger is set
+func (h *SARHandler) audit(c *gin.Context, draft *reports.SARDraft, format string) {
+	if h.auditLogger == nil {
+		return
+	}
+	details := map[string]interface{}{
+		"reference": draft.Reference,
+		"subject":   draft.Subject,
+		"outliers":  len(draft.Outliers),
+		"format":    format,
+	}
+	if draft.IncidentKey != "" {
+		details["incident_key"] = draft.IncidentKey
+	}
+	if requestID := middleware.GetRequestID(c); requestID != "" {
+		details["request_id"] = requestID
+	}
+	h.auditLogger.Log(c.GetString("user_id"), "sar_draft_exported", c.Request.URL.Path, "200", c.ClientIP(), details)
+}
@@ -5,10 +5,12 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
 	"github.com/mikedewar/stablerisk/internal/graph"
 	"github.com/mikedewar/stablerisk/pkg/models"
 	"go.uber.org/zap"
@@ -34,29 +36,80 @@ func NewStatisticsHandler(db *sql.DB, raphtoryClient *graph.RaphtoryClient, logg
 	}
 }
 
+// Statistics windows and defaults
+const (
+	defaultActivityWindow = 24 * time.Hour
+	maxActivityWindow     = 30 * 24 * time.Hour
+	defaultTopAddresses   = 10
+)
+
 // GetStatistics returns overall statistics
 func (h *StatisticsHandler) GetStatistics(c *gin.Context) {
+	var req api.StatisticsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid query parameters",
+		})
+		return
+	}
+
+	window, err := activityWindow(req.Window)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": err.Error(),
+		})
+		return
+	}
+	if req.Top == 0 {
+		req.Top = defaultTopAddresses
+	}
+
+	jsonWithETag(c, h.statistics(c, window, req.Top), h.logger)
+}
+
+// activityWindow parses a recent activity window, defaulting to 24 hours
+func activityWindow(s string) (time.Duration, error) {
+	if s == "" {
+		return defaultActivityWindow, nil
+	}
+	window, err := time.ParseDuration(s)
+	if err != nil || window < time.Minute || window > maxActivityWindow {
+		return 0, fmt.Errorf("window must be a duration between 1m and %s, e.g. 1h or 24h", maxActivityWindow)
+	}
+	return window, nil
+}
+
+// statistics gathers overall statistics, with activity over the window
+// ending at the current minute and its top addresses by volume. Parts
+// that cannot be read are logged and left out rather than failing the
+// whole summary.
+func (h *StatisticsHandler) statistics(c *gin.Context, window time.Duration, top int) api.StatisticsResponse {
 	stats := api.StatisticsResponse{
 		OutliersBySeverity: make(map[models.Severity]int64),
 		OutliersByType:     make(map[models.OutlierType]int64),
 	}
 
-	// Note: In a real implementation, we would query a transactions table
-	// For now, we'll return placeholder values or query outliers
+	// Outlier counts cover the outliers the caller's organization sees
+	orgID := middleware.GetOrgID(c)
 
 	// Total outliers
-	err := h.db.QueryRow(`SELECT COUNT(*) FROM outliers`).Scan(&stats.TotalOutliers)
+	err := h.db.QueryRowContext(c.Request.Context(), `
+		SELECT COUNT(*) FROM outliers WHERE `+visibleOutliers("$1")+`
+	`, orgID).Scan(&stats.TotalOutliers)
 	if err != nil && err != sql.ErrNoRows {
-		h.logger.Error("Failed to count outliers",
+		middleware.RequestLogger(c, h.logger).Error("Failed to count outliers",
 			zap.Error(err))
 	}
 
 	// Outliers by severity
-	rows, err := h.db.Query(`
+	rows, err := h.db.QueryContext(c.Request.Context(), `
 		SELECT severity, COUNT(*)
 		FROM outliers
+		WHERE `+visibleOutliers("$1")+`
 		GROUP BY severity
-	`)
+	`, orgID)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
@@ -69,11 +122,12 @@ func (h *StatisticsHandler) GetStatistics(c *gin.Context) {
 	}
 
 	// Outliers by type
-	rows, err = h.db.Query(`
+	rows, err = h.db.QueryContext(c.Request.Context(), `
 		SELECT type, COUNT(*)
 		FROM outliers
+		WHERE `+visibleOutliers("$1")+`
 		GROUP BY type
-	`)
+	`, orgID)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
@@ -85,65 +139,145 @@ func (h *StatisticsHandler) GetStatistics(c *gin.Context) {
 		}
 	}
 
-	// Last detection run
-	// This would typically come from a detection_runs table
-	// For now, use the most recent outlier timestamp
+	// Last detection run and whether a cycle is currently in progress.
+	// Runs left 'running' for over an hour were interrupted and are ignored.
 	var lastDetection sql.NullTime
-	err = h.db.QueryRow(`
-		SELECT MAX(detected_at) FROM outliers
+	err = h.db.QueryRowContext(c.Request.Context(), `
+		SELECT MAX(completed_at) FROM detection_runs WHERE status = 'completed'
 	`).Scan(&lastDetection)
-	if err == nil && lastDetection.Valid {
-		stats.LastDetectionRun = lastDetection.Time
-	} else {
-		stats.LastDetectionRun = time.Now()
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to get last detection run",
+			zap.Error(err))
+	} else if lastDetection.Valid {
+		stats.LastDetectionRun = &lastDetection.Time
 	}
 
-	// Detection running status
-	// This would typically come from a monitoring system
-	stats.DetectionRunning = true
+	err = h.db.QueryRowContext(c.Request.Context(), `
+		SELECT EXISTS (
+			SELECT 1 FROM detection_runs
+			WHERE status = 'running' AND started_at >= $1
+		)
+	`, time.Now().Add(-1*time.Hour)).Scan(&stats.DetectionRunning)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to get detection running status",
+			zap.Error(err))
+	}
 
-	// Get total transactions from Raphtory
+	// Transaction totals come from the Raphtory graph; without it the
+	// graph summary is left out so clients can tell "unknown" from zero
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	graphStats, err := h.raphtoryClient.GetStatistics(ctx)
 	if err != nil {
-		h.logger.Warn("Failed to get Raphtory statistics, returning 0 transactions",
+		middleware.RequestLogger(c, h.logger).Warn("Failed to get Raphtory statistics, omitting graph summary",
 			zap.Error(err))
-		stats.TotalTransactions = 0
 	} else {
 		stats.TotalTransactions = graphStats.TransactionCount
+		stats.Graph = &api.GraphStats{
+			NodeCount:           graphStats.NodeCount,
+			EdgeCount:           graphStats.EdgeCount,
+			EarliestTransaction: graphTime(graphStats.EarliestTime),
+			LatestTransaction:   graphTime(graphStats.LatestTime),
+		}
+
+		activity, err := h.activity(ctx, window, top)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Warn("Failed to get Raphtory address activity, omitting activity summary",
+				zap.Error(err))
+		} else {
+			stats.Activity = activity
+		}
 	}
 
-	c.JSON(http.StatusOK, stats)
+	return stats
 }
 
-// GetOutlierTrends returns outlier trends over time
-func (h *StatisticsHandler) GetOutlierTrends(c *gin.Context) {
-	// Query parameters for time range
-	daysStr := c.DefaultQuery("days", "7")
+// activity summarises the transfers in the window ending at the current
+// minute from Raphtory's per-address aggregates. Each transfer is received
+// by exactly one address, so received counts sum to the window's
+// transactions. Ending on the minute keeps the summary, and so its ETag,
+// the same for dashboards polling within a minute.
+func (h *StatisticsHandler) activity(ctx context.Context, window time.Duration, top int) (*api.ActivityStats, error) {
+	end := time.Now().UTC().Truncate(time.Minute)
+	start := end.Add(-window)
+	addresses, err := h.raphtoryClient.GetAddressActivity(ctx, graph.Window{Start: start, End: end}, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	activity := &api.ActivityStats{
+		Window:          window.String(),
+		Start:           start,
+		End:             end,
+		ActiveAddresses: len(addresses),
+		TopAddresses:    make([]api.AddressVolume, 0, top),
+	}
+	volumes := make([]api.AddressVolume, len(addresses))
+	for i, address := range addresses {
+		activity.TransactionCount += int64(address.InCount)
+		activity.Volume = activity.Volume.Add(address.Received)
+		volumes[i] = api.AddressVolume{
+			Address:          address.Address,
+			TransactionCount: address.TransactionCount(),
+			Sent:             address.Sent,
+			Received:         address.Received,
+			Volume:           address.Sent.Add(address.Received),
+		}
+	}
+	activity.TransactionsPerSecond = float64(activity.TransactionCount) / window.Seconds()
+
+	// Addresses come ordered by address, so ties keep a stable order
+	sort.SliceStable(volumes, func(i, j int) bool {
+		return volumes[i].Volume.GreaterThan(volumes[j].Volume)
+	})
+	if len(volumes) > top {
+		volumes = volumes[:top]
+	}
+	activity.TopAddresses = append(activity.TopAddresses, volumes...)
+	return activity, nil
+}
 
-	var days int
-	if _, err := fmt.Sscanf(daysStr, "%d", &days); err != nil || days < 1 || days > 90 {
-		days = 7
+// graphTime converts a Raphtory Unix timestamp, where zero means the graph
+// is empty
+func graphTime(unix int64) *time.Time {
+	if unix == 0 {
+		return nil
+	}
+	t := time.Unix(unix, 0).UTC()
+	return &t
+}
+
+// GetOutlierTrends returns outlier counts by severity and type over the
+// last days, bucketed by hour, day, week or month
+func (h *StatisticsHandler) GetOutlierTrends(c *gin.Context) {
+	var req api.OutlierTrendsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "days must be between 1 and 90, and granularity hour, day, week or month",
+		})
+		return
+	}
+	if req.Days == 0 {
+		req.Days = 7
+	}
+	if req.Granularity == "" {
+		req.Granularity = "day"
 	}
 
-	startTime := time.Now().AddDate(0, 0, -days)
+	end := time.Now().UTC()
+	start := trendBucket(end.AddDate(0, 0, -req.Days), req.Granularity)
 
-	// Query outliers grouped by day
-	rows, err := h.db.Query(`
-		SELECT
-			DATE(detected_at) as date,
-			severity,
-			COUNT(*) as count
+	// Outliers are bucketed here rather than in SQL so buckets are UTC
+	// whatever the database's time zone, and weeks start on Monday
+	rows, err := h.db.QueryContext(c.Request.Context(), `
+		SELECT detected_at, severity, type
 		FROM outliers
-		WHERE detected_at >= $1
-		GROUP BY DATE(detected_at), severity
-		ORDER BY date DESC
-	`, startTime)
-
+		WHERE `+visibleOutliers("$1")+` AND detected_at >= $2 AND detected_at <= $3
+	`, middleware.GetOrgID(c), start, end)
 	if err != nil {
-		h.logger.Error("Failed to query outlier trends",
+		middleware.RequestLogger(c, h.logger).Error("Failed to query outlier trends",
 			zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "internal_error",
@@ -153,44 +287,107 @@ func (h *StatisticsHandler) GetOutlierTrends(c *gin.Context) {
 	}
 	defer rows.Close()
 
-	type DailyStats struct {
-		Date     string                       `json:"date"`
-		Severity map[models.Severity]int64    `json:"severity"`
+	// Every bucket from start to now, so charts have no gaps
+	var trends []api.OutlierTrend
+	index := make(map[time.Time]int)
+	for t := start; !t.After(end); t = nextTrendBucket(t, req.Granularity) {
+		index[t] = len(trends)
+		trends = append(trends, api.OutlierTrend{
+			Date:  trendDate(t, req.Granularity),
+			Start: t,
+			Severity: map[models.Severity]int64{
+				models.SeverityLow: 0, models.SeverityMedium: 0, models.SeverityHigh: 0, models.SeverityCritical: 0,
+			},
+			Type: make(map[models.OutlierType]int64),
+		})
 	}
-
-	statsMap := make(map[string]*DailyStats)
-
+	types := make(map[models.OutlierType]bool)
 	for rows.Next() {
-		var date time.Time
+		var detectedAt time.Time
 		var severity models.Severity
-		var count int64
+		var outlierType models.OutlierType
+		if err := rows.Scan(&detectedAt, &severity, &outlierType); err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan outlier trend",
+				zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "internal_error",
+				"message": "Failed to fetch trends",
+			})
+			return
+		}
 
-		if err := rows.Scan(&date, &severity, &count); err != nil {
+		i, ok := index[trendBucket(detectedAt, req.Granularity)]
+		if !ok {
 			continue
 		}
+		trends[i].Total++
+		trends[i].Severity[severity]++
+		trends[i].Type[outlierType]++
+		types[outlierType] = true
+	}
+	if err := rows.Err(); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to read outlier trends",
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch trends",
+		})
+		return
+	}
 
-		dateStr := date.Format("2006-01-02")
-		if _, ok := statsMap[dateStr]; !ok {
-			statsMap[dateStr] = &DailyStats{
-				Date:     dateStr,
-				Severity: make(map[models.Severity]int64),
+	for i := range trends {
+		for outlierType := range types {
+			if _, ok := trends[i].Type[outlierType]; !ok {
+				trends[i].Type[outlierType] = 0
 			}
 		}
-		statsMap[dateStr].Severity[severity] = count
-	}
-
-	// Convert map to slice
-	trends := make([]DailyStats, 0, len(statsMap))
-	for _, stats := range statsMap {
-		trends = append(trends, *stats)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"trends": trends,
-		"period": gin.H{
-			"start": startTime.Format(time.RFC3339),
-			"end":   time.Now().Format(time.RFC3339),
-			"days":  days,
+	c.JSON(http.StatusOK, api.OutlierTrendsResponse{
+		Trends: trends,
+		Period: api.TrendPeriod{
+			Start:       start,
+			End:         end,
+			Days:        req.Days,
+			Granularity: req.Granularity,
 		},
 	})
 }
+
+// trendBucket returns the start of the UTC bucket holding t
+func trendBucket(t time.Time, granularity string) time.Time {
+	t = t.UTC()
+	switch granularity {
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "week":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// nextTrendBucket returns the start of the bucket after the one starting at t
+func nextTrendBucket(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case "hour":
+		return t.Add(time.Hour)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// trendDate formats a bucket start as its trend's date
+func trendDate(t time.Time, granularity string) string {
+	if granularity == "hour" {
+		return t.Format("2006-01-02T15:04Z")
+	}
+	return t.Format("2006-01-02")
+}
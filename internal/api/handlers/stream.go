@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ndjsonContentType is newline-delimited JSON, one value per line
+	ndjsonContentType = "application/x-ndjson"
+
+	// ndjsonFlushEvery is how many rows are written between flushes
+	ndjsonFlushEvery = 100
+
+	// ndjsonWriteTimeout is how long a client may take to read between
+	// flushes. Each flush extends the server's write deadline by this much,
+	// so a stream may run as long as the client keeps reading.
+	ndjsonWriteTimeout = 30 * time.Second
+)
+
+// wantsStream reports whether a list request asked for every matching row
+// as NDJSON instead of a page, with Accept: application/x-ndjson or
+// ?stream=true
+func wantsStream(c *gin.Context) bool {
+	if c.Query("stream") == "true" {
+		return true
+	}
+	for _, accept := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(accept, ";", 2)[0])
+		if strings.EqualFold(mediaType, ndjsonContentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// ndjsonWriter streams rows to the client as they are scanned, so result
+// sets of any size are sent without holding them in memory
+type ndjsonWriter struct {
+	c          *gin.Context
+	controller *http.ResponseController
+	encoder    *json.Encoder
+	written    int
+}
+
+// newNDJSONWriter sends the response headers and returns a writer for the
+// rows
+func newNDJSONWriter(c *gin.Context) *ndjsonWriter {
+	w := &ndjsonWriter{
+		c:          c,
+		controller: http.NewResponseController(c.Writer),
+		encoder:    json.NewEncoder(c.Writer),
+	}
+	c.Header("Content-Type", ndjsonContentType)
+	// Stop proxies such as nginx buffering the whole stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	w.extendDeadline()
+	return w
+}
+
+// write writes one row. An error means the client has gone and the stream
+// should stop.
+func (w *ndjsonWriter) write(row interface{}) error {
+	if err := w.encoder.Encode(row); err != nil {
+		return err
+	}
+	w.written++
+	if w.written%ndjsonFlushEvery == 0 {
+		w.flush()
+	}
+	return nil
+}
+
+// fail ends the stream with an error line, since the status code has
+// already been sent, so the client can tell the stream was cut short
+func (w *ndjsonWriter) fail(message string) {
+	w.encoder.Encode(gin.H{
+		"error":   "internal_error",
+		"message": message,
+	})
+	w.flush()
+}
+
+// flush sends buffered rows to the client
+func (w *ndjsonWriter) flush() {
+	w.c.Writer.Flush()
+	w.extendDeadline()
+}
+
+// extendDeadline moves the write deadline past the next flush. Writers that
+// cannot set deadlines, such as test recorders, are left as they are.
+func (w *ndjsonWriter) extendDeadline() {
+	w.controller.SetWriteDeadline(time.Now().Add(ndjsonWriteTimeout))
+}
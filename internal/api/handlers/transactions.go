@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"go.uber.org/zap"
+)
+
+// TransactionHandler handles transaction requests, read from Raphtory
+type TransactionHandler struct {
+	raphtoryClient *graph.RaphtoryClient
+	db             *sql.DB // Address labels, when set
+	logger         *zap.Logger
+}
+
+// NewTransactionHandler creates a new transaction handler
+func NewTransactionHandler(raphtoryClient *graph.RaphtoryClient, logger *zap.Logger) *TransactionHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &TransactionHandler{
+		raphtoryClient: raphtoryClient,
+		logger:         logger,
+	}
+}
+
+// SetAddressLabels labels the senders and receivers of listed transactions
+// from the address_labels table in db
+func (h *TransactionHandler) SetAddressLabels(db *sql.DB) {
+	h.db = db
+}
+
+// ListTransactions returns a page of transactions, newest first, filtered
+// by time window, address and amount
+func (h *TransactionHandler) ListTransactions(c *gin.Context) {
+	var req api.TransactionListRequest
+
+	// Set defaults
+	req.Page = 1
+	req.Limit = 50
+
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid query parameters",
+		})
+		return
+	}
+	if req.From != nil && req.To != nil && !req.From.Before(*req.To) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "from must be before to",
+		})
+		return
+	}
+
+	minAmount, maxAmount, err := parseAmountRange(req.MinAmount, req.MaxAmount)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	query := graph.TransactionQuery{
+		Address:   req.Address,
+		MinAmount: minAmount,
+		MaxAmount: maxAmount,
+		Limit:     req.Limit,
+		Offset:    (req.Page - 1) * req.Limit,
+	}
+	if req.From != nil {
+		query.Window.Start = *req.From
+	}
+	if req.To != nil {
+		query.Window.End = *req.To
+	}
+
+	page, err := h.raphtoryClient.QueryTransactions(c.Request.Context(), query)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query transactions from Raphtory",
+			zap.Error(err))
+		h.graphError(c, err, "Failed to fetch transactions")
+		return
+	}
+
+	resp := api.TransactionListResponse{
+		Transactions: page.Transactions,
+		Total:        page.Total,
+		Page:         req.Page,
+		Limit:        req.Limit,
+		TotalPages:   int(math.Ceil(float64(page.Total) / float64(req.Limit))),
+	}
+
+	if h.db != nil && len(page.Transactions) > 0 {
+		addresses := make([]string, 0, 2*len(page.Transactions))
+		for _, tx := range page.Transactions {
+			addresses = append(addresses, tx.From, tx.To)
+		}
+		// Labels are best effort; the transactions are still returned
+		labels, err := addressLabels(c.Request.Context(), h.db, addresses)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Warn("Failed to fetch address labels", zap.Error(err))
+		} else if len(labels) > 0 {
+			resp.Labels = labels
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetTransaction returns a single transaction by hash
+func (h *TransactionHandler) GetTransaction(c *gin.Context) {
+	hash := c.Param("hash")
+
+	tx, err := h.raphtoryClient.GetTransaction(c.Request.Context(), hash)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to get transaction from Raphtory",
+			zap.Error(err),
+			zap.String("tx_hash", hash))
+		h.graphError(c, err, "Failed to fetch transaction")
+		return
+	}
+	if tx == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Transaction not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tx)
+}
+
+// graphError responds to a failed Raphtory request: 503 while Raphtory is
+// unreachable, 501 for a query its transport cannot make, otherwise 500
+func (h *TransactionHandler) graphError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, graph.ErrRaphtoryUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "service_unavailable",
+			"message": "Graph service unavailable",
+		})
+	case errors.Is(err, graph.ErrRaphtoryUnsupported):
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error":   "not_implemented",
+			"message": "Not supported by the configured graph transport",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": message,
+		})
+	}
+}
@@ -0,0 +1,618 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/internal/security/crypto"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// userColumns are the users columns scanned by scanUser
+const userColumns = `id, org_id, username, COALESCE(email, ''), role, created_at, updated_at, last_login, is_active`
+
+// UserHandler handles user management requests
+type UserHandler struct {
+	db              *sql.DB
+	passwordManager *security.PasswordManager
+	fields          fieldCipher
+	logger          *zap.Logger
+}
+
+// NewUserHandler creates a new user handler
+func NewUserHandler(db *sql.DB, passwordManager *security.PasswordManager, logger *zap.Logger) *UserHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &UserHandler{
+		db:              db,
+		passwordManager: passwordManager,
+		logger:          logger,
+	}
+}
+
+// SetCipher encrypts user emails at rest. Emails are then kept unique by
+// their blind index rather than by the email column.
+func (h *UserHandler) SetCipher(cipher *crypto.Cipher) {
+	h.fields = fieldCipher{cipher: cipher}
+}
+
+// ListUsers returns a paginated list of the caller's organization's users,
+// optionally filtered by role and active status
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	req := api.UserListRequest{Page: 1, Limit: 50}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid query parameters",
+		})
+		return
+	}
+
+	where := ` WHERE org_id = $1`
+	args := []interface{}{middleware.GetOrgID(c)}
+	if req.Role != "" {
+		args = append(args, req.Role)
+		where += fmt.Sprintf(` AND role = $%d`, len(args))
+	}
+	if req.Active != nil {
+		args = append(args, *req.Active)
+		where += fmt.Sprintf(` AND is_active = $%d`, len(args))
+	}
+
+	var total int
+	if err := h.db.QueryRowContext(c.Request.Context(), `SELECT COUNT(*) FROM users`+where, args...).Scan(&total); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to count users", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch users",
+		})
+		return
+	}
+
+	query := `SELECT ` + userColumns + ` FROM users` + where +
+		fmt.Sprintf(` ORDER BY username LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2)
+	args = append(args, req.Limit, (req.Page-1)*req.Limit)
+
+	rows, err := h.db.QueryContext(c.Request.Context(), query, args...)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query users", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch users",
+		})
+		return
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows, h.fields)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan user", zap.Error(err))
+			continue
+		}
+		users = append(users, *user)
+	}
+
+	c.JSON(http.StatusOK, api.UserListResponse{
+		Users:      users,
+		Total:      total,
+		Page:       req.Page,
+		Limit:      req.Limit,
+		TotalPages: int(math.Ceil(float64(total) / float64(req.Limit))),
+	})
+}
+
+// GetUser returns a single user by ID
+func (h *UserHandler) GetUser(c *gin.Context) {
+	user, err := h.getUser(c.Request.Context(), middleware.GetOrgID(c), c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "User not found",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to fetch user",
+			zap.Error(err),
+			zap.String("user_id", c.Param("id")))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch user",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// CreateUser creates a user whose password meets the password policy
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	var req api.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	if !h.checkRole(c, req.Role) {
+		return
+	}
+	orgID, ok := h.targetOrg(c, req.OrgID)
+	if !ok {
+		return
+	}
+
+	passwordHash, err := h.passwordManager.Hash(req.Password)
+	if errors.Is(err, security.ErrPasswordTooShort) || errors.Is(err, security.ErrPasswordTooLong) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to hash password", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to create user",
+		})
+		return
+	}
+
+	// Emails are optional but unique, so a missing one is stored as NULL
+	email, err := h.fields.encrypt(req.Email)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to encrypt email", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to create user",
+		})
+		return
+	}
+
+	id := uuid.New().String()
+	result, err := h.db.ExecContext(c.Request.Context(), `
+		INSERT INTO users (id, org_id, username, email, email_hash, password_hash, role, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, true)
+		ON CONFLICT DO NOTHING
+	`, id, orgID, req.Username, email, h.fields.index(req.Email), passwordHash, req.Role)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to create user",
+			zap.Error(err),
+			zap.String("username", req.Username))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to create user",
+		})
+		return
+	}
+	if created, err := result.RowsAffected(); err == nil && created == 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "conflict",
+			"message": "Username or email already in use",
+		})
+		return
+	}
+
+	user, err := h.getUser(c.Request.Context(), orgID, id)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to fetch created user",
+			zap.Error(err),
+			zap.String("user_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch created user",
+		})
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("User created",
+		zap.String("user_id", user.ID),
+		zap.String("username", user.Username),
+		zap.String("role", string(user.Role)),
+		zap.String("org_id", user.OrgID),
+		zap.String("created_by", c.GetString("user_id")))
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// UpdateUser changes a user's email, role or active status
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	var req api.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	h.update(c, req)
+}
+
+// DeleteUser deactivates a user. Rows are kept so audit logs and outlier
+// acknowledgements still resolve to a user.
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	inactive := false
+	h.update(c, api.UpdateUserRequest{IsActive: &inactive})
+}
+
+// IssuePasswordReset issues a one-time token with which an active user can
+// set a new password through /auth/password/reset. Earlier unused tokens
+// for the user are revoked. The user's current password keeps working
+// until the token is redeemed. Callers cannot issue tokens for users whose
+// role grants permissions they lack.
+func (h *UserHandler) IssuePasswordReset(c *gin.Context) {
+	id := c.Param("id")
+	ctx := c.Request.Context()
+
+	user, err := h.getUser(ctx, middleware.GetOrgID(c), id)
+	if err == sql.ErrNoRows || (err == nil && !user.IsActive) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Active user not found",
+		})
+		return
+	}
+	fail := func(err error) {
+		middleware.RequestLogger(c, h.logger).Error("Failed to issue password reset",
+			zap.Error(err),
+			zap.String("user_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to issue password reset",
+		})
+	}
+	if err != nil {
+		fail(err)
+		return
+	}
+	if !h.checkTarget(c, user) {
+		return
+	}
+
+	token, tokenHash, expiresAt, err := h.passwordManager.GenerateResetToken()
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	var createdBy sql.NullString
+	if issuer := c.GetString("user_id"); issuer != "" {
+		createdBy = sql.NullString{String: issuer, Valid: true}
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE password_reset_tokens SET used_at = $1 WHERE user_id = $2 AND used_at IS NULL
+	`, now, id); err != nil {
+		fail(err)
+		return
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO password_reset_tokens (id, user_id, token_hash, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, uuid.New().String(), id, tokenHash, createdBy, now, expiresAt.UTC()); err != nil {
+		fail(err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		fail(err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Password reset issued",
+		zap.String("user_id", id),
+		zap.String("issued_by", createdBy.String),
+		zap.Time("expires_at", expiresAt))
+
+	c.JSON(http.StatusCreated, api.PasswordResetResponse{
+		UserID:     id,
+		ResetToken: token,
+		ExpiresAt:  expiresAt,
+	})
+}
+
+// update applies req to the user named in the path and responds with the
+// result. It refuses email, role and status changes to users whose role
+// grants permissions the caller lacks, and changes that would leave the user's
+// organization with no active admin.
+func (h *UserHandler) update(c *gin.Context, req api.UpdateUserRequest) {
+	id := c.Param("id")
+	orgID := middleware.GetOrgID(c)
+	ctx := c.Request.Context()
+
+	user, err := h.getUser(ctx, orgID, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "User not found",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to fetch user",
+			zap.Error(err),
+			zap.String("user_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to update user",
+		})
+		return
+	}
+	if (req.Email != nil || req.Role != nil || req.IsActive != nil) && !h.checkTarget(c, user) {
+		return
+	}
+	if req.Role != nil && !h.checkRole(c, *req.Role) {
+		return
+	}
+
+	set := `updated_at = CURRENT_TIMESTAMP`
+	args := []interface{}{}
+	if req.Email != nil {
+		email, err := h.fields.encrypt(*req.Email)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to encrypt email",
+				zap.Error(err),
+				zap.String("user_id", id))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "internal_error",
+				"message": "Failed to update user",
+			})
+			return
+		}
+		args = append(args, email)
+		set += fmt.Sprintf(`, email = $%d`, len(args))
+		args = append(args, h.fields.index(*req.Email))
+		set += fmt.Sprintf(`, email_hash = $%d`, len(args))
+	}
+	if req.Role != nil {
+		args = append(args, *req.Role)
+		set += fmt.Sprintf(`, role = $%d`, len(args))
+	}
+	if req.IsActive != nil {
+		args = append(args, *req.IsActive)
+		set += fmt.Sprintf(`, is_active = $%d`, len(args))
+	}
+	args = append(args, id, orgID)
+
+	fail := func(err error) {
+		middleware.RequestLogger(c, h.logger).Error("Failed to update user",
+			zap.Error(err),
+			zap.String("user_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to update user",
+		})
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer tx.Rollback()
+
+	removesAdmin := (req.Role != nil && *req.Role != models.RoleAdmin) || (req.IsActive != nil && !*req.IsActive)
+	if user.Role == models.RoleAdmin && user.IsActive && removesAdmin {
+		// Lock the organization first so concurrent demotions take turns
+		// and each counts the admins the others left
+		if _, err := tx.ExecContext(ctx, `UPDATE organizations SET name = name WHERE id = $1`, orgID); err != nil {
+			fail(err)
+			return
+		}
+		var others int
+		if err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM users WHERE org_id = $1 AND role = $2 AND is_active = true AND id <> $3
+		`, orgID, models.RoleAdmin, id).Scan(&others); err != nil {
+			fail(err)
+			return
+		}
+		if others == 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "conflict",
+				"message": "Cannot demote or deactivate the last active admin",
+			})
+			return
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET `+set+fmt.Sprintf(` WHERE id = $%d AND org_id = $%d`, len(args)-1, len(args)), args...); err != nil {
+		fail(err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		fail(err)
+		return
+	}
+
+	updated, err := h.getUser(ctx, orgID, id)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to fetch updated user",
+			zap.Error(err),
+			zap.String("user_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch updated user",
+		})
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("User updated",
+		zap.String("user_id", id),
+		zap.String("role", string(updated.Role)),
+		zap.Bool("is_active", updated.IsActive),
+		zap.String("updated_by", c.GetString("user_id")))
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// checkRole responds 400 and returns false unless role is defined in the
+// roles table, and 403 unless the caller's own role grants every permission
+// role does, so managing users cannot escalate the caller's privileges
+func (h *UserHandler) checkRole(c *gin.Context, role models.Role) bool {
+	exists, covered, err := roleCovered(c, h.db, role)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to check role",
+			zap.Error(err),
+			zap.String("role", string(role)))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to check role",
+		})
+		return false
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": fmt.Sprintf("Unknown role %q", role),
+		})
+		return false
+	}
+	if !covered {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "forbidden",
+			"message": fmt.Sprintf("Role %q grants permissions you do not have", role),
+		})
+		return false
+	}
+	return true
+}
+
+// checkTarget responds 403 and returns false unless the caller's own role
+// grants every permission user's current role does, so a lesser role cannot
+// demote or deactivate a greater one
+func (h *UserHandler) checkTarget(c *gin.Context, user *models.User) bool {
+	_, covered, err := roleCovered(c, h.db, user.Role)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to check role",
+			zap.Error(err),
+			zap.String("role", string(user.Role)))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to check role",
+		})
+		return false
+	}
+	if !covered {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "forbidden",
+			"message": fmt.Sprintf("User's role %q grants permissions you do not have", user.Role),
+		})
+		return false
+	}
+	return true
+}
+
+// roleCovered reports whether role is defined in the roles table and whether
+// the caller's own role grants every permission it does
+func roleCovered(c *gin.Context, db *sql.DB, role models.Role) (exists, covered bool, err error) {
+	err = db.QueryRowContext(c.Request.Context(), `
+		SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1),
+			NOT EXISTS(
+				SELECT 1 FROM role_permissions target
+				WHERE target.role = $1 AND target.permission NOT IN (
+					SELECT own.permission FROM role_permissions own
+					JOIN users caller ON caller.role = own.role
+					WHERE caller.id = $2
+				)
+			)
+	`, role, middleware.GetUserID(c)).Scan(&exists, &covered)
+	return exists, covered, err
+}
+
+// targetOrg returns the organization a new user joins: the caller's own,
+// unless the operating organization names another to add its first users.
+// It responds and returns false if the caller may not use orgID or it does
+// not exist.
+func (h *UserHandler) targetOrg(c *gin.Context, orgID string) (string, bool) {
+	callerOrg := middleware.GetOrgID(c)
+	if orgID == "" || orgID == callerOrg {
+		return callerOrg, true
+	}
+	if callerOrg != models.DefaultOrganizationID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "forbidden",
+			"message": "Users can only be created in your own organization",
+		})
+		return "", false
+	}
+
+	var exists bool
+	err := h.db.QueryRowContext(c.Request.Context(), `
+		SELECT EXISTS(SELECT 1 FROM organizations WHERE id = $1)
+	`, orgID).Scan(&exists)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to check organization",
+			zap.Error(err),
+			zap.String("org_id", orgID))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to check organization",
+		})
+		return "", false
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": fmt.Sprintf("Unknown organization %q", orgID),
+		})
+		return "", false
+	}
+	return orgID, true
+}
+
+// getUser loads a user of an organization by ID, returning sql.ErrNoRows if
+// there is none
+func (h *UserHandler) getUser(ctx context.Context, orgID, id string) (*models.User, error) {
+	return scanUser(h.db.QueryRowContext(ctx, `
+		SELECT `+userColumns+` FROM users WHERE id = $1 AND org_id = $2
+	`, id, orgID), h.fields)
+}
+
+// scanUser scans a row of userColumns, decrypting the email
+func scanUser(row interface{ Scan(dest ...any) error }, fields fieldCipher) (*models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.ID,
+		&user.OrgID,
+		&user.Username,
+		&user.Email,
+		&user.Role,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.LastLogin,
+		&user.IsActive,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := fields.decryptUser(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,508 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// WatchlistHandler handles watchlist management requests. The detector
+// reloads watchlists periodically and alerts on every transfer touching an
+// address on one. Watchlists, and the alerts they raise, belong to the
+// organization that created them.
+type WatchlistHandler struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewWatchlistHandler creates a new watchlist handler
+func NewWatchlistHandler(db *sql.DB, logger *zap.Logger) *WatchlistHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &WatchlistHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// watchlistColumns are the columns scanWatchlist reads. $1 is the time
+// entries are counted as unexpired at.
+const watchlistColumns = `w.id, w.org_id, w.name, w.description, w.created_by, w.created_at, w.updated_at,
+	(SELECT COUNT(*) FROM watchlist_entries e
+	 WHERE e.watchlist_id = w.id AND (e.expires_at IS NULL OR e.expires_at > $1))`
+
+// watchlistEntryColumns are the columns scanWatchlistEntry reads
+const watchlistEntryColumns = `e.id, e.watchlist_id, w.name, e.address, e.reason, e.expires_at, e.added_by, e.added_at`
+
+// ListWatchlists returns the caller's organization's watchlists with their
+// numbers of unexpired entries
+func (h *WatchlistHandler) ListWatchlists(c *gin.Context) {
+	rows, err := h.db.QueryContext(c.Request.Context(),
+		`SELECT `+watchlistColumns+` FROM watchlists w WHERE w.org_id = $2 ORDER BY w.name`,
+		time.Now().UTC(), middleware.GetOrgID(c))
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to query watchlists", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to fetch watchlists",
+		})
+		return
+	}
+	defer rows.Close()
+
+	watchlists := []models.Watchlist{}
+	for rows.Next() {
+		watchlist, err := scanWatchlist(rows)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan watchlist row", zap.Error(err))
+			continue
+		}
+		watchlists = append(watchlists, *watchlist)
+	}
+
+	c.JSON(http.StatusOK, api.WatchlistListResponse{Watchlists: watchlists})
+}
+
+// GetWatchlist returns a watchlist and its entries. Expired entries are
+// left out unless include_expired is set.
+func (h *WatchlistHandler) GetWatchlist(c *gin.Context) {
+	var req api.WatchlistRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid query parameters",
+		})
+		return
+	}
+
+	h.respondWatchlist(c, http.StatusOK, c.Param("id"), req.IncludeExpired)
+}
+
+// CreateWatchlist creates an empty watchlist
+func (h *WatchlistHandler) CreateWatchlist(c *gin.Context) {
+	var req api.CreateWatchlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Watchlist name is required",
+		})
+		return
+	}
+
+	id := uuid.New().String()
+	now := time.Now().UTC()
+	result, err := h.db.ExecContext(c.Request.Context(), `
+		INSERT INTO watchlists (id, org_id, name, description, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		ON CONFLICT DO NOTHING
+	`, id, middleware.GetOrgID(c), name, req.Description, c.GetString("user_id"), now)
+	if err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to create watchlist",
+			zap.Error(err),
+			zap.String("name", name))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to create watchlist",
+		})
+		return
+	}
+	if created, err := result.RowsAffected(); err == nil && created == 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "conflict",
+			"message": "A watchlist with that name already exists",
+		})
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Watchlist created",
+		zap.String("watchlist_id", id),
+		zap.String("name", name),
+		zap.String("created_by", c.GetString("user_id")))
+
+	h.respondWatchlist(c, http.StatusCreated, id, false)
+}
+
+// UpdateWatchlist renames a watchlist or changes its description
+func (h *WatchlistHandler) UpdateWatchlist(c *gin.Context) {
+	var req api.UpdateWatchlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	id := c.Param("id")
+	orgID := middleware.GetOrgID(c)
+	q := &queryFilter{}
+	sets := []string{"updated_at = " + q.arg(time.Now().UTC())}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": "Watchlist name must not be empty",
+			})
+			return
+		}
+
+		var taken bool
+		err := h.db.QueryRowContext(c.Request.Context(),
+			`SELECT EXISTS (SELECT 1 FROM watchlists WHERE org_id = $1 AND name = $2 AND id != $3)`,
+			orgID, name, id).Scan(&taken)
+		if err != nil {
+			internalError(c, h.logger, err, "Failed to update watchlist", zap.String("watchlist_id", c.Param("id")))
+			return
+		}
+		if taken {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "conflict",
+				"message": "A watchlist with that name already exists",
+			})
+			return
+		}
+		sets = append(sets, "name = "+q.arg(name))
+	}
+	if req.Description != nil {
+		sets = append(sets, "description = "+q.arg(*req.Description))
+	}
+
+	result, err := h.db.ExecContext(c.Request.Context(),
+		`UPDATE watchlists SET `+strings.Join(sets, ", ")+` WHERE id = `+q.arg(id)+` AND org_id = `+q.arg(orgID), q.args...)
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to update watchlist", zap.String("watchlist_id", c.Param("id")))
+		return
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		h.notFound(c, "Watchlist not found")
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Watchlist updated",
+		zap.String("watchlist_id", id),
+		zap.String("updated_by", c.GetString("user_id")))
+
+	h.respondWatchlist(c, http.StatusOK, id, false)
+}
+
+// DeleteWatchlist deletes a watchlist and all its entries
+func (h *WatchlistHandler) DeleteWatchlist(c *gin.Context) {
+	id := c.Param("id")
+	orgID := middleware.GetOrgID(c)
+
+	tx, err := h.db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to delete watchlist", zap.String("watchlist_id", c.Param("id")))
+		return
+	}
+	defer tx.Rollback()
+
+	// Deleted explicitly too, for databases not enforcing the cascade
+	if _, err := tx.ExecContext(c.Request.Context(), `
+		DELETE FROM watchlist_entries
+		WHERE watchlist_id IN (SELECT id FROM watchlists WHERE id = $1 AND org_id = $2)
+	`, id, orgID); err != nil {
+		internalError(c, h.logger, err, "Failed to delete watchlist", zap.String("watchlist_id", c.Param("id")))
+		return
+	}
+	result, err := tx.ExecContext(c.Request.Context(), `DELETE FROM watchlists WHERE id = $1 AND org_id = $2`, id, orgID)
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to delete watchlist", zap.String("watchlist_id", c.Param("id")))
+		return
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		h.notFound(c, "Watchlist not found")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		internalError(c, h.logger, err, "Failed to delete watchlist", zap.String("watchlist_id", c.Param("id")))
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Watchlist deleted",
+		zap.String("watchlist_id", id),
+		zap.String("deleted_by", c.GetString("user_id")))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Watchlist deleted",
+	})
+}
+
+// AddWatchlistEntry puts an address on a watchlist
+func (h *WatchlistHandler) AddWatchlistEntry(c *gin.Context) {
+	req, ok := bindWatchlistEntry(c)
+	if !ok {
+		return
+	}
+	address := strings.TrimSpace(req.Address)
+	if address == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Address is required",
+		})
+		return
+	}
+
+	watchlistID := c.Param("id")
+	var exists bool
+	err := h.db.QueryRowContext(c.Request.Context(),
+		`SELECT EXISTS (SELECT 1 FROM watchlists WHERE id = $1 AND org_id = $2)`,
+		watchlistID, middleware.GetOrgID(c)).Scan(&exists)
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to add watchlist entry", zap.String("watchlist_id", c.Param("id")))
+		return
+	}
+	if !exists {
+		h.notFound(c, "Watchlist not found")
+		return
+	}
+
+	id := uuid.New().String()
+	result, err := h.db.ExecContext(c.Request.Context(), `
+		INSERT INTO watchlist_entries (id, watchlist_id, address, reason, expires_at, added_by, added_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT DO NOTHING
+	`, id, watchlistID, address, req.Reason, nullTime(req.ExpiresAt), c.GetString("user_id"), time.Now().UTC())
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to add watchlist entry", zap.String("watchlist_id", c.Param("id")))
+		return
+	}
+	if created, err := result.RowsAffected(); err == nil && created == 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "conflict",
+			"message": "Address is already on the watchlist",
+		})
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Address added to watchlist",
+		zap.String("watchlist_id", watchlistID),
+		zap.String("address", address),
+		zap.String("added_by", c.GetString("user_id")))
+
+	h.respondEntry(c, http.StatusCreated, watchlistID, id)
+}
+
+// UpdateWatchlistEntry replaces an entry's reason and expiry
+func (h *WatchlistHandler) UpdateWatchlistEntry(c *gin.Context) {
+	req, ok := bindWatchlistEntry(c)
+	if !ok {
+		return
+	}
+
+	watchlistID, id := c.Param("id"), c.Param("entry_id")
+	result, err := h.db.ExecContext(c.Request.Context(), `
+		UPDATE watchlist_entries SET reason = $1, expires_at = $2
+		WHERE id = $3 AND watchlist_id = $4
+		  AND watchlist_id IN (SELECT id FROM watchlists WHERE org_id = $5)
+	`, req.Reason, nullTime(req.ExpiresAt), id, watchlistID, middleware.GetOrgID(c))
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to update watchlist entry", zap.String("watchlist_id", c.Param("id")))
+		return
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		h.notFound(c, "Watchlist entry not found")
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Watchlist entry updated",
+		zap.String("watchlist_id", watchlistID),
+		zap.String("entry_id", id),
+		zap.String("updated_by", c.GetString("user_id")))
+
+	h.respondEntry(c, http.StatusOK, watchlistID, id)
+}
+
+// RemoveWatchlistEntry takes an address off a watchlist
+func (h *WatchlistHandler) RemoveWatchlistEntry(c *gin.Context) {
+	watchlistID, id := c.Param("id"), c.Param("entry_id")
+	result, err := h.db.ExecContext(c.Request.Context(), `
+		DELETE FROM watchlist_entries
+		WHERE id = $1 AND watchlist_id = $2
+		  AND watchlist_id IN (SELECT id FROM watchlists WHERE org_id = $3)
+	`, id, watchlistID, middleware.GetOrgID(c))
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to remove watchlist entry", zap.String("watchlist_id", c.Param("id")))
+		return
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		h.notFound(c, "Watchlist entry not found")
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Address removed from watchlist",
+		zap.String("watchlist_id", watchlistID),
+		zap.String("entry_id", id),
+		zap.String("removed_by", c.GetString("user_id")))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Watchlist entry removed",
+	})
+}
+
+// bindWatchlistEntry binds an entry request, rejecting an expiry that has
+// already passed
+func bindWatchlistEntry(c *gin.Context) (*api.WatchlistEntryRequest, bool) {
+	var req api.WatchlistEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return nil, false
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "expires_at must be in the future",
+		})
+		return nil, false
+	}
+	return &req, true
+}
+
+// respondWatchlist responds with a watchlist of the caller's organization
+// and its entries
+func (h *WatchlistHandler) respondWatchlist(c *gin.Context, status int, id string, includeExpired bool) {
+	now := time.Now().UTC()
+	watchlist, err := scanWatchlist(h.db.QueryRowContext(c.Request.Context(),
+		`SELECT `+watchlistColumns+` FROM watchlists w WHERE w.id = $2 AND w.org_id = $3`,
+		now, id, middleware.GetOrgID(c)))
+	if err == sql.ErrNoRows {
+		h.notFound(c, "Watchlist not found")
+		return
+	}
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to fetch watchlist", zap.String("watchlist_id", c.Param("id")))
+		return
+	}
+
+	query := `SELECT ` + watchlistEntryColumns + `
+		FROM watchlist_entries e
+		JOIN watchlists w ON w.id = e.watchlist_id
+		WHERE e.watchlist_id = $1`
+	args := []interface{}{id}
+	if !includeExpired {
+		query += ` AND (e.expires_at IS NULL OR e.expires_at > $2)`
+		args = append(args, now)
+	}
+	rows, err := h.db.QueryContext(c.Request.Context(), query+` ORDER BY e.added_at DESC, e.id`, args...)
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to fetch watchlist", zap.String("watchlist_id", c.Param("id")))
+		return
+	}
+	defer rows.Close()
+
+	resp := api.WatchlistResponse{
+		Watchlist: *watchlist,
+		Entries:   []models.WatchlistEntry{},
+	}
+	for rows.Next() {
+		entry, err := scanWatchlistEntry(rows)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan watchlist entry row", zap.Error(err))
+			continue
+		}
+		resp.Entries = append(resp.Entries, *entry)
+	}
+
+	c.JSON(status, resp)
+}
+
+// respondEntry responds with a single entry on a watchlist of the caller's
+// organization
+func (h *WatchlistHandler) respondEntry(c *gin.Context, status int, watchlistID, id string) {
+	entry, err := scanWatchlistEntry(h.db.QueryRowContext(c.Request.Context(), `
+		SELECT `+watchlistEntryColumns+`
+		FROM watchlist_entries e
+		JOIN watchlists w ON w.id = e.watchlist_id
+		WHERE e.id = $1 AND e.watchlist_id = $2 AND w.org_id = $3
+	`, id, watchlistID, middleware.GetOrgID(c)))
+	if err == sql.ErrNoRows {
+		h.notFound(c, "Watchlist entry not found")
+		return
+	}
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to fetch watchlist entry", zap.String("watchlist_id", c.Param("id")))
+		return
+	}
+
+	c.JSON(status, entry)
+}
+
+// notFound responds with a 404
+func (h *WatchlistHandler) notFound(c *gin.Context, message string) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"error":   "not_found",
+		"message": message,
+	})
+}
+
+// scanWatchlist scans a row of watchlistColumns
+func scanWatchlist(row interface{ Scan(dest ...any) error }) (*models.Watchlist, error) {
+	var watchlist models.Watchlist
+	err := row.Scan(
+		&watchlist.ID,
+		&watchlist.OrgID,
+		&watchlist.Name,
+		&watchlist.Description,
+		&watchlist.CreatedBy,
+		&watchlist.CreatedAt,
+		&watchlist.UpdatedAt,
+		&watchlist.EntryCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &watchlist, nil
+}
+
+// scanWatchlistEntry scans a row of watchlistEntryColumns
+func scanWatchlistEntry(row interface{ Scan(dest ...any) error }) (*models.WatchlistEntry, error) {
+	var entry models.WatchlistEntry
+	var expiresAt sql.NullTime
+	err := row.Scan(
+		&entry.ID,
+		&entry.WatchlistID,
+		&entry.WatchlistName,
+		&entry.Address,
+		&entry.Reason,
+		&expiresAt,
+		&entry.AddedBy,
+		&entry.AddedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		entry.ExpiresAt = &expiresAt.Time
+	}
+	return &entry, nil
+}
+
+// nullTime converts an optional time to a nullable column value
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
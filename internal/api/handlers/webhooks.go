@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/security/crypto"
+	"github.com/mikedewar/stablerisk/internal/webhook"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// WebhookHandler handles webhook management requests. Webhooks belong to
+// the organization that registered them and receive its events, signed
+// with a secret shown only when it is generated.
+type WebhookHandler struct {
+	db            *sql.DB
+	fields        fieldCipher
+	allowInsecure bool
+	allowPrivate  bool
+	logger        *zap.Logger
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(db *sql.DB, logger *zap.Logger) *WebhookHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &WebhookHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// SetCipher sets the cipher webhook secrets are encrypted with
+func (h *WebhookHandler) SetCipher(cipher *crypto.Cipher) {
+	h.fields = fieldCipher{cipher: cipher}
+}
+
+// SetAllowInsecureURLs allows plain http webhook URLs, for development.
+// Otherwise only https URLs are accepted.
+func (h *WebhookHandler) SetAllowInsecureURLs(allow bool) {
+	h.allowInsecure = allow
+}
+
+// SetAllowPrivateAddresses allows webhook URLs naming localhost or a
+// loopback, private or link-local address, for development
+func (h *WebhookHandler) SetAllowPrivateAddresses(allow bool) {
+	h.allowPrivate = allow
+}
+
+// webhookColumns are the columns scanWebhook reads
+const webhookColumns = `id, org_id, url, description, events, enabled, created_by, created_at, updated_at`
+
+// ListWebhooks returns the caller's organization's webhooks
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	rows, err := h.db.QueryContext(c.Request.Context(),
+		`SELECT `+webhookColumns+` FROM webhooks WHERE org_id = $1 ORDER BY created_at, id`,
+		middleware.GetOrgID(c))
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to fetch webhooks")
+		return
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan webhook row", zap.Error(err))
+			continue
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+
+	c.JSON(http.StatusOK, api.WebhookListResponse{Webhooks: webhooks})
+}
+
+// GetWebhook returns a webhook of the caller's organization
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	webhook, ok := h.fetch(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, webhook)
+}
+
+// CreateWebhook registers a webhook and returns it with its secret
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req api.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+	endpoint, ok := h.bindURL(c, req.URL)
+	if !ok {
+		return
+	}
+	events, ok := bindWebhookEvents(c, req.Events)
+	if !ok {
+		return
+	}
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	secret, stored, err := h.newSecret()
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to create webhook")
+		return
+	}
+	encodedEvents, err := json.Marshal(events)
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to create webhook")
+		return
+	}
+
+	id := uuid.New().String()
+	now := time.Now().UTC()
+	_, err = h.db.ExecContext(c.Request.Context(), `
+		INSERT INTO webhooks (id, org_id, url, description, events, secret, enabled, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)
+	`, id, middleware.GetOrgID(c), endpoint, req.Description, string(encodedEvents), stored, enabled, c.GetString("user_id"), now)
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to create webhook")
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Webhook created",
+		zap.String("webhook_id", id),
+		zap.String("url", endpoint),
+		zap.String("created_by", c.GetString("user_id")))
+
+	webhook, ok := h.fetch(c, id)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusCreated, api.CreateWebhookResponse{Webhook: *webhook, Secret: secret})
+}
+
+// UpdateWebhook changes a webhook's URL, description, events or whether it
+// is enabled. Its secret is kept.
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	var req api.UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	q := &queryFilter{}
+	sets := []string{"updated_at = " + q.arg(time.Now().UTC())}
+	if req.URL != nil {
+		endpoint, ok := h.bindURL(c, *req.URL)
+		if !ok {
+			return
+		}
+		sets = append(sets, "url = "+q.arg(endpoint))
+	}
+	if req.Description != nil {
+		sets = append(sets, "description = "+q.arg(*req.Description))
+	}
+	if req.Events != nil {
+		events, ok := bindWebhookEvents(c, *req.Events)
+		if !ok {
+			return
+		}
+		encoded, err := json.Marshal(events)
+		if err != nil {
+			internalError(c, h.logger, err, "Failed to update webhook", zap.String("webhook_id", c.Param("id")))
+			return
+		}
+		sets = append(sets, "events = "+q.arg(string(encoded)))
+	}
+	if req.Enabled != nil {
+		sets = append(sets, "enabled = "+q.arg(*req.Enabled))
+	}
+
+	id := c.Param("id")
+	result, err := h.db.ExecContext(c.Request.Context(),
+		`UPDATE webhooks SET `+strings.Join(sets, ", ")+` WHERE id = `+q.arg(id)+` AND org_id = `+q.arg(middleware.GetOrgID(c)), q.args...)
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to update webhook", zap.String("webhook_id", c.Param("id")))
+		return
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		h.notFound(c)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Webhook updated",
+		zap.String("webhook_id", id),
+		zap.String("updated_by", c.GetString("user_id")))
+
+	h.GetWebhook(c)
+}
+
+// DeleteWebhook deletes a webhook and its delivery history
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	id := c.Param("id")
+	orgID := middleware.GetOrgID(c)
+
+	tx, err := h.db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to delete webhook", zap.String("webhook_id", c.Param("id")))
+		return
+	}
+	defer tx.Rollback()
+
+	// Deleted explicitly too, for databases not enforcing the cascade
+	if _, err := tx.ExecContext(c.Request.Context(), `
+		DELETE FROM webhook_deliveries
+		WHERE webhook_id IN (SELECT id FROM webhooks WHERE id = $1 AND org_id = $2)
+	`, id, orgID); err != nil {
+		internalError(c, h.logger, err, "Failed to delete webhook", zap.String("webhook_id", c.Param("id")))
+		return
+	}
+	result, err := tx.ExecContext(c.Request.Context(), `DELETE FROM webhooks WHERE id = $1 AND org_id = $2`, id, orgID)
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to delete webhook", zap.String("webhook_id", c.Param("id")))
+		return
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		h.notFound(c)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		internalError(c, h.logger, err, "Failed to delete webhook", zap.String("webhook_id", c.Param("id")))
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Webhook deleted",
+		zap.String("webhook_id", id),
+		zap.String("deleted_by", c.GetString("user_id")))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Webhook deleted",
+	})
+}
+
+// RotateWebhookSecret replaces a webhook's secret and returns the new one.
+// Deliveries are signed with the new secret from then on, including
+// retries of earlier events.
+func (h *WebhookHandler) RotateWebhookSecret(c *gin.Context) {
+	secret, stored, err := h.newSecret()
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to rotate webhook secret", zap.String("webhook_id", c.Param("id")))
+		return
+	}
+
+	id := c.Param("id")
+	result, err := h.db.ExecContext(c.Request.Context(),
+		`UPDATE webhooks SET secret = $1, updated_at = $2 WHERE id = $3 AND org_id = $4`,
+		stored, time.Now().UTC(), id, middleware.GetOrgID(c))
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to rotate webhook secret", zap.String("webhook_id", c.Param("id")))
+		return
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		h.notFound(c)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Webhook secret rotated",
+		zap.String("webhook_id", id),
+		zap.String("rotated_by", c.GetString("user_id")))
+
+	webhook, ok := h.fetch(c, id)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, api.CreateWebhookResponse{Webhook: *webhook, Secret: secret})
+}
+
+// ListWebhookDeliveries returns a webhook's most recent deliveries,
+// optionally only those with a status
+func (h *WebhookHandler) ListWebhookDeliveries(c *gin.Context) {
+	var req api.WebhookDeliveryListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid query parameters",
+		})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 50
+	}
+
+	id := c.Param("id")
+	if _, ok := h.fetch(c, id); !ok {
+		return
+	}
+
+	q := &queryFilter{}
+	q.equal("webhook_id", id)
+	if req.Status != "" {
+		q.equal("status", string(req.Status))
+	}
+	rows, err := h.db.QueryContext(c.Request.Context(), `
+		SELECT id, webhook_id, event_id, event_type, status, attempts, response_status, error,
+		       created_at, last_attempt_at, delivered_at
+		FROM webhook_deliveries
+		WHERE `+strings.Join(q.conditions, " AND ")+`
+		ORDER BY created_at DESC, id
+		LIMIT `+q.arg(req.Limit), q.args...)
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to fetch webhook deliveries", zap.String("webhook_id", c.Param("id")))
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var responseStatus sql.NullInt64
+		var lastAttemptAt, deliveredAt sql.NullTime
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.EventID,
+			&delivery.EventType,
+			&delivery.Status,
+			&delivery.Attempts,
+			&responseStatus,
+			&delivery.Error,
+			&delivery.CreatedAt,
+			&lastAttemptAt,
+			&deliveredAt,
+		)
+		if err != nil {
+			middleware.RequestLogger(c, h.logger).Error("Failed to scan webhook delivery row", zap.Error(err))
+			continue
+		}
+		delivery.ResponseStatus = int(responseStatus.Int64)
+		if lastAttemptAt.Valid {
+			delivery.LastAttemptAt = &lastAttemptAt.Time
+		}
+		if deliveredAt.Valid {
+			delivery.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	c.JSON(http.StatusOK, api.WebhookDeliveryListResponse{Deliveries: deliveries})
+}
+
+// fetch loads a webhook of the caller's organization, responding with an
+// error if it cannot
+func (h *WebhookHandler) fetch(c *gin.Context, id string) (*models.Webhook, bool) {
+	webhook, err := scanWebhook(h.db.QueryRowContext(c.Request.Context(),
+		`SELECT `+webhookColumns+` FROM webhooks WHERE id = $1 AND org_id = $2`,
+		id, middleware.GetOrgID(c)))
+	if err == sql.ErrNoRows {
+		h.notFound(c)
+		return nil, false
+	}
+	if err != nil {
+		internalError(c, h.logger, err, "Failed to fetch webhook", zap.String("webhook_id", c.Param("id")))
+		return nil, false
+	}
+	return webhook, true
+}
+
+// bindURL checks a webhook URL is absolute and, unless insecure URLs are
+// allowed, uses https. Unless private addresses are allowed, URLs naming
+// one are refused here; names resolving to one are refused on delivery.
+func (h *WebhookHandler) bindURL(c *gin.Context, raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	endpoint, err := url.Parse(raw)
+	valid := err == nil && endpoint.Host != "" &&
+		(endpoint.Scheme == "https" || (h.allowInsecure && endpoint.Scheme == "http"))
+	if !valid {
+		message := "Webhook URL must be an absolute https URL"
+		if h.allowInsecure {
+			message = "Webhook URL must be an absolute http or https URL"
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": message,
+		})
+		return "", false
+	}
+	if !h.allowPrivate && webhook.BlockedHost(endpoint.Hostname()) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Webhook URL must not name a private, loopback or link-local address",
+		})
+		return "", false
+	}
+	return raw, true
+}
+
+// bindWebhookEvents checks every event is known, defaulting to all of them
+func bindWebhookEvents(c *gin.Context, events []models.WebhookEvent) ([]models.WebhookEvent, bool) {
+	if len(events) == 0 {
+		return models.WebhookEvents, true
+	}
+
+	seen := make(map[models.WebhookEvent]bool, len(events))
+	unique := make([]models.WebhookEvent, 0, len(events))
+	for _, event := range events {
+		if !event.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": fmt.Sprintf("Unknown webhook event %q", event),
+			})
+			return nil, false
+		}
+		if !seen[event] {
+			seen[event] = true
+			unique = append(unique, event)
+		}
+	}
+	return unique, true
+}
+
+// newSecret returns a random signing secret and its stored form
+func (h *WebhookHandler) newSecret() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	secret := "whsec_" + hex.EncodeToString(raw)
+
+	stored, err := h.fields.encrypt(secret)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt webhook secret: %w", err)
+	}
+	return secret, stored.String, nil
+}
+
+// notFound responds with a 404
+func (h *WebhookHandler) notFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"error":   "not_found",
+		"message": "Webhook not found",
+	})
+}
+
+// scanWebhook scans a row of webhookColumns
+func scanWebhook(row interface{ Scan(dest ...any) error }) (*models.Webhook, error) {
+	var webhook models.Webhook
+	var events []byte
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.OrgID,
+		&webhook.URL,
+		&webhook.Description,
+		&events,
+		&webhook.Enabled,
+		&webhook.CreatedBy,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(events, &webhook.Events); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook events: %w", err)
+	}
+	return &webhook, nil
+}
@@ -1,16 +1,25 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
 	"github.com/mikedewar/stablerisk/internal/security"
 	ws "github.com/mikedewar/stablerisk/internal/websocket"
 	"github.com/mikedewar/stablerisk/pkg/models"
 	"go.uber.org/zap"
 )
 
+// adminDisconnectReason is sent in the close frame of connections an
+// administrator closes
+const adminDisconnectReason = "Disconnected by an administrator"
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -25,10 +34,12 @@ var upgrader = websocket.Upgrader{
 type WebSocketHandler struct {
 	hub        *ws.Hub
 	jwtManager *security.JWTManager
+	roles      security.PermissionChecker
 	logger     *zap.Logger
 }
 
-// NewWebSocketHandler creates a new WebSocket handler
+// NewWebSocketHandler creates a new WebSocket handler. Roles grant the
+// built-in permissions until SetRoles is called.
 func NewWebSocketHandler(hub *ws.Hub, jwtManager *security.JWTManager, logger *zap.Logger) *WebSocketHandler {
 	if logger == nil {
 		logger = zap.NewNop()
@@ -37,10 +48,17 @@ func NewWebSocketHandler(hub *ws.Hub, jwtManager *security.JWTManager, logger *z
 	return &WebSocketHandler{
 		hub:        hub,
 		jwtManager: jwtManager,
+		roles:      security.DefaultRoles,
 		logger:     logger,
 	}
 }
 
+// SetRoles sets where role permissions are looked up, normally a
+// security.RoleStore
+func (h *WebSocketHandler) SetRoles(roles security.PermissionChecker) {
+	h.roles = roles
+}
+
 // HandleWebSocket upgrades HTTP connection to WebSocket
 func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 	// Extract token from query parameter (since WebSocket can't send custom headers)
@@ -64,7 +82,7 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 	// Validate token
 	claims, err := h.jwtManager.ValidateToken(token)
 	if err != nil {
-		h.logger.Warn("WebSocket authentication failed",
+		middleware.RequestLogger(c, h.logger).Warn("WebSocket authentication failed",
 			zap.Error(err))
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error":   "unauthorized",
@@ -73,38 +91,98 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
+	// Binary consumers can ask for MessagePack instead of JSON
+	format, err := ws.ParseFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	// Upgrade connection
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		h.logger.Error("Failed to upgrade WebSocket connection",
+		middleware.RequestLogger(c, h.logger).Error("Failed to upgrade WebSocket connection",
 			zap.Error(err),
 			zap.String("user_id", claims.UserID))
 		return
 	}
 
-	// Create client
+	// Create client. Tokens issued before organizations act within the
+	// default organization.
+	orgID := claims.OrgID
+	if orgID == "" {
+		orgID = models.DefaultOrganizationID
+	}
 	client := ws.NewClient(
 		h.hub,
 		conn,
 		claims.UserID,
 		claims.Username,
+		orgID,
 		claims.Role,
 		h.logger,
 	)
 
-	// Register client with hub
-	h.hub.RegisterClient(client)
+	// The role's permissions are checked once, when the connection is made.
+	// Admin broadcasts describe the whole deployment, so like other system
+	// permissions they are kept to the default organization.
+	ctx := c.Request.Context()
+	if h.roles.HasPermission(ctx, claims.Role, string(middleware.PermissionStreamTransactions)) {
+		client.AllowTransactions()
+	}
+	switch {
+	case orgID == models.DefaultOrganizationID &&
+		h.roles.HasPermission(ctx, claims.Role, string(middleware.PermissionManageSystem)):
+		client.SetAudience(ws.AudienceAdmin)
+	case h.roles.HasPermission(ctx, claims.Role, string(middleware.PermissionWriteOutliers)):
+		client.SetAudience(ws.AudienceAnalyst)
+	}
+	client.SetFormat(format)
+	if claims.ExpiresAt != nil {
+		client.SetTokenExpiry(claims.ExpiresAt.Time, h.reauthenticator(claims))
+	}
+
+	// Register client with hub, which closes connections over its limits
+	if err := h.hub.RegisterClient(client); err != nil {
+		middleware.RequestLogger(c, h.logger).Warn("WebSocket connection refused",
+			zap.Error(err),
+			zap.String("user_id", claims.UserID))
+		return
+	}
 
 	// Start read and write pumps
 	go client.WritePump()
 	go client.ReadPump()
 
-	h.logger.Info("WebSocket connection established",
+	middleware.RequestLogger(c, h.logger).Info("WebSocket connection established",
 		zap.String("user_id", claims.UserID),
 		zap.String("username", claims.Username),
 		zap.String("role", string(claims.Role)))
 }
 
+// reauthenticator checks the fresh tokens a connection sends to stay open.
+// They must be for the user, organization and role the connection was
+// opened with, since its permissions were settled then; a user whose role
+// changed reconnects instead.
+func (h *WebSocketHandler) reauthenticator(claims *security.Claims) ws.Authenticator {
+	return func(token string) (time.Time, error) {
+		fresh, err := h.jwtManager.ValidateToken(token)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fresh.UserID != claims.UserID || fresh.OrgID != claims.OrgID || fresh.Role != claims.Role {
+			return time.Time{}, fmt.Errorf("token is not for the connection's user and role")
+		}
+		if fresh.ExpiresAt == nil {
+			return time.Time{}, fmt.Errorf("token has no expiry")
+		}
+		return fresh.ExpiresAt.Time, nil
+	}
+}
+
 // BroadcastOutlier broadcasts an outlier to all connected clients
 func (h *WebSocketHandler) BroadcastOutlier(outlier models.Outlier) {
 	h.hub.BroadcastOutlier(outlier)
@@ -114,3 +192,84 @@ func (h *WebSocketHandler) BroadcastOutlier(outlier models.Outlier) {
 func (h *WebSocketHandler) GetConnectionCount() int {
 	return h.hub.ClientCount()
 }
+
+// ListConnections lists connected WebSocket clients, oldest first, with
+// their user, connect time, subscription filters and send queue depth.
+// ?user_id= lists one user's connections.
+func (h *WebSocketHandler) ListConnections(c *gin.Context) {
+	var req api.WebSocketConnectionListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid query parameters",
+		})
+		return
+	}
+
+	var connections []api.WebSocketConnection
+	if req.UserID != "" {
+		for _, client := range h.hub.GetClientsByUser(req.UserID) {
+			connections = append(connections, client.Info())
+		}
+		sort.Slice(connections, func(i, j int) bool {
+			return connections[i].ConnectedAt.Before(connections[j].ConnectedAt)
+		})
+	} else {
+		connections = h.hub.Connections()
+	}
+	if connections == nil {
+		connections = []api.WebSocketConnection{}
+	}
+
+	c.JSON(http.StatusOK, api.WebSocketConnectionListResponse{
+		Connections: connections,
+		Total:       len(connections),
+	})
+}
+
+// DisconnectConnection closes a WebSocket connection by ID. The client may
+// reconnect unless its user is deactivated or its token revoked.
+func (h *WebSocketHandler) DisconnectConnection(c *gin.Context) {
+	client := h.hub.GetClient(c.Param("id"))
+	if client == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": "Connection not found",
+		})
+		return
+	}
+
+	client.Disconnect(adminDisconnectReason)
+	h.logDisconnect(c, client.Info())
+
+	c.JSON(http.StatusOK, api.WebSocketDisconnectResponse{Disconnected: 1})
+}
+
+// DisconnectUserConnections closes every WebSocket connection of the user
+// given by ?user_id=
+func (h *WebSocketHandler) DisconnectUserConnections(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "user_id is required",
+		})
+		return
+	}
+
+	clients := h.hub.GetClientsByUser(userID)
+	for _, client := range clients {
+		client.Disconnect(adminDisconnectReason)
+		h.logDisconnect(c, client.Info())
+	}
+
+	c.JSON(http.StatusOK, api.WebSocketDisconnectResponse{Disconnected: len(clients)})
+}
+
+// logDisconnect records who closed a connection
+func (h *WebSocketHandler) logDisconnect(c *gin.Context, connection api.WebSocketConnection) {
+	middleware.RequestLogger(c, h.logger).Info("WebSocket connection closed by administrator",
+		zap.String("connection_id", connection.ID),
+		zap.String("user_id", connection.UserID),
+		zap.String("closed_by", middleware.GetUserID(c)))
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -83,12 +84,29 @@ func (m *AuditMiddleware) Log() gin.HandlerFunc {
 			"duration_ms": duration.Milliseconds(),
 			"status_code": blw.Status(),
 		}
+		if requestID := GetRequestID(c); requestID != "" {
+			details["request_id"] = requestID
+		}
 
 		// Add request body for write operations (excluding sensitive endpoints)
 		if requestBody != "" && !isSensitiveEndpoint(c.Request.URL.Path) {
 			details["request_body"] = requestBody
 		}
 
+		// Attribute API key requests to the key as well as its owner
+		if apiKey := GetAPIKey(c); apiKey != nil {
+			details["api_key_id"] = apiKey.ID
+		}
+
+		// Note retries answered from a stored response, which did not
+		// change anything
+		if key := c.GetHeader(IdempotencyKeyHeader); key != "" {
+			details["idempotency_key"] = key
+			if IsIdempotentReplay(c) {
+				details["idempotent_replay"] = true
+			}
+		}
+
 		// Add error if request failed
 		if len(c.Errors) > 0 {
 			details["errors"] = c.Errors.String()
@@ -103,7 +121,7 @@ func (m *AuditMiddleware) Log() gin.HandlerFunc {
 		m.auditLogger.Log(userID, action, resource, status, ipAddress, details)
 
 		// Also log to structured logger for immediate visibility
-		m.logger.Info("API request",
+		RequestLogger(c, m.logger).Info("API request",
 			zap.String("user_id", userID),
 			zap.String("method", c.Request.Method),
 			zap.String("path", c.Request.URL.Path),
@@ -130,6 +148,12 @@ func (w *bodyLogWriter) WriteString(s string) (int, error) {
 	return w.ResponseWriter.WriteString(s)
 }
 
+// Unwrap returns the underlying writer, so http.ResponseController can
+// reach it to set deadlines on streamed responses
+func (w *bodyLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 // Status returns the status code
 func (w *bodyLogWriter) Status() int {
 	if w.status == 0 {
@@ -155,6 +179,9 @@ func isSensitiveEndpoint(path string) bool {
 		"/api/v1/auth/login",
 		"/api/v1/auth/register",
 		"/api/v1/auth/refresh",
+		"/api/v1/auth/password",
+		"/api/v1/auth/password/reset",
+		"/api/v1/users", // Creation carries the initial password
 		"/api/v1/users/password",
 	}
 
@@ -1,11 +1,15 @@
 package middleware
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/pkg/models"
 	"go.uber.org/zap"
 )
 
@@ -18,11 +22,21 @@ const (
 	ContextKeyRole = "user_role"
 	// ContextKeyClaims is the context key for JWT claims
 	ContextKeyClaims = "jwt_claims"
+	// ContextKeyAPIKey is the context key for the API key a request
+	// authenticated with
+	ContextKeyAPIKey = "api_key"
+	// ContextKeyOrgID is the context key for the organization a request
+	// acts within
+	ContextKeyOrgID = "org_id"
+
+	// APIKeyHeader carries API keys
+	APIKeyHeader = "X-API-Key"
 )
 
 // AuthMiddleware creates authentication middleware
 type AuthMiddleware struct {
 	jwtManager *security.JWTManager
+	apiKeys    *security.APIKeyManager
 	logger     *zap.Logger
 }
 
@@ -38,12 +52,23 @@ func NewAuthMiddleware(jwtManager *security.JWTManager, logger *zap.Logger) *Aut
 	}
 }
 
+// SetAPIKeys lets requests authenticate with an X-API-Key header instead
+// of a JWT
+func (m *AuthMiddleware) SetAPIKeys(apiKeys *security.APIKeyManager) {
+	m.apiKeys = apiKeys
+}
+
 // Authenticate validates JWT token and adds claims to context
 func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := c.GetHeader(APIKeyHeader); key != "" && m.apiKeys != nil {
+			m.authenticateAPIKey(c, key)
+			return
+		}
+
 		token := m.extractToken(c)
 		if token == "" {
-			m.logger.Debug("Missing authentication token",
+			RequestLogger(c, m.logger).Debug("Missing authentication token",
 				zap.String("path", c.Request.URL.Path),
 				zap.String("method", c.Request.Method))
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -56,7 +81,7 @@ func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
 
 		claims, err := m.jwtManager.ValidateToken(token)
 		if err != nil {
-			m.logger.Debug("Invalid authentication token",
+			RequestLogger(c, m.logger).Debug("Invalid authentication token",
 				zap.Error(err),
 				zap.String("path", c.Request.URL.Path))
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -71,9 +96,10 @@ func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
 		c.Set(ContextKeyUserID, claims.UserID)
 		c.Set(ContextKeyUsername, claims.Username)
 		c.Set(ContextKeyRole, string(claims.Role)) // Convert Role to string for context
+		c.Set(ContextKeyOrgID, claims.OrgID)
 		c.Set(ContextKeyClaims, claims)
 
-		m.logger.Debug("User authenticated",
+		RequestLogger(c, m.logger).Debug("User authenticated",
 			zap.String("user_id", claims.UserID),
 			zap.String("username", claims.Username),
 			zap.String("role", string(claims.Role)))
@@ -82,6 +108,51 @@ func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
 	}
 }
 
+// authenticateAPIKey validates an API key and enforces its rate limit. API
+// key requests carry the owning user's ID and name but no role, so only
+// routes guarded by RequirePermission accept them, and then only within
+// the key's scopes.
+func (m *AuthMiddleware) authenticateAPIKey(c *gin.Context, key string) {
+	apiKey, err := m.apiKeys.Authenticate(c.Request.Context(), key)
+	if err != nil {
+		if !errors.Is(err, security.ErrInvalidAPIKey) {
+			RequestLogger(c, m.logger).Error("Failed to authenticate API key", zap.Error(err))
+		}
+		RequestLogger(c, m.logger).Debug("Invalid API key",
+			zap.String("path", c.Request.URL.Path))
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": "Invalid or expired API key",
+		})
+		c.Abort()
+		return
+	}
+
+	c.Set(ContextKeyUserID, apiKey.UserID)
+	c.Set(ContextKeyUsername, apiKey.Username)
+	c.Set(ContextKeyOrgID, apiKey.OrgID)
+	c.Set(ContextKeyAPIKey, apiKey)
+
+	if ok, retryAfter := m.apiKeys.Allow(apiKey); !ok {
+		RequestLogger(c, m.logger).Warn("API key rate limit exceeded",
+			zap.String("api_key_id", apiKey.ID),
+			zap.String("path", c.Request.URL.Path))
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":   "too_many_requests",
+			"message": "API key rate limit exceeded",
+		})
+		c.Abort()
+		return
+	}
+
+	RequestLogger(c, m.logger).Debug("API key authenticated",
+		zap.String("api_key_id", apiKey.ID),
+		zap.String("user_id", apiKey.UserID))
+
+	c.Next()
+}
+
 // Optional makes authentication optional - validates token if present but doesn't require it
 func (m *AuthMiddleware) Optional() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -95,7 +166,7 @@ func (m *AuthMiddleware) Optional() gin.HandlerFunc {
 		claims, err := m.jwtManager.ValidateToken(token)
 		if err != nil {
 			// Invalid token, but don't block request
-			m.logger.Debug("Invalid token in optional auth",
+			RequestLogger(c, m.logger).Debug("Invalid token in optional auth",
 				zap.Error(err))
 			c.Next()
 			return
@@ -105,6 +176,7 @@ func (m *AuthMiddleware) Optional() gin.HandlerFunc {
 		c.Set(ContextKeyUserID, claims.UserID)
 		c.Set(ContextKeyUsername, claims.Username)
 		c.Set(ContextKeyRole, string(claims.Role)) // Convert Role to string for context
+		c.Set(ContextKeyOrgID, claims.OrgID)
 		c.Set(ContextKeyClaims, claims)
 
 		c.Next()
@@ -167,6 +239,27 @@ func GetRole(c *gin.Context) string {
 	return ""
 }
 
+// GetOrgID retrieves the organization a request acts within. Requests
+// without one, such as those with tokens issued before organizations,
+// act within the default organization.
+func GetOrgID(c *gin.Context) string {
+	if orgID := c.GetString(ContextKeyOrgID); orgID != "" {
+		return orgID
+	}
+	return models.DefaultOrganizationID
+}
+
+// GetAPIKey retrieves the API key a request authenticated with, or nil for
+// JWT-authenticated requests
+func GetAPIKey(c *gin.Context) *models.APIKey {
+	if apiKey, exists := c.Get(ContextKeyAPIKey); exists {
+		if k, ok := apiKey.(*models.APIKey); ok {
+			return k
+		}
+	}
+	return nil
+}
+
 // GetClaims retrieves JWT claims from context
 func GetClaims(c *gin.Context) *security.Claims {
 	if claims, exists := c.Get(ContextKeyClaims); exists {
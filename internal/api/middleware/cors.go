@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsAllowedHeaders are the request headers browsers may send cross-origin
+const corsAllowedHeaders = "Authorization, Content-Type, Accept, Cache-Control, X-Requested-With, X-API-Key, X-Request-ID, Idempotency-Key, If-None-Match"
+
+// corsExposedHeaders are the response headers cross-origin scripts may read
+const corsExposedHeaders = "Content-Disposition, Retry-After, X-Request-ID, Idempotent-Replayed, ETag"
+
+// CORSConfig holds configuration for the CORS middleware
+type CORSConfig struct {
+	// AllowedOrigins are the origins, such as https://stablerisk.example.com,
+	// whose scripts may call the API with credentials. "*" allows any
+	// origin, but then without credentials.
+	AllowedOrigins []string
+	AllowedMethods []string
+	MaxAge         time.Duration // How long browsers may cache a preflight response
+}
+
+// CORS answers preflight requests and adds CORS headers to responses for
+// allowed origins. Requests from other origins are still served, as
+// browsers block cross-origin scripts from reading the response, but
+// their preflight requests are refused.
+func CORS(config CORSConfig) gin.HandlerFunc {
+	origins := make(map[string]bool, len(config.AllowedOrigins))
+	anyOrigin := false
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			anyOrigin = true
+		}
+		origins[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	methods := make([]string, 0, len(config.AllowedMethods))
+	for _, method := range config.AllowedMethods {
+		methods = append(methods, strings.ToUpper(method))
+	}
+	allowedMethods := strings.Join(methods, ", ")
+	maxAge := strconv.Itoa(int(config.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+
+		allowed := anyOrigin || origins[origin]
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if !allowed {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		if anyOrigin {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			header.Set("Access-Control-Allow-Methods", allowedMethods)
+			header.Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			header.Set("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		header.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		c.Next()
+	}
+}
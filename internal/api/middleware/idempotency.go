@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"go.uber.org/zap"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client's key for a mutation
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotentReplayedHeader marks a response replayed from an earlier
+	// request with the same key
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	// ContextKeyIdempotentReplay is set on requests answered from a stored
+	// response, for the audit log
+	ContextKeyIdempotentReplay = "idempotent_replay"
+
+	// maxIdempotencyKeyLength bounds keys accepted from clients
+	maxIdempotencyKeyLength = 255
+)
+
+// Idempotency makes a mutation safe to retry. A request with an
+// Idempotency-Key header is processed once per key and caller; a retry of
+// the same request gets the stored response, with Idempotent-Replayed:
+// true, without the handler running again, so state changes and their
+// audit entries are not repeated. A key reused for a different request is
+// refused with 422, and one whose first request is still running with 409.
+// Server errors and 429s are not stored, so those can be retried. Requests
+// without the header are processed as usual, as are all requests if store
+// is nil. It must run after Authenticate, since keys belong to the caller.
+func Idempotency(store *security.IdempotencyStore, logger *zap.Logger) gin.HandlerFunc {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		principal := idempotencyPrincipal(c)
+		if store == nil || key == "" || principal == "" {
+			c.Next()
+			return
+		}
+		if !validIdempotencyKey(key) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": "Idempotency-Key must be 1 to 255 printable ASCII characters",
+			})
+			return
+		}
+
+		requestHash, err := hashRequest(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": "Failed to read request body",
+			})
+			return
+		}
+
+		ctx := c.Request.Context()
+		stored, err := store.Begin(ctx, principal, key, requestHash)
+		switch {
+		case errors.Is(err, security.ErrIdempotencyKeyReused):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+				"error":   "unprocessable_entity",
+				"message": "Idempotency-Key was already used for a different request",
+			})
+			return
+		case errors.Is(err, security.ErrIdempotencyKeyInUse):
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error":   "conflict",
+				"message": "A request with this Idempotency-Key is still being processed",
+			})
+			return
+		case err != nil:
+			// Process the request without a key rather than refuse it
+			// while the database is unavailable
+			RequestLogger(c, logger).Error("Failed to check idempotency key", zap.Error(err))
+			c.Next()
+			return
+		case stored != nil:
+			c.Set(ContextKeyIdempotentReplay, true)
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(stored.StatusCode, stored.ContentType, stored.Body)
+			c.Abort()
+			return
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		// A client that disconnects, the timeout a retry follows, cancels
+		// the request context once the handler has made its change; the
+		// outcome must still be recorded, or the retry would repeat it
+		ctx = context.WithoutCancel(ctx)
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+			if err := store.Release(ctx, principal, key); err != nil {
+				RequestLogger(c, logger).Error("Failed to release idempotency key", zap.Error(err))
+			}
+			return
+		}
+		if err := store.Complete(ctx, principal, key, security.IdempotentResponse{
+			StatusCode:  status,
+			ContentType: writer.Header().Get("Content-Type"),
+			Body:        writer.body.Bytes(),
+		}); err != nil {
+			RequestLogger(c, logger).Error("Failed to store idempotent response", zap.Error(err))
+		}
+	}
+}
+
+// IsIdempotentReplay reports whether the request was answered from a
+// stored response
+func IsIdempotentReplay(c *gin.Context) bool {
+	return c.GetBool(ContextKeyIdempotentReplay)
+}
+
+// idempotencyPrincipal identifies who a key belongs to: the API key for
+// API key requests, otherwise the user
+func idempotencyPrincipal(c *gin.Context) string {
+	if apiKey := GetAPIKey(c); apiKey != nil {
+		return "api_key:" + apiKey.ID
+	}
+	return GetUserID(c)
+}
+
+// validIdempotencyKey reports whether a client-supplied key is short and
+// printable ASCII
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// hashRequest fingerprints the method, path, query and body, restoring
+// the body for the handler
+func hashRequest(c *gin.Context) (string, error) {
+	var body []byte
+	if c.Request.Body != nil {
+		var err error
+		body, err = io.ReadAll(c.Request.Body)
+		if err != nil {
+			return "", err
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	h := sha256.New()
+	h.Write([]byte(c.Request.Method + "\n" + c.Request.URL.Path + "\n" + c.Request.URL.RawQuery + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// idempotencyWriter keeps a copy of the response body to store
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write copies the response body
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// WriteString copies the response body
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Unwrap returns the underlying writer
+func (w *idempotencyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -4,32 +4,47 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/security"
 	"github.com/mikedewar/stablerisk/pkg/models"
 	"go.uber.org/zap"
 )
 
 // RBACMiddleware handles role-based access control
 type RBACMiddleware struct {
+	roles  security.PermissionChecker
 	logger *zap.Logger
 }
 
-// NewRBACMiddleware creates a new RBAC middleware
+// NewRBACMiddleware creates a new RBAC middleware. Roles grant the
+// built-in permissions until SetRoles is called.
 func NewRBACMiddleware(logger *zap.Logger) *RBACMiddleware {
 	if logger == nil {
 		logger = zap.NewNop()
 	}
 
 	return &RBACMiddleware{
+		roles:  security.DefaultRoles,
 		logger: logger,
 	}
 }
 
+// SetRoles sets where role permissions are looked up, normally a
+// security.RoleStore
+func (m *RBACMiddleware) SetRoles(roles security.PermissionChecker) {
+	m.roles = roles
+}
+
 // RequireRole checks if user has one of the required roles
 func (m *RBACMiddleware) RequireRole(allowedRoles ...models.Role) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := GetAPIKey(c); apiKey != nil {
+			m.denyAPIKey(c, apiKey, "")
+			return
+		}
+
 		userRole := GetRole(c)
 		if userRole == "" {
-			m.logger.Warn("RBAC check failed: no role in context",
+			RequestLogger(c, m.logger).Warn("RBAC check failed: no role in context",
 				zap.String("path", c.Request.URL.Path),
 				zap.String("method", c.Request.Method))
 			c.JSON(http.StatusForbidden, gin.H{
@@ -44,7 +59,7 @@ func (m *RBACMiddleware) RequireRole(allowedRoles ...models.Role) gin.HandlerFun
 		role := models.Role(userRole)
 		for _, allowedRole := range allowedRoles {
 			if role == allowedRole {
-				m.logger.Debug("RBAC check passed",
+				RequestLogger(c, m.logger).Debug("RBAC check passed",
 					zap.String("user_id", GetUserID(c)),
 					zap.String("role", userRole),
 					zap.String("path", c.Request.URL.Path))
@@ -54,7 +69,7 @@ func (m *RBACMiddleware) RequireRole(allowedRoles ...models.Role) gin.HandlerFun
 		}
 
 		// Access denied
-		m.logger.Warn("RBAC check failed: insufficient permissions",
+		RequestLogger(c, m.logger).Warn("RBAC check failed: insufficient permissions",
 			zap.String("user_id", GetUserID(c)),
 			zap.String("user_role", userRole),
 			zap.Strings("allowed_roles", rolesToStrings(allowedRoles)),
@@ -83,11 +98,145 @@ func (m *RBACMiddleware) RequireViewer() gin.HandlerFunc {
 	return m.RequireRole(models.RoleAdmin, models.RoleAnalyst, models.RoleViewer)
 }
 
+// RequireUser checks that the request comes from a user rather than an API
+// key, whatever their role
+func (m *RBACMiddleware) RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if apiKey := GetAPIKey(c); apiKey != nil {
+			m.denyAPIKey(c, apiKey, "")
+			return
+		}
+
+		if GetRole(c) == "" {
+			RequestLogger(c, m.logger).Warn("RBAC check failed: no role in context",
+				zap.String("path", c.Request.URL.Path),
+				zap.String("method", c.Request.Method))
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "forbidden",
+				"message": "Access denied: authentication required",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission checks if the user's role grants a specific permission.
+// System permissions are further limited to the default organization.
+func (m *RBACMiddleware) RequirePermission(permission Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if SystemPermission(permission) && GetOrgID(c) != models.DefaultOrganizationID {
+			RequestLogger(c, m.logger).Warn("RBAC check failed: system permission outside the default organization",
+				zap.String("user_id", GetUserID(c)),
+				zap.String("org_id", GetOrgID(c)),
+				zap.String("permission", string(permission)),
+				zap.String("path", c.Request.URL.Path))
+
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "forbidden",
+				"message": "Access denied: reserved for the operating organization",
+			})
+			c.Abort()
+			return
+		}
+
+		if apiKey := GetAPIKey(c); apiKey != nil {
+			if !m.apiKeyHasPermission(c, apiKey, permission) {
+				m.denyAPIKey(c, apiKey, permission)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		userRole := GetRole(c)
+		if userRole == "" {
+			RequestLogger(c, m.logger).Warn("RBAC check failed: no role in context",
+				zap.String("path", c.Request.URL.Path),
+				zap.String("method", c.Request.Method))
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "forbidden",
+				"message": "Access denied: authentication required",
+			})
+			c.Abort()
+			return
+		}
+
+		if !m.roles.HasPermission(c.Request.Context(), models.Role(userRole), string(permission)) {
+			RequestLogger(c, m.logger).Warn("RBAC check failed: missing permission",
+				zap.String("user_id", GetUserID(c)),
+				zap.String("user_role", userRole),
+				zap.String("permission", string(permission)),
+				zap.String("path", c.Request.URL.Path))
+
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "forbidden",
+				"message": "Access denied: insufficient permissions",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // HasPermission checks if the current user has a specific permission
 // This is a helper function for more granular permission checks
-func HasPermission(c *gin.Context, permission Permission) bool {
+func (m *RBACMiddleware) HasPermission(c *gin.Context, permission Permission) bool {
+	if SystemPermission(permission) && GetOrgID(c) != models.DefaultOrganizationID {
+		return false
+	}
+	if apiKey := GetAPIKey(c); apiKey != nil {
+		return m.apiKeyHasPermission(c, apiKey, permission)
+	}
 	role := models.Role(GetRole(c))
-	return roleHasPermission(role, permission)
+	return m.roles.HasPermission(c.Request.Context(), role, string(permission))
+}
+
+// denyAPIKey rejects an API key request for a role-guarded route, or for a
+// permission outside the key's scopes
+func (m *RBACMiddleware) denyAPIKey(c *gin.Context, apiKey *models.APIKey, permission Permission) {
+	RequestLogger(c, m.logger).Warn("RBAC check failed: API key not permitted",
+		zap.String("api_key_id", apiKey.ID),
+		zap.String("permission", string(permission)),
+		zap.String("path", c.Request.URL.Path))
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "forbidden",
+		"message": "Access denied: not permitted for this API key",
+	})
+	c.Abort()
+}
+
+// APIKeyPermissions are the permissions an API key may be scoped to. Users
+// and system settings are managed interactively, never with API keys.
+var APIKeyPermissions = []Permission{
+	PermissionReadOutliers,
+	PermissionReadTransactions,
+	PermissionReadStatistics,
+	PermissionWriteOutliers,
+	PermissionTriggerDetection,
+}
+
+// APIKeyScope reports whether API keys may be scoped to scope. The owner's
+// role must grant it too.
+func APIKeyScope(scope string) bool {
+	for _, permission := range APIKeyPermissions {
+		if string(permission) == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyHasPermission checks that both the key's scopes and its owner's
+// current role grant a permission, so demoting the owner narrows the key
+func (m *RBACMiddleware) apiKeyHasPermission(c *gin.Context, apiKey *models.APIKey, permission Permission) bool {
+	return apiKey.HasScope(string(permission)) && APIKeyScope(string(permission)) &&
+		m.roles.HasPermission(c.Request.Context(), apiKey.Role, string(permission))
 }
 
 // Permission represents a specific action permission
@@ -99,48 +248,65 @@ const (
 	PermissionReadTransactions  Permission = "read:transactions"
 	PermissionReadStatistics    Permission = "read:statistics"
 	PermissionReadUsers         Permission = "read:users"
+	PermissionReadAudit         Permission = "read:audit"
+
+	// Stream permissions
+	PermissionStreamTransactions Permission = "stream:transactions"
 
 	// Write permissions
 	PermissionWriteOutliers     Permission = "write:outliers"
 	PermissionTriggerDetection  Permission = "trigger:detection"
 	PermissionManageUsers       Permission = "manage:users"
 	PermissionManageSystem      Permission = "manage:system"
+	PermissionManageWebhooks    Permission = "manage:webhooks"
+
+	// Export permissions
+	PermissionExportSAR Permission = "export:sar"
 )
 
-// roleHasPermission checks if a role has a specific permission
-func roleHasPermission(role models.Role, permission Permission) bool {
-	switch role {
-	case models.RoleAdmin:
-		// Admin has all permissions
-		return true
-
-	case models.RoleAnalyst:
-		// Analyst can read everything and write outliers (acknowledge)
-		switch permission {
-		case PermissionReadOutliers,
-			PermissionReadTransactions,
-			PermissionReadStatistics,
-			PermissionWriteOutliers,
-			PermissionTriggerDetection:
+// Permissions lists every permission a role can be granted
+var Permissions = []Permission{
+	PermissionReadOutliers,
+	PermissionReadTransactions,
+	PermissionReadStatistics,
+	PermissionReadUsers,
+	PermissionReadAudit,
+	PermissionStreamTransactions,
+	PermissionWriteOutliers,
+	PermissionTriggerDetection,
+	PermissionManageUsers,
+	PermissionManageSystem,
+	PermissionManageWebhooks,
+	PermissionExportSAR,
+}
+
+// SystemPermissions act on the whole instance rather than one
+// organization, such as roles, detection settings, organizations and the
+// audit log, so only members of the default organization, which operates
+// the instance, are granted them
+var SystemPermissions = []Permission{
+	PermissionReadAudit,
+	PermissionManageSystem,
+}
+
+// SystemPermission reports whether permission is one of SystemPermissions
+func SystemPermission(permission Permission) bool {
+	for _, p := range SystemPermissions {
+		if p == permission {
 			return true
-		default:
-			return false
 		}
+	}
+	return false
+}
 
-	case models.RoleViewer:
-		// Viewer can only read
-		switch permission {
-		case PermissionReadOutliers,
-			PermissionReadTransactions,
-			PermissionReadStatistics:
+// KnownPermission reports whether permission is one of Permissions
+func KnownPermission(permission string) bool {
+	for _, p := range Permissions {
+		if string(p) == permission {
 			return true
-		default:
-			return false
 		}
-
-	default:
-		return false
 	}
+	return false
 }
 
 // rolesToStrings converts role slice to string slice for logging
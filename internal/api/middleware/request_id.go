@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mikedewar/stablerisk/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// RequestIDHeader carries the request ID in requests and responses
+	RequestIDHeader = "X-Request-ID"
+
+	// ContextKeyRequestID is the context key for the request ID
+	ContextKeyRequestID = "request_id"
+
+	// maxRequestIDLength bounds request IDs accepted from clients
+	maxRequestIDLength = 128
+)
+
+// RequestID gives every request an ID, returned in the X-Request-ID
+// response header so a user reporting an error can quote it. An ID sent by
+// the client or a proxy in X-Request-ID is kept if it is short and plain,
+// so one ID follows the request through every hop; otherwise a new one is
+// generated. It should run before any middleware that logs.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+
+		c.Set(ContextKeyRequestID, id)
+		c.Request = c.Request.WithContext(utils.WithRequestID(c.Request.Context(), id))
+		c.Header(RequestIDHeader, id)
+
+		c.Next()
+	}
+}
+
+// validRequestID reports whether a client-supplied ID is safe to log and
+// echo: letters, digits and . _ : - only
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == ':', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// GetRequestID retrieves the request ID from context
+func GetRequestID(c *gin.Context) string {
+	if requestID, exists := c.Get(ContextKeyRequestID); exists {
+		if id, ok := requestID.(string); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// RequestLogger returns logger with the request's ID attached, so every
+// line logged while serving the request can be found from the ID
+func RequestLogger(c *gin.Context, logger *zap.Logger) *zap.Logger {
+	if id := GetRequestID(c); id != "" {
+		return logger.With(zap.String("request_id", id))
+	}
+	return logger
+}
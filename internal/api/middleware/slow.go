@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/internal/tracing"
+	"go.uber.org/zap"
+)
+
+// SlowRequests logs a warning, and counts it in
+// stablerisk_http_slow_requests_total, for each request taking longer than
+// threshold. Query parameter values may hold addresses or tokens, so only
+// their names are logged. WebSocket upgrades are long-lived by design and
+// are skipped.
+func SlowRequests(threshold time.Duration, logger *zap.Logger) gin.HandlerFunc {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return func(c *gin.Context) {
+		if threshold <= 0 || c.IsWebsocket() {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+
+		c.Next()
+
+		elapsed := time.Since(start)
+		if elapsed < threshold {
+			return
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.SlowRequests.WithLabelValues(c.Request.Method, route).Inc()
+
+		params := make([]string, 0, len(c.Request.URL.Query()))
+		for name := range c.Request.URL.Query() {
+			params = append(params, name)
+		}
+		sort.Strings(params)
+
+		fields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("route", route),
+			zap.String("path", c.Request.URL.Path),
+			zap.Strings("query_params", params),
+			zap.String("status", strconv.Itoa(c.Writer.Status())),
+			zap.Duration("duration", elapsed),
+			zap.Duration("threshold", threshold),
+		}
+		if requestID := GetRequestID(c); requestID != "" {
+			fields = append(fields, zap.String("request_id", requestID))
+		}
+		if userID, exists := c.Get(ContextKeyUserID); exists {
+			fields = append(fields, zap.Any("user_id", userID))
+		}
+		if sc := tracing.SpanFromContext(c.Request.Context()).SpanContext(); sc.IsValid() {
+			fields = append(fields, zap.String("trace_id", sc.TraceID.String()))
+		}
+		logger.Warn("Slow HTTP request", fields...)
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/tracing"
+)
+
+// Tracing records a server span for every request, continuing the trace
+// from an incoming traceparent header. Handlers that pass
+// c.Request.Context() on to Raphtory, Postgres or detection calls get those
+// calls recorded as children of the request.
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := tracing.Extract(c.Request.Context(), c.Request.Header)
+
+		// The route template is only known once routing has matched, which
+		// happens before middleware runs
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := tracing.Start(ctx, c.Request.Method+" "+route,
+			tracing.WithKind(tracing.KindServer),
+			tracing.WithAttributes(
+				tracing.String("http.request.method", c.Request.Method),
+				tracing.String("http.route", route),
+				tracing.String("url.path", c.Request.URL.Path),
+			))
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		if sc := span.SpanContext(); sc.IsValid() {
+			c.Header("X-Trace-Id", sc.TraceID.String())
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(tracing.Int("http.response.status_code", status))
+		if status >= 500 {
+			span.SetStatus(tracing.StatusError, "HTTP "+strconv.Itoa(status))
+		}
+		if len(c.Errors) > 0 {
+			span.SetAttributes(tracing.String("error.message", c.Errors.String()))
+		}
+	}
+}
@@ -3,19 +3,38 @@ package api
 import (
 	"time"
 
+	"github.com/mikedewar/stablerisk/internal/security"
 	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
 )
 
+// OutlierFilter selects outliers, from the query parameters of a list or
+// the body of a bulk acknowledgement
+type OutlierFilter struct {
+	Type          []string   `form:"type" json:"type,omitempty"`               // Repeated or comma separated
+	Severity      []string   `form:"severity" json:"severity,omitempty"`       // Repeated or comma separated
+	Address       []string   `form:"address" json:"address,omitempty"`         // Repeated or comma separated
+	Status        []string   `form:"status" json:"status,omitempty"`           // Repeated or comma separated
+	AssignedTo    string     `form:"assigned_to" json:"assigned_to,omitempty"` // User ID, "me" or "none"
+	Acknowledged  *bool      `form:"acknowledged" json:"acknowledged,omitempty"`
+	Invalidated   *bool      `form:"invalidated" json:"invalidated,omitempty"`
+	Archived      string     `form:"archived" json:"archived,omitempty"` // "false" (default), "true" or "all"
+	FromTimestamp *time.Time `form:"from" json:"from,omitempty"`
+	ToTimestamp   *time.Time `form:"to" json:"to,omitempty"`
+	MinAmount     string     `form:"min_amount" json:"min_amount,omitempty"` // Decimal
+	MaxAmount     string     `form:"max_amount" json:"max_amount,omitempty"` // Decimal
+}
+
 // OutlierListRequest represents query parameters for listing outliers
 type OutlierListRequest struct {
-	Page          int                 `form:"page" binding:"omitempty,min=1"`
-	Limit         int                 `form:"limit" binding:"omitempty,min=1,max=100"`
-	Type          models.OutlierType  `form:"type" binding:"omitempty"`
-	Severity      models.Severity     `form:"severity" binding:"omitempty"`
-	Address       string              `form:"address" binding:"omitempty"`
-	Acknowledged  *bool               `form:"acknowledged" binding:"omitempty"`
-	FromTimestamp *time.Time          `form:"from" binding:"omitempty"`
-	ToTimestamp   *time.Time          `form:"to" binding:"omitempty"`
+	Page  int `form:"page" binding:"omitempty,min=1"`
+	Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
+	OutlierFilter
+	Sort string `form:"sort" binding:"omitempty"` // detected_at, severity, amount or z_score; "-" prefix for descending
+	// AfterID and AfterDetectedAt continue a detected_at-sorted list after
+	// the given outlier, in place of page
+	AfterID         string     `form:"after_id" binding:"omitempty"`
+	AfterDetectedAt *time.Time `form:"after_detected_at" binding:"omitempty"`
 }
 
 // OutlierListResponse represents a paginated list of outliers
@@ -25,11 +44,395 @@ type OutlierListResponse struct {
 	Page       int              `json:"page"`
 	Limit      int              `json:"limit"`
 	TotalPages int              `json:"total_pages"`
+	// NextAfterID and NextAfterDetectedAt are the cursor for the next page
+	// of a detected_at-sorted list, unset on the last page
+	NextAfterID         string     `json:"next_after_id,omitempty"`
+	NextAfterDetectedAt *time.Time `json:"next_after_detected_at,omitempty"`
 }
 
 // AcknowledgeOutlierRequest represents a request to acknowledge an outlier
 type AcknowledgeOutlierRequest struct {
-	Notes string `json:"notes"`
+	Notes string               `json:"notes"`
+	Label models.FeedbackLabel `json:"label" binding:"omitempty,oneof=true_positive false_positive"`
+}
+
+// UpdateOutlierStatusRequest represents a request to move an outlier
+// through the triage workflow
+type UpdateOutlierStatusRequest struct {
+	Status models.OutlierStatus `json:"status" binding:"required"`
+	Notes  string               `json:"notes"`
+}
+
+// OutlierStatusHistoryResponse represents the status history of an outlier
+type OutlierStatusHistoryResponse struct {
+	OutlierID string                       `json:"outlier_id"`
+	Status    models.OutlierStatus         `json:"status"`
+	History   []models.OutlierStatusChange `json:"history"`
+}
+
+// AssignOutlierRequest represents a request to assign an outlier to a
+// user; an empty user ID unassigns it
+type AssignOutlierRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// OutlierAssignment represents who an outlier is assigned to
+type OutlierAssignment struct {
+	OutlierID        string    `json:"outlier_id"`
+	AssignedTo       string    `json:"assigned_to,omitempty"`
+	PreviousAssignee string    `json:"previous_assignee,omitempty"`
+	AssignedBy       string    `json:"assigned_by"`
+	AssignedAt       time.Time `json:"assigned_at"`
+}
+
+// DetectionRunRequest represents a request to run detection on demand
+type DetectionRunRequest struct {
+	From      *time.Time `json:"from"`
+	To        *time.Time `json:"to"`
+	Addresses []string   `json:"addresses" binding:"omitempty,max=100"`
+	Token     string     `json:"token"` // Only analyse transfers of this token, e.g. USDC
+	Async     bool       `json:"async"` // Return a job ID immediately instead of waiting
+}
+
+// DetectionRunListRequest represents query parameters for listing detection runs
+type DetectionRunListRequest struct {
+	Page    int                        `form:"page" binding:"omitempty,min=1"`
+	Limit   int                        `form:"limit" binding:"omitempty,min=1,max=100"`
+	Status  models.DetectionRunStatus  `form:"status" binding:"omitempty,oneof=running completed failed"`
+	Trigger models.DetectionRunTrigger `form:"trigger" binding:"omitempty,oneof=scheduled manual"`
+}
+
+// DetectionRunListResponse represents a paginated list of detection runs
+type DetectionRunListResponse struct {
+	Runs       []models.DetectionRun `json:"runs"`
+	Total      int                   `json:"total"`
+	Page       int                   `json:"page"`
+	Limit      int                   `json:"limit"`
+	TotalPages int                   `json:"total_pages"`
+}
+
+// DetectionConfig is the detection configuration that can be changed while
+// detection runs. Durations are Go duration strings, e.g. "24h".
+type DetectionConfig struct {
+	Enabled           map[models.OutlierType]bool `json:"enabled"` // By the outlier type each detector raises
+	MinDataPoints     int                         `json:"min_data_points"`
+	WindowDuration    string                      `json:"window_duration"`
+	ZScoreThreshold   float64                     `json:"zscore_threshold"`
+	IQRMultiplier     float64                     `json:"iqr_multiplier"`
+	DBSCANEpsilon     float64                     `json:"dbscan_epsilon"`
+	DBSCANMinPoints   int                         `json:"dbscan_min_points"`
+	CirculationWindow string                      `json:"circulation_window"`
+	FanWindow         string                      `json:"fan_window"`
+	FanOutThreshold   int                         `json:"fan_out_threshold"`
+	FanInThreshold    int                         `json:"fan_in_threshold"`
+	VelocityWindow    string                      `json:"velocity_window"`
+	VelocityThreshold int                         `json:"velocity_threshold"`
+	ClusterWindow     string                      `json:"cluster_window"`
+	ClusterMinSize    int                         `json:"cluster_min_size"`
+	ClusterMinDensity float64                     `json:"cluster_min_density"`
+}
+
+// DetectionConfigResponse is the detection configuration detectors run with
+type DetectionConfigResponse struct {
+	DetectionConfig
+	Source    string     `json:"source"`            // file until first saved through the API, then database
+	Version   int        `json:"version,omitempty"` // Incremented by every save
+	UpdatedBy string     `json:"updated_by,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// IssuerEventListRequest represents query parameters for listing issuer events
+type IssuerEventListRequest struct {
+	Page    int                    `form:"page" binding:"omitempty,min=1"`
+	Limit   int                    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Type    models.IssuerEventType `form:"type" binding:"omitempty,oneof=blacklisted unblacklisted funds_destroyed issue redeem"`
+	Address string                 `form:"address"`
+}
+
+// IssuerEventListResponse represents a paginated list of issuer events
+type IssuerEventListResponse struct {
+	Events     []models.IssuerEvent `json:"events"`
+	Total      int                  `json:"total"`
+	Page       int                  `json:"page"`
+	Limit      int                  `json:"limit"`
+	TotalPages int                  `json:"total_pages"`
+}
+
+// TransactionListRequest represents query parameters for listing
+// transactions from the graph
+type TransactionListRequest struct {
+	Page      int        `form:"page" binding:"min=1"`
+	Limit     int        `form:"limit" binding:"min=1,max=1000"`
+	Address   string     `form:"address"` // Sender or receiver
+	From      *time.Time `form:"from" binding:"omitempty"`
+	To        *time.Time `form:"to" binding:"omitempty"`
+	MinAmount string     `form:"min_amount"` // Decimal
+	MaxAmount string     `form:"max_amount"` // Decimal
+}
+
+// TransactionListResponse represents a paginated list of transactions,
+// newest first
+type TransactionListResponse struct {
+	Transactions []models.Transaction `json:"transactions"`
+	Total        int                  `json:"total"`
+	Page         int                  `json:"page"`
+	Limit        int                  `json:"limit"`
+	TotalPages   int                  `json:"total_pages"`
+	// Labels are the known entities among the page's senders and receivers, by address
+	Labels map[string]models.AddressLabel `json:"labels,omitempty"`
+}
+
+// AddressProfileRequest represents query parameters for an address profile
+type AddressProfileRequest struct {
+	Outliers       int `form:"outliers" binding:"omitempty,min=1,max=100"`       // Recent outliers to include
+	Counterparties int `form:"counterparties" binding:"omitempty,min=1,max=100"` // Top counterparties to include
+}
+
+// AddressWatchlistStatus represents whether an address is being watched or
+// has been frozen
+type AddressWatchlistStatus struct {
+	Watchlisted   bool                    `json:"watchlisted"`
+	Watchlist     string                  `json:"watchlist,omitempty"` // Watchlist the address is tagged with in the graph
+	Entries       []models.WatchlistEntry `json:"entries,omitempty"`   // Unexpired entries on the API's watchlists
+	Blacklisted   bool                    `json:"blacklisted"`         // Blacklisted by the token issuer
+	BlacklistedAt *time.Time              `json:"blacklisted_at,omitempty"`
+}
+
+// AddressCounterparty is an address that has transacted directly with a
+// profiled address. Sent and Received are from the profiled address's side.
+type AddressCounterparty struct {
+	Address          string               `json:"address"`
+	TransactionCount int                  `json:"transaction_count"`
+	SentCount        int                  `json:"sent_count"`
+	ReceivedCount    int                  `json:"received_count"`
+	Sent             decimal.Decimal      `json:"sent"`
+	Received         decimal.Decimal      `json:"received"`
+	FirstSeen        *time.Time           `json:"first_seen,omitempty"`
+	LastSeen         *time.Time           `json:"last_seen,omitempty"`
+	RiskScore        float64              `json:"risk_score"`
+	MaxSeverity      models.Severity      `json:"max_severity,omitempty"`
+	Label            string               `json:"label,omitempty"`
+	Category         models.LabelCategory `json:"category,omitempty"`
+}
+
+// AddressProfileResponse represents everything known about an address.
+// Graph fields are left empty when Raphtory cannot be reached, with
+// GraphAvailable false.
+type AddressProfileResponse struct {
+	Address          string                 `json:"address"`
+	GraphAvailable   bool                   `json:"graph_available"`
+	FirstSeen        *time.Time             `json:"first_seen,omitempty"`
+	LastSeen         *time.Time             `json:"last_seen,omitempty"`
+	TransactionCount int                    `json:"transaction_count"`
+	SentCount        int                    `json:"sent_count"`
+	ReceivedCount    int                    `json:"received_count"`
+	TotalSent        float64                `json:"total_sent"`
+	TotalReceived    float64                `json:"total_received"`
+	Label            string                 `json:"label,omitempty"`  // Known entity, from address labels or else the graph
+	Entity           *models.AddressLabel   `json:"entity,omitempty"` // The address label, when there is one
+	RiskScore        float64                `json:"risk_score"`       // 0 with no outliers, up to 1 for a critical one
+	MaxSeverity      models.Severity        `json:"max_severity,omitempty"`
+	OutlierCount     int                    `json:"outlier_count"`   // Outliers that have not been invalidated
+	RecentOutliers   []models.Outlier       `json:"recent_outliers"` // Newest first, including invalidated ones
+	Watchlist        AddressWatchlistStatus `json:"watchlist"`
+	Counterparties   []AddressCounterparty  `json:"counterparties"` // Most transactions first
+	// CounterpartiesTruncated is set when Raphtory stopped at its
+	// counterparty limit, so the top counterparties may be incomplete
+	CounterpartiesTruncated bool `json:"counterparties_truncated"`
+	// ExternalRisk is a chain-analytics provider's latest screening of the
+	// address, when enrichment has screened it
+	ExternalRisk *models.AddressScreening `json:"external_risk,omitempty"`
+}
+
+// AddressLabelListRequest represents query parameters for listing address labels
+type AddressLabelListRequest struct {
+	Page     int                  `form:"page" binding:"omitempty,min=1"`
+	Limit    int                  `form:"limit" binding:"omitempty,min=1,max=100"`
+	Category models.LabelCategory `form:"category"`
+	Source   string               `form:"source"`
+	Search   string               `form:"q"` // Part of the label, case-insensitive
+}
+
+// AddressLabelListResponse represents a paginated list of address labels
+type AddressLabelListResponse struct {
+	Labels     []models.AddressLabel `json:"labels"`
+	Total      int                   `json:"total"`
+	Page       int                   `json:"page"`
+	Limit      int                   `json:"limit"`
+	TotalPages int                   `json:"total_pages"`
+}
+
+// SetAddressLabelRequest represents a request to label an address
+type SetAddressLabelRequest struct {
+	Label    string               `json:"label" binding:"required,max=200"`
+	Category models.LabelCategory `json:"category" binding:"required"`
+	Source   string               `json:"source" binding:"max=100"` // Defaults to manual
+}
+
+// AddressLabelImportResponse reports the outcome of a label import
+type AddressLabelImportResponse struct {
+	Imported int                       `json:"imported"`
+	Skipped  []AddressLabelImportError `json:"skipped"`
+}
+
+// AddressLabelImportError is a CSV row an import skipped
+type AddressLabelImportError struct {
+	Line    int    `json:"line"`
+	Address string `json:"address,omitempty"`
+	Message string `json:"message"`
+}
+
+// FeatureFlagListResponse lists every feature flag
+type FeatureFlagListResponse struct {
+	Environment string               `json:"environment"` // Whose overrides decide each flag's active state
+	Flags       []models.FeatureFlag `json:"flags"`
+}
+
+// SetFeatureFlagRequest represents a request to set a feature flag
+type SetFeatureFlagRequest struct {
+	Enabled      *bool           `json:"enabled" binding:"required"` // For environments without an override
+	Environments map[string]bool `json:"environments"`               // Overrides by environment name
+}
+
+// GraphQLRequest represents a GraphQL query, as sent by GraphQL clients
+type GraphQLRequest struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// CreateWatchlistRequest represents a request to create a watchlist
+type CreateWatchlistRequest struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Description string `json:"description" binding:"max=1000"`
+}
+
+// UpdateWatchlistRequest represents a request to update a watchlist.
+// Omitted fields are left unchanged.
+type UpdateWatchlistRequest struct {
+	Name        *string `json:"name" binding:"omitempty,min=1,max=100"`
+	Description *string `json:"description" binding:"omitempty,max=1000"`
+}
+
+// WatchlistListResponse represents every watchlist
+type WatchlistListResponse struct {
+	Watchlists []models.Watchlist `json:"watchlists"`
+}
+
+// WatchlistRequest represents query parameters for reading a watchlist
+type WatchlistRequest struct {
+	IncludeExpired bool `form:"include_expired"`
+}
+
+// WatchlistResponse represents a watchlist and its entries, newest first
+type WatchlistResponse struct {
+	models.Watchlist
+	Entries []models.WatchlistEntry `json:"entries"`
+}
+
+// WatchlistEntryRequest represents a request to add an address to a
+// watchlist, or to replace an entry's reason and expiry. A null expiry
+// never expires.
+type WatchlistEntryRequest struct {
+	Address   string     `json:"address" binding:"omitempty,max=64"` // Required when adding; ignored when updating
+	Reason    string     `json:"reason" binding:"required,max=1000"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateWebhookRequest represents a request to register a webhook. Events
+// defaults to every event.
+type CreateWebhookRequest struct {
+	URL         string                `json:"url" binding:"required,max=2048"`
+	Description string                `json:"description" binding:"max=1000"`
+	Events      []models.WebhookEvent `json:"events"`
+	Enabled     *bool                 `json:"enabled"` // Defaults to true
+}
+
+// UpdateWebhookRequest represents a request to update a webhook. Omitted
+// fields are left unchanged.
+type UpdateWebhookRequest struct {
+	URL         *string                `json:"url" binding:"omitempty,max=2048"`
+	Description *string                `json:"description" binding:"omitempty,max=1000"`
+	Events      *[]models.WebhookEvent `json:"events"`
+	Enabled     *bool                  `json:"enabled"`
+}
+
+// CreateWebhookResponse carries a webhook and the secret its deliveries are
+// signed with. The secret cannot be retrieved again, only rotated.
+type CreateWebhookResponse struct {
+	models.Webhook
+	Secret string `json:"secret"`
+}
+
+// WebhookListResponse represents every webhook of an organization
+type WebhookListResponse struct {
+	Webhooks []models.Webhook `json:"webhooks"`
+}
+
+// WebhookDeliveryListRequest represents query parameters for listing a
+// webhook's deliveries
+type WebhookDeliveryListRequest struct {
+	Status models.WebhookDeliveryStatus `form:"status" binding:"omitempty,oneof=pending delivered failed"`
+	Limit  int                          `form:"limit" binding:"omitempty,min=1,max=500"`
+}
+
+// WebhookDeliveryListResponse represents a webhook's deliveries, newest
+// first
+type WebhookDeliveryListResponse struct {
+	Deliveries []models.WebhookDelivery `json:"deliveries"`
+}
+
+// SubgraphRequest represents query parameters for the graph around an address
+type SubgraphRequest struct {
+	Address string     `form:"address" binding:"required"`
+	Hops    int        `form:"hops" binding:"omitempty,min=1,max=3"`
+	From    *time.Time `form:"from" binding:"omitempty"`
+	To      *time.Time `form:"to" binding:"omitempty"`
+}
+
+// SubgraphNode is an address in a subgraph. Risk comes from the address's
+// outliers that have not been invalidated.
+type SubgraphNode struct {
+	ID               string          `json:"id"` // The address, for graph libraries that key nodes by id
+	Address          string          `json:"address"`
+	Hop              int             `json:"hop"` // 0 for the requested address
+	TransactionCount int             `json:"transaction_count"`
+	Sent             decimal.Decimal `json:"sent"`
+	Received         decimal.Decimal `json:"received"`
+	FirstSeen        *time.Time      `json:"first_seen,omitempty"`
+	LastSeen         *time.Time      `json:"last_seen,omitempty"`
+	RiskScore        float64         `json:"risk_score"` // 0 with no outliers, up to 1 for a critical one
+	OutlierCount     int             `json:"outlier_count"`
+	MaxSeverity      models.Severity `json:"max_severity,omitempty"`
+}
+
+// SubgraphEdge aggregates the transfers from one address to another
+type SubgraphEdge struct {
+	ID               string          `json:"id"`
+	Source           string          `json:"source"`
+	Target           string          `json:"target"`
+	TransactionCount int             `json:"transaction_count"`
+	Amount           decimal.Decimal `json:"amount"`
+	FirstSeen        *time.Time      `json:"first_seen,omitempty"`
+	LastSeen         *time.Time      `json:"last_seen,omitempty"`
+}
+
+// SubgraphResponse represents the addresses around an address and the
+// transfers between them
+type SubgraphResponse struct {
+	Address   string         `json:"address"`
+	Hops      int            `json:"hops"`
+	From      *time.Time     `json:"from,omitempty"`
+	To        *time.Time     `json:"to,omitempty"`
+	Nodes     []SubgraphNode `json:"nodes"`
+	Edges     []SubgraphEdge `json:"edges"`
+	Truncated bool           `json:"truncated"` // More addresses were in range than returned
+}
+
+// StatisticsRequest represents query parameters for statistics
+type StatisticsRequest struct {
+	Window string `form:"window"`                                 // Recent activity window, e.g. 1h or 24h (default 24h)
+	Top    int    `form:"top" binding:"omitempty,min=1,max=100"` // Top addresses by volume to include (default 10)
 }
 
 // StatisticsResponse represents overall statistics
@@ -38,8 +441,88 @@ type StatisticsResponse struct {
 	TotalOutliers     int64                      `json:"total_outliers"`
 	OutliersBySeverity map[models.Severity]int64 `json:"outliers_by_severity"`
 	OutliersByType    map[models.OutlierType]int64 `json:"outliers_by_type"`
-	LastDetectionRun  time.Time                  `json:"last_detection_run"`
+	LastDetectionRun  *time.Time                 `json:"last_detection_run,omitempty"`
 	DetectionRunning  bool                       `json:"detection_running"`
+	Graph             *GraphStats                `json:"graph,omitempty"`
+	Activity          *ActivityStats             `json:"activity,omitempty"`
+}
+
+// ActivityStats summarises transfers in the graph over a recent window. It
+// is omitted from StatisticsResponse when Raphtory cannot be reached.
+type ActivityStats struct {
+	Window                string          `json:"window"`
+	Start                 time.Time       `json:"start"`
+	End                   time.Time       `json:"end"`
+	TransactionCount      int64           `json:"transaction_count"`
+	TransactionsPerSecond float64         `json:"transactions_per_second"`
+	ActiveAddresses       int             `json:"active_addresses"` // Addresses that sent or received
+	Volume                decimal.Decimal `json:"volume"`           // Total amount transferred
+	TopAddresses          []AddressVolume `json:"top_addresses"`    // Most sent plus received first
+}
+
+// AddressVolume is an address's transfers within an activity window
+type AddressVolume struct {
+	Address          string          `json:"address"`
+	TransactionCount int             `json:"transaction_count"`
+	Sent             decimal.Decimal `json:"sent"`
+	Received         decimal.Decimal `json:"received"`
+	Volume           decimal.Decimal `json:"volume"` // Sent plus received
+}
+
+// OutlierTrendsRequest represents query parameters for outlier trends
+type OutlierTrendsRequest struct {
+	Days        int    `form:"days" binding:"omitempty,min=1,max=90"`                         // Default 7
+	Granularity string `form:"granularity" binding:"omitempty,oneof=hour day week month"` // Default day
+}
+
+// DailyReportRequest represents query parameters for a daily report
+type DailyReportRequest struct {
+	Date   string `form:"date"`                                            // UTC day as YYYY-MM-DD (default yesterday)
+	Format string `form:"format" binding:"omitempty,oneof=json html pdf"` // Default json
+}
+
+// SARDraftRequest represents query parameters for a suspicious activity
+// report draft. Exactly one of OutlierID and Address is required.
+type SARDraftRequest struct {
+	OutlierID string `form:"outlier_id"`                                     // Draft for the incident the outlier belongs to
+	Address   string `form:"address"`                                        // Draft for every outlier on the address
+	Format    string `form:"format" binding:"omitempty,oneof=pdf docx json"` // Default pdf
+}
+
+// OutlierTrend counts the outliers detected in one bucket of a trend.
+// Severity has every severity and Type every type seen in the period, zero
+// where none were detected.
+type OutlierTrend struct {
+	Date     string                       `json:"date"`  // Bucket start: 2006-01-02, or 2006-01-02T15:00Z by hour
+	Start    time.Time                    `json:"start"` // Bucket start, UTC
+	Total    int64                        `json:"total"`
+	Severity map[models.Severity]int64    `json:"severity"`
+	Type     map[models.OutlierType]int64 `json:"type"`
+}
+
+// OutlierTrendsResponse represents outlier counts over time, oldest bucket
+// first with no gaps
+type OutlierTrendsResponse struct {
+	Trends []OutlierTrend `json:"trends"`
+	Period TrendPeriod    `json:"period"`
+}
+
+// TrendPeriod is the span a trend covers. Start is aligned to the first
+// bucket, so it may be before Days ago.
+type TrendPeriod struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Days        int       `json:"days"`
+	Granularity string    `json:"granularity"` // hour, day, week (from Monday) or month
+}
+
+// GraphStats summarises the Raphtory transaction graph. It is omitted from
+// StatisticsResponse when Raphtory cannot be reached.
+type GraphStats struct {
+	NodeCount           int        `json:"node_count"`
+	EdgeCount           int        `json:"edge_count"`
+	EarliestTransaction *time.Time `json:"earliest_transaction,omitempty"`
+	LatestTransaction   *time.Time `json:"latest_transaction,omitempty"`
 }
 
 // HealthResponse represents health check response
@@ -52,8 +535,206 @@ type HealthResponse struct {
 
 // ServiceStatus represents the status of a service
 type ServiceStatus struct {
-	Healthy bool   `json:"healthy"`
-	Message string `json:"message,omitempty"`
+	Healthy bool                   `json:"healthy"`
+	Message string                 `json:"message,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"` // Component-specific state, e.g. lag or queue depth
+}
+
+// UserListRequest represents a request to list users
+type UserListRequest struct {
+	Page   int         `form:"page" binding:"omitempty,min=1"`
+	Limit  int         `form:"limit" binding:"omitempty,min=1,max=100"`
+	Role   models.Role `form:"role"`
+	Active *bool       `form:"active" binding:"omitempty"`
+}
+
+// UserListResponse represents a paginated list of users
+type UserListResponse struct {
+	Users      []models.User `json:"users"`
+	Total      int           `json:"total"`
+	Page       int           `json:"page"`
+	Limit      int           `json:"limit"`
+	TotalPages int           `json:"total_pages"`
+}
+
+// CreateUserRequest represents a request to create a user
+type CreateUserRequest struct {
+	Username string      `json:"username" binding:"required,min=3"`
+	Email    string      `json:"email" binding:"omitempty,email"`
+	Password string      `json:"password" binding:"required"`
+	Role     models.Role `json:"role" binding:"required"` // Any role defined in /roles
+	OrgID    string      `json:"org_id"`                  // Defaults to the caller's; only the operating organization may name another
+}
+
+// UpdateUserRequest represents a request to update a user. Omitted fields
+// are left unchanged.
+type UpdateUserRequest struct {
+	Email    *string      `json:"email" binding:"omitempty,email"`
+	Role     *models.Role `json:"role" binding:"omitempty,min=1"`
+	IsActive *bool        `json:"is_active"`
+}
+
+// APIKeyListRequest represents a request to list API keys
+type APIKeyListRequest struct {
+	UserID string `form:"user_id"`
+	Active *bool  `form:"active" binding:"omitempty"`
+}
+
+// APIKeyListResponse represents a list of API keys
+type APIKeyListResponse struct {
+	APIKeys []models.APIKey `json:"api_keys"`
+	Total   int             `json:"total"`
+}
+
+// CreateAPIKeyRequest represents a request to create an API key. The key
+// belongs to UserID, or to the caller if omitted.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	UserID    string     `json:"user_id"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	RateLimit int        `json:"rate_limit" binding:"omitempty,min=0"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKeyResponse carries a new API key. The key is not stored and
+// cannot be retrieved again.
+type CreateAPIKeyResponse struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+// UpdateAPIKeyRequest represents a request to update an API key. Omitted
+// fields are left unchanged.
+type UpdateAPIKeyRequest struct {
+	Name      *string   `json:"name" binding:"omitempty,min=1"`
+	Scopes    *[]string `json:"scopes" binding:"omitempty,min=1"`
+	RateLimit *int      `json:"rate_limit" binding:"omitempty,min=0"`
+	IsActive  *bool     `json:"is_active"`
+}
+
+// OrganizationListResponse lists organizations
+type OrganizationListResponse struct {
+	Organizations []models.Organization `json:"organizations"`
+}
+
+// CreateOrganizationRequest represents a request to create an
+// organization. Its first admin is then created with POST /users and the
+// new organization's org_id.
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// RoleListResponse lists roles along with every permission a role can be
+// granted
+type RoleListResponse struct {
+	Roles       []models.RoleDefinition `json:"roles"`
+	Permissions []string                `json:"permissions"`
+}
+
+// CreateRoleRequest represents a request to create a custom role
+type CreateRoleRequest struct {
+	Name        models.Role `json:"name" binding:"required"`
+	Description string      `json:"description"`
+	Permissions []string    `json:"permissions" binding:"required"`
+}
+
+// UpdateRoleRequest represents a request to update a role. Omitted fields
+// are left unchanged; permissions replace the role's current ones.
+type UpdateRoleRequest struct {
+	Description *string   `json:"description"`
+	Permissions *[]string `json:"permissions"`
+}
+
+// AuditLogListRequest represents query parameters for listing or exporting
+// audit logs
+type AuditLogListRequest struct {
+	Page   int        `form:"page" binding:"omitempty,min=1"`
+	Limit  int        `form:"limit" binding:"omitempty,min=1,max=1000"`
+	UserID string     `form:"user_id"`
+	Action string     `form:"action"`
+	Status string     `form:"status"`
+	From   *time.Time `form:"from" binding:"omitempty"`
+	To     *time.Time `form:"to" binding:"omitempty"`
+	Format string     `form:"format" binding:"omitempty,oneof=json csv"` // Export only
+}
+
+// AuditLogEntry is an audit log record with the result of checking its
+// signature
+type AuditLogEntry struct {
+	ID             string                 `json:"id"`
+	Timestamp      time.Time              `json:"timestamp"`
+	UserID         string                 `json:"user_id,omitempty"`
+	Action         string                 `json:"action"`
+	Resource       string                 `json:"resource,omitempty"`
+	Status         string                 `json:"status,omitempty"`
+	IPAddress      string                 `json:"ip_address,omitempty"`
+	Details        map[string]interface{} `json:"details,omitempty"`
+	Signature      string                 `json:"signature"`
+	Sequence       int64                  `json:"sequence,omitempty"` // Position in the hash chain; absent for entries written before chaining
+	SignatureValid bool                   `json:"signature_valid"`
+}
+
+// AuditLogListResponse represents a paginated list of audit logs
+type AuditLogListResponse struct {
+	Logs       []AuditLogEntry `json:"logs"`
+	Total      int             `json:"total"`
+	Page       int             `json:"page"`
+	Limit      int             `json:"limit"`
+	TotalPages int             `json:"total_pages"`
+}
+
+// AuditArchiveListResponse lists the manifests of archived audit logs
+type AuditArchiveListResponse struct {
+	Archives []security.AuditArchive `json:"archives"`
+	Total    int                     `json:"total"`
+}
+
+// PasswordResetResponse carries a one-time password reset token for an
+// admin to pass on to the user
+type PasswordResetResponse struct {
+	UserID     string    `json:"user_id"`
+	ResetToken string    `json:"reset_token"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// BulkAcknowledgeRequest acknowledges the listed outliers, or every
+// unacknowledged outlier matching the filter
+type BulkAcknowledgeRequest struct {
+	IDs    []string             `json:"ids"`
+	Filter *OutlierFilter       `json:"filter"`
+	Notes  string               `json:"notes"`
+	Label  models.FeedbackLabel `json:"label" binding:"omitempty,oneof=true_positive false_positive"`
+}
+
+// BulkAcknowledgeResult is the outcome for one outlier
+type BulkAcknowledgeResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"` // acknowledged or not_found
+}
+
+// BulkAcknowledgeResponse reports a bulk acknowledgement
+type BulkAcknowledgeResponse struct {
+	Acknowledged int                     `json:"acknowledged"`
+	Results      []BulkAcknowledgeResult `json:"results"`
+}
+
+// BulkArchiveRequest archives the listed outliers, or every live outlier
+// matching the filter
+type BulkArchiveRequest struct {
+	IDs    []string       `json:"ids"`
+	Filter *OutlierFilter `json:"filter"`
+}
+
+// BulkArchiveResult is the outcome for one outlier
+type BulkArchiveResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"` // archived, already_archived or not_found
+}
+
+// BulkArchiveResponse reports a bulk archival
+type BulkArchiveResponse struct {
+	Archived int                 `json:"archived"`
+	Results  []BulkArchiveResult `json:"results"`
 }
 
 // ErrorResponse represents an error response
@@ -75,3 +756,52 @@ type WebSocketMessage struct {
 	Data      interface{} `json:"data"`
 	Timestamp time.Time   `json:"timestamp"`
 }
+
+// WebSocketConnection describes a connected WebSocket client
+type WebSocketConnection struct {
+	ID             string      `json:"id"`
+	UserID         string      `json:"user_id"`
+	Username       string      `json:"username"`
+	OrgID          string      `json:"org_id"`
+	Role           models.Role `json:"role"`
+	Audience       string      `json:"audience"` // Broadcasts received: viewer, analyst or admin
+	Format         string      `json:"format"`   // Message encoding: json or msgpack
+	ConnectedAt    time.Time   `json:"connected_at"`
+	TokenExpiresAt *time.Time  `json:"token_expires_at,omitempty"` // When the connection closes unless it reauthenticates
+	WebSocketSubscription
+	QueueDepth    int `json:"queue_depth"`    // Messages waiting to be sent
+	QueueCapacity int `json:"queue_capacity"` // Queue size at which the client is dropped
+}
+
+// WebSocketSubscription holds a WebSocket client's subscription filters.
+// It answers subscribe and get_filters messages.
+type WebSocketSubscription struct {
+	Severities   []models.Severity                 `json:"severities"`             // Subscribed severities; empty receives all
+	Types        []models.OutlierType              `json:"types"`                  // Subscribed outlier types; empty receives all
+	Addresses    []string                          `json:"addresses"`              // Subscribed addresses; empty receives all
+	MinAmount    decimal.Decimal                   `json:"min_amount"`             // Smallest amount received; zero receives all
+	Transactions *WebSocketTransactionSubscription `json:"transactions,omitempty"` // Live transaction stream; unset when not subscribed
+}
+
+// WebSocketTransactionSubscription holds a client's live transaction
+// stream options
+type WebSocketTransactionSubscription struct {
+	MinAmount  decimal.Decimal `json:"min_amount"`  // Smallest transfer received; zero receives all
+	SampleRate float64         `json:"sample_rate"` // Fraction of transfers over the threshold received, up to 1
+}
+
+// WebSocketConnectionListRequest filters WebSocket connections
+type WebSocketConnectionListRequest struct {
+	UserID string `form:"user_id"`
+}
+
+// WebSocketConnectionListResponse lists connected WebSocket clients
+type WebSocketConnectionListResponse struct {
+	Connections []WebSocketConnection `json:"connections"`
+	Total       int                   `json:"total"`
+}
+
+// WebSocketDisconnectResponse reports the connections closed
+type WebSocketDisconnectResponse struct {
+	Disconnected int `json:"disconnected"`
+}
@@ -0,0 +1,599 @@
+// Package openapi generates an OpenAPI 3 specification for the API from the
+// routes gin has registered and the Go types their handlers bind and return,
+// so the specification cannot drift from the request and response structs.
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Version is the OpenAPI version generated
+const Version = "3.0.3"
+
+// Info describes the API
+type Info struct {
+	Title       string
+	Version     string
+	Description string
+}
+
+// Parameter is a query or header parameter read outside a bound struct
+type Parameter struct {
+	Name        string
+	In          string // query or header
+	Description string
+	Type        interface{} // A value of the parameter's type
+	Default     interface{}
+	Required    bool
+}
+
+// Operation documents the handler of a route
+type Operation struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Public      bool   // Served without authentication
+	Permission  string // Required permission, if any beyond authentication
+	APIKey      bool   // Also accepts an API key scoped to Permission
+
+	Query  interface{} // Struct whose form tags are the query parameters
+	Params []Parameter
+	Body   interface{} // Request body, encoded as BodyType
+	// BodyType is the request media type (default application/json)
+	BodyType string
+
+	Status   int         // Of a successful response (default 200)
+	Response interface{} // Successful response body, encoded as ResponseType
+	// ResponseType is the response media type (default application/json)
+	ResponseType string
+}
+
+// Operations documents routes by method and gin path, e.g.
+// "GET /api/v1/outliers/:id"
+type Operations map[string]Operation
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       DocumentInfo          `json:"info"`
+	Servers    []Server              `json:"servers,omitempty"`
+	Tags       []Tag                 `json:"tags,omitempty"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []SecurityRequirement `json:"security,omitempty"`
+}
+
+// DocumentInfo is the info object of a document
+type DocumentInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Server is a base URL the API is served from
+type Server struct {
+	URL string `json:"url"`
+}
+
+// Tag groups operations
+type Tag struct {
+	Name string `json:"name"`
+}
+
+// PathItem holds the operations on a path, by lowercase method
+type PathItem map[string]*OperationObject
+
+// OperationObject is a documented operation
+type OperationObject struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Parameters  []ParameterObject      `json:"parameters,omitempty"`
+	RequestBody *RequestBody           `json:"requestBody,omitempty"`
+	Responses   map[string]Response    `json:"responses"`
+	Security    *[]SecurityRequirement `json:"security,omitempty"`
+}
+
+// ParameterObject is a path, query or header parameter
+type ParameterObject struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body of a request
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is a response to an operation
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType is a body's schema in one media type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the schemas and security schemes operations refer to
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityScheme is a way of authenticating
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// SecurityRequirement names the schemes an operation accepts
+type SecurityRequirement map[string][]string
+
+// Schema is a JSON schema for a value
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+// Security scheme names
+const (
+	BearerAuth = "bearerAuth"
+	APIKeyAuth = "apiKeyAuth"
+)
+
+// Generator builds a Document from routes
+type Generator struct {
+	info       Info
+	basePath   string
+	operations Operations
+	enums      map[reflect.Type][]interface{}
+
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+// NewGenerator creates a generator for routes served under basePath, such
+// as /api/v1, documented by operations
+func NewGenerator(info Info, basePath string, operations Operations) *Generator {
+	return &Generator{
+		info:       info,
+		basePath:   strings.TrimSuffix(basePath, "/"),
+		operations: operations,
+		enums:      make(map[reflect.Type][]interface{}),
+	}
+}
+
+// Enum lists the values of a named type, such as a string constant type.
+// Fields of that type are documented with the values.
+func (g *Generator) Enum(values ...interface{}) {
+	if len(values) == 0 {
+		return
+	}
+	g.enums[reflect.TypeOf(values[0])] = values
+}
+
+// Generate documents every route under the base path. Routes missing from
+// the operations are documented from their path alone.
+func (g *Generator) Generate(routes gin.RoutesInfo) *Document {
+	g.schemas = make(map[string]*Schema)
+	g.names = make(map[reflect.Type]string)
+
+	doc := &Document{
+		OpenAPI: Version,
+		Info: DocumentInfo{
+			Title:       g.info.Title,
+			Version:     g.info.Version,
+			Description: g.info.Description,
+		},
+		Servers: []Server{{URL: g.basePath}},
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			Schemas: g.schemas,
+			SecuritySchemes: map[string]SecurityScheme{
+				BearerAuth: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				APIKeyAuth: {Type: "apiKey", In: "header", Name: "X-API-Key",
+					Description: "Accepted by operations open to API keys"},
+			},
+		},
+		Security: []SecurityRequirement{{BearerAuth: {}}},
+	}
+	g.schemas["Error"] = &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"error":   {Type: "string", Description: "Machine-readable code, e.g. bad_request or not_found"},
+			"message": {Type: "string"},
+		},
+		Required: []string{"error", "message"},
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	tags := make(map[string]bool)
+	operationIDs := make(map[string]bool)
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, g.basePath+"/") {
+			continue
+		}
+		operation := g.operations[route.Method+" "+route.Path]
+		object := g.operation(route, operation)
+
+		if operationIDs[object.OperationID] {
+			object.OperationID += strings.ToUpper(route.Method[:1]) + strings.ToLower(route.Method[1:])
+		}
+		operationIDs[object.OperationID] = true
+		for _, tag := range object.Tags {
+			if !tags[tag] {
+				tags[tag] = true
+				doc.Tags = append(doc.Tags, Tag{Name: tag})
+			}
+		}
+
+		specPath := openAPIPath(strings.TrimPrefix(route.Path, g.basePath))
+		if doc.Paths[specPath] == nil {
+			doc.Paths[specPath] = make(PathItem)
+		}
+		doc.Paths[specPath][strings.ToLower(route.Method)] = object
+	}
+	return doc
+}
+
+// operation documents a route
+func (g *Generator) operation(route gin.RouteInfo, operation Operation) *OperationObject {
+	object := &OperationObject{
+		OperationID: handlerName(route.Handler),
+		Summary:     operation.Summary,
+		Description: operation.Description,
+		Tags:        operation.Tags,
+		Responses:   make(map[string]Response),
+	}
+	if object.Summary == "" {
+		object.Summary = object.OperationID
+	}
+
+	if operation.Permission != "" {
+		required := fmt.Sprintf("Requires the %s permission.", operation.Permission)
+		if object.Description == "" {
+			object.Description = required
+		} else {
+			object.Description += "\n\n" + required
+		}
+	}
+	switch {
+	case operation.Public:
+		object.Security = &[]SecurityRequirement{}
+	case operation.APIKey:
+		object.Security = &[]SecurityRequirement{{BearerAuth: {}}, {APIKeyAuth: {}}}
+	}
+
+	for _, segment := range strings.Split(route.Path, "/") {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			object.Parameters = append(object.Parameters, ParameterObject{
+				Name:     segment[1:],
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+	}
+	if operation.Query != nil {
+		object.Parameters = append(object.Parameters, g.queryParameters(reflect.TypeOf(operation.Query))...)
+	}
+	for _, param := range operation.Params {
+		schema := g.schema(reflect.TypeOf(param.Type))
+		schema.Default = param.Default
+		object.Parameters = append(object.Parameters, ParameterObject{
+			Name:        param.Name,
+			In:          param.In,
+			Description: param.Description,
+			Required:    param.Required,
+			Schema:      schema,
+		})
+	}
+
+	if operation.Body != nil {
+		object.RequestBody = &RequestBody{
+			Required: true,
+			Content:  g.content(operation.BodyType, operation.Body),
+		}
+	}
+
+	status := operation.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := Response{Description: http.StatusText(status)}
+	if operation.Response != nil {
+		response.Content = g.content(operation.ResponseType, operation.Response)
+	}
+	object.Responses[strconv.Itoa(status)] = response
+	object.Responses["default"] = Response{
+		Description: "Error",
+		Content:     map[string]MediaType{"application/json": {Schema: &Schema{Ref: "#/components/schemas/Error"}}},
+	}
+	return object
+}
+
+// content describes a body of value's type in mediaType
+func (g *Generator) content(mediaType string, value interface{}) map[string]MediaType {
+	if mediaType == "" {
+		mediaType = "application/json"
+	}
+	return map[string]MediaType{mediaType: {Schema: g.schema(reflect.TypeOf(value))}}
+}
+
+// queryParameters documents the form-tagged fields of a query struct
+func (g *Generator) queryParameters(t reflect.Type) []ParameterObject {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var params []ParameterObject
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if field.Anonymous && name == "" {
+			params = append(params, g.queryParameters(field.Type)...)
+			continue
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := g.schema(field.Type)
+		required := applyBinding(schema, field.Tag.Get("binding"))
+		params = append(params, ParameterObject{
+			Name:     name,
+			In:       "query",
+			Required: required,
+			Schema:   schema,
+		})
+	}
+	return params
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// schema describes values of t as encoding/json encodes them. Named
+// structs become components referred to by $ref.
+func (g *Generator) schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if values, ok := g.enums[t]; ok {
+		schema := &Schema{Type: "string", Enum: values}
+		if t.Kind() != reflect.String {
+			schema.Type = "integer"
+		}
+		return schema
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == durationType:
+		return &Schema{Type: "integer", Format: "int64", Description: "Nanoseconds"}
+	case implements(t, textMarshalerType):
+		return &Schema{Type: "string"}
+	case implements(t, jsonMarshalerType):
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name, ok := g.names[t]
+		if !ok {
+			name = g.componentName(t)
+			g.names[t] = name
+			g.schemas[name] = &Schema{} // Placeholder for recursive types
+			*g.schemas[name] = *g.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		return &Schema{}
+	}
+}
+
+// object describes a struct by its JSON fields
+func (g *Generator) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	g.fields(t, schema)
+	return schema
+}
+
+// fields adds the JSON fields of t to schema, flattening embedded structs
+// as encoding/json does
+func (g *Generator) fields(t reflect.Type, schema *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			g.fields(fieldType, schema)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := g.schema(field.Type)
+		if strings.Contains(options, "string") && property.Ref == "" {
+			property = &Schema{Type: "string"}
+		}
+		if applyBinding(property, field.Tag.Get("binding")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+}
+
+// componentName names the component for a named type, qualifying it with
+// its package when another package's type has the same name
+func (g *Generator) componentName(t reflect.Type) string {
+	name := t.Name()
+	if _, taken := g.schemas[name]; !taken {
+		return name
+	}
+	pkg := path.Base(t.PkgPath())
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + name
+}
+
+// applyBinding applies gin's validation tags to schema and reports whether
+// the value is required
+func applyBinding(schema *Schema, binding string) bool {
+	required := false
+	for _, rule := range strings.Split(binding, ",") {
+		if rule == "dive" {
+			break
+		}
+		key, value, _ := strings.Cut(rule, "=")
+		switch key {
+		case "required":
+			required = true
+		case "oneof":
+			if schema.Ref == "" && len(schema.Enum) == 0 {
+				for _, option := range strings.Fields(value) {
+					schema.Enum = append(schema.Enum, option)
+				}
+			}
+		case "min", "gte", "max", "lte":
+			limit, err := strconv.ParseFloat(value, 64)
+			if err != nil || schema.Ref != "" {
+				continue
+			}
+			lower := key == "min" || key == "gte"
+			switch schema.Type {
+			case "integer", "number":
+				if lower {
+					schema.Minimum = &limit
+				} else {
+					schema.Maximum = &limit
+				}
+			case "string":
+				n := int(limit)
+				if lower {
+					schema.MinLength = &n
+				} else {
+					schema.MaxLength = &n
+				}
+			case "array":
+				n := int(limit)
+				if lower {
+					schema.MinItems = &n
+				} else {
+					schema.MaxItems = &n
+				}
+			}
+		}
+	}
+	return required
+}
+
+// implements reports whether t or a pointer to t implements iface
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PointerTo(t).Implements(iface)
+}
+
+// handlerName is the method or function name of a gin handler, e.g.
+// ListOutliers for handlers.(*OutlierHandler).ListOutliers-fm
+func handlerName(handler string) string {
+	name := strings.TrimSuffix(handler, "-fm")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// openAPIPath converts gin path parameters to OpenAPI's, e.g. /outliers/:id
+// to /outliers/{id}
+func openAPIPath(ginPath string) string {
+	segments := strings.Split(ginPath, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
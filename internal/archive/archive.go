@@ -0,0 +1,243 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Store writes archive objects. Keys use forward slashes.
+type Store interface {
+	Put(ctx context.Context, key string, body []byte) error
+}
+
+// Config holds archiver configuration
+type Config struct {
+	Prefix     string        // Key prefix, e.g. raw/trongrid
+	QueueSize  int           // Batches waiting for upload before new ones are dropped (default 100)
+	MaxRetries int           // Upload retries per batch on top of the first attempt
+	RetryDelay time.Duration // Doubles on each further retry (default 1 second)
+	Timeout    time.Duration // Per-upload timeout (default 30 seconds)
+}
+
+// Stats holds archiver counters
+type Stats struct {
+	Batches    uint64 // Batches uploaded
+	Events     uint64 // Events in uploaded batches
+	Bytes      uint64 // Compressed bytes uploaded
+	Retries    uint64 // Upload attempts that were retried
+	Failed     uint64 // Batches not uploaded after retries
+	Dropped    uint64 // Batches dropped because the queue was full
+	QueueDepth int    // Batches waiting for upload
+}
+
+// batch is one page of raw events as fetched from TronGrid
+type batch struct {
+	source    string
+	fetchedAt time.Time
+	events    []models.TronEvent
+}
+
+// Archiver uploads raw event batches in the background so ingestion can be
+// replayed and audited later. Each batch becomes one gzipped NDJSON object
+// under <prefix>/dt=<date>/<source>/, which the monitor's replay mode reads
+// directly. Archiving never blocks ingestion: when uploads fall behind and
+// the queue is full, batches are dropped and counted.
+type Archiver struct {
+	config Config
+	store  Store
+	logger *zap.Logger
+
+	queue  chan batch
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	closed bool
+	mu     sync.RWMutex // Guards closing the queue against Archive
+	seq    atomic.Uint64
+
+	batches atomic.Uint64
+	events  atomic.Uint64
+	bytes   atomic.Uint64
+	retries atomic.Uint64
+	failed  atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// NewArchiver creates an archiver and starts its upload worker
+func NewArchiver(config Config, store Store, logger *zap.Logger) *Archiver {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+	config.Prefix = strings.Trim(config.Prefix, "/")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &Archiver{
+		config: config,
+		store:  store,
+		logger: logger,
+		queue:  make(chan batch, config.QueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go a.run()
+	return a
+}
+
+// Archive queues a page of raw events for upload without blocking
+func (a *Archiver) Archive(source string, events []models.TronEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return
+	}
+
+	select {
+	case a.queue <- batch{source: source, fetchedAt: time.Now().UTC(), events: events}:
+	default:
+		a.dropped.Add(1)
+		a.logger.Error("Archive queue full, dropping raw event batch",
+			zap.String("source", source),
+			zap.Int("events", len(events)))
+	}
+}
+
+// Close stops accepting batches and uploads the queued ones, giving up when
+// ctx is done
+func (a *Archiver) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		a.cancel()
+		<-a.done
+		return fmt.Errorf("archive not drained: %w", ctx.Err())
+	}
+}
+
+// Stats returns a snapshot of the archiver counters
+func (a *Archiver) Stats() Stats {
+	return Stats{
+		Batches:    a.batches.Load(),
+		Events:     a.events.Load(),
+		Bytes:      a.bytes.Load(),
+		Retries:    a.retries.Load(),
+		Failed:     a.failed.Load(),
+		Dropped:    a.dropped.Load(),
+		QueueDepth: len(a.queue),
+	}
+}
+
+// run uploads queued batches in order until the queue is closed
+func (a *Archiver) run() {
+	defer close(a.done)
+
+	for b := range a.queue {
+		if a.ctx.Err() != nil {
+			a.failed.Add(1)
+			continue
+		}
+
+		key := a.key(b)
+		if err := a.upload(key, b); err != nil {
+			a.failed.Add(1)
+			a.logger.Error("Failed to archive raw event batch",
+				zap.Error(err),
+				zap.String("key", key),
+				zap.Int("events", len(b.events)))
+		}
+	}
+}
+
+// upload compresses a batch and puts it, retrying under the configured policy
+func (a *Archiver) upload(key string, b batch) error {
+	body, err := Encode(b.events)
+	if err != nil {
+		return err
+	}
+
+	delay := a.config.RetryDelay
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(a.ctx, a.config.Timeout)
+		err = a.store.Put(ctx, key, body)
+		cancel()
+		if err == nil {
+			a.batches.Add(1)
+			a.events.Add(uint64(len(b.events)))
+			a.bytes.Add(uint64(len(body)))
+			return nil
+		}
+		if attempt >= a.config.MaxRetries {
+			return err
+		}
+
+		a.retries.Add(1)
+		a.logger.Warn("Archive upload failed, retrying",
+			zap.Error(err),
+			zap.String("key", key),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay))
+
+		select {
+		case <-time.After(delay):
+		case <-a.ctx.Done():
+			return a.ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// key names a batch's object, partitioned by the UTC date it was fetched.
+// The sequence number keeps keys unique within a process.
+func (a *Archiver) key(b batch) string {
+	name := fmt.Sprintf("%s-%06d.ndjson.gz", b.fetchedAt.Format("20060102T150405.000000000Z"), a.seq.Add(1))
+	return path.Join(a.config.Prefix, "dt="+b.fetchedAt.Format("2006-01-02"), b.source, name)
+}
+
+// Encode writes events as gzipped newline-delimited JSON
+func Encode(events []models.TronEvent) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(gz)
+	for i := range events {
+		if err := encoder.Encode(&events[i]); err != nil {
+			return nil, fmt.Errorf("failed to encode event: %w", err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress batch: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,37 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileStore writes archive objects under a local directory, e.g. for
+// development or a mounted volume that is synced elsewhere
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a file store rooted at dir
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+// Put writes an object, replacing any existing one atomically
+func (f *FileStore) Put(ctx context.Context, key string, body []byte) error {
+	path := filepath.Join(f.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return fmt.Errorf("failed to write archive object: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write archive object: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// OverflowStrategy decides what happens to a transaction when the consumer
+// channel is full
+type OverflowStrategy string
+
+const (
+	// OverflowBlock waits for space up to a timeout, then drops
+	OverflowBlock OverflowStrategy = "block"
+	// OverflowSpill writes to a disk-backed queue that is drained as space frees up
+	OverflowSpill OverflowStrategy = "spill"
+	// OverflowDrop drops immediately and counts the loss
+	OverflowDrop OverflowStrategy = "drop"
+)
+
+// BackpressureConfig holds overflow handling configuration
+type BackpressureConfig struct {
+	Strategy     OverflowStrategy // Default OverflowBlock
+	BlockTimeout time.Duration    // Used by OverflowBlock (default 10 seconds)
+	SpillPath    string           // Queue file, required by OverflowSpill
+}
+
+// BackpressureStats holds overflow counters
+type BackpressureStats struct {
+	Dropped    uint64 // Transactions lost because the channel stayed full
+	Spilled    uint64 // Transactions written to the spill queue
+	SpillDepth int    // Transactions currently waiting in the spill queue
+}
+
+// Backpressure delivers transactions to a channel according to an overflow
+// strategy
+type Backpressure struct {
+	config BackpressureConfig
+	out    chan *models.Transaction
+	spill  *SpillQueue
+	logger *zap.Logger
+
+	dropped atomic.Uint64
+	spilled atomic.Uint64
+	sent    atomic.Uint64
+}
+
+// NewBackpressure creates overflow handling for out
+func NewBackpressure(config BackpressureConfig, out chan *models.Transaction, logger *zap.Logger) *Backpressure {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.Strategy == "" {
+		config.Strategy = OverflowBlock
+	}
+	if config.BlockTimeout <= 0 {
+		config.BlockTimeout = 10 * time.Second
+	}
+
+	return &Backpressure{
+		config: config,
+		out:    out,
+		logger: logger,
+	}
+}
+
+// Start opens the spill queue, if any, and drains it into the channel until
+// ctx is cancelled
+func (b *Backpressure) Start(ctx context.Context) error {
+	if b.config.Strategy != OverflowSpill {
+		return nil
+	}
+
+	if b.config.SpillPath == "" {
+		return fmt.Errorf("spill path is required for the spill overflow strategy")
+	}
+
+	spill, err := OpenSpillQueue(b.config.SpillPath)
+	if err != nil {
+		return err
+	}
+	b.spill = spill
+
+	if depth := spill.Len(); depth > 0 {
+		b.logger.Info("Resuming spilled transactions",
+			zap.Int("depth", depth),
+			zap.String("path", b.config.SpillPath))
+	}
+
+	go b.drain(ctx)
+	return nil
+}
+
+// Send delivers a transaction, applying the overflow strategy when the channel is full
+func (b *Backpressure) Send(ctx context.Context, tx *models.Transaction) error {
+	// Keep ordering: once anything is spilled, new transactions queue behind it
+	if b.spill != nil && b.spill.Len() > 0 {
+		return b.spillTransaction(tx)
+	}
+
+	select {
+	case b.out <- tx:
+		b.sent.Add(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	switch b.config.Strategy {
+	case OverflowSpill:
+		return b.spillTransaction(tx)
+
+	case OverflowBlock:
+		timer := time.NewTimer(b.config.BlockTimeout)
+		defer timer.Stop()
+
+		select {
+		case b.out <- tx:
+			b.sent.Add(1)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			b.drop(tx, "channel full after block timeout")
+			return nil
+		}
+
+	default:
+		b.drop(tx, "channel full")
+		return nil
+	}
+}
+
+// spillTransaction writes a transaction to the spill queue, dropping it if
+// the queue cannot be written
+func (b *Backpressure) spillTransaction(tx *models.Transaction) error {
+	if err := b.spill.Push(tx); err != nil {
+		b.logger.Error("Failed to spill transaction", zap.Error(err))
+		b.drop(tx, "spill queue write failed")
+		return nil
+	}
+
+	if b.spilled.Add(1)%1000 == 1 {
+		b.logger.Warn("Transaction channel full, spilling to disk",
+			zap.Int("depth", b.spill.Len()))
+	}
+	return nil
+}
+
+// drop records a lost transaction
+func (b *Backpressure) drop(tx *models.Transaction, reason string) {
+	dropped := b.dropped.Add(1)
+	metrics.TransactionsDropped.WithLabelValues(string(tx.Chain), tx.Token).Inc()
+	b.logger.Warn("Dropping transaction",
+		zap.String("tx_hash", tx.TxHash),
+		zap.String("reason", reason),
+		zap.Uint64("total_dropped", dropped))
+}
+
+// drain feeds spilled transactions back into the channel in order
+func (b *Backpressure) drain(ctx context.Context) {
+	defer b.spill.Close()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			tx, err := b.spill.Peek()
+			if err != nil {
+				// Skip the unreadable record rather than stalling the queue
+				b.logger.Error("Failed to read spill queue, skipping record", zap.Error(err))
+				b.dropped.Add(1)
+				metrics.TransactionsDropped.WithLabelValues("", "").Inc()
+				if err := b.spill.Commit(); err != nil {
+					b.logger.Error("Failed to commit spill queue", zap.Error(err))
+				}
+				break
+			}
+			if tx == nil {
+				break
+			}
+
+			select {
+			case b.out <- tx:
+				b.sent.Add(1)
+			case <-ctx.Done():
+				return
+			}
+
+			if err := b.spill.Commit(); err != nil {
+				b.logger.Error("Failed to commit spill queue", zap.Error(err))
+				break
+			}
+		}
+	}
+}
+
+// Sent returns the number of transactions put on the channel, directly or
+// from the spill queue
+func (b *Backpressure) Sent() uint64 {
+	return b.sent.Load()
+}
+
+// Stats returns a snapshot of the overflow counters
+func (b *Backpressure) Stats() BackpressureStats {
+	stats := BackpressureStats{
+		Dropped: b.dropped.Load(),
+		Spilled: b.spilled.Load(),
+	}
+	if b.spill != nil {
+		stats.SpillDepth = b.spill.Len()
+	}
+	return stats
+}
@@ -0,0 +1,142 @@
+package blockchain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CheckpointStore persists the polling position so ingestion resumes where it
+// stopped after a restart. Implementations must make Save atomic: a crash
+// mid-write must leave either the old or the new checkpoint, never neither.
+type CheckpointStore interface {
+	// Load returns the last saved block timestamp (milliseconds), or 0 if none
+	Load(ctx context.Context) (int64, error)
+	// Save records the latest fully processed block timestamp (milliseconds)
+	Save(ctx context.Context, blockTimestamp int64) error
+}
+
+// checkpointFile is the on-disk checkpoint format
+type checkpointFile struct {
+	BlockTimestamp int64     `json:"block_timestamp"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// FileCheckpointStore stores the checkpoint as JSON in a local file
+type FileCheckpointStore struct {
+	path string
+}
+
+// NewFileCheckpointStore creates a file-backed checkpoint store
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{path: path}
+}
+
+// Load reads the checkpoint file
+func (s *FileCheckpointStore) Load(ctx context.Context) (int64, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var checkpoint checkpointFile
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return 0, fmt.Errorf("failed to decode checkpoint: %w", err)
+	}
+
+	return checkpoint.BlockTimestamp, nil
+}
+
+// Save writes the checkpoint to a temporary file and renames it into place
+func (s *FileCheckpointStore) Save(ctx context.Context, blockTimestamp int64) error {
+	data, err := json.Marshal(checkpointFile{
+		BlockTimestamp: blockTimestamp,
+		UpdatedAt:      time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close checkpoint: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// PostgresCheckpointStore stores the checkpoint in the ingestion_checkpoints table
+type PostgresCheckpointStore struct {
+	db   *sql.DB
+	name string // Identifies the stream, e.g. the contract address
+}
+
+// NewPostgresCheckpointStore creates a database-backed checkpoint store
+func NewPostgresCheckpointStore(db *sql.DB, name string) *PostgresCheckpointStore {
+	return &PostgresCheckpointStore{
+		db:   db,
+		name: name,
+	}
+}
+
+// Load reads the checkpoint row
+func (s *PostgresCheckpointStore) Load(ctx context.Context) (int64, error) {
+	var blockTimestamp int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT block_timestamp FROM ingestion_checkpoints WHERE name = $1
+	`, s.name).Scan(&blockTimestamp)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+
+	return blockTimestamp, nil
+}
+
+// Save upserts the checkpoint row in a single statement
+func (s *PostgresCheckpointStore) Save(ctx context.Context, blockTimestamp int64) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO ingestion_checkpoints (name, block_timestamp, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE
+		SET block_timestamp = EXCLUDED.block_timestamp,
+		    updated_at = EXCLUDED.updated_at
+	`, s.name, blockTimestamp, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package blockchain
+
+import (
+	"container/heap"
+	"sync"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+)
+
+// ConfirmationTracker marks transactions confirmed once enough blocks have
+// been built on top of them. The chain head is the highest block seen among
+// tracked transactions or reported with Advance, so each source should have
+// its own tracker.
+type ConfirmationTracker struct {
+	depth     uint64
+	head      uint64
+	pending   pendingHeap                    // Unconfirmed transactions, lowest block first
+	hashes    map[string]*models.Transaction // Pending transactions by hash
+	positions map[string]uint64              // Pending transactions by hash, to the order they were tracked in
+	tracked   uint64
+	mu        sync.Mutex
+
+	confirmed uint64
+}
+
+// ConfirmationStats holds confirmation tracking counters
+type ConfirmationStats struct {
+	Head      uint64 // Highest block seen
+	Pending   int    // Transactions waiting for confirmation
+	Confirmed uint64 // Transactions confirmed after being sent unconfirmed
+}
+
+// NewConfirmationTracker creates a tracker that confirms transactions depth
+// blocks below the head
+func NewConfirmationTracker(depth uint64) *ConfirmationTracker {
+	return &ConfirmationTracker{
+		depth:     depth,
+		hashes:    make(map[string]*models.Transaction),
+		positions: make(map[string]uint64),
+	}
+}
+
+// Track sets tx.Confirmed from its depth below the head and returns updates
+// for pending transactions that the new head has confirmed
+func (t *ConfirmationTracker) Track(tx *models.Transaction) []models.ConfirmationUpdate {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tracked++
+	if tx.BlockNumber > t.head {
+		t.head = tx.BlockNumber
+	}
+
+	tx.Confirmed = t.confirmations(tx.BlockNumber) >= t.depth
+	if !tx.Confirmed {
+		if _, ok := t.hashes[tx.TxHash]; !ok {
+			t.hashes[tx.TxHash] = tx
+			t.positions[tx.TxHash] = t.tracked
+			heap.Push(&t.pending, tx)
+		}
+	}
+
+	return t.confirmPendingLocked()
+}
+
+// Advance moves the head to a block reported by the chain, so pending
+// transactions are confirmed even while no new transactions arrive, and
+// returns updates for the ones it confirmed
+func (t *ConfirmationTracker) Advance(head uint64) []models.ConfirmationUpdate {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if head > t.head {
+		t.head = head
+	}
+	return t.confirmPendingLocked()
+}
+
+// Settled returns how many transactions, in the order they were tracked,
+// came before the oldest one still waiting for confirmation: all of them if
+// none is. A source's checkpoint must not pass that transaction, or a
+// restart would lose its confirmation update.
+func (t *ConfirmationTracker) Settled() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	settled := t.tracked
+	for _, position := range t.positions {
+		if position-1 < settled {
+			settled = position - 1
+		}
+	}
+	return settled
+}
+
+// confirmPendingLocked confirms the pending transactions now deep enough
+// below the head
+func (t *ConfirmationTracker) confirmPendingLocked() []models.ConfirmationUpdate {
+	var updates []models.ConfirmationUpdate
+	for t.pending.Len() > 0 {
+		oldest := t.pending[0]
+		if t.hashes[oldest.TxHash] != oldest {
+			// Forgotten after a retraction
+			heap.Pop(&t.pending)
+			continue
+		}
+		confirmations := t.confirmations(oldest.BlockNumber)
+		if confirmations < t.depth {
+			break
+		}
+
+		heap.Pop(&t.pending)
+		delete(t.hashes, oldest.TxHash)
+		delete(t.positions, oldest.TxHash)
+		t.confirmed++
+		updates = append(updates, models.ConfirmationUpdate{
+			TxHash:        oldest.TxHash,
+			BlockNumber:   oldest.BlockNumber,
+			Confirmations: confirmations,
+			Chain:         oldest.Chain,
+		})
+	}
+
+	return updates
+}
+
+// Forget stops tracking a transaction, e.g. after a reorg reverted it
+func (t *ConfirmationTracker) Forget(txHash string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.hashes, txHash)
+	delete(t.positions, txHash)
+}
+
+// Stats returns a snapshot of the tracking counters
+func (t *ConfirmationTracker) Stats() ConfirmationStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return ConfirmationStats{
+		Head:      t.head,
+		Pending:   len(t.hashes),
+		Confirmed: t.confirmed,
+	}
+}
+
+func (t *ConfirmationTracker) confirmations(block uint64) uint64 {
+	if block > t.head {
+		return 0
+	}
+	return t.head - block
+}
+
+// pendingHeap orders transactions by block number
+type pendingHeap []*models.Transaction
+
+func (h pendingHeap) Len() int           { return len(h) }
+func (h pendingHeap) Less(i, j int) bool { return h[i].BlockNumber < h[j].BlockNumber }
+func (h pendingHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *pendingHeap) Push(x interface{}) {
+	*h = append(*h, x.(*models.Transaction))
+}
+
+func (h *pendingHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	tx := old[n-1]
+	*h = old[:n-1]
+	return tx
+}
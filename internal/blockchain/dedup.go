@@ -0,0 +1,92 @@
+package blockchain
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+)
+
+// DedupCache remembers the most recently seen event keys so events that
+// TronGrid delivers more than once are only emitted once. The least
+// recently seen key is evicted when the cache is full.
+type DedupCache struct {
+	size  int
+	order *list.List // Front is the most recently seen key
+	keys  map[string]*list.Element
+	mu    sync.Mutex
+}
+
+// NewDedupCache creates a cache holding up to size keys
+func NewDedupCache(size int) *DedupCache {
+	if size <= 0 {
+		size = 1
+	}
+	return &DedupCache{
+		size:  size,
+		order: list.New(),
+		keys:  make(map[string]*list.Element, size),
+	}
+}
+
+// Seen reports whether key was already in the cache and records it
+func (d *DedupCache) Seen(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if element, ok := d.keys[key]; ok {
+		d.order.MoveToFront(element)
+		return true
+	}
+
+	d.keys[key] = d.order.PushFront(key)
+	if d.order.Len() > d.size {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.keys, oldest.Value.(string))
+	}
+	return false
+}
+
+// Forget removes key so the next event with it is emitted again
+func (d *DedupCache) Forget(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if element, ok := d.keys[key]; ok {
+		d.order.Remove(element)
+		delete(d.keys, key)
+	}
+}
+
+// Len returns the number of keys in the cache
+func (d *DedupCache) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.order.Len()
+}
+
+// SeenEvent reports whether the event was already seen and records it.
+// Seeing an event or its retraction forgets the other, so a transaction
+// re-included after a reorg is emitted again.
+func (d *DedupCache) SeenEvent(event *models.TronEvent) bool {
+	if d.Seen(EventKey(event)) {
+		return true
+	}
+
+	opposite := *event
+	opposite.Removed = !event.Removed
+	d.Forget(EventKey(&opposite))
+	return false
+}
+
+// EventKey identifies an event by transaction ID and log index. Removed
+// events get their own key so a retraction is not mistaken for a
+// re-delivery of the event it reverts.
+func EventKey(event *models.TronEvent) string {
+	if event.Removed {
+		return fmt.Sprintf("%s:%d:removed", event.TransactionID, event.EventIndex)
+	}
+	return fmt.Sprintf("%s:%d", event.TransactionID, event.EventIndex)
+}
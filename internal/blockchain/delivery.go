@@ -0,0 +1,72 @@
+package blockchain
+
+import "sync"
+
+// DeliveryTracker holds a client's checkpoints back until the consumer has
+// acknowledged every transaction put on the channel before them, so a crash
+// never loses transactions that were fetched but not yet delivered by the
+// sinks. Spilled transactions need no acknowledgement: the spill queue
+// survives a restart, and they are counted once they reach the channel.
+type DeliveryTracker struct {
+	backpressure *Backpressure
+	save         func(position int64)
+
+	mu      sync.Mutex
+	acked   uint64
+	pending []pendingCheckpoint
+}
+
+// pendingCheckpoint is a position waiting for the transactions sent before it
+type pendingCheckpoint struct {
+	sent     uint64 // Transactions put on the channel when the position was reached
+	position int64
+}
+
+// NewDeliveryTracker creates a tracker for the channel fed by backpressure.
+// save persists a position once it is safe to resume from.
+func NewDeliveryTracker(backpressure *Backpressure, save func(position int64)) *DeliveryTracker {
+	return &DeliveryTracker{
+		backpressure: backpressure,
+		save:         save,
+	}
+}
+
+// Checkpoint saves position once every transaction sent so far has been
+// acknowledged, immediately if they already have
+func (t *DeliveryTracker) Checkpoint(position int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pending = append(t.pending, pendingCheckpoint{sent: t.backpressure.Sent(), position: position})
+	t.saveDeliveredLocked()
+}
+
+// Acknowledge records that the next n transactions received from the
+// channel have been delivered, saving any checkpoint that was waiting on them
+func (t *DeliveryTracker) Acknowledge(n int) {
+	if n <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.acked += uint64(n)
+	t.saveDeliveredLocked()
+}
+
+// saveDeliveredLocked saves the latest position whose transactions have all
+// been acknowledged and forgets the ones before it
+func (t *DeliveryTracker) saveDeliveredLocked() {
+	delivered := 0
+	for delivered < len(t.pending) && t.pending[delivered].sent <= t.acked {
+		delivered++
+	}
+	if delivered == 0 {
+		return
+	}
+
+	position := t.pending[delivered-1].position
+	t.pending = t.pending[delivered:]
+	t.save(position)
+}
@@ -0,0 +1,62 @@
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/mikedewar/stablerisk/internal/errs"
+)
+
+// errComponent labels failures recorded by the TronGrid client
+const errComponent = "trongrid"
+
+// Kinds of TronGrid ingestion failure. Match them with errors.Is.
+var (
+	// ErrTronGridRateLimited is returned, inside a *RateLimitError, for 429 responses
+	ErrTronGridRateLimited = errs.New("trongrid_rate_limited", errs.ClassUpstream, "TronGrid rate limit exceeded")
+
+	// ErrTronGridUnavailable covers network failures and 5xx responses
+	ErrTronGridUnavailable = errs.New("trongrid_unavailable", errs.ClassUpstream, "TronGrid unavailable")
+
+	// ErrTronGridBadResponse is a response that could not be decoded or reported failure
+	ErrTronGridBadResponse = errs.New("trongrid_bad_response", errs.ClassUpstream, "TronGrid returned an invalid response")
+
+	// ErrTronGridRejected is a 4xx response other than 429, usually a bad API key or request
+	ErrTronGridRejected = errs.New("trongrid_rejected", errs.ClassInternal, "TronGrid rejected the request")
+
+	// ErrInvalidEvent is an event that claims to be a supported event but cannot be parsed or validated
+	ErrInvalidEvent = errs.New("invalid_event", errs.ClassInput, "invalid event")
+
+	// ErrUnsupportedEvent is an event the parser does not handle, such as Approval
+	ErrUnsupportedEvent = errs.New("unsupported_event", errs.ClassInput, "unsupported event")
+)
+
+// Unwrap classifies rate limiting for errors.Is and errs.Record
+func (e *RateLimitError) Unwrap() error { return ErrTronGridRateLimited }
+
+// fail creates an error of kind and records it, unless the client is
+// shutting down and the failure is just the cancelled request
+func (c *TronClient) fail(kind *errs.Kind, format string, args ...interface{}) error {
+	err := errs.Wrapf(kind, format, args...)
+	if c.ctx.Err() == nil {
+		errs.Record(errComponent, err)
+	}
+	return err
+}
+
+// statusError classifies a non-200 TronGrid response other than 429
+func (c *TronClient) statusError(status int, body []byte) error {
+	kind := ErrTronGridRejected
+	if status >= 500 {
+		kind = ErrTronGridUnavailable
+	}
+	return c.fail(kind, "TronGrid API returned status %d: %s", status, string(body))
+}
+
+// recordEventError counts a failure to process an event. Unsupported events
+// are expected, since contracts emit more than transfers, and not counted.
+func (c *TronClient) recordEventError(err error) {
+	if errors.Is(err, ErrUnsupportedEvent) || c.ctx.Err() != nil {
+		return
+	}
+	errs.Record(errComponent, err)
+}
@@ -0,0 +1,497 @@
+// Package ethereum ingests ERC-20 stablecoin transfers from an Ethereum node
+// by polling Transfer logs over JSON-RPC. Transactions are emitted in the same
+// models.Transaction form as the Tron client, tagged with models.ChainEthereum.
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Contract describes an ERC-20 token contract to monitor
+type Contract struct {
+	Address  string
+	Symbol   string
+	Decimals int32
+}
+
+// ClientConfig holds Ethereum client configuration
+type ClientConfig struct {
+	RPCURL        string
+	Contracts     []Contract
+	PollInterval  time.Duration // Default 15 seconds
+	Confirmations uint64        // Blocks behind head before logs are ingested (default 12)
+	MaxBlockRange uint64        // Blocks per eth_getLogs call (default 500)
+	// CheckpointStore persists the last fully processed block number across
+	// restarts. Optional; without it ingestion starts at the current safe head.
+	CheckpointStore blockchain.CheckpointStore
+	// AwaitDelivery holds checkpoints back until the consumer has confirmed,
+	// with Acknowledge, that the transactions before them were delivered
+	AwaitDelivery bool
+	// Backpressure decides what happens when the transaction channel is full
+	Backpressure blockchain.BackpressureConfig
+}
+
+// ClientStats holds polling counters
+type ClientStats struct {
+	BlocksScanned uint64 // Total blocks covered by eth_getLogs
+	LogsFetched   uint64 // Total Transfer logs fetched
+	Retractions   uint64 // Transactions reverted by chain reorganisations
+	HeadBlock     uint64 // Latest head block seen
+	Dropped       uint64 // Transactions lost because the channel stayed full
+	Spilled       uint64 // Transactions written to the spill queue
+	SpillDepth    int    // Transactions waiting in the spill queue
+}
+
+// Client polls an Ethereum node for ERC-20 Transfer logs
+type Client struct {
+	rpc           *rpcClient
+	contracts     map[string]Contract // Keyed by lowercase address
+	addresses     []string
+	pollInterval  time.Duration
+	confirmations uint64
+	maxBlockRange uint64
+	checkpoints   blockchain.CheckpointStore
+	backpressure  *blockchain.Backpressure
+	deliveries    *blockchain.DeliveryTracker // nil checkpoints as soon as a range is processed
+	logger        *zap.Logger
+
+	// Channels
+	txChannel      chan *models.Transaction
+	retractChannel chan string
+
+	// State
+	status     models.ConnectionStatus
+	statusLock sync.RWMutex
+	ctx        context.Context
+	cancel     context.CancelFunc
+	lastBlock  uint64
+	blockLock  sync.RWMutex
+
+	// Metrics
+	stats     ClientStats
+	statsLock sync.RWMutex
+}
+
+// NewClient creates a new Ethereum client
+func NewClient(config ClientConfig, logger *zap.Logger) *Client {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	pollInterval := config.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = 15 * time.Second
+	}
+
+	confirmations := config.Confirmations
+	if confirmations == 0 {
+		confirmations = 12
+	}
+
+	maxBlockRange := config.MaxBlockRange
+	if maxBlockRange == 0 {
+		maxBlockRange = 500
+	}
+
+	contracts := make(map[string]Contract, len(config.Contracts))
+	addresses := make([]string, 0, len(config.Contracts))
+	for _, contract := range config.Contracts {
+		address := strings.ToLower(strings.TrimSpace(contract.Address))
+		contracts[address] = contract
+		addresses = append(addresses, address)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	txChannel := make(chan *models.Transaction, 100)
+
+	client := &Client{
+		rpc: &rpcClient{
+			url:        config.RPCURL,
+			httpClient: &http.Client{Timeout: 30 * time.Second},
+		},
+		contracts:      contracts,
+		addresses:      addresses,
+		pollInterval:   pollInterval,
+		confirmations:  confirmations,
+		maxBlockRange:  maxBlockRange,
+		checkpoints:    config.CheckpointStore,
+		backpressure:   blockchain.NewBackpressure(config.Backpressure, txChannel, logger),
+		logger:         logger,
+		txChannel:      txChannel,
+		retractChannel: make(chan string, 100),
+		status:         models.StatusDisconnected,
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+	if config.AwaitDelivery {
+		client.deliveries = blockchain.NewDeliveryTracker(client.backpressure, func(position int64) {
+			client.saveCheckpoint(uint64(position))
+		})
+	}
+
+	return client
+}
+
+// Start restores the checkpoint, verifies the node is reachable and starts polling
+func (c *Client) Start() error {
+	c.logger.Info("Starting Ethereum client",
+		zap.Int("contracts", len(c.contracts)),
+		zap.Uint64("confirmations", c.confirmations))
+
+	if err := c.loadCheckpoint(); err != nil {
+		return fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+
+	if err := c.backpressure.Start(c.ctx); err != nil {
+		return fmt.Errorf("failed to start overflow handling: %w", err)
+	}
+
+	c.setStatus(models.StatusConnecting)
+	if _, err := c.blockNumber(); err != nil {
+		c.setStatus(models.StatusError)
+		return fmt.Errorf("initial connection failed: %w", err)
+	}
+	c.setStatus(models.StatusConnected)
+
+	go c.pollLogs()
+
+	return nil
+}
+
+// pollLogs polls for new logs until the client is closed
+func (c *Client) pollLogs() {
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			c.logger.Info("Log polling stopped")
+			return
+		case <-ticker.C:
+			if err := c.poll(); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return
+				}
+				// The next tick retries from the last checkpointed block
+				c.logger.Error("Failed to poll logs", zap.Error(err))
+				c.setStatus(models.StatusError)
+				continue
+			}
+			c.setStatus(models.StatusConnected)
+		}
+	}
+}
+
+// poll fetches logs from the last processed block up to the confirmed head,
+// in ranges of at most maxBlockRange blocks
+func (c *Client) poll() error {
+	head, err := c.blockNumber()
+	if err != nil {
+		return err
+	}
+
+	c.statsLock.Lock()
+	c.stats.HeadBlock = head
+	c.statsLock.Unlock()
+
+	if head < c.confirmations {
+		return nil
+	}
+	safe := head - c.confirmations
+
+	last := c.LastBlock()
+	if last == 0 {
+		// No checkpoint: start at the confirmed head rather than genesis
+		last = safe - 1
+	}
+
+	for from := last + 1; from <= safe; {
+		to := from + c.maxBlockRange - 1
+		if to > safe {
+			to = safe
+		}
+
+		logs, err := c.getLogs(from, to)
+		if err != nil {
+			return err
+		}
+
+		if err := c.processLogs(logs); err != nil {
+			return err
+		}
+
+		c.statsLock.Lock()
+		c.stats.BlocksScanned += to - from + 1
+		c.stats.LogsFetched += uint64(len(logs))
+		c.statsLock.Unlock()
+
+		c.blockLock.Lock()
+		c.lastBlock = to
+		c.blockLock.Unlock()
+		if c.deliveries != nil {
+			c.deliveries.Checkpoint(int64(to))
+		} else {
+			c.saveCheckpoint(to)
+		}
+
+		from = to + 1
+	}
+
+	return nil
+}
+
+// processLogs converts logs into transactions or retractions
+func (c *Client) processLogs(logs []Log) error {
+	timestamps := make(map[string]time.Time)
+
+	for i := range logs {
+		log := &logs[i]
+
+		contract, ok := c.contracts[strings.ToLower(log.Address)]
+		if !ok {
+			continue
+		}
+
+		if log.Removed {
+			if err := c.retract(log); err != nil {
+				return err
+			}
+			continue
+		}
+		metrics.EventsFetched.WithLabelValues(string(models.ChainEthereum), contract.Symbol).Inc()
+
+		timestamp, err := c.logTimestamp(log, timestamps)
+		if err != nil {
+			return err
+		}
+
+		tx, err := parseTransferLog(log, contract, timestamp)
+		if err != nil {
+			c.logger.Warn("Failed to parse Transfer log",
+				zap.Error(err),
+				zap.String("tx_hash", log.TransactionHash))
+			continue
+		}
+
+		if err := blockchain.ValidateTransaction(tx); err != nil {
+			c.logger.Warn("Invalid transaction",
+				zap.Error(err),
+				zap.String("tx_hash", tx.TxHash))
+			continue
+		}
+
+		if err := c.backpressure.Send(c.ctx, tx); err != nil {
+			return err
+		}
+
+		c.logger.Debug("Transaction processed",
+			zap.String("tx_hash", tx.TxHash),
+			zap.String("token", tx.Token),
+			zap.String("amount", tx.Amount.String()))
+	}
+
+	return nil
+}
+
+// retract publishes the hash of a transaction reverted by a reorg. Like the
+// Tron client, retractions are never dropped.
+func (c *Client) retract(log *Log) error {
+	txHash := strings.ToLower(log.TransactionHash)
+
+	c.logger.Warn("Log removed by chain reorganisation",
+		zap.String("tx_hash", txHash),
+		zap.String("block", log.BlockNumber))
+
+	select {
+	case c.retractChannel <- txHash:
+		c.statsLock.Lock()
+		c.stats.Retractions++
+		c.statsLock.Unlock()
+		return nil
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+}
+
+// logTimestamp returns the block time of a log, fetching and caching the block
+// header when the node does not include blockTimestamp in logs
+func (c *Client) logTimestamp(log *Log, cache map[string]time.Time) (time.Time, error) {
+	if log.BlockTimestamp != "" {
+		seconds, err := hexToUint64(log.BlockTimestamp)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid block timestamp: %w", err)
+		}
+		return time.Unix(int64(seconds), 0), nil
+	}
+
+	if timestamp, ok := cache[log.BlockNumber]; ok {
+		return timestamp, nil
+	}
+
+	var block struct {
+		Timestamp string `json:"timestamp"`
+	}
+	if err := c.rpc.call(c.ctx, "eth_getBlockByNumber", &block, log.BlockNumber, false); err != nil {
+		return time.Time{}, err
+	}
+
+	seconds, err := hexToUint64(block.Timestamp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid block timestamp: %w", err)
+	}
+
+	timestamp := time.Unix(int64(seconds), 0)
+	cache[log.BlockNumber] = timestamp
+	return timestamp, nil
+}
+
+// blockNumber returns the current head block
+func (c *Client) blockNumber() (uint64, error) {
+	var result string
+	if err := c.rpc.call(c.ctx, "eth_blockNumber", &result); err != nil {
+		return 0, err
+	}
+	return hexToUint64(result)
+}
+
+// getLogs fetches Transfer logs of the monitored contracts in a block range
+func (c *Client) getLogs(from, to uint64) ([]Log, error) {
+	filter := map[string]interface{}{
+		"fromBlock": toHex(from),
+		"toBlock":   toHex(to),
+		"address":   c.addresses,
+		"topics":    []interface{}{TransferTopic},
+	}
+
+	var logs []Log
+	if err := c.rpc.call(c.ctx, "eth_getLogs", &logs, filter); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// loadCheckpoint restores the last processed block from the checkpoint store
+func (c *Client) loadCheckpoint() error {
+	if c.checkpoints == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, 10*time.Second)
+	defer cancel()
+
+	block, err := c.checkpoints.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.blockLock.Lock()
+	c.lastBlock = uint64(block)
+	c.blockLock.Unlock()
+
+	if block > 0 {
+		c.logger.Info("Resuming from checkpoint", zap.Int64("block", block))
+	}
+
+	return nil
+}
+
+// saveCheckpoint persists the last processed block. Failures are logged and
+// retried with a newer block on the next range.
+func (c *Client) saveCheckpoint(block uint64) {
+	if c.checkpoints == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.checkpoints.Save(ctx, int64(block)); err != nil {
+		c.logger.Error("Failed to save checkpoint",
+			zap.Error(err),
+			zap.Uint64("block", block))
+	}
+}
+
+// LastBlock returns the last fully processed block number
+func (c *Client) LastBlock() uint64 {
+	c.blockLock.RLock()
+	defer c.blockLock.RUnlock()
+	return c.lastBlock
+}
+
+// Transactions returns the transaction channel
+func (c *Client) Transactions() <-chan *models.Transaction {
+	return c.txChannel
+}
+
+// Acknowledge confirms that the next n transactions received from
+// Transactions have been delivered. Only needed with AwaitDelivery.
+func (c *Client) Acknowledge(n int) {
+	if c.deliveries != nil {
+		c.deliveries.Acknowledge(n)
+	}
+}
+
+// Retractions returns the channel of transaction hashes reverted by chain
+// reorganisations
+func (c *Client) Retractions() <-chan string {
+	return c.retractChannel
+}
+
+// Stats returns a snapshot of the polling counters
+func (c *Client) Stats() ClientStats {
+	c.statsLock.RLock()
+	stats := c.stats
+	c.statsLock.RUnlock()
+
+	overflow := c.backpressure.Stats()
+	stats.Dropped = overflow.Dropped
+	stats.Spilled = overflow.Spilled
+	stats.SpillDepth = overflow.SpillDepth
+	return stats
+}
+
+// Status returns the current connection status
+func (c *Client) Status() models.ConnectionStatus {
+	c.statusLock.RLock()
+	defer c.statusLock.RUnlock()
+	return c.status
+}
+
+// setStatus sets the connection status
+func (c *Client) setStatus(status models.ConnectionStatus) {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+
+	if c.status != status {
+		c.logger.Info("Status changed",
+			zap.String("from", string(c.status)),
+			zap.String("to", string(status)))
+		c.status = status
+	}
+}
+
+// IsConnected returns whether the last poll succeeded
+func (c *Client) IsConnected() bool {
+	return c.Status() == models.StatusConnected
+}
+
+// Close stops polling
+func (c *Client) Close() error {
+	c.logger.Info("Closing Ethereum client")
+	c.cancel()
+	c.setStatus(models.StatusDisconnected)
+	return nil
+}
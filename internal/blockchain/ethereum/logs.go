@@ -0,0 +1,102 @@
+package ethereum
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+)
+
+// TransferTopic is keccak256("Transfer(address,address,uint256)"), the first
+// topic of every ERC-20 Transfer log
+const TransferTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+// Log is an Ethereum event log as returned by eth_getLogs
+type Log struct {
+	Address          string   `json:"address"`
+	Topics           []string `json:"topics"`
+	Data             string   `json:"data"`
+	BlockNumber      string   `json:"blockNumber"`
+	BlockTimestamp   string   `json:"blockTimestamp,omitempty"` // Not returned by every node
+	TransactionHash  string   `json:"transactionHash"`
+	TransactionIndex string   `json:"transactionIndex"`
+	LogIndex         string   `json:"logIndex"`
+	Removed          bool     `json:"removed"` // Reverted by a chain reorganisation
+}
+
+// parseTransferLog converts an ERC-20 Transfer log into a transaction
+func parseTransferLog(log *Log, token Contract, timestamp time.Time) (*models.Transaction, error) {
+	if len(log.Topics) != 3 || !strings.EqualFold(log.Topics[0], TransferTopic) {
+		return nil, fmt.Errorf("not an ERC-20 Transfer log")
+	}
+
+	from, err := topicAddress(log.Topics[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode from address: %w", err)
+	}
+
+	to, err := topicAddress(log.Topics[2])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode to address: %w", err)
+	}
+
+	value, err := hexToBig(log.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode value: %w", err)
+	}
+
+	blockNumber, err := hexToUint64(log.BlockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode block number: %w", err)
+	}
+
+	return &models.Transaction{
+		TxHash:      strings.ToLower(log.TransactionHash),
+		BlockNumber: blockNumber,
+		Timestamp:   timestamp,
+		From:        from,
+		To:          to,
+		Amount:      decimal.NewFromBigInt(value, -token.Decimals),
+		Contract:    strings.ToLower(log.Address),
+		Token:       token.Symbol,
+		Chain:       models.ChainEthereum,
+		Confirmed:   true,
+	}, nil
+}
+
+// topicAddress extracts the address from a 32-byte indexed topic
+func topicAddress(topic string) (string, error) {
+	hex := strings.TrimPrefix(strings.ToLower(topic), "0x")
+	if len(hex) != 64 {
+		return "", fmt.Errorf("invalid topic length: %d", len(hex))
+	}
+	return "0x" + hex[24:], nil
+}
+
+// hexToBig parses a 0x-prefixed hex quantity or word
+func hexToBig(s string) (*big.Int, error) {
+	hex := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if hex == "" {
+		return new(big.Int), nil
+	}
+
+	value, ok := new(big.Int).SetString(hex, 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid hex value: %s", s)
+	}
+	return value, nil
+}
+
+// hexToUint64 parses a 0x-prefixed hex quantity
+func hexToUint64(s string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"), 16, 64)
+}
+
+// toHex formats a block number as a JSON-RPC quantity
+func toHex(n uint64) string {
+	return "0x" + strconv.FormatUint(n, 16)
+}
@@ -0,0 +1,51 @@
+package blockchain
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/mikedewar/stablerisk/pkg/models"
+)
+
+// IssuerEventStore persists issuer events in the issuer_events table
+type IssuerEventStore struct {
+	db *sql.DB
+}
+
+// NewIssuerEventStore creates a database-backed issuer event store
+func NewIssuerEventStore(db *sql.DB) *IssuerEventStore {
+	return &IssuerEventStore{db: db}
+}
+
+// Save records an issuer event. An event already recorded, e.g. one seen
+// again after a restart, is ignored.
+func (s *IssuerEventStore) Save(ctx context.Context, event *models.IssuerEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO issuer_events (id, tx_hash, type, address, amount, block_number,
+		                           timestamp, contract, token, chain)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (tx_hash, type, address) DO NOTHING
+	`,
+		event.ID,
+		event.TxHash,
+		string(event.Type),
+		event.Address,
+		event.Amount.String(),
+		event.BlockNumber,
+		event.Timestamp,
+		event.Contract,
+		event.Token,
+		string(event.Chain),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save issuer event: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitError is returned when the API rejects a request with 429 Too Many
+// Requests. RetryAfter is the server's requested delay, or zero if it gave none.
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Body       string
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("rate limited, retry after %s: %s", e.RetryAfter, e.Body)
+	}
+	return fmt.Sprintf("rate limited: %s", e.Body)
+}
+
+// parseRetryAfter reads the delay requested by a rate-limited response. It
+// understands Retry-After in seconds or as an HTTP date, and falls back to
+// X-RateLimit-Reset as either a Unix timestamp or seconds until reset.
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if at, err := http.ParseTime(value); err == nil && at.After(now) {
+			return at.Sub(now)
+		}
+	}
+
+	if value := header.Get("X-RateLimit-Reset"); value != "" {
+		if reset, err := strconv.ParseInt(value, 10, 64); err == nil && reset > 0 {
+			// Values this large are Unix timestamps rather than deltas
+			if reset > 1_000_000_000 {
+				if at := time.Unix(reset, 0); at.After(now) {
+					return at.Sub(now)
+				}
+				return 0
+			}
+			return time.Duration(reset) * time.Second
+		}
+	}
+
+	return 0
+}
+
+// RateLimiter is a token bucket limiting outbound requests. A single limiter
+// can be shared by several clients using the same API key.
+type RateLimiter struct {
+	mu          sync.Mutex
+	rate        float64 // Tokens added per second
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+// NewRateLimiter creates a limiter allowing rps requests per second with bursts
+// of up to burst requests. A burst below 1 is treated as 1.
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &RateLimiter{
+		rate:   rps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request may be made or ctx is cancelled
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		delay := l.reserve()
+		if delay <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token if one is available, otherwise returns how long to
+// wait before trying again
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// Pause blocks all requests for d, e.g. after the server asked us to back off.
+// Overlapping pauses keep the later deadline.
+func (l *RateLimiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+		// Resume from an empty bucket rather than a full burst
+		l.tokens = 0
+		l.last = until
+	}
+}
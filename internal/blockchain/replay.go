@@ -0,0 +1,387 @@
+package blockchain
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// ReplayContract is a token contract whose TronEvents a replay parses
+type ReplayContract struct {
+	Address  string
+	Symbol   string
+	Decimals int32
+}
+
+// ReplayConfig holds replay source configuration
+type ReplayConfig struct {
+	Path string // Newline-delimited JSON TronEvents or transactions, gzipped if it ends in .gz
+	// Speed is a multiple of the recorded pace: 1 replays in real time, 10
+	// ten times faster. 0 replays as fast as the pipeline accepts.
+	Speed float64
+	// Rebase shifts every timestamp by the same offset so the first record
+	// is stamped with the time the replay started
+	Rebase    bool
+	Contracts []ReplayContract // Contracts whose TronEvents are parsed (default USDT)
+}
+
+// ReplayStats holds replay counters
+type ReplayStats struct {
+	Lines        uint64 // Lines read
+	Transactions uint64 // Transactions emitted
+	Retractions  uint64 // Removed events emitted as retractions
+	IssuerEvents uint64 // Issuer events emitted
+	Duplicates   uint64 // Re-delivered TronEvents skipped, as recorded in raw archives
+	Skipped      uint64 // Lines that were not valid records or not for a known contract
+}
+
+// replayRecord holds the fields that tell the two record kinds apart
+type replayRecord struct {
+	TxHash        string `json:"tx_hash"`        // Set on transactions
+	TransactionID string `json:"transaction_id"` // Set on TronEvents
+}
+
+// ReplaySource emits the transactions recorded in a file in place of a live
+// chain client. It has the same channels as TronClient, which are
+// unbuffered so that Done is only closed once every record was received.
+type ReplaySource struct {
+	config  ReplayConfig
+	parsers map[string]*TransactionParser // By lower-case contract address
+	dedup   *DedupCache
+	logger  *zap.Logger
+
+	txChannel      chan *models.Transaction
+	retractChannel chan string
+	issuerChannel  chan *models.IssuerEvent
+	done           chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	status     models.ConnectionStatus
+	statusLock sync.RWMutex
+
+	stats     ReplayStats
+	statsLock sync.RWMutex
+}
+
+// NewReplaySource creates a replay source
+func NewReplaySource(config ReplayConfig, logger *zap.Logger) *ReplaySource {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	contracts := config.Contracts
+	if len(contracts) == 0 {
+		contracts = []ReplayContract{{Address: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", Symbol: USDTSymbol, Decimals: USDTDecimals}}
+	}
+	parsers := make(map[string]*TransactionParser, len(contracts))
+	for _, contract := range contracts {
+		parsers[strings.ToLower(strings.TrimSpace(contract.Address))] = NewTokenParser(contract.Address, contract.Symbol, contract.Decimals)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &ReplaySource{
+		config:         config,
+		parsers:        parsers,
+		dedup:          NewDedupCache(10000),
+		logger:         logger,
+		txChannel:      make(chan *models.Transaction),
+		retractChannel: make(chan string),
+		issuerChannel:  make(chan *models.IssuerEvent),
+		done:           make(chan struct{}),
+		ctx:            ctx,
+		cancel:         cancel,
+		status:         models.StatusDisconnected,
+	}
+}
+
+// Start opens the file and begins replaying it
+func (r *ReplaySource) Start() error {
+	file, err := os.Open(r.config.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open replay file: %w", err)
+	}
+
+	var reader io.Reader = file
+	if strings.HasSuffix(r.config.Path, ".gz") {
+		// Raw event archives are gzipped NDJSON, and concatenated archives
+		// decompress as one stream
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to open gzipped replay file: %w", err)
+		}
+		reader = gz
+	}
+
+	r.logger.Info("Starting replay",
+		zap.String("path", r.config.Path),
+		zap.Float64("speed", r.config.Speed),
+		zap.Bool("rebase", r.config.Rebase))
+	r.setStatus(models.StatusConnected)
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer file.Close()
+		defer r.setStatus(models.StatusDisconnected)
+
+		if err := r.replay(reader); err != nil {
+			r.logger.Error("Replay stopped", zap.Error(err))
+			return
+		}
+
+		stats := r.Stats()
+		r.logger.Info("Replay finished",
+			zap.Uint64("lines", stats.Lines),
+			zap.Uint64("transactions", stats.Transactions),
+			zap.Uint64("retractions", stats.Retractions),
+			zap.Uint64("issuer_events", stats.IssuerEvents),
+			zap.Uint64("duplicates", stats.Duplicates),
+			zap.Uint64("skipped", stats.Skipped))
+		close(r.done)
+	}()
+
+	return nil
+}
+
+// replay emits every record in the file, pacing them by their timestamps
+func (r *ReplaySource) replay(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	started := time.Now()
+	var first, previous time.Time
+	var offset time.Duration
+
+	for line := 1; scanner.Scan(); line++ {
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+		r.count(func(s *ReplayStats) { s.Lines++ })
+
+		timestamp, emit, err := r.decode([]byte(data))
+		if err != nil {
+			r.count(func(s *ReplayStats) { s.Skipped++ })
+			r.logger.Warn("Skipping replay record",
+				zap.Int("line", line),
+				zap.Error(err))
+			continue
+		}
+
+		if !timestamp.IsZero() {
+			if first.IsZero() {
+				first = timestamp
+				if r.config.Rebase {
+					offset = started.Sub(first)
+				}
+			}
+			if err := r.pace(previous, timestamp); err != nil {
+				return err
+			}
+			previous = timestamp
+		}
+
+		if err := emit(offset); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read replay file: %w", err)
+	}
+	return nil
+}
+
+// decode parses one record and returns its recorded time and a function
+// that emits it with timestamps shifted by the rebase offset
+func (r *ReplaySource) decode(data []byte) (time.Time, func(time.Duration) error, error) {
+	var record replayRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return time.Time{}, nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	switch {
+	case record.TxHash != "":
+		var tx models.Transaction
+		if err := json.Unmarshal(data, &tx); err != nil {
+			return time.Time{}, nil, fmt.Errorf("invalid transaction: %w", err)
+		}
+		if err := ValidateTransaction(&tx); err != nil {
+			return time.Time{}, nil, err
+		}
+		return tx.Timestamp, func(offset time.Duration) error {
+			tx.Timestamp = tx.Timestamp.Add(offset)
+			return r.emitTransaction(&tx)
+		}, nil
+
+	case record.TransactionID != "":
+		var event models.TronEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return time.Time{}, nil, fmt.Errorf("invalid TronEvent: %w", err)
+		}
+		parser, ok := r.parsers[strings.ToLower(strings.TrimSpace(event.ContractAddress))]
+		if !ok {
+			return time.Time{}, nil, fmt.Errorf("event for unmonitored contract %s", event.ContractAddress)
+		}
+		timestamp := time.UnixMilli(event.BlockTimestamp)
+		return timestamp, func(offset time.Duration) error {
+			event.BlockTimestamp += offset.Milliseconds()
+			return r.emitEvent(parser, &event)
+		}, nil
+
+	default:
+		return time.Time{}, nil, errors.New("record is neither a transaction nor a TronEvent")
+	}
+}
+
+// emitEvent parses a TronEvent the way TronClient does and emits the result
+func (r *ReplaySource) emitEvent(parser *TransactionParser, event *models.TronEvent) error {
+	if r.dedup.SeenEvent(event) {
+		r.count(func(s *ReplayStats) { s.Duplicates++ })
+		return nil
+	}
+
+	if IsIssuerEvent(event.EventName) {
+		issuerEvent, err := parser.ParseIssuerEvent(event)
+		if err != nil {
+			r.count(func(s *ReplayStats) { s.Skipped++ })
+			return nil
+		}
+		select {
+		case r.issuerChannel <- issuerEvent:
+			r.count(func(s *ReplayStats) { s.IssuerEvents++ })
+			return nil
+		case <-r.ctx.Done():
+			return r.ctx.Err()
+		}
+	}
+
+	tx, err := parser.ParseEvent(event)
+	if errors.Is(err, ErrRemovedEvent) {
+		return r.emitRetraction(event.TransactionID)
+	}
+	if err == nil {
+		err = ValidateTransaction(tx)
+	}
+	if err != nil {
+		// Non-Transfer events are skipped, as they are when polling
+		r.count(func(s *ReplayStats) { s.Skipped++ })
+		r.logger.Debug("Skipping replayed event",
+			zap.Error(err),
+			zap.String("tx_hash", event.TransactionID))
+		return nil
+	}
+	return r.emitTransaction(tx)
+}
+
+func (r *ReplaySource) emitTransaction(tx *models.Transaction) error {
+	select {
+	case r.txChannel <- tx:
+		r.count(func(s *ReplayStats) { s.Transactions++ })
+		return nil
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	}
+}
+
+func (r *ReplaySource) emitRetraction(txHash string) error {
+	select {
+	case r.retractChannel <- txHash:
+		r.count(func(s *ReplayStats) { s.Retractions++ })
+		return nil
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	}
+}
+
+// pace sleeps for the recorded time between two records, scaled by Speed
+func (r *ReplaySource) pace(previous, next time.Time) error {
+	if r.config.Speed <= 0 || previous.IsZero() || !next.After(previous) {
+		return nil
+	}
+
+	delay := time.Duration(float64(next.Sub(previous)) / r.config.Speed)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	}
+}
+
+func (r *ReplaySource) count(fn func(*ReplayStats)) {
+	r.statsLock.Lock()
+	fn(&r.stats)
+	r.statsLock.Unlock()
+}
+
+// Transactions returns the transaction channel
+func (r *ReplaySource) Transactions() <-chan *models.Transaction {
+	return r.txChannel
+}
+
+// Retractions returns hashes of transactions whose recorded events were removed
+func (r *ReplaySource) Retractions() <-chan string {
+	return r.retractChannel
+}
+
+// IssuerEvents returns the issuer event channel
+func (r *ReplaySource) IssuerEvents() <-chan *models.IssuerEvent {
+	return r.issuerChannel
+}
+
+// Done is closed once every record in the file has been received
+func (r *ReplaySource) Done() <-chan struct{} {
+	return r.done
+}
+
+// Stats returns a snapshot of the replay counters
+func (r *ReplaySource) Stats() ReplayStats {
+	r.statsLock.RLock()
+	defer r.statsLock.RUnlock()
+	return r.stats
+}
+
+// Status returns connected while the file is being replayed
+func (r *ReplaySource) Status() models.ConnectionStatus {
+	r.statusLock.RLock()
+	defer r.statusLock.RUnlock()
+	return r.status
+}
+
+func (r *ReplaySource) setStatus(status models.ConnectionStatus) {
+	r.statusLock.Lock()
+	defer r.statusLock.Unlock()
+	r.status = status
+}
+
+// IsConnected reports whether the replay is still running
+func (r *ReplaySource) IsConnected() bool {
+	return r.Status() == models.StatusConnected
+}
+
+// Close stops the replay
+func (r *ReplaySource) Close() error {
+	r.cancel()
+	r.wg.Wait()
+	return nil
+}
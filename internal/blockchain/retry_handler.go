@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -38,6 +39,11 @@ type RetryHandler struct {
 	attempt       int
 	circuitOpen   bool
 	circuitOpened time.Time
+
+	// Server-requested minimum delay for the next retry (e.g. Retry-After).
+	// Set from the polling goroutine, so it is guarded separately.
+	retryAfter     time.Duration
+	retryAfterLock sync.Mutex
 }
 
 // NewRetryHandler creates a new retry handler
@@ -76,8 +82,31 @@ func (r *RetryHandler) ShouldRetry() bool {
 	return true
 }
 
-// NextDelay calculates the next retry delay using exponential backoff
+// SetRetryAfter sets a minimum delay for the next retry, as requested by the
+// server. It applies once and is cleared by the next Wait.
+func (r *RetryHandler) SetRetryAfter(d time.Duration) {
+	r.retryAfterLock.Lock()
+	defer r.retryAfterLock.Unlock()
+	r.retryAfter = d
+}
+
+// NextDelay calculates the next retry delay using exponential backoff. A
+// server-requested delay takes precedence when it is longer.
 func (r *RetryHandler) NextDelay() time.Duration {
+	delay := r.backoffDelay()
+
+	r.retryAfterLock.Lock()
+	retryAfter := r.retryAfter
+	r.retryAfterLock.Unlock()
+
+	if retryAfter > delay {
+		return retryAfter
+	}
+	return delay
+}
+
+// backoffDelay calculates the exponential backoff delay for the current attempt
+func (r *RetryHandler) backoffDelay() time.Duration {
 	if r.attempt == 0 {
 		return r.config.InitialDelay
 	}
@@ -113,6 +142,7 @@ func (r *RetryHandler) Wait(ctx context.Context) error {
 		return ctx.Err()
 	case <-time.After(delay):
 		r.attempt++
+		r.SetRetryAfter(0)
 		return nil
 	}
 }
@@ -0,0 +1,151 @@
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+)
+
+// SpillQueue is a disk-backed FIFO of transactions, stored as JSON lines. It
+// absorbs bursts the in-memory channel cannot hold. Records are consumed with
+// Peek and Commit so a transaction is only removed once it has been delivered.
+// Space is reclaimed only when the queue empties, so a restart redelivers every
+// record still in the file; consumers must tolerate duplicates.
+type SpillQueue struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	offset   int64 // Read position of the next record
+	size     int64 // Bytes written
+	pending  int
+	peekSize int64 // Length of the record returned by the last Peek
+}
+
+// OpenSpillQueue opens or creates a spill queue file. Records left by a
+// previous run are kept and delivered first.
+func OpenSpillQueue(path string) (*SpillQueue, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spill queue: %w", err)
+	}
+
+	q := &SpillQueue{path: path, file: file}
+
+	// Count records left over from a previous run
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read spill queue: %w", err)
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		q.size += int64(len(scanner.Bytes())) + 1
+		q.pending++
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read spill queue: %w", err)
+	}
+
+	return q, nil
+}
+
+// Push appends a transaction to the queue
+func (q *SpillQueue) Push(tx *models.Transaction) error {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return fmt.Errorf("failed to encode transaction: %w", err)
+	}
+	data = append(data, '\n')
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, err := q.file.WriteAt(data, q.size); err != nil {
+		return fmt.Errorf("failed to write spill queue: %w", err)
+	}
+	if err := q.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync spill queue: %w", err)
+	}
+
+	q.size += int64(len(data))
+	q.pending++
+	return nil
+}
+
+// Peek returns the oldest transaction without removing it, or nil if the
+// queue is empty
+func (q *SpillQueue) Peek() (*models.Transaction, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.pending == 0 {
+		return nil, nil
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(q.file, q.offset, q.size-q.offset))
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spill queue: %w", err)
+	}
+
+	// Set before decoding so a corrupt record can be skipped with Commit
+	q.peekSize = int64(len(line))
+
+	var tx models.Transaction
+	if err := json.Unmarshal(bytes.TrimSpace(line), &tx); err != nil {
+		return nil, fmt.Errorf("failed to decode spilled transaction: %w", err)
+	}
+
+	return &tx, nil
+}
+
+// Commit removes the record returned by the last Peek. The file is truncated
+// once every record has been consumed.
+func (q *SpillQueue) Commit() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.peekSize == 0 {
+		return nil
+	}
+
+	q.offset += q.peekSize
+	q.peekSize = 0
+	q.pending--
+
+	if q.pending == 0 {
+		if err := q.file.Truncate(0); err != nil {
+			return fmt.Errorf("failed to truncate spill queue: %w", err)
+		}
+		q.offset = 0
+		q.size = 0
+	}
+
+	return nil
+}
+
+// Len returns the number of queued transactions
+func (q *SpillQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending
+}
+
+// Close closes the queue file
+func (q *SpillQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.file.Close()
+}
@@ -2,11 +2,13 @@ package blockchain
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 	"strings"
 	"time"
 
+	"github.com/mikedewar/stablerisk/internal/errs"
 	"github.com/mikedewar/stablerisk/pkg/models"
 	"github.com/shopspring/decimal"
 )
@@ -17,17 +19,33 @@ const (
 
 	// USDT TRC20 has 6 decimals
 	USDTDecimals = 6
+
+	// USDTSymbol is the token symbol used when none is configured
+	USDTSymbol = "USDT"
 )
 
+// ErrRemovedEvent is returned for events reverted by a chain reorganisation.
+// The transaction they describe should be retracted rather than ingested.
+var ErrRemovedEvent = errors.New("event removed by chain reorganisation")
+
 // TransactionParser handles parsing of Tron events into transactions
 type TransactionParser struct {
-	usdtContract string
+	usdtContract string // Contract whose events are parsed, not necessarily USDT
+	symbol       string
+	decimals     int32
 }
 
-// NewTransactionParser creates a new transaction parser
+// NewTransactionParser creates a new transaction parser for USDT
 func NewTransactionParser(usdtContract string) *TransactionParser {
+	return NewTokenParser(usdtContract, USDTSymbol, USDTDecimals)
+}
+
+// NewTokenParser creates a transaction parser for any TRC20 token
+func NewTokenParser(contract, symbol string, decimals int32) *TransactionParser {
 	return &TransactionParser{
-		usdtContract: strings.ToLower(strings.TrimSpace(usdtContract)),
+		usdtContract: strings.ToLower(strings.TrimSpace(contract)),
+		symbol:       symbol,
+		decimals:     decimals,
 	}
 }
 
@@ -35,24 +53,31 @@ func NewTransactionParser(usdtContract string) *TransactionParser {
 func (p *TransactionParser) ParseEvent(event *models.TronEvent) (*models.Transaction, error) {
 	// Validate event
 	if event == nil {
-		return nil, fmt.Errorf("event is nil")
+		return nil, errs.Wrapf(ErrInvalidEvent, "event is nil")
 	}
 
 	// Check if this is a Transfer event
 	if event.EventName != "Transfer" {
-		return nil, fmt.Errorf("not a Transfer event: %s", event.EventName)
+		return nil, errs.Wrapf(ErrUnsupportedEvent, "not a Transfer event: %s", event.EventName)
 	}
 
 	// Check if this is from the USDT contract
 	contractAddr := strings.ToLower(strings.TrimSpace(event.ContractAddress))
 	if contractAddr != p.usdtContract {
-		return nil, fmt.Errorf("not a USDT contract event: %s", event.ContractAddress)
+		return nil, errs.Wrapf(ErrUnsupportedEvent, "not a %s contract event: %s", p.symbol, event.ContractAddress)
+	}
+
+	// Reverted events must not be ingested as new transfers. TronGrid only
+	// reports them alongside unconfirmed events, so a Tron client fetching
+	// with only_confirmed never reaches this path.
+	if event.Removed {
+		return nil, fmt.Errorf("%w: %s", ErrRemovedEvent, event.TransactionID)
 	}
 
 	// Parse transfer event data from Result field
 	transfer, err := p.parseTransferEvent(event.Result)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse transfer event: %w", err)
+		return nil, errs.Wrapf(ErrInvalidEvent, "failed to parse transfer event: %w", err)
 	}
 
 	// Convert timestamp from milliseconds to time.Time
@@ -67,12 +92,94 @@ func (p *TransactionParser) ParseEvent(event *models.TronEvent) (*models.Transac
 		To:          transfer.To,
 		Amount:      transfer.Value,
 		Contract:    event.ContractAddress,
-		Confirmed:   true,
+		Token:       p.symbol,
+		Chain:       models.ChainTron,
+		Confirmed:   !event.Unconfirmed,
 	}
 
 	return tx, nil
 }
 
+// issuerEvents maps Tether contract event names to issuer event types and the
+// result keys holding the affected address and amount
+var issuerEvents = map[string]struct {
+	eventType  models.IssuerEventType
+	addressKey string
+	amountKey  string
+}{
+	"AddedBlackList":      {models.IssuerEventBlacklisted, "_user", ""},
+	"RemovedBlackList":    {models.IssuerEventUnblacklisted, "_user", ""},
+	"DestroyedBlackFunds": {models.IssuerEventFundsDestroyed, "_blackListedUser", "_balance"},
+	"Issue":               {models.IssuerEventIssue, "", "amount"},
+	"Redeem":              {models.IssuerEventRedeem, "", "amount"},
+}
+
+// IsIssuerEvent reports whether an event name is an issuer administrative event
+func IsIssuerEvent(eventName string) bool {
+	_, ok := issuerEvents[eventName]
+	return ok
+}
+
+// ParseIssuerEvent parses a blacklist, issue or redeem event
+func (p *TransactionParser) ParseIssuerEvent(event *models.TronEvent) (*models.IssuerEvent, error) {
+	if event == nil {
+		return nil, errs.Wrapf(ErrInvalidEvent, "event is nil")
+	}
+
+	spec, ok := issuerEvents[event.EventName]
+	if !ok {
+		return nil, errs.Wrapf(ErrUnsupportedEvent, "not an issuer event: %s", event.EventName)
+	}
+
+	contractAddr := strings.ToLower(strings.TrimSpace(event.ContractAddress))
+	if contractAddr != p.usdtContract {
+		return nil, errs.Wrapf(ErrUnsupportedEvent, "not a %s contract event: %s", p.symbol, event.ContractAddress)
+	}
+
+	if event.Removed {
+		return nil, fmt.Errorf("%w: %s", ErrRemovedEvent, event.TransactionID)
+	}
+
+	issuerEvent := &models.IssuerEvent{
+		TxHash:      event.TransactionID,
+		Type:        spec.eventType,
+		BlockNumber: event.BlockNumber,
+		Timestamp:   time.Unix(event.BlockTimestamp/1000, (event.BlockTimestamp%1000)*int64(time.Millisecond)),
+		Contract:    event.ContractAddress,
+		Token:       p.symbol,
+		Chain:       models.ChainTron,
+	}
+
+	// Positional keys are used when the ABI parameter names are not available
+	if spec.addressKey != "" {
+		address, err := p.extractAddress(event.Result, spec.addressKey)
+		if err != nil {
+			address, err = p.extractAddress(event.Result, "0")
+		}
+		if err != nil {
+			return nil, errs.Wrapf(ErrInvalidEvent, "failed to extract address: %w", err)
+		}
+		issuerEvent.Address = address
+	}
+
+	if spec.amountKey != "" {
+		position := "0"
+		if spec.addressKey != "" {
+			position = "1"
+		}
+		value, err := p.extractValue(event.Result, spec.amountKey)
+		if err != nil {
+			value, err = p.extractValue(event.Result, position)
+		}
+		if err != nil {
+			return nil, errs.Wrapf(ErrInvalidEvent, "failed to extract amount: %w", err)
+		}
+		issuerEvent.Amount = decimal.NewFromBigInt(value, -p.decimals)
+	}
+
+	return issuerEvent, nil
+}
+
 // parseTransferEvent extracts transfer data from event data
 func (p *TransactionParser) parseTransferEvent(eventData map[string]interface{}) (*models.TransferEvent, error) {
 	// Extract from address
@@ -93,8 +200,8 @@ func (p *TransactionParser) parseTransferEvent(eventData map[string]interface{})
 		return nil, fmt.Errorf("failed to extract value: %w", err)
 	}
 
-	// Convert value from smallest unit to USDT (6 decimals)
-	amount := decimal.NewFromBigInt(value, -USDTDecimals)
+	// Convert value from the token's smallest unit
+	amount := decimal.NewFromBigInt(value, -p.decimals)
 
 	return &models.TransferEvent{
 		From:  fromAddr,
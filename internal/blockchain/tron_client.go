@@ -3,12 +3,17 @@ package blockchain
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/mikedewar/stablerisk/internal/errs"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/internal/tracing"
 	"github.com/mikedewar/stablerisk/pkg/models"
 	"go.uber.org/zap"
 )
@@ -18,15 +23,23 @@ type TronClient struct {
 	apiKey       string
 	apiURL       string
 	usdtContract string
+	token        string // Symbol of the monitored token
 	httpClient   *http.Client
 	parser       *TransactionParser
 	retryHandler *RetryHandler
+	limiter      *RateLimiter
+	backpressure *Backpressure
+	checkpoints  CheckpointStore // nil keeps the checkpoint in memory only
+	archiver     EventArchiver   // nil when raw events are not archived
 	logger       *zap.Logger
 
 	// Channels
-	txChannel   chan *models.Transaction
-	errChannel  chan error
-	closeSignal chan struct{}
+	txChannel      chan *models.Transaction
+	retractChannel chan string // Hashes of transactions reverted by a reorg
+	headChannel    chan uint64 // Latest chain head block, measured every lagInterval
+	issuerChannel  chan *models.IssuerEvent
+	errChannel     chan error
+	closeSignal    chan struct{}
 
 	// State
 	status     models.ConnectionStatus
@@ -37,17 +50,112 @@ type TronClient struct {
 
 	// Configuration
 	pollingInterval time.Duration
+	maxPagesPerPoll int
 	lastTimestamp   int64 // Track last processed event timestamp to avoid duplicates
 	timestampLock   sync.RWMutex
+	gapThreshold    uint64
+	backfillGaps    bool
+	lastBlock       uint64 // Highest block seen, for gap detection
+	lastBlockTime   int64
+	pendingGaps     []BlockGap
+	dedup           *DedupCache   // Recently emitted events; nil when disabled
+	lagInterval     time.Duration // Zero when lag is not measured
+	onlyConfirmed   bool
+
+	// Poll position, guarded by timestampLock. caughtUp is set once a poll
+	// has fetched every event up to the present, so the block at
+	// lastTimestamp is complete and the next poll starts after it.
+	// Otherwise, as after a restart, the next poll starts at lastTimestamp
+	// so the rest of a partly fetched block is not missed.
+	caughtUp bool
+	// A poll cut short by the page cap is continued by the next poll from
+	// the fingerprint of its next page, with the same minimum timestamp
+	resumeFrom        int64
+	resumeFingerprint string
+	// Checkpoints waiting for the consumer's acknowledgement; nil without
+	// AwaitDelivery, when a page is checkpointed as soon as it is processed
+	deliveries *DeliveryTracker
+
+	// Metrics
+	stats     TronClientStats
+	statsLock sync.RWMutex
+}
+
+// TronClientStats holds polling counters
+type TronClientStats struct {
+	PagesFetched   uint64 // Total pages fetched
+	EventsFetched  uint64 // Total events fetched
+	TruncatedPolls uint64 // Polls that hit the page cap with events remaining
+	Retractions    uint64 // Transactions reverted by chain reorganisations
+	IssuerEvents   uint64 // Blacklist, issue and redeem events
+	RateLimited    uint64 // Requests rejected with 429 Too Many Requests
+	LastPollPages  int    // Pages fetched by the most recent poll
+	Gaps           uint64 // Block gaps detected between consecutive events
+	GapBlocks      uint64 // Blocks covered by detected gaps
+	Backfilled     uint64 // Events recovered by gap backfills
+	Duplicates     uint64 // Re-delivered events skipped by the dedup cache
+	Dropped        uint64 // Transactions lost because the channel stayed full
+	Spilled        uint64 // Transactions written to the spill queue
+	SpillDepth     int    // Transactions waiting in the spill queue
+
+	// Chain head and lag, updated every lag interval
+	HeadBlock     uint64        // Latest block number reported by TronGrid
+	HeadTimestamp int64         // Latest block timestamp (milliseconds)
+	Lag           time.Duration // Head timestamp minus the last processed event timestamp
+	BlocksBehind  uint64        // Head block minus the last processed event's block
 }
 
 // TronClientConfig holds TronGrid client configuration
 type TronClientConfig struct {
 	APIKey          string
 	WebSocketURL    string        // Kept for backwards compatibility, but will use as API URL
-	USDTContract    string
+	USDTContract    string        // Contract to monitor; any TRC20 token when TokenSymbol is set
+	TokenSymbol     string        // Token symbol tagged on transactions (default USDT)
+	TokenDecimals   int32         // Token decimals, used when TokenSymbol is set
 	PingInterval    time.Duration // Used as polling interval
 	RetryConfig     RetryConfig
+	CheckpointStore CheckpointStore // Optional; persists the polling position across restarts
+	MaxPagesPerPoll int             // Pagination safety cap per poll (default 10)
+	// AwaitDelivery holds checkpoints back until the consumer has confirmed,
+	// with Acknowledge, that the transactions before them were delivered
+	AwaitDelivery bool
+	// RequestsPerSecond caps outbound requests (default 10). Ignored when
+	// RateLimiter is set, which lets clients sharing an API key share a budget.
+	RequestsPerSecond float64
+	RateLimiter       *RateLimiter
+	Backpressure      BackpressureConfig // What to do when the transaction channel is full
+	// GapThreshold is the largest jump in block number between consecutive
+	// events that is not reported as a gap (default 20, about one minute)
+	GapThreshold uint64
+	BackfillGaps bool // Re-query the time range of each gap for missed events
+	// DedupCacheSize is the number of recent events remembered to skip
+	// re-deliveries (default 10000, negative disables de-duplication)
+	DedupCacheSize int
+	Archiver       EventArchiver // Optional; receives every fetched page of raw events
+	// LagInterval is how often the chain head is queried to measure
+	// ingestion lag (default 30 seconds, negative disables). Each head is
+	// also reported on Heads.
+	LagInterval time.Duration
+	// IncludeUnconfirmed fetches events before TronGrid has solidified
+	// them. They are tagged unconfirmed for the consumer to track their
+	// confirmation depth, and events later dropped by a reorg are retracted.
+	IncludeUnconfirmed bool
+}
+
+// EventArchiver keeps the raw events fetched from TronGrid, before parsing
+// or de-duplication, so ingestion can be replayed and audited. Archive must
+// not block polling.
+type EventArchiver interface {
+	Archive(source string, events []models.TronEvent)
+}
+
+// BlockGap is a range of blocks in which no events were received although
+// events arrived on both sides of it
+type BlockGap struct {
+	FromBlock     uint64
+	ToBlock       uint64
+	FromTimestamp int64 // Block timestamp (milliseconds) of the last event before the gap
+	ToTimestamp   int64 // Block timestamp (milliseconds) of the first event after the gap
 }
 
 // NewTronClient creates a new TronGrid REST API client
@@ -70,17 +178,69 @@ func NewTronClient(config TronClientConfig, logger *zap.Logger) *TronClient {
 		pollingInterval = 10 * time.Second
 	}
 
+	maxPagesPerPoll := config.MaxPagesPerPoll
+	if maxPagesPerPoll <= 0 {
+		maxPagesPerPoll = 10
+	}
+
+	limiter := config.RateLimiter
+	if limiter == nil {
+		rps := config.RequestsPerSecond
+		if rps <= 0 {
+			rps = 10
+		}
+		limiter = NewRateLimiter(rps, int(rps))
+	}
+
+	token, decimals := config.TokenSymbol, config.TokenDecimals
+	if token == "" {
+		token, decimals = USDTSymbol, USDTDecimals
+	}
+
+	gapThreshold := config.GapThreshold
+	if gapThreshold == 0 {
+		gapThreshold = 20
+	}
+
+	var dedup *DedupCache
+	if config.DedupCacheSize >= 0 {
+		dedupSize := config.DedupCacheSize
+		if dedupSize == 0 {
+			dedupSize = 10000
+		}
+		dedup = NewDedupCache(dedupSize)
+	}
+
+	lagInterval := config.LagInterval
+	if lagInterval == 0 {
+		lagInterval = 30 * time.Second
+	}
+	if lagInterval < 0 {
+		lagInterval = 0
+	}
+
+	txChannel := make(chan *models.Transaction, 100)
+
 	client := &TronClient{
 		apiKey:       config.APIKey,
 		apiURL:       apiURL,
 		usdtContract: config.USDTContract,
+		token:        token,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: tracing.Transport(nil),
 		},
-		parser:          NewTransactionParser(config.USDTContract),
+		parser:          NewTokenParser(config.USDTContract, token, decimals),
 		retryHandler:    NewRetryHandler(config.RetryConfig, logger),
+		limiter:         limiter,
+		backpressure:    NewBackpressure(config.Backpressure, txChannel, logger),
+		checkpoints:     config.CheckpointStore,
+		archiver:        config.Archiver,
 		logger:          logger,
-		txChannel:       make(chan *models.Transaction, 100),
+		txChannel:       txChannel,
+		retractChannel:  make(chan string, 100),
+		headChannel:     make(chan uint64, 1),
+		issuerChannel:   make(chan *models.IssuerEvent, 100),
 		errChannel:      make(chan error, 10),
 		closeSignal:     make(chan struct{}),
 		status:          models.StatusDisconnected,
@@ -88,7 +248,16 @@ func NewTronClient(config TronClientConfig, logger *zap.Logger) *TronClient {
 		ctx:             ctx,
 		cancel:          cancel,
 		pollingInterval: pollingInterval,
+		maxPagesPerPoll: maxPagesPerPoll,
 		lastTimestamp:   0,
+		gapThreshold:    gapThreshold,
+		backfillGaps:    config.BackfillGaps,
+		dedup:           dedup,
+		lagInterval:     lagInterval,
+		onlyConfirmed:   !config.IncludeUnconfirmed,
+	}
+	if config.AwaitDelivery {
+		client.deliveries = NewDeliveryTracker(client.backpressure, client.saveCheckpoint)
 	}
 
 	return client
@@ -109,7 +278,8 @@ func (c *TronClient) Connect() error {
 	c.setStatus(models.StatusConnecting)
 	c.logger.Info("Connecting to TronGrid REST API",
 		zap.String("url", c.apiURL),
-		zap.String("contract", c.usdtContract))
+		zap.String("contract", c.usdtContract),
+		zap.String("token", c.token))
 
 	// Test API connectivity with a simple request
 	endpoint := fmt.Sprintf("%s/v1/contracts/%s/events", c.apiURL, c.usdtContract)
@@ -127,20 +297,31 @@ func (c *TronClient) Connect() error {
 	// Add query parameters for initial test
 	q := req.URL.Query()
 	q.Add("limit", "1")
-	q.Add("only_confirmed", "true")
+	if c.onlyConfirmed {
+		q.Add("only_confirmed", "true")
+	}
 	req.URL.RawQuery = q.Encode()
 
+	if err := c.limiter.Wait(c.ctx); err != nil {
+		return err
+	}
+
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		c.setStatus(models.StatusError)
-		return fmt.Errorf("failed to connect to TronGrid API: %w", err)
+		return c.fail(ErrTronGridUnavailable, "failed to connect to TronGrid API: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		c.setStatus(models.StatusError)
+		return c.rateLimited(resp)
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		c.setStatus(models.StatusError)
-		return fmt.Errorf("TronGrid API returned status %d: %s", resp.StatusCode, string(body))
+		return c.statusError(resp.StatusCode, body)
 	}
 
 	c.connected = true
@@ -174,13 +355,113 @@ func (c *TronClient) pollEvents() {
 	}
 }
 
-// fetchEvents retrieves events from TronGrid API
-func (c *TronClient) fetchEvents() error {
+// fetchEvents retrieves events from TronGrid API, following the pagination
+// fingerprint until every event since the last poll has been fetched or the
+// page cap is reached
+func (c *TronClient) fetchEvents() (err error) {
+	c.timestampLock.RLock()
+	minTimestamp := c.lastTimestamp
+	if c.caughtUp && minTimestamp > 0 {
+		minTimestamp++
+	}
+	fingerprint := c.resumeFingerprint
+	if fingerprint != "" {
+		minTimestamp = c.resumeFrom
+	}
+	c.timestampLock.RUnlock()
+
+	pages := 0
+	events := 0
+
+	ctx, span := tracing.Start(c.ctx, "trongrid.poll",
+		tracing.WithAttributes(tracing.String("token", c.token)))
+	defer func() {
+		span.SetAttributes(tracing.Int("pages", pages), tracing.Int("events", events))
+		span.RecordError(err)
+		span.End()
+	}()
+
+	for {
+		eventResp, err := c.fetchPage(ctx, minTimestamp, 0, fingerprint)
+		if err != nil {
+			// The pages already processed may have ended partway through a
+			// block, so the next poll starts again at that block
+			c.setPollPosition(false, 0, "")
+			return err
+		}
+		pages++
+		events += len(eventResp.Data)
+
+		c.statsLock.Lock()
+		c.stats.PagesFetched++
+		c.stats.EventsFetched += uint64(len(eventResp.Data))
+		c.statsLock.Unlock()
+		metrics.EventsFetched.WithLabelValues(string(models.ChainTron), c.token).Add(float64(len(eventResp.Data)))
+		c.archive(eventResp.Data)
+
+		// Process events
+		c.logger.Debug("Fetched events from TronGrid",
+			zap.Int("count", len(eventResp.Data)),
+			zap.Int("page", pages))
+
+		c.processPage(eventResp.Data)
+
+		fingerprint = eventResp.Meta.Fingerprint
+		if fingerprint == "" {
+			c.setPollPosition(true, 0, "")
+			break
+		}
+
+		if pages >= c.maxPagesPerPoll {
+			// Remaining events, which may include the rest of the last
+			// block, are picked up by the next poll from the next page
+			c.setPollPosition(false, minTimestamp, fingerprint)
+			c.statsLock.Lock()
+			c.stats.TruncatedPolls++
+			c.statsLock.Unlock()
+
+			c.logger.Warn("Page cap reached, deferring remaining events to next poll",
+				zap.Int("pages", pages),
+				zap.Int("max_pages", c.maxPagesPerPoll))
+			break
+		}
+	}
+
+	c.statsLock.Lock()
+	c.stats.LastPollPages = pages
+	c.statsLock.Unlock()
+
+	if pages > 1 {
+		c.logger.Info("Fetched multiple pages in one poll",
+			zap.Int("pages", pages))
+	}
+
+	if c.backfillGaps {
+		c.backfillPendingGaps(ctx)
+	}
+
+	return nil
+}
+
+// setPollPosition records where the next poll starts
+func (c *TronClient) setPollPosition(caughtUp bool, resumeFrom int64, resumeFingerprint string) {
+	c.timestampLock.Lock()
+	c.caughtUp = caughtUp
+	c.resumeFrom = resumeFrom
+	c.resumeFingerprint = resumeFingerprint
+	c.timestampLock.Unlock()
+}
+
+// fetchPage retrieves a single page of events. fingerprint continues a
+// previous page; minTimestamp and maxTimestamp must be the same for every
+// page of a poll. Both are inclusive, and a zero maxTimestamp leaves the
+// range open.
+func (c *TronClient) fetchPage(ctx context.Context, minTimestamp, maxTimestamp int64, fingerprint string) (*TronEventResponse, error) {
 	endpoint := fmt.Sprintf("%s/v1/contracts/%s/events", c.apiURL, c.usdtContract)
 
-	req, err := http.NewRequestWithContext(c.ctx, "GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Add API key header
@@ -189,49 +470,103 @@ func (c *TronClient) fetchEvents() error {
 
 	// Add query parameters
 	q := req.URL.Query()
-	q.Add("limit", "200") // Fetch up to 200 events per poll
-	q.Add("only_confirmed", "true") // Only get confirmed transactions
+	q.Add("limit", "200") // Fetch up to 200 events per page
+	if c.onlyConfirmed {
+		q.Add("only_confirmed", "true") // Only get confirmed transactions
+	}
 	q.Add("order_by", "block_timestamp,asc") // Oldest first
 
 	// Add min timestamp to avoid fetching old events
-	c.timestampLock.RLock()
-	lastTimestamp := c.lastTimestamp
-	c.timestampLock.RUnlock()
+	if minTimestamp > 0 {
+		q.Add("min_block_timestamp", fmt.Sprintf("%d", minTimestamp))
+	}
+	if maxTimestamp > 0 {
+		q.Add("max_block_timestamp", fmt.Sprintf("%d", maxTimestamp))
+	}
 
-	if lastTimestamp > 0 {
-		// Add 1ms to avoid getting the same event again
-		q.Add("min_block_timestamp", fmt.Sprintf("%d", lastTimestamp+1))
+	if fingerprint != "" {
+		q.Add("fingerprint", fingerprint)
 	}
 
 	req.URL.RawQuery = q.Encode()
 
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to fetch events: %w", err)
+		return nil, c.fail(ErrTronGridUnavailable, "failed to fetch events: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, c.rateLimited(resp)
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("TronGrid API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, c.statusError(resp.StatusCode, body)
 	}
 
 	// Parse response
 	var eventResp TronEventResponse
 	if err := json.NewDecoder(resp.Body).Decode(&eventResp); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
+		return nil, c.fail(ErrTronGridBadResponse, "failed to decode response: %w", err)
 	}
 
 	if !eventResp.Success {
-		return fmt.Errorf("TronGrid API returned success=false")
+		return nil, c.fail(ErrTronGridBadResponse, "TronGrid API returned success=false")
+	}
+
+	return &eventResp, nil
+}
+
+// rateLimited handles a 429 response: it pauses all requests through the
+// limiter for the server-requested delay (or the initial retry delay, at least
+// one polling interval, if none was given) and primes the retry handler with
+// the same delay
+func (c *TronClient) rateLimited(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	rlErr := &RateLimitError{
+		RetryAfter: parseRetryAfter(resp.Header, time.Now()),
+		Body:       string(body),
+	}
+
+	delay := rlErr.RetryAfter
+	if delay <= 0 {
+		delay = c.retryHandler.config.InitialDelay
+		if delay < c.pollingInterval {
+			delay = c.pollingInterval
+		}
 	}
+	c.limiter.Pause(delay)
+	c.retryHandler.SetRetryAfter(delay)
 
-	// Process events
-	c.logger.Debug("Fetched events from TronGrid",
-		zap.Int("count", len(eventResp.Data)))
+	c.statsLock.Lock()
+	c.stats.RateLimited++
+	c.statsLock.Unlock()
+
+	c.logger.Warn("TronGrid rate limit hit, backing off",
+		zap.Duration("delay", delay),
+		zap.Bool("server_requested", rlErr.RetryAfter > 0))
+
+	return errs.Record(errComponent, rlErr)
+}
+
+// processPage processes a page of events and checkpoints the new position,
+// or with AwaitDelivery queues the checkpoint until the page's transactions
+// are acknowledged
+func (c *TronClient) processPage(events []models.TronEvent) {
+	c.timestampLock.RLock()
+	previous := c.lastTimestamp
+	c.timestampLock.RUnlock()
+
+	for _, event := range events {
+		c.trackBlock(&event)
 
-	for _, event := range eventResp.Data {
 		if err := c.processEvent(&event); err != nil {
+			c.recordEventError(err)
 			c.logger.Warn("Failed to process event",
 				zap.Error(err),
 				zap.String("tx_hash", event.TransactionID))
@@ -247,13 +582,207 @@ func (c *TronClient) fetchEvents() error {
 		}
 	}
 
+	// Persist the new position once the whole page has been processed
+	c.timestampLock.RLock()
+	current := c.lastTimestamp
+	c.timestampLock.RUnlock()
+
+	if current > previous {
+		if c.deliveries != nil {
+			c.deliveries.Checkpoint(current)
+		} else {
+			c.saveCheckpoint(current)
+		}
+	}
+}
+
+// trackBlock checks block continuity against the previous event and records
+// a gap if the block number jumped by more than the threshold
+func (c *TronClient) trackBlock(event *models.TronEvent) {
+	if event.Removed || event.BlockNumber == 0 {
+		return
+	}
+
+	c.timestampLock.Lock()
+	defer c.timestampLock.Unlock()
+
+	if c.lastBlock > 0 && event.BlockNumber > c.lastBlock+c.gapThreshold {
+		gap := BlockGap{
+			FromBlock:     c.lastBlock + 1,
+			ToBlock:       event.BlockNumber - 1,
+			FromTimestamp: c.lastBlockTime,
+			ToTimestamp:   event.BlockTimestamp,
+		}
+		blocks := gap.ToBlock - gap.FromBlock + 1
+
+		c.statsLock.Lock()
+		c.stats.Gaps++
+		c.stats.GapBlocks += blocks
+		c.statsLock.Unlock()
+
+		c.logger.Warn("Block gap detected",
+			zap.Uint64("from_block", gap.FromBlock),
+			zap.Uint64("to_block", gap.ToBlock),
+			zap.Uint64("blocks", blocks),
+			zap.Bool("backfill", c.backfillGaps))
+
+		if c.backfillGaps {
+			c.pendingGaps = append(c.pendingGaps, gap)
+		}
+	}
+
+	if event.BlockNumber > c.lastBlock {
+		c.lastBlock = event.BlockNumber
+		c.lastBlockTime = event.BlockTimestamp
+	}
+}
+
+// backfillPendingGaps re-queries the time range of each gap detected during
+// the last poll. Events found there were missed and are processed normally;
+// the polling position is not moved.
+func (c *TronClient) backfillPendingGaps(ctx context.Context) {
+	c.timestampLock.Lock()
+	gaps := c.pendingGaps
+	c.pendingGaps = nil
+	c.timestampLock.Unlock()
+
+	for _, gap := range gaps {
+		recovered, err := c.backfillGap(ctx, gap)
+		if err != nil {
+			c.logger.Error("Gap backfill failed",
+				zap.Error(err),
+				zap.Uint64("from_block", gap.FromBlock),
+				zap.Uint64("to_block", gap.ToBlock))
+			continue
+		}
+
+		c.statsLock.Lock()
+		c.stats.Backfilled += uint64(recovered)
+		c.statsLock.Unlock()
+
+		c.logger.Info("Gap backfill complete",
+			zap.Uint64("from_block", gap.FromBlock),
+			zap.Uint64("to_block", gap.ToBlock),
+			zap.Int("events", recovered))
+	}
+}
+
+// backfillGap fetches and processes the events strictly inside a gap
+func (c *TronClient) backfillGap(ctx context.Context, gap BlockGap) (int, error) {
+	if gap.ToTimestamp-gap.FromTimestamp <= 1 {
+		return 0, nil
+	}
+
+	recovered := 0
+	fingerprint := ""
+	for pages := 0; pages < c.maxPagesPerPoll; pages++ {
+		eventResp, err := c.fetchPage(ctx, gap.FromTimestamp+1, gap.ToTimestamp-1, fingerprint)
+		if err != nil {
+			return recovered, err
+		}
+		c.archive(eventResp.Data)
+
+		for _, event := range eventResp.Data {
+			if event.BlockNumber < gap.FromBlock || event.BlockNumber > gap.ToBlock {
+				continue
+			}
+			recovered++
+			if err := c.processEvent(&event); err != nil {
+				c.recordEventError(err)
+				c.logger.Warn("Failed to process backfilled event",
+					zap.Error(err),
+					zap.String("tx_hash", event.TransactionID))
+			}
+		}
+
+		fingerprint = eventResp.Meta.Fingerprint
+		if fingerprint == "" {
+			break
+		}
+	}
+
+	return recovered, nil
+}
+
+// archive hands a fetched page to the archiver, tagged with the chain and token
+func (c *TronClient) archive(events []models.TronEvent) {
+	if c.archiver == nil || len(events) == 0 {
+		return
+	}
+	c.archiver.Archive("tron-"+strings.ToLower(c.token), events)
+}
+
+// loadCheckpoint restores the polling position from the checkpoint store
+func (c *TronClient) loadCheckpoint() error {
+	if c.checkpoints == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, 10*time.Second)
+	defer cancel()
+
+	timestamp, err := c.checkpoints.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.timestampLock.Lock()
+	c.lastTimestamp = timestamp
+	c.timestampLock.Unlock()
+
+	if timestamp > 0 {
+		c.logger.Info("Resuming from checkpoint",
+			zap.Int64("block_timestamp", timestamp),
+			zap.Time("time", time.UnixMilli(timestamp)))
+	} else {
+		c.logger.Info("No checkpoint found, starting from latest events")
+	}
+
 	return nil
 }
 
+// saveCheckpoint persists the polling position. Failures are logged and the
+// next successful poll retries with a newer position.
+func (c *TronClient) saveCheckpoint(timestamp int64) {
+	if c.checkpoints == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.checkpoints.Save(ctx, timestamp); err != nil {
+		c.logger.Error("Failed to save checkpoint",
+			zap.Error(err),
+			zap.Int64("block_timestamp", timestamp))
+	}
+}
+
+// LastTimestamp returns the latest processed block timestamp (milliseconds)
+func (c *TronClient) LastTimestamp() int64 {
+	c.timestampLock.RLock()
+	defer c.timestampLock.RUnlock()
+	return c.lastTimestamp
+}
+
 // processEvent parses and processes a TronGrid event
 func (c *TronClient) processEvent(event *models.TronEvent) error {
+	if c.isDuplicate(event) {
+		c.logger.Debug("Skipping duplicate event",
+			zap.String("tx_hash", event.TransactionID),
+			zap.Int("event_index", event.EventIndex))
+		return nil
+	}
+
+	if IsIssuerEvent(event.EventName) {
+		return c.processIssuerEvent(event)
+	}
+
 	// Parse into transaction
 	tx, err := c.parser.ParseEvent(event)
+	if errors.Is(err, ErrRemovedEvent) {
+		return c.retractEvent(event)
+	}
 	if err != nil {
 		// Not all events are valid transactions (e.g., wrong contract, non-Transfer events)
 		return err
@@ -261,31 +790,99 @@ func (c *TronClient) processEvent(event *models.TronEvent) error {
 
 	// Validate transaction
 	if err := ValidateTransaction(tx); err != nil {
-		return fmt.Errorf("invalid transaction: %w", err)
+		return errs.Wrapf(ErrInvalidEvent, "invalid transaction: %w", err)
+	}
+
+	// Send to transaction channel, applying the overflow strategy if it is full
+	if err := c.backpressure.Send(c.ctx, tx); err != nil {
+		return err
+	}
+
+	c.logger.Debug("Transaction processed",
+		zap.String("tx_hash", tx.TxHash),
+		zap.String("from", tx.From),
+		zap.String("to", tx.To),
+		zap.String("amount", tx.Amount.String()))
+
+	return nil
+}
+
+// isDuplicate reports whether the event was already emitted and remembers
+// it otherwise
+func (c *TronClient) isDuplicate(event *models.TronEvent) bool {
+	if c.dedup == nil || event.TransactionID == "" {
+		return false
+	}
+
+	if c.dedup.SeenEvent(event) {
+		c.statsLock.Lock()
+		c.stats.Duplicates++
+		c.statsLock.Unlock()
+		return true
+	}
+	return false
+}
+
+// processIssuerEvent publishes a blacklist, issue or redeem event. Like
+// retractions, issuer events are never dropped.
+func (c *TronClient) processIssuerEvent(event *models.TronEvent) error {
+	issuerEvent, err := c.parser.ParseIssuerEvent(event)
+	if err != nil {
+		return err
 	}
 
-	// Send to transaction channel
+	c.logger.Warn("Issuer event",
+		zap.String("type", string(issuerEvent.Type)),
+		zap.String("tx_hash", issuerEvent.TxHash),
+		zap.String("address", issuerEvent.Address),
+		zap.String("amount", issuerEvent.Amount.String()))
+
 	select {
-	case c.txChannel <- tx:
-		c.logger.Debug("Transaction processed",
-			zap.String("tx_hash", tx.TxHash),
-			zap.String("from", tx.From),
-			zap.String("to", tx.To),
-			zap.String("amount", tx.Amount.String()))
+	case c.issuerChannel <- issuerEvent:
+		c.statsLock.Lock()
+		c.stats.IssuerEvents++
+		c.statsLock.Unlock()
+		return nil
 	case <-c.ctx.Done():
 		return c.ctx.Err()
-	default:
-		c.logger.Warn("Transaction channel full, dropping transaction",
-			zap.String("tx_hash", tx.TxHash))
 	}
+}
 
-	return nil
+// retractEvent publishes the hash of a transaction reverted by a reorg so
+// downstream consumers can remove it. Retractions are never dropped: losing
+// one would leave a transaction in the graph that no longer exists on chain.
+// TronGrid only marks events removed when unconfirmed events are fetched, so
+// this runs only with IncludeUnconfirmed set.
+func (c *TronClient) retractEvent(event *models.TronEvent) error {
+	c.logger.Warn("Event removed by chain reorganisation",
+		zap.String("tx_hash", event.TransactionID),
+		zap.Uint64("block", event.BlockNumber))
+
+	select {
+	case c.retractChannel <- event.TransactionID:
+		c.statsLock.Lock()
+		c.stats.Retractions++
+		c.statsLock.Unlock()
+		return nil
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
 }
 
 // Start starts the client with automatic reconnection
 func (c *TronClient) Start() error {
 	c.logger.Info("Starting TronGrid client")
 
+	// Restore polling position before the first poll
+	if err := c.loadCheckpoint(); err != nil {
+		return fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+
+	// Resume any transactions spilled to disk by a previous run
+	if err := c.backpressure.Start(c.ctx); err != nil {
+		return fmt.Errorf("failed to start overflow handling: %w", err)
+	}
+
 	// Initial connection test
 	if err := c.Connect(); err != nil {
 		return fmt.Errorf("initial connection failed: %w", err)
@@ -297,6 +894,11 @@ func (c *TronClient) Start() error {
 	// Start reconnection handler
 	go c.reconnectionLoop()
 
+	// Measure how far behind the chain head ingestion is
+	if c.lagInterval > 0 {
+		go c.trackLag()
+	}
+
 	return nil
 }
 
@@ -355,6 +957,51 @@ func (c *TronClient) Transactions() <-chan *models.Transaction {
 	return c.txChannel
 }
 
+// Acknowledge confirms that the next n transactions received from
+// Transactions have been delivered. Only needed with AwaitDelivery.
+func (c *TronClient) Acknowledge(n int) {
+	if c.deliveries != nil {
+		c.deliveries.Acknowledge(n)
+	}
+}
+
+// Retractions returns the channel of transaction hashes reverted by chain
+// reorganisations. TronGrid only reports reverted events when unconfirmed
+// events are fetched, so without IncludeUnconfirmed nothing is retracted.
+func (c *TronClient) Retractions() <-chan string {
+	return c.retractChannel
+}
+
+// Heads returns the channel of chain head block numbers, one each time lag
+// is measured. Only the latest unread head is kept.
+func (c *TronClient) Heads() <-chan uint64 {
+	return c.headChannel
+}
+
+// IssuerEvents returns the channel of blacklist, issue and redeem events.
+// Consumers must drain it: a full channel stalls polling.
+func (c *TronClient) IssuerEvents() <-chan *models.IssuerEvent {
+	return c.issuerChannel
+}
+
+// Token returns the symbol of the monitored token
+func (c *TronClient) Token() string {
+	return c.token
+}
+
+// Stats returns a snapshot of the polling counters
+func (c *TronClient) Stats() TronClientStats {
+	c.statsLock.RLock()
+	stats := c.stats
+	c.statsLock.RUnlock()
+
+	overflow := c.backpressure.Stats()
+	stats.Dropped = overflow.Dropped
+	stats.Spilled = overflow.Spilled
+	stats.SpillDepth = overflow.SpillDepth
+	return stats
+}
+
 // Status returns the current connection status
 func (c *TronClient) Status() models.ConnectionStatus {
 	c.statusLock.RLock()
@@ -0,0 +1,138 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// tronNowBlockResponse is the part of /wallet/getnowblock used for lag tracking
+type tronNowBlockResponse struct {
+	BlockHeader struct {
+		RawData struct {
+			Number    uint64 `json:"number"`
+			Timestamp int64  `json:"timestamp"`
+		} `json:"raw_data"`
+	} `json:"block_header"`
+}
+
+// trackLag periodically compares the latest processed event with the chain
+// head. Failures are logged and retried on the next tick; they never affect
+// polling.
+func (c *TronClient) trackLag() {
+	ticker := time.NewTicker(c.lagInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.updateLag(); err != nil && c.ctx.Err() == nil {
+				c.logger.Warn("Failed to measure ingestion lag", zap.Error(err))
+			}
+		}
+	}
+}
+
+// updateLag fetches the chain head, reports it on Heads and records how far
+// the last processed event is behind it. Lag is measured from the event's block, so it also
+// grows while a token has no transfers; compare it across tokens, or with
+// the blocks-behind gauge, before alerting.
+func (c *TronClient) updateLag() error {
+	headBlock, headTimestamp, err := c.fetchHead()
+	if err != nil {
+		return err
+	}
+
+	// Replace a head the consumer has not read yet
+	select {
+	case <-c.headChannel:
+	default:
+	}
+	select {
+	case c.headChannel <- headBlock:
+	default:
+	}
+
+	c.timestampLock.RLock()
+	lastTimestamp := c.lastTimestamp
+	lastBlock := c.lastBlock
+	c.timestampLock.RUnlock()
+
+	// Nothing processed yet: the client is starting from the head
+	if lastTimestamp == 0 {
+		lastTimestamp = headTimestamp
+	}
+	lag := time.Duration(headTimestamp-lastTimestamp) * time.Millisecond
+	if lag < 0 {
+		lag = 0
+	}
+	var blocksBehind uint64
+	if lastBlock > 0 && headBlock > lastBlock {
+		blocksBehind = headBlock - lastBlock
+	}
+
+	c.statsLock.Lock()
+	c.stats.HeadBlock = headBlock
+	c.stats.HeadTimestamp = headTimestamp
+	c.stats.Lag = lag
+	c.stats.BlocksBehind = blocksBehind
+	c.statsLock.Unlock()
+
+	metrics.IngestionLag.WithLabelValues(string(models.ChainTron), c.token).Set(lag.Seconds())
+	metrics.IngestionBlocksBehind.WithLabelValues(string(models.ChainTron), c.token).Set(float64(blocksBehind))
+
+	c.logger.Debug("Measured ingestion lag",
+		zap.Uint64("head_block", headBlock),
+		zap.Duration("lag", lag),
+		zap.Uint64("blocks_behind", blocksBehind))
+
+	return nil
+}
+
+// fetchHead returns the number and timestamp (milliseconds) of the latest block
+func (c *TronClient) fetchHead() (uint64, int64, error) {
+	endpoint := fmt.Sprintf("%s/wallet/getnowblock", c.apiURL)
+
+	req, err := http.NewRequestWithContext(c.ctx, "POST", endpoint, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("TRON-PRO-API-KEY", c.apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	if err := c.limiter.Wait(c.ctx); err != nil {
+		return 0, 0, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, 0, c.fail(ErrTronGridUnavailable, "failed to fetch chain head: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return 0, 0, c.rateLimited(resp)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, 0, c.statusError(resp.StatusCode, body)
+	}
+
+	var head tronNowBlockResponse
+	if err := json.NewDecoder(resp.Body).Decode(&head); err != nil {
+		return 0, 0, c.fail(ErrTronGridBadResponse, "failed to decode chain head: %w", err)
+	}
+	if head.BlockHeader.RawData.Number == 0 {
+		return 0, 0, c.fail(ErrTronGridBadResponse, "TronGrid API returned no block header")
+	}
+
+	return head.BlockHeader.RawData.Number, head.BlockHeader.RawData.Timestamp, nil
+}
@@ -0,0 +1,26 @@
+package bus
+
+// Backplane relays the API's WebSocket broadcasts between its instances,
+// so clients get broadcasts from whichever instance made them. Broadcasts
+// are only worth sending while they are fresh, so they go over core NATS
+// rather than the stream, and an instance that is down misses them.
+type Backplane struct {
+	conn *Conn
+}
+
+// NewBackplane creates a backplane over a bus connection
+func NewBackplane(conn *Conn) *Backplane {
+	return &Backplane{conn: conn}
+}
+
+// Publish sends a broadcast to every instance, this one included
+func (b *Backplane) Publish(data []byte) error {
+	return b.conn.Send(SubjectBroadcasts, data)
+}
+
+// Subscribe delivers every instance's broadcasts to handler
+func (b *Backplane) Subscribe(handler func(data []byte)) error {
+	return b.conn.Subscribe(SubjectBroadcasts, "", func(subject string, data []byte) {
+		handler(data)
+	})
+}
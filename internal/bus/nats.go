@@ -0,0 +1,574 @@
+// Package bus connects the monitor, detector and API through NATS JetStream
+// so the services can scale and restart independently. It speaks the NATS
+// client protocol directly and uses JetStream through its request/reply API.
+package bus
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Subjects the services publish to. The stream captures everything under
+// SubjectPrefix.
+const (
+	SubjectPrefix        = "stablerisk."
+	SubjectTransactions  = SubjectPrefix + "transactions"
+	SubjectRetractions   = SubjectPrefix + "retractions"
+	SubjectConfirmations = SubjectPrefix + "confirmations"
+	SubjectOutliers      = SubjectPrefix + "outliers"
+)
+
+// SubjectBroadcasts carries WebSocket broadcasts between API instances. It
+// is outside SubjectPrefix, so the stream does not keep them.
+const SubjectBroadcasts = "stablerisk-api.broadcasts"
+
+// ErrClosed is returned when using a closed connection
+var ErrClosed = errors.New("bus connection closed")
+
+// ErrDisconnected is returned when publishing while the connection is down
+var ErrDisconnected = errors.New("bus disconnected")
+
+// Config holds NATS connection configuration
+type Config struct {
+	URL            string        // nats://host:port, credentials may be embedded
+	Token          string        // Auth token, if the server requires one
+	Name           string        // Client name shown by the server
+	Stream         string        // JetStream stream holding the stablerisk subjects
+	MaxAge         time.Duration // Stream retention; 0 keeps messages until limits are hit
+	PublishTimeout time.Duration // Wait for a JetStream acknowledgement (default 5 seconds)
+	ReconnectWait  time.Duration // Delay between reconnect attempts (default 2 seconds)
+}
+
+// Handler processes a message delivered to a subscription
+type Handler func(subject string, data []byte)
+
+// subscription is an active SUB, replayed after a reconnect
+type subscription struct {
+	sid     int
+	subject string
+	queue   string
+	handler Handler
+}
+
+// Conn is a NATS connection with JetStream publishing
+type Conn struct {
+	config Config
+	logger *zap.Logger
+
+	mu        sync.Mutex
+	conn      net.Conn
+	writer    *bufio.Writer
+	connected bool
+	closed    bool
+	lost      chan struct{} // Closed when the current connection drops
+	pongs     []chan struct{}
+	subs      map[int]*subscription
+	nextSID   int
+
+	inbox     string // Prefix for request replies
+	respMu    sync.Mutex
+	responses map[string]chan []byte
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Connect dials the server and starts reading. The connection reconnects on
+// its own until Close is called.
+func Connect(ctx context.Context, config Config, logger *zap.Logger) (*Conn, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.PublishTimeout <= 0 {
+		config.PublishTimeout = 5 * time.Second
+	}
+	if config.ReconnectWait <= 0 {
+		config.ReconnectWait = 2 * time.Second
+	}
+	if config.Name == "" {
+		config.Name = "stablerisk"
+	}
+
+	c := &Conn{
+		config:    config,
+		logger:    logger,
+		subs:      make(map[int]*subscription),
+		inbox:     "_INBOX." + newToken(),
+		responses: make(map[string]chan []byte),
+		done:      make(chan struct{}),
+	}
+
+	// Replies to every request arrive on one wildcard inbox subscription
+	c.subs[0] = &subscription{sid: 0, subject: c.inbox + ".*", handler: c.handleResponse}
+	c.nextSID = 1
+
+	if err := c.connect(ctx); err != nil {
+		return nil, err
+	}
+
+	c.wg.Add(1)
+	go c.run()
+
+	return c, nil
+}
+
+// connect dials the server, performs the handshake and replays subscriptions
+func (c *Conn) connect(ctx context.Context) error {
+	u, err := url.Parse(c.config.URL)
+	if err != nil {
+		return fmt.Errorf("invalid nats url: %w", err)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return fmt.Errorf("failed to connect to nats: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("nats handshake failed: %q: %v", strings.TrimSpace(line), err)
+	}
+
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     c.config.Name,
+		"lang":     "go",
+		"version":  "stablerisk",
+		"protocol": 1,
+	}
+	if u.User != nil {
+		options["user"] = u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			options["pass"] = password
+		}
+	}
+	if c.config.Token != "" {
+		options["auth_token"] = c.config.Token
+	}
+	connectJSON, _ := json.Marshal(options)
+
+	writer := bufio.NewWriter(conn)
+	fmt.Fprintf(writer, "CONNECT %s\r\nPING\r\n", connectJSON)
+	if err := writer.Flush(); err != nil {
+		conn.Close()
+		return fmt.Errorf("nats handshake failed: %w", err)
+	}
+
+	// The server answers PING with PONG once CONNECT is accepted
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("nats handshake failed: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "PONG" {
+			break
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			conn.Close()
+			return fmt.Errorf("nats rejected connection: %s", line)
+		}
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, sub := range c.subs {
+		writeSub(writer, sub)
+	}
+	if err := writer.Flush(); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to restore subscriptions: %w", err)
+	}
+
+	lost := make(chan struct{})
+	c.conn = conn
+	c.writer = writer
+	c.connected = true
+	c.lost = lost
+
+	c.wg.Add(1)
+	go c.readLoop(conn, reader, lost)
+
+	return nil
+}
+
+// run reconnects whenever the connection drops
+func (c *Conn) run() {
+	defer c.wg.Done()
+
+	for {
+		c.mu.Lock()
+		lost := c.lost
+		c.mu.Unlock()
+
+		select {
+		case <-c.done:
+			return
+		case <-lost:
+		}
+
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-time.After(c.config.ReconnectWait):
+			}
+
+			if err := c.connect(context.Background()); err != nil {
+				c.logger.Warn("NATS reconnect failed", zap.Error(err))
+				continue
+			}
+			c.logger.Info("NATS reconnected", zap.String("url", c.config.URL))
+			break
+		}
+	}
+}
+
+// readLoop dispatches server messages until the connection fails
+func (c *Conn) readLoop(conn net.Conn, reader *bufio.Reader, lost chan struct{}) {
+	defer c.wg.Done()
+	defer close(lost)
+
+	err := c.read(reader)
+
+	c.mu.Lock()
+	if c.conn == conn {
+		c.connected = false
+	}
+	closed := c.closed
+	pongs := c.pongs
+	c.pongs = nil
+	c.mu.Unlock()
+	conn.Close()
+
+	for _, pong := range pongs {
+		close(pong)
+	}
+
+	if !closed {
+		c.logger.Warn("NATS connection lost", zap.Error(err))
+	}
+}
+
+// read parses protocol lines from the server
+func (c *Conn) read(reader *bufio.Reader) error {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case strings.HasPrefix(line, "MSG "):
+			if err := c.readMsg(reader, strings.Fields(line)[1:]); err != nil {
+				return err
+			}
+		case line == "PING":
+			c.mu.Lock()
+			c.writer.WriteString("PONG\r\n")
+			c.writer.Flush()
+			c.mu.Unlock()
+		case line == "PONG":
+			c.mu.Lock()
+			if len(c.pongs) > 0 {
+				close(c.pongs[0])
+				c.pongs = c.pongs[1:]
+			}
+			c.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			c.logger.Error("NATS server error", zap.String("error", line))
+		}
+	}
+}
+
+// readMsg reads a MSG payload and dispatches it to the subscription handler
+func (c *Conn) readMsg(reader *bufio.Reader, args []string) error {
+	// MSG <subject> <sid> [reply-to] <#bytes>
+	if len(args) < 3 {
+		return fmt.Errorf("malformed MSG: %v", args)
+	}
+	size, err := strconv.Atoi(args[len(args)-1])
+	if err != nil {
+		return fmt.Errorf("malformed MSG size: %w", err)
+	}
+	sid, _ := strconv.Atoi(args[1])
+
+	payload := make([]byte, size+2) // Payload is followed by CRLF
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	sub := c.subs[sid]
+	c.mu.Unlock()
+
+	if sub != nil {
+		sub.handler(args[0], payload[:size])
+	}
+	return nil
+}
+
+// handleResponse routes a request reply to its waiting caller
+func (c *Conn) handleResponse(subject string, data []byte) {
+	c.respMu.Lock()
+	ch, ok := c.responses[subject]
+	delete(c.responses, subject)
+	c.respMu.Unlock()
+
+	if ok {
+		ch <- data
+	}
+}
+
+// Subscribe delivers messages on subject to handler. With a queue group,
+// each message goes to one member of the group. Handlers run on the read
+// goroutine, so a slow handler delays every subscription.
+func (c *Conn) Subscribe(subject, queue string, handler Handler) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	sub := &subscription{sid: c.nextSID, subject: subject, queue: queue, handler: handler}
+	c.nextSID++
+	c.subs[sub.sid] = sub
+
+	// Replayed on reconnect if the connection is down now
+	if c.connected {
+		writeSub(c.writer, sub)
+		return c.writer.Flush()
+	}
+	return nil
+}
+
+// writeSub writes a SUB command
+func writeSub(w *bufio.Writer, sub *subscription) {
+	if sub.queue != "" {
+		fmt.Fprintf(w, "SUB %s %s %d\r\n", sub.subject, sub.queue, sub.sid)
+		return
+	}
+	fmt.Fprintf(w, "SUB %s %d\r\n", sub.subject, sub.sid)
+}
+
+// pub writes a PUB command
+func (c *Conn) pub(subject, reply string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+	if !c.connected {
+		return ErrDisconnected
+	}
+
+	if reply != "" {
+		fmt.Fprintf(c.writer, "PUB %s %s %d\r\n", subject, reply, len(data))
+	} else {
+		fmt.Fprintf(c.writer, "PUB %s %d\r\n", subject, len(data))
+	}
+	c.writer.Write(data)
+	c.writer.WriteString("\r\n")
+	return c.writer.Flush()
+}
+
+// Send publishes data to the current subscribers of subject without
+// JetStream, so it is neither stored nor acknowledged
+func (c *Conn) Send(subject string, data []byte) error {
+	return c.pub(subject, "", data)
+}
+
+// Request publishes data and waits for a single reply
+func (c *Conn) Request(ctx context.Context, subject string, data []byte) ([]byte, error) {
+	reply := c.inbox + "." + newToken()
+	ch := make(chan []byte, 1)
+
+	c.respMu.Lock()
+	c.responses[reply] = ch
+	c.respMu.Unlock()
+	defer func() {
+		c.respMu.Lock()
+		delete(c.responses, reply)
+		c.respMu.Unlock()
+	}()
+
+	if err := c.pub(subject, reply, data); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// jsError is the error body of a JetStream API or publish response
+type jsError struct {
+	Code        int    `json:"code"`
+	ErrCode     int    `json:"err_code"`
+	Description string `json:"description"`
+}
+
+// Publish publishes v as JSON to a JetStream subject and waits for the
+// stream to acknowledge it
+func (c *Conn) Publish(ctx context.Context, subject string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.PublishTimeout)
+	defer cancel()
+
+	resp, err := c.Request(ctx, subject, data)
+	if err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", subject, err)
+	}
+
+	var ack struct {
+		Stream string   `json:"stream"`
+		Seq    uint64   `json:"seq"`
+		Error  *jsError `json:"error"`
+	}
+	if err := json.Unmarshal(resp, &ack); err != nil {
+		return fmt.Errorf("invalid publish acknowledgement: %w", err)
+	}
+	if ack.Error != nil {
+		return fmt.Errorf("jetstream rejected message on %s: %s", subject, ack.Error.Description)
+	}
+
+	return nil
+}
+
+// PublishOutlier publishes a detected outlier for the API to broadcast
+func (c *Conn) PublishOutlier(ctx context.Context, outlier models.Outlier) error {
+	return c.Publish(ctx, SubjectOutliers, outlier)
+}
+
+// EnsureStream creates the configured stream over every stablerisk subject,
+// or leaves it alone if it already exists
+func (c *Conn) EnsureStream(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.config.PublishTimeout)
+	defer cancel()
+
+	request, _ := json.Marshal(map[string]interface{}{
+		"name":     c.config.Stream,
+		"subjects": []string{SubjectPrefix + ">"},
+		"max_age":  c.config.MaxAge.Nanoseconds(),
+		"storage":  "file",
+	})
+
+	resp, err := c.Request(ctx, "$JS.API.STREAM.CREATE."+c.config.Stream, request)
+	if err != nil {
+		return fmt.Errorf("failed to create stream %s: %w", c.config.Stream, err)
+	}
+
+	var result struct {
+		Error *jsError `json:"error"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return fmt.Errorf("invalid stream response: %w", err)
+	}
+
+	// 10058: stream name already in use
+	if result.Error != nil && result.Error.ErrCode != 10058 {
+		return fmt.Errorf("failed to create stream %s: %s", c.config.Stream, result.Error.Description)
+	}
+
+	return nil
+}
+
+// Flush waits until the server has processed everything written so far
+func (c *Conn) Flush(ctx context.Context) error {
+	pong := make(chan struct{})
+
+	c.mu.Lock()
+	if !c.connected {
+		c.mu.Unlock()
+		return ErrDisconnected
+	}
+	c.pongs = append(c.pongs, pong)
+	c.writer.WriteString("PING\r\n")
+	err := c.writer.Flush()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-pong:
+		// Pending PONGs are also released when the connection drops
+		if !c.IsConnected() {
+			return ErrDisconnected
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// IsConnected reports whether the connection is currently up
+func (c *Conn) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// Close closes the connection and stops reconnecting
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.connected = false
+	conn := c.conn
+	c.mu.Unlock()
+
+	close(c.done)
+	if conn != nil {
+		conn.Close()
+	}
+	c.wg.Wait()
+	return nil
+}
+
+// newToken returns a random identifier for inbox subjects
+func newToken() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -2,9 +2,11 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
+	"github.com/mikedewar/stablerisk/pkg/models"
 	"github.com/spf13/viper"
 )
 
@@ -13,9 +15,22 @@ type Config struct {
 	Server     ServerConfig     `mapstructure:"server"`
 	Database   DatabaseConfig   `mapstructure:"database"`
 	TronGrid   TronGridConfig   `mapstructure:"trongrid"`
+	Ethereum   EthereumConfig   `mapstructure:"ethereum"`
+	Ingestion  IngestionConfig  `mapstructure:"ingestion"`
 	Raphtory   RaphtoryConfig   `mapstructure:"raphtory"`
+	Sinks      SinksConfig      `mapstructure:"sinks"`
+	Bus        BusConfig        `mapstructure:"bus"`
+	Archive    ArchiveConfig    `mapstructure:"archive"`
 	Security   SecurityConfig   `mapstructure:"security"`
+	RateLimit  RateLimitConfig  `mapstructure:"rate_limit"`
 	Detection  DetectionConfig  `mapstructure:"detection"`
+	Sanctions  SanctionsConfig  `mapstructure:"sanctions"`
+	Enrichment EnrichmentConfig `mapstructure:"enrichment"`
+	Notify     NotifyConfig     `mapstructure:"notify"`
+	Webhooks   WebhooksConfig   `mapstructure:"webhooks"`
+	Reports    ReportsConfig    `mapstructure:"reports"`
+	SIEM       SIEMConfig       `mapstructure:"siem"`
+	Features   FeaturesConfig   `mapstructure:"features"`
 	Logging    LoggingConfig    `mapstructure:"logging"`
 	Monitoring MonitoringConfig `mapstructure:"monitoring"`
 }
@@ -26,6 +41,37 @@ type ServerConfig struct {
 	ReadTimeout    time.Duration `mapstructure:"read_timeout"`
 	WriteTimeout   time.Duration `mapstructure:"write_timeout"`
 	MaxHeaderBytes int           `mapstructure:"max_header_bytes"`
+	// CORSAllowedOrigins may call the API from browser scripts; "*" allows
+	// any origin, without credentials
+	CORSAllowedOrigins    []string      `mapstructure:"cors_allowed_origins"`
+	CORSAllowedMethods    []string      `mapstructure:"cors_allowed_methods"`
+	CORSMaxAge            time.Duration `mapstructure:"cors_max_age"`
+	HSTSMaxAge            time.Duration `mapstructure:"hsts_max_age"` // 0 disables Strict-Transport-Security
+	ContentSecurityPolicy string        `mapstructure:"content_security_policy"`
+	// SwaggerUIEnabled serves Swagger UI at /api/v1/docs, loading its assets
+	// from SwaggerUIAssetsURL
+	SwaggerUIEnabled   bool   `mapstructure:"swagger_ui_enabled"`
+	SwaggerUIAssetsURL string `mapstructure:"swagger_ui_assets_url"`
+	// GraphQLEnabled serves GraphQL at /api/v1/graphql. Queries may nest
+	// GraphQLMaxDepth deep and resolve GraphQLMaxResolves fields that fetch
+	// data; 0 removes a limit.
+	GraphQLEnabled     bool `mapstructure:"graphql_enabled"`
+	GraphQLMaxDepth    int  `mapstructure:"graphql_max_depth"`
+	GraphQLMaxResolves int  `mapstructure:"graphql_max_resolves"`
+	// Each API instance accepts WebSocketMaxConnections WebSocket
+	// connections, and WebSocketMaxConnectionsPerUser from any one user;
+	// 0 removes a limit
+	WebSocketMaxConnections        int `mapstructure:"websocket_max_connections"`
+	WebSocketMaxConnectionsPerUser int `mapstructure:"websocket_max_connections_per_user"`
+	// Broadcasts are delivered to WebSocket clients by
+	// WebSocketBroadcastWorkers goroutines; 0 for one per CPU
+	WebSocketBroadcastWorkers int `mapstructure:"websocket_broadcast_workers"`
+
+	// Client IPs, used for rate limits, login lockout and the audit log,
+	// are read from X-Forwarded-For only on requests from TrustedProxies
+	// (addresses or CIDR ranges); by default none are trusted and the
+	// connecting address is the client
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 // DatabaseConfig holds PostgreSQL configuration
@@ -39,6 +85,8 @@ type DatabaseConfig struct {
 	MaxOpenConns    int           `mapstructure:"max_open_conns"`
 	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
 	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	// AutoMigrate applies the API's embedded migrations on startup
+	AutoMigrate bool `mapstructure:"auto_migrate"`
 }
 
 // TronGridConfig holds TronGrid API configuration
@@ -49,6 +97,78 @@ type TronGridConfig struct {
 	ReconnectDelay  time.Duration `mapstructure:"reconnect_delay"`
 	MaxReconnects   int           `mapstructure:"max_reconnects"`
 	PingInterval    time.Duration `mapstructure:"ping_interval"` // Used as polling interval for REST API
+	CheckpointStore string        `mapstructure:"checkpoint_store"` // file, postgres or none
+	CheckpointPath  string        `mapstructure:"checkpoint_path"`  // Used by the file store
+	MaxPagesPerPoll int           `mapstructure:"max_pages_per_poll"`
+	RequestsPerSecond float64     `mapstructure:"requests_per_second"` // Shared by all contract pollers
+	Contracts       []ContractConfig `mapstructure:"contracts"` // Overrides usdt_contract when set
+	GapThreshold    uint64        `mapstructure:"gap_threshold"` // Block jump between events reported as a gap
+	BackfillGaps    bool          `mapstructure:"backfill_gaps"` // Re-query gaps for missed events
+	DedupCacheSize  int           `mapstructure:"dedup_cache_size"` // Recent events remembered to skip re-deliveries
+	ConfirmationDepth uint64      `mapstructure:"confirmation_depth"` // Blocks on top before a transfer is confirmed; 0 ingests only solidified events
+	LagInterval     time.Duration `mapstructure:"lag_interval"` // How often the chain head is queried for the lag gauge and confirmations; 0 disables
+}
+
+// ContractConfig describes a TRC20 token contract to monitor
+type ContractConfig struct {
+	Address  string `mapstructure:"address"`
+	Symbol   string `mapstructure:"symbol"`
+	Decimals int32  `mapstructure:"decimals"`
+	// GapThreshold overrides trongrid.gap_threshold for tokens that trade too
+	// rarely to have an event every few blocks
+	GapThreshold uint64 `mapstructure:"gap_threshold"`
+}
+
+// MonitoredContracts returns the contracts to poll. Without an explicit
+// contract list only the USDT contract is monitored.
+func (c TronGridConfig) MonitoredContracts() []ContractConfig {
+	if len(c.Contracts) > 0 {
+		return c.Contracts
+	}
+
+	return []ContractConfig{{
+		Address:  c.USDTContract,
+		Symbol:   "USDT",
+		Decimals: 6,
+	}}
+}
+
+// EthereumConfig holds Ethereum ERC-20 ingestion configuration
+type EthereumConfig struct {
+	Enabled         bool             `mapstructure:"enabled"`
+	RPCURL          string           `mapstructure:"rpc_url"`
+	Contracts       []ContractConfig `mapstructure:"contracts"` // Defaults to USDT and USDC
+	PollInterval    time.Duration    `mapstructure:"poll_interval"`
+	Confirmations   uint64           `mapstructure:"confirmations"`
+	MaxBlockRange   uint64           `mapstructure:"max_block_range"`
+	CheckpointStore string           `mapstructure:"checkpoint_store"` // file, postgres or none
+	CheckpointPath  string           `mapstructure:"checkpoint_path"`  // Used by the file store
+}
+
+// MonitoredContracts returns the ERC-20 contracts to poll
+func (c EthereumConfig) MonitoredContracts() []ContractConfig {
+	if len(c.Contracts) > 0 {
+		return c.Contracts
+	}
+
+	return []ContractConfig{
+		{Address: "0xdAC17F958D2ee523a2206206994597C13D831ec7", Symbol: "USDT", Decimals: 6},
+		{Address: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", Symbol: "USDC", Decimals: 6},
+	}
+}
+
+// IngestionConfig holds configuration shared by all chain clients
+type IngestionConfig struct {
+	// OverflowStrategy applies when a client's transaction channel is full:
+	// block (wait up to block_timeout, then drop), spill (queue to disk) or drop
+	OverflowStrategy string        `mapstructure:"overflow_strategy"`
+	BlockTimeout     time.Duration `mapstructure:"block_timeout"`
+	SpillDir         string        `mapstructure:"spill_dir"` // One queue file per client
+	// ReplayPath replaces the chain clients with a newline-delimited JSON file
+	// of TronEvents or transactions, e.g. for local development
+	ReplayPath   string  `mapstructure:"replay_path"`
+	ReplaySpeed  float64 `mapstructure:"replay_speed"`  // Multiple of recorded pace; 0 replays as fast as possible
+	ReplayRebase bool    `mapstructure:"replay_rebase"` // Shift timestamps so the replay starts now
 }
 
 // RaphtoryConfig holds Raphtory service configuration
@@ -57,6 +177,101 @@ type RaphtoryConfig struct {
 	Timeout        time.Duration `mapstructure:"timeout"`
 	MaxRetries     int           `mapstructure:"max_retries"`
 	RetryDelay     time.Duration `mapstructure:"retry_delay"`
+	// CircuitFailureThreshold consecutive failed calls stop calls to
+	// Raphtory for CircuitOpenTimeout. A negative threshold disables it.
+	CircuitFailureThreshold int           `mapstructure:"circuit_failure_threshold"`
+	CircuitOpenTimeout      time.Duration `mapstructure:"circuit_open_timeout"`
+	// OutboxEnabled parks failed writes in the raphtory_outbox table and
+	// retries them, so outages do not leave gaps in the graph. Requires the database.
+	OutboxEnabled          bool          `mapstructure:"outbox_enabled"`
+	OutboxRetryInterval    time.Duration `mapstructure:"outbox_retry_interval"`
+	OutboxMaxRetryInterval time.Duration `mapstructure:"outbox_max_retry_interval"`
+	// OutboxMaxAttempts failed deliveries dead-letter a write so it no
+	// longer holds up the outbox. Negative retries writes forever.
+	OutboxMaxAttempts int `mapstructure:"outbox_max_attempts"`
+	// BatchSize transactions are sent per request, or fewer after
+	// BatchFlushInterval. 1 sends each transaction on its own.
+	BatchSize          int           `mapstructure:"batch_size"`
+	BatchFlushInterval time.Duration `mapstructure:"batch_flush_interval"`
+	// Workers forward transactions concurrently from a queue of QueueSize.
+	// OrderByAddress keeps each sender's transactions on one worker, in order.
+	Workers        int  `mapstructure:"workers"`
+	QueueSize      int  `mapstructure:"queue_size"`
+	OrderByAddress bool `mapstructure:"order_by_address"`
+	// Transport is rest for the StableRisk Raphtory service or graphql for
+	// Raphtory's own GraphQL server at BaseURL, using the graph GraphName.
+	Transport string `mapstructure:"transport"`
+	GraphName string `mapstructure:"graph_name"`
+	// TLSCertFile and TLSKeyFile present a client certificate for mTLS
+	// with an https BaseURL; TLSCAFile verifies Raphtory's certificate.
+	TLSCertFile string `mapstructure:"tls_cert_file"`
+	TLSKeyFile  string `mapstructure:"tls_key_file"`
+	TLSCAFile   string `mapstructure:"tls_ca_file"`
+}
+
+// SinksConfig selects where the monitor delivers ingested transactions
+type SinksConfig struct {
+	Output   string          `mapstructure:"output"` // raphtory, kafka or both
+	Raphtory SinkRetryConfig `mapstructure:"raphtory"`
+	Kafka    KafkaSinkConfig `mapstructure:"kafka"`
+}
+
+// SinkRetryConfig holds per-sink delivery retries
+type SinkRetryConfig struct {
+	MaxRetries int           `mapstructure:"max_retries"`
+	RetryDelay time.Duration `mapstructure:"retry_delay"` // Doubles on each further retry
+}
+
+// KafkaSinkConfig holds Kafka sink configuration. Records are produced
+// through the Kafka REST Proxy.
+type KafkaSinkConfig struct {
+	RestProxyURL string        `mapstructure:"rest_proxy_url"`
+	Topic        string        `mapstructure:"topic"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+	MaxRetries   int           `mapstructure:"max_retries"`
+	RetryDelay   time.Duration `mapstructure:"retry_delay"`
+}
+
+// UsesSink reports whether the named sink is selected by Output
+func (c SinksConfig) UsesSink(name string) bool {
+	return c.Output == name || c.Output == "both"
+}
+
+// BusConfig holds NATS JetStream message bus configuration. When enabled
+// the monitor publishes transactions, the detector publishes outliers and
+// the API broadcasts outliers it receives from the bus.
+type BusConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	URL            string        `mapstructure:"url"`
+	Token          string        `mapstructure:"token"`
+	Stream         string        `mapstructure:"stream"`
+	MaxAge         time.Duration `mapstructure:"max_age"` // Stream retention
+	PublishTimeout time.Duration `mapstructure:"publish_timeout"`
+	ReconnectWait  time.Duration `mapstructure:"reconnect_wait"`
+	MaxRetries     int           `mapstructure:"max_retries"` // Per publish, on top of the first attempt
+	RetryDelay     time.Duration `mapstructure:"retry_delay"`
+	// WebSocketBackplane relays WebSocket broadcasts made by one API
+	// instance, such as outliers from manual detection runs, to the
+	// clients of every other instance
+	WebSocketBackplane bool `mapstructure:"websocket_backplane"`
+}
+
+// ArchiveConfig holds raw event archival configuration. When enabled the
+// monitor uploads every page of TronGrid events as a gzipped NDJSON object.
+type ArchiveConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	Backend         string        `mapstructure:"backend"` // s3, gcs or file
+	Bucket          string        `mapstructure:"bucket"`
+	Prefix          string        `mapstructure:"prefix"`
+	Endpoint        string        `mapstructure:"endpoint"` // Overrides the backend's default, e.g. for MinIO
+	Region          string        `mapstructure:"region"`
+	AccessKeyID     string        `mapstructure:"access_key_id"`     // HMAC access ID for gcs
+	SecretAccessKey string        `mapstructure:"secret_access_key"` // HMAC secret for gcs
+	Directory       string        `mapstructure:"directory"`         // Used by the file backend
+	QueueSize       int           `mapstructure:"queue_size"`
+	MaxRetries      int           `mapstructure:"max_retries"`
+	RetryDelay      time.Duration `mapstructure:"retry_delay"`
+	Timeout         time.Duration `mapstructure:"timeout"`
 }
 
 // SecurityConfig holds security and compliance configuration
@@ -65,12 +280,51 @@ type SecurityConfig struct {
 	JWTExpiry           time.Duration `mapstructure:"jwt_expiry"`
 	RefreshTokenExpiry  time.Duration `mapstructure:"refresh_token_expiry"`
 	EncryptionKey       string        `mapstructure:"encryption_key"`
+	PreviousEncryptionKeys []string   `mapstructure:"previous_encryption_keys"` // Still decrypt fields until they are re-encrypted
 	HMACKey             string        `mapstructure:"hmac_key"`
 	TLSEnabled          bool          `mapstructure:"tls_enabled"`
 	TLSCertFile         string        `mapstructure:"tls_cert_file"`
 	TLSKeyFile          string        `mapstructure:"tls_key_file"`
 	PasswordMinLength   int           `mapstructure:"password_min_length"`
-	PasswordHashCost    int           `mapstructure:"password_hash_cost"`
+	PasswordAlgorithm   string        `mapstructure:"password_algorithm"` // bcrypt or argon2id; other hashes move to it at login
+	PasswordHashCost    int           `mapstructure:"password_hash_cost"` // bcrypt cost
+	PasswordArgon2Memory      int     `mapstructure:"password_argon2_memory"` // KiB
+	PasswordArgon2Iterations  int     `mapstructure:"password_argon2_iterations"`
+	PasswordArgon2Parallelism int     `mapstructure:"password_argon2_parallelism"`
+	PasswordResetExpiry time.Duration `mapstructure:"password_reset_expiry"` // Lifetime of admin-issued reset tokens
+	LoginMaxFailures    int           `mapstructure:"login_max_failures"`    // Consecutive failures that lock an account; 0 disables
+	LoginLockout        time.Duration `mapstructure:"login_lockout"`         // How long a locked account stays locked
+	LoginIPMaxFailures  int           `mapstructure:"login_ip_max_failures"` // Failures per IP within LoginIPWindow before 429; 0 disables
+	LoginIPWindow       time.Duration `mapstructure:"login_ip_window"`
+	APIKeyRateLimit     int           `mapstructure:"api_key_rate_limit"` // Requests per minute for API keys without their own limit; 0 disables
+	RoleCacheTTL        time.Duration `mapstructure:"role_cache_ttl"`     // How long role permissions are cached before reloading
+	AuditAnchorInterval time.Duration `mapstructure:"audit_anchor_interval"` // How often the audit chain head is anchored
+	AuditRetentionDays  int           `mapstructure:"audit_retention_days"`  // Audit logs older than this move to the archive store; 0 keeps them
+	AuditArchiveInterval time.Duration `mapstructure:"audit_archive_interval"`
+	AuditArchivePrefix   string        `mapstructure:"audit_archive_prefix"`
+	IdempotencyTTL       time.Duration `mapstructure:"idempotency_ttl"` // How long responses to Idempotency-Key requests are kept for retries
+}
+
+// RateLimitConfig holds API request rate limits. Buckets are kept in memory,
+// limiting each API instance separately, or in Redis to share them.
+type RateLimitConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	Backend     string        `mapstructure:"backend"` // memory or redis
+	RedisURL    string        `mapstructure:"redis_url"`
+	RedisPrefix string        `mapstructure:"redis_prefix"`
+	Timeout     time.Duration `mapstructure:"timeout"` // Per Redis call; requests are allowed if it fails
+	Auth        RateLimitRule `mapstructure:"auth"`     // Login, token refresh and password reset
+	Outliers    RateLimitRule `mapstructure:"outliers"`
+	API         RateLimitRule `mapstructure:"api"` // Every other authenticated route
+}
+
+// RateLimitRule holds the limits for one route group, in requests per
+// minute. A limit of 0 disables it and a burst of 0 defaults to the limit.
+type RateLimitRule struct {
+	PerIP        int `mapstructure:"per_ip"`
+	PerIPBurst   int `mapstructure:"per_ip_burst"`
+	PerUser      int `mapstructure:"per_user"`
+	PerUserBurst int `mapstructure:"per_user_burst"`
 }
 
 // DetectionConfig holds anomaly detection configuration
@@ -78,9 +332,285 @@ type DetectionConfig struct {
 	Interval             time.Duration `mapstructure:"interval"`
 	ZScoreThreshold      float64       `mapstructure:"zscore_threshold"`
 	IQRMultiplier        float64       `mapstructure:"iqr_multiplier"`
+	IQRStreaming         bool          `mapstructure:"iqr_streaming"`
 	WindowDuration       time.Duration `mapstructure:"window_duration"`
 	MinDataPoints        int           `mapstructure:"min_data_points"`
 	PatternDetectionEnabled bool       `mapstructure:"pattern_detection_enabled"`
+	DBSCANEnabled        bool          `mapstructure:"dbscan_enabled"`
+	DBSCANEpsilon        float64       `mapstructure:"dbscan_epsilon"`
+	DBSCANMinPoints      int           `mapstructure:"dbscan_min_points"`
+	DBSCANMaxAddresses   int           `mapstructure:"dbscan_max_addresses"`
+	CirculationWindow    time.Duration `mapstructure:"circulation_window"`
+	FanOutThreshold      int           `mapstructure:"fan_out_threshold"`
+	FanInThreshold       int           `mapstructure:"fan_in_threshold"`
+	DormancyPeriod       time.Duration `mapstructure:"dormancy_period"`
+	VelocityWindow       time.Duration `mapstructure:"velocity_window"`
+	VelocityThreshold    int           `mapstructure:"velocity_threshold"`
+	MaxTransactions      int           `mapstructure:"max_transactions"`
+	Shards               int           `mapstructure:"shards"`
+	Workers              int           `mapstructure:"workers"`
+	MaxConcurrentRuns    int           `mapstructure:"max_concurrent_runs"`
+	RunTimeout           time.Duration `mapstructure:"run_timeout"`
+	IgnoreUnconfirmed    bool          `mapstructure:"ignore_unconfirmed"` // Skip transfers not yet at the confirmation depth
+	ClusterWindow        time.Duration `mapstructure:"cluster_window"`
+	ClusterMinSize       int           `mapstructure:"cluster_min_size"`
+	ClusterMinDensity    float64       `mapstructure:"cluster_min_density"`
+	TagGraphNodes        bool          `mapstructure:"tag_graph_nodes"` // Tag flagged addresses with their risk in Raphtory
+	FanWindow            time.Duration `mapstructure:"fan_window"`
+	FallbackGraphEnabled bool          `mapstructure:"fallback_graph_enabled"` // Keep recent transactions in memory for when Raphtory is down
+	FallbackGraphCapacity int          `mapstructure:"fallback_graph_capacity"`
+	FallbackGraphRetention time.Duration `mapstructure:"fallback_graph_retention"`
+	WatchlistEnabled     bool          `mapstructure:"watchlist_enabled"` // Alert on every transfer touching a watchlisted address
+	WatchlistRefreshInterval time.Duration `mapstructure:"watchlist_refresh_interval"`
+	// Label outliers with the known entities behind their addresses
+	LabelsEnabled           bool          `mapstructure:"labels_enabled"`
+	LabelsRefreshInterval   time.Duration `mapstructure:"labels_refresh_interval"`
+	LabelExemptCategories   []string      `mapstructure:"label_exempt_categories"`   // No fan-out, fan-in or velocity outliers for these entities
+	LabelEscalateCategories []string      `mapstructure:"label_escalate_categories"` // Outliers touching these entities are raised one severity
+	// How often detectors check for settings saved through the API, which
+	// override the thresholds, windows and enabled detectors above
+	ConfigRefreshInterval time.Duration `mapstructure:"config_refresh_interval"`
+	// Acknowledged outliers of these severities older than
+	// OutlierArchiveAfterDays are archived every OutlierArchiveInterval,
+	// which drops them from default listings; 0 days keeps them
+	OutlierArchiveAfterDays  int           `mapstructure:"outlier_archive_after_days"`
+	OutlierArchiveSeverities []string      `mapstructure:"outlier_archive_severities"`
+	OutlierArchiveInterval   time.Duration `mapstructure:"outlier_archive_interval"`
+}
+
+// SanctionsConfig holds sanctions list screening configuration. When
+// enabled the monitor screens every ingested transaction against the lists
+// and raises a critical pattern_sanctions outlier for each sanctioned side.
+type SanctionsConfig struct {
+	Enabled         bool                  `mapstructure:"enabled"`
+	RefreshInterval time.Duration         `mapstructure:"refresh_interval"`
+	Timeout         time.Duration         `mapstructure:"timeout"` // Per list download
+	OFACEnabled     bool                  `mapstructure:"ofac_enabled"`
+	OFACURL         string                `mapstructure:"ofac_url"` // SDN list XML, as a URL or file path
+	CSVLists        []SanctionsListConfig `mapstructure:"csv_lists"`
+}
+
+// SanctionsListConfig describes a sanctions list imported from CSV
+type SanctionsListConfig struct {
+	Name   string `mapstructure:"name"`
+	Source string `mapstructure:"source"` // URL or file path
+}
+
+// EnrichmentConfig holds chain-analytics enrichment configuration. When
+// enabled, detection screens outliers' addresses and counterparties with a
+// third-party address-risk API, such as Chainalysis or TRM Labs, and adds
+// the risk it reports to the outliers and address profiles.
+type EnrichmentConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Provider string `mapstructure:"provider"` // Recorded with screenings, e.g. chainalysis
+	// URL is requested for each address, with {address} replaced. Body is
+	// POSTed as JSON, with {address} replaced, when set.
+	URL          string `mapstructure:"url"`
+	Body         string `mapstructure:"body"`
+	APIKeyHeader string `mapstructure:"api_key_header"`
+	APIKey       string `mapstructure:"api_key"`
+	// Dotted paths to the category, risk rating and entity name in the
+	// API's response; numbers index arrays
+	CategoryField string        `mapstructure:"category_field"`
+	RiskField     string        `mapstructure:"risk_field"`
+	EntityField   string        `mapstructure:"entity_field"`
+	Timeout       time.Duration `mapstructure:"timeout"`       // Per request
+	CacheTTL      time.Duration `mapstructure:"cache_ttl"`     // How long a screening is reused
+	Concurrency   int           `mapstructure:"concurrency"`   // Requests in flight at once
+	MaxAddresses  int           `mapstructure:"max_addresses"` // Addresses screened per detection cycle
+}
+
+// NotifyConfig holds alert notification configuration. When enabled the
+// API sends outliers matching a rule to the rule's channels.
+type NotifyConfig struct {
+	Enabled     bool               `mapstructure:"enabled"`
+	Rules       []NotifyRuleConfig `mapstructure:"rules"`
+	DedupWindow time.Duration      `mapstructure:"dedup_window"` // Repeat alerts for an outlier type and address within this are dropped
+	// RatePerMinute alerts may go to each channel, in bursts of up to
+	// RateBurst; 0 for no limit
+	RatePerMinute int           `mapstructure:"rate_per_minute"`
+	RateBurst     int           `mapstructure:"rate_burst"`
+	MaxRetries    int           `mapstructure:"max_retries"`
+	RetryDelay    time.Duration `mapstructure:"retry_delay"`
+	QueueSize     int           `mapstructure:"queue_size"`    // Alerts waiting per channel
+	DashboardURL  string        `mapstructure:"dashboard_url"` // Alerts link to the outlier here
+
+	Email     NotifyEmailConfig     `mapstructure:"email"`
+	PagerDuty NotifyPagerDutyConfig `mapstructure:"pagerduty"`
+	Opsgenie  NotifyOpsgenieConfig  `mapstructure:"opsgenie"`
+	Telegram  NotifyTelegramConfig  `mapstructure:"telegram"`
+}
+
+// WebhooksConfig holds outbound webhook delivery configuration. When
+// enabled organizations can register webhooks, and the API posts outlier
+// and incident events to them.
+type WebhooksConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	MaxRetries    int           `mapstructure:"max_retries"`     // Retries of a failed delivery, with exponential backoff
+	RetryDelay    time.Duration `mapstructure:"retry_delay"`     // Before the first retry, doubled on each further one
+	MaxRetryDelay time.Duration `mapstructure:"max_retry_delay"` // Longest wait between retries
+	Timeout       time.Duration `mapstructure:"timeout"`         // Per delivery attempt
+	Workers       int           `mapstructure:"workers"`         // Deliveries made at once
+	QueueSize     int           `mapstructure:"queue_size"`      // Events waiting before new ones are dropped
+	// AllowInsecureURLs accepts http webhook URLs, for development;
+	// otherwise they must use https
+	AllowInsecureURLs bool `mapstructure:"allow_insecure_urls"`
+	// AllowPrivateAddresses lets webhooks reach localhost and loopback,
+	// private and link-local addresses, for development
+	AllowPrivateAddresses bool `mapstructure:"allow_private_addresses"`
+}
+
+// SIEMConfig holds SIEM export configuration. When enabled the API
+// forwards outliers and audit log entries to a SIEM over syslog, or to an
+// HTTPS collector.
+type SIEMConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	Transport string `mapstructure:"transport"` // syslog or https
+	// Network is udp, tcp or tls, for syslog to the host:port Address
+	Network  string `mapstructure:"network"`
+	Address  string `mapstructure:"address"`
+	Facility int    `mapstructure:"facility"` // Syslog facility, e.g. 16 for local0
+	Hostname string `mapstructure:"hostname"` // In syslog headers; empty for the host's name
+	// URL is the HTTPS collector events are POSTed to, with Headers such as
+	// the collector's token
+	URL     string            `mapstructure:"url"`
+	Headers map[string]string `mapstructure:"headers"`
+	// TLSCertFile and TLSKeyFile present a client certificate for tls
+	// syslog and the HTTPS collector; TLSCAFile verifies their certificate.
+	TLSCertFile string        `mapstructure:"tls_cert_file"`
+	TLSKeyFile  string        `mapstructure:"tls_key_file"`
+	TLSCAFile   string        `mapstructure:"tls_ca_file"`
+	Timeout     time.Duration `mapstructure:"timeout"`     // Per send
+	MaxRetries  int           `mapstructure:"max_retries"` // Retries of a failed send, with exponential backoff
+	RetryDelay  time.Duration `mapstructure:"retry_delay"` // Before the first retry, doubled on each further one
+	QueueSize   int           `mapstructure:"queue_size"`  // Events waiting before new ones are dropped
+	BatchSize   int           `mapstructure:"batch_size"`  // Events sent at once
+
+	Outliers SIEMEventConfig `mapstructure:"outliers"`
+	Audit    SIEMEventConfig `mapstructure:"audit"`
+}
+
+// SIEMEventConfig selects the events of one type exported to the SIEM, and
+// their format
+type SIEMEventConfig struct {
+	Enabled     bool     `mapstructure:"enabled"`
+	Format      string   `mapstructure:"format"`       // cef, leef or json
+	MinSeverity string   `mapstructure:"min_severity"` // Outliers only: less severe ones are not exported
+	Actions     []string `mapstructure:"actions"`      // Audit only: actions exported; empty for all
+}
+
+// ReportsConfig holds scheduled report configuration
+type ReportsConfig struct {
+	Daily DailyReportConfig `mapstructure:"daily"`
+}
+
+// DailyReportConfig holds the daily digest's settings. The digest is sent
+// through the SMTP server configured under notify.email, which need not be
+// enabled for alerts.
+type DailyReportConfig struct {
+	Enabled    bool     `mapstructure:"enabled"`
+	SendAt     string   `mapstructure:"send_at"` // UTC time of day the previous day's report is sent, as HH:MM
+	Recipients []string `mapstructure:"recipients"`
+	OrgID      string   `mapstructure:"org_id"`     // Organization reported on; empty for the default organization
+	AttachPDF  bool     `mapstructure:"attach_pdf"` // Attach a PDF copy as well as the HTML body
+	// CheckInterval is how often each instance checks whether the report is
+	// due; it is sent once however many instances run
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+	MaxAttempts   int           `mapstructure:"max_attempts"` // Sends of a report before giving up
+}
+
+// SendAfter returns SendAt as the time after midnight UTC
+func (c DailyReportConfig) SendAfter() time.Duration {
+	sendAt, _ := time.Parse("15:04", c.SendAt)
+	return time.Duration(sendAt.Hour())*time.Hour + time.Duration(sendAt.Minute())*time.Minute
+}
+
+// NotifyEmailConfig holds the email channel's SMTP settings
+type NotifyEmailConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	Host        string `mapstructure:"host"`
+	Port        int    `mapstructure:"port"`
+	ImplicitTLS bool   `mapstructure:"implicit_tls"` // TLS from connect, as on port 465; otherwise STARTTLS when offered
+	Username    string `mapstructure:"username"`     // Empty sends without authenticating
+	Password    string `mapstructure:"password"`
+	From        string `mapstructure:"from"`
+	// Recipients by severity; severities not listed go to DefaultRecipients
+	Recipients        map[string][]string `mapstructure:"recipients"`
+	DefaultRecipients []string            `mapstructure:"default_recipients"`
+	// BatchWindow collects alerts less severe than ImmediateSeverity into a
+	// digest sent every window; 0 sends each alert on its own
+	BatchWindow       time.Duration `mapstructure:"batch_window"`
+	ImmediateSeverity string        `mapstructure:"immediate_severity"`
+	Timeout           time.Duration `mapstructure:"timeout"`
+}
+
+// NotifyPagerDutyConfig holds the pagerduty channel's settings
+type NotifyPagerDutyConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	EventsURL  string `mapstructure:"events_url"`
+	RoutingKey string `mapstructure:"routing_key"` // Events API v2 integration key
+	// RoutingKeys page other services, with their own escalation policies,
+	// for some severities
+	RoutingKeys map[string]string `mapstructure:"routing_keys"`
+	MinSeverity string            `mapstructure:"min_severity"` // Less severe alerts are not paged
+	Timeout     time.Duration     `mapstructure:"timeout"`
+}
+
+// NotifyOpsgenieConfig holds the opsgenie channel's settings
+type NotifyOpsgenieConfig struct {
+	Enabled     bool                      `mapstructure:"enabled"`
+	APIURL      string                    `mapstructure:"api_url"`
+	APIKey      string                    `mapstructure:"api_key"`
+	Responders  []NotifyOpsgenieResponder `mapstructure:"responders"`
+	Priorities  map[string]string         `mapstructure:"priorities"`   // By severity, e.g. critical: P1
+	MinSeverity string                    `mapstructure:"min_severity"` // Less severe alerts are not paged
+	Timeout     time.Duration             `mapstructure:"timeout"`
+}
+
+// NotifyOpsgenieResponder is a team, user, escalation or schedule Opsgenie
+// alerts go to
+type NotifyOpsgenieResponder struct {
+	Type string `mapstructure:"type"`
+	Name string `mapstructure:"name"`
+}
+
+// NotifyTelegramConfig holds the telegram channel's settings
+type NotifyTelegramConfig struct {
+	Enabled  bool                 `mapstructure:"enabled"`
+	APIURL   string               `mapstructure:"api_url"`
+	BotToken string               `mapstructure:"bot_token"`
+	Chats    []NotifyTelegramChat `mapstructure:"chats"`
+	// ChatRatePerMinute messages may go to each chat, in bursts of up to
+	// ChatRateBurst, and RatePerMinute across every chat, in bursts of up to
+	// RateBurst; alerts over either are dropped
+	ChatRatePerMinute int           `mapstructure:"chat_rate_per_minute"`
+	ChatRateBurst     int           `mapstructure:"chat_rate_burst"`
+	RatePerMinute     int           `mapstructure:"rate_per_minute"`
+	RateBurst         int           `mapstructure:"rate_burst"`
+	Timeout           time.Duration `mapstructure:"timeout"`
+}
+
+// NotifyTelegramChat is a chat, group or channel Telegram alerts go to
+type NotifyTelegramChat struct {
+	ID          string `mapstructure:"id"`           // Numeric chat ID, or @username for public channels
+	MinSeverity string `mapstructure:"min_severity"` // Less severe alerts are not sent to this chat
+}
+
+// NotifyRuleConfig selects the outliers sent to a set of channels
+type NotifyRuleConfig struct {
+	Name        string   `mapstructure:"name"`
+	MinSeverity string   `mapstructure:"min_severity"` // Empty matches every severity
+	Types       []string `mapstructure:"types"`        // Empty matches every type
+	Watchlisted bool     `mapstructure:"watchlisted"`  // Only outliers on or against a watched address
+	Channels    []string `mapstructure:"channels"`
+}
+
+// FeaturesConfig holds feature flag configuration. Flags gate experimental
+// capabilities; values saved through the API override Flags.
+type FeaturesConfig struct {
+	Environment     string          `mapstructure:"environment"`      // Selects each flag's per-environment override, e.g. staging
+	Flags           map[string]bool `mapstructure:"flags"`            // By flag name; unset flags keep their built-in default
+	RefreshInterval time.Duration   `mapstructure:"refresh_interval"` // How quickly flags saved through the API reach each service
 }
 
 // LoggingConfig holds logging configuration
@@ -89,6 +619,16 @@ type LoggingConfig struct {
 	Format     string `mapstructure:"format"`
 	OutputPath string `mapstructure:"output_path"`
 	ErrorPath  string `mapstructure:"error_path"`
+
+	// Rotation of file outputs
+	MaxSizeMB  int           `mapstructure:"max_size_mb"`
+	MaxAge     time.Duration `mapstructure:"max_age"`
+	MaxBackups int           `mapstructure:"max_backups"`
+	Compress   bool          `mapstructure:"compress"`
+
+	// Sampling of debug and info entries; 0 sampling_initial disables it
+	SamplingInitial    int `mapstructure:"sampling_initial"`
+	SamplingThereafter int `mapstructure:"sampling_thereafter"`
 }
 
 // MonitoringConfig holds monitoring and observability configuration
@@ -96,10 +636,34 @@ type MonitoringConfig struct {
 	Enabled        bool   `mapstructure:"enabled"`
 	MetricsPort    int    `mapstructure:"metrics_port"`
 	HealthCheckURL string `mapstructure:"health_check_url"`
+
+	// OpenTelemetry tracing, exported over OTLP/HTTP
+	TracingEnabled     bool    `mapstructure:"tracing_enabled"`
+	TracingEndpoint    string  `mapstructure:"tracing_endpoint"`     // Collector base URL; spans are posted to /v1/traces
+	TracingSampleRatio float64 `mapstructure:"tracing_sample_ratio"` // Fraction of new traces recorded (0-1)
+
+	// pprof profiles and expvar runtime state, served on their own listener
+	DiagnosticsEnabled bool   `mapstructure:"diagnostics_enabled"`
+	DiagnosticsAddress string `mapstructure:"diagnostics_address"` // Keep on loopback; profiles expose memory contents
+
+	// Latency above which database calls and API requests are logged and counted; 0 disables
+	SlowQueryThreshold   time.Duration `mapstructure:"slow_query_threshold"`
+	SlowRequestThreshold time.Duration `mapstructure:"slow_request_threshold"`
+
+	// Component statuses each service shares for the API health report
+	StatusInterval   time.Duration `mapstructure:"status_interval"`    // How often each service reports
+	StatusStaleAfter time.Duration `mapstructure:"status_stale_after"` // Reports older than this are unhealthy
 }
 
 // Load reads configuration from file and environment variables
 func Load(configPath string) (*Config, error) {
+	return LoadWithOverrides(configPath, nil)
+}
+
+// LoadWithOverrides reads configuration like Load, then applies overrides
+// (keyed by dotted config path, e.g. from command-line flags) on top of the
+// file and environment before validating
+func LoadWithOverrides(configPath string, overrides map[string]interface{}) (*Config, error) {
 	v := viper.New()
 
 	// Set default values
@@ -128,6 +692,10 @@ func Load(configPath string) (*Config, error) {
 		// Config file not found; use defaults and env vars
 	}
 
+	for key, value := range overrides {
+		v.Set(key, value)
+	}
+
 	// Unmarshal config
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
@@ -149,6 +717,20 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("server.read_timeout", 10*time.Second)
 	v.SetDefault("server.write_timeout", 10*time.Second)
 	v.SetDefault("server.max_header_bytes", 1<<20) // 1 MB
+	v.SetDefault("server.cors_allowed_origins", []string{"http://localhost:3000"})
+	v.SetDefault("server.cors_allowed_methods", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"})
+	v.SetDefault("server.cors_max_age", 10*time.Minute)
+	v.SetDefault("server.hsts_max_age", 365*24*time.Hour)
+	v.SetDefault("server.content_security_policy", "default-src 'none'; frame-ancestors 'none'")
+	v.SetDefault("server.swagger_ui_enabled", false)
+	v.SetDefault("server.swagger_ui_assets_url", "https://cdn.jsdelivr.net/npm/swagger-ui-dist@5.17.14")
+	v.SetDefault("server.graphql_enabled", true)
+	v.SetDefault("server.graphql_max_depth", 10)
+	v.SetDefault("server.graphql_max_resolves", 1000)
+	v.SetDefault("server.websocket_max_connections", 10000)
+	v.SetDefault("server.websocket_max_connections_per_user", 10)
+	v.SetDefault("server.websocket_broadcast_workers", 0)
+	v.SetDefault("server.trusted_proxies", []string{})
 
 	// Database defaults
 	v.SetDefault("database.host", "localhost")
@@ -159,6 +741,7 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("database.max_open_conns", 25)
 	v.SetDefault("database.max_idle_conns", 5)
 	v.SetDefault("database.conn_max_lifetime", 5*time.Minute)
+	v.SetDefault("database.auto_migrate", false)
 
 	// TronGrid defaults
 	// Note: websocket_url is now used for REST API (https://), not WebSocket (wss://)
@@ -167,52 +750,530 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("trongrid.reconnect_delay", 1*time.Second)
 	v.SetDefault("trongrid.max_reconnects", 10)
 	v.SetDefault("trongrid.ping_interval", 10*time.Second) // Used as polling interval
+	v.SetDefault("trongrid.checkpoint_store", "file")
+	v.SetDefault("trongrid.checkpoint_path", "data/trongrid-checkpoint.json")
+	v.SetDefault("trongrid.max_pages_per_poll", 10)
+	v.SetDefault("trongrid.requests_per_second", 10.0)
+	v.SetDefault("trongrid.gap_threshold", 20)
+	v.SetDefault("trongrid.backfill_gaps", true)
+	v.SetDefault("trongrid.dedup_cache_size", 10000)
+	v.SetDefault("trongrid.confirmation_depth", 0)
+	v.SetDefault("trongrid.lag_interval", 30*time.Second)
+
+	// Ethereum defaults
+	v.SetDefault("ethereum.enabled", false)
+	v.SetDefault("ethereum.poll_interval", 15*time.Second)
+	v.SetDefault("ethereum.confirmations", 12)
+	v.SetDefault("ethereum.max_block_range", 500)
+	v.SetDefault("ethereum.checkpoint_store", "file")
+	v.SetDefault("ethereum.checkpoint_path", "data/ethereum-checkpoint.json")
+
+	// Ingestion defaults
+	v.SetDefault("ingestion.overflow_strategy", "block")
+	v.SetDefault("ingestion.block_timeout", 10*time.Second)
+	v.SetDefault("ingestion.spill_dir", "data/spill")
+	v.SetDefault("ingestion.replay_path", "")
+	v.SetDefault("ingestion.replay_speed", 0.0)
+	v.SetDefault("ingestion.replay_rebase", false)
 
 	// Raphtory defaults
 	v.SetDefault("raphtory.base_url", "http://localhost:8000")
 	v.SetDefault("raphtory.timeout", 30*time.Second)
 	v.SetDefault("raphtory.max_retries", 3)
 	v.SetDefault("raphtory.retry_delay", 1*time.Second)
+	v.SetDefault("raphtory.circuit_failure_threshold", 5)
+	v.SetDefault("raphtory.circuit_open_timeout", 30*time.Second)
+	v.SetDefault("raphtory.outbox_enabled", true)
+	v.SetDefault("raphtory.outbox_retry_interval", 5*time.Second)
+	v.SetDefault("raphtory.outbox_max_retry_interval", 5*time.Minute)
+	v.SetDefault("raphtory.outbox_max_attempts", 20)
+	v.SetDefault("raphtory.batch_size", 100)
+	v.SetDefault("raphtory.batch_flush_interval", 1*time.Second)
+	v.SetDefault("raphtory.workers", 4)
+	v.SetDefault("raphtory.queue_size", 1000)
+	v.SetDefault("raphtory.order_by_address", false)
+	v.SetDefault("raphtory.transport", "rest")
+	v.SetDefault("raphtory.graph_name", "stablerisk")
+
+	// Sink defaults. Raphtory adds are retried by the outbox, so only
+	// retractions use the Raphtory retries.
+	v.SetDefault("sinks.output", "raphtory")
+	v.SetDefault("sinks.raphtory.max_retries", 3)
+	v.SetDefault("sinks.raphtory.retry_delay", 1*time.Second)
+	v.SetDefault("sinks.kafka.rest_proxy_url", "http://localhost:8082")
+	v.SetDefault("sinks.kafka.topic", "stablerisk.transactions")
+	v.SetDefault("sinks.kafka.timeout", 10*time.Second)
+	v.SetDefault("sinks.kafka.max_retries", 3)
+	v.SetDefault("sinks.kafka.retry_delay", 1*time.Second)
+
+	// Message bus defaults
+	v.SetDefault("bus.enabled", false)
+	v.SetDefault("bus.url", "nats://localhost:4222")
+	v.SetDefault("bus.stream", "STABLERISK")
+	v.SetDefault("bus.max_age", 168*time.Hour)
+	v.SetDefault("bus.publish_timeout", 5*time.Second)
+	v.SetDefault("bus.reconnect_wait", 2*time.Second)
+	v.SetDefault("bus.max_retries", 3)
+	v.SetDefault("bus.retry_delay", 1*time.Second)
+	v.SetDefault("bus.websocket_backplane", false)
+
+	// Archive defaults
+	v.SetDefault("archive.enabled", false)
+	v.SetDefault("archive.backend", "s3")
+	v.SetDefault("archive.prefix", "raw/trongrid")
+	v.SetDefault("archive.directory", "data/archive")
+	v.SetDefault("archive.queue_size", 100)
+	v.SetDefault("archive.max_retries", 5)
+	v.SetDefault("archive.retry_delay", 1*time.Second)
+	v.SetDefault("archive.timeout", 30*time.Second)
 
 	// Security defaults
 	v.SetDefault("security.jwt_expiry", 1*time.Hour)
 	v.SetDefault("security.refresh_token_expiry", 7*24*time.Hour)
 	v.SetDefault("security.tls_enabled", false)
 	v.SetDefault("security.password_min_length", 12)
+	v.SetDefault("security.password_algorithm", "bcrypt")
 	v.SetDefault("security.password_hash_cost", 12)
+	v.SetDefault("security.password_argon2_memory", 64*1024)
+	v.SetDefault("security.password_argon2_iterations", 3)
+	v.SetDefault("security.password_argon2_parallelism", 4)
+	v.SetDefault("security.password_reset_expiry", 24*time.Hour)
+	v.SetDefault("security.login_max_failures", 5)
+	v.SetDefault("security.login_lockout", 15*time.Minute)
+	v.SetDefault("security.login_ip_max_failures", 20)
+	v.SetDefault("security.login_ip_window", 15*time.Minute)
+	v.SetDefault("security.api_key_rate_limit", 600)
+	v.SetDefault("security.role_cache_ttl", 30*time.Second)
+	v.SetDefault("security.audit_anchor_interval", time.Hour)
+	v.SetDefault("security.audit_retention_days", 0)
+	v.SetDefault("security.audit_archive_interval", 24*time.Hour)
+	v.SetDefault("security.audit_archive_prefix", "audit")
+	v.SetDefault("security.idempotency_ttl", 24*time.Hour)
 
 	// Detection defaults
 	v.SetDefault("detection.interval", 60*time.Second)
 	v.SetDefault("detection.zscore_threshold", 3.0)
 	v.SetDefault("detection.iqr_multiplier", 1.5)
+	v.SetDefault("detection.iqr_streaming", true)
 	v.SetDefault("detection.window_duration", 24*time.Hour)
 	v.SetDefault("detection.min_data_points", 30)
 	v.SetDefault("detection.pattern_detection_enabled", true)
+	v.SetDefault("detection.dbscan_enabled", true)
+	v.SetDefault("detection.dbscan_epsilon", 0.5)
+	v.SetDefault("detection.dbscan_min_points", 5)
+	v.SetDefault("detection.dbscan_max_addresses", 5000)
+	v.SetDefault("detection.circulation_window", 24*time.Hour)
+	v.SetDefault("detection.fan_out_threshold", 50)
+	v.SetDefault("detection.fan_in_threshold", 50)
+	v.SetDefault("detection.dormancy_period", 90*24*time.Hour)
+	v.SetDefault("detection.velocity_window", 1*time.Hour)
+	v.SetDefault("detection.velocity_threshold", 100)
+	v.SetDefault("detection.max_transactions", 100000)
+	v.SetDefault("detection.shards", 16)
+	v.SetDefault("detection.workers", 0)
+	v.SetDefault("detection.max_concurrent_runs", 2)
+	v.SetDefault("detection.run_timeout", 5*time.Minute)
+	v.SetDefault("detection.ignore_unconfirmed", false)
+	v.SetDefault("detection.cluster_window", 24*time.Hour)
+	v.SetDefault("detection.cluster_min_size", 3)
+	v.SetDefault("detection.cluster_min_density", 0.3)
+	v.SetDefault("detection.tag_graph_nodes", true)
+	v.SetDefault("detection.fan_window", 24*time.Hour)
+	v.SetDefault("detection.fallback_graph_enabled", true)
+	v.SetDefault("detection.fallback_graph_capacity", 100000)
+	v.SetDefault("detection.fallback_graph_retention", 24*time.Hour)
+	v.SetDefault("detection.watchlist_enabled", true)
+	v.SetDefault("detection.watchlist_refresh_interval", 30*time.Second)
+	v.SetDefault("detection.labels_enabled", true)
+	v.SetDefault("detection.labels_refresh_interval", 5*time.Minute)
+	v.SetDefault("detection.label_exempt_categories", []string{"exchange"})
+	v.SetDefault("detection.label_escalate_categories", []string{"mixer"})
+	v.SetDefault("detection.config_refresh_interval", 30*time.Second)
+	v.SetDefault("detection.outlier_archive_after_days", 0)
+	v.SetDefault("detection.outlier_archive_severities", []string{"low"})
+	v.SetDefault("detection.outlier_archive_interval", time.Hour)
+
+	// Sanctions screening defaults
+	v.SetDefault("sanctions.enabled", false)
+	v.SetDefault("sanctions.refresh_interval", 24*time.Hour)
+	v.SetDefault("sanctions.timeout", 60*time.Second)
+	v.SetDefault("sanctions.ofac_enabled", true)
+	v.SetDefault("sanctions.ofac_url", "https://sanctionslistservice.ofac.treas.gov/api/PublicationPreview/exports/SDN.XML")
+
+	// Chain-analytics enrichment defaults
+	v.SetDefault("enrichment.enabled", false)
+	v.SetDefault("enrichment.provider", "chainalysis")
+	v.SetDefault("enrichment.url", "https://api.chainalysis.com/api/risk/v2/entities/{address}")
+	v.SetDefault("enrichment.body", "")
+	v.SetDefault("enrichment.api_key_header", "Token")
+	v.SetDefault("enrichment.api_key", "")
+	v.SetDefault("enrichment.category_field", "cluster.category")
+	v.SetDefault("enrichment.risk_field", "risk")
+	v.SetDefault("enrichment.entity_field", "cluster.name")
+	v.SetDefault("enrichment.timeout", 10*time.Second)
+	v.SetDefault("enrichment.cache_ttl", 24*time.Hour)
+	v.SetDefault("enrichment.concurrency", 4)
+	v.SetDefault("enrichment.max_addresses", 100)
+
+	// Notification defaults
+	v.SetDefault("notify.enabled", false)
+	v.SetDefault("notify.dedup_window", 15*time.Minute)
+	v.SetDefault("notify.rate_per_minute", 30)
+	v.SetDefault("notify.rate_burst", 10)
+	v.SetDefault("notify.max_retries", 3)
+	v.SetDefault("notify.retry_delay", 2*time.Second)
+	v.SetDefault("notify.queue_size", 100)
+	v.SetDefault("notify.dashboard_url", "")
+	v.SetDefault("notify.email.enabled", false)
+	v.SetDefault("notify.email.host", "")
+	v.SetDefault("notify.email.port", 587)
+	v.SetDefault("notify.email.implicit_tls", false)
+	v.SetDefault("notify.email.username", "")
+	v.SetDefault("notify.email.password", "")
+	v.SetDefault("notify.email.from", "")
+	v.SetDefault("notify.email.batch_window", time.Duration(0))
+	v.SetDefault("notify.email.immediate_severity", "critical")
+	v.SetDefault("notify.email.timeout", 30*time.Second)
+	v.SetDefault("notify.pagerduty.enabled", false)
+	v.SetDefault("notify.pagerduty.events_url", "https://events.pagerduty.com/v2/enqueue")
+	v.SetDefault("notify.pagerduty.routing_key", "")
+	v.SetDefault("notify.pagerduty.min_severity", "critical")
+	v.SetDefault("notify.pagerduty.timeout", 10*time.Second)
+	v.SetDefault("notify.opsgenie.enabled", false)
+	v.SetDefault("notify.opsgenie.api_url", "https://api.opsgenie.com")
+	v.SetDefault("notify.opsgenie.api_key", "")
+	v.SetDefault("notify.opsgenie.min_severity", "critical")
+	v.SetDefault("notify.opsgenie.timeout", 10*time.Second)
+	v.SetDefault("notify.telegram.enabled", false)
+	v.SetDefault("notify.telegram.api_url", "https://api.telegram.org")
+	v.SetDefault("notify.telegram.bot_token", "")
+	v.SetDefault("notify.telegram.chat_rate_per_minute", 20)
+	v.SetDefault("notify.telegram.chat_rate_burst", 3)
+	v.SetDefault("notify.telegram.rate_per_minute", 1200)
+	v.SetDefault("notify.telegram.rate_burst", 30)
+	v.SetDefault("notify.telegram.timeout", 10*time.Second)
+
+	// Webhooks defaults
+	v.SetDefault("webhooks.enabled", true)
+	v.SetDefault("webhooks.max_retries", 5)
+	v.SetDefault("webhooks.retry_delay", 5*time.Second)
+	v.SetDefault("webhooks.max_retry_delay", 5*time.Minute)
+	v.SetDefault("webhooks.timeout", 10*time.Second)
+	v.SetDefault("webhooks.workers", 4)
+	v.SetDefault("webhooks.queue_size", 1000)
+	v.SetDefault("webhooks.allow_insecure_urls", false)
+	v.SetDefault("webhooks.allow_private_addresses", false)
+
+	// Reports defaults
+	v.SetDefault("reports.daily.enabled", false)
+	v.SetDefault("reports.daily.send_at", "07:00")
+	v.SetDefault("reports.daily.org_id", "")
+	v.SetDefault("reports.daily.attach_pdf", true)
+	v.SetDefault("reports.daily.check_interval", 5*time.Minute)
+	v.SetDefault("reports.daily.max_attempts", 3)
+
+	// SIEM export defaults
+	v.SetDefault("siem.enabled", false)
+	v.SetDefault("siem.transport", "syslog")
+	v.SetDefault("siem.network", "udp")
+	v.SetDefault("siem.address", "")
+	v.SetDefault("siem.facility", 16)
+	v.SetDefault("siem.hostname", "")
+	v.SetDefault("siem.url", "")
+	v.SetDefault("siem.timeout", 10*time.Second)
+	v.SetDefault("siem.max_retries", 3)
+	v.SetDefault("siem.retry_delay", time.Second)
+	v.SetDefault("siem.queue_size", 1000)
+	v.SetDefault("siem.batch_size", 100)
+	v.SetDefault("siem.outliers.enabled", true)
+	v.SetDefault("siem.outliers.format", "cef")
+	v.SetDefault("siem.outliers.min_severity", "low")
+	v.SetDefault("siem.audit.enabled", true)
+	v.SetDefault("siem.audit.format", "cef")
+
+	// Feature flag defaults
+	v.SetDefault("features.environment", "production")
+	v.SetDefault("features.refresh_interval", 30*time.Second)
+
+	// Rate limit defaults
+	v.SetDefault("rate_limit.enabled", true)
+	v.SetDefault("rate_limit.backend", "memory")
+	v.SetDefault("rate_limit.redis_url", "redis://localhost:6379/0")
+	v.SetDefault("rate_limit.redis_prefix", "stablerisk:ratelimit:")
+	v.SetDefault("rate_limit.timeout", 1*time.Second)
+	v.SetDefault("rate_limit.auth.per_ip", 10)
+	v.SetDefault("rate_limit.auth.per_ip_burst", 5)
+	v.SetDefault("rate_limit.auth.per_user", 0)
+	v.SetDefault("rate_limit.auth.per_user_burst", 0)
+	v.SetDefault("rate_limit.outliers.per_ip", 300)
+	v.SetDefault("rate_limit.outliers.per_ip_burst", 0)
+	v.SetDefault("rate_limit.outliers.per_user", 120)
+	v.SetDefault("rate_limit.outliers.per_user_burst", 30)
+	v.SetDefault("rate_limit.api.per_ip", 600)
+	v.SetDefault("rate_limit.api.per_ip_burst", 0)
+	v.SetDefault("rate_limit.api.per_user", 300)
+	v.SetDefault("rate_limit.api.per_user_burst", 0)
 
 	// Logging defaults
 	v.SetDefault("logging.level", "info")
 	v.SetDefault("logging.format", "json")
 	v.SetDefault("logging.output_path", "stdout")
 	v.SetDefault("logging.error_path", "stderr")
+	v.SetDefault("logging.max_size_mb", 100)
+	v.SetDefault("logging.max_age", "168h")
+	v.SetDefault("logging.max_backups", 5)
+	v.SetDefault("logging.compress", true)
+	v.SetDefault("logging.sampling_initial", 0)
+	v.SetDefault("logging.sampling_thereafter", 100)
 
 	// Monitoring defaults
 	v.SetDefault("monitoring.enabled", true)
 	v.SetDefault("monitoring.metrics_port", 9090)
 	v.SetDefault("monitoring.health_check_url", "/health")
+	v.SetDefault("monitoring.tracing_enabled", false)
+	v.SetDefault("monitoring.tracing_endpoint", "http://localhost:4318")
+	v.SetDefault("monitoring.tracing_sample_ratio", 1.0)
+	v.SetDefault("monitoring.diagnostics_enabled", false)
+	v.SetDefault("monitoring.diagnostics_address", "localhost:6060")
+	v.SetDefault("monitoring.slow_query_threshold", "500ms")
+	v.SetDefault("monitoring.slow_request_threshold", "2s")
+	v.SetDefault("monitoring.status_interval", 15*time.Second)
+	v.SetDefault("monitoring.status_stale_after", time.Minute)
 }
 
 // validate checks if the configuration is valid
 func validate(cfg *Config) error {
-	// Validate TronGrid API key
-	if cfg.TronGrid.APIKey == "" {
+	// Validate TronGrid API key; a replay does not call TronGrid
+	if cfg.TronGrid.APIKey == "" && cfg.Ingestion.ReplayPath == "" {
 		return fmt.Errorf("trongrid.api_key is required")
 	}
 
 	// Validate USDT contract address
-	if cfg.TronGrid.USDTContract == "" {
+	if cfg.TronGrid.USDTContract == "" && len(cfg.TronGrid.Contracts) == 0 {
 		return fmt.Errorf("trongrid.usdt_contract is required")
 	}
 
+	if cfg.TronGrid.RequestsPerSecond <= 0 {
+		return fmt.Errorf("trongrid.requests_per_second must be positive")
+	}
+
+	// Validate monitored contracts
+	symbols := make(map[string]bool)
+	for i, contract := range cfg.TronGrid.Contracts {
+		if contract.Address == "" {
+			return fmt.Errorf("trongrid.contracts[%d].address is required", i)
+		}
+		if contract.Symbol == "" {
+			return fmt.Errorf("trongrid.contracts[%d].symbol is required", i)
+		}
+		if contract.Decimals < 0 || contract.Decimals > 36 {
+			return fmt.Errorf("trongrid.contracts[%d].decimals must be between 0 and 36", i)
+		}
+		if symbols[contract.Symbol] {
+			return fmt.Errorf("trongrid.contracts[%d].symbol %s is duplicated", i, contract.Symbol)
+		}
+		symbols[contract.Symbol] = true
+	}
+
+	// Confirmations of a quiet token follow the head measured for lag
+	if cfg.TronGrid.ConfirmationDepth > 0 && cfg.TronGrid.LagInterval <= 0 {
+		return fmt.Errorf("trongrid.lag_interval must be positive when trongrid.confirmation_depth is set")
+	}
+
+	// Validate checkpoint store
+	switch cfg.TronGrid.CheckpointStore {
+	case "file":
+		if cfg.TronGrid.CheckpointPath == "" {
+			return fmt.Errorf("trongrid.checkpoint_path is required for the file checkpoint store")
+		}
+	case "postgres", "none":
+	default:
+		return fmt.Errorf("trongrid.checkpoint_store must be one of: file, postgres, none")
+	}
+
+	// Validate Ethereum ingestion
+	if cfg.Ethereum.Enabled {
+		if cfg.Ethereum.RPCURL == "" {
+			return fmt.Errorf("ethereum.rpc_url is required when ethereum is enabled")
+		}
+		if cfg.Ethereum.MaxBlockRange == 0 {
+			return fmt.Errorf("ethereum.max_block_range must be positive")
+		}
+		for i, contract := range cfg.Ethereum.Contracts {
+			if contract.Address == "" || contract.Symbol == "" {
+				return fmt.Errorf("ethereum.contracts[%d] requires address and symbol", i)
+			}
+		}
+		switch cfg.Ethereum.CheckpointStore {
+		case "file":
+			if cfg.Ethereum.CheckpointPath == "" {
+				return fmt.Errorf("ethereum.checkpoint_path is required for the file checkpoint store")
+			}
+		case "postgres", "none":
+		default:
+			return fmt.Errorf("ethereum.checkpoint_store must be one of: file, postgres, none")
+		}
+	}
+
+	// Validate overflow handling
+	switch cfg.Ingestion.OverflowStrategy {
+	case "block":
+		if cfg.Ingestion.BlockTimeout <= 0 {
+			return fmt.Errorf("ingestion.block_timeout must be positive")
+		}
+	case "spill":
+		if cfg.Ingestion.SpillDir == "" {
+			return fmt.Errorf("ingestion.spill_dir is required for the spill overflow strategy")
+		}
+	case "drop":
+	default:
+		return fmt.Errorf("ingestion.overflow_strategy must be one of: block, spill, drop")
+	}
+
+	if cfg.Ingestion.ReplaySpeed < 0 {
+		return fmt.Errorf("ingestion.replay_speed must not be negative")
+	}
+
+	// Validate Raphtory transport
+	if cfg.Raphtory.Transport != "rest" && cfg.Raphtory.Transport != "graphql" {
+		return fmt.Errorf("raphtory.transport must be rest or graphql, got %q", cfg.Raphtory.Transport)
+	}
+	if cfg.Raphtory.Transport == "graphql" && cfg.Raphtory.GraphName == "" {
+		return fmt.Errorf("raphtory.graph_name is required with the graphql transport")
+	}
+	if (cfg.Raphtory.TLSCertFile == "") != (cfg.Raphtory.TLSKeyFile == "") {
+		return fmt.Errorf("raphtory.tls_cert_file and raphtory.tls_key_file must be set together")
+	}
+
+	// Validate Raphtory batching
+	if cfg.Raphtory.BatchSize < 1 {
+		return fmt.Errorf("raphtory.batch_size must be at least 1")
+	}
+	if cfg.Raphtory.Workers < 1 {
+		return fmt.Errorf("raphtory.workers must be at least 1")
+	}
+	if cfg.Raphtory.QueueSize < 1 {
+		return fmt.Errorf("raphtory.queue_size must be at least 1")
+	}
+
+	// Validate sinks
+	switch cfg.Sinks.Output {
+	case "raphtory", "kafka", "both":
+	default:
+		return fmt.Errorf("sinks.output must be one of: raphtory, kafka, both")
+	}
+	if cfg.Sinks.UsesSink("kafka") {
+		if cfg.Sinks.Kafka.RestProxyURL == "" || cfg.Sinks.Kafka.Topic == "" {
+			return fmt.Errorf("sinks.kafka requires rest_proxy_url and topic")
+		}
+	}
+	if cfg.Sinks.Raphtory.MaxRetries < 0 || cfg.Sinks.Kafka.MaxRetries < 0 {
+		return fmt.Errorf("sinks max_retries must not be negative")
+	}
+
+	// Validate message bus
+	if cfg.Bus.Enabled && (cfg.Bus.URL == "" || cfg.Bus.Stream == "") {
+		return fmt.Errorf("bus requires url and stream when enabled")
+	}
+
+	// Validate raw event archival
+	if cfg.Archive.Enabled {
+		if err := validateArchiveBackend(cfg.Archive); err != nil {
+			return err
+		}
+		if cfg.Archive.MaxRetries < 0 {
+			return fmt.Errorf("archive.max_retries must not be negative")
+		}
+	}
+
+	// Validate logging
+	if cfg.Logging.MaxSizeMB < 1 {
+		return fmt.Errorf("logging.max_size_mb must be at least 1")
+	}
+	if cfg.Logging.MaxAge < 0 || cfg.Logging.MaxBackups < 0 {
+		return fmt.Errorf("logging.max_age and logging.max_backups must not be negative")
+	}
+	if cfg.Logging.SamplingInitial < 0 || cfg.Logging.SamplingThereafter < 0 {
+		return fmt.Errorf("logging sampling settings must not be negative")
+	}
+
+	// Validate tracing
+	if cfg.Monitoring.TracingEnabled {
+		if cfg.Monitoring.TracingEndpoint == "" {
+			return fmt.Errorf("monitoring.tracing_endpoint is required when tracing is enabled")
+		}
+		if cfg.Monitoring.TracingSampleRatio < 0 || cfg.Monitoring.TracingSampleRatio > 1 {
+			return fmt.Errorf("monitoring.tracing_sample_ratio must be between 0 and 1")
+		}
+	}
+
+	if cfg.Monitoring.DiagnosticsEnabled && cfg.Monitoring.DiagnosticsAddress == "" {
+		return fmt.Errorf("monitoring.diagnostics_address is required when diagnostics are enabled")
+	}
+
+	if cfg.Monitoring.SlowQueryThreshold < 0 || cfg.Monitoring.SlowRequestThreshold < 0 {
+		return fmt.Errorf("monitoring slow query and request thresholds must not be negative")
+	}
+
+	if cfg.Monitoring.StatusInterval <= 0 {
+		return fmt.Errorf("monitoring.status_interval must be positive")
+	}
+	if cfg.Monitoring.StatusStaleAfter <= cfg.Monitoring.StatusInterval {
+		return fmt.Errorf("monitoring.status_stale_after must be longer than monitoring.status_interval")
+	}
+
+	// Validate browser access
+	if len(cfg.Server.CORSAllowedMethods) == 0 {
+		return fmt.Errorf("server.cors_allowed_methods must not be empty")
+	}
+	if cfg.Server.CORSMaxAge < 0 || cfg.Server.HSTSMaxAge < 0 {
+		return fmt.Errorf("server.cors_max_age and server.hsts_max_age must not be negative")
+	}
+	if cfg.Server.SwaggerUIEnabled && cfg.Server.SwaggerUIAssetsURL == "" {
+		return fmt.Errorf("server.swagger_ui_assets_url is required when Swagger UI is enabled")
+	}
+	if cfg.Server.GraphQLMaxDepth < 0 || cfg.Server.GraphQLMaxResolves < 0 {
+		return fmt.Errorf("server.graphql_max_depth and server.graphql_max_resolves must not be negative")
+	}
+	if cfg.Server.WebSocketMaxConnections < 0 || cfg.Server.WebSocketMaxConnectionsPerUser < 0 {
+		return fmt.Errorf("server.websocket_max_connections and server.websocket_max_connections_per_user must not be negative")
+	}
+	if cfg.Server.WebSocketBroadcastWorkers < 0 {
+		return fmt.Errorf("server.websocket_broadcast_workers must not be negative")
+	}
+	for _, proxy := range cfg.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("server.trusted_proxies: %q is not an IP address or CIDR range", proxy)
+		}
+	}
+
+	// Validate rate limits
+	if cfg.RateLimit.Enabled {
+		switch cfg.RateLimit.Backend {
+		case "memory":
+		case "redis":
+			if cfg.RateLimit.RedisURL == "" {
+				return fmt.Errorf("rate_limit.redis_url is required for the redis backend")
+			}
+		default:
+			return fmt.Errorf("rate_limit.backend must be one of: memory, redis")
+		}
+		groups := []struct {
+			name string
+			rule RateLimitRule
+		}{
+			{"auth", cfg.RateLimit.Auth},
+			{"outliers", cfg.RateLimit.Outliers},
+			{"api", cfg.RateLimit.API},
+		}
+		for _, group := range groups {
+			rule := group.rule
+			if rule.PerIP < 0 || rule.PerIPBurst < 0 || rule.PerUser < 0 || rule.PerUserBurst < 0 {
+				return fmt.Errorf("rate_limit.%s limits must not be negative", group.name)
+			}
+		}
+	}
+
 	// Validate security keys
 	if cfg.Security.JWTSecret == "" {
 		return fmt.Errorf("security.jwt_secret is required")
@@ -220,10 +1281,79 @@ func validate(cfg *Config) error {
 	if cfg.Security.EncryptionKey == "" {
 		return fmt.Errorf("security.encryption_key is required")
 	}
+	for _, key := range cfg.Security.PreviousEncryptionKeys {
+		if key == "" {
+			return fmt.Errorf("security.previous_encryption_keys must not contain empty keys")
+		}
+	}
 	if cfg.Security.HMACKey == "" {
 		return fmt.Errorf("security.hmac_key is required")
 	}
 
+	if cfg.Security.TLSEnabled && (cfg.Security.TLSCertFile == "" || cfg.Security.TLSKeyFile == "") {
+		return fmt.Errorf("security.tls_cert_file and security.tls_key_file are required when tls_enabled is set")
+	}
+
+	if cfg.Security.PasswordMinLength < 1 {
+		return fmt.Errorf("security.password_min_length must be at least 1")
+	}
+	// bcrypt accepts costs from 4 to 31
+	if cfg.Security.PasswordHashCost < 4 || cfg.Security.PasswordHashCost > 31 {
+		return fmt.Errorf("security.password_hash_cost must be between 4 and 31")
+	}
+	switch cfg.Security.PasswordAlgorithm {
+	case "bcrypt":
+	case "argon2id":
+		if cfg.Security.PasswordArgon2Parallelism < 1 || cfg.Security.PasswordArgon2Parallelism > 255 {
+			return fmt.Errorf("security.password_argon2_parallelism must be between 1 and 255")
+		}
+		if cfg.Security.PasswordArgon2Iterations < 1 {
+			return fmt.Errorf("security.password_argon2_iterations must be at least 1")
+		}
+		// argon2 needs 8 KiB per thread
+		if cfg.Security.PasswordArgon2Memory < 8*cfg.Security.PasswordArgon2Parallelism {
+			return fmt.Errorf("security.password_argon2_memory must be at least 8 KiB per thread")
+		}
+	default:
+		return fmt.Errorf("security.password_algorithm must be one of: bcrypt, argon2id")
+	}
+	if cfg.Security.PasswordResetExpiry <= 0 {
+		return fmt.Errorf("security.password_reset_expiry must be positive")
+	}
+	if cfg.Security.LoginMaxFailures < 0 || cfg.Security.LoginIPMaxFailures < 0 {
+		return fmt.Errorf("security login failure limits must not be negative")
+	}
+	if cfg.Security.LoginMaxFailures > 0 && cfg.Security.LoginLockout <= 0 {
+		return fmt.Errorf("security.login_lockout must be positive when login_max_failures is set")
+	}
+	if cfg.Security.LoginIPMaxFailures > 0 && cfg.Security.LoginIPWindow <= 0 {
+		return fmt.Errorf("security.login_ip_window must be positive when login_ip_max_failures is set")
+	}
+	if cfg.Security.APIKeyRateLimit < 0 {
+		return fmt.Errorf("security.api_key_rate_limit must not be negative")
+	}
+	if cfg.Security.RoleCacheTTL <= 0 {
+		return fmt.Errorf("security.role_cache_ttl must be positive")
+	}
+	if cfg.Security.AuditAnchorInterval <= 0 {
+		return fmt.Errorf("security.audit_anchor_interval must be positive")
+	}
+	if cfg.Security.AuditRetentionDays < 0 {
+		return fmt.Errorf("security.audit_retention_days must not be negative")
+	}
+	if cfg.Security.AuditRetentionDays > 0 {
+		// Archived audit logs go to the archive backend
+		if err := validateArchiveBackend(cfg.Archive); err != nil {
+			return fmt.Errorf("security.audit_retention_days needs an archive backend: %w", err)
+		}
+		if cfg.Security.AuditArchiveInterval <= 0 {
+			return fmt.Errorf("security.audit_archive_interval must be positive")
+		}
+	}
+	if cfg.Security.IdempotencyTTL <= 0 {
+		return fmt.Errorf("security.idempotency_ttl must be positive")
+	}
+
 	// Validate database password
 	if cfg.Database.Password == "" {
 		return fmt.Errorf("database.password is required")
@@ -236,6 +1366,420 @@ func validate(cfg *Config) error {
 	if cfg.Detection.IQRMultiplier <= 0 {
 		return fmt.Errorf("detection.iqr_multiplier must be positive")
 	}
+	if cfg.Detection.DBSCANEnabled {
+		if cfg.Detection.DBSCANEpsilon <= 0 {
+			return fmt.Errorf("detection.dbscan_epsilon must be positive")
+		}
+		if cfg.Detection.DBSCANMinPoints < 1 {
+			return fmt.Errorf("detection.dbscan_min_points must be at least 1")
+		}
+	}
+	if cfg.Detection.VelocityWindow <= 0 {
+		return fmt.Errorf("detection.velocity_window must be positive")
+	}
+	if cfg.Detection.ClusterWindow <= 0 {
+		return fmt.Errorf("detection.cluster_window must be positive")
+	}
+	if cfg.Detection.ClusterMinDensity < 0 || cfg.Detection.ClusterMinDensity > 1 {
+		return fmt.Errorf("detection.cluster_min_density must be between 0 and 1")
+	}
+	if cfg.Detection.FanWindow <= 0 {
+		return fmt.Errorf("detection.fan_window must be positive")
+	}
+	if cfg.Detection.FallbackGraphEnabled && cfg.Detection.FallbackGraphCapacity < 1 {
+		return fmt.Errorf("detection.fallback_graph_capacity must be at least 1")
+	}
+	if cfg.Detection.WatchlistEnabled && cfg.Detection.WatchlistRefreshInterval <= 0 {
+		return fmt.Errorf("detection.watchlist_refresh_interval must be positive")
+	}
+	if cfg.Detection.ConfigRefreshInterval <= 0 {
+		return fmt.Errorf("detection.config_refresh_interval must be positive")
+	}
+	if cfg.Detection.LabelsEnabled && cfg.Detection.LabelsRefreshInterval <= 0 {
+		return fmt.Errorf("detection.labels_refresh_interval must be positive")
+	}
+	if cfg.Detection.OutlierArchiveAfterDays < 0 {
+		return fmt.Errorf("detection.outlier_archive_after_days must not be negative")
+	}
+	if cfg.Detection.OutlierArchiveAfterDays > 0 {
+		if cfg.Detection.OutlierArchiveInterval <= 0 {
+			return fmt.Errorf("detection.outlier_archive_interval must be positive")
+		}
+		if len(cfg.Detection.OutlierArchiveSeverities) == 0 {
+			return fmt.Errorf("detection.outlier_archive_severities must not be empty")
+		}
+		for _, severity := range cfg.Detection.OutlierArchiveSeverities {
+			if models.Severity(severity).RiskScore() == 0 {
+				return fmt.Errorf("detection.outlier_archive_severities must be low, medium, high or critical, not %q", severity)
+			}
+		}
+	}
+	for _, categories := range [][]string{cfg.Detection.LabelExemptCategories, cfg.Detection.LabelEscalateCategories} {
+		for _, category := range categories {
+			if !models.LabelCategory(category).Valid() {
+				return fmt.Errorf("detection label category %q is not one of the known categories", category)
+			}
+		}
+	}
+
+	// Validate sanctions screening
+	if cfg.Sanctions.Enabled {
+		if err := validateSanctions(cfg.Sanctions); err != nil {
+			return err
+		}
+	}
+
+	// Validate chain-analytics enrichment
+	if cfg.Enrichment.Enabled {
+		if err := validateEnrichment(cfg.Enrichment); err != nil {
+			return err
+		}
+	}
+
+	// Validate notifications
+	if cfg.Notify.Enabled {
+		if err := validateNotify(cfg.Notify); err != nil {
+			return err
+		}
+	}
 
+	// Validate webhooks
+	if cfg.Webhooks.Enabled {
+		if err := validateWebhooks(cfg.Webhooks); err != nil {
+			return err
+		}
+	}
+
+	// Validate reports
+	if cfg.Reports.Daily.Enabled {
+		if err := validateDailyReport(cfg.Reports.Daily, cfg.Notify.Email); err != nil {
+			return err
+		}
+	}
+
+	// Validate SIEM export
+	if cfg.SIEM.Enabled {
+		if err := validateSIEM(cfg.SIEM); err != nil {
+			return err
+		}
+	}
+
+	// Validate feature flags
+	if cfg.Features.Environment == "" {
+		return fmt.Errorf("features.environment is required")
+	}
+	if cfg.Features.RefreshInterval <= 0 {
+		return fmt.Errorf("features.refresh_interval must be positive")
+	}
+
+	return nil
+}
+
+// validateSanctions checks the sanctions lists when screening is enabled
+func validateSanctions(cfg SanctionsConfig) error {
+	if cfg.RefreshInterval <= 0 {
+		return fmt.Errorf("sanctions.refresh_interval must be positive")
+	}
+	if cfg.OFACEnabled && cfg.OFACURL == "" {
+		return fmt.Errorf("sanctions.ofac_url is required when ofac_enabled is set")
+	}
+	if !cfg.OFACEnabled && len(cfg.CSVLists) == 0 {
+		return fmt.Errorf("sanctions requires ofac_enabled or at least one csv_lists entry when enabled")
+	}
+
+	names := map[string]bool{"ofac_sdn": cfg.OFACEnabled}
+	for _, list := range cfg.CSVLists {
+		if list.Name == "" || list.Source == "" {
+			return fmt.Errorf("sanctions.csv_lists entries require name and source")
+		}
+		if names[list.Name] {
+			return fmt.Errorf("sanctions list name %q is used more than once", list.Name)
+		}
+		names[list.Name] = true
+	}
+	return nil
+}
+
+// validateEnrichment checks the chain-analytics enrichment settings when it
+// is enabled
+func validateEnrichment(cfg EnrichmentConfig) error {
+	if cfg.Provider == "" {
+		return fmt.Errorf("enrichment.provider is required")
+	}
+	if !strings.HasPrefix(cfg.URL, "https://") && !strings.HasPrefix(cfg.URL, "http://") {
+		return fmt.Errorf("enrichment.url must be an http or https URL")
+	}
+	if !strings.Contains(cfg.URL, "{address}") && !strings.Contains(cfg.Body, "{address}") {
+		return fmt.Errorf("enrichment.url or enrichment.body must contain {address}")
+	}
+	if cfg.APIKey == "" {
+		return fmt.Errorf("enrichment.api_key is required")
+	}
+	if cfg.Timeout <= 0 || cfg.CacheTTL <= 0 {
+		return fmt.Errorf("enrichment.timeout and enrichment.cache_ttl must be positive")
+	}
+	if cfg.Concurrency <= 0 || cfg.MaxAddresses <= 0 {
+		return fmt.Errorf("enrichment.concurrency and enrichment.max_addresses must be positive")
+	}
+	return nil
+}
+
+// validateArchiveBackend checks the archive store settings, which raw event
+// archival and audit log retention share
+func validateArchiveBackend(cfg ArchiveConfig) error {
+	switch cfg.Backend {
+	case "s3", "gcs":
+		if cfg.Bucket == "" {
+			return fmt.Errorf("archive.bucket is required for the %s backend", cfg.Backend)
+		}
+	case "file":
+		if cfg.Directory == "" {
+			return fmt.Errorf("archive.directory is required for the file backend")
+		}
+	default:
+		return fmt.Errorf("archive.backend must be one of: s3, gcs, file")
+	}
+	return nil
+}
+
+// validateNotify checks the alert rules and delivery settings when
+// notifications are enabled. Rule channels are checked against the
+// configured notifiers when the API starts.
+func validateNotify(cfg NotifyConfig) error {
+	if len(cfg.Rules) == 0 {
+		return fmt.Errorf("notify.rules must not be empty when notifications are enabled")
+	}
+	if cfg.DedupWindow < 0 {
+		return fmt.Errorf("notify.dedup_window must not be negative")
+	}
+	if cfg.RatePerMinute < 0 || cfg.RateBurst < 0 {
+		return fmt.Errorf("notify.rate_per_minute and notify.rate_burst must not be negative")
+	}
+	if cfg.MaxRetries < 0 {
+		return fmt.Errorf("notify.max_retries must not be negative")
+	}
+	if cfg.QueueSize <= 0 {
+		return fmt.Errorf("notify.queue_size must be positive")
+	}
+
+	names := make(map[string]bool)
+	for _, rule := range cfg.Rules {
+		if rule.Name == "" || len(rule.Channels) == 0 {
+			return fmt.Errorf("notify.rules entries require name and channels")
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("notify rule name %q is used more than once", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.MinSeverity != "" && !models.Severity(rule.MinSeverity).Valid() {
+			return fmt.Errorf("notify rule %q: min_severity must be low, medium, high or critical, not %q", rule.Name, rule.MinSeverity)
+		}
+	}
+
+	if cfg.Email.Enabled {
+		if err := validateNotifyEmail(cfg.Email); err != nil {
+			return err
+		}
+	}
+	if cfg.PagerDuty.Enabled {
+		if err := validateNotifyPagerDuty(cfg.PagerDuty); err != nil {
+			return err
+		}
+	}
+	if cfg.Opsgenie.Enabled {
+		if err := validateNotifyOpsgenie(cfg.Opsgenie); err != nil {
+			return err
+		}
+	}
+	if cfg.Telegram.Enabled {
+		if err := validateNotifyTelegram(cfg.Telegram); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateWebhooks checks the webhook delivery settings when webhooks are
+// enabled
+func validateWebhooks(cfg WebhooksConfig) error {
+	if cfg.MaxRetries < 0 {
+		return fmt.Errorf("webhooks.max_retries must not be negative")
+	}
+	if cfg.RetryDelay <= 0 || cfg.MaxRetryDelay < cfg.RetryDelay {
+		return fmt.Errorf("webhooks.retry_delay must be positive and no longer than webhooks.max_retry_delay")
+	}
+	if cfg.Timeout <= 0 {
+		return fmt.Errorf("webhooks.timeout must be positive")
+	}
+	if cfg.Workers <= 0 || cfg.QueueSize <= 0 {
+		return fmt.Errorf("webhooks.workers and webhooks.queue_size must be positive")
+	}
+	return nil
+}
+
+// validateSIEM checks the SIEM export settings when it is enabled
+func validateSIEM(cfg SIEMConfig) error {
+	switch cfg.Transport {
+	case "syslog":
+		if cfg.Address == "" {
+			return fmt.Errorf("siem.address is required for syslog")
+		}
+		if cfg.Network != "udp" && cfg.Network != "tcp" && cfg.Network != "tls" {
+			return fmt.Errorf("siem.network must be udp, tcp or tls, not %q", cfg.Network)
+		}
+		if cfg.Facility < 0 || cfg.Facility > 23 {
+			return fmt.Errorf("siem.facility must be between 0 and 23")
+		}
+	case "https":
+		if !strings.HasPrefix(cfg.URL, "https://") {
+			return fmt.Errorf("siem.url must be an https URL for the https transport")
+		}
+	default:
+		return fmt.Errorf("siem.transport must be syslog or https, not %q", cfg.Transport)
+	}
+	if cfg.Timeout <= 0 {
+		return fmt.Errorf("siem.timeout must be positive")
+	}
+	if cfg.MaxRetries < 0 {
+		return fmt.Errorf("siem.max_retries must not be negative")
+	}
+	if cfg.QueueSize <= 0 || cfg.BatchSize <= 0 {
+		return fmt.Errorf("siem.queue_size and siem.batch_size must be positive")
+	}
+	if !cfg.Outliers.Enabled && !cfg.Audit.Enabled {
+		return fmt.Errorf("siem.outliers or siem.audit must be enabled when SIEM export is enabled")
+	}
+	for name, events := range map[string]SIEMEventConfig{"outliers": cfg.Outliers, "audit": cfg.Audit} {
+		if events.Enabled && events.Format != "cef" && events.Format != "leef" && events.Format != "json" {
+			return fmt.Errorf("siem.%s.format must be cef, leef or json, not %q", name, events.Format)
+		}
+	}
+	if cfg.Outliers.MinSeverity != "" && !models.Severity(cfg.Outliers.MinSeverity).Valid() {
+		return fmt.Errorf("siem.outliers.min_severity must be low, medium, high or critical, not %q", cfg.Outliers.MinSeverity)
+	}
+	return nil
+}
+
+// validateDailyReport checks the daily digest's settings and that email
+// can send it
+func validateDailyReport(cfg DailyReportConfig, email NotifyEmailConfig) error {
+	if _, err := time.Parse("15:04", cfg.SendAt); err != nil {
+		return fmt.Errorf("reports.daily.send_at must be a UTC time of day as HH:MM, not %q", cfg.SendAt)
+	}
+	if len(cfg.Recipients) == 0 {
+		return fmt.Errorf("reports.daily.recipients is required when the daily report is enabled")
+	}
+	if cfg.CheckInterval <= 0 {
+		return fmt.Errorf("reports.daily.check_interval must be positive")
+	}
+	if cfg.MaxAttempts <= 0 {
+		return fmt.Errorf("reports.daily.max_attempts must be positive")
+	}
+	if email.Host == "" || email.From == "" {
+		return fmt.Errorf("notify.email.host and notify.email.from are required to send the daily report")
+	}
+	if email.Port <= 0 || email.Port > 65535 {
+		return fmt.Errorf("notify.email.port must be between 1 and 65535")
+	}
+	return nil
+}
+
+// validateNotifyEmail checks the email channel's settings
+func validateNotifyEmail(cfg NotifyEmailConfig) error {
+	if cfg.Host == "" || cfg.From == "" {
+		return fmt.Errorf("notify.email.host and notify.email.from are required when email is enabled")
+	}
+	if cfg.Port <= 0 || cfg.Port > 65535 {
+		return fmt.Errorf("notify.email.port must be between 1 and 65535")
+	}
+	if cfg.BatchWindow < 0 {
+		return fmt.Errorf("notify.email.batch_window must not be negative")
+	}
+	if cfg.ImmediateSeverity != "" && !models.Severity(cfg.ImmediateSeverity).Valid() {
+		return fmt.Errorf("notify.email.immediate_severity must be low, medium, high or critical, not %q", cfg.ImmediateSeverity)
+	}
+
+	hasRecipients := len(cfg.DefaultRecipients) > 0
+	for severity, recipients := range cfg.Recipients {
+		if !models.Severity(severity).Valid() {
+			return fmt.Errorf("notify.email.recipients key %q must be low, medium, high or critical", severity)
+		}
+		hasRecipients = hasRecipients || len(recipients) > 0
+	}
+	if !hasRecipients {
+		return fmt.Errorf("notify.email requires default_recipients or recipients when enabled")
+	}
+	return nil
+}
+
+// validateNotifyPagerDuty checks the pagerduty channel's settings
+func validateNotifyPagerDuty(cfg NotifyPagerDutyConfig) error {
+	if cfg.RoutingKey == "" {
+		return fmt.Errorf("notify.pagerduty.routing_key is required when pagerduty is enabled")
+	}
+	if cfg.MinSeverity != "" && !models.Severity(cfg.MinSeverity).Valid() {
+		return fmt.Errorf("notify.pagerduty.min_severity must be low, medium, high or critical, not %q", cfg.MinSeverity)
+	}
+	for severity := range cfg.RoutingKeys {
+		if !models.Severity(severity).Valid() {
+			return fmt.Errorf("notify.pagerduty.routing_keys key %q must be low, medium, high or critical", severity)
+		}
+	}
+	return nil
+}
+
+// validateNotifyOpsgenie checks the opsgenie channel's settings
+func validateNotifyOpsgenie(cfg NotifyOpsgenieConfig) error {
+	if cfg.APIKey == "" {
+		return fmt.Errorf("notify.opsgenie.api_key is required when opsgenie is enabled")
+	}
+	if cfg.MinSeverity != "" && !models.Severity(cfg.MinSeverity).Valid() {
+		return fmt.Errorf("notify.opsgenie.min_severity must be low, medium, high or critical, not %q", cfg.MinSeverity)
+	}
+	for severity, priority := range cfg.Priorities {
+		if !models.Severity(severity).Valid() {
+			return fmt.Errorf("notify.opsgenie.priorities key %q must be low, medium, high or critical", severity)
+		}
+		switch priority {
+		case "P1", "P2", "P3", "P4", "P5":
+		default:
+			return fmt.Errorf("notify.opsgenie.priorities values must be P1 to P5, not %q", priority)
+		}
+	}
+	for _, responder := range cfg.Responders {
+		switch responder.Type {
+		case "team", "user", "escalation", "schedule":
+		default:
+			return fmt.Errorf("notify.opsgenie.responders type must be team, user, escalation or schedule, not %q", responder.Type)
+		}
+		if responder.Name == "" {
+			return fmt.Errorf("notify.opsgenie.responders entries require a name")
+		}
+	}
+	return nil
+}
+
+// validateNotifyTelegram checks the telegram channel's settings
+func validateNotifyTelegram(cfg NotifyTelegramConfig) error {
+	if cfg.BotToken == "" {
+		return fmt.Errorf("notify.telegram.bot_token is required when telegram is enabled")
+	}
+	if len(cfg.Chats) == 0 {
+		return fmt.Errorf("notify.telegram.chats must not be empty when telegram is enabled")
+	}
+	for _, chat := range cfg.Chats {
+		if chat.ID == "" {
+			return fmt.Errorf("notify.telegram.chats entries require an id")
+		}
+		if chat.MinSeverity != "" && !models.Severity(chat.MinSeverity).Valid() {
+			return fmt.Errorf("notify.telegram chat %s: min_severity must be low, medium, high or critical, not %q", chat.ID, chat.MinSeverity)
+		}
+	}
+	if cfg.ChatRatePerMinute <= 0 || cfg.RatePerMinute <= 0 {
+		return fmt.Errorf("notify.telegram.chat_rate_per_minute and notify.telegram.rate_per_minute must be positive")
+	}
+	if cfg.ChatRateBurst < 0 || cfg.RateBurst < 0 {
+		return fmt.Errorf("notify.telegram.chat_rate_burst and notify.telegram.rate_burst must not be negative")
+	}
 	return nil
 }
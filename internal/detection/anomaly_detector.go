@@ -2,37 +2,94 @@ package detection
 
 import (
 	"context"
+	"errors"
+	"runtime"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/mikedewar/stablerisk/internal/errs"
+	"github.com/mikedewar/stablerisk/internal/features"
 	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/internal/tracing"
 	"github.com/mikedewar/stablerisk/pkg/models"
 	"go.uber.org/zap"
 )
 
 // AnomalyDetector coordinates all anomaly detection methods
 type AnomalyDetector struct {
-	zscoreDetector  *ZScoreDetector
-	iqrDetector     *IQRDetector
-	patternDetector *PatternDetector
-	raphtoryClient  *graph.RaphtoryClient
-	logger          *zap.Logger
+	config         AnomalyDetectorConfig // As last applied
+	detectors      *detectorSet          // Replaced whole by ApplySettings
+	raphtoryClient *graph.RaphtoryClient
+	runRecorder    RunRecorder        // nil when run history is not persisted
+	labels         *AddressLabels     // nil when outliers are not labeled
+	enricher       OutlierEnricher    // nil when outliers are not enriched
+	fallback       *graph.MemoryGraph // Read when Raphtory is unavailable; nil disables
+	flags          *features.Flags    // nil leaves every feature at its default
+	logger         *zap.Logger
+
+	// Sharding
+	maxTransactions int // Transactions fetched per cycle
+	shards          int // Partitions scored in parallel
+	workers         int // Goroutines scoring shards
+	shardTimings    []ShardTiming
+
+	ignoreUnconfirmed bool // Leave unconfirmed transfers out of scoring
+	tagNodes          bool // Tag flagged addresses with their risk in the graph
 
 	interval time.Duration
 	running  bool
 	stopChan chan struct{}
 	mu       sync.RWMutex
 
+	// Scheduled cycles, for status reports
+	cycleInProgress bool
+	lastCycle       *models.DetectionRun
+
 	// Channels
 	outlierChan chan models.Outlier
+	publisher   OutlierPublisher // Replaces outlierChan when set
+}
+
+// OutlierPublisher delivers detected outliers to other services, e.g. over
+// the message bus
+type OutlierPublisher interface {
+	PublishOutlier(ctx context.Context, outlier models.Outlier) error
+}
+
+// OutlierEnricher adds outside context to detected outliers before they
+// are published, e.g. from chain-analytics services
+type OutlierEnricher interface {
+	Enrich(ctx context.Context, outliers []models.Outlier) []models.Outlier
 }
 
 // AnomalyDetectorConfig holds configuration for anomaly detector
 type AnomalyDetectorConfig struct {
 	Interval              time.Duration
+	MaxTransactions       int // Defaults to 100,000
+	Shards                int // Defaults to 16
+	Workers               int // Defaults to GOMAXPROCS
 	ZScoreConfig          ZScoreConfig
 	IQRConfig             IQRConfig
+	DBSCANEnabled         bool
+	DBSCANConfig          DBSCANConfig
 	PatternDetectorConfig PatternDetectorConfig
+	IgnoreUnconfirmed     bool // Leave transfers not yet at the confirmation depth out of detection
+	TagNodes              bool // Tag flagged addresses with their risk in the graph
+	// Disabled are the detectors not run, by the outlier type they raise.
+	// DBSCAN also needs DBSCANEnabled.
+	Disabled map[models.OutlierType]bool
+}
+
+// detectorSet is the detectors a cycle runs. ApplySettings replaces the set
+// rather than changing it, so a running cycle keeps the settings it started
+// with.
+type detectorSet struct {
+	zscore  *ZScoreDetector // nil when disabled
+	iqr     *IQRDetector    // nil when disabled
+	dbscan  *DBSCANDetector // nil when disabled
+	pattern *PatternDetector
 }
 
 // NewAnomalyDetector creates a new anomaly detector
@@ -41,17 +98,78 @@ func NewAnomalyDetector(config AnomalyDetectorConfig, raphtoryClient *graph.Raph
 		logger = zap.NewNop()
 	}
 
-	return &AnomalyDetector{
-		zscoreDetector:  NewZScoreDetector(config.ZScoreConfig, logger),
-		iqrDetector:     NewIQRDetector(config.IQRConfig, logger),
-		patternDetector: NewPatternDetector(config.PatternDetectorConfig, raphtoryClient, logger),
-		raphtoryClient:  raphtoryClient,
-		logger:          logger,
-		interval:        config.Interval,
-		running:         false,
-		stopChan:        make(chan struct{}),
-		outlierChan:     make(chan models.Outlier, 100),
+	if config.MaxTransactions <= 0 {
+		config.MaxTransactions = 100000
+	}
+	if config.Shards <= 0 {
+		config.Shards = 16
+	}
+	if config.Workers <= 0 {
+		config.Workers = runtime.GOMAXPROCS(0)
+	}
+
+	d := &AnomalyDetector{
+		config:            config,
+		raphtoryClient:    raphtoryClient,
+		logger:            logger,
+		interval:          config.Interval,
+		maxTransactions:   config.MaxTransactions,
+		shards:            config.Shards,
+		workers:           config.Workers,
+		ignoreUnconfirmed: config.IgnoreUnconfirmed,
+		tagNodes:          config.TagNodes,
+		running:           false,
+		stopChan:          make(chan struct{}),
+		outlierChan:       make(chan models.Outlier, 100),
+	}
+	d.detectors = d.newDetectorSet(config)
+	return d
+}
+
+// newDetectorSet creates the detectors config enables
+func (d *AnomalyDetector) newDetectorSet(config AnomalyDetectorConfig) *detectorSet {
+	patternConfig := config.PatternDetectorConfig
+	patternConfig.Disabled = config.Disabled
+
+	set := &detectorSet{
+		pattern: NewPatternDetector(patternConfig, d.raphtoryClient, d.logger),
+	}
+	if !config.Disabled[models.OutlierTypeZScore] {
+		set.zscore = NewZScoreDetector(config.ZScoreConfig, d.logger)
+	}
+	if !config.Disabled[models.OutlierTypeIQR] {
+		set.iqr = NewIQRDetector(config.IQRConfig, d.logger)
+	}
+	if config.DBSCANEnabled && !config.Disabled[models.OutlierTypeDBSCAN] {
+		set.dbscan = NewDBSCANDetector(config.DBSCANConfig, d.logger)
+	}
+	if d.fallback != nil {
+		set.pattern.SetFallback(d.fallback)
+	}
+	return set
+}
+
+// currentDetectors returns the detectors a cycle starting now runs,
+// leaving out those whose feature flag is off
+func (d *AnomalyDetector) currentDetectors() *detectorSet {
+	d.mu.RLock()
+	detectors, flags := d.detectors, d.flags
+	d.mu.RUnlock()
+
+	if detectors.dbscan != nil && !flags.Enabled(features.DBSCANDetector) {
+		gated := *detectors
+		gated.dbscan = nil
+		return &gated
 	}
+	return detectors
+}
+
+// featureEnabled reports whether the named feature flag is on
+func (d *AnomalyDetector) featureEnabled(name string) bool {
+	d.mu.RLock()
+	flags := d.flags
+	d.mu.RUnlock()
+	return flags.Enabled(name)
 }
 
 // Start starts the anomaly detection loop
@@ -93,6 +211,54 @@ func (d *AnomalyDetector) IsRunning() bool {
 	return d.running
 }
 
+// SetRunRecorder sets where detection run history is persisted
+func (d *AnomalyDetector) SetRunRecorder(recorder RunRecorder) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.runRecorder = recorder
+}
+
+// SetAddressLabels labels detected outliers with the known entities behind
+// their addresses, dropping or escalating them by entity category
+func (d *AnomalyDetector) SetAddressLabels(labels *AddressLabels) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.labels = labels
+}
+
+// SetEnricher enriches detected outliers with enricher after they are
+// labeled
+func (d *AnomalyDetector) SetEnricher(enricher OutlierEnricher) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.enricher = enricher
+}
+
+// SetFeatureFlags gates experimental detectors and modes behind flags,
+// checked at the start of each cycle
+func (d *AnomalyDetector) SetFeatureFlags(flags *features.Flags) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.flags = flags
+}
+
+// SetOutlierPublisher publishes outliers through publisher instead of the
+// Outliers channel
+func (d *AnomalyDetector) SetOutlierPublisher(publisher OutlierPublisher) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.publisher = publisher
+}
+
+// SetFallbackGraph sets an in-memory graph of recent transactions that
+// detection reads while Raphtory is unavailable
+func (d *AnomalyDetector) SetFallbackGraph(fallback *graph.MemoryGraph) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.fallback = fallback
+	d.detectors.pattern.SetFallback(fallback)
+}
+
 // Outliers returns the outlier channel
 func (d *AnomalyDetector) Outliers() <-chan models.Outlier {
 	return d.outlierChan
@@ -125,18 +291,32 @@ func (d *AnomalyDetector) runDetection(ctx context.Context) {
 	d.logger.Info("Running anomaly detection cycle")
 	startTime := time.Now()
 
+	ctx, span := tracing.Start(ctx, "detection.cycle",
+		tracing.WithAttributes(tracing.String("trigger", string(models.DetectionRunScheduled))))
+	defer span.End()
+
 	// Get recent transactions from Raphtory
-	endTime := time.Now().Unix()
-	startTimeQuery := time.Now().Add(-d.interval * 2).Unix() // Look back 2 intervals
+	windowEnd := time.Now()
+	windowStart := windowEnd.Add(-d.interval * 2) // Look back 2 intervals
+
+	detectors := d.currentDetectors()
+	run := d.startRun(detectors, models.DetectionRunScheduled, "", windowStart, windowEnd)
 
-	transactions, err := d.raphtoryClient.GetTransactionsInWindow(ctx, startTimeQuery, endTime, 10000)
+	transactions, err := d.fetchTransactions(ctx, windowStart, windowEnd)
+	err = classifyRunError(err)
 	if err != nil {
 		d.logger.Error("Failed to get transactions from Raphtory", zap.Error(err))
+		span.RecordError(err)
+		d.finishRun(run, 0, 0, err)
 		return
 	}
+	if d.ignoreUnconfirmed {
+		transactions = ConfirmedTransactions(transactions)
+	}
 
 	if len(transactions) == 0 {
 		d.logger.Debug("No transactions in window, skipping detection")
+		d.finishRun(run, 0, 0, nil)
 		return
 	}
 
@@ -147,29 +327,12 @@ func (d *AnomalyDetector) runDetection(ctx context.Context) {
 	var wg sync.WaitGroup
 	outliersLock := sync.Mutex{}
 
-	// Run Z-score detection
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		outliers, err := d.zscoreDetector.Detect(transactions)
-		if err != nil {
-			d.logger.Error("Z-score detection failed", zap.Error(err))
-			return
-		}
-		outliersLock.Lock()
-		allOutliers = append(allOutliers, outliers...)
-		outliersLock.Unlock()
-	}()
-
-	// Run IQR detection
+	// Run statistical and clustering detection over the transactions
+	streaming := d.featureEnabled(features.IQRStreaming)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		outliers, err := d.iqrDetector.Detect(transactions)
-		if err != nil {
-			d.logger.Error("IQR detection failed", zap.Error(err))
-			return
-		}
+		outliers := d.detectTransactions(ctx, detectors, transactions, streaming)
 		outliersLock.Lock()
 		allOutliers = append(allOutliers, outliers...)
 		outliersLock.Unlock()
@@ -179,7 +342,7 @@ func (d *AnomalyDetector) runDetection(ctx context.Context) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		outliers, err := d.patternDetector.DetectAll(ctx)
+		outliers, err := d.detectPatterns(ctx, detectors)
 		if err != nil {
 			d.logger.Error("Pattern detection failed", zap.Error(err))
 			return
@@ -193,10 +356,16 @@ func (d *AnomalyDetector) runDetection(ctx context.Context) {
 	wg.Wait()
 
 	// Deduplicate outliers (same transaction detected by multiple methods)
-	deduped := d.deduplicateOutliers(allOutliers)
+	deduped := d.enrich(ctx, d.applyLabels(d.deduplicateOutliers(allOutliers)))
 
 	// Publish outliers
-	d.publishOutliers(deduped)
+	countOutliers(deduped)
+	d.publishOutliers(ctx, deduped)
+	d.tagRisk(ctx, deduped)
+	d.finishRun(run, len(transactions), len(deduped), nil)
+	span.SetAttributes(
+		tracing.Int("transactions", len(transactions)),
+		tracing.Int("outliers", len(deduped)))
 
 	duration := time.Since(startTime)
 	d.logger.Info("Detection cycle completed",
@@ -205,6 +374,123 @@ func (d *AnomalyDetector) runDetection(ctx context.Context) {
 		zap.Duration("duration", duration))
 }
 
+// detectTransactions runs the detectors that work on the fetched transactions
+// once per token, since amounts of different tokens are not comparable, and
+// publishes the shard timings of every token together
+func (d *AnomalyDetector) detectTransactions(ctx context.Context, detectors *detectorSet, transactions []models.Transaction, streaming bool) []models.Outlier {
+	ctx, span := tracing.Start(ctx, "detection.statistical",
+		tracing.WithAttributes(tracing.Int("transactions", len(transactions))))
+	defer span.End()
+
+	var outliers []models.Outlier
+	var timings []ShardTiming
+	for _, group := range groupByToken(transactions) {
+		tokenOutliers, tokenTimings := d.detectToken(ctx, detectors, group.token, group.transactions, streaming)
+		outliers = append(outliers, tokenOutliers...)
+		timings = append(timings, tokenTimings...)
+	}
+
+	d.mu.Lock()
+	d.shardTimings = timings
+	d.mu.Unlock()
+
+	return outliers
+}
+
+// tokenTransactions are the transactions of one token
+type tokenTransactions struct {
+	token        string
+	transactions []models.Transaction
+}
+
+// groupByToken splits transactions by token symbol, ignoring case, in the
+// order each token first appears
+func groupByToken(transactions []models.Transaction) []tokenTransactions {
+	index := make(map[string]int)
+	var groups []tokenTransactions
+	for _, tx := range transactions {
+		token := strings.ToUpper(tx.Token)
+		i, ok := index[token]
+		if !ok {
+			i = len(groups)
+			index[token] = i
+			groups = append(groups, tokenTransactions{token: token})
+		}
+		groups[i].transactions = append(groups[i].transactions, tx)
+	}
+	return groups
+}
+
+// detectToken runs sharded statistical scoring over one token's transactions
+// alongside DBSCAN clustering, which needs every address in the window and
+// so runs over the whole set
+func (d *AnomalyDetector) detectToken(ctx context.Context, detectors *detectorSet, token string, transactions []models.Transaction, streaming bool) ([]models.Outlier, []ShardTiming) {
+	var dbscanOutliers []models.Outlier
+	var wg sync.WaitGroup
+
+	if detectors.dbscan != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outliers, err := detectors.dbscan.Detect(transactions)
+			if err != nil {
+				errs.Record(errComponent, errs.Wrap(ErrDetectorFailed, err))
+				d.logger.Error("DBSCAN detection failed", zap.Error(err))
+				return
+			}
+			dbscanOutliers = outliers
+		}()
+	}
+
+	outliers, timings := d.detectStatistical(ctx, detectors, token, transactions, streaming)
+	wg.Wait()
+
+	return append(outliers, dbscanOutliers...), timings
+}
+
+// detectPatterns runs graph pattern detection in its own span
+func (d *AnomalyDetector) detectPatterns(ctx context.Context, detectors *detectorSet) ([]models.Outlier, error) {
+	ctx, span := tracing.Start(ctx, "detection.patterns")
+	defer span.End()
+
+	outliers, err := detectors.pattern.DetectAll(ctx)
+	span.RecordError(err)
+	span.SetAttributes(tracing.Int("outliers", len(outliers)))
+	return outliers, err
+}
+
+// fetchTransactions reads the window's transactions from Raphtory, or from
+// the fallback graph when Raphtory is unavailable and one is set
+func (d *AnomalyDetector) fetchTransactions(ctx context.Context, start, end time.Time) ([]models.Transaction, error) {
+	transactions, err := d.raphtoryClient.GetTransactionsInWindow(ctx, start.Unix(), end.Unix(), d.maxTransactions)
+
+	d.mu.RLock()
+	fallback := d.fallback
+	d.mu.RUnlock()
+
+	if err == nil || fallback == nil || !errors.Is(err, graph.ErrRaphtoryUnavailable) {
+		return transactions, err
+	}
+
+	d.logger.Warn("Raphtory unavailable, reading transactions from the in-memory graph",
+		zap.Error(err),
+		zap.Int("transactions", fallback.Len()))
+	metrics.DetectionGraphFallback.WithLabelValues().Set(1)
+	return fallback.GetTransactionsInWindow(ctx, start.Unix(), end.Unix(), d.maxTransactions)
+}
+
+// ConfirmedTransactions filters out transactions that have not yet reached
+// the confirmation depth. The slice is filtered in place.
+func ConfirmedTransactions(transactions []models.Transaction) []models.Transaction {
+	confirmed := transactions[:0]
+	for _, tx := range transactions {
+		if tx.Confirmed {
+			confirmed = append(confirmed, tx)
+		}
+	}
+	return confirmed
+}
+
 // deduplicateOutliers removes duplicate outliers
 func (d *AnomalyDetector) deduplicateOutliers(outliers []models.Outlier) []models.Outlier {
 	// Use map to track unique outliers by transaction hash
@@ -259,8 +545,54 @@ func (d *AnomalyDetector) compareSeverity(s1, s2 models.Severity) int {
 	return severityValue[s1] - severityValue[s2]
 }
 
-// publishOutliers sends outliers to the channel
-func (d *AnomalyDetector) publishOutliers(outliers []models.Outlier) {
+// applyLabels labels outliers when address labels are set
+func (d *AnomalyDetector) applyLabels(outliers []models.Outlier) []models.Outlier {
+	d.mu.RLock()
+	labels := d.labels
+	d.mu.RUnlock()
+
+	if labels == nil {
+		return outliers
+	}
+	return labels.Apply(outliers)
+}
+
+// enrich enriches outliers when an enricher is set
+func (d *AnomalyDetector) enrich(ctx context.Context, outliers []models.Outlier) []models.Outlier {
+	d.mu.RLock()
+	enricher := d.enricher
+	d.mu.RUnlock()
+
+	if enricher == nil || len(outliers) == 0 {
+		return outliers
+	}
+	ctx, span := tracing.Start(ctx, "detection.enrich",
+		tracing.WithAttributes(tracing.Int("outliers", len(outliers))))
+	defer span.End()
+	return enricher.Enrich(ctx, outliers)
+}
+
+// publishOutliers sends outliers to the publisher, or to the channel if none is set
+func (d *AnomalyDetector) publishOutliers(ctx context.Context, outliers []models.Outlier) {
+	d.mu.RLock()
+	publisher := d.publisher
+	d.mu.RUnlock()
+
+	ctx, span := tracing.Start(ctx, "detection.publish",
+		tracing.WithAttributes(tracing.Int("outliers", len(outliers))))
+	defer span.End()
+
+	if publisher != nil {
+		for _, outlier := range outliers {
+			if err := publisher.PublishOutlier(ctx, outlier); err != nil {
+				d.logger.Error("Failed to publish outlier",
+					zap.Error(err),
+					zap.String("id", outlier.ID))
+			}
+		}
+		return
+	}
+
 	for _, outlier := range outliers {
 		select {
 		case d.outlierChan <- outlier:
@@ -275,47 +607,141 @@ func (d *AnomalyDetector) publishOutliers(outliers []models.Outlier) {
 	}
 }
 
+// tagRisk tags each flagged address's graph node with its most severe
+// outlier so graph queries can filter on risk. Failures are only logged.
+func (d *AnomalyDetector) tagRisk(ctx context.Context, outliers []models.Outlier) {
+	if !d.tagNodes || len(outliers) == 0 {
+		return
+	}
+
+	worst := make(map[string]models.Severity)
+	for _, outlier := range outliers {
+		if outlier.Address == "" {
+			continue
+		}
+		if outlier.Severity.RiskScore() > worst[outlier.Address].RiskScore() {
+			worst[outlier.Address] = outlier.Severity
+		}
+	}
+
+	now := time.Now().Unix()
+	for address, severity := range worst {
+		err := d.raphtoryClient.SetNodeProperties(ctx, address, map[string]any{
+			graph.PropertyRiskScore:    severity.RiskScore(),
+			graph.PropertyRiskSeverity: string(severity),
+			graph.PropertyRiskAt:       now,
+		})
+		if err != nil {
+			d.logger.Warn("Failed to tag address risk in graph",
+				zap.Error(err),
+				zap.String("address", address))
+			// The rest would fail the same way
+			if errors.Is(err, graph.ErrRaphtoryUnavailable) {
+				return
+			}
+		}
+	}
+}
+
+// DetectOptions narrows an on-demand detection run
+type DetectOptions struct {
+	StartTime time.Time `json:"start_time,omitempty"` // Defaults to 24 hours before EndTime
+	EndTime   time.Time `json:"end_time,omitempty"`   // Defaults to now
+	Addresses []string  `json:"addresses,omitempty"`  // Only analyse transactions touching these addresses
+	Token     string    `json:"token,omitempty"`      // Only analyse transfers of this token symbol
+
+	TriggeredBy string `json:"-"` // User recorded in the run history
+}
+
 // DetectOnce runs detection once and returns outliers
-func (d *AnomalyDetector) DetectOnce(ctx context.Context) ([]models.Outlier, error) {
-	// Get recent transactions
-	endTime := time.Now().Unix()
-	startTime := time.Now().Add(-24 * time.Hour).Unix()
+func (d *AnomalyDetector) DetectOnce(ctx context.Context, opts DetectOptions) ([]models.Outlier, error) {
+	// Resolve time range
+	end := opts.EndTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+	start := opts.StartTime
+	if start.IsZero() {
+		start = end.Add(-24 * time.Hour)
+	}
+
+	ctx, span := tracing.Start(ctx, "detection.cycle",
+		tracing.WithAttributes(tracing.String("trigger", string(models.DetectionRunManual))))
+	defer span.End()
 
-	transactions, err := d.raphtoryClient.GetTransactionsInWindow(ctx, startTime, endTime, 10000)
+	detectors := d.currentDetectors()
+	run := d.startRun(detectors, models.DetectionRunManual, opts.TriggeredBy, start, end)
+
+	transactions, err := d.fetchTransactions(ctx, start, end)
 	if err != nil {
+		span.RecordError(err)
+		d.finishRun(run, 0, 0, err)
 		return nil, err
 	}
-
-	if len(transactions) == 0 {
-		return nil, nil
+	if d.ignoreUnconfirmed {
+		transactions = ConfirmedTransactions(transactions)
 	}
 
-	var allOutliers []models.Outlier
+	// Apply address filter
+	addresses := make(map[string]bool, len(opts.Addresses))
+	for _, address := range opts.Addresses {
+		addresses[address] = true
+	}
+	if len(addresses) > 0 {
+		filtered := transactions[:0]
+		for _, tx := range transactions {
+			if addresses[tx.From] || addresses[tx.To] {
+				filtered = append(filtered, tx)
+			}
+		}
+		transactions = filtered
+	}
 
-	// Run Z-score detection
-	zscoreOutliers, err := d.zscoreDetector.Detect(transactions)
-	if err != nil {
-		d.logger.Error("Z-score detection failed", zap.Error(err))
-	} else {
-		allOutliers = append(allOutliers, zscoreOutliers...)
+	// Apply token filter so baselines are not mixed across tokens
+	if opts.Token != "" {
+		filtered := transactions[:0]
+		for _, tx := range transactions {
+			if strings.EqualFold(tx.Token, opts.Token) {
+				filtered = append(filtered, tx)
+			}
+		}
+		transactions = filtered
 	}
 
-	// Run IQR detection
-	iqrOutliers, err := d.iqrDetector.Detect(transactions)
-	if err != nil {
-		d.logger.Error("IQR detection failed", zap.Error(err))
-	} else {
-		allOutliers = append(allOutliers, iqrOutliers...)
+	if len(transactions) == 0 {
+		d.finishRun(run, 0, 0, nil)
+		return nil, nil
 	}
 
-	// Run pattern detection
-	patternOutliers, err := d.patternDetector.DetectAll(ctx)
+	allOutliers := d.detectTransactions(ctx, detectors, transactions, false)
+
+	// Run pattern detection (graph patterns are not address-scoped, so filter results)
+	patternOutliers, err := d.detectPatterns(ctx, detectors)
 	if err != nil {
 		d.logger.Error("Pattern detection failed", zap.Error(err))
 	} else {
-		allOutliers = append(allOutliers, patternOutliers...)
+		for _, outlier := range patternOutliers {
+			if len(addresses) == 0 || addresses[outlier.Address] {
+				allOutliers = append(allOutliers, outlier)
+			}
+		}
 	}
 
 	// Deduplicate
-	return d.deduplicateOutliers(allOutliers), nil
+	deduped := d.enrich(ctx, d.applyLabels(d.deduplicateOutliers(allOutliers)))
+	countOutliers(deduped)
+	d.tagRisk(ctx, deduped)
+	d.finishRun(run, len(transactions), len(deduped), nil)
+	span.SetAttributes(
+		tracing.Int("transactions", len(transactions)),
+		tracing.Int("outliers", len(deduped)))
+
+	return deduped, nil
+}
+
+// countOutliers records raised outliers by type and severity
+func countOutliers(outliers []models.Outlier) {
+	for _, outlier := range outliers {
+		metrics.OutliersDetected.WithLabelValues(string(outlier.Type), string(outlier.Severity)).Inc()
+	}
 }
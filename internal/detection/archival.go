@@ -0,0 +1,126 @@
+package detection
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// archivedBySystem marks outliers archived by the scheduled job rather
+// than a user
+const archivedBySystem = "system"
+
+// OutlierArchiverConfig holds scheduled outlier archival configuration
+type OutlierArchiverConfig struct {
+	After      time.Duration     // Acknowledged outliers detected longer ago than this are archived
+	Severities []models.Severity // Severities to archive; defaults to low
+	BatchSize  int               // Outliers archived per statement; defaults to 1000
+}
+
+// OutlierArchiver archives acknowledged outliers once they are old enough,
+// for each organization that acknowledged them, so default listings only
+// cover outliers still worth looking at. Archived outliers stay in the
+// table and can be listed with ?archived=true.
+type OutlierArchiver struct {
+	db     *sql.DB
+	config OutlierArchiverConfig
+	logger *zap.Logger
+
+	mu sync.Mutex // One archival run at a time
+}
+
+// NewOutlierArchiver creates an outlier archiver
+func NewOutlierArchiver(db *sql.DB, config OutlierArchiverConfig, logger *zap.Logger) *OutlierArchiver {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if len(config.Severities) == 0 {
+		config.Severities = []models.Severity{models.SeverityLow}
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1000
+	}
+
+	return &OutlierArchiver{
+		db:     db,
+		config: config,
+		logger: logger,
+	}
+}
+
+// Run archives on start and then every interval until ctx is done
+func (a *OutlierArchiver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := a.Archive(ctx); err != nil && ctx.Err() == nil {
+			a.logger.Error("Failed to archive outliers", zap.Error(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Archive archives every outlier of the configured severities detected
+// before the cutoff for each organization that acknowledged it, a batch at
+// a time so no single statement holds locks on much of the table, and
+// returns how many were archived
+func (a *OutlierArchiver) Archive(ctx context.Context) (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	args := []interface{}{now, archivedBySystem, now.Add(-a.config.After)}
+	placeholders := make([]string, len(a.config.Severities))
+	for i, severity := range a.config.Severities {
+		args = append(args, string(severity))
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	args = append(args, a.config.BatchSize)
+	query := `
+		UPDATE outlier_triage
+		SET archived_at = $1,
+		    archived_by = $2
+		WHERE id IN (
+			SELECT t.id FROM outlier_triage t
+			JOIN outliers o ON o.id = t.outlier_id
+			WHERE t.archived_at IS NULL
+			  AND t.acknowledged = true
+			  AND o.detected_at < $3
+			  AND o.severity IN (` + strings.Join(placeholders, ", ") + `)
+			ORDER BY o.detected_at
+			LIMIT ` + fmt.Sprintf("$%d", len(args)) + `
+		)
+	`
+
+	var total int64
+	for {
+		result, err := a.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return total, fmt.Errorf("failed to archive outliers: %w", err)
+		}
+		count, _ := result.RowsAffected()
+		total += count
+		if count < int64(a.config.BatchSize) {
+			break
+		}
+	}
+
+	if total > 0 {
+		a.logger.Info("Outliers archived",
+			zap.Int64("count", total),
+			zap.Duration("after", a.config.After))
+	}
+	return total, nil
+}
@@ -0,0 +1,372 @@
+package detection
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gonum.org/v1/gonum/stat"
+)
+
+// DBSCANDetector detects anomalous addresses using density-based clustering
+// over per-address feature vectors (amount, velocity, counterparty count).
+// Addresses that fall in sparse regions of the feature space (DBSCAN noise
+// points) are flagged as outliers.
+type DBSCANDetector struct {
+	epsilon        float64       // Neighbourhood radius in standardised feature space
+	minPoints      int           // Minimum neighbours for a point to be a core point
+	minAddresses   int           // Minimum addresses required to run clustering
+	maxAddresses   int           // Cap on addresses clustered per cycle (neighbour search is O(n²))
+	windowDuration time.Duration // Time window the features are computed over
+	logger         *zap.Logger
+}
+
+// DBSCANConfig holds configuration for DBSCAN detector
+type DBSCANConfig struct {
+	Epsilon        float64
+	MinPoints      int
+	MinAddresses   int
+	MaxAddresses   int
+	WindowDuration time.Duration
+}
+
+// AddressFeatures is the feature vector built for a single address
+type AddressFeatures struct {
+	Address           string
+	TotalAmount       decimal.Decimal
+	TransactionCount  int
+	Velocity          float64 // Transactions per hour over the window
+	CounterpartyCount int
+	LargestTxHash     string
+	LargestAmount     decimal.Decimal
+}
+
+// NewDBSCANDetector creates a new DBSCAN detector
+func NewDBSCANDetector(config DBSCANConfig, logger *zap.Logger) *DBSCANDetector {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	if config.Epsilon <= 0 {
+		config.Epsilon = 0.5
+	}
+	if config.MinPoints <= 0 {
+		config.MinPoints = 5
+	}
+	if config.MinAddresses <= 0 {
+		config.MinAddresses = 30
+	}
+	if config.MaxAddresses <= 0 {
+		config.MaxAddresses = 5000
+	}
+	if config.WindowDuration <= 0 {
+		config.WindowDuration = 24 * time.Hour
+	}
+
+	return &DBSCANDetector{
+		epsilon:        config.Epsilon,
+		minPoints:      config.MinPoints,
+		minAddresses:   config.MinAddresses,
+		maxAddresses:   config.MaxAddresses,
+		windowDuration: config.WindowDuration,
+		logger:         logger,
+	}
+}
+
+// Detect finds addresses whose activity lies in sparse regions of the feature space
+func (d *DBSCANDetector) Detect(transactions []models.Transaction) ([]models.Outlier, error) {
+	features := BuildAddressFeatures(transactions, d.windowDuration)
+	if len(features) < d.minAddresses {
+		d.logger.Debug("Insufficient addresses for DBSCAN detection",
+			zap.Int("count", len(features)),
+			zap.Int("min_required", d.minAddresses))
+		return nil, nil
+	}
+
+	// Keep the most active addresses when over the cap so the neighbour
+	// search stays bounded
+	if len(features) > d.maxAddresses {
+		sort.Slice(features, func(i, j int) bool {
+			return features[i].TransactionCount > features[j].TransactionCount
+		})
+		features = features[:d.maxAddresses]
+	}
+
+	points := standardiseFeatures(features)
+	labels := dbscan(points, d.epsilon, d.minPoints)
+
+	clusters := make(map[int]int)
+	for _, label := range labels {
+		if label != noiseLabel {
+			clusters[label]++
+		}
+	}
+
+	d.logger.Debug("DBSCAN clustering completed",
+		zap.Int("addresses", len(points)),
+		zap.Int("clusters", len(clusters)),
+		zap.Float64("epsilon", d.epsilon),
+		zap.Int("min_points", d.minPoints))
+
+	var outliers []models.Outlier
+	for i, label := range labels {
+		if label != noiseLabel {
+			continue
+		}
+
+		f := features[i]
+		distance := nearestClusterDistance(points, labels, i, d.epsilon)
+		ratio := distance / d.epsilon
+		severity := d.calculateSeverity(ratio)
+
+		outlier := models.Outlier{
+			ID:              uuid.New().String(),
+			DetectedAt:      time.Now(),
+			Type:            models.OutlierTypeDBSCAN,
+			Severity:        severity,
+			Address:         f.Address,
+			TransactionHash: f.LargestTxHash,
+			Amount:          f.LargestAmount,
+			Details: map[string]interface{}{
+				"total_amount":             f.TotalAmount.String(),
+				"transaction_count":        f.TransactionCount,
+				"velocity":                 f.Velocity,
+				"counterparty_count":       f.CounterpartyCount,
+				"nearest_cluster_distance": distance,
+				"distance_ratio":           ratio,
+				"epsilon":                  d.epsilon,
+				"min_points":               d.minPoints,
+				"clusters":                 len(clusters),
+				"sample_size":              len(points),
+				"time_window":              d.windowDuration.String(),
+			},
+			Status:       models.OutlierStatusOpen,
+			Acknowledged: false,
+		}
+
+		outliers = append(outliers, outlier)
+
+		d.logger.Info("DBSCAN outlier detected",
+			zap.String("address", f.Address),
+			zap.Float64("distance_ratio", ratio),
+			zap.Int("transaction_count", f.TransactionCount),
+			zap.Int("counterparty_count", f.CounterpartyCount),
+			zap.String("severity", string(severity)))
+	}
+
+	d.logger.Info("DBSCAN detection completed",
+		zap.Int("total_addresses", len(points)),
+		zap.Int("outliers_found", len(outliers)))
+
+	return outliers, nil
+}
+
+// calculateSeverity determines severity from the distance to the nearest
+// clustered point, measured in multiples of epsilon
+func (d *DBSCANDetector) calculateSeverity(ratio float64) models.Severity {
+	switch {
+	case ratio >= 8.0:
+		return models.SeverityCritical
+	case ratio >= 4.0:
+		return models.SeverityHigh
+	case ratio >= 2.0:
+		return models.SeverityMedium
+	default:
+		return models.SeverityLow
+	}
+}
+
+// BuildAddressFeatures aggregates transactions into per-address feature vectors
+func BuildAddressFeatures(transactions []models.Transaction, window time.Duration) []AddressFeatures {
+	type accumulator struct {
+		features       AddressFeatures
+		counterparties map[string]struct{}
+	}
+
+	hours := window.Hours()
+	if hours <= 0 {
+		hours = 1
+	}
+
+	byAddress := make(map[string]*accumulator)
+	order := make([]string, 0)
+
+	touch := func(address, counterparty string, tx models.Transaction) {
+		acc, ok := byAddress[address]
+		if !ok {
+			acc = &accumulator{
+				features:       AddressFeatures{Address: address},
+				counterparties: make(map[string]struct{}),
+			}
+			byAddress[address] = acc
+			order = append(order, address)
+		}
+
+		acc.features.TotalAmount = acc.features.TotalAmount.Add(tx.Amount)
+		acc.features.TransactionCount++
+		acc.counterparties[counterparty] = struct{}{}
+
+		if acc.features.LargestTxHash == "" || tx.Amount.GreaterThan(acc.features.LargestAmount) {
+			acc.features.LargestTxHash = tx.TxHash
+			acc.features.LargestAmount = tx.Amount
+		}
+	}
+
+	for _, tx := range transactions {
+		touch(tx.From, tx.To, tx)
+		if tx.To != tx.From {
+			touch(tx.To, tx.From, tx)
+		}
+	}
+
+	features := make([]AddressFeatures, 0, len(order))
+	for _, address := range order {
+		acc := byAddress[address]
+		acc.features.CounterpartyCount = len(acc.counterparties)
+		acc.features.Velocity = float64(acc.features.TransactionCount) / hours
+		features = append(features, acc.features)
+	}
+
+	return features
+}
+
+// standardiseFeatures converts features into z-normalised points. Amount and
+// velocity are heavy-tailed, so they are log-scaled before normalisation.
+func standardiseFeatures(features []AddressFeatures) [][]float64 {
+	const dims = 3
+
+	columns := make([][]float64, dims)
+	for i := range columns {
+		columns[i] = make([]float64, len(features))
+	}
+
+	for i, f := range features {
+		amount, _ := f.TotalAmount.Float64()
+		columns[0][i] = math.Log1p(math.Max(amount, 0))
+		columns[1][i] = math.Log1p(f.Velocity)
+		columns[2][i] = math.Log1p(float64(f.CounterpartyCount))
+	}
+
+	for _, column := range columns {
+		mean := stat.Mean(column, nil)
+		stddev := stat.StdDev(column, nil)
+		for i := range column {
+			if stddev == 0 {
+				column[i] = 0
+				continue
+			}
+			column[i] = (column[i] - mean) / stddev
+		}
+	}
+
+	points := make([][]float64, len(features))
+	for i := range features {
+		points[i] = []float64{columns[0][i], columns[1][i], columns[2][i]}
+	}
+
+	return points
+}
+
+const (
+	noiseLabel     = -1
+	unvisitedLabel = 0
+	firstClusterID = 1
+)
+
+// dbscan labels each point with a cluster ID (>= 1) or noiseLabel
+func dbscan(points [][]float64, epsilon float64, minPoints int) []int {
+	labels := make([]int, len(points))
+	clusterID := firstClusterID - 1
+
+	for i := range points {
+		if labels[i] != unvisitedLabel {
+			continue
+		}
+
+		neighbours := regionQuery(points, i, epsilon)
+		if len(neighbours) < minPoints {
+			labels[i] = noiseLabel
+			continue
+		}
+
+		clusterID++
+		labels[i] = clusterID
+
+		// Expand cluster
+		queue := neighbours
+		for len(queue) > 0 {
+			j := queue[0]
+			queue = queue[1:]
+
+			if labels[j] == noiseLabel {
+				// Border point previously marked as noise
+				labels[j] = clusterID
+			}
+			if labels[j] != unvisitedLabel {
+				continue
+			}
+
+			labels[j] = clusterID
+			jNeighbours := regionQuery(points, j, epsilon)
+			if len(jNeighbours) >= minPoints {
+				queue = append(queue, jNeighbours...)
+			}
+		}
+	}
+
+	return labels
+}
+
+// regionQuery returns indices of all points within epsilon of point i (including i)
+func regionQuery(points [][]float64, i int, epsilon float64) []int {
+	var neighbours []int
+	for j := range points {
+		if euclidean(points[i], points[j]) <= epsilon {
+			neighbours = append(neighbours, j)
+		}
+	}
+	return neighbours
+}
+
+// nearestClusterDistance returns the distance from point i to the closest
+// clustered point, or to the closest other point if nothing was clustered
+func nearestClusterDistance(points [][]float64, labels []int, i int, epsilon float64) float64 {
+	nearest := math.Inf(1)
+	fallback := math.Inf(1)
+
+	for j := range points {
+		if j == i {
+			continue
+		}
+		dist := euclidean(points[i], points[j])
+		if dist < fallback {
+			fallback = dist
+		}
+		if labels[j] != noiseLabel && dist < nearest {
+			nearest = dist
+		}
+	}
+
+	if math.IsInf(nearest, 1) {
+		if math.IsInf(fallback, 1) {
+			return epsilon
+		}
+		return fallback
+	}
+
+	return nearest
+}
+
+// euclidean returns the Euclidean distance between two points
+func euclidean(a, b []float64) float64 {
+	var sum float64
+	for k := range a {
+		diff := a[k] - b[k]
+		sum += diff * diff
+	}
+	return math.Sqrt(sum)
+}
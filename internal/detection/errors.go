@@ -0,0 +1,33 @@
+package detection
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mikedewar/stablerisk/internal/errs"
+)
+
+// errComponent labels failures recorded by detection
+const errComponent = "detection"
+
+// Kinds of detection failure. Raphtory failures during detection keep the
+// graph package's kinds. Match them with errors.Is.
+var (
+	// ErrTooManyJobs is returned when the concurrent on-demand run limit is reached
+	ErrTooManyJobs = errs.New("detection_busy", errs.ClassInput, "too many detection jobs running")
+
+	// ErrDetectionTimeout is a run that did not finish within its timeout
+	ErrDetectionTimeout = errs.New("detection_timeout", errs.ClassInternal, "detection run timed out")
+
+	// ErrDetectorFailed is a detector that failed on the data it was given
+	ErrDetectorFailed = errs.New("detector_failed", errs.ClassInternal, "detector failed")
+)
+
+// classifyRunError marks a run that hit its deadline as a timeout and
+// records it. Other failures were recorded where they arose.
+func classifyRunError(err error) error {
+	if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return errs.Record(errComponent, errs.Wrap(ErrDetectionTimeout, err))
+}
@@ -0,0 +1,86 @@
+package detection
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// OutlierStore reads and updates persisted outliers in the outliers table
+type OutlierStore struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewOutlierStore creates a new outlier store
+func NewOutlierStore(db *sql.DB, logger *zap.Logger) *OutlierStore {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &OutlierStore{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// InvalidateByTransaction marks every outlier tied to a transaction as
+// invalidated and returns how many were updated. Outliers are kept rather than
+// deleted so acknowledgements and feedback remain in the record.
+func (s *OutlierStore) InvalidateByTransaction(ctx context.Context, txHash, reason string) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE outliers
+		SET invalidated = true,
+		    invalidated_at = $1,
+		    invalid_reason = $2
+		WHERE transaction_hash = $3 AND invalidated = false
+	`, time.Now(), reason, txHash)
+	if err != nil {
+		return 0, fmt.Errorf("failed to invalidate outliers: %w", err)
+	}
+
+	count, _ := result.RowsAffected()
+	if count > 0 {
+		s.logger.Info("Outliers invalidated",
+			zap.String("tx_hash", txHash),
+			zap.String("reason", reason),
+			zap.Int64("count", count))
+	}
+
+	return count, nil
+}
+
+// IncidentOpen reports whether outlier's incident, the live outliers of its
+// type on its address for its organization, has any that organization has
+// not acknowledged. The shared detections' incidents are the default
+// organization's. An outlier without an address is an incident of its own.
+func (s *OutlierStore) IncidentOpen(ctx context.Context, outlier models.Outlier) (bool, error) {
+	if outlier.Address == "" {
+		return false, nil
+	}
+
+	orgID := outlier.OrgID
+	owned := "o.org_id = $1"
+	if orgID == "" || orgID == models.DefaultOrganizationID {
+		orgID = models.DefaultOrganizationID
+		owned = "(o.org_id = $1 OR o.org_id IS NULL)"
+	}
+
+	var open bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM outliers o
+			LEFT JOIN outlier_triage t ON t.outlier_id = o.id AND t.org_id = $1
+			WHERE `+owned+` AND o.type = $2 AND o.address = $3
+			  AND o.invalidated = false AND COALESCE(t.acknowledged, false) = false
+		)
+	`, orgID, string(outlier.Type), outlier.Address).Scan(&open)
+	if err != nil {
+		return false, fmt.Errorf("failed to check incident: %w", err)
+	}
+	return open, nil
+}
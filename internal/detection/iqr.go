@@ -3,6 +3,7 @@ package detection
 import (
 	"math"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,6 +18,19 @@ type IQRDetector struct {
 	windowDuration time.Duration // Time window for calculating statistics
 	minDataPoints  int           // Minimum data points required
 	logger         *zap.Logger
+
+	// Streaming quartile estimation across cycles, by token
+	streaming bool
+	streams   map[string]*quartileStream
+	mu        sync.Mutex
+}
+
+// quartileStream estimates one token's quartiles across cycles
+type quartileStream struct {
+	q1Estimator    *P2Quantile
+	q3Estimator    *P2Quantile
+	estimatorStart time.Time            // When the estimators were last reset
+	seen           map[string]time.Time // Timestamps of the transactions fed to the estimators, by hash
 }
 
 // IQRConfig holds configuration for IQR detector
@@ -24,6 +38,7 @@ type IQRConfig struct {
 	Multiplier     float64
 	WindowDuration time.Duration
 	MinDataPoints  int
+	Streaming      bool // Maintain quartiles incrementally instead of sorting each window
 }
 
 // NewIQRDetector creates a new IQR detector
@@ -37,16 +52,46 @@ func NewIQRDetector(config IQRConfig, logger *zap.Logger) *IQRDetector {
 		windowDuration: config.WindowDuration,
 		minDataPoints:  config.MinDataPoints,
 		logger:         logger,
+		streaming:      config.Streaming,
+		streams:        make(map[string]*quartileStream),
 	}
 }
 
+// IQRBaseline holds the window quartiles transactions are scored against
+type IQRBaseline struct {
+	Q1         float64
+	Q3         float64
+	IQR        float64
+	LowerBound float64
+	UpperBound float64
+	SampleSize int
+	Estimated  bool // Quartiles come from the streaming estimator
+}
+
 // Detect finds outliers using IQR method
 func (d *IQRDetector) Detect(transactions []models.Transaction) ([]models.Outlier, error) {
+	baseline, ok := d.Baseline(transactions)
+	if !ok {
+		return nil, nil
+	}
+
+	outliers := d.Score(transactions, baseline)
+
+	d.logger.Info("IQR detection completed",
+		zap.Int("total_transactions", len(transactions)),
+		zap.Int("outliers_found", len(outliers)))
+
+	return outliers, nil
+}
+
+// Baseline computes the quartiles and outlier bounds of transaction amounts.
+// It returns false when there is too little data.
+func (d *IQRDetector) Baseline(transactions []models.Transaction) (*IQRBaseline, bool) {
 	if len(transactions) < d.minDataPoints {
 		d.logger.Debug("Insufficient data points for IQR detection",
 			zap.Int("count", len(transactions)),
 			zap.Int("min_required", d.minDataPoints))
-		return nil, nil
+		return nil, false
 	}
 
 	// Extract amounts as float64 array
@@ -76,15 +121,104 @@ func (d *IQRDetector) Detect(transactions []models.Transaction) ([]models.Outlie
 		zap.Float64("upper_bound", upperBound),
 		zap.Int("sample_size", len(amounts)))
 
-	// Find outliers
+	return &IQRBaseline{
+		Q1:         q1,
+		Q3:         q3,
+		IQR:        iqr,
+		LowerBound: lowerBound,
+		UpperBound: upperBound,
+		SampleSize: len(amounts),
+	}, true
+}
+
+// StreamingBaseline feeds transactions of token not seen before into that
+// token's streaming quartile estimators and returns bounds from them.
+// Transactions are recognised by hash, so ones backfilled with older
+// timestamps are still fed once. Estimators are restarted once they span
+// more than the window duration. Until they hold enough data, or when
+// streaming is disabled, the exact Baseline is used.
+func (d *IQRDetector) StreamingBaseline(token string, transactions []models.Transaction) (*IQRBaseline, bool) {
+	if !d.streaming {
+		return d.Baseline(transactions)
+	}
+
+	d.mu.Lock()
+	stream := d.streams[token]
+	if stream == nil || (d.windowDuration > 0 && time.Since(stream.estimatorStart) > d.windowDuration) {
+		stream = &quartileStream{
+			q1Estimator:    NewP2Quantile(0.25),
+			q3Estimator:    NewP2Quantile(0.75),
+			estimatorStart: time.Now(),
+			seen:           make(map[string]time.Time),
+		}
+		if previous := d.streams[token]; previous != nil {
+			stream.seen = previous.seen
+		}
+		d.streams[token] = stream
+	}
+
+	// Transactions that have left the window are not fed again, so forget
+	// them
+	if d.windowDuration > 0 {
+		cutoff := time.Now().Add(-d.windowDuration)
+		for hash, timestamp := range stream.seen {
+			if timestamp.Before(cutoff) {
+				delete(stream.seen, hash)
+			}
+		}
+	}
+
+	// Detection windows overlap, so only feed transactions not seen before
+	for _, tx := range transactions {
+		if _, ok := stream.seen[tx.TxHash]; ok {
+			continue
+		}
+		amt, _ := tx.Amount.Float64()
+		stream.q1Estimator.Add(amt)
+		stream.q3Estimator.Add(amt)
+		stream.seen[tx.TxHash] = tx.Timestamp
+	}
+
+	count := stream.q1Estimator.Count()
+	q1 := stream.q1Estimator.Value()
+	q3 := stream.q3Estimator.Value()
+	d.mu.Unlock()
+
+	if count < d.minDataPoints {
+		return d.Baseline(transactions)
+	}
+
+	iqr := q3 - q1
+	baseline := &IQRBaseline{
+		Q1:         q1,
+		Q3:         q3,
+		IQR:        iqr,
+		LowerBound: q1 - (d.multiplier * iqr),
+		UpperBound: q3 + (d.multiplier * iqr),
+		SampleSize: count,
+		Estimated:  true,
+	}
+
+	d.logger.Debug("IQR streaming statistics estimated",
+		zap.Float64("q1", baseline.Q1),
+		zap.Float64("q3", baseline.Q3),
+		zap.Float64("iqr", baseline.IQR),
+		zap.Int("sample_size", count))
+
+	return baseline, true
+}
+
+// Score flags transactions whose amount falls outside the baseline bounds.
+// transactions may be any subset of the baseline window.
+func (d *IQRDetector) Score(transactions []models.Transaction, baseline *IQRBaseline) []models.Outlier {
 	var outliers []models.Outlier
-	for i, tx := range transactions {
-		amount := amounts[i]
+	for _, tx := range transactions {
+		amount, _ := tx.Amount.Float64()
 
 		// Check if outside bounds
-		if amount < lowerBound || amount > upperBound {
+		if amount < baseline.LowerBound || amount > baseline.UpperBound {
 			// Calculate severity based on how far outside bounds
-			deviation := d.calculateDeviation(amount, lowerBound, upperBound, iqr)
+			deviation := d.calculateDeviation(amount, baseline.LowerBound, baseline.UpperBound, baseline.IQR)
 			severity := d.calculateSeverity(deviation)
 
 			outlier := models.Outlier{
@@ -96,20 +230,22 @@ func (d *IQRDetector) Detect(transactions []models.Transaction) ([]models.Outlie
 				TransactionHash: tx.TxHash,
 				Amount:          tx.Amount,
 				Details: map[string]interface{}{
-					"q1":            q1,
-					"q3":            q3,
-					"iqr":           iqr,
-					"lower_bound":   lowerBound,
-					"upper_bound":   upperBound,
+					"q1":            baseline.Q1,
+					"q3":            baseline.Q3,
+					"iqr":           baseline.IQR,
+					"lower_bound":   baseline.LowerBound,
+					"upper_bound":   baseline.UpperBound,
 					"deviation":     deviation,
-					"sample_size":   len(amounts),
+					"sample_size":   baseline.SampleSize,
 					"from":          tx.From,
 					"to":            tx.To,
 					"block_number":  tx.BlockNumber,
 					"timestamp":     tx.Timestamp,
 					"multiplier":    d.multiplier,
 					"amount":        amount,
+					"estimated":     baseline.Estimated,
 				},
+				Status:       models.OutlierStatusOpen,
 				Acknowledged: false,
 			}
 
@@ -118,18 +254,14 @@ func (d *IQRDetector) Detect(transactions []models.Transaction) ([]models.Outlie
 			d.logger.Info("IQR outlier detected",
 				zap.String("tx_hash", tx.TxHash),
 				zap.Float64("amount", amount),
-				zap.Float64("lower_bound", lowerBound),
-				zap.Float64("upper_bound", upperBound),
+				zap.Float64("lower_bound", baseline.LowerBound),
+				zap.Float64("upper_bound", baseline.UpperBound),
 				zap.Float64("deviation", deviation),
 				zap.String("severity", string(severity)))
 		}
 	}
 
-	d.logger.Info("IQR detection completed",
-		zap.Int("total_transactions", len(transactions)),
-		zap.Int("outliers_found", len(outliers)))
-
-	return outliers, nil
+	return outliers
 }
 
 // DetectByAddress detects outliers for a specific address
@@ -0,0 +1,215 @@
+package detection
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mikedewar/stablerisk/internal/errs"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// JobStatus represents the state of an on-demand detection job
+type JobStatus string
+
+const (
+	JobStatusPending   JobStatus = "pending"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusCompleted JobStatus = "completed"
+	JobStatusFailed    JobStatus = "failed"
+)
+
+// DetectionJob is an on-demand detection run
+type DetectionJob struct {
+	ID           string           `json:"id"`
+	Status       JobStatus        `json:"status"`
+	SubmittedBy  string           `json:"submitted_by,omitempty"`
+	Options      DetectOptions    `json:"options"`
+	CreatedAt    time.Time        `json:"created_at"`
+	StartedAt    *time.Time       `json:"started_at,omitempty"`
+	CompletedAt  *time.Time       `json:"completed_at,omitempty"`
+	OutlierCount int              `json:"outlier_count"`
+	Outliers     []models.Outlier `json:"outliers,omitempty"`
+	Error        string           `json:"error,omitempty"`
+
+	done chan struct{}
+}
+
+// JobManager runs on-demand detection jobs in the background and keeps their
+// results for a limited time so clients can poll for them
+type JobManager struct {
+	detector      *AnomalyDetector
+	logger        *zap.Logger
+	maxConcurrent int
+	timeout       time.Duration
+	retention     time.Duration
+
+	jobs    map[string]*DetectionJob
+	running int
+	mu      sync.Mutex
+}
+
+// JobManagerConfig holds configuration for the job manager
+type JobManagerConfig struct {
+	MaxConcurrent int           // Maximum jobs running at once
+	Timeout       time.Duration // Maximum duration of a single job
+	Retention     time.Duration // How long finished jobs are kept
+}
+
+// NewJobManager creates a new detection job manager
+func NewJobManager(detector *AnomalyDetector, config JobManagerConfig, logger *zap.Logger) *JobManager {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = 2
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Minute
+	}
+	if config.Retention <= 0 {
+		config.Retention = 1 * time.Hour
+	}
+
+	return &JobManager{
+		detector:      detector,
+		logger:        logger,
+		maxConcurrent: config.MaxConcurrent,
+		timeout:       config.Timeout,
+		retention:     config.Retention,
+		jobs:          make(map[string]*DetectionJob),
+	}
+}
+
+// Submit queues a detection run and starts it in the background. The run
+// keeps ctx's values, such as the submitting request's trace, but not its
+// cancellation, so it outlives the request.
+func (m *JobManager) Submit(ctx context.Context, opts DetectOptions, submittedBy string) (*DetectionJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pruneLocked()
+
+	if m.running >= m.maxConcurrent {
+		return nil, errs.Record(errComponent, ErrTooManyJobs)
+	}
+
+	opts.TriggeredBy = submittedBy
+	job := &DetectionJob{
+		ID:          uuid.New().String(),
+		Status:      JobStatusPending,
+		SubmittedBy: submittedBy,
+		Options:     opts,
+		CreatedAt:   time.Now(),
+		done:        make(chan struct{}),
+	}
+	m.jobs[job.ID] = job
+	m.running++
+
+	go m.run(context.WithoutCancel(ctx), job)
+
+	m.logger.Info("Detection job submitted",
+		zap.String("job_id", job.ID),
+		zap.String("submitted_by", submittedBy),
+		zap.Int("addresses", len(opts.Addresses)))
+
+	return job.snapshot(), nil
+}
+
+// Running returns the number of jobs pending or in progress
+func (m *JobManager) Running() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.running
+}
+
+// Get returns a snapshot of a job
+func (m *JobManager) Get(id string) (*DetectionJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	return job.snapshot(), true
+}
+
+// Wait blocks until the job finishes or ctx is done, then returns its latest snapshot
+func (m *JobManager) Wait(ctx context.Context, id string) (*DetectionJob, bool) {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	select {
+	case <-job.done:
+	case <-ctx.Done():
+	}
+
+	return m.Get(id)
+}
+
+// run executes the job
+func (m *JobManager) run(ctx context.Context, job *DetectionJob) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	m.mu.Lock()
+	started := time.Now()
+	job.Status = JobStatusRunning
+	job.StartedAt = &started
+	m.mu.Unlock()
+
+	outliers, err := m.detector.DetectOnce(ctx, job.Options)
+	err = classifyRunError(err)
+
+	m.mu.Lock()
+	completed := time.Now()
+	job.CompletedAt = &completed
+	if err != nil {
+		job.Status = JobStatusFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = JobStatusCompleted
+		job.Outliers = outliers
+		job.OutlierCount = len(outliers)
+	}
+	m.running--
+	close(job.done)
+	m.mu.Unlock()
+
+	if err != nil {
+		m.logger.Error("Detection job failed",
+			zap.String("job_id", job.ID),
+			zap.Error(err))
+		return
+	}
+
+	m.logger.Info("Detection job completed",
+		zap.String("job_id", job.ID),
+		zap.Int("outliers_found", len(outliers)),
+		zap.Duration("duration", completed.Sub(started)))
+}
+
+// pruneLocked removes finished jobs older than the retention period
+func (m *JobManager) pruneLocked() {
+	cutoff := time.Now().Add(-m.retention)
+	for id, job := range m.jobs {
+		if job.CompletedAt != nil && job.CompletedAt.Before(cutoff) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// snapshot copies the job so callers can read it without holding the lock
+func (j *DetectionJob) snapshot() *DetectionJob {
+	cp := *j
+	cp.done = nil
+	return &cp
+}
@@ -0,0 +1,217 @@
+package detection
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// AddressLabelsConfig holds address label configuration
+type AddressLabelsConfig struct {
+	RefreshInterval time.Duration // How often labels are reloaded from the database (default 5m)
+	// ExemptCategories are entities whose fan-out, fan-in and velocity are
+	// normal business, e.g. exchanges; those outliers are dropped for them
+	ExemptCategories []models.LabelCategory
+	// EscalateCategories are entities whose involvement raises an outlier
+	// one severity level, e.g. mixers
+	EscalateCategories []models.LabelCategory
+}
+
+// exemptTypes are the outlier types ExemptCategories suppress
+var exemptTypes = map[models.OutlierType]bool{
+	models.OutlierTypePatternFanOut:   true,
+	models.OutlierTypePatternFanIn:    true,
+	models.OutlierTypePatternVelocity: true,
+}
+
+// AddressLabels holds the known-entity labels of addresses in memory,
+// reloaded periodically, and applies them to detected outliers
+type AddressLabels struct {
+	db       *sql.DB
+	config   AddressLabelsConfig
+	exempt   map[models.LabelCategory]bool
+	escalate map[models.LabelCategory]bool
+	logger   *zap.Logger
+
+	mu     sync.RWMutex
+	labels map[string]models.AddressLabel // By normalized address
+}
+
+// NewAddressLabels creates an address label store with no labels until the
+// first Refresh
+func NewAddressLabels(db *sql.DB, config AddressLabelsConfig, logger *zap.Logger) *AddressLabels {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = 5 * time.Minute
+	}
+
+	exempt := make(map[models.LabelCategory]bool, len(config.ExemptCategories))
+	for _, category := range config.ExemptCategories {
+		exempt[category] = true
+	}
+	escalate := make(map[models.LabelCategory]bool, len(config.EscalateCategories))
+	for _, category := range config.EscalateCategories {
+		escalate[category] = true
+	}
+
+	return &AddressLabels{
+		db:       db,
+		config:   config,
+		exempt:   exempt,
+		escalate: escalate,
+		logger:   logger,
+		labels:   make(map[string]models.AddressLabel),
+	}
+}
+
+// Refresh reloads every label
+func (l *AddressLabels) Refresh(ctx context.Context) error {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT address, label, category, source, updated_by, updated_at
+		FROM address_labels
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query address labels: %w", err)
+	}
+	defer rows.Close()
+
+	labels := make(map[string]models.AddressLabel)
+	for rows.Next() {
+		var label models.AddressLabel
+		if err := rows.Scan(&label.Address, &label.Label, &label.Category, &label.Source,
+			&label.UpdatedBy, &label.UpdatedAt); err != nil {
+			return fmt.Errorf("failed to scan address label: %w", err)
+		}
+		labels[models.NormalizeAddress(label.Address)] = label
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read address labels: %w", err)
+	}
+
+	l.mu.Lock()
+	l.labels = labels
+	l.mu.Unlock()
+
+	l.logger.Debug("Address labels loaded", zap.Int("labels", len(labels)))
+	return nil
+}
+
+// Run refreshes the labels every RefreshInterval until ctx is cancelled. A
+// failed refresh keeps the labels already loaded.
+func (l *AddressLabels) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Refresh(ctx); err != nil && ctx.Err() == nil {
+				l.logger.Error("Failed to refresh address labels", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Lookup returns the label for address, if it has one
+func (l *AddressLabels) Lookup(address string) (models.AddressLabel, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	label, ok := l.labels[models.NormalizeAddress(address)]
+	return label, ok
+}
+
+// Apply labels outliers in place and returns those that remain. Each
+// outlier's Details gain address_label for its address, counterparty_label
+// for a counterparty and member_labels for community members. Fan-out,
+// fan-in and velocity outliers on exempt entities are dropped, and outliers
+// touching an escalating entity are raised one severity level.
+func (l *AddressLabels) Apply(outliers []models.Outlier) []models.Outlier {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	kept := outliers[:0]
+	for _, outlier := range outliers {
+		label, ok := l.labels[models.NormalizeAddress(outlier.Address)]
+		if ok && l.exempt[label.Category] && exemptTypes[outlier.Type] {
+			l.logger.Debug("Dropping outlier on exempt entity",
+				zap.String("type", string(outlier.Type)),
+				zap.String("address", outlier.Address),
+				zap.String("label", label.Label))
+			continue
+		}
+
+		var touched []models.AddressLabel
+		if ok {
+			outlier.Details = withDetail(outlier.Details, "address_label", labelDetails(label))
+			touched = append(touched, label)
+		}
+		if counterparty, _ := outlier.Details["counterparty"].(string); counterparty != "" {
+			if label, ok := l.labels[models.NormalizeAddress(counterparty)]; ok {
+				outlier.Details["counterparty_label"] = labelDetails(label)
+				touched = append(touched, label)
+			}
+		}
+		if members, _ := outlier.Details["members"].([]string); len(members) > 0 {
+			memberLabels := make(map[string]interface{})
+			for _, member := range members {
+				if label, ok := l.labels[models.NormalizeAddress(member)]; ok {
+					memberLabels[member] = labelDetails(label)
+					touched = append(touched, label)
+				}
+			}
+			if len(memberLabels) > 0 {
+				outlier.Details["member_labels"] = memberLabels
+			}
+		}
+
+		for _, label := range touched {
+			if l.escalate[label.Category] {
+				outlier.Severity = escalateSeverity(outlier.Severity)
+				outlier.Details["escalated_by_label"] = string(label.Category)
+				break
+			}
+		}
+
+		kept = append(kept, outlier)
+	}
+	return kept
+}
+
+// labelDetails is how a label appears in outlier details
+func labelDetails(label models.AddressLabel) map[string]interface{} {
+	return map[string]interface{}{
+		"label":    label.Label,
+		"category": string(label.Category),
+		"source":   label.Source,
+	}
+}
+
+// withDetail sets key in details, creating the map if needed
+func withDetail(details map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	if details == nil {
+		details = make(map[string]interface{})
+	}
+	details[key] = value
+	return details
+}
+
+// escalateSeverity returns the next severity up, critical staying critical
+func escalateSeverity(severity models.Severity) models.Severity {
+	switch severity {
+	case models.SeverityLow:
+		return models.SeverityMedium
+	case models.SeverityMedium:
+		return models.SeverityHigh
+	default:
+		return models.SeverityCritical
+	}
+}
@@ -3,10 +3,12 @@ package detection
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/internal/metrics"
 	"github.com/mikedewar/stablerisk/pkg/models"
 	"go.uber.org/zap"
 )
@@ -21,6 +23,22 @@ type PatternDetector struct {
 	dormancyPeriod       time.Duration // Period of inactivity before dormant
 	velocityWindow       time.Duration // Time window for velocity calculation
 	velocityThreshold    int           // Number of transactions in window
+	ignoreUnconfirmed    bool          // Leave unconfirmed transfers out of velocity counts
+	clusterWindow        time.Duration // Time window for finding communities
+	clusterMinSize       int           // Smallest community worth flagging
+	clusterMinDensity    float64       // Share of member pairs that must have transacted
+	fanWindow            time.Duration // Time window for counting fan-out/fan-in counterparties
+	disabled             map[models.OutlierType]bool
+
+	mu       sync.RWMutex
+	fallback *graph.MemoryGraph // Queried when Raphtory fails its health check; nil disables
+}
+
+// graphSource answers the per-address activity queries that velocity and
+// fan-out/fan-in detection need. Both RaphtoryClient and MemoryGraph
+// implement it.
+type graphSource interface {
+	GetAddressActivity(ctx context.Context, window graph.Window, minCount int) ([]graph.AddressActivity, error)
 }
 
 // PatternDetectorConfig holds configuration for pattern detector
@@ -31,6 +49,12 @@ type PatternDetectorConfig struct {
 	DormancyPeriod    time.Duration
 	VelocityWindow    time.Duration
 	VelocityThreshold int
+	IgnoreUnconfirmed bool
+	ClusterWindow     time.Duration
+	ClusterMinSize    int
+	ClusterMinDensity float64
+	FanWindow         time.Duration // Defaults to 24 hours
+	Disabled          map[models.OutlierType]bool // Pattern types not detected
 }
 
 // NewPatternDetector creates a new pattern detector
@@ -39,6 +63,10 @@ func NewPatternDetector(config PatternDetectorConfig, raphtoryClient *graph.Raph
 		logger = zap.NewNop()
 	}
 
+	if config.FanWindow <= 0 {
+		config.FanWindow = 24 * time.Hour
+	}
+
 	return &PatternDetector{
 		raphtoryClient:    raphtoryClient,
 		logger:            logger,
@@ -48,47 +76,106 @@ func NewPatternDetector(config PatternDetectorConfig, raphtoryClient *graph.Raph
 		dormancyPeriod:    config.DormancyPeriod,
 		velocityWindow:    config.VelocityWindow,
 		velocityThreshold: config.VelocityThreshold,
+		ignoreUnconfirmed: config.IgnoreUnconfirmed,
+		clusterWindow:     config.ClusterWindow,
+		clusterMinSize:    config.ClusterMinSize,
+		clusterMinDensity: config.ClusterMinDensity,
+		fanWindow:         config.FanWindow,
+		disabled:          config.Disabled,
+	}
+}
+
+// SetFallback sets the in-memory graph that velocity and fan-out/fan-in
+// detection read while Raphtory fails its health check
+func (d *PatternDetector) SetFallback(fallback *graph.MemoryGraph) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.fallback = fallback
+}
+
+// source returns Raphtory while it passes its health check, otherwise the
+// fallback graph if one is set. The second result reports whether the
+// fallback was chosen.
+func (d *PatternDetector) source(ctx context.Context) (graphSource, bool) {
+	d.mu.RLock()
+	fallback := d.fallback
+	d.mu.RUnlock()
+
+	if fallback == nil {
+		return d.raphtoryClient, false
+	}
+	if err := d.raphtoryClient.Health(ctx); err != nil {
+		d.logger.Warn("Raphtory unavailable, detecting patterns from the in-memory graph",
+			zap.Error(err),
+			zap.Int("transactions", fallback.Len()))
+		metrics.DetectionGraphFallback.WithLabelValues().Set(1)
+		return fallback, true
 	}
+	metrics.DetectionGraphFallback.WithLabelValues().Set(0)
+	return d.raphtoryClient, false
 }
 
-// DetectAll runs all pattern detection algorithms
+// DetectAll runs all pattern detection algorithms. When Raphtory is down and
+// a fallback graph is set, only velocity and fan-out/fan-in detection run,
+// against the fallback.
 func (d *PatternDetector) DetectAll(ctx context.Context) ([]models.Outlier, error) {
 	var allOutliers []models.Outlier
 
+	source, degraded := d.source(ctx)
+
 	// Detect circulation patterns
-	circulation, err := d.DetectCirculation(ctx)
-	if err != nil {
-		d.logger.Error("Failed to detect circulation patterns", zap.Error(err))
-	} else {
-		allOutliers = append(allOutliers, circulation...)
+	if !degraded && !d.disabled[models.OutlierTypePatternCirculation] {
+		circulation, err := d.DetectCirculation(ctx)
+		if err != nil {
+			d.logger.Error("Failed to detect circulation patterns", zap.Error(err))
+		} else {
+			allOutliers = append(allOutliers, circulation...)
+		}
 	}
 
 	// Detect fan-out patterns
-	fanOut, err := d.DetectFanOut(ctx)
-	if err != nil {
-		d.logger.Error("Failed to detect fan-out patterns", zap.Error(err))
-	} else {
-		allOutliers = append(allOutliers, fanOut...)
+	if !d.disabled[models.OutlierTypePatternFanOut] {
+		fanOut, err := d.detectFan(ctx, source, graph.DegreeOut)
+		if err != nil {
+			d.logger.Error("Failed to detect fan-out patterns", zap.Error(err))
+		} else {
+			allOutliers = append(allOutliers, fanOut...)
+		}
 	}
 
 	// Detect fan-in patterns
-	fanIn, err := d.DetectFanIn(ctx)
-	if err != nil {
-		d.logger.Error("Failed to detect fan-in patterns", zap.Error(err))
-	} else {
-		allOutliers = append(allOutliers, fanIn...)
+	if !d.disabled[models.OutlierTypePatternFanIn] {
+		fanIn, err := d.detectFan(ctx, source, graph.DegreeIn)
+		if err != nil {
+			d.logger.Error("Failed to detect fan-in patterns", zap.Error(err))
+		} else {
+			allOutliers = append(allOutliers, fanIn...)
+		}
 	}
 
 	// Detect velocity patterns
-	velocity, err := d.DetectVelocity(ctx)
-	if err != nil {
-		d.logger.Error("Failed to detect velocity patterns", zap.Error(err))
-	} else {
-		allOutliers = append(allOutliers, velocity...)
+	if !d.disabled[models.OutlierTypePatternVelocity] {
+		velocity, err := d.detectVelocity(ctx, source)
+		if err != nil {
+			d.logger.Error("Failed to detect velocity patterns", zap.Error(err))
+		} else {
+			allOutliers = append(allOutliers, velocity...)
+		}
+	}
+
+	// Detect suspicious communities
+	if !degraded && !d.disabled[models.OutlierTypePatternCluster] {
+		clusters, err := d.DetectClusters(ctx)
+		if err != nil {
+			d.logger.Error("Failed to detect cluster patterns", zap.Error(err))
+		} else {
+			allOutliers = append(allOutliers, clusters...)
+		}
 	}
 
 	d.logger.Info("Pattern detection completed",
-		zap.Int("total_outliers", len(allOutliers)))
+		zap.Int("total_outliers", len(allOutliers)),
+		zap.Bool("fallback_graph", degraded))
 
 	return allOutliers, nil
 }
@@ -108,32 +195,78 @@ func (d *PatternDetector) DetectCirculation(ctx context.Context) ([]models.Outli
 
 // DetectFanOut detects fan-out patterns (one sender → many receivers)
 func (d *PatternDetector) DetectFanOut(ctx context.Context) ([]models.Outlier, error) {
-	d.logger.Debug("Detecting fan-out patterns",
-		zap.Int("threshold", d.fanOutThreshold))
-
-	// This would query Raphtory for nodes with high out-degree
-	// indicating potential fund distribution
-
-	// Placeholder implementation
-	// TODO: Query graph for nodes with out-degree > fanOutThreshold
-	// within a time window
-
-	return nil, nil
+	return d.detectFan(ctx, d.raphtoryClient, graph.DegreeOut)
 }
 
 // DetectFanIn detects fan-in patterns (many senders → one receiver)
 func (d *PatternDetector) DetectFanIn(ctx context.Context) ([]models.Outlier, error) {
-	d.logger.Debug("Detecting fan-in patterns",
-		zap.Int("threshold", d.fanInThreshold))
+	return d.detectFan(ctx, d.raphtoryClient, graph.DegreeIn)
+}
 
-	// This would query Raphtory for nodes with high in-degree
-	// indicating potential fund collection
+// detectFan flags addresses with more distinct receivers (DegreeOut) or
+// senders (DegreeIn) than the threshold within fanWindow, indicating funds
+// being distributed or collected
+func (d *PatternDetector) detectFan(ctx context.Context, source graphSource, direction graph.DegreeDirection) ([]models.Outlier, error) {
+	outlierType, pattern, threshold := models.OutlierTypePatternFanOut, "fan_out", d.fanOutThreshold
+	if direction == graph.DegreeIn {
+		outlierType, pattern, threshold = models.OutlierTypePatternFanIn, "fan_in", d.fanInThreshold
+	}
 
-	// Placeholder implementation
-	// TODO: Query graph for nodes with in-degree > fanInThreshold
-	// within a time window
+	d.logger.Debug("Detecting fan patterns",
+		zap.String("pattern", pattern),
+		zap.Duration("window", d.fanWindow),
+		zap.Int("threshold", threshold))
 
-	return nil, nil
+	if threshold <= 0 {
+		return nil, nil
+	}
+
+	// Each counterparty needs a transaction, so addresses with threshold or
+	// fewer transactions can be left out by Raphtory
+	end := time.Now()
+	nodes, err := source.GetAddressActivity(ctx, graph.Window{Start: end.Add(-d.fanWindow), End: end}, threshold+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get address activity: %w", err)
+	}
+
+	var outliers []models.Outlier
+	for _, node := range nodes {
+		degree, count, amount := node.OutDegree, node.OutCount, node.Sent
+		if direction == graph.DegreeIn {
+			degree, count, amount = node.InDegree, node.InCount, node.Received
+		}
+		if degree <= threshold {
+			continue
+		}
+
+		outlier := models.Outlier{
+			ID:         uuid.New().String(),
+			DetectedAt: time.Now(),
+			Type:       outlierType,
+			Severity:   d.calculateRatioSeverity(degree, threshold),
+			Address:    node.Address,
+			Amount:     amount,
+			Details: map[string]interface{}{
+				"counterparties":    degree,
+				"transaction_count": count,
+				"amount":            amount.String(),
+				"threshold":         threshold,
+				"time_window":       d.fanWindow.String(),
+				"pattern":           pattern,
+			},
+			Status:       models.OutlierStatusOpen,
+			Acknowledged: false,
+		}
+
+		outliers = append(outliers, outlier)
+
+		d.logger.Info("Fan pattern detected",
+			zap.String("pattern", pattern),
+			zap.String("address", node.Address),
+			zap.Int("counterparties", degree))
+	}
+
+	return outliers, nil
 }
 
 // DetectDormantAwakening detects dormant addresses that suddenly become active
@@ -171,6 +304,7 @@ func (d *PatternDetector) DetectDormantAwakening(ctx context.Context, address st
 				"transaction_count": nodeInfo.TransactionCount,
 				"pattern":           "dormant_awakening",
 			},
+			Status:       models.OutlierStatusOpen,
 			Acknowledged: false,
 		}
 
@@ -186,49 +320,40 @@ func (d *PatternDetector) DetectDormantAwakening(ctx context.Context, address st
 
 // DetectVelocity detects high transaction velocity (many transactions in short time)
 func (d *PatternDetector) DetectVelocity(ctx context.Context) ([]models.Outlier, error) {
+	return d.detectVelocity(ctx, d.raphtoryClient)
+}
+
+// detectVelocity counts each address's transactions in velocityWindow from source
+func (d *PatternDetector) detectVelocity(ctx context.Context, source graphSource) ([]models.Outlier, error) {
 	d.logger.Debug("Detecting velocity patterns",
 		zap.Duration("window", d.velocityWindow),
 		zap.Int("threshold", d.velocityThreshold))
 
-	// Query recent transactions from Raphtory
-	endTime := time.Now().Unix()
-	startTime := time.Now().Add(-d.velocityWindow).Unix()
-
-	transactions, err := d.raphtoryClient.GetTransactionsInWindow(ctx, startTime, endTime, 10000)
+	// Raphtory totals each address's transactions in the window, leaving out
+	// addresses that cannot exceed the threshold
+	end := time.Now()
+	nodes, err := source.GetAddressActivity(ctx, graph.Window{Start: end.Add(-d.velocityWindow), End: end}, d.velocityThreshold+1)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get transactions: %w", err)
-	}
-
-	// Group transactions by address
-	addressTxCounts := make(map[string]int)
-	addressFirstTx := make(map[string]models.Transaction)
-
-	for _, tx := range transactions {
-		addressTxCounts[tx.From]++
-		addressTxCounts[tx.To]++
-
-		if _, exists := addressFirstTx[tx.From]; !exists {
-			addressFirstTx[tx.From] = tx
-		}
-		if _, exists := addressFirstTx[tx.To]; !exists {
-			addressFirstTx[tx.To] = tx
-		}
+		return nil, fmt.Errorf("failed to get address activity: %w", err)
 	}
 
 	// Detect addresses with high velocity
 	var outliers []models.Outlier
-	for address, count := range addressTxCounts {
+	for _, node := range nodes {
+		count := node.TransactionCount()
+		if d.ignoreUnconfirmed {
+			count -= node.UnconfirmedCount
+		}
 		if count > d.velocityThreshold {
-			tx := addressFirstTx[address]
-			severity := d.calculateVelocitySeverity(count, d.velocityThreshold)
+			severity := d.calculateRatioSeverity(count, d.velocityThreshold)
 
 			outlier := models.Outlier{
 				ID:              uuid.New().String(),
 				DetectedAt:      time.Now(),
 				Type:            models.OutlierTypePatternVelocity,
 				Severity:        severity,
-				Address:         address,
-				TransactionHash: tx.TxHash,
+				Address:         node.Address,
+				TransactionHash: node.FirstTxHash,
 				Details: map[string]interface{}{
 					"transaction_count": count,
 					"time_window":       d.velocityWindow.String(),
@@ -236,13 +361,14 @@ func (d *PatternDetector) DetectVelocity(ctx context.Context) ([]models.Outlier,
 					"velocity":          float64(count) / d.velocityWindow.Hours(),
 					"pattern":           "high_velocity",
 				},
+				Status:       models.OutlierStatusOpen,
 				Acknowledged: false,
 			}
 
 			outliers = append(outliers, outlier)
 
 			d.logger.Info("High velocity detected",
-				zap.String("address", address),
+				zap.String("address", node.Address),
 				zap.Int("transaction_count", count),
 				zap.Duration("window", d.velocityWindow))
 		}
@@ -251,6 +377,94 @@ func (d *PatternDetector) DetectVelocity(ctx context.Context) ([]models.Outlier,
 	return outliers, nil
 }
 
+// DetectClusters detects tightly-knit communities whose transfers either
+// loop between members (circular flow) or enter and leave through a single
+// address each (a funnel)
+func (d *PatternDetector) DetectClusters(ctx context.Context) ([]models.Outlier, error) {
+	d.logger.Debug("Detecting cluster patterns",
+		zap.Duration("window", d.clusterWindow),
+		zap.Int("min_size", d.clusterMinSize),
+		zap.Float64("min_density", d.clusterMinDensity))
+
+	end := time.Now()
+	communities, err := d.raphtoryClient.GetCommunities(ctx, graph.Window{Start: end.Add(-d.clusterWindow), End: end})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get communities: %w", err)
+	}
+
+	var outliers []models.Outlier
+	for _, community := range communities {
+		if community.Size < d.clusterMinSize || community.Density < d.clusterMinDensity {
+			continue
+		}
+
+		// A funnel is reported at its entry; a loop at its first member
+		var pattern, address string
+		switch {
+		case community.HasCycle:
+			pattern, address = "circular_cluster", community.Members[0]
+		case len(community.EntryPoints) == 1 && len(community.ExitPoints) == 1:
+			pattern, address = "funnel_cluster", community.EntryPoints[0]
+		default:
+			continue
+		}
+
+		outlier := models.Outlier{
+			ID:         uuid.New().String(),
+			DetectedAt: time.Now(),
+			Type:       models.OutlierTypePatternCluster,
+			Severity:   d.calculateClusterSeverity(community),
+			Address:    address,
+			Amount:     community.InternalAmount,
+			Details: map[string]interface{}{
+				"members":         community.Members,
+				"size":            community.Size,
+				"density":         community.Density,
+				"internal_count":  community.InternalCount,
+				"internal_amount": community.InternalAmount.String(),
+				"entry_points":    community.EntryPoints,
+				"exit_points":     community.ExitPoints,
+				"inflow":          community.Inflow.String(),
+				"outflow":         community.Outflow.String(),
+				"has_cycle":       community.HasCycle,
+				"first_seen":      time.Unix(community.FirstSeen, 0),
+				"last_seen":       time.Unix(community.LastSeen, 0),
+				"time_window":     d.clusterWindow.String(),
+				"pattern":         pattern,
+			},
+			Status:       models.OutlierStatusOpen,
+			Acknowledged: false,
+		}
+
+		outliers = append(outliers, outlier)
+
+		d.logger.Info("Suspicious cluster detected",
+			zap.String("pattern", pattern),
+			zap.String("address", address),
+			zap.Int("size", community.Size),
+			zap.Float64("density", community.Density))
+	}
+
+	return outliers, nil
+}
+
+// calculateClusterSeverity calculates severity for a flagged community from
+// its size and how densely its members transact
+func (d *PatternDetector) calculateClusterSeverity(community graph.Community) models.Severity {
+	score := float64(community.Size) * community.Density
+
+	switch {
+	case score >= 10:
+		return models.SeverityCritical
+	case score >= 5:
+		return models.SeverityHigh
+	case score >= 2:
+		return models.SeverityMedium
+	default:
+		return models.SeverityLow
+	}
+}
+
 // calculateDormantSeverity calculates severity for dormant awakening
 func (d *PatternDetector) calculateDormantSeverity(dormancy time.Duration) models.Severity {
 	days := dormancy.Hours() / 24
@@ -267,8 +481,9 @@ func (d *PatternDetector) calculateDormantSeverity(dormancy time.Duration) model
 	}
 }
 
-// calculateVelocitySeverity calculates severity for high velocity
-func (d *PatternDetector) calculateVelocitySeverity(count, threshold int) models.Severity {
+// calculateRatioSeverity calculates severity from how far a count exceeds
+// its threshold, for velocity and fan-out/fan-in
+func (d *PatternDetector) calculateRatioSeverity(count, threshold int) models.Severity {
 	ratio := float64(count) / float64(threshold)
 
 	switch {
@@ -0,0 +1,123 @@
+package detection
+
+import (
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// P2Quantile estimates a single quantile of a stream in constant memory using
+// the P² algorithm (Jain & Chlamtac, 1985). Five markers track the minimum,
+// the target quantile, the midpoints either side of it and the maximum; their
+// heights are adjusted with piecewise-parabolic interpolation as values arrive.
+type P2Quantile struct {
+	p       float64
+	count   int
+	heights [5]float64 // Marker heights
+	pos     [5]float64 // Actual marker positions (1-based)
+	desired [5]float64 // Desired marker positions
+	incr    [5]float64 // Desired position increments per observation
+}
+
+// NewP2Quantile creates an estimator for quantile p (0 < p < 1)
+func NewP2Quantile(p float64) *P2Quantile {
+	return &P2Quantile{
+		p:    p,
+		incr: [5]float64{0, p / 2, p, (1 + p) / 2, 1},
+	}
+}
+
+// Add adds an observation to the estimator
+func (q *P2Quantile) Add(x float64) {
+	// The first five observations initialise the markers
+	if q.count < 5 {
+		q.heights[q.count] = x
+		q.count++
+		if q.count == 5 {
+			sort.Float64s(q.heights[:])
+			for i := range q.pos {
+				q.pos[i] = float64(i + 1)
+			}
+			q.desired = [5]float64{1, 1 + 2*q.p, 1 + 4*q.p, 3 + 2*q.p, 5}
+		}
+		return
+	}
+	q.count++
+
+	// Find the cell k such that heights[k] <= x < heights[k+1], extending
+	// the extremes if needed
+	var k int
+	switch {
+	case x < q.heights[0]:
+		q.heights[0] = x
+		k = 0
+	case x >= q.heights[4]:
+		q.heights[4] = x
+		k = 3
+	default:
+		for k = 0; k < 3; k++ {
+			if x < q.heights[k+1] {
+				break
+			}
+		}
+	}
+
+	for i := k + 1; i < 5; i++ {
+		q.pos[i]++
+	}
+	for i := range q.desired {
+		q.desired[i] += q.incr[i]
+	}
+
+	// Adjust the middle markers if they have drifted from their desired positions
+	for i := 1; i <= 3; i++ {
+		d := q.desired[i] - q.pos[i]
+		if (d >= 1 && q.pos[i+1]-q.pos[i] > 1) || (d <= -1 && q.pos[i-1]-q.pos[i] < -1) {
+			step := math.Copysign(1, d)
+			h := q.parabolic(i, step)
+			if q.heights[i-1] < h && h < q.heights[i+1] {
+				q.heights[i] = h
+			} else {
+				q.heights[i] = q.linear(i, step)
+			}
+			q.pos[i] += step
+		}
+	}
+}
+
+// Value returns the current quantile estimate
+func (q *P2Quantile) Value() float64 {
+	if q.count == 0 {
+		return 0
+	}
+
+	// Exact quantile until the markers are initialised
+	if q.count < 5 {
+		values := make([]float64, q.count)
+		copy(values, q.heights[:q.count])
+		sort.Float64s(values)
+		return stat.Quantile(q.p, stat.Empirical, values, nil)
+	}
+
+	return q.heights[2]
+}
+
+// Count returns the number of observations added
+func (q *P2Quantile) Count() int {
+	return q.count
+}
+
+// parabolic computes the piecewise-parabolic prediction for marker i
+func (q *P2Quantile) parabolic(i int, d float64) float64 {
+	n, h := q.pos, q.heights
+	return h[i] + d/(n[i+1]-n[i-1])*
+		((n[i]-n[i-1]+d)*(h[i+1]-h[i])/(n[i+1]-n[i])+
+			(n[i+1]-n[i]-d)*(h[i]-h[i-1])/(n[i]-n[i-1]))
+}
+
+// linear computes the linear prediction for marker i
+func (q *P2Quantile) linear(i int, d float64) float64 {
+	j := i + int(d)
+	return q.heights[i] + d*(q.heights[j]-q.heights[i])/(q.pos[j]-q.pos[i])
+}
@@ -0,0 +1,205 @@
+package detection
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Detector versions recorded with each run. Bump a version when the
+// detector's scoring changes so historical results can be compared.
+const (
+	ZScoreDetectorVersion  = "1.1.0"
+	IQRDetectorVersion     = "1.1.0"
+	DBSCANDetectorVersion  = "1.0.0"
+	PatternDetectorVersion = "1.0.0"
+)
+
+// RunRecorder persists detection run history
+type RunRecorder interface {
+	RecordRun(ctx context.Context, run *models.DetectionRun) error
+}
+
+// RunStore records detection runs in the detection_runs table
+type RunStore struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewRunStore creates a new detection run store
+func NewRunStore(db *sql.DB, logger *zap.Logger) *RunStore {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &RunStore{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// RecordRun inserts a run, or updates it if it was already recorded when it started
+func (s *RunStore) RecordRun(ctx context.Context, run *models.DetectionRun) error {
+	versionsJSON, err := json.Marshal(run.DetectorVersions)
+	if err != nil {
+		return fmt.Errorf("failed to marshal detector versions: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO detection_runs (id, trigger, triggered_by, status, started_at, completed_at,
+		                            window_start, window_end, transactions_analyzed, outliers_found,
+		                            duration_ms, detector_versions, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (id) DO UPDATE
+		SET status = EXCLUDED.status,
+		    completed_at = EXCLUDED.completed_at,
+		    transactions_analyzed = EXCLUDED.transactions_analyzed,
+		    outliers_found = EXCLUDED.outliers_found,
+		    duration_ms = EXCLUDED.duration_ms,
+		    error = EXCLUDED.error
+	`,
+		run.ID,
+		run.Trigger,
+		nullString(run.TriggeredBy),
+		run.Status,
+		run.StartedAt,
+		run.CompletedAt,
+		run.WindowStart,
+		run.WindowEnd,
+		run.TransactionsAnalyzed,
+		run.OutliersFound,
+		run.DurationMs,
+		versionsJSON,
+		nullString(run.Error),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record detection run: %w", err)
+	}
+
+	return nil
+}
+
+// nullString converts empty strings to NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{
+		String: s,
+		Valid:  s != "",
+	}
+}
+
+// startRun records the beginning of a detection cycle
+func (d *AnomalyDetector) startRun(detectors *detectorSet, trigger models.DetectionRunTrigger, triggeredBy string, windowStart, windowEnd time.Time) *models.DetectionRun {
+	run := &models.DetectionRun{
+		ID:               uuid.New().String(),
+		Trigger:          trigger,
+		TriggeredBy:      triggeredBy,
+		Status:           models.DetectionRunRunning,
+		StartedAt:        time.Now(),
+		WindowStart:      windowStart,
+		WindowEnd:        windowEnd,
+		DetectorVersions: detectors.versions(),
+	}
+
+	if trigger == models.DetectionRunScheduled {
+		d.mu.Lock()
+		d.cycleInProgress = true
+		d.mu.Unlock()
+	}
+
+	d.recordRun(run)
+	return run
+}
+
+// finishRun records the outcome of a detection cycle
+func (d *AnomalyDetector) finishRun(run *models.DetectionRun, transactions, outliers int, err error) {
+	completed := time.Now()
+	run.CompletedAt = &completed
+	run.DurationMs = completed.Sub(run.StartedAt).Milliseconds()
+	run.TransactionsAnalyzed = transactions
+	run.OutliersFound = outliers
+
+	if err != nil {
+		run.Status = models.DetectionRunFailed
+		run.Error = err.Error()
+	} else {
+		run.Status = models.DetectionRunCompleted
+	}
+	metrics.DetectionCycleDuration.WithLabelValues(string(run.Trigger), string(run.Status)).
+		Observe(completed.Sub(run.StartedAt).Seconds())
+
+	if run.Trigger == models.DetectionRunScheduled {
+		finished := *run
+		d.mu.Lock()
+		d.cycleInProgress = false
+		d.lastCycle = &finished
+		d.mu.Unlock()
+	}
+
+	d.recordRun(run)
+}
+
+// recordRun persists a run. Failures are logged rather than failing detection,
+// and a fresh context is used so runs cancelled mid-cycle are still recorded.
+func (d *AnomalyDetector) recordRun(run *models.DetectionRun) {
+	d.mu.RLock()
+	recorder := d.runRecorder
+	d.mu.RUnlock()
+
+	if recorder == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := recorder.RecordRun(ctx, run); err != nil {
+		d.logger.Warn("Failed to record detection run",
+			zap.String("run_id", run.ID),
+			zap.Error(err))
+	}
+}
+
+// versions returns the versions of the enabled detectors
+func (s *detectorSet) versions() map[string]string {
+	versions := map[string]string{
+		"pattern": PatternDetectorVersion,
+	}
+	if s.zscore != nil {
+		versions[string(models.OutlierTypeZScore)] = ZScoreDetectorVersion
+	}
+	if s.iqr != nil {
+		versions[string(models.OutlierTypeIQR)] = IQRDetectorVersion
+	}
+	if s.dbscan != nil {
+		versions[string(models.OutlierTypeDBSCAN)] = DBSCANDetectorVersion
+	}
+	return versions
+}
+
+// CycleStatus describes the scheduled detection loop
+type CycleStatus struct {
+	Running    bool                 // The loop has been started and not stopped
+	InProgress bool                 // A cycle is running now
+	LastCycle  *models.DetectionRun // The last finished cycle; nil before the first
+}
+
+// CycleStatus reports whether the detection loop is running and how its
+// last cycle went
+func (d *AnomalyDetector) CycleStatus() CycleStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	status := CycleStatus{Running: d.running, InProgress: d.cycleInProgress}
+	if d.lastCycle != nil {
+		last := *d.lastCycle
+		status.LastCycle = &last
+	}
+	return status
+}
@@ -0,0 +1,309 @@
+package detection
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// ConfigurableDetectors are the detectors Settings can enable and disable,
+// by the outlier type each raises
+var ConfigurableDetectors = []models.OutlierType{
+	models.OutlierTypeZScore,
+	models.OutlierTypeIQR,
+	models.OutlierTypeDBSCAN,
+	models.OutlierTypePatternCirculation,
+	models.OutlierTypePatternFanOut,
+	models.OutlierTypePatternFanIn,
+	models.OutlierTypePatternVelocity,
+	models.OutlierTypePatternCluster,
+}
+
+// Settings are the detection thresholds, windows and enabled detectors,
+// which can be changed while the detector runs
+type Settings struct {
+	Enabled           map[models.OutlierType]bool `json:"enabled"` // Every ConfigurableDetectors type
+	MinDataPoints     int                         `json:"min_data_points"`
+	WindowDuration    time.Duration               `json:"window_duration"` // Z-score, IQR and DBSCAN
+	ZScoreThreshold   float64                     `json:"zscore_threshold"`
+	IQRMultiplier     float64                     `json:"iqr_multiplier"`
+	DBSCANEpsilon     float64                     `json:"dbscan_epsilon"`
+	DBSCANMinPoints   int                         `json:"dbscan_min_points"`
+	CirculationWindow time.Duration               `json:"circulation_window"`
+	FanWindow         time.Duration               `json:"fan_window"`
+	FanOutThreshold   int                         `json:"fan_out_threshold"`
+	FanInThreshold    int                         `json:"fan_in_threshold"`
+	VelocityWindow    time.Duration               `json:"velocity_window"`
+	VelocityThreshold int                         `json:"velocity_threshold"`
+	ClusterWindow     time.Duration               `json:"cluster_window"`
+	ClusterMinSize    int                         `json:"cluster_min_size"`
+	ClusterMinDensity float64                     `json:"cluster_min_density"`
+}
+
+// Validate checks that every threshold and window is usable
+func (s Settings) Validate() error {
+	known := make(map[models.OutlierType]bool, len(ConfigurableDetectors))
+	for _, outlierType := range ConfigurableDetectors {
+		known[outlierType] = true
+	}
+	for outlierType := range s.Enabled {
+		if !known[outlierType] {
+			return fmt.Errorf("%s is not a configurable detector", outlierType)
+		}
+	}
+
+	for _, check := range []struct {
+		name string
+		ok   bool
+	}{
+		{"min_data_points", s.MinDataPoints > 0},
+		{"window_duration", s.WindowDuration > 0},
+		{"zscore_threshold", s.ZScoreThreshold > 0},
+		{"iqr_multiplier", s.IQRMultiplier > 0},
+		{"dbscan_epsilon", s.DBSCANEpsilon > 0},
+		{"dbscan_min_points", s.DBSCANMinPoints > 0},
+		{"circulation_window", s.CirculationWindow > 0},
+		{"fan_window", s.FanWindow > 0},
+		{"fan_out_threshold", s.FanOutThreshold > 0},
+		{"fan_in_threshold", s.FanInThreshold > 0},
+		{"velocity_window", s.VelocityWindow > 0},
+		{"velocity_threshold", s.VelocityThreshold > 0},
+		{"cluster_window", s.ClusterWindow > 0},
+		{"cluster_min_size", s.ClusterMinSize > 1},
+		{"cluster_min_density", s.ClusterMinDensity > 0 && s.ClusterMinDensity <= 1},
+	} {
+		if !check.ok {
+			return fmt.Errorf("%s is out of range", check.name)
+		}
+	}
+	return nil
+}
+
+// Settings returns the settings in effect
+func (d *AnomalyDetector) Settings() Settings {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	config := d.config
+	enabled := make(map[models.OutlierType]bool, len(ConfigurableDetectors))
+	for _, outlierType := range ConfigurableDetectors {
+		enabled[outlierType] = !config.Disabled[outlierType]
+	}
+	enabled[models.OutlierTypeDBSCAN] = enabled[models.OutlierTypeDBSCAN] && config.DBSCANEnabled
+
+	return Settings{
+		Enabled:           enabled,
+		MinDataPoints:     config.ZScoreConfig.MinDataPoints,
+		WindowDuration:    config.ZScoreConfig.WindowDuration,
+		ZScoreThreshold:   config.ZScoreConfig.Threshold,
+		IQRMultiplier:     config.IQRConfig.Multiplier,
+		DBSCANEpsilon:     config.DBSCANConfig.Epsilon,
+		DBSCANMinPoints:   config.DBSCANConfig.MinPoints,
+		CirculationWindow: config.PatternDetectorConfig.CirculationWindow,
+		FanWindow:         config.PatternDetectorConfig.FanWindow,
+		FanOutThreshold:   config.PatternDetectorConfig.FanOutThreshold,
+		FanInThreshold:    config.PatternDetectorConfig.FanInThreshold,
+		VelocityWindow:    config.PatternDetectorConfig.VelocityWindow,
+		VelocityThreshold: config.PatternDetectorConfig.VelocityThreshold,
+		ClusterWindow:     config.PatternDetectorConfig.ClusterWindow,
+		ClusterMinSize:    config.PatternDetectorConfig.ClusterMinSize,
+		ClusterMinDensity: config.PatternDetectorConfig.ClusterMinDensity,
+	}
+}
+
+// ApplySettings changes detection from the next cycle; a cycle already
+// running finishes with the settings it started with. Detectors missing
+// from settings.Enabled keep their state, and detectors whose settings are
+// unchanged keep what they have learned, such as IQR's streaming quartiles.
+func (d *AnomalyDetector) ApplySettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	config := d.config
+	disabled := make(map[models.OutlierType]bool)
+	for outlierType, off := range config.Disabled {
+		disabled[outlierType] = off
+	}
+	for outlierType, on := range settings.Enabled {
+		disabled[outlierType] = !on
+	}
+	if settings.Enabled[models.OutlierTypeDBSCAN] {
+		config.DBSCANEnabled = true
+	}
+	config.Disabled = disabled
+
+	config.ZScoreConfig.Threshold = settings.ZScoreThreshold
+	config.ZScoreConfig.MinDataPoints = settings.MinDataPoints
+	config.ZScoreConfig.WindowDuration = settings.WindowDuration
+	config.IQRConfig.Multiplier = settings.IQRMultiplier
+	config.IQRConfig.MinDataPoints = settings.MinDataPoints
+	config.IQRConfig.WindowDuration = settings.WindowDuration
+	config.DBSCANConfig.Epsilon = settings.DBSCANEpsilon
+	config.DBSCANConfig.MinPoints = settings.DBSCANMinPoints
+	config.DBSCANConfig.MinAddresses = settings.MinDataPoints
+	config.DBSCANConfig.WindowDuration = settings.WindowDuration
+	config.PatternDetectorConfig.CirculationWindow = settings.CirculationWindow
+	config.PatternDetectorConfig.FanWindow = settings.FanWindow
+	config.PatternDetectorConfig.FanOutThreshold = settings.FanOutThreshold
+	config.PatternDetectorConfig.FanInThreshold = settings.FanInThreshold
+	config.PatternDetectorConfig.VelocityWindow = settings.VelocityWindow
+	config.PatternDetectorConfig.VelocityThreshold = settings.VelocityThreshold
+	config.PatternDetectorConfig.ClusterWindow = settings.ClusterWindow
+	config.PatternDetectorConfig.ClusterMinSize = settings.ClusterMinSize
+	config.PatternDetectorConfig.ClusterMinDensity = settings.ClusterMinDensity
+
+	detectors := d.newDetectorSet(config)
+	if detectors.zscore != nil && d.detectors.zscore != nil && config.ZScoreConfig == d.config.ZScoreConfig {
+		detectors.zscore = d.detectors.zscore
+	}
+	if detectors.iqr != nil && d.detectors.iqr != nil && config.IQRConfig == d.config.IQRConfig {
+		detectors.iqr = d.detectors.iqr
+	}
+	if detectors.dbscan != nil && d.detectors.dbscan != nil && config.DBSCANConfig == d.config.DBSCANConfig {
+		detectors.dbscan = d.detectors.dbscan
+	}
+
+	d.config = config
+	d.detectors = detectors
+
+	d.logger.Info("Detection settings applied",
+		zap.Float64("zscore_threshold", settings.ZScoreThreshold),
+		zap.Float64("iqr_multiplier", settings.IQRMultiplier),
+		zap.Duration("window_duration", settings.WindowDuration),
+		zap.Any("enabled", settings.Enabled))
+	return nil
+}
+
+// StoredSettings are detection settings as saved, with who saved them
+type StoredSettings struct {
+	Settings
+	Version   int // Incremented by every save
+	UpdatedBy string
+	UpdatedAt time.Time
+}
+
+// SettingsStore persists detection settings in the detection_config table,
+// so changes made through the API reach every running detector
+type SettingsStore struct {
+	db     *sql.DB
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	applied int // Version last applied by Sync
+}
+
+// NewSettingsStore creates a new detection settings store
+func NewSettingsStore(db *sql.DB, logger *zap.Logger) *SettingsStore {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &SettingsStore{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Load returns the saved settings, or nil if none have been saved and the
+// file configuration is in effect
+func (s *SettingsStore) Load(ctx context.Context) (*StoredSettings, error) {
+	var stored StoredSettings
+	var settingsJSON []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT settings, version, updated_by, updated_at
+		FROM detection_config
+		WHERE id = 1
+	`).Scan(&settingsJSON, &stored.Version, &stored.UpdatedBy, &stored.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query detection settings: %w", err)
+	}
+	if err := json.Unmarshal(settingsJSON, &stored.Settings); err != nil {
+		return nil, fmt.Errorf("failed to decode detection settings: %w", err)
+	}
+	return &stored, nil
+}
+
+// Save replaces the saved settings
+func (s *SettingsStore) Save(ctx context.Context, settings Settings, updatedBy string) (*StoredSettings, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode detection settings: %w", err)
+	}
+
+	stored := StoredSettings{
+		Settings:  settings,
+		UpdatedBy: updatedBy,
+		UpdatedAt: time.Now().UTC(),
+	}
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO detection_config (id, settings, version, updated_by, updated_at)
+		VALUES (1, $1, 1, $2, $3)
+		ON CONFLICT (id) DO UPDATE
+		SET settings = EXCLUDED.settings,
+		    version = detection_config.version + 1,
+		    updated_by = EXCLUDED.updated_by,
+		    updated_at = EXCLUDED.updated_at
+		RETURNING version
+	`, string(settingsJSON), updatedBy, stored.UpdatedAt).Scan(&stored.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save detection settings: %w", err)
+	}
+	return &stored, nil
+}
+
+// Sync applies the saved settings to detector if they have changed since
+// the last Sync. Nothing is applied while no settings are saved.
+func (s *SettingsStore) Sync(ctx context.Context, detector *AnomalyDetector) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.Load(ctx)
+	if err != nil || stored == nil || stored.Version == s.applied {
+		return err
+	}
+	if err := detector.ApplySettings(stored.Settings); err != nil {
+		return fmt.Errorf("failed to apply detection settings version %d: %w", stored.Version, err)
+	}
+	s.applied = stored.Version
+
+	s.logger.Info("Detection settings loaded",
+		zap.Int("version", stored.Version),
+		zap.String("updated_by", stored.UpdatedBy),
+		zap.Time("updated_at", stored.UpdatedAt))
+	return nil
+}
+
+// Watch syncs detector every interval until ctx is cancelled. A failed
+// sync keeps the settings already applied.
+func (s *SettingsStore) Watch(ctx context.Context, detector *AnomalyDetector, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Sync(ctx, detector); err != nil && ctx.Err() == nil {
+				s.logger.Error("Failed to sync detection settings", zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package detection
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// ShardTiming records how long one shard of one token's transactions took to
+// score
+type ShardTiming struct {
+	Token        string        `json:"token"`
+	Shard        int           `json:"shard"`
+	Transactions int           `json:"transactions"`
+	Outliers     int           `json:"outliers"`
+	Duration     time.Duration `json:"duration"`
+}
+
+// shardTransactions partitions transactions by a hash of the sender address so
+// every transaction attributed to an address lands in the same shard
+func shardTransactions(transactions []models.Transaction, shards int) [][]models.Transaction {
+	if shards <= 1 {
+		return [][]models.Transaction{transactions}
+	}
+
+	result := make([][]models.Transaction, shards)
+	for _, tx := range transactions {
+		h := fnv.New32a()
+		h.Write([]byte(tx.From))
+		shard := int(h.Sum32() % uint32(shards))
+		result[shard] = append(result[shard], tx)
+	}
+	return result
+}
+
+// detectStatistical runs Z-score and IQR detection over one token's
+// transactions. Baselines are computed once over the full window, then shards
+// are scored by a bounded worker pool so results are identical to a single
+// pass regardless of shard count. Scheduled cycles set streaming so IQR
+// quartiles carry over between cycles; on-demand runs over arbitrary windows
+// use exact quartiles. The shard timings are returned for the caller to
+// publish once the whole cycle has run.
+func (d *AnomalyDetector) detectStatistical(ctx context.Context, detectors *detectorSet, token string, transactions []models.Transaction, streaming bool) ([]models.Outlier, []ShardTiming) {
+	var zscoreBaseline *ZScoreBaseline
+	var iqrBaseline *IQRBaseline
+	var wg sync.WaitGroup
+
+	if detectors.zscore != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			zscoreBaseline, _ = detectors.zscore.Baseline(transactions)
+		}()
+	}
+	if detectors.iqr != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if streaming {
+				iqrBaseline, _ = detectors.iqr.StreamingBaseline(token, transactions)
+			} else {
+				iqrBaseline, _ = detectors.iqr.Baseline(transactions)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if zscoreBaseline == nil && iqrBaseline == nil {
+		return nil, nil
+	}
+
+	shards := shardTransactions(transactions, d.shards)
+	results := make([][]models.Outlier, len(shards))
+	timings := make([]ShardTiming, len(shards))
+
+	work := make(chan int)
+	for w := 0; w < d.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				start := time.Now()
+
+				var outliers []models.Outlier
+				if zscoreBaseline != nil {
+					outliers = append(outliers, detectors.zscore.Score(shards[i], zscoreBaseline)...)
+				}
+				if iqrBaseline != nil {
+					outliers = append(outliers, detectors.iqr.Score(shards[i], iqrBaseline)...)
+				}
+
+				duration := time.Since(start)
+				metrics.DetectionShardDuration.WithLabelValues(token, strconv.Itoa(i)).Observe(duration.Seconds())
+
+				results[i] = outliers
+				timings[i] = ShardTiming{
+					Token:        token,
+					Shard:        i,
+					Transactions: len(shards[i]),
+					Outliers:     len(outliers),
+					Duration:     duration,
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for i := range shards {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	var allOutliers []models.Outlier
+	var slowest time.Duration
+	for i, timing := range timings {
+		allOutliers = append(allOutliers, results[i]...)
+		if timing.Duration > slowest {
+			slowest = timing.Duration
+		}
+
+		d.logger.Debug("Detection shard completed",
+			zap.String("token", timing.Token),
+			zap.Int("shard", timing.Shard),
+			zap.Int("transactions", timing.Transactions),
+			zap.Int("outliers", timing.Outliers),
+			zap.Duration("duration", timing.Duration))
+	}
+
+	d.logger.Info("Statistical detection completed",
+		zap.String("token", token),
+		zap.Int("transactions", len(transactions)),
+		zap.Int("shards", len(shards)),
+		zap.Int("workers", d.workers),
+		zap.Duration("slowest_shard", slowest),
+		zap.Int("outliers_found", len(allOutliers)))
+
+	return allOutliers, timings
+}
+
+// ShardTimings returns per-shard timings for every token scored in the most
+// recent detection cycle
+func (d *AnomalyDetector) ShardTimings() []ShardTiming {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	timings := make([]ShardTiming, len(d.shardTimings))
+	copy(timings, d.shardTimings)
+	return timings
+}
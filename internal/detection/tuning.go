@@ -0,0 +1,208 @@
+package detection
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+)
+
+// FeedbackSample is a single analyst-labelled outlier used for tuning
+type FeedbackSample struct {
+	Type     models.OutlierType
+	Label    models.FeedbackLabel
+	Score    float64 // Detector score on the same scale as its threshold
+	HasScore bool
+}
+
+// DetectorTuning summarises analyst feedback for one detector type
+type DetectorTuning struct {
+	Type                  models.OutlierType `json:"type"`
+	Labelled              int                `json:"labelled"`
+	TruePositives         int                `json:"true_positives"`
+	FalsePositives        int                `json:"false_positives"`
+	FalsePositiveRate     float64            `json:"false_positive_rate"`
+	CurrentThreshold      *float64           `json:"current_threshold,omitempty"`
+	SuggestedThreshold    *float64           `json:"suggested_threshold,omitempty"`
+	ProjectedFPRate       *float64           `json:"projected_false_positive_rate,omitempty"`
+	TruePositivesRetained *int               `json:"true_positives_retained,omitempty"`
+	Recommendation        string             `json:"recommendation"`
+}
+
+// TuningReport is the per-detector feedback report
+type TuningReport struct {
+	GeneratedAt             time.Time        `json:"generated_at"`
+	TargetFalsePositiveRate float64          `json:"target_false_positive_rate"`
+	MinSamples              int              `json:"min_samples"`
+	Detectors               []DetectorTuning `json:"detectors"`
+}
+
+// Tuning recommendations
+const (
+	RecommendationInsufficientData = "insufficient_data"
+	RecommendationKeep             = "keep"
+	RecommendationRaise            = "raise_threshold"
+	RecommendationLower            = "consider_lowering_threshold"
+	RecommendationReview           = "review_detector"
+)
+
+// FeedbackScore extracts the value a detector compares against its threshold
+// from the outlier details recorded at detection time
+func FeedbackScore(outlierType models.OutlierType, details map[string]interface{}) (float64, bool) {
+	switch outlierType {
+	case models.OutlierTypeZScore:
+		z, ok := detailFloat(details, "z_score")
+		return math.Abs(z), ok
+
+	case models.OutlierTypeIQR:
+		// Outliers lie beyond q3 + multiplier*iqr, so the effective multiplier
+		// for a point is the configured one plus its deviation past the bound
+		deviation, ok := detailFloat(details, "deviation")
+		if !ok {
+			return 0, false
+		}
+		multiplier, ok := detailFloat(details, "multiplier")
+		return multiplier + deviation, ok
+
+	case models.OutlierTypeDBSCAN:
+		return detailFloat(details, "nearest_cluster_distance")
+
+	case models.OutlierTypePatternVelocity:
+		return detailFloat(details, "transaction_count")
+
+	default:
+		return 0, false
+	}
+}
+
+// BuildTuningReport computes per-detector false positive rates and, where the
+// rate exceeds the target, the lowest threshold that would bring it back in line
+func BuildTuningReport(samples []FeedbackSample, current map[models.OutlierType]float64,
+	targetFPRate float64, minSamples int) *TuningReport {
+
+	byType := make(map[models.OutlierType][]FeedbackSample)
+	for _, sample := range samples {
+		byType[sample.Type] = append(byType[sample.Type], sample)
+	}
+
+	report := &TuningReport{
+		GeneratedAt:             time.Now(),
+		TargetFalsePositiveRate: targetFPRate,
+		MinSamples:              minSamples,
+		Detectors:               make([]DetectorTuning, 0, len(byType)),
+	}
+
+	for outlierType, typeSamples := range byType {
+		tuning := DetectorTuning{Type: outlierType}
+
+		for _, sample := range typeSamples {
+			switch sample.Label {
+			case models.FeedbackTruePositive:
+				tuning.TruePositives++
+			case models.FeedbackFalsePositive:
+				tuning.FalsePositives++
+			}
+		}
+		tuning.Labelled = tuning.TruePositives + tuning.FalsePositives
+		if tuning.Labelled > 0 {
+			tuning.FalsePositiveRate = float64(tuning.FalsePositives) / float64(tuning.Labelled)
+		}
+
+		threshold, hasThreshold := current[outlierType]
+		if hasThreshold {
+			tuning.CurrentThreshold = &threshold
+		}
+
+		switch {
+		case tuning.Labelled < minSamples:
+			tuning.Recommendation = RecommendationInsufficientData
+		case tuning.FalsePositiveRate > targetFPRate:
+			tuning.Recommendation = RecommendationRaise
+			suggestThreshold(&tuning, typeSamples, targetFPRate)
+		case tuning.FalsePositiveRate < targetFPRate/4:
+			tuning.Recommendation = RecommendationLower
+		default:
+			tuning.Recommendation = RecommendationKeep
+		}
+
+		report.Detectors = append(report.Detectors, tuning)
+	}
+
+	sort.Slice(report.Detectors, func(i, j int) bool {
+		return report.Detectors[i].Type < report.Detectors[j].Type
+	})
+
+	return report
+}
+
+// suggestThreshold scans candidate cut-offs in ascending order and picks the
+// first one at which the labelled false positive rate meets the target
+func suggestThreshold(tuning *DetectorTuning, samples []FeedbackSample, targetFPRate float64) {
+	scored := make([]FeedbackSample, 0, len(samples))
+	for _, sample := range samples {
+		if sample.HasScore {
+			scored = append(scored, sample)
+		}
+	}
+
+	if len(scored) == 0 {
+		// Detector has no tunable score (e.g. graph patterns)
+		tuning.Recommendation = RecommendationReview
+		return
+	}
+
+	sort.Slice(scored, func(i, j int) bool {
+		return scored[i].Score < scored[j].Score
+	})
+
+	for i := range scored {
+		if i > 0 && scored[i].Score == scored[i-1].Score {
+			continue
+		}
+
+		tp, fp := 0, 0
+		for _, sample := range scored[i:] {
+			if sample.Label == models.FeedbackFalsePositive {
+				fp++
+			} else {
+				tp++
+			}
+		}
+
+		if tp == 0 {
+			break
+		}
+
+		rate := float64(fp) / float64(tp+fp)
+		if rate <= targetFPRate {
+			cutoff := scored[i].Score
+			if tuning.CurrentThreshold != nil && cutoff <= *tuning.CurrentThreshold {
+				continue
+			}
+			tuning.SuggestedThreshold = &cutoff
+			tuning.ProjectedFPRate = &rate
+			tuning.TruePositivesRetained = &tp
+			return
+		}
+	}
+
+	// No cut-off separates true from false positives
+	tuning.Recommendation = RecommendationReview
+}
+
+// detailFloat reads a numeric value from outlier details
+func detailFloat(details map[string]interface{}, key string) (float64, bool) {
+	switch v := details[key].(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
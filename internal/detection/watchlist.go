@@ -0,0 +1,212 @@
+package detection
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// WatchlistConfig holds watchlist matching configuration
+type WatchlistConfig struct {
+	RefreshInterval time.Duration // How often entries are reloaded from the database (default 30s)
+}
+
+// WatchlistMatcher raises a high-severity outlier for every transfer to or
+// from an address on a watchlist, bypassing the statistical detectors.
+// Entries are held in memory and reloaded periodically, so matching a
+// transaction never waits on the database.
+type WatchlistMatcher struct {
+	db     *sql.DB
+	config WatchlistConfig
+	logger *zap.Logger
+
+	mu      sync.RWMutex
+	entries map[string][]watchedEntry // By address
+}
+
+// watchedEntry is a watchlist entry with the organization owning its
+// watchlist, which owns the outliers it raises
+type watchedEntry struct {
+	orgID string
+	models.WatchlistEntry
+}
+
+// NewWatchlistMatcher creates a watchlist matcher with no entries until the
+// first Refresh
+func NewWatchlistMatcher(db *sql.DB, config WatchlistConfig, logger *zap.Logger) *WatchlistMatcher {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = 30 * time.Second
+	}
+
+	return &WatchlistMatcher{
+		db:      db,
+		config:  config,
+		logger:  logger,
+		entries: make(map[string][]watchedEntry),
+	}
+}
+
+// Refresh reloads the entries that have not expired
+func (m *WatchlistMatcher) Refresh(ctx context.Context) error {
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT w.org_id, e.id, e.watchlist_id, w.name, e.address, e.reason, e.expires_at, e.added_by, e.added_at
+		FROM watchlist_entries e
+		JOIN watchlists w ON w.id = e.watchlist_id
+		WHERE e.expires_at IS NULL OR e.expires_at > $1
+	`, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to query watchlist entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make(map[string][]watchedEntry)
+	count := 0
+	for rows.Next() {
+		var entry watchedEntry
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&entry.orgID, &entry.ID, &entry.WatchlistID, &entry.WatchlistName, &entry.Address,
+			&entry.Reason, &expiresAt, &entry.AddedBy, &entry.AddedAt); err != nil {
+			return fmt.Errorf("failed to scan watchlist entry: %w", err)
+		}
+		if expiresAt.Valid {
+			entry.ExpiresAt = &expiresAt.Time
+		}
+		entries[entry.Address] = append(entries[entry.Address], entry)
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read watchlist entries: %w", err)
+	}
+
+	m.mu.Lock()
+	m.entries = entries
+	m.mu.Unlock()
+
+	m.logger.Debug("Watchlist entries loaded",
+		zap.Int("entries", count),
+		zap.Int("addresses", len(entries)))
+	return nil
+}
+
+// Run refreshes the entries every RefreshInterval until ctx is cancelled. A
+// failed refresh keeps the entries already loaded.
+func (m *WatchlistMatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Refresh(ctx); err != nil && ctx.Err() == nil {
+				m.logger.Error("Failed to refresh watchlists", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Match returns an outlier for each side of tx that is on a watchlist, one
+// per watched address and organization however many of the organization's
+// watchlists it is on. Each outlier belongs to the organization whose
+// watchlists matched.
+func (m *WatchlistMatcher) Match(tx models.Transaction) []models.Outlier {
+	now := time.Now()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var outliers []models.Outlier
+	for _, side := range []struct {
+		address, counterparty, direction string
+	}{
+		{tx.From, tx.To, "sent"},
+		{tx.To, tx.From, "received"},
+	} {
+		// A transfer to itself is reported once
+		if side.direction == "received" && tx.To == tx.From {
+			break
+		}
+
+		matched := make(map[string][]models.WatchlistEntry) // By organization
+		var orgs []string
+		for _, entry := range m.entries[side.address] {
+			// Entries can expire between refreshes
+			if entry.Expired(now) {
+				continue
+			}
+			if _, seen := matched[entry.orgID]; !seen {
+				orgs = append(orgs, entry.orgID)
+			}
+			matched[entry.orgID] = append(matched[entry.orgID], entry.WatchlistEntry)
+		}
+		sort.Strings(orgs)
+
+		for _, orgID := range orgs {
+			orgMatched := matched[orgID]
+			sort.Slice(orgMatched, func(i, j int) bool { return orgMatched[i].WatchlistName < orgMatched[j].WatchlistName })
+
+			names := make([]string, len(orgMatched))
+			entries := make([]map[string]interface{}, len(orgMatched))
+			for i, entry := range orgMatched {
+				names[i] = entry.WatchlistName
+				entries[i] = map[string]interface{}{
+					"entry_id":     entry.ID,
+					"watchlist_id": entry.WatchlistID,
+					"watchlist":    entry.WatchlistName,
+					"reason":       entry.Reason,
+				}
+			}
+
+			outliers = append(outliers, models.Outlier{
+				ID:              uuid.New().String(),
+				OrgID:           orgID,
+				DetectedAt:      now,
+				Type:            models.OutlierTypeWatchlist,
+				Severity:        models.SeverityHigh,
+				Address:         side.address,
+				TransactionHash: tx.TxHash,
+				Amount:          tx.Amount,
+				Details: map[string]interface{}{
+					"watchlists":   names,
+					"entries":      entries,
+					"direction":    side.direction,
+					"counterparty": side.counterparty,
+					"token":        tx.Token,
+					"timestamp":    tx.Timestamp.Unix(),
+				},
+				Status:       models.OutlierStatusOpen,
+				Acknowledged: false,
+			})
+		}
+	}
+
+	countOutliers(outliers)
+	return outliers
+}
+
+// Watched reports whether address is on one of an organization's
+// watchlists in an entry that has not expired
+func (m *WatchlistMatcher) Watched(orgID, address string) bool {
+	now := time.Now()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, entry := range m.entries[address] {
+		if entry.orgID == orgID && !entry.Expired(now) {
+			return true
+		}
+	}
+	return false
+}
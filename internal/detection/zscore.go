@@ -41,13 +41,37 @@ func NewZScoreDetector(config ZScoreConfig, logger *zap.Logger) *ZScoreDetector
 	}
 }
 
+// ZScoreBaseline holds the window statistics transactions are scored against
+type ZScoreBaseline struct {
+	Mean       float64
+	StdDev     float64
+	SampleSize int
+}
+
 // Detect finds outliers using Z-score method
 func (d *ZScoreDetector) Detect(transactions []models.Transaction) ([]models.Outlier, error) {
+	baseline, ok := d.Baseline(transactions)
+	if !ok {
+		return nil, nil
+	}
+
+	outliers := d.Score(transactions, baseline)
+
+	d.logger.Info("Z-score detection completed",
+		zap.Int("total_transactions", len(transactions)),
+		zap.Int("outliers_found", len(outliers)))
+
+	return outliers, nil
+}
+
+// Baseline computes the mean and standard deviation of transaction amounts.
+// It returns false when there is too little data or no variance to score against.
+func (d *ZScoreDetector) Baseline(transactions []models.Transaction) (*ZScoreBaseline, bool) {
 	if len(transactions) < d.minDataPoints {
 		d.logger.Debug("Insufficient data points for Z-score detection",
 			zap.Int("count", len(transactions)),
 			zap.Int("min_required", d.minDataPoints))
-		return nil, nil
+		return nil, false
 	}
 
 	// Extract amounts as float64 array
@@ -69,14 +93,23 @@ func (d *ZScoreDetector) Detect(transactions []models.Transaction) ([]models.Out
 	// If stddev is 0, all values are the same - no outliers
 	if stddev == 0 {
 		d.logger.Debug("Standard deviation is zero, no outliers detected")
-		return nil, nil
+		return nil, false
 	}
 
-	// Find outliers
+	return &ZScoreBaseline{
+		Mean:       mean,
+		StdDev:     stddev,
+		SampleSize: len(amounts),
+	}, true
+}
+
+// Score flags transactions whose amount deviates from the baseline by more
+// than the threshold. transactions may be any subset of the baseline window.
+func (d *ZScoreDetector) Score(transactions []models.Transaction, baseline *ZScoreBaseline) []models.Outlier {
 	var outliers []models.Outlier
-	for i, tx := range transactions {
-		amount := amounts[i]
-		zScore := (amount - mean) / stddev
+	for _, tx := range transactions {
+		amount, _ := tx.Amount.Float64()
+		zScore := (amount - baseline.Mean) / baseline.StdDev
 
 		if math.Abs(zScore) > d.threshold {
 			severity := d.calculateSeverity(math.Abs(zScore))
@@ -92,15 +125,16 @@ func (d *ZScoreDetector) Detect(transactions []models.Transaction) ([]models.Out
 				ZScore:          zScore,
 				Details: map[string]interface{}{
 					"z_score":       zScore,
-					"mean":          mean,
-					"stddev":        stddev,
-					"sample_size":   len(amounts),
+					"mean":          baseline.Mean,
+					"stddev":        baseline.StdDev,
+					"sample_size":   baseline.SampleSize,
 					"from":          tx.From,
 					"to":            tx.To,
 					"block_number":  tx.BlockNumber,
 					"timestamp":     tx.Timestamp,
 					"threshold":     d.threshold,
 				},
+				Status:       models.OutlierStatusOpen,
 				Acknowledged: false,
 			}
 
@@ -114,11 +148,7 @@ func (d *ZScoreDetector) Detect(transactions []models.Transaction) ([]models.Out
 		}
 	}
 
-	d.logger.Info("Z-score detection completed",
-		zap.Int("total_transactions", len(transactions)),
-		zap.Int("outliers_found", len(outliers)))
-
-	return outliers, nil
+	return outliers
 }
 
 // DetectByAddress detects outliers for a specific address
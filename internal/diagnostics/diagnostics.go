@@ -0,0 +1,88 @@
+// Package diagnostics serves net/http/pprof profiles and expvar runtime
+// state on a separate listener, so goroutine and memory leaks can be
+// investigated in production without exposing them on the public API port.
+package diagnostics
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var startTime = time.Now()
+
+func init() {
+	expvar.Publish("runtime", expvar.Func(runtimeStats))
+}
+
+// runtimeStats is a compact summary of the Go runtime; the full MemStats
+// are published by expvar as memstats
+func runtimeStats() interface{} {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	return map[string]interface{}{
+		"goroutines":       runtime.NumGoroutine(),
+		"cpus":             runtime.NumCPU(),
+		"go_version":       runtime.Version(),
+		"uptime_seconds":   time.Since(startTime).Seconds(),
+		"heap_alloc_bytes": mem.HeapAlloc,
+		"heap_objects":     mem.HeapObjects,
+		"heap_sys_bytes":   mem.HeapSys,
+		"stack_inuse":      mem.StackInuse,
+		"gc_cycles":        mem.NumGC,
+		"gc_pause_total":   time.Duration(mem.PauseTotalNs).String(),
+		"last_gc":          time.Unix(0, int64(mem.LastGC)).UTC(),
+	}
+}
+
+// Publish exposes the value returned by fn under name at /debug/vars. It is
+// called on every request, so it must be cheap and safe to call from any
+// goroutine. Publishing a name twice keeps the first.
+func Publish(name string, fn func() interface{}) {
+	if expvar.Get(name) != nil {
+		return
+	}
+	expvar.Publish(name, expvar.Func(fn))
+}
+
+// Handler serves /debug/pprof/ and /debug/vars
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// StartServer serves Handler on addr in the background. Bind addr to
+// loopback (e.g. localhost:6060) and reach it with kubectl port-forward;
+// profiles reveal memory contents. Shut the returned server down on exit.
+func StartServer(addr string, logger *zap.Logger) *http.Server {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		// No write timeout: CPU profiles and traces stream for their duration
+	}
+
+	go func() {
+		logger.Info("Diagnostics server listening", zap.String("address", addr))
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("Diagnostics server failed", zap.Error(err))
+		}
+	}()
+
+	return srv
+}
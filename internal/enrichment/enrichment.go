@@ -0,0 +1,282 @@
+// Package enrichment screens the addresses behind detected outliers with
+// third-party chain-analytics services, such as Chainalysis or TRM Labs,
+// and adds the risk they report to the outliers. Screenings are cached, in
+// memory and in the database, so each address is looked up at most once
+// per cache period.
+package enrichment
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Provider looks up addresses with a chain-analytics service
+type Provider interface {
+	// Name identifies the service in screenings and metrics
+	Name() string
+	// Screen returns the service's assessment of address, with no
+	// category or risk when it knows nothing of it
+	Screen(ctx context.Context, address string) (*models.AddressScreening, error)
+}
+
+// Config holds enrichment configuration
+type Config struct {
+	CacheTTL     time.Duration // How long a screening is reused (default 24h)
+	Concurrency  int           // Lookups in flight at once (default 4)
+	MaxAddresses int           // Addresses screened per detection cycle (default 100)
+}
+
+// maxCached is the number of screenings kept in memory before expired
+// ones are evicted
+const maxCached = 10000
+
+// Enricher adds providers' screenings of outliers' addresses and
+// counterparties to the outliers' details
+type Enricher struct {
+	provider Provider
+	store    *Store // nil caches in memory only
+	config   Config
+	logger   *zap.Logger
+
+	mu     sync.Mutex
+	cached map[string]models.AddressScreening // By normalized address
+}
+
+// NewEnricher creates an enricher screening addresses with provider and
+// caching screenings in store, if it is not nil
+func NewEnricher(provider Provider, store *Store, config Config, logger *zap.Logger) *Enricher {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.CacheTTL <= 0 {
+		config.CacheTTL = 24 * time.Hour
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 4
+	}
+	if config.MaxAddresses <= 0 {
+		config.MaxAddresses = 100
+	}
+
+	return &Enricher{
+		provider: provider,
+		store:    store,
+		config:   config,
+		logger:   logger,
+		cached:   make(map[string]models.AddressScreening),
+	}
+}
+
+// Screen returns the provider's screening of address, from the cache while
+// it is fresh
+func (e *Enricher) Screen(ctx context.Context, address string) (*models.AddressScreening, error) {
+	key := models.NormalizeAddress(address)
+	name := e.provider.Name()
+
+	e.mu.Lock()
+	screening, ok := e.cached[key]
+	e.mu.Unlock()
+	if ok && e.fresh(screening) {
+		metrics.EnrichmentLookups.WithLabelValues(name, "cached").Inc()
+		return &screening, nil
+	}
+
+	if e.store != nil {
+		stored, err := e.store.Get(ctx, name, key)
+		if err != nil {
+			e.logger.Warn("Failed to read cached address screening", zap.Error(err))
+		} else if stored != nil && e.fresh(*stored) {
+			e.remember(key, *stored)
+			metrics.EnrichmentLookups.WithLabelValues(name, "cached").Inc()
+			return stored, nil
+		}
+	}
+
+	fetched, err := e.provider.Screen(ctx, address)
+	if err != nil {
+		metrics.EnrichmentLookups.WithLabelValues(name, "failed").Inc()
+		return nil, err
+	}
+	fetched.Address = key
+	fetched.Provider = name
+	fetched.ScreenedAt = time.Now().UTC()
+	metrics.EnrichmentLookups.WithLabelValues(name, "screened").Inc()
+
+	e.remember(key, *fetched)
+	if e.store != nil {
+		if err := e.store.Save(ctx, *fetched); err != nil {
+			e.logger.Warn("Failed to cache address screening", zap.Error(err))
+		}
+	}
+	return fetched, nil
+}
+
+// fresh reports whether a screening may still be reused
+func (e *Enricher) fresh(screening models.AddressScreening) bool {
+	return time.Since(screening.ScreenedAt) < e.config.CacheTTL
+}
+
+// remember caches a screening in memory, evicting expired ones when the
+// cache is full
+func (e *Enricher) remember(key string, screening models.AddressScreening) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.cached) >= maxCached {
+		for cachedKey, cached := range e.cached {
+			if !e.fresh(cached) {
+				delete(e.cached, cachedKey)
+			}
+		}
+	}
+	e.cached[key] = screening
+}
+
+// Enrich screens each outlier's address, counterparty and community
+// members and adds what the provider knows of them to the outlier's
+// Details, as external_risk, counterparty_external_risk and
+// member_external_risk. Addresses the provider knows nothing of, and those
+// whose lookup fails, are left out. At most MaxAddresses are screened, the
+// outliers' own addresses first.
+func (e *Enricher) Enrich(ctx context.Context, outliers []models.Outlier) []models.Outlier {
+	var addresses []string
+	seen := make(map[string]bool)
+	add := func(address string) {
+		if address != "" && !seen[address] && len(addresses) < e.config.MaxAddresses {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+	for _, outlier := range outliers {
+		add(outlier.Address)
+	}
+	for _, outlier := range outliers {
+		add(counterparty(outlier))
+		for _, member := range members(outlier) {
+			add(member)
+		}
+	}
+	if len(addresses) == 0 {
+		return outliers
+	}
+
+	screenings := e.screenAll(ctx, addresses)
+
+	for i := range outliers {
+		outlier := &outliers[i]
+		if screening, ok := screenings[outlier.Address]; ok {
+			outlier.Details = withDetail(outlier.Details, "external_risk", screeningDetails(screening))
+		}
+		if screening, ok := screenings[counterparty(*outlier)]; ok {
+			outlier.Details["counterparty_external_risk"] = screeningDetails(screening)
+		}
+		memberRisks := make(map[string]interface{})
+		for _, member := range members(*outlier) {
+			if screening, ok := screenings[member]; ok {
+				memberRisks[member] = screeningDetails(screening)
+			}
+		}
+		if len(memberRisks) > 0 {
+			outlier.Details["member_external_risk"] = memberRisks
+		}
+	}
+	return outliers
+}
+
+// screenAll screens addresses, Concurrency at a time, returning the known
+// ones by address
+func (e *Enricher) screenAll(ctx context.Context, addresses []string) map[string]models.AddressScreening {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	screenings := make(map[string]models.AddressScreening)
+	failed := 0
+	slots := make(chan struct{}, e.config.Concurrency)
+
+	for _, address := range addresses {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(address string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			screening, err := e.Screen(ctx, address)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				e.logger.Debug("Failed to screen address",
+					zap.Error(err),
+					zap.String("address", address))
+				return
+			}
+			if screening.Known() {
+				screenings[address] = *screening
+			}
+		}(address)
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		e.logger.Warn("Some addresses could not be screened",
+			zap.String("provider", e.provider.Name()),
+			zap.Int("failed", failed),
+			zap.Int("addresses", len(addresses)))
+	}
+	return screenings
+}
+
+// counterparty returns the counterparty pattern outliers record, if any
+func counterparty(outlier models.Outlier) string {
+	address, _ := outlier.Details["counterparty"].(string)
+	return address
+}
+
+// members returns the community members community outliers record, if
+// any, whether as detected or decoded from JSON
+func members(outlier models.Outlier) []string {
+	switch v := outlier.Details["members"].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		members := make([]string, 0, len(v))
+		for _, member := range v {
+			if address, ok := member.(string); ok {
+				members = append(members, address)
+			}
+		}
+		return members
+	}
+	return nil
+}
+
+// screeningDetails is how a screening appears in outlier details
+func screeningDetails(screening models.AddressScreening) map[string]interface{} {
+	details := map[string]interface{}{
+		"provider":    screening.Provider,
+		"screened_at": screening.ScreenedAt.UTC().Format(time.RFC3339),
+	}
+	if screening.Category != "" {
+		details["category"] = screening.Category
+	}
+	if screening.Risk != "" {
+		details["risk"] = screening.Risk
+	}
+	if screening.Entity != "" {
+		details["entity"] = screening.Entity
+	}
+	return details
+}
+
+// withDetail sets key in details, creating the map if needed
+func withDetail(details map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	if details == nil {
+		details = make(map[string]interface{})
+	}
+	details[key] = value
+	return details
+}
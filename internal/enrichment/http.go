@@ -0,0 +1,167 @@
+package enrichment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+)
+
+// AddressPlaceholder is replaced by the screened address in HTTPConfig's
+// URL and Body
+const AddressPlaceholder = "{address}"
+
+// HTTPConfig holds the configuration of an address-risk API reached over
+// HTTP. The defaults read Chainalysis's entity API; other services, such as
+// TRM Labs' screening API, are read by setting the field paths.
+type HTTPConfig struct {
+	Name string // Recorded with each screening, e.g. chainalysis
+	// URL is requested for each address, with AddressPlaceholder replaced,
+	// e.g. https://api.chainalysis.com/api/risk/v2/entities/{address}
+	URL string
+	// Body is POSTed as JSON when set, with AddressPlaceholder replaced;
+	// otherwise URL is fetched with GET
+	Body         string
+	APIKeyHeader string // Header carrying APIKey; defaults to Token
+	APIKey       string
+	// Dotted paths to the category, risk rating and entity name in the
+	// response, where numbers index arrays, e.g. 0.entities.0.category.
+	// They default to Chainalysis's cluster.category, risk and cluster.name.
+	CategoryField string
+	RiskField     string
+	EntityField   string
+	Timeout       time.Duration // Per request; defaults to 10s
+}
+
+// HTTPProvider screens addresses with an address-risk API over HTTP
+type HTTPProvider struct {
+	config HTTPConfig
+	client *http.Client
+}
+
+// NewHTTPProvider creates an HTTP address-risk provider
+func NewHTTPProvider(config HTTPConfig) (*HTTPProvider, error) {
+	if config.Name == "" {
+		return nil, fmt.Errorf("provider name is required")
+	}
+	if config.URL == "" {
+		return nil, fmt.Errorf("provider URL is required")
+	}
+	if _, err := url.Parse(strings.ReplaceAll(config.URL, AddressPlaceholder, "address")); err != nil {
+		return nil, fmt.Errorf("invalid provider URL: %w", err)
+	}
+	if config.APIKeyHeader == "" {
+		config.APIKeyHeader = "Token"
+	}
+	if config.CategoryField == "" {
+		config.CategoryField = "cluster.category"
+	}
+	if config.RiskField == "" {
+		config.RiskField = "risk"
+	}
+	if config.EntityField == "" {
+		config.EntityField = "cluster.name"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	return &HTTPProvider{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Name identifies the provider
+func (p *HTTPProvider) Name() string {
+	return p.config.Name
+}
+
+// Screen asks the API about address. An address the API has never seen,
+// answered with 404, is returned with no category or risk.
+func (p *HTTPProvider) Screen(ctx context.Context, address string) (*models.AddressScreening, error) {
+	target := strings.ReplaceAll(p.config.URL, AddressPlaceholder, url.PathEscape(address))
+
+	method := http.MethodGet
+	var body io.Reader
+	if p.config.Body != "" {
+		method = http.MethodPost
+		quoted, _ := json.Marshal(address)
+		body = strings.NewReader(strings.ReplaceAll(p.config.Body, AddressPlaceholder, strings.Trim(string(quoted), `"`)))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if p.config.APIKey != "" {
+		req.Header.Set(p.config.APIKeyHeader, p.config.APIKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", p.config.Name, err)
+	}
+	defer resp.Body.Close()
+
+	screening := &models.AddressScreening{Address: address, Provider: p.config.Name}
+	if resp.StatusCode == http.StatusNotFound {
+		return screening, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s returned status %d: %s", p.config.Name, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+
+	var document interface{}
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, 1<<20))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("failed to decode %s response: %w", p.config.Name, err)
+	}
+	screening.Category = field(document, p.config.CategoryField)
+	screening.Risk = field(document, p.config.RiskField)
+	screening.Entity = field(document, p.config.EntityField)
+	return screening, nil
+}
+
+// field returns the value at a dotted path in a decoded JSON document as a
+// string, or "" when there is nothing there
+func field(document interface{}, path string) string {
+	value := document
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return ""
+			}
+			value = v[i]
+		default:
+			return ""
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package enrichment
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+)
+
+// Store keeps screenings in the address_screenings table, so the API and
+// the detector service share them and they outlive restarts
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore creates a screening store
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Get returns provider's screening of address, or nil if it has none
+func (s *Store) Get(ctx context.Context, provider, address string) (*models.AddressScreening, error) {
+	return s.scan(s.db.QueryRowContext(ctx, `
+		SELECT address, provider, category, risk, entity, screened_at
+		FROM address_screenings
+		WHERE address = $1 AND provider = $2
+	`, models.NormalizeAddress(address), provider))
+}
+
+// Latest returns the newest screening of address by any provider, or nil
+// if it has none
+func (s *Store) Latest(ctx context.Context, address string) (*models.AddressScreening, error) {
+	return s.scan(s.db.QueryRowContext(ctx, `
+		SELECT address, provider, category, risk, entity, screened_at
+		FROM address_screenings
+		WHERE address = $1
+		ORDER BY screened_at DESC
+		LIMIT 1
+	`, models.NormalizeAddress(address)))
+}
+
+func (s *Store) scan(row *sql.Row) (*models.AddressScreening, error) {
+	var screening models.AddressScreening
+	err := row.Scan(&screening.Address, &screening.Provider, &screening.Category, &screening.Risk,
+		&screening.Entity, &screening.ScreenedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query address screening: %w", err)
+	}
+	return &screening, nil
+}
+
+// Save records a screening, replacing the provider's previous one of the
+// address
+func (s *Store) Save(ctx context.Context, screening models.AddressScreening) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO address_screenings (address, provider, category, risk, entity, screened_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (address, provider) DO UPDATE SET
+			category = excluded.category,
+			risk = excluded.risk,
+			entity = excluded.entity,
+			screened_at = excluded.screened_at
+	`, models.NormalizeAddress(screening.Address), screening.Provider, screening.Category, screening.Risk,
+		screening.Entity, screening.ScreenedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save address screening: %w", err)
+	}
+	return nil
+}
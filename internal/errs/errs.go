@@ -0,0 +1,91 @@
+// Package errs classifies failures so alerting can tell an upstream outage
+// from bad input or a bug in StableRisk. Packages declare Kind sentinels,
+// wrap the errors they return with them, and Record each failure where it
+// arises so it is counted exactly once in stablerisk_errors_total.
+package errs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mikedewar/stablerisk/internal/metrics"
+)
+
+// Class is who is at fault for a failure
+type Class string
+
+const (
+	ClassUpstream Class = "upstream" // A dependency is down, throttling or misbehaving
+	ClassInput    Class = "input"    // Bad data from a chain or an API client
+	ClassInternal Class = "internal" // A StableRisk bug or misconfiguration
+)
+
+// Kind is a sentinel error with a stable code, used as a metric label
+type Kind struct {
+	Code  string
+	Class Class
+	msg   string
+}
+
+// New declares a kind of failure
+func New(code string, class Class, msg string) *Kind {
+	return &Kind{Code: code, Class: class, msg: msg}
+}
+
+func (k *Kind) Error() string { return k.msg }
+
+// wrapped carries a kind alongside the underlying error, keeping the
+// underlying message so existing log lines and error strings are unchanged
+type wrapped struct {
+	kind *Kind
+	err  error
+}
+
+func (w *wrapped) Error() string   { return w.err.Error() }
+func (w *wrapped) Unwrap() []error { return []error{w.kind, w.err} }
+
+// Wrap marks err as kind. errors.Is matches both kind and err's own chain.
+// A nil err stays nil.
+func Wrap(kind *Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &wrapped{kind: kind, err: err}
+}
+
+// Wrapf creates an error of kind with a formatted message; %w is supported
+func Wrapf(kind *Kind, format string, args ...interface{}) error {
+	return &wrapped{kind: kind, err: fmt.Errorf(format, args...)}
+}
+
+// KindOf returns the first kind in err's chain, or nil
+func KindOf(err error) *Kind {
+	var kind *Kind
+	if errors.As(err, &kind) {
+		return kind
+	}
+	return nil
+}
+
+// Code returns the code of err's kind, or "unknown"
+func Code(err error) string {
+	if kind := KindOf(err); kind != nil {
+		return kind.Code
+	}
+	return "unknown"
+}
+
+// Record counts err against component and returns it unchanged, so it can
+// be used in return statements. Errors without a kind are counted as
+// unknown internal errors; nil is not counted.
+func Record(component string, err error) error {
+	if err == nil {
+		return nil
+	}
+	code, class := "unknown", ClassInternal
+	if kind := KindOf(err); kind != nil {
+		code, class = kind.Code, kind.Class
+	}
+	metrics.Errors.WithLabelValues(component, code, string(class)).Inc()
+	return err
+}
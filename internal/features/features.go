@@ -0,0 +1,310 @@
+// Package features gates experimental capabilities behind flags so they can
+// be rolled out one environment at a time. Each flag has a built-in default,
+// may be set per deployment in the config file, and is overridden by the
+// value saved through the API, which every service reloads periodically.
+package features
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Flag names
+const (
+	DBSCANDetector  = "dbscan_detector"  // DBSCAN clustering on each detection run
+	IQRStreaming    = "iqr_streaming"    // IQR quartiles carried over between scheduled cycles
+	WatchlistAlerts = "watchlist_alerts" // Real-time alerts on watchlisted addresses
+)
+
+// Known lists every flag with its built-in default
+var Known = []models.FeatureFlag{
+	{
+		Name:        DBSCANDetector,
+		Description: "Cluster transactions with DBSCAN on every detection run",
+		Enabled:     true,
+	},
+	{
+		Name:        IQRStreaming,
+		Description: "Estimate IQR quartiles incrementally across scheduled cycles instead of sorting each window",
+		Enabled:     true,
+	},
+	{
+		Name:        WatchlistAlerts,
+		Description: "Alert on watchlisted addresses as their transactions arrive on the message bus",
+		Enabled:     true,
+	},
+}
+
+// Sources of a flag's value
+const (
+	SourceDefault  = "default"
+	SourceConfig   = "config"
+	SourceDatabase = "database"
+)
+
+var (
+	// ErrUnknownFlag is returned for a flag not in Known
+	ErrUnknownFlag = errors.New("unknown feature flag")
+	// ErrNoDatabase is returned when saving flags without a database
+	ErrNoDatabase = errors.New("feature flags are not stored in a database")
+)
+
+// Config holds feature flag configuration
+type Config struct {
+	Environment     string          // Selects the per-environment overrides that apply
+	Defaults        map[string]bool // Set in the config file, by flag name
+	RefreshInterval time.Duration   // How often saved flags are reloaded (default 30s)
+}
+
+// Flags holds every flag's value in memory. Values saved through the API
+// are reloaded periodically, so flags can be checked on hot paths.
+type Flags struct {
+	db     *sql.DB // nil when flags come from configuration only
+	config Config
+	logger *zap.Logger
+
+	mu    sync.RWMutex
+	saved map[string]models.FeatureFlag // By name
+}
+
+// New creates feature flags with the configured values until the first
+// Refresh. db may be nil, leaving flags to configuration.
+func New(db *sql.DB, config Config, logger *zap.Logger) *Flags {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = 30 * time.Second
+	}
+	for name := range config.Defaults {
+		if _, ok := known(name); !ok {
+			logger.Warn("Ignoring unknown feature flag in configuration", zap.String("flag", name))
+		}
+	}
+
+	return &Flags{
+		db:     db,
+		config: config,
+		logger: logger,
+		saved:  make(map[string]models.FeatureFlag),
+	}
+}
+
+// Environment returns the environment whose overrides apply
+func (f *Flags) Environment() string {
+	return f.config.Environment
+}
+
+// Enabled reports whether the named flag is on in this environment. A nil
+// Flags leaves every flag at its built-in default.
+func (f *Flags) Enabled(name string) bool {
+	if f == nil {
+		flag, ok := known(name)
+		return ok && flag.Enabled
+	}
+	flag, ok := f.Lookup(name)
+	return ok && flag.Active
+}
+
+// Lookup returns the named flag as it applies in this environment
+func (f *Flags) Lookup(name string) (models.FeatureFlag, bool) {
+	flag, ok := known(name)
+	if !ok {
+		return models.FeatureFlag{}, false
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.resolve(flag), true
+}
+
+// List returns every flag as it applies in this environment
+func (f *Flags) List() []models.FeatureFlag {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	flags := make([]models.FeatureFlag, 0, len(Known))
+	for _, flag := range Known {
+		flags = append(flags, f.resolve(flag))
+	}
+	return flags
+}
+
+// resolve layers configured and saved values over a flag's default. Callers
+// hold mu.
+func (f *Flags) resolve(flag models.FeatureFlag) models.FeatureFlag {
+	flag.Source = SourceDefault
+	if enabled, ok := f.config.Defaults[flag.Name]; ok {
+		flag.Enabled = enabled
+		flag.Source = SourceConfig
+	}
+	if saved, ok := f.saved[flag.Name]; ok {
+		flag.Enabled = saved.Enabled
+		flag.Environments = saved.Environments
+		flag.Source = SourceDatabase
+		flag.UpdatedBy = saved.UpdatedBy
+		flag.UpdatedAt = saved.UpdatedAt
+	}
+
+	flag.Active = flag.Enabled
+	if active, ok := flag.Environments[f.config.Environment]; ok {
+		flag.Active = active
+	}
+	return flag
+}
+
+// Refresh reloads the flags saved through the API
+func (f *Flags) Refresh(ctx context.Context) error {
+	if f.db == nil {
+		return nil
+	}
+
+	rows, err := f.db.QueryContext(ctx, `
+		SELECT name, enabled, environments, updated_by, updated_at
+		FROM feature_flags
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query feature flags: %w", err)
+	}
+	defer rows.Close()
+
+	saved := make(map[string]models.FeatureFlag)
+	for rows.Next() {
+		var flag models.FeatureFlag
+		var environments []byte
+		var updatedAt time.Time
+		if err := rows.Scan(&flag.Name, &flag.Enabled, &environments, &flag.UpdatedBy, &updatedAt); err != nil {
+			return fmt.Errorf("failed to scan feature flag: %w", err)
+		}
+		if len(environments) > 0 {
+			if err := json.Unmarshal(environments, &flag.Environments); err != nil {
+				return fmt.Errorf("failed to decode environments of feature flag %s: %w", flag.Name, err)
+			}
+		}
+		flag.UpdatedAt = &updatedAt
+		saved[flag.Name] = flag
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read feature flags: %w", err)
+	}
+
+	f.mu.Lock()
+	f.saved = saved
+	f.mu.Unlock()
+
+	f.logger.Debug("Feature flags loaded", zap.Int("saved", len(saved)))
+	return nil
+}
+
+// Run refreshes the flags every RefreshInterval until ctx is cancelled. A
+// failed refresh keeps the flags already loaded.
+func (f *Flags) Run(ctx context.Context) {
+	if f.db == nil {
+		return
+	}
+
+	ticker := time.NewTicker(f.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := f.Refresh(ctx); err != nil && ctx.Err() == nil {
+				f.logger.Error("Failed to refresh feature flags", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Set saves the named flag, overriding its configured value. environments
+// overrides enabled in the environments it names. The flag applies here at
+// once and in other services after their next refresh.
+func (f *Flags) Set(ctx context.Context, name string, enabled bool, environments map[string]bool, updatedBy string) (models.FeatureFlag, error) {
+	flag, ok := known(name)
+	if !ok {
+		return models.FeatureFlag{}, ErrUnknownFlag
+	}
+	if f.db == nil {
+		return models.FeatureFlag{}, ErrNoDatabase
+	}
+	for environment := range environments {
+		if strings.TrimSpace(environment) == "" {
+			return models.FeatureFlag{}, fmt.Errorf("environment names must not be empty")
+		}
+	}
+	if environments == nil {
+		environments = make(map[string]bool)
+	}
+
+	environmentsJSON, err := json.Marshal(environments)
+	if err != nil {
+		return models.FeatureFlag{}, fmt.Errorf("failed to encode feature flag environments: %w", err)
+	}
+
+	updatedAt := time.Now().UTC()
+	_, err = f.db.ExecContext(ctx, `
+		INSERT INTO feature_flags (name, enabled, environments, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO UPDATE
+		SET enabled = EXCLUDED.enabled,
+		    environments = EXCLUDED.environments,
+		    updated_by = EXCLUDED.updated_by,
+		    updated_at = EXCLUDED.updated_at
+	`, name, enabled, string(environmentsJSON), updatedBy, updatedAt)
+	if err != nil {
+		return models.FeatureFlag{}, fmt.Errorf("failed to save feature flag: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.saved[name] = models.FeatureFlag{
+		Name:         name,
+		Enabled:      enabled,
+		Environments: environments,
+		UpdatedBy:    updatedBy,
+		UpdatedAt:    &updatedAt,
+	}
+	return f.resolve(flag), nil
+}
+
+// Reset deletes the saved value of the named flag, returning it to its
+// configured value
+func (f *Flags) Reset(ctx context.Context, name string) (models.FeatureFlag, error) {
+	flag, ok := known(name)
+	if !ok {
+		return models.FeatureFlag{}, ErrUnknownFlag
+	}
+	if f.db == nil {
+		return models.FeatureFlag{}, ErrNoDatabase
+	}
+
+	if _, err := f.db.ExecContext(ctx, `DELETE FROM feature_flags WHERE name = $1`, name); err != nil {
+		return models.FeatureFlag{}, fmt.Errorf("failed to delete feature flag: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.saved, name)
+	return f.resolve(flag), nil
+}
+
+// known returns the named flag from Known
+func known(name string) (models.FeatureFlag, bool) {
+	for _, flag := range Known {
+		if flag.Name == name {
+			return flag, true
+		}
+	}
+	return models.FeatureFlag{}, false
+}
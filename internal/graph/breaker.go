@@ -0,0 +1,134 @@
+package graph
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/errs"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// CircuitState is the state of the Raphtory client's circuit breaker
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"    // Calls go through
+	CircuitOpen     CircuitState = "open"      // Calls fail fast until the open timeout passes
+	CircuitHalfOpen CircuitState = "half_open" // One trial call decides whether to close again
+)
+
+// circuitBreaker stops calls to Raphtory after consecutive failures so an
+// outage fails fast instead of every caller waiting out its retries
+type circuitBreaker struct {
+	threshold   int
+	openTimeout time.Duration
+	logger      *zap.Logger
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+	onChange func(from, to CircuitState)
+}
+
+func newCircuitBreaker(threshold int, openTimeout time.Duration, logger *zap.Logger) *circuitBreaker {
+	return &circuitBreaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		logger:      logger,
+		state:       CircuitClosed,
+	}
+}
+
+// allow reports whether a call may proceed. Once the open timeout has
+// passed, a single trial call is let through.
+func (b *circuitBreaker) allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return errs.Wrapf(ErrRaphtoryCircuitOpen, "%w: circuit breaker is open", ErrRaphtoryUnavailable)
+		}
+		b.setState(CircuitHalfOpen)
+		b.probing = true
+		return nil
+	case CircuitHalfOpen:
+		if b.probing {
+			return errs.Wrapf(ErrRaphtoryCircuitOpen, "%w: circuit breaker is open", ErrRaphtoryUnavailable)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record updates the breaker with a call's outcome. Only failures that
+// suggest Raphtory is down count; a rejected request is the caller's problem.
+func (b *circuitBreaker) record(failed bool) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		if b.state != CircuitClosed {
+			b.setState(CircuitClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		if b.state != CircuitOpen {
+			b.setState(CircuitOpen)
+		}
+	}
+}
+
+// release gives up a trial call that ended without an outcome, e.g.
+// because its context was cancelled
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+func (b *circuitBreaker) current() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// setState must be called with mu held
+func (b *circuitBreaker) setState(state CircuitState) {
+	log := b.logger.Info
+	if state == CircuitOpen {
+		log = b.logger.Warn
+	}
+	log("Raphtory circuit breaker state changed",
+		zap.String("from", string(b.state)),
+		zap.String("to", string(state)),
+		zap.Int("consecutive_failures", b.failures))
+	if b.onChange != nil {
+		b.onChange(b.state, state)
+	}
+	b.state = state
+
+	open := 0.0
+	if state != CircuitClosed {
+		open = 1
+	}
+	metrics.RaphtoryCircuitOpen.WithLabelValues().Set(open)
+}
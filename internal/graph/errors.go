@@ -0,0 +1,42 @@
+package graph
+
+import (
+	"github.com/mikedewar/stablerisk/internal/errs"
+)
+
+// errComponent labels failures recorded by the Raphtory client
+const errComponent = "raphtory"
+
+// Kinds of Raphtory failure. Match them with errors.Is.
+var (
+	// ErrRaphtoryUnavailable covers network failures, timeouts and 5xx responses
+	ErrRaphtoryUnavailable = errs.New("raphtory_unavailable", errs.ClassUpstream, "Raphtory unavailable")
+
+	// ErrRaphtoryCircuitOpen is a call refused without being sent because
+	// Raphtory kept failing. It also matches ErrRaphtoryUnavailable.
+	ErrRaphtoryCircuitOpen = errs.New("raphtory_circuit_open", errs.ClassUpstream, "Raphtory circuit breaker is open")
+
+	// ErrRaphtoryBadResponse is a response body that could not be decoded
+	ErrRaphtoryBadResponse = errs.New("raphtory_bad_response", errs.ClassUpstream, "Raphtory returned an invalid response")
+
+	// ErrRaphtoryRejected is a 4xx response: the client sent something the service does not accept
+	ErrRaphtoryRejected = errs.New("raphtory_rejected", errs.ClassInternal, "Raphtory rejected the request")
+
+	// ErrRaphtoryUnsupported is an operation the configured transport cannot
+	// express, e.g. retracting by transaction hash over GraphQL
+	ErrRaphtoryUnsupported = errs.New("raphtory_unsupported", errs.ClassInternal, "Operation not supported by the Raphtory transport")
+)
+
+// statusError classifies and records an unexpected Raphtory status code
+func statusError(status int) error {
+	kind := ErrRaphtoryRejected
+	if status >= 500 {
+		kind = ErrRaphtoryUnavailable
+	}
+	return errs.Record(errComponent, errs.Wrapf(kind, "raphtory returned status %d", status))
+}
+
+// decodeError classifies and records a response body that could not be decoded
+func decodeError(err error) error {
+	return errs.Record(errComponent, errs.Wrapf(ErrRaphtoryBadResponse, "failed to decode response: %w", err))
+}
@@ -0,0 +1,536 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// ForwarderConfig holds batching and outbox draining configuration
+type ForwarderConfig struct {
+	RetryInterval    time.Duration // First retry delay while Raphtory is failing (default 5 seconds)
+	MaxRetryInterval time.Duration // Backoff cap (default 5 minutes)
+	// BatchSize is the number of transactions sent per Raphtory request and
+	// outbox entries read per drain (default 100). 1 sends each transaction
+	// on its own.
+	BatchSize     int
+	FlushInterval time.Duration // Longest a partial batch waits before it is sent (default 1 second)
+	WriteTimeout  time.Duration // Timeout for each Raphtory write (default 10 seconds)
+	// MaxAttempts failed deliveries dead-letter an outbox entry so it no
+	// longer holds up the writes behind it (default 20). Negative retries
+	// entries forever.
+	MaxAttempts int
+}
+
+// ForwarderStats holds forwarding counters
+type ForwarderStats struct {
+	Forwarded uint64 // Writes delivered to Raphtory, directly or from the outbox
+	Queued    uint64 // Writes parked in the outbox
+	Failed    uint64 // Failed delivery attempts
+	Depth     int64  // Writes currently waiting in the outbox
+
+	DeadLettered uint64 // Writes given up on after MaxAttempts failed deliveries
+}
+
+// Forwarder delivers graph writes to Raphtory. Transactions are batched into
+// one request per BatchSize transactions or FlushInterval, whichever comes
+// first. Writes that fail are parked in the outbox and retried in order with
+// exponential backoff, so a Raphtory outage delays the graph instead of
+// leaving gaps in it. Without an outbox writes are attempted once; failures
+// of unbatched writes are returned to the caller, failed batches are logged
+// and counted.
+type Forwarder struct {
+	client *RaphtoryClient
+	outbox *Outbox
+	config ForwarderConfig
+	logger *zap.Logger
+
+	batch     []*models.Transaction
+	batchLock sync.Mutex
+	sendLock  sync.RWMutex // Adds share it; retractions and confirmations take it exclusively so they never overtake an add
+
+	wake    chan struct{}
+	pending atomic.Int64
+
+	forwarded    atomic.Uint64
+	queued       atomic.Uint64
+	failed       atomic.Uint64
+	deadLettered atomic.Uint64
+}
+
+// NewForwarder creates a forwarder. outbox may be nil to disable buffering.
+func NewForwarder(config ForwarderConfig, client *RaphtoryClient, outbox *Outbox, logger *zap.Logger) *Forwarder {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = 5 * time.Second
+	}
+	if config.MaxRetryInterval < config.RetryInterval {
+		config.MaxRetryInterval = 5 * time.Minute
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = 10 * time.Second
+	}
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = 20
+	}
+
+	return &Forwarder{
+		client: client,
+		outbox: outbox,
+		config: config,
+		logger: logger,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Start resumes delivery of writes left in the outbox, then drains the
+// outbox and flushes partial batches until ctx is cancelled
+func (f *Forwarder) Start(ctx context.Context) error {
+	if f.config.BatchSize > 1 {
+		go f.flushLoop(ctx)
+	}
+
+	if f.outbox == nil {
+		return nil
+	}
+
+	depth, err := f.outbox.Len(ctx)
+	if err != nil {
+		return err
+	}
+	f.pending.Store(int64(depth))
+
+	if depth > 0 {
+		f.logger.Info("Resuming queued Raphtory writes", zap.Int("depth", depth))
+	}
+
+	go f.drain(ctx)
+	return nil
+}
+
+// AddTransaction adds a transaction to the graph. With batching enabled the
+// transaction is buffered and sent with the next batch.
+func (f *Forwarder) AddTransaction(ctx context.Context, tx *models.Transaction) error {
+	if f.config.BatchSize <= 1 {
+		return f.write(ctx, OutboxAdd, tx.TxHash, tx)
+	}
+
+	f.batchLock.Lock()
+	f.batch = append(f.batch, tx)
+	var full []*models.Transaction
+	if len(f.batch) >= f.config.BatchSize {
+		full = f.batch
+		f.batch = nil
+	}
+	f.batchLock.Unlock()
+
+	if full == nil {
+		return nil
+	}
+	return f.sendBatch(ctx, full)
+}
+
+// DeleteTransaction retracts a transaction from the graph. Buffered
+// transactions are sent first so the retraction cannot overtake them.
+func (f *Forwarder) DeleteTransaction(ctx context.Context, txHash string) error {
+	if err := f.Flush(ctx); err != nil {
+		return err
+	}
+	return f.write(ctx, OutboxDelete, txHash, nil)
+}
+
+// ConfirmTransaction marks a transaction as confirmed. Like retractions,
+// buffered transactions are sent first.
+func (f *Forwarder) ConfirmTransaction(ctx context.Context, txHash string) error {
+	if err := f.Flush(ctx); err != nil {
+		return err
+	}
+	return f.write(ctx, OutboxConfirm, txHash, nil)
+}
+
+// Flush sends any buffered transactions
+func (f *Forwarder) Flush(ctx context.Context) error {
+	f.batchLock.Lock()
+	batch := f.batch
+	f.batch = nil
+	f.batchLock.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	return f.sendBatch(ctx, batch)
+}
+
+// Close sends any buffered transactions. Queued outbox entries are left for
+// the next run.
+func (f *Forwarder) Close(ctx context.Context) error {
+	return f.Flush(ctx)
+}
+
+// flushLoop sends partial batches every FlushInterval
+func (f *Forwarder) flushLoop(ctx context.Context) {
+	ticker := time.NewTicker(f.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := f.Flush(ctx); err != nil {
+				f.logger.Error("Failed to flush Raphtory batch", zap.Error(err))
+			}
+		}
+	}
+}
+
+// sendBatch delivers a batch directly, parking failed transactions in the
+// outbox if Raphtory is failing or earlier writes are still queued
+func (f *Forwarder) sendBatch(ctx context.Context, txs []*models.Transaction) error {
+	f.sendLock.RLock()
+	defer f.sendLock.RUnlock()
+
+	// Keep ordering: once anything is queued, new writes queue behind it
+	if f.outbox == nil || f.pending.Load() == 0 {
+		err := f.applyBatch(ctx, txs)
+		failed := failedTransactions(err, txs)
+		f.forwarded.Add(uint64(len(txs) - len(failed)))
+		if err == nil {
+			return nil
+		}
+
+		f.failed.Add(1)
+		if f.outbox == nil {
+			f.logger.Error("Failed to add transaction batch to Raphtory",
+				zap.Error(err),
+				zap.Int("size", len(txs)),
+				zap.Int("lost", len(failed)))
+			return nil
+		}
+
+		f.logger.Warn("Raphtory batch failed, queueing for retry",
+			zap.Error(err),
+			zap.Int("size", len(txs)),
+			zap.Int("queued", len(failed)))
+		txs = failed
+	}
+
+	for _, tx := range txs {
+		if err := f.enqueue(ctx, OutboxAdd, tx.TxHash, tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// write delivers a single write directly, or parks it in the outbox if
+// Raphtory is failing or earlier writes are still queued
+func (f *Forwarder) write(ctx context.Context, op OutboxOp, txHash string, tx *models.Transaction) error {
+	if op != OutboxAdd {
+		f.sendLock.Lock()
+		defer f.sendLock.Unlock()
+	} else {
+		f.sendLock.RLock()
+		defer f.sendLock.RUnlock()
+	}
+
+	// Keep ordering: once anything is queued, new writes queue behind it
+	if f.outbox == nil || f.pending.Load() == 0 {
+		err := f.apply(ctx, op, txHash, tx)
+		if err == nil {
+			f.forwarded.Add(1)
+			return nil
+		}
+
+		f.failed.Add(1)
+		if f.outbox == nil {
+			return err
+		}
+
+		f.logger.Warn("Raphtory write failed, queueing for retry",
+			zap.Error(err),
+			zap.String("op", string(op)),
+			zap.String("tx_hash", txHash))
+	}
+
+	return f.enqueue(ctx, op, txHash, tx)
+}
+
+// enqueue parks a write in the outbox and wakes the drain loop
+func (f *Forwarder) enqueue(ctx context.Context, op OutboxOp, txHash string, tx *models.Transaction) error {
+	if err := f.outbox.Push(ctx, op, txHash, tx); err != nil {
+		return err
+	}
+	f.queued.Add(1)
+
+	if f.pending.Add(1) == 1 {
+		select {
+		case f.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// apply performs a single Raphtory write
+func (f *Forwarder) apply(ctx context.Context, op OutboxOp, txHash string, tx *models.Transaction) error {
+	writeCtx, cancel := context.WithTimeout(ctx, f.config.WriteTimeout)
+	defer cancel()
+
+	var err error
+	switch op {
+	case OutboxAdd:
+		if tx == nil {
+			return fmt.Errorf("outbox entry for %s has no transaction", txHash)
+		}
+		err = f.client.AddTransaction(writeCtx, tx)
+	case OutboxDelete:
+		err = f.client.DeleteTransaction(writeCtx, txHash)
+	case OutboxConfirm:
+		err = f.client.ConfirmTransaction(writeCtx, txHash)
+	default:
+		return fmt.Errorf("unknown outbox operation: %s", op)
+	}
+
+	// Retrying cannot help a write the transport has no way to express
+	if errors.Is(err, ErrRaphtoryUnsupported) {
+		f.logger.Warn("Raphtory transport cannot apply write, dropping it",
+			zap.Error(err),
+			zap.String("op", string(op)),
+			zap.String("tx_hash", txHash))
+		return nil
+	}
+	return err
+}
+
+// applyBatch performs a single batched Raphtory write
+func (f *Forwarder) applyBatch(ctx context.Context, txs []*models.Transaction) error {
+	writeCtx, cancel := context.WithTimeout(ctx, f.config.WriteTimeout)
+	defer cancel()
+
+	return f.client.AddTransactions(writeCtx, txs)
+}
+
+// applyEntries sends queued adds as one batch and returns the IDs of the
+// entries that were not added
+func (f *Forwarder) applyEntries(ctx context.Context, entries []OutboxEntry) (map[int64]bool, error) {
+	txs := make([]*models.Transaction, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Transaction != nil {
+			txs = append(txs, entry.Transaction)
+		}
+	}
+
+	err := f.applyBatch(ctx, txs)
+	if err == nil {
+		return nil, nil
+	}
+
+	failedHashes := make(map[string]bool)
+	for _, tx := range failedTransactions(err, txs) {
+		failedHashes[tx.TxHash] = true
+	}
+
+	failed := make(map[int64]bool)
+	for _, entry := range entries {
+		if entry.Transaction == nil || failedHashes[entry.TxHash] {
+			failed[entry.ID] = true
+		}
+	}
+	return failed, err
+}
+
+// failedTransactions returns the transactions a batch write did not add: the
+// ones named by a *BatchError, or all of them for any other error
+func failedTransactions(err error, txs []*models.Transaction) []*models.Transaction {
+	if err == nil {
+		return nil
+	}
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		return txs
+	}
+
+	rejected := make(map[string]bool, len(batchErr.Failed))
+	for _, hash := range batchErr.Failed {
+		rejected[hash] = true
+	}
+
+	var failed []*models.Transaction
+	for _, tx := range txs {
+		if rejected[tx.TxHash] {
+			failed = append(failed, tx)
+		}
+	}
+	return failed
+}
+
+// drain retries queued writes, backing off while Raphtory keeps failing
+func (f *Forwarder) drain(ctx context.Context) {
+	delay := f.config.RetryInterval
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-f.wake:
+		case <-timer.C:
+		}
+
+		if f.drainOnce(ctx) {
+			delay = f.config.RetryInterval
+		} else {
+			delay *= 2
+			if delay > f.config.MaxRetryInterval {
+				delay = f.config.MaxRetryInterval
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(delay)
+	}
+}
+
+// drainOnce delivers queued writes in order until the outbox is empty or a
+// write fails. It reports whether the outbox was emptied.
+func (f *Forwarder) drainOnce(ctx context.Context) bool {
+	delivered := 0
+	for f.pending.Load() > 0 {
+		entries, err := f.outbox.Peek(ctx, f.config.BatchSize)
+		if err != nil {
+			f.logger.Error("Failed to read Raphtory outbox", zap.Error(err))
+			return false
+		}
+		if len(entries) == 0 {
+			f.pending.Store(0)
+			return true
+		}
+
+		for i := 0; i < len(entries); {
+			// Send runs of queued adds as one batch; retractions, and entries
+			// on their last attempt, go on their own so only the entry that
+			// keeps failing is dead-lettered
+			end := i + 1
+			if entries[i].Op == OutboxAdd && f.config.BatchSize > 1 && !f.lastAttempt(entries[i]) {
+				for end < len(entries) && entries[end].Op == OutboxAdd && !f.lastAttempt(entries[end]) {
+					end++
+				}
+			}
+			run := entries[i:end]
+
+			var err error
+			var failed map[int64]bool
+			if end-i > 1 {
+				failed, err = f.applyEntries(ctx, run)
+			} else if err = f.apply(ctx, run[0].Op, run[0].TxHash, run[0].Transaction); err != nil {
+				failed = map[int64]bool{run[0].ID: true}
+			}
+
+			for _, entry := range run {
+				if failed[entry.ID] {
+					continue
+				}
+				if err := f.outbox.Delete(ctx, entry.ID); err != nil {
+					// The write will be redelivered; stop until the database recovers
+					f.logger.Error("Failed to remove delivered outbox entry", zap.Error(err))
+					return false
+				}
+				f.forwarded.Add(1)
+				f.pending.Add(-1)
+				delivered++
+			}
+
+			if err != nil {
+				f.failed.Add(1)
+				if len(run) == 1 && f.lastAttempt(run[0]) {
+					if err := f.deadLetter(ctx, run[0], err); err != nil {
+						f.logger.Error("Failed to dead-letter outbox entry", zap.Error(err))
+						return false
+					}
+					i = end
+					continue
+				}
+
+				f.logger.Warn("Raphtory still unavailable, will retry queued writes",
+					zap.Error(err),
+					zap.Int64("depth", f.pending.Load()))
+				for _, entry := range run {
+					if !failed[entry.ID] {
+						continue
+					}
+					if err := f.outbox.RecordFailure(ctx, entry.ID, err); err != nil {
+						f.logger.Error("Failed to record outbox failure", zap.Error(err))
+					}
+				}
+				return false
+			}
+
+			i = end
+		}
+	}
+
+	if delivered > 0 {
+		f.logger.Info("Raphtory outbox drained", zap.Int("delivered", delivered))
+	}
+	return true
+}
+
+// lastAttempt reports whether failing to deliver entry again dead-letters it
+func (f *Forwarder) lastAttempt(entry OutboxEntry) bool {
+	return f.config.MaxAttempts > 0 && entry.Attempts+1 >= f.config.MaxAttempts
+}
+
+// deadLetter gives up on an entry that has failed MaxAttempts times, so the
+// writes queued behind it can be delivered
+func (f *Forwarder) deadLetter(ctx context.Context, entry OutboxEntry, deliveryErr error) error {
+	if err := f.outbox.DeadLetter(ctx, entry.ID, deliveryErr); err != nil {
+		return err
+	}
+	f.pending.Add(-1)
+	f.deadLettered.Add(1)
+	metrics.RaphtoryOutboxDeadLettered.WithLabelValues(string(entry.Op)).Inc()
+
+	f.logger.Warn("Raphtory write keeps failing, dead-lettering it",
+		zap.Error(deliveryErr),
+		zap.Int64("id", entry.ID),
+		zap.String("op", string(entry.Op)),
+		zap.String("tx_hash", entry.TxHash),
+		zap.Int("attempts", entry.Attempts+1))
+	return nil
+}
+
+// Stats returns a snapshot of the forwarding counters
+func (f *Forwarder) Stats() ForwarderStats {
+	return ForwarderStats{
+		Forwarded:    f.forwarded.Load(),
+		Queued:       f.queued.Load(),
+		Failed:       f.failed.Load(),
+		Depth:        f.pending.Load(),
+		DeadLettered: f.deadLettered.Load(),
+	}
+}
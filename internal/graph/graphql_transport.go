@@ -0,0 +1,682 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/errs"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// graphqlTransport speaks to Raphtory's own GraphQL server, reading and
+// writing one named graph. Each transaction is an edge update at its Unix
+// time carrying the transaction's fields as properties. Operations that rely
+// on the StableRisk service's bookkeeping or algorithms return
+// ErrRaphtoryUnsupported.
+type graphqlTransport struct {
+	endpoint  string
+	graphName string
+	send      sendFunc
+	retries   int
+	logger    *zap.Logger
+}
+
+// graphqlProperties is a Raphtory property set as key/value pairs
+type graphqlProperties struct {
+	Values []struct {
+		Key   string      `json:"key"`
+		Value interface{} `json:"value"`
+	} `json:"values"`
+}
+
+// toMap returns the properties keyed by name
+func (p graphqlProperties) toMap() map[string]interface{} {
+	props := make(map[string]interface{}, len(p.Values))
+	for _, v := range p.Values {
+		props[v.Key] = v.Value
+	}
+	return props
+}
+
+// graphqlName is a node reference
+type graphqlName struct {
+	Name string `json:"name"`
+}
+
+// graphqlEdgeUpdate is one exploded edge update: a single transaction
+type graphqlEdgeUpdate struct {
+	Time       int64             `json:"time"`
+	Src        graphqlName       `json:"src"`
+	Dst        graphqlName       `json:"dst"`
+	Properties graphqlProperties `json:"properties"`
+}
+
+// transaction converts an edge update back into the transaction it stores
+func (u graphqlEdgeUpdate) transaction() models.Transaction {
+	props := u.Properties.toMap()
+	text := func(key string) string {
+		s, _ := props[key].(string)
+		return s
+	}
+
+	amount, _ := decimal.NewFromString(text("amount"))
+	block, _ := props["block_number"].(float64)
+	confirmed, ok := props["confirmed"].(bool)
+
+	return models.Transaction{
+		TxHash:      text("tx_hash"),
+		From:        u.Src.Name,
+		To:          u.Dst.Name,
+		Amount:      amount,
+		BlockNumber: uint64(block),
+		Timestamp:   time.Unix(u.Time, 0),
+		Contract:    text("contract"),
+		Token:       text("token"),
+		Chain:       models.Chain(text("chain")),
+		Confirmed:   !ok || confirmed,
+	}
+}
+
+// query posts a GraphQL document with the client's configured retries
+func (t *graphqlTransport) query(ctx context.Context, operation, document string, variables map[string]interface{}, out interface{}) error {
+	return t.post(ctx, operation, document, variables, out, t.retries)
+}
+
+// post sends a GraphQL document and decodes the response's data into out.
+// Data is decoded even when the response also reports errors, so callers
+// can see which parts of a mutation succeeded; the first error is returned
+// as ErrRaphtoryRejected.
+func (t *graphqlTransport) post(ctx context.Context, operation, document string, variables map[string]interface{}, out interface{}, retries int) error {
+	body, err := json.Marshal(map[string]interface{}{"query": document, "variables": variables})
+	if err != nil {
+		return fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.send(req, operation, retries)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp.StatusCode)
+	}
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return decodeError(err)
+	}
+
+	if out != nil && len(result.Data) > 0 && string(result.Data) != "null" {
+		if err := json.Unmarshal(result.Data, out); err != nil {
+			return decodeError(err)
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		return errs.Record(errComponent, errs.Wrapf(ErrRaphtoryRejected, "raphtory graphql error: %s", result.Errors[0].Message))
+	}
+
+	return nil
+}
+
+// unsupported records and returns an ErrRaphtoryUnsupported for operation
+func unsupported(operation string) error {
+	return errs.Record(errComponent, errs.Wrapf(ErrRaphtoryUnsupported, "%s is not available over GraphQL", operation))
+}
+
+// propertyInput converts a value to Raphtory's PropertyInput, which tags the
+// value with its type
+func propertyInput(key string, value interface{}) (map[string]interface{}, error) {
+	var typed map[string]interface{}
+	switch v := value.(type) {
+	case string:
+		typed = map[string]interface{}{"str": v}
+	case bool:
+		typed = map[string]interface{}{"bool": v}
+	case int:
+		typed = map[string]interface{}{"i64": v}
+	case int64:
+		typed = map[string]interface{}{"i64": v}
+	case uint64:
+		typed = map[string]interface{}{"u64": v}
+	case float32:
+		typed = map[string]interface{}{"f64": v}
+	case float64:
+		typed = map[string]interface{}{"f64": v}
+	default:
+		return nil, fmt.Errorf("property %q has unsupported type %T", key, value)
+	}
+	return map[string]interface{}{"key": key, "value": typed}, nil
+}
+
+// transactionProperties returns the edge properties a transaction is stored with
+func transactionProperties(tx *models.Transaction) []map[string]interface{} {
+	return []map[string]interface{}{
+		{"key": "tx_hash", "value": map[string]interface{}{"str": tx.TxHash}},
+		{"key": "block_number", "value": map[string]interface{}{"u64": tx.BlockNumber}},
+		{"key": "amount", "value": map[string]interface{}{"str": tx.Amount.String()}},
+		{"key": "contract", "value": map[string]interface{}{"str": tx.Contract}},
+		{"key": "token", "value": map[string]interface{}{"str": tx.Token}},
+		{"key": "chain", "value": map[string]interface{}{"str": string(tx.Chain)}},
+		{"key": "confirmed", "value": map[string]interface{}{"bool": tx.Confirmed}},
+	}
+}
+
+// windowBounds converts a window to GraphQL view bounds, opening zero bounds
+// as far as they go
+func windowBounds(window Window) (int64, int64) {
+	start, end := int64(0), int64(math.MaxInt64)
+	if !window.Start.IsZero() {
+		start = window.Start.Unix()
+	}
+	if !window.End.IsZero() {
+		end = window.End.Unix()
+	}
+	return start, end
+}
+
+const addEdgeMutation = `mutation AddTransaction($graph: String!, $time: Int!, $src: String!, $dst: String!, $properties: [PropertyInput!]) {
+  updateGraph(path: $graph) {
+    addEdge(time: $time, src: $src, dst: $dst, properties: $properties) { success }
+  }
+}`
+
+// AddTransaction adds the transaction as an edge update
+func (t *graphqlTransport) AddTransaction(ctx context.Context, tx *models.Transaction) error {
+	var result struct {
+		UpdateGraph struct {
+			AddEdge struct {
+				Success bool `json:"success"`
+			} `json:"addEdge"`
+		} `json:"updateGraph"`
+	}
+	err := t.query(ctx, "add_transaction", addEdgeMutation, map[string]interface{}{
+		"graph":      t.graphName,
+		"time":       tx.Timestamp.Unix(),
+		"src":        tx.From,
+		"dst":        tx.To,
+		"properties": transactionProperties(tx),
+	}, &result)
+	if err != nil {
+		return err
+	}
+	if !result.UpdateGraph.AddEdge.Success {
+		return errs.Record(errComponent, errs.Wrapf(ErrRaphtoryRejected, "raphtory did not add transaction %s", tx.TxHash))
+	}
+
+	t.logger.Debug("Transaction added to Raphtory",
+		zap.String("tx_hash", tx.TxHash),
+		zap.String("from", tx.From),
+		zap.String("to", tx.To))
+
+	return nil
+}
+
+// AddTransactions adds every transaction in one mutation, one aliased
+// addEdge per transaction
+func (t *graphqlTransport) AddTransactions(ctx context.Context, txs []*models.Transaction) error {
+	var params, fields strings.Builder
+	variables := map[string]interface{}{"graph": t.graphName}
+	for i, tx := range txs {
+		fmt.Fprintf(&params, ", $t%d: Int!, $s%d: String!, $d%d: String!, $p%d: [PropertyInput!]", i, i, i, i)
+		fmt.Fprintf(&fields, "    tx%d: addEdge(time: $t%d, src: $s%d, dst: $d%d, properties: $p%d) { success }\n", i, i, i, i, i)
+		variables[fmt.Sprintf("t%d", i)] = tx.Timestamp.Unix()
+		variables[fmt.Sprintf("s%d", i)] = tx.From
+		variables[fmt.Sprintf("d%d", i)] = tx.To
+		variables[fmt.Sprintf("p%d", i)] = transactionProperties(tx)
+	}
+	document := fmt.Sprintf("mutation AddTransactions($graph: String!%s) {\n  updateGraph(path: $graph) {\n%s  }\n}", params.String(), fields.String())
+
+	var result struct {
+		UpdateGraph map[string]*struct {
+			Success bool `json:"success"`
+		} `json:"updateGraph"`
+	}
+	err := t.query(ctx, "add_transactions", document, variables, &result)
+	if err != nil && result.UpdateGraph == nil {
+		return err
+	}
+
+	// Individual edges can fail while the rest of the mutation succeeds
+	var failed []string
+	for i, tx := range txs {
+		if added := result.UpdateGraph[fmt.Sprintf("tx%d", i)]; added == nil || !added.Success {
+			failed = append(failed, tx.TxHash)
+		}
+	}
+
+	t.logger.Debug("Transaction batch added to Raphtory",
+		zap.Int("size", len(txs)),
+		zap.Int("added", len(txs)-len(failed)))
+
+	if len(failed) > 0 {
+		return &BatchError{Failed: failed}
+	}
+
+	return nil
+}
+
+// DeleteTransaction is unsupported: GraphQL cannot find an edge update by
+// transaction hash
+func (t *graphqlTransport) DeleteTransaction(ctx context.Context, txHash string) error {
+	return unsupported("delete_transaction")
+}
+
+// ConfirmTransaction is unsupported: GraphQL cannot find an edge update by
+// transaction hash
+func (t *graphqlTransport) ConfirmTransaction(ctx context.Context, txHash string) error {
+	return unsupported("confirm_transaction")
+}
+
+const nodeLatestQuery = `query NodeLatest($graph: String!, $name: String!) {
+  graph(path: $graph) {
+    node(name: $name) { latestTime }
+  }
+}`
+
+const nodeUpdateMutation = `mutation SetNodeProperties($graph: String!, $name: String!, $time: Int!, $properties: [PropertyInput!]) {
+  updateGraph(path: $graph) {
+    node(name: $name) { addUpdates(time: $time, properties: $properties) }
+  }
+}`
+
+const addNodeMutation = `mutation AddNode($graph: String!, $name: String!, $time: Int!, $properties: [PropertyInput!]) {
+  updateGraph(path: $graph) {
+    addNode(time: $time, name: $name, properties: $properties) { success }
+  }
+}`
+
+// SetNodeProperties writes the tags as property updates at the node's latest
+// time, so tagging does not extend its activity. Unknown addresses are added
+// now. Raphtory cannot remove a property, so nil values are unsupported.
+func (t *graphqlTransport) SetNodeProperties(ctx context.Context, address string, properties map[string]any) error {
+	keys := make([]string, 0, len(properties))
+	for key, value := range properties {
+		if value == nil {
+			return errs.Record(errComponent, errs.Wrapf(ErrRaphtoryUnsupported, "removing property %q is not available over GraphQL", key))
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	inputs := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		input, err := propertyInput(key, properties[key])
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, input)
+	}
+
+	var latest struct {
+		Graph struct {
+			Node *struct {
+				LatestTime int64 `json:"latestTime"`
+			} `json:"node"`
+		} `json:"graph"`
+	}
+	variables := map[string]interface{}{"graph": t.graphName, "name": address}
+	if err := t.query(ctx, "get_node_latest", nodeLatestQuery, variables, &latest); err != nil {
+		return err
+	}
+
+	variables["properties"] = inputs
+	var err error
+	if latest.Graph.Node != nil {
+		variables["time"] = latest.Graph.Node.LatestTime
+		err = t.query(ctx, "set_node_properties", nodeUpdateMutation, variables, nil)
+	} else {
+		variables["time"] = time.Now().Unix()
+		err = t.query(ctx, "set_node_properties", addNodeMutation, variables, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	t.logger.Debug("Node properties set in Raphtory",
+		zap.String("address", address),
+		zap.Int("properties", len(properties)))
+
+	return nil
+}
+
+const nodesQuery = `query Nodes($graph: String!) {
+  graph(path: $graph) {
+    nodes { list { name properties { values { key value } } } }
+  }
+}`
+
+// FindNodesByProperty scans every node's properties, comparing values as text
+func (t *graphqlTransport) FindNodesByProperty(ctx context.Context, key string, value any, limit int) ([]TaggedNode, error) {
+	var result struct {
+		Graph struct {
+			Nodes struct {
+				List []struct {
+					Name       string            `json:"name"`
+					Properties graphqlProperties `json:"properties"`
+				} `json:"list"`
+			} `json:"nodes"`
+		} `json:"graph"`
+	}
+	if err := t.query(ctx, "find_nodes", nodesQuery, map[string]interface{}{"graph": t.graphName}, &result); err != nil {
+		return nil, err
+	}
+
+	var nodes []TaggedNode
+	for _, node := range result.Graph.Nodes.List {
+		props := node.Properties.toMap()
+		tag, ok := props[key]
+		if !ok || (value != nil && fmt.Sprint(tag) != fmt.Sprint(value)) {
+			continue
+		}
+		nodes = append(nodes, TaggedNode{Address: node.Name, Properties: props})
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Address < nodes[j].Address })
+	if len(nodes) > limit {
+		nodes = nodes[:limit]
+	}
+	return nodes, nil
+}
+
+const nodeInfoQuery = `query NodeInfo($graph: String!, $name: String!) {
+  graph(path: $graph) {
+    node(name: $name) {
+      name
+      earliestTime
+      latestTime
+      properties { values { key value } }
+      outEdges { explode { list { properties { values { key value } } } } }
+      inEdges { explode { list { properties { values { key value } } } } }
+    }
+  }
+}`
+
+// GetNodeInfo totals the node's exploded edges; an unknown address is nil
+func (t *graphqlTransport) GetNodeInfo(ctx context.Context, address string) (*NodeInfo, error) {
+	type updates struct {
+		Explode struct {
+			List []graphqlEdgeUpdate `json:"list"`
+		} `json:"explode"`
+	}
+	var result struct {
+		Graph struct {
+			Node *struct {
+				Name         string            `json:"name"`
+				EarliestTime int64             `json:"earliestTime"`
+				LatestTime   int64             `json:"latestTime"`
+				Properties   graphqlProperties `json:"properties"`
+				OutEdges     updates           `json:"outEdges"`
+				InEdges      updates           `json:"inEdges"`
+			} `json:"node"`
+		} `json:"graph"`
+	}
+	variables := map[string]interface{}{"graph": t.graphName, "name": address}
+	if err := t.query(ctx, "get_node_info", nodeInfoQuery, variables, &result); err != nil {
+		return nil, err
+	}
+
+	node := result.Graph.Node
+	if node == nil {
+		return nil, nil
+	}
+
+	info := &NodeInfo{
+		Address:       node.Name,
+		FirstSeen:     node.EarliestTime,
+		LastSeen:      node.LatestTime,
+		SentCount:     len(node.OutEdges.Explode.List),
+		ReceivedCount: len(node.InEdges.Explode.List),
+	}
+	for _, update := range node.OutEdges.Explode.List {
+		amount, _ := update.transaction().Amount.Float64()
+		info.TotalSent += amount
+	}
+	for _, update := range node.InEdges.Explode.List {
+		amount, _ := update.transaction().Amount.Float64()
+		info.TotalReceived += amount
+	}
+	info.TransactionCount = info.SentCount + info.ReceivedCount
+	if props := node.Properties.toMap(); len(props) > 0 {
+		info.Properties = props
+	}
+
+	return info, nil
+}
+
+const windowQuery = `query Window($graph: String!, $start: Int!, $end: Int!) {
+  graph(path: $graph) {
+    window(start: $start, end: $end) {
+      edges { explode { list { time src { name } dst { name } properties { values { key value } } } } }
+    }
+  }
+}`
+
+// windowTransactions returns every transaction in [start, end), oldest first
+func (t *graphqlTransport) windowTransactions(ctx context.Context, operation string, start, end int64) ([]models.Transaction, error) {
+	var result struct {
+		Graph struct {
+			Window struct {
+				Edges struct {
+					Explode struct {
+						List []graphqlEdgeUpdate `json:"list"`
+					} `json:"explode"`
+				} `json:"edges"`
+			} `json:"window"`
+		} `json:"graph"`
+	}
+	variables := map[string]interface{}{"graph": t.graphName, "start": start, "end": end}
+	if err := t.query(ctx, operation, windowQuery, variables, &result); err != nil {
+		return nil, err
+	}
+
+	updates := result.Graph.Window.Edges.Explode.List
+	transactions := make([]models.Transaction, len(updates))
+	for i, update := range updates {
+		transactions[i] = update.transaction()
+	}
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Timestamp.Before(transactions[j].Timestamp)
+	})
+	return transactions, nil
+}
+
+// GetTransactionsInWindow reads the window's exploded edges
+func (t *graphqlTransport) GetTransactionsInWindow(ctx context.Context, startTime, endTime int64, limit int) ([]models.Transaction, error) {
+	transactions, err := t.windowTransactions(ctx, "get_transactions_in_window", startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(transactions) > limit {
+		transactions = transactions[:limit]
+	}
+	return transactions, nil
+}
+
+// QueryTransactions filters and pages the window's transactions on the
+// client
+func (t *graphqlTransport) QueryTransactions(ctx context.Context, query TransactionQuery) (*TransactionPage, error) {
+	start, end := windowBounds(query.Window)
+	transactions, err := t.windowTransactions(ctx, "query_transactions", start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]models.Transaction, 0, len(transactions))
+	for i := range transactions {
+		if query.matches(&transactions[i]) {
+			matched = append(matched, transactions[i])
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].Timestamp.Equal(matched[j].Timestamp) {
+			return matched[i].Timestamp.After(matched[j].Timestamp)
+		}
+		return matched[i].TxHash > matched[j].TxHash
+	})
+
+	page := &TransactionPage{Transactions: []models.Transaction{}, Total: len(matched)}
+	if query.Offset < len(matched) {
+		matched = matched[query.Offset:]
+		if len(matched) > query.Limit {
+			matched = matched[:query.Limit]
+		}
+		page.Transactions = matched
+	}
+	return page, nil
+}
+
+// GetTransaction is unsupported over GraphQL
+func (t *graphqlTransport) GetTransaction(ctx context.Context, txHash string) (*models.Transaction, error) {
+	return nil, unsupported("get_transaction")
+}
+
+// GetNeighbors is unsupported over GraphQL
+func (t *graphqlTransport) GetNeighbors(ctx context.Context, address string, hops int, window Window) (*Neighborhood, error) {
+	return nil, unsupported("get_neighbors")
+}
+
+// GetSubgraph is unsupported over GraphQL
+func (t *graphqlTransport) GetSubgraph(ctx context.Context, address string, hops int, window Window) (*Subgraph, error) {
+	return nil, unsupported("get_subgraph")
+}
+
+// FindPaths is unsupported over GraphQL
+func (t *graphqlTransport) FindPaths(ctx context.Context, from, to string, maxHops int, window Window) (*PathSet, error) {
+	return nil, unsupported("find_paths")
+}
+
+// GetTopDegree ranks the window's transactions on the client
+func (t *graphqlTransport) GetTopDegree(ctx context.Context, direction DegreeDirection, window Window, limit int) ([]NodeDegree, error) {
+	start, end := windowBounds(window)
+	transactions, err := t.windowTransactions(ctx, "get_top_degree", start, end)
+	if err != nil {
+		return nil, err
+	}
+	return rankDegrees(transactions, direction, limit), nil
+}
+
+// GetAddressActivity aggregates the window's transactions on the client
+func (t *graphqlTransport) GetAddressActivity(ctx context.Context, window Window, minCount int) ([]AddressActivity, error) {
+	start, end := windowBounds(window)
+	transactions, err := t.windowTransactions(ctx, "get_address_activity", start, end)
+	if err != nil {
+		return nil, err
+	}
+	return aggregateActivity(transactions, minCount), nil
+}
+
+const pageRankQuery = `query PageRank($graph: String!, $start: Int!, $end: Int!) {
+  graph(path: $graph) {
+    window(start: $start, end: $end) {
+      algorithms { pagerank(iterCount: 20) { name rank } }
+    }
+  }
+}`
+
+// GetPageRank runs Raphtory's PageRank over the window. Raphtory's version
+// is unweighted, so scores differ from the REST service's, which weights
+// edges by transaction count.
+func (t *graphqlTransport) GetPageRank(ctx context.Context, window Window, limit int) ([]NodeScore, error) {
+	var result struct {
+		Graph struct {
+			Window struct {
+				Algorithms struct {
+					PageRank []struct {
+						Name string  `json:"name"`
+						Rank float64 `json:"rank"`
+					} `json:"pagerank"`
+				} `json:"algorithms"`
+			} `json:"window"`
+		} `json:"graph"`
+	}
+	start, end := windowBounds(window)
+	variables := map[string]interface{}{"graph": t.graphName, "start": start, "end": end}
+	if err := t.query(ctx, "get_pagerank", pageRankQuery, variables, &result); err != nil {
+		return nil, err
+	}
+
+	ranks := result.Graph.Window.Algorithms.PageRank
+	scores := make([]NodeScore, len(ranks))
+	for i, rank := range ranks {
+		scores[i] = NodeScore{Address: rank.Name, Score: rank.Rank}
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Address < scores[j].Address
+	})
+	if len(scores) > limit {
+		scores = scores[:limit]
+	}
+	return scores, nil
+}
+
+// GetCommunities is unsupported over GraphQL
+func (t *graphqlTransport) GetCommunities(ctx context.Context, window Window) ([]Community, error) {
+	return nil, unsupported("get_communities")
+}
+
+const statisticsQuery = `query Statistics($graph: String!) {
+  graph(path: $graph) { countNodes countEdges countTemporalEdges earliestTime latestTime }
+}`
+
+// GetStatistics reads the graph's counts and time range
+func (t *graphqlTransport) GetStatistics(ctx context.Context) (*GraphStatistics, error) {
+	var result struct {
+		Graph struct {
+			CountNodes         int    `json:"countNodes"`
+			CountEdges         int    `json:"countEdges"`
+			CountTemporalEdges int64  `json:"countTemporalEdges"`
+			EarliestTime       *int64 `json:"earliestTime"` // Null for an empty graph
+			LatestTime         *int64 `json:"latestTime"`
+		} `json:"graph"`
+	}
+	if err := t.query(ctx, "get_statistics", statisticsQuery, map[string]interface{}{"graph": t.graphName}, &result); err != nil {
+		return nil, err
+	}
+
+	stats := &GraphStatistics{
+		NodeCount:        result.Graph.CountNodes,
+		EdgeCount:        result.Graph.CountEdges,
+		TransactionCount: result.Graph.CountTemporalEdges,
+	}
+	if result.Graph.EarliestTime != nil {
+		stats.EarliestTime = *result.Graph.EarliestTime
+	}
+	if result.Graph.LatestTime != nil {
+		stats.LatestTime = *result.Graph.LatestTime
+	}
+	return stats, nil
+}
+
+// Health sends a trivial query without retrying
+func (t *graphqlTransport) Health(ctx context.Context) error {
+	if err := t.post(ctx, "health", `query Health { __typename }`, nil, nil, 0); err != nil {
+		return fmt.Errorf("raphtory health check failed: %w", err)
+	}
+	return nil
+}
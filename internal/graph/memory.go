@@ -0,0 +1,329 @@
+package graph
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+)
+
+// MemoryGraphConfig holds in-memory graph settings
+type MemoryGraphConfig struct {
+	Capacity  int           // Transactions kept; the oldest arrivals are dropped first (default 100,000)
+	Retention time.Duration // Transactions older than this are dropped too; 0 keeps them until capacity evicts them
+}
+
+// MemoryGraph is a small in-process temporal graph of recent transactions
+// for when Raphtory cannot be reached. Transactions are kept in a ring
+// buffer in arrival order, with indexes of the transfers between each pair
+// of addresses. It answers the same window and degree queries as
+// RaphtoryClient so detectors can switch between them.
+type MemoryGraph struct {
+	config MemoryGraphConfig
+
+	mu     sync.RWMutex
+	ring   []memoryEntry
+	head   int // Next slot to write
+	size   int
+	byHash map[string]int            // Ring slot of each live transaction
+	out    map[string]map[string]int // Sender -> receiver -> live transfers
+	in     map[string]map[string]int // Receiver -> sender -> live transfers
+}
+
+type memoryEntry struct {
+	tx        models.Transaction
+	retracted bool
+}
+
+// NewMemoryGraph creates an empty in-memory graph
+func NewMemoryGraph(config MemoryGraphConfig) *MemoryGraph {
+	if config.Capacity <= 0 {
+		config.Capacity = 100000
+	}
+
+	return &MemoryGraph{
+		config: config,
+		ring:   make([]memoryEntry, config.Capacity),
+		byHash: make(map[string]int),
+		out:    make(map[string]map[string]int),
+		in:     make(map[string]map[string]int),
+	}
+}
+
+// Add records a transaction, evicting the oldest arrival when the buffer is
+// full. A transaction already held is ignored, so replays are harmless.
+func (g *MemoryGraph) Add(tx models.Transaction) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, exists := g.byHash[tx.TxHash]; exists {
+		return
+	}
+
+	g.expire()
+	if g.size == len(g.ring) {
+		g.evict()
+	}
+
+	g.ring[g.head] = memoryEntry{tx: tx}
+	g.byHash[tx.TxHash] = g.head
+	g.link(tx.From, tx.To, 1)
+	g.head = (g.head + 1) % len(g.ring)
+	g.size++
+}
+
+// Retract drops a transaction reverted by a chain reorganisation from query
+// results. Unknown hashes are ignored.
+func (g *MemoryGraph) Retract(txHash string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	slot, ok := g.byHash[txHash]
+	if !ok || g.ring[slot].retracted {
+		return
+	}
+	g.ring[slot].retracted = true
+	g.link(g.ring[slot].tx.From, g.ring[slot].tx.To, -1)
+}
+
+// Confirm marks a transaction as having reached the confirmation depth.
+// Unknown hashes are ignored.
+func (g *MemoryGraph) Confirm(txHash string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if slot, ok := g.byHash[txHash]; ok {
+		g.ring[slot].tx.Confirmed = true
+	}
+}
+
+// Len returns the number of transactions held, including retracted ones
+// not yet evicted
+func (g *MemoryGraph) Len() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.size
+}
+
+// Neighbors returns the addresses an address has live transfers with
+func (g *MemoryGraph) Neighbors(address string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	for other := range g.out[address] {
+		seen[other] = true
+	}
+	for other := range g.in[address] {
+		seen[other] = true
+	}
+
+	neighbors := make([]string, 0, len(seen))
+	for other := range seen {
+		neighbors = append(neighbors, other)
+	}
+	sort.Strings(neighbors)
+	return neighbors
+}
+
+// GetTransactionsInWindow returns up to limit live transactions with
+// timestamps in [startTime, endTime), oldest first. It matches
+// RaphtoryClient.GetTransactionsInWindow and never fails.
+func (g *MemoryGraph) GetTransactionsInWindow(ctx context.Context, startTime, endTime int64, limit int) ([]models.Transaction, error) {
+	g.mu.RLock()
+	var transactions []models.Transaction
+	g.each(func(entry *memoryEntry) {
+		ts := entry.tx.Timestamp.Unix()
+		if ts >= startTime && ts < endTime {
+			transactions = append(transactions, entry.tx)
+		}
+	})
+	g.mu.RUnlock()
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Timestamp.Before(transactions[j].Timestamp)
+	})
+	if limit > 0 && len(transactions) > limit {
+		transactions = transactions[:limit]
+	}
+	return transactions, nil
+}
+
+// GetTopDegree returns the limit addresses with the most distinct
+// counterparties in direction within window, highest first. It matches
+// RaphtoryClient.GetTopDegree and never fails.
+func (g *MemoryGraph) GetTopDegree(ctx context.Context, direction DegreeDirection, window Window, limit int) ([]NodeDegree, error) {
+	return rankDegrees(g.inWindow(window), direction, limit), nil
+}
+
+// GetAddressActivity returns every address with at least minCount
+// transactions within window, ordered by address. It matches
+// RaphtoryClient.GetAddressActivity and never fails.
+func (g *MemoryGraph) GetAddressActivity(ctx context.Context, window Window, minCount int) ([]AddressActivity, error) {
+	return aggregateActivity(g.inWindow(window), minCount), nil
+}
+
+// inWindow returns the live transactions within window in arrival order
+func (g *MemoryGraph) inWindow(window Window) []models.Transaction {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var transactions []models.Transaction
+	g.each(func(entry *memoryEntry) {
+		ts := entry.tx.Timestamp
+		if (window.Start.IsZero() || !ts.Before(window.Start)) && (window.End.IsZero() || ts.Before(window.End)) {
+			transactions = append(transactions, entry.tx)
+		}
+	})
+	return transactions
+}
+
+// aggregateActivity totals each address's distinct counterparties and
+// transfers and returns those with at least minCount transactions, ordered
+// by address
+func aggregateActivity(transactions []models.Transaction, minCount int) []AddressActivity {
+	nodes := make(map[string]*AddressActivity)
+	node := func(address string) *AddressActivity {
+		n, ok := nodes[address]
+		if !ok {
+			n = &AddressActivity{NodeDegree: NodeDegree{Address: address}}
+			nodes[address] = n
+		}
+		return n
+	}
+	seen := func(n *AddressActivity, tx models.Transaction) {
+		ts := tx.Timestamp.Unix()
+		if n.FirstTxHash == "" || ts < n.FirstSeen {
+			n.FirstSeen = ts
+			n.FirstTxHash = tx.TxHash
+		}
+		if ts > n.LastSeen {
+			n.LastSeen = ts
+		}
+		if !tx.Confirmed {
+			n.UnconfirmedCount++
+		}
+	}
+
+	type pair struct{ from, to string }
+	pairs := make(map[pair]bool)
+	for _, tx := range transactions {
+		sender, receiver := node(tx.From), node(tx.To)
+		sender.OutCount++
+		sender.Sent = sender.Sent.Add(tx.Amount)
+		receiver.InCount++
+		receiver.Received = receiver.Received.Add(tx.Amount)
+		seen(sender, tx)
+		seen(receiver, tx)
+
+		key := pair{tx.From, tx.To}
+		if !pairs[key] {
+			pairs[key] = true
+			sender.OutDegree++
+			receiver.InDegree++
+		}
+	}
+
+	activity := make([]AddressActivity, 0, len(nodes))
+	for _, n := range nodes {
+		if n.TransactionCount() >= minCount {
+			activity = append(activity, *n)
+		}
+	}
+	sort.Slice(activity, func(i, j int) bool {
+		return activity[i].Address < activity[j].Address
+	})
+	return activity
+}
+
+// rankDegrees totals each address's distinct counterparties and transfers
+// and returns the limit addresses with the highest degree in direction,
+// ties broken by address
+func rankDegrees(transactions []models.Transaction, direction DegreeDirection, limit int) []NodeDegree {
+	rank := func(n *NodeDegree) int {
+		switch direction {
+		case DegreeIn:
+			return n.InDegree
+		case DegreeOut:
+			return n.OutDegree
+		default:
+			return n.InDegree + n.OutDegree
+		}
+	}
+
+	activity := aggregateActivity(transactions, 0)
+	ranked := make([]NodeDegree, len(activity))
+	for i := range activity {
+		ranked[i] = activity[i].NodeDegree
+	}
+	// Stable keeps address order among equal degrees
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return rank(&ranked[i]) > rank(&ranked[j])
+	})
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+// each calls fn for every live transaction. mu must be held.
+func (g *MemoryGraph) each(fn func(entry *memoryEntry)) {
+	for i := 0; i < g.size; i++ {
+		entry := &g.ring[g.slot(i)]
+		if !entry.retracted {
+			fn(entry)
+		}
+	}
+}
+
+// slot returns the ring slot of the i-th oldest arrival. mu must be held.
+func (g *MemoryGraph) slot(i int) int {
+	return (g.head - g.size + i + len(g.ring)) % len(g.ring)
+}
+
+// expire drops the oldest arrivals while they are past the retention period.
+// Arrivals are roughly in timestamp order, so a late straggler can outlive
+// its retention until capacity evicts it. mu must be held.
+func (g *MemoryGraph) expire() {
+	if g.config.Retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-g.config.Retention)
+	for g.size > 0 && g.ring[g.slot(0)].tx.Timestamp.Before(cutoff) {
+		g.evict()
+	}
+}
+
+// evict drops the oldest arrival. mu must be held.
+func (g *MemoryGraph) evict() {
+	slot := g.slot(0)
+	entry := g.ring[slot]
+	if !entry.retracted {
+		g.link(entry.tx.From, entry.tx.To, -1)
+	}
+	delete(g.byHash, entry.tx.TxHash)
+	g.ring[slot] = memoryEntry{}
+	g.size--
+}
+
+// link adjusts the transfer count between two addresses. mu must be held.
+func (g *MemoryGraph) link(from, to string, delta int) {
+	adjust := func(index map[string]map[string]int, a, b string) {
+		links := index[a]
+		if links == nil {
+			links = make(map[string]int)
+			index[a] = links
+		}
+		links[b] += delta
+		if links[b] <= 0 {
+			delete(links, b)
+			if len(links) == 0 {
+				delete(index, a)
+			}
+		}
+	}
+	adjust(g.out, from, to)
+	adjust(g.in, to, from)
+}
@@ -0,0 +1,148 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+)
+
+// OutboxOp is the Raphtory write an outbox entry replays
+type OutboxOp string
+
+const (
+	// OutboxAdd adds a transaction to the graph
+	OutboxAdd OutboxOp = "add"
+	// OutboxDelete retracts a transaction from the graph
+	OutboxDelete OutboxOp = "delete"
+	// OutboxConfirm marks a transaction added unconfirmed as confirmed
+	OutboxConfirm OutboxOp = "confirm"
+)
+
+// OutboxEntry is a Raphtory write waiting to be delivered
+type OutboxEntry struct {
+	ID          int64
+	Op          OutboxOp
+	TxHash      string
+	Transaction *models.Transaction // Set for OutboxAdd
+	Attempts    int
+	LastError   string
+	CreatedAt   time.Time
+}
+
+// Outbox persists Raphtory writes in the raphtory_outbox table so they survive
+// a Raphtory outage or a monitor restart. Entries are delivered in ID order.
+// Dead-lettered entries stay in the table for inspection but are no longer
+// delivered or counted.
+type Outbox struct {
+	db *sql.DB
+}
+
+// NewOutbox creates a database-backed outbox
+func NewOutbox(db *sql.DB) *Outbox {
+	return &Outbox{db: db}
+}
+
+// Push appends a write to the outbox
+func (o *Outbox) Push(ctx context.Context, op OutboxOp, txHash string, tx *models.Transaction) error {
+	var payload []byte
+	if tx != nil {
+		data, err := json.Marshal(tx)
+		if err != nil {
+			return fmt.Errorf("failed to encode transaction: %w", err)
+		}
+		payload = data
+	}
+
+	_, err := o.db.ExecContext(ctx, `
+		INSERT INTO raphtory_outbox (op, tx_hash, payload, attempts, created_at)
+		VALUES ($1, $2, $3, 0, $4)
+	`, string(op), txHash, payload, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to queue raphtory write: %w", err)
+	}
+
+	return nil
+}
+
+// Peek returns up to limit of the oldest entries without removing them
+func (o *Outbox) Peek(ctx context.Context, limit int) ([]OutboxEntry, error) {
+	rows, err := o.db.QueryContext(ctx, `
+		SELECT id, op, tx_hash, payload, attempts, COALESCE(last_error, ''), created_at
+		FROM raphtory_outbox
+		WHERE dead_lettered_at IS NULL
+		ORDER BY id
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []OutboxEntry
+	for rows.Next() {
+		var entry OutboxEntry
+		var op string
+		var payload []byte
+		if err := rows.Scan(&entry.ID, &op, &entry.TxHash, &payload, &entry.Attempts,
+			&entry.LastError, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox entry: %w", err)
+		}
+		entry.Op = OutboxOp(op)
+
+		if len(payload) > 0 {
+			var tx models.Transaction
+			if err := json.Unmarshal(payload, &tx); err != nil {
+				return nil, fmt.Errorf("failed to decode outbox entry %d: %w", entry.ID, err)
+			}
+			entry.Transaction = &tx
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// Delete removes a delivered entry
+func (o *Outbox) Delete(ctx context.Context, id int64) error {
+	if _, err := o.db.ExecContext(ctx, `DELETE FROM raphtory_outbox WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete outbox entry: %w", err)
+	}
+	return nil
+}
+
+// RecordFailure notes a failed delivery attempt
+func (o *Outbox) RecordFailure(ctx context.Context, id int64, deliveryErr error) error {
+	_, err := o.db.ExecContext(ctx, `
+		UPDATE raphtory_outbox SET attempts = attempts + 1, last_error = $1 WHERE id = $2
+	`, deliveryErr.Error(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update outbox entry: %w", err)
+	}
+	return nil
+}
+
+// DeadLetter records a final failed delivery attempt and stops delivering
+// the entry
+func (o *Outbox) DeadLetter(ctx context.Context, id int64, deliveryErr error) error {
+	_, err := o.db.ExecContext(ctx, `
+		UPDATE raphtory_outbox SET attempts = attempts + 1, last_error = $1, dead_lettered_at = $2 WHERE id = $3
+	`, deliveryErr.Error(), time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter outbox entry: %w", err)
+	}
+	return nil
+}
+
+// Len returns the number of queued entries, excluding dead-lettered ones
+func (o *Outbox) Len(ctx context.Context) (int, error) {
+	var count int
+	if err := o.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM raphtory_outbox WHERE dead_lettered_at IS NULL`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count outbox entries: %w", err)
+	}
+	return count, nil
+}
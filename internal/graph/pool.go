@@ -0,0 +1,249 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// PoolConfig holds forwarding worker pool configuration
+type PoolConfig struct {
+	Workers   int           // Concurrent forwarding workers (default 4)
+	QueueSize int           // Transactions waiting across all workers before Submit blocks (default 1000)
+	Timeout   time.Duration // Per-transaction forwarding timeout (default 30 seconds)
+	// OrderByAddress routes every transaction from the same sender to the same
+	// worker so they are forwarded in the order they were received. Without it
+	// any idle worker takes the next transaction.
+	OrderByAddress bool
+}
+
+// PoolStats holds worker pool counters
+type PoolStats struct {
+	QueueDepth int    // Transactions waiting for a worker
+	Active     int64  // Workers currently forwarding
+	Processed  uint64 // Transactions handed to the forwarder
+	Errors     uint64 // Transactions the forwarder failed to accept
+}
+
+// ForwardPool forwards transactions to Raphtory from a bounded set of
+// workers, so one slow call does not stall ingestion
+type ForwardPool struct {
+	config    PoolConfig
+	forwarder *Forwarder
+	logger    *zap.Logger
+
+	queues []chan *models.Transaction // One per worker with OrderByAddress, otherwise one shared queue
+	cancel []context.CancelFunc       // Per-worker contexts
+	wg     sync.WaitGroup
+	idle   *sync.Cond // Signalled when a worker finishes a transaction
+	mu     sync.Mutex
+
+	inflight  atomic.Int64 // Submitted but not yet forwarded
+	active    atomic.Int64
+	processed atomic.Uint64
+	errors    atomic.Uint64
+}
+
+// NewForwardPool creates a worker pool in front of forwarder
+func NewForwardPool(config PoolConfig, forwarder *Forwarder, logger *zap.Logger) *ForwardPool {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.Workers <= 0 {
+		config.Workers = 4
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1000
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	queueCount, queueSize := 1, config.QueueSize
+	if config.OrderByAddress {
+		queueCount = config.Workers
+		queueSize = (config.QueueSize + config.Workers - 1) / config.Workers
+	}
+
+	queues := make([]chan *models.Transaction, queueCount)
+	for i := range queues {
+		queues[i] = make(chan *models.Transaction, queueSize)
+	}
+
+	p := &ForwardPool{
+		config:    config,
+		forwarder: forwarder,
+		logger:    logger,
+		queues:    queues,
+	}
+	p.idle = sync.NewCond(&p.mu)
+	return p
+}
+
+// Start launches the workers. Each worker runs with its own context derived
+// from ctx.
+func (p *ForwardPool) Start(ctx context.Context) {
+	p.cancel = make([]context.CancelFunc, p.config.Workers)
+	for i := 0; i < p.config.Workers; i++ {
+		workerCtx, cancel := context.WithCancel(ctx)
+		p.cancel[i] = cancel
+
+		queue := p.queues[0]
+		if p.config.OrderByAddress {
+			queue = p.queues[i]
+		}
+
+		p.wg.Add(1)
+		go p.work(workerCtx, i, queue)
+	}
+
+	p.logger.Info("Forwarding workers started",
+		zap.Int("workers", p.config.Workers),
+		zap.Int("queue_size", p.config.QueueSize),
+		zap.Bool("order_by_address", p.config.OrderByAddress))
+}
+
+// Submit queues a transaction for forwarding, blocking while the queue is full
+func (p *ForwardPool) Submit(ctx context.Context, tx *models.Transaction) error {
+	queue := p.queues[0]
+	if p.config.OrderByAddress {
+		queue = p.queues[p.route(tx.From)]
+	}
+
+	p.inflight.Add(1)
+	select {
+	case queue <- tx:
+		return nil
+	case <-ctx.Done():
+		p.done()
+		return ctx.Err()
+	}
+}
+
+// done marks a submitted transaction as finished and wakes Wait
+func (p *ForwardPool) done() {
+	p.inflight.Add(-1)
+	p.mu.Lock()
+	p.idle.Broadcast()
+	p.mu.Unlock()
+}
+
+// route picks the worker queue for a sender address
+func (p *ForwardPool) route(address string) int {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(address)))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// Wait blocks until every queued transaction has been handed to the
+// forwarder, e.g. before retracting a transaction that may still be queued
+func (p *ForwardPool) Wait(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		p.idle.Broadcast()
+		p.mu.Unlock()
+	})
+	defer stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.inflight.Load() > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p.idle.Wait()
+	}
+	return nil
+}
+
+// Close stops accepting transactions and waits for the workers to forward
+// what is already queued, cancelling them if ctx expires first. Submit must
+// not be called after Close.
+func (p *ForwardPool) Close(ctx context.Context) error {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, cancel := range p.cancel {
+			cancel()
+		}
+		<-done
+		return fmt.Errorf("forwarding workers stopped with %d transactions queued: %w", p.depth(), ctx.Err())
+	}
+}
+
+// work forwards transactions from queue until it is closed or ctx is cancelled
+func (p *ForwardPool) work(ctx context.Context, id int, queue chan *models.Transaction) {
+	defer p.wg.Done()
+	defer p.cancel[id]()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case tx, ok := <-queue:
+			if !ok {
+				return
+			}
+			p.forward(ctx, id, tx)
+		}
+	}
+}
+
+// forward hands one transaction to the forwarder
+func (p *ForwardPool) forward(ctx context.Context, id int, tx *models.Transaction) {
+	p.active.Add(1)
+	defer func() {
+		p.active.Add(-1)
+		p.done()
+	}()
+
+	forwardCtx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	if err := p.forwarder.AddTransaction(forwardCtx, tx); err != nil {
+		p.errors.Add(1)
+		p.logger.Error("Failed to add transaction to Raphtory",
+			zap.Error(err),
+			zap.Int("worker", id),
+			zap.String("tx_hash", tx.TxHash))
+		return
+	}
+	p.processed.Add(1)
+}
+
+// depth returns the number of queued transactions
+func (p *ForwardPool) depth() int {
+	depth := 0
+	for _, queue := range p.queues {
+		depth += len(queue)
+	}
+	return depth
+}
+
+// Stats returns a snapshot of the pool counters
+func (p *ForwardPool) Stats() PoolStats {
+	return PoolStats{
+		QueueDepth: p.depth(),
+		Active:     p.active.Load(),
+		Processed:  p.processed.Load(),
+		Errors:     p.errors.Load(),
+	}
+}
@@ -1,13 +1,17 @@
 package graph
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/tls"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/mikedewar/stablerisk/internal/errs"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/internal/tracing"
 	"github.com/mikedewar/stablerisk/pkg/models"
 	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
@@ -15,17 +19,35 @@ import (
 
 // RaphtoryClient manages communication with Raphtory service
 type RaphtoryClient struct {
-	baseURL    string
+	transport  transport
 	httpClient *http.Client
+	retry      blockchain.RetryConfig
+	breaker    *circuitBreaker
 	logger     *zap.Logger
 }
 
 // RaphtoryConfig holds Raphtory client configuration
 type RaphtoryConfig struct {
-	BaseURL    string
+	BaseURL    string // Service root for REST; the GraphQL endpoint for GraphQL
 	Timeout    time.Duration
-	MaxRetries int
-	RetryDelay time.Duration
+	MaxRetries int           // Retries of network failures and 5xx responses; 0 disables retrying
+	RetryDelay time.Duration // Delay before the first retry, doubled on each further retry (default 1 second)
+
+	// FailureThreshold consecutive failed calls open the circuit, failing
+	// calls fast for OpenTimeout before a trial call is let through.
+	// Defaults are 5 and 30 seconds; a negative threshold disables the breaker.
+	FailureThreshold int
+	OpenTimeout      time.Duration
+
+	// Transport selects how operations reach Raphtory: TransportREST
+	// (default) or TransportGraphQL. GraphName is the graph GraphQL
+	// operations read and write (default "stablerisk").
+	Transport string
+	GraphName string
+
+	// TLS configures https connections, such as a client certificate for
+	// mTLS or a private CA; nil uses Go's defaults
+	TLS *tls.Config
 }
 
 // NewRaphtoryClient creates a new Raphtory client
@@ -33,59 +55,188 @@ func NewRaphtoryClient(config RaphtoryConfig, logger *zap.Logger) *RaphtoryClien
 	if logger == nil {
 		logger = zap.NewNop()
 	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = time.Second
+	}
+	if config.FailureThreshold == 0 {
+		config.FailureThreshold = 5
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 30 * time.Second
+	}
+
+	var base http.RoundTripper
+	if config.TLS != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = config.TLS
+		base = transport
+	}
 
-	return &RaphtoryClient{
-		baseURL: config.BaseURL,
+	client := &RaphtoryClient{
 		httpClient: &http.Client{
-			Timeout: config.Timeout,
+			Timeout:   config.Timeout,
+			Transport: tracing.Transport(base),
 		},
-		logger: logger,
+		retry: blockchain.RetryConfig{
+			InitialDelay: config.RetryDelay,
+			MaxDelay:     30 * time.Second,
+			MaxRetries:   config.MaxRetries,
+			Multiplier:   2.0,
+			Jitter:       true,
+		},
+		breaker: newCircuitBreaker(config.FailureThreshold, config.OpenTimeout, logger),
+		logger:  logger,
 	}
+
+	switch config.Transport {
+	case TransportGraphQL:
+		if config.GraphName == "" {
+			config.GraphName = "stablerisk"
+		}
+		client.transport = &graphqlTransport{
+			endpoint:  config.BaseURL,
+			graphName: config.GraphName,
+			send:      client.send,
+			retries:   config.MaxRetries,
+			logger:    logger,
+		}
+	default:
+		client.transport = &restTransport{
+			baseURL: config.BaseURL,
+			send:    client.send,
+			retries: config.MaxRetries,
+			logger:  logger,
+		}
+	}
+
+	return client
 }
 
-// AddTransaction sends a transaction to Raphtory to add to the graph
-func (c *RaphtoryClient) AddTransaction(ctx context.Context, tx *models.Transaction) error {
-	// Prepare request payload
-	payload := map[string]interface{}{
-		"tx_hash":      tx.TxHash,
-		"block_number": tx.BlockNumber,
-		"timestamp":    tx.Timestamp.Unix(),
-		"from":         tx.From,
-		"to":           tx.To,
-		"amount":       tx.Amount.String(),
-		"contract":     tx.Contract,
-	}
-
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal transaction: %w", err)
+// CircuitState returns the state of the client's circuit breaker
+func (c *RaphtoryClient) CircuitState() CircuitState {
+	return c.breaker.current()
+}
+
+// OnCircuitStateChange calls fn whenever the circuit breaker changes state.
+// fn runs with the breaker locked, so it must not block or call the client.
+func (c *RaphtoryClient) OnCircuitStateChange(fn func(from, to CircuitState)) {
+	c.breaker.mu.Lock()
+	defer c.breaker.mu.Unlock()
+	c.breaker.onChange = fn
+}
+
+// send sends a request through the circuit breaker, retrying network
+// failures and 5xx responses up to retries times with backoff, and returns
+// the first response below 500. Failures are classified as
+// ErrRaphtoryUnavailable and recorded once per call. Transports send every
+// request through it.
+func (c *RaphtoryClient) send(req *http.Request, operation string, retries int) (*http.Response, error) {
+	ctx := req.Context()
+	if err := c.breaker.allow(); err != nil {
+		return nil, errs.Record(errComponent, err)
 	}
 
-	// Send HTTP POST request
-	url := fmt.Sprintf("%s/graph/transaction", c.baseURL)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	var resp *http.Response
+	attempt := func() error {
+		r, err := c.attempt(req, operation)
+		if err != nil {
+			return err
+		}
+		if r.StatusCode >= 500 {
+			r.Body.Close()
+			return errs.Wrapf(ErrRaphtoryUnavailable, "raphtory returned status %d", r.StatusCode)
+		}
+		resp = r
+		return nil
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	var err error
+	if retries > 0 {
+		retry := c.retry
+		retry.MaxRetries = retries
+		err = blockchain.RetryWithBackoff(ctx, retry, c.logger.With(zap.String("operation", operation)), attempt)
+	} else {
+		err = attempt()
+	}
 
-	resp, err := c.httpClient.Do(req)
+	if err != nil && ctx.Err() != nil {
+		// The caller gave up; that says nothing about Raphtory
+		c.breaker.release()
+		return nil, err
+	}
+	c.breaker.record(err != nil)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return nil, errs.Record(errComponent, err)
+	}
+	return resp, nil
+}
+
+// attempt sends req once and records its latency under operation. The
+// request is traced as a child of the span in its context, and the trace
+// context is forwarded so the service can join the trace.
+func (c *RaphtoryClient) attempt(req *http.Request, operation string) (*http.Response, error) {
+	ctx, span := tracing.Start(req.Context(), "raphtory."+operation)
+	defer span.End()
+
+	// Each attempt needs its own copy of the body
+	req = req.WithContext(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to reset request body: %w", err)
+		}
+		req.Body = body
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("raphtory returned status %d", resp.StatusCode)
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+		if resp.StatusCode >= 400 {
+			span.SetStatus(tracing.StatusError, "HTTP "+status)
+		}
+	} else {
+		span.RecordError(err)
+		err = errs.Wrap(ErrRaphtoryUnavailable, err)
 	}
+	metrics.RaphtoryRequestDuration.WithLabelValues(operation, status).Observe(time.Since(start).Seconds())
 
-	c.logger.Debug("Transaction added to Raphtory",
-		zap.String("tx_hash", tx.TxHash),
-		zap.String("from", tx.From),
-		zap.String("to", tx.To))
+	return resp, err
+}
+
+// AddTransaction sends a transaction to Raphtory to add to the graph
+func (c *RaphtoryClient) AddTransaction(ctx context.Context, tx *models.Transaction) error {
+	return c.transport.AddTransaction(ctx, tx)
+}
 
-	return nil
+// BatchError reports transactions Raphtory rejected from an otherwise
+// accepted batch
+type BatchError struct {
+	Failed []string // Hashes of the transactions that were not added
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("raphtory failed to add %d transactions from batch", len(e.Failed))
+}
+
+// AddTransactions sends several transactions to Raphtory in a single request.
+// If only some are rejected the error is a *BatchError naming them.
+func (c *RaphtoryClient) AddTransactions(ctx context.Context, txs []*models.Transaction) error {
+	return c.transport.AddTransactions(ctx, txs)
+}
+
+// DeleteTransaction retracts a transaction from the graph, e.g. after it was
+// reverted by a chain reorganisation. Retracting an unknown hash is not an error.
+func (c *RaphtoryClient) DeleteTransaction(ctx context.Context, txHash string) error {
+	return c.transport.DeleteTransaction(ctx, txHash)
+}
+
+// ConfirmTransaction marks a transaction that was added unconfirmed as
+// confirmed. Confirming an unknown hash is not an error.
+func (c *RaphtoryClient) ConfirmTransaction(ctx context.Context, txHash string) error {
+	return c.transport.ConfirmTransaction(ctx, txHash)
 }
 
 // NodeInfo represents node information from Raphtory
@@ -98,6 +249,42 @@ type NodeInfo struct {
 	ReceivedCount    int     `json:"received_count"`
 	TotalSent        float64 `json:"total_sent"`
 	TotalReceived    float64 `json:"total_received"`
+
+	Properties map[string]interface{} `json:"properties,omitempty"` // Tags set with SetNodeProperties
+}
+
+// Node properties StableRisk tags addresses with
+const (
+	PropertyRiskScore    = "risk_score"    // RiskScore of the address's latest outlier severity
+	PropertyRiskSeverity = "risk_severity" // Severity of the address's latest outlier
+	PropertyRiskAt       = "risk_at"       // Unix time the risk tags were last set
+	PropertyWatchlist    = "watchlist"     // Name of a watchlist the address is on
+	PropertyLabel        = "label"         // Exchange or entity label
+)
+
+// TaggedNode is an address with its tags
+type TaggedNode struct {
+	Address    string                 `json:"address"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// SetNodeProperties tags an address so later graph queries can filter on it.
+// Properties are merged into the address's existing tags and a nil value
+// removes one. Values must be strings, numbers or booleans. Addresses not yet
+// in the graph keep their tags until they first transact.
+func (c *RaphtoryClient) SetNodeProperties(ctx context.Context, address string, properties map[string]any) error {
+	return c.transport.SetNodeProperties(ctx, address, properties)
+}
+
+// FindNodesByProperty returns up to limit addresses tagged with key, sorted
+// by address. A non-nil value only matches tags equal to it when both are
+// written as text, with booleans as true/false.
+func (c *RaphtoryClient) FindNodesByProperty(ctx context.Context, key string, value any, limit int) ([]TaggedNode, error) {
+	if limit < 1 {
+		return nil, fmt.Errorf("limit must be at least 1, got %d", limit)
+	}
+
+	return c.transport.FindNodesByProperty(ctx, key, value, limit)
 }
 
 // TransactionInfo represents a transaction from Raphtory
@@ -108,76 +295,301 @@ type TransactionInfo struct {
 	Amount      string `json:"amount"`
 	BlockNumber int    `json:"block_number"`
 	Timestamp   int64  `json:"timestamp"`
+	Contract    string `json:"contract,omitempty"`
+	Token       string `json:"token,omitempty"`
+	Chain       string `json:"chain,omitempty"`
+	Confirmed   *bool  `json:"confirmed,omitempty"` // Absent from older services, meaning confirmed
 }
 
 // GetNodeInfo gets information about a node from Raphtory
 func (c *RaphtoryClient) GetNodeInfo(ctx context.Context, address string) (*NodeInfo, error) {
-	url := fmt.Sprintf("%s/graph/node/%s", c.baseURL, address)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
+	return c.transport.GetNodeInfo(ctx, address)
+}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+// GetTransactionsInWindow gets transactions in a time window
+func (c *RaphtoryClient) GetTransactionsInWindow(ctx context.Context, startTime, endTime int64, limit int) ([]models.Transaction, error) {
+	return c.transport.GetTransactionsInWindow(ctx, startTime, endTime, limit)
+}
+
+// maxTransactionPage is the most transactions QueryTransactions returns at
+// once, matching the Raphtory service's own cap
+const maxTransactionPage = 1000
+
+// TransactionQuery selects a page of transactions from the graph
+type TransactionQuery struct {
+	Window    Window
+	Address   string           // Sender or receiver; empty matches every address
+	MinAmount *decimal.Decimal // Inclusive; nil is unbounded
+	MaxAmount *decimal.Decimal // Inclusive; nil is unbounded
+	Limit     int              // 1 to 1000
+	Offset    int
+}
+
+// matches reports whether tx satisfies the query's address and amount
+// filters. The window is applied by whoever reads the transactions.
+func (q *TransactionQuery) matches(tx *models.Transaction) bool {
+	if q.Address != "" && tx.From != q.Address && tx.To != q.Address {
+		return false
+	}
+	if q.MinAmount != nil && tx.Amount.LessThan(*q.MinAmount) {
+		return false
+	}
+	if q.MaxAmount != nil && tx.Amount.GreaterThan(*q.MaxAmount) {
+		return false
 	}
-	defer resp.Body.Close()
+	return true
+}
+
+// TransactionPage is one page of a transaction query, newest first, with
+// the total number of matching transactions
+type TransactionPage struct {
+	Transactions []models.Transaction `json:"transactions"`
+	Total        int                  `json:"total"`
+}
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, nil
+// QueryTransactions returns the transactions matching query, newest first
+// with ties broken by hash, skipping Offset and returning at most Limit
+func (c *RaphtoryClient) QueryTransactions(ctx context.Context, query TransactionQuery) (*TransactionPage, error) {
+	if query.Limit < 1 || query.Limit > maxTransactionPage {
+		return nil, fmt.Errorf("limit must be between 1 and %d, got %d", maxTransactionPage, query.Limit)
+	}
+	if query.Offset < 0 {
+		return nil, fmt.Errorf("offset must not be negative, got %d", query.Offset)
+	}
+	if query.MinAmount != nil && query.MaxAmount != nil && query.MinAmount.GreaterThan(*query.MaxAmount) {
+		return nil, fmt.Errorf("min amount %s exceeds max amount %s", query.MinAmount, query.MaxAmount)
+	}
+	if !query.Window.Start.IsZero() && !query.Window.End.IsZero() && !query.Window.Start.Before(query.Window.End) {
+		return nil, fmt.Errorf("window start must be before its end")
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("raphtory returned status %d", resp.StatusCode)
+	return c.transport.QueryTransactions(ctx, query)
+}
+
+// GetTransaction looks up a transaction by hash. A hash Raphtory has not
+// seen, or that was retracted, returns nil.
+func (c *RaphtoryClient) GetTransaction(ctx context.Context, txHash string) (*models.Transaction, error) {
+	if txHash == "" {
+		return nil, fmt.Errorf("transaction hash is required")
 	}
 
-	var nodeInfo NodeInfo
-	if err := json.NewDecoder(resp.Body).Decode(&nodeInfo); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	return c.transport.GetTransaction(ctx, txHash)
+}
+
+// Window bounds a graph query in time: Start inclusive, End exclusive. A
+// zero bound is open, so the zero Window covers the whole graph.
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Neighbor is an address reached from a queried address, with totals of the
+// transactions linking it to addresses one hop closer. Sent is value flowing
+// away from the queried address and Received value flowing towards it.
+type Neighbor struct {
+	Address       string          `json:"address"`
+	Hop           int             `json:"hop"`
+	SentCount     int             `json:"sent_count"`
+	ReceivedCount int             `json:"received_count"`
+	Sent          decimal.Decimal `json:"sent"`
+	Received      decimal.Decimal `json:"received"`
+	FirstSeen     int64           `json:"first_seen"`
+	LastSeen      int64           `json:"last_seen"`
+}
+
+// Neighborhood holds the addresses within a number of hops of an address
+type Neighborhood struct {
+	Address   string     `json:"address"`
+	Hops      int        `json:"hops"`
+	Neighbors []Neighbor `json:"counterparties"`
+	Truncated bool       `json:"truncated"` // Raphtory stopped at its counterparty limit
+}
+
+// GetNeighbors returns the counterparties within hops of address, counting
+// transactions in both directions inside window. An address Raphtory has
+// not seen has no neighbors.
+func (c *RaphtoryClient) GetNeighbors(ctx context.Context, address string, hops int, window Window) (*Neighborhood, error) {
+	if hops < 1 {
+		return nil, fmt.Errorf("hops must be at least 1, got %d", hops)
 	}
 
-	return &nodeInfo, nil
+	return c.transport.GetNeighbors(ctx, address, hops, window)
 }
 
-// GetTransactionsInWindow gets transactions in a time window
-func (c *RaphtoryClient) GetTransactionsInWindow(ctx context.Context, startTime, endTime int64, limit int) ([]models.Transaction, error) {
-	url := fmt.Sprintf("%s/graph/window?start=%d&end=%d&limit=%d", c.baseURL, startTime, endTime, limit)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// SubgraphNode is an address in a subgraph with totals over the subgraph's
+// edges
+type SubgraphNode struct {
+	Address          string          `json:"address"`
+	Hop              int             `json:"hop"` // 0 for the centre address
+	TransactionCount int             `json:"transaction_count"`
+	Sent             decimal.Decimal `json:"sent"`
+	Received         decimal.Decimal `json:"received"`
+	FirstSeen        int64           `json:"first_seen"`
+	LastSeen         int64           `json:"last_seen"`
+}
+
+// SubgraphEdge aggregates the transfers from one address to another
+type SubgraphEdge struct {
+	From             string          `json:"from"`
+	To               string          `json:"to"`
+	TransactionCount int             `json:"transaction_count"`
+	Amount           decimal.Decimal `json:"amount"`
+	FirstSeen        int64           `json:"first_seen"`
+	LastSeen         int64           `json:"last_seen"`
+}
+
+// Subgraph holds the addresses within some hops of an address and every
+// transfer between them
+type Subgraph struct {
+	Address   string         `json:"address"`
+	Hops      int            `json:"hops"`
+	Nodes     []SubgraphNode `json:"nodes"`
+	Edges     []SubgraphEdge `json:"edges"`
+	Truncated bool           `json:"truncated"` // Raphtory stopped at its address limit
+}
+
+// GetSubgraph returns the addresses within hops of address in either
+// direction, counting only transactions inside window, with the transfers
+// between them. An address Raphtory has not seen gives an empty subgraph.
+func (c *RaphtoryClient) GetSubgraph(ctx context.Context, address string, hops int, window Window) (*Subgraph, error) {
+	if hops < 1 {
+		return nil, fmt.Errorf("hops must be at least 1, got %d", hops)
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+	return c.transport.GetSubgraph(ctx, address, hops, window)
+}
+
+// PathHop is one leg of a path: the transactions from one address to the next
+type PathHop struct {
+	From         string
+	To           string
+	Transactions []models.Transaction
+}
+
+// Path is a route value could have taken between two addresses
+type Path struct {
+	Addresses []string
+	Hops      []PathHop
+}
+
+// PathSet holds the paths found between two addresses, shortest first
+type PathSet struct {
+	From      string
+	To        string
+	Paths     []Path
+	Truncated bool // Raphtory stopped at its path limit or search budget
+}
+
+// FindPaths returns the paths of at most maxHops transfers from one address
+// to another inside window. Each hop only includes transactions made no
+// earlier than the first one that reached its sender, so every path is one
+// funds could actually have flowed along.
+func (c *RaphtoryClient) FindPaths(ctx context.Context, from, to string, maxHops int, window Window) (*PathSet, error) {
+	if maxHops < 1 {
+		return nil, fmt.Errorf("maxHops must be at least 1, got %d", maxHops)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("raphtory returned status %d", resp.StatusCode)
+	return c.transport.FindPaths(ctx, from, to, maxHops, window)
+}
+
+// DegreeDirection selects which side of an address's transfers a degree
+// ranking counts
+type DegreeDirection string
+
+const (
+	DegreeIn    DegreeDirection = "in"    // Distinct senders; high for fan-in addresses
+	DegreeOut   DegreeDirection = "out"   // Distinct receivers; high for fan-out addresses
+	DegreeTotal DegreeDirection = "total" // Both
+)
+
+// NodeDegree is an address's distinct counterparties and transfer totals
+// within a window
+type NodeDegree struct {
+	Address   string          `json:"address"`
+	InDegree  int             `json:"in_degree"`
+	OutDegree int             `json:"out_degree"`
+	InCount   int             `json:"in_count"`
+	OutCount  int             `json:"out_count"`
+	Received  decimal.Decimal `json:"received"`
+	Sent      decimal.Decimal `json:"sent"`
+}
+
+// GetTopDegree returns the limit addresses with the most distinct
+// counterparties in direction within window, highest first
+func (c *RaphtoryClient) GetTopDegree(ctx context.Context, direction DegreeDirection, window Window, limit int) ([]NodeDegree, error) {
+	if limit < 1 {
+		return nil, fmt.Errorf("limit must be at least 1, got %d", limit)
 	}
 
-	var txInfos []TransactionInfo
-	if err := json.NewDecoder(resp.Body).Decode(&txInfos); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	return c.transport.GetTopDegree(ctx, direction, window, limit)
+}
+
+// AddressActivity is an address's transfers within a window, aggregated by
+// Raphtory so callers need not read the window's transactions
+type AddressActivity struct {
+	NodeDegree
+	UnconfirmedCount int    `json:"unconfirmed_count"`
+	FirstSeen        int64  `json:"first_seen"`
+	LastSeen         int64  `json:"last_seen"`
+	FirstTxHash      string `json:"first_tx_hash"` // Earliest transaction in the window
+}
+
+// TransactionCount is the number of transfers the address sent or received
+func (a AddressActivity) TransactionCount() int {
+	return a.InCount + a.OutCount
+}
+
+// GetAddressActivity returns every address with at least minCount
+// transactions within window, ordered by address. A minCount below 1
+// returns every active address.
+func (c *RaphtoryClient) GetAddressActivity(ctx context.Context, window Window, minCount int) ([]AddressActivity, error) {
+	if minCount < 1 {
+		minCount = 1
 	}
 
-	// Convert to models.Transaction
-	transactions := make([]models.Transaction, len(txInfos))
-	for i, txInfo := range txInfos {
-		amount, _ := decimal.NewFromString(txInfo.Amount)
-		transactions[i] = models.Transaction{
-			TxHash:      txInfo.TxHash,
-			From:        txInfo.From,
-			To:          txInfo.To,
-			Amount:      amount,
-			BlockNumber: uint64(txInfo.BlockNumber),
-			Timestamp:   time.Unix(txInfo.Timestamp, 0),
-		}
+	return c.transport.GetAddressActivity(ctx, window, minCount)
+}
+
+// NodeScore is an address's centrality score
+type NodeScore struct {
+	Address string  `json:"address"`
+	Score   float64 `json:"score"`
+}
+
+// GetPageRank returns the limit addresses with the highest PageRank over the
+// transfers in window, weighted by transaction count. Scores sum to 1 across
+// every address active in the window, so they compare within one window only.
+func (c *RaphtoryClient) GetPageRank(ctx context.Context, window Window, limit int) ([]NodeScore, error) {
+	if limit < 1 {
+		return nil, fmt.Errorf("limit must be at least 1, got %d", limit)
 	}
 
-	return transactions, nil
+	return c.transport.GetPageRank(ctx, window, limit)
+}
+
+// Community is a group of addresses that transact mostly with each other in
+// a window, with the flows inside it and across its boundary
+type Community struct {
+	ID             int             `json:"id"`
+	Members        []string        `json:"members"`
+	Size           int             `json:"size"`
+	InternalEdges  int             `json:"internal_edges"` // Distinct sender/receiver pairs between members
+	InternalCount  int             `json:"internal_count"` // Transactions between members
+	InternalAmount decimal.Decimal `json:"internal_amount"`
+	Density        float64         `json:"density"`      // Share of possible member pairs that transacted
+	EntryPoints    []string        `json:"entry_points"` // Members receiving from outside
+	ExitPoints     []string        `json:"exit_points"`  // Members sending outside
+	Inflow         decimal.Decimal `json:"inflow"`
+	Outflow        decimal.Decimal `json:"outflow"`
+	HasCycle       bool            `json:"has_cycle"` // Transfers between members form a loop
+	FirstSeen      int64           `json:"first_seen"`
+	LastSeen       int64           `json:"last_seen"`
+}
+
+// GetCommunities returns the communities of at least three addresses found
+// in window, largest first
+func (c *RaphtoryClient) GetCommunities(ctx context.Context, window Window) ([]Community, error) {
+	return c.transport.GetCommunities(ctx, window)
 }
 
 // GraphStatistics represents graph statistics from Raphtory
@@ -192,47 +604,10 @@ type GraphStatistics struct {
 
 // GetStatistics retrieves graph statistics from Raphtory
 func (c *RaphtoryClient) GetStatistics(ctx context.Context) (*GraphStatistics, error) {
-	url := fmt.Sprintf("%s/graph/statistics", c.baseURL)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("raphtory returned status %d", resp.StatusCode)
-	}
-
-	var stats GraphStatistics
-	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	return &stats, nil
+	return c.transport.GetStatistics(ctx)
 }
 
 // Health checks if Raphtory service is healthy
 func (c *RaphtoryClient) Health(ctx context.Context) error {
-	url := fmt.Sprintf("%s/health", c.baseURL)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("raphtory health check failed with status %d", resp.StatusCode)
-	}
-
-	return nil
+	return c.transport.Health(ctx)
 }
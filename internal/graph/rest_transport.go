@@ -0,0 +1,701 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/errs"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// restTransport speaks to the StableRisk Raphtory service's REST routes
+type restTransport struct {
+	baseURL string
+	send    sendFunc
+	retries int
+	logger  *zap.Logger
+}
+
+// do sends req with the client's configured retries
+func (t *restTransport) do(req *http.Request, operation string) (*http.Response, error) {
+	return t.send(req, operation, t.retries)
+}
+
+// AddTransaction posts a transaction to /graph/transaction
+func (t *restTransport) AddTransaction(ctx context.Context, tx *models.Transaction) error {
+	body, err := json.Marshal(transactionPayload(tx))
+	if err != nil {
+		return fmt.Errorf("failed to marshal transaction: %w", err)
+	}
+
+	// Send HTTP POST request
+	url := fmt.Sprintf("%s/graph/transaction", t.baseURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.do(req, "add_transaction")
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return statusError(resp.StatusCode)
+	}
+
+	t.logger.Debug("Transaction added to Raphtory",
+		zap.String("tx_hash", tx.TxHash),
+		zap.String("from", tx.From),
+		zap.String("to", tx.To))
+
+	return nil
+}
+
+// AddTransactions posts a batch to /graph/transactions/batch
+func (t *restTransport) AddTransactions(ctx context.Context, txs []*models.Transaction) error {
+	if len(txs) == 0 {
+		return nil
+	}
+
+	payloads := make([]map[string]interface{}, len(txs))
+	for i, tx := range txs {
+		payloads[i] = transactionPayload(tx)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"transactions": payloads})
+	if err != nil {
+		return fmt.Errorf("failed to marshal transactions: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/graph/transactions/batch", t.baseURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.do(req, "add_transactions")
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return statusError(resp.StatusCode)
+	}
+
+	var result struct {
+		Added  int      `json:"added"`
+		Failed []string `json:"failed"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return decodeError(err)
+	}
+
+	t.logger.Debug("Transaction batch added to Raphtory",
+		zap.Int("size", len(txs)),
+		zap.Int("added", result.Added))
+
+	if len(result.Failed) > 0 {
+		return &BatchError{Failed: result.Failed}
+	}
+
+	return nil
+}
+
+// DeleteTransaction deletes /graph/transaction/{hash}
+func (t *restTransport) DeleteTransaction(ctx context.Context, txHash string) error {
+	url := fmt.Sprintf("%s/graph/transaction/%s", t.baseURL, txHash)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := t.do(req, "delete_transaction")
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return statusError(resp.StatusCode)
+	}
+
+	t.logger.Debug("Transaction retracted from Raphtory",
+		zap.String("tx_hash", txHash))
+
+	return nil
+}
+
+// ConfirmTransaction posts to /graph/transaction/{hash}/confirm
+func (t *restTransport) ConfirmTransaction(ctx context.Context, txHash string) error {
+	url := fmt.Sprintf("%s/graph/transaction/%s/confirm", t.baseURL, txHash)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := t.do(req, "confirm_transaction")
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return statusError(resp.StatusCode)
+	}
+
+	t.logger.Debug("Transaction confirmed in Raphtory",
+		zap.String("tx_hash", txHash))
+
+	return nil
+}
+
+// SetNodeProperties puts the tags to /graph/node/{address}/properties
+func (t *restTransport) SetNodeProperties(ctx context.Context, address string, properties map[string]any) error {
+	body, err := json.Marshal(map[string]interface{}{"properties": properties})
+	if err != nil {
+		return fmt.Errorf("failed to marshal properties: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/graph/node/%s/properties", t.baseURL, url.PathEscape(address))
+	req, err := http.NewRequestWithContext(ctx, "PUT", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.do(req, "set_node_properties")
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp.StatusCode)
+	}
+
+	t.logger.Debug("Node properties set in Raphtory",
+		zap.String("address", address),
+		zap.Int("properties", len(properties)))
+
+	return nil
+}
+
+// FindNodesByProperty queries /graph/nodes
+func (t *restTransport) FindNodesByProperty(ctx context.Context, key string, value any, limit int) ([]TaggedNode, error) {
+	query := url.Values{}
+	query.Set("property", key)
+	if value != nil {
+		query.Set("value", fmt.Sprint(value))
+	}
+	query.Set("limit", strconv.Itoa(limit))
+
+	endpoint := fmt.Sprintf("%s/graph/nodes?%s", t.baseURL, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := t.do(req, "find_nodes")
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	var result struct {
+		Nodes []TaggedNode `json:"nodes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, decodeError(err)
+	}
+
+	return result.Nodes, nil
+}
+
+// GetNodeInfo reads /graph/node/{address}; 404 means an unknown address
+func (t *restTransport) GetNodeInfo(ctx context.Context, address string) (*NodeInfo, error) {
+	url := fmt.Sprintf("%s/graph/node/%s", t.baseURL, address)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := t.do(req, "get_node_info")
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	var nodeInfo NodeInfo
+	if err := json.NewDecoder(resp.Body).Decode(&nodeInfo); err != nil {
+		return nil, decodeError(err)
+	}
+
+	return &nodeInfo, nil
+}
+
+// GetTransactionsInWindow reads /graph/window
+func (t *restTransport) GetTransactionsInWindow(ctx context.Context, startTime, endTime int64, limit int) ([]models.Transaction, error) {
+	url := fmt.Sprintf("%s/graph/window?start=%d&end=%d&limit=%d", t.baseURL, startTime, endTime, limit)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := t.do(req, "get_transactions_in_window")
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	var txInfos []TransactionInfo
+	if err := json.NewDecoder(resp.Body).Decode(&txInfos); err != nil {
+		return nil, decodeError(err)
+	}
+
+	return toTransactions(txInfos), nil
+}
+
+// QueryTransactions reads /graph/transactions
+func (t *restTransport) QueryTransactions(ctx context.Context, query TransactionQuery) (*TransactionPage, error) {
+	params := url.Values{}
+	params.Set("limit", strconv.Itoa(query.Limit))
+	params.Set("offset", strconv.Itoa(query.Offset))
+	if query.Address != "" {
+		params.Set("address", query.Address)
+	}
+	if query.MinAmount != nil {
+		params.Set("min_amount", query.MinAmount.String())
+	}
+	if query.MaxAmount != nil {
+		params.Set("max_amount", query.MaxAmount.String())
+	}
+	query.Window.addTo(params)
+
+	endpoint := fmt.Sprintf("%s/graph/transactions?%s", t.baseURL, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := t.do(req, "query_transactions")
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	var result struct {
+		Transactions []TransactionInfo `json:"transactions"`
+		Total        int               `json:"total"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, decodeError(err)
+	}
+
+	return &TransactionPage{
+		Transactions: toTransactions(result.Transactions),
+		Total:        result.Total,
+	}, nil
+}
+
+// GetTransaction reads /graph/transaction/{tx_hash}; 404 means an unknown
+// or retracted hash
+func (t *restTransport) GetTransaction(ctx context.Context, txHash string) (*models.Transaction, error) {
+	endpoint := fmt.Sprintf("%s/graph/transaction/%s", t.baseURL, url.PathEscape(txHash))
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := t.do(req, "get_transaction")
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	var txInfo TransactionInfo
+	if err := json.NewDecoder(resp.Body).Decode(&txInfo); err != nil {
+		return nil, decodeError(err)
+	}
+
+	return &toTransactions([]TransactionInfo{txInfo})[0], nil
+}
+
+// GetNeighbors reads /graph/neighbors/{address} in both directions
+func (t *restTransport) GetNeighbors(ctx context.Context, address string, hops int, window Window) (*Neighborhood, error) {
+	query := url.Values{}
+	query.Set("direction", "both")
+	query.Set("hops", strconv.Itoa(hops))
+	window.addTo(query)
+
+	endpoint := fmt.Sprintf("%s/graph/neighbors/%s?%s", t.baseURL, url.PathEscape(address), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := t.do(req, "get_neighbors")
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	var neighborhood Neighborhood
+	if err := json.NewDecoder(resp.Body).Decode(&neighborhood); err != nil {
+		return nil, decodeError(err)
+	}
+
+	return &neighborhood, nil
+}
+
+// GetSubgraph reads /graph/subgraph/{address}
+func (t *restTransport) GetSubgraph(ctx context.Context, address string, hops int, window Window) (*Subgraph, error) {
+	query := url.Values{}
+	query.Set("hops", strconv.Itoa(hops))
+	window.addTo(query)
+
+	endpoint := fmt.Sprintf("%s/graph/subgraph/%s?%s", t.baseURL, url.PathEscape(address), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := t.do(req, "get_subgraph")
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	var subgraph Subgraph
+	if err := json.NewDecoder(resp.Body).Decode(&subgraph); err != nil {
+		return nil, decodeError(err)
+	}
+
+	return &subgraph, nil
+}
+
+// FindPaths reads /graph/paths and converts its flows
+func (t *restTransport) FindPaths(ctx context.Context, from, to string, maxHops int, window Window) (*PathSet, error) {
+	query := url.Values{}
+	query.Set("from", from)
+	query.Set("to", to)
+	query.Set("max_hops", strconv.Itoa(maxHops))
+	window.addTo(query)
+
+	endpoint := fmt.Sprintf("%s/graph/paths?%s", t.baseURL, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := t.do(req, "find_paths")
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	var result struct {
+		Flows []struct {
+			Addresses []string `json:"addresses"`
+			Hops      []struct {
+				From         string            `json:"from"`
+				To           string            `json:"to"`
+				Transactions []TransactionInfo `json:"transactions"`
+			} `json:"hops"`
+		} `json:"flows"`
+		Truncated bool `json:"truncated"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, decodeError(err)
+	}
+
+	paths := &PathSet{From: from, To: to, Paths: make([]Path, len(result.Flows)), Truncated: result.Truncated}
+	for i, flow := range result.Flows {
+		path := Path{Addresses: flow.Addresses, Hops: make([]PathHop, len(flow.Hops))}
+		for j, hop := range flow.Hops {
+			path.Hops[j] = PathHop{From: hop.From, To: hop.To, Transactions: toTransactions(hop.Transactions)}
+		}
+		paths.Paths[i] = path
+	}
+
+	return paths, nil
+}
+
+// GetTopDegree reads /graph/degree
+func (t *restTransport) GetTopDegree(ctx context.Context, direction DegreeDirection, window Window, limit int) ([]NodeDegree, error) {
+	query := url.Values{}
+	query.Set("direction", string(direction))
+	query.Set("limit", strconv.Itoa(limit))
+	window.addTo(query)
+
+	endpoint := fmt.Sprintf("%s/graph/degree?%s", t.baseURL, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := t.do(req, "get_top_degree")
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	var result struct {
+		Nodes []NodeDegree `json:"nodes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, decodeError(err)
+	}
+
+	return result.Nodes, nil
+}
+
+// GetAddressActivity reads /graph/activity
+func (t *restTransport) GetAddressActivity(ctx context.Context, window Window, minCount int) ([]AddressActivity, error) {
+	query := url.Values{}
+	query.Set("min_count", strconv.Itoa(minCount))
+	window.addTo(query)
+
+	endpoint := fmt.Sprintf("%s/graph/activity?%s", t.baseURL, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := t.do(req, "get_address_activity")
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	var result struct {
+		Addresses []AddressActivity `json:"addresses"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, decodeError(err)
+	}
+
+	return result.Addresses, nil
+}
+
+// GetPageRank reads /graph/centrality with the pagerank algorithm
+func (t *restTransport) GetPageRank(ctx context.Context, window Window, limit int) ([]NodeScore, error) {
+	query := url.Values{}
+	query.Set("algorithm", "pagerank")
+	query.Set("limit", strconv.Itoa(limit))
+	window.addTo(query)
+
+	endpoint := fmt.Sprintf("%s/graph/centrality?%s", t.baseURL, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := t.do(req, "get_pagerank")
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	var result struct {
+		Nodes []NodeScore `json:"nodes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, decodeError(err)
+	}
+
+	return result.Nodes, nil
+}
+
+// GetCommunities reads /graph/communities
+func (t *restTransport) GetCommunities(ctx context.Context, window Window) ([]Community, error) {
+	query := url.Values{}
+	window.addTo(query)
+
+	endpoint := fmt.Sprintf("%s/graph/communities?%s", t.baseURL, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := t.do(req, "get_communities")
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	var result struct {
+		Communities []Community `json:"communities"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, decodeError(err)
+	}
+
+	return result.Communities, nil
+}
+
+// GetStatistics reads /graph/statistics
+func (t *restTransport) GetStatistics(ctx context.Context) (*GraphStatistics, error) {
+	url := fmt.Sprintf("%s/graph/statistics", t.baseURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := t.do(req, "get_statistics")
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	var stats GraphStatistics
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, decodeError(err)
+	}
+
+	return &stats, nil
+}
+
+// Health reads /health without retrying
+func (t *restTransport) Health(ctx context.Context) error {
+	url := fmt.Sprintf("%s/health", t.baseURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Health checks have their own deadlines, so they are not retried
+	resp, err := t.send(req, "health", 0)
+	if err != nil {
+		return fmt.Errorf("raphtory health check failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errs.Record(errComponent, errs.Wrapf(ErrRaphtoryUnavailable, "raphtory health check failed with status %d", resp.StatusCode))
+	}
+
+	return nil
+}
+
+// transactionPayload converts a transaction to the Raphtory request format
+func transactionPayload(tx *models.Transaction) map[string]interface{} {
+	return map[string]interface{}{
+		"tx_hash":      tx.TxHash,
+		"block_number": tx.BlockNumber,
+		"timestamp":    tx.Timestamp.Unix(),
+		"from":         tx.From,
+		"to":           tx.To,
+		"amount":       tx.Amount.String(),
+		"contract":     tx.Contract,
+		"token":        tx.Token,
+		"chain":        tx.Chain,
+		"confirmed":    tx.Confirmed,
+	}
+}
+
+// toTransactions converts transactions from the Raphtory wire format
+func toTransactions(txInfos []TransactionInfo) []models.Transaction {
+	transactions := make([]models.Transaction, len(txInfos))
+	for i, txInfo := range txInfos {
+		amount, _ := decimal.NewFromString(txInfo.Amount)
+		transactions[i] = models.Transaction{
+			TxHash:      txInfo.TxHash,
+			From:        txInfo.From,
+			To:          txInfo.To,
+			Amount:      amount,
+			BlockNumber: uint64(txInfo.BlockNumber),
+			Timestamp:   time.Unix(txInfo.Timestamp, 0),
+			Contract:    txInfo.Contract,
+			Token:       txInfo.Token,
+			Chain:       models.Chain(txInfo.Chain),
+			Confirmed:   txInfo.Confirmed == nil || *txInfo.Confirmed,
+		}
+	}
+	return transactions
+}
+
+// addTo sets the start and end query parameters for the window's bounds
+func (w Window) addTo(query url.Values) {
+	if !w.Start.IsZero() {
+		query.Set("start", strconv.FormatInt(w.Start.Unix(), 10))
+	}
+	if !w.End.IsZero() {
+		query.Set("end", strconv.FormatInt(w.End.Unix(), 10))
+	}
+}
@@ -0,0 +1,43 @@
+package graph
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+)
+
+// Transports RaphtoryConfig.Transport selects
+const (
+	TransportREST    = "rest"    // The StableRisk Raphtory service's REST routes (default)
+	TransportGraphQL = "graphql" // Raphtory's own GraphQL server
+)
+
+// transport carries the client's operations to the graph service. Inputs
+// are validated by RaphtoryClient before they reach a transport, and every
+// request goes out through the client's circuit breaker and retries.
+type transport interface {
+	AddTransaction(ctx context.Context, tx *models.Transaction) error
+	AddTransactions(ctx context.Context, txs []*models.Transaction) error
+	DeleteTransaction(ctx context.Context, txHash string) error
+	ConfirmTransaction(ctx context.Context, txHash string) error
+	SetNodeProperties(ctx context.Context, address string, properties map[string]any) error
+	FindNodesByProperty(ctx context.Context, key string, value any, limit int) ([]TaggedNode, error)
+	GetNodeInfo(ctx context.Context, address string) (*NodeInfo, error)
+	GetTransactionsInWindow(ctx context.Context, startTime, endTime int64, limit int) ([]models.Transaction, error)
+	QueryTransactions(ctx context.Context, query TransactionQuery) (*TransactionPage, error)
+	GetTransaction(ctx context.Context, txHash string) (*models.Transaction, error)
+	GetNeighbors(ctx context.Context, address string, hops int, window Window) (*Neighborhood, error)
+	GetSubgraph(ctx context.Context, address string, hops int, window Window) (*Subgraph, error)
+	FindPaths(ctx context.Context, from, to string, maxHops int, window Window) (*PathSet, error)
+	GetTopDegree(ctx context.Context, direction DegreeDirection, window Window, limit int) ([]NodeDegree, error)
+	GetAddressActivity(ctx context.Context, window Window, minCount int) ([]AddressActivity, error)
+	GetPageRank(ctx context.Context, window Window, limit int) ([]NodeScore, error)
+	GetCommunities(ctx context.Context, window Window) ([]Community, error)
+	GetStatistics(ctx context.Context) (*GraphStatistics, error)
+	Health(ctx context.Context) error
+}
+
+// sendFunc sends a request through the circuit breaker, retrying up to
+// retries times, and returns the first response below 500
+type sendFunc func(req *http.Request, operation string, retries int) (*http.Response, error)
@@ -0,0 +1,174 @@
+// Package health reports the status of a service's dependencies over
+// HTTP for Kubernetes probes and operators. Services register one check per
+// component; critical components make the service unhealthy and not ready,
+// the others only degrade it.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/api"
+	"go.uber.org/zap"
+)
+
+// CheckFunc reports the status of one component. It must respect ctx's deadline.
+type CheckFunc func(ctx context.Context) api.ServiceStatus
+
+type check struct {
+	name     string
+	critical bool
+	fn       CheckFunc
+}
+
+// Checker runs the registered checks and serves the results
+type Checker struct {
+	version string
+	timeout time.Duration
+	logger  *zap.Logger
+
+	mu     sync.RWMutex
+	checks []check
+}
+
+// NewChecker creates a checker reporting version in its responses
+func NewChecker(version string, logger *zap.Logger) *Checker {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if version == "" {
+		version = "dev"
+	}
+
+	return &Checker{
+		version: version,
+		timeout: 5 * time.Second,
+		logger:  logger,
+	}
+}
+
+// Register adds a component check. Registering a name again replaces its check.
+func (c *Checker) Register(name string, critical bool, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range c.checks {
+		if c.checks[i].name == name {
+			c.checks[i] = check{name: name, critical: critical, fn: fn}
+			return
+		}
+	}
+	c.checks = append(c.checks, check{name: name, critical: critical, fn: fn})
+	sort.Slice(c.checks, func(i, j int) bool { return c.checks[i].name < c.checks[j].name })
+}
+
+// Check runs every check concurrently. The overall status is unhealthy if a
+// critical component is unhealthy, degraded if any other component is, and
+// healthy otherwise.
+func (c *Checker) Check(ctx context.Context) api.HealthResponse {
+	c.mu.RLock()
+	checks := append([]check(nil), c.checks...)
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]api.ServiceStatus, len(checks))
+	var wg sync.WaitGroup
+	for i, chk := range checks {
+		wg.Add(1)
+		go func(i int, chk check) {
+			defer wg.Done()
+			results[i] = chk.fn(ctx)
+		}(i, chk)
+	}
+	wg.Wait()
+
+	response := api.HealthResponse{
+		Status:    "healthy",
+		Timestamp: time.Now(),
+		Version:   c.version,
+		Services:  make(map[string]api.ServiceStatus, len(checks)),
+	}
+	for i, chk := range checks {
+		response.Services[chk.name] = results[i]
+		if results[i].Healthy {
+			continue
+		}
+
+		c.logger.Warn("Health check failed",
+			zap.String("component", chk.name),
+			zap.String("message", results[i].Message))
+		if chk.critical {
+			response.Status = "unhealthy"
+		} else if response.Status == "healthy" {
+			response.Status = "degraded"
+		}
+	}
+
+	return response
+}
+
+// HealthHandler serves the full report, with 503 when unhealthy
+func (c *Checker) HealthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := c.Check(r.Context())
+
+		status := http.StatusOK
+		if response.Status == "unhealthy" {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, response)
+	}
+}
+
+// ReadinessHandler reports ready unless a critical component is unhealthy
+func (c *Checker) ReadinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c.Check(r.Context()).Status == "unhealthy" {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+				"ready":   false,
+				"message": "Critical component unhealthy",
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ready": true})
+	}
+}
+
+// LivenessHandler reports that the process is serving requests
+func (c *Checker) LivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"alive": true})
+	}
+}
+
+// Mux returns a mux serving /health, /readiness and /liveness
+func (c *Checker) Mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/health", c.HealthHandler())
+	mux.Handle("/readiness", c.ReadinessHandler())
+	mux.Handle("/liveness", c.LivenessHandler())
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Ping returns a check for a dependency that reports health as an error,
+// such as sql.DB.PingContext or RaphtoryClient.Health
+func Ping(ping func(ctx context.Context) error) CheckFunc {
+	return func(ctx context.Context) api.ServiceStatus {
+		if err := ping(ctx); err != nil {
+			return api.ServiceStatus{Healthy: false, Message: err.Error()}
+		}
+		return api.ServiceStatus{Healthy: true, Message: "ok"}
+	}
+}
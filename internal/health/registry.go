@@ -0,0 +1,192 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/api"
+	"go.uber.org/zap"
+)
+
+// registryRetention is how long reports from instances that stopped
+// reporting are kept before they are deleted
+const registryRetention = 24 * time.Hour
+
+// Registry shares component statuses between services. Each service
+// reports the components it runs, such as the monitor's TronGrid streams,
+// the detector's loop and the API's WebSocket hub, and any service can read
+// them all, so the API's health report covers the whole deployment.
+// Reports are kept in Postgres, one per component and instance.
+type Registry struct {
+	db         *sql.DB
+	instance   string
+	staleAfter time.Duration
+	logger     *zap.Logger
+}
+
+// RegistryConfig holds status registry configuration
+type RegistryConfig struct {
+	Instance   string        // Names this process's reports; defaults to the hostname
+	StaleAfter time.Duration // Reports older than this count as unhealthy
+}
+
+// NewRegistry creates a status registry
+func NewRegistry(db *sql.DB, config RegistryConfig, logger *zap.Logger) *Registry {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.Instance == "" {
+		config.Instance, _ = os.Hostname()
+	}
+
+	return &Registry{
+		db:         db,
+		instance:   config.Instance,
+		staleAfter: config.StaleAfter,
+		logger:     logger,
+	}
+}
+
+// Report records component's status for this instance
+func (r *Registry) Report(ctx context.Context, component string, status api.ServiceStatus) error {
+	details, err := json.Marshal(status.Details)
+	if err != nil {
+		return fmt.Errorf("failed to encode status details: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if _, err := r.db.ExecContext(ctx, `
+		INSERT INTO component_status (component, instance, healthy, message, details, reported_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (component, instance) DO UPDATE
+		SET healthy = EXCLUDED.healthy,
+		    message = EXCLUDED.message,
+		    details = EXCLUDED.details,
+		    reported_at = EXCLUDED.reported_at
+	`, component, r.instance, status.Healthy, status.Message, string(details), now); err != nil {
+		return fmt.Errorf("failed to report component status: %w", err)
+	}
+
+	// Instances that went away are trimmed here rather than in a separate job
+	if _, err := r.db.ExecContext(ctx, `
+		DELETE FROM component_status WHERE reported_at < $1
+	`, now.Add(-registryRetention)); err != nil {
+		r.logger.Warn("Failed to trim component statuses", zap.Error(err))
+	}
+	return nil
+}
+
+// Publish reports check's result as component now and every interval
+// until ctx is done. Failed reports are logged and retried at the next
+// interval.
+func (r *Registry) Publish(ctx context.Context, interval time.Duration, component string, check CheckFunc) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		status := check(checkCtx)
+		if err := r.Report(checkCtx, component, status); err != nil && ctx.Err() == nil {
+			r.logger.Warn("Failed to publish component status",
+				zap.String("component", component),
+				zap.Error(err))
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Components returns the latest status of every reported component. A
+// component reported by several live instances is listed once per
+// instance, as component@instance. Reports older than the stale limit are
+// left out when a live instance reports the same component, and otherwise
+// listed as unhealthy, so a service that stopped reporting shows up.
+func (r *Registry) Components(ctx context.Context) (map[string]api.ServiceStatus, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT component, instance, healthy, message, details, reported_at
+		FROM component_status
+		ORDER BY component, reported_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query component statuses: %w", err)
+	}
+	defer rows.Close()
+
+	type report struct {
+		instance string
+		status   api.ServiceStatus
+	}
+	var order []string
+	live := make(map[string][]report)
+	stale := make(map[string]report) // Most recent stale report per component
+
+	now := time.Now()
+	for rows.Next() {
+		var (
+			component, instance, message string
+			healthy                      bool
+			details                      []byte
+			reportedAt                   time.Time
+		)
+		if err := rows.Scan(&component, &instance, &healthy, &message, &details, &reportedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan component status: %w", err)
+		}
+
+		status := api.ServiceStatus{Healthy: healthy, Message: message}
+		if len(details) > 0 {
+			if err := json.Unmarshal(details, &status.Details); err != nil {
+				r.logger.Warn("Failed to decode component status details",
+					zap.String("component", component),
+					zap.Error(err))
+			}
+		}
+		if status.Details == nil {
+			status.Details = make(map[string]interface{})
+		}
+		status.Details["instance"] = instance
+		status.Details["reported_at"] = reportedAt.UTC()
+
+		if _, seen := live[component]; !seen {
+			if _, seen := stale[component]; !seen {
+				order = append(order, component)
+			}
+		}
+		if age := now.Sub(reportedAt); age > r.staleAfter {
+			if _, seen := stale[component]; !seen {
+				status.Healthy = false
+				status.Message = fmt.Sprintf("no report for %s", age.Truncate(time.Second))
+				stale[component] = report{instance, status}
+			}
+			continue
+		}
+		live[component] = append(live[component], report{instance, status})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read component statuses: %w", err)
+	}
+
+	components := make(map[string]api.ServiceStatus)
+	for _, component := range order {
+		reports := live[component]
+		switch {
+		case len(reports) == 0:
+			components[component] = stale[component].status
+		case len(reports) == 1:
+			components[component] = reports[0].status
+		default:
+			for _, report := range reports {
+				components[component+"@"+report.instance] = report.status
+			}
+		}
+	}
+	return components, nil
+}
@@ -0,0 +1,198 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Service metrics. Each service only updates the ones for the parts it
+// runs, and families without samples are not exposed.
+var (
+	// EventsFetched counts events and logs fetched from chain APIs
+	EventsFetched = NewCounterVec("stablerisk_ingestion_events_fetched_total",
+		"Events fetched from chain APIs, before parsing and de-duplication.", "chain", "token")
+
+	// TransactionsDropped counts transactions lost because a client's channel stayed full
+	TransactionsDropped = NewCounterVec("stablerisk_ingestion_transactions_dropped_total",
+		"Transactions dropped because the consumer channel stayed full.", "chain", "token")
+
+	// ChannelDepth is the number of transactions waiting for the monitor's processor
+	ChannelDepth = NewGaugeVec("stablerisk_ingestion_channel_depth",
+		"Transactions buffered in a source channel, waiting to be processed.", "source")
+
+	// IngestionLag is how far the last processed event is behind the chain head
+	IngestionLag = NewGaugeVec("stablerisk_ingestion_lag_seconds",
+		"Chain head block time minus the block time of the last processed event.", "chain", "token")
+
+	// IngestionBlocksBehind is the number of blocks between the last processed event and the chain head
+	IngestionBlocksBehind = NewGaugeVec("stablerisk_ingestion_blocks_behind",
+		"Chain head block number minus the block of the last processed event.", "chain", "token")
+
+	// RaphtoryRequestDuration times calls to the Raphtory service
+	RaphtoryRequestDuration = NewHistogramVec("stablerisk_raphtory_request_duration_seconds",
+		"Raphtory request latency by operation and HTTP status (error when no response).",
+		DefBuckets, "operation", "status")
+
+	// RaphtoryCircuitOpen is 1 while the Raphtory client's circuit breaker is open or half-open
+	RaphtoryCircuitOpen = NewGaugeVec("stablerisk_raphtory_circuit_open",
+		"1 while the Raphtory client's circuit breaker is open or trying a call, 0 when closed.")
+
+	// RaphtoryOutboxDeadLettered counts queued Raphtory writes given up on
+	RaphtoryOutboxDeadLettered = NewCounterVec("stablerisk_raphtory_outbox_dead_lettered_total",
+		"Raphtory writes dead-lettered in the outbox after raphtory.outbox_max_attempts failed deliveries, by operation.", "op")
+
+	// DetectionCycleDuration times detection runs
+	DetectionCycleDuration = NewHistogramVec("stablerisk_detection_cycle_duration_seconds",
+		"Detection run duration by trigger (scheduled or manual) and outcome.",
+		[]float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}, "trigger", "status")
+
+	// DetectionShardDuration times the scoring of each shard of a token's window
+	DetectionShardDuration = NewHistogramVec("stablerisk_detection_shard_duration_seconds",
+		"Statistical scoring time per shard of a detection window, by token and shard index.",
+		[]float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60}, "token", "shard")
+
+	// OutliersDetected counts outliers raised by detection
+	OutliersDetected = NewCounterVec("stablerisk_outliers_detected_total",
+		"Outliers raised by detection, by type and severity.", "type", "severity")
+
+	// DetectionGraphFallback is 1 while detection reads the in-memory graph because Raphtory is down
+	DetectionGraphFallback = NewGaugeVec("stablerisk_detection_graph_fallback",
+		"1 while detection is reading the in-memory fallback graph because Raphtory is unavailable, 0 otherwise.")
+
+	// SanctionedAddresses is the number of addresses loaded from each sanctions list
+	SanctionedAddresses = NewGaugeVec("stablerisk_sanctions_addresses",
+		"Addresses loaded from each sanctions list, as of its last successful load.", "list")
+
+	// HTTPRequestDuration times API requests
+	HTTPRequestDuration = NewHistogramVec("stablerisk_http_request_duration_seconds",
+		"HTTP request latency by method, route template and status code.",
+		DefBuckets, "method", "route", "status")
+
+	// SlowQueries counts database calls slower than the configured threshold
+	SlowQueries = NewCounterVec("stablerisk_db_slow_queries_total",
+		"Database queries and statements slower than monitoring.slow_query_threshold.", "operation")
+
+	// SlowRequests counts API requests slower than the configured threshold
+	SlowRequests = NewCounterVec("stablerisk_http_slow_requests_total",
+		"HTTP requests slower than monitoring.slow_request_threshold, by method and route template.", "method", "route")
+
+	// RateLimited counts API requests refused by rate limiting
+	RateLimited = NewCounterVec("stablerisk_http_rate_limited_total",
+		"HTTP requests refused with 429 by rate limiting, by route group and whether the IP or user limit was hit.", "group", "scope")
+
+	// Errors counts failures by where they arose and who is at fault
+	Errors = NewCounterVec("stablerisk_errors_total",
+		"Failures by component, error code and class (upstream, input or internal).", "component", "code", "class")
+
+	// WebSocketClients is the number of connected WebSocket clients
+	WebSocketClients = NewGaugeVec("stablerisk_websocket_clients",
+		"Connected WebSocket clients.")
+
+	// WebSocketRejected counts WebSocket connections refused by connection limits
+	WebSocketRejected = NewCounterVec("stablerisk_websocket_rejected_total",
+		"WebSocket connections refused by connection limits, by limit (user or instance).", "limit")
+
+	// WebSocketMessagesDropped counts WebSocket messages not sent to a client
+	WebSocketMessagesDropped = NewCounterVec("stablerisk_websocket_messages_dropped_total",
+		"WebSocket messages not sent, by message type and reason (client_queue_full, hub_busy or backplane).", "type", "reason")
+
+	// WebSocketRelayed counts WebSocket broadcasts passed between API instances
+	WebSocketRelayed = NewCounterVec("stablerisk_websocket_relayed_total",
+		"WebSocket broadcasts relayed over the backplane, by direction (sent or received).", "direction")
+
+	// WebSocketSlowClients counts WebSocket clients disconnected for falling behind
+	WebSocketSlowClients = NewCounterVec("stablerisk_websocket_slow_clients_total",
+		"WebSocket clients disconnected because their send queue was full.")
+
+	// Notifications counts outlier alerts by channel and what became of them
+	Notifications = NewCounterVec("stablerisk_notifications_total",
+		"Outlier alerts by channel and result (sent, resolved, failed, duplicate, throttled or dropped).", "channel", "result")
+
+	// WebhookDeliveries counts webhook deliveries by how they ended
+	WebhookDeliveries = NewCounterVec("stablerisk_webhook_deliveries_total",
+		"Webhook deliveries by result (delivered, failed or dropped).", "result")
+
+	// EnrichmentLookups counts address screenings by chain-analytics providers
+	EnrichmentLookups = NewCounterVec("stablerisk_enrichment_lookups_total",
+		"Address screenings by chain-analytics provider and result (cached, screened or failed).", "provider", "result")
+
+	// SIEMEvents counts outliers and audit entries exported to the SIEM
+	SIEMEvents = NewCounterVec("stablerisk_siem_events_total",
+		"Events exported to the SIEM by kind (outlier or audit) and result (sent, failed or dropped).", "kind", "result")
+)
+
+var startTime = time.Now()
+
+func init() {
+	Default.MustRegister(
+		EventsFetched,
+		TransactionsDropped,
+		ChannelDepth,
+		IngestionLag,
+		IngestionBlocksBehind,
+		RaphtoryRequestDuration,
+		RaphtoryCircuitOpen,
+		RaphtoryOutboxDeadLettered,
+		DetectionCycleDuration,
+		DetectionShardDuration,
+		OutliersDetected,
+		DetectionGraphFallback,
+		SanctionedAddresses,
+		HTTPRequestDuration,
+		SlowQueries,
+		SlowRequests,
+		RateLimited,
+		Errors,
+		WebSocketClients,
+		WebSocketRejected,
+		WebSocketMessagesDropped,
+		WebSocketSlowClients,
+		WebSocketRelayed,
+		Notifications,
+		WebhookDeliveries,
+		EnrichmentLookups,
+		SIEMEvents,
+		NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() float64 {
+			return float64(runtime.NumGoroutine())
+		}),
+		NewGaugeFunc("go_memstats_heap_alloc_bytes", "Bytes of allocated heap objects.", func() float64 {
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			return float64(stats.HeapAlloc)
+		}),
+		NewGaugeFunc("process_start_time_seconds", "Start time of the process since the Unix epoch in seconds.", func() float64 {
+			return float64(startTime.UnixNano()) / 1e9
+		}),
+	)
+}
+
+// StartServer serves /metrics, along with any routes already on mux, on
+// port in the background. mux may be nil. Shut the returned server down on exit.
+func StartServer(port int, mux *http.ServeMux, logger *zap.Logger) *http.Server {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if mux == nil {
+		mux = http.NewServeMux()
+	}
+	mux.Handle("/metrics", Handler())
+
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		logger.Info("Metrics server listening", zap.Int("port", port))
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("Metrics server failed", zap.Error(err))
+		}
+	}()
+
+	return srv
+}
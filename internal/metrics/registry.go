@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the Prometheus text exposition format version 0.0.4
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var nameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Collector is a metric family that can be registered and exposed
+type Collector interface {
+	// desc returns the family name, help text and type
+	desc() (name, help, kind string)
+	// write appends the family's samples in text format; nothing when empty
+	write(buf *bytes.Buffer)
+}
+
+// Registry holds the metric families a service exposes
+type Registry struct {
+	mu         sync.RWMutex
+	collectors map[string]Collector
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// Default is the registry the service metrics are registered with and that
+// Handler exposes
+var Default = NewRegistry()
+
+// MustRegister adds collectors, panicking on an invalid or duplicate name
+func (r *Registry) MustRegister(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range collectors {
+		name, _, _ := c.desc()
+		if !nameRE.MatchString(name) {
+			panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+		}
+		if _, ok := r.collectors[name]; ok {
+			panic(fmt.Sprintf("metrics: duplicate metric %q", name))
+		}
+		r.collectors[name] = c
+	}
+}
+
+// WriteText writes every family in the Prometheus text format, sorted by name
+func (r *Registry) WriteText(buf *bytes.Buffer) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	collectors := make([]Collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.mu.RUnlock()
+
+	for _, c := range collectors {
+		var samples bytes.Buffer
+		c.write(&samples)
+		if samples.Len() == 0 {
+			continue
+		}
+
+		name, help, kind := c.desc()
+		fmt.Fprintf(buf, "# HELP %s %s\n", name, escapeHelp(help))
+		fmt.Fprintf(buf, "# TYPE %s %s\n", name, kind)
+		buf.Write(samples.Bytes())
+	}
+}
+
+// Handler serves the registry in the Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var buf bytes.Buffer
+		r.WriteText(&buf)
+		w.Header().Set("Content-Type", ContentType)
+		w.Write(buf.Bytes())
+	})
+}
+
+// Handler serves the default registry
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// writeSample appends one sample line
+func writeSample(buf *bytes.Buffer, name string, labels []string, values []string, value float64) {
+	buf.WriteString(name)
+	if len(labels) > 0 {
+		buf.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(label)
+			buf.WriteString(`="`)
+			buf.WriteString(escapeLabel(values[i]))
+			buf.WriteByte('"')
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(formatFloat(value))
+	buf.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
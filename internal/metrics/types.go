@@ -0,0 +1,255 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are latency buckets in seconds, from 5ms to 10s
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// atomicFloat is a float64 updated without locks
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) add(delta float64) {
+	for {
+		old := f.bits.Load()
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if f.bits.CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) set(v float64) { f.bits.Store(math.Float64bits(v)) }
+func (f *atomicFloat) load() float64 { return math.Float64frombits(f.bits.Load()) }
+
+// Counter is a value that only goes up
+type Counter struct {
+	value atomicFloat
+}
+
+// Inc adds one
+func (c *Counter) Inc() { c.value.add(1) }
+
+// Add adds delta, which must not be negative
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.value.add(delta)
+}
+
+// Value returns the current count
+func (c *Counter) Value() float64 { return c.value.load() }
+
+// Gauge is a value that goes up and down
+type Gauge struct {
+	value atomicFloat
+}
+
+// Set replaces the value
+func (g *Gauge) Set(v float64) { g.value.set(v) }
+
+// Add adds delta, which may be negative
+func (g *Gauge) Add(delta float64) { g.value.add(delta) }
+
+// Inc adds one
+func (g *Gauge) Inc() { g.value.add(1) }
+
+// Dec subtracts one
+func (g *Gauge) Dec() { g.value.add(-1) }
+
+// Value returns the current value
+func (g *Gauge) Value() float64 { return g.value.load() }
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	upperBounds []float64
+	counts      []atomic.Uint64 // Per bucket, not cumulative; the last is +Inf
+	sum         atomicFloat
+	count       atomic.Uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		upperBounds: buckets,
+		counts:      make([]atomic.Uint64, len(buckets)+1),
+	}
+}
+
+// Observe records one value
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	h.counts[i].Add(1)
+	h.sum.add(v)
+	h.count.Add(1)
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() uint64 { return h.count.Load() }
+
+func (h *Histogram) write(buf *bytes.Buffer, name string, labels, values []string) {
+	bucketLabels := append(append([]string{}, labels...), "le")
+	var cumulative uint64
+	for i, bound := range h.upperBounds {
+		cumulative += h.counts[i].Load()
+		writeSample(buf, name+"_bucket", bucketLabels, append(append([]string{}, values...), formatFloat(bound)), float64(cumulative))
+	}
+	cumulative += h.counts[len(h.upperBounds)].Load()
+	writeSample(buf, name+"_bucket", bucketLabels, append(append([]string{}, values...), "+Inf"), float64(cumulative))
+	writeSample(buf, name+"_sum", labels, values, h.sum.load())
+	writeSample(buf, name+"_count", labels, values, float64(h.count.Load()))
+}
+
+// vec holds one child metric per combination of label values
+type vec[T any] struct {
+	name     string
+	help     string
+	kind     string
+	labels   []string
+	newChild func() *T
+	writeFn  func(buf *bytes.Buffer, child *T, values []string)
+
+	mu       sync.RWMutex
+	children map[string]*T
+	values   map[string][]string
+}
+
+func newVec[T any](name, help, kind string, labels []string, newChild func() *T, writeFn func(*bytes.Buffer, *T, []string)) *vec[T] {
+	return &vec[T]{
+		name:     name,
+		help:     help,
+		kind:     kind,
+		labels:   labels,
+		newChild: newChild,
+		writeFn:  writeFn,
+		children: make(map[string]*T),
+		values:   make(map[string][]string),
+	}
+}
+
+// get returns the child for the label values, creating it on first use
+func (v *vec[T]) get(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	child, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return child
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, ok := v.children[key]; ok {
+		return child
+	}
+	child = v.newChild()
+	v.children[key] = child
+	v.values[key] = append([]string{}, values...)
+	return child
+}
+
+func (v *vec[T]) desc() (string, string, string) { return v.name, v.help, v.kind }
+
+func (v *vec[T]) write(buf *bytes.Buffer) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v.writeFn(buf, v.children[key], v.values[key])
+	}
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	*vec[Counter]
+}
+
+// NewCounterVec creates a counter family. Without labels it has a single
+// series, returned by WithLabelValues().
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{}
+	v.vec = newVec(name, help, "counter", labels, func() *Counter { return &Counter{} },
+		func(buf *bytes.Buffer, c *Counter, values []string) {
+			writeSample(buf, name, labels, values, c.Value())
+		})
+	return v
+}
+
+// WithLabelValues returns the counter for the label values, in label order
+func (v *CounterVec) WithLabelValues(values ...string) *Counter { return v.get(values) }
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct {
+	*vec[Gauge]
+}
+
+// NewGaugeVec creates a gauge family
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{}
+	v.vec = newVec(name, help, "gauge", labels, func() *Gauge { return &Gauge{} },
+		func(buf *bytes.Buffer, g *Gauge, values []string) {
+			writeSample(buf, name, labels, values, g.Value())
+		})
+	return v
+}
+
+// WithLabelValues returns the gauge for the label values, in label order
+func (v *GaugeVec) WithLabelValues(values ...string) *Gauge { return v.get(values) }
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	*vec[Histogram]
+}
+
+// NewHistogramVec creates a histogram family with the given bucket upper
+// bounds, which must be sorted (DefBuckets when nil)
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	v := &HistogramVec{}
+	v.vec = newVec(name, help, "histogram", labels, func() *Histogram { return newHistogram(buckets) },
+		func(buf *bytes.Buffer, h *Histogram, values []string) {
+			h.write(buf, name, labels, values)
+		})
+	return v
+}
+
+// WithLabelValues returns the histogram for the label values, in label order
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram { return v.get(values) }
+
+// GaugeFunc is a gauge whose value is read when metrics are scraped
+type GaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+// NewGaugeFunc creates a gauge that calls fn on every scrape
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	return &GaugeFunc{name: name, help: help, fn: fn}
+}
+
+func (g *GaugeFunc) desc() (string, string, string) { return g.name, g.help, "gauge" }
+
+func (g *GaugeFunc) write(buf *bytes.Buffer) {
+	writeSample(buf, g.name, nil, nil, g.fn())
+}
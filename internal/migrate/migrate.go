@@ -0,0 +1,396 @@
+// Package migrate applies SQL migrations to the database in order,
+// recording each one in schema_migrations so it runs once. Each migration
+// runs in a transaction with its record, so a failed migration leaves
+// nothing behind and is retried on the next run.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Table records applied migrations
+const Table = "schema_migrations"
+
+// lockID is the Postgres advisory lock held while migrating, so API
+// instances starting together do not apply a migration twice
+const lockID = 7_246_113_550
+
+// fileName matches migration files, e.g. 001_initial_schema.sql
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+
+// Migration is one SQL migration file
+type Migration struct {
+	Version  int
+	Name     string // File name without the extension, e.g. 001_initial_schema
+	SQL      string
+	Checksum string // SHA-256 of SQL, to spot applied migrations edited since
+}
+
+// Status is a migration and whether it has been applied
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool // Applied, but the file has changed since
+}
+
+// Load reads the migrations at the root of fsys, in version order. Files
+// not named like migrations are ignored.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	var migrations []Migration
+	versions := make(map[int]string)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(match[1])
+		name := entry.Name()[:len(entry.Name())-len(path.Ext(entry.Name()))]
+		if other, ok := versions[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, name)
+		}
+		versions[version] = name
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", name, err)
+		}
+		sum := sha256.Sum256(data)
+		migrations = append(migrations, Migration{
+			Version:  version,
+			Name:     name,
+			SQL:      string(data),
+			Checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Config holds migrator configuration
+type Config struct {
+	// AdvisoryLock holds a Postgres advisory lock while migrating, so
+	// processes migrating at once take turns
+	AdvisoryLock bool
+}
+
+// AuditLogger records applied migrations in the audit log hash chain,
+// as security.AuditLogger does
+type AuditLogger interface {
+	Log(userID, action, resource, status, ipAddress string, details map[string]interface{})
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	db          *sql.DB
+	migrations  []Migration
+	config      Config
+	auditLogger AuditLogger
+	logger      *zap.Logger
+}
+
+// New creates a migrator for the migrations in fsys
+func New(db *sql.DB, fsys fs.FS, config Config, logger *zap.Logger) (*Migrator, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+		config:     config,
+		logger:     logger,
+	}, nil
+}
+
+// SetAuditLogger records each migration Up applies in the audit log.
+// Migrations themselves only write to audit_logs up to the one that
+// chains it, since SQL cannot sign chained records.
+func (m *Migrator) SetAuditLogger(auditLogger AuditLogger) {
+	m.auditLogger = auditLogger
+}
+
+// Migrations returns the migrations, in version order
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Up applies every migration not yet applied, in order, and returns how
+// many it applied. It stops at the first that fails.
+//
+// A database created before migrations were recorded, such as by the
+// Postgres image's init scripts, is adopted first: the migrations it has
+// already run are recorded from their migration entries in audit_logs.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	count := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			if applied, err = m.adopt(ctx, conn); err != nil {
+				return err
+			}
+		}
+		m.checkApplied(applied)
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			start := time.Now()
+			if err := m.apply(ctx, conn, migration, true); err != nil {
+				return fmt.Errorf("migration %s failed: %w", migration.Name, err)
+			}
+			count++
+			m.logger.Info("Applied migration",
+				zap.String("migration", migration.Name),
+				zap.Duration("duration", time.Since(start)))
+			if m.auditLogger != nil {
+				m.auditLogger.Log("system", "migration", "database", "success", "", map[string]interface{}{
+					"migration": migration.Name,
+					"checksum":  migration.Checksum,
+				})
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Status lists every migration, and whether and when it was applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			status := Status{Migration: migration}
+			if record, ok := applied[migration.Version]; ok {
+				status.Applied = true
+				status.AppliedAt = record.appliedAt
+				status.Modified = record.checksum != migration.Checksum
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Baseline records every migration up to and including version as
+// applied without running it, for a database whose schema was created by
+// hand
+func (m *Migrator) Baseline(ctx context.Context, version int) (int, error) {
+	found := false
+	for _, migration := range m.migrations {
+		found = found || migration.Version == version
+	}
+	if !found {
+		return 0, fmt.Errorf("no migration has version %d", version)
+	}
+
+	count := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration, false); err != nil {
+				return fmt.Errorf("failed to record migration %s: %w", migration.Name, err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// locked runs fn on one connection, after creating the migrations table,
+// holding the advisory lock if configured
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close()
+
+	if m.config.AdvisoryLock {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+			return fmt.Errorf("failed to lock migrations: %w", err)
+		}
+		defer func() {
+			// Unlock even when ctx is done, or the lock lasts as long as
+			// the pooled connection
+			if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID); err != nil {
+				m.logger.Warn("Failed to unlock migrations", zap.Error(err))
+			}
+		}()
+	}
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS `+Table+` (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL -- UTC
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", Table, err)
+	}
+	return fn(conn)
+}
+
+// record is an applied migration
+type record struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// applied returns the applied migrations by version
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int]record, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM `+Table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]record)
+	for rows.Next() {
+		var version int
+		var r record
+		if err := rows.Scan(&version, &r.name, &r.checksum, &r.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		applied[version] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// adopt records the migrations an untracked database has run, from the
+// audit log entries they wrote, and returns them. A database without an
+// audit log is new and has run none.
+func (m *Migrator) adopt(ctx context.Context, conn *sql.Conn) (map[int]record, error) {
+	applied := make(map[int]record)
+	rows, err := conn.QueryContext(ctx, `SELECT details FROM audit_logs WHERE action = 'migration'`)
+	if err != nil {
+		// No audit log yet
+		return applied, nil
+	}
+	ran := make(map[string]bool)
+	for rows.Next() {
+		var details sql.NullString
+		if err := rows.Scan(&details); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan migration audit entry: %w", err)
+		}
+		var entry struct {
+			Migration string `json:"migration"`
+		}
+		if json.Unmarshal([]byte(details.String), &entry) == nil && entry.Migration != "" {
+			ran[entry.Migration] = true
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration audit entries: %w", err)
+	}
+	if len(ran) == 0 {
+		return applied, nil
+	}
+
+	for _, migration := range m.migrations {
+		if !ran[migration.Name] {
+			continue
+		}
+		if err := m.apply(ctx, conn, migration, false); err != nil {
+			return nil, fmt.Errorf("failed to record migration %s: %w", migration.Name, err)
+		}
+		applied[migration.Version] = record{name: migration.Name, checksum: migration.Checksum}
+	}
+	m.logger.Info("Adopted migrations already run on the database",
+		zap.Int("migrations", len(applied)))
+	return applied, nil
+}
+
+// checkApplied warns about applied migrations this binary does not have
+// or that have changed since they were applied
+func (m *Migrator) checkApplied(applied map[int]record) {
+	known := make(map[int]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+	for version, r := range applied {
+		migration, ok := known[version]
+		switch {
+		case !ok:
+			m.logger.Warn("Database has a migration this build does not; it may be older than the schema",
+				zap.String("migration", r.name))
+		case r.checksum != migration.Checksum:
+			m.logger.Warn("Migration changed since it was applied; the change has not been applied",
+				zap.String("migration", migration.Name))
+		}
+	}
+}
+
+// apply records migration as applied, running it first if run is set, in
+// one transaction
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, run bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if run {
+		if _, err := tx.ExecContext(ctx, migration.SQL); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO `+Table+` (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)`,
+		migration.Version, migration.Name, migration.Checksum, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,365 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// EmailConfig holds SMTP alert delivery configuration
+type EmailConfig struct {
+	Host        string
+	Port        int    // Defaults to 587
+	ImplicitTLS bool   // Connect over TLS, as on port 465; otherwise STARTTLS is used when offered
+	Username    string // Empty sends without authenticating
+	Password    string
+	From        string
+	// Recipients by severity; severities not listed go to DefaultRecipients
+	Recipients        map[models.Severity][]string
+	DefaultRecipients []string
+	DashboardURL      string // Alerts link to the outlier on the dashboard at this URL
+	// BatchWindow collects alerts less severe than ImmediateSeverity into one
+	// digest per recipient list, sent every window; 0 sends every alert on
+	// its own
+	BatchWindow       time.Duration
+	ImmediateSeverity models.Severity // Defaults to critical
+	Retry             RetryPolicy     // Applies to digests; single alerts are retried by the router
+	Timeout           time.Duration   // Per message; defaults to 30s
+}
+
+// EmailNotifier sends alerts as HTML email over SMTP
+type EmailNotifier struct {
+	config EmailConfig
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	pending map[string][]Alert // Batched alerts by recipient list
+}
+
+// NewEmailNotifier creates an email notifier
+func NewEmailNotifier(config EmailConfig, logger *zap.Logger) *EmailNotifier {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	if config.ImmediateSeverity == "" {
+		config.ImmediateSeverity = models.SeverityCritical
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	return &EmailNotifier{
+		config:  config,
+		logger:  logger,
+		pending: make(map[string][]Alert),
+	}
+}
+
+// Name implements Notifier
+func (n *EmailNotifier) Name() string {
+	return "email"
+}
+
+// Notify implements Notifier. With batching, alerts less severe than the
+// immediate severity are held for the next digest.
+func (n *EmailNotifier) Notify(ctx context.Context, alert Alert) error {
+	recipients := n.recipients(alert.Outlier.Severity)
+	if len(recipients) == 0 {
+		n.logger.Debug("No email recipients for severity", zap.String("severity", string(alert.Outlier.Severity)))
+		return nil
+	}
+
+	if n.config.BatchWindow > 0 && alert.Outlier.Severity.RiskScore() < n.config.ImmediateSeverity.RiskScore() {
+		key := strings.Join(recipients, ",")
+		n.mu.Lock()
+		n.pending[key] = append(n.pending[key], alert)
+		n.mu.Unlock()
+		return nil
+	}
+
+	return n.send(ctx, recipients, "[StableRisk] "+summary(alert.Outlier), []Alert{alert})
+}
+
+// Run sends a digest of the batched alerts every batch window until ctx is
+// done, then sends what is left. It returns at once without batching.
+func (n *EmailNotifier) Run(ctx context.Context) {
+	if n.config.BatchWindow <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(n.config.BatchWindow)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			n.Flush(ctx)
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), n.config.Timeout)
+			n.Flush(flushCtx)
+			cancel()
+			return
+		}
+	}
+}
+
+// Flush sends a digest of the batched alerts to each recipient list. A
+// digest that still fails after retrying is logged and dropped.
+func (n *EmailNotifier) Flush(ctx context.Context) {
+	n.mu.Lock()
+	pending := n.pending
+	n.pending = make(map[string][]Alert)
+	n.mu.Unlock()
+
+	for key, alerts := range pending {
+		recipients := strings.Split(key, ",")
+		subject := fmt.Sprintf("[StableRisk] %d outlier alerts", len(alerts))
+		if len(alerts) == 1 {
+			subject = "[StableRisk] 1 outlier alert"
+		}
+
+		err := retry(ctx, n.config.Retry, n.logger, func() error {
+			return n.send(ctx, recipients, subject, alerts)
+		})
+		if err != nil {
+			n.logger.Error("Failed to send alert digest",
+				zap.Strings("recipients", recipients),
+				zap.Int("alerts", len(alerts)),
+				zap.Error(err))
+		}
+	}
+}
+
+// recipients returns who is told about outliers of severity, sorted so
+// batches for the same people share a key
+func (n *EmailNotifier) recipients(severity models.Severity) []string {
+	recipients, ok := n.config.Recipients[severity]
+	if !ok {
+		recipients = n.config.DefaultRecipients
+	}
+	recipients = append([]string(nil), recipients...)
+	sort.Strings(recipients)
+	return recipients
+}
+
+// emailTemplate renders one or more alerts
+var emailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+{{range .}}
+<table style="border-collapse: collapse; margin-bottom: 24px;">
+<tr><th colspan="2" style="text-align: left; font-size: 16px; padding-bottom: 8px;">{{.Severity}} {{.Type}} outlier</th></tr>
+<tr><td style="padding-right: 16px;">Rule</td><td>{{.Rule}}</td></tr>
+<tr><td style="padding-right: 16px;">Detected</td><td>{{.DetectedAt}}</td></tr>
+{{if .Address}}<tr><td style="padding-right: 16px;">Address</td><td><code>{{.Address}}</code></td></tr>{{end}}
+{{if .TransactionHash}}<tr><td style="padding-right: 16px;">Transaction</td><td><code>{{.TransactionHash}}</code></td></tr>{{end}}
+{{if .Amount}}<tr><td style="padding-right: 16px;">Amount</td><td>{{.Amount}}</td></tr>{{end}}
+{{range .Details}}<tr><td style="padding-right: 16px;">{{.Name}}</td><td>{{.Value}}</td></tr>{{end}}
+{{if .Link}}<tr><td colspan="2" style="padding-top: 8px;"><a href="{{.Link}}">View in StableRisk</a></td></tr>{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
+
+// emailAlert is an alert as the template shows it
+type emailAlert struct {
+	Rule            string
+	Severity        string
+	Type            string
+	DetectedAt      string
+	Address         string
+	TransactionHash string
+	Amount          string
+	Details         []emailDetail
+	Link            string
+}
+
+// emailDetail is one of an outlier's details
+type emailDetail struct {
+	Name  string
+	Value string
+}
+
+// render builds the HTML body for alerts
+func (n *EmailNotifier) render(alerts []Alert) ([]byte, error) {
+	views := make([]emailAlert, len(alerts))
+	for i, alert := range alerts {
+		o := alert.Outlier
+		view := emailAlert{
+			Rule:            alert.Rule,
+			Severity:        strings.ToUpper(string(o.Severity)),
+			Type:            string(o.Type),
+			DetectedAt:      o.DetectedAt.UTC().Format(time.RFC1123),
+			Address:         o.Address,
+			TransactionHash: o.TransactionHash,
+			Link:            outlierLink(n.config.DashboardURL, o.ID),
+		}
+		if !o.Amount.IsZero() {
+			view.Amount = o.Amount.String()
+		}
+		names := make([]string, 0, len(o.Details))
+		for name := range o.Details {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			view.Details = append(view.Details, emailDetail{Name: name, Value: fmt.Sprint(o.Details[name])})
+		}
+		views[i] = view
+	}
+
+	var body bytes.Buffer
+	if err := emailTemplate.Execute(&body, views); err != nil {
+		return nil, fmt.Errorf("failed to render email: %w", err)
+	}
+	return body.Bytes(), nil
+}
+
+// send delivers alerts to recipients in one email
+func (n *EmailNotifier) send(ctx context.Context, recipients []string, subject string, alerts []Alert) error {
+	body, err := n.render(alerts)
+	if err != nil {
+		return err
+	}
+	return n.Send(ctx, recipients, subject, body)
+}
+
+// Attachment is a file attached to an email
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+// Send emails an HTML body, with any attachments, to recipients
+func (n *EmailNotifier) Send(ctx context.Context, recipients []string, subject string, body []byte, attachments ...Attachment) error {
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", n.config.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	if len(attachments) == 0 {
+		message.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+		message.Write(body)
+	} else if err := writeMultipart(&message, body, attachments); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, n.config.Timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(n.config.Host, strconv.Itoa(n.config.Port))
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	var err error
+	if n.config.ImplicitTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: n.config.Host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, n.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if !n.config.ImplicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: n.config.Host}); err != nil {
+				return fmt.Errorf("failed to start TLS: %w", err)
+			}
+		}
+	}
+	if n.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(n.config.From); err != nil {
+		return fmt.Errorf("SMTP server refused sender: %w", err)
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("SMTP server refused recipient %s: %w", recipient, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if _, err := w.Write(message.Bytes()); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return client.Quit()
+}
+
+// writeMultipart writes a multipart/mixed message body holding the HTML
+// body followed by the attachments
+func writeMultipart(message *bytes.Buffer, body []byte, attachments []Attachment) error {
+	parts := multipart.NewWriter(message)
+	fmt.Fprintf(message, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", parts.Boundary())
+
+	part, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/html; charset=UTF-8"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build email: %w", err)
+	}
+	part.Write(body)
+
+	for _, attachment := range attachments {
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to build email: %w", err)
+		}
+
+		// Base64 lines are kept to 76 characters as MIME requires
+		encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+		for len(encoded) > 76 {
+			fmt.Fprintf(part, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", encoded)
+	}
+	if err := parts.Close(); err != nil {
+		return fmt.Errorf("failed to build email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// LogNotifier writes alerts to the service log. It is always available, so
+// rules have somewhere to send alerts before any other channel is set up.
+type LogNotifier struct {
+	logger *zap.Logger
+}
+
+// NewLogNotifier creates a notifier logging to logger
+func NewLogNotifier(logger *zap.Logger) *LogNotifier {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &LogNotifier{logger: logger}
+}
+
+// Name implements Notifier
+func (n *LogNotifier) Name() string {
+	return "log"
+}
+
+// Notify implements Notifier
+func (n *LogNotifier) Notify(_ context.Context, alert Alert) error {
+	n.logger.Warn("Outlier alert",
+		zap.String("rule", alert.Rule),
+		zap.String("outlier_id", alert.Outlier.ID),
+		zap.String("org_id", alert.Outlier.OrgID),
+		zap.String("type", string(alert.Outlier.Type)),
+		zap.String("severity", string(alert.Outlier.Severity)),
+		zap.String("address", alert.Outlier.Address),
+		zap.String("transaction_hash", alert.Outlier.TransactionHash))
+	return nil
+}
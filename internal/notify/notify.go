@@ -0,0 +1,174 @@
+// Package notify tells people about outliers through channels such as
+// email, chat or paging services. A Router matches each outlier against
+// alert rules and delivers those that match to the rules' channels,
+// retrying failed deliveries, dropping duplicates and throttling each
+// channel so an alert storm cannot flood it.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+)
+
+// Notifier delivers alerts to one channel
+type Notifier interface {
+	// Name identifies the channel in rules, logs and metrics
+	Name() string
+	// Notify delivers an alert. Failures are retried by the router.
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// Resolver is a Notifier that closes what it raised once an outlier is
+// acknowledged, such as a paging service's incident
+type Resolver interface {
+	Resolve(ctx context.Context, outlier models.Outlier) error
+}
+
+// Alert is an outlier to tell someone about, with the rule it matched
+type Alert struct {
+	Rule    string
+	Outlier models.Outlier
+}
+
+// IncidentKey groups alerts into incidents: those of the same type about
+// the same address for the same organization are one incident. Outliers
+// without an address are an incident of their own.
+func IncidentKey(outlier models.Outlier) string {
+	orgID := outlier.OrgID
+	if orgID == "" {
+		orgID = models.DefaultOrganizationID
+	}
+	subject := outlier.Address
+	if subject == "" {
+		subject = outlier.ID
+	}
+	return "stablerisk:" + orgID + ":" + string(outlier.Type) + ":" + subject
+}
+
+// summary describes an outlier in one line
+func summary(outlier models.Outlier) string {
+	text := fmt.Sprintf("%s %s outlier", strings.ToUpper(string(outlier.Severity)), outlier.Type)
+	if outlier.Address != "" {
+		text += " on " + outlier.Address
+	}
+	return text
+}
+
+// outlierLink is the dashboard page showing an outlier, or empty without a
+// dashboard URL
+func outlierLink(dashboardURL, id string) string {
+	if dashboardURL == "" {
+		return ""
+	}
+	return strings.TrimRight(dashboardURL, "/") + "/outliers?id=" + id
+}
+
+// postJSON sends body as JSON to endpoint, failing unless the response is
+// one of accepted. Error responses' bodies are included in the error.
+func postJSON(ctx context.Context, client *http.Client, endpoint string, headers map[string]string, body interface{}, accepted ...int) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	for _, status := range accepted {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%s returned status %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(message)))
+}
+
+// Watchlist reports whether an organization watches an address
+type Watchlist interface {
+	Watched(orgID, address string) bool
+}
+
+// Incidents reports whether an outlier's incident still has outliers
+// waiting to be acknowledged, so acknowledging one of several does not
+// close it
+type Incidents interface {
+	IncidentOpen(ctx context.Context, outlier models.Outlier) (bool, error)
+}
+
+// Rule selects the outliers sent to its channels. An outlier must match
+// every condition that is set.
+type Rule struct {
+	Name        string
+	MinSeverity models.Severity      // At least this severe; empty matches all
+	Types       []models.OutlierType // Any of these types; empty matches all
+	Watchlisted bool                 // Only outliers on or against a watched address
+	Channels    []string             // Names of the notifiers alerts go to
+}
+
+// validate checks the rule's severity and that it names channels
+func (r Rule) validate() error {
+	if r.MinSeverity != "" && !r.MinSeverity.Valid() {
+		return fmt.Errorf("rule %q: unknown severity %q", r.Name, r.MinSeverity)
+	}
+	if len(r.Channels) == 0 {
+		return fmt.Errorf("rule %q: no channels", r.Name)
+	}
+	return nil
+}
+
+// Matches reports whether outlier meets the rule's conditions. Watchlist
+// hits are always on a watched address; other outliers are checked against
+// watchlist, which may be nil.
+func (r Rule) Matches(outlier models.Outlier, watchlist Watchlist) bool {
+	if r.MinSeverity != "" && outlier.Severity.RiskScore() < r.MinSeverity.RiskScore() {
+		return false
+	}
+
+	if len(r.Types) > 0 {
+		match := false
+		for _, t := range r.Types {
+			if outlier.Type == t {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+
+	if r.Watchlisted && outlier.Type != models.OutlierTypeWatchlist {
+		if watchlist == nil {
+			return false
+		}
+		orgID := outlier.OrgID
+		if orgID == "" {
+			orgID = models.DefaultOrganizationID
+		}
+		counterparty, _ := outlier.Details["counterparty"].(string)
+		if !watchlist.Watched(orgID, outlier.Address) && (counterparty == "" || !watchlist.Watched(orgID, counterparty)) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,164 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// OpsgenieConfig holds Opsgenie Alert API configuration
+type OpsgenieConfig struct {
+	APIURL string // Defaults to https://api.opsgenie.com; EU accounts use https://api.eu.opsgenie.com
+	APIKey string
+	// Responders are notified of every alert, through their own escalation
+	// and on-call rules
+	Responders []OpsgenieResponder
+	// Priorities by severity; defaults to P1 for critical down to P4 for low
+	Priorities   map[models.Severity]string
+	MinSeverity  models.Severity // Less severe alerts are ignored; defaults to critical
+	DashboardURL string          // Alerts link to the outlier on the dashboard at this URL
+	Timeout      time.Duration   // Per request; defaults to 10s
+}
+
+// OpsgenieResponder is a team, user, escalation or schedule alerts go to,
+// by name (or username for users)
+type OpsgenieResponder struct {
+	Type string
+	Name string
+}
+
+// defaultOpsgeniePriorities maps outlier severities to Opsgenie priorities
+var defaultOpsgeniePriorities = map[models.Severity]string{
+	models.SeverityCritical: "P1",
+	models.SeverityHigh:     "P2",
+	models.SeverityMedium:   "P3",
+	models.SeverityLow:      "P4",
+}
+
+// OpsgenieNotifier opens an Opsgenie alert for each incident key, which
+// Opsgenie de-duplicates while the alert is open, and closes it when an
+// outlier is acknowledged
+type OpsgenieNotifier struct {
+	config     OpsgenieConfig
+	httpClient *http.Client
+	logger     *zap.Logger
+}
+
+// NewOpsgenieNotifier creates an Opsgenie notifier
+func NewOpsgenieNotifier(config OpsgenieConfig, logger *zap.Logger) *OpsgenieNotifier {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.APIURL == "" {
+		config.APIURL = "https://api.opsgenie.com"
+	}
+	config.APIURL = strings.TrimRight(config.APIURL, "/")
+	if config.MinSeverity == "" {
+		config.MinSeverity = models.SeverityCritical
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	return &OpsgenieNotifier{
+		config:     config,
+		httpClient: &http.Client{Timeout: config.Timeout},
+		logger:     logger,
+	}
+}
+
+// Name implements Notifier
+func (n *OpsgenieNotifier) Name() string {
+	return "opsgenie"
+}
+
+// Notify implements Notifier
+func (n *OpsgenieNotifier) Notify(ctx context.Context, alert Alert) error {
+	o := alert.Outlier
+	if o.Severity.RiskScore() < n.config.MinSeverity.RiskScore() {
+		return nil
+	}
+
+	// Opsgenie details are string values
+	details := map[string]string{
+		"outlier_id": o.ID,
+		"rule":       alert.Rule,
+		"type":       string(o.Type),
+		"address":    o.Address,
+	}
+	if o.TransactionHash != "" {
+		details["transaction_hash"] = o.TransactionHash
+	}
+	if !o.Amount.IsZero() {
+		details["amount"] = o.Amount.String()
+	}
+	for name, value := range o.Details {
+		details[name] = fmt.Sprint(value)
+	}
+
+	priority, ok := n.config.Priorities[o.Severity]
+	if !ok {
+		priority = defaultOpsgeniePriorities[o.Severity]
+	}
+
+	description := summary(o) + " detected " + o.DetectedAt.UTC().Format(time.RFC1123) + "."
+	if link := outlierLink(n.config.DashboardURL, o.ID); link != "" {
+		description += "\n\n" + link
+	}
+
+	body := map[string]interface{}{
+		"message":     "StableRisk: " + summary(o),
+		"alias":       IncidentKey(o),
+		"description": description,
+		"priority":    priority,
+		"source":      "StableRisk",
+		"entity":      o.Address,
+		"tags":        []string{"stablerisk", string(o.Type), string(o.Severity)},
+		"details":     details,
+	}
+	if len(n.config.Responders) > 0 {
+		responders := make([]map[string]string, len(n.config.Responders))
+		for i, responder := range n.config.Responders {
+			key := "name"
+			if responder.Type == "user" {
+				key = "username"
+			}
+			responders[i] = map[string]string{"type": responder.Type, key: responder.Name}
+		}
+		body["responders"] = responders
+	}
+
+	if err := n.post(ctx, "/v2/alerts", body); err != nil {
+		return fmt.Errorf("opsgenie create alert: %w", err)
+	}
+	return nil
+}
+
+// Resolve implements Resolver, closing the alert of an acknowledged
+// outlier whatever its severity, since a more severe outlier may have
+// opened it. An alert that is already closed, or was never opened, is left
+// alone.
+func (n *OpsgenieNotifier) Resolve(ctx context.Context, outlier models.Outlier) error {
+	path := "/v2/alerts/" + url.PathEscape(IncidentKey(outlier)) + "/close?identifierType=alias"
+	err := n.post(ctx, path, map[string]string{
+		"source": "StableRisk",
+		"note":   "Outlier " + outlier.ID + " acknowledged in StableRisk",
+	}, http.StatusNotFound)
+	if err != nil {
+		return fmt.Errorf("opsgenie close alert: %w", err)
+	}
+	return nil
+}
+
+// post sends a request to the Alert API. Opsgenie processes requests
+// asynchronously and accepts them with 202.
+func (n *OpsgenieNotifier) post(ctx context.Context, path string, body interface{}, alsoAccepted ...int) error {
+	headers := map[string]string{"Authorization": "GenieKey " + n.config.APIKey}
+	return postJSON(ctx, n.httpClient, n.config.APIURL+path, headers, body, append(alsoAccepted, http.StatusAccepted)...)
+}
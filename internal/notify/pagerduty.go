@@ -0,0 +1,159 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// PagerDutyConfig holds PagerDuty Events API v2 configuration
+type PagerDutyConfig struct {
+	EventsURL  string // Defaults to https://events.pagerduty.com/v2/enqueue
+	RoutingKey string // Integration key of the service paged
+	// RoutingKeys page other services, and so other escalation policies,
+	// for some severities
+	RoutingKeys  map[models.Severity]string
+	MinSeverity  models.Severity // Less severe alerts are ignored; defaults to critical
+	DashboardURL string          // Incidents link to the outlier on the dashboard at this URL
+	Timeout      time.Duration   // Per request; defaults to 10s
+}
+
+// PagerDutyNotifier triggers a PagerDuty incident for each incident key,
+// so repeat alerts about the same address add to the open incident rather
+// than paging again, and resolves it when an outlier is acknowledged
+type PagerDutyNotifier struct {
+	config     PagerDutyConfig
+	httpClient *http.Client
+	logger     *zap.Logger
+}
+
+// NewPagerDutyNotifier creates a PagerDuty notifier
+func NewPagerDutyNotifier(config PagerDutyConfig, logger *zap.Logger) *PagerDutyNotifier {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.EventsURL == "" {
+		config.EventsURL = "https://events.pagerduty.com/v2/enqueue"
+	}
+	if config.MinSeverity == "" {
+		config.MinSeverity = models.SeverityCritical
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	return &PagerDutyNotifier{
+		config:     config,
+		httpClient: &http.Client{Timeout: config.Timeout},
+		logger:     logger,
+	}
+}
+
+// Name implements Notifier
+func (n *PagerDutyNotifier) Name() string {
+	return "pagerduty"
+}
+
+// pagerDutySeverities maps outlier severities to PagerDuty's
+var pagerDutySeverities = map[models.Severity]string{
+	models.SeverityCritical: "critical",
+	models.SeverityHigh:     "error",
+	models.SeverityMedium:   "warning",
+	models.SeverityLow:      "info",
+}
+
+// Notify implements Notifier
+func (n *PagerDutyNotifier) Notify(ctx context.Context, alert Alert) error {
+	o := alert.Outlier
+	if o.Severity.RiskScore() < n.config.MinSeverity.RiskScore() {
+		return nil
+	}
+
+	details := map[string]interface{}{
+		"outlier_id": o.ID,
+		"rule":       alert.Rule,
+		"address":    o.Address,
+	}
+	if o.TransactionHash != "" {
+		details["transaction_hash"] = o.TransactionHash
+	}
+	if !o.Amount.IsZero() {
+		details["amount"] = o.Amount.String()
+	}
+	for name, value := range o.Details {
+		details[name] = value
+	}
+
+	event := map[string]interface{}{
+		"routing_key":  n.routingKey(o.Severity),
+		"event_action": "trigger",
+		"dedup_key":    IncidentKey(o),
+		"payload": map[string]interface{}{
+			"summary":        "StableRisk: " + summary(o),
+			"source":         "stablerisk",
+			"severity":       pagerDutySeverities[o.Severity],
+			"timestamp":      o.DetectedAt.UTC().Format(time.RFC3339),
+			"component":      string(o.Type),
+			"group":          o.OrgID,
+			"custom_details": details,
+		},
+		"client": "StableRisk",
+	}
+	if link := outlierLink(n.config.DashboardURL, o.ID); link != "" {
+		event["client_url"] = link
+		event["links"] = []map[string]string{{"href": link, "text": "View in StableRisk"}}
+	}
+
+	return n.send(ctx, event)
+}
+
+// Resolve implements Resolver, resolving the incident of an acknowledged
+// outlier. The incident may have been triggered by a more severe outlier
+// than this one, so the resolve goes to every routing key, whatever the
+// outlier's severity; PagerDuty ignores it where there is no such incident.
+func (n *PagerDutyNotifier) Resolve(ctx context.Context, outlier models.Outlier) error {
+	for _, routingKey := range n.routingKeys() {
+		err := n.send(ctx, map[string]interface{}{
+			"routing_key":  routingKey,
+			"event_action": "resolve",
+			"dedup_key":    IncidentKey(outlier),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// routingKey is the integration key paged for severity
+func (n *PagerDutyNotifier) routingKey(severity models.Severity) string {
+	if key, ok := n.config.RoutingKeys[severity]; ok {
+		return key
+	}
+	return n.config.RoutingKey
+}
+
+// routingKeys is every integration key an incident may have been
+// triggered with, in a stable order
+func (n *PagerDutyNotifier) routingKeys() []string {
+	keys := []string{n.config.RoutingKey}
+	for _, severity := range []models.Severity{models.SeverityCritical, models.SeverityHigh, models.SeverityMedium, models.SeverityLow} {
+		if key, ok := n.config.RoutingKeys[severity]; ok && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// send posts an event to the Events API
+func (n *PagerDutyNotifier) send(ctx context.Context, event map[string]interface{}) error {
+	if err := postJSON(ctx, n.httpClient, n.config.EventsURL, nil, event, http.StatusAccepted); err != nil {
+		return fmt.Errorf("pagerduty %s: %w", event["event_action"], err)
+	}
+	return nil
+}
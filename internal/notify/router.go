@@ -0,0 +1,329 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/internal/ratelimit"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// RetryPolicy controls how often a failed delivery is retried
+type RetryPolicy struct {
+	MaxRetries int           // Retries after the first attempt; 0 disables retrying
+	RetryDelay time.Duration // Delay before the first retry, doubled on each further retry
+}
+
+// RouterConfig holds alert routing configuration
+type RouterConfig struct {
+	Rules       []Rule
+	Retry       RetryPolicy
+	DedupWindow time.Duration  // Repeat alerts for the same outlier type and address within this are dropped; defaults to 15m
+	Throttle    ratelimit.Rule // Alerts allowed per channel; zero for no limit
+	QueueSize   int            // Alerts waiting per channel before new ones are dropped; defaults to 100
+}
+
+// Router delivers outliers matching its rules to their channels. Each
+// channel has its own queue and worker, so a slow or failing channel does
+// not hold up the others.
+type Router struct {
+	config    RouterConfig
+	channels  map[string]*channel
+	limiter   *ratelimit.MemoryLimiter
+	logger    *zap.Logger
+	watchlist Watchlist
+	incidents Incidents
+
+	mu     sync.Mutex
+	recent map[string]time.Time // Dedup key to when it was last alerted
+	swept  time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// channel is a notifier and its queue of work
+type channel struct {
+	notifier Notifier
+	queue    chan job
+}
+
+// job is an alert to deliver, or with resolve set an acknowledged outlier
+// whose alerts to close
+type job struct {
+	alert   Alert
+	resolve bool
+}
+
+// NewRouter creates a router delivering to notifiers. Every channel a rule
+// names must be one of the notifiers.
+func NewRouter(config RouterConfig, notifiers []Notifier, logger *zap.Logger) (*Router, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.DedupWindow <= 0 {
+		config.DedupWindow = 15 * time.Minute
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+
+	channels := make(map[string]*channel, len(notifiers))
+	for _, notifier := range notifiers {
+		if _, exists := channels[notifier.Name()]; exists {
+			return nil, fmt.Errorf("duplicate notification channel %q", notifier.Name())
+		}
+		channels[notifier.Name()] = &channel{
+			notifier: notifier,
+			queue:    make(chan job, config.QueueSize),
+		}
+	}
+
+	for _, rule := range config.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		for _, name := range rule.Channels {
+			if _, ok := channels[name]; !ok {
+				return nil, fmt.Errorf("rule %q: unknown channel %q", rule.Name, name)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Router{
+		config:   config,
+		channels: channels,
+		limiter:  ratelimit.NewMemoryLimiter(),
+		logger:   logger,
+		recent:   make(map[string]time.Time),
+		swept:    time.Now(),
+		ctx:      ctx,
+		cancel:   cancel,
+	}, nil
+}
+
+// SetWatchlist sets the watchlist Watchlisted rules check. Call it before
+// Start.
+func (r *Router) SetWatchlist(watchlist Watchlist) {
+	r.watchlist = watchlist
+}
+
+// SetIncidents sets where resolutions check for outliers still waiting in
+// an incident; without it, acknowledging any outlier closes its incident.
+// Call it before Start.
+func (r *Router) SetIncidents(incidents Incidents) {
+	r.incidents = incidents
+}
+
+// Start starts a delivery worker for each channel
+func (r *Router) Start() {
+	for _, ch := range r.channels {
+		r.wg.Add(1)
+		go r.run(ch)
+	}
+}
+
+// Stop stops the workers, abandoning alerts still queued, and waits for
+// deliveries in progress to give up
+func (r *Router) Stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// Route queues an alert on each channel of each rule outlier matches, once
+// per channel however many of its rules match. It never blocks: alerts for
+// a channel whose queue is full are dropped.
+func (r *Router) Route(outlier models.Outlier) {
+	queued := make(map[string]bool)
+	for _, rule := range r.config.Rules {
+		if !rule.Matches(outlier, r.watchlist) {
+			continue
+		}
+		for _, name := range rule.Channels {
+			if queued[name] {
+				continue
+			}
+			queued[name] = true
+			r.enqueue(r.channels[name], Alert{Rule: rule.Name, Outlier: outlier})
+		}
+	}
+}
+
+// enqueue queues alert on ch unless it repeats a recent alert or the
+// channel is over its rate
+func (r *Router) enqueue(ch *channel, alert Alert) {
+	name := ch.notifier.Name()
+	logger := r.logger.With(
+		zap.String("channel", name),
+		zap.String("rule", alert.Rule),
+		zap.String("outlier_id", alert.Outlier.ID))
+
+	if r.duplicate(name, alert.Outlier) {
+		metrics.Notifications.WithLabelValues(name, "duplicate").Inc()
+		logger.Debug("Duplicate alert dropped")
+		return
+	}
+
+	if allowed, _, _ := r.limiter.Allow(r.ctx, name, r.config.Throttle); !allowed {
+		metrics.Notifications.WithLabelValues(name, "throttled").Inc()
+		logger.Warn("Alert throttled")
+		return
+	}
+
+	select {
+	case ch.queue <- job{alert: alert}:
+	default:
+		metrics.Notifications.WithLabelValues(name, "dropped").Inc()
+		logger.Warn("Alert queue full, dropping alert")
+	}
+}
+
+// Resolve queues closing the alerts raised for an acknowledged outlier on
+// every channel that can close them, once no other outlier of its incident
+// is waiting to be acknowledged. Those channels then alert on the incident
+// again without waiting out the dedup window. Like Route, it never blocks.
+func (r *Router) Resolve(outlier models.Outlier) {
+	for name, ch := range r.channels {
+		if _, ok := ch.notifier.(Resolver); !ok {
+			continue
+		}
+
+		select {
+		case ch.queue <- job{alert: Alert{Outlier: outlier}, resolve: true}:
+		default:
+			metrics.Notifications.WithLabelValues(name, "dropped").Inc()
+			r.logger.Warn("Alert queue full, dropping resolution",
+				zap.String("channel", name),
+				zap.String("outlier_id", outlier.ID))
+		}
+	}
+}
+
+// duplicate reports whether outlier repeats an alert sent on the channel
+// within the dedup window, and records it if not. Alerts are the same when
+// they share an incident key.
+func (r *Router) duplicate(channelName string, outlier models.Outlier) bool {
+	key := channelName + "|" + IncidentKey(outlier)
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Forget expired keys now and then so the map does not grow forever
+	if now.Sub(r.swept) > r.config.DedupWindow {
+		for k, at := range r.recent {
+			if now.Sub(at) >= r.config.DedupWindow {
+				delete(r.recent, k)
+			}
+		}
+		r.swept = now
+	}
+
+	if at, ok := r.recent[key]; ok && now.Sub(at) < r.config.DedupWindow {
+		return true
+	}
+	r.recent[key] = now
+	return false
+}
+
+// run works through ch's queue until the router stops
+func (r *Router) run(ch *channel) {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case j := <-ch.queue:
+			if j.resolve {
+				r.resolve(ch.notifier.(Resolver), ch.notifier.Name(), j.alert.Outlier)
+			} else {
+				r.deliver(ch.notifier, j.alert)
+			}
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver sends alert through notifier, retrying failures under the retry
+// policy
+func (r *Router) deliver(notifier Notifier, alert Alert) {
+	err := retry(r.ctx, r.config.Retry, r.logger, func() error {
+		return notifier.Notify(r.ctx, alert)
+	})
+	if err != nil {
+		metrics.Notifications.WithLabelValues(notifier.Name(), "failed").Inc()
+		r.logger.Error("Failed to deliver alert",
+			zap.String("channel", notifier.Name()),
+			zap.String("rule", alert.Rule),
+			zap.String("outlier_id", alert.Outlier.ID),
+			zap.Error(err))
+		return
+	}
+	metrics.Notifications.WithLabelValues(notifier.Name(), "sent").Inc()
+}
+
+// resolve closes the alerts resolver raised for outlier unless its
+// incident is still open, retrying failures under the retry policy
+func (r *Router) resolve(resolver Resolver, name string, outlier models.Outlier) {
+	if r.incidents != nil {
+		open, err := r.incidents.IncidentOpen(r.ctx, outlier)
+		if err != nil {
+			metrics.Notifications.WithLabelValues(name, "failed").Inc()
+			r.logger.Error("Failed to check incident, leaving it open",
+				zap.String("channel", name),
+				zap.String("outlier_id", outlier.ID),
+				zap.Error(err))
+			return
+		}
+		if open {
+			r.logger.Debug("Incident has unacknowledged outliers, leaving it open",
+				zap.String("channel", name),
+				zap.String("outlier_id", outlier.ID))
+			return
+		}
+	}
+
+	r.mu.Lock()
+	delete(r.recent, name+"|"+IncidentKey(outlier))
+	r.mu.Unlock()
+
+	err := retry(r.ctx, r.config.Retry, r.logger, func() error {
+		return resolver.Resolve(r.ctx, outlier)
+	})
+	if err != nil {
+		metrics.Notifications.WithLabelValues(name, "failed").Inc()
+		r.logger.Error("Failed to resolve alert",
+			zap.String("channel", name),
+			zap.String("outlier_id", outlier.ID),
+			zap.Error(err))
+		return
+	}
+	metrics.Notifications.WithLabelValues(name, "resolved").Inc()
+}
+
+// retry runs fn, retrying failures with exponential backoff under policy
+func retry(ctx context.Context, policy RetryPolicy, logger *zap.Logger, fn func() error) error {
+	if policy.MaxRetries <= 0 {
+		return fn()
+	}
+
+	delay := policy.RetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+
+	return blockchain.RetryWithBackoff(ctx, blockchain.RetryConfig{
+		InitialDelay: delay,
+		MaxDelay:     30 * time.Second,
+		MaxRetries:   policy.MaxRetries,
+		Multiplier:   2.0,
+		Jitter:       true,
+	}, logger, fn)
+}
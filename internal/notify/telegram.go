@@ -0,0 +1,230 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/internal/ratelimit"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// TelegramConfig holds Telegram Bot API configuration
+type TelegramConfig struct {
+	APIURL   string // Defaults to https://api.telegram.org
+	BotToken string
+	Chats    []TelegramChat
+	// ChatRate limits messages to each chat; defaults to 20 a minute in
+	// bursts of 3, Telegram's limit for groups
+	ChatRate ratelimit.Rule
+	// Rate limits messages across every chat; defaults to 1200 a minute in
+	// bursts of 30, under Telegram's limit for a bot
+	Rate         ratelimit.Rule
+	DashboardURL string        // Alerts link to the outlier on the dashboard at this URL
+	Timeout      time.Duration // Per request; defaults to 10s
+}
+
+// TelegramChat is a chat, group or channel alerts are sent to
+type TelegramChat struct {
+	ID          string          // Numeric chat ID, or @username for public channels
+	MinSeverity models.Severity // Less severe alerts are not sent to this chat; empty sends all
+}
+
+// TelegramNotifier sends alerts through a Telegram bot. Messages over a
+// chat's rate or the bot's are dropped rather than risk the bot being
+// banned during an alert storm, and when Telegram asks the bot to slow
+// down nothing is sent until it may resume.
+type TelegramNotifier struct {
+	config     TelegramConfig
+	httpClient *http.Client
+	limiter    *ratelimit.MemoryLimiter
+	logger     *zap.Logger
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+// NewTelegramNotifier creates a Telegram notifier
+func NewTelegramNotifier(config TelegramConfig, logger *zap.Logger) *TelegramNotifier {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.APIURL == "" {
+		config.APIURL = "https://api.telegram.org"
+	}
+	config.APIURL = strings.TrimRight(config.APIURL, "/")
+	if !config.ChatRate.Enabled() {
+		config.ChatRate = ratelimit.Rule{PerMinute: 20, Burst: 3}
+	}
+	if !config.Rate.Enabled() {
+		config.Rate = ratelimit.Rule{PerMinute: 1200, Burst: 30}
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	return &TelegramNotifier{
+		config:     config,
+		httpClient: &http.Client{Timeout: config.Timeout},
+		limiter:    ratelimit.NewMemoryLimiter(),
+		logger:     logger,
+	}
+}
+
+// Name implements Notifier
+func (n *TelegramNotifier) Name() string {
+	return "telegram"
+}
+
+// Notify implements Notifier, sending the alert to every chat whose
+// minimum severity it meets. A retry after some chats failed may repeat
+// the alert in the others.
+func (n *TelegramNotifier) Notify(ctx context.Context, alert Alert) error {
+	if wait := n.paused(); wait > 0 {
+		return fmt.Errorf("telegram asked the bot to wait %s", wait.Round(time.Second))
+	}
+
+	text := n.render(alert)
+	var errs []error
+	for _, chat := range n.config.Chats {
+		if alert.Outlier.Severity.RiskScore() < chat.MinSeverity.RiskScore() {
+			continue
+		}
+		if !n.allow(ctx, chat.ID) {
+			metrics.Notifications.WithLabelValues(n.Name(), "throttled").Inc()
+			n.logger.Warn("Telegram rate reached, dropping alert",
+				zap.String("chat_id", chat.ID),
+				zap.String("outlier_id", alert.Outlier.ID))
+			continue
+		}
+		if err := n.send(ctx, chat.ID, text); err != nil {
+			errs = append(errs, fmt.Errorf("chat %s: %w", chat.ID, err))
+			if n.paused() > 0 {
+				break
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("telegram send message: %w", err)
+	}
+	return nil
+}
+
+// allow takes a message from chatID's allowance and the bot's
+func (n *TelegramNotifier) allow(ctx context.Context, chatID string) bool {
+	if allowed, _, _ := n.limiter.Allow(ctx, "chat:"+chatID, n.config.ChatRate); !allowed {
+		return false
+	}
+	allowed, _, _ := n.limiter.Allow(ctx, "bot", n.config.Rate)
+	return allowed
+}
+
+// paused returns how much longer Telegram asked the bot to wait
+func (n *TelegramNotifier) paused() time.Duration {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return time.Until(n.pausedUntil)
+}
+
+// render formats an alert as a Telegram HTML message
+func (n *TelegramNotifier) render(alert Alert) string {
+	o := alert.Outlier
+	var text strings.Builder
+	fmt.Fprintf(&text, "<b>%s</b>\n", html.EscapeString(summary(o)))
+	fmt.Fprintf(&text, "Detected: %s\n", o.DetectedAt.UTC().Format(time.RFC1123))
+	if alert.Rule != "" {
+		fmt.Fprintf(&text, "Rule: %s\n", html.EscapeString(alert.Rule))
+	}
+	if o.TransactionHash != "" {
+		fmt.Fprintf(&text, "Transaction: <code>%s</code>\n", html.EscapeString(o.TransactionHash))
+	}
+	if !o.Amount.IsZero() {
+		fmt.Fprintf(&text, "Amount: %s\n", o.Amount.String())
+	}
+
+	names := make([]string, 0, len(o.Details))
+	for name := range o.Details {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&text, "%s: %s\n", html.EscapeString(name), html.EscapeString(fmt.Sprint(o.Details[name])))
+	}
+
+	if link := outlierLink(n.config.DashboardURL, o.ID); link != "" {
+		fmt.Fprintf(&text, "\n<a href=\"%s\">View in StableRisk</a>", html.EscapeString(link))
+	}
+	return strings.TrimRight(text.String(), "\n")
+}
+
+// telegramResponse is the Bot API's reply
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// send posts a message to a chat. When Telegram answers 429 the bot is
+// paused for as long as it asks.
+func (n *TelegramNotifier) send(ctx context.Context, chatID, text string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"chat_id":                  chatID,
+		"text":                     text,
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// The token is part of the path, so it is kept out of errors
+	req, err := http.NewRequestWithContext(ctx, "POST", n.config.APIURL+"/bot"+n.config.BotToken+"/sendMessage", bytes.NewReader(body))
+	if err != nil {
+		return errors.New("failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var reply telegramResponse
+	json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&reply)
+	if resp.StatusCode == http.StatusOK && reply.OK {
+		return nil
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		wait := time.Duration(reply.Parameters.RetryAfter) * time.Second
+		if wait <= 0 {
+			wait = time.Minute
+		}
+		n.mu.Lock()
+		if until := time.Now().Add(wait); until.After(n.pausedUntil) {
+			n.pausedUntil = until
+		}
+		n.mu.Unlock()
+		n.logger.Warn("Telegram rate limited the bot", zap.Duration("retry_after", wait))
+	}
+	return fmt.Errorf("status %d: %s", resp.StatusCode, reply.Description)
+}
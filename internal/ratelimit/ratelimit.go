@@ -0,0 +1,117 @@
+// Package ratelimit provides token-bucket rate limiters, held in memory for
+// a single instance or in Redis to share limits across instances.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Rule is a token-bucket limit: PerMinute requests on average, up to Burst
+// at once
+type Rule struct {
+	PerMinute int // 0 disables the rule
+	Burst     int // Defaults to PerMinute
+}
+
+// Enabled reports whether the rule limits anything
+func (r Rule) Enabled() bool {
+	return r.PerMinute > 0
+}
+
+// rate returns the refill rate in tokens per second
+func (r Rule) rate() float64 {
+	return float64(r.PerMinute) / 60
+}
+
+// capacity returns the bucket size
+func (r Rule) capacity() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return float64(r.PerMinute)
+}
+
+// Limiter takes a token from the bucket for key under rule. If the bucket
+// is empty the request is refused, and retryAfter says when a token will
+// be available.
+type Limiter interface {
+	Allow(ctx context.Context, key string, rule Rule) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// sweepInterval is how often the memory limiter drops idle buckets
+const sweepInterval = time.Minute
+
+// bucket is a token bucket held in memory
+type bucket struct {
+	tokens   float64
+	updated  time.Time
+	capacity float64
+	rate     float64
+}
+
+// refill adds the tokens earned since the bucket was last updated
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.updated).Seconds()*b.rate)
+	b.updated = now
+}
+
+// MemoryLimiter keeps buckets in memory, so limits apply per instance. It
+// is safe for concurrent use.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// NewMemoryLimiter creates an in-memory limiter
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: make(map[string]*bucket),
+		swept:   time.Now(),
+	}
+}
+
+// Allow takes a token from key's bucket
+func (l *MemoryLimiter) Allow(_ context.Context, key string, rule Rule) (bool, time.Duration, error) {
+	if !rule.Enabled() {
+		return true, 0, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.swept) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: rule.capacity(), updated: now}
+		l.buckets[key] = b
+	}
+	// Rules may change with configuration, so each call sets them
+	b.capacity = rule.capacity()
+	b.rate = rule.rate()
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second)), nil
+}
+
+// sweep drops buckets that have refilled, since a new bucket starts full
+func (l *MemoryLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= b.capacity {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
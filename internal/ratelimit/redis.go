@@ -0,0 +1,307 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenBucketScript takes a token from the bucket at KEYS[1], refilling at
+// ARGV[1] tokens per second up to ARGV[2]. It returns whether a token was
+// taken and, if not, the seconds until one is available. Redis's clock is
+// used so every instance agrees on the time.
+const tokenBucketScript = `
+local rate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) + tonumber(clock[2]) / 1000000
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or capacity
+local updated = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = (1 - tokens) / rate
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate * 1000) + 1000)
+return {allowed, tostring(wait)}
+`
+
+// tokenBucketSHA identifies the script for EVALSHA
+var tokenBucketSHA = func() string {
+	sum := sha1.Sum([]byte(tokenBucketScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// RedisConfig holds configuration for a Redis limiter
+type RedisConfig struct {
+	URL      string        // redis://[user:password@]host:port[/db], or rediss:// for TLS
+	Prefix   string        // Prepended to bucket keys; defaults to "stablerisk:ratelimit:"
+	Timeout  time.Duration // Per-call timeout, including connecting; defaults to 1 second
+	PoolSize int           // Idle connections kept; defaults to 10
+}
+
+// RedisLimiter keeps buckets in Redis, so limits are shared by every
+// instance using the same Redis. It speaks the Redis protocol directly and
+// is safe for concurrent use.
+type RedisLimiter struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      *tls.Config
+	prefix   string
+	timeout  time.Duration
+	idle     chan *redisConn
+}
+
+// NewRedisLimiter creates a Redis limiter. Connections are made on demand.
+func NewRedisLimiter(config RedisConfig) (*RedisLimiter, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("redis URL must use redis:// or rediss://, got %q", u.Scheme)
+	}
+	if config.Prefix == "" {
+		config.Prefix = "stablerisk:ratelimit:"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second
+	}
+	if config.PoolSize <= 0 {
+		config.PoolSize = 10
+	}
+
+	l := &RedisLimiter{
+		addr:    u.Host,
+		prefix:  config.Prefix,
+		timeout: config.Timeout,
+		idle:    make(chan *redisConn, config.PoolSize),
+	}
+	if u.Port() == "" {
+		l.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		l.password, _ = u.User.Password()
+		if l.password == "" {
+			// redis://password@host is a common shorthand
+			l.password = u.User.Username()
+		} else {
+			l.username = u.User.Username()
+		}
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if l.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+	}
+	if u.Scheme == "rediss" {
+		l.tls = &tls.Config{MinVersion: tls.VersionTLS12, ServerName: u.Hostname()}
+	}
+
+	return l, nil
+}
+
+// Allow takes a token from key's bucket
+func (l *RedisLimiter) Allow(ctx context.Context, key string, rule Rule) (bool, time.Duration, error) {
+	if !rule.Enabled() {
+		return true, 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	rate := strconv.FormatFloat(rule.rate(), 'f', -1, 64)
+	capacity := strconv.FormatFloat(rule.capacity(), 'f', -1, 64)
+	reply, err := l.do(ctx, "EVALSHA", tokenBucketSHA, "1", l.prefix+key, rate, capacity)
+	var redisErr redisError
+	if errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), "NOSCRIPT") {
+		// EVAL also caches the script for later EVALSHA calls
+		reply, err = l.do(ctx, "EVAL", tokenBucketScript, "1", l.prefix+key, rate, capacity)
+	}
+	if err != nil {
+		return false, 0, err
+	}
+
+	result, ok := reply.([]interface{})
+	if !ok || len(result) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+	allowed, _ := result[0].(int64)
+	wait, _ := result[1].(string)
+	seconds, err := strconv.ParseFloat(wait, 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("unexpected rate limit wait %q", wait)
+	}
+	return allowed == 1, time.Duration(seconds * float64(time.Second)), nil
+}
+
+// Close closes idle connections
+func (l *RedisLimiter) Close() error {
+	for {
+		select {
+		case conn := <-l.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends a command on a pooled connection and returns its reply.
+// Connections that fail are closed rather than returned to the pool.
+func (l *RedisLimiter) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := l.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.do(ctx, args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		conn.Close()
+		return nil, err
+	}
+
+	select {
+	case l.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+// get returns an idle connection, or a new one
+func (l *RedisLimiter) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-l.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := &net.Dialer{}
+	raw, err := dialer.DialContext(ctx, "tcp", l.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	if l.tls != nil {
+		tlsConn := tls.Client(raw, l.tls)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			raw.Close()
+			return nil, fmt.Errorf("redis TLS handshake failed: %w", err)
+		}
+		raw = tlsConn
+	}
+
+	conn := &redisConn{Conn: raw, reader: bufio.NewReader(raw)}
+	if l.password != "" {
+		args := []string{"AUTH", l.password}
+		if l.username != "" {
+			args = []string{"AUTH", l.username, l.password}
+		}
+		if _, err := conn.do(ctx, args...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis authentication failed: %w", err)
+		}
+	}
+	if l.db != 0 {
+		if _, err := conn.do(ctx, "SELECT", strconv.Itoa(l.db)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to select redis database: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// redisError is an error reply from Redis. The connection remains usable.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisConn is a connection speaking RESP
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// do writes a command and reads its reply
+func (c *redisConn) do(ctx context.Context, args ...string) (interface{}, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.Conn, b.String()); err != nil {
+		return nil, fmt.Errorf("failed to write to redis: %w", err)
+	}
+
+	return c.read()
+}
+
+// read reads one reply: a string, int64, nil, []interface{} or redisError
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from redis: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, fmt.Errorf("failed to read from redis: %w", err)
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected redis reply %q", line)
+	}
+}
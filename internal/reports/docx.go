@@ -0,0 +1,133 @@
+package reports
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// A4 text width in twentieths of a point, inside 1 inch margins
+const docxTextWidth = 11906 - 2*1440
+
+// docxDocument builds a Word document from paragraphs and tables in the
+// default styles, enough for report drafts without a DOCX library
+type docxDocument struct {
+	body bytes.Buffer // Children of w:body
+}
+
+// title writes the document's title
+func (d *docxDocument) title(text string) {
+	d.run(text, 36, true)
+}
+
+// heading implements documentWriter
+func (d *docxDocument) heading(text string) {
+	d.run(text, 26, true)
+}
+
+// paragraph implements documentWriter
+func (d *docxDocument) paragraph(text string) {
+	d.run(text, 0, false)
+}
+
+// run writes a paragraph of one run of text in half-points size, or the
+// default size when 0
+func (d *docxDocument) run(text string, size int, bold bool) {
+	d.body.WriteString("<w:p><w:r>")
+	if size > 0 || bold {
+		d.body.WriteString("<w:rPr>")
+		if bold {
+			d.body.WriteString("<w:b/>")
+		}
+		if size > 0 {
+			fmt.Fprintf(&d.body, `<w:sz w:val="%d"/>`, size)
+		}
+		d.body.WriteString("</w:rPr>")
+	}
+	fmt.Fprintf(&d.body, `<w:t xml:space="preserve">%s</w:t></w:r></w:p>`, xmlEscape(text))
+}
+
+// table implements documentWriter
+func (d *docxDocument) table(widths []float64, header []string, rows [][]string) {
+	twips := make([]int, len(widths))
+	for i, width := range widths {
+		twips[i] = int(width * docxTextWidth)
+	}
+
+	d.body.WriteString(`<w:tbl><w:tblPr><w:tblW w:w="0" w:type="auto"/><w:tblBorders>`)
+	for _, side := range []string{"top", "left", "bottom", "right", "insideH", "insideV"} {
+		fmt.Fprintf(&d.body, `<w:%s w:val="single" w:sz="4" w:space="0" w:color="999999"/>`, side)
+	}
+	d.body.WriteString(`</w:tblBorders></w:tblPr><w:tblGrid>`)
+	for _, width := range twips {
+		fmt.Fprintf(&d.body, `<w:gridCol w:w="%d"/>`, width)
+	}
+	d.body.WriteString(`</w:tblGrid>`)
+
+	row := func(cells []string, bold bool) {
+		d.body.WriteString("<w:tr>")
+		for i, cell := range cells {
+			fmt.Fprintf(&d.body, `<w:tc><w:tcPr><w:tcW w:w="%d" w:type="dxa"/></w:tcPr><w:p><w:r><w:rPr>`, twips[i])
+			if bold {
+				d.body.WriteString("<w:b/>")
+			}
+			fmt.Fprintf(&d.body, `<w:sz w:val="16"/></w:rPr><w:t xml:space="preserve">%s</w:t></w:r></w:p></w:tc>`, xmlEscape(cell))
+		}
+		d.body.WriteString("</w:tr>")
+	}
+	row(header, true)
+	for _, cells := range rows {
+		row(cells, false)
+	}
+	d.body.WriteString("</w:tbl>")
+
+	// Word needs a paragraph between consecutive tables
+	d.body.WriteString("<w:p/>")
+}
+
+// docxContentTypes and docxRelationships are the package parts every
+// document needs
+const (
+	docxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/></Types>`
+	docxRelationships = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/></Relationships>`
+)
+
+// bytes returns the document as a DOCX file
+func (d *docxDocument) bytes() ([]byte, error) {
+	var document strings.Builder
+	document.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>`)
+	document.Write(d.body.Bytes())
+	document.WriteString(`<w:sectPr><w:pgSz w:w="11906" w:h="16838"/><w:pgMar w:top="1440" w:right="1440" w:bottom="1440" w:left="1440" w:header="720" w:footer="720" w:gutter="0"/></w:sectPr></w:body></w:document>`)
+
+	var out bytes.Buffer
+	archive := zip.NewWriter(&out)
+	for _, part := range []struct{ name, content string }{
+		{"[Content_Types].xml", docxContentTypes},
+		{"_rels/.rels", docxRelationships},
+		{"word/document.xml", document.String()},
+	} {
+		w, err := archive.Create(part.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", part.name, err)
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", part.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write document: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// xmlEscape makes s safe as XML character data
+func xmlEscape(s string) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(s))
+	return escaped.String()
+}
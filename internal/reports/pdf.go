@@ -0,0 +1,169 @@
+package reports
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page size and margins, in points
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	margin     = 50.0
+)
+
+// pdfDocument lays out lines of text on A4 pages in the standard Helvetica
+// fonts, which PDF readers provide, so reports need no fonts or PDF
+// library. Text outside printable ASCII is replaced with '?'.
+type pdfDocument struct {
+	pages []*bytes.Buffer // Content stream of each page
+	y     float64         // Baseline of the next line on the last page
+}
+
+// newPDFDocument creates a document with one empty page
+func newPDFDocument() *pdfDocument {
+	d := &pdfDocument{}
+	d.newPage()
+	return d
+}
+
+// newPage starts a page at the top margin
+func (d *pdfDocument) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pageHeight - margin
+}
+
+// space moves the next line down by height points
+func (d *pdfDocument) space(height float64) {
+	d.y -= height
+}
+
+// text writes a line at the left margin
+func (d *pdfDocument) text(s string, size float64, bold bool) {
+	d.row([]string{s}, []float64{pageWidth - 2*margin}, size, bold)
+}
+
+// row writes a line of columns with the given widths, truncating text
+// that would overflow its column, on a new page when the current one is full
+func (d *pdfDocument) row(columns []string, widths []float64, size float64, bold bool) {
+	lineHeight := size * 1.4
+	if d.y-lineHeight < margin {
+		d.newPage()
+	}
+	d.y -= lineHeight
+
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	page := d.pages[len(d.pages)-1]
+	x := margin
+	for i, column := range columns {
+		// Helvetica averages about half the font size per character
+		column = truncate(printable(column), int(widths[i]/(size*0.5)))
+		fmt.Fprintf(page, "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", font, size, x, d.y, pdfEscape(column))
+		x += widths[i]
+	}
+}
+
+// heading implements documentWriter
+func (d *pdfDocument) heading(text string) {
+	d.space(10)
+	d.text(text, 13, true)
+}
+
+// paragraph implements documentWriter, wrapping text at word boundaries
+func (d *pdfDocument) paragraph(text string) {
+	const size = 10
+	width := int((pageWidth - 2*margin) / (size * 0.5))
+	var line string
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(line)+1+len(word) > width {
+			d.text(line, size, false)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		d.text(line, size, false)
+	}
+	d.space(4)
+}
+
+// table implements documentWriter
+func (d *pdfDocument) table(widths []float64, header []string, rows [][]string) {
+	points := make([]float64, len(widths))
+	for i, width := range widths {
+		points[i] = width * (pageWidth - 2*margin)
+	}
+	d.row(header, points, 8, true)
+	for _, row := range rows {
+		d.row(row, points, 8, false)
+	}
+}
+
+// bytes returns the document as a PDF file
+func (d *pdfDocument) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	// Objects 1-4 are the catalog, page tree and fonts; each page is then
+	// a page object followed by its content stream
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// truncate shortens s to at most n characters, marking the cut with "..."
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	if n <= 3 {
+		return s[:n]
+	}
+	return s[:n-3] + "..."
+}
+
+// printable replaces characters outside printable ASCII with '?'
+func printable(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// pdfEscape makes s safe inside a PDF string literal
+func pdfEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s)
+}
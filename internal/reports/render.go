@@ -0,0 +1,187 @@
+package reports
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+)
+
+// documentWriter lays out a report as headings, paragraphs and tables, so
+// one layout serves every format
+type documentWriter interface {
+	heading(text string)
+	paragraph(text string)
+	// table writes a table whose column widths are fractions of the page
+	// width
+	table(widths []float64, header []string, rows [][]string)
+}
+
+// Subject is the email subject for a report
+func (r *DailyReport) Subject() string {
+	return fmt.Sprintf("[StableRisk] Daily report for %s: %d outliers, %d unacknowledged",
+		r.Date, r.TotalOutliers, r.Backlog.Unacknowledged)
+}
+
+// count is a labelled number in a report table
+type count struct {
+	Label string
+	Count int
+}
+
+// severityCounts lists counts by severity, most severe first
+func severityCounts(bySeverity map[models.Severity]int) []count {
+	counts := make([]count, len(severities))
+	for i, severity := range severities {
+		counts[i] = count{Label: string(severity), Count: bySeverity[severity]}
+	}
+	return counts
+}
+
+// typeCounts lists counts by outlier type, most frequent first
+func typeCounts(byType map[models.OutlierType]int) []count {
+	counts := make([]count, 0, len(byType))
+	for outlierType, n := range byType {
+		counts = append(counts, count{Label: string(outlierType), Count: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Label < counts[j].Label
+	})
+	return counts
+}
+
+// oldest formats the backlog's oldest detection, or "-" without one
+func (b Backlog) oldest() string {
+	if b.OldestDetected == nil {
+		return "-"
+	}
+	return b.OldestDetected.Format(time.RFC1123)
+}
+
+// reportTemplate renders a daily report as an HTML email
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<h2>StableRisk daily report for {{.Report.Date}}</h2>
+<p>{{.Report.TotalOutliers}} outliers detected between {{.From}} and {{.To}} UTC.</p>
+
+<h3>By severity</h3>
+<table style="border-collapse: collapse;">
+{{range .Severities}}<tr><td style="padding-right: 16px;">{{.Label}}</td><td style="text-align: right;">{{.Count}}</td></tr>
+{{end}}</table>
+
+<h3>By type</h3>
+{{if .Types}}<table style="border-collapse: collapse;">
+{{range .Types}}<tr><td style="padding-right: 16px;">{{.Label}}</td><td style="text-align: right;">{{.Count}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+
+<h3>Top addresses</h3>
+{{if .Report.TopAddresses}}<table style="border-collapse: collapse;">
+<tr><th style="text-align: left; padding-right: 16px;">Address</th><th style="text-align: right; padding-right: 16px;">Outliers</th><th style="text-align: left;">Highest severity</th></tr>
+{{range .Report.TopAddresses}}<tr><td style="padding-right: 16px;"><code>{{.Address}}</code></td><td style="text-align: right; padding-right: 16px;">{{.Outliers}}</td><td>{{.HighestSeverity}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+
+<h3>Largest transfers</h3>
+{{if .Report.LargestTransfers}}<table style="border-collapse: collapse;">
+<tr><th style="text-align: right; padding-right: 16px;">Amount</th><th style="text-align: left; padding-right: 16px;">Transaction</th><th style="text-align: left; padding-right: 16px;">Address</th><th style="text-align: left;">Outlier</th></tr>
+{{range .Report.LargestTransfers}}<tr><td style="text-align: right; padding-right: 16px;">{{.Amount}}</td><td style="padding-right: 16px;"><code>{{.TransactionHash}}</code></td><td style="padding-right: 16px;"><code>{{.Address}}</code></td><td>{{.Severity}} {{.Type}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+
+<h3>Unacknowledged backlog</h3>
+<p>{{.Report.Backlog.Unacknowledged}} outliers waiting to be acknowledged; the oldest was detected {{.Oldest}}.</p>
+<table style="border-collapse: collapse;">
+{{range .Backlog}}<tr><td style="padding-right: 16px;">{{.Label}}</td><td style="text-align: right;">{{.Count}}</td></tr>
+{{end}}</table>
+{{if .DashboardURL}}<p><a href="{{.DashboardURL}}">Open StableRisk</a></p>{{end}}
+</body>
+</html>
+`))
+
+// RenderHTML renders the report as an HTML page, linking to the dashboard
+// at dashboardURL when set
+func (r *DailyReport) RenderHTML(dashboardURL string) ([]byte, error) {
+	var body bytes.Buffer
+	err := reportTemplate.Execute(&body, struct {
+		Report       *DailyReport
+		From, To     string
+		Severities   []count
+		Types        []count
+		Backlog      []count
+		Oldest       string
+		DashboardURL string
+	}{
+		Report:       r,
+		From:         r.From.Format("2006-01-02 15:04"),
+		To:           r.To.Format("2006-01-02 15:04"),
+		Severities:   severityCounts(r.BySeverity),
+		Types:        typeCounts(r.ByType),
+		Backlog:      severityCounts(r.Backlog.BySeverity),
+		Oldest:       r.Backlog.oldest(),
+		DashboardURL: dashboardURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render report: %w", err)
+	}
+	return body.Bytes(), nil
+}
+
+// RenderPDF renders the report as a PDF document
+func (r *DailyReport) RenderPDF() []byte {
+	doc := newPDFDocument()
+	doc.text("StableRisk daily report for "+r.Date, 18, true)
+	doc.text(fmt.Sprintf("%d outliers detected between %s and %s UTC. Generated %s.",
+		r.TotalOutliers, r.From.Format("2006-01-02 15:04"), r.To.Format("2006-01-02 15:04"),
+		r.GeneratedAt.Format(time.RFC1123)), 9, false)
+
+	counts := func(title string, counts []count) {
+		doc.space(12)
+		doc.text(title, 13, true)
+		if len(counts) == 0 {
+			doc.text("None.", 10, false)
+		}
+		for _, c := range counts {
+			doc.row([]string{c.Label, strconv.Itoa(c.Count)}, []float64{200, 100}, 10, false)
+		}
+	}
+	counts("By severity", severityCounts(r.BySeverity))
+	counts("By type", typeCounts(r.ByType))
+
+	doc.space(12)
+	doc.text("Top addresses", 13, true)
+	if len(r.TopAddresses) == 0 {
+		doc.text("None.", 10, false)
+	} else {
+		widths := []float64{260, 80, 100}
+		doc.row([]string{"Address", "Outliers", "Highest severity"}, widths, 9, true)
+		for _, a := range r.TopAddresses {
+			doc.row([]string{a.Address, strconv.Itoa(a.Outliers), string(a.HighestSeverity)}, widths, 9, false)
+		}
+	}
+
+	doc.space(12)
+	doc.text("Largest transfers", 13, true)
+	if len(r.LargestTransfers) == 0 {
+		doc.text("None.", 10, false)
+	} else {
+		widths := []float64{90, 170, 150, 85}
+		doc.row([]string{"Amount", "Transaction", "Address", "Outlier"}, widths, 8, true)
+		for _, t := range r.LargestTransfers {
+			doc.row([]string{t.Amount.String(), t.TransactionHash, t.Address,
+				strings.TrimSpace(string(t.Severity) + " " + string(t.Type))}, widths, 8, false)
+		}
+	}
+
+	counts("Unacknowledged backlog", severityCounts(r.Backlog.BySeverity))
+	doc.text(fmt.Sprintf("%d outliers waiting to be acknowledged; the oldest was detected %s.",
+		r.Backlog.Unacknowledged, r.Backlog.oldest()), 10, false)
+
+	return doc.bytes()
+}
@@ -0,0 +1,286 @@
+package reports
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// DateLayout is how report dates are written, in UTC
+const DateLayout = "2006-01-02"
+
+// severities lists severities from most to least severe, the order reports
+// show them in
+var severities = []models.Severity{
+	models.SeverityCritical,
+	models.SeverityHigh,
+	models.SeverityMedium,
+	models.SeverityLow,
+}
+
+// DailyReport summarises one UTC day's outliers for an organization
+type DailyReport struct {
+	OrgID            string                     `json:"org_id"`
+	Date             string                     `json:"date"` // YYYY-MM-DD
+	From             time.Time                  `json:"from"`
+	To               time.Time                  `json:"to"`
+	GeneratedAt      time.Time                  `json:"generated_at"`
+	TotalOutliers    int                        `json:"total_outliers"`
+	BySeverity       map[models.Severity]int    `json:"by_severity"`
+	ByType           map[models.OutlierType]int `json:"by_type"`
+	TopAddresses     []AddressSummary           `json:"top_addresses"`
+	LargestTransfers []Transfer                 `json:"largest_transfers"`
+	Backlog          Backlog                    `json:"backlog"`
+}
+
+// AddressSummary is an address flagged during the day
+type AddressSummary struct {
+	Address         string          `json:"address"`
+	Outliers        int             `json:"outliers"`
+	HighestSeverity models.Severity `json:"highest_severity"`
+}
+
+// Transfer is one of the day's largest flagged transfers
+type Transfer struct {
+	OutlierID       string             `json:"outlier_id"`
+	TransactionHash string             `json:"transaction_hash"`
+	Address         string             `json:"address"`
+	Amount          decimal.Decimal    `json:"amount"`
+	Type            models.OutlierType `json:"type"`
+	Severity        models.Severity    `json:"severity"`
+	DetectedAt      time.Time          `json:"detected_at"`
+}
+
+// Backlog is the outliers detected by the end of the day that were still
+// unacknowledged when the report was generated. Invalidated outliers are
+// left out.
+type Backlog struct {
+	Unacknowledged int                     `json:"unacknowledged"`
+	BySeverity     map[models.Severity]int `json:"by_severity"`
+	OldestDetected *time.Time              `json:"oldest_detected_at,omitempty"`
+}
+
+// Generator compiles reports from the outliers table
+type Generator struct {
+	db     *sql.DB
+	top    int
+	logger *zap.Logger
+}
+
+// NewGenerator creates a report generator listing the top 10 addresses and
+// transfers
+func NewGenerator(db *sql.DB, logger *zap.Logger) *Generator {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &Generator{
+		db:     db,
+		top:    10,
+		logger: logger,
+	}
+}
+
+// Day returns the UTC day containing t as its date and bounds
+func Day(t time.Time) (string, time.Time, time.Time) {
+	t = t.UTC()
+	from := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return from.Format(DateLayout), from, from.AddDate(0, 0, 1)
+}
+
+// Daily compiles orgID's report for the UTC day containing date, over its
+// watchlist hits and the shared detections. Invalidated outliers are not
+// counted.
+func (g *Generator) Daily(ctx context.Context, orgID string, date time.Time) (*DailyReport, error) {
+	day, from, to := Day(date)
+	report := &DailyReport{
+		OrgID:            orgID,
+		Date:             day,
+		From:             from,
+		To:               to,
+		GeneratedAt:      time.Now().UTC(),
+		BySeverity:       make(map[models.Severity]int),
+		ByType:           make(map[models.OutlierType]int),
+		TopAddresses:     []AddressSummary{},
+		LargestTransfers: []Transfer{},
+		Backlog:          Backlog{BySeverity: make(map[models.Severity]int)},
+	}
+
+	if err := g.counts(ctx, report); err != nil {
+		return nil, err
+	}
+	if err := g.largestTransfers(ctx, report); err != nil {
+		return nil, err
+	}
+	if err := g.backlog(ctx, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// counts fills in the day's totals and its most flagged addresses
+func (g *Generator) counts(ctx context.Context, report *DailyReport) error {
+	rows, err := g.db.QueryContext(ctx, `
+		SELECT address, severity, type, COUNT(*)
+		FROM outliers
+		WHERE (org_id = $1 OR org_id IS NULL)
+		  AND detected_at >= $2
+		  AND detected_at < $3
+		  AND invalidated = false
+		GROUP BY address, severity, type
+	`, report.OrgID, report.From, report.To)
+	if err != nil {
+		return fmt.Errorf("failed to count outliers: %w", err)
+	}
+	defer rows.Close()
+
+	addresses := make(map[string]*AddressSummary)
+	for rows.Next() {
+		var address string
+		var severity models.Severity
+		var outlierType models.OutlierType
+		var count int
+		if err := rows.Scan(&address, &severity, &outlierType, &count); err != nil {
+			return fmt.Errorf("failed to scan outlier counts: %w", err)
+		}
+
+		report.TotalOutliers += count
+		report.BySeverity[severity] += count
+		report.ByType[outlierType] += count
+
+		if address == "" {
+			continue
+		}
+		summary, ok := addresses[address]
+		if !ok {
+			summary = &AddressSummary{Address: address}
+			addresses[address] = summary
+		}
+		summary.Outliers += count
+		if severity.RiskScore() > summary.HighestSeverity.RiskScore() {
+			summary.HighestSeverity = severity
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to count outliers: %w", err)
+	}
+
+	for _, summary := range addresses {
+		report.TopAddresses = append(report.TopAddresses, *summary)
+	}
+	sort.Slice(report.TopAddresses, func(i, j int) bool {
+		a, b := report.TopAddresses[i], report.TopAddresses[j]
+		if a.Outliers != b.Outliers {
+			return a.Outliers > b.Outliers
+		}
+		if a.HighestSeverity != b.HighestSeverity {
+			return a.HighestSeverity.RiskScore() > b.HighestSeverity.RiskScore()
+		}
+		return a.Address < b.Address
+	})
+	if len(report.TopAddresses) > g.top {
+		report.TopAddresses = report.TopAddresses[:g.top]
+	}
+	return nil
+}
+
+// largestTransfers fills in the day's largest flagged transfers. A transfer
+// flagged by several detectors is listed once, as first detected.
+func (g *Generator) largestTransfers(ctx context.Context, report *DailyReport) error {
+	// Over-fetch so transfers flagged more than once still fill the list
+	rows, err := g.db.QueryContext(ctx, `
+		SELECT id, transaction_hash, address, amount, type, severity, detected_at
+		FROM outliers
+		WHERE (org_id = $1 OR org_id IS NULL)
+		  AND detected_at >= $2
+		  AND detected_at < $3
+		  AND invalidated = false
+		  AND transaction_hash != ''
+		  AND amount > 0
+		ORDER BY amount DESC, detected_at
+		LIMIT $4
+	`, report.OrgID, report.From, report.To, g.top*5)
+	if err != nil {
+		return fmt.Errorf("failed to list largest transfers: %w", err)
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var transfer Transfer
+		if err := rows.Scan(&transfer.OutlierID, &transfer.TransactionHash, &transfer.Address,
+			&transfer.Amount, &transfer.Type, &transfer.Severity, &transfer.DetectedAt); err != nil {
+			return fmt.Errorf("failed to scan transfer: %w", err)
+		}
+		if seen[transfer.TransactionHash] || len(report.LargestTransfers) == g.top {
+			continue
+		}
+		seen[transfer.TransactionHash] = true
+		transfer.DetectedAt = transfer.DetectedAt.UTC()
+		report.LargestTransfers = append(report.LargestTransfers, transfer)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list largest transfers: %w", err)
+	}
+	return nil
+}
+
+// backlog fills in the outliers the organization sees, detected by the end
+// of the day, that are still waiting for it to acknowledge them
+func (g *Generator) backlog(ctx context.Context, report *DailyReport) error {
+	rows, err := g.db.QueryContext(ctx, `
+		SELECT o.severity, COUNT(*)
+		FROM outliers o
+		LEFT JOIN outlier_triage t ON t.outlier_id = o.id AND t.org_id = $1
+		WHERE (o.org_id = $1 OR o.org_id IS NULL)
+		  AND o.detected_at < $2
+		  AND COALESCE(t.acknowledged, false) = false
+		  AND o.invalidated = false
+		GROUP BY o.severity
+	`, report.OrgID, report.To)
+	if err != nil {
+		return fmt.Errorf("failed to count unacknowledged outliers: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var severity models.Severity
+		var count int
+		if err := rows.Scan(&severity, &count); err != nil {
+			return fmt.Errorf("failed to scan unacknowledged outliers: %w", err)
+		}
+		report.Backlog.Unacknowledged += count
+		report.Backlog.BySeverity[severity] = count
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to count unacknowledged outliers: %w", err)
+	}
+	if report.Backlog.Unacknowledged == 0 {
+		return nil
+	}
+
+	var oldest time.Time
+	err = g.db.QueryRowContext(ctx, `
+		SELECT o.detected_at
+		FROM outliers o
+		LEFT JOIN outlier_triage t ON t.outlier_id = o.id AND t.org_id = $1
+		WHERE (o.org_id = $1 OR o.org_id IS NULL)
+		  AND o.detected_at < $2
+		  AND COALESCE(t.acknowledged, false) = false
+		  AND o.invalidated = false
+		ORDER BY o.detected_at
+		LIMIT 1
+	`, report.OrgID, report.To).Scan(&oldest)
+	if err != nil {
+		return fmt.Errorf("failed to find oldest unacknowledged outlier: %w", err)
+	}
+	oldest = oldest.UTC()
+	report.Backlog.OldestDetected = &oldest
+	return nil
+}
@@ -0,0 +1,274 @@
+package reports
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+)
+
+// SARDraft is a suspicious activity report draft assembled from an
+// incident's or an address's outliers, for compliance to review, complete
+// and file. StableRisk never files reports itself.
+type SARDraft struct {
+	Reference      string               `json:"reference"`
+	OrgID          string               `json:"org_id"`
+	Subject        string               `json:"subject"`                // Address reported on
+	IncidentKey    string               `json:"incident_key,omitempty"` // When drafted for an incident
+	GeneratedAt    time.Time            `json:"generated_at"`
+	GeneratedBy    string               `json:"generated_by"`
+	ActivityFrom   time.Time            `json:"activity_from"` // First flagged activity
+	ActivityTo     time.Time            `json:"activity_to"`   // Last flagged activity
+	Narrative      []string             `json:"narrative"`     // Paragraphs
+	Outliers       []models.Outlier     `json:"outliers"`
+	Transactions   []models.Transaction `json:"transactions"` // The subject's, around the activity, newest first
+	Counterparties []SARCounterparty    `json:"counterparties"`
+	Flows          []SARFlow            `json:"flows"`
+	GraphTruncated bool                 `json:"graph_truncated,omitempty"`
+	Notes          []SARNote            `json:"notes"`
+	Gaps           []string             `json:"gaps,omitempty"` // Sections that could not be filled in
+}
+
+// SARCounterparty is an address the subject transacted with during the
+// activity, with its own outliers
+type SARCounterparty struct {
+	Address          string          `json:"address"`
+	TransactionCount int             `json:"transaction_count"`
+	Sent             decimal.Decimal `json:"sent"`
+	Received         decimal.Decimal `json:"received"`
+	Outliers         int             `json:"outliers"`
+	HighestSeverity  models.Severity `json:"highest_severity,omitempty"`
+}
+
+// SARFlow aggregates the transfers from one address to another in the
+// graph snapshot
+type SARFlow struct {
+	From             string          `json:"from"`
+	To               string          `json:"to"`
+	TransactionCount int             `json:"transaction_count"`
+	Amount           decimal.Decimal `json:"amount"`
+}
+
+// SARNote is an analyst's note on one of the outliers
+type SARNote struct {
+	OutlierID string    `json:"outlier_id"`
+	Author    string    `json:"author"`
+	At        time.Time `json:"at"`
+	Text      string    `json:"text"`
+}
+
+// patternDescriptions explain in plain words what each detector flags
+var patternDescriptions = map[models.OutlierType]string{
+	models.OutlierTypeZScore:             "transfer amounts far outside the usual range (z-score)",
+	models.OutlierTypeIQR:                "transfer amounts outside the interquartile range of recent activity",
+	models.OutlierTypePatternCirculation: "funds moving in a cycle back to where they started",
+	models.OutlierTypePatternFanOut:      "funds dispersed to many addresses in a short period",
+	models.OutlierTypePatternFanIn:       "funds gathered from many addresses in a short period",
+	models.OutlierTypePatternDormant:     "a long-dormant address suddenly moving funds",
+	models.OutlierTypePatternVelocity:    "an unusually high rate of transfers",
+	models.OutlierTypePatternCluster:     "membership of a tightly connected cluster of addresses",
+	models.OutlierTypeDBSCAN:             "transfer behaviour unlike any cluster of normal activity",
+	models.OutlierTypeWatchlist:          "transfers touching a watchlisted address",
+	models.OutlierTypeSanctions:          "transfers touching an address on a sanctions list",
+}
+
+// Narrate writes the draft's narrative from its other sections
+func (d *SARDraft) Narrate() {
+	d.Narrative = nil
+
+	bySeverity := make(map[models.Severity]int)
+	byType := make(map[models.OutlierType]int)
+	acknowledged := 0
+	for _, o := range d.Outliers {
+		bySeverity[o.Severity]++
+		byType[o.Type]++
+		if o.Acknowledged {
+			acknowledged++
+		}
+	}
+
+	var severityCounts []string
+	for _, severity := range severities {
+		if n := bySeverity[severity]; n > 0 {
+			severityCounts = append(severityCounts, fmt.Sprintf("%d %s", n, severity))
+		}
+	}
+	scope := ""
+	if d.Subject != "" {
+		scope = " on address " + d.Subject
+	}
+	if d.IncidentKey != "" {
+		scope += " as one incident"
+	}
+	d.Narrative = append(d.Narrative, fmt.Sprintf(
+		"Between %s and %s UTC, StableRisk flagged %s%s (%s).",
+		d.ActivityFrom.Format("2006-01-02 15:04"), d.ActivityTo.Format("2006-01-02 15:04"),
+		plural(len(d.Outliers), "outlier"), scope, strings.Join(severityCounts, ", ")))
+
+	for _, c := range typeCounts(byType) {
+		description := patternDescriptions[models.OutlierType(c.Label)]
+		if description == "" {
+			description = "activity flagged by the " + c.Label + " detector"
+		}
+		d.Narrative = append(d.Narrative, fmt.Sprintf("%s: %s (%s).", c.Label, description, plural(c.Count, "outlier")))
+	}
+
+	if len(d.Transactions) > 0 {
+		var sent, received decimal.Decimal
+		var sentCount, receivedCount int
+		largest := d.Transactions[0]
+		for _, tx := range d.Transactions {
+			if tx.From == d.Subject {
+				sent = sent.Add(tx.Amount)
+				sentCount++
+			}
+			if tx.To == d.Subject {
+				received = received.Add(tx.Amount)
+				receivedCount++
+			}
+			if tx.Amount.GreaterThan(largest.Amount) {
+				largest = tx
+			}
+		}
+		d.Narrative = append(d.Narrative, fmt.Sprintf(
+			"Around this activity the address sent %s across %s and received %s across %s. The largest was %s in transaction %s on %s.",
+			sent.String(), plural(sentCount, "transfer"), received.String(), plural(receivedCount, "transfer"),
+			largest.Amount.String(), largest.TxHash, largest.Timestamp.UTC().Format("2006-01-02 15:04")))
+	}
+
+	if len(d.Counterparties) > 0 {
+		var flagged []string
+		for _, c := range d.Counterparties {
+			if c.Outliers > 0 {
+				flagged = append(flagged, fmt.Sprintf("%s (%s, highest %s)", c.Address, plural(c.Outliers, "outlier"), c.HighestSeverity))
+			}
+		}
+		sentence := fmt.Sprintf("The address transacted directly with %s.", plural(len(d.Counterparties), "counterparty"))
+		if len(flagged) > 0 {
+			sentence += fmt.Sprintf(" Of these, %d %s flagged in their own right: %s.",
+				len(flagged), pluralVerb(len(flagged), "was", "were"), strings.Join(flagged, "; "))
+		}
+		d.Narrative = append(d.Narrative, sentence)
+	}
+
+	d.Narrative = append(d.Narrative, fmt.Sprintf("%d of the %s %s been acknowledged by an analyst, and %s recorded.",
+		acknowledged, plural(len(d.Outliers), "outlier"), pluralVerb(acknowledged, "has", "have"), plural(len(d.Notes), "analyst note")))
+}
+
+// plural formats a count of things, e.g. "1 outlier" or "3 outliers"
+func plural(n int, thing string) string {
+	if n == 1 {
+		return "1 " + thing
+	}
+	if strings.HasSuffix(thing, "y") {
+		return fmt.Sprintf("%d %sies", n, strings.TrimSuffix(thing, "y"))
+	}
+	return fmt.Sprintf("%d %ss", n, thing)
+}
+
+// pluralVerb picks the verb form agreeing with a count
+func pluralVerb(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+// write lays out the draft
+func (d *SARDraft) write(w documentWriter) {
+	w.paragraph("DRAFT for compliance review. Verify every section before filing.")
+	w.table([]float64{0.3, 0.7}, []string{"Field", "Value"}, [][]string{
+		{"Reference", d.Reference},
+		{"Subject address", d.Subject},
+		{"Incident", d.IncidentKey},
+		{"Activity", d.ActivityFrom.Format(time.RFC1123) + " to " + d.ActivityTo.Format(time.RFC1123)},
+		{"Generated", d.GeneratedAt.Format(time.RFC1123) + " by " + d.GeneratedBy},
+	})
+
+	w.heading("Narrative")
+	for _, paragraph := range d.Narrative {
+		w.paragraph(paragraph)
+	}
+
+	w.heading("Flagged activity")
+	rows := make([][]string, len(d.Outliers))
+	for i, o := range d.Outliers {
+		amount := ""
+		if !o.Amount.IsZero() {
+			amount = o.Amount.String()
+		}
+		rows[i] = []string{o.DetectedAt.UTC().Format("2006-01-02 15:04"), string(o.Severity), string(o.Type),
+			amount, o.TransactionHash, string(o.Status)}
+	}
+	w.table([]float64{0.17, 0.1, 0.17, 0.14, 0.3, 0.12},
+		[]string{"Detected (UTC)", "Severity", "Type", "Amount", "Transaction", "Status"}, rows)
+
+	w.heading("Transactions")
+	if len(d.Transactions) == 0 {
+		w.paragraph("None available.")
+	} else {
+		rows = make([][]string, len(d.Transactions))
+		for i, tx := range d.Transactions {
+			rows[i] = []string{tx.Timestamp.UTC().Format("2006-01-02 15:04"), tx.From, tx.To, tx.Amount.String(), tx.TxHash}
+		}
+		w.table([]float64{0.15, 0.22, 0.22, 0.13, 0.28},
+			[]string{"Time (UTC)", "From", "To", "Amount", "Transaction"}, rows)
+	}
+
+	w.heading("Graph snapshot")
+	if len(d.Counterparties) == 0 && len(d.Flows) == 0 {
+		w.paragraph("None available.")
+	} else {
+		if d.GraphTruncated {
+			w.paragraph("The graph service stopped at its address limit, so some counterparties are missing.")
+		}
+		rows = make([][]string, len(d.Counterparties))
+		for i, c := range d.Counterparties {
+			rows[i] = []string{c.Address, fmt.Sprint(c.TransactionCount), c.Sent.String(), c.Received.String(),
+				fmt.Sprint(c.Outliers), string(c.HighestSeverity)}
+		}
+		w.table([]float64{0.34, 0.12, 0.14, 0.14, 0.11, 0.15},
+			[]string{"Counterparty", "Transfers", "Sent", "Received", "Outliers", "Highest"}, rows)
+
+		rows = make([][]string, len(d.Flows))
+		for i, f := range d.Flows {
+			rows[i] = []string{f.From, f.To, fmt.Sprint(f.TransactionCount), f.Amount.String()}
+		}
+		w.table([]float64{0.35, 0.35, 0.12, 0.18}, []string{"From", "To", "Transfers", "Amount"}, rows)
+	}
+
+	w.heading("Analyst notes")
+	if len(d.Notes) == 0 {
+		w.paragraph("None recorded.")
+	}
+	for _, note := range d.Notes {
+		w.paragraph(fmt.Sprintf("%s, %s, on outlier %s: %s",
+			note.At.UTC().Format("2006-01-02 15:04"), note.Author, note.OutlierID, note.Text))
+	}
+
+	if len(d.Gaps) > 0 {
+		w.heading("Gaps")
+		for _, gap := range d.Gaps {
+			w.paragraph(gap)
+		}
+	}
+}
+
+// RenderPDF renders the draft as a PDF document
+func (d *SARDraft) RenderPDF() []byte {
+	doc := newPDFDocument()
+	doc.text("Suspicious Activity Report", 18, true)
+	d.write(doc)
+	return doc.bytes()
+}
+
+// RenderDOCX renders the draft as a Word document, for compliance to edit
+// before filing
+func (d *SARDraft) RenderDOCX() ([]byte, error) {
+	doc := &docxDocument{}
+	doc.title("Suspicious Activity Report")
+	d.write(doc)
+	return doc.bytes()
+}
@@ -0,0 +1,192 @@
+package reports
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/notify"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// reportDaily names daily reports in report_deliveries
+const reportDaily = "daily"
+
+// Delivery statuses in report_deliveries
+const (
+	deliverySending = "sending"
+	deliverySent    = "sent"
+	deliveryFailed  = "failed"
+)
+
+// Sender emails a report
+type Sender interface {
+	Send(ctx context.Context, recipients []string, subject string, body []byte, attachments ...notify.Attachment) error
+}
+
+// SchedulerConfig holds daily report delivery configuration
+type SchedulerConfig struct {
+	OrgID        string        // Organization reported on; defaults to the default organization
+	SendAt       time.Duration // Time after midnight UTC the previous day's report is sent
+	Recipients   []string
+	AttachPDF    bool          // Attach the report as a PDF as well as in the email body
+	DashboardURL string        // The email links to the dashboard at this URL
+	Interval     time.Duration // How often to check for a report due; defaults to 5 minutes
+	MaxAttempts  int           // Sends of a report before giving up; defaults to 3
+	// StaleAfter is how long a send may take before another instance
+	// takes it over; defaults to an hour
+	StaleAfter time.Duration
+}
+
+// Scheduler emails the previous day's report once a day. Each report is
+// claimed in report_deliveries before it is sent, so with several API
+// instances running it is still only sent once, and a failed send is
+// retried on later checks.
+type Scheduler struct {
+	db        *sql.DB
+	generator *Generator
+	sender    Sender
+	config    SchedulerConfig
+	logger    *zap.Logger
+}
+
+// NewScheduler creates a daily report scheduler
+func NewScheduler(db *sql.DB, generator *Generator, sender Sender, config SchedulerConfig, logger *zap.Logger) *Scheduler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.OrgID == "" {
+		config.OrgID = models.DefaultOrganizationID
+	}
+	if config.Interval <= 0 {
+		config.Interval = 5 * time.Minute
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 3
+	}
+	if config.StaleAfter <= 0 {
+		config.StaleAfter = time.Hour
+	}
+
+	return &Scheduler{
+		db:        db,
+		generator: generator,
+		sender:    sender,
+		config:    config,
+		logger:    logger,
+	}
+}
+
+// Run sends any report due on start and then checks every interval until
+// ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.SendDue(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			s.logger.Error("Failed to send daily report", zap.Error(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// SendDue sends the report for the day before now once now is past the
+// send time, unless it has been sent already or another instance is
+// sending it. It reports whether this call sent it.
+func (s *Scheduler) SendDue(ctx context.Context, now time.Time) (bool, error) {
+	_, today, _ := Day(now)
+	if now.UTC().Before(today.Add(s.config.SendAt)) {
+		return false, nil
+	}
+	yesterday := today.AddDate(0, 0, -1)
+	date := yesterday.Format(DateLayout)
+
+	claimed, err := s.claim(ctx, date, now)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	sendErr := s.send(ctx, yesterday)
+	status, message := deliverySent, ""
+	if sendErr != nil {
+		status, message = deliveryFailed, sendErr.Error()
+	}
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE report_deliveries
+		SET status = $1, error = $2, completed_at = $3
+		WHERE report = $4 AND org_id = $5 AND report_date = $6
+	`, status, message, time.Now().UTC(), reportDaily, s.config.OrgID, date)
+	if err != nil {
+		s.logger.Error("Failed to record daily report delivery", zap.String("date", date), zap.Error(err))
+	}
+	if sendErr != nil {
+		return false, fmt.Errorf("report for %s: %w", date, sendErr)
+	}
+
+	s.logger.Info("Daily report sent",
+		zap.String("date", date),
+		zap.Int("recipients", len(s.config.Recipients)))
+	return true, nil
+}
+
+// claim takes the report for date for this instance. A report can be
+// claimed when it has not been tried yet, when it failed with attempts to
+// spare, or when the instance sending it has taken so long it probably
+// stopped.
+func (s *Scheduler) claim(ctx context.Context, date string, now time.Time) (bool, error) {
+	now = now.UTC()
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO report_deliveries (report, org_id, report_date, status, attempts, claimed_at)
+		VALUES ($1, $2, $3, $4, 1, $5)
+		ON CONFLICT DO NOTHING
+	`, reportDaily, s.config.OrgID, date, deliverySending, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim report: %w", err)
+	}
+	if count, _ := result.RowsAffected(); count == 1 {
+		return true, nil
+	}
+
+	result, err = s.db.ExecContext(ctx, `
+		UPDATE report_deliveries
+		SET status = $1, attempts = attempts + 1, claimed_at = $2, error = ''
+		WHERE report = $3 AND org_id = $4 AND report_date = $5
+		  AND ((status = $6 AND attempts < $7) OR (status = $8 AND claimed_at < $9))
+	`, deliverySending, now, reportDaily, s.config.OrgID, date,
+		deliveryFailed, s.config.MaxAttempts, deliverySending, now.Add(-s.config.StaleAfter))
+	if err != nil {
+		return false, fmt.Errorf("failed to claim report: %w", err)
+	}
+	count, _ := result.RowsAffected()
+	return count == 1, nil
+}
+
+// send generates the report for the day of date and emails it
+func (s *Scheduler) send(ctx context.Context, date time.Time) error {
+	report, err := s.generator.Daily(ctx, s.config.OrgID, date)
+	if err != nil {
+		return err
+	}
+	body, err := report.RenderHTML(s.config.DashboardURL)
+	if err != nil {
+		return err
+	}
+
+	var attachments []notify.Attachment
+	if s.config.AttachPDF {
+		attachments = append(attachments, notify.Attachment{
+			Filename:    fmt.Sprintf("stablerisk-daily-%s.pdf", report.Date),
+			ContentType: "application/pdf",
+			Content:     report.RenderPDF(),
+		})
+	}
+	return s.sender.Send(ctx, s.config.Recipients, report.Subject(), body, attachments...)
+}
@@ -0,0 +1,118 @@
+package sanctions
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CSVLoader loads a sanctions list from a CSV file with a header row. The
+// address column is required; currency, name, id and programs (separated
+// by semicolons) are read when present. Column names are case-insensitive.
+type CSVLoader struct {
+	name   string
+	source string
+	client *http.Client
+}
+
+// NewCSVLoader creates a loader for the CSV at source, a URL or file path
+func NewCSVLoader(name, source string, timeout time.Duration) *CSVLoader {
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+
+	return &CSVLoader{
+		name:   name,
+		source: source,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Name returns the list's configured name
+func (l *CSVLoader) Name() string {
+	return l.name
+}
+
+// Load reads and parses the CSV
+func (l *CSVLoader) Load(ctx context.Context) (*List, error) {
+	body, err := open(ctx, l.client, l.source)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	list, err := ParseCSV(body, l.name)
+	if err != nil {
+		return nil, err
+	}
+	list.Source = l.source
+	return list, nil
+}
+
+// ParseCSV reads a sanctions list named name from CSV. Rows with an empty
+// address are skipped.
+func ParseCSV(r io.Reader, name string) (*List, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty sanctions CSV")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sanctions CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))] = i
+	}
+	if _, ok := columns["address"]; !ok {
+		return nil, fmt.Errorf("sanctions CSV has no address column")
+	}
+	field := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	list := &List{
+		Name:     name,
+		LoadedAt: time.Now(),
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sanctions CSV: %w", err)
+		}
+
+		address := field(record, "address")
+		if address == "" {
+			continue
+		}
+		var programs []string
+		for _, program := range strings.Split(field(record, "programs"), ";") {
+			if program = strings.TrimSpace(program); program != "" {
+				programs = append(programs, program)
+			}
+		}
+		list.Entries = append(list.Entries, Entry{
+			Address:  address,
+			Currency: field(record, "currency"),
+			List:     name,
+			EntryID:  field(record, "id"),
+			Name:     field(record, "name"),
+			Programs: programs,
+		})
+	}
+	return list, nil
+}
@@ -0,0 +1,242 @@
+// Package sanctions screens transactions against sanctions lists of crypto
+// addresses, such as OFAC's Specially Designated Nationals list.
+package sanctions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Entry is a sanctioned address and where it was listed
+type Entry struct {
+	Address  string   `json:"address"`
+	Currency string   `json:"currency,omitempty"` // As given by the list, e.g. USDT, ETH or XBT
+	List     string   `json:"list"`
+	EntryID  string   `json:"entry_id,omitempty"` // The list's identifier for the sanctioned party
+	Name     string   `json:"name,omitempty"`     // Sanctioned party
+	Programs []string `json:"programs,omitempty"` // Sanctions programs, e.g. CYBER2
+}
+
+// List is one loaded sanctions list
+type List struct {
+	Name        string
+	Source      string     // File path or URL the list was loaded from
+	PublishedAt *time.Time // When the list says it was published, if it does
+	LoadedAt    time.Time
+	Entries     []Entry
+}
+
+// Loader loads a sanctions list
+type Loader interface {
+	// Name identifies the list in outliers and metrics
+	Name() string
+	Load(ctx context.Context) (*List, error)
+}
+
+// ScreenerConfig holds sanctions screening configuration
+type ScreenerConfig struct {
+	RefreshInterval time.Duration // How often lists are reloaded (default 24h)
+}
+
+// Screener raises a critical outlier for every transfer to or from an
+// address on a loaded sanctions list. Lists are held in memory and reloaded
+// periodically; a list that fails to reload keeps its previous entries.
+type Screener struct {
+	loaders []Loader
+	config  ScreenerConfig
+	logger  *zap.Logger
+
+	mu    sync.RWMutex
+	lists map[string]*List   // By name
+	index map[string][]Entry // By normalized address
+}
+
+// NewScreener creates a screener for the lists loaded by loaders. Nothing
+// is screened until the first Refresh.
+func NewScreener(config ScreenerConfig, loaders []Loader, logger *zap.Logger) *Screener {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = 24 * time.Hour
+	}
+
+	return &Screener{
+		loaders: loaders,
+		config:  config,
+		logger:  logger,
+		lists:   make(map[string]*List),
+		index:   make(map[string][]Entry),
+	}
+}
+
+// Refresh reloads every list. Lists that fail to load keep their previous
+// entries, and their errors are returned together.
+func (s *Screener) Refresh(ctx context.Context) error {
+	var errs []error
+	loaded := make(map[string]*List, len(s.loaders))
+	for _, loader := range s.loaders {
+		list, err := loader.Load(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to load sanctions list %s: %w", loader.Name(), err))
+			continue
+		}
+		loaded[loader.Name()] = list
+
+		metrics.SanctionedAddresses.WithLabelValues(list.Name).Set(float64(len(list.Entries)))
+		fields := []zap.Field{
+			zap.String("list", list.Name),
+			zap.String("source", list.Source),
+			zap.Int("addresses", len(list.Entries)),
+		}
+		if list.PublishedAt != nil {
+			fields = append(fields, zap.Time("published_at", *list.PublishedAt))
+		}
+		s.logger.Info("Sanctions list loaded", fields...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, list := range loaded {
+		s.lists[name] = list
+	}
+	index := make(map[string][]Entry)
+	for _, list := range s.lists {
+		for _, entry := range list.Entries {
+			address := models.NormalizeAddress(entry.Address)
+			index[address] = append(index[address], entry)
+		}
+	}
+	s.index = index
+
+	return errors.Join(errs...)
+}
+
+// Run refreshes the lists every RefreshInterval until ctx is cancelled
+func (s *Screener) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(ctx); err != nil && ctx.Err() == nil {
+				s.logger.Error("Failed to refresh sanctions lists", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Screen returns an outlier for each side of tx that is on a sanctions
+// list, one per sanctioned address however many lists name it
+func (s *Screener) Screen(tx models.Transaction) []models.Outlier {
+	now := time.Now()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var outliers []models.Outlier
+	for _, side := range []struct {
+		address, counterparty, direction string
+	}{
+		{tx.From, tx.To, "sent"},
+		{tx.To, tx.From, "received"},
+	} {
+		// A transfer to itself is reported once
+		if side.direction == "received" && tx.To == tx.From {
+			break
+		}
+
+		matched := s.index[models.NormalizeAddress(side.address)]
+		if len(matched) == 0 {
+			continue
+		}
+
+		outliers = append(outliers, models.Outlier{
+			ID:              uuid.New().String(),
+			DetectedAt:      now,
+			Type:            models.OutlierTypeSanctions,
+			Severity:        models.SeverityCritical,
+			Address:         side.address,
+			TransactionHash: tx.TxHash,
+			Amount:          tx.Amount,
+			Details: map[string]interface{}{
+				"lists":        s.provenance(matched),
+				"direction":    side.direction,
+				"counterparty": side.counterparty,
+				"chain":        string(tx.Chain),
+				"token":        tx.Token,
+				"timestamp":    tx.Timestamp.Unix(),
+			},
+			Status:       models.OutlierStatusOpen,
+			Acknowledged: false,
+		})
+		metrics.OutliersDetected.WithLabelValues(string(models.OutlierTypeSanctions), string(models.SeverityCritical)).Inc()
+	}
+
+	return outliers
+}
+
+// provenance describes where each matched entry was listed, ordered by
+// list. The caller holds s.mu.
+func (s *Screener) provenance(entries []Entry) []map[string]interface{} {
+	sorted := append([]Entry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].List < sorted[j].List })
+
+	provenance := make([]map[string]interface{}, len(sorted))
+	for i, entry := range sorted {
+		p := map[string]interface{}{
+			"list":     entry.List,
+			"entry_id": entry.EntryID,
+			"name":     entry.Name,
+			"programs": entry.Programs,
+			"currency": entry.Currency,
+		}
+		if list := s.lists[entry.List]; list != nil {
+			p["source"] = list.Source
+			p["loaded_at"] = list.LoadedAt.UTC().Format(time.RFC3339)
+			if list.PublishedAt != nil {
+				p["published_at"] = list.PublishedAt.UTC().Format(time.RFC3339)
+			}
+		}
+		provenance[i] = p
+	}
+	return provenance
+}
+
+// open reads source, a file path or an http(s) URL
+func open(ctx context.Context, client *http.Client, source string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.Open(source)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
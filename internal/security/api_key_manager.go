@@ -0,0 +1,173 @@
+package security
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to recognise
+const APIKeyPrefix = "srk_"
+
+// APIKeyColumns selects the columns ScanAPIKey reads from api_keys k joined
+// to the owning users u
+const APIKeyColumns = `k.id, k.org_id, k.user_id, u.username, u.role, k.name, k.key_prefix, k.scopes, k.rate_limit,
+	k.created_at, k.expires_at, k.last_used, k.is_active
+	FROM api_keys k JOIN users u ON u.id = k.user_id`
+
+// ErrInvalidAPIKey is returned for unknown, revoked or expired API keys, or
+// keys whose owner is inactive
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeyManager authenticates API keys and enforces their rate limits.
+// Rate limits are counted per API instance.
+type APIKeyManager struct {
+	db               *sql.DB
+	logger           *zap.Logger
+	defaultRateLimit int
+
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+}
+
+// APIKeyConfig holds API key configuration
+type APIKeyConfig struct {
+	DefaultRateLimit int // Requests per minute for keys without their own limit; 0 means unlimited
+}
+
+// rateWindow counts a key's requests in the current minute
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// NewAPIKeyManager creates a new API key manager
+func NewAPIKeyManager(db *sql.DB, config APIKeyConfig, logger *zap.Logger) *APIKeyManager {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &APIKeyManager{
+		db:               db,
+		logger:           logger,
+		defaultRateLimit: config.DefaultRateLimit,
+		windows:          make(map[string]*rateWindow),
+	}
+}
+
+// GenerateAPIKey returns a random API key, the prefix shown in listings,
+// and the hash to store in its place
+func GenerateAPIKey() (key, prefix, keyHash string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	key = APIKeyPrefix + hex.EncodeToString(raw)
+	return key, key[:len(APIKeyPrefix)+8], HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the stored form of an API key. Keys are random, so an
+// unsalted SHA-256 is enough and lets them be looked up by hash.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate returns the active, unexpired key matching key, along with
+// its owner's username and role
+func (m *APIKeyManager) Authenticate(ctx context.Context, key string) (*models.APIKey, error) {
+	apiKey, err := ScanAPIKey(m.db.QueryRowContext(ctx, `
+		SELECT `+APIKeyColumns+`
+		WHERE k.key_hash = $1 AND k.is_active = true AND u.is_active = true
+	`, HashAPIKey(key)))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API key: %w", err)
+	}
+
+	now := time.Now()
+	if apiKey.ExpiresAt != nil && !apiKey.ExpiresAt.After(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// Record use at most once a minute to keep writes off the hot path
+	if apiKey.LastUsed == nil || now.Sub(*apiKey.LastUsed) > time.Minute {
+		if _, err := m.db.ExecContext(ctx, `
+			UPDATE api_keys SET last_used = $1 WHERE id = $2
+		`, now.UTC(), apiKey.ID); err != nil {
+			m.logger.Error("Failed to record API key use", zap.Error(err), zap.String("api_key_id", apiKey.ID))
+		}
+	}
+
+	return apiKey, nil
+}
+
+// ScanAPIKey scans a row selected with APIKeyColumns
+func ScanAPIKey(row interface{ Scan(dest ...any) error }) (*models.APIKey, error) {
+	var apiKey models.APIKey
+	var scopes []byte
+	err := row.Scan(
+		&apiKey.ID,
+		&apiKey.OrgID,
+		&apiKey.UserID,
+		&apiKey.Username,
+		&apiKey.Role,
+		&apiKey.Name,
+		&apiKey.Prefix,
+		&scopes,
+		&apiKey.RateLimit,
+		&apiKey.CreatedAt,
+		&apiKey.ExpiresAt,
+		&apiKey.LastUsed,
+		&apiKey.IsActive,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(scopes, &apiKey.Scopes); err != nil {
+		return nil, fmt.Errorf("failed to decode API key scopes: %w", err)
+	}
+	return &apiKey, nil
+}
+
+// Allow counts a request against key's per-minute rate limit. If the limit
+// is reached it returns false and how long until the next window.
+func (m *APIKeyManager) Allow(key *models.APIKey) (bool, time.Duration) {
+	limit := key.RateLimit
+	if limit == 0 {
+		limit = m.defaultRateLimit
+	}
+	if limit <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	window := m.windows[key.ID]
+	if window == nil || now.Sub(window.start) >= time.Minute {
+		window = &rateWindow{start: now}
+		m.windows[key.ID] = window
+	}
+	if window.count >= limit {
+		return false, window.start.Add(time.Minute).Sub(now)
+	}
+
+	window.count++
+	return true, 0
+}
@@ -0,0 +1,396 @@
+package security
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/archive"
+	"go.uber.org/zap"
+)
+
+// auditArchiveColumns selects the audit_archives columns scanAuditArchive
+// reads
+const auditArchiveColumns = `id, object_key, records, first_sequence, last_sequence, last_signature,
+	unchained_before, first_timestamp, last_timestamp, sha256, signature, created_at`
+
+// AuditArchive is the manifest of an archive object holding audit records
+// moved out of audit_logs. Manifests are kept in audit_archives and next to
+// each object, and are signed with the audit key.
+type AuditArchive struct {
+	ID              int64      `json:"id,omitempty"` // Assigned when recorded in audit_archives
+	Key             string     `json:"key"`
+	Records         int        `json:"records"`
+	FirstSequence   int64      `json:"first_sequence,omitempty"` // Zero for records written before chaining
+	LastSequence    int64      `json:"last_sequence,omitempty"`
+	LastSignature   string     `json:"last_signature,omitempty"`   // Signature the rest of the chain follows on from
+	UnchainedBefore *time.Time `json:"unchained_before,omitempty"` // Latest timestamp in an archive of unchained records
+	FirstTimestamp  time.Time  `json:"first_timestamp"`
+	LastTimestamp   time.Time  `json:"last_timestamp"`
+	SHA256          string     `json:"sha256"` // Of the compressed object
+	Signature       string     `json:"signature"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// AuditArchiverConfig holds audit retention configuration
+type AuditArchiverConfig struct {
+	Retention time.Duration // Records older than this are archived
+	Prefix    string        // Object key prefix; defaults to audit
+	BatchSize int           // Records per archive object; defaults to 10000
+}
+
+// AuditArchiver moves audit records past the retention period into
+// gzipped NDJSON objects in an archive store, then deletes them from
+// audit_logs. Chained records are archived in chain order, so the records
+// left in the table still form an unbroken chain from the last archive.
+type AuditArchiver struct {
+	db          *sql.DB
+	store       archive.Store
+	auditLogger *AuditLogger
+	config      AuditArchiverConfig
+	logger      *zap.Logger
+
+	mu sync.Mutex // One archival run at a time
+}
+
+// NewAuditArchiver creates an audit archiver. auditLogger signs the
+// manifests.
+func NewAuditArchiver(db *sql.DB, store archive.Store, auditLogger *AuditLogger, config AuditArchiverConfig, logger *zap.Logger) *AuditArchiver {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.Prefix == "" {
+		config.Prefix = "audit"
+	}
+	config.Prefix = strings.Trim(config.Prefix, "/")
+	if config.BatchSize <= 0 {
+		config.BatchSize = 10000
+	}
+
+	return &AuditArchiver{
+		db:          db,
+		store:       store,
+		auditLogger: auditLogger,
+		config:      config,
+		logger:      logger,
+	}
+}
+
+// Run archives on start and then every interval until ctx is done
+func (a *AuditArchiver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := a.Archive(ctx); err != nil && ctx.Err() == nil {
+			a.logger.Error("Failed to archive audit logs", zap.Error(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Archive moves every record older than the retention period into the
+// archive store, returning the manifests written. Records written before
+// chaining go first, then the chain up to the first record still within
+// retention.
+func (a *AuditArchiver) Archive(ctx context.Context) ([]AuditArchive, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	cutoff := time.Now().UTC().Add(-a.config.Retention)
+	archives := []AuditArchive{}
+
+	for {
+		logs, err := a.query(ctx, `
+			SELECT `+AuditLogColumns+` FROM audit_logs
+			WHERE sequence IS NULL AND timestamp < $1
+			ORDER BY timestamp, id LIMIT $2
+		`, cutoff, a.config.BatchSize)
+		if err != nil {
+			return archives, err
+		}
+		if len(logs) == 0 {
+			break
+		}
+		manifest, err := a.archive(ctx, logs, false)
+		if err != nil {
+			return archives, err
+		}
+		if manifest == nil {
+			break
+		}
+		archives = append(archives, *manifest)
+	}
+
+	// The chain is archived up to, not including, its first recent record
+	var end int64
+	if err := a.db.QueryRowContext(ctx, `
+		SELECT COALESCE(MIN(sequence) - 1, (SELECT COALESCE(MAX(sequence), 0) FROM audit_logs))
+		FROM audit_logs WHERE sequence IS NOT NULL AND timestamp >= $1
+	`, cutoff).Scan(&end); err != nil {
+		return archives, fmt.Errorf("failed to find end of archivable audit chain: %w", err)
+	}
+
+	for {
+		logs, err := a.query(ctx, `
+			SELECT `+AuditLogColumns+` FROM audit_logs
+			WHERE sequence IS NOT NULL AND sequence <= $1
+			ORDER BY sequence LIMIT $2
+		`, end, a.config.BatchSize)
+		if err != nil || len(logs) == 0 {
+			return archives, err
+		}
+		manifest, err := a.archive(ctx, logs, true)
+		if err != nil {
+			return archives, err
+		}
+		if manifest == nil {
+			break
+		}
+		archives = append(archives, *manifest)
+	}
+	return archives, nil
+}
+
+// ListAuditArchives returns every audit archive manifest, oldest first
+func ListAuditArchives(ctx context.Context, db *sql.DB) ([]AuditArchive, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+auditArchiveColumns+` FROM audit_archives ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit archives: %w", err)
+	}
+	defer rows.Close()
+
+	archives := []AuditArchive{}
+	for rows.Next() {
+		manifest, err := scanAuditArchive(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit archive: %w", err)
+		}
+		archives = append(archives, *manifest)
+	}
+	return archives, rows.Err()
+}
+
+// query reads audit logs selected with AuditLogColumns
+func (a *AuditArchiver) query(ctx context.Context, query string, args ...interface{}) ([]*AuditLog, error) {
+	rows, err := a.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit logs: %w", err)
+	}
+	defer rows.Close()
+
+	var logs []*AuditLog
+	for rows.Next() {
+		log, err := ScanAuditLog(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit log: %w", err)
+		}
+		logs = append(logs, log)
+	}
+	return logs, rows.Err()
+}
+
+// archive uploads logs and their manifest, then records the manifest and
+// deletes the logs in one transaction. It returns nil if another replica
+// archived the same records first.
+func (a *AuditArchiver) archive(ctx context.Context, logs []*AuditLog, chained bool) (*AuditArchive, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(gz)
+	for _, log := range logs {
+		if err := encoder.Encode(log); err != nil {
+			return nil, fmt.Errorf("failed to encode audit log: %w", err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress audit logs: %w", err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+
+	first, last := logs[0], logs[len(logs)-1]
+	manifest := &AuditArchive{
+		Records:        len(logs),
+		FirstTimestamp: first.Timestamp,
+		LastTimestamp:  last.Timestamp,
+		SHA256:         hex.EncodeToString(sum[:]),
+		CreatedAt:      time.Now().UTC().Truncate(time.Microsecond),
+	}
+	if chained {
+		manifest.FirstSequence = first.Sequence
+		manifest.LastSequence = last.Sequence
+		manifest.LastSignature = last.Signature
+		manifest.Key = path.Join(a.config.Prefix, fmt.Sprintf("sequence=%020d-%020d.ndjson.gz", first.Sequence, last.Sequence))
+	} else {
+		// Unchained records are ordered by time; the archive covers up to
+		// the last one's timestamp
+		manifest.UnchainedBefore = &last.Timestamp
+		manifest.Key = path.Join(a.config.Prefix, "unchained", fmt.Sprintf("%s-%s.ndjson.gz",
+			first.Timestamp.UTC().Format("20060102T150405.000000Z"), last.Timestamp.UTC().Format("20060102T150405.000000Z")))
+	}
+	manifest.Signature = a.auditLogger.manifestSignature(manifest)
+
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit archive manifest: %w", err)
+	}
+	if err := a.store.Put(ctx, manifest.Key, buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to upload audit archive: %w", err)
+	}
+	if err := a.store.Put(ctx, manifest.Key+".manifest.json", manifestJSON); err != nil {
+		return nil, fmt.Errorf("failed to upload audit archive manifest: %w", err)
+	}
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO audit_archives (object_key, records, first_sequence, last_sequence, last_signature,
+			unchained_before, first_timestamp, last_timestamp, sha256, signature, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (object_key) DO NOTHING
+		RETURNING id
+	`, manifest.Key, manifest.Records, manifest.FirstSequence, manifest.LastSequence, manifest.LastSignature,
+		manifest.UnchainedBefore, manifest.FirstTimestamp, manifest.LastTimestamp, manifest.SHA256,
+		manifest.Signature, manifest.CreatedAt).Scan(&manifest.ID)
+	if err == sql.ErrNoRows {
+		a.logger.Info("Audit records already archived", zap.String("key", manifest.Key))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record audit archive: %w", err)
+	}
+
+	var deleted int64
+	if chained {
+		result, err := tx.ExecContext(ctx, `
+			DELETE FROM audit_logs WHERE sequence >= $1 AND sequence <= $2
+		`, manifest.FirstSequence, manifest.LastSequence)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete archived audit logs: %w", err)
+		}
+		deleted, _ = result.RowsAffected()
+	} else {
+		stmt, err := tx.PrepareContext(ctx, `DELETE FROM audit_logs WHERE id = $1`)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare audit log deletion: %w", err)
+		}
+		defer stmt.Close()
+		for _, log := range logs {
+			result, err := stmt.ExecContext(ctx, log.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to delete archived audit log: %w", err)
+			}
+			n, _ := result.RowsAffected()
+			deleted += n
+		}
+	}
+	if deleted != int64(len(logs)) {
+		return nil, fmt.Errorf("deleted %d of %d archived audit logs", deleted, len(logs))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit audit archive: %w", err)
+	}
+
+	a.logger.Info("Audit logs archived",
+		zap.String("key", manifest.Key),
+		zap.Int("records", manifest.Records),
+		zap.Int64("last_sequence", manifest.LastSequence),
+		zap.String("sha256", manifest.SHA256))
+	return manifest, nil
+}
+
+// archivedChain checks the signed manifests of archived chain records and
+// returns the sequence and signature the table's chain continues from
+func (al *AuditLogger) archivedChain(ctx context.Context, problem func(int64, string, ...interface{})) (int64, string, error) {
+	rows, err := al.db.QueryContext(ctx, `
+		SELECT `+auditArchiveColumns+` FROM audit_archives ORDER BY first_sequence, id
+	`)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to query audit archives: %w", err)
+	}
+	defer rows.Close()
+
+	var last int64
+	var lastSignature string
+	for rows.Next() {
+		manifest, err := scanAuditArchive(rows)
+		if err != nil {
+			return 0, "", fmt.Errorf("failed to scan audit archive: %w", err)
+		}
+		if !hmac.Equal([]byte(manifest.Signature), []byte(al.manifestSignature(manifest))) {
+			problem(manifest.FirstSequence, "manifest of archive %s does not verify", manifest.Key)
+			continue
+		}
+		if manifest.FirstSequence == 0 {
+			continue
+		}
+		if manifest.FirstSequence != last+1 {
+			problem(manifest.FirstSequence, "archived records %d to %d are missing", last+1, manifest.FirstSequence-1)
+		}
+		last = manifest.LastSequence
+		lastSignature = manifest.LastSignature
+	}
+	return last, lastSignature, rows.Err()
+}
+
+// manifestSignature signs every manifest field but ID and the signature
+func (al *AuditLogger) manifestSignature(m *AuditArchive) string {
+	unchainedBefore := ""
+	if m.UnchainedBefore != nil {
+		unchainedBefore = m.UnchainedBefore.UTC().Format(time.RFC3339Nano)
+	}
+	return al.sign(fmt.Sprintf("archive|%s|%d|%d|%d|%s|%s|%s|%s|%s|%s",
+		m.Key,
+		m.Records,
+		m.FirstSequence,
+		m.LastSequence,
+		m.LastSignature,
+		unchainedBefore,
+		m.FirstTimestamp.UTC().Format(time.RFC3339Nano),
+		m.LastTimestamp.UTC().Format(time.RFC3339Nano),
+		m.SHA256,
+		m.CreatedAt.UTC().Format(time.RFC3339Nano),
+	))
+}
+
+// scanAuditArchive scans a row selected with auditArchiveColumns
+func scanAuditArchive(row interface{ Scan(dest ...any) error }) (*AuditArchive, error) {
+	var m AuditArchive
+	err := row.Scan(
+		&m.ID,
+		&m.Key,
+		&m.Records,
+		&m.FirstSequence,
+		&m.LastSequence,
+		&m.LastSignature,
+		&m.UnchainedBefore,
+		&m.FirstTimestamp,
+		&m.LastTimestamp,
+		&m.SHA256,
+		&m.Signature,
+		&m.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
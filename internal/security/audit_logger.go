@@ -8,26 +8,58 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
-// AuditLog represents an audit log entry
+// AuditLogColumns selects the audit_logs columns ScanAuditLog reads.
+// ip_address is INET, so it is scanned as a nullable string.
+const AuditLogColumns = `id, timestamp, COALESCE(user_id, ''), action, COALESCE(resource, ''),
+	COALESCE(status, ''), ip_address, details, signature, COALESCE(sequence, 0), COALESCE(prev_signature, '')`
+
+// AuditLog represents an audit log entry. Entries form a hash chain: each
+// is numbered by Sequence and signed over the previous entry's signature,
+// so removing or reordering entries breaks the chain. Entries written
+// before chaining have no Sequence.
 type AuditLog struct {
-	ID        string
-	Timestamp time.Time
-	UserID    string
-	Action    string
-	Resource  string
-	Status    string
-	IPAddress string
-	Details   map[string]interface{}
-	Signature string
+	ID            string                 `json:"id"`
+	Timestamp     time.Time              `json:"timestamp"`
+	UserID        string                 `json:"user_id,omitempty"`
+	Action        string                 `json:"action"`
+	Resource      string                 `json:"resource,omitempty"`
+	Status        string                 `json:"status,omitempty"`
+	IPAddress     string                 `json:"ip_address,omitempty"`
+	Details       map[string]interface{} `json:"details,omitempty"`
+	Signature     string                 `json:"signature"`
+	Sequence      int64                  `json:"sequence,omitempty"`
+	PrevSignature string                 `json:"prev_signature,omitempty"`
+}
+
+// ChainReport is the result of verifying the audit log hash chain
+type ChainReport struct {
+	Valid    bool           `json:"valid"`
+	Records  int64          `json:"records"`  // Chained records checked
+	Head     int64          `json:"head"`     // Sequence of the last record written
+	Archived int64          `json:"archived"` // Sequence of the last archived record
+	Anchors  int            `json:"anchors"`  // Anchors checked
+	Problems []ChainProblem `json:"problems"` // At most maxChainProblems
 }
 
+// ChainProblem describes a break in the audit log hash chain
+type ChainProblem struct {
+	Sequence int64  `json:"sequence"`
+	Problem  string `json:"problem"`
+}
+
+// maxChainProblems caps the problems VerifyChain reports, since a single
+// break can be followed by many more
+const maxChainProblems = 100
+
 // AuditLogger handles tamper-proof audit logging
 type AuditLogger struct {
 	db         *sql.DB
@@ -39,6 +71,8 @@ type AuditLogger struct {
 	cancel     context.CancelFunc
 	batchSize  int
 	flushInterval time.Duration
+	anchorInterval time.Duration
+	written        atomic.Pointer[func(AuditLog)]
 }
 
 // AuditLoggerConfig holds configuration for audit logger
@@ -46,6 +80,7 @@ type AuditLoggerConfig struct {
 	SecretKey     string
 	BatchSize     int           // Number of logs to batch before writing
 	FlushInterval time.Duration // Maximum time to wait before flushing
+	AnchorInterval time.Duration // How often to anchor the chain head; defaults to 1 hour
 }
 
 // NewAuditLogger creates a new audit logger
@@ -62,6 +97,10 @@ func NewAuditLogger(db *sql.DB, config AuditLoggerConfig, logger *zap.Logger) *A
 		config.FlushInterval = 5 * time.Second
 	}
 
+	if config.AnchorInterval <= 0 {
+		config.AnchorInterval = time.Hour
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	al := &AuditLogger{
@@ -73,6 +112,7 @@ func NewAuditLogger(db *sql.DB, config AuditLoggerConfig, logger *zap.Logger) *A
 		cancel:        cancel,
 		batchSize:     config.BatchSize,
 		flushInterval: config.FlushInterval,
+		anchorInterval: config.AnchorInterval,
 	}
 
 	// Start worker to process audit logs
@@ -82,11 +122,24 @@ func NewAuditLogger(db *sql.DB, config AuditLoggerConfig, logger *zap.Logger) *A
 	return al
 }
 
-// Log creates an audit log entry
+// SetWrittenHook calls hook with each entry once it is committed to the
+// chain, signed, such as to forward it to a SIEM. The hook must not block.
+// A nil hook removes it.
+func (al *AuditLogger) SetWrittenHook(hook func(AuditLog)) {
+	if hook == nil {
+		al.written.Store(nil)
+		return
+	}
+	al.written.Store(&hook)
+}
+
+// Log creates an audit log entry. It is signed when written, once its
+// place in the chain is known.
 func (al *AuditLogger) Log(userID, action, resource, status, ipAddress string, details map[string]interface{}) {
 	log := &AuditLog{
-		ID:        uuid.New().String(),
-		Timestamp: time.Now(),
+		ID: uuid.New().String(),
+		// Postgres keeps microseconds, so sign what will be read back
+		Timestamp: time.Now().UTC().Truncate(time.Microsecond),
 		UserID:    userID,
 		Action:    action,
 		Resource:  resource,
@@ -95,9 +148,6 @@ func (al *AuditLogger) Log(userID, action, resource, status, ipAddress string, d
 		Details:   details,
 	}
 
-	// Generate HMAC signature for tamper-proofing
-	log.Signature = al.generateSignature(log)
-
 	// Send to channel (non-blocking)
 	select {
 	case al.logChan <- log:
@@ -115,6 +165,8 @@ func (al *AuditLogger) worker() {
 	batch := make([]*AuditLog, 0, al.batchSize)
 	ticker := time.NewTicker(al.flushInterval)
 	defer ticker.Stop()
+	anchorTicker := time.NewTicker(al.anchorInterval)
+	defer anchorTicker.Stop()
 
 	for {
 		select {
@@ -131,6 +183,11 @@ func (al *AuditLogger) worker() {
 				batch = make([]*AuditLog, 0, al.batchSize)
 			}
 
+		case <-anchorTicker.C:
+			if err := al.Anchor(context.Background()); err != nil {
+				al.logger.Error("Failed to anchor audit chain", zap.Error(err))
+			}
+
 		case <-al.ctx.Done():
 			// Flush remaining logs before shutdown
 			if len(batch) > 0 {
@@ -149,7 +206,8 @@ func (al *AuditLogger) worker() {
 	}
 }
 
-// flushBatch writes a batch of audit logs to the database
+// flushBatch appends a batch of audit logs to the chain and writes them.
+// Replicas share one chain, serialised on the audit_chain_head row.
 func (al *AuditLogger) flushBatch(logs []*AuditLog) {
 	if len(logs) == 0 {
 		return
@@ -164,13 +222,29 @@ func (al *AuditLogger) flushBatch(logs []*AuditLog) {
 			zap.Error(err))
 		return
 	}
+	defer tx.Rollback()
+
+	// Lock the head first so the read below sees other replicas' commits
+	if _, err := tx.ExecContext(ctx, `UPDATE audit_chain_head SET sequence = sequence WHERE id = 1`); err != nil {
+		al.logger.Error("Failed to lock audit chain head",
+			zap.Error(err))
+		return
+	}
+	var sequence int64
+	var prevSignature string
+	if err := tx.QueryRowContext(ctx, `
+		SELECT sequence, signature FROM audit_chain_head WHERE id = 1
+	`).Scan(&sequence, &prevSignature); err != nil {
+		al.logger.Error("Failed to read audit chain head",
+			zap.Error(err))
+		return
+	}
 
 	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO audit_logs (id, timestamp, user_id, action, resource, status, ip_address, details, signature)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO audit_logs (id, timestamp, user_id, action, resource, status, ip_address, details, signature, sequence, prev_signature)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`)
 	if err != nil {
-		tx.Rollback()
 		al.logger.Error("Failed to prepare audit log statement",
 			zap.Error(err))
 		return
@@ -186,6 +260,10 @@ func (al *AuditLogger) flushBatch(logs []*AuditLog) {
 			continue
 		}
 
+		log.Sequence = sequence + 1
+		log.PrevSignature = prevSignature
+		log.Signature = al.generateSignature(log)
+
 		_, err = stmt.ExecContext(ctx,
 			log.ID,
 			log.Timestamp,
@@ -196,21 +274,233 @@ func (al *AuditLogger) flushBatch(logs []*AuditLog) {
 			nullString(log.IPAddress),
 			detailsJSON,
 			log.Signature,
+			log.Sequence,
+			log.PrevSignature,
 		)
 		if err != nil {
+			// The batch is dropped rather than leave a gap in the chain
 			al.logger.Error("Failed to insert audit log",
 				zap.Error(err),
-				zap.String("log_id", log.ID))
+				zap.String("log_id", log.ID),
+				zap.Int("dropped", len(logs)))
+			return
 		}
+
+		sequence = log.Sequence
+		prevSignature = log.Signature
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE audit_chain_head SET sequence = $1, signature = $2 WHERE id = 1
+	`, sequence, prevSignature); err != nil {
+		al.logger.Error("Failed to advance audit chain head",
+			zap.Error(err))
+		return
 	}
 
 	if err := tx.Commit(); err != nil {
 		al.logger.Error("Failed to commit audit logs",
 			zap.Error(err))
-	} else {
-		al.logger.Debug("Flushed audit logs",
-			zap.Int("count", len(logs)))
+		return
+	}
+	al.logger.Debug("Flushed audit logs",
+		zap.Int("count", len(logs)),
+		zap.Int64("sequence", sequence))
+
+	if hook := al.written.Load(); hook != nil {
+		for _, log := range logs {
+			// Entries whose details could not be marshalled were skipped
+			if log.Sequence > 0 {
+				(*hook)(*log)
+			}
+		}
+	}
+}
+
+// Anchor records the chain head in audit_anchors, and in the service log
+// so a copy survives outside the database. An attacker who deletes the
+// newest audit records and rewinds the head is caught by a later anchor.
+// Nothing is written if the head has not moved since the last anchor.
+func (al *AuditLogger) Anchor(ctx context.Context) error {
+	var sequence, anchored int64
+	var signature string
+	if err := al.db.QueryRowContext(ctx, `
+		SELECT sequence, signature FROM audit_chain_head WHERE id = 1
+	`).Scan(&sequence, &signature); err != nil {
+		return fmt.Errorf("failed to read audit chain head: %w", err)
+	}
+	if err := al.db.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(sequence), 0) FROM audit_anchors
+	`).Scan(&anchored); err != nil {
+		return fmt.Errorf("failed to read last audit anchor: %w", err)
+	}
+	if sequence == 0 || sequence == anchored {
+		return nil
+	}
+
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	hash := al.anchorHash(sequence, signature, createdAt)
+	if _, err := al.db.ExecContext(ctx, `
+		INSERT INTO audit_anchors (sequence, signature, anchor_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+	`, sequence, signature, hash, createdAt); err != nil {
+		return fmt.Errorf("failed to insert audit anchor: %w", err)
+	}
+
+	al.logger.Info("Audit chain anchored",
+		zap.Int64("sequence", sequence),
+		zap.String("signature", signature),
+		zap.String("anchor_hash", hash))
+	return nil
+}
+
+// VerifyChain walks the audit log chain in order, checking each record's
+// signature and link to its predecessor, that no sequence numbers are
+// missing, and that every anchored record is still present. Archived
+// records are vouched for by their signed manifests, and the chain resumes
+// after the last of them.
+func (al *AuditLogger) VerifyChain(ctx context.Context) (*ChainReport, error) {
+	report := &ChainReport{Problems: []ChainProblem{}}
+	problem := func(sequence int64, format string, args ...interface{}) {
+		if len(report.Problems) < maxChainProblems {
+			report.Problems = append(report.Problems, ChainProblem{
+				Sequence: sequence,
+				Problem:  fmt.Sprintf(format, args...),
+			})
+		}
+		report.Valid = false
+	}
+	report.Valid = true
+
+	var headSignature string
+	if err := al.db.QueryRowContext(ctx, `
+		SELECT sequence, signature FROM audit_chain_head WHERE id = 1
+	`).Scan(&report.Head, &headSignature); err != nil {
+		return nil, fmt.Errorf("failed to read audit chain head: %w", err)
+	}
+
+	anchors, err := al.loadAnchors(ctx, problem)
+	if err != nil {
+		return nil, err
+	}
+	report.Anchors = len(anchors)
+
+	last, lastSignature, err := al.archivedChain(ctx, problem)
+	if err != nil {
+		return nil, err
+	}
+	report.Archived = last
+	for sequence := range anchors {
+		if sequence <= last {
+			delete(anchors, sequence)
+		}
 	}
+
+	rows, err := al.db.QueryContext(ctx, `
+		SELECT `+AuditLogColumns+` FROM audit_logs WHERE sequence > $1 ORDER BY sequence
+	`, last)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit logs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		log, err := ScanAuditLog(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit log: %w", err)
+		}
+		report.Records++
+
+		if log.Sequence != last+1 {
+			problem(log.Sequence, "records %d to %d are missing", last+1, log.Sequence-1)
+		} else if log.PrevSignature != lastSignature {
+			problem(log.Sequence, "does not follow record %d", last)
+		}
+		if !al.VerifySignature(log) {
+			problem(log.Sequence, "signature does not match contents")
+		}
+		if signature, ok := anchors[log.Sequence]; ok {
+			if signature != log.Signature {
+				problem(log.Sequence, "signature differs from anchor")
+			}
+			delete(anchors, log.Sequence)
+		}
+
+		last = log.Sequence
+		lastSignature = log.Signature
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit logs: %w", err)
+	}
+
+	if last != report.Head {
+		problem(last, "chain ends at record %d but the head is record %d", last, report.Head)
+	} else if lastSignature != headSignature {
+		problem(last, "signature differs from the chain head")
+	}
+	for sequence := range anchors {
+		problem(sequence, "anchored record is missing")
+	}
+
+	return report, nil
+}
+
+// loadAnchors returns the signature recorded by each valid anchor, keyed by
+// sequence, reporting anchors whose hash does not verify
+func (al *AuditLogger) loadAnchors(ctx context.Context, problem func(int64, string, ...interface{})) (map[int64]string, error) {
+	rows, err := al.db.QueryContext(ctx, `
+		SELECT sequence, signature, anchor_hash, created_at FROM audit_anchors ORDER BY sequence
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit anchors: %w", err)
+	}
+	defer rows.Close()
+
+	anchors := make(map[int64]string)
+	for rows.Next() {
+		var sequence int64
+		var signature, hash string
+		var createdAt time.Time
+		if err := rows.Scan(&sequence, &signature, &hash, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit anchor: %w", err)
+		}
+		if !hmac.Equal([]byte(hash), []byte(al.anchorHash(sequence, signature, createdAt))) {
+			problem(sequence, "anchor hash does not verify")
+			continue
+		}
+		anchors[sequence] = signature
+	}
+	return anchors, rows.Err()
+}
+
+// ScanAuditLog scans a row selected with AuditLogColumns
+func ScanAuditLog(row interface{ Scan(dest ...any) error }) (*AuditLog, error) {
+	var log AuditLog
+	var ipAddress sql.NullString
+	var details []byte
+	err := row.Scan(
+		&log.ID,
+		&log.Timestamp,
+		&log.UserID,
+		&log.Action,
+		&log.Resource,
+		&log.Status,
+		&ipAddress,
+		&details,
+		&log.Signature,
+		&log.Sequence,
+		&log.PrevSignature,
+	)
+	if err != nil {
+		return nil, err
+	}
+	log.IPAddress = ipAddress.String
+	if len(details) > 0 {
+		if err := json.Unmarshal(details, &log.Details); err != nil {
+			return nil, fmt.Errorf("failed to decode audit log details: %w", err)
+		}
+	}
+	return &log, nil
 }
 
 // generateSignature generates an HMAC-SHA256 signature for the audit log
@@ -219,7 +509,7 @@ func (al *AuditLogger) generateSignature(log *AuditLog) string {
 	detailsJSON, _ := json.Marshal(log.Details)
 	data := fmt.Sprintf("%s|%s|%s|%s|%s|%s|%s|%s",
 		log.ID,
-		log.Timestamp.Format(time.RFC3339Nano),
+		log.Timestamp.UTC().Format(time.RFC3339Nano),
 		log.UserID,
 		log.Action,
 		log.Resource,
@@ -227,6 +517,10 @@ func (al *AuditLogger) generateSignature(log *AuditLog) string {
 		log.IPAddress,
 		string(detailsJSON),
 	)
+	// Chained entries also cover their place in the chain
+	if log.Sequence > 0 {
+		data += "|" + strconv.FormatInt(log.Sequence, 10) + "|" + log.PrevSignature
+	}
 
 	// Generate HMAC
 	h := hmac.New(sha256.New, al.secretKey)
@@ -234,12 +528,25 @@ func (al *AuditLogger) generateSignature(log *AuditLog) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
-// VerifySignature verifies the HMAC signature of an audit log
+// VerifySignature verifies the HMAC signature of an audit log, such as one
+// read back from the database
 func (al *AuditLogger) VerifySignature(log *AuditLog) bool {
 	expectedSignature := al.generateSignature(log)
 	return hmac.Equal([]byte(expectedSignature), []byte(log.Signature))
 }
 
+// anchorHash signs an anchor, so anchors cannot be forged without the key
+func (al *AuditLogger) anchorHash(sequence int64, signature string, createdAt time.Time) string {
+	return al.sign(fmt.Sprintf("anchor|%d|%s|%s", sequence, signature, createdAt.UTC().Format(time.RFC3339Nano)))
+}
+
+// sign returns the hex HMAC-SHA256 of data under the audit key
+func (al *AuditLogger) sign(data string) string {
+	h := hmac.New(sha256.New, al.secretKey)
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 // Close gracefully shuts down the audit logger
 func (al *AuditLogger) Close() error {
 	al.logger.Info("Shutting down audit logger")
@@ -0,0 +1,182 @@
+// Package crypto encrypts sensitive database fields with AES-256-GCM.
+//
+// Encrypted values are self-describing strings of the form
+// enc:v1:<key id>:<base64 nonce and ciphertext>, so a column can hold a mix
+// of plaintext written before encryption was enabled and values encrypted
+// under current and previous keys while keys are rotated.
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefix marks an encrypted value
+const prefix = "enc:v1:"
+
+var (
+	// ErrUnknownKey is returned when decrypting a value encrypted under a
+	// key that is neither the current key nor a previous one
+	ErrUnknownKey = errors.New("value is encrypted under an unknown key")
+	// ErrMalformed is returned when decrypting a value that carries the
+	// encryption prefix but cannot be decoded or authenticated
+	ErrMalformed = errors.New("malformed encrypted value")
+)
+
+// CipherConfig holds the keys for a Cipher
+type CipherConfig struct {
+	Key          string   // Encrypts new values
+	PreviousKeys []string // Still decrypt, for values not yet re-encrypted
+	IndexKey     string   // Keys BlindIndex; must not change when Key rotates
+}
+
+// Cipher encrypts and decrypts field values. It is safe for concurrent use.
+type Cipher struct {
+	current  string
+	keys     map[string]cipher.AEAD
+	indexKey []byte
+}
+
+// NewCipher creates a cipher from config. Keys are 32 bytes, base64
+// encoded; any other string is hashed to 32 bytes, which keeps development
+// defaults working but gives a weaker key than one from a random source.
+func NewCipher(config CipherConfig) (*Cipher, error) {
+	if config.Key == "" {
+		return nil, errors.New("encryption key is required")
+	}
+	if config.IndexKey == "" {
+		return nil, errors.New("index key is required")
+	}
+
+	c := &Cipher{
+		keys:     make(map[string]cipher.AEAD),
+		indexKey: []byte(config.IndexKey),
+	}
+	for i, key := range append([]string{config.Key}, config.PreviousKeys...) {
+		id, aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			c.current = id
+		}
+		if _, ok := c.keys[id]; !ok {
+			c.keys[id] = aead
+		}
+	}
+
+	return c, nil
+}
+
+// newAEAD derives the AES key for key and identifies it by a short hash, so
+// stored values name their key without revealing it
+func newAEAD(key string) (string, cipher.AEAD, error) {
+	material, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(material) != 32 {
+		sum := sha256.Sum256([]byte(key))
+		material = sum[:]
+	}
+
+	block, err := aes.NewCipher(material)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	id := sha256.Sum256(append([]byte("stablerisk-key-id|"), material...))
+	return hex.EncodeToString(id[:4]), aead, nil
+}
+
+// Encrypt encrypts plaintext under the current key. The empty string is
+// returned unchanged, so optional fields stay empty.
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	aead := c.keys[c.current]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(c.current))
+
+	return prefix + c.current + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of value. Values without the encryption
+// prefix are returned as they are, since they were written before
+// encryption was enabled.
+func (c *Cipher) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	if !ok {
+		return "", ErrMalformed
+	}
+	aead, ok := c.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrMalformed
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", ErrMalformed
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports whether value should be rewritten: it is plaintext,
+// or encrypted under a key other than the current one
+func (c *Cipher) NeedsRotation(value string) bool {
+	if value == "" {
+		return false
+	}
+	if !IsEncrypted(value) {
+		return true
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id != c.current
+}
+
+// BlindIndex returns a keyed hash of value for equality lookups and unique
+// constraints on an encrypted column. Values are compared case-insensitively
+// with surrounding space removed. The empty string has no index.
+func (c *Cipher) BlindIndex(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return ""
+	}
+
+	h := hmac.New(sha256.New, c.indexKey)
+	h.Write([]byte(value))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CurrentPrefix returns the prefix shared by values encrypted under the
+// current key, for finding values that still need rotation in SQL
+func (c *Cipher) CurrentPrefix() string {
+	return prefix + c.current + ":"
+}
+
+// IsEncrypted reports whether value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
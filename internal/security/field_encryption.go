@@ -0,0 +1,135 @@
+package security
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/mikedewar/stablerisk/internal/security/crypto"
+	"go.uber.org/zap"
+)
+
+// encryptedColumn is a column whose values are encrypted at rest, with the
+// column holding its blind index if it has one
+type encryptedColumn struct {
+	table  string
+	column string
+	index  string
+}
+
+// encryptedColumns lists the columns the API encrypts
+var encryptedColumns = []encryptedColumn{
+	{table: "users", column: "email", index: "email_hash"},
+	{table: "outlier_triage", column: "notes"},
+}
+
+// fieldEncryptionBatch is how many values are read per query
+const fieldEncryptionBatch = 500
+
+// EncryptFields encrypts values written before encryption was enabled and
+// re-encrypts values under previous keys with the current one, so previous
+// keys can be retired once it has run. Values that cannot be rewritten,
+// such as those under a key that is no longer configured, are logged and
+// skipped. It returns the number of values rewritten.
+func EncryptFields(ctx context.Context, db *sql.DB, cipher *crypto.Cipher, logger *zap.Logger) (int, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	total := 0
+	for _, col := range encryptedColumns {
+		rewritten, err := encryptColumn(ctx, db, cipher, col, logger)
+		total += rewritten
+		if err != nil {
+			return total, fmt.Errorf("failed to encrypt %s.%s: %w", col.table, col.column, err)
+		}
+		if rewritten > 0 {
+			logger.Info("Encrypted field values",
+				zap.String("table", col.table),
+				zap.String("column", col.column),
+				zap.Int("count", rewritten))
+		}
+	}
+	return total, nil
+}
+
+// encryptColumn rewrites the values of col not yet under the current key,
+// walking the table in id order
+func encryptColumn(ctx context.Context, db *sql.DB, cipher *crypto.Cipher, col encryptedColumn, logger *zap.Logger) (int, error) {
+	query := fmt.Sprintf(`
+		SELECT CAST(id AS TEXT), %[2]s FROM %[1]s
+		WHERE %[2]s IS NOT NULL AND %[2]s <> '' AND %[2]s NOT LIKE $1 AND CAST(id AS TEXT) > $2
+		ORDER BY CAST(id AS TEXT) LIMIT $3
+	`, col.table, col.column)
+
+	set := col.column + ` = $1`
+	if col.index != "" {
+		set += `, ` + col.index + ` = $2`
+	}
+
+	rewritten := 0
+	last := ""
+	for {
+		ids, values, err := nextValues(ctx, db, query, cipher.CurrentPrefix()+"%", last)
+		if err != nil {
+			return rewritten, err
+		}
+		if len(ids) == 0 {
+			return rewritten, nil
+		}
+		last = ids[len(ids)-1]
+
+		for i, id := range ids {
+			plaintext, err := cipher.Decrypt(values[i])
+			if err != nil {
+				logger.Warn("Skipping field value that cannot be decrypted",
+					zap.Error(err),
+					zap.String("table", col.table),
+					zap.String("id", id))
+				continue
+			}
+			encrypted, err := cipher.Encrypt(plaintext)
+			if err != nil {
+				return rewritten, err
+			}
+
+			args := []interface{}{encrypted}
+			if col.index != "" {
+				args = append(args, cipher.BlindIndex(plaintext))
+			}
+			args = append(args, id, values[i])
+			// Matching the old value leaves concurrent edits in place
+			_, err = db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET %s WHERE CAST(id AS TEXT) = $%d AND %s = $%d`,
+				col.table, set, len(args)-1, col.column, len(args)), args...)
+			if err != nil {
+				// Typically two legacy emails differing only in case
+				logger.Warn("Skipping field value that cannot be rewritten",
+					zap.Error(err),
+					zap.String("table", col.table),
+					zap.String("id", id))
+				continue
+			}
+			rewritten++
+		}
+	}
+}
+
+// nextValues reads the next batch of ids and values for encryptColumn
+func nextValues(ctx context.Context, db *sql.DB, query, current, after string) ([]string, []string, error) {
+	rows, err := db.QueryContext(ctx, query, current, after, fieldEncryptionBatch)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var ids, values []string
+	for rows.Next() {
+		var id, value string
+		if err := rows.Scan(&id, &value); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+		values = append(values, value)
+	}
+	return ids, values, rows.Err()
+}
@@ -0,0 +1,151 @@
+package security
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrIdempotencyKeyInUse is returned while an earlier request with the
+	// same key is still being processed
+	ErrIdempotencyKeyInUse = errors.New("idempotency key in use")
+	// ErrIdempotencyKeyReused is returned when a key is sent again with a
+	// different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused for a different request")
+)
+
+// defaultIdempotencyLockTimeout is how long a request may hold its key
+// before a retry may take it over, in case the API died mid-request
+const defaultIdempotencyLockTimeout = time.Minute
+
+// IdempotentResponse is a stored response to a mutation
+type IdempotentResponse struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// IdempotencyStore remembers the responses to mutations sent with an
+// idempotency key, so a client retrying after a timeout gets the first
+// response back rather than applying the change twice. Keys belong to the
+// principal that sent them and expire after a TTL. State is kept in
+// Postgres so retries landing on another API replica are recognised.
+type IdempotencyStore struct {
+	db          *sql.DB
+	logger      *zap.Logger
+	ttl         time.Duration
+	lockTimeout time.Duration
+}
+
+// IdempotencyConfig holds idempotency key configuration
+type IdempotencyConfig struct {
+	TTL         time.Duration // How long responses are kept for replay
+	LockTimeout time.Duration // How long an unfinished request holds its key; 0 uses one minute
+}
+
+// NewIdempotencyStore creates a new idempotency store
+func NewIdempotencyStore(db *sql.DB, config IdempotencyConfig, logger *zap.Logger) *IdempotencyStore {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.LockTimeout <= 0 {
+		config.LockTimeout = defaultIdempotencyLockTimeout
+	}
+
+	return &IdempotencyStore{
+		db:          db,
+		logger:      logger,
+		ttl:         config.TTL,
+		lockTimeout: config.LockTimeout,
+	}
+}
+
+// Begin claims key for principal's request with requestHash. It returns
+// nil if the caller now holds the key and should process the request,
+// then Complete or Release it; or the stored response if the same request
+// was already processed. ErrIdempotencyKeyInUse and ErrIdempotencyKeyReused
+// report a key held by another request.
+func (s *IdempotencyStore) Begin(ctx context.Context, principal, key, requestHash string) (*IdempotentResponse, error) {
+	now := time.Now().UTC()
+
+	// Expired keys, and keys left by requests that never finished, are
+	// trimmed here rather than in a separate job
+	if _, err := s.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE created_at <= $1 OR (status_code IS NULL AND created_at <= $2)
+	`, now.Add(-s.ttl), now.Add(-s.lockTimeout)); err != nil {
+		s.logger.Error("Failed to trim idempotency keys", zap.Error(err))
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (principal, idempotency_key, request_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (principal, idempotency_key) DO NOTHING
+	`, principal, key, requestHash, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	if claimed, err := result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+	} else if claimed == 1 {
+		return nil, nil
+	}
+
+	var (
+		storedHash  string
+		statusCode  sql.NullInt64
+		contentType string
+		body        []byte
+	)
+	err = s.db.QueryRowContext(ctx, `
+		SELECT request_hash, status_code, content_type, response_body
+		FROM idempotency_keys WHERE principal = $1 AND idempotency_key = $2
+	`, principal, key).Scan(&storedHash, &statusCode, &contentType, &body)
+	if err == sql.ErrNoRows {
+		// Released between the insert and the select; the retry can try again
+		return nil, ErrIdempotencyKeyInUse
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query idempotency key: %w", err)
+	}
+
+	if storedHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !statusCode.Valid {
+		return nil, ErrIdempotencyKeyInUse
+	}
+	return &IdempotentResponse{
+		StatusCode:  int(statusCode.Int64),
+		ContentType: contentType,
+		Body:        body,
+	}, nil
+}
+
+// Complete stores the response to the request holding key, to be replayed
+// to retries
+func (s *IdempotencyStore) Complete(ctx context.Context, principal, key string, response IdempotentResponse) error {
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE idempotency_keys SET status_code = $1, content_type = $2, response_body = $3
+		WHERE principal = $4 AND idempotency_key = $5
+	`, response.StatusCode, response.ContentType, response.Body, principal, key); err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Release frees key without storing a response, so a retry is processed
+// afresh. It is used when the request failed in a way worth retrying.
+func (s *IdempotencyStore) Release(ctx context.Context, principal, key string) error {
+	if _, err := s.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys WHERE principal = $1 AND idempotency_key = $2 AND status_code IS NULL
+	`, principal, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
@@ -22,6 +22,7 @@ type Claims struct {
 	UserID   string      `json:"user_id"`
 	Username string      `json:"username"`
 	Role     models.Role `json:"role"`
+	OrgID    string      `json:"org_id,omitempty"` // Unset in tokens issued before organizations
 	jwt.RegisteredClaims
 }
 
@@ -52,6 +53,7 @@ func (m *JWTManager) GenerateAccessToken(user *models.User) (string, error) {
 		UserID:   user.ID,
 		Username: user.Username,
 		Role:     user.Role,
+		OrgID:    user.OrgID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    m.issuer,
 			Audience:  jwt.ClaimStrings{m.audience},
@@ -73,6 +75,7 @@ func (m *JWTManager) GenerateRefreshToken(user *models.User) (string, error) {
 		UserID:   user.ID,
 		Username: user.Username,
 		Role:     user.Role,
+		OrgID:    user.OrgID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    m.issuer,
 			Audience:  jwt.ClaimStrings{m.audience},
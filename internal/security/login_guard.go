@@ -0,0 +1,198 @@
+package security
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// LoginVerdict says whether a login attempt may proceed
+type LoginVerdict int
+
+const (
+	LoginAllowed     LoginVerdict = iota
+	LoginRateLimited              // Too many recent failures from the client's IP
+	LoginLocked                   // The account is locked after repeated failures
+)
+
+// LoginGuard protects logins against brute force. It counts failures per
+// account, locking the account for a cooldown once they reach a limit, and
+// per client IP, refusing further attempts from an IP with too many recent
+// failures. State is kept in Postgres so it is shared between API replicas.
+type LoginGuard struct {
+	db            *sql.DB
+	auditLogger   *AuditLogger
+	logger        *zap.Logger
+	maxFailures   int
+	lockout       time.Duration
+	ipMaxFailures int
+	ipWindow      time.Duration
+}
+
+// LoginGuardConfig holds brute-force protection configuration
+type LoginGuardConfig struct {
+	MaxFailures   int           // Consecutive failures that lock an account; 0 disables locking
+	Lockout       time.Duration // How long an account stays locked
+	IPMaxFailures int           // Failures within IPWindow that block an IP; 0 disables IP limiting
+	IPWindow      time.Duration // Window for counting failures per IP
+}
+
+// NewLoginGuard creates a new login guard. auditLogger may be nil.
+func NewLoginGuard(db *sql.DB, config LoginGuardConfig, auditLogger *AuditLogger, logger *zap.Logger) *LoginGuard {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &LoginGuard{
+		db:            db,
+		auditLogger:   auditLogger,
+		logger:        logger,
+		maxFailures:   config.MaxFailures,
+		lockout:       config.Lockout,
+		ipMaxFailures: config.IPMaxFailures,
+		ipWindow:      config.IPWindow,
+	}
+}
+
+// Check decides whether a login for username from ip may proceed and, if
+// not, how long the client should wait. Database errors are logged and
+// the attempt allowed, so an outage does not lock everyone out.
+func (g *LoginGuard) Check(ctx context.Context, username, ip string) (LoginVerdict, time.Duration) {
+	now := time.Now().UTC()
+
+	if g.ipMaxFailures > 0 {
+		var failures int
+		err := g.db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM login_failures WHERE ip_address = $1 AND attempted_at > $2
+		`, ip, now.Add(-g.ipWindow)).Scan(&failures)
+		if err != nil {
+			g.logger.Error("Failed to count login failures", zap.Error(err), zap.String("ip", ip))
+		} else if failures >= g.ipMaxFailures {
+			g.audit(ctx, "", "login_rate_limited", "429", ip, map[string]interface{}{
+				"username": username,
+				"failures": failures,
+			})
+			return LoginRateLimited, g.ipWindow
+		}
+	}
+
+	if g.maxFailures > 0 {
+		lockedUntil, err := g.lockedUntil(ctx, username)
+		if err != nil {
+			g.logger.Error("Failed to check account lock", zap.Error(err), zap.String("username", username))
+		} else if lockedUntil.After(now) {
+			g.audit(ctx, "", "login_locked_out", "423", ip, map[string]interface{}{
+				"username":     username,
+				"locked_until": lockedUntil,
+			})
+			return LoginLocked, lockedUntil.Sub(now)
+		}
+	}
+
+	return LoginAllowed, 0
+}
+
+// RecordFailure notes a failed login for username from ip, whether or not
+// the username exists. It reports whether this failure locked the account.
+func (g *LoginGuard) RecordFailure(ctx context.Context, username, ip string) bool {
+	now := time.Now().UTC()
+
+	if g.ipMaxFailures > 0 {
+		// Failures older than the window no longer count, so trim them here
+		// rather than in a separate job
+		if _, err := g.db.ExecContext(ctx, `
+			DELETE FROM login_failures WHERE attempted_at <= $1
+		`, now.Add(-g.ipWindow)); err != nil {
+			g.logger.Error("Failed to trim login failures", zap.Error(err))
+		}
+		if _, err := g.db.ExecContext(ctx, `
+			INSERT INTO login_failures (username, ip_address, attempted_at) VALUES ($1, $2, $3)
+		`, username, ip, now); err != nil {
+			g.logger.Error("Failed to record login failure", zap.Error(err), zap.String("ip", ip))
+		}
+	}
+
+	locked := false
+	if g.maxFailures > 0 {
+		// Reaching the limit locks the account and restarts the count, so
+		// one more failure after the cooldown does not lock it again
+		_, err := g.db.ExecContext(ctx, `
+			UPDATE users SET
+				locked_until = CASE WHEN failed_login_attempts + 1 >= $1 THEN $2 ELSE locked_until END,
+				failed_login_attempts = CASE WHEN failed_login_attempts + 1 >= $1 THEN 0 ELSE failed_login_attempts + 1 END
+			WHERE username = $3
+		`, g.maxFailures, now.Add(g.lockout), username)
+		if err != nil {
+			g.logger.Error("Failed to record account login failure", zap.Error(err), zap.String("username", username))
+		} else if lockedUntil, err := g.lockedUntil(ctx, username); err == nil {
+			locked = lockedUntil.After(now)
+		}
+	}
+
+	g.audit(ctx, "", "login_failed", "401", ip, map[string]interface{}{"username": username})
+	if locked {
+		g.logger.Warn("Account locked after repeated login failures",
+			zap.String("username", username),
+			zap.String("ip", ip),
+			zap.Duration("lockout", g.lockout))
+		g.audit(ctx, "", "account_locked", "423", ip, map[string]interface{}{
+			"username": username,
+			"lockout":  g.lockout.String(),
+		})
+	}
+	return locked
+}
+
+// Lockout returns how long an account stays locked
+func (g *LoginGuard) Lockout() time.Duration {
+	return g.lockout
+}
+
+// RecordSuccess clears the failure count and any lock on a user after a
+// successful login
+func (g *LoginGuard) RecordSuccess(ctx context.Context, userID, ip string) {
+	if g.maxFailures > 0 {
+		if _, err := g.db.ExecContext(ctx, `
+			UPDATE users SET failed_login_attempts = 0, locked_until = NULL WHERE id = $1
+		`, userID); err != nil {
+			g.logger.Error("Failed to reset login failures", zap.Error(err), zap.String("user_id", userID))
+		}
+	}
+
+	g.audit(ctx, userID, "login", "200", ip, nil)
+}
+
+// lockedUntil returns when username's lock ends, or the zero time if the
+// user is unknown or not locked
+func (g *LoginGuard) lockedUntil(ctx context.Context, username string) (time.Time, error) {
+	var lockedUntil sql.NullTime
+	err := g.db.QueryRowContext(ctx, `
+		SELECT locked_until FROM users WHERE username = $1
+	`, username).Scan(&lockedUntil)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query account lock: %w", err)
+	}
+	return lockedUntil.Time, nil
+}
+
+// audit records a login event, with the HTTP status the client received
+// and the request ID, if an audit logger is set
+func (g *LoginGuard) audit(ctx context.Context, userID, action, status, ip string, details map[string]interface{}) {
+	if g.auditLogger == nil {
+		return
+	}
+	if requestID := utils.RequestIDFromContext(ctx); requestID != "" {
+		if details == nil {
+			details = make(map[string]interface{})
+		}
+		details["request_id"] = requestID
+	}
+	g.auditLogger.Log(userID, action, "/api/v1/auth/login", status, ip, details)
+}
@@ -0,0 +1,219 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms
+const (
+	PasswordAlgorithmBcrypt   = "bcrypt"
+	PasswordAlgorithmArgon2id = "argon2id"
+)
+
+// argon2idPrefix starts every argon2id hash. Hashes are stored in the PHC
+// string format, $argon2id$v=19$m=<KiB>,t=<iterations>,p=<parallelism>$<salt>$<key>,
+// while bcrypt hashes start $2a$ or $2b$, so the stored hash says how to
+// check it and users keep working whichever algorithm is configured.
+const argon2idPrefix = "$argon2id$"
+
+// maxArgon2idPasswordBytes bounds passwords hashed with argon2id, which
+// unlike bcrypt has no length limit of its own
+const maxArgon2idPasswordBytes = 1024
+
+// ErrPasswordTooShort is returned when a new password is below the
+// configured minimum length
+var ErrPasswordTooShort = errors.New("password too short")
+
+// ErrPasswordTooLong is returned when a new password exceeds the 72 bytes
+// bcrypt can hash, or 1024 bytes for argon2id
+var ErrPasswordTooLong = errors.New("password too long")
+
+// PasswordManager hashes and checks passwords and issues one-time reset
+// tokens
+type PasswordManager struct {
+	minLength   int
+	algorithm   string
+	hashCost    int
+	argon2      Argon2Params
+	resetExpiry time.Duration
+}
+
+// PasswordConfig holds password policy configuration
+type PasswordConfig struct {
+	MinLength   int           // Minimum length in characters
+	Algorithm   string        // bcrypt or argon2id; defaults to bcrypt
+	HashCost    int           // bcrypt cost; defaults to bcrypt.DefaultCost
+	Argon2      Argon2Params  // argon2id parameters; zero fields take the defaults
+	ResetExpiry time.Duration // Lifetime of reset tokens; defaults to 24 hours
+}
+
+// Argon2Params are the argon2id cost parameters
+type Argon2Params struct {
+	Memory      uint32 // KiB; defaults to 64 MiB
+	Iterations  uint32 // Defaults to 3
+	Parallelism uint8  // Defaults to 4
+}
+
+// NewPasswordManager creates a new password manager
+func NewPasswordManager(config PasswordConfig) *PasswordManager {
+	if config.Algorithm == "" {
+		config.Algorithm = PasswordAlgorithmBcrypt
+	}
+	if config.HashCost == 0 {
+		config.HashCost = bcrypt.DefaultCost
+	}
+	if config.Argon2.Memory == 0 {
+		config.Argon2.Memory = 64 * 1024
+	}
+	if config.Argon2.Iterations == 0 {
+		config.Argon2.Iterations = 3
+	}
+	if config.Argon2.Parallelism == 0 {
+		config.Argon2.Parallelism = 4
+	}
+	if config.ResetExpiry <= 0 {
+		config.ResetExpiry = 24 * time.Hour
+	}
+
+	return &PasswordManager{
+		minLength:   config.MinLength,
+		algorithm:   config.Algorithm,
+		hashCost:    config.HashCost,
+		argon2:      config.Argon2,
+		resetExpiry: config.ResetExpiry,
+	}
+}
+
+// Hash checks password against the policy and returns its hash under the
+// configured algorithm
+func (m *PasswordManager) Hash(password string) (string, error) {
+	if utf8.RuneCountInString(password) < m.minLength {
+		return "", fmt.Errorf("%w: must be at least %d characters", ErrPasswordTooShort, m.minLength)
+	}
+	return m.Rehash(password)
+}
+
+// Rehash hashes a password under the configured algorithm without the
+// length policy, for migrating a password that has just been verified
+// against an outdated hash
+func (m *PasswordManager) Rehash(password string) (string, error) {
+	if m.algorithm == PasswordAlgorithmArgon2id {
+		if len(password) > maxArgon2idPasswordBytes {
+			return "", ErrPasswordTooLong
+		}
+		return m.hashArgon2id(password)
+	}
+
+	if len(password) > 72 {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), m.hashCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// Compare reports whether password matches hash, made by either algorithm
+func (m *PasswordManager) Compare(hash, password string) bool {
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		params, salt, key, err := parseArgon2id(hash)
+		if err != nil {
+			return false
+		}
+		derived := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(derived, key) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NeedsRehash reports whether hash was made with a different algorithm or
+// cost than is configured, so should be replaced at the next login
+func (m *PasswordManager) NeedsRehash(hash string) bool {
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		if m.algorithm != PasswordAlgorithmArgon2id {
+			return true
+		}
+		params, _, _, err := parseArgon2id(hash)
+		return err != nil || params != m.argon2
+	}
+
+	if m.algorithm != PasswordAlgorithmBcrypt {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != m.hashCost
+}
+
+// hashArgon2id hashes password with a random salt in the PHC string format
+func (m *PasswordManager) hashArgon2id(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, m.argon2.Iterations, m.argon2.Memory, m.argon2.Parallelism, 32)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		m.argon2.Memory, m.argon2.Iterations, m.argon2.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// parseArgon2id splits a PHC argon2id hash into its parameters, salt and key
+func parseArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errors.New("malformed argon2id key")
+	}
+	return params, salt, key, nil
+}
+
+// GenerateResetToken returns a random reset token, the hash to store in
+// its place, and when it expires
+func (m *PasswordManager) GenerateResetToken() (token, tokenHash string, expiresAt time.Time, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", time.Time{}, fmt.Errorf("failed to generate reset token: %w", err)
+	}
+
+	token = hex.EncodeToString(raw)
+	return token, HashResetToken(token), time.Now().Add(m.resetExpiry), nil
+}
+
+// HashResetToken returns the stored form of a reset token. Tokens are
+// random, so an unsalted SHA-256 is enough to keep them unusable if the
+// table leaks.
+func HashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
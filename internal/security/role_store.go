@@ -0,0 +1,357 @@
+package security
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrRoleNotFound is returned for a role that does not exist
+	ErrRoleNotFound = errors.New("role not found")
+	// ErrRoleExists is returned when creating a role whose name is taken
+	ErrRoleExists = errors.New("role already exists")
+	// ErrRoleInUse is returned when deleting a role that users still hold
+	ErrRoleInUse = errors.New("role is assigned to users")
+	// ErrBuiltInRole is returned when deleting a built-in role, or changing
+	// the admin role's permissions
+	ErrBuiltInRole = errors.New("built-in role cannot be changed")
+)
+
+// PermissionChecker resolves whether a role grants a permission
+type PermissionChecker interface {
+	HasPermission(ctx context.Context, role models.Role, permission string) bool
+}
+
+// StaticRoles grants fixed permissions per role, without a database
+type StaticRoles map[models.Role][]string
+
+// HasPermission reports whether role grants permission
+func (r StaticRoles) HasPermission(ctx context.Context, role models.Role, permission string) bool {
+	for _, p := range r[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRoles are the built-in roles' permissions, as seeded by the
+// migrations
+var DefaultRoles = StaticRoles{
+	models.RoleAdmin: {
+		"read:outliers", "read:transactions", "read:statistics", "read:users", "read:audit",
+		"stream:transactions", "write:outliers", "trigger:detection", "manage:users", "manage:system",
+		"manage:webhooks", "export:sar",
+	},
+	models.RoleAnalyst: {
+		"read:outliers", "read:transactions", "read:statistics",
+		"stream:transactions", "write:outliers", "trigger:detection", "export:sar",
+	},
+	models.RoleViewer: {
+		"read:outliers", "read:transactions", "read:statistics",
+	},
+}
+
+// RoleStore keeps role→permission mappings in the roles and
+// role_permissions tables. Lookups are served from a cache reloaded every
+// CacheTTL, so edits made on another API instance apply within that time.
+type RoleStore struct {
+	db       *sql.DB
+	logger   *zap.Logger
+	cacheTTL time.Duration
+
+	mu       sync.RWMutex
+	cache    map[models.Role]map[string]bool
+	loadedAt time.Time
+}
+
+// RoleStoreConfig holds role store configuration
+type RoleStoreConfig struct {
+	CacheTTL time.Duration // How long cached permissions are used; defaults to 30 seconds
+}
+
+// NewRoleStore creates a new role store
+func NewRoleStore(db *sql.DB, config RoleStoreConfig, logger *zap.Logger) *RoleStore {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.CacheTTL <= 0 {
+		config.CacheTTL = 30 * time.Second
+	}
+
+	return &RoleStore{
+		db:       db,
+		logger:   logger,
+		cacheTTL: config.CacheTTL,
+	}
+}
+
+// HasPermission reports whether role grants permission. If the cache cannot
+// be loaded the last loaded permissions are used, or none at all.
+func (s *RoleStore) HasPermission(ctx context.Context, role models.Role, permission string) bool {
+	s.mu.RLock()
+	fresh := s.cache != nil && time.Since(s.loadedAt) < s.cacheTTL
+	granted := s.cache[role][permission]
+	s.mu.RUnlock()
+	if fresh {
+		return granted
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cache == nil || time.Since(s.loadedAt) >= s.cacheTTL {
+		cache, err := s.load(ctx)
+		if err != nil {
+			s.logger.Error("Failed to load role permissions", zap.Error(err))
+		} else {
+			s.cache = cache
+			s.loadedAt = time.Now()
+		}
+	}
+	return s.cache[role][permission]
+}
+
+// Invalidate drops cached permissions so the next lookup reloads them
+func (s *RoleStore) Invalidate() {
+	s.mu.Lock()
+	s.cache = nil
+	s.mu.Unlock()
+}
+
+// load reads every role's permissions
+func (s *RoleStore) load(ctx context.Context) (map[models.Role]map[string]bool, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT role, permission FROM role_permissions`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query role permissions: %w", err)
+	}
+	defer rows.Close()
+
+	cache := make(map[models.Role]map[string]bool)
+	for rows.Next() {
+		var role models.Role
+		var permission string
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, fmt.Errorf("failed to scan role permission: %w", err)
+		}
+		if cache[role] == nil {
+			cache[role] = make(map[string]bool)
+		}
+		cache[role][permission] = true
+	}
+	return cache, rows.Err()
+}
+
+// ListRoles returns every role with its permissions, ordered by name
+func (s *RoleStore) ListRoles(ctx context.Context) ([]models.RoleDefinition, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT name, COALESCE(description, ''), built_in, created_at FROM roles ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []models.RoleDefinition{}
+	index := make(map[models.Role]int)
+	for rows.Next() {
+		var role models.RoleDefinition
+		if err := rows.Scan(&role.Name, &role.Description, &role.BuiltIn, &role.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		role.Permissions = []string{}
+		index[role.Name] = len(roles)
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read roles: %w", err)
+	}
+
+	permissions, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for name, granted := range permissions {
+		if i, ok := index[name]; ok {
+			roles[i].Permissions = sortedPermissions(granted)
+		}
+	}
+	return roles, nil
+}
+
+// GetRole returns a single role, or ErrRoleNotFound
+func (s *RoleStore) GetRole(ctx context.Context, name models.Role) (*models.RoleDefinition, error) {
+	role := models.RoleDefinition{Name: name, Permissions: []string{}}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(description, ''), built_in, created_at FROM roles WHERE name = $1
+	`, name).Scan(&role.Description, &role.BuiltIn, &role.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query role: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT permission FROM role_permissions WHERE role = $1 ORDER BY permission
+	`, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query role permissions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, fmt.Errorf("failed to scan role permission: %w", err)
+		}
+		role.Permissions = append(role.Permissions, permission)
+	}
+	return &role, rows.Err()
+}
+
+// CreateRole creates a custom role, or returns ErrRoleExists
+func (s *RoleStore) CreateRole(ctx context.Context, name models.Role, description string, permissions []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO roles (name, description, built_in, created_at)
+		VALUES ($1, $2, false, $3)
+		ON CONFLICT DO NOTHING
+	`, name, description, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to create role: %w", err)
+	}
+	if created, err := result.RowsAffected(); err == nil && created == 0 {
+		return ErrRoleExists
+	}
+
+	if err := insertPermissions(ctx, tx, name, permissions); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit role: %w", err)
+	}
+
+	s.Invalidate()
+	return nil
+}
+
+// UpdateRole changes a role's description and, if permissions is not nil,
+// replaces its permissions. The admin role's permissions cannot change, so
+// there is always a role that can manage users and roles.
+func (s *RoleStore) UpdateRole(ctx context.Context, name models.Role, description *string, permissions []string) error {
+	if name == models.RoleAdmin && permissions != nil {
+		return ErrBuiltInRole
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1)`, name).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to query role: %w", err)
+	}
+	if !exists {
+		return ErrRoleNotFound
+	}
+
+	if description != nil {
+		if _, err := tx.ExecContext(ctx, `UPDATE roles SET description = $1 WHERE name = $2`, *description, name); err != nil {
+			return fmt.Errorf("failed to update role: %w", err)
+		}
+	}
+	if permissions != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role = $1`, name); err != nil {
+			return fmt.Errorf("failed to clear role permissions: %w", err)
+		}
+		if err := insertPermissions(ctx, tx, name, permissions); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit role: %w", err)
+	}
+
+	s.Invalidate()
+	return nil
+}
+
+// DeleteRole deletes a custom role that no user holds
+func (s *RoleStore) DeleteRole(ctx context.Context, name models.Role) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var builtIn bool
+	err = tx.QueryRowContext(ctx, `SELECT built_in FROM roles WHERE name = $1`, name).Scan(&builtIn)
+	if err == sql.ErrNoRows {
+		return ErrRoleNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query role: %w", err)
+	}
+	if builtIn {
+		return ErrBuiltInRole
+	}
+
+	var holders int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE role = $1`, name).Scan(&holders); err != nil {
+		return fmt.Errorf("failed to count role holders: %w", err)
+	}
+	if holders > 0 {
+		return ErrRoleInUse
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role = $1`, name); err != nil {
+		return fmt.Errorf("failed to delete role permissions: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM roles WHERE name = $1`, name); err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit role deletion: %w", err)
+	}
+
+	s.Invalidate()
+	return nil
+}
+
+// insertPermissions grants permissions to role
+func insertPermissions(ctx context.Context, tx *sql.Tx, role models.Role, permissions []string) error {
+	for _, permission := range permissions {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO role_permissions (role, permission) VALUES ($1, $2) ON CONFLICT DO NOTHING
+		`, role, permission); err != nil {
+			return fmt.Errorf("failed to grant %s: %w", permission, err)
+		}
+	}
+	return nil
+}
+
+// sortedPermissions lists a permission set in order
+func sortedPermissions(granted map[string]bool) []string {
+	permissions := make([]string, 0, len(granted))
+	for permission := range granted {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return permissions
+}
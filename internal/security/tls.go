@@ -0,0 +1,185 @@
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// CertReloaderConfig holds configuration for a certificate reloader
+type CertReloaderConfig struct {
+	CertFile      string
+	KeyFile       string
+	CheckInterval time.Duration // How often the files are checked for changes; defaults to 1 minute
+}
+
+// CertReloader serves a certificate and key from files, picking up
+// replacements such as renewals by cert-manager without a restart. The
+// files are checked for changes at most once per CheckInterval, during
+// handshakes; if a changed pair fails to load, the previous certificate is
+// kept.
+type CertReloader struct {
+	config  CertReloaderConfig
+	logger  *zap.Logger
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	loaded  time.Time // Modification time of the loaded files
+	checked time.Time
+}
+
+// NewCertReloader loads the certificate and key, failing if they cannot be
+// loaded now
+func NewCertReloader(config CertReloaderConfig, logger *zap.Logger) (*CertReloader, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, errors.New("certificate and key files are required")
+	}
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = time.Minute
+	}
+
+	r := &CertReloader{
+		config: config,
+		logger: logger,
+	}
+	modTime, err := r.filesModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.current(), nil
+}
+
+// GetClientCertificate returns the current certificate, for tls.Config
+// on clients authenticating with mTLS
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.current(), nil
+}
+
+// current returns the certificate, reloading it if the files have changed
+// since they were last loaded
+func (r *CertReloader) current() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) >= r.config.CheckInterval {
+		r.checked = time.Now()
+		modTime, err := r.filesModTime()
+		if err != nil {
+			r.logger.Warn("Failed to check TLS certificate", zap.Error(err))
+		} else if !modTime.Equal(r.loaded) {
+			if err := r.load(modTime); err != nil {
+				r.logger.Error("Failed to reload TLS certificate, keeping the previous one",
+					zap.Error(err),
+					zap.String("cert_file", r.config.CertFile))
+			} else {
+				r.logger.Info("TLS certificate reloaded",
+					zap.String("cert_file", r.config.CertFile),
+					zap.Time("not_after", r.cert.Leaf.NotAfter))
+			}
+		}
+	}
+	return r.cert
+}
+
+// filesModTime returns the later modification time of the certificate and key
+func (r *CertReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.config.CertFile, r.config.KeyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to stat %s: %w", file, err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// load reads the certificate and key, recording modTime as their version
+func (r *CertReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return fmt.Errorf("failed to parse certificate: %w", err)
+		}
+	}
+
+	r.cert = &cert
+	r.loaded = modTime
+	r.checked = time.Now()
+	return nil
+}
+
+// ServerTLSConfig returns a TLS configuration serving the reloader's
+// certificate
+func ServerTLSConfig(reloader *CertReloader) *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+}
+
+// ClientTLSFiles names the files for a TLS client. All are optional: CAFile
+// replaces the system roots for verifying the server, and CertFile and
+// KeyFile together present a client certificate for mTLS.
+type ClientTLSFiles struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+// ClientTLSConfig returns a TLS configuration for calling an internal
+// service, or nil if files names none. A client certificate is reloaded
+// like a server's.
+func ClientTLSConfig(files ClientTLSFiles, logger *zap.Logger) (*tls.Config, error) {
+	if files.CertFile == "" && files.KeyFile == "" && files.CAFile == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if files.CAFile != "" {
+		pem, err := os.ReadFile(files.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", files.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if files.CertFile != "" || files.KeyFile != "" {
+		reloader, err := NewCertReloader(CertReloaderConfig{
+			CertFile: files.CertFile,
+			KeyFile:  files.KeyFile,
+		}, logger)
+		if err != nil {
+			return nil, err
+		}
+		config.GetClientCertificate = reloader.GetClientCertificate
+	}
+
+	return config, nil
+}
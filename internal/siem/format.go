@@ -0,0 +1,319 @@
+package siem
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/notify"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/pkg/models"
+)
+
+// Format is how events are written
+type Format string
+
+const (
+	// FormatCEF is ArcSight's Common Event Format
+	FormatCEF Format = "cef"
+	// FormatLEEF is QRadar's Log Event Extended Format, version 2.0
+	FormatLEEF Format = "leef"
+	// FormatJSON is one JSON object per event
+	FormatJSON Format = "json"
+)
+
+// Valid reports whether f is a known format
+func (f Format) Valid() bool {
+	switch f {
+	case FormatCEF, FormatLEEF, FormatJSON:
+		return true
+	}
+	return false
+}
+
+// Event kinds, used as the syslog MSGID and the CEF and LEEF category
+const (
+	kindOutlier = "outlier"
+	kindAudit   = "audit"
+)
+
+// vendor and product name StableRisk in CEF and LEEF headers
+const (
+	vendor  = "StableRisk"
+	product = "StableRisk"
+)
+
+// leefTimeFormat is the devTimeFormat of LEEF events, matching devTime
+const (
+	leefTimeFormat   = "yyyy-MM-dd'T'HH:mm:ss.SSSZ"
+	leefTimeLayout   = "2006-01-02T15:04:05.000-0700"
+	leefDelimiter    = "\t"
+	leefDelimiterHex = "x09"
+)
+
+// message is a formatted event
+type message struct {
+	kind     string
+	at       time.Time
+	severity int // Syslog severity, 0 (emergency) to 7 (debug)
+	json     bool
+	body     []byte
+}
+
+// field is a key and value in a CEF extension or LEEF attributes
+type field struct {
+	key, value string
+}
+
+// outlierSeverities rate outliers from 0 to 10, as CEF, LEEF and the JSON
+// format do
+var outlierSeverities = map[models.Severity]int{
+	models.SeverityLow:      3,
+	models.SeverityMedium:   5,
+	models.SeverityHigh:     8,
+	models.SeverityCritical: 10,
+}
+
+// outlierSyslogSeverities are the syslog severities of outliers
+var outlierSyslogSeverities = map[models.Severity]int{
+	models.SeverityLow:      5, // notice
+	models.SeverityMedium:   4, // warning
+	models.SeverityHigh:     3, // error
+	models.SeverityCritical: 2, // critical
+}
+
+// jsonEvent is an event in the JSON format
+type jsonEvent struct {
+	Source      string             `json:"source"`
+	Kind        string             `json:"kind"`
+	Time        time.Time          `json:"time"`
+	Severity    int                `json:"severity"` // 0 to 10
+	IncidentKey string             `json:"incident_key,omitempty"`
+	Outlier     *models.Outlier    `json:"outlier,omitempty"`
+	Audit       *security.AuditLog `json:"audit,omitempty"`
+}
+
+// outlierMessage writes an outlier in format
+func outlierMessage(outlier models.Outlier, format Format, version string) message {
+	msg := message{
+		kind:     kindOutlier,
+		at:       outlier.DetectedAt.UTC(),
+		severity: outlierSyslogSeverities[outlier.Severity],
+	}
+	if msg.severity == 0 {
+		msg.severity = 5
+	}
+	severity := outlierSeverities[outlier.Severity]
+	name := fmt.Sprintf("%s %s outlier", strings.ToUpper(string(outlier.Severity)), outlier.Type)
+	if outlier.Address != "" {
+		name += " on " + outlier.Address
+	}
+	orgID := outlier.OrgID
+	if orgID == "" {
+		orgID = models.DefaultOrganizationID
+	}
+	amount := ""
+	if !outlier.Amount.IsZero() {
+		amount = outlier.Amount.String()
+	}
+
+	switch format {
+	case FormatJSON:
+		msg.json = true
+		msg.body, _ = json.Marshal(jsonEvent{
+			Source:      "stablerisk",
+			Kind:        kindOutlier,
+			Time:        msg.at,
+			Severity:    severity,
+			IncidentKey: notify.IncidentKey(outlier),
+			Outlier:     &outlier,
+		})
+	case FormatLEEF:
+		msg.body = leef(version, "outlier:"+string(outlier.Type), []field{
+			{"devTime", msg.at.Format(leefTimeLayout)},
+			{"devTimeFormat", leefTimeFormat},
+			{"cat", kindOutlier},
+			{"sev", strconv.Itoa(severity)},
+			{"name", name},
+			{"outlierId", outlier.ID},
+			{"outlierType", string(outlier.Type)},
+			{"address", outlier.Address},
+			{"transactionHash", outlier.TransactionHash},
+			{"amount", amount},
+			{"status", string(outlier.Status)},
+			{"orgId", orgID},
+			{"incidentKey", notify.IncidentKey(outlier)},
+		})
+	default:
+		msg.body = cef(version, "outlier:"+string(outlier.Type), name, severity, []field{
+			{"rt", strconv.FormatInt(msg.at.UnixMilli(), 10)},
+			{"cat", kindOutlier},
+			{"externalId", outlier.ID},
+			{"act", string(outlier.Type)},
+			{"cs1Label", "address"},
+			{"cs1", outlier.Address},
+			{"cs2Label", "transactionHash"},
+			{"cs2", outlier.TransactionHash},
+			{"cs3Label", "amount"},
+			{"cs3", amount},
+			{"cs4Label", "orgId"},
+			{"cs4", orgID},
+			{"cs5Label", "incidentKey"},
+			{"cs5", notify.IncidentKey(outlier)},
+			{"cs6Label", "status"},
+			{"cs6", string(outlier.Status)},
+		})
+	}
+	return msg
+}
+
+// auditFailed reports whether an audit entry records a failure or a
+// refusal, from its status word or HTTP status code
+func auditFailed(status string) bool {
+	switch strings.ToLower(status) {
+	case "failure", "failed", "denied", "error":
+		return true
+	}
+	code, err := strconv.Atoi(status)
+	return err == nil && code >= 400
+}
+
+// auditMessage writes an audit log entry in format
+func auditMessage(entry security.AuditLog, format Format, version string) message {
+	msg := message{
+		kind:     kindAudit,
+		at:       entry.Timestamp.UTC(),
+		severity: 6, // informational
+	}
+	severity := 3
+	if auditFailed(entry.Status) {
+		msg.severity = 4 // warning
+		severity = 6
+	}
+	details := ""
+	if len(entry.Details) > 0 {
+		data, _ := json.Marshal(entry.Details)
+		details = string(data)
+	}
+	// Source addresses must be IP addresses in CEF and LEEF
+	ip := ""
+	if net.ParseIP(entry.IPAddress) != nil {
+		ip = entry.IPAddress
+	}
+	sequence := ""
+	if entry.Sequence > 0 {
+		sequence = strconv.FormatInt(entry.Sequence, 10)
+	}
+
+	switch format {
+	case FormatJSON:
+		msg.json = true
+		msg.body, _ = json.Marshal(jsonEvent{
+			Source:   "stablerisk",
+			Kind:     kindAudit,
+			Time:     msg.at,
+			Severity: severity,
+			Audit:    &entry,
+		})
+	case FormatLEEF:
+		msg.body = leef(version, "audit:"+entry.Action, []field{
+			{"devTime", msg.at.Format(leefTimeLayout)},
+			{"devTimeFormat", leefTimeFormat},
+			{"cat", kindAudit},
+			{"sev", strconv.Itoa(severity)},
+			{"auditId", entry.ID},
+			{"action", entry.Action},
+			{"usrName", entry.UserID},
+			{"src", ip},
+			{"resource", entry.Resource},
+			{"outcome", entry.Status},
+			{"sequence", sequence},
+			{"details", details},
+		})
+	default:
+		msg.body = cef(version, "audit:"+entry.Action, "Audit: "+entry.Action, severity, []field{
+			{"rt", strconv.FormatInt(msg.at.UnixMilli(), 10)},
+			{"cat", kindAudit},
+			{"externalId", entry.ID},
+			{"act", entry.Action},
+			{"suser", entry.UserID},
+			{"src", ip},
+			{"request", entry.Resource},
+			{"outcome", entry.Status},
+			{"cn1Label", "sequence"},
+			{"cn1", sequence},
+			{"cs1Label", "details"},
+			{"cs1", details},
+		})
+	}
+	return msg
+}
+
+// cef writes a CEF event. Fields without a value are left out, along with
+// the label of an unset custom field.
+func cef(version, signatureID, name string, severity int, fields []field) []byte {
+	var b strings.Builder
+	b.WriteString("CEF:0")
+	for _, header := range []string{vendor, product, version, signatureID, name, strconv.Itoa(severity)} {
+		b.WriteByte('|')
+		b.WriteString(cefHeaderEscaper.Replace(header))
+	}
+	b.WriteByte('|')
+
+	first := true
+	for i, f := range fields {
+		if f.value == "" || (strings.HasSuffix(f.key, "Label") && i+1 < len(fields) && fields[i+1].value == "") {
+			continue
+		}
+		if !first {
+			b.WriteByte(' ')
+		}
+		first = false
+		b.WriteString(f.key)
+		b.WriteByte('=')
+		b.WriteString(cefValueEscaper.Replace(f.value))
+	}
+	return []byte(b.String())
+}
+
+// cefHeaderEscaper escapes CEF header fields
+var cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+
+// cefValueEscaper escapes CEF extension values
+var cefValueEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+
+// leef writes a LEEF 2.0 event, tab delimited. Fields without a value are
+// left out.
+func leef(version, eventID string, fields []field) []byte {
+	var b strings.Builder
+	b.WriteString("LEEF:2.0")
+	for _, header := range []string{vendor, product, version, eventID, leefDelimiterHex} {
+		b.WriteByte('|')
+		b.WriteString(leefHeaderEscaper.Replace(header))
+	}
+	b.WriteByte('|')
+
+	first := true
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		if !first {
+			b.WriteString(leefDelimiter)
+		}
+		first = false
+		b.WriteString(f.key)
+		b.WriteByte('=')
+		b.WriteString(leefValueEscaper.Replace(f.value))
+	}
+	return []byte(b.String())
+}
+
+// leefHeaderEscaper escapes LEEF header fields
+var leefHeaderEscaper = strings.NewReplacer(`|`, `\|`, "\t", " ", "\r", " ", "\n", " ")
+
+// leefValueEscaper keeps values from breaking the delimiter or the line
+var leefValueEscaper = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
@@ -0,0 +1,264 @@
+// Package siem forwards outliers and audit log entries to a SIEM, so the
+// SOC can correlate StableRisk alerts with other security telemetry. Events
+// are written as CEF, LEEF or JSON and sent over syslog or to an HTTPS
+// collector, each event type with its own format and filter.
+package siem
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Transport is how events reach the SIEM
+type Transport string
+
+const (
+	TransportSyslog Transport = "syslog"
+	TransportHTTPS  Transport = "https"
+)
+
+// Config holds SIEM export configuration
+type Config struct {
+	Transport Transport
+
+	// Syslog
+	Network  string // udp, tcp or tls; defaults to udp
+	Address  string // host:port of the syslog server
+	Facility int    // Syslog facility; defaults to 16 (local0)
+	Hostname string // Sent in syslog headers; defaults to the host's name
+
+	// HTTPS collector
+	URL     string
+	Headers map[string]string // Sent with every request, such as the collector's token
+
+	TLS     *tls.Config   // For tls syslog and the HTTPS collector; nil verifies against the system roots
+	Timeout time.Duration // Per send; defaults to 10s
+
+	Outliers EventConfig
+	Audit    EventConfig
+
+	ProductVersion string        // Device version in CEF and LEEF headers
+	MaxRetries     int           // Retries of a failed send; 0 disables retrying
+	RetryDelay     time.Duration // Before the first retry, doubled on each further one; defaults to 1s
+	QueueSize      int           // Events waiting before new ones are dropped; defaults to 1000
+	BatchSize      int           // Events sent at once; defaults to 100
+}
+
+// EventConfig selects the events of one type that are exported, and how
+// they are written
+type EventConfig struct {
+	Enabled     bool
+	Format      Format          // Defaults to CEF
+	MinSeverity models.Severity // Outliers only: less severe ones are not exported
+	Actions     []string        // Audit only: the actions exported; empty exports every action
+}
+
+// Exporter sends outliers and audit log entries to a SIEM. Events are
+// queued, so detection and request handling never wait on the SIEM, and
+// sent in order by a single worker.
+type Exporter struct {
+	config    Config
+	transport transport
+	actions   map[string]bool
+	logger    *zap.Logger
+
+	queue chan message
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewExporter creates a SIEM exporter
+func NewExporter(config Config, logger *zap.Logger) (*Exporter, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.Network == "" {
+		config.Network = "udp"
+	}
+	if config.Facility == 0 {
+		config.Facility = 16
+	}
+	if config.Hostname == "" {
+		config.Hostname, _ = os.Hostname()
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = time.Second
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1000
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	for _, events := range []*EventConfig{&config.Outliers, &config.Audit} {
+		if events.Format == "" {
+			events.Format = FormatCEF
+		}
+		if !events.Format.Valid() {
+			return nil, fmt.Errorf("unknown SIEM format %q", events.Format)
+		}
+	}
+
+	var t transport
+	switch config.Transport {
+	case TransportSyslog:
+		if config.Address == "" {
+			return nil, fmt.Errorf("syslog address is required")
+		}
+		if config.Network != "udp" && config.Network != "tcp" && config.Network != "tls" {
+			return nil, fmt.Errorf("syslog network must be udp, tcp or tls, not %q", config.Network)
+		}
+		t = newSyslogTransport(config)
+	case TransportHTTPS:
+		if config.URL == "" {
+			return nil, fmt.Errorf("collector URL is required")
+		}
+		t = newHTTPSTransport(config)
+	default:
+		return nil, fmt.Errorf("SIEM transport must be syslog or https, not %q", config.Transport)
+	}
+
+	var actions map[string]bool
+	if len(config.Audit.Actions) > 0 {
+		actions = make(map[string]bool, len(config.Audit.Actions))
+		for _, action := range config.Audit.Actions {
+			actions[action] = true
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Exporter{
+		config:    config,
+		transport: t,
+		actions:   actions,
+		logger:    logger,
+		queue:     make(chan message, config.QueueSize),
+		ctx:       ctx,
+		cancel:    cancel,
+	}, nil
+}
+
+// Start begins sending queued events
+func (e *Exporter) Start() {
+	e.wg.Add(1)
+	go e.run()
+}
+
+// Stop stops sending, abandoning queued events, and closes the connection
+// to the SIEM
+func (e *Exporter) Stop() {
+	e.cancel()
+	e.wg.Wait()
+	e.transport.close()
+}
+
+// Outlier queues an outlier for export, unless outliers are not exported
+// or it is below the minimum severity. It never blocks.
+func (e *Exporter) Outlier(outlier models.Outlier) {
+	events := e.config.Outliers
+	if !events.Enabled {
+		return
+	}
+	if events.MinSeverity != "" && outlier.Severity.RiskScore() < events.MinSeverity.RiskScore() {
+		return
+	}
+	e.enqueue(outlierMessage(outlier, events.Format, e.config.ProductVersion))
+}
+
+// Audit queues an audit log entry for export, unless audit entries are not
+// exported or its action is not one of those selected. It never blocks.
+func (e *Exporter) Audit(entry security.AuditLog) {
+	if !e.config.Audit.Enabled {
+		return
+	}
+	if e.actions != nil && !e.actions[entry.Action] {
+		return
+	}
+	e.enqueue(auditMessage(entry, e.config.Audit.Format, e.config.ProductVersion))
+}
+
+// enqueue queues msg, dropping it when the queue is full
+func (e *Exporter) enqueue(msg message) {
+	select {
+	case e.queue <- msg:
+	default:
+		metrics.SIEMEvents.WithLabelValues(msg.kind, "dropped").Inc()
+		e.logger.Warn("SIEM queue full, dropping event",
+			zap.String("kind", msg.kind))
+	}
+}
+
+// run sends queued events, up to a batch at a time, until the exporter
+// stops
+func (e *Exporter) run() {
+	defer e.wg.Done()
+
+	for {
+		select {
+		case msg := <-e.queue:
+			batch := []message{msg}
+		collect:
+			for len(batch) < e.config.BatchSize {
+				select {
+				case msg := <-e.queue:
+					batch = append(batch, msg)
+				default:
+					break collect
+				}
+			}
+			e.send(batch)
+		case <-e.ctx.Done():
+			return
+		}
+	}
+}
+
+// send delivers a batch, retrying failures with exponential backoff
+func (e *Exporter) send(batch []message) {
+	delay := e.config.RetryDelay
+	var err error
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(e.ctx, e.config.Timeout)
+		err = e.transport.send(ctx, batch)
+		cancel()
+		if err == nil || attempt >= e.config.MaxRetries {
+			break
+		}
+
+		e.logger.Warn("SIEM send failed, retrying",
+			zap.Error(err),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay))
+		select {
+		case <-time.After(delay):
+		case <-e.ctx.Done():
+			return
+		}
+		delay *= 2
+	}
+
+	result := "sent"
+	if err != nil {
+		result = "failed"
+		e.logger.Error("Failed to send events to SIEM",
+			zap.Error(err),
+			zap.Int("events", len(batch)))
+	}
+	for _, msg := range batch {
+		metrics.SIEMEvents.WithLabelValues(msg.kind, result).Inc()
+	}
+}
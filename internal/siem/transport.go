@@ -0,0 +1,191 @@
+package siem
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// transport delivers formatted events to the SIEM
+type transport interface {
+	send(ctx context.Context, batch []message) error
+	close() error
+}
+
+// syslogTransport sends events as RFC 5424 syslog messages. Over TCP and
+// TLS messages are framed by octet counting (RFC 6587), and the
+// connection is kept open between sends and redialled after a failure.
+type syslogTransport struct {
+	network  string
+	address  string
+	facility int
+	hostname string
+	tls      *tls.Config
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogTransport(config Config) *syslogTransport {
+	tlsConfig := config.TLS
+	if config.Network == "tls" {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		if tlsConfig.ServerName == "" {
+			host, _, _ := net.SplitHostPort(config.Address)
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = host
+		}
+	}
+
+	return &syslogTransport{
+		network:  config.Network,
+		address:  config.Address,
+		facility: config.Facility,
+		hostname: config.Hostname,
+		tls:      tlsConfig,
+	}
+}
+
+// format writes msg as a syslog message
+func (t *syslogTransport) format(msg message) []byte {
+	hostname := t.hostname
+	if hostname == "" {
+		hostname = "-"
+	}
+	header := fmt.Sprintf("<%d>1 %s %s stablerisk - %s - ",
+		t.facility*8+msg.severity, msg.at.Format("2006-01-02T15:04:05.000000Z07:00"), hostname, msg.kind)
+	return append([]byte(header), msg.body...)
+}
+
+func (t *syslogTransport) send(ctx context.Context, batch []message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		conn, err := t.dial(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog server: %w", err)
+		}
+		t.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		t.conn.SetWriteDeadline(deadline)
+	}
+
+	var err error
+	if t.network == "udp" {
+		// One datagram per message
+		for _, msg := range batch {
+			if _, err = t.conn.Write(t.format(msg)); err != nil {
+				break
+			}
+		}
+	} else {
+		var frames bytes.Buffer
+		for _, msg := range batch {
+			line := t.format(msg)
+			frames.WriteString(strconv.Itoa(len(line)))
+			frames.WriteByte(' ')
+			frames.Write(line)
+		}
+		_, err = t.conn.Write(frames.Bytes())
+	}
+	if err != nil {
+		t.conn.Close()
+		t.conn = nil
+		return fmt.Errorf("failed to write to syslog server: %w", err)
+	}
+	return nil
+}
+
+// dial connects to the syslog server
+func (t *syslogTransport) dial(ctx context.Context) (net.Conn, error) {
+	if t.network == "tls" {
+		dialer := &tls.Dialer{Config: t.tls}
+		return dialer.DialContext(ctx, "tcp", t.address)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, t.network, t.address)
+}
+
+func (t *syslogTransport) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+// httpsTransport POSTs batches of events to an HTTPS collector, one event
+// per line
+type httpsTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newHTTPSTransport(config Config) *httpsTransport {
+	client := &http.Client{Timeout: config.Timeout}
+	if config.TLS != nil {
+		client.Transport = &http.Transport{TLSClientConfig: config.TLS}
+	}
+
+	return &httpsTransport{
+		url:     config.URL,
+		headers: config.Headers,
+		client:  client,
+	}
+}
+
+func (t *httpsTransport) send(ctx context.Context, batch []message) error {
+	var body bytes.Buffer
+	allJSON := true
+	for _, msg := range batch {
+		body.Write(msg.body)
+		body.WriteByte('\n')
+		allJSON = allJSON && msg.json
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.url, &body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if allJSON {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	} else {
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send events: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("collector returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+func (t *httpsTransport) close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
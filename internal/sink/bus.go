@@ -0,0 +1,120 @@
+package sink
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/mikedewar/stablerisk/internal/bus"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Publisher publishes JSON messages to the message bus
+type Publisher interface {
+	Publish(ctx context.Context, subject string, v interface{}) error
+}
+
+// Retraction is the message published when a reorg reverts a transaction
+type Retraction struct {
+	TxHash string `json:"tx_hash"`
+}
+
+// BusStats holds bus sink counters
+type BusStats struct {
+	Published uint64 // Transactions published
+	Retracted uint64 // Retractions published
+	Confirmed uint64 // Confirmation updates published
+	Failed    uint64 // Messages not published after retries
+}
+
+// BusSink publishes transactions, retractions and confirmation updates to the
+// message bus
+type BusSink struct {
+	publisher Publisher
+	retry     RetryPolicy
+	logger    *zap.Logger
+
+	published atomic.Uint64
+	retracted atomic.Uint64
+	confirmed atomic.Uint64
+	failed    atomic.Uint64
+}
+
+// NewBusSink creates a sink publishing through publisher
+func NewBusSink(publisher Publisher, retry RetryPolicy, logger *zap.Logger) *BusSink {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &BusSink{
+		publisher: publisher,
+		retry:     retry,
+		logger:    logger,
+	}
+}
+
+// Name implements Sink
+func (s *BusSink) Name() string {
+	return "bus"
+}
+
+// Send publishes a transaction
+func (s *BusSink) Send(ctx context.Context, tx *models.Transaction) error {
+	err := retry(ctx, s.retry, s.logger, func() error {
+		return s.publisher.Publish(ctx, bus.SubjectTransactions, tx)
+	})
+	if err != nil {
+		s.failed.Add(1)
+		return err
+	}
+	s.published.Add(1)
+	return nil
+}
+
+// Retract publishes a retraction
+func (s *BusSink) Retract(ctx context.Context, txHash string) error {
+	err := retry(ctx, s.retry, s.logger, func() error {
+		return s.publisher.Publish(ctx, bus.SubjectRetractions, Retraction{TxHash: txHash})
+	})
+	if err != nil {
+		s.failed.Add(1)
+		return err
+	}
+	s.retracted.Add(1)
+	return nil
+}
+
+// Confirm publishes a confirmation update
+func (s *BusSink) Confirm(ctx context.Context, update models.ConfirmationUpdate) error {
+	err := retry(ctx, s.retry, s.logger, func() error {
+		return s.publisher.Publish(ctx, bus.SubjectConfirmations, update)
+	})
+	if err != nil {
+		s.failed.Add(1)
+		return err
+	}
+	s.confirmed.Add(1)
+	return nil
+}
+
+// Sync implements Sink. Send returns once the message is published, so
+// there is nothing to wait for.
+func (s *BusSink) Sync(ctx context.Context) error {
+	return nil
+}
+
+// Close implements Sink. Messages are acknowledged as they are published, so
+// nothing is buffered; the connection is owned by the caller.
+func (s *BusSink) Close(ctx context.Context) error {
+	return nil
+}
+
+// Stats returns a snapshot of the sink counters
+func (s *BusSink) Stats() BusStats {
+	return BusStats{
+		Published: s.published.Load(),
+		Retracted: s.retracted.Load(),
+		Confirmed: s.confirmed.Load(),
+		Failed:    s.failed.Load(),
+	}
+}
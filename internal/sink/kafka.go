@@ -0,0 +1,219 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Kafka REST Proxy v2 content types
+const (
+	kafkaJSONContentType = "application/vnd.kafka.json.v2+json"
+	kafkaAccept          = "application/vnd.kafka.v2+json"
+)
+
+// Kafka message types
+const (
+	KafkaMessageTransaction  = "transaction"
+	KafkaMessageRetraction   = "retraction"
+	KafkaMessageConfirmation = "confirmation"
+)
+
+// KafkaConfig holds Kafka sink configuration
+type KafkaConfig struct {
+	RestProxyURL string        // Base URL of the Kafka REST Proxy
+	Topic        string        // Topic transactions and retractions are produced to
+	Timeout      time.Duration // Per-request timeout (default 10 seconds)
+	Retry        RetryPolicy
+}
+
+// KafkaMessage is the value of every record the sink produces. Records are
+// keyed by transaction hash so a retraction or confirmation lands on the same
+// partition as, and after, the transaction it refers to.
+type KafkaMessage struct {
+	Type         string                     `json:"type"` // transaction, retraction or confirmation
+	TxHash       string                     `json:"tx_hash"`
+	Transaction  *models.Transaction        `json:"transaction,omitempty"`
+	Confirmation *models.ConfirmationUpdate `json:"confirmation,omitempty"`
+}
+
+// KafkaStats holds Kafka sink counters
+type KafkaStats struct {
+	Published uint64 // Transaction records produced
+	Retracted uint64 // Retraction records produced
+	Confirmed uint64 // Confirmation records produced
+	Failed    uint64 // Records not produced after retries
+}
+
+// KafkaSink produces the transaction stream to a Kafka topic through the
+// Kafka REST Proxy
+type KafkaSink struct {
+	config     KafkaConfig
+	httpClient *http.Client
+	logger     *zap.Logger
+
+	published atomic.Uint64
+	retracted atomic.Uint64
+	confirmed atomic.Uint64
+	failed    atomic.Uint64
+}
+
+// NewKafkaSink creates a Kafka sink
+func NewKafkaSink(config KafkaConfig, logger *zap.Logger) *KafkaSink {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	config.RestProxyURL = strings.TrimRight(config.RestProxyURL, "/")
+
+	return &KafkaSink{
+		config: config,
+		httpClient: &http.Client{
+			Timeout: config.Timeout,
+		},
+		logger: logger,
+	}
+}
+
+// Name implements Sink
+func (s *KafkaSink) Name() string {
+	return "kafka"
+}
+
+// Send produces a transaction record
+func (s *KafkaSink) Send(ctx context.Context, tx *models.Transaction) error {
+	err := s.produce(ctx, KafkaMessage{
+		Type:        KafkaMessageTransaction,
+		TxHash:      tx.TxHash,
+		Transaction: tx,
+	})
+	if err != nil {
+		s.failed.Add(1)
+		return err
+	}
+	s.published.Add(1)
+	return nil
+}
+
+// Retract produces a retraction record
+func (s *KafkaSink) Retract(ctx context.Context, txHash string) error {
+	err := s.produce(ctx, KafkaMessage{
+		Type:   KafkaMessageRetraction,
+		TxHash: txHash,
+	})
+	if err != nil {
+		s.failed.Add(1)
+		return err
+	}
+	s.retracted.Add(1)
+	return nil
+}
+
+// Confirm produces a confirmation record
+func (s *KafkaSink) Confirm(ctx context.Context, update models.ConfirmationUpdate) error {
+	err := s.produce(ctx, KafkaMessage{
+		Type:         KafkaMessageConfirmation,
+		TxHash:       update.TxHash,
+		Confirmation: &update,
+	})
+	if err != nil {
+		s.failed.Add(1)
+		return err
+	}
+	s.confirmed.Add(1)
+	return nil
+}
+
+// Sync implements Sink. Send returns once the record is produced, so there
+// is nothing to wait for.
+func (s *KafkaSink) Sync(ctx context.Context) error {
+	return nil
+}
+
+// Close implements Sink. Records are produced synchronously, so nothing is
+// buffered.
+func (s *KafkaSink) Close(ctx context.Context) error {
+	return nil
+}
+
+// Stats returns a snapshot of the sink counters
+func (s *KafkaSink) Stats() KafkaStats {
+	return KafkaStats{
+		Published: s.published.Load(),
+		Retracted: s.retracted.Load(),
+		Confirmed: s.confirmed.Load(),
+		Failed:    s.failed.Load(),
+	}
+}
+
+// produce sends one record, retrying under the configured policy
+func (s *KafkaSink) produce(ctx context.Context, message KafkaMessage) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"records": []map[string]interface{}{
+			{"key": message.TxHash, "value": message},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal kafka record: %w", err)
+	}
+
+	return retry(ctx, s.config.Retry, s.logger, func() error {
+		return s.post(ctx, body)
+	})
+}
+
+// post sends a produce request to the REST Proxy and checks the per-record result
+func (s *KafkaSink) post(ctx context.Context, body []byte) error {
+	endpoint := fmt.Sprintf("%s/topics/%s", s.config.RestProxyURL, url.PathEscape(s.config.Topic))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", kafkaJSONContentType)
+	req.Header.Set("Accept", kafkaAccept)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return fmt.Errorf("kafka rest proxy returned status %d: %s", resp.StatusCode, errResp.Message)
+	}
+
+	var result struct {
+		Offsets []struct {
+			Partition int     `json:"partition"`
+			Offset    int64   `json:"offset"`
+			Error     *string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	for _, offset := range result.Offsets {
+		if offset.Error != nil {
+			return fmt.Errorf("kafka rejected record: %s", *offset.Error)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// RaphtorySink forwards transactions to the Raphtory graph through the
+// forwarding worker pool. Failed adds are already retried by the forwarder's
+// outbox, so Retry only applies to retractions.
+type RaphtorySink struct {
+	pool      *graph.ForwardPool
+	forwarder *graph.Forwarder
+	retry     RetryPolicy
+	logger    *zap.Logger
+}
+
+// NewRaphtorySink creates a sink in front of a started pool and forwarder
+func NewRaphtorySink(pool *graph.ForwardPool, forwarder *graph.Forwarder, retry RetryPolicy, logger *zap.Logger) *RaphtorySink {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &RaphtorySink{
+		pool:      pool,
+		forwarder: forwarder,
+		retry:     retry,
+		logger:    logger,
+	}
+}
+
+// Name implements Sink
+func (s *RaphtorySink) Name() string {
+	return "raphtory"
+}
+
+// Send queues a transaction for the forwarding workers, blocking while their
+// queue is full
+func (s *RaphtorySink) Send(ctx context.Context, tx *models.Transaction) error {
+	return s.pool.Submit(ctx, tx)
+}
+
+// Retract deletes a transaction from the graph once anything queued ahead of
+// it, possibly the transaction itself, has reached Raphtory
+func (s *RaphtorySink) Retract(ctx context.Context, txHash string) error {
+	if err := s.pool.Wait(ctx); err != nil {
+		return err
+	}
+
+	return retry(ctx, s.retry, s.logger, func() error {
+		if err := s.forwarder.DeleteTransaction(ctx, txHash); err != nil {
+			return fmt.Errorf("failed to delete transaction from Raphtory: %w", err)
+		}
+		return nil
+	})
+}
+
+// Confirm marks a transaction confirmed once anything queued ahead of it has
+// reached Raphtory
+func (s *RaphtorySink) Confirm(ctx context.Context, update models.ConfirmationUpdate) error {
+	if err := s.pool.Wait(ctx); err != nil {
+		return err
+	}
+
+	return retry(ctx, s.retry, s.logger, func() error {
+		if err := s.forwarder.ConfirmTransaction(ctx, update.TxHash); err != nil {
+			return fmt.Errorf("failed to confirm transaction in Raphtory: %w", err)
+		}
+		return nil
+	})
+}
+
+// Sync waits for the workers to forward what is queued, then sends
+// transactions still waiting for a batch. Failed writes are parked in the
+// outbox, which survives a restart.
+func (s *RaphtorySink) Sync(ctx context.Context) error {
+	if err := s.pool.Wait(ctx); err != nil {
+		return err
+	}
+	return s.forwarder.Flush(ctx)
+}
+
+// Close forwards what is already queued, then sends transactions still
+// waiting for a batch
+func (s *RaphtorySink) Close(ctx context.Context) error {
+	if err := s.pool.Close(ctx); err != nil {
+		return err
+	}
+	return s.forwarder.Close(ctx)
+}
+
+// PoolStats returns the forwarding worker pool counters
+func (s *RaphtorySink) PoolStats() graph.PoolStats {
+	return s.pool.Stats()
+}
+
+// ForwarderStats returns the forwarder and outbox counters
+func (s *RaphtorySink) ForwarderStats() graph.ForwarderStats {
+	return s.forwarder.Stats()
+}
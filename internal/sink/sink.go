@@ -0,0 +1,58 @@
+// Package sink delivers ingested transactions to downstream systems. The
+// monitor fans each transaction, confirmation update and reorg retraction out
+// to every configured sink.
+package sink
+
+import (
+	"context"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Sink receives the normalized transaction stream
+type Sink interface {
+	// Name identifies the sink in logs
+	Name() string
+	// Send delivers a transaction
+	Send(ctx context.Context, tx *models.Transaction) error
+	// Retract reports that a previously sent transaction was reverted by a
+	// chain reorganisation
+	Retract(ctx context.Context, txHash string) error
+	// Confirm reports that a transaction sent unconfirmed has reached the
+	// confirmation depth
+	Confirm(ctx context.Context, update models.ConfirmationUpdate) error
+	// Sync returns once every transaction sent so far has been delivered,
+	// or queued somewhere that survives a restart
+	Sync(ctx context.Context) error
+	// Close delivers anything still buffered and releases resources
+	Close(ctx context.Context) error
+}
+
+// RetryPolicy controls how often a sink retries a failed delivery
+type RetryPolicy struct {
+	MaxRetries int           // Retries after the first attempt; 0 disables retrying
+	RetryDelay time.Duration // Delay before the first retry, doubled on each further retry
+}
+
+// retry runs fn, retrying failures with exponential backoff under policy
+func retry(ctx context.Context, policy RetryPolicy, logger *zap.Logger, fn func() error) error {
+	if policy.MaxRetries <= 0 {
+		return fn()
+	}
+
+	delay := policy.RetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+
+	return blockchain.RetryWithBackoff(ctx, blockchain.RetryConfig{
+		InitialDelay: delay,
+		MaxDelay:     30 * time.Second,
+		MaxRetries:   policy.MaxRetries,
+		Multiplier:   2.0,
+		Jitter:       true,
+	}, logger, fn)
+}
@@ -0,0 +1,293 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// exporter batches ended spans and posts them to an OTLP/HTTP collector
+// using the JSON encoding
+type exporter struct {
+	config     Config
+	url        string
+	httpClient *http.Client
+	logger     *zap.Logger
+
+	queue chan *Span
+	flush chan chan struct{}
+	done  chan struct{}
+	once  sync.Once
+
+	mu      sync.Mutex
+	dropped int64
+}
+
+func newExporter(config Config, logger *zap.Logger) *exporter {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 512
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 2048
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 5 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	e := &exporter{
+		config:     config,
+		url:        strings.TrimRight(config.Endpoint, "/") + "/v1/traces",
+		httpClient: &http.Client{Timeout: config.Timeout},
+		logger:     logger,
+		queue:      make(chan *Span, config.QueueSize),
+		flush:      make(chan chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// enqueue queues an ended span, dropping it if the queue is full so a slow
+// collector never blocks the pipeline
+func (e *exporter) enqueue(span *Span) {
+	select {
+	case <-e.done:
+		return
+	default:
+	}
+
+	select {
+	case e.queue <- span:
+	default:
+		e.mu.Lock()
+		e.dropped++
+		e.mu.Unlock()
+	}
+}
+
+func (e *exporter) run() {
+	ticker := time.NewTicker(e.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, e.config.BatchSize)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			e.logger.Warn("Failed to export spans", zap.Int("spans", len(batch)), zap.Error(err))
+		}
+		batch = batch[:0]
+	}
+	drain := func() {
+		for {
+			select {
+			case span := <-e.queue:
+				batch = append(batch, span)
+				if len(batch) >= e.config.BatchSize {
+					send()
+				}
+			default:
+				send()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= e.config.BatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+			e.logDropped()
+		case ack := <-e.flush:
+			drain()
+			close(ack)
+		case <-e.done:
+			drain()
+			e.logDropped()
+			return
+		}
+	}
+}
+
+func (e *exporter) logDropped() {
+	e.mu.Lock()
+	dropped := e.dropped
+	e.dropped = 0
+	e.mu.Unlock()
+	if dropped > 0 {
+		e.logger.Warn("Dropped spans because the export queue was full", zap.Int64("spans", dropped))
+	}
+}
+
+// forceFlush exports everything queued so far
+func (e *exporter) forceFlush(ctx context.Context) error {
+	ack := make(chan struct{})
+	select {
+	case e.flush <- ack:
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shutdown exports queued spans and stops the exporter
+func (e *exporter) shutdown(ctx context.Context) error {
+	if err := e.forceFlush(ctx); err != nil {
+		return err
+	}
+	e.once.Do(func() { close(e.done) })
+	return nil
+}
+
+func (e *exporter) export(spans []*Span) error {
+	body, err := json.Marshal(encodeSpans(e.config.ServiceName, spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post spans: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// OTLP JSON payload types. IDs are hex and 64-bit integers are strings, as
+// the OTLP JSON mapping specifies.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func encodeSpans(serviceName string, spans []*Span) otlpRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		span.mu.Lock()
+		s := otlpSpan{
+			TraceID:           span.sc.TraceID.String(),
+			SpanID:            span.sc.SpanID.String(),
+			Name:              span.name,
+			Kind:              span.kind,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        encodeAttributes(span.attributes),
+			Status:            otlpStatus{Code: span.status, Message: span.statusMessage},
+		}
+		span.mu.Unlock()
+		if span.parent.IsValid() {
+			s.ParentSpanID = span.parent.String()
+		}
+		encoded = append(encoded, s)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{
+			{Key: "service.name", Value: map[string]interface{}{"stringValue": serviceName}},
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/mikedewar/stablerisk"},
+			Spans: encoded,
+		}},
+	}}}
+}
+
+func encodeAttributes(attributes []Attribute) []otlpKeyValue {
+	if len(attributes) == 0 {
+		return nil
+	}
+	encoded := make([]otlpKeyValue, 0, len(attributes))
+	for _, attr := range attributes {
+		var value map[string]interface{}
+		switch v := attr.Value.(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		encoded = append(encoded, otlpKeyValue{Key: attr.Key, Value: value})
+	}
+	return encoded
+}
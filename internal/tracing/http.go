@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// transport records a client span for each request and forwards the trace
+// context to the server
+type transport struct {
+	base http.RoundTripper
+}
+
+// Transport wraps base (http.DefaultTransport when nil) so outgoing requests
+// are traced and carry a traceparent header
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Start(req.Context(), "HTTP "+req.Method,
+		WithKind(KindClient),
+		WithAttributes(
+			String("http.request.method", req.Method),
+			String("server.address", req.URL.Host),
+			String("url.path", req.URL.Path),
+		))
+
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.End()
+		return nil, err
+	}
+
+	span.SetAttributes(Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetStatus(StatusError, "HTTP "+strconv.Itoa(resp.StatusCode))
+	}
+	span.End()
+	return resp, nil
+}
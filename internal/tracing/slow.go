@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// DBOption configures a database opened with OpenDB
+type DBOption func(*connector)
+
+// WithSlowQueryLog logs a warning, and counts it in
+// stablerisk_db_slow_queries_total, for each query or statement taking longer
+// than threshold. Queries are timed until the first rows are available, not
+// until they have all been read. A zero threshold disables it.
+func WithSlowQueryLog(threshold time.Duration, logger *zap.Logger) DBOption {
+	return func(c *connector) {
+		if threshold <= 0 {
+			return
+		}
+		if logger == nil {
+			logger = zap.NewNop()
+		}
+		c.slowThreshold = threshold
+		c.logger = logger
+	}
+}
+
+// observe logs and counts the call if it was slow
+func (c *tracedConn) observe(ctx context.Context, operation, query string, args []driver.NamedValue, elapsed time.Duration, err error) {
+	if c.slowThreshold <= 0 || elapsed < c.slowThreshold || err == driver.ErrSkip {
+		return
+	}
+
+	metrics.SlowQueries.WithLabelValues(operation).Inc()
+
+	fields := []zap.Field{
+		zap.String("operation", operation),
+		zap.Duration("duration", elapsed),
+		zap.Duration("threshold", c.slowThreshold),
+		zap.String("query", truncateQuery(query)),
+		zap.Strings("args", RedactArgs(args)),
+	}
+	if sc := parentOf(ctx); sc.IsValid() {
+		fields = append(fields, zap.String("trace_id", sc.TraceID.String()))
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	c.logger.Warn("Slow database query", fields...)
+}
+
+// RedactArgs describes query arguments for logs. Numbers, booleans, times
+// and NULLs are kept because they explain most slow queries (limits,
+// offsets, time windows); strings and bytes may hold addresses, emails or
+// secrets, so only their length is shown.
+func RedactArgs(args []driver.NamedValue) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		name := arg.Name
+		if name == "" {
+			name = "$" + strconv.Itoa(arg.Ordinal)
+		}
+
+		var value string
+		switch v := arg.Value.(type) {
+		case nil:
+			value = "NULL"
+		case int64, float64, bool:
+			value = fmt.Sprint(v)
+		case time.Time:
+			value = v.UTC().Format(time.RFC3339Nano)
+		case string:
+			value = fmt.Sprintf("[redacted string, %d bytes]", len(v))
+		case []byte:
+			value = fmt.Sprintf("[redacted bytes, %d bytes]", len(v))
+		default:
+			value = fmt.Sprintf("[redacted %T]", v)
+		}
+		redacted[i] = name + "=" + value
+	}
+	return redacted
+}
@@ -0,0 +1,169 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// OpenDB opens a database like sql.Open, except that queries and statements
+// run with a context record client spans. The driver must already be
+// registered, e.g. by importing lib/pq.
+func OpenDB(driverName, dsn string, opts ...DBOption) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	base := db.Driver()
+	if err := db.Close(); err != nil {
+		return nil, err
+	}
+	c := &connector{driver: base, dsn: dsn, system: driverName}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return sql.OpenDB(c), nil
+}
+
+type connector struct {
+	driver driver.Driver
+	dsn    string
+	system string
+
+	slowThreshold time.Duration
+	logger        *zap.Logger
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	var (
+		conn driver.Conn
+		err  error
+	)
+	if dc, ok := c.driver.(driver.DriverContext); ok {
+		var inner driver.Connector
+		if inner, err = dc.OpenConnector(c.dsn); err != nil {
+			return nil, err
+		}
+		conn, err = inner.Connect(ctx)
+	} else {
+		conn, err = c.driver.Open(c.dsn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn, system: c.system, slowThreshold: c.slowThreshold, logger: c.logger}, nil
+}
+
+func (c *connector) Driver() driver.Driver { return c.driver }
+
+// tracedConn traces the context-aware paths of a driver connection. Paths the
+// underlying driver does not implement return driver.ErrSkip, so
+// database/sql falls back exactly as it would without the wrapper.
+type tracedConn struct {
+	driver.Conn
+	system string
+
+	slowThreshold time.Duration
+	logger        *zap.Logger
+}
+
+func (c *tracedConn) startSpan(ctx context.Context, operation, query string) (context.Context, *Span) {
+	return Start(ctx, "db."+operation,
+		WithKind(KindClient),
+		WithAttributes(
+			String("db.system", c.system),
+			String("db.operation.name", operation),
+			String("db.query.text", truncateQuery(query)),
+		))
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := c.startSpan(ctx, "query", query)
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	c.observe(ctx, "query", query, args, time.Since(start), err)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := c.startSpan(ctx, "exec", query)
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	c.observe(ctx, "exec", query, args, time.Since(start), err)
+	endSpan(span, err)
+	return result, err
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *tracedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func endSpan(span *Span, err error) {
+	if err != nil && err != driver.ErrSkip {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// truncateQuery collapses whitespace and caps the query text so large
+// generated statements do not bloat spans. Arguments are never recorded.
+func truncateQuery(query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	const limit = 1000
+	if len(query) > limit {
+		return fmt.Sprintf("%s...", query[:limit])
+	}
+	return query
+}
@@ -0,0 +1,320 @@
+// Package tracing records OpenTelemetry-compatible spans and exports them to
+// an OpenTelemetry collector over OTLP/HTTP. Trace context is propagated
+// between services with W3C traceparent headers, so a slow API request or
+// detection cycle can be followed into Raphtory and Postgres calls.
+//
+// Until Init is called every span is a no-op, so instrumented code costs
+// next to nothing when tracing is disabled.
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// String returns the lower-case hex form used in headers and OTLP
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// String returns the lower-case hex form used in headers and OTLP
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether the ID is not all zeros
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// IsValid reports whether the ID is not all zeros
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext is the part of a span that crosses process boundaries
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// SpanKind describes a span's role, using the OTLP enum values
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+	KindProducer SpanKind = 4
+	KindConsumer SpanKind = 5
+)
+
+// StatusCode is a span's outcome, using the OTLP enum values
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attribute is a key and a string, bool, int64 or float64 value
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String creates a string attribute
+func String(key, value string) Attribute { return Attribute{Key: key, Value: value} }
+
+// Int creates an integer attribute
+func Int(key string, value int) Attribute { return Attribute{Key: key, Value: int64(value)} }
+
+// Int64 creates an integer attribute
+func Int64(key string, value int64) Attribute { return Attribute{Key: key, Value: value} }
+
+// Bool creates a boolean attribute
+func Bool(key string, value bool) Attribute { return Attribute{Key: key, Value: value} }
+
+// Float64 creates a floating point attribute
+func Float64(key string, value float64) Attribute { return Attribute{Key: key, Value: value} }
+
+// Span is one timed operation. A nil *Span is a valid no-op span, which is
+// what Start returns while tracing is disabled or the trace is not sampled.
+type Span struct {
+	tracer *Tracer
+	name   string
+	kind   SpanKind
+	sc     SpanContext
+	parent SpanID
+	start  time.Time
+	end    time.Time
+
+	mu            sync.Mutex
+	attributes    []Attribute
+	status        StatusCode
+	statusMessage string
+	ended         bool
+}
+
+// SpanContext returns the span's IDs; zero for a no-op span
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attributes = append(s.attributes, attributes...)
+	s.mu.Unlock()
+}
+
+// SetStatus sets the span's outcome
+func (s *Span) SetStatus(code StatusCode, message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.status = code
+	s.statusMessage = message
+	s.mu.Unlock()
+}
+
+// RecordError marks the span failed with err. Context cancellation is
+// recorded as an attribute rather than a failure.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		s.SetAttributes(Bool("cancelled", true))
+		return
+	}
+	s.SetStatus(StatusError, err.Error())
+}
+
+// End finishes the span and queues it for export. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.exporter.enqueue(s)
+}
+
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	remoteKey
+)
+
+// ContextWithSpan returns ctx carrying span as the current span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey, span)
+}
+
+// SpanFromContext returns the current span, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// ContextWithRemoteSpanContext returns ctx carrying a parent extracted from
+// another process
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+// parentOf returns the span context new spans in ctx are children of
+func parentOf(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.sc
+	}
+	sc, _ := ctx.Value(remoteKey).(SpanContext)
+	return sc
+}
+
+// Config holds tracer configuration
+type Config struct {
+	ServiceName   string
+	Endpoint      string        // OTLP/HTTP collector base URL, e.g. http://localhost:4318
+	SampleRatio   float64       // Fraction of new traces recorded; traces started elsewhere follow the caller
+	BatchSize     int           // Spans per export request (default 512)
+	QueueSize     int           // Ended spans waiting for export before new ones are dropped (default 2048)
+	FlushInterval time.Duration // Export partial batches after this long (default 5 seconds)
+	Timeout       time.Duration // Per-export timeout (default 10 seconds)
+}
+
+// Tracer creates spans and exports the sampled ones
+type Tracer struct {
+	config   Config
+	exporter *exporter
+}
+
+var global atomic.Pointer[Tracer]
+
+// Init installs a tracer exporting to the configured collector. Call the
+// returned function on shutdown to export spans that are still queued.
+func Init(config Config, logger *zap.Logger) func(context.Context) error {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.SampleRatio < 0 {
+		config.SampleRatio = 0
+	}
+	if config.SampleRatio > 1 {
+		config.SampleRatio = 1
+	}
+
+	tracer := &Tracer{
+		config:   config,
+		exporter: newExporter(config, logger),
+	}
+	global.Store(tracer)
+
+	logger.Info("Tracing enabled",
+		zap.String("endpoint", config.Endpoint),
+		zap.Float64("sample_ratio", config.SampleRatio))
+
+	return func(ctx context.Context) error {
+		global.CompareAndSwap(tracer, nil)
+		return tracer.exporter.shutdown(ctx)
+	}
+}
+
+// StartOption configures a new span
+type StartOption func(*Span)
+
+// WithKind sets the span kind (default KindInternal)
+func WithKind(kind SpanKind) StartOption {
+	return func(s *Span) { s.kind = kind }
+}
+
+// WithAttributes sets attributes when the span starts
+func WithAttributes(attributes ...Attribute) StartOption {
+	return func(s *Span) { s.attributes = append(s.attributes, attributes...) }
+}
+
+// Start begins a span as a child of the current span in ctx and returns a
+// context carrying it. The span is nil, and ctx is returned unchanged, when
+// tracing is disabled or the trace is not sampled.
+func Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	tracer := global.Load()
+	if tracer == nil {
+		return ctx, nil
+	}
+
+	parent := parentOf(ctx)
+	sc := SpanContext{TraceID: parent.TraceID, SpanID: newSpanID()}
+	if parent.IsValid() {
+		sc.Sampled = parent.Sampled
+	} else {
+		sc.TraceID = newTraceID()
+		sc.Sampled = tracer.config.SampleRatio > 0 && rand.Float64() < tracer.config.SampleRatio
+	}
+
+	if !sc.Sampled {
+		// Keep propagating the unsampled decision so callees agree with it
+		return ContextWithRemoteSpanContext(ctx, sc), nil
+	}
+
+	span := &Span{
+		tracer: tracer,
+		name:   name,
+		kind:   KindInternal,
+		sc:     sc,
+		parent: parent.SpanID,
+		start:  time.Now(),
+	}
+	for _, opt := range opts {
+		opt(span)
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		hi, lo := rand.Uint64(), rand.Uint64()
+		for i := 0; i < 8; i++ {
+			id[i] = byte(hi >> (56 - 8*i))
+			id[8+i] = byte(lo >> (56 - 8*i))
+		}
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		v := rand.Uint64()
+		for i := 0; i < 8; i++ {
+			id[i] = byte(v >> (56 - 8*i))
+		}
+	}
+	return id
+}
@@ -0,0 +1,57 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// ErrBlockedAddress is a webhook endpoint that resolves to an address
+// deliveries may not reach
+var ErrBlockedAddress = errors.New("webhook endpoint resolves to a private, loopback or link-local address")
+
+// sharedAddressSpace is the carrier-grade NAT range, 100.64.0.0/10, which
+// some clouds use for their metadata services
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// BlockedIP reports whether ip is loopback, private (RFC 1918 or IPv6 ULA),
+// link-local, such as the 169.254.169.254 cloud metadata service,
+// unspecified or shared address space. Webhooks could otherwise be used to
+// reach services inside the deployment.
+func BlockedIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		if ip[0] == 0 || sharedAddressSpace.Contains(ip) {
+			return true
+		}
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// BlockedHost reports whether a URL host is localhost or an IP address
+// BlockedIP refuses. Names are only checked when they are dialled.
+func BlockedHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && BlockedIP(ip)
+}
+
+// dialControl refuses connections to blocked addresses. It runs after name
+// resolution, for every address tried, so DNS cannot be used to get round it.
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || BlockedIP(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	return nil
+}
@@ -0,0 +1,461 @@
+// Package webhook delivers outlier and incident events to the HTTPS
+// endpoints organizations register. Every delivery is signed with the
+// endpoint's secret, retried with exponential backoff while the endpoint is
+// failing, and recorded so its status can be inspected.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/internal/notify"
+	"github.com/mikedewar/stablerisk/internal/security/crypto"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-StableRisk-Event"
+	HeaderDelivery  = "X-StableRisk-Delivery"
+	HeaderTimestamp = "X-StableRisk-Timestamp"
+	HeaderSignature = "X-StableRisk-Signature"
+)
+
+// Config holds webhook delivery configuration
+type Config struct {
+	MaxRetries    int           // Retries after the first attempt; 0 disables retrying
+	RetryDelay    time.Duration // Delay before the first retry, doubled on each further retry; defaults to 5s
+	MaxRetryDelay time.Duration // Longest delay between retries; defaults to 5m
+	Timeout       time.Duration // Per attempt; defaults to 10s
+	Workers       int           // Deliveries made at once; defaults to 4
+	QueueSize     int           // Events waiting before new ones are dropped; defaults to 1000
+	// AllowPrivateAddresses lets deliveries reach loopback, private and
+	// link-local addresses, for development; otherwise connections to them
+	// are refused
+	AllowPrivateAddresses bool
+}
+
+// Event is the JSON body POSTed to webhooks
+type Event struct {
+	ID        string              `json:"id"`
+	Type      models.WebhookEvent `json:"type"`
+	CreatedAt time.Time           `json:"created_at"`
+	OrgID     string              `json:"org_id,omitempty"` // Empty for shared detections
+	Data      interface{}         `json:"data"`
+}
+
+// IncidentResolved is the data of an incident.resolved event
+type IncidentResolved struct {
+	IncidentKey string         `json:"incident_key"` // As used to de-duplicate alerts and pages
+	Outlier     models.Outlier `json:"outlier"`      // The acknowledged outlier
+}
+
+// Sign returns the signature of a delivery: the hex HMAC-SHA256, keyed by
+// the webhook's secret, of the timestamp header, a dot and the body.
+// Receivers recompute it to check a delivery came from StableRisk, and
+// reject old timestamps to stop replays.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher sends events to the webhooks subscribed to them. Events are
+// queued, so detection never waits on a slow endpoint, and each delivery is
+// retried on its own worker.
+type Dispatcher struct {
+	db         *sql.DB
+	config     Config
+	cipher     *crypto.Cipher
+	httpClient *http.Client
+	logger     *zap.Logger
+
+	events     chan Event
+	deliveries chan delivery
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// delivery is an event on its way to one webhook
+type delivery struct {
+	id      string
+	webhook target
+	event   Event
+	body    []byte
+}
+
+// target is a webhook as the dispatcher needs it
+type target struct {
+	id     string
+	url    string
+	secret string
+}
+
+// NewDispatcher creates a webhook dispatcher
+func NewDispatcher(db *sql.DB, config Config, logger *zap.Logger) *Dispatcher {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = 5 * time.Second
+	}
+	if config.MaxRetryDelay <= 0 {
+		config.MaxRetryDelay = 5 * time.Minute
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.Workers <= 0 {
+		config.Workers = 4
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1000
+	}
+
+	// Connections are checked against the blocked ranges after the
+	// endpoint's name is resolved. Proxies are bypassed, since the check
+	// would only see the proxy's address.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !config.AllowPrivateAddresses {
+		transport.Proxy = nil
+		transport.DialContext = (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   dialControl,
+		}).DialContext
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		db:     db,
+		config: config,
+		httpClient: &http.Client{
+			Timeout:   config.Timeout,
+			Transport: transport,
+			// Endpoints are called as registered; following redirects would
+			// send signed events somewhere nobody registered, or to an
+			// address the endpoint's URL could not name
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		logger:     logger,
+		events:     make(chan Event, config.QueueSize),
+		deliveries: make(chan delivery),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// SetCipher sets the cipher webhook secrets are decrypted with. Call it
+// before Start.
+func (d *Dispatcher) SetCipher(cipher *crypto.Cipher) {
+	d.cipher = cipher
+}
+
+// Start starts looking up the webhooks for queued events and the delivery
+// workers
+func (d *Dispatcher) Start() {
+	d.wg.Add(1)
+	go d.fanOut()
+	for i := 0; i < d.config.Workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+}
+
+// Stop stops the dispatcher, abandoning queued events, and waits for
+// deliveries in progress to give up. Abandoned deliveries stay pending.
+func (d *Dispatcher) Stop() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+// Outlier queues an outlier.detected event. It never blocks: the event is
+// dropped if the queue is full.
+func (d *Dispatcher) Outlier(outlier models.Outlier) {
+	d.enqueue(models.WebhookEventOutlierDetected, outlier.OrgID, outlier)
+}
+
+// Resolved queues an incident.resolved event for the webhooks of orgID,
+// which acknowledged outlier. Like Outlier, it never blocks.
+func (d *Dispatcher) Resolved(orgID string, outlier models.Outlier) {
+	d.enqueue(models.WebhookEventIncidentResolved, orgID, IncidentResolved{
+		IncidentKey: notify.IncidentKey(outlier),
+		Outlier:     outlier,
+	})
+}
+
+// enqueue queues an event for orgID's webhooks, or with no orgID, as for
+// the shared detections' outliers, for every organization's
+func (d *Dispatcher) enqueue(eventType models.WebhookEvent, orgID string, data interface{}) {
+	event := Event{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		OrgID:     orgID,
+		Data:      data,
+	}
+
+	select {
+	case d.events <- event:
+	default:
+		metrics.WebhookDeliveries.WithLabelValues("dropped").Inc()
+		d.logger.Warn("Webhook queue full, dropping event",
+			zap.String("event", string(eventType)),
+			zap.String("org_id", orgID))
+	}
+}
+
+// fanOut turns each queued event into a delivery for every webhook
+// subscribed to it, until the dispatcher stops
+func (d *Dispatcher) fanOut() {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case event := <-d.events:
+			d.fanOutEvent(event)
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// fanOutEvent records a pending delivery of event to each subscribed
+// webhook and hands it to a worker
+func (d *Dispatcher) fanOutEvent(event Event) {
+	logger := d.logger.With(zap.String("event_id", event.ID), zap.String("event", string(event.Type)))
+
+	targets, err := d.targets(event)
+	if err != nil {
+		logger.Error("Failed to load webhooks", zap.Error(err))
+		return
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("Failed to encode webhook event", zap.Error(err))
+		return
+	}
+
+	for _, t := range targets {
+		id := uuid.New().String()
+		_, err := d.db.ExecContext(d.ctx, `
+			INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, status, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, id, t.id, event.ID, string(event.Type), string(models.WebhookDeliveryPending), time.Now().UTC())
+		if err != nil {
+			logger.Error("Failed to record webhook delivery", zap.String("webhook_id", t.id), zap.Error(err))
+			continue
+		}
+
+		select {
+		case d.deliveries <- delivery{id: id, webhook: t, event: event, body: body}:
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// targets loads the enabled webhooks subscribed to event of its
+// organization, or of every organization for a shared event
+func (d *Dispatcher) targets(event Event) ([]target, error) {
+	query, args := `SELECT id, url, secret, events FROM webhooks WHERE enabled = $1`, []interface{}{true}
+	if event.OrgID != "" {
+		query += ` AND org_id = $2`
+		args = append(args, event.OrgID)
+	}
+	rows, err := d.db.QueryContext(d.ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []target
+	for rows.Next() {
+		var t target
+		var events []byte
+		if err := rows.Scan(&t.id, &t.url, &t.secret, &events); err != nil {
+			return nil, err
+		}
+		webhook := models.Webhook{ID: t.id}
+		if err := json.Unmarshal(events, &webhook.Events); err != nil {
+			return nil, fmt.Errorf("failed to decode events of webhook %s: %w", t.id, err)
+		}
+		if !webhook.Subscribed(event.Type) {
+			continue
+		}
+		if t.secret, err = d.decrypt(t.secret); err != nil {
+			d.logger.Error("Failed to decrypt webhook secret, skipping webhook",
+				zap.String("webhook_id", t.id),
+				zap.Error(err))
+			continue
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+// decrypt returns the plaintext of a stored secret
+func (d *Dispatcher) decrypt(secret string) (string, error) {
+	if d.cipher == nil {
+		if crypto.IsEncrypted(secret) {
+			return "", fmt.Errorf("secret is encrypted but no encryption key is configured")
+		}
+		return secret, nil
+	}
+	return d.cipher.Decrypt(secret)
+}
+
+// work makes deliveries until the dispatcher stops
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case del := <-d.deliveries:
+			d.deliver(del)
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver POSTs a delivery, retrying with exponential backoff until the
+// endpoint accepts it, rejects it outright or the retries run out, and
+// records each attempt
+func (d *Dispatcher) deliver(del delivery) {
+	logger := d.logger.With(
+		zap.String("webhook_id", del.webhook.id),
+		zap.String("delivery_id", del.id),
+		zap.String("event", string(del.event.Type)))
+
+	retries := blockchain.NewRetryHandler(blockchain.RetryConfig{
+		InitialDelay: d.config.RetryDelay,
+		MaxDelay:     d.config.MaxRetryDelay,
+		MaxRetries:   d.config.MaxRetries,
+		Multiplier:   2.0,
+		Jitter:       true,
+	}, logger)
+
+	for attempts := 1; ; attempts++ {
+		status, retryAfter, err := d.post(del)
+		if err == nil {
+			d.record(del.id, models.WebhookDeliveryDelivered, attempts, status, "")
+			metrics.WebhookDeliveries.WithLabelValues("delivered").Inc()
+			return
+		}
+
+		if !retryable(status) || !retries.ShouldRetry() {
+			d.record(del.id, models.WebhookDeliveryFailed, attempts, status, err.Error())
+			metrics.WebhookDeliveries.WithLabelValues("failed").Inc()
+			logger.Warn("Webhook delivery failed",
+				zap.Int("attempts", attempts),
+				zap.Int("status", status),
+				zap.Error(err))
+			return
+		}
+
+		d.record(del.id, models.WebhookDeliveryPending, attempts, status, err.Error())
+		retries.SetRetryAfter(retryAfter)
+		if err := retries.Wait(d.ctx); err != nil {
+			return
+		}
+	}
+}
+
+// post makes one delivery attempt, returning the response status, if one
+// was received, and any delay the endpoint asked for before retrying
+func (d *Dispatcher) post(del delivery) (int, time.Duration, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, del.webhook.url, bytes.NewReader(del.body))
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "StableRisk-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, string(del.event.Type))
+	req.Header.Set(HeaderDelivery, del.id)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(del.webhook.secret, timestamp, del.body))
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, 0, nil
+	}
+
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+	return resp.StatusCode, retryAfter, fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+}
+
+// retryable reports whether a failed attempt is worth retrying. Client
+// errors other than timeouts and rate limiting will fail the same way
+// again.
+func retryable(status int) bool {
+	if status >= 400 && status < 500 {
+		return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// record saves the outcome of a delivery's latest attempt
+func (d *Dispatcher) record(id string, status models.WebhookDeliveryStatus, attempts, responseStatus int, errMessage string) {
+	now := time.Now().UTC()
+	var deliveredAt sql.NullTime
+	if status == models.WebhookDeliveryDelivered {
+		deliveredAt = sql.NullTime{Time: now, Valid: true}
+	}
+	var response sql.NullInt64
+	if responseStatus != 0 {
+		response = sql.NullInt64{Int64: int64(responseStatus), Valid: true}
+	}
+
+	// Recorded even while stopping, so the attempt is not lost
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, response_status = $3, error = $4, last_attempt_at = $5, delivered_at = $6
+		WHERE id = $7
+	`, string(status), attempts, response, errMessage, now, deliveredAt, id)
+	if err != nil {
+		d.logger.Error("Failed to record webhook delivery attempt",
+			zap.String("delivery_id", id),
+			zap.Error(err))
+	}
+}
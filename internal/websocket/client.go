@@ -2,11 +2,17 @@ package websocket
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/mikedewar/stablerisk/internal/api"
 	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
 )
 
@@ -20,44 +26,168 @@ const (
 	// Send pings to peer with this period (must be less than pongWait)
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer
-	maxMessageSize = 512
+	// Maximum message size allowed from peer; room for a subscribe message
+	// listing a couple of hundred addresses
+	maxMessageSize = 8192
+
+	// How long before its token expires a client is asked for a fresh one
+	reauthNotice = 5 * time.Minute
 )
 
+// Authenticator checks a fresh token a client sends to keep its connection
+// open and returns when the token expires
+type Authenticator func(token string) (time.Time, error)
+
+// errStreamForbidden rejects transaction stream subscriptions from users
+// whose role does not grant it
+var errStreamForbidden = errors.New("your role does not grant stream:transactions")
+
 // Client represents a WebSocket client connection
 type Client struct {
-	hub      *Hub
-	conn     *websocket.Conn
-	send     chan []byte
-	userID   string
-	username string
-	role     models.Role
-	filters  *SubscriptionFilters
-	logger   *zap.Logger
+	id          string
+	hub         *Hub
+	conn        *websocket.Conn
+	send        chan []byte
+	userID      string
+	username    string
+	orgID       string
+	role        models.Role
+	connectedAt time.Time
+	streamTxs   bool     // Whether the user may subscribe to the transaction stream
+	audience    Audience // Most privileged broadcasts the client receives
+	format      Format   // How messages to the client are encoded
+	filters     *SubscriptionFilters
+	filtersMu   sync.RWMutex // Filters change on the read pump and are read by the hub
+
+	// When the client's token expires, renewed by reauth messages checked
+	// with authenticate; zero when the connection does not expire
+	expiresAt    time.Time
+	authenticate Authenticator
+	authMu       sync.RWMutex  // Expiry changes on the read pump and is read by the write pump
+	renewed      chan struct{} // Tells the write pump the expiry changed
+
+	logger *zap.Logger
 }
 
 // SubscriptionFilters allows clients to filter which messages they receive
 type SubscriptionFilters struct {
-	Severities []models.Severity     // Only receive these severities (empty = all)
-	Types      []models.OutlierType  // Only receive these types (empty = all)
+	Severities []models.Severity    // Only receive these severities (empty = all)
+	Types      []models.OutlierType // Only receive these types (empty = all)
+	Addresses  []string             // Only receive outliers on or against these addresses (empty = all)
+	MinAmount  decimal.Decimal      // Only receive outliers of at least this amount (zero = all)
+
+	// Live transaction stream options; nil when not subscribed
+	Transactions *api.WebSocketTransactionSubscription
 }
 
-// NewClient creates a new WebSocket client
-func NewClient(hub *Hub, conn *websocket.Conn, userID, username string, role models.Role, logger *zap.Logger) *Client {
+// NewClient creates a new WebSocket client for a user of an organization,
+// which receives the shared detections and that organization's own outliers
+func NewClient(hub *Hub, conn *websocket.Conn, userID, username, orgID string, role models.Role, logger *zap.Logger) *Client {
 	if logger == nil {
 		logger = zap.NewNop()
 	}
 
 	return &Client{
-		hub:      hub,
-		conn:     conn,
-		send:     make(chan []byte, 256),
-		userID:   userID,
-		username: username,
-		role:     role,
-		filters:  &SubscriptionFilters{},
-		logger:   logger,
+		id:          uuid.New().String(),
+		hub:         hub,
+		conn:        conn,
+		send:        make(chan []byte, 256),
+		userID:      userID,
+		username:    username,
+		orgID:       orgID,
+		role:        role,
+		connectedAt: time.Now().UTC(),
+		format:      FormatJSON,
+		filters:     &SubscriptionFilters{},
+		renewed:     make(chan struct{}, 1),
+		logger:      logger,
+	}
+}
+
+// SetFormat sets how messages to the client are encoded; clients start
+// with JSON. Messages from the client are always JSON. Call it before
+// registering the client.
+func (c *Client) SetFormat(format Format) {
+	c.format = format
+}
+
+// SetTokenExpiry closes the connection when the token it was opened with
+// expires at expiresAt, unless the client sends a fresh one. The client is
+// sent a "reauth_required" message shortly before, and answers it with a
+// "reauth" message carrying a token that authenticate accepts. Call it
+// before registering the client.
+func (c *Client) SetTokenExpiry(expiresAt time.Time, authenticate Authenticator) {
+	c.expiresAt = expiresAt
+	c.authenticate = authenticate
+}
+
+// tokenExpiry returns when the client's token expires, or zero
+func (c *Client) tokenExpiry() time.Time {
+	c.authMu.RLock()
+	defer c.authMu.RUnlock()
+	return c.expiresAt
+}
+
+// SetAudience sets which broadcasts the client receives, from its role's
+// permissions; clients start as viewers. Call it before registering the
+// client.
+func (c *Client) SetAudience(audience Audience) {
+	c.audience = audience
+}
+
+// AllowTransactions lets the client subscribe to the live transaction
+// stream. Call it before registering the client.
+func (c *Client) AllowTransactions() {
+	c.streamTxs = true
+}
+
+// ID returns the connection's ID
+func (c *Client) ID() string {
+	return c.id
+}
+
+// Info describes the connection: its user, when it connected, its
+// subscription filters and how many messages are waiting to be sent
+func (c *Client) Info() api.WebSocketConnection {
+	c.filtersMu.RLock()
+	defer c.filtersMu.RUnlock()
+
+	var tokenExpiresAt *time.Time
+	if expiresAt := c.tokenExpiry(); !expiresAt.IsZero() {
+		tokenExpiresAt = &expiresAt
+	}
+
+	return api.WebSocketConnection{
+		ID:                    c.id,
+		UserID:                c.userID,
+		Username:              c.username,
+		OrgID:                 c.orgID,
+		Role:                  c.role,
+		Audience:              c.audience.String(),
+		Format:                string(c.format),
+		ConnectedAt:           c.connectedAt,
+		TokenExpiresAt:        tokenExpiresAt,
+		WebSocketSubscription: c.subscription(),
+		QueueDepth:            len(c.send),
+		QueueCapacity:         cap(c.send),
+	}
+}
+
+// Disconnect closes the connection with a close frame giving reason. The
+// read pump then fails and unregisters the client.
+func (c *Client) Disconnect(reason string) {
+	c.close(websocket.ClosePolicyViolation, reason)
+}
+
+// close sends a close frame with code and reason, then closes the connection
+func (c *Client) close(code int, reason string) {
+	if c.conn == nil {
+		return
 	}
+	c.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(writeWait))
+	c.conn.Close()
 }
 
 // ReadPump pumps messages from the WebSocket connection to the hub
@@ -90,14 +220,36 @@ func (c *Client) ReadPump() {
 	}
 }
 
-// WritePump pumps messages from the hub to the WebSocket connection
+// WritePump pumps messages from the hub to the WebSocket connection. It
+// also asks the client to reauthenticate before its token expires, and
+// closes the connection once it has.
 func (c *Client) WritePump() {
 	ticker := time.NewTicker(pingPeriod)
+	expiry := time.NewTimer(time.Hour)
 	defer func() {
 		ticker.Stop()
+		expiry.Stop()
 		c.conn.Close()
 	}()
 
+	// The timer first fires at the reauth notice and then at expiry
+	var expired <-chan time.Time
+	noticed := false
+	schedule := func() {
+		expiresAt := c.tokenExpiry()
+		if expiresAt.IsZero() {
+			expiry.Stop()
+			expired = nil
+			return
+		}
+		if !noticed {
+			expiresAt = expiresAt.Add(-reauthNotice)
+		}
+		expiry.Reset(time.Until(expiresAt))
+		expired = expiry.C
+	}
+	schedule()
+
 	for {
 		select {
 		case message, ok := <-c.send:
@@ -108,7 +260,7 @@ func (c *Client) WritePump() {
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
+			w, err := c.conn.NextWriter(c.format.frameType())
 			if err != nil {
 				return
 			}
@@ -117,7 +269,7 @@ func (c *Client) WritePump() {
 			// Add queued messages to the current websocket message
 			n := len(c.send)
 			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
+				w.Write(c.format.separator())
 				w.Write(<-c.send)
 			}
 
@@ -130,6 +282,35 @@ func (c *Client) WritePump() {
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+
+		case <-c.renewed:
+			noticed = false
+			schedule()
+
+		case <-expired:
+			if noticed {
+				c.logger.Info("WebSocket token expired, closing connection",
+					zap.String("user_id", c.userID),
+					zap.String("connection_id", c.id))
+				c.close(websocket.ClosePolicyViolation, "token expired")
+				return
+			}
+
+			noticed = true
+			message, err := encodeMessage(&api.WebSocketMessage{
+				Type:      "reauth_required",
+				Data:      map[string]time.Time{"expires_at": c.tokenExpiry()},
+				Timestamp: time.Now(),
+			}, c.format)
+			if err != nil {
+				c.logger.Error("Failed to marshal WebSocket message", zap.Error(err))
+				return
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(c.format.frameType(), message); err != nil {
+				return
+			}
+			schedule()
 		}
 	}
 }
@@ -141,60 +322,305 @@ func (c *Client) handleMessage(message []byte) {
 		c.logger.Warn("Failed to parse WebSocket message",
 			zap.Error(err),
 			zap.String("user_id", c.userID))
+		c.replyError("bad_request", "Message is not valid JSON")
 		return
 	}
 
 	switch msg.Type {
 	case "subscribe":
 		c.handleSubscribe(msg.Data)
+	case "reauth":
+		c.handleReauth(msg.Data)
+	case "get_filters":
+		c.filtersMu.RLock()
+		subscription := c.subscription()
+		c.filtersMu.RUnlock()
+		c.reply("filters", subscription)
 	case "pong":
 		// Client responded to ping, nothing to do
 	default:
 		c.logger.Debug("Unknown WebSocket message type",
 			zap.String("type", msg.Type),
 			zap.String("user_id", c.userID))
+		c.replyError("bad_request", fmt.Sprintf("Unknown message type %q", msg.Type))
 	}
 }
 
-// handleSubscribe updates client subscription filters
+// handleSubscribe updates client subscription filters and replies with
+// the filters now applied. A message with any invalid filter changes
+// nothing and is answered with an error.
 func (c *Client) handleSubscribe(data interface{}) {
-	filterData, ok := data.(map[string]interface{})
-	if !ok {
-		c.logger.Warn("Invalid subscribe message format",
+	c.filtersMu.Lock()
+	filters, err := c.parseSubscription(data, *c.filters)
+	if err == nil {
+		*c.filters = filters
+	}
+	subscription := c.subscription()
+	c.filtersMu.Unlock()
+
+	if errors.Is(err, errStreamForbidden) {
+		c.logger.Warn("Transaction stream subscription denied",
+			zap.String("user_id", c.userID),
+			zap.String("role", string(c.role)))
+		c.replyError("forbidden", "Access denied: "+err.Error())
+		return
+	}
+	if err != nil {
+		c.logger.Warn("Invalid subscribe message",
+			zap.Error(err),
+			zap.String("user_id", c.userID))
+		c.replyError("bad_request", "Invalid subscription: "+err.Error())
+		return
+	}
+
+	c.logger.Debug("Updated client subscription filters",
+		zap.String("user_id", c.userID),
+		zap.Int("severities", len(filters.Severities)),
+		zap.Int("types", len(filters.Types)),
+		zap.Int("addresses", len(filters.Addresses)),
+		zap.String("min_amount", filters.MinAmount.String()),
+		zap.Bool("transactions", filters.Transactions != nil))
+	c.reply("subscribed", subscription)
+}
+
+// handleReauth renews the client's token with a fresh one, so its
+// connection stays open, and replies with the new expiry. A rejected token
+// changes nothing.
+func (c *Client) handleReauth(data interface{}) {
+	if c.authenticate == nil {
+		c.replyError("bad_request", "This connection does not expire")
+		return
+	}
+	options, _ := data.(map[string]interface{})
+	token, _ := options["token"].(string)
+	if token == "" {
+		c.replyError("bad_request", "reauth needs a token")
+		return
+	}
+
+	expiresAt, err := c.authenticate(token)
+	if err != nil {
+		c.logger.Warn("WebSocket reauthentication failed",
+			zap.Error(err),
 			zap.String("user_id", c.userID))
+		c.replyError("unauthorized", "Invalid or expired token")
 		return
 	}
 
-	// Update severities filter
-	if severitiesRaw, ok := filterData["severities"].([]interface{}); ok {
-		severities := make([]models.Severity, 0, len(severitiesRaw))
-		for _, s := range severitiesRaw {
-			if sev, ok := s.(string); ok {
-				severities = append(severities, models.Severity(sev))
+	c.authMu.Lock()
+	c.expiresAt = expiresAt
+	c.authMu.Unlock()
+	select {
+	case c.renewed <- struct{}{}:
+	default:
+		// The write pump has yet to pick up an earlier renewal, and will
+		// read this expiry when it does
+	}
+
+	c.logger.Debug("WebSocket client reauthenticated",
+		zap.String("user_id", c.userID),
+		zap.Time("expires_at", expiresAt))
+	c.reply("reauthenticated", map[string]time.Time{"expires_at": expiresAt})
+}
+
+// parseSubscription returns current with the filters a subscribe message
+// names replaced. Filters it leaves out are kept; an empty list or null
+// clears one.
+func (c *Client) parseSubscription(data interface{}, current SubscriptionFilters) (SubscriptionFilters, error) {
+	filterData, ok := data.(map[string]interface{})
+	if !ok {
+		return current, fmt.Errorf("data must be an object of filters")
+	}
+	filters := current
+
+	for name, raw := range filterData {
+		switch name {
+		case "severities":
+			values, err := parseStrings(name, raw)
+			if err != nil {
+				return current, err
+			}
+			severities := make([]models.Severity, len(values))
+			for i, value := range values {
+				severities[i] = models.Severity(value)
+				if !severities[i].Valid() {
+					return current, fmt.Errorf("unknown severity %q", value)
+				}
+			}
+			filters.Severities = severities
+
+		case "types":
+			values, err := parseStrings(name, raw)
+			if err != nil {
+				return current, err
+			}
+			types := make([]models.OutlierType, len(values))
+			for i, value := range values {
+				types[i] = models.OutlierType(value)
+			}
+			filters.Types = types
+
+		case "addresses":
+			values, err := parseStrings(name, raw)
+			if err != nil {
+				return current, err
+			}
+			addresses := make([]string, len(values))
+			for i, value := range values {
+				addresses[i] = models.NormalizeAddress(value)
+			}
+			filters.Addresses = addresses
+
+		case "min_amount":
+			minAmount, err := parseAmount(raw)
+			if err != nil {
+				return current, fmt.Errorf("invalid min_amount: %w", err)
+			}
+			if minAmount.IsNegative() {
+				return current, fmt.Errorf("min_amount must not be negative")
+			}
+			filters.MinAmount = minAmount
+
+		case "transactions":
+			subscription, err := parseTransactionSubscription(raw)
+			if err != nil {
+				return current, err
 			}
+			if subscription != nil && !c.streamTxs {
+				return current, errStreamForbidden
+			}
+			filters.Transactions = subscription
+
+		default:
+			return current, fmt.Errorf("unknown filter %q", name)
 		}
-		c.filters.Severities = severities
 	}
+	return filters, nil
+}
 
-	// Update types filter
-	if typesRaw, ok := filterData["types"].([]interface{}); ok {
-		types := make([]models.OutlierType, 0, len(typesRaw))
-		for _, t := range typesRaw {
-			if typ, ok := t.(string); ok {
-				types = append(types, models.OutlierType(typ))
-			}
+// parseStrings reads a list of non-empty strings from a subscribe message;
+// null is an empty list
+func parseStrings(name string, raw interface{}) ([]string, error) {
+	if raw == nil {
+		return []string{}, nil
+	}
+	items, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be a list of strings", name)
+	}
+	values := make([]string, len(items))
+	for i, item := range items {
+		value, ok := item.(string)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%s must be a list of strings", name)
 		}
-		c.filters.Types = types
+		values[i] = value
 	}
+	return values, nil
+}
 
-	c.logger.Debug("Updated client subscription filters",
-		zap.String("user_id", c.userID),
-		zap.Int("severities", len(c.filters.Severities)),
-		zap.Int("types", len(c.filters.Types)))
+// parseAmount reads an amount from a subscribe message. Amounts may be sent
+// as strings to keep their precision; null is zero.
+func parseAmount(raw interface{}) (decimal.Decimal, error) {
+	switch amount := raw.(type) {
+	case nil:
+		return decimal.Zero, nil
+	case float64:
+		return decimal.NewFromFloat(amount), nil
+	case string:
+		return decimal.NewFromString(amount)
+	default:
+		return decimal.Zero, fmt.Errorf("amount must be a string or number")
+	}
+}
+
+// parseTransactionSubscription reads the transaction stream options of a
+// subscribe message: nil to unsubscribe, or an object with an optional
+// min_amount and sample_rate
+func parseTransactionSubscription(raw interface{}) (*api.WebSocketTransactionSubscription, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	options, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("transactions must be an object or null")
+	}
+
+	subscription := &api.WebSocketTransactionSubscription{SampleRate: 1}
+	minAmount, err := parseAmount(options["min_amount"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid min_amount: %w", err)
+	}
+	subscription.MinAmount = minAmount
+
+	if sampleRateRaw, ok := options["sample_rate"]; ok && sampleRateRaw != nil {
+		sampleRate, ok := sampleRateRaw.(float64)
+		if !ok || sampleRate <= 0 || sampleRate > 1 {
+			return nil, fmt.Errorf("sample_rate must be a number above 0 and at most 1")
+		}
+		subscription.SampleRate = sampleRate
+	}
+	return subscription, nil
+}
+
+// subscription returns a copy of the client's subscription filters. The
+// caller holds filtersMu.
+func (c *Client) subscription() api.WebSocketSubscription {
+	subscription := api.WebSocketSubscription{
+		Severities: append([]models.Severity{}, c.filters.Severities...),
+		Types:      append([]models.OutlierType{}, c.filters.Types...),
+		Addresses:  append([]string{}, c.filters.Addresses...),
+		MinAmount:  c.filters.MinAmount,
+	}
+	if c.filters.Transactions != nil {
+		transactions := *c.filters.Transactions
+		subscription.Transactions = &transactions
+	}
+	return subscription
+}
+
+// reply sends the client a message through the hub, which drops it if the
+// client has gone
+func (c *Client) reply(messageType string, data interface{}) {
+	c.hub.reply(c, &api.WebSocketMessage{
+		Type:      messageType,
+		Data:      data,
+		Timestamp: time.Now(),
+	})
+}
+
+// replyError tells the client a message was rejected, with the same error
+// codes as HTTP responses
+func (c *Client) replyError(code, message string) {
+	c.reply("error", map[string]string{"error": code, "message": message})
+}
+
+// wantsTransaction checks if the client subscribed to the transaction
+// stream and tx is over its threshold and picked by its sampling
+func (c *Client) wantsTransaction(tx *models.Transaction) bool {
+	c.filtersMu.RLock()
+	defer c.filtersMu.RUnlock()
+
+	subscription := c.filters.Transactions
+	if subscription == nil {
+		return false
+	}
+	if subscription.MinAmount.IsPositive() && tx.Amount.LessThan(subscription.MinAmount) {
+		return false
+	}
+	return subscription.SampleRate >= 1 || rand.Float64() < subscription.SampleRate
 }
 
-// matchesFilters checks if an outlier matches the client's subscription filters
+// matchesFilters checks if an outlier is shared or belongs to the client's
+// organization, and matches its subscription filters
 func (c *Client) matchesFilters(outlier *models.Outlier) bool {
+	if !outlier.Shared() && outlier.OrgID != c.orgID {
+		return false
+	}
+
+	c.filtersMu.RLock()
+	defer c.filtersMu.RUnlock()
+
 	// Check severity filter
 	if len(c.filters.Severities) > 0 {
 		match := false
@@ -223,5 +649,29 @@ func (c *Client) matchesFilters(outlier *models.Outlier) bool {
 		}
 	}
 
+	// Check address filter, against the outlier's address or, for
+	// watchlist hits, the other side of the transfer
+	if len(c.filters.Addresses) > 0 {
+		address := models.NormalizeAddress(outlier.Address)
+		counterparty, _ := outlier.Details["counterparty"].(string)
+		counterparty = models.NormalizeAddress(counterparty)
+		match := false
+		for _, subscribed := range c.filters.Addresses {
+			if address == subscribed || (counterparty != "" && counterparty == subscribed) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+
+	// Check amount filter; outliers without an amount, such as patterns
+	// spanning several transfers, never reach a threshold
+	if c.filters.MinAmount.IsPositive() && outlier.Amount.LessThan(c.filters.MinAmount) {
+		return false
+	}
+
 	return true
 }
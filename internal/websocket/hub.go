@@ -3,27 +3,97 @@ package websocket
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"runtime"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/metrics"
 	"github.com/mikedewar/stablerisk/pkg/models"
 	"go.uber.org/zap"
 )
 
+// Errors returned by RegisterClient
+var (
+	ErrUserConnectionLimit = errors.New("too many connections for this user")
+	ErrHubFull             = errors.New("server is at connection capacity")
+	ErrHubStopped          = errors.New("hub is shutting down")
+)
+
+// Audience is the least privileged client a broadcast reaches. Each client
+// is given a level from its role's permissions when it connects.
+type Audience int
+
+const (
+	AudienceViewer  Audience = iota // Every client
+	AudienceAnalyst                 // Clients whose role grants write:outliers
+	AudienceAdmin                   // Clients whose role grants manage:system
+)
+
+// String returns the audience's name
+func (a Audience) String() string {
+	switch a {
+	case AudienceAnalyst:
+		return "analyst"
+	case AudienceAdmin:
+		return "admin"
+	default:
+		return "viewer"
+	}
+}
+
+// broadcastShardSize is the fewest clients a broadcast hands to each
+// worker, so small broadcasts are not split up for nothing
+const broadcastShardSize = 64
+
+// Backplane relays broadcasts between the hubs of API instances, so a
+// client receives every instance's broadcasts, not just those of the
+// instance it is connected to
+type Backplane interface {
+	Publish(data []byte) error                 // Send a broadcast to every hub, this one included
+	Subscribe(handler func(data []byte)) error // Receive every hub's broadcasts
+}
+
+// HubConfig holds WebSocket hub configuration
+type HubConfig struct {
+	MaxConnections        int // Clients the hub accepts; 0 for no limit
+	MaxConnectionsPerUser int // Clients the hub accepts from one user; 0 for no limit
+	BroadcastWorkers      int // Goroutines a broadcast is fanned out over; defaults to one per CPU
+}
+
 // Hub maintains the set of active clients and broadcasts messages to them
 type Hub struct {
+	// Identifies the hub's broadcasts on the backplane
+	id string
+
 	// Registered clients
 	clients map[*Client]bool
 
+	// Connection limits
+	config HubConfig
+
 	// Register requests from clients
-	register chan *Client
+	register chan registration
 
 	// Unregister requests from clients
 	unregister chan *Client
 
-	// Broadcast messages to all clients
-	broadcast chan *api.WebSocketMessage
+	// Broadcast messages to the clients of an audience
+	broadcast chan broadcast
+
+	// Replies to messages from clients
+	replies chan clientReply
+
+	// Shares of a broadcast for the fan-out workers
+	fanout chan func()
+
+	// Relays broadcasts to other instances' hubs, if set, through a queue
+	backplane Backplane
+	relay     chan relayedBroadcast
 
 	// Logger
 	logger *zap.Logger
@@ -37,27 +107,74 @@ type Hub struct {
 	wg     sync.WaitGroup
 }
 
+// broadcast is a message for every client of an audience
+type broadcast struct {
+	message  *api.WebSocketMessage
+	audience Audience
+}
+
+// relayedBroadcast is a broadcast passed between hubs over the backplane
+type relayedBroadcast struct {
+	Origin   string                `json:"origin"`
+	Audience Audience              `json:"audience"`
+	Message  *api.WebSocketMessage `json:"message"`
+}
+
+// registration asks the hub's loop to accept a client, answering on result
+type registration struct {
+	client *Client
+	result chan error
+}
+
+// clientReply is a message for a single client, sent from the hub's loop so
+// it cannot race the client being dropped
+type clientReply struct {
+	client  *Client
+	message *api.WebSocketMessage
+}
+
 // NewHub creates a new WebSocket hub
-func NewHub(logger *zap.Logger) *Hub {
+func NewHub(config HubConfig, logger *zap.Logger) *Hub {
 	if logger == nil {
 		logger = zap.NewNop()
 	}
 
+	if config.BroadcastWorkers <= 0 {
+		config.BroadcastWorkers = runtime.GOMAXPROCS(0)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Hub{
+		id:         uuid.New().String(),
 		clients:    make(map[*Client]bool),
-		register:   make(chan *Client),
+		config:     config,
+		register:   make(chan registration),
 		unregister: make(chan *Client),
-		broadcast:  make(chan *api.WebSocketMessage, 256),
+		broadcast:  make(chan broadcast, 256),
+		replies:    make(chan clientReply, 64),
+		fanout:     make(chan func(), config.BroadcastWorkers),
+		relay:      make(chan relayedBroadcast, 256),
 		logger:     logger,
 		ctx:        ctx,
 		cancel:     cancel,
 	}
 }
 
-// Start runs the hub's main loop
+// Start runs the hub's main loop and its fan-out workers. The loop itself
+// delivers one share of each broadcast, so it starts one worker fewer than
+// configured.
 func (h *Hub) Start() {
+	for i := 1; i < h.config.BroadcastWorkers; i++ {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			for deliver := range h.fanout {
+				deliver()
+			}
+		}()
+	}
+
 	h.wg.Add(1)
 	go h.run()
 }
@@ -70,16 +187,27 @@ func (h *Hub) Stop() {
 	h.logger.Info("WebSocket hub shutdown complete")
 }
 
-// run is the main event loop for the hub
+// run is the main event loop for the hub. It alone adds clients to and
+// removes them from the hub and closes their send channels, so nothing else
+// can send to a closed channel.
 func (h *Hub) run() {
 	defer h.wg.Done()
+	defer close(h.fanout)
 
 	for {
 		select {
-		case client := <-h.register:
+		case registration := <-h.register:
+			client := registration.client
+			if err := h.admit(client); err != nil {
+				registration.result <- err
+				continue
+			}
+
 			h.mu.Lock()
 			h.clients[client] = true
+			metrics.WebSocketClients.WithLabelValues().Set(float64(len(h.clients)))
 			h.mu.Unlock()
+			registration.result <- nil
 
 			h.logger.Info("Client connected",
 				zap.String("user_id", client.userID),
@@ -98,6 +226,7 @@ func (h *Hub) run() {
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
 				close(client.send)
+				metrics.WebSocketClients.WithLabelValues().Set(float64(len(h.clients)))
 
 				h.logger.Info("Client disconnected",
 					zap.String("user_id", client.userID),
@@ -106,8 +235,16 @@ func (h *Hub) run() {
 			}
 			h.mu.Unlock()
 
-		case message := <-h.broadcast:
-			h.broadcastMessage(message)
+		case broadcast := <-h.broadcast:
+			h.broadcastMessage(broadcast.message, broadcast.audience)
+
+		case reply := <-h.replies:
+			h.mu.RLock()
+			registered := h.clients[reply.client]
+			h.mu.RUnlock()
+			if registered {
+				h.sendToClient(reply.client, reply.message)
+			}
 
 		case <-h.ctx.Done():
 			// Graceful shutdown: close all client connections
@@ -116,17 +253,57 @@ func (h *Hub) run() {
 				close(client.send)
 			}
 			h.clients = make(map[*Client]bool)
+			metrics.WebSocketClients.WithLabelValues().Set(float64(len(h.clients)))
 			h.mu.Unlock()
 			return
 		}
 	}
 }
 
-// broadcastMessage sends a message to all connected clients
-func (h *Hub) broadcastMessage(message *api.WebSocketMessage) {
+// admit checks client against the connection limits, closing its
+// connection with a close code saying which limit it hit when it is over
+// one. Rejections are counted in stablerisk_websocket_rejected_total.
+func (h *Hub) admit(client *Client) error {
 	h.mu.RLock()
-	defer h.mu.RUnlock()
+	total := len(h.clients)
+	userConnections := 0
+	for c := range h.clients {
+		if c.userID == client.userID {
+			userConnections++
+		}
+	}
+	h.mu.RUnlock()
+
+	var (
+		err   error
+		limit string
+		code  int
+	)
+	switch {
+	case h.config.MaxConnectionsPerUser > 0 && userConnections >= h.config.MaxConnectionsPerUser:
+		err, limit, code = ErrUserConnectionLimit, "user", websocket.ClosePolicyViolation
+	case h.config.MaxConnections > 0 && total >= h.config.MaxConnections:
+		err, limit, code = ErrHubFull, "instance", websocket.CloseTryAgainLater
+	default:
+		return nil
+	}
+
+	metrics.WebSocketRejected.WithLabelValues(limit).Inc()
+	h.logger.Warn("WebSocket connection rejected",
+		zap.String("user_id", client.userID),
+		zap.String("limit", limit),
+		zap.Int("user_connections", userConnections),
+		zap.Int("total_clients", total))
+	client.close(code, err.Error())
+	return err
+}
 
+// broadcastMessage sends a message to the connected clients of audience.
+// The clients are split into shards delivered in parallel by the fan-out
+// workers, and the hub waits for every shard so each client still gets
+// messages in order. Sends never block: clients whose queue is full are
+// disconnected afterwards, except that they only miss transactions.
+func (h *Hub) broadcastMessage(message *api.WebSocketMessage, audience Audience) {
 	messageJSON, err := json.Marshal(message)
 	if err != nil {
 		h.logger.Error("Failed to marshal WebSocket message",
@@ -134,6 +311,14 @@ func (h *Hub) broadcastMessage(message *api.WebSocketMessage) {
 		return
 	}
 
+	// Transactions only go to clients subscribed to the stream
+	var tx *models.Transaction
+	if message.Type == "transaction" {
+		if data, ok := message.Data.(models.Transaction); ok {
+			tx = &data
+		}
+	}
+
 	// Extract outlier if this is an outlier message (for filtering)
 	var outlier *models.Outlier
 	if message.Type == "outlier" {
@@ -149,34 +334,135 @@ func (h *Hub) broadcastMessage(message *api.WebSocketMessage) {
 		}
 	}
 
-	sentCount := 0
+	h.mu.RLock()
+	total := len(h.clients)
+	recipients := make([]*Client, 0, total)
+	binary := false
 	for client := range h.clients {
-		// Apply filters if this is an outlier message
-		if outlier != nil && !client.matchesFilters(outlier) {
-			continue
+		if client.audience >= audience {
+			recipients = append(recipients, client)
+			binary = binary || client.format == FormatMsgpack
+		}
+	}
+	h.mu.RUnlock()
+
+	// The message is encoded once for all clients of a format
+	payloads := map[Format][]byte{FormatJSON: messageJSON}
+	if binary {
+		messageMsgpack, err := msgpackFromJSON(messageJSON)
+		if err != nil {
+			h.logger.Error("Failed to encode WebSocket message as MessagePack",
+				zap.Error(err))
+		} else {
+			payloads[FormatMsgpack] = messageMsgpack
 		}
+	}
 
-		select {
-		case client.send <- messageJSON:
-			sentCount++
-		default:
-			// Client send buffer is full, close connection
-			close(client.send)
-			delete(h.clients, client)
-			h.logger.Warn("Client send buffer full, closing connection",
-				zap.String("user_id", client.userID))
+	deliver := func(clients []*Client) delivery {
+		var result delivery
+		for _, client := range clients {
+			// Apply filters if this is an outlier message
+			if outlier != nil && !client.matchesFilters(outlier) {
+				continue
+			}
+			if message.Type == "transaction" && (tx == nil || !client.wantsTransaction(tx)) {
+				continue
+			}
+
+			payload, ok := payloads[client.format]
+			if !ok {
+				continue
+			}
+
+			select {
+			case client.send <- payload:
+				result.sent++
+			default:
+				metrics.WebSocketMessagesDropped.WithLabelValues(message.Type, "client_queue_full").Inc()
+				if tx != nil {
+					// A slow client misses ticker entries rather than its connection
+					continue
+				}
+				result.slow = append(result.slow, client)
+			}
+		}
+		return result
+	}
+
+	shards := shardClients(recipients, h.config.BroadcastWorkers)
+	results := make([]delivery, len(shards))
+	var wg sync.WaitGroup
+	for i := 1; i < len(shards); i++ {
+		i := i
+		wg.Add(1)
+		h.fanout <- func() {
+			defer wg.Done()
+			results[i] = deliver(shards[i])
+		}
+	}
+	if len(shards) > 0 {
+		results[0] = deliver(shards[0])
+	}
+	wg.Wait()
+
+	sentCount := 0
+	for _, result := range results {
+		sentCount += result.sent
+		for _, client := range result.slow {
+			h.dropClient(client)
 		}
 	}
 
 	h.logger.Debug("Broadcast message sent",
 		zap.String("type", message.Type),
+		zap.Stringer("audience", audience),
 		zap.Int("recipients", sentCount),
-		zap.Int("total_clients", len(h.clients)))
+		zap.Int("total_clients", total))
+}
+
+// delivery is what delivering a broadcast to a shard of clients did
+type delivery struct {
+	sent int       // Clients the message was queued for
+	slow []*Client // Clients whose queue was full
+}
+
+// shardClients splits clients into at most workers shards of at least
+// broadcastShardSize clients each
+func shardClients(clients []*Client, workers int) [][]*Client {
+	count := (len(clients) + broadcastShardSize - 1) / broadcastShardSize
+	if count > workers {
+		count = workers
+	}
+
+	shards := make([][]*Client, 0, count)
+	for i := 0; i < count; i++ {
+		shards = append(shards, clients[i*len(clients)/count:(i+1)*len(clients)/count])
+	}
+	return shards
+}
+
+// dropClient disconnects a client whose send queue filled up. Closing its
+// send channel makes its write pump close the connection. Only the hub's
+// loop calls it.
+func (h *Hub) dropClient(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	delete(h.clients, client)
+	close(client.send)
+	metrics.WebSocketClients.WithLabelValues().Set(float64(len(h.clients)))
+	metrics.WebSocketSlowClients.WithLabelValues().Inc()
+	h.logger.Warn("Client send buffer full, closing connection",
+		zap.String("user_id", client.userID),
+		zap.String("connection_id", client.id))
 }
 
 // sendToClient sends a message to a specific client
 func (h *Hub) sendToClient(client *Client, message *api.WebSocketMessage) {
-	messageJSON, err := json.Marshal(message)
+	payload, err := encodeMessage(message, client.format)
 	if err != nil {
 		h.logger.Error("Failed to marshal WebSocket message",
 			zap.Error(err))
@@ -184,43 +470,210 @@ func (h *Hub) sendToClient(client *Client, message *api.WebSocketMessage) {
 	}
 
 	select {
-	case client.send <- messageJSON:
+	case client.send <- payload:
 	default:
+		metrics.WebSocketMessagesDropped.WithLabelValues(message.Type, "client_queue_full").Inc()
 		h.logger.Warn("Failed to send message to client",
 			zap.String("user_id", client.userID))
 	}
 }
 
+// reply queues a message for client, waiting while the hub runs
+func (h *Hub) reply(client *Client, message *api.WebSocketMessage) {
+	select {
+	case h.replies <- clientReply{client: client, message: message}:
+	case <-h.ctx.Done():
+	}
+}
+
+// SetBackplane relays the hub's broadcasts to the hubs of other API
+// instances and theirs to this hub's clients. Call it once, after Start.
+func (h *Hub) SetBackplane(backplane Backplane) error {
+	if err := backplane.Subscribe(h.receiveRelayed); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.backplane = backplane
+	h.mu.Unlock()
+
+	h.wg.Add(1)
+	go h.runRelay(backplane)
+	return nil
+}
+
+// runRelay publishes queued broadcasts to the backplane until the hub stops
+func (h *Hub) runRelay(backplane Backplane) {
+	defer h.wg.Done()
+
+	for {
+		select {
+		case relayed := <-h.relay:
+			data, err := json.Marshal(relayed)
+			if err != nil {
+				h.logger.Error("Failed to marshal WebSocket broadcast for relay",
+					zap.Error(err))
+				continue
+			}
+			if err := backplane.Publish(data); err != nil {
+				metrics.WebSocketMessagesDropped.WithLabelValues(relayed.Message.Type, "backplane").Inc()
+				h.logger.Warn("Failed to relay WebSocket broadcast",
+					zap.String("type", relayed.Message.Type),
+					zap.Error(err))
+				continue
+			}
+			metrics.WebSocketRelayed.WithLabelValues("sent").Inc()
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+// relayBroadcast queues a broadcast for the other hubs, if there is a
+// backplane. It never blocks; when the backplane is behind the broadcast
+// only reaches this hub's clients.
+func (h *Hub) relayBroadcast(message *api.WebSocketMessage, audience Audience) {
+	h.mu.RLock()
+	backplane := h.backplane
+	h.mu.RUnlock()
+	if backplane == nil {
+		return
+	}
+
+	select {
+	case h.relay <- relayedBroadcast{Origin: h.id, Audience: audience, Message: message}:
+	default:
+		metrics.WebSocketMessagesDropped.WithLabelValues(message.Type, "backplane").Inc()
+		h.logger.Warn("WebSocket backplane busy, not relaying broadcast",
+			zap.String("type", message.Type))
+	}
+}
+
+// receiveRelayed broadcasts another hub's broadcast to this hub's clients
+func (h *Hub) receiveRelayed(data []byte) {
+	var relayed relayedBroadcast
+	if err := json.Unmarshal(data, &relayed); err != nil || relayed.Message == nil {
+		h.logger.Warn("Failed to decode relayed WebSocket broadcast", zap.Error(err))
+		return
+	}
+	if relayed.Origin == h.id {
+		return
+	}
+
+	metrics.WebSocketRelayed.WithLabelValues("received").Inc()
+	select {
+	case h.broadcast <- broadcast{message: relayed.Message, audience: relayed.Audience}:
+	case <-h.ctx.Done():
+	}
+}
+
+// Broadcast sends a message of messageType to every client of audience, on
+// every API instance when the hub has a backplane
+func (h *Hub) Broadcast(messageType string, data interface{}, audience Audience) {
+	message := &api.WebSocketMessage{
+		Type:      messageType,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+	h.relayBroadcast(message, audience)
+	h.broadcast <- broadcast{message: message, audience: audience}
+}
+
+// BroadcastLocal sends a message of messageType to this hub's clients of
+// audience only. It is for messages every API instance receives anyway,
+// such as outliers from the bus.
+func (h *Hub) BroadcastLocal(messageType string, data interface{}, audience Audience) {
+	h.broadcast <- broadcast{
+		message: &api.WebSocketMessage{
+			Type:      messageType,
+			Data:      data,
+			Timestamp: time.Now(),
+		},
+		audience: audience,
+	}
+}
+
 // BroadcastOutlier broadcasts an outlier to all connected clients
 func (h *Hub) BroadcastOutlier(outlier models.Outlier) {
-	h.broadcast <- &api.WebSocketMessage{
-		Type:      "outlier",
-		Data:      outlier,
-		Timestamp: time.Now(),
+	h.Broadcast("outlier", outlier, AudienceViewer)
+}
+
+// BroadcastTransaction sends a transaction to this hub's clients subscribed
+// to the live transaction stream; every instance reads transactions from
+// the bus, so they are not relayed. It never blocks: transactions only take up half
+// of the hub's queue and are dropped beyond that, so a burst of transfers
+// cannot hold up outliers.
+func (h *Hub) BroadcastTransaction(tx models.Transaction) {
+	if len(h.broadcast) >= cap(h.broadcast)/2 {
+		metrics.WebSocketMessagesDropped.WithLabelValues("transaction", "hub_busy").Inc()
+		h.logger.Debug("WebSocket hub busy, dropping transaction",
+			zap.String("tx_hash", tx.TxHash))
+		return
+	}
+
+	select {
+	case h.broadcast <- broadcast{
+		message: &api.WebSocketMessage{
+			Type:      "transaction",
+			Data:      tx,
+			Timestamp: time.Now(),
+		},
+		audience: AudienceViewer,
+	}:
+	default:
+		metrics.WebSocketMessagesDropped.WithLabelValues("transaction", "hub_busy").Inc()
 	}
 }
 
 // BroadcastStatistics broadcasts statistics update to all connected clients
 func (h *Hub) BroadcastStatistics(stats interface{}) {
-	h.broadcast <- &api.WebSocketMessage{
-		Type:      "statistics",
-		Data:      stats,
-		Timestamp: time.Now(),
-	}
+	h.Broadcast("statistics", stats, AudienceViewer)
 }
 
 // BroadcastSystemMessage broadcasts a system message to all connected clients
 func (h *Hub) BroadcastSystemMessage(message string) {
-	h.broadcast <- &api.WebSocketMessage{
-		Type:      "system",
-		Data:      map[string]string{"message": message},
+	h.Broadcast("system", map[string]string{"message": message}, AudienceViewer)
+}
+
+// BroadcastOperational tells admins about the deployment's state, such as
+// a failed detection run or Raphtory's circuit breaker opening, as an
+// "operational" message naming event. It never blocks, so it can be called
+// from code that must not wait on clients; when the hub is behind the
+// event is logged and dropped.
+func (h *Hub) BroadcastOperational(event string, details map[string]interface{}) {
+	data := map[string]interface{}{"event": event}
+	for key, value := range details {
+		data[key] = value
+	}
+	message := &api.WebSocketMessage{
+		Type:      "operational",
+		Data:      data,
 		Timestamp: time.Now(),
 	}
+	h.relayBroadcast(message, AudienceAdmin)
+
+	select {
+	case h.broadcast <- broadcast{message: message, audience: AudienceAdmin}:
+	default:
+		metrics.WebSocketMessagesDropped.WithLabelValues("operational", "hub_busy").Inc()
+		h.logger.Warn("WebSocket hub busy, dropping operational message",
+			zap.String("event", event))
+	}
 }
 
-// RegisterClient registers a new client with the hub
-func (h *Hub) RegisterClient(client *Client) {
-	h.register <- client
+// RegisterClient registers a new client with the hub. A client over the
+// per-user or instance connection limit is refused: its connection is
+// closed and ErrUserConnectionLimit or ErrHubFull returned, so its pumps
+// must not be started.
+func (h *Hub) RegisterClient(client *Client) error {
+	result := make(chan error, 1)
+	select {
+	case h.register <- registration{client: client, result: result}:
+		return <-result
+	case <-h.ctx.Done():
+		client.close(websocket.CloseGoingAway, ErrHubStopped.Error())
+		return ErrHubStopped
+	}
 }
 
 // UnregisterClient unregisters a client from the hub
@@ -248,3 +701,31 @@ func (h *Hub) GetClientsByUser(userID string) []*Client {
 	}
 	return userClients
 }
+
+// Connections describes every connected client, oldest connection first
+func (h *Hub) Connections() []api.WebSocketConnection {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	connections := make([]api.WebSocketConnection, 0, len(h.clients))
+	for client := range h.clients {
+		connections = append(connections, client.Info())
+	}
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].ConnectedAt.Before(connections[j].ConnectedAt)
+	})
+	return connections
+}
+
+// GetClient returns the connected client with id, or nil
+func (h *Hub) GetClient(id string) *Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for client := range h.clients {
+		if client.id == id {
+			return client
+		}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+// Package migrations embeds the database migrations in the binaries, so
+// the API can apply them itself on startup or with its migrate subcommand.
+package migrations
+
+import "embed"
+
+// Postgres holds the PostgreSQL migrations under postgres/, named
+// NNN_description.sql and applied in order of NNN
+//
+//go:embed postgres/*.sql
+var Postgres embed.FS
@@ -0,0 +1,17 @@
+-- Allow outliers produced by the DBSCAN clustering detector
+
+ALTER TABLE outliers DROP CONSTRAINT IF EXISTS outliers_type_check;
+ALTER TABLE outliers ADD CONSTRAINT outliers_type_check CHECK (type IN (
+    'zscore', 'iqr', 'dbscan',
+    'pattern_circulation', 'pattern_fanout', 'pattern_fanin', 'pattern_dormant', 'pattern_velocity'
+));
+
+-- Log the migration
+INSERT INTO audit_logs (action, resource, details, signature, user_id)
+VALUES (
+    'migration',
+    'database',
+    '{"migration": "003_dbscan_outlier_type", "description": "Allow dbscan outlier type"}',
+    encode(digest('003_dbscan_outlier_type', 'sha256'), 'hex'),
+    'system'
+);
@@ -0,0 +1,17 @@
+-- Analyst feedback labels on outliers, used for detector tuning
+
+ALTER TABLE outliers ADD COLUMN IF NOT EXISTS feedback TEXT
+    CHECK (feedback IN ('true_positive', 'false_positive'));
+
+-- Tuning report reads labelled outliers per detector type
+CREATE INDEX IF NOT EXISTS idx_outliers_feedback ON outliers(type, detected_at DESC) WHERE feedback IS NOT NULL;
+
+-- Log the migration
+INSERT INTO audit_logs (action, resource, details, signature, user_id)
+VALUES (
+    'migration',
+    'database',
+    '{"migration": "004_outlier_feedback", "description": "Add analyst feedback label to outliers"}',
+    encode(digest('004_outlier_feedback', 'sha256'), 'hex'),
+    'system'
+);
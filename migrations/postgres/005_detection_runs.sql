@@ -0,0 +1,31 @@
+-- Detection run history, one row per scheduled or on-demand detection cycle
+
+CREATE TABLE IF NOT EXISTS detection_runs (
+    id UUID PRIMARY KEY,
+    trigger TEXT NOT NULL CHECK (trigger IN ('scheduled', 'manual')),
+    triggered_by TEXT,
+    status TEXT NOT NULL CHECK (status IN ('running', 'completed', 'failed')),
+    started_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ,
+    window_start TIMESTAMPTZ NOT NULL,
+    window_end TIMESTAMPTZ NOT NULL,
+    transactions_analyzed INTEGER NOT NULL DEFAULT 0,
+    outliers_found INTEGER NOT NULL DEFAULT 0,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    detector_versions JSONB NOT NULL DEFAULT '{}',
+    error TEXT
+);
+
+-- Run history is listed newest first
+CREATE INDEX IF NOT EXISTS idx_detection_runs_started_at ON detection_runs(started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_detection_runs_status ON detection_runs(status);
+
+-- Log the migration
+INSERT INTO audit_logs (action, resource, details, signature, user_id)
+VALUES (
+    'migration',
+    'database',
+    '{"migration": "005_detection_runs", "description": "Add detection run history table"}',
+    encode(digest('005_detection_runs', 'sha256'), 'hex'),
+    'system'
+);
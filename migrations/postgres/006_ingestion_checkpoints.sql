@@ -0,0 +1,17 @@
+-- Polling checkpoints so the monitor resumes ingestion after a restart
+
+CREATE TABLE IF NOT EXISTS ingestion_checkpoints (
+    name TEXT PRIMARY KEY,
+    block_timestamp BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Log the migration
+INSERT INTO audit_logs (action, resource, details, signature, user_id)
+VALUES (
+    'migration',
+    'database',
+    '{"migration": "006_ingestion_checkpoints", "description": "Add ingestion checkpoint table"}',
+    encode(digest('006_ingestion_checkpoints', 'sha256'), 'hex'),
+    'system'
+);
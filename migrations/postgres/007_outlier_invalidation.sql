@@ -0,0 +1,18 @@
+-- Outliers tied to transactions reverted by a chain reorganisation are
+-- invalidated rather than deleted, so analyst history is preserved
+
+ALTER TABLE outliers ADD COLUMN IF NOT EXISTS invalidated BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE outliers ADD COLUMN IF NOT EXISTS invalidated_at TIMESTAMPTZ;
+ALTER TABLE outliers ADD COLUMN IF NOT EXISTS invalid_reason TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_outliers_invalidated ON outliers(detected_at DESC) WHERE invalidated = true;
+
+-- Log the migration
+INSERT INTO audit_logs (action, resource, details, signature, user_id)
+VALUES (
+    'migration',
+    'database',
+    '{"migration": "007_outlier_invalidation", "description": "Add reorg invalidation to outliers"}',
+    encode(digest('007_outlier_invalidation', 'sha256'), 'hex'),
+    'system'
+);
@@ -0,0 +1,21 @@
+-- Durable outbox for Raphtory writes so an outage does not leave gaps in the graph
+
+CREATE TABLE IF NOT EXISTS raphtory_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    op VARCHAR(16) NOT NULL CHECK (op IN ('add', 'delete')),
+    tx_hash VARCHAR(128) NOT NULL,
+    payload JSONB,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Log the migration
+INSERT INTO audit_logs (action, resource, details, signature, user_id)
+VALUES (
+    'migration',
+    'database',
+    '{"migration": "008_raphtory_outbox", "description": "Add Raphtory outbox table"}',
+    encode(digest('008_raphtory_outbox', 'sha256'), 'hex'),
+    'system'
+);
@@ -0,0 +1,29 @@
+-- Issuer administrative events (blacklisting, destroyed funds, issue and redeem)
+
+CREATE TABLE IF NOT EXISTS issuer_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tx_hash VARCHAR(128) NOT NULL,
+    type VARCHAR(32) NOT NULL CHECK (type IN ('blacklisted', 'unblacklisted', 'funds_destroyed', 'issue', 'redeem')),
+    address VARCHAR(64) NOT NULL DEFAULT '',
+    amount NUMERIC(30, 6) NOT NULL DEFAULT 0,
+    block_number BIGINT NOT NULL,
+    timestamp TIMESTAMPTZ NOT NULL,
+    contract VARCHAR(64) NOT NULL,
+    token VARCHAR(16) NOT NULL DEFAULT '',
+    chain VARCHAR(16) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tx_hash, type, address)
+);
+
+CREATE INDEX IF NOT EXISTS idx_issuer_events_timestamp ON issuer_events(timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_issuer_events_address ON issuer_events(address);
+
+-- Log the migration
+INSERT INTO audit_logs (action, resource, details, signature, user_id)
+VALUES (
+    'migration',
+    'database',
+    '{"migration": "009_issuer_events", "description": "Add issuer events table"}',
+    encode(digest('009_issuer_events', 'sha256'), 'hex'),
+    'system'
+);
@@ -0,0 +1,15 @@
+-- Allow confirmation updates to be queued in the Raphtory outbox
+
+ALTER TABLE raphtory_outbox DROP CONSTRAINT IF EXISTS raphtory_outbox_op_check;
+ALTER TABLE raphtory_outbox
+    ADD CONSTRAINT raphtory_outbox_op_check CHECK (op IN ('add', 'delete', 'confirm'));
+
+-- Log the migration
+INSERT INTO audit_logs (action, resource, details, signature, user_id)
+VALUES (
+    'migration',
+    'database',
+    '{"migration": "010_outbox_confirm", "description": "Add confirm operation to Raphtory outbox"}',
+    encode(digest('010_outbox_confirm', 'sha256'), 'hex'),
+    'system'
+);
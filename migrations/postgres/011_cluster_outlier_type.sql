@@ -0,0 +1,18 @@
+-- Allow outliers raised for suspicious address communities
+
+ALTER TABLE outliers DROP CONSTRAINT IF EXISTS outliers_type_check;
+ALTER TABLE outliers ADD CONSTRAINT outliers_type_check CHECK (type IN (
+    'zscore', 'iqr', 'dbscan',
+    'pattern_circulation', 'pattern_fanout', 'pattern_fanin', 'pattern_dormant', 'pattern_velocity',
+    'pattern_cluster'
+));
+
+-- Log the migration
+INSERT INTO audit_logs (action, resource, details, signature, user_id)
+VALUES (
+    'migration',
+    'database',
+    '{"migration": "011_cluster_outlier_type", "description": "Allow pattern_cluster outlier type"}',
+    encode(digest('011_cluster_outlier_type', 'sha256'), 'hex'),
+    'system'
+);
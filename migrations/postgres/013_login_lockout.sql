@@ -0,0 +1,24 @@
+-- Brute-force protection for logins: per-account lockout and per-IP failure counts
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_login_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS login_failures (
+    id BIGSERIAL PRIMARY KEY,
+    username TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+    attempted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_failures_ip_attempted_at ON login_failures(ip_address, attempted_at);
+CREATE INDEX IF NOT EXISTS idx_login_failures_attempted_at ON login_failures(attempted_at);
+
+-- Log the migration
+INSERT INTO audit_logs (action, resource, details, signature, user_id)
+VALUES (
+    'migration',
+    'database',
+    '{"migration": "013_login_lockout", "description": "Add account lockout columns and login failures table"}',
+    encode(digest('013_login_lockout', 'sha256'), 'hex'),
+    'system'
+);
@@ -0,0 +1,16 @@
+-- Scoped, rate-limited API keys for service-to-service access
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS key_prefix TEXT NOT NULL DEFAULT '';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS scopes JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rate_limit INTEGER NOT NULL DEFAULT 0 CHECK (rate_limit >= 0);
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS created_by UUID REFERENCES users(id);
+
+-- Log the migration
+INSERT INTO audit_logs (action, resource, details, signature, user_id)
+VALUES (
+    'migration',
+    'database',
+    '{"migration": "014_api_key_scopes", "description": "Add scopes, rate limits and prefixes to API keys"}',
+    encode(digest('014_api_key_scopes', 'sha256'), 'hex'),
+    'system'
+);
@@ -0,0 +1,56 @@
+-- Role→permission mappings, replacing the permissions hard-coded per role,
+-- so deployments can define custom roles
+
+CREATE TABLE IF NOT EXISTS roles (
+    name TEXT PRIMARY KEY,
+    description TEXT,
+    built_in BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT role_name_format CHECK (name ~ '^[a-z][a-z0-9_-]{1,31}$')
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission TEXT NOT NULL,
+    PRIMARY KEY (role, permission)
+);
+
+-- Built-in roles, with the permissions they had before
+INSERT INTO roles (name, description, built_in) VALUES
+    ('admin', 'Full access', true),
+    ('analyst', 'Read outliers, transactions and statistics; acknowledge outliers; trigger detection', true),
+    ('viewer', 'Read-only access', true)
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'read:outliers'),
+    ('admin', 'read:transactions'),
+    ('admin', 'read:statistics'),
+    ('admin', 'read:users'),
+    ('admin', 'write:outliers'),
+    ('admin', 'trigger:detection'),
+    ('admin', 'manage:users'),
+    ('admin', 'manage:system'),
+    ('analyst', 'read:outliers'),
+    ('analyst', 'read:transactions'),
+    ('analyst', 'read:statistics'),
+    ('analyst', 'write:outliers'),
+    ('analyst', 'trigger:detection'),
+    ('viewer', 'read:outliers'),
+    ('viewer', 'read:transactions'),
+    ('viewer', 'read:statistics')
+ON CONFLICT DO NOTHING;
+
+-- Users may hold any defined role
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles(name);
+
+-- Log the migration
+INSERT INTO audit_logs (action, resource, details, signature, user_id)
+VALUES (
+    'migration',
+    'database',
+    '{"migration": "015_role_permissions", "description": "Add roles and role_permissions tables"}',
+    encode(digest('015_role_permissions', 'sha256'), 'hex'),
+    'system'
+);
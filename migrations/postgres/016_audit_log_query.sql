@@ -0,0 +1,19 @@
+-- Audit log queries: the status column AuditLogger writes, and a permission
+-- to read the log
+
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS status TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_status ON audit_logs(status);
+
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'read:audit')
+ON CONFLICT DO NOTHING;
+
+-- Log the migration
+INSERT INTO audit_logs (action, resource, details, signature, user_id)
+VALUES (
+    'migration',
+    'database',
+    '{"migration": "016_audit_log_query", "description": "Add audit_logs.status and the read:audit permission"}',
+    encode(digest('016_audit_log_query', 'sha256'), 'hex'),
+    'system'
+);
@@ -0,0 +1,42 @@
+-- Hash-chained audit log: each record carries its place in the chain and
+-- the previous record's signature, the head is tracked in a single row that
+-- writers lock, and the head is periodically anchored
+
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS sequence BIGINT;
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS prev_signature TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_logs_sequence ON audit_logs(sequence);
+
+CREATE TABLE IF NOT EXISTS audit_chain_head (
+    id INTEGER PRIMARY KEY,
+    sequence BIGINT NOT NULL,
+    signature TEXT NOT NULL,
+    CONSTRAINT single_row CHECK (id = 1)
+);
+
+INSERT INTO audit_chain_head (id, sequence, signature) VALUES (1, 0, '')
+ON CONFLICT DO NOTHING;
+
+-- Anchors are append-only, like audit_logs
+CREATE TABLE IF NOT EXISTS audit_anchors (
+    id BIGSERIAL PRIMARY KEY,
+    sequence BIGINT NOT NULL,
+    signature TEXT NOT NULL,
+    anchor_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_anchors_sequence ON audit_anchors(sequence);
+
+CREATE OR REPLACE RULE audit_anchors_no_update AS ON UPDATE TO audit_anchors DO INSTEAD NOTHING;
+CREATE OR REPLACE RULE audit_anchors_no_delete AS ON DELETE TO audit_anchors DO INSTEAD NOTHING;
+
+-- Log the migration
+INSERT INTO audit_logs (action, resource, details, signature, user_id)
+VALUES (
+    'migration',
+    'database',
+    '{"migration": "017_audit_chain", "description": "Chain audit log signatures and anchor the chain head"}',
+    encode(digest('017_audit_chain', 'sha256'), 'hex'),
+    'system'
+);
@@ -0,0 +1,31 @@
+-- Audit log retention: manifests of archived audit records, and deletion
+-- of audit_logs rows only once a manifest covers them
+
+CREATE TABLE IF NOT EXISTS audit_archives (
+    id BIGSERIAL PRIMARY KEY,
+    object_key TEXT NOT NULL UNIQUE,
+    records INTEGER NOT NULL,
+    first_sequence BIGINT NOT NULL DEFAULT 0,  -- 0 for records written before chaining
+    last_sequence BIGINT NOT NULL DEFAULT 0,
+    last_signature TEXT NOT NULL DEFAULT '',
+    unchained_before TIMESTAMPTZ,
+    first_timestamp TIMESTAMPTZ NOT NULL,
+    last_timestamp TIMESTAMPTZ NOT NULL,
+    sha256 TEXT NOT NULL,
+    signature TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_archives_first_sequence ON audit_archives(first_sequence);
+
+CREATE OR REPLACE RULE audit_archives_no_update AS ON UPDATE TO audit_archives DO INSTEAD NOTHING;
+CREATE OR REPLACE RULE audit_archives_no_delete AS ON DELETE TO audit_archives DO INSTEAD NOTHING;
+
+-- audit_logs stays append-only except for archived rows
+CREATE OR REPLACE RULE audit_logs_no_delete AS ON DELETE TO audit_logs
+WHERE NOT EXISTS (
+    SELECT 1 FROM audit_archives a
+    WHERE (OLD.sequence IS NOT NULL AND OLD.sequence BETWEEN a.first_sequence AND a.last_sequence)
+       OR (OLD.sequence IS NULL AND a.first_sequence = 0 AND OLD.timestamp <= a.unchained_before)
+)
+DO INSTEAD NOTHING;
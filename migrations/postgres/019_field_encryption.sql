@@ -0,0 +1,7 @@
+-- Field-level encryption: user emails are stored encrypted, so their
+-- uniqueness is enforced on a keyed hash instead. The API fills email_hash
+-- when it encrypts existing emails at startup.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_hash TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_hash ON users(email_hash);
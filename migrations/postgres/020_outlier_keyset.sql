@@ -0,0 +1,4 @@
+-- Keyset pagination of outliers: the list continues after the last
+-- (detected_at, id) seen, so the index covers both
+
+CREATE INDEX IF NOT EXISTS idx_outliers_detected_at_id ON outliers(detected_at DESC, id);
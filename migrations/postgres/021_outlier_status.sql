@@ -0,0 +1,29 @@
+-- Outlier triage status, replacing the acknowledged flag as the workflow,
+-- and the history of every status change for compliance
+
+ALTER TABLE outliers ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'open'
+    CHECK (status IN ('open', 'investigating', 'false_positive', 'confirmed'));
+
+-- Existing acknowledgements carry over: a feedback label is a verdict,
+-- otherwise an acknowledged outlier has at least been looked at
+UPDATE outliers
+SET status = CASE feedback
+        WHEN 'true_positive' THEN 'confirmed'
+        WHEN 'false_positive' THEN 'false_positive'
+        ELSE 'investigating'
+    END
+WHERE acknowledged = true AND status = 'open';
+
+CREATE INDEX IF NOT EXISTS idx_outliers_status ON outliers(status, detected_at DESC);
+
+CREATE TABLE IF NOT EXISTS outlier_status_history (
+    id UUID PRIMARY KEY,
+    outlier_id UUID NOT NULL REFERENCES outliers(id) ON DELETE CASCADE,
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    changed_by TEXT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    notes TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_outlier_status_history_outlier ON outlier_status_history(outlier_id, changed_at);
@@ -0,0 +1,8 @@
+-- Outlier assignment, so team leads can distribute triage across analysts
+
+ALTER TABLE outliers ADD COLUMN IF NOT EXISTS assigned_to UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE outliers ADD COLUMN IF NOT EXISTS assigned_by TEXT;
+ALTER TABLE outliers ADD COLUMN IF NOT EXISTS assigned_at TIMESTAMPTZ;
+
+-- Each analyst's queue is listed newest first
+CREATE INDEX IF NOT EXISTS idx_outliers_assigned_to ON outliers(assigned_to, detected_at DESC) WHERE assigned_to IS NOT NULL;
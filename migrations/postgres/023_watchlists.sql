@@ -0,0 +1,33 @@
+-- Watchlists of addresses analysts want alerted on, whatever the
+-- statistical detectors make of their transfers
+
+CREATE TABLE IF NOT EXISTS watchlists (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT watchlist_name_not_empty CHECK (name != '')
+);
+
+CREATE TABLE IF NOT EXISTS watchlist_entries (
+    id UUID PRIMARY KEY,
+    watchlist_id UUID NOT NULL REFERENCES watchlists(id) ON DELETE CASCADE,
+    address VARCHAR(64) NOT NULL,
+    reason TEXT NOT NULL,
+    expires_at TIMESTAMPTZ,
+    added_by TEXT NOT NULL,
+    added_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (watchlist_id, address)
+);
+
+CREATE INDEX IF NOT EXISTS idx_watchlist_entries_address ON watchlist_entries(address);
+
+-- Watchlist hits are outliers of their own type
+ALTER TABLE outliers DROP CONSTRAINT IF EXISTS outliers_type_check;
+ALTER TABLE outliers ADD CONSTRAINT outliers_type_check CHECK (type IN (
+    'zscore', 'iqr', 'dbscan',
+    'pattern_circulation', 'pattern_fanout', 'pattern_fanin', 'pattern_dormant', 'pattern_velocity',
+    'pattern_cluster', 'watchlist'
+));
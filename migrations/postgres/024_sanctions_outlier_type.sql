@@ -0,0 +1,8 @@
+-- Allow outliers raised for transfers touching sanctioned addresses
+
+ALTER TABLE outliers DROP CONSTRAINT IF EXISTS outliers_type_check;
+ALTER TABLE outliers ADD CONSTRAINT outliers_type_check CHECK (type IN (
+    'zscore', 'iqr', 'dbscan',
+    'pattern_circulation', 'pattern_fanout', 'pattern_fanin', 'pattern_dormant', 'pattern_velocity',
+    'pattern_cluster', 'watchlist', 'pattern_sanctions'
+));
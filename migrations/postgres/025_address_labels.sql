@@ -0,0 +1,17 @@
+-- Known entities behind addresses (exchanges, bridges, mixers, ...), used to
+-- enrich transactions and outliers and as detection features
+
+CREATE TABLE IF NOT EXISTS address_labels (
+    address VARCHAR(64) PRIMARY KEY, -- Hex addresses are stored lowercased
+    label TEXT NOT NULL,
+    category VARCHAR(20) NOT NULL,
+    source TEXT NOT NULL DEFAULT 'manual',
+    updated_by TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT address_labels_label_not_empty CHECK (label != ''),
+    CONSTRAINT address_labels_category_check CHECK (category IN (
+        'exchange', 'bridge', 'mixer', 'defi', 'merchant', 'issuer', 'scam', 'other'
+    ))
+);
+
+CREATE INDEX IF NOT EXISTS idx_address_labels_category ON address_labels(category);
@@ -0,0 +1,12 @@
+-- Detection thresholds, windows and enabled detectors saved through the API.
+-- A single row; once saved it overrides the file configuration, and running
+-- detectors apply each new version without a restart.
+
+CREATE TABLE IF NOT EXISTS detection_config (
+    id SMALLINT PRIMARY KEY DEFAULT 1,
+    settings JSONB NOT NULL,
+    version INTEGER NOT NULL, -- Incremented by every save
+    updated_by TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT detection_config_single_row CHECK (id = 1)
+);
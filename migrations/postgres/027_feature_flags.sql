@@ -0,0 +1,11 @@
+-- Feature flags saved through the API. A row overrides the flag's value
+-- from the config file; environments overrides enabled in the environments
+-- it names, e.g. {"staging": true}. Services reload flags periodically.
+
+CREATE TABLE IF NOT EXISTS feature_flags (
+    name TEXT PRIMARY KEY,
+    enabled BOOLEAN NOT NULL,
+    environments JSONB NOT NULL DEFAULT '{}',
+    updated_by TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,17 @@
+-- Responses to mutations sent with an Idempotency-Key header, so a retried
+-- request is answered from here instead of being applied twice. A row with
+-- no status_code is a request still in progress. Rows expire after
+-- security.idempotency_ttl and are trimmed by the API as keys are used.
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    principal TEXT NOT NULL,              -- User ID, or api_key:<id> for API keys
+    idempotency_key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,           -- SHA-256 of method, path, query and body
+    status_code INTEGER,
+    content_type TEXT NOT NULL DEFAULT '',
+    response_body BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (principal, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys (created_at);
@@ -0,0 +1,14 @@
+-- Component statuses shared between services for the API health report.
+-- Each service instance reports the components it runs, such as TronGrid
+-- streams, the detection loop and the WebSocket hub, at an interval;
+-- reports that stop arriving show as unhealthy and are trimmed after a day.
+
+CREATE TABLE IF NOT EXISTS component_status (
+    component TEXT NOT NULL,
+    instance TEXT NOT NULL,               -- Hostname of the reporting process
+    healthy BOOLEAN NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}',
+    reported_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (component, instance)
+);
@@ -0,0 +1,11 @@
+-- Outlier archival: archived outliers are kept, but left out of default
+-- listings so the live set analysts work through stays small
+
+ALTER TABLE outliers ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
+ALTER TABLE outliers ADD COLUMN IF NOT EXISTS archived_by TEXT;
+
+-- Default listings read only live outliers, newest first
+CREATE INDEX IF NOT EXISTS idx_outliers_live ON outliers(detected_at DESC) WHERE archived_at IS NULL;
+
+-- The scheduled archival looks for old acknowledged outliers by severity
+CREATE INDEX IF NOT EXISTS idx_outliers_archivable ON outliers(severity, detected_at) WHERE archived_at IS NULL AND acknowledged = true;
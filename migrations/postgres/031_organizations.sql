@@ -0,0 +1,35 @@
+-- Organizations, so one instance can serve several compliance teams. Users,
+-- outliers, watchlists and API keys belong to an organization, and each
+-- organization only sees its own. Transactions, detection and address
+-- labels stay shared.
+
+CREATE TABLE IF NOT EXISTS organizations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT organization_name_not_empty CHECK (name != '')
+);
+
+-- Existing data belongs to the default organization, which operates the
+-- instance
+INSERT INTO organizations (id, name)
+VALUES ('00000000-0000-0000-0000-000000000001', 'Default')
+ON CONFLICT (id) DO NOTHING;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS org_id UUID NOT NULL
+    DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES organizations(id);
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS org_id UUID NOT NULL
+    DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES organizations(id);
+ALTER TABLE watchlists ADD COLUMN IF NOT EXISTS org_id UUID NOT NULL
+    DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES organizations(id);
+ALTER TABLE outliers ADD COLUMN IF NOT EXISTS org_id UUID NOT NULL
+    DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES organizations(id);
+
+-- Watchlist names only need to be unique within an organization
+ALTER TABLE watchlists DROP CONSTRAINT IF EXISTS watchlists_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_watchlists_org_name ON watchlists(org_id, name);
+
+-- Every listing is scoped to one organization
+CREATE INDEX IF NOT EXISTS idx_users_org_id ON users(org_id, username);
+CREATE INDEX IF NOT EXISTS idx_api_keys_org_id ON api_keys(org_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_outliers_org_id ON outliers(org_id, detected_at DESC);
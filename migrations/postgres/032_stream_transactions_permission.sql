@@ -0,0 +1,7 @@
+-- The stream:transactions permission, letting admins and analysts follow
+-- the live transaction stream over the WebSocket
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'stream:transactions'),
+    ('analyst', 'stream:transactions')
+ON CONFLICT DO NOTHING;
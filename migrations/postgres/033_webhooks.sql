@@ -0,0 +1,40 @@
+-- Outbound webhooks. Each organization registers endpoints that are POSTed
+-- outlier and incident events, signed with the endpoint's secret, and every
+-- delivery is recorded so failing endpoints can be diagnosed.
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    org_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES organizations(id),
+    url TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    events JSONB NOT NULL DEFAULT '[]',
+    secret TEXT NOT NULL, -- Encrypted when field encryption is configured
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT webhook_url_not_empty CHECK (url != '')
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_org_id ON webhooks(org_id, created_at);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_status INTEGER,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_attempt_at TIMESTAMPTZ,
+    delivered_at TIMESTAMPTZ,
+    CONSTRAINT webhook_delivery_status CHECK (status IN ('pending', 'delivered', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at DESC);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'manage:webhooks')
+ON CONFLICT DO NOTHING;
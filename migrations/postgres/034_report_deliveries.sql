@@ -0,0 +1,16 @@
+-- Scheduled report deliveries. A report is claimed here before it is
+-- emailed, so with several API instances running each day's report is
+-- sent once, and failed sends can be retried.
+
+CREATE TABLE IF NOT EXISTS report_deliveries (
+    report TEXT NOT NULL,
+    org_id UUID NOT NULL REFERENCES organizations(id),
+    report_date DATE NOT NULL,
+    status TEXT NOT NULL DEFAULT 'sending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    claimed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ,
+    PRIMARY KEY (report, org_id, report_date),
+    CONSTRAINT report_delivery_status CHECK (status IN ('sending', 'sent', 'failed'))
+);
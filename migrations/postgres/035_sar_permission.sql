@@ -0,0 +1,7 @@
+-- The export:sar permission, letting admins and analysts download
+-- suspicious activity report drafts
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'export:sar'),
+    ('analyst', 'export:sar')
+ON CONFLICT DO NOTHING;
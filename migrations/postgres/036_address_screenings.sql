@@ -0,0 +1,15 @@
+-- Third-party chain-analytics screenings of addresses (Chainalysis, TRM
+-- Labs, ...), cached so each address is looked up once per cache period
+-- and shown on address profiles
+
+CREATE TABLE IF NOT EXISTS address_screenings (
+    address VARCHAR(64) NOT NULL, -- Hex addresses are stored lowercased
+    provider VARCHAR(50) NOT NULL,
+    category TEXT NOT NULL DEFAULT '', -- Empty when the provider knows nothing of the address
+    risk TEXT NOT NULL DEFAULT '',
+    entity TEXT NOT NULL DEFAULT '',
+    screened_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (address, provider)
+);
+
+CREATE INDEX IF NOT EXISTS idx_address_screenings_screened_at ON address_screenings(address, screened_at DESC);
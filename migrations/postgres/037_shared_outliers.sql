@@ -0,0 +1,9 @@
+-- Outliers from the shared detectors (z-score, IQR, DBSCAN, patterns and
+-- sanctions) belong to no organization and every organization sees them.
+-- Only watchlist hits, which come from an organization's own watchlist,
+-- belong to one. The default organization triages the shared outliers.
+
+ALTER TABLE outliers ALTER COLUMN org_id DROP NOT NULL;
+ALTER TABLE outliers ALTER COLUMN org_id DROP DEFAULT;
+
+UPDATE outliers SET org_id = NULL WHERE type <> 'watchlist';
@@ -0,0 +1,8 @@
+-- Dead-letter Raphtory outbox entries that keep failing, so one bad write
+-- cannot hold up every write queued behind it. Dead-lettered entries are
+-- kept for inspection and are requeued by clearing dead_lettered_at.
+
+ALTER TABLE raphtory_outbox ADD COLUMN IF NOT EXISTS dead_lettered_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_raphtory_outbox_pending
+    ON raphtory_outbox (id) WHERE dead_lettered_at IS NULL;
@@ -0,0 +1,4 @@
+-- Record when each user's password last changed, so refresh tokens issued
+-- before a password change or reset are refused
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMPTZ;
@@ -0,0 +1,65 @@
+-- Per-organization triage. Every organization sees the shared detections,
+-- so each acknowledges, assigns, archives and moves them through statuses
+-- on its own, with its own notes and feedback. Triage moves off outliers
+-- into one row per organization and outlier; an outlier without a row is
+-- untriaged for that organization.
+
+CREATE TABLE IF NOT EXISTS outlier_triage (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    outlier_id UUID NOT NULL REFERENCES outliers(id) ON DELETE CASCADE,
+    org_id UUID NOT NULL REFERENCES organizations(id),
+    status TEXT NOT NULL DEFAULT 'open'
+        CHECK (status IN ('open', 'investigating', 'false_positive', 'confirmed')),
+    acknowledged BOOLEAN NOT NULL DEFAULT false,
+    acknowledged_by UUID REFERENCES users(id),
+    acknowledged_at TIMESTAMPTZ,
+    notes TEXT,
+    feedback TEXT CHECK (feedback IN ('true_positive', 'false_positive')),
+    assigned_to UUID REFERENCES users(id) ON DELETE SET NULL,
+    assigned_by TEXT,
+    assigned_at TIMESTAMPTZ,
+    archived_at TIMESTAMPTZ,
+    archived_by TEXT,
+    UNIQUE (outlier_id, org_id)
+);
+
+-- Existing triage is kept by the organization that did it: the owner of a
+-- watchlist hit, and the default organization for the shared detections
+INSERT INTO outlier_triage (outlier_id, org_id, status, acknowledged, acknowledged_by, acknowledged_at,
+    notes, feedback, assigned_to, assigned_by, assigned_at, archived_at, archived_by)
+SELECT id, COALESCE(org_id, '00000000-0000-0000-0000-000000000001'), status, acknowledged, acknowledged_by, acknowledged_at,
+    notes, feedback, assigned_to, assigned_by, assigned_at, archived_at, archived_by
+FROM outliers
+WHERE status <> 'open' OR acknowledged OR notes IS NOT NULL OR feedback IS NOT NULL
+   OR assigned_to IS NOT NULL OR archived_at IS NOT NULL
+ON CONFLICT (outlier_id, org_id) DO NOTHING;
+
+-- Each analyst's queue, and the scheduled archival's old acknowledged
+-- outliers
+CREATE INDEX IF NOT EXISTS idx_outlier_triage_assigned_to ON outlier_triage(org_id, assigned_to) WHERE assigned_to IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_outlier_triage_archivable ON outlier_triage(outlier_id) WHERE archived_at IS NULL AND acknowledged = true;
+
+-- Status history belongs to the organization that changed the status
+ALTER TABLE outlier_status_history ADD COLUMN IF NOT EXISTS org_id UUID REFERENCES organizations(id);
+UPDATE outlier_status_history h
+SET org_id = COALESCE(o.org_id, '00000000-0000-0000-0000-000000000001')
+FROM outliers o
+WHERE o.id = h.outlier_id AND h.org_id IS NULL;
+ALTER TABLE outlier_status_history ALTER COLUMN org_id SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_outlier_status_history_outlier;
+CREATE INDEX IF NOT EXISTS idx_outlier_status_history_outlier ON outlier_status_history(outlier_id, org_id, changed_at);
+
+-- Their indexes go with the columns
+ALTER TABLE outliers
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS acknowledged,
+    DROP COLUMN IF EXISTS acknowledged_by,
+    DROP COLUMN IF EXISTS acknowledged_at,
+    DROP COLUMN IF EXISTS notes,
+    DROP COLUMN IF EXISTS feedback,
+    DROP COLUMN IF EXISTS assigned_to,
+    DROP COLUMN IF EXISTS assigned_by,
+    DROP COLUMN IF EXISTS assigned_at,
+    DROP COLUMN IF EXISTS archived_at,
+    DROP COLUMN IF EXISTS archived_by;
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// LabelCategory is the kind of entity behind a labeled address
+type LabelCategory string
+
+const (
+	LabelCategoryExchange LabelCategory = "exchange"
+	LabelCategoryBridge   LabelCategory = "bridge"
+	LabelCategoryMixer    LabelCategory = "mixer"
+	LabelCategoryDeFi     LabelCategory = "defi"
+	LabelCategoryMerchant LabelCategory = "merchant"
+	LabelCategoryIssuer   LabelCategory = "issuer"
+	LabelCategoryScam     LabelCategory = "scam"
+	LabelCategoryOther    LabelCategory = "other"
+)
+
+// LabelCategories lists every label category
+var LabelCategories = []LabelCategory{
+	LabelCategoryExchange,
+	LabelCategoryBridge,
+	LabelCategoryMixer,
+	LabelCategoryDeFi,
+	LabelCategoryMerchant,
+	LabelCategoryIssuer,
+	LabelCategoryScam,
+	LabelCategoryOther,
+}
+
+// Valid reports whether c is a known category
+func (c LabelCategory) Valid() bool {
+	for _, category := range LabelCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// AddressLabel names the known entity behind an address, such as
+// "Binance hot wallet"
+type AddressLabel struct {
+	Address   string        `json:"address"`
+	Label     string        `json:"label"`
+	Category  LabelCategory `json:"category"`
+	Source    string        `json:"source"` // Where the label came from, e.g. manual or the imported file
+	UpdatedBy string        `json:"updated_by,omitempty"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// NormalizeAddress returns the form addresses are stored and matched in.
+// Hex addresses are case-insensitive, so they are lowercased; base58
+// addresses such as Tron's are case-sensitive and only trimmed.
+func NormalizeAddress(address string) string {
+	address = strings.TrimSpace(address)
+	if strings.HasPrefix(address, "0x") || strings.HasPrefix(address, "0X") {
+		return strings.ToLower(address)
+	}
+	return address
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// AddressScreening is a third-party chain-analytics service's assessment
+// of an address, such as Chainalysis's or TRM Labs'
+type AddressScreening struct {
+	Address    string    `json:"address"`
+	Provider   string    `json:"provider"`           // The service, e.g. chainalysis
+	Category   string    `json:"category,omitempty"` // As the service names it, e.g. sanctions or mixing
+	Risk       string    `json:"risk,omitempty"`     // The service's rating, e.g. Severe
+	Entity     string    `json:"entity,omitempty"`   // Entity the service attributes the address to
+	ScreenedAt time.Time `json:"screened_at"`
+}
+
+// Known reports whether the service had anything to say about the address
+func (s AddressScreening) Known() bool {
+	return s.Category != "" || s.Risk != "" || s.Entity != ""
+}
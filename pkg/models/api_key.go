@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// APIKey represents a key that lets an automated consumer call the API
+// without a user JWT. The key acts for its owning user, limited to its
+// scopes. The key itself is only shown once, when it is created.
+type APIKey struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	OrgID     string     `json:"org_id"`             // The owner's organization
+	Username  string     `json:"username,omitempty"` // Owning user
+	Role      Role       `json:"role,omitempty"`     // Owning user's role, which caps the scopes
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"` // First characters of the key, to tell keys apart
+	Scopes    []string   `json:"scopes"`
+	RateLimit int        `json:"rate_limit"` // Requests per minute; 0 uses the configured default
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+	IsActive  bool       `json:"is_active"`
+}
+
+// HasScope reports whether the key was granted scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// DetectionRunTrigger identifies what started a detection run
+type DetectionRunTrigger string
+
+const (
+	DetectionRunScheduled DetectionRunTrigger = "scheduled"
+	DetectionRunManual    DetectionRunTrigger = "manual"
+)
+
+// DetectionRunStatus represents the state of a detection run
+type DetectionRunStatus string
+
+const (
+	DetectionRunRunning   DetectionRunStatus = "running"
+	DetectionRunCompleted DetectionRunStatus = "completed"
+	DetectionRunFailed    DetectionRunStatus = "failed"
+)
+
+// DetectionRun records a single detection cycle
+type DetectionRun struct {
+	ID                   string              `json:"id"`
+	Trigger              DetectionRunTrigger `json:"trigger"`
+	TriggeredBy          string              `json:"triggered_by,omitempty"`
+	Status               DetectionRunStatus  `json:"status"`
+	StartedAt            time.Time           `json:"started_at"`
+	CompletedAt          *time.Time          `json:"completed_at,omitempty"`
+	WindowStart          time.Time           `json:"window_start"`
+	WindowEnd            time.Time           `json:"window_end"`
+	TransactionsAnalyzed int                 `json:"transactions_analyzed"`
+	OutliersFound        int                 `json:"outliers_found"`
+	DurationMs           int64               `json:"duration_ms"`
+	DetectorVersions     map[string]string   `json:"detector_versions"`
+	Error                string              `json:"error,omitempty"`
+}
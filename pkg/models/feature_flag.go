@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// FeatureFlag gates an experimental capability so it can be rolled out one
+// environment at a time
+type FeatureFlag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Enabled applies to every environment without an override
+	Enabled      bool            `json:"enabled"`
+	Environments map[string]bool `json:"environments,omitempty"` // Overrides by environment name
+	Active       bool            `json:"active"`                 // Whether the flag is on in this service's environment
+	Source       string          `json:"source"`                 // default, config or database
+	UpdatedBy    string          `json:"updated_by,omitempty"`
+	UpdatedAt    *time.Time      `json:"updated_at,omitempty"`
+}
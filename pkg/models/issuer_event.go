@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// IssuerEventType identifies an administrative action taken by a stablecoin
+// issuer through the token contract
+type IssuerEventType string
+
+const (
+	IssuerEventBlacklisted    IssuerEventType = "blacklisted"     // AddedBlackList
+	IssuerEventUnblacklisted  IssuerEventType = "unblacklisted"   // RemovedBlackList
+	IssuerEventFundsDestroyed IssuerEventType = "funds_destroyed" // DestroyedBlackFunds
+	IssuerEventIssue          IssuerEventType = "issue"           // New tokens minted to the issuer
+	IssuerEventRedeem         IssuerEventType = "redeem"          // Tokens redeemed and burned by the issuer
+)
+
+// IssuerEvent is an issuer action such as blacklisting an address or minting
+// tokens. Blacklisting and mint/redeem activity are risk signals in their own
+// right, independent of transfer patterns.
+type IssuerEvent struct {
+	ID          string          `json:"id,omitempty"`
+	TxHash      string          `json:"tx_hash"`
+	Type        IssuerEventType `json:"type"`
+	Address     string          `json:"address,omitempty"` // Affected address; empty for issue and redeem
+	Amount      decimal.Decimal `json:"amount"`            // Destroyed, issued or redeemed amount; zero for blacklist changes
+	BlockNumber uint64          `json:"block_number"`
+	Timestamp   time.Time       `json:"timestamp"`
+	Contract    string          `json:"contract"`
+	Token       string          `json:"token,omitempty"`
+	Chain       Chain           `json:"chain,omitempty"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// DefaultOrganizationID is the organization that users, outliers,
+// watchlists and API keys created before organizations existed belong to,
+// as do tokens issued before then. Its admins operate the instance: only
+// they hold system-wide permissions, such as managing roles, detection
+// settings and organizations.
+const DefaultOrganizationID = "00000000-0000-0000-0000-000000000001"
+
+// Organization is a team whose users, watchlist hits, watchlists and API
+// keys are kept apart from every other organization's. Transactions,
+// detection, the shared detectors' outliers and address labels are shared
+// by all.
+type Organization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -17,6 +17,10 @@ const (
 	OutlierTypePatternFanIn        OutlierType = "pattern_fanin"
 	OutlierTypePatternDormant      OutlierType = "pattern_dormant"
 	OutlierTypePatternVelocity     OutlierType = "pattern_velocity"
+	OutlierTypePatternCluster      OutlierType = "pattern_cluster"
+	OutlierTypeDBSCAN              OutlierType = "dbscan"
+	OutlierTypeWatchlist           OutlierType = "watchlist" // Transfer touching a watchlisted address
+	OutlierTypeSanctions           OutlierType = "pattern_sanctions" // Transfer touching an address on a sanctions list
 )
 
 // Severity represents the severity level of an outlier
@@ -29,9 +33,108 @@ const (
 	SeverityCritical Severity = "critical"
 )
 
+// RiskScore maps a severity to a score between 0 and 1 for ranking and
+// display; an unknown or empty severity scores 0
+func (s Severity) RiskScore() float64 {
+	switch s {
+	case SeverityLow:
+		return 0.25
+	case SeverityMedium:
+		return 0.5
+	case SeverityHigh:
+		return 0.75
+	case SeverityCritical:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Valid reports whether s is a known severity
+func (s Severity) Valid() bool {
+	return s.RiskScore() > 0
+}
+
+// FeedbackLabel is an analyst's verdict on whether an outlier was a real anomaly
+type FeedbackLabel string
+
+const (
+	FeedbackTruePositive  FeedbackLabel = "true_positive"
+	FeedbackFalsePositive FeedbackLabel = "false_positive"
+)
+
+// OutlierStatus is where an outlier is in triage
+type OutlierStatus string
+
+const (
+	OutlierStatusOpen          OutlierStatus = "open"
+	OutlierStatusInvestigating OutlierStatus = "investigating"
+	OutlierStatusFalsePositive OutlierStatus = "false_positive"
+	OutlierStatusConfirmed     OutlierStatus = "confirmed"
+)
+
+// outlierStatusTransitions lists the statuses each status may move to. A
+// closed outlier (false positive or confirmed) can only be reopened for
+// investigation, so every change of verdict passes through review.
+var outlierStatusTransitions = map[OutlierStatus][]OutlierStatus{
+	OutlierStatusOpen:          {OutlierStatusInvestigating, OutlierStatusFalsePositive, OutlierStatusConfirmed},
+	OutlierStatusInvestigating: {OutlierStatusOpen, OutlierStatusFalsePositive, OutlierStatusConfirmed},
+	OutlierStatusFalsePositive: {OutlierStatusInvestigating},
+	OutlierStatusConfirmed:     {OutlierStatusInvestigating},
+}
+
+// Valid reports whether s is a known status
+func (s OutlierStatus) Valid() bool {
+	_, ok := outlierStatusTransitions[s]
+	return ok
+}
+
+// CanTransition reports whether an outlier may move from s to next
+func (s OutlierStatus) CanTransition(next OutlierStatus) bool {
+	for _, allowed := range outlierStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Closed reports whether s is a final verdict
+func (s OutlierStatus) Closed() bool {
+	return s == OutlierStatusFalsePositive || s == OutlierStatusConfirmed
+}
+
+// FeedbackLabel returns the feedback label a closed status implies, or ""
+func (s OutlierStatus) FeedbackLabel() FeedbackLabel {
+	switch s {
+	case OutlierStatusFalsePositive:
+		return FeedbackFalsePositive
+	case OutlierStatusConfirmed:
+		return FeedbackTruePositive
+	default:
+		return ""
+	}
+}
+
+// OutlierStatusChange records one status change of an outlier
+type OutlierStatusChange struct {
+	ID         string        `json:"id"`
+	OutlierID  string        `json:"outlier_id"`
+	FromStatus OutlierStatus `json:"from_status"`
+	ToStatus   OutlierStatus `json:"to_status"`
+	ChangedBy  string        `json:"changed_by"`
+	ChangedAt  time.Time     `json:"changed_at"`
+	Notes      string        `json:"notes,omitempty"`
+}
+
+// InvalidReasonChainReorg marks outliers whose transaction was reverted by a
+// chain reorganisation
+const InvalidReasonChainReorg = "chain_reorg"
+
 // Outlier represents a detected anomaly
 type Outlier struct {
 	ID              string          `json:"id"`
+	OrgID           string          `json:"org_id,omitempty"` // Owning organization; empty for shared detections every organization sees
 	DetectedAt      time.Time       `json:"detected_at"`
 	Type            OutlierType     `json:"type"`
 	Severity        Severity        `json:"severity"`
@@ -40,10 +143,26 @@ type Outlier struct {
 	Amount          decimal.Decimal `json:"amount,omitempty"`
 	ZScore          float64         `json:"z_score,omitempty"`
 	Details         map[string]interface{} `json:"details"`
+	Status          OutlierStatus   `json:"status"`
 	Acknowledged    bool            `json:"acknowledged"`
 	AcknowledgedBy  string          `json:"acknowledged_by,omitempty"`
 	AcknowledgedAt  time.Time       `json:"acknowledged_at,omitempty"`
 	Notes           string          `json:"notes,omitempty"`
+	Feedback        FeedbackLabel   `json:"feedback,omitempty"`
+	AssignedTo      string          `json:"assigned_to,omitempty"`
+	AssignedBy      string          `json:"assigned_by,omitempty"`
+	AssignedAt      time.Time       `json:"assigned_at,omitempty"`
+	Invalidated     bool            `json:"invalidated"`
+	InvalidatedAt   time.Time       `json:"invalidated_at,omitempty"`
+	InvalidReason   string          `json:"invalid_reason,omitempty"`
+	ArchivedAt      time.Time       `json:"archived_at,omitempty"`
+	ArchivedBy      string          `json:"archived_by,omitempty"`
+}
+
+// Shared reports whether the outlier comes from the shared detectors
+// rather than an organization's watchlist, so every organization sees it
+func (o *Outlier) Shared() bool {
+	return o.OrgID == ""
 }
 
 // StatisticalData holds statistical information for anomaly detection
@@ -6,7 +6,15 @@ import (
 	"github.com/shopspring/decimal"
 )
 
-// Transaction represents a USDT TRC20 transaction on Tron blockchain
+// Chain identifies the blockchain a transaction was observed on
+type Chain string
+
+const (
+	ChainTron     Chain = "tron"
+	ChainEthereum Chain = "ethereum"
+)
+
+// Transaction represents a stablecoin token transfer (TRC20 on Tron, ERC-20 on Ethereum)
 type Transaction struct {
 	TxHash      string          `json:"tx_hash"`
 	BlockNumber uint64          `json:"block_number"`
@@ -15,9 +23,20 @@ type Transaction struct {
 	To          string          `json:"to"`
 	Amount      decimal.Decimal `json:"amount"`
 	Contract    string          `json:"contract"`
+	Token       string          `json:"token,omitempty"` // Token symbol, e.g. USDT or USDC
+	Chain       Chain           `json:"chain,omitempty"`
 	Confirmed   bool            `json:"confirmed"`
 }
 
+// ConfirmationUpdate reports that a transaction sent unconfirmed has reached
+// the configured confirmation depth
+type ConfirmationUpdate struct {
+	TxHash        string `json:"tx_hash"`
+	BlockNumber   uint64 `json:"block_number"`
+	Confirmations uint64 `json:"confirmations"` // Blocks on top of the transaction's block
+	Chain         Chain  `json:"chain,omitempty"`
+}
+
 // TronEvent represents a raw event from TronGrid REST API
 type TronEvent struct {
 	TransactionID   string                 `json:"transaction_id"`
@@ -30,6 +49,10 @@ type TronEvent struct {
 	EventIndex      int                    `json:"event_index"`
 	BlockNumber     uint64                 `json:"block_number"`
 	BlockTimestamp  int64                  `json:"block_timestamp"`
+	Removed         bool                   `json:"removed,omitempty"` // Reverted by a chain reorganisation
+	// Unconfirmed is set on events TronGrid has not yet solidified, which
+	// are only returned when only_confirmed is not requested
+	Unconfirmed bool `json:"_unconfirmed,omitempty"`
 }
 
 // TransferEvent represents a decoded Transfer event
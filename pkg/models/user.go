@@ -6,6 +6,7 @@ import "time"
 type User struct {
 	ID           string     `json:"id"`
 	Username     string     `json:"username"`
+	OrgID        string     `json:"org_id"`
 	Email        string     `json:"email,omitempty"`
 	PasswordHash string     `json:"-"` // Never expose in JSON
 	Role         Role       `json:"role"`
@@ -42,3 +43,26 @@ type LoginResponse struct {
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
+
+// ChangePasswordRequest represents a request to change one's own password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ResetPasswordRequest represents a request to set a new password with a
+// one-time reset token
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// RoleDefinition describes a role and the permissions it grants. Built-in
+// roles (admin, analyst, viewer) cannot be deleted.
+type RoleDefinition struct {
+	Name        Role      `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Permissions []string  `json:"permissions"`
+	BuiltIn     bool      `json:"built_in"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Watchlist is a named list of addresses analysts want alerted on. Any
+// transfer to or from an address on a watchlist raises a watchlist outlier,
+// whatever the statistical detectors make of it.
+type Watchlist struct {
+	ID          string    `json:"id"`
+	OrgID       string    `json:"org_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	EntryCount  int       `json:"entry_count"` // Entries that have not expired
+}
+
+// WatchlistEntry is an address on a watchlist, with why it was added and
+// optionally when it stops being watched
+type WatchlistEntry struct {
+	ID            string     `json:"id"`
+	WatchlistID   string     `json:"watchlist_id"`
+	WatchlistName string     `json:"watchlist_name,omitempty"`
+	Address       string     `json:"address"`
+	Reason        string     `json:"reason"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"` // Nil never expires
+	AddedBy       string     `json:"added_by"`
+	AddedAt       time.Time  `json:"added_at"`
+}
+
+// Expired reports whether the entry has stopped being watched at now
+func (e *WatchlistEntry) Expired(now time.Time) bool {
+	return e.ExpiresAt != nil && !now.Before(*e.ExpiresAt)
+}
@@ -0,0 +1,78 @@
+package models
+
+import "time"
+
+// WebhookEvent is a kind of event webhooks can subscribe to
+type WebhookEvent string
+
+const (
+	// WebhookEventOutlierDetected is sent for every outlier detected
+	WebhookEventOutlierDetected WebhookEvent = "outlier.detected"
+	// WebhookEventIncidentResolved is sent when an outlier is acknowledged,
+	// closing the incident its alerts belong to
+	WebhookEventIncidentResolved WebhookEvent = "incident.resolved"
+)
+
+// WebhookEvents lists every event webhooks can subscribe to
+var WebhookEvents = []WebhookEvent{
+	WebhookEventOutlierDetected,
+	WebhookEventIncidentResolved,
+}
+
+// Valid reports whether e is a known event
+func (e WebhookEvent) Valid() bool {
+	for _, event := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook is an endpoint an organization's events are POSTed to. The
+// secret deliveries are signed with is only shown when it is generated.
+type Webhook struct {
+	ID          string         `json:"id"`
+	OrgID       string         `json:"org_id"`
+	URL         string         `json:"url"`
+	Description string         `json:"description,omitempty"`
+	Events      []WebhookEvent `json:"events"`
+	Enabled     bool           `json:"enabled"`
+	CreatedBy   string         `json:"created_by"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// Subscribed reports whether the webhook receives event
+func (w *Webhook) Subscribed(event WebhookEvent) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDeliveryStatus is where a delivery has got to
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"   // Being attempted or waiting to retry
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered" // Accepted with a 2xx response
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"    // Rejected, or still failing after every retry
+)
+
+// WebhookDelivery records sending one event to one webhook
+type WebhookDelivery struct {
+	ID             string                `json:"id"`
+	WebhookID      string                `json:"webhook_id"`
+	EventID        string                `json:"event_id"`
+	EventType      WebhookEvent          `json:"event_type"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	ResponseStatus int                   `json:"response_status,omitempty"` // HTTP status of the last attempt; 0 if none was received
+	Error          string                `json:"error,omitempty"`           // Why the last attempt failed
+	CreatedAt      time.Time             `json:"created_at"`
+	LastAttemptAt  *time.Time            `json:"last_attempt_at,omitempty"`
+	DeliveredAt    *time.Time            `json:"delivered_at,omitempty"`
+}
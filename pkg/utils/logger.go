@@ -1,8 +1,10 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -14,6 +16,16 @@ type LoggerConfig struct {
 	Format     string // "json" or "console"
 	OutputPath string
 	ErrorPath  string
+
+	// Rotation applies to file outputs; stdout and stderr are never rotated
+	Rotation RotationConfig
+
+	// SampleInitial and SampleThereafter sample debug and info entries: each
+	// second, the first SampleInitial entries with a given message are
+	// logged and then every SampleThereafter-th. Warnings and errors are
+	// never sampled. Zero SampleInitial disables sampling.
+	SampleInitial    int
+	SampleThereafter int
 }
 
 // NewLogger creates a new zap logger based on configuration
@@ -48,32 +60,23 @@ func NewLogger(cfg LoggerConfig) (*zap.Logger, error) {
 		encoder = zapcore.NewJSONEncoder(encoderConfig)
 	}
 
-	// Configure outputs
-	var outputWriteSyncer zapcore.WriteSyncer
-	if cfg.OutputPath == "stdout" || cfg.OutputPath == "" {
-		outputWriteSyncer = zapcore.AddSync(os.Stdout)
-	} else {
-		file, err := os.OpenFile(cfg.OutputPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open output file %s: %w", cfg.OutputPath, err)
-		}
-		outputWriteSyncer = zapcore.AddSync(file)
+	// Configure outputs, sharing one writer when both go to the same file
+	outputWriteSyncer, err := openOutput(cfg.OutputPath, "stdout", os.Stdout, cfg.Rotation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file %s: %w", cfg.OutputPath, err)
 	}
 
-	var errorWriteSyncer zapcore.WriteSyncer
-	if cfg.ErrorPath == "stderr" || cfg.ErrorPath == "" {
-		errorWriteSyncer = zapcore.AddSync(os.Stderr)
-	} else {
-		file, err := os.OpenFile(cfg.ErrorPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	errorWriteSyncer := outputWriteSyncer
+	if cfg.ErrorPath != cfg.OutputPath || cfg.OutputPath == "" {
+		errorWriteSyncer, err = openOutput(cfg.ErrorPath, "stderr", os.Stderr, cfg.Rotation)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open error file %s: %w", cfg.ErrorPath, err)
 		}
-		errorWriteSyncer = zapcore.AddSync(file)
 	}
 
 	// Create core
 	core := zapcore.NewTee(
-		zapcore.NewCore(encoder, outputWriteSyncer, level),
+		newOutputCore(encoder, outputWriteSyncer, level, cfg.SampleInitial, cfg.SampleThereafter),
 		zapcore.NewCore(encoder, errorWriteSyncer, zapcore.ErrorLevel),
 	)
 
@@ -83,6 +86,39 @@ func NewLogger(cfg LoggerConfig) (*zap.Logger, error) {
 	return logger, nil
 }
 
+// openOutput returns the standard stream for path's empty or standard
+// name, otherwise a rotating file
+func openOutput(path, standardName string, standard *os.File, rotation RotationConfig) (zapcore.WriteSyncer, error) {
+	if path == "" || path == standardName {
+		return zapcore.AddSync(standard), nil
+	}
+	file, err := NewRotatingFile(path, rotation)
+	if err != nil {
+		return nil, err
+	}
+	return zapcore.AddSync(file), nil
+}
+
+// newOutputCore logs entries at level and above, sampling those below warn
+// when sampling is enabled
+func newOutputCore(encoder zapcore.Encoder, out zapcore.WriteSyncer, level zapcore.Level, initial, thereafter int) zapcore.Core {
+	if initial <= 0 {
+		return zapcore.NewCore(encoder, out, level)
+	}
+
+	verbose := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return l >= level && l < zapcore.WarnLevel
+	})
+	important := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return l >= level && l >= zapcore.WarnLevel
+	})
+
+	return zapcore.NewTee(
+		zapcore.NewSamplerWithOptions(zapcore.NewCore(encoder, out, verbose), time.Second, initial, thereafter),
+		zapcore.NewCore(encoder, out, important),
+	)
+}
+
 // NewDevelopmentLogger creates a logger suitable for development
 func NewDevelopmentLogger() (*zap.Logger, error) {
 	return NewLogger(LoggerConfig{
@@ -121,3 +157,19 @@ func LoggerFromConfig(level, format, outputPath, errorPath string) (*zap.Logger,
 		ErrorPath:  errorPath,
 	})
 }
+
+// requestIDKey is the context key for request IDs
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying an HTTP request's ID, so
+// code below the HTTP layer can tie its logs and audit records to the
+// request
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, or ""
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
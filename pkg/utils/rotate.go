@@ -0,0 +1,290 @@
+package utils
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the timestamp inserted into rotated file names
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotationConfig holds log file rotation settings
+type RotationConfig struct {
+	MaxSizeMB  int           // Rotate once the file would exceed this size (default 100)
+	MaxAge     time.Duration // Delete rotated files older than this; 0 keeps them regardless of age
+	MaxBackups int           // Keep at most this many rotated files; 0 keeps them all
+	Compress   bool          // Gzip rotated files
+}
+
+// RotatingFile is a log file that is renamed to
+// <name>-<timestamp><ext> once it reaches its size limit, with a fresh file
+// opened in its place. Old rotated files are compressed and pruned in the
+// background so logging is never blocked on it.
+type RotatingFile struct {
+	path   string
+	config RotationConfig
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	closed bool
+
+	millCh   chan struct{}
+	millOnce sync.Once
+	millDone chan struct{}
+}
+
+// NewRotatingFile opens path for appending, creating it if needed
+func NewRotatingFile(path string, config RotationConfig) (*RotatingFile, error) {
+	if config.MaxSizeMB <= 0 {
+		config.MaxSizeMB = 100
+	}
+
+	r := &RotatingFile{
+		path:     path,
+		config:   config,
+		millCh:   make(chan struct{}, 1),
+		millDone: make(chan struct{}),
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write appends p, rotating first if p would take the file over its limit
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	maxSize := int64(r.config.MaxSizeMB) * 1024 * 1024
+	if r.size > 0 && r.size+int64(len(p)) > maxSize {
+		// A failed rename leaves the current file open; keep appending to it
+		if err := r.rotate(); err != nil && r.file == nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Sync flushes the current file to disk
+func (r *RotatingFile) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Sync()
+}
+
+// Rotate renames the current file and starts a new one
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	return r.rotate()
+}
+
+// Close closes the current file and waits for background cleanup to finish
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	var err error
+	if r.file != nil {
+		err = r.file.Close()
+		r.file = nil
+	}
+	r.mu.Unlock()
+
+	r.millOnce.Do(func() { close(r.millDone) })
+	close(r.millCh)
+	<-r.millDone
+	return err
+}
+
+// open opens the log file for appending and records its current size
+func (r *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %w", r.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file %s: %w", r.path, err)
+	}
+
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+// rotate must be called with mu held
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	r.file = nil
+
+	if err := os.Rename(r.path, r.backupName(time.Now().UTC())); err != nil && !os.IsNotExist(err) {
+		// Keep logging to the existing file rather than losing every later line
+		if openErr := r.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.millOnce.Do(func() { go r.mill() })
+	select {
+	case r.millCh <- struct{}{}:
+	default:
+		// A cleanup is already pending and will see this file too
+	}
+	return nil
+}
+
+// backupName returns the rotated name for the file at t
+func (r *RotatingFile) backupName(t time.Time) string {
+	dir, prefix, ext := r.nameParts()
+	return filepath.Join(dir, prefix+t.Format(backupTimeFormat)+ext)
+}
+
+func (r *RotatingFile) nameParts() (dir, prefix, ext string) {
+	dir = filepath.Dir(r.path)
+	base := filepath.Base(r.path)
+	ext = filepath.Ext(base)
+	prefix = strings.TrimSuffix(base, ext) + "-"
+	return dir, prefix, ext
+}
+
+// mill compresses and prunes rotated files each time a rotation signals it
+func (r *RotatingFile) mill() {
+	defer close(r.millDone)
+	for range r.millCh {
+		r.cleanup()
+	}
+}
+
+type backupFile struct {
+	path      string
+	timestamp time.Time
+}
+
+// cleanup removes rotated files beyond MaxBackups or older than MaxAge and
+// compresses the rest when configured to. Failures are left for the next
+// rotation; there is nowhere useful to log them from inside the logger.
+func (r *RotatingFile) cleanup() {
+	backups := r.backups()
+
+	var keep []backupFile
+	cutoff := time.Now().Add(-r.config.MaxAge)
+	for i, backup := range backups {
+		tooMany := r.config.MaxBackups > 0 && i >= r.config.MaxBackups
+		tooOld := r.config.MaxAge > 0 && backup.timestamp.Before(cutoff)
+		if tooMany || tooOld {
+			os.Remove(backup.path)
+			continue
+		}
+		keep = append(keep, backup)
+	}
+
+	if !r.config.Compress {
+		return
+	}
+	for _, backup := range keep {
+		if !strings.HasSuffix(backup.path, ".gz") {
+			compressFile(backup.path)
+		}
+	}
+}
+
+// backups lists rotated files, newest first
+func (r *RotatingFile) backups() []backupFile {
+	dir, prefix, ext := r.nameParts()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var backups []backupFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimPrefix(name, prefix)
+		stamp = strings.TrimSuffix(stamp, ".gz")
+		if !strings.HasSuffix(stamp, ext) {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, strings.TrimSuffix(stamp, ext))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{path: filepath.Join(dir, name), timestamp: t})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].timestamp.After(backups[j].timestamp) })
+	return backups
+}
+
+// compressFile gzips path to path.gz and removes the original
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
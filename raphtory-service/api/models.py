@@ -3,7 +3,7 @@ API models for Raphtory service
 """
 
 from pydantic import BaseModel, Field
-from typing import List, Optional, Dict, Any
+from typing import List, Optional, Dict, Any, Union
 from datetime import datetime
 
 
@@ -16,11 +16,26 @@ class TransactionInput(BaseModel):
     timestamp: int = Field(..., description="Unix timestamp in seconds")
     block_number: int = Field(..., description="Block number")
     contract: str = Field(..., description="Contract address")
+    token: Optional[str] = Field(None, description="Token symbol, e.g. USDT")
+    chain: Optional[str] = Field(None, description="Blockchain, e.g. tron or ethereum")
+    confirmed: bool = Field(True, description="False until the transaction reaches the confirmation depth")
 
     class Config:
         populate_by_name = True
 
 
+class TransactionBatchInput(BaseModel):
+    """Input model for adding several transactions in one request"""
+    transactions: List[TransactionInput] = Field(..., description="Transactions to add")
+
+
+class TransactionBatchResponse(BaseModel):
+    """Result of a batch add"""
+    success: bool
+    added: int
+    failed: List[str] = Field(default_factory=list, description="Hashes of transactions that were not added")
+
+
 class TransactionResponse(BaseModel):
     """Response model for a transaction"""
     from_address: str = Field(..., alias="from")
@@ -29,11 +44,21 @@ class TransactionResponse(BaseModel):
     tx_hash: str
     block_number: int
     timestamp: Optional[int] = None
+    contract: Optional[str] = None
+    token: Optional[str] = None
+    chain: Optional[str] = None
+    confirmed: bool = True
 
     class Config:
         populate_by_name = True
 
 
+class TransactionPageResponse(BaseModel):
+    """A page of transactions, newest first, with the total matching"""
+    transactions: List[TransactionResponse]
+    total: int
+
+
 class NodeInfo(BaseModel):
     """Information about a graph node (address)"""
     address: str
@@ -45,6 +70,36 @@ class NodeInfo(BaseModel):
     total_sent: float = 0.0
     total_received: float = 0.0
     balance_flow: float = 0.0
+    properties: Dict[str, Union[float, bool, str]] = Field(default_factory=dict, description="Tags such as risk scores and labels")
+
+
+class NodePropertiesInput(BaseModel):
+    """Tags to set on an address; a null value removes the tag"""
+    properties: Dict[str, Optional[Union[float, bool, str]]]
+
+
+class NodeProperties(BaseModel):
+    """An address and its tags"""
+    address: str
+    properties: Dict[str, Union[float, bool, str]]
+
+
+class NodeSearchResponse(BaseModel):
+    """Addresses matching a tag"""
+    nodes: List[NodeProperties]
+    count: int
+
+
+class Counterparty(BaseModel):
+    """An address in a neighborhood, with totals of the transactions linking it one hop closer"""
+    address: str
+    hop: int
+    sent_count: int = 0
+    received_count: int = 0
+    sent: str = "0"
+    received: str = "0"
+    first_seen: Optional[int] = None
+    last_seen: Optional[int] = None
 
 
 class NeighborsResponse(BaseModel):
@@ -52,6 +107,25 @@ class NeighborsResponse(BaseModel):
     address: str
     neighbors: List[str]
     count: int
+    hops: int = 1
+    counterparties: List[Counterparty] = Field(default_factory=list)
+    truncated: bool = False
+
+
+class PathHop(BaseModel):
+    """One transfer leg of a path"""
+    from_address: str = Field(..., alias="from")
+    to_address: str = Field(..., alias="to")
+    transactions: List[TransactionResponse]
+
+    class Config:
+        populate_by_name = True
+
+
+class FlowPath(BaseModel):
+    """A path between two addresses with the transactions of each hop"""
+    addresses: List[str]
+    hops: List[PathHop]
 
 
 class PathsResponse(BaseModel):
@@ -60,11 +134,112 @@ class PathsResponse(BaseModel):
     to_address: str = Field(..., alias="to")
     paths: List[List[str]]
     count: int
+    flows: List[FlowPath] = Field(default_factory=list)
+    truncated: bool = False
+
+    class Config:
+        populate_by_name = True
+
+
+class NodeDegree(BaseModel):
+    """An address's distinct counterparties and transfers in a window"""
+    address: str
+    in_degree: int
+    out_degree: int
+    in_count: int
+    out_count: int
+    received: str
+    sent: str
+
+
+class DegreeResponse(BaseModel):
+    """Addresses ranked by degree"""
+    direction: str
+    nodes: List[NodeDegree]
+
+
+class AddressActivity(NodeDegree):
+    """An address's transfers in a window, with first and last transaction"""
+    unconfirmed_count: int
+    first_seen: int
+    last_seen: int
+    first_tx_hash: Optional[str] = None
+
+
+class ActivityResponse(BaseModel):
+    """Per-address activity in a window"""
+    addresses: List[AddressActivity]
+
+
+class NodeScore(BaseModel):
+    """An address's centrality score"""
+    address: str
+    score: float
+
+
+class CentralityResponse(BaseModel):
+    """Addresses ranked by centrality"""
+    algorithm: str
+    nodes: List[NodeScore]
+
+
+class Community(BaseModel):
+    """A group of addresses that transact mostly with each other"""
+    id: int
+    members: List[str]
+    size: int
+    internal_edges: int = Field(..., description="Distinct sender/receiver pairs inside the community")
+    internal_count: int = Field(..., description="Transactions between members")
+    internal_amount: str
+    density: float = Field(..., description="Share of possible member pairs that transacted")
+    entry_points: List[str] = Field(..., description="Members receiving from outside the community")
+    exit_points: List[str] = Field(..., description="Members sending outside the community")
+    inflow: str
+    outflow: str
+    has_cycle: bool = Field(..., description="Whether transfers between members form a loop")
+    first_seen: Optional[int] = None
+    last_seen: Optional[int] = None
+
+
+class CommunitiesResponse(BaseModel):
+    """Communities found in a window"""
+    communities: List[Community]
+    count: int
+
+
+class SubgraphNode(BaseModel):
+    """An address in a subgraph with totals over the subgraph's edges"""
+    address: str
+    hop: int = Field(..., description="Hops from the centre address; 0 for the centre")
+    transaction_count: int
+    sent: str
+    received: str
+    first_seen: Optional[int] = None
+    last_seen: Optional[int] = None
+
+
+class SubgraphEdge(BaseModel):
+    """The transfers from one address to another in a subgraph"""
+    from_address: str = Field(..., alias="from")
+    to_address: str = Field(..., alias="to")
+    transaction_count: int
+    amount: str
+    first_seen: Optional[int] = None
+    last_seen: Optional[int] = None
 
     class Config:
         populate_by_name = True
 
 
+class SubgraphResponse(BaseModel):
+    """The addresses around an address and the transfers between them"""
+    address: str
+    hops: int
+    nodes: List[SubgraphNode]
+    edges: List[SubgraphEdge]
+    truncated: bool
+
+
 class GraphStatistics(BaseModel):
     """Graph statistics"""
     node_count: int
@@ -4,16 +4,28 @@ FastAPI server for Raphtory temporal graph service
 
 from fastapi import FastAPI, HTTPException, Query, status
 from fastapi.middleware.cors import CORSMiddleware
-from typing import List, Optional
+from typing import Any, Dict, List, Optional
+from decimal import Decimal
 from datetime import datetime
 import structlog
 
 from api.models import (
     TransactionInput,
+    TransactionBatchInput,
+    TransactionBatchResponse,
     TransactionResponse,
+    TransactionPageResponse,
     NodeInfo,
+    NodePropertiesInput,
+    NodeProperties,
+    NodeSearchResponse,
     NeighborsResponse,
     PathsResponse,
+    SubgraphResponse,
+    DegreeResponse,
+    ActivityResponse,
+    CentralityResponse,
+    CommunitiesResponse,
     GraphStatistics,
     HealthResponse,
     ErrorResponse,
@@ -121,7 +133,10 @@ async def add_transaction(transaction: TransactionInput):
         amount=transaction.amount,
         timestamp=transaction.timestamp,
         block_number=transaction.block_number,
-        contract=transaction.contract
+        contract=transaction.contract,
+        token=transaction.token,
+        chain=transaction.chain,
+        confirmed=transaction.confirmed
     )
 
     if not success:
@@ -136,6 +151,104 @@ async def add_transaction(transaction: TransactionInput):
     )
 
 
+@app.post("/graph/transactions/batch", response_model=TransactionBatchResponse, status_code=status.HTTP_201_CREATED)
+async def add_transactions(batch: TransactionBatchInput):
+    """
+    Add several transactions to the temporal graph in one request
+
+    Args:
+        batch: Transactions to add
+
+    Returns:
+        Count of added transactions and hashes of any that failed
+    """
+    if graph_manager is None:
+        raise HTTPException(
+            status_code=status.HTTP_503_SERVICE_UNAVAILABLE,
+            detail="Graph manager not initialized"
+        )
+
+    logger.info("Adding transaction batch", size=len(batch.transactions))
+
+    added = 0
+    failed = []
+    for transaction in batch.transactions:
+        success = graph_manager.add_transaction(
+            tx_hash=transaction.tx_hash,
+            from_address=transaction.from_address,
+            to_address=transaction.to_address,
+            amount=transaction.amount,
+            timestamp=transaction.timestamp,
+            block_number=transaction.block_number,
+            contract=transaction.contract,
+            token=transaction.token,
+            chain=transaction.chain,
+            confirmed=transaction.confirmed
+        )
+        if success:
+            added += 1
+        else:
+            failed.append(transaction.tx_hash)
+
+    return TransactionBatchResponse(
+        success=not failed,
+        added=added,
+        failed=failed
+    )
+
+
+@app.delete("/graph/transaction/{tx_hash}", response_model=SuccessResponse)
+async def delete_transaction(tx_hash: str):
+    """
+    Retract a transaction reverted by a chain reorganisation
+
+    Args:
+        tx_hash: Transaction hash
+
+    Returns:
+        Success response
+    """
+    if graph_manager is None:
+        raise HTTPException(
+            status_code=status.HTTP_503_SERVICE_UNAVAILABLE,
+            detail="Graph manager not initialized"
+        )
+
+    logger.info("Retracting transaction", tx_hash=tx_hash)
+
+    retracted = graph_manager.delete_transaction(tx_hash)
+
+    return SuccessResponse(
+        success=True,
+        message="Transaction retracted" if retracted else "Transaction already retracted"
+    )
+
+
+@app.post("/graph/transaction/{tx_hash}/confirm", response_model=SuccessResponse)
+async def confirm_transaction(tx_hash: str):
+    """
+    Mark a transaction added unconfirmed as confirmed
+
+    Args:
+        tx_hash: Transaction hash
+
+    Returns:
+        Success response
+    """
+    if graph_manager is None:
+        raise HTTPException(
+            status_code=status.HTTP_503_SERVICE_UNAVAILABLE,
+            detail="Graph manager not initialized"
+        )
+
+    confirmed = graph_manager.confirm_transaction(tx_hash)
+
+    return SuccessResponse(
+        success=True,
+        message="Transaction confirmed" if confirmed else "Transaction already confirmed"
+    )
+
+
 @app.get("/graph/node/{address}", response_model=NodeInfo)
 async def get_node_info(address: str):
     """
@@ -164,11 +277,63 @@ async def get_node_info(address: str):
     return NodeInfo(**node_info)
 
 
+@app.put("/graph/node/{address}/properties", response_model=NodeProperties)
+async def set_node_properties(address: str, body: NodePropertiesInput):
+    """
+    Tag an address, e.g. with a risk score, watchlist or exchange label
+
+    Tags are merged into the address's existing ones; a null value removes
+    a tag. Addresses not yet in the graph keep their tags until they transact.
+
+    Args:
+        address: The address to tag
+        body: Tag names and values
+
+    Returns:
+        The address's tags after the update
+    """
+    if graph_manager is None:
+        raise HTTPException(
+            status_code=status.HTTP_503_SERVICE_UNAVAILABLE,
+            detail="Graph manager not initialized"
+        )
+
+    properties = graph_manager.set_node_properties(address, body.properties)
+    return NodeProperties(address=address, properties=properties)
+
+
+@app.get("/graph/nodes", response_model=NodeSearchResponse)
+async def find_nodes(
+    property: str = Query(..., description="Tag name"),
+    value: Optional[str] = Query(None, description="Tag value to match; any value when omitted"),
+    limit: int = Query(1000, ge=1, le=10000, description="Maximum addresses")
+):
+    """
+    Find addresses by tag
+
+    Args:
+        property: Tag name
+        value: Tag value to match, as text (true/false for booleans)
+        limit: Maximum addresses
+
+    Returns:
+        Matching addresses with all their tags
+    """
+    if graph_manager is None:
+        raise HTTPException(
+            status_code=status.HTTP_503_SERVICE_UNAVAILABLE,
+            detail="Graph manager not initialized"
+        )
+
+    nodes = graph_manager.find_nodes(property, value, limit)
+    return NodeSearchResponse(nodes=nodes, count=len(nodes))
+
+
 @app.get("/graph/window", response_model=List[TransactionResponse])
 async def get_transactions_in_window(
     start: int = Query(..., description="Start timestamp (Unix seconds)"),
     end: int = Query(..., description="End timestamp (Unix seconds)"),
-    limit: int = Query(1000, ge=1, le=10000, description="Maximum number of transactions")
+    limit: int = Query(1000, ge=1, le=200000, description="Maximum number of transactions")
 ):
     """
     Get transactions in a time window
@@ -202,16 +367,112 @@ async def get_transactions_in_window(
             amount=tx["amount"],
             tx_hash=tx["tx_hash"],
             block_number=tx["block_number"],
-            timestamp=tx.get("timestamp")
+            timestamp=tx.get("timestamp"),
+            confirmed=tx.get("confirmed", True)
         )
         for tx in transactions
     ]
 
 
+def _transaction_response(tx: Dict[str, Any]) -> TransactionResponse:
+    """Build the response for a transaction from the graph manager"""
+    return TransactionResponse(
+        from_address=tx["from"],
+        to_address=tx["to"],
+        amount=str(tx["amount"]),
+        tx_hash=tx["tx_hash"],
+        block_number=tx["block_number"],
+        timestamp=tx.get("timestamp"),
+        contract=tx.get("contract"),
+        token=tx.get("token"),
+        chain=tx.get("chain"),
+        confirmed=tx.get("confirmed", True)
+    )
+
+
+@app.get("/graph/transactions", response_model=TransactionPageResponse)
+async def query_transactions(
+    start: Optional[int] = Query(None, description="Only transactions at or after this Unix time"),
+    end: Optional[int] = Query(None, description="Only transactions before this Unix time"),
+    address: Optional[str] = Query(None, description="Only transactions sent or received by this address"),
+    min_amount: Optional[Decimal] = Query(None, description="Only transactions of at least this amount"),
+    max_amount: Optional[Decimal] = Query(None, description="Only transactions of at most this amount"),
+    limit: int = Query(100, ge=1, le=1000, description="Maximum number of transactions"),
+    offset: int = Query(0, ge=0, description="Matching transactions to skip")
+):
+    """
+    Find transactions, newest first, a page at a time
+
+    Returns:
+        The page of transactions and the total matching
+    """
+    if graph_manager is None:
+        raise HTTPException(
+            status_code=status.HTTP_503_SERVICE_UNAVAILABLE,
+            detail="Graph manager not initialized"
+        )
+
+    if start is not None and end is not None and start >= end:
+        raise HTTPException(
+            status_code=status.HTTP_400_BAD_REQUEST,
+            detail="Start time must be before end time"
+        )
+    if min_amount is not None and max_amount is not None and min_amount > max_amount:
+        raise HTTPException(
+            status_code=status.HTTP_400_BAD_REQUEST,
+            detail="min_amount must not exceed max_amount"
+        )
+
+    page = graph_manager.query_transactions(
+        start_time=start,
+        end_time=end,
+        address=address,
+        min_amount=min_amount,
+        max_amount=max_amount,
+        limit=limit,
+        offset=offset
+    )
+    return TransactionPageResponse(
+        transactions=[_transaction_response(tx) for tx in page["transactions"]],
+        total=page["total"]
+    )
+
+
+@app.get("/graph/transaction/{tx_hash}", response_model=TransactionResponse)
+async def get_transaction(tx_hash: str):
+    """
+    Look up a transaction by hash
+
+    Args:
+        tx_hash: Transaction hash
+
+    Returns:
+        The transaction
+    """
+    if graph_manager is None:
+        raise HTTPException(
+            status_code=status.HTTP_503_SERVICE_UNAVAILABLE,
+            detail="Graph manager not initialized"
+        )
+
+    tx = graph_manager.get_transaction(tx_hash)
+    if tx is None:
+        raise HTTPException(
+            status_code=status.HTTP_404_NOT_FOUND,
+            detail=f"Transaction not found: {tx_hash}"
+        )
+
+    return _transaction_response(tx)
+
+
 @app.get("/graph/neighbors/{address}", response_model=NeighborsResponse)
 async def get_neighbors(
     address: str,
-    direction: str = Query("both", regex="^(in|out|both)$", description="Edge direction")
+    direction: str = Query("both", regex="^(in|out|both)$", description="Edge direction"),
+    hops: int = Query(1, ge=1, le=3, description="Hops to follow"),
+    start: Optional[int] = Query(None, description="Window start (Unix seconds)"),
+    end: Optional[int] = Query(None, description="Window end (Unix seconds, exclusive)"),
+    limit: int = Query(1000, ge=1, le=10000, description="Maximum counterparties")
 ):
     """
     Get neighboring addresses
@@ -219,9 +480,13 @@ async def get_neighbors(
     Args:
         address: The address to query
         direction: "in", "out", or "both"
+        hops: How many hops to follow
+        start: Only count transactions at or after this time
+        end: Only count transactions before this time
+        limit: Maximum number of counterparties
 
     Returns:
-        List of neighbor addresses
+        Neighbor addresses with per-counterparty transaction totals
     """
     if graph_manager is None:
         raise HTTPException(
@@ -229,12 +494,16 @@ async def get_neighbors(
             detail="Graph manager not initialized"
         )
 
-    neighbors = graph_manager.get_neighbors(address, direction)
+    neighborhood = graph_manager.get_neighborhood(address, hops, direction, start, end, limit)
+    counterparties = neighborhood["counterparties"]
 
     return NeighborsResponse(
         address=address,
-        neighbors=neighbors,
-        count=len(neighbors)
+        neighbors=[c["address"] for c in counterparties],
+        count=len(counterparties),
+        hops=hops,
+        counterparties=counterparties,
+        truncated=neighborhood["truncated"]
     )
 
 
@@ -242,7 +511,12 @@ async def get_neighbors(
 async def find_paths(
     from_address: str = Query(..., alias="from", description="Start address"),
     to_address: str = Query(..., alias="to", description="End address"),
-    max_depth: int = Query(3, ge=1, le=10, description="Maximum path length")
+    max_depth: int = Query(3, ge=1, le=10, description="Maximum addresses in a path"),
+    max_hops: Optional[int] = Query(None, ge=1, le=6, description="Maximum transfers in a path; overrides max_depth"),
+    start: Optional[int] = Query(None, description="Window start (Unix seconds)"),
+    end: Optional[int] = Query(None, description="Window end (Unix seconds, exclusive)"),
+    time_ordered: bool = Query(True, description="Only follow transfers made after the previous hop"),
+    limit: int = Query(100, ge=1, le=1000, description="Maximum paths")
 ):
     """
     Find paths between two addresses
@@ -250,10 +524,15 @@ async def find_paths(
     Args:
         from_address: Start address
         to_address: End address
-        max_depth: Maximum path length
+        max_depth: Maximum path length in addresses
+        max_hops: Maximum path length in transfers
+        start: Only follow transactions at or after this time
+        end: Only follow transactions before this time
+        time_ordered: Require each hop to happen after the previous one
+        limit: Maximum number of paths
 
     Returns:
-        List of paths
+        List of paths, shortest first, with the transactions of each hop
     """
     if graph_manager is None:
         raise HTTPException(
@@ -261,16 +540,165 @@ async def find_paths(
             detail="Graph manager not initialized"
         )
 
-    paths = graph_manager.find_paths(from_address, to_address, max_depth)
+    hops = max_hops if max_hops is not None else max_depth - 1
+    found = graph_manager.find_flow_paths(from_address, to_address, hops, start, end, time_ordered, limit)
+    flows = found["paths"]
 
     return PathsResponse(
         from_address=from_address,
         to_address=to_address,
-        paths=paths,
-        count=len(paths)
+        paths=[flow["addresses"] for flow in flows],
+        count=len(flows),
+        flows=flows,
+        truncated=found["truncated"]
     )
 
 
+@app.get("/graph/subgraph/{address}", response_model=SubgraphResponse)
+async def get_subgraph(
+    address: str,
+    hops: int = Query(2, ge=1, le=3, description="Hops to follow in either direction"),
+    start: Optional[int] = Query(None, description="Window start (Unix seconds)"),
+    end: Optional[int] = Query(None, description="Window end (Unix seconds, exclusive)"),
+    limit: int = Query(500, ge=1, le=5000, description="Maximum addresses besides the centre")
+):
+    """
+    Get the addresses around an address and every transfer between them
+
+    Args:
+        address: The address at the centre
+        hops: Hops to follow in either direction
+        start: Only include transactions at or after this time
+        end: Only include transactions before this time
+        limit: Maximum addresses besides the centre
+
+    Returns:
+        Nodes and edges with amounts and first/last seen times
+    """
+    if graph_manager is None:
+        raise HTTPException(
+            status_code=status.HTTP_503_SERVICE_UNAVAILABLE,
+            detail="Graph manager not initialized"
+        )
+
+    subgraph = graph_manager.get_subgraph(address, hops, start, end, limit)
+    return SubgraphResponse(address=address, hops=hops, **subgraph)
+
+
+@app.get("/graph/degree", response_model=DegreeResponse)
+async def get_degree_ranking(
+    direction: str = Query("total", regex="^(in|out|total)$", description="Rank by in, out or total degree"),
+    start: Optional[int] = Query(None, description="Window start (Unix seconds)"),
+    end: Optional[int] = Query(None, description="Window end (Unix seconds, exclusive)"),
+    limit: int = Query(100, ge=1, le=10000, description="Number of addresses")
+):
+    """
+    Rank addresses by distinct counterparties
+
+    Args:
+        direction: "in" ranks by senders, "out" by receivers, "total" by both
+        start: Only count transactions at or after this time
+        end: Only count transactions before this time
+        limit: Number of addresses
+
+    Returns:
+        The top addresses with degree, transaction counts and amounts
+    """
+    if graph_manager is None:
+        raise HTTPException(
+            status_code=status.HTTP_503_SERVICE_UNAVAILABLE,
+            detail="Graph manager not initialized"
+        )
+
+    nodes = graph_manager.get_degree_ranking(start, end, direction, limit)
+    return DegreeResponse(direction=direction, nodes=nodes)
+
+
+@app.get("/graph/activity", response_model=ActivityResponse)
+async def get_address_activity(
+    start: Optional[int] = Query(None, description="Window start (Unix seconds)"),
+    end: Optional[int] = Query(None, description="Window end (Unix seconds, exclusive)"),
+    min_count: int = Query(1, ge=1, description="Fewest transactions an address needs to be included")
+):
+    """
+    Summarise each address's transfers in a window
+
+    Args:
+        start: Only count transactions at or after this time
+        end: Only count transactions before this time
+        min_count: Leave out addresses with fewer transactions
+
+    Returns:
+        Every qualifying address with degree, counts, amounts and first/last transaction
+    """
+    if graph_manager is None:
+        raise HTTPException(
+            status_code=status.HTTP_503_SERVICE_UNAVAILABLE,
+            detail="Graph manager not initialized"
+        )
+
+    addresses = graph_manager.get_address_activity(start, end, min_count)
+    return ActivityResponse(addresses=addresses)
+
+
+@app.get("/graph/centrality", response_model=CentralityResponse)
+async def get_centrality(
+    algorithm: str = Query("pagerank", regex="^pagerank$", description="Centrality algorithm"),
+    start: Optional[int] = Query(None, description="Window start (Unix seconds)"),
+    end: Optional[int] = Query(None, description="Window end (Unix seconds, exclusive)"),
+    limit: int = Query(100, ge=1, le=10000, description="Number of addresses")
+):
+    """
+    Rank addresses by centrality
+
+    Args:
+        algorithm: Centrality algorithm; only "pagerank" is supported
+        start: Only count transactions at or after this time
+        end: Only count transactions before this time
+        limit: Number of addresses
+
+    Returns:
+        The top addresses with their scores, highest first
+    """
+    if graph_manager is None:
+        raise HTTPException(
+            status_code=status.HTTP_503_SERVICE_UNAVAILABLE,
+            detail="Graph manager not initialized"
+        )
+
+    nodes = graph_manager.get_pagerank(start, end, limit)
+    return CentralityResponse(algorithm=algorithm, nodes=nodes)
+
+
+@app.get("/graph/communities", response_model=CommunitiesResponse)
+async def get_communities(
+    start: Optional[int] = Query(None, description="Window start (Unix seconds)"),
+    end: Optional[int] = Query(None, description="Window end (Unix seconds, exclusive)"),
+    min_size: int = Query(3, ge=2, le=1000, description="Smallest community to return"),
+    limit: int = Query(100, ge=1, le=10000, description="Number of communities")
+):
+    """
+    Find groups of addresses that transact mostly with each other
+
+    Args:
+        start: Only count transactions at or after this time
+        end: Only count transactions before this time
+        min_size: Smallest community to return
+        limit: Number of communities, largest first
+
+    Returns:
+        Communities with members, entry and exit points and flow totals
+    """
+    if graph_manager is None:
+        raise HTTPException(
+            status_code=status.HTTP_503_SERVICE_UNAVAILABLE,
+            detail="Graph manager not initialized"
+        )
+
+    communities = graph_manager.get_communities(start, end, min_size, limit)
+    return CommunitiesResponse(communities=communities, count=len(communities))
+
+
 @app.get("/graph/statistics", response_model=GraphStatistics)
 async def get_graph_statistics():
     """Get graph statistics"""
@@ -5,7 +5,8 @@ This module manages a temporal graph of USDT transactions using Raphtory.
 Nodes represent Tron addresses, edges represent transactions with amounts and timestamps.
 """
 
-from typing import Dict, List, Optional, Any
+from collections import deque
+from typing import Dict, List, Optional, Any, Tuple
 from datetime import datetime
 from decimal import Decimal
 import structlog
@@ -14,6 +15,10 @@ from raphtory import Graph, PersistentGraph
 
 logger = structlog.get_logger()
 
+# Partial paths a single path query may extend before giving up, so a query
+# between two busy exchange wallets cannot tie up the service
+MAX_PATH_EXPANSIONS = 100000
+
 
 class GraphManager:
     """Manages the temporal graph of USDT transactions"""
@@ -40,6 +45,18 @@ class GraphManager:
         self._node_count = 0
         self._edge_count = 0
 
+        # Raphtory edges are append-only, so transactions reverted by a chain
+        # reorganisation are tracked here and filtered out of query results
+        self._retracted: set = set()
+        # Transactions added before reaching the monitor's confirmation depth
+        self._unconfirmed: set = set()
+        # Tags such as risk scores and labels, by address. Tags for addresses
+        # not yet in the graph are applied when they first transact.
+        self._node_properties: Dict[str, Dict[str, Any]] = {}
+        # The address pair of each transaction, so a lookup by hash only
+        # explodes the one edge holding it
+        self._tx_edges: Dict[str, Tuple[str, str]] = {}
+
     def add_transaction(
         self,
         tx_hash: str,
@@ -48,7 +65,10 @@ class GraphManager:
         amount: str,
         timestamp: int,
         block_number: int,
-        contract: str
+        contract: str,
+        token: Optional[str] = None,
+        chain: Optional[str] = None,
+        confirmed: bool = True
     ) -> bool:
         """
         Add a transaction to the temporal graph
@@ -61,31 +81,47 @@ class GraphManager:
             timestamp: Unix timestamp in seconds
             block_number: Block number
             contract: Contract address
+            token: Token symbol (e.g. USDT), if known
+            chain: Blockchain the transfer was observed on (e.g. tron), if known
+            confirmed: False until the transaction reaches the confirmation depth
 
         Returns:
             True if successful, False otherwise
         """
         try:
+            properties = {
+                "tx_hash": tx_hash,
+                "amount": amount,
+                "block_number": block_number,
+                "contract": contract
+            }
+            if token:
+                properties["token"] = token
+            if chain:
+                properties["chain"] = chain
+
             # Add or update nodes (addresses)
             self._add_or_update_node(from_address, timestamp)
             self._add_or_update_node(to_address, timestamp)
 
-            # Add edge (transaction) with temporal information
+            # Add edge (transaction) with temporal information, layered by
+            # token; transfers from older monitors carry no token and were USDT
             self.graph.add_edge(
                 timestamp,
                 from_address,
                 to_address,
-                properties={
-                    "tx_hash": tx_hash,
-                    "amount": amount,
-                    "block_number": block_number,
-                    "contract": contract
-                },
-                layer="usdt"
+                properties=properties,
+                layer=(token or "usdt").lower()
             )
 
             self._transaction_count += 1
             self._edge_count += 1
+            self._tx_edges[tx_hash] = (from_address, to_address)
+
+            if confirmed:
+                self._unconfirmed.discard(tx_hash)
+            else:
+                self._unconfirmed.add(tx_hash)
 
             logger.debug(
                 "Transaction added to graph",
@@ -106,18 +142,54 @@ class GraphManager:
             )
             return False
 
+    def delete_transaction(self, tx_hash: str) -> bool:
+        """
+        Retract a transaction reverted by a chain reorganisation
+
+        Args:
+            tx_hash: Transaction hash
+
+        Returns:
+            True if the transaction was newly retracted, False if it already was
+        """
+        if tx_hash in self._retracted:
+            return False
+
+        self._retracted.add(tx_hash)
+        logger.info("Transaction retracted from graph", tx_hash=tx_hash)
+        return True
+
+    def confirm_transaction(self, tx_hash: str) -> bool:
+        """
+        Mark a transaction added unconfirmed as confirmed
+
+        Args:
+            tx_hash: Transaction hash
+
+        Returns:
+            True if the transaction was unconfirmed, False otherwise
+        """
+        if tx_hash not in self._unconfirmed:
+            return False
+
+        self._unconfirmed.discard(tx_hash)
+        logger.debug("Transaction confirmed", tx_hash=tx_hash)
+        return True
+
     def _add_or_update_node(self, address: str, timestamp: int):
         """Add or update a node (address) in the graph"""
         try:
             # Check if node exists
+            properties = {"address": address}
             if not self.graph.has_node(address):
                 self._node_count += 1
+                properties.update(self._node_properties.get(address, {}))
 
             # Add node with temporal information
             self.graph.add_node(
                 timestamp,
                 address,
-                properties={"address": address},
+                properties=properties,
                 node_type="wallet"
             )
 
@@ -167,7 +239,8 @@ class GraphManager:
                 "received_count": len(in_edges),
                 "total_sent": total_sent,
                 "total_received": total_received,
-                "balance_flow": total_received - total_sent
+                "balance_flow": total_received - total_sent,
+                "properties": self.get_node_properties(address)
             }
 
         except Exception as e:
@@ -178,6 +251,79 @@ class GraphManager:
             )
             return None
 
+    def set_node_properties(self, address: str, properties: Dict[str, Any]) -> Dict[str, Any]:
+        """
+        Tag an address, e.g. with a risk score or exchange label
+
+        Properties are merged into the address's existing tags, and a None
+        value removes a tag. Known addresses get the tags as a property
+        update at their latest time, so tagging does not move them in time.
+
+        Args:
+            address: The address to tag
+            properties: Tag names and values
+
+        Returns:
+            All of the address's tags after the update
+        """
+        tags = self._node_properties.setdefault(address, {})
+        for key, value in properties.items():
+            if value is None:
+                tags.pop(key, None)
+            else:
+                tags[key] = value
+        if not tags:
+            del self._node_properties[address]
+
+        updates = {key: value for key, value in properties.items() if value is not None}
+        if updates and self.graph.has_node(address):
+            try:
+                node = self.graph.node(address)
+                self.graph.add_node(node.latest_time, address, properties=updates)
+            except Exception as e:
+                # The tags are still served from memory
+                logger.warning("Failed to write node properties to graph", address=address, error=str(e))
+
+        logger.debug("Node properties set", address=address, properties=list(properties))
+        return dict(tags)
+
+    def get_node_properties(self, address: str) -> Dict[str, Any]:
+        """An address's tags"""
+        return dict(self._node_properties.get(address, {}))
+
+    def find_nodes(self, key: str, value: Optional[str] = None, limit: int = 1000) -> List[Dict[str, Any]]:
+        """
+        Find addresses by tag
+
+        Args:
+            key: Tag name
+            value: Only match this value, compared as text; any value when None
+            limit: Maximum addresses to return
+
+        Returns:
+            Matching addresses with all their tags, sorted by address
+        """
+        matches = []
+        for address in sorted(self._node_properties):
+            tags = self._node_properties[address]
+            if key not in tags:
+                continue
+            if value is not None and self._property_text(tags[key]) != value:
+                continue
+            matches.append({"address": address, "properties": dict(tags)})
+            if len(matches) >= limit:
+                break
+        return matches
+
+    @staticmethod
+    def _property_text(value: Any) -> str:
+        """A tag value as text for matching: true/false for booleans, no trailing .0"""
+        if isinstance(value, bool):
+            return "true" if value else "false"
+        if isinstance(value, float) and value.is_integer():
+            return str(int(value))
+        return str(value)
+
     def get_transactions_in_window(
         self,
         start_time: int,
@@ -204,12 +350,19 @@ class GraphManager:
                 if len(transactions) >= limit:
                     break
 
+                if edge.properties.get("tx_hash") in self._retracted:
+                    continue
+
                 transactions.append({
                     "from": edge.src().name,
                     "to": edge.dst().name,
                     "amount": edge.properties.get("amount"),
                     "tx_hash": edge.properties.get("tx_hash"),
                     "block_number": edge.properties.get("block_number"),
+                    "contract": edge.properties.get("contract"),
+                    "token": edge.properties.get("token"),
+                    "chain": edge.properties.get("chain"),
+                    "confirmed": edge.properties.get("tx_hash") not in self._unconfirmed,
                     "timestamp": edge.earliest_time if hasattr(edge, 'earliest_time') else None
                 })
 
@@ -231,6 +384,81 @@ class GraphManager:
             )
             return []
 
+    def query_transactions(
+        self,
+        start_time: Optional[int] = None,
+        end_time: Optional[int] = None,
+        address: Optional[str] = None,
+        min_amount: Optional[Decimal] = None,
+        max_amount: Optional[Decimal] = None,
+        limit: int = 100,
+        offset: int = 0
+    ) -> Dict[str, Any]:
+        """
+        Find transactions, newest first, a page at a time
+
+        Args:
+            start_time: Only transactions at or after this Unix time
+            end_time: Only transactions before this Unix time
+            address: Only transactions sent or received by this address
+            min_amount: Only transactions of at least this amount
+            max_amount: Only transactions of at most this amount
+            limit: Maximum number of transactions to return
+            offset: Number of matching transactions to skip
+
+        Returns:
+            Dictionary with the page of transactions and the total matching
+        """
+        view = self._view(start_time, end_time)
+        if address is None:
+            edges = view.edges()
+        elif view.has_node(address):
+            node = view.node(address)
+            # A self-transfer is both an in and an out edge of the address
+            edges = list(node.out_edges()) + [
+                edge for edge in node.in_edges() if edge.src().name != address
+            ]
+        else:
+            edges = []
+
+        matches = []
+        for edge in edges:
+            for tx in self._edge_transactions(edge):
+                amount = Decimal(str(tx["amount"] or 0))
+                if min_amount is not None and amount < min_amount:
+                    continue
+                if max_amount is not None and amount > max_amount:
+                    continue
+                matches.append(tx)
+
+        matches.sort(key=lambda tx: (tx["timestamp"] or 0, tx["tx_hash"] or ""), reverse=True)
+        return {
+            "transactions": matches[offset:offset + limit],
+            "total": len(matches)
+        }
+
+    def get_transaction(self, tx_hash: str) -> Optional[Dict[str, Any]]:
+        """
+        Look up a transaction by hash
+
+        Args:
+            tx_hash: Transaction hash
+
+        Returns:
+            The transaction, or None if it is unknown or was retracted
+        """
+        pair = self._tx_edges.get(tx_hash)
+        if pair is None or tx_hash in self._retracted:
+            return None
+
+        edge = self.graph.edge(*pair)
+        if edge is None:
+            return None
+        for tx in self._edge_transactions(edge):
+            if tx["tx_hash"] == tx_hash:
+                return tx
+        return None
+
     def get_neighbors(
         self,
         address: str,
@@ -271,6 +499,234 @@ class GraphManager:
             )
             return []
 
+    def _view(self, start_time: Optional[int] = None, end_time: Optional[int] = None):
+        """The whole graph, or a windowed view when either bound is given"""
+        if start_time is None and end_time is None:
+            return self.graph
+        earliest = start_time if start_time is not None else 0
+        latest = end_time if end_time is not None else 2**62
+        return self.graph.window(earliest, latest)
+
+    def _edge_transactions(self, edge) -> List[Dict[str, Any]]:
+        """
+        The individual transactions on an edge, oldest first
+
+        Raphtory keeps one edge per address pair with an update per transfer,
+        so the edge is exploded into its updates. Retracted transactions are
+        left out.
+        """
+        transactions = []
+        for update in edge.explode():
+            tx_hash = update.properties.get("tx_hash")
+            if tx_hash in self._retracted:
+                continue
+            transactions.append({
+                "from": update.src().name,
+                "to": update.dst().name,
+                "amount": update.properties.get("amount"),
+                "tx_hash": tx_hash,
+                "block_number": update.properties.get("block_number"),
+                "contract": update.properties.get("contract"),
+                "token": update.properties.get("token"),
+                "chain": update.properties.get("chain"),
+                "confirmed": tx_hash not in self._unconfirmed,
+                "timestamp": update.earliest_time if hasattr(update, 'earliest_time') else None
+            })
+        transactions.sort(key=lambda tx: tx["timestamp"] or 0)
+        return transactions
+
+    def get_neighborhood(
+        self,
+        address: str,
+        hops: int = 1,
+        direction: str = "both",
+        start_time: Optional[int] = None,
+        end_time: Optional[int] = None,
+        limit: int = 1000
+    ) -> Dict[str, Any]:
+        """
+        Get the addresses within a number of hops of an address
+
+        Each counterparty is reported at the hop it was first reached, with
+        totals of the transactions linking it to addresses one hop closer.
+        "sent" is value flowing away from the queried address and "received"
+        value flowing towards it.
+
+        Args:
+            address: The address to query
+            hops: How many hops to follow
+            direction: "in", "out", or "both"
+            start_time: Only count transactions at or after this Unix time
+            end_time: Only count transactions before this Unix time
+            limit: Maximum number of counterparties to return
+
+        Returns:
+            Dictionary with the counterparties and whether the limit cut them short
+        """
+        result = {"counterparties": [], "truncated": False}
+        try:
+            view = self._view(start_time, end_time)
+            if not view.has_node(address):
+                return result
+
+            found: Dict[str, Dict[str, Any]] = {}
+            seen = {address}
+            frontier = [address]
+
+            for hop in range(1, hops + 1):
+                reached = []
+                for current in frontier:
+                    node = view.node(current)
+                    links = []
+                    if direction in ("out", "both"):
+                        links += [(edge, edge.dst().name, "sent") for edge in node.out_edges()]
+                    if direction in ("in", "both"):
+                        links += [(edge, edge.src().name, "received") for edge in node.in_edges()]
+
+                    for edge, other, flow in links:
+                        if other in seen:
+                            continue
+                        transactions = self._edge_transactions(edge)
+                        if not transactions:
+                            continue
+
+                        entry = found.get(other)
+                        if entry is None:
+                            if len(found) >= limit:
+                                result["truncated"] = True
+                                continue
+                            entry = {
+                                "address": other,
+                                "hop": hop,
+                                "sent_count": 0,
+                                "received_count": 0,
+                                "sent": Decimal(0),
+                                "received": Decimal(0),
+                                "first_seen": None,
+                                "last_seen": None
+                            }
+                            found[other] = entry
+                            reached.append(other)
+
+                        for tx in transactions:
+                            entry[flow + "_count"] += 1
+                            entry[flow] += Decimal(str(tx["amount"] or 0))
+                            ts = tx["timestamp"]
+                            if ts is not None:
+                                if entry["first_seen"] is None or ts < entry["first_seen"]:
+                                    entry["first_seen"] = ts
+                                if entry["last_seen"] is None or ts > entry["last_seen"]:
+                                    entry["last_seen"] = ts
+
+                # Addresses reached at this hop are not revisited further out
+                seen.update(reached)
+                frontier = reached
+                if not frontier:
+                    break
+
+            for entry in found.values():
+                entry["sent"] = str(entry["sent"])
+                entry["received"] = str(entry["received"])
+            result["counterparties"] = sorted(found.values(), key=lambda e: (e["hop"], e["address"]))
+            return result
+
+        except Exception as e:
+            logger.error(
+                "Failed to get neighborhood",
+                error=str(e),
+                address=address,
+                hops=hops
+            )
+            return result
+
+    def get_subgraph(
+        self,
+        address: str,
+        hops: int = 2,
+        start_time: Optional[int] = None,
+        end_time: Optional[int] = None,
+        limit: int = 500
+    ) -> Dict[str, Any]:
+        """
+        Get the addresses within a number of hops of an address and every
+        transfer between them, ready for drawing
+
+        Args:
+            address: The address at the centre
+            hops: How many hops to follow, in either direction
+            start_time: Only include transactions at or after this Unix time
+            end_time: Only include transactions before this Unix time
+            limit: Maximum number of addresses besides the centre
+
+        Returns:
+            Dictionary of nodes, edges and whether the limit cut the nodes short
+        """
+        result = {"nodes": [], "edges": [], "truncated": False}
+        try:
+            neighborhood = self.get_neighborhood(address, hops, "both", start_time, end_time, limit)
+            if not neighborhood["counterparties"]:
+                return result
+            result["truncated"] = neighborhood["truncated"]
+
+            hop_of = {address: 0}
+            for counterparty in neighborhood["counterparties"]:
+                hop_of[counterparty["address"]] = counterparty["hop"]
+
+            nodes = {
+                member: {
+                    "address": member,
+                    "hop": hop,
+                    "transaction_count": 0,
+                    "sent": Decimal(0),
+                    "received": Decimal(0),
+                    "first_seen": None,
+                    "last_seen": None
+                }
+                for member, hop in hop_of.items()
+            }
+
+            view = self._view(start_time, end_time)
+            for member in hop_of:
+                for edge in view.node(member).out_edges():
+                    other = edge.dst().name
+                    if other not in hop_of:
+                        continue
+                    transactions = self._edge_transactions(edge)
+                    if not transactions:
+                        continue
+
+                    amount = sum(Decimal(str(tx["amount"] or 0)) for tx in transactions)
+                    timestamps = [tx["timestamp"] for tx in transactions if tx["timestamp"] is not None]
+                    first_seen = min(timestamps) if timestamps else None
+                    last_seen = max(timestamps) if timestamps else None
+                    result["edges"].append({
+                        "from": member,
+                        "to": other,
+                        "transaction_count": len(transactions),
+                        "amount": str(amount),
+                        "first_seen": first_seen,
+                        "last_seen": last_seen
+                    })
+
+                    for node, flow in ((nodes[member], "sent"), (nodes[other], "received")):
+                        node["transaction_count"] += len(transactions)
+                        node[flow] += amount
+                        if first_seen is not None and (node["first_seen"] is None or first_seen < node["first_seen"]):
+                            node["first_seen"] = first_seen
+                        if last_seen is not None and (node["last_seen"] is None or last_seen > node["last_seen"]):
+                            node["last_seen"] = last_seen
+
+            for node in nodes.values():
+                node["sent"] = str(node["sent"])
+                node["received"] = str(node["received"])
+            result["nodes"] = sorted(nodes.values(), key=lambda n: (n["hop"], n["address"]))
+            result["edges"].sort(key=lambda e: (e["from"], e["to"]))
+            return result
+
+        except Exception as e:
+            logger.error("Failed to get subgraph", address=address, error=str(e))
+            return result
+
     def find_paths(
         self,
         from_address: str,
@@ -325,6 +781,475 @@ class GraphManager:
             )
             return []
 
+    def find_flow_paths(
+        self,
+        from_address: str,
+        to_address: str,
+        max_hops: int = 3,
+        start_time: Optional[int] = None,
+        end_time: Optional[int] = None,
+        time_ordered: bool = True,
+        limit: int = 100
+    ) -> Dict[str, Any]:
+        """
+        Find paths value could have taken from one address to another
+
+        Paths follow transfers forwards, shortest first, and never revisit an
+        address. When time_ordered, each hop only keeps transactions made no
+        earlier than the first transaction that reached its sender, so funds
+        could actually have flowed along the path.
+
+        Args:
+            from_address: Start address
+            to_address: End address
+            max_hops: Maximum number of transfers in a path
+            start_time: Only follow transactions at or after this Unix time
+            end_time: Only follow transactions before this Unix time
+            time_ordered: Require each hop to happen after the previous one
+            limit: Maximum number of paths to return
+
+        Returns:
+            Dictionary with the paths, each a list of addresses and the
+            transactions of every hop, and whether the search was cut short
+        """
+        result = {"paths": [], "truncated": False}
+        try:
+            view = self._view(start_time, end_time)
+            if not view.has_node(from_address) or not view.has_node(to_address):
+                return result
+
+            # Each entry is the addresses so far, their hops, and the earliest
+            # time value could have reached the last address
+            queue = deque([([from_address], [], None)])
+            expansions = 0
+
+            while queue:
+                addresses, hops, reached_at = queue.popleft()
+                if len(hops) >= max_hops:
+                    continue
+
+                expansions += 1
+                if expansions > MAX_PATH_EXPANSIONS:
+                    result["truncated"] = True
+                    break
+
+                for edge in view.node(addresses[-1]).out_edges():
+                    next_address = edge.dst().name
+                    if next_address in addresses:
+                        continue
+
+                    transactions = self._edge_transactions(edge)
+                    if time_ordered and reached_at is not None:
+                        transactions = [
+                            tx for tx in transactions
+                            if tx["timestamp"] is not None and tx["timestamp"] >= reached_at
+                        ]
+                    if not transactions:
+                        continue
+
+                    arrival = None
+                    if time_ordered:
+                        times = [tx["timestamp"] for tx in transactions if tx["timestamp"] is not None]
+                        arrival = min(times) if times else reached_at
+
+                    path_hops = hops + [{
+                        "from": addresses[-1],
+                        "to": next_address,
+                        "transactions": transactions
+                    }]
+
+                    if next_address == to_address:
+                        if len(result["paths"]) >= limit:
+                            result["truncated"] = True
+                            return result
+                        result["paths"].append({
+                            "addresses": addresses + [next_address],
+                            "hops": path_hops
+                        })
+                        continue
+
+                    queue.append((addresses + [next_address], path_hops, arrival))
+
+            return result
+
+        except Exception as e:
+            logger.error(
+                "Failed to find flow paths",
+                error=str(e),
+                from_address=from_address,
+                to_address=to_address
+            )
+            return result
+
+    def _window_flows(
+        self,
+        start_time: Optional[int] = None,
+        end_time: Optional[int] = None
+    ) -> Dict[tuple, List[Dict[str, Any]]]:
+        """Transactions in a window grouped by (sender, receiver), without retracted ones"""
+        flows = {}
+        for edge in self._view(start_time, end_time).edges():
+            transactions = self._edge_transactions(edge)
+            if transactions:
+                flows[(edge.src().name, edge.dst().name)] = transactions
+        return flows
+
+    def get_degree_ranking(
+        self,
+        start_time: Optional[int] = None,
+        end_time: Optional[int] = None,
+        direction: str = "total",
+        limit: int = 100
+    ) -> List[Dict[str, Any]]:
+        """
+        Rank addresses by how many distinct counterparties they have
+
+        Args:
+            start_time: Only count transactions at or after this Unix time
+            end_time: Only count transactions before this Unix time
+            direction: Rank by "in" (senders), "out" (receivers) or "total"
+            limit: Number of addresses to return
+
+        Returns:
+            The top addresses with in/out degree, transaction counts and amounts
+        """
+        try:
+            nodes: Dict[str, Dict[str, Any]] = {}
+
+            def entry(address):
+                if address not in nodes:
+                    nodes[address] = {
+                        "address": address,
+                        "in_degree": 0,
+                        "out_degree": 0,
+                        "in_count": 0,
+                        "out_count": 0,
+                        "received": Decimal(0),
+                        "sent": Decimal(0)
+                    }
+                return nodes[address]
+
+            for (src, dst), transactions in self._window_flows(start_time, end_time).items():
+                amount = sum(Decimal(str(tx["amount"] or 0)) for tx in transactions)
+                sender, receiver = entry(src), entry(dst)
+                sender["out_degree"] += 1
+                sender["out_count"] += len(transactions)
+                sender["sent"] += amount
+                receiver["in_degree"] += 1
+                receiver["in_count"] += len(transactions)
+                receiver["received"] += amount
+
+            def rank(node):
+                if direction == "in":
+                    return node["in_degree"]
+                if direction == "out":
+                    return node["out_degree"]
+                return node["in_degree"] + node["out_degree"]
+
+            ranked = sorted(nodes.values(), key=lambda node: (-rank(node), node["address"]))[:limit]
+            for node in ranked:
+                node["received"] = str(node["received"])
+                node["sent"] = str(node["sent"])
+            return ranked
+
+        except Exception as e:
+            logger.error("Failed to rank degrees", error=str(e))
+            return []
+
+    def get_address_activity(
+        self,
+        start_time: Optional[int] = None,
+        end_time: Optional[int] = None,
+        min_count: int = 1
+    ) -> List[Dict[str, Any]]:
+        """
+        Summarise each address's transfers in a window
+
+        Unlike get_degree_ranking every qualifying address is returned, so
+        callers can apply their own thresholds without reading the window's
+        transactions.
+
+        Args:
+            start_time: Only count transactions at or after this Unix time
+            end_time: Only count transactions before this Unix time
+            min_count: Leave out addresses with fewer transactions than this
+
+        Returns:
+            Per-address degree, transaction counts, amounts, unconfirmed count
+            and first/last transaction, ordered by address
+        """
+        try:
+            nodes: Dict[str, Dict[str, Any]] = {}
+
+            def entry(address):
+                if address not in nodes:
+                    nodes[address] = {
+                        "address": address,
+                        "in_degree": 0,
+                        "out_degree": 0,
+                        "in_count": 0,
+                        "out_count": 0,
+                        "received": Decimal(0),
+                        "sent": Decimal(0),
+                        "unconfirmed_count": 0,
+                        "first_seen": None,
+                        "last_seen": None,
+                        "first_tx_hash": None
+                    }
+                return nodes[address]
+
+            def seen(node, tx):
+                timestamp = tx["timestamp"] or 0
+                if node["first_seen"] is None or timestamp < node["first_seen"]:
+                    node["first_seen"] = timestamp
+                    node["first_tx_hash"] = tx["tx_hash"]
+                if node["last_seen"] is None or timestamp > node["last_seen"]:
+                    node["last_seen"] = timestamp
+
+            for (src, dst), transactions in self._window_flows(start_time, end_time).items():
+                sender, receiver = entry(src), entry(dst)
+                sender["out_degree"] += 1
+                receiver["in_degree"] += 1
+                for tx in transactions:
+                    amount = Decimal(str(tx["amount"] or 0))
+                    sender["out_count"] += 1
+                    sender["sent"] += amount
+                    receiver["in_count"] += 1
+                    receiver["received"] += amount
+                    for node in (sender, receiver):
+                        if not tx["confirmed"]:
+                            node["unconfirmed_count"] += 1
+                        seen(node, tx)
+
+            activity = []
+            for address in sorted(nodes):
+                node = nodes[address]
+                if node["in_count"] + node["out_count"] < min_count:
+                    continue
+                node["received"] = str(node["received"])
+                node["sent"] = str(node["sent"])
+                activity.append(node)
+            return activity
+
+        except Exception as e:
+            logger.error("Failed to summarise address activity", error=str(e))
+            return []
+
+    def get_pagerank(
+        self,
+        start_time: Optional[int] = None,
+        end_time: Optional[int] = None,
+        limit: int = 100,
+        damping: float = 0.85,
+        iterations: int = 50,
+        tolerance: float = 1e-6
+    ) -> List[Dict[str, Any]]:
+        """
+        Rank addresses by PageRank over the transfer graph in a window
+
+        Links are weighted by transaction count, so an address that many
+        others pay repeatedly ranks high. Scores sum to 1 across the window.
+
+        Args:
+            start_time: Only count transactions at or after this Unix time
+            end_time: Only count transactions before this Unix time
+            limit: Number of addresses to return
+            damping: Probability of following a transfer rather than jumping
+            iterations: Maximum power iterations
+            tolerance: Stop once scores change by less than this in total
+
+        Returns:
+            The top addresses with their scores, highest first
+        """
+        try:
+            flows = self._window_flows(start_time, end_time)
+            nodes = sorted({address for pair in flows for address in pair})
+            if not nodes:
+                return []
+
+            out_weight: Dict[str, int] = {}
+            incoming: Dict[str, List[tuple]] = {address: [] for address in nodes}
+            for (src, dst), transactions in flows.items():
+                out_weight[src] = out_weight.get(src, 0) + len(transactions)
+                incoming[dst].append((src, len(transactions)))
+
+            n = len(nodes)
+            scores = {address: 1.0 / n for address in nodes}
+            for _ in range(iterations):
+                # Addresses that never send spread their score evenly
+                dangling = sum(scores[address] for address in nodes if address not in out_weight)
+                base = (1.0 - damping) / n + damping * dangling / n
+                updated = {
+                    address: base + damping * sum(
+                        scores[src] * weight / out_weight[src]
+                        for src, weight in incoming[address]
+                    )
+                    for address in nodes
+                }
+                change = sum(abs(updated[address] - scores[address]) for address in nodes)
+                scores = updated
+                if change < tolerance:
+                    break
+
+            ranked = sorted(scores.items(), key=lambda item: (-item[1], item[0]))[:limit]
+            return [{"address": address, "score": score} for address, score in ranked]
+
+        except Exception as e:
+            logger.error("Failed to compute PageRank", error=str(e))
+            return []
+
+    def get_communities(
+        self,
+        start_time: Optional[int] = None,
+        end_time: Optional[int] = None,
+        min_size: int = 3,
+        limit: int = 100,
+        max_iterations: int = 20
+    ) -> List[Dict[str, Any]]:
+        """
+        Group addresses that transact mostly with each other
+
+        Communities come from label propagation over transfers in the window,
+        ignoring direction and weighting links by transaction count. Each
+        address repeatedly adopts the label most common among its
+        counterparties, so densely linked groups converge on one label.
+
+        Args:
+            start_time: Only count transactions at or after this Unix time
+            end_time: Only count transactions before this Unix time
+            min_size: Leave out communities with fewer members
+            limit: Number of communities to return, largest first
+            max_iterations: Maximum label propagation passes
+
+        Returns:
+            Communities with their members and flow statistics
+        """
+        try:
+            flows = self._window_flows(start_time, end_time)
+
+            weights: Dict[str, Dict[str, int]] = {}
+            for (src, dst), transactions in flows.items():
+                if src == dst:
+                    continue
+                for a, b in ((src, dst), (dst, src)):
+                    links = weights.setdefault(a, {})
+                    links[b] = links.get(b, 0) + len(transactions)
+
+            # Visit in a fixed order and break ties by label so results are stable
+            nodes = sorted(weights)
+            labels = {address: address for address in nodes}
+            for _ in range(max_iterations):
+                changed = False
+                for address in nodes:
+                    votes: Dict[str, int] = {}
+                    for neighbor, weight in weights[address].items():
+                        votes[labels[neighbor]] = votes.get(labels[neighbor], 0) + weight
+                    best = max(votes.values())
+                    if votes.get(labels[address]) == best:
+                        continue
+                    labels[address] = min(label for label, votes_for in votes.items() if votes_for == best)
+                    changed = True
+                if not changed:
+                    break
+
+            groups: Dict[str, List[str]] = {}
+            for address, label in labels.items():
+                groups.setdefault(label, []).append(address)
+
+            communities = [
+                self._community_stats(sorted(members), flows)
+                for members in groups.values()
+                if len(members) >= min_size
+            ]
+            communities.sort(key=lambda c: (-c["size"], -Decimal(c["internal_amount"]), c["members"][0]))
+            communities = communities[:limit]
+            for i, community in enumerate(communities):
+                community["id"] = i
+            return communities
+
+        except Exception as e:
+            logger.error("Failed to detect communities", error=str(e))
+            return []
+
+    def _community_stats(
+        self,
+        members: List[str],
+        flows: Dict[tuple, List[Dict[str, Any]]]
+    ) -> Dict[str, Any]:
+        """Flow statistics for one community"""
+        member_set = set(members)
+        internal_edges = 0
+        internal_count = 0
+        internal_amount = Decimal(0)
+        inflow = Decimal(0)
+        outflow = Decimal(0)
+        entry_points = set()
+        exit_points = set()
+        successors: Dict[str, List[str]] = {address: [] for address in members}
+        first_seen = None
+        last_seen = None
+
+        for (src, dst), transactions in flows.items():
+            inside_src, inside_dst = src in member_set, dst in member_set
+            if not inside_src and not inside_dst:
+                continue
+            amount = sum(Decimal(str(tx["amount"] or 0)) for tx in transactions)
+            if inside_src and inside_dst:
+                internal_edges += 1
+                internal_count += len(transactions)
+                internal_amount += amount
+                successors[src].append(dst)
+                for tx in transactions:
+                    first_seen = tx["timestamp"] if first_seen is None else min(first_seen, tx["timestamp"])
+                    last_seen = tx["timestamp"] if last_seen is None else max(last_seen, tx["timestamp"])
+            elif inside_dst:
+                entry_points.add(dst)
+                inflow += amount
+            else:
+                exit_points.add(src)
+                outflow += amount
+
+        size = len(members)
+        return {
+            "id": 0,
+            "members": members,
+            "size": size,
+            "internal_edges": internal_edges,
+            "internal_count": internal_count,
+            "internal_amount": str(internal_amount),
+            "density": internal_edges / (size * (size - 1)) if size > 1 else 0.0,
+            "entry_points": sorted(entry_points),
+            "exit_points": sorted(exit_points),
+            "inflow": str(inflow),
+            "outflow": str(outflow),
+            "has_cycle": self._has_cycle(successors),
+            "first_seen": first_seen,
+            "last_seen": last_seen
+        }
+
+    @staticmethod
+    def _has_cycle(successors: Dict[str, List[str]]) -> bool:
+        """Whether following transfers between the given addresses can loop back"""
+        visiting, done = set(), set()
+        for root in successors:
+            if root in done:
+                continue
+            stack = [(root, iter(successors[root]))]
+            visiting.add(root)
+            while stack:
+                address, children = stack[-1]
+                child = next(children, None)
+                if child is None:
+                    stack.pop()
+                    visiting.discard(address)
+                    done.add(address)
+                elif child in visiting:
+                    return True
+                elif child not in done:
+                    visiting.add(child)
+                    stack.append((child, iter(successors[child])))
+        return False
+
     def get_statistics(self) -> Dict[str, Any]:
         """Get graph statistics"""
         try:
@@ -381,5 +1306,9 @@ class GraphManager:
         self._transaction_count = 0
         self._node_count = 0
         self._edge_count = 0
+        self._retracted = set()
+        self._unconfirmed = set()
+        self._node_properties = {}
+        self._tx_edges = {}
 
         logger.info("Graph cleared")
@@ -42,6 +42,31 @@ def test_add_transaction(client):
     assert "message" in data
 
 
+def test_add_transactions_batch(client):
+    """Test adding several transactions in one request"""
+    batch = {
+        "transactions": [
+            {
+                "tx_hash": f"0xbatch{i}",
+                "from": "TFromAddress123",
+                "to": "TToAddress456",
+                "amount": "10.00",
+                "timestamp": 1704067200 + i,
+                "block_number": 12345 + i,
+                "contract": "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+            }
+            for i in range(3)
+        ]
+    }
+
+    response = client.post("/graph/transactions/batch", json=batch)
+    assert response.status_code == 201
+    data = response.json()
+    assert data["success"] is True
+    assert data["added"] == 3
+    assert data["failed"] == []
+
+
 def test_get_node_info(client):
     """Test getting node information"""
     # First add a transaction
@@ -71,6 +96,22 @@ def test_get_node_info_not_found(client):
     assert response.status_code == 404
 
 
+def test_set_node_properties(client):
+    """Test tagging an address and finding it by tag"""
+    response = client.put("/graph/node/TTagged/properties", json={
+        "properties": {"risk_score": 1, "risk_severity": "critical"}
+    })
+    assert response.status_code == 200
+    assert response.json()["properties"] == {"risk_score": 1.0, "risk_severity": "critical"}
+
+    response = client.get("/graph/nodes?property=risk_severity&value=critical")
+    assert response.status_code == 200
+    assert "TTagged" in [node["address"] for node in response.json()["nodes"]]
+
+    response = client.put("/graph/node/TTagged/properties", json={"properties": {"risk_score": [1]}})
+    assert response.status_code == 422
+
+
 def test_get_neighbors(client):
     """Test getting neighbors"""
     # Add transactions
@@ -108,6 +149,38 @@ def test_get_neighbors(client):
     assert "TAddr3" in data["neighbors"]
 
 
+def test_get_neighbors_multi_hop(client):
+    """Test multi-hop neighbors with counterparty totals"""
+    transactions = [
+        ("0xn1", "TNbrA", "TNbrB", "100", 1704067200),
+        ("0xn2", "TNbrB", "TNbrC", "40", 1704067260),
+    ]
+    for tx_hash, from_addr, to_addr, amount, timestamp in transactions:
+        client.post("/graph/transaction", json={
+            "tx_hash": tx_hash,
+            "from": from_addr,
+            "to": to_addr,
+            "amount": amount,
+            "timestamp": timestamp,
+            "block_number": 12345,
+            "contract": "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+        })
+
+    response = client.get("/graph/neighbors/TNbrA?hops=2")
+    assert response.status_code == 200
+    data = response.json()
+    assert data["hops"] == 2
+    assert data["truncated"] is False
+    counterparties = {c["address"]: c for c in data["counterparties"]}
+    assert counterparties["TNbrB"]["hop"] == 1
+    assert counterparties["TNbrB"]["sent"] == "100"
+    assert counterparties["TNbrC"]["hop"] == 2
+    assert counterparties["TNbrC"]["sent"] == "40"
+
+    response = client.get("/graph/neighbors/TNbrA?hops=4")
+    assert response.status_code == 422
+
+
 def test_find_paths(client):
     """Test finding paths"""
     # Add path: A -> B -> C
@@ -144,6 +217,135 @@ def test_find_paths(client):
     assert len(data["paths"]) > 0
 
 
+def test_find_paths_with_hops(client):
+    """Test paths include the transactions of each hop"""
+    transactions = [
+        ("0xp1", "TPathA", "TPathB", 1704067200),
+        ("0xp2", "TPathB", "TPathC", 1704067260),
+    ]
+    for tx_hash, from_addr, to_addr, timestamp in transactions:
+        client.post("/graph/transaction", json={
+            "tx_hash": tx_hash,
+            "from": from_addr,
+            "to": to_addr,
+            "amount": "100",
+            "timestamp": timestamp,
+            "block_number": 12345,
+            "contract": "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+        })
+
+    response = client.get("/graph/paths?from=TPathA&to=TPathC&max_hops=2&start=1704067000")
+    assert response.status_code == 200
+    data = response.json()
+    assert data["paths"] == [["TPathA", "TPathB", "TPathC"]]
+    hops = data["flows"][0]["hops"]
+    assert hops[0]["from"] == "TPathA"
+    assert hops[0]["transactions"][0]["tx_hash"] == "0xp1"
+    assert hops[1]["transactions"][0]["from"] == "TPathB"
+
+
+def test_get_subgraph(client):
+    """Test the subgraph around an address"""
+    transactions = [
+        ("0xs1", "TSubA", "TSubB", 1704067200),
+        ("0xs2", "TSubB", "TSubC", 1704067260),
+    ]
+    for tx_hash, from_addr, to_addr, timestamp in transactions:
+        client.post("/graph/transaction", json={
+            "tx_hash": tx_hash,
+            "from": from_addr,
+            "to": to_addr,
+            "amount": "100",
+            "timestamp": timestamp,
+            "block_number": 12345,
+            "contract": "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+        })
+
+    response = client.get("/graph/subgraph/TSubB?hops=1")
+    assert response.status_code == 200
+    data = response.json()
+    assert data["address"] == "TSubB"
+    assert [node["address"] for node in data["nodes"]] == ["TSubB", "TSubA", "TSubC"]
+    assert data["edges"][0]["from"] == "TSubA"
+    assert data["edges"][0]["amount"] == "100"
+
+    assert client.get("/graph/subgraph/TSubB?hops=4").status_code == 422
+
+
+def test_get_degree_and_centrality(client):
+    """Test degree and centrality rankings over a window"""
+    # Timestamps well clear of other tests' transactions
+    transactions = [
+        ("0xr1", "TRankA", "TRankHub", 1893456000),
+        ("0xr2", "TRankB", "TRankHub", 1893456060),
+        ("0xr3", "TRankHub", "TRankA", 1893456120),
+    ]
+    for tx_hash, from_addr, to_addr, timestamp in transactions:
+        client.post("/graph/transaction", json={
+            "tx_hash": tx_hash,
+            "from": from_addr,
+            "to": to_addr,
+            "amount": "100",
+            "timestamp": timestamp,
+            "block_number": 12345,
+            "contract": "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+        })
+
+    response = client.get("/graph/degree?direction=in&start=1893456000&limit=1")
+    assert response.status_code == 200
+    data = response.json()
+    assert data["direction"] == "in"
+    assert data["nodes"][0]["address"] == "TRankHub"
+    assert data["nodes"][0]["in_degree"] == 2
+
+    response = client.get("/graph/centrality?start=1893456000")
+    assert response.status_code == 200
+    data = response.json()
+    assert data["algorithm"] == "pagerank"
+    assert data["nodes"][0]["address"] == "TRankHub"
+
+    response = client.get("/graph/activity?start=1893456000&min_count=2")
+    assert response.status_code == 200
+    addresses = {node["address"]: node for node in response.json()["addresses"]}
+    assert set(addresses) == {"TRankA", "TRankHub"}
+    assert addresses["TRankHub"]["in_count"] == 2
+    assert addresses["TRankHub"]["first_tx_hash"] == "0xr1"
+
+    assert client.get("/graph/degree?direction=sideways").status_code == 422
+    assert client.get("/graph/activity?min_count=0").status_code == 422
+    assert client.get("/graph/centrality?algorithm=betweenness").status_code == 422
+
+
+def test_get_communities(client):
+    """Test communities over a window"""
+    # Timestamps well clear of other tests' transactions
+    transactions = [
+        ("0xc1", "TLoopA", "TLoopB", 1893542400),
+        ("0xc2", "TLoopB", "TLoopC", 1893542460),
+        ("0xc3", "TLoopC", "TLoopA", 1893542520),
+    ]
+    for tx_hash, from_addr, to_addr, timestamp in transactions:
+        client.post("/graph/transaction", json={
+            "tx_hash": tx_hash,
+            "from": from_addr,
+            "to": to_addr,
+            "amount": "100",
+            "timestamp": timestamp,
+            "block_number": 12345,
+            "contract": "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+        })
+
+    response = client.get("/graph/communities?start=1893542400&end=1893542600")
+    assert response.status_code == 200
+    data = response.json()
+    assert data["count"] == 1
+    community = data["communities"][0]
+    assert community["members"] == ["TLoopA", "TLoopB", "TLoopC"]
+    assert community["has_cycle"] is True
+
+    assert client.get("/graph/communities?min_size=1").status_code == 422
+
+
 def test_get_window_transactions(client):
     """Test getting transactions in window"""
     # Add transactions
@@ -171,6 +373,36 @@ def test_get_window_invalid_range(client):
     assert response.status_code == 400
 
 
+def test_query_transactions(client):
+    """Test finding and looking up transactions"""
+    for i, amount in enumerate(["10", "500", "2000"]):
+        client.post("/graph/transaction", json={
+            "tx_hash": f"0xquery{i}",
+            "from": "TQueryFrom",
+            "to": f"TQueryTo{i}",
+            "amount": amount,
+            "timestamp": 1704067200 + i * 60,
+            "block_number": 12345 + i,
+            "contract": "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+        })
+
+    response = client.get("/graph/transactions?address=TQueryFrom&min_amount=100&limit=1")
+    assert response.status_code == 200
+    data = response.json()
+    assert data["total"] == 2
+    assert [tx["tx_hash"] for tx in data["transactions"]] == ["0xquery2"]
+    assert data["transactions"][0]["from"] == "TQueryFrom"
+
+    response = client.get("/graph/transaction/0xquery1")
+    assert response.status_code == 200
+    assert response.json()["amount"] == "500"
+
+    assert client.get("/graph/transaction/0xmissing").status_code == 404
+    assert client.get("/graph/transactions?start=1704067300&end=1704067200").status_code == 400
+    assert client.get("/graph/transactions?min_amount=5&max_amount=1").status_code == 400
+    assert client.get("/graph/transactions?limit=5000").status_code == 422
+
+
 def test_get_statistics(client):
     """Test getting graph statistics"""
     response = client.get("/graph/statistics")
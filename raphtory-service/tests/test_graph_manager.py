@@ -3,6 +3,7 @@ Tests for GraphManager
 """
 
 import pytest
+from decimal import Decimal
 from graph.graph_manager import GraphManager
 
 
@@ -109,6 +110,41 @@ def test_get_node_info_nonexistent(graph_manager):
     assert info is None
 
 
+def test_set_node_properties(graph_manager):
+    """Test tagging addresses and finding them by tag"""
+    graph_manager.add_transaction(
+        tx_hash="0x1",
+        from_address="TAddrA",
+        to_address="TAddrB",
+        amount="100",
+        timestamp=1704067200,
+        block_number=12345,
+        contract="TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+    )
+
+    tags = graph_manager.set_node_properties("TAddrA", {"risk_score": 0.75, "label": "exchange"})
+    assert tags == {"risk_score": 0.75, "label": "exchange"}
+
+    # Tagging does not move the address in time
+    info = graph_manager.get_node_info("TAddrA")
+    assert info["properties"] == tags
+    assert info["last_seen"] == 1704067200
+
+    # Merging, and removing a tag with None
+    tags = graph_manager.set_node_properties("TAddrA", {"label": None, "watchlist": True})
+    assert tags == {"risk_score": 0.75, "watchlist": True}
+
+    # Addresses not yet seen keep their tags
+    graph_manager.set_node_properties("TAddrNew", {"watchlist": True})
+    assert graph_manager.get_node_info("TAddrNew") is None
+
+    matches = graph_manager.find_nodes("watchlist", "true")
+    assert [m["address"] for m in matches] == ["TAddrA", "TAddrNew"]
+    assert graph_manager.find_nodes("risk_score", "0.75")[0]["address"] == "TAddrA"
+    assert graph_manager.find_nodes("label") == []
+    assert len(graph_manager.find_nodes("watchlist", limit=1)) == 1
+
+
 def test_get_neighbors(graph_manager):
     """Test getting neighbors"""
     # Add transactions to create a graph: A -> B -> C
@@ -148,6 +184,55 @@ def test_get_neighbors(graph_manager):
     assert len(neighbors_b) == 2
 
 
+def test_get_neighborhood(graph_manager):
+    """Test k-hop neighborhoods with edge totals"""
+    # A -> B twice, C -> B, B -> D, D -> E
+    transactions = [
+        ("0x1", "TAddrA", "TAddrB", "100", 1704067200),
+        ("0x2", "TAddrA", "TAddrB", "50.5", 1704067260),
+        ("0x3", "TAddrC", "TAddrB", "20", 1704067320),
+        ("0x4", "TAddrB", "TAddrD", "70", 1704067380),
+        ("0x5", "TAddrD", "TAddrE", "10", 1704067440),
+    ]
+    for tx_hash, from_addr, to_addr, amount, timestamp in transactions:
+        graph_manager.add_transaction(
+            tx_hash=tx_hash,
+            from_address=from_addr,
+            to_address=to_addr,
+            amount=amount,
+            timestamp=timestamp,
+            block_number=12345,
+            contract="TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+        )
+
+    one_hop = graph_manager.get_neighborhood("TAddrB", hops=1)
+    by_address = {c["address"]: c for c in one_hop["counterparties"]}
+    assert set(by_address) == {"TAddrA", "TAddrC", "TAddrD"}
+    assert by_address["TAddrA"]["received_count"] == 2
+    assert by_address["TAddrA"]["received"] == "150.5"
+    assert by_address["TAddrA"]["first_seen"] == 1704067200
+    assert by_address["TAddrA"]["last_seen"] == 1704067260
+    assert by_address["TAddrD"]["sent_count"] == 1
+    assert by_address["TAddrD"]["sent"] == "70"
+
+    two_hops = graph_manager.get_neighborhood("TAddrB", hops=2)
+    hops = {c["address"]: c["hop"] for c in two_hops["counterparties"]}
+    assert hops == {"TAddrA": 1, "TAddrC": 1, "TAddrD": 1, "TAddrE": 2}
+
+    # Only transactions inside the window count
+    windowed = graph_manager.get_neighborhood("TAddrB", hops=1, start_time=1704067250, end_time=1704067330)
+    by_address = {c["address"]: c for c in windowed["counterparties"]}
+    assert set(by_address) == {"TAddrA", "TAddrC"}
+    assert by_address["TAddrA"]["received"] == "50.5"
+
+    # Retracted transactions are left out
+    graph_manager.delete_transaction("0x3")
+    limited = graph_manager.get_neighborhood("TAddrB", hops=1, limit=1)
+    assert len(limited["counterparties"]) == 1
+    assert limited["truncated"] is True
+    assert "TAddrC" not in {c["address"] for c in graph_manager.get_neighborhood("TAddrB")["counterparties"]}
+
+
 def test_find_paths(graph_manager):
     """Test finding paths between nodes"""
     # Create path: A -> B -> C -> D
@@ -174,6 +259,228 @@ def test_find_paths(graph_manager):
     assert ["TAddrA", "TAddrB", "TAddrC", "TAddrD"] in paths
 
 
+def test_find_flow_paths(graph_manager):
+    """Test time-ordered paths with the transactions of each hop"""
+    # A -> B -> D, and A -> C -> D where C forwarded before it was paid
+    transactions = [
+        ("0x1", "TAddrA", "TAddrB", 1704067200),
+        ("0x2", "TAddrB", "TAddrD", 1704067260),
+        ("0x3", "TAddrA", "TAddrC", 1704067320),
+        ("0x4", "TAddrC", "TAddrD", 1704067100),
+    ]
+    for tx_hash, from_addr, to_addr, timestamp in transactions:
+        graph_manager.add_transaction(
+            tx_hash=tx_hash,
+            from_address=from_addr,
+            to_address=to_addr,
+            amount="100",
+            timestamp=timestamp,
+            block_number=12345,
+            contract="TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+        )
+
+    result = graph_manager.find_flow_paths("TAddrA", "TAddrD", max_hops=2)
+    assert result["truncated"] is False
+    assert [path["addresses"] for path in result["paths"]] == [["TAddrA", "TAddrB", "TAddrD"]]
+    hops = result["paths"][0]["hops"]
+    assert [tx["tx_hash"] for tx in hops[0]["transactions"]] == ["0x1"]
+    assert [tx["tx_hash"] for tx in hops[1]["transactions"]] == ["0x2"]
+
+    # Without time ordering both routes count
+    unordered = graph_manager.find_flow_paths("TAddrA", "TAddrD", max_hops=2, time_ordered=False)
+    assert len(unordered["paths"]) == 2
+
+    # Too few hops, or a window that misses the second hop, finds nothing
+    assert graph_manager.find_flow_paths("TAddrA", "TAddrD", max_hops=1)["paths"] == []
+    windowed = graph_manager.find_flow_paths("TAddrA", "TAddrD", max_hops=2, start_time=1704067000, end_time=1704067250)
+    assert windowed["paths"] == []
+
+
+def test_get_subgraph(graph_manager):
+    """Test the subgraph includes transfers between neighbours"""
+    # B is the centre; A and C are one hop away and also trade with each other
+    transactions = [
+        ("0x1", "TAddrA", "TAddrB", 1704067200, "100"),
+        ("0x2", "TAddrB", "TAddrC", 1704067260, "40"),
+        ("0x3", "TAddrC", "TAddrA", 1704067320, "10"),
+        ("0x4", "TAddrC", "TAddrD", 1704067380, "5"),
+    ]
+    for tx_hash, from_addr, to_addr, timestamp, amount in transactions:
+        graph_manager.add_transaction(
+            tx_hash=tx_hash,
+            from_address=from_addr,
+            to_address=to_addr,
+            amount=amount,
+            timestamp=timestamp,
+            block_number=12345,
+            contract="TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+        )
+
+    subgraph = graph_manager.get_subgraph("TAddrB", hops=1)
+    assert [(n["address"], n["hop"]) for n in subgraph["nodes"]] == [
+        ("TAddrB", 0), ("TAddrA", 1), ("TAddrC", 1)
+    ]
+    assert [(e["from"], e["to"]) for e in subgraph["edges"]] == [
+        ("TAddrA", "TAddrB"), ("TAddrB", "TAddrC"), ("TAddrC", "TAddrA")
+    ]
+    centre = subgraph["nodes"][0]
+    assert centre["received"] == "100"
+    assert centre["sent"] == "40"
+    assert centre["first_seen"] == 1704067200
+    assert centre["last_seen"] == 1704067260
+
+    assert len(graph_manager.get_subgraph("TAddrB", hops=2)["nodes"]) == 4
+    assert graph_manager.get_subgraph("TAddrB", hops=2, limit=2)["truncated"] is True
+    assert graph_manager.get_subgraph("TUnknown")["nodes"] == []
+
+
+def test_get_degree_ranking(graph_manager):
+    """Test ranking addresses by distinct counterparties"""
+    # A hub receives from three senders, one of which pays it twice
+    transactions = [
+        ("0x1", "TAddrA", "TAddrHub", 1704067200),
+        ("0x2", "TAddrB", "TAddrHub", 1704067260),
+        ("0x3", "TAddrC", "TAddrHub", 1704067320),
+        ("0x4", "TAddrC", "TAddrHub", 1704067380),
+        ("0x5", "TAddrHub", "TAddrD", 1704067440),
+    ]
+    for tx_hash, from_addr, to_addr, timestamp in transactions:
+        graph_manager.add_transaction(
+            tx_hash=tx_hash,
+            from_address=from_addr,
+            to_address=to_addr,
+            amount="100",
+            timestamp=timestamp,
+            block_number=12345,
+            contract="TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+        )
+
+    ranked = graph_manager.get_degree_ranking(direction="in", limit=2)
+    assert len(ranked) == 2
+    hub = ranked[0]
+    assert hub["address"] == "TAddrHub"
+    assert hub["in_degree"] == 3
+    assert hub["in_count"] == 4
+    assert hub["out_degree"] == 1
+    assert hub["received"] == "400"
+    assert hub["sent"] == "100"
+
+    assert graph_manager.get_degree_ranking(direction="out")[0]["address"] == "TAddrC"
+
+    # The window drops the first two senders
+    windowed = graph_manager.get_degree_ranking(start_time=1704067300, direction="in")
+    assert windowed[0]["in_degree"] == 1
+
+
+def test_get_address_activity(graph_manager):
+    """Test per-address activity summaries over a window"""
+    transactions = [
+        ("0x1", "TAddrA", "TAddrHub", 1704067200, True),
+        ("0x2", "TAddrA", "TAddrHub", 1704067260, True),
+        ("0x3", "TAddrB", "TAddrHub", 1704067320, False),
+        ("0x4", "TAddrHub", "TAddrC", 1704067380, True),
+    ]
+    for tx_hash, from_addr, to_addr, timestamp, confirmed in transactions:
+        graph_manager.add_transaction(
+            tx_hash=tx_hash,
+            from_address=from_addr,
+            to_address=to_addr,
+            amount="50",
+            timestamp=timestamp,
+            block_number=12345,
+            contract="TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t",
+            confirmed=confirmed
+        )
+
+    activity = {node["address"]: node for node in graph_manager.get_address_activity()}
+    assert sorted(activity) == ["TAddrA", "TAddrB", "TAddrC", "TAddrHub"]
+    hub = activity["TAddrHub"]
+    assert hub["in_degree"] == 2
+    assert hub["in_count"] == 3
+    assert hub["out_count"] == 1
+    assert hub["received"] == "150"
+    assert hub["unconfirmed_count"] == 1
+    assert hub["first_seen"] == 1704067200
+    assert hub["first_tx_hash"] == "0x1"
+    assert hub["last_seen"] == 1704067380
+
+    # Only the hub and TAddrA have at least two transactions
+    busy = graph_manager.get_address_activity(min_count=2)
+    assert [node["address"] for node in busy] == ["TAddrA", "TAddrHub"]
+
+    # The window keeps only the last two transfers
+    windowed = {node["address"]: node for node in graph_manager.get_address_activity(start_time=1704067300)}
+    assert windowed["TAddrHub"]["in_count"] == 1
+    assert windowed["TAddrHub"]["first_tx_hash"] == "0x3"
+    assert "TAddrA" not in windowed
+
+
+def test_get_pagerank(graph_manager):
+    """Test PageRank ranks the address everyone pays highest"""
+    transactions = [
+        ("0x1", "TAddrA", "TAddrHub", 1704067200),
+        ("0x2", "TAddrB", "TAddrHub", 1704067260),
+        ("0x3", "TAddrC", "TAddrHub", 1704067320),
+        ("0x4", "TAddrHub", "TAddrA", 1704067380),
+    ]
+    for tx_hash, from_addr, to_addr, timestamp in transactions:
+        graph_manager.add_transaction(
+            tx_hash=tx_hash,
+            from_address=from_addr,
+            to_address=to_addr,
+            amount="100",
+            timestamp=timestamp,
+            block_number=12345,
+            contract="TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+        )
+
+    ranked = graph_manager.get_pagerank()
+    assert [node["address"] for node in ranked[:2]] == ["TAddrHub", "TAddrA"]
+    assert sum(node["score"] for node in ranked) == pytest.approx(1.0)
+    assert len(graph_manager.get_pagerank(limit=1)) == 1
+    assert graph_manager.get_pagerank(start_time=1800000000) == []
+
+
+def test_get_communities(graph_manager):
+    """Test separate groups of addresses form separate communities"""
+    # A loop A -> B -> C -> A, and a chain P -> Q -> R -> S
+    transactions = [
+        ("0x1", "TAddrA", "TAddrB", 1704067200),
+        ("0x2", "TAddrB", "TAddrC", 1704067260),
+        ("0x3", "TAddrC", "TAddrA", 1704067320),
+        ("0x4", "TAddrP", "TAddrQ", 1704067200),
+        ("0x5", "TAddrQ", "TAddrR", 1704067260),
+        ("0x6", "TAddrR", "TAddrS", 1704067320),
+    ]
+    for tx_hash, from_addr, to_addr, timestamp in transactions:
+        graph_manager.add_transaction(
+            tx_hash=tx_hash,
+            from_address=from_addr,
+            to_address=to_addr,
+            amount="100",
+            timestamp=timestamp,
+            block_number=12345,
+            contract="TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+        )
+
+    communities = graph_manager.get_communities()
+    assert [c["members"] for c in communities] == [
+        ["TAddrP", "TAddrQ", "TAddrR", "TAddrS"],
+        ["TAddrA", "TAddrB", "TAddrC"],
+    ]
+    chain, loop = communities
+    assert chain["has_cycle"] is False
+    assert loop["has_cycle"] is True
+    assert loop["internal_count"] == 3
+    assert loop["internal_amount"] == "300"
+    assert loop["density"] == pytest.approx(0.5)
+    assert loop["first_seen"] == 1704067200
+    assert loop["last_seen"] == 1704067320
+
+    assert len(graph_manager.get_communities(min_size=4)) == 1
+    assert graph_manager.get_communities(start_time=1800000000) == []
+
+
 def test_get_transactions_in_window(graph_manager):
     """Test getting transactions in a time window"""
     # Add transactions with different timestamps
@@ -206,6 +513,143 @@ def test_get_transactions_in_window(graph_manager):
     assert len(txs) >= 2
 
 
+def test_query_transactions(graph_manager):
+    """Test filtering and paging transactions"""
+    transactions = [
+        ("0x1", "TAddr1", "TAddr2", "100", 1704067200),
+        ("0x2", "TAddr2", "TAddr3", "2500", 1704067260),
+        ("0x3", "TAddr3", "TAddr1", "50", 1704067320),
+        ("0x4", "TAddr1", "TAddr2", "900", 1704067380),
+    ]
+    for tx_hash, from_address, to_address, amount, timestamp in transactions:
+        graph_manager.add_transaction(
+            tx_hash=tx_hash,
+            from_address=from_address,
+            to_address=to_address,
+            amount=amount,
+            timestamp=timestamp,
+            block_number=12345,
+            contract="TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+        )
+    graph_manager.delete_transaction("0x3")
+
+    page = graph_manager.query_transactions()
+    assert page["total"] == 3
+    assert [tx["tx_hash"] for tx in page["transactions"]] == ["0x4", "0x2", "0x1"]
+
+    # Sent or received by an address
+    page = graph_manager.query_transactions(address="TAddr2")
+    assert [tx["tx_hash"] for tx in page["transactions"]] == ["0x4", "0x2", "0x1"]
+    page = graph_manager.query_transactions(address="TAddr3")
+    assert [tx["tx_hash"] for tx in page["transactions"]] == ["0x2"]
+
+    page = graph_manager.query_transactions(
+        start_time=1704067200, end_time=1704067380, min_amount=Decimal("100")
+    )
+    assert [tx["tx_hash"] for tx in page["transactions"]] == ["0x2", "0x1"]
+
+    page = graph_manager.query_transactions(max_amount=Decimal("1000"), limit=1, offset=1)
+    assert page["total"] == 2
+    assert [tx["tx_hash"] for tx in page["transactions"]] == ["0x1"]
+
+    assert graph_manager.query_transactions(address="TUnknown")["total"] == 0
+
+
+def test_get_transaction(graph_manager):
+    """Test looking up a transaction by hash"""
+    graph_manager.add_transaction(
+        tx_hash="0xlookup",
+        from_address="TFrom",
+        to_address="TTo",
+        amount="75.5",
+        timestamp=1704067200,
+        block_number=12345,
+        contract="TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t",
+        token="USDT"
+    )
+
+    tx = graph_manager.get_transaction("0xlookup")
+    assert tx["from"] == "TFrom"
+    assert tx["to"] == "TTo"
+    assert tx["amount"] == "75.5"
+    assert tx["token"] == "USDT"
+
+    assert graph_manager.get_transaction("0xmissing") is None
+    graph_manager.delete_transaction("0xlookup")
+    assert graph_manager.get_transaction("0xlookup") is None
+
+
+def test_edges_layered_by_token(graph_manager):
+    """Test each token's transfers are kept on a layer of their own"""
+    for tx_hash, token in [("0xusdt", "USDT"), ("0xusdc", "USDC"), ("0xlegacy", None)]:
+        graph_manager.add_transaction(
+            tx_hash=tx_hash,
+            from_address="TFrom",
+            to_address="TTo",
+            amount="100",
+            timestamp=1704067200,
+            block_number=12345,
+            contract="TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t",
+            token=token
+        )
+
+    assert {"usdt", "usdc"} <= set(graph_manager.graph.unique_layers)
+    assert graph_manager.graph.layer("usdc").count_temporal_edges() == 1
+    assert graph_manager.graph.layer("usdt").count_temporal_edges() == 2
+
+
+def test_delete_transaction(graph_manager):
+    """Test retracting a transaction reverted by a reorg"""
+    graph_manager.add_transaction(
+        tx_hash="0xreverted",
+        from_address="TFrom",
+        to_address="TTo",
+        amount="100",
+        timestamp=1704067200,
+        block_number=12345,
+        contract="TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+    )
+
+    assert graph_manager.delete_transaction("0xreverted") is True
+    # Retracting again is a no-op
+    assert graph_manager.delete_transaction("0xreverted") is False
+
+    txs = graph_manager.get_transactions_in_window(
+        start_time=1704067100,
+        end_time=1704067300,
+        limit=100
+    )
+    assert all(tx["tx_hash"] != "0xreverted" for tx in txs)
+
+
+def test_confirm_transaction(graph_manager):
+    """Test confirming a transaction added before the confirmation depth"""
+    graph_manager.add_transaction(
+        tx_hash="0xpending",
+        from_address="TFrom",
+        to_address="TTo",
+        amount="100",
+        timestamp=1704067200,
+        block_number=12345,
+        contract="TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t",
+        confirmed=False
+    )
+
+    def confirmed():
+        txs = graph_manager.get_transactions_in_window(
+            start_time=1704067100,
+            end_time=1704067300,
+            limit=100
+        )
+        return next(tx["confirmed"] for tx in txs if tx["tx_hash"] == "0xpending")
+
+    assert confirmed() is False
+    assert graph_manager.confirm_transaction("0xpending") is True
+    assert confirmed() is True
+    # Confirming again is a no-op
+    assert graph_manager.confirm_transaction("0xpending") is False
+
+
 def test_clear_graph(graph_manager):
     """Test clearing the graph"""
     # Add transaction
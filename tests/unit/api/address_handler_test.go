@@ -0,0 +1,276 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/enrichment"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupAddressRouter serves address profiles from the address fixtures
+func setupAddressRouter(t *testing.T, handler http.HandlerFunc) *gin.Engine {
+	db, client := setupAddressFixtures(t, handler)
+	addressHandler := handlers.NewAddressHandler(db, client, handlers.NewOutlierHandler(db, nil), nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/addresses/:address", addressHandler.GetAddressProfile)
+	return router
+}
+
+// setupAddressFixtures adds issuer events, watchlists and labels to the
+// outlier list fixtures, and starts a fake Raphtory service answering with
+// handler
+func setupAddressFixtures(t *testing.T, handler http.HandlerFunc) (*sql.DB, *graph.RaphtoryClient) {
+	_, db := setupOutlierListRouter(t)
+	_, err := db.Exec(`
+		CREATE TABLE issuer_events (
+			id TEXT PRIMARY KEY,
+			type TEXT NOT NULL,
+			address TEXT NOT NULL,
+			timestamp DATETIME NOT NULL
+		)
+	`)
+	require.NoError(t, err)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, row := range []struct{ eventType, address string }{
+		{"blacklisted", "TAddrB"},
+		{"blacklisted", "TAddrC"},
+		{"unblacklisted", "TAddrC"},
+	} {
+		_, err := db.Exec(`INSERT INTO issuer_events (id, type, address, timestamp) VALUES (?, ?, ?, ?)`,
+			i, row.eventType, row.address, start.Add(time.Duration(i)*time.Hour))
+		require.NoError(t, err)
+	}
+
+	createWatchlistTables(t, db)
+	_, err = db.Exec(`
+		INSERT INTO watchlists (id, name, created_at, updated_at) VALUES ('w1', 'exploits', ?, ?);
+		INSERT INTO watchlist_entries (id, watchlist_id, address, reason, added_at) VALUES ('e1', 'w1', 'TAddrW', 'Drainer', ?);
+	`, start, start, start)
+	require.NoError(t, err)
+
+	createAddressLabelTable(t, db)
+	_, err = db.Exec(`
+		INSERT INTO address_labels (address, label, category, updated_at) VALUES ('TAddrD', 'Sinbad', 'mixer', ?);
+		INSERT INTO address_labels (address, label, category, updated_at) VALUES ('TAddrL', 'Kraken deposit', 'exchange', ?);
+	`, start, start)
+	require.NoError(t, err)
+
+	raphtory := httptest.NewServer(handler)
+	t.Cleanup(raphtory.Close)
+
+	return db, graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: raphtory.URL}, nil)
+}
+
+func TestAddressHandler_GetAddressProfile(t *testing.T) {
+	router := setupAddressRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/graph/node/TAddrA":
+			w.Write([]byte(`{"address": "TAddrA", "first_seen": 1704067200, "last_seen": 1704070800,
+				"transaction_count": 6, "sent_count": 4, "received_count": 2, "total_sent": 800, "total_received": 300,
+				"properties": {"label": "Exchange X", "watchlist": "sanctions"}}`))
+		case "/graph/neighbors/TAddrA":
+			assert.Equal(t, "1", r.URL.Query().Get("hops"))
+			w.Write([]byte(`{"address": "TAddrA", "hops": 1, "truncated": true, "counterparties": [
+				{"address": "TAddrE", "hop": 1, "sent_count": 1, "received_count": 0, "sent": "100", "received": "0"},
+				{"address": "TAddrB", "hop": 1, "sent_count": 3, "received_count": 0, "sent": "700", "received": "0"},
+				{"address": "TAddrD", "hop": 1, "sent_count": 0, "received_count": 2, "sent": "0", "received": "300"}
+			]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/addresses/TAddrA?counterparties=2", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp internalapi.AddressProfileResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.GraphAvailable)
+	assert.Equal(t, 6, resp.TransactionCount)
+	require.NotNil(t, resp.FirstSeen)
+	assert.Equal(t, int64(1704067200), resp.FirstSeen.Unix())
+	assert.Equal(t, "Exchange X", resp.Label)
+	assert.True(t, resp.Watchlist.Watchlisted)
+	assert.Equal(t, "sanctions", resp.Watchlist.Watchlist)
+	assert.False(t, resp.Watchlist.Blacklisted)
+
+	// Risk comes from the most severe of o1 (low) and o4 (medium)
+	assert.Equal(t, 2, resp.OutlierCount)
+	assert.Equal(t, models.SeverityMedium, resp.MaxSeverity)
+	assert.Equal(t, 0.5, resp.RiskScore)
+	require.Len(t, resp.RecentOutliers, 2)
+	assert.Equal(t, "o4", resp.RecentOutliers[0].ID)
+
+	// Busiest counterparties first, with their own risk
+	assert.True(t, resp.CounterpartiesTruncated)
+	require.Len(t, resp.Counterparties, 2)
+	assert.Equal(t, "TAddrB", resp.Counterparties[0].Address)
+	assert.Equal(t, 3, resp.Counterparties[0].TransactionCount)
+	assert.Equal(t, models.SeverityCritical, resp.Counterparties[0].MaxSeverity)
+	assert.Equal(t, "TAddrD", resp.Counterparties[1].Address)
+	assert.Equal(t, 0.75, resp.Counterparties[1].RiskScore)
+	assert.Equal(t, "Sinbad", resp.Counterparties[1].Label)
+	assert.Equal(t, models.LabelCategoryMixer, resp.Counterparties[1].Category)
+	assert.Empty(t, resp.Counterparties[0].Label)
+	assert.Nil(t, resp.Entity)
+}
+
+func TestAddressHandler_GetAddressProfile_Blacklist(t *testing.T) {
+	router := setupAddressRouter(t, http.NotFound)
+
+	// Raphtory has not seen TAddrB, but it has an outlier and is blacklisted
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/addresses/TAddrB", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp internalapi.AddressProfileResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Watchlist.Blacklisted)
+	require.NotNil(t, resp.Watchlist.BlacklistedAt)
+	assert.Empty(t, resp.Counterparties)
+
+	// TAddrC was blacklisted and then removed
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/addresses/TAddrC", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.Watchlist.Blacklisted)
+
+	// TAddrW has never transacted, but is on a watchlist
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/addresses/TAddrW", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Watchlist.Watchlisted)
+	require.Len(t, resp.Watchlist.Entries, 1)
+	assert.Equal(t, "exploits", resp.Watchlist.Entries[0].WatchlistName)
+
+	// TAddrL has never transacted, but is a known entity
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/addresses/TAddrL", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Kraken deposit", resp.Label)
+	require.NotNil(t, resp.Entity)
+	assert.Equal(t, models.LabelCategoryExchange, resp.Entity.Category)
+
+	// Nothing has seen TAddrZ
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/addresses/TAddrZ", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAddressHandler_GetAddressProfile_ETag(t *testing.T) {
+	db, client := setupAddressFixtures(t, http.NotFound)
+	addressHandler := handlers.NewAddressHandler(db, client, handlers.NewOutlierHandler(db, nil), nil)
+	router := gin.New()
+	router.GET("/addresses/:address", addressHandler.GetAddressProfile)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/addresses/TAddrB", nil)
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	w = get(etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	// Unblacklisting the address changes its profile
+	_, err := db.Exec(`INSERT INTO issuer_events (id, type, address, timestamp) VALUES ('9', 'unblacklisted', 'TAddrB', ?)`,
+		time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	w = get(etag)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
+
+func TestAddressHandler_GetAddressProfile_RaphtoryUnavailable(t *testing.T) {
+	router := setupAddressRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	// The database half of the profile is still returned
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/addresses/TAddrZ", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp internalapi.AddressProfileResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.GraphAvailable)
+	assert.Empty(t, resp.RecentOutliers)
+}
+
+func TestAddressHandler_GetAddressProfile_ExternalRisk(t *testing.T) {
+	db, client := setupAddressFixtures(t, http.NotFound)
+	_, err := db.Exec(`
+		CREATE TABLE address_screenings (
+			address TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			category TEXT NOT NULL DEFAULT '',
+			risk TEXT NOT NULL DEFAULT '',
+			entity TEXT NOT NULL DEFAULT '',
+			screened_at DATETIME NOT NULL,
+			PRIMARY KEY (address, provider)
+		)
+	`)
+	require.NoError(t, err)
+	screenings := enrichment.NewStore(db)
+	at := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, screenings.Save(context.Background(), models.AddressScreening{
+		Address: "TAddrS", Provider: "trm", Category: "gambling", Risk: "Medium", ScreenedAt: at,
+	}))
+	require.NoError(t, screenings.Save(context.Background(), models.AddressScreening{
+		Address: "TAddrS", Provider: "chainalysis", Category: "sanctions", Risk: "Severe", Entity: "Garantex",
+		ScreenedAt: at.Add(time.Hour),
+	}))
+
+	addressHandler := handlers.NewAddressHandler(db, client, handlers.NewOutlierHandler(db, nil), nil)
+	addressHandler.SetScreenings(screenings)
+	router := gin.New()
+	router.GET("/addresses/:address", addressHandler.GetAddressProfile)
+
+	// Known only to the providers, so still found, with the newest screening
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/addresses/TAddrS", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp internalapi.AddressProfileResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.NotNil(t, resp.ExternalRisk)
+	assert.Equal(t, "chainalysis", resp.ExternalRisk.Provider)
+	assert.Equal(t, "sanctions", resp.ExternalRisk.Category)
+	assert.Equal(t, "Severe", resp.ExternalRisk.Risk)
+	assert.Equal(t, "Garantex", resp.ExternalRisk.Entity)
+
+	// Unscreened addresses have none
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/addresses/TAddrB", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	resp = internalapi.AddressProfileResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Nil(t, resp.ExternalRisk)
+}
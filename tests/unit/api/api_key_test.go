@@ -0,0 +1,277 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAPIKeyRouter(db *sql.DB) *gin.Engine {
+	handler := handlers.NewAPIKeyHandler(db, security.NewRoleStore(db, security.RoleStoreConfig{}, nil), nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", "admin-id") })
+	router.GET("/api-keys", handler.ListAPIKeys)
+	router.POST("/api-keys", handler.CreateAPIKey)
+	router.GET("/api-keys/:id", handler.GetAPIKey)
+	router.PUT("/api-keys/:id", handler.UpdateAPIKey)
+	router.DELETE("/api-keys/:id", handler.DeleteAPIKey)
+	return router
+}
+
+// setupAPIKeyProtectedRouter serves routes guarded the way cmd/api guards
+// them, authenticating with JWTs or API keys
+func setupAPIKeyProtectedRouter(db *sql.DB) *gin.Engine {
+	auth := middleware.NewAuthMiddleware(setupTestJWTManager(), nil)
+	auth.SetAPIKeys(security.NewAPIKeyManager(db, security.APIKeyConfig{DefaultRateLimit: 3}, nil))
+	rbac := middleware.NewRBACMiddleware(nil)
+	ok := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": middleware.GetUserID(c)})
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	protected := router.Group("/", auth.Authenticate())
+	protected.GET("/outliers", rbac.RequirePermission(middleware.PermissionReadOutliers), ok)
+	protected.POST("/outliers/:id/acknowledge", rbac.RequirePermission(middleware.PermissionWriteOutliers), ok)
+	protected.GET("/users", rbac.RequireAdmin(), ok)
+	return router
+}
+
+func createAPIKey(t *testing.T, router *gin.Engine, body map[string]interface{}) internalapi.CreateAPIKeyResponse {
+	w := doJSON(router, "POST", "/api-keys", body)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created internalapi.CreateAPIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	return created
+}
+
+func withAPIKey(router *gin.Engine, method, path, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set(middleware.APIKeyHeader, key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIKeyHandler_CreateAndList(t *testing.T) {
+	db := setupUsersDB(t)
+	router := setupAPIKeyRouter(db)
+
+	created := createAPIKey(t, router, map[string]interface{}{
+		"name": "siem-export", "scopes": []string{"read:outliers"}, "rate_limit": 120,
+	})
+	assert.True(t, strings.HasPrefix(created.Key, security.APIKeyPrefix))
+	assert.True(t, strings.HasPrefix(created.Key, created.Prefix))
+	assert.Equal(t, "admin-id", created.UserID, "keys default to the caller")
+	assert.Equal(t, []string{"read:outliers"}, created.Scopes)
+	assert.Equal(t, 120, created.RateLimit)
+
+	// Only the hash is stored
+	var keyHash string
+	require.NoError(t, db.QueryRow(`SELECT key_hash FROM api_keys WHERE id = ?`, created.ID).Scan(&keyHash))
+	assert.Equal(t, security.HashAPIKey(created.Key), keyHash)
+
+	w := doJSON(router, "GET", "/api-keys", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Key)
+	var list internalapi.APIKeyListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.APIKeys, 1)
+	assert.Equal(t, "siem-export", list.APIKeys[0].Name)
+	assert.Equal(t, "admin", list.APIKeys[0].Username)
+
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/api-keys/missing", nil).Code)
+}
+
+func TestAPIKeyHandler_ScopesLimitedByOwnerRole(t *testing.T) {
+	router := setupAPIKeyRouter(setupUsersDB(t))
+
+	w := doJSON(router, "POST", "/api-keys", map[string]interface{}{
+		"name": "viewer-key", "user_id": "viewer-id", "scopes": []string{"write:outliers"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(router, "POST", "/api-keys", map[string]interface{}{
+		"name": "admin-key", "scopes": []string{"manage:users"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "keys never manage users")
+
+	w = doJSON(router, "POST", "/api-keys", map[string]interface{}{
+		"name": "orphan", "user_id": "missing", "scopes": []string{"read:outliers"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	created := createAPIKey(t, router, map[string]interface{}{
+		"name": "viewer-key", "user_id": "viewer-id", "scopes": []string{"read:outliers"},
+	})
+	w = doJSON(router, "PUT", "/api-keys/"+created.ID, map[string]interface{}{"scopes": []string{"write:outliers"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAPIKeyHandler_RefusesKeysBeyondCallerRole(t *testing.T) {
+	db := setupUsersDB(t)
+	_, err := db.Exec(`
+		INSERT INTO roles (name) VALUES ('user_manager');
+		INSERT INTO role_permissions (role, permission) VALUES
+			('user_manager', 'read:users'), ('user_manager', 'manage:users'), ('user_manager', 'read:outliers'),
+			('user_manager', 'read:transactions'), ('user_manager', 'read:statistics');
+		INSERT INTO users (id, username, password_hash, role) VALUES
+			('manager-id', 'manager', 'x', 'user_manager'),
+			('analyst-id', 'analyst', 'x', 'analyst');
+	`)
+	require.NoError(t, err)
+	admin := setupAPIKeyRouter(db)
+	analystKey := createAPIKey(t, admin, map[string]interface{}{
+		"name": "analyst-key", "user_id": "analyst-id", "scopes": []string{"read:outliers"},
+	})
+
+	handler := handlers.NewAPIKeyHandler(db, security.NewRoleStore(db, security.RoleStoreConfig{}, nil), nil)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", "manager-id") })
+	router.POST("/api-keys", handler.CreateAPIKey)
+	router.PUT("/api-keys/:id", handler.UpdateAPIKey)
+	router.DELETE("/api-keys/:id", handler.DeleteAPIKey)
+
+	// The manager cannot act as the analyst through a key, with or without
+	// scopes the manager lacks
+	w := doJSON(router, "POST", "/api-keys", map[string]interface{}{
+		"name": "analyst-write", "user_id": "analyst-id", "scopes": []string{"write:outliers"},
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	w = doJSON(router, "POST", "/api-keys", map[string]interface{}{
+		"name": "analyst-read", "user_id": "analyst-id", "scopes": []string{"read:outliers"},
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	// Nor change or revoke the analyst's keys
+	w = doJSON(router, "PUT", "/api-keys/"+analystKey.ID, map[string]interface{}{"scopes": []string{"trigger:detection"}})
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	w = doJSON(router, "DELETE", "/api-keys/"+analystKey.ID, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM api_keys WHERE user_id = 'analyst-id'`).Scan(&count))
+	assert.Equal(t, 1, count)
+	var scopes string
+	var active bool
+	require.NoError(t, db.QueryRow(`SELECT scopes, is_active FROM api_keys WHERE id = ?`, analystKey.ID).Scan(&scopes, &active))
+	assert.Equal(t, `["read:outliers"]`, scopes)
+	assert.True(t, active)
+
+	// Keys for users within the manager's own permissions are still fine
+	w = doJSON(router, "POST", "/api-keys", map[string]interface{}{
+		"name": "viewer-key", "user_id": "viewer-id", "scopes": []string{"read:outliers"},
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created internalapi.CreateAPIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	w = doJSON(router, "PUT", "/api-keys/"+created.ID, map[string]interface{}{"scopes": []string{"read:statistics"}})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestAPIKey_AuthenticatesWithinScopes(t *testing.T) {
+	db := setupUsersDB(t)
+	admin := setupAPIKeyRouter(db)
+	router := setupAPIKeyProtectedRouter(db)
+
+	created := createAPIKey(t, admin, map[string]interface{}{
+		"name": "reader", "scopes": []string{"read:outliers"}, "rate_limit": 10,
+	})
+
+	w := withAPIKey(router, "GET", "/outliers", created.Key)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "admin-id")
+
+	// Outside the key's scopes, and role-guarded routes, are refused even
+	// though the owner is an admin
+	assert.Equal(t, http.StatusForbidden, withAPIKey(router, "POST", "/outliers/1/acknowledge", created.Key).Code)
+	assert.Equal(t, http.StatusForbidden, withAPIKey(router, "GET", "/users", created.Key).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, withAPIKey(router, "GET", "/outliers", created.Key+"x").Code)
+
+	var lastUsed sql.NullTime
+	require.NoError(t, db.QueryRow(`SELECT last_used FROM api_keys WHERE id = ?`, created.ID).Scan(&lastUsed))
+	assert.True(t, lastUsed.Valid)
+
+	// Revoked keys stop working
+	require.Equal(t, http.StatusOK, doJSON(admin, "DELETE", "/api-keys/"+created.ID, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, withAPIKey(router, "GET", "/outliers", created.Key).Code)
+}
+
+func TestAPIKey_RejectsExpiredKeysAndInactiveOwners(t *testing.T) {
+	db := setupUsersDB(t)
+	admin := setupAPIKeyRouter(db)
+	router := setupAPIKeyProtectedRouter(db)
+
+	expiring := createAPIKey(t, admin, map[string]interface{}{
+		"name": "expiring", "scopes": []string{"read:outliers"}, "expires_at": time.Now().Add(time.Hour),
+	})
+	_, err := db.Exec(`UPDATE api_keys SET expires_at = ? WHERE id = ?`, time.Now().UTC().Add(-time.Minute), expiring.ID)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, withAPIKey(router, "GET", "/outliers", expiring.Key).Code)
+
+	viewerKey := createAPIKey(t, admin, map[string]interface{}{
+		"name": "viewer-key", "user_id": "viewer-id", "scopes": []string{"read:outliers"},
+	})
+	require.Equal(t, http.StatusOK, withAPIKey(router, "GET", "/outliers", viewerKey.Key).Code)
+	_, err = db.Exec(`UPDATE users SET is_active = false WHERE id = 'viewer-id'`)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, withAPIKey(router, "GET", "/outliers", viewerKey.Key).Code)
+}
+
+func TestAPIKey_RateLimit(t *testing.T) {
+	db := setupUsersDB(t)
+	admin := setupAPIKeyRouter(db)
+	router := setupAPIKeyProtectedRouter(db)
+
+	// The router's default limit is 3 requests a minute
+	created := createAPIKey(t, admin, map[string]interface{}{"name": "reader", "scopes": []string{"read:outliers"}})
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusOK, withAPIKey(router, "GET", "/outliers", created.Key).Code)
+	}
+
+	w := withAPIKey(router, "GET", "/outliers", created.Key)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// A key's own limit overrides the default
+	generous := createAPIKey(t, admin, map[string]interface{}{
+		"name": "bulk", "scopes": []string{"read:outliers"}, "rate_limit": 5,
+	})
+	for i := 0; i < 5; i++ {
+		require.Equal(t, http.StatusOK, withAPIKey(router, "GET", "/outliers", generous.Key).Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, withAPIKey(router, "GET", "/outliers", generous.Key).Code)
+}
+
+func TestRBAC_APIKeyScopeMustMatchOwnerRole(t *testing.T) {
+	// A key keeps only the scopes its owner's current role still grants
+	key := &models.APIKey{Role: models.RoleViewer, Scopes: []string{"read:outliers", "write:outliers"}}
+
+	rbac := middleware.NewRBACMiddleware(nil)
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Set(middleware.ContextKeyAPIKey, key)
+
+	assert.True(t, rbac.HasPermission(c, middleware.PermissionReadOutliers))
+	assert.False(t, rbac.HasPermission(c, middleware.PermissionWriteOutliers))
+	assert.False(t, rbac.HasPermission(c, middleware.PermissionReadStatistics))
+}
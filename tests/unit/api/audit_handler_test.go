@@ -0,0 +1,256 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/archive"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const auditTestKey = "test-audit-secret"
+
+// setupAuditDB creates an audit_logs table and writes entries through a
+// real AuditLogger, so they carry genuine signatures
+func setupAuditDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE audit_logs (
+			id TEXT PRIMARY KEY,
+			timestamp DATETIME NOT NULL,
+			user_id TEXT,
+			action TEXT NOT NULL,
+			resource TEXT,
+			status TEXT,
+			ip_address TEXT,
+			details TEXT,
+			signature TEXT NOT NULL,
+			sequence INTEGER UNIQUE,
+			prev_signature TEXT
+		);
+		CREATE TABLE audit_chain_head (id INTEGER PRIMARY KEY, sequence INTEGER NOT NULL, signature TEXT NOT NULL);
+		INSERT INTO audit_chain_head VALUES (1, 0, '');
+		CREATE TABLE audit_anchors (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			sequence INTEGER NOT NULL,
+			signature TEXT NOT NULL,
+			anchor_hash TEXT NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+		CREATE TABLE audit_archives (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			object_key TEXT NOT NULL UNIQUE,
+			records INTEGER NOT NULL,
+			first_sequence INTEGER NOT NULL DEFAULT 0,
+			last_sequence INTEGER NOT NULL DEFAULT 0,
+			last_signature TEXT NOT NULL DEFAULT '',
+			unchained_before DATETIME,
+			first_timestamp DATETIME NOT NULL,
+			last_timestamp DATETIME NOT NULL,
+			sha256 TEXT NOT NULL,
+			signature TEXT NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+	`)
+	require.NoError(t, err)
+
+	auditLogger := security.NewAuditLogger(db, security.AuditLoggerConfig{SecretKey: auditTestKey}, nil)
+	auditLogger.Log("admin-id", "login", "/api/v1/auth/login", "success", "10.0.0.1", nil)
+	auditLogger.Log("viewer-id", "login", "/api/v1/auth/login", "failure", "10.0.0.2", map[string]interface{}{"reason": "bad password"})
+	auditLogger.Log("admin-id", "update_user", "/api/v1/users/viewer-id", "success", "10.0.0.1", map[string]interface{}{"status_code": 200})
+	require.NoError(t, auditLogger.Close())
+
+	return db
+}
+
+func setupAuditRouter(db *sql.DB) *gin.Engine {
+	auditLogger := security.NewAuditLogger(db, security.AuditLoggerConfig{SecretKey: auditTestKey}, nil)
+	handler := handlers.NewAuditHandler(db, auditLogger, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/audit", handler.ListAuditLogs)
+	router.GET("/audit/export", handler.ExportAuditLogs)
+	router.GET("/audit/verify", handler.VerifyAuditChain)
+	return router
+}
+
+func listAudit(t *testing.T, router *gin.Engine, query string) internalapi.AuditLogListResponse {
+	w := doJSON(router, "GET", "/audit"+query, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var list internalapi.AuditLogListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	return list
+}
+
+func TestAuditHandler_ListVerifiesSignatures(t *testing.T) {
+	db := setupAuditDB(t)
+	router := setupAuditRouter(db)
+
+	list := listAudit(t, router, "")
+	require.Equal(t, 3, list.Total)
+	require.Len(t, list.Logs, 3)
+	for _, entry := range list.Logs {
+		assert.True(t, entry.SignatureValid, "stored entry %s verifies", entry.Action)
+	}
+	assert.Equal(t, "update_user", list.Logs[0].Action, "newest first")
+
+	// Tampered rows fail verification
+	_, err := db.Exec(`UPDATE audit_logs SET status = 'success' WHERE status = 'failure'`)
+	require.NoError(t, err)
+	list = listAudit(t, router, "?user_id=viewer-id")
+	require.Len(t, list.Logs, 1)
+	assert.False(t, list.Logs[0].SignatureValid)
+
+	// A different key verifies nothing
+	other := handlers.NewAuditHandler(db, security.NewAuditLogger(db, security.AuditLoggerConfig{SecretKey: "other"}, nil), nil)
+	gin.SetMode(gin.TestMode)
+	otherRouter := gin.New()
+	otherRouter.GET("/audit", other.ListAuditLogs)
+	for _, entry := range listAudit(t, otherRouter, "").Logs {
+		assert.False(t, entry.SignatureValid)
+	}
+}
+
+func TestAuditHandler_FiltersAndPagination(t *testing.T) {
+	router := setupAuditRouter(setupAuditDB(t))
+
+	assert.Equal(t, 2, listAudit(t, router, "?action=login").Total)
+	assert.Equal(t, 2, listAudit(t, router, "?user_id=admin-id").Total)
+	assert.Equal(t, 1, listAudit(t, router, "?action=login&status=failure").Total)
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	assert.Equal(t, 3, listAudit(t, router, "?from="+past+"&to="+future).Total)
+	assert.Equal(t, 0, listAudit(t, router, "?from="+future).Total)
+
+	page := listAudit(t, router, "?limit=2&page=2")
+	assert.Equal(t, 3, page.Total)
+	assert.Equal(t, 2, page.TotalPages)
+	assert.Len(t, page.Logs, 1)
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/audit?from=yesterday", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/audit?limit=5000", nil).Code)
+}
+
+func TestAuditHandler_Export(t *testing.T) {
+	router := setupAuditRouter(setupAuditDB(t))
+
+	w := doJSON(router, "GET", "/audit/export?format=csv&action=login", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "signature_valid", records[0][10])
+	assert.Equal(t, "admin-id", records[1][2], "oldest first")
+	assert.Equal(t, "1", records[1][9])
+	assert.Equal(t, "true", records[1][10])
+	assert.Equal(t, `{"reason":"bad password"}`, records[2][7])
+
+	w = doJSON(router, "GET", "/audit/export", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var entries []internalapi.AuditLogEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.Len(t, entries, 3)
+	assert.True(t, entries[2].SignatureValid)
+
+	w = doJSON(router, "GET", "/audit/export?user_id=nobody", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	assert.Empty(t, entries)
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/audit/export?format=xml", nil).Code)
+}
+
+func TestAuditHandler_ListStream(t *testing.T) {
+	router := setupAuditRouter(setupAuditDB(t))
+
+	req := httptest.NewRequest("GET", "/audit?user_id=admin-id&limit=1", nil)
+	req.Header.Set("Accept", "application/x-ndjson; q=1.0")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 2, "every match, ignoring limit")
+	var entry internalapi.AuditLogEntry
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "update_user", entry.Action, "newest first")
+	assert.True(t, entry.SignatureValid)
+
+	w = doJSON(router, "GET", "/audit?stream=true&user_id=nobody", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestAuditHandler_VerifyChain(t *testing.T) {
+	db := setupAuditDB(t)
+	router := setupAuditRouter(db)
+
+	w := doJSON(router, "GET", "/audit/verify", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var report security.ChainReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.True(t, report.Valid)
+	assert.Equal(t, int64(3), report.Records)
+
+	_, err := db.Exec(`DELETE FROM audit_logs WHERE sequence = 2`)
+	require.NoError(t, err)
+	w = doJSON(router, "GET", "/audit/verify", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.False(t, report.Valid)
+	require.NotEmpty(t, report.Problems)
+	assert.Equal(t, int64(3), report.Problems[0].Sequence)
+}
+
+func TestAuditHandler_Archive(t *testing.T) {
+	db := setupAuditDB(t)
+	auditLogger := security.NewAuditLogger(db, security.AuditLoggerConfig{SecretKey: auditTestKey}, nil)
+	handler := handlers.NewAuditHandler(db, auditLogger, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/audit/archive", handler.ArchiveAuditLogs)
+	router.GET("/audit/archives", handler.ListAuditArchives)
+	router.GET("/audit/verify", handler.VerifyAuditChain)
+
+	assert.Equal(t, http.StatusConflict, doJSON(router, "POST", "/audit/archive", nil).Code, "retention is not configured")
+
+	handler.SetArchiver(security.NewAuditArchiver(db, archive.NewFileStore(t.TempDir()), auditLogger, security.AuditArchiverConfig{}, nil))
+	w := doJSON(router, "POST", "/audit/archive", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var archived internalapi.AuditArchiveListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &archived))
+	require.Equal(t, 1, archived.Total)
+	assert.Equal(t, 3, archived.Archives[0].Records)
+
+	w = doJSON(router, "GET", "/audit/archives", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var listed internalapi.AuditArchiveListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	assert.Equal(t, archived.Archives[0].Key, listed.Archives[0].Key)
+
+	var report security.ChainReport
+	require.NoError(t, json.Unmarshal(doJSON(router, "GET", "/audit/verify", nil).Body.Bytes(), &report))
+	assert.True(t, report.Valid, "%+v", report.Problems)
+	assert.Equal(t, int64(3), report.Archived)
+}
@@ -31,6 +31,7 @@ func setupTestDB(t *testing.T) *sql.DB {
 	_, err = db.Exec(`
 		CREATE TABLE users (
 			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001',
 			username TEXT UNIQUE NOT NULL,
 			email TEXT,
 			password_hash TEXT NOT NULL,
@@ -38,7 +39,8 @@ func setupTestDB(t *testing.T) *sql.DB {
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			last_login DATETIME,
-			is_active INTEGER DEFAULT 1
+			is_active INTEGER DEFAULT 1,
+			password_changed_at DATETIME
 		)
 	`)
 	require.NoError(t, err)
@@ -65,12 +67,19 @@ func setupTestJWTManager() *security.JWTManager {
 	})
 }
 
+func setupTestPasswordManager() *security.PasswordManager {
+	return security.NewPasswordManager(security.PasswordConfig{
+		MinLength: 8,
+		HashCost:  bcrypt.MinCost,
+	})
+}
+
 func TestAuthHandler_Login_Success(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
 	jwtManager := setupTestJWTManager()
-	handler := handlers.NewAuthHandler(db, jwtManager, nil)
+	handler := handlers.NewAuthHandler(db, jwtManager, setupTestPasswordManager(), nil)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -107,7 +116,7 @@ func TestAuthHandler_Login_InvalidCredentials(t *testing.T) {
 	defer db.Close()
 
 	jwtManager := setupTestJWTManager()
-	handler := handlers.NewAuthHandler(db, jwtManager, nil)
+	handler := handlers.NewAuthHandler(db, jwtManager, setupTestPasswordManager(), nil)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -149,7 +158,7 @@ func TestAuthHandler_GetProfile_Success(t *testing.T) {
 	defer db.Close()
 
 	jwtManager := setupTestJWTManager()
-	handler := handlers.NewAuthHandler(db, jwtManager, nil)
+	handler := handlers.NewAuthHandler(db, jwtManager, setupTestPasswordManager(), nil)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -181,7 +190,7 @@ func TestAuthHandler_RefreshToken_Success(t *testing.T) {
 	defer db.Close()
 
 	jwtManager := setupTestJWTManager()
-	handler := handlers.NewAuthHandler(db, jwtManager, nil)
+	handler := handlers.NewAuthHandler(db, jwtManager, setupTestPasswordManager(), nil)
 
 	// First, create a refresh token
 	user := &models.User{
@@ -222,7 +231,7 @@ func TestAuthHandler_RefreshToken_InvalidToken(t *testing.T) {
 	defer db.Close()
 
 	jwtManager := setupTestJWTManager()
-	handler := handlers.NewAuthHandler(db, jwtManager, nil)
+	handler := handlers.NewAuthHandler(db, jwtManager, setupTestPasswordManager(), nil)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
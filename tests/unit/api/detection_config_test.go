@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupDetectionConfigRouter(t *testing.T) (*gin.Engine, *detection.AnomalyDetector) {
+	db := setupUsersDB(t)
+	_, err := db.Exec(`
+		CREATE TABLE detection_config (
+			id INTEGER PRIMARY KEY,
+			settings TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			updated_by TEXT NOT NULL DEFAULT '',
+			updated_at DATETIME NOT NULL
+		)
+	`)
+	require.NoError(t, err)
+
+	detector := detection.NewAnomalyDetector(detection.AnomalyDetectorConfig{
+		Interval:      time.Minute,
+		ZScoreConfig:  detection.ZScoreConfig{Threshold: 3, MinDataPoints: 10, WindowDuration: 24 * time.Hour},
+		IQRConfig:     detection.IQRConfig{Multiplier: 1.5, MinDataPoints: 10, WindowDuration: 24 * time.Hour},
+		DBSCANEnabled: true,
+		DBSCANConfig:  detection.DBSCANConfig{Epsilon: 0.5, MinPoints: 5},
+		PatternDetectorConfig: detection.PatternDetectorConfig{
+			CirculationWindow: time.Hour,
+			FanOutThreshold:   50,
+			FanInThreshold:    50,
+			VelocityWindow:    time.Hour,
+			VelocityThreshold: 100,
+			ClusterWindow:     24 * time.Hour,
+			ClusterMinSize:    3,
+			ClusterMinDensity: 0.3,
+			FanWindow:         24 * time.Hour,
+		},
+	}, nil, nil)
+
+	handler := handlers.NewDetectionHandler(db, nil, nil, nil)
+	handler.SetSettingsStore(detection.NewSettingsStore(db, nil), detector)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "admin-1")
+		c.Next()
+	})
+	router.GET("/detection/config", handler.GetDetectionConfig)
+	router.PUT("/detection/config", handler.UpdateDetectionConfig)
+	return router, detector
+}
+
+func TestDetectionHandler_DetectionConfig(t *testing.T) {
+	router, detector := setupDetectionConfigRouter(t)
+
+	// Until saved the file configuration is reported
+	w := doJSON(router, "GET", "/detection/config", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var config internalapi.DetectionConfigResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &config))
+	assert.Equal(t, "file", config.Source)
+	assert.Equal(t, 3.0, config.ZScoreThreshold)
+	assert.Equal(t, "24h0m0s", config.WindowDuration)
+	assert.True(t, config.Enabled[models.OutlierTypeDBSCAN])
+	assert.Len(t, config.Enabled, len(detection.ConfigurableDetectors))
+
+	// Omitted fields and detectors keep their values
+	w = doJSON(router, "PUT", "/detection/config", map[string]interface{}{
+		"zscore_threshold": 4.5,
+		"velocity_window":  "30m",
+		"enabled":          map[string]bool{"dbscan": false},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	config = internalapi.DetectionConfigResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &config))
+	assert.Equal(t, "database", config.Source)
+	assert.Equal(t, 1, config.Version)
+	assert.Equal(t, "admin-1", config.UpdatedBy)
+	assert.Equal(t, 4.5, config.ZScoreThreshold)
+	assert.Equal(t, "30m0s", config.VelocityWindow)
+	assert.Equal(t, 1.5, config.IQRMultiplier)
+	assert.False(t, config.Enabled[models.OutlierTypeDBSCAN])
+	assert.True(t, config.Enabled[models.OutlierTypeZScore])
+
+	// Applied to the running detector without a restart
+	settings := detector.Settings()
+	assert.Equal(t, 4.5, settings.ZScoreThreshold)
+	assert.Equal(t, 30*time.Minute, settings.VelocityWindow)
+	assert.False(t, settings.Enabled[models.OutlierTypeDBSCAN])
+
+	w = doJSON(router, "GET", "/detection/config", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	config = internalapi.DetectionConfigResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &config))
+	assert.Equal(t, 1, config.Version)
+	assert.Equal(t, 4.5, config.ZScoreThreshold)
+
+	for _, body := range []map[string]interface{}{
+		{"zscore_threshold": -1},
+		{"cluster_min_density": 1.5},
+		{"fan_window": "a day"},
+		{"enabled": map[string]bool{"pattern_sanctions": false}},
+		{"zscore_treshold": 4},
+	} {
+		w = doJSON(router, "PUT", "/detection/config", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+	assert.Equal(t, 4.5, detector.Settings().ZScoreThreshold)
+}
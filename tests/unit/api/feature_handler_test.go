@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/features"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupFeatureRouter(t *testing.T) (*gin.Engine, *features.Flags) {
+	db := setupUsersDB(t)
+	_, err := db.Exec(`
+		CREATE TABLE feature_flags (
+			name TEXT PRIMARY KEY,
+			enabled BOOLEAN NOT NULL,
+			environments TEXT NOT NULL DEFAULT '{}',
+			updated_by TEXT NOT NULL DEFAULT '',
+			updated_at DATETIME NOT NULL
+		)
+	`)
+	require.NoError(t, err)
+
+	flags := features.New(db, features.Config{Environment: "staging"}, nil)
+	handler := handlers.NewFeatureHandler(flags, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "admin-1")
+		c.Next()
+	})
+	router.GET("/features", handler.ListFeatures)
+	router.GET("/features/:name", handler.GetFeature)
+	router.PUT("/features/:name", handler.SetFeature)
+	router.DELETE("/features/:name", handler.ResetFeature)
+	return router, flags
+}
+
+func TestFeatureHandler_Features(t *testing.T) {
+	router, flags := setupFeatureRouter(t)
+
+	w := doJSON(router, "GET", "/features", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list internalapi.FeatureFlagListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, "staging", list.Environment)
+	assert.Len(t, list.Flags, len(features.Known))
+
+	// Off everywhere but staging
+	w = doJSON(router, "PUT", "/features/"+features.IQRStreaming, map[string]interface{}{
+		"enabled":      false,
+		"environments": map[string]bool{"staging": true},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var flag models.FeatureFlag
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &flag))
+	assert.False(t, flag.Enabled)
+	assert.True(t, flag.Active)
+	assert.Equal(t, "admin-1", flag.UpdatedBy)
+
+	w = doJSON(router, "PUT", "/features/"+features.DBSCANDetector, map[string]interface{}{"enabled": false})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, flags.Enabled(features.DBSCANDetector))
+
+	w = doJSON(router, "GET", "/features/"+features.DBSCANDetector, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	flag = models.FeatureFlag{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &flag))
+	assert.Equal(t, features.SourceDatabase, flag.Source)
+	assert.False(t, flag.Active)
+
+	w = doJSON(router, "DELETE", "/features/"+features.DBSCANDetector, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, flags.Enabled(features.DBSCANDetector))
+
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/features/no_such_flag", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "PUT", "/features/no_such_flag", map[string]interface{}{"enabled": true}).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "DELETE", "/features/no_such_flag", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "PUT", "/features/"+features.IQRStreaming, map[string]interface{}{}).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "PUT", "/features/"+features.IQRStreaming, map[string]interface{}{
+		"enabled":      true,
+		"environments": map[string]bool{" ": true},
+	}).Code)
+}
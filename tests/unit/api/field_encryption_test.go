@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/security/crypto"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestCipher(t *testing.T) *crypto.Cipher {
+	cipher, err := crypto.NewCipher(crypto.CipherConfig{Key: "test-encryption-key", IndexKey: "test-index-key"})
+	require.NoError(t, err)
+	return cipher
+}
+
+func TestUserHandler_EncryptsEmail(t *testing.T) {
+	db := setupUsersDB(t)
+	cipher := setupTestCipher(t)
+	handler := handlers.NewUserHandler(db, setupTestPasswordManager(), nil)
+	handler.SetCipher(cipher)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", "admin-id") })
+	router.GET("/users", handler.ListUsers)
+	router.POST("/users", handler.CreateUser)
+	router.PUT("/users/:id", handler.UpdateUser)
+
+	w := doJSON(router, "POST", "/users", map[string]string{
+		"username": "analyst1", "email": "analyst1@example.com", "password": "s3cret-pass", "role": "analyst",
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "analyst1@example.com", created.Email)
+
+	var stored, storedHash string
+	require.NoError(t, db.QueryRow(`SELECT email, email_hash FROM users WHERE id = ?`, created.ID).Scan(&stored, &storedHash))
+	assert.True(t, crypto.IsEncrypted(stored))
+	assert.Equal(t, cipher.BlindIndex("analyst1@example.com"), storedHash)
+
+	// Ciphertexts differ, so uniqueness rests on the blind index
+	w = doJSON(router, "POST", "/users", map[string]string{
+		"username": "analyst2", "email": "Analyst1@Example.com", "password": "s3cret-pass", "role": "analyst",
+	})
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+
+	w = doJSON(router, "PUT", "/users/"+created.ID, map[string]string{"email": "renamed@example.com"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, db.QueryRow(`SELECT email, email_hash FROM users WHERE id = ?`, created.ID).Scan(&stored, &storedHash))
+	assert.True(t, crypto.IsEncrypted(stored))
+	assert.Equal(t, cipher.BlindIndex("renamed@example.com"), storedHash)
+
+	// Plaintext written before encryption reads back alongside encrypted emails
+	w = doJSON(router, "GET", "/users", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"admin@example.com"`)
+	assert.Contains(t, w.Body.String(), `"renamed@example.com"`)
+	assert.NotContains(t, w.Body.String(), "enc:v1:")
+}
+
+func TestOutlierHandler_EncryptsNotes(t *testing.T) {
+	_, db := setupOutlierListRouter(t)
+
+	handler := handlers.NewOutlierHandler(db, nil)
+	handler.SetCipher(setupTestCipher(t))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", "admin-id") })
+	router.GET("/outliers/:id", handler.GetOutlier)
+	router.POST("/outliers/:id/acknowledge", handler.AcknowledgeOutlier)
+
+	w := doJSON(router, "POST", "/outliers/o1/acknowledge", map[string]string{"notes": "linked to known mixer"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var stored string
+	require.NoError(t, db.QueryRow(`SELECT notes FROM outlier_triage WHERE outlier_id = 'o1'`).Scan(&stored))
+	assert.True(t, crypto.IsEncrypted(stored))
+	assert.NotContains(t, stored, "mixer")
+
+	w = doJSON(router, "GET", "/outliers/o1", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var outlier models.Outlier
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &outlier))
+	assert.Equal(t, "linked to known mixer", outlier.Notes)
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupOutliersDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE outliers (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001',
+			address TEXT NOT NULL,
+			severity TEXT NOT NULL,
+			invalidated BOOLEAN NOT NULL DEFAULT false
+		)
+	`)
+	require.NoError(t, err)
+
+	_, err = db.Exec(`
+		INSERT INTO outliers (id, address, severity, invalidated) VALUES
+			('1', 'TAddrA', 'medium', false),
+			('2', 'TAddrA', 'high', false),
+			('3', 'TAddrA', 'critical', true),
+			('4', 'TOther', 'critical', false)
+	`)
+	require.NoError(t, err)
+	return db
+}
+
+func TestGraphHandler_GetSubgraph(t *testing.T) {
+	raphtory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/graph/subgraph/TAddrB", r.URL.Path)
+		assert.Equal(t, "2", r.URL.Query().Get("hops"))
+		assert.Equal(t, "1704067200", r.URL.Query().Get("start"))
+		w.Write([]byte(`{
+			"address": "TAddrB", "hops": 2, "truncated": false,
+			"nodes": [
+				{"address": "TAddrB", "hop": 0, "transaction_count": 2, "sent": "0", "received": "150",
+				 "first_seen": 1704067200, "last_seen": 1704067260},
+				{"address": "TAddrA", "hop": 1, "transaction_count": 2, "sent": "150", "received": "0",
+				 "first_seen": 1704067200, "last_seen": 1704067260}
+			],
+			"edges": [
+				{"from": "TAddrA", "to": "TAddrB", "transaction_count": 2, "amount": "150",
+				 "first_seen": 1704067200, "last_seen": 1704067260}
+			]
+		}`))
+	}))
+	defer raphtory.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: raphtory.URL}, nil)
+	handler := handlers.NewGraphHandler(setupOutliersDB(t), client, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/graph/subgraph", handler.GetSubgraph)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/graph/subgraph?address=TAddrB&from=2024-01-01T00:00:00Z", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp internalapi.SubgraphResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Hops)
+	require.Len(t, resp.Nodes, 2)
+
+	centre, neighbour := resp.Nodes[0], resp.Nodes[1]
+	assert.Equal(t, "TAddrB", centre.ID)
+	assert.Zero(t, centre.RiskScore)
+	assert.Equal(t, 0, centre.OutlierCount)
+
+	// The invalidated critical outlier does not count
+	assert.Equal(t, 2, neighbour.OutlierCount)
+	assert.Equal(t, models.SeverityHigh, neighbour.MaxSeverity)
+	assert.Equal(t, 0.75, neighbour.RiskScore)
+	require.NotNil(t, neighbour.LastSeen)
+	assert.Equal(t, int64(1704067260), neighbour.LastSeen.Unix())
+
+	require.Len(t, resp.Edges, 1)
+	edge := resp.Edges[0]
+	assert.Equal(t, "TAddrA", edge.Source)
+	assert.Equal(t, "TAddrB", edge.Target)
+	assert.True(t, decimal.NewFromInt(150).Equal(edge.Amount))
+}
+
+func TestGraphHandler_GetSubgraph_InvalidParameters(t *testing.T) {
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: "http://127.0.0.1:0"}, nil)
+	handler := handlers.NewGraphHandler(setupOutliersDB(t), client, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/graph/subgraph", handler.GetSubgraph)
+
+	for _, query := range []string{
+		"",
+		"?address=TAddrB&hops=4",
+		"?address=TAddrB&from=2024-02-01T00:00:00Z&to=2024-01-01T00:00:00Z",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/graph/subgraph"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestGraphHandler_GetSubgraph_RaphtoryUnavailable(t *testing.T) {
+	raphtory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer raphtory.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: raphtory.URL}, nil)
+	handler := handlers.NewGraphHandler(setupOutliersDB(t), client, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/graph/subgraph", handler.GetSubgraph)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/graph/subgraph?address=TAddrB", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// graphQLRaphtory answers for the graph behind the GraphQL tests: the
+// transaction 0xabc from TAddrA to TAddrD, TAddrA's node and neighbors, and
+// a page of transactions
+func graphQLRaphtory(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/graph/transaction/0xabc":
+		w.Write([]byte(`{"tx_hash": "0xabc", "from": "TAddrA", "to": "TAddrD", "amount": "500", "block_number": 7, "timestamp": 1704067300, "confirmed": true}`))
+	case "/graph/transactions":
+		w.Write([]byte(`{"total": 3, "transactions": [
+			{"tx_hash": "0x3", "from": "TAddrA", "to": "TAddrL", "amount": "250", "block_number": 9, "timestamp": 1704067300},
+			{"tx_hash": "0x2", "from": "TAddrD", "to": "TAddrA", "amount": "100", "block_number": 8, "timestamp": 1704067250}
+		]}`))
+	case "/graph/node/TAddrA":
+		w.Write([]byte(`{"address": "TAddrA", "first_seen": 1704067200, "last_seen": 1704070800,
+			"transaction_count": 6, "sent_count": 4, "received_count": 2, "total_sent": 800, "total_received": 300}`))
+	case "/graph/neighbors/TAddrA":
+		w.Write([]byte(`{"address": "TAddrA", "hops": 1, "counterparties": [
+			{"address": "TAddrD", "hop": 1, "sent_count": 0, "received_count": 2, "sent": "0", "received": "300"}
+		]}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// setupGraphQLRouter serves GraphQL over the address fixtures to callers
+// authenticated by auth
+func setupGraphQLRouter(t *testing.T, raphtory http.HandlerFunc, auth gin.HandlerFunc) (*gin.Engine, *handlers.GraphQLHandler) {
+	db, client := setupAddressFixtures(t, raphtory)
+	_, err := db.Exec(`UPDATE outliers SET transaction_hash = '0xabc' WHERE id = 'o1'`)
+	require.NoError(t, err)
+
+	handler := handlers.NewGraphQLHandler(db, client, handlers.NewOutlierHandler(db, nil), middleware.NewRBACMiddleware(nil), nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(auth)
+	router.POST("/graphql", handler.Query)
+	router.GET("/graphql/schema", handler.GetSchema)
+	return router, handler
+}
+
+// asRole authenticates requests as a user with role
+func asRole(role models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(middleware.ContextKeyUserID, "user-1")
+		c.Set(middleware.ContextKeyRole, string(role))
+	}
+}
+
+// graphQLResult is a GraphQL response as a client decodes it
+type graphQLResult struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message string        `json:"message"`
+		Path    []interface{} `json:"path"`
+	} `json:"errors"`
+}
+
+func postGraphQL(t *testing.T, router *gin.Engine, query string, variables map[string]interface{}) (int, graphQLResult) {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/graphql", bytes.NewReader(body)))
+
+	var result graphQLResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result), w.Body.String())
+	return w.Code, result
+}
+
+func TestGraphQLHandler_NestedOutlier(t *testing.T) {
+	router, _ := setupGraphQLRouter(t, graphQLRaphtory, asRole(models.RoleViewer))
+
+	code, result := postGraphQL(t, router, `
+		query Outlier($id: ID!) {
+			outlier(id: $id) {
+				id
+				severity
+				amount
+				transaction {
+					txHash
+					amount
+					toLabel { label category }
+					fromProfile(counterparties: 5) {
+						outlierCount
+						maxSeverity
+						counterparties { address label profile { outlierCount } }
+					}
+				}
+			}
+		}`, map[string]interface{}{"id": "o1"})
+	require.Equal(t, http.StatusOK, code)
+	require.Empty(t, result.Errors)
+
+	outlier := result.Data["outlier"].(map[string]interface{})
+	assert.Equal(t, "o1", outlier["id"])
+	assert.Equal(t, "low", outlier["severity"])
+	assert.Equal(t, "500", outlier["amount"])
+
+	tx := outlier["transaction"].(map[string]interface{})
+	assert.Equal(t, "0xabc", tx["txHash"])
+	assert.Equal(t, map[string]interface{}{"label": "Sinbad", "category": "mixer"}, tx["toLabel"])
+
+	profile := tx["fromProfile"].(map[string]interface{})
+	assert.Equal(t, 2.0, profile["outlierCount"])
+	assert.Equal(t, "medium", profile["maxSeverity"])
+	counterparties := profile["counterparties"].([]interface{})
+	require.Len(t, counterparties, 1)
+	counterparty := counterparties[0].(map[string]interface{})
+	assert.Equal(t, "TAddrD", counterparty["address"])
+	assert.Equal(t, "Sinbad", counterparty["label"])
+	assert.Equal(t, 1.0, counterparty["profile"].(map[string]interface{})["outlierCount"])
+}
+
+func TestGraphQLHandler_ListsAndStatistics(t *testing.T) {
+	router, _ := setupGraphQLRouter(t, graphQLRaphtory, asRole(models.RoleViewer))
+
+	code, result := postGraphQL(t, router, `{
+		critical: outliers(severity: [critical, high], sort: "-severity", limit: 1) {
+			total totalPages outliers { id severity }
+		}
+		transactions(address: "TAddrA", limit: 2) {
+			total totalPages transactions { txHash fromLabel { label } toLabel { label } }
+		}
+		statistics { totalOutliers outliersBySeverity { severity count } }
+	}`, nil)
+	require.Equal(t, http.StatusOK, code)
+	require.Empty(t, result.Errors)
+
+	critical := result.Data["critical"].(map[string]interface{})
+	assert.Equal(t, 3.0, critical["total"])
+	assert.Equal(t, 3.0, critical["totalPages"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"id": "o2", "severity": "critical"}}, critical["outliers"])
+
+	transactions := result.Data["transactions"].(map[string]interface{})
+	assert.Equal(t, 3.0, transactions["total"])
+	assert.Equal(t, 2.0, transactions["totalPages"])
+	first := transactions["transactions"].([]interface{})[0].(map[string]interface{})
+	assert.Nil(t, first["fromLabel"])
+	assert.Equal(t, map[string]interface{}{"label": "Kraken deposit"}, first["toLabel"])
+
+	statistics := result.Data["statistics"].(map[string]interface{})
+	assert.Equal(t, 5.0, statistics["totalOutliers"])
+	bySeverity := statistics["outliersBySeverity"].([]interface{})
+	require.Len(t, bySeverity, 4)
+	assert.Equal(t, map[string]interface{}{"severity": "critical", "count": 1.0}, bySeverity[0])
+}
+
+func TestGraphQLHandler_Permissions(t *testing.T) {
+	// A key scoped to outliers may not follow them to transactions
+	router, _ := setupGraphQLRouter(t, graphQLRaphtory, func(c *gin.Context) {
+		c.Set(middleware.ContextKeyAPIKey, &models.APIKey{
+			ID: "key-1", Role: models.RoleViewer, Scopes: []string{string(middleware.PermissionReadOutliers)}, IsActive: true,
+		})
+	})
+
+	code, result := postGraphQL(t, router, `{ outlier(id: "o1") { id transaction { txHash } } }`, nil)
+	require.Equal(t, http.StatusOK, code)
+	outlier := result.Data["outlier"].(map[string]interface{})
+	assert.Equal(t, "o1", outlier["id"])
+	assert.Nil(t, outlier["transaction"])
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "permission denied: transaction requires the read:transactions permission", result.Errors[0].Message)
+	assert.Equal(t, []interface{}{"outlier", "transaction"}, result.Errors[0].Path)
+
+	// statistics is non-null, so its denial nulls the whole of data
+	code, result = postGraphQL(t, router, `{ statistics { totalOutliers } }`, nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Nil(t, result.Data)
+	require.Len(t, result.Errors, 1)
+	assert.Contains(t, result.Errors[0].Message, "statistics requires the read:statistics permission")
+}
+
+func TestGraphQLHandler_RejectsInvalidQueries(t *testing.T) {
+	router, _ := setupGraphQLRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected Raphtory request %s", r.URL)
+	}, asRole(models.RoleViewer))
+
+	for _, query := range []string{
+		`{ outlier(id: "o1") { secret } }`,
+		`{ outliers { total outliers } }`,
+		`mutation { outliers { total } }`,
+		`{ outliers(severity: [catastrophic]) { total } }`,
+		`{ outlier(id: "o1") `,
+	} {
+		code, result := postGraphQL(t, router, query, nil)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+		assert.Nil(t, result.Data, query)
+		assert.NotEmpty(t, result.Errors, query)
+	}
+
+	// Argument values the schema allows but the API does not fail the field
+	code, result := postGraphQL(t, router, `{ outliers(limit: 500) { total } }`, nil)
+	assert.Equal(t, http.StatusOK, code)
+	require.Len(t, result.Errors, 1)
+	assert.Contains(t, result.Errors[0].Message, "limit must be between 1 and 100")
+}
+
+func TestGraphQLHandler_Limits(t *testing.T) {
+	var profiles atomic.Int32
+	router, handler := setupGraphQLRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/graph/node/") {
+			profiles.Add(1)
+		}
+		graphQLRaphtory(w, r)
+	}, asRole(models.RoleViewer))
+
+	// The same profile is fetched once per request
+	code, result := postGraphQL(t, router, `{
+		a: address(address: "TAddrA") { outlierCount }
+		b: address(address: "TAddrA") { outlierCount }
+	}`, nil)
+	require.Equal(t, http.StatusOK, code)
+	require.Empty(t, result.Errors)
+	assert.Equal(t, int32(1), profiles.Load())
+
+	handler.SetLimits(3, 0)
+	code, result = postGraphQL(t, router, `{ outlier(id: "o1") { transaction { fromProfile { outlierCount } } } }`, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	require.Len(t, result.Errors, 1)
+	assert.Contains(t, result.Errors[0].Message, "depth")
+
+	handler.SetLimits(0, 2)
+	code, result = postGraphQL(t, router, `{ a: outlier(id: "o1") { id } b: outlier(id: "o2") { id } c: outlier(id: "o3") { id } }`, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, result.Data)
+	require.NotEmpty(t, result.Errors)
+	assert.Contains(t, result.Errors[len(result.Errors)-1].Message, "maximum of 2")
+}
+
+func TestGraphQLHandler_GetSchema(t *testing.T) {
+	router, _ := setupGraphQLRouter(t, graphQLRaphtory, asRole(models.RoleViewer))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/graphql/schema", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, w.Body.String(), "type Query {")
+	assert.Contains(t, w.Body.String(), "enum Severity {")
+	assert.Contains(t, w.Body.String(), "outlier(id: ID!): Outlier")
+}
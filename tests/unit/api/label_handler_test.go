@@ -0,0 +1,143 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createAddressLabelTable creates the address_labels table of migration 025
+func createAddressLabelTable(t *testing.T, db *sql.DB) {
+	_, err := db.Exec(`
+		CREATE TABLE address_labels (
+			address TEXT PRIMARY KEY,
+			label TEXT NOT NULL,
+			category TEXT NOT NULL,
+			source TEXT NOT NULL DEFAULT 'manual',
+			updated_by TEXT NOT NULL DEFAULT '',
+			updated_at DATETIME NOT NULL
+		)
+	`)
+	require.NoError(t, err)
+}
+
+func setupLabelRouter(t *testing.T) *gin.Engine {
+	db := setupUsersDB(t)
+	createAddressLabelTable(t, db)
+
+	handler := handlers.NewLabelHandler(db, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "analyst-1")
+		c.Next()
+	})
+	router.GET("/labels", handler.ListLabels)
+	router.POST("/labels/import", handler.ImportLabels)
+	router.GET("/labels/:address", handler.GetLabel)
+	router.PUT("/labels/:address", handler.SetLabel)
+	router.DELETE("/labels/:address", handler.DeleteLabel)
+	return router
+}
+
+func TestLabelHandler_Labels(t *testing.T) {
+	router := setupLabelRouter(t)
+
+	w := doJSON(router, "PUT", "/labels/TBinanceHot", map[string]string{"label": "Binance hot wallet", "category": "exchange"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var label models.AddressLabel
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &label))
+	assert.Equal(t, "manual", label.Source)
+	assert.Equal(t, "analyst-1", label.UpdatedBy)
+
+	// Hex addresses are stored lowercased
+	w = doJSON(router, "PUT", "/labels/0xABCDEF0000000000000000000000000000000001",
+		map[string]string{"label": "Tornado Cash", "category": "mixer", "source": "chainalysis"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doJSON(router, "GET", "/labels/0xabcdef0000000000000000000000000000000001", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &label))
+	assert.Equal(t, "Tornado Cash", label.Label)
+	assert.Equal(t, models.LabelCategoryMixer, label.Category)
+
+	// Setting a label again replaces it
+	w = doJSON(router, "PUT", "/labels/TBinanceHot", map[string]string{"label": "Binance cold wallet", "category": "exchange"})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doJSON(router, "PUT", "/labels/TX", map[string]string{"label": "Unknown", "category": "casino"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(router, "PUT", "/labels/TX", map[string]string{"category": "other"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(router, "GET", "/labels?category=exchange", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list internalapi.AddressLabelListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Equal(t, 1, list.Total)
+	assert.Equal(t, "Binance cold wallet", list.Labels[0].Label)
+
+	w = doJSON(router, "GET", "/labels?q=TORNADO", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Labels, 1)
+	assert.Equal(t, "chainalysis", list.Labels[0].Source)
+
+	w = doJSON(router, "GET", "/labels?category=casino", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(router, "DELETE", "/labels/TBinanceHot", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, "GET", "/labels/TBinanceHot", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doJSON(router, "DELETE", "/labels/TBinanceHot", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestLabelHandler_ImportLabels(t *testing.T) {
+	router := setupLabelRouter(t)
+
+	body := "Address,Label,Category,Source\n" +
+		"TKraken1,Kraken deposit,Exchange,\n" +
+		"TMixer1,Sinbad,mixer,trm\n" +
+		",No address,other,\n" +
+		"TBad1,Bad category,casino,\n"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/labels/import?source=vendor-2026-10", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp internalapi.AddressLabelImportResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Imported)
+	require.Len(t, resp.Skipped, 2)
+	assert.Equal(t, 4, resp.Skipped[0].Line)
+	assert.Equal(t, 5, resp.Skipped[1].Line)
+	assert.Equal(t, "TBad1", resp.Skipped[1].Address)
+
+	w = doJSON(router, "GET", "/labels/TKraken1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var label models.AddressLabel
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &label))
+	assert.Equal(t, models.LabelCategoryExchange, label.Category)
+	assert.Equal(t, "vendor-2026-10", label.Source)
+
+	w = doJSON(router, "GET", "/labels/TMixer1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &label))
+	assert.Equal(t, "trm", label.Source)
+
+	// A CSV without the required columns is rejected outright
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/labels/import", strings.NewReader("address,name\nTX,y\n")))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
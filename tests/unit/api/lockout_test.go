@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// setupLockoutRouter serves Login guarded by a login guard with the given
+// config. The user "viewer" has the password "viewer-pass".
+func setupLockoutRouter(t *testing.T, config security.LoginGuardConfig) (*gin.Engine, *security.LoginGuard) {
+	db := setupUsersDB(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("viewer-pass"), bcrypt.MinCost)
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE users SET password_hash = ? WHERE id = 'viewer-id'`, string(hash))
+	require.NoError(t, err)
+
+	guard := security.NewLoginGuard(db, config, nil, nil)
+	handler := handlers.NewAuthHandler(db, setupTestJWTManager(), setupTestPasswordManager(), nil)
+	handler.SetLoginGuard(guard)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/auth/login", handler.Login)
+	return router, guard
+}
+
+func TestLogin_LocksAccountAfterRepeatedFailures(t *testing.T) {
+	router, _ := setupLockoutRouter(t, security.LoginGuardConfig{MaxFailures: 3, Lockout: time.Minute})
+
+	assert.Equal(t, http.StatusUnauthorized, login(router, "wrong-1"))
+	assert.Equal(t, http.StatusUnauthorized, login(router, "wrong-2"))
+
+	w := doJSON(router, "POST", "/auth/login", map[string]string{"username": "viewer", "password": "wrong-3"})
+	assert.Equal(t, http.StatusLocked, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// The right password is refused while the account is locked
+	w = doJSON(router, "POST", "/auth/login", map[string]string{"username": "viewer", "password": "viewer-pass"})
+	assert.Equal(t, http.StatusLocked, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// Other accounts are unaffected
+	w = doJSON(router, "POST", "/auth/login", map[string]string{"username": "admin", "password": "wrong"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestLogin_LockExpires(t *testing.T) {
+	router, _ := setupLockoutRouter(t, security.LoginGuardConfig{MaxFailures: 2, Lockout: 50 * time.Millisecond})
+
+	assert.Equal(t, http.StatusUnauthorized, login(router, "wrong-1"))
+	assert.Equal(t, http.StatusLocked, login(router, "wrong-2"))
+
+	time.Sleep(100 * time.Millisecond)
+
+	// The count restarted when the account locked, so one more failure
+	// does not lock it again
+	assert.Equal(t, http.StatusUnauthorized, login(router, "wrong-3"))
+	assert.Equal(t, http.StatusOK, login(router, "viewer-pass"))
+}
+
+func TestLogin_SuccessResetsFailures(t *testing.T) {
+	router, _ := setupLockoutRouter(t, security.LoginGuardConfig{MaxFailures: 2, Lockout: time.Minute})
+
+	assert.Equal(t, http.StatusUnauthorized, login(router, "wrong-1"))
+	assert.Equal(t, http.StatusOK, login(router, "viewer-pass"))
+	assert.Equal(t, http.StatusUnauthorized, login(router, "wrong-2"))
+	assert.Equal(t, http.StatusOK, login(router, "viewer-pass"))
+}
+
+func TestLogin_RateLimitsIP(t *testing.T) {
+	router, _ := setupLockoutRouter(t, security.LoginGuardConfig{IPMaxFailures: 3, IPWindow: time.Minute})
+
+	// Failures for unknown usernames count against the IP too
+	for _, username := range []string{"alice", "bob", "carol"} {
+		w := doJSON(router, "POST", "/auth/login", map[string]string{"username": username, "password": "guess"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	w := doJSON(router, "POST", "/auth/login", map[string]string{"username": "viewer", "password": "viewer-pass"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupOpenAPIRouter(swaggerUI bool) *gin.Engine {
+	outlierHandler := handlers.NewOutlierHandler(nil, nil)
+	featureHandler := handlers.NewFeatureHandler(nil, nil)
+	authHandler := handlers.NewAuthHandler(nil, nil, nil, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/health", func(c *gin.Context) {})
+	router.POST("/api/v1/auth/login", authHandler.Login)
+	router.GET("/api/v1/outliers", outlierHandler.ListOutliers)
+	router.GET("/api/v1/outliers/:id", outlierHandler.GetOutlier)
+	router.PUT("/api/v1/features/:name", featureHandler.SetFeature)
+	router.GET("/api/v1/undocumented", func(c *gin.Context) {})
+
+	handler := handlers.NewOpenAPIHandler(router.Routes, "1.2.3", nil)
+	router.GET("/api/v1/openapi.json", handler.GetOpenAPI)
+	if swaggerUI {
+		handler.SetSwaggerUI("https://cdn.example.com/swagger-ui/")
+		router.GET("/api/v1/docs", handler.GetSwaggerUI)
+		router.GET("/api/v1/docs/init.js", handler.GetSwaggerUIInit)
+	}
+	return router
+}
+
+// openAPISpec is the part of the specification the tests inspect
+type openAPISpec struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Version string `json:"version"`
+	} `json:"info"`
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas         map[string]openAPISchema `json:"schemas"`
+		SecuritySchemes map[string]interface{}   `json:"securitySchemes"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	OperationID string                    `json:"operationId"`
+	Description string                    `json:"description"`
+	Tags        []string                  `json:"tags"`
+	Security    *[]map[string]interface{} `json:"security"`
+	Parameters  []struct {
+		Name     string        `json:"name"`
+		In       string        `json:"in"`
+		Required bool          `json:"required"`
+		Schema   openAPISchema `json:"schema"`
+	} `json:"parameters"`
+	RequestBody *struct {
+		Content map[string]struct {
+			Schema openAPISchema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema openAPISchema `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+type openAPISchema struct {
+	Ref        string                   `json:"$ref"`
+	Type       string                   `json:"type"`
+	Format     string                   `json:"format"`
+	Enum       []interface{}            `json:"enum"`
+	Minimum    *float64                 `json:"minimum"`
+	Maximum    *float64                 `json:"maximum"`
+	Properties map[string]openAPISchema `json:"properties"`
+	Required   []string                 `json:"required"`
+}
+
+func TestOpenAPIHandler_GetOpenAPI(t *testing.T) {
+	router := setupOpenAPIRouter(false)
+
+	w := doJSON(router, "GET", "/api/v1/openapi.json", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var spec openAPISpec
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+	assert.Equal(t, "3.0.3", spec.OpenAPI)
+	assert.Equal(t, "1.2.3", spec.Info.Version)
+	require.Len(t, spec.Servers, 1)
+	assert.Equal(t, "/api/v1", spec.Servers[0].URL)
+	assert.Contains(t, spec.Components.SecuritySchemes, "bearerAuth")
+	assert.Contains(t, spec.Components.SecuritySchemes, "apiKeyAuth")
+
+	// Only routes under the base path, relative to it
+	assert.NotContains(t, spec.Paths, "/health")
+	assert.Contains(t, spec.Paths, "/undocumented")
+	assert.Contains(t, spec.Paths, "/openapi.json")
+
+	// Public routes need no credentials
+	login := spec.Paths["/auth/login"]["post"]
+	assert.Equal(t, "Login", login.OperationID)
+	require.NotNil(t, login.Security)
+	assert.Empty(t, *login.Security)
+	require.NotNil(t, login.RequestBody)
+	body := spec.Components.Schemas["LoginRequest"]
+	assert.ElementsMatch(t, []string{"username", "password"}, body.Required)
+
+	// Query parameters with their binding rules, and API key access
+	list := spec.Paths["/outliers"]["get"]
+	assert.Equal(t, "ListOutliers", list.OperationID)
+	assert.Equal(t, []string{"Outliers"}, list.Tags)
+	assert.Contains(t, list.Description, "read:outliers")
+	require.NotNil(t, list.Security)
+	assert.Len(t, *list.Security, 2)
+	params := make(map[string]int)
+	for i, param := range list.Parameters {
+		params[param.Name] = i
+	}
+	for _, name := range []string{"page", "limit", "severity", "status", "from", "after_id", "stream"} {
+		assert.Contains(t, params, name)
+	}
+	limit := list.Parameters[params["limit"]].Schema
+	require.NotNil(t, limit.Maximum)
+	assert.Equal(t, 100.0, *limit.Maximum)
+	assert.Equal(t, "date-time", list.Parameters[params["from"]].Schema.Format)
+	assert.Equal(t, "#/components/schemas/OutlierListResponse",
+		list.Responses["200"].Content["application/json"].Schema.Ref)
+	assert.Contains(t, list.Responses, "default")
+
+	// Path and header parameters, and enums on named types
+	get := spec.Paths["/outliers/{id}"]["get"]
+	require.Len(t, get.Parameters, 2)
+	assert.Equal(t, "id", get.Parameters[0].Name)
+	assert.Equal(t, "path", get.Parameters[0].In)
+	assert.True(t, get.Parameters[0].Required)
+	assert.Equal(t, "If-None-Match", get.Parameters[1].Name)
+	assert.Equal(t, "header", get.Parameters[1].In)
+	assert.False(t, get.Parameters[1].Required)
+	outlier := spec.Components.Schemas["Outlier"]
+	assert.Contains(t, outlier.Properties["severity"].Enum, "critical")
+	assert.Contains(t, outlier.Properties["type"].Enum, "zscore")
+	assert.Contains(t, outlier.Properties["status"].Enum, "investigating")
+	assert.Equal(t, "date-time", outlier.Properties["detected_at"].Format)
+
+	// Routes only a JWT may call
+	set := spec.Paths["/features/{name}"]["put"]
+	assert.Nil(t, set.Security)
+	assert.Contains(t, set.Description, "manage:system")
+	assert.Equal(t, "#/components/schemas/SetFeatureFlagRequest",
+		set.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Contains(t, spec.Components.Schemas["SetFeatureFlagRequest"].Required, "enabled")
+}
+
+func TestOpenAPIHandler_SwaggerUI(t *testing.T) {
+	router := setupOpenAPIRouter(true)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/docs", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), `src="https://cdn.example.com/swagger-ui/swagger-ui-bundle.js"`)
+	assert.Contains(t, w.Body.String(), `src="/api/v1/docs/init.js"`)
+	csp := w.Header().Get("Content-Security-Policy")
+	assert.Contains(t, csp, "script-src https://cdn.example.com/swagger-ui/ 'self'")
+	assert.NotContains(t, csp, "unsafe-eval")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/docs/init.js", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `url: "/api/v1/openapi.json"`)
+
+	// Disabled unless configured
+	router = setupOpenAPIRouter(false)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/docs", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
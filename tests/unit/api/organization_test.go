@@ -0,0 +1,367 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const otherOrgID = "00000000-0000-0000-0000-0000000000b2"
+
+// setupOrganizationRouter serves the org-scoped handlers over the outlier
+// fixtures plus a second organization with its own admin, outlier and
+// watchlist. Requests act as the default organization's admin unless
+// X-Test-Org names another organization, whose admin they then act as.
+func setupOrganizationRouter(t *testing.T) (*gin.Engine, *sql.DB) {
+	_, db := setupOutlierListRouter(t)
+	createWatchlistTables(t, db)
+	_, err := db.Exec(`
+		INSERT INTO organizations (id, name) VALUES ('` + otherOrgID + `', 'Team B');
+		INSERT INTO users (id, org_id, username, password_hash, role) VALUES
+			('b-admin', '` + otherOrgID + `', 'b-admin', 'x', 'admin');
+		INSERT INTO outliers (id, org_id, detected_at, type, severity, address) VALUES
+			('b1', '` + otherOrgID + `', '2026-01-01 00:00:10', 'watchlist', 'high', 'TAddrA');
+		INSERT INTO watchlists (id, org_id, name, created_at, updated_at) VALUES
+			('w-b', '` + otherOrgID + `', 'sanctions', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
+	`)
+	require.NoError(t, err)
+
+	outliers := handlers.NewOutlierHandler(db, nil)
+	users := handlers.NewUserHandler(db, setupTestPasswordManager(), nil)
+	watchlists := handlers.NewWatchlistHandler(db, nil)
+	apiKeys := handlers.NewAPIKeyHandler(db, security.NewRoleStore(db, security.RoleStoreConfig{}, nil), nil)
+	organizations := handlers.NewOrganizationHandler(db, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(middleware.ContextKeyUserID, "admin-id")
+		if orgID := c.GetHeader("X-Test-Org"); orgID != "" {
+			c.Set(middleware.ContextKeyUserID, "b-admin")
+			c.Set(middleware.ContextKeyOrgID, orgID)
+		}
+	})
+	router.GET("/organization", organizations.GetCurrentOrganization)
+	router.GET("/organizations", organizations.ListOrganizations)
+	router.POST("/organizations", organizations.CreateOrganization)
+	router.GET("/outliers", outliers.ListOutliers)
+	router.GET("/outliers/:id", outliers.GetOutlier)
+	router.POST("/outliers/:id/acknowledge", outliers.AcknowledgeOutlier)
+	router.POST("/outliers/:id/assign", outliers.AssignOutlier)
+	router.POST("/outliers/:id/archive", outliers.ArchiveOutlier)
+	router.PATCH("/outliers/:id/status", outliers.UpdateOutlierStatus)
+	router.GET("/outliers/:id/history", outliers.GetOutlierStatusHistory)
+	router.GET("/users", users.ListUsers)
+	router.POST("/users", users.CreateUser)
+	router.GET("/users/:id", users.GetUser)
+	router.GET("/watchlists", watchlists.ListWatchlists)
+	router.POST("/watchlists", watchlists.CreateWatchlist)
+	router.GET("/watchlists/:id", watchlists.GetWatchlist)
+	router.DELETE("/watchlists/:id", watchlists.DeleteWatchlist)
+	router.GET("/api-keys", apiKeys.ListAPIKeys)
+	router.POST("/api-keys", apiKeys.CreateAPIKey)
+	router.GET("/api-keys/:id", apiKeys.GetAPIKey)
+	return router, db
+}
+
+// doOrgJSON is doJSON acting as the admin of an organization
+func doOrgJSON(router *gin.Engine, orgID, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var encoded []byte
+	if body != nil {
+		encoded, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(encoded))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-Org", orgID)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestOrganizations_OutlierIsolation(t *testing.T) {
+	router, db := setupOrganizationRouter(t)
+
+	var resp internalapi.OutlierListResponse
+	w := doOrgJSON(router, otherOrgID, "GET", "/outliers", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Outliers, 1)
+	assert.Equal(t, "b1", resp.Outliers[0].ID)
+	assert.Equal(t, otherOrgID, resp.Outliers[0].OrgID)
+
+	ids, total := listOutlierIDs(t, router, "?address=TAddrA")
+	assert.Equal(t, []string{"o4", "o1"}, ids, "the default organization does not see team B's outlier")
+	assert.Equal(t, 2, total)
+
+	// Another organization's outliers cannot be read or changed
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/outliers/b1", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doOrgJSON(router, otherOrgID, "GET", "/outliers/o1", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doOrgJSON(router, otherOrgID, "POST", "/outliers/o1/acknowledge", map[string]string{}).Code)
+	var triaged int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM outlier_triage WHERE outlier_id = 'o1'`).Scan(&triaged))
+	assert.Zero(t, triaged)
+
+	// Nor assigned to another organization's users
+	w = doJSON(router, "POST", "/outliers/o1/assign", map[string]string{"user_id": "b-admin"})
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	w = doOrgJSON(router, otherOrgID, "POST", "/outliers/b1/assign", map[string]string{"user_id": "b-admin"})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestOrganizations_SharedOutliers(t *testing.T) {
+	router, db := setupOrganizationRouter(t)
+	_, err := db.Exec(`
+		INSERT INTO outliers (id, org_id, detected_at, type, severity, address) VALUES
+			('s1', NULL, '2026-01-01 00:00:20', 'zscore', 'critical', 'TShared')
+	`)
+	require.NoError(t, err)
+
+	// A z-score outlier from the shared detectors is seen by every
+	// organization, alongside its own watchlist hits
+	var resp internalapi.OutlierListResponse
+	w := doOrgJSON(router, otherOrgID, "GET", "/outliers", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	var ids []string
+	for _, outlier := range resp.Outliers {
+		ids = append(ids, outlier.ID)
+	}
+	assert.ElementsMatch(t, []string{"s1", "b1"}, ids)
+
+	var outlier models.Outlier
+	w = doOrgJSON(router, otherOrgID, "GET", "/outliers/s1", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &outlier))
+	assert.Equal(t, models.OutlierTypeZScore, outlier.Type)
+	assert.Empty(t, outlier.OrgID)
+	assert.True(t, outlier.Shared())
+
+	ids, _ = listOutlierIDs(t, router, "?address=TShared")
+	assert.Equal(t, []string{"s1"}, ids)
+
+	// Every organization triages it, and each acknowledgement is its own
+	w = doOrgJSON(router, otherOrgID, "POST", "/outliers/s1/acknowledge", map[string]string{})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doOrgJSON(router, otherOrgID, "POST", "/outliers/s1/assign", map[string]string{"user_id": "b-admin"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = doOrgJSON(router, otherOrgID, "GET", "/outliers/s1", nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &outlier))
+	assert.True(t, outlier.Acknowledged)
+	assert.Equal(t, "b-admin", outlier.AssignedTo)
+	w = doJSON(router, "GET", "/outliers/s1", nil)
+	outlier = models.Outlier{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &outlier))
+	assert.False(t, outlier.Acknowledged)
+	assert.Empty(t, outlier.AssignedTo)
+
+	w = doJSON(router, "POST", "/outliers/s1/acknowledge", map[string]string{})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var triaged int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM outlier_triage WHERE outlier_id = 's1' AND acknowledged = true`).Scan(&triaged))
+	assert.Equal(t, 2, triaged)
+}
+
+func TestOrganizations_SharedOutlierTriageIsolation(t *testing.T) {
+	router, db := setupOrganizationRouter(t)
+	_, err := db.Exec(`
+		INSERT INTO outliers (id, org_id, detected_at, type, severity, address) VALUES
+			('s1', NULL, '2026-01-01 00:00:20', 'zscore', 'critical', 'TShared')
+	`)
+	require.NoError(t, err)
+
+	// The default organization triages the shared outlier
+	w := doJSON(router, "POST", "/outliers/s1/assign", map[string]string{"user_id": "admin-id"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doJSON(router, "PATCH", "/outliers/s1/status", map[string]string{"status": "investigating", "notes": "Linked to the exchange hack"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doJSON(router, "POST", "/outliers/s1/acknowledge", map[string]string{"notes": "Escalated to compliance", "label": "true_positive"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var outlier models.Outlier
+	w = doJSON(router, "GET", "/outliers/s1", nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &outlier))
+	assert.Equal(t, "Escalated to compliance", outlier.Notes)
+	assert.Equal(t, "admin-id", outlier.AssignedTo)
+
+	// Team B sees the outlier, but none of that triage
+	w = doOrgJSON(router, otherOrgID, "GET", "/outliers/s1", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	outlier = models.Outlier{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &outlier))
+	assert.Empty(t, outlier.Notes)
+	assert.Empty(t, outlier.AssignedTo)
+	assert.Empty(t, outlier.AssignedBy)
+	assert.Empty(t, outlier.AcknowledgedBy)
+	assert.Empty(t, outlier.Feedback)
+	assert.False(t, outlier.Acknowledged)
+	assert.Equal(t, models.OutlierStatusOpen, outlier.Status)
+
+	var page internalapi.OutlierListResponse
+	w = doOrgJSON(router, otherOrgID, "GET", "/outliers?address=TShared", nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Outliers, 1)
+	assert.Empty(t, page.Outliers[0].Notes)
+	assert.Empty(t, page.Outliers[0].AssignedTo)
+
+	// Nor can it be found by filtering on that triage
+	for _, query := range []string{"?assigned_to=admin-id", "?status=investigating", "?acknowledged=true"} {
+		page = internalapi.OutlierListResponse{}
+		w = doOrgJSON(router, otherOrgID, "GET", "/outliers"+query, nil)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		assert.Empty(t, page.Outliers, query)
+	}
+
+	// Team B triages it separately, and archiving it hides it from team B only
+	w = doOrgJSON(router, otherOrgID, "PATCH", "/outliers/s1/status", map[string]string{"status": "false_positive", "notes": "Exchange rebalancing"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doOrgJSON(router, otherOrgID, "POST", "/outliers/s1/archive", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	page = internalapi.OutlierListResponse{}
+	w = doOrgJSON(router, otherOrgID, "GET", "/outliers?address=TShared", nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Empty(t, page.Outliers)
+	ids, _ := listOutlierIDs(t, router, "?address=TShared")
+	assert.Equal(t, []string{"s1"}, ids)
+	w = doJSON(router, "GET", "/outliers/s1", nil)
+	outlier = models.Outlier{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &outlier))
+	assert.Equal(t, models.OutlierStatusInvestigating, outlier.Status)
+	assert.True(t, outlier.ArchivedAt.IsZero())
+
+	var history internalapi.OutlierStatusHistoryResponse
+	w = doOrgJSON(router, otherOrgID, "GET", "/outliers/s1/history", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Equal(t, models.OutlierStatusFalsePositive, history.Status)
+	require.Len(t, history.History, 1)
+	assert.Equal(t, "Exchange rebalancing", history.History[0].Notes)
+	w = doJSON(router, "GET", "/outliers/s1/history", nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Equal(t, models.OutlierStatusInvestigating, history.Status)
+	require.Len(t, history.History, 1)
+	assert.Equal(t, "Linked to the exchange hack", history.History[0].Notes)
+}
+
+func TestOrganizations_UserIsolation(t *testing.T) {
+	router, _ := setupOrganizationRouter(t)
+
+	var page internalapi.UserListResponse
+	w := doOrgJSON(router, otherOrgID, "GET", "/users", nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Users, 1)
+	assert.Equal(t, "b-admin", page.Users[0].ID)
+	assert.Equal(t, otherOrgID, page.Users[0].OrgID)
+	assert.Equal(t, http.StatusNotFound, doOrgJSON(router, otherOrgID, "GET", "/users/admin-id", nil).Code)
+
+	w = doJSON(router, "GET", "/users", nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, 2, page.Total)
+
+	// Users join the creator's organization
+	w = doOrgJSON(router, otherOrgID, "POST", "/users", map[string]string{
+		"username": "b-analyst", "password": "s3cret-pass", "role": "analyst",
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, otherOrgID, created.OrgID)
+
+	// Only the default organization may create users in another
+	w = doOrgJSON(router, otherOrgID, "POST", "/users", map[string]string{
+		"username": "intruder", "password": "s3cret-pass", "role": "admin", "org_id": models.DefaultOrganizationID,
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doJSON(router, "POST", "/users", map[string]string{
+		"username": "b-admin-2", "password": "s3cret-pass", "role": "admin", "org_id": otherOrgID,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, otherOrgID, created.OrgID)
+	w = doJSON(router, "POST", "/users", map[string]string{
+		"username": "nowhere", "password": "s3cret-pass", "role": "admin", "org_id": "missing",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOrganizations_WatchlistIsolation(t *testing.T) {
+	router, _ := setupOrganizationRouter(t)
+
+	var list internalapi.WatchlistListResponse
+	w := doJSON(router, "GET", "/watchlists", nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Empty(t, list.Watchlists)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/watchlists/w-b", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "DELETE", "/watchlists/w-b", nil).Code)
+
+	// Names are unique within an organization only
+	w = doJSON(router, "POST", "/watchlists", map[string]string{"name": "sanctions"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = doOrgJSON(router, otherOrgID, "POST", "/watchlists", map[string]string{"name": "sanctions"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = doOrgJSON(router, otherOrgID, "GET", "/watchlists", nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Watchlists, 1)
+	assert.Equal(t, "w-b", list.Watchlists[0].ID)
+	assert.Equal(t, otherOrgID, list.Watchlists[0].OrgID)
+}
+
+func TestOrganizations_APIKeyIsolation(t *testing.T) {
+	router, _ := setupOrganizationRouter(t)
+
+	// Keys can only be issued to users of the caller's organization
+	w := doJSON(router, "POST", "/api-keys", map[string]interface{}{
+		"name": "cross", "user_id": "b-admin", "scopes": []string{"read:outliers"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doOrgJSON(router, otherOrgID, "POST", "/api-keys", map[string]interface{}{
+		"name": "siem", "scopes": []string{"read:outliers"},
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created internalapi.CreateAPIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, otherOrgID, created.APIKey.OrgID)
+
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/api-keys/"+created.APIKey.ID, nil).Code)
+	var list internalapi.APIKeyListResponse
+	require.NoError(t, json.Unmarshal(doJSON(router, "GET", "/api-keys", nil).Body.Bytes(), &list))
+	assert.Empty(t, list.APIKeys)
+}
+
+func TestOrganizationHandler(t *testing.T) {
+	router, _ := setupOrganizationRouter(t)
+
+	var org models.Organization
+	w := doOrgJSON(router, otherOrgID, "GET", "/organization", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &org))
+	assert.Equal(t, "Team B", org.Name)
+
+	w = doJSON(router, "POST", "/organizations", map[string]string{"name": "Team C"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &org))
+	assert.Equal(t, "Team C", org.Name)
+	assert.NotEmpty(t, org.ID)
+
+	assert.Equal(t, http.StatusConflict, doJSON(router, "POST", "/organizations", map[string]string{"name": "Team C"}).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/organizations", map[string]string{"name": " "}).Code)
+
+	var list internalapi.OrganizationListResponse
+	require.NoError(t, json.Unmarshal(doJSON(router, "GET", "/organizations", nil).Body.Bytes(), &list))
+	require.Len(t, list.Organizations, 3)
+	assert.Equal(t, models.DefaultOrganizationID, list.Organizations[0].ID)
+}
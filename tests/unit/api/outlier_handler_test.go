@@ -0,0 +1,686 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupOutlierListRouter(t *testing.T) (*gin.Engine, *sql.DB) {
+	db := setupUsersDB(t)
+	_, err := db.Exec(`
+		CREATE TABLE outliers (
+			id TEXT PRIMARY KEY,
+			org_id TEXT DEFAULT '00000000-0000-0000-0000-000000000001',
+			detected_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			type TEXT NOT NULL,
+			severity TEXT NOT NULL,
+			address TEXT NOT NULL,
+			transaction_hash TEXT NOT NULL DEFAULT '',
+			amount REAL NOT NULL DEFAULT 0,
+			z_score REAL,
+			details TEXT NOT NULL DEFAULT '{}',
+			invalidated BOOLEAN NOT NULL DEFAULT false,
+			invalidated_at DATETIME,
+			invalid_reason TEXT
+		);
+		CREATE TABLE outlier_triage (
+			id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+			outlier_id TEXT NOT NULL,
+			org_id TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'open',
+			acknowledged BOOLEAN NOT NULL DEFAULT false,
+			acknowledged_by TEXT,
+			acknowledged_at DATETIME,
+			notes TEXT,
+			feedback TEXT,
+			assigned_to TEXT,
+			assigned_by TEXT,
+			assigned_at DATETIME,
+			archived_at DATETIME,
+			archived_by TEXT,
+			UNIQUE (outlier_id, org_id)
+		);
+		CREATE TABLE outlier_status_history (
+			id TEXT PRIMARY KEY,
+			outlier_id TEXT NOT NULL,
+			org_id TEXT NOT NULL,
+			from_status TEXT NOT NULL,
+			to_status TEXT NOT NULL,
+			changed_by TEXT NOT NULL,
+			changed_at DATETIME NOT NULL,
+			notes TEXT
+		);
+	`)
+	require.NoError(t, err)
+
+	// Timestamps are bound as times, so they compare like cursor times do
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, row := range []struct {
+		id, outlierType, severity, address string
+		amount                             float64
+		acknowledged                       bool
+	}{
+		{"o1", "zscore", "low", "TAddrA", 500, false},
+		{"o2", "iqr", "critical", "TAddrB", 100, false},
+		{"o3", "pattern_fanout", "high", "TAddrC", 900, true},
+		{"o4", "zscore", "medium", "TAddrA", 300, false},
+		{"o5", "dbscan", "high", "TAddrD", 700, false},
+	} {
+		_, err := db.Exec(`INSERT INTO outliers (id, detected_at, type, severity, address, amount) VALUES (?, ?, ?, ?, ?, ?)`,
+			row.id, start.Add(time.Duration(i+1)*time.Second), row.outlierType, row.severity, row.address, row.amount)
+		require.NoError(t, err)
+		if row.acknowledged {
+			setTriage(t, db, row.id, `acknowledged = true`)
+		}
+	}
+
+	handler := handlers.NewOutlierHandler(db, nil)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/outliers", handler.ListOutliers)
+	return router, db
+}
+
+// setTriage sets the default organization's triage of an outlier
+func setTriage(t *testing.T, db *sql.DB, id, set string) {
+	_, err := db.Exec(`INSERT INTO outlier_triage (id, outlier_id, org_id) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`,
+		"triage-"+id, id, models.DefaultOrganizationID)
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE outlier_triage SET `+set+` WHERE outlier_id = ? AND org_id = ?`, id, models.DefaultOrganizationID)
+	require.NoError(t, err)
+}
+
+// listOutliers lists outliers and returns the response and their IDs in order
+func listOutliers(t *testing.T, router *gin.Engine, query string) (internalapi.OutlierListResponse, []string) {
+	w := doJSON(router, "GET", "/outliers"+query, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp internalapi.OutlierListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	ids := make([]string, len(resp.Outliers))
+	for i, outlier := range resp.Outliers {
+		ids[i] = outlier.ID
+	}
+	return resp, ids
+}
+
+// listOutlierIDs lists outliers and returns their IDs in order and the total
+func listOutlierIDs(t *testing.T, router *gin.Engine, query string) ([]string, int) {
+	resp, ids := listOutliers(t, router, query)
+	return ids, resp.Total
+}
+
+func TestOutlierHandler_ListOutliers_Filters(t *testing.T) {
+	router, _ := setupOutlierListRouter(t)
+
+	ids, total := listOutlierIDs(t, router, "")
+	assert.Equal(t, []string{"o5", "o4", "o3", "o2", "o1"}, ids, "newest first by default")
+	assert.Equal(t, 5, total)
+
+	ids, _ = listOutlierIDs(t, router, "?severity=high,critical")
+	assert.Equal(t, []string{"o5", "o3", "o2"}, ids)
+
+	ids, _ = listOutlierIDs(t, router, "?severity=high&severity=critical&acknowledged=false")
+	assert.Equal(t, []string{"o5", "o2"}, ids)
+
+	ids, _ = listOutlierIDs(t, router, "?min_amount=300&max_amount=700.5")
+	assert.Equal(t, []string{"o5", "o4", "o1"}, ids)
+
+	// Largest unacknowledged high and critical outliers first
+	ids, _ = listOutlierIDs(t, router, "?severity=high,critical&acknowledged=false&sort=-amount")
+	assert.Equal(t, []string{"o5", "o2"}, ids)
+
+	// More than nine placeholders
+	ids, total = listOutlierIDs(t, router, "?type=zscore,iqr,dbscan&severity=low,medium,high&address=TAddrA,TAddrB,TAddrD&acknowledged=false&invalidated=false&limit=1&page=2")
+	assert.Equal(t, []string{"o4"}, ids)
+	assert.Equal(t, 3, total)
+}
+
+func TestOutlierHandler_ListOutliers_Sort(t *testing.T) {
+	router, _ := setupOutlierListRouter(t)
+
+	ids, _ := listOutlierIDs(t, router, "?sort=-severity")
+	assert.Equal(t, []string{"o2", "o5", "o3", "o4", "o1"}, ids, "by rank, newest first within a severity")
+
+	ids, _ = listOutlierIDs(t, router, "?sort=amount")
+	assert.Equal(t, []string{"o2", "o4", "o1", "o5", "o3"}, ids)
+
+	ids, _ = listOutlierIDs(t, router, "?sort=detected_at")
+	assert.Equal(t, []string{"o1", "o2", "o3", "o4", "o5"}, ids)
+}
+
+func TestOutlierHandler_ListOutliers_RejectsUnknownValues(t *testing.T) {
+	router, _ := setupOutlierListRouter(t)
+
+	for _, query := range []string{
+		"?sort=address",
+		"?sort=detected_at%3BDROP%20TABLE%20outliers",
+		"?severity=urgent",
+		"?severity=high,urgent",
+		"?min_amount=lots",
+		"?max_amount=1e",
+		"?min_amount=500&max_amount=100",
+	} {
+		w := doJSON(router, "GET", "/outliers"+query, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestOutlierHandler_ListOutliers_Cursor(t *testing.T) {
+	router, db := setupOutlierListRouter(t)
+	// o6 ties with o5, so the cursor must break ties by ID
+	_, err := db.Exec(`INSERT INTO outliers (id, detected_at, type, severity, address) SELECT 'o6', detected_at, 'zscore', 'low', 'TAddrE' FROM outliers WHERE id = 'o5'`)
+	require.NoError(t, err)
+
+	var seen []string
+	query := "?limit=2"
+	for pages := 0; pages < 5; pages++ {
+		resp, ids := listOutliers(t, router, query)
+		seen = append(seen, ids...)
+		if resp.NextAfterID == "" {
+			break
+		}
+		require.NotNil(t, resp.NextAfterDetectedAt)
+
+		// A new outlier arriving mid-listing shifts nothing
+		if pages == 0 {
+			_, err := db.Exec(`INSERT INTO outliers (id, detected_at, type, severity, address) VALUES ('o7', ?, 'zscore', 'low', 'TAddrF')`, time.Now().UTC())
+			require.NoError(t, err)
+		}
+		query = "?limit=2&after_id=" + resp.NextAfterID + "&after_detected_at=" + url.QueryEscape(resp.NextAfterDetectedAt.Format(time.RFC3339Nano))
+	}
+	assert.Equal(t, []string{"o5", "o6", "o4", "o3", "o2", "o1"}, seen)
+
+	// Ascending
+	resp, ids := listOutliers(t, router, "?limit=3&sort=detected_at")
+	assert.Equal(t, []string{"o1", "o2", "o3"}, ids)
+	_, ids = listOutliers(t, router, "?limit=3&sort=detected_at&after_id="+resp.NextAfterID+"&after_detected_at="+url.QueryEscape(resp.NextAfterDetectedAt.Format(time.RFC3339Nano)))
+	assert.Equal(t, []string{"o4", "o5", "o6"}, ids)
+
+	// Cursors need both halves and a detected_at sort
+	for _, query := range []string{
+		"?after_id=o5",
+		"?after_detected_at=2026-01-01T00:00:05Z",
+		"?sort=amount&after_id=o5&after_detected_at=2026-01-01T00:00:05Z",
+	} {
+		assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/outliers"+query, nil).Code, query)
+	}
+}
+
+func setupBulkAcknowledgeRouter(t *testing.T) (*gin.Engine, *sql.DB) {
+	_, db := setupOutlierListRouter(t)
+	handler := handlers.NewOutlierHandler(db, nil)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "analyst-1")
+		c.Next()
+	})
+	router.POST("/outliers/acknowledge", handler.BulkAcknowledgeOutliers)
+	return router, db
+}
+
+func acknowledgedIDs(t *testing.T, db *sql.DB) []string {
+	rows, err := db.Query(`SELECT outlier_id FROM outlier_triage WHERE acknowledged = true ORDER BY outlier_id`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		require.NoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestOutlierHandler_BulkAcknowledge_IDs(t *testing.T) {
+	router, db := setupBulkAcknowledgeRouter(t)
+
+	w := doJSON(router, "POST", "/outliers/acknowledge", map[string]interface{}{
+		"ids":   []string{"o1", "missing", "o2", "o1"},
+		"notes": "Exchange rebalancing",
+		"label": "false_positive",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp internalapi.BulkAcknowledgeResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Acknowledged)
+	assert.Equal(t, []internalapi.BulkAcknowledgeResult{
+		{ID: "o1", Status: "acknowledged"},
+		{ID: "missing", Status: "not_found"},
+		{ID: "o2", Status: "acknowledged"},
+	}, resp.Results)
+	assert.Equal(t, []string{"o1", "o2", "o3"}, acknowledgedIDs(t, db))
+
+	var by, notes, feedback string
+	require.NoError(t, db.QueryRow(`SELECT acknowledged_by, notes, feedback FROM outlier_triage WHERE outlier_id = 'o2'`).Scan(&by, &notes, &feedback))
+	assert.Equal(t, "analyst-1", by)
+	assert.Equal(t, "Exchange rebalancing", notes)
+	assert.Equal(t, "false_positive", feedback)
+}
+
+func TestOutlierHandler_BulkAcknowledge_Filter(t *testing.T) {
+	router, db := setupBulkAcknowledgeRouter(t)
+
+	w := doJSON(router, "POST", "/outliers/acknowledge", map[string]interface{}{
+		"filter": map[string]interface{}{"severity": []string{"high", "critical"}},
+		"notes":  "Reviewed",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp internalapi.BulkAcknowledgeResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	// o3 matches but was already acknowledged, so it is left alone
+	assert.Equal(t, 2, resp.Acknowledged)
+	assert.Equal(t, []internalapi.BulkAcknowledgeResult{
+		{ID: "o2", Status: "acknowledged"},
+		{ID: "o5", Status: "acknowledged"},
+	}, resp.Results)
+	assert.Equal(t, []string{"o2", "o3", "o5"}, acknowledgedIDs(t, db))
+}
+
+func TestOutlierHandler_BulkAcknowledge_RejectsInvalidRequests(t *testing.T) {
+	router, db := setupBulkAcknowledgeRouter(t)
+
+	tooMany := make([]string, 1001)
+	for i := range tooMany {
+		tooMany[i] = "o1"
+	}
+
+	for name, body := range map[string]interface{}{
+		"neither":        map[string]interface{}{"notes": "x"},
+		"both":           map[string]interface{}{"ids": []string{"o1"}, "filter": map[string]interface{}{"severity": []string{"low"}}},
+		"bad severity":   map[string]interface{}{"filter": map[string]interface{}{"severity": []string{"urgent"}}},
+		"bad label":      map[string]interface{}{"ids": []string{"o1"}, "label": "maybe"},
+		"too many ids":   map[string]interface{}{"ids": tooMany},
+		"inverted range": map[string]interface{}{"filter": map[string]interface{}{"min_amount": "500", "max_amount": "100"}},
+	} {
+		w := doJSON(router, "POST", "/outliers/acknowledge", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, name)
+	}
+	assert.Equal(t, []string{"o3"}, acknowledgedIDs(t, db), "nothing acknowledged")
+}
+
+func TestOutlierHandler_AcknowledgeHook(t *testing.T) {
+	_, db := setupOutlierListRouter(t)
+	handler := handlers.NewOutlierHandler(db, nil)
+	var acknowledged []models.Outlier
+	var orgIDs []string
+	handler.SetAcknowledgeHook(func(orgID string, outlier models.Outlier) {
+		orgIDs = append(orgIDs, orgID)
+		acknowledged = append(acknowledged, outlier)
+	})
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "analyst-1")
+		c.Next()
+	})
+	router.POST("/outliers/acknowledge", handler.BulkAcknowledgeOutliers)
+	router.POST("/outliers/:id/acknowledge", handler.AcknowledgeOutlier)
+
+	w := doJSON(router, "POST", "/outliers/o2/acknowledge", map[string]interface{}{"notes": "Paged and reviewed"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Len(t, acknowledged, 1)
+	assert.Equal(t, "o2", acknowledged[0].ID)
+	assert.Equal(t, models.DefaultOrganizationID, orgIDs[0])
+	assert.Equal(t, models.DefaultOrganizationID, acknowledged[0].OrgID)
+	assert.Equal(t, models.OutlierTypeIQR, acknowledged[0].Type)
+	assert.Equal(t, models.SeverityCritical, acknowledged[0].Severity)
+	assert.Equal(t, "TAddrB", acknowledged[0].Address)
+
+	// Missing outliers are not passed on
+	w = doJSON(router, "POST", "/outliers/acknowledge", map[string]interface{}{"ids": []string{"o4", "missing", "o5"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Len(t, acknowledged, 3)
+	ids := []string{acknowledged[1].ID, acknowledged[2].ID}
+	assert.ElementsMatch(t, []string{"o4", "o5"}, ids)
+
+	w = doJSON(router, "POST", "/outliers/missing/acknowledge", map[string]interface{}{})
+	require.Equal(t, http.StatusNotFound, w.Code)
+	assert.Len(t, acknowledged, 3)
+}
+
+func setupOutlierStatusRouter(t *testing.T) (*gin.Engine, *sql.DB) {
+	router, db := setupOutlierListRouter(t)
+	handler := handlers.NewOutlierHandler(db, nil)
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "analyst-1")
+		c.Next()
+	})
+	router.PATCH("/outliers/:id/status", handler.UpdateOutlierStatus)
+	router.GET("/outliers/:id/history", handler.GetOutlierStatusHistory)
+	return router, db
+}
+
+func setOutlierStatus(router *gin.Engine, id, status, notes string) *httptest.ResponseRecorder {
+	return doJSON(router, "PATCH", "/outliers/"+id+"/status", map[string]string{"status": status, "notes": notes})
+}
+
+func TestOutlierHandler_UpdateOutlierStatus_Workflow(t *testing.T) {
+	router, db := setupOutlierStatusRouter(t)
+
+	w := setOutlierStatus(router, "o2", "investigating", "Looking into the counterparty")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var change models.OutlierStatusChange
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &change))
+	assert.Equal(t, models.OutlierStatusOpen, change.FromStatus)
+	assert.Equal(t, models.OutlierStatusInvestigating, change.ToStatus)
+	assert.Equal(t, "analyst-1", change.ChangedBy)
+
+	var acknowledged bool
+	var feedback sql.NullString
+	require.NoError(t, db.QueryRow(`SELECT acknowledged, feedback FROM outlier_triage WHERE outlier_id = 'o2'`).Scan(&acknowledged, &feedback))
+	assert.True(t, acknowledged, "leaving open acknowledges the outlier")
+	assert.False(t, feedback.Valid)
+
+	require.Equal(t, http.StatusOK, setOutlierStatus(router, "o2", "false_positive", "Exchange rebalancing").Code)
+	require.NoError(t, db.QueryRow(`SELECT feedback FROM outlier_triage WHERE outlier_id = 'o2'`).Scan(&feedback))
+	assert.Equal(t, "false_positive", feedback.String, "closing sets the feedback label")
+
+	// Closed outliers can only be reopened for investigation
+	w = setOutlierStatus(router, "o2", "confirmed", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	require.Equal(t, http.StatusOK, setOutlierStatus(router, "o2", "investigating", "New evidence").Code)
+	require.Equal(t, http.StatusOK, setOutlierStatus(router, "o2", "confirmed", "").Code)
+
+	w = doJSON(router, "GET", "/outliers/o2/history", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var history internalapi.OutlierStatusHistoryResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Equal(t, models.OutlierStatusConfirmed, history.Status)
+	require.Len(t, history.History, 4)
+	var transitions []string
+	for _, change := range history.History {
+		transitions = append(transitions, string(change.FromStatus)+">"+string(change.ToStatus))
+	}
+	assert.Equal(t, []string{"open>investigating", "investigating>false_positive", "false_positive>investigating", "investigating>confirmed"}, transitions)
+	assert.Equal(t, "Exchange rebalancing", history.History[1].Notes)
+
+	// The list filters by status
+	ids, _ := listOutlierIDs(t, router, "?status=confirmed,investigating")
+	assert.Equal(t, []string{"o2"}, ids)
+	ids, _ = listOutlierIDs(t, router, "?status=open")
+	assert.Equal(t, []string{"o5", "o4", "o3", "o1"}, ids)
+}
+
+func TestOutlierHandler_UpdateOutlierStatus_Rejects(t *testing.T) {
+	router, _ := setupOutlierStatusRouter(t)
+
+	assert.Equal(t, http.StatusBadRequest, setOutlierStatus(router, "o1", "closed", "").Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "PATCH", "/outliers/o1/status", map[string]string{}).Code)
+	assert.Equal(t, http.StatusConflict, setOutlierStatus(router, "o1", "open", "").Code, "no change")
+	assert.Equal(t, http.StatusNotFound, setOutlierStatus(router, "missing", "investigating", "").Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/outliers/missing/history", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/outliers?status=closed", nil).Code)
+}
+
+func TestOutlierHandler_AssignOutlier(t *testing.T) {
+	_, db := setupOutlierListRouter(t)
+	_, err := db.Exec(`
+		INSERT INTO users (id, username, password_hash, role) VALUES ('analyst-1', 'analyst1', 'x', 'analyst');
+		INSERT INTO users (id, username, password_hash, role) VALUES ('analyst-2', 'analyst2', 'x', 'analyst');
+		INSERT INTO users (id, username, password_hash, role, is_active) VALUES ('former', 'former', 'x', 'analyst', false);
+	`)
+	require.NoError(t, err)
+
+	auditDB := setupAuditDB(t)
+	auditLogger := security.NewAuditLogger(auditDB, security.AuditLoggerConfig{SecretKey: auditTestKey}, nil)
+	handler := handlers.NewOutlierHandler(db, nil)
+	handler.SetAuditLogger(auditLogger)
+
+	// Requests act as the user named in X-Test-User
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", c.GetHeader("X-Test-User"))
+		c.Next()
+	})
+	router.GET("/outliers", handler.ListOutliers)
+	router.POST("/outliers/:id/assign", handler.AssignOutlier)
+	as := func(userID, method, path string, body interface{}) *httptest.ResponseRecorder {
+		encoded, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(encoded))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test-User", userID)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	queue := func(userID, query string) []string {
+		w := as(userID, "GET", "/outliers"+query, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp internalapi.OutlierListResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		var ids []string
+		for _, outlier := range resp.Outliers {
+			ids = append(ids, outlier.ID)
+		}
+		return ids
+	}
+
+	w := as("lead", "POST", "/outliers/o2/assign", map[string]string{"user_id": "analyst-1"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var assignment internalapi.OutlierAssignment
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &assignment))
+	assert.Equal(t, "analyst-1", assignment.AssignedTo)
+	assert.Equal(t, "lead", assignment.AssignedBy)
+	assert.Empty(t, assignment.PreviousAssignee)
+
+	require.Equal(t, http.StatusOK, as("lead", "POST", "/outliers/o4/assign", map[string]string{"user_id": "analyst-1"}).Code)
+	require.Equal(t, http.StatusOK, as("lead", "POST", "/outliers/o4/assign", map[string]string{"user_id": "analyst-2"}).Code)
+	require.Equal(t, http.StatusOK, as("lead", "POST", "/outliers/o5/assign", map[string]string{"user_id": "analyst-2"}).Code)
+	require.Equal(t, http.StatusOK, as("lead", "POST", "/outliers/o5/assign", map[string]string{}).Code)
+
+	assert.Equal(t, []string{"o2"}, queue("analyst-1", "?assigned_to=me"))
+	assert.Equal(t, []string{"o4"}, queue("analyst-1", "?assigned_to=analyst-2"))
+	assert.Equal(t, []string{"o5", "o3", "o1"}, queue("lead", "?assigned_to=none"))
+	assert.Equal(t, http.StatusBadRequest, as("", "GET", "/outliers?assigned_to=me", nil).Code)
+
+	assert.Equal(t, http.StatusBadRequest, as("lead", "POST", "/outliers/o1/assign", map[string]string{"user_id": "nobody"}).Code)
+	assert.Equal(t, http.StatusBadRequest, as("lead", "POST", "/outliers/o1/assign", map[string]string{"user_id": "former"}).Code)
+	assert.Equal(t, http.StatusNotFound, as("lead", "POST", "/outliers/missing/assign", map[string]string{"user_id": "analyst-1"}).Code)
+
+	// Every change is audited, reassignments with the previous assignee
+	require.NoError(t, auditLogger.Close())
+	rows, err := auditDB.Query(`SELECT action, details FROM audit_logs WHERE action LIKE 'outlier_%' ORDER BY sequence`)
+	require.NoError(t, err)
+	defer rows.Close()
+	var actions []string
+	for rows.Next() {
+		var action, details string
+		require.NoError(t, rows.Scan(&action, &details))
+		actions = append(actions, action)
+		if action == "outlier_reassigned" {
+			assert.Contains(t, details, `"previous_assignee":"analyst-1"`)
+			assert.Contains(t, details, `"assigned_to":"analyst-2"`)
+		}
+	}
+	assert.Equal(t, []string{"outlier_assigned", "outlier_assigned", "outlier_reassigned", "outlier_assigned", "outlier_unassigned"}, actions)
+}
+
+// readNDJSON decodes each line of an NDJSON body into a map
+func readNDJSON(t *testing.T, body string) []map[string]interface{} {
+	var values []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		var value map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &value), line)
+		values = append(values, value)
+	}
+	return values
+}
+
+func TestOutlierHandler_ListOutliers_Stream(t *testing.T) {
+	router, db := setupOutlierListRouter(t)
+	// More than one flush of rows
+	for i := 0; i < 250; i++ {
+		_, err := db.Exec(`INSERT INTO outliers (id, detected_at, type, severity, address) VALUES (?, ?, 'zscore', 'low', 'TAddrS')`,
+			fmt.Sprintf("s%03d", i), time.Date(2025, 1, 1, 0, 0, i, 0, time.UTC))
+		require.NoError(t, err)
+	}
+
+	req := httptest.NewRequest("GET", "/outliers?address=TAddrS&limit=10", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	rows := readNDJSON(t, w.Body.String())
+	require.Len(t, rows, 250, "every match, ignoring limit")
+	assert.Equal(t, "s249", rows[0]["id"], "newest first")
+	assert.Equal(t, "s000", rows[249]["id"])
+
+	// ?stream=true honours filters, sort and a cursor to resume after
+	w = doJSON(router, "GET", "/outliers?stream=true&severity=high,critical&sort=detected_at", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var ids []interface{}
+	for _, row := range readNDJSON(t, w.Body.String()) {
+		ids = append(ids, row["id"])
+	}
+	assert.Equal(t, []interface{}{"o2", "o3", "o5"}, ids)
+
+	w = doJSON(router, "GET", "/outliers?stream=true&after_id=o4&after_detected_at=2026-01-01T00:00:04Z", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	rows = readNDJSON(t, w.Body.String())
+	assert.Equal(t, "o3", rows[0]["id"])
+	assert.Len(t, rows, 253)
+
+	// Invalid filters are still rejected before streaming starts
+	w = doJSON(router, "GET", "/outliers?stream=true&severity=urgent", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOutlierHandler_GetOutlier_ETag(t *testing.T) {
+	_, db := setupOutlierListRouter(t)
+	handler := handlers.NewOutlierHandler(db, nil)
+	router := gin.New()
+	router.GET("/outliers/:id", handler.GetOutlier)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/outliers/o1", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+
+	// An unchanged outlier is not sent again, whether the client names the
+	// ETag alone, weakly or in a list
+	for _, ifNoneMatch := range []string{etag, "W/" + etag, `"stale", ` + etag} {
+		w = get(ifNoneMatch)
+		assert.Equal(t, http.StatusNotModified, w.Code, ifNoneMatch)
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+	}
+
+	setTriage(t, db, "o1", `acknowledged = true`)
+	w = get(etag)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
+
+func setupOutlierArchiveRouter(t *testing.T) (*gin.Engine, *sql.DB) {
+	router, db := setupOutlierListRouter(t)
+	handler := handlers.NewOutlierHandler(db, nil)
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "analyst-1")
+		c.Next()
+	})
+	router.POST("/outliers/:id/archive", handler.ArchiveOutlier)
+	router.POST("/outliers/archive", handler.BulkArchiveOutliers)
+	return router, db
+}
+
+func TestOutlierHandler_ArchiveOutlier(t *testing.T) {
+	router, db := setupOutlierArchiveRouter(t)
+
+	w := doJSON(router, "POST", "/outliers/o3/archive", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var by string
+	require.NoError(t, db.QueryRow(`SELECT archived_by FROM outlier_triage WHERE outlier_id = 'o3'`).Scan(&by))
+	assert.Equal(t, "analyst-1", by)
+
+	// Archived outliers leave default listings but can still be asked for
+	ids, total := listOutlierIDs(t, router, "")
+	assert.Equal(t, []string{"o5", "o4", "o2", "o1"}, ids)
+	assert.Equal(t, 4, total)
+	ids, _ = listOutlierIDs(t, router, "?archived=false")
+	assert.Equal(t, []string{"o5", "o4", "o2", "o1"}, ids)
+	resp, ids := listOutliers(t, router, "?archived=true")
+	assert.Equal(t, []string{"o3"}, ids)
+	assert.Equal(t, "analyst-1", resp.Outliers[0].ArchivedBy)
+	assert.False(t, resp.Outliers[0].ArchivedAt.IsZero())
+	ids, _ = listOutlierIDs(t, router, "?archived=all&severity=high")
+	assert.Equal(t, []string{"o5", "o3"}, ids)
+
+	assert.Equal(t, http.StatusConflict, doJSON(router, "POST", "/outliers/o3/archive", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "POST", "/outliers/missing/archive", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/outliers?archived=maybe", nil).Code)
+}
+
+func TestOutlierHandler_BulkArchive(t *testing.T) {
+	router, _ := setupOutlierArchiveRouter(t)
+
+	w := doJSON(router, "POST", "/outliers/archive", map[string]interface{}{
+		"ids": []string{"o1", "missing", "o1"},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp internalapi.BulkArchiveResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Archived)
+	assert.Equal(t, []internalapi.BulkArchiveResult{
+		{ID: "o1", Status: "archived"},
+		{ID: "missing", Status: "not_found"},
+	}, resp.Results)
+
+	// A filter only selects live outliers, even when it asks for archived ones
+	w = doJSON(router, "POST", "/outliers/archive", map[string]interface{}{
+		"filter": map[string]interface{}{"address": []string{"TAddrA"}, "archived": "all"},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Archived)
+	assert.Equal(t, []internalapi.BulkArchiveResult{{ID: "o4", Status: "archived"}}, resp.Results)
+
+	w = doJSON(router, "POST", "/outliers/archive", map[string]interface{}{"ids": []string{"o4", "o5"}})
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []internalapi.BulkArchiveResult{
+		{ID: "o4", Status: "already_archived"},
+		{ID: "o5", Status: "archived"},
+	}, resp.Results)
+
+	ids, _ := listOutlierIDs(t, router, "")
+	assert.Equal(t, []string{"o3", "o2"}, ids)
+
+	for name, body := range map[string]interface{}{
+		"neither":      map[string]interface{}{},
+		"both":         map[string]interface{}{"ids": []string{"o2"}, "filter": map[string]interface{}{}},
+		"bad severity": map[string]interface{}{"filter": map[string]interface{}{"severity": []string{"urgent"}}},
+	} {
+		assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/outliers/archive", body).Code, name)
+	}
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// setupPasswordRouter serves the auth and user password endpoints as the
+// user "viewer-id", whose password is "viewer-pass"
+func setupPasswordRouter(t *testing.T) (*gin.Engine, *sql.DB) {
+	db := setupUsersDB(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("viewer-pass"), bcrypt.MinCost)
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE users SET password_hash = ? WHERE id = 'viewer-id'`, string(hash))
+	require.NoError(t, err)
+
+	passwords := setupTestPasswordManager()
+	authHandler := handlers.NewAuthHandler(db, setupTestJWTManager(), passwords, nil)
+	userHandler := handlers.NewUserHandler(db, passwords, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/auth/password/reset", authHandler.ResetPassword)
+	router.POST("/auth/login", authHandler.Login)
+	router.POST("/auth/refresh", authHandler.RefreshToken)
+	router.POST("/auth/password", func(c *gin.Context) { c.Set("user_id", "viewer-id") }, authHandler.ChangePassword)
+	router.POST("/users/:id/password-reset", func(c *gin.Context) { c.Set("user_id", "admin-id") }, userHandler.IssuePasswordReset)
+	return router, db
+}
+
+func login(router *gin.Engine, password string) int {
+	return doJSON(router, "POST", "/auth/login", map[string]string{"username": "viewer", "password": password}).Code
+}
+
+// loginRefreshToken logs in and returns the refresh token
+func loginRefreshToken(t *testing.T, router *gin.Engine, password string) string {
+	w := doJSON(router, "POST", "/auth/login", map[string]string{"username": "viewer", "password": password})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp models.LoginResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.NotEmpty(t, resp.RefreshToken)
+	return resp.RefreshToken
+}
+
+func refresh(router *gin.Engine, refreshToken string) int {
+	return doJSON(router, "POST", "/auth/refresh", map[string]string{"refresh_token": refreshToken}).Code
+}
+
+// passTime moves the viewer's password change into the past, as if the
+// next login came a while after it
+func passTime(t *testing.T, db *sql.DB) {
+	_, err := db.Exec(`UPDATE users SET password_changed_at = ? WHERE id = 'viewer-id'`, time.Now().UTC().Add(-time.Minute))
+	require.NoError(t, err)
+}
+
+func TestAuthHandler_ChangePasswordRevokesRefreshTokens(t *testing.T) {
+	router, db := setupPasswordRouter(t)
+	stolen := loginRefreshToken(t, router, "viewer-pass")
+	require.Equal(t, http.StatusOK, refresh(router, stolen))
+
+	w := doJSON(router, "POST", "/auth/password", map[string]string{"current_password": "viewer-pass", "new_password": "new-password"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, refresh(router, stolen))
+
+	passTime(t, db)
+	assert.Equal(t, http.StatusOK, refresh(router, loginRefreshToken(t, router, "new-password")))
+}
+
+func TestPasswordReset_RevokesRefreshTokens(t *testing.T) {
+	router, db := setupPasswordRouter(t)
+	stolen := loginRefreshToken(t, router, "viewer-pass")
+
+	w := doJSON(router, "POST", "/users/viewer-id/password-reset", nil)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var reset internalapi.PasswordResetResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reset))
+
+	w = doJSON(router, "POST", "/auth/password/reset", map[string]string{"token": reset.ResetToken, "new_password": "reset-password"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, refresh(router, stolen))
+
+	passTime(t, db)
+	assert.Equal(t, http.StatusOK, refresh(router, loginRefreshToken(t, router, "reset-password")))
+}
+
+func TestAuthHandler_ChangePassword(t *testing.T) {
+	router, _ := setupPasswordRouter(t)
+
+	w := doJSON(router, "POST", "/auth/password", map[string]string{"current_password": "wrong-pass", "new_password": "new-password"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Current password is incorrect")
+
+	w = doJSON(router, "POST", "/auth/password", map[string]string{"current_password": "viewer-pass", "new_password": "short"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(router, "POST", "/auth/password", map[string]string{"current_password": "viewer-pass", "new_password": "new-password"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	assert.Equal(t, http.StatusUnauthorized, login(router, "viewer-pass"))
+	assert.Equal(t, http.StatusOK, login(router, "new-password"))
+}
+
+func TestPasswordReset_OneTimeToken(t *testing.T) {
+	router, _ := setupPasswordRouter(t)
+
+	w := doJSON(router, "POST", "/users/viewer-id/password-reset", nil)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var first internalapi.PasswordResetResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+	assert.Len(t, first.ResetToken, 64)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), first.ExpiresAt, time.Minute)
+
+	// A second reset revokes the first token
+	w = doJSON(router, "POST", "/users/viewer-id/password-reset", nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var second internalapi.PasswordResetResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &second))
+
+	w = doJSON(router, "POST", "/auth/password/reset", map[string]string{"token": first.ResetToken, "new_password": "reset-password"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The old password works until the token is redeemed
+	assert.Equal(t, http.StatusOK, login(router, "viewer-pass"))
+
+	w = doJSON(router, "POST", "/auth/password/reset", map[string]string{"token": second.ResetToken, "new_password": "reset-password"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusOK, login(router, "reset-password"))
+
+	w = doJSON(router, "POST", "/auth/password/reset", map[string]string{"token": second.ResetToken, "new_password": "another-password"})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "tokens work once")
+
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "POST", "/users/missing/password-reset", nil).Code)
+}
+
+func TestPasswordReset_ExpiredToken(t *testing.T) {
+	router, db := setupPasswordRouter(t)
+
+	w := doJSON(router, "POST", "/users/viewer-id/password-reset", nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var reset internalapi.PasswordResetResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reset))
+
+	_, err := db.Exec(`UPDATE password_reset_tokens SET expires_at = ?`, time.Now().UTC().Add(-time.Minute))
+	require.NoError(t, err)
+
+	w = doJSON(router, "POST", "/auth/password/reset", map[string]string{"token": reset.ResetToken, "new_password": "reset-password"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, http.StatusOK, login(router, "viewer-pass"))
+}
+
+func TestLogin_RehashesBcryptToArgon2id(t *testing.T) {
+	db := setupUsersDB(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("viewer-pass"), bcrypt.MinCost)
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE users SET password_hash = ? WHERE id = 'viewer-id'`, string(hash))
+	require.NoError(t, err)
+
+	passwords := security.NewPasswordManager(security.PasswordConfig{
+		MinLength: 8,
+		Algorithm: security.PasswordAlgorithmArgon2id,
+		Argon2:    security.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1},
+	})
+	authHandler := handlers.NewAuthHandler(db, setupTestJWTManager(), passwords, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/auth/login", authHandler.Login)
+
+	assert.Equal(t, http.StatusUnauthorized, login(router, "wrong-pass"))
+	var stored string
+	require.NoError(t, db.QueryRow(`SELECT password_hash FROM users WHERE id = 'viewer-id'`).Scan(&stored))
+	assert.Equal(t, string(hash), stored, "failed logins leave the hash alone")
+
+	assert.Equal(t, http.StatusOK, login(router, "viewer-pass"))
+	require.NoError(t, db.QueryRow(`SELECT password_hash FROM users WHERE id = 'viewer-id'`).Scan(&stored))
+	assert.True(t, strings.HasPrefix(stored, "$argon2id$"), stored)
+
+	// The migrated password still works
+	assert.Equal(t, http.StatusOK, login(router, "viewer-pass"))
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/reports"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupReportRouter(t *testing.T) *gin.Engine {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE outliers (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001',
+			detected_at DATETIME NOT NULL,
+			type TEXT NOT NULL,
+			severity TEXT NOT NULL,
+			address TEXT NOT NULL DEFAULT '',
+			transaction_hash TEXT NOT NULL DEFAULT '',
+			amount REAL NOT NULL DEFAULT 0,
+			invalidated BOOLEAN NOT NULL DEFAULT false
+		);
+		CREATE TABLE outlier_triage (
+			outlier_id TEXT NOT NULL,
+			org_id TEXT NOT NULL,
+			acknowledged BOOLEAN NOT NULL DEFAULT false
+		)
+	`)
+	require.NoError(t, err)
+
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	_, yesterday, _ := reports.Day(time.Now().AddDate(0, 0, -1))
+	_, err = db.Exec(`
+		INSERT INTO outliers (id, org_id, detected_at, type, severity, address, transaction_hash, amount)
+		VALUES
+			('o1', '00000000-0000-0000-0000-000000000001', $1, 'zscore', 'high', 'TA', 'tx1', 250000),
+			('o2', 'org-2', $1, 'zscore', 'critical', 'TB', 'tx2', 100),
+			('o3', '00000000-0000-0000-0000-000000000001', $2, 'iqr', 'low', 'TC', 'tx3', 10)
+	`, day.Add(time.Hour), yesterday.Add(time.Hour))
+	require.NoError(t, err)
+
+	handler := handlers.NewReportHandler(reports.NewGenerator(db, nil), "https://stablerisk.test", nil)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/reports/daily", handler.GetDailyReport)
+	return router
+}
+
+func TestReportHandler_GetDailyReport(t *testing.T) {
+	router := setupReportRouter(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/reports/daily?date=2025-01-15", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var report reports.DailyReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, "2025-01-15", report.Date)
+	assert.Equal(t, models.DefaultOrganizationID, report.OrgID)
+	assert.Equal(t, 1, report.TotalOutliers)
+	require.Len(t, report.LargestTransfers, 1)
+	assert.Equal(t, "tx1", report.LargestTransfers[0].TransactionHash)
+
+	// Yesterday by default
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/reports/daily", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var yesterday reports.DailyReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &yesterday))
+	assert.Equal(t, time.Now().UTC().AddDate(0, 0, -1).Format(reports.DateLayout), yesterday.Date)
+	assert.Equal(t, map[models.OutlierType]int{models.OutlierTypeIQR: 1}, yesterday.ByType)
+}
+
+func TestReportHandler_Formats(t *testing.T) {
+	router := setupReportRouter(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/reports/daily?date=2025-01-15&format=html", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "StableRisk daily report for 2025-01-15")
+	assert.Contains(t, w.Body.String(), `href="https://stablerisk.test"`)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/reports/daily?date=2025-01-15&format=pdf", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="stablerisk-daily-2025-01-15.pdf"`, w.Header().Get("Content-Disposition"))
+	assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF-")))
+}
+
+func TestReportHandler_RejectsInvalidQueries(t *testing.T) {
+	router := setupReportRouter(t)
+
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format(reports.DateLayout)
+	for _, query := range []string{"date=15-01-2025", "date=" + tomorrow, "format=csv"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/reports/daily?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
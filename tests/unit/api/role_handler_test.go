@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupRoleRouter(db *sql.DB) (*gin.Engine, *security.RoleStore) {
+	roles := security.NewRoleStore(db, security.RoleStoreConfig{CacheTTL: time.Hour}, nil)
+	handler := handlers.NewRoleHandler(roles, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/roles", handler.ListRoles)
+	router.POST("/roles", handler.CreateRole)
+	router.GET("/roles/:name", handler.GetRole)
+	router.PUT("/roles/:name", handler.UpdateRole)
+	router.DELETE("/roles/:name", handler.DeleteRole)
+	return router, roles
+}
+
+func TestRoleHandler_ListBuiltInRoles(t *testing.T) {
+	router, _ := setupRoleRouter(setupUsersDB(t))
+
+	w := doJSON(router, "GET", "/roles", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var list internalapi.RoleListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+
+	require.Len(t, list.Roles, 3)
+	assert.Len(t, list.Permissions, len(middleware.Permissions))
+	for _, role := range list.Roles {
+		assert.True(t, role.BuiltIn)
+		assert.ElementsMatch(t, security.DefaultRoles[role.Name], role.Permissions, "the seed matches the defaults for %s", role.Name)
+	}
+}
+
+func TestRoleHandler_CustomRoleLifecycle(t *testing.T) {
+	db := setupUsersDB(t)
+	router, _ := setupRoleRouter(db)
+
+	w := doJSON(router, "POST", "/roles", map[string]interface{}{
+		"name": "auditor", "description": "Reads users and outliers", "permissions": []string{"read:users", "read:outliers"},
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var role models.RoleDefinition
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &role))
+	assert.Equal(t, []string{"read:outliers", "read:users"}, role.Permissions)
+	assert.False(t, role.BuiltIn)
+
+	assert.Equal(t, http.StatusConflict, doJSON(router, "POST", "/roles", map[string]interface{}{
+		"name": "auditor", "permissions": []string{},
+	}).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/roles", map[string]interface{}{
+		"name": "Bad Name", "permissions": []string{},
+	}).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/roles", map[string]interface{}{
+		"name": "hacker", "permissions": []string{"delete:everything"},
+	}).Code)
+
+	// Users can be given the new role
+	users := setupUserRouter(db)
+	w = doJSON(users, "POST", "/users", map[string]string{"username": "auditor1", "password": "s3cret-pass", "role": "auditor"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusBadRequest, doJSON(users, "POST", "/users", map[string]string{
+		"username": "nobody", "password": "s3cret-pass", "role": "missing",
+	}).Code)
+
+	w = doJSON(router, "PUT", "/roles/auditor", map[string]interface{}{"permissions": []string{"read:users"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &role))
+	assert.Equal(t, []string{"read:users"}, role.Permissions)
+	assert.Equal(t, "Reads users and outliers", role.Description, "omitted fields are unchanged")
+
+	assert.Equal(t, http.StatusConflict, doJSON(router, "DELETE", "/roles/auditor", nil).Code, "still assigned")
+	_, err := db.Exec(`UPDATE users SET role = 'viewer' WHERE username = 'auditor1'`)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", "/roles/auditor", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/roles/auditor", nil).Code)
+}
+
+func TestRoleHandler_ProtectsBuiltInRoles(t *testing.T) {
+	router, _ := setupRoleRouter(setupUsersDB(t))
+
+	assert.Equal(t, http.StatusConflict, doJSON(router, "DELETE", "/roles/viewer", nil).Code)
+	assert.Equal(t, http.StatusConflict, doJSON(router, "PUT", "/roles/admin", map[string]interface{}{
+		"permissions": []string{"read:outliers"},
+	}).Code)
+
+	// Other built-in roles' permissions can change
+	w := doJSON(router, "PUT", "/roles/viewer", map[string]interface{}{
+		"permissions": []string{"read:outliers"},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "PUT", "/roles/missing", map[string]interface{}{
+		"description": "x",
+	}).Code)
+}
+
+func TestRBAC_CustomRolePermissions(t *testing.T) {
+	db := setupUsersDB(t)
+	router, roles := setupRoleRouter(db)
+
+	rbac := middleware.NewRBACMiddleware(nil)
+	rbac.SetRoles(roles)
+	guarded := gin.New()
+	guarded.Use(func(c *gin.Context) { c.Set(middleware.ContextKeyRole, "auditor") })
+	guarded.GET("/users", rbac.RequirePermission(middleware.PermissionReadUsers), func(c *gin.Context) { c.Status(http.StatusOK) })
+	guarded.GET("/outliers", rbac.RequirePermission(middleware.PermissionReadOutliers), func(c *gin.Context) { c.Status(http.StatusOK) })
+	guarded.GET("/profile", rbac.RequireUser(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	assert.Equal(t, http.StatusForbidden, doJSON(guarded, "GET", "/users", nil).Code, "unknown roles have no permissions")
+
+	require.Equal(t, http.StatusCreated, doJSON(router, "POST", "/roles", map[string]interface{}{
+		"name": "auditor", "permissions": []string{"read:users"},
+	}).Code)
+	assert.Equal(t, http.StatusOK, doJSON(guarded, "GET", "/users", nil).Code)
+	assert.Equal(t, http.StatusForbidden, doJSON(guarded, "GET", "/outliers", nil).Code)
+	assert.Equal(t, http.StatusOK, doJSON(guarded, "GET", "/profile", nil).Code)
+
+	// Edits through the store apply immediately on this instance
+	require.Equal(t, http.StatusOK, doJSON(router, "PUT", "/roles/auditor", map[string]interface{}{
+		"permissions": []string{"read:users", "read:outliers"},
+	}).Code)
+	assert.Equal(t, http.StatusOK, doJSON(guarded, "GET", "/outliers", nil).Code)
+}
+
+func TestRoleStore_CachesPermissions(t *testing.T) {
+	db := setupUsersDB(t)
+	roles := security.NewRoleStore(db, security.RoleStoreConfig{CacheTTL: time.Hour}, nil)
+	ctx := context.Background()
+
+	assert.False(t, roles.HasPermission(ctx, models.RoleViewer, "write:outliers"))
+
+	// Changes made elsewhere are picked up once the cache expires
+	_, err := db.Exec(`INSERT INTO role_permissions (role, permission) VALUES ('viewer', 'write:outliers')`)
+	require.NoError(t, err)
+	assert.False(t, roles.HasPermission(ctx, models.RoleViewer, "write:outliers"))
+
+	roles.Invalidate()
+	assert.True(t, roles.HasPermission(ctx, models.RoleViewer, "write:outliers"))
+}
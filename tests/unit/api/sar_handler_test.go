@@ -0,0 +1,199 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/internal/reports"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSARRaphtory answers the transaction and subgraph queries of a TAddrA
+// draft
+func fakeSARRaphtory(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/graph/transactions":
+			assert.Equal(t, "TAddrA", r.URL.Query().Get("address"))
+			w.Write([]byte(`{"total": 3, "transactions": [
+				{"tx_hash": "0x2", "from": "TAddrA", "to": "TAddrB", "amount": "400", "block_number": 2, "timestamp": 1767225601},
+				{"tx_hash": "0x1", "from": "TAddrX", "to": "TAddrA", "amount": "500", "block_number": 1, "timestamp": 1767225600}
+			]}`))
+		case "/graph/subgraph/TAddrA":
+			assert.Equal(t, "1", r.URL.Query().Get("hops"))
+			w.Write([]byte(`{
+				"address": "TAddrA", "hops": 1, "truncated": false,
+				"nodes": [
+					{"address": "TAddrA", "hop": 0, "transaction_count": 2, "sent": "400", "received": "500"},
+					{"address": "TAddrX", "hop": 1, "transaction_count": 1, "sent": "500", "received": "0"},
+					{"address": "TAddrB", "hop": 1, "transaction_count": 1, "sent": "0", "received": "400"}
+				],
+				"edges": [
+					{"from": "TAddrX", "to": "TAddrA", "transaction_count": 1, "amount": "500"},
+					{"from": "TAddrA", "to": "TAddrB", "transaction_count": 1, "amount": "400"}
+				]
+			}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+// setupSARRouter adds a velocity outlier on TAddrA and analysts' notes to
+// the outlier list fixtures, encrypting the notes
+func setupSARRouter(t *testing.T, raphtoryHandler http.HandlerFunc) *gin.Engine {
+	_, db := setupOutlierListRouter(t)
+	cipher := setupTestCipher(t)
+
+	at := time.Date(2026, 1, 1, 0, 0, 10, 0, time.UTC)
+	ackNotes, err := cipher.Encrypt("Large inbound from a new counterparty")
+	require.NoError(t, err)
+	statusNotes, err := cipher.Encrypt("Escalated to compliance")
+	require.NoError(t, err)
+	_, err = db.Exec(`
+		INSERT INTO outliers (id, detected_at, type, severity, address, amount) VALUES ('o6', ?, 'pattern_velocity', 'high', 'TAddrA', 0);
+		INSERT INTO outliers (id, detected_at, type, severity, address, invalidated) VALUES ('o7', ?, 'zscore', 'critical', 'TAddrA', true);
+		INSERT INTO outlier_triage (id, outlier_id, org_id, acknowledged, acknowledged_by, acknowledged_at, notes)
+		VALUES ('t4', 'o4', ?, true, 'analyst-id', ?, ?);
+		INSERT INTO outlier_status_history (id, outlier_id, org_id, from_status, to_status, changed_by, changed_at, notes)
+		VALUES ('h1', 'o1', ?, 'open', 'investigating', 'admin-id', ?, ?);
+	`, at, at, models.DefaultOrganizationID, at.Add(time.Minute), ackNotes,
+		models.DefaultOrganizationID, at.Add(2*time.Minute), statusNotes)
+	require.NoError(t, err)
+
+	raphtory := httptest.NewServer(raphtoryHandler)
+	t.Cleanup(raphtory.Close)
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: raphtory.URL}, nil)
+
+	outliers := handlers.NewOutlierHandler(db, nil)
+	outliers.SetCipher(cipher)
+	handler := handlers.NewSARHandler(db, client, outliers, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("username", "analyst") })
+	router.GET("/reports/sar", handler.GetSARDraft)
+	return router
+}
+
+// getSARDraft fetches a draft as JSON
+func getSARDraft(t *testing.T, router *gin.Engine, query string) reports.SARDraft {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/reports/sar?format=json&"+query, nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var draft reports.SARDraft
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &draft))
+	return draft
+}
+
+func TestSARHandler_DraftForIncident(t *testing.T) {
+	router := setupSARRouter(t, fakeSARRaphtory(t))
+
+	// o1's incident is the zscore outliers on TAddrA, without the invalidated o7
+	draft := getSARDraft(t, router, "outlier_id=o1")
+	assert.Regexp(t, `^SAR-\d{8}-[0-9A-F]{8}$`, draft.Reference)
+	assert.Equal(t, "TAddrA", draft.Subject)
+	assert.Equal(t, "stablerisk:"+models.DefaultOrganizationID+":zscore:TAddrA", draft.IncidentKey)
+	assert.Equal(t, "analyst", draft.GeneratedBy)
+	require.Len(t, draft.Outliers, 2)
+	assert.Equal(t, "o1", draft.Outliers[0].ID)
+	assert.Equal(t, "o4", draft.Outliers[1].ID)
+	assert.Equal(t, draft.Outliers[0].DetectedAt.Unix(), draft.ActivityFrom.Unix())
+	assert.Equal(t, draft.Outliers[1].DetectedAt.Unix(), draft.ActivityTo.Unix())
+
+	// Notes from acknowledgement and status changes, decrypted, oldest first
+	require.Len(t, draft.Notes, 2)
+	assert.Equal(t, reports.SARNote{OutlierID: "o4", Author: "analyst-id", At: draft.Notes[0].At,
+		Text: "Large inbound from a new counterparty"}, draft.Notes[0])
+	assert.Equal(t, "Escalated to compliance", draft.Notes[1].Text)
+	assert.Equal(t, "admin-id", draft.Notes[1].Author)
+
+	// Graph snapshot, busiest counterparties first, with their own risk
+	require.Len(t, draft.Transactions, 2)
+	assert.Equal(t, "0x2", draft.Transactions[0].TxHash)
+	require.Len(t, draft.Counterparties, 2)
+	assert.Equal(t, "TAddrB", draft.Counterparties[0].Address)
+	assert.Equal(t, 1, draft.Counterparties[0].Outliers)
+	assert.Equal(t, models.SeverityCritical, draft.Counterparties[0].HighestSeverity)
+	assert.Equal(t, "TAddrX", draft.Counterparties[1].Address)
+	assert.Zero(t, draft.Counterparties[1].Outliers)
+	assert.Len(t, draft.Flows, 2)
+	assert.Equal(t, []string{"Only the newest 2 of 3 transactions are listed."}, draft.Gaps)
+
+	require.NotEmpty(t, draft.Narrative)
+	assert.Contains(t, draft.Narrative[0], "flagged 2 outliers on address TAddrA as one incident")
+}
+
+func TestSARHandler_DraftForAddress(t *testing.T) {
+	router := setupSARRouter(t, fakeSARRaphtory(t))
+
+	draft := getSARDraft(t, router, "address=TAddrA")
+	assert.Empty(t, draft.IncidentKey)
+	ids := make([]string, len(draft.Outliers))
+	for i, outlier := range draft.Outliers {
+		ids[i] = outlier.ID
+	}
+	assert.Equal(t, []string{"o1", "o4", "o6"}, ids)
+}
+
+func TestSARHandler_RaphtoryDown(t *testing.T) {
+	router := setupSARRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	draft := getSARDraft(t, router, "outlier_id=o1")
+	require.Len(t, draft.Outliers, 2)
+	assert.Empty(t, draft.Transactions)
+	assert.Empty(t, draft.Counterparties)
+	assert.Equal(t, []string{
+		"Transactions could not be read from the graph.",
+		"The graph snapshot could not be read from the graph.",
+	}, draft.Gaps)
+}
+
+func TestSARHandler_Formats(t *testing.T) {
+	router := setupSARRouter(t, fakeSARRaphtory(t))
+
+	// PDF by default
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/reports/sar?outlier_id=o1", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Regexp(t, `^attachment; filename="SAR-\d{8}-[0-9A-F]{8}\.pdf"$`, w.Header().Get("Content-Disposition"))
+	assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF-")))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/reports/sar?address=TAddrA&format=docx", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/vnd.openxmlformats-officedocument.wordprocessingml.document", w.Header().Get("Content-Type"))
+	assert.Regexp(t, `\.docx"$`, w.Header().Get("Content-Disposition"))
+	_, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	assert.NoError(t, err)
+}
+
+func TestSARHandler_RejectsInvalidQueries(t *testing.T) {
+	router := setupSARRouter(t, fakeSARRaphtory(t))
+
+	for query, code := range map[string]int{
+		"":                             http.StatusBadRequest,
+		"outlier_id=o1&address=TAddrA": http.StatusBadRequest,
+		"outlier_id=o1&format=csv":     http.StatusBadRequest,
+		"outlier_id=missing":           http.StatusNotFound,
+		"address=TAddrNone":            http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/reports/sar?"+query, nil))
+		assert.Equal(t, code, w.Code, query)
+	}
+}
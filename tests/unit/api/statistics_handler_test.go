@@ -0,0 +1,268 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupStatisticsDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE outliers (id TEXT PRIMARY KEY, org_id TEXT NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001', severity TEXT NOT NULL, type TEXT NOT NULL);
+		CREATE TABLE detection_runs (status TEXT, started_at TIMESTAMP, completed_at TIMESTAMP);
+		INSERT INTO outliers (id, severity, type) VALUES ('1', 'high', 'zscore');
+	`)
+	require.NoError(t, err)
+	return db
+}
+
+func getStatistics(t *testing.T, raphtoryURL string) (int, map[string]json.RawMessage, internalapi.StatisticsResponse) {
+	return getStatisticsQuery(t, raphtoryURL, "")
+}
+
+func getStatisticsQuery(t *testing.T, raphtoryURL, query string) (int, map[string]json.RawMessage, internalapi.StatisticsResponse) {
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: raphtoryURL}, nil)
+	handler := handlers.NewStatisticsHandler(setupStatisticsDB(t), client, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/statistics", handler.GetStatistics)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/statistics"+query, nil))
+
+	var raw map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &raw))
+	var resp internalapi.StatisticsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return w.Code, raw, resp
+}
+
+func TestStatisticsHandler_GraphStats(t *testing.T) {
+	raphtory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/graph/statistics":
+			w.Write([]byte(`{"node_count": 120, "edge_count": 340, "transaction_count": 512,
+				"earliest_time": 1704067200, "latest_time": 1704153600, "persistent": true}`))
+		case "/graph/activity":
+			w.Write([]byte(`{"addresses": []}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer raphtory.Close()
+
+	code, _, resp := getStatistics(t, raphtory.URL)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(512), resp.TotalTransactions)
+	assert.Equal(t, int64(1), resp.TotalOutliers)
+
+	require.NotNil(t, resp.Graph)
+	assert.Equal(t, 120, resp.Graph.NodeCount)
+	assert.Equal(t, 340, resp.Graph.EdgeCount)
+	require.NotNil(t, resp.Graph.EarliestTransaction)
+	assert.True(t, resp.Graph.EarliestTransaction.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, resp.Graph.LatestTransaction.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestStatisticsHandler_RaphtoryUnavailable(t *testing.T) {
+	raphtory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer raphtory.Close()
+
+	// Outlier counts are still served; the graph summary is left out
+	code, raw, resp := getStatistics(t, raphtory.URL)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(1), resp.TotalOutliers)
+	assert.NotContains(t, raw, "graph")
+}
+
+func TestStatisticsHandler_ETag(t *testing.T) {
+	raphtory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer raphtory.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: raphtory.URL}, nil)
+	db := setupStatisticsDB(t)
+	handler := handlers.NewStatisticsHandler(db, client, nil)
+	router := gin.New()
+	router.GET("/statistics", handler.GetStatistics)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/statistics", nil)
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("")
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	w = get(etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	// A new outlier changes the counts, and so the ETag
+	_, err := db.Exec(`INSERT INTO outliers (id, severity, type) VALUES ('2', 'low', 'iqr')`)
+	require.NoError(t, err)
+	w = get(etag)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
+
+func TestStatisticsHandler_Activity(t *testing.T) {
+	var start, end int64
+	raphtory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/graph/statistics":
+			w.Write([]byte(`{"node_count": 3, "edge_count": 3, "transaction_count": 512}`))
+		case "/graph/activity":
+			start, _ = strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+			end, _ = strconv.ParseInt(r.URL.Query().Get("end"), 10, 64)
+			w.Write([]byte(`{"addresses": [
+				{"address": "TAddrA", "in_count": 1, "out_count": 4, "received": "50", "sent": "900"},
+				{"address": "TAddrB", "in_count": 3, "out_count": 0, "received": "700", "sent": "0"},
+				{"address": "TAddrC", "in_count": 2, "out_count": 2, "received": "250", "sent": "100"}
+			]}`))
+		}
+	}))
+	defer raphtory.Close()
+
+	code, _, resp := getStatisticsQuery(t, raphtory.URL, "?window=1h&top=2")
+	require.Equal(t, http.StatusOK, code)
+	require.NotNil(t, resp.Activity)
+	assert.Equal(t, int64(3600), end-start)
+	assert.Equal(t, "1h0m0s", resp.Activity.Window)
+
+	// Every transfer is received once
+	assert.Equal(t, int64(6), resp.Activity.TransactionCount)
+	assert.InDelta(t, 6.0/3600, resp.Activity.TransactionsPerSecond, 1e-9)
+	assert.Equal(t, 3, resp.Activity.ActiveAddresses)
+	assert.Equal(t, "1000", resp.Activity.Volume.String())
+
+	require.Len(t, resp.Activity.TopAddresses, 2)
+	assert.Equal(t, "TAddrA", resp.Activity.TopAddresses[0].Address)
+	assert.Equal(t, "950", resp.Activity.TopAddresses[0].Volume.String())
+	assert.Equal(t, 5, resp.Activity.TopAddresses[0].TransactionCount)
+	assert.Equal(t, "TAddrB", resp.Activity.TopAddresses[1].Address)
+}
+
+func TestStatisticsHandler_InvalidParameters(t *testing.T) {
+	raphtory := httptest.NewServer(http.NotFoundHandler())
+	defer raphtory.Close()
+
+	for _, query := range []string{"?window=forever", "?window=10s", "?window=1000h", "?top=101"} {
+		code, _, _ := getStatisticsQuery(t, raphtory.URL, query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
+
+func getTrends(t *testing.T, db *sql.DB, query string) (int, internalapi.OutlierTrendsResponse) {
+	handler := handlers.NewStatisticsHandler(db, nil, nil)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/statistics/trends", handler.GetOutlierTrends)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/statistics/trends"+query, nil))
+
+	var resp internalapi.OutlierTrendsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return w.Code, resp
+}
+
+func TestStatisticsHandler_GetOutlierTrends(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec(`CREATE TABLE outliers (id TEXT PRIMARY KEY, org_id TEXT NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001', detected_at DATETIME NOT NULL, severity TEXT NOT NULL, type TEXT NOT NULL)`)
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	hour := now.Truncate(time.Hour)
+	for i, row := range []struct {
+		detectedAt         time.Time
+		severity, category string
+	}{
+		{hour, "high", "zscore"},
+		{hour, "critical", "watchlist"},
+		{hour.Add(-2 * time.Hour), "low", "zscore"},
+		{now.AddDate(0, 0, -40), "low", "iqr"}, // Before the default week
+	} {
+		_, err := db.Exec(`INSERT INTO outliers (id, detected_at, severity, type) VALUES (?, ?, ?, ?)`,
+			i, row.detectedAt, row.severity, row.category)
+		require.NoError(t, err)
+	}
+
+	// Hourly, oldest first, with empty hours and absent severities as zeros
+	code, resp := getTrends(t, db, "?days=1&granularity=hour")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "hour", resp.Period.Granularity)
+	require.GreaterOrEqual(t, len(resp.Trends), 25)
+	last := resp.Trends[len(resp.Trends)-1]
+	assert.True(t, last.Start.Equal(hour))
+	assert.Equal(t, hour.Format("2006-01-02T15:04Z"), last.Date)
+	assert.Equal(t, int64(2), last.Total)
+	assert.Equal(t, int64(1), last.Severity["critical"])
+	assert.Equal(t, int64(0), last.Severity["low"])
+	assert.Equal(t, int64(1), last.Type["watchlist"])
+	empty := resp.Trends[len(resp.Trends)-2]
+	assert.Equal(t, int64(0), empty.Total)
+	assert.Equal(t, map[models.OutlierType]int64{"zscore": 0, "watchlist": 0}, empty.Type)
+	assert.Equal(t, int64(1), resp.Trends[len(resp.Trends)-3].Total)
+	for i := 1; i < len(resp.Trends); i++ {
+		assert.Equal(t, time.Hour, resp.Trends[i].Start.Sub(resp.Trends[i-1].Start))
+	}
+
+	// Weekly buckets start on Monday
+	code, resp = getTrends(t, db, "?days=60&granularity=week")
+	require.Equal(t, http.StatusOK, code)
+	var total, iqr int64
+	for _, trend := range resp.Trends {
+		assert.Equal(t, time.Monday, trend.Start.Weekday())
+		total += trend.Total
+		iqr += trend.Type["iqr"]
+	}
+	assert.Equal(t, int64(4), total)
+	assert.Equal(t, int64(1), iqr)
+
+	// Daily over a week by default
+	code, resp = getTrends(t, db, "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 7, resp.Period.Days)
+	assert.Equal(t, "day", resp.Period.Granularity)
+	assert.Len(t, resp.Trends, 8)
+	assert.NotContains(t, resp.Trends[0].Type, models.OutlierType("iqr"))
+
+	code, resp = getTrends(t, db, "?days=90&granularity=month")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, resp.Trends[0].Start.Day())
+
+	for _, query := range []string{"?granularity=minute", "?days=-1", "?days=91"} {
+		code, _ := getTrends(t, db, query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupTransactionRouter serves the transaction routes backed by a fake
+// Raphtory service answering with handler
+func setupTransactionRouter(t *testing.T, handler http.HandlerFunc) *gin.Engine {
+	raphtory := httptest.NewServer(handler)
+	t.Cleanup(raphtory.Close)
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: raphtory.URL}, nil)
+	transactionHandler := handlers.NewTransactionHandler(client, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/transactions", transactionHandler.ListTransactions)
+	router.GET("/transactions/:hash", transactionHandler.GetTransaction)
+	return router
+}
+
+func TestTransactionHandler_ListTransactions(t *testing.T) {
+	router := setupTransactionRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/graph/transactions", r.URL.Path)
+		query := r.URL.Query()
+		assert.Equal(t, "TAddrA", query.Get("address"))
+		assert.Equal(t, "100", query.Get("min_amount"))
+		assert.Equal(t, "1704067200", query.Get("start"))
+		assert.Equal(t, "2", query.Get("limit"))
+		assert.Equal(t, "2", query.Get("offset"))
+		w.Write([]byte(`{"total": 5, "transactions": [
+			{"tx_hash": "0x3", "from": "TAddrA", "to": "TAddrB", "amount": "250", "block_number": 9, "timestamp": 1704067300},
+			{"tx_hash": "0x2", "from": "TAddrC", "to": "TAddrA", "amount": "100", "block_number": 8, "timestamp": 1704067250}
+		]}`))
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET",
+		"/transactions?address=TAddrA&min_amount=100&from=2024-01-01T00:00:00Z&page=2&limit=2", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp internalapi.TransactionListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 5, resp.Total)
+	assert.Equal(t, 2, resp.Page)
+	assert.Equal(t, 3, resp.TotalPages)
+	require.Len(t, resp.Transactions, 2)
+	assert.Equal(t, "0x3", resp.Transactions[0].TxHash)
+	assert.Equal(t, "250", resp.Transactions[0].Amount.String())
+	assert.Empty(t, resp.Labels)
+}
+
+func TestTransactionHandler_ListTransactions_Labels(t *testing.T) {
+	raphtory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"total": 1, "transactions": [
+			{"tx_hash": "0x3", "from": "TAddrA", "to": "0xFEED000000000000000000000000000000000002", "amount": "250", "block_number": 9, "timestamp": 1704067300}
+		]}`))
+	}))
+	t.Cleanup(raphtory.Close)
+
+	db := setupUsersDB(t)
+	createAddressLabelTable(t, db)
+	_, err := db.Exec(`INSERT INTO address_labels (address, label, category, updated_at)
+		VALUES ('0xfeed000000000000000000000000000000000002', 'Bridge escrow', 'bridge', '2026-01-01T00:00:00Z')`)
+	require.NoError(t, err)
+
+	transactionHandler := handlers.NewTransactionHandler(graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: raphtory.URL}, nil), nil)
+	transactionHandler.SetAddressLabels(db)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/transactions", transactionHandler.ListTransactions)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/transactions", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Labels are keyed by the address as it appears in the transactions
+	var resp internalapi.TransactionListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Labels, 1)
+	assert.Equal(t, "Bridge escrow", resp.Labels["0xFEED000000000000000000000000000000000002"].Label)
+}
+
+func TestTransactionHandler_ListTransactions_InvalidParameters(t *testing.T) {
+	router := setupTransactionRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected Raphtory request %s", r.URL)
+	})
+
+	for _, query := range []string{
+		"?limit=1001",
+		"?page=0",
+		"?min_amount=lots",
+		"?min_amount=10&max_amount=5",
+		"?from=2024-02-01T00:00:00Z&to=2024-01-01T00:00:00Z",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/transactions"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestTransactionHandler_GetTransaction(t *testing.T) {
+	router := setupTransactionRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/graph/transaction/0xabc":
+			w.Write([]byte(`{"tx_hash": "0xabc", "from": "TAddrA", "to": "TAddrB", "amount": "42.5", "block_number": 7, "timestamp": 1704067300, "confirmed": false}`))
+		case "/graph/transaction/0xdown":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/transactions/0xabc", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var tx struct {
+		TxHash    string `json:"tx_hash"`
+		Amount    string `json:"amount"`
+		Confirmed bool   `json:"confirmed"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tx))
+	assert.Equal(t, "0xabc", tx.TxHash)
+	assert.Equal(t, "42.5", tx.Amount)
+	assert.False(t, tx.Confirmed)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/transactions/0xmissing", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/transactions/0xdown", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
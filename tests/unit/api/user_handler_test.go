@@ -0,0 +1,354 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func setupUsersDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	createUsersSchema(t, db)
+	return db
+}
+
+// createUsersSchema creates the tables the user handler needs, with a
+// viewer and an admin
+func createUsersSchema(t *testing.T, db *sql.DB) {
+	_, err := db.Exec(`
+		CREATE TABLE organizations (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO organizations (id, name) VALUES ('00000000-0000-0000-0000-000000000001', 'Default');
+		CREATE TABLE users (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001',
+			username TEXT UNIQUE NOT NULL,
+			email TEXT UNIQUE,
+			email_hash TEXT UNIQUE,
+			password_hash TEXT NOT NULL,
+			role TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_login DATETIME,
+			is_active BOOLEAN NOT NULL DEFAULT true,
+			failed_login_attempts INTEGER NOT NULL DEFAULT 0,
+			locked_until DATETIME,
+			password_changed_at DATETIME
+		);
+		CREATE TABLE login_failures (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL,
+			ip_address TEXT NOT NULL,
+			attempted_at DATETIME NOT NULL
+		);
+		CREATE TABLE api_keys (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001',
+			user_id TEXT NOT NULL,
+			key_hash TEXT NOT NULL UNIQUE,
+			key_prefix TEXT NOT NULL DEFAULT '',
+			name TEXT NOT NULL,
+			scopes TEXT NOT NULL DEFAULT '[]',
+			rate_limit INTEGER NOT NULL DEFAULT 0,
+			created_by TEXT,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME,
+			last_used DATETIME,
+			is_active BOOLEAN NOT NULL DEFAULT true
+		);
+		CREATE TABLE password_reset_tokens (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_by TEXT,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			used_at DATETIME
+		);
+		CREATE TABLE roles (
+			name TEXT PRIMARY KEY,
+			description TEXT,
+			built_in BOOLEAN NOT NULL DEFAULT false,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE role_permissions (
+			role TEXT NOT NULL,
+			permission TEXT NOT NULL,
+			PRIMARY KEY (role, permission)
+		);
+		INSERT INTO roles (name, built_in) VALUES ('admin', true), ('analyst', true), ('viewer', true);
+		INSERT INTO role_permissions (role, permission) VALUES
+			('admin', 'read:outliers'), ('admin', 'read:transactions'), ('admin', 'read:statistics'),
+			('admin', 'read:users'), ('admin', 'read:audit'), ('admin', 'stream:transactions'), ('admin', 'write:outliers'),
+			('admin', 'trigger:detection'), ('admin', 'manage:users'), ('admin', 'manage:system'), ('admin', 'manage:webhooks'),
+			('admin', 'export:sar'),
+			('analyst', 'read:outliers'), ('analyst', 'read:transactions'), ('analyst', 'read:statistics'),
+			('analyst', 'stream:transactions'), ('analyst', 'write:outliers'), ('analyst', 'trigger:detection'),
+			('analyst', 'export:sar'),
+			('viewer', 'read:outliers'), ('viewer', 'read:transactions'), ('viewer', 'read:statistics');
+		INSERT INTO users (id, username, email, password_hash, role) VALUES
+			('admin-id', 'admin', 'admin@example.com', 'x', 'admin'),
+			('viewer-id', 'viewer', NULL, 'x', 'viewer');
+	`)
+	require.NoError(t, err)
+}
+
+func setupUserRouter(db *sql.DB) *gin.Engine {
+	handler := handlers.NewUserHandler(db, setupTestPasswordManager(), nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", "admin-id") })
+	router.GET("/users", handler.ListUsers)
+	router.POST("/users", handler.CreateUser)
+	router.GET("/users/:id", handler.GetUser)
+	router.PUT("/users/:id", handler.UpdateUser)
+	router.DELETE("/users/:id", handler.DeleteUser)
+	router.POST("/users/:id/password-reset", handler.IssuePasswordReset)
+	return router
+}
+
+func doJSON(router *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var encoded []byte
+	if body != nil {
+		encoded, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(encoded))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestUserHandler_CreateAndList(t *testing.T) {
+	db := setupUsersDB(t)
+	router := setupUserRouter(db)
+
+	w := doJSON(router, "POST", "/users", map[string]string{
+		"username": "analyst1", "email": "analyst1@example.com", "password": "s3cret-pass", "role": "analyst",
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "s3cret-pass")
+
+	var created models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, models.RoleAnalyst, created.Role)
+	assert.True(t, created.IsActive)
+
+	var hash string
+	require.NoError(t, db.QueryRow(`SELECT password_hash FROM users WHERE id = ?`, created.ID).Scan(&hash))
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte("s3cret-pass")))
+
+	// Usernames are unique
+	w = doJSON(router, "POST", "/users", map[string]string{"username": "analyst1", "password": "other-pass", "role": "viewer"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Passwords follow the policy
+	w = doJSON(router, "POST", "/users", map[string]string{"username": "analyst2", "password": "short", "role": "viewer"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "at least 8 characters")
+
+	w = doJSON(router, "POST", "/users", map[string]string{"username": "bad", "password": "pass", "role": "superuser"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(router, "GET", "/users?limit=2&page=2", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var page internalapi.UserListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, 3, page.Total)
+	assert.Equal(t, 2, page.TotalPages)
+	require.Len(t, page.Users, 1)
+	assert.Equal(t, "viewer", page.Users[0].Username)
+
+	w = doJSON(router, "GET", "/users?role=analyst", nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Users, 1)
+	assert.Equal(t, "analyst1", page.Users[0].Username)
+}
+
+func TestUserHandler_UpdateAndDeactivate(t *testing.T) {
+	router := setupUserRouter(setupUsersDB(t))
+
+	w := doJSON(router, "PUT", "/users/viewer-id", map[string]string{"role": "analyst"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var user models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(t, models.RoleAnalyst, user.Role)
+
+	w = doJSON(router, "DELETE", "/users/viewer-id", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.False(t, user.IsActive)
+
+	w = doJSON(router, "GET", "/users?active=false", nil)
+	var page internalapi.UserListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Users, 1)
+	assert.Equal(t, "viewer-id", page.Users[0].ID)
+
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "PUT", "/users/missing", map[string]string{"role": "viewer"}).Code)
+}
+
+func TestUserHandler_KeepsLastAdmin(t *testing.T) {
+	router := setupUserRouter(setupUsersDB(t))
+
+	assert.Equal(t, http.StatusConflict, doJSON(router, "PUT", "/users/admin-id", map[string]string{"role": "viewer"}).Code)
+	assert.Equal(t, http.StatusConflict, doJSON(router, "DELETE", "/users/admin-id", nil).Code)
+
+	// Once another admin exists the first can step down
+	require.Equal(t, http.StatusOK, doJSON(router, "PUT", "/users/viewer-id", map[string]string{"role": "admin"}).Code)
+	assert.Equal(t, http.StatusOK, doJSON(router, "PUT", "/users/admin-id", map[string]string{"role": "viewer"}).Code)
+}
+
+func TestUserHandler_KeepsLastAdminUnderConcurrentDemotions(t *testing.T) {
+	// A file database, so requests run on their own connections
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "users.db")+"?_busy_timeout=5000")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	createUsersSchema(t, db)
+
+	// The caller keeps every admin permission through a role of its own, so
+	// demoting the admins does not take away its right to demote the rest
+	_, err = db.Exec(`
+		INSERT INTO roles (name) VALUES ('owner');
+		INSERT INTO role_permissions (role, permission) SELECT 'owner', permission FROM role_permissions WHERE role = 'admin';
+		INSERT INTO users (id, username, password_hash, role) VALUES ('owner-id', 'owner', 'x', 'owner');
+	`)
+	require.NoError(t, err)
+	handler := handlers.NewUserHandler(db, setupTestPasswordManager(), nil)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", "owner-id") })
+	router.PUT("/users/:id", handler.UpdateUser)
+
+	ids := []string{"admin-id"}
+	for i := 0; i < 7; i++ {
+		id := fmt.Sprintf("admin-%d", i)
+		_, err = db.Exec(`INSERT INTO users (id, username, password_hash, role) VALUES ($1, $2, 'x', 'admin')`, id, id)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	// Each demotion alone would leave other admins in place
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			doJSON(router, "PUT", "/users/"+id, map[string]string{"role": "viewer"})
+		}(id)
+	}
+	wg.Wait()
+
+	var admins int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM users WHERE role = 'admin' AND is_active = true`).Scan(&admins))
+	assert.Equal(t, 1, admins)
+}
+
+func TestUserHandler_RefusesRolesBeyondCallersPermissions(t *testing.T) {
+	db := setupUsersDB(t)
+	_, err := db.Exec(`
+		INSERT INTO roles (name) VALUES ('user_manager');
+		INSERT INTO role_permissions (role, permission) VALUES
+			('user_manager', 'read:users'), ('user_manager', 'manage:users'), ('user_manager', 'read:outliers');
+		INSERT INTO users (id, username, password_hash, role) VALUES ('manager-id', 'manager', 'x', 'user_manager');
+	`)
+	require.NoError(t, err)
+
+	handler := handlers.NewUserHandler(db, setupTestPasswordManager(), nil)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", "manager-id") })
+	router.POST("/users", handler.CreateUser)
+	router.PUT("/users/:id", handler.UpdateUser)
+
+	// Neither themselves nor anyone else can be given admin
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "PUT", "/users/manager-id", map[string]string{"role": "admin"}).Code)
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "PUT", "/users/viewer-id", map[string]string{"role": "admin"}).Code)
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "POST", "/users", map[string]string{
+		"username": "escalated", "password": "s3cret-pass", "role": "admin",
+	}).Code)
+
+	var role string
+	require.NoError(t, db.QueryRow(`SELECT role FROM users WHERE id = 'manager-id'`).Scan(&role))
+	assert.Equal(t, "user_manager", role)
+
+	// Viewer grants read:transactions and read:statistics, which the
+	// manager lacks; their own role is always assignable
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "POST", "/users", map[string]string{
+		"username": "viewer2", "password": "s3cret-pass", "role": "viewer",
+	}).Code)
+	w := doJSON(router, "POST", "/users", map[string]string{
+		"username": "manager2", "password": "s3cret-pass", "role": "user_manager",
+	})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+}
+
+func TestUserHandler_RefusesChangesToGreaterRoles(t *testing.T) {
+	db := setupUsersDB(t)
+	_, err := db.Exec(`
+		INSERT INTO roles (name) VALUES ('user_manager');
+		INSERT INTO role_permissions (role, permission) VALUES
+			('user_manager', 'read:users'), ('user_manager', 'manage:users'), ('user_manager', 'read:outliers'),
+			('user_manager', 'read:transactions'), ('user_manager', 'read:statistics');
+		INSERT INTO users (id, username, password_hash, role) VALUES
+			('manager-id', 'manager', 'x', 'user_manager'),
+			('admin2-id', 'admin2', 'x', 'admin');
+	`)
+	require.NoError(t, err)
+
+	handler := handlers.NewUserHandler(db, setupTestPasswordManager(), nil)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", "manager-id") })
+	router.PUT("/users/:id", handler.UpdateUser)
+	router.DELETE("/users/:id", handler.DeleteUser)
+	router.POST("/users/:id/password-reset", handler.IssuePasswordReset)
+
+	// Two admins, so the last admin check would not stop either change
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "PUT", "/users/admin2-id", map[string]string{"role": "viewer"}).Code)
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "PUT", "/users/admin2-id", map[string]bool{"is_active": false}).Code)
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "DELETE", "/users/admin2-id", nil).Code)
+
+	// Nor can the manager take the account over by its email or a reset
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "PUT", "/users/admin2-id", map[string]string{"email": "manager@example.com"}).Code)
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "POST", "/users/admin2-id/password-reset", nil).Code)
+
+	var role string
+	var active bool
+	var email sql.NullString
+	require.NoError(t, db.QueryRow(`SELECT role, is_active, email FROM users WHERE id = 'admin2-id'`).Scan(&role, &active, &email))
+	assert.Equal(t, "admin", role)
+	assert.True(t, active)
+	assert.False(t, email.Valid)
+	var tokens int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM password_reset_tokens WHERE user_id = 'admin2-id'`).Scan(&tokens))
+	assert.Zero(t, tokens)
+
+	// Users within the manager's own permissions can still be managed
+	w := doJSON(router, "POST", "/users/viewer-id/password-reset", nil)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = doJSON(router, "DELETE", "/users/viewer-id", nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createWatchlistTables creates the watchlist tables in db
+func createWatchlistTables(t *testing.T, db *sql.DB) {
+	_, err := db.Exec(`
+		CREATE TABLE watchlists (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001',
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			created_by TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL,
+			UNIQUE (org_id, name)
+		);
+		CREATE TABLE watchlist_entries (
+			id TEXT PRIMARY KEY,
+			watchlist_id TEXT NOT NULL REFERENCES watchlists(id) ON DELETE CASCADE,
+			address TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			expires_at DATETIME,
+			added_by TEXT NOT NULL DEFAULT '',
+			added_at DATETIME NOT NULL,
+			UNIQUE (watchlist_id, address)
+		)
+	`)
+	require.NoError(t, err)
+}
+
+func setupWatchlistRouter(t *testing.T) (*gin.Engine, *sql.DB) {
+	db := setupUsersDB(t)
+	createWatchlistTables(t, db)
+
+	handler := handlers.NewWatchlistHandler(db, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "analyst-1")
+		c.Next()
+	})
+	router.GET("/watchlists", handler.ListWatchlists)
+	router.POST("/watchlists", handler.CreateWatchlist)
+	router.GET("/watchlists/:id", handler.GetWatchlist)
+	router.PATCH("/watchlists/:id", handler.UpdateWatchlist)
+	router.DELETE("/watchlists/:id", handler.DeleteWatchlist)
+	router.POST("/watchlists/:id/entries", handler.AddWatchlistEntry)
+	router.PUT("/watchlists/:id/entries/:entry_id", handler.UpdateWatchlistEntry)
+	router.DELETE("/watchlists/:id/entries/:entry_id", handler.RemoveWatchlistEntry)
+	return router, db
+}
+
+func TestWatchlistHandler_Watchlists(t *testing.T) {
+	router, _ := setupWatchlistRouter(t)
+
+	w := doJSON(router, "POST", "/watchlists", map[string]string{"name": "sanctions", "description": "OFAC SDN"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var sanctions internalapi.WatchlistResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sanctions))
+	assert.NotEmpty(t, sanctions.ID)
+	assert.Equal(t, "analyst-1", sanctions.CreatedBy)
+	assert.Empty(t, sanctions.Entries)
+
+	w = doJSON(router, "POST", "/watchlists", map[string]string{"name": "sanctions"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = doJSON(router, "POST", "/watchlists", map[string]string{"name": "  "})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(router, "POST", "/watchlists", map[string]string{"name": "exploits"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var exploits internalapi.WatchlistResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &exploits))
+
+	// Renaming onto another watchlist's name is a conflict
+	w = doJSON(router, "PATCH", "/watchlists/"+exploits.ID, map[string]string{"name": "sanctions"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = doJSON(router, "PATCH", "/watchlists/"+exploits.ID, map[string]string{"description": "Drainer wallets"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &exploits))
+	assert.Equal(t, "exploits", exploits.Name)
+	assert.Equal(t, "Drainer wallets", exploits.Description)
+	w = doJSON(router, "PATCH", "/watchlists/missing", map[string]string{"description": "x"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doJSON(router, "GET", "/watchlists", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list internalapi.WatchlistListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Watchlists, 2)
+	assert.Equal(t, "exploits", list.Watchlists[0].Name)
+	assert.Equal(t, "sanctions", list.Watchlists[1].Name)
+
+	w = doJSON(router, "DELETE", "/watchlists/"+exploits.ID, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, "GET", "/watchlists/"+exploits.ID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doJSON(router, "DELETE", "/watchlists/"+exploits.ID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestWatchlistHandler_Entries(t *testing.T) {
+	router, db := setupWatchlistRouter(t)
+
+	w := doJSON(router, "POST", "/watchlists", map[string]string{"name": "sanctions"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var watchlist internalapi.WatchlistResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &watchlist))
+	entries := "/watchlists/" + watchlist.ID + "/entries"
+
+	expiresAt := time.Now().Add(24 * time.Hour)
+	w = doJSON(router, "POST", entries, map[string]interface{}{
+		"address": "TAddrA", "reason": "Listed 2026-01-01", "expires_at": expiresAt,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var entry models.WatchlistEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+	assert.Equal(t, "TAddrA", entry.Address)
+	assert.Equal(t, "sanctions", entry.WatchlistName)
+	assert.Equal(t, "analyst-1", entry.AddedBy)
+	require.NotNil(t, entry.ExpiresAt)
+
+	// Duplicates, missing fields, past expiries and unknown watchlists
+	w = doJSON(router, "POST", entries, map[string]string{"address": "TAddrA", "reason": "again"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = doJSON(router, "POST", entries, map[string]string{"reason": "no address"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(router, "POST", entries, map[string]string{"address": "TAddrB"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(router, "POST", entries, map[string]interface{}{
+		"address": "TAddrB", "reason": "stale", "expires_at": time.Now().Add(-time.Hour),
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(router, "POST", "/watchlists/missing/entries", map[string]string{"address": "TAddrB", "reason": "x"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Clearing the expiry keeps the address watched indefinitely
+	w = doJSON(router, "PUT", entries+"/"+entry.ID, map[string]string{"reason": "Confirmed"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated models.WatchlistEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, "Confirmed", updated.Reason)
+	assert.Nil(t, updated.ExpiresAt)
+
+	// An entry that has since expired only shows with include_expired
+	_, err := db.Exec(`INSERT INTO watchlist_entries (id, watchlist_id, address, reason, expires_at, added_at)
+		VALUES ('old', ?, 'TAddrC', 'Stale', ?, ?)`,
+		watchlist.ID, time.Now().UTC().Add(-time.Hour), time.Now().UTC().Add(-48*time.Hour))
+	require.NoError(t, err)
+
+	w = doJSON(router, "GET", "/watchlists/"+watchlist.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &watchlist))
+	assert.Equal(t, 1, watchlist.EntryCount)
+	require.Len(t, watchlist.Entries, 1)
+	assert.Equal(t, "TAddrA", watchlist.Entries[0].Address)
+
+	w = doJSON(router, "GET", "/watchlists/"+watchlist.ID+"?include_expired=true", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &watchlist))
+	assert.Len(t, watchlist.Entries, 2)
+
+	w = doJSON(router, "DELETE", entries+"/"+entry.ID, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, "DELETE", entries+"/"+entry.ID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doJSON(router, "PUT", entries+"/"+entry.ID, map[string]string{"reason": "gone"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/security/crypto"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createWebhookTables creates the webhook tables in db
+func createWebhookTables(t *testing.T, db *sql.DB) {
+	_, err := db.Exec(`
+		CREATE TABLE webhooks (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001',
+			url TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			events TEXT NOT NULL DEFAULT '[]',
+			secret TEXT NOT NULL,
+			enabled BOOLEAN NOT NULL DEFAULT 1,
+			created_by TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		);
+		CREATE TABLE webhook_deliveries (
+			id TEXT PRIMARY KEY,
+			webhook_id TEXT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+			event_id TEXT NOT NULL,
+			event_type TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			response_status INTEGER,
+			error TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			last_attempt_at DATETIME,
+			delivered_at DATETIME
+		)
+	`)
+	require.NoError(t, err)
+}
+
+func setupWebhookRouter(t *testing.T, cipher *crypto.Cipher) (*gin.Engine, *sql.DB) {
+	db := setupUsersDB(t)
+	createWebhookTables(t, db)
+
+	handler := handlers.NewWebhookHandler(db, nil)
+	handler.SetCipher(cipher)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "admin-1")
+		c.Next()
+	})
+	router.GET("/webhooks", handler.ListWebhooks)
+	router.POST("/webhooks", handler.CreateWebhook)
+	router.GET("/webhooks/:id", handler.GetWebhook)
+	router.PATCH("/webhooks/:id", handler.UpdateWebhook)
+	router.DELETE("/webhooks/:id", handler.DeleteWebhook)
+	router.POST("/webhooks/:id/rotate-secret", handler.RotateWebhookSecret)
+	router.GET("/webhooks/:id/deliveries", handler.ListWebhookDeliveries)
+	return router, db
+}
+
+func TestWebhookHandler_Webhooks(t *testing.T) {
+	cipher := setupTestCipher(t)
+	router, db := setupWebhookRouter(t, cipher)
+
+	w := doJSON(router, "POST", "/webhooks", map[string]interface{}{
+		"url": "https://hooks.example.com/stablerisk", "description": "SOAR",
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created internalapi.CreateWebhookResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.ID)
+	assert.Equal(t, "admin-1", created.CreatedBy)
+	assert.True(t, created.Enabled)
+	assert.Equal(t, models.WebhookEvents, created.Events)
+	assert.True(t, strings.HasPrefix(created.Secret, "whsec_"))
+
+	// The secret is stored encrypted and never returned again
+	var stored string
+	require.NoError(t, db.QueryRow(`SELECT secret FROM webhooks WHERE id = ?`, created.ID).Scan(&stored))
+	assert.True(t, crypto.IsEncrypted(stored))
+	decrypted, err := cipher.Decrypt(stored)
+	require.NoError(t, err)
+	assert.Equal(t, created.Secret, decrypted)
+	w = doJSON(router, "GET", "/webhooks/"+created.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret")
+
+	// Plain http, relative URLs and unknown events are rejected
+	w = doJSON(router, "POST", "/webhooks", map[string]string{"url": "http://hooks.example.com"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(router, "POST", "/webhooks", map[string]string{"url": "/stablerisk"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// As are internal addresses
+	for _, internal := range []string{"https://localhost:8080", "https://10.0.0.5/hook", "https://169.254.169.254/latest/meta-data/", "https://[::1]/hook"} {
+		w = doJSON(router, "POST", "/webhooks", map[string]string{"url": internal})
+		assert.Equal(t, http.StatusBadRequest, w.Code, internal)
+		assert.Contains(t, w.Body.String(), "private, loopback or link-local", internal)
+	}
+	w = doJSON(router, "POST", "/webhooks", map[string]interface{}{
+		"url": "https://hooks.example.com", "events": []string{"outlier.deleted"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(router, "PATCH", "/webhooks/"+created.ID, map[string]interface{}{
+		"events": []string{"incident.resolved", "incident.resolved"}, "enabled": false,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated models.Webhook
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, []models.WebhookEvent{models.WebhookEventIncidentResolved}, updated.Events)
+	assert.False(t, updated.Enabled)
+	assert.Equal(t, "SOAR", updated.Description)
+	w = doJSON(router, "PATCH", "/webhooks/missing", map[string]interface{}{"enabled": true})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doJSON(router, "POST", "/webhooks/"+created.ID+"/rotate-secret", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var rotated internalapi.CreateWebhookResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+	assert.True(t, strings.HasPrefix(rotated.Secret, "whsec_"))
+	assert.NotEqual(t, created.Secret, rotated.Secret)
+
+	w = doJSON(router, "GET", "/webhooks", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list internalapi.WebhookListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Webhooks, 1)
+
+	w = doJSON(router, "DELETE", "/webhooks/"+created.ID, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, "GET", "/webhooks/"+created.ID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestWebhookHandler_Deliveries(t *testing.T) {
+	router, db := setupWebhookRouter(t, nil)
+
+	w := doJSON(router, "POST", "/webhooks", map[string]string{"url": "https://hooks.example.com"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var webhook internalapi.CreateWebhookResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &webhook))
+
+	now := time.Now().UTC()
+	_, err := db.Exec(`
+		INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, status, attempts, response_status, error, created_at, last_attempt_at, delivered_at)
+		VALUES
+			('d1', $1, 'e1', 'outlier.detected', 'delivered', 1, 200, '', $2, $2, $2),
+			('d2', $1, 'e2', 'outlier.detected', 'failed', 6, 503, 'endpoint responded with status 503', $3, $3, NULL)
+	`, webhook.ID, now.Add(-time.Minute), now)
+	require.NoError(t, err)
+
+	w = doJSON(router, "GET", "/webhooks/"+webhook.ID+"/deliveries", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var list internalapi.WebhookDeliveryListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Deliveries, 2)
+	assert.Equal(t, "d2", list.Deliveries[0].ID)
+	assert.Equal(t, 503, list.Deliveries[0].ResponseStatus)
+	assert.Nil(t, list.Deliveries[0].DeliveredAt)
+	assert.Equal(t, "d1", list.Deliveries[1].ID)
+	require.NotNil(t, list.Deliveries[1].DeliveredAt)
+
+	w = doJSON(router, "GET", "/webhooks/"+webhook.ID+"/deliveries?status=failed", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Deliveries, 1)
+	assert.Equal(t, models.WebhookDeliveryFailed, list.Deliveries[0].Status)
+	assert.Equal(t, 6, list.Deliveries[0].Attempts)
+
+	w = doJSON(router, "GET", "/webhooks/"+webhook.ID+"/deliveries?status=lost", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(router, "GET", "/webhooks/missing/deliveries", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
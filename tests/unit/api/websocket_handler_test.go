@@ -0,0 +1,689 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	internalapi "github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/api/handlers"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/internal/security"
+	ws "github.com/mikedewar/stablerisk/internal/websocket"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ugorji/go/codec"
+)
+
+// webSocketJWTManager issues and validates the WebSocket tests' tokens
+var webSocketJWTManager = security.NewJWTManager(security.JWTConfig{
+	SecretKey:          "test-secret-key-32-characters!!",
+	Issuer:             "stablerisk-test",
+	Audience:           "stablerisk-api-test",
+	AccessTokenExpiry:  time.Hour,
+	RefreshTokenExpiry: time.Hour,
+})
+
+// dialWebSocket opens a WebSocket to server as a user with a role
+func dialWebSocket(t *testing.T, server *httptest.Server, userID string, role models.Role) *websocket.Conn {
+	token, err := webSocketJWTManager.GenerateAccessToken(&models.User{ID: userID, Username: userID, Role: role})
+	require.NoError(t, err)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?token="+token, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// setupWebSocketServer serves the WebSocket and its admin routes from a
+// running hub, returning the hub, the server and a function that connects
+// as a user with a role
+func setupWebSocketServer(t *testing.T, config ws.HubConfig) (*ws.Hub, *httptest.Server, func(userID string, role models.Role) *websocket.Conn) {
+	hub := ws.NewHub(config, nil)
+	hub.Start()
+	t.Cleanup(hub.Stop)
+	handler := handlers.NewWebSocketHandler(hub, webSocketJWTManager, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws", handler.HandleWebSocket)
+	router.GET("/admin/ws/connections", handler.ListConnections)
+	router.DELETE("/admin/ws/connections", handler.DisconnectUserConnections)
+	router.DELETE("/admin/ws/connections/:id", handler.DisconnectConnection)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	connect := func(userID string, role models.Role) *websocket.Conn {
+		conn := dialWebSocket(t, server, userID, role)
+
+		// Wait for the hub's welcome, so the client is registered
+		_, _, err := conn.ReadMessage()
+		require.NoError(t, err)
+		return conn
+	}
+	return hub, server, connect
+}
+
+func listConnections(t *testing.T, server *httptest.Server, query string) internalapi.WebSocketConnectionListResponse {
+	resp, err := http.Get(server.URL + "/admin/ws/connections" + query)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var list internalapi.WebSocketConnectionListResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	return list
+}
+
+func deleteConnections(t *testing.T, server *httptest.Server, path string) (int, internalapi.WebSocketDisconnectResponse) {
+	req, err := http.NewRequest(http.MethodDelete, server.URL+path, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var result internalapi.WebSocketDisconnectResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+func TestWebSocketHandler_ListConnections(t *testing.T) {
+	_, server, connect := setupWebSocketServer(t, ws.HubConfig{})
+
+	analyst := connect("analyst-1", models.RoleViewer)
+	connect("viewer-1", models.RoleViewer)
+	require.NoError(t, analyst.WriteJSON(map[string]interface{}{
+		"type": "subscribe",
+		"data": map[string]interface{}{"severities": []string{"critical", "high"}},
+	}))
+
+	var list internalapi.WebSocketConnectionListResponse
+	require.Eventually(t, func() bool {
+		list = listConnections(t, server, "?user_id=analyst-1")
+		return list.Total == 1 && len(list.Connections[0].Severities) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	connection := list.Connections[0]
+	assert.NotEmpty(t, connection.ID)
+	assert.Equal(t, "analyst-1", connection.Username)
+	assert.Equal(t, models.RoleViewer, connection.Role)
+	assert.WithinDuration(t, time.Now(), connection.ConnectedAt, time.Minute)
+	assert.Equal(t, []models.Severity{models.SeverityCritical, models.SeverityHigh}, connection.Severities)
+	assert.Empty(t, connection.Types)
+	assert.Equal(t, 256, connection.QueueCapacity)
+
+	all := listConnections(t, server, "")
+	require.Equal(t, 2, all.Total)
+	assert.Equal(t, "analyst-1", all.Connections[0].UserID, "oldest first")
+	assert.Equal(t, 0, listConnections(t, server, "?user_id=nobody").Total)
+}
+
+func TestWebSocketHandler_Disconnect(t *testing.T) {
+	_, server, connect := setupWebSocketServer(t, ws.HubConfig{})
+
+	first := connect("analyst-1", models.RoleViewer)
+	connect("analyst-1", models.RoleViewer)
+	viewer := connect("viewer-1", models.RoleViewer)
+
+	id := listConnections(t, server, "?user_id=viewer-1").Connections[0].ID
+	code, result := deleteConnections(t, server, "/admin/ws/connections/"+id)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, result.Disconnected)
+
+	// The client is told why, and the hub forgets it
+	_, _, err := viewer.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), err)
+	require.Eventually(t, func() bool {
+		return listConnections(t, server, "").Total == 2
+	}, time.Second, 10*time.Millisecond)
+
+	code, _ = deleteConnections(t, server, "/admin/ws/connections/"+id)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, result = deleteConnections(t, server, "/admin/ws/connections?user_id=analyst-1")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, result.Disconnected)
+	_, _, err = first.ReadMessage()
+	assert.Error(t, err)
+	require.Eventually(t, func() bool {
+		return listConnections(t, server, "").Total == 0
+	}, time.Second, 10*time.Millisecond)
+
+	code, _ = deleteConnections(t, server, "/admin/ws/connections")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+// wsReader reads a connection's messages one at a time, splitting the
+// frames the server batches queued messages into
+type wsReader struct {
+	t       *testing.T
+	conn    *websocket.Conn
+	pending []string
+}
+
+// next returns the type and data of the next message
+func (r *wsReader) next() (string, json.RawMessage) {
+	r.t.Helper()
+	if len(r.pending) == 0 {
+		require.NoError(r.t, r.conn.SetReadDeadline(time.Now().Add(time.Second)))
+		_, data, err := r.conn.ReadMessage()
+		require.NoError(r.t, err)
+		r.pending = strings.Split(string(data), "\n")
+	}
+
+	var message struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	require.NoError(r.t, json.Unmarshal([]byte(r.pending[0]), &message))
+	r.pending = r.pending[1:]
+	return message.Type, message.Data
+}
+
+// expect decodes the next message into v, failing unless it has messageType
+func (r *wsReader) expect(messageType string, v interface{}) {
+	r.t.Helper()
+	actualType, data := r.next()
+	require.Equal(r.t, messageType, actualType, string(data))
+	require.NoError(r.t, json.Unmarshal(data, v))
+}
+
+// send writes a client message
+func send(t *testing.T, conn *websocket.Conn, messageType string, data interface{}) {
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": messageType, "data": data}))
+}
+
+func TestWebSocketHandler_SubscribeReplies(t *testing.T) {
+	_, _, connect := setupWebSocketServer(t, ws.HubConfig{})
+	conn := connect("viewer-1", models.RoleViewer)
+	reader := &wsReader{t: t, conn: conn}
+
+	var subscription internalapi.WebSocketSubscription
+	send(t, conn, "subscribe", map[string]interface{}{"severities": []string{"critical", "high"}, "types": []string{"zscore"}})
+	reader.expect("subscribed", &subscription)
+	assert.Equal(t, []models.Severity{models.SeverityCritical, models.SeverityHigh}, subscription.Severities)
+	assert.Equal(t, []models.OutlierType{models.OutlierTypeZScore}, subscription.Types)
+	assert.Empty(t, subscription.Addresses)
+	assert.Nil(t, subscription.Transactions)
+
+	for name, data := range map[string]interface{}{
+		"unknown severity":       map[string]interface{}{"severities": []string{"urgent"}},
+		"severities not a list":  map[string]interface{}{"severities": "high"},
+		"invalid amount":         map[string]interface{}{"types": []string{"iqr"}, "min_amount": "lots"},
+		"negative amount":        map[string]interface{}{"min_amount": -5},
+		"unknown filter":         map[string]interface{}{"severity": []string{"high"}},
+		"filters not an object":  []string{"high"},
+		"transactions not valid": map[string]interface{}{"transactions": true},
+	} {
+		send(t, conn, "subscribe", data)
+		var reply map[string]string
+		reader.expect("error", &reply)
+		assert.Equal(t, "bad_request", reply["error"], name)
+		assert.Contains(t, reply["message"], "Invalid subscription", name)
+	}
+
+	// Rejected messages changed nothing
+	send(t, conn, "get_filters", nil)
+	var filters internalapi.WebSocketSubscription
+	reader.expect("filters", &filters)
+	assert.Equal(t, subscription, filters)
+
+	// Viewers may not stream transactions
+	send(t, conn, "subscribe", map[string]interface{}{"transactions": map[string]interface{}{}})
+	var reply map[string]string
+	reader.expect("error", &reply)
+	assert.Equal(t, "forbidden", reply["error"])
+
+	send(t, conn, "unsubscribe", nil)
+	reader.expect("error", &reply)
+	assert.Equal(t, `Unknown message type "unsubscribe"`, reply["message"])
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("{not json")))
+	reader.expect("error", &reply)
+	assert.Equal(t, "bad_request", reply["error"])
+}
+
+func TestWebSocketHandler_AddressAndAmountFilters(t *testing.T) {
+	hub, _, connect := setupWebSocketServer(t, ws.HubConfig{})
+	conn := connect("analyst-1", models.RoleViewer)
+	reader := &wsReader{t: t, conn: conn}
+
+	var subscription internalapi.WebSocketSubscription
+	send(t, conn, "subscribe", map[string]interface{}{
+		"addresses":  []string{"TWatchedWallet", "0xABCDEF"},
+		"min_amount": "1000.50",
+	})
+	reader.expect("subscribed", &subscription)
+	assert.Equal(t, []string{"TWatchedWallet", "0xabcdef"}, subscription.Addresses, "hex addresses are matched lowercased")
+	assert.Equal(t, "1000.5", subscription.MinAmount.String())
+
+	outliers := []models.Outlier{
+		{ID: "other-address", Address: "TOtherWallet", Amount: decimal.NewFromInt(5000)},
+		{ID: "below-threshold", Address: "TWatchedWallet", Amount: decimal.NewFromInt(1000)},
+		{ID: "no-amount", Address: "TWatchedWallet", Type: models.OutlierTypePatternFanOut},
+		{ID: "counterparty", Address: "TOtherWallet", Amount: decimal.NewFromInt(2000),
+			Details: map[string]interface{}{"counterparty": "TWatchedWallet"}},
+		{ID: "hex-address", Address: "0xabcdef", Amount: decimal.RequireFromString("1000.50")},
+	}
+	for _, outlier := range outliers {
+		hub.BroadcastOutlier(outlier)
+	}
+
+	// Outliers arrive in order, so everything before the last match was
+	// filtered out
+	var outlier models.Outlier
+	reader.expect("outlier", &outlier)
+	assert.Equal(t, "counterparty", outlier.ID)
+	reader.expect("outlier", &outlier)
+	assert.Equal(t, "hex-address", outlier.ID)
+
+	// Clearing the filters receives everything again
+	send(t, conn, "subscribe", map[string]interface{}{"addresses": []string{}, "min_amount": nil})
+	reader.expect("subscribed", &subscription)
+	assert.Empty(t, subscription.Addresses)
+	assert.True(t, subscription.MinAmount.IsZero())
+}
+
+func TestWebSocketHandler_TransactionStream(t *testing.T) {
+	hub, server, connect := setupWebSocketServer(t, ws.HubConfig{})
+	analyst := connect("analyst-1", models.RoleAnalyst)
+	analystReader := &wsReader{t: t, conn: analyst}
+	viewer := connect("viewer-1", models.RoleViewer)
+	viewerReader := &wsReader{t: t, conn: viewer}
+
+	var subscription internalapi.WebSocketSubscription
+	stream := map[string]interface{}{"transactions": map[string]interface{}{"min_amount": "100000"}}
+	send(t, analyst, "subscribe", stream)
+	analystReader.expect("subscribed", &subscription)
+	require.NotNil(t, subscription.Transactions)
+	assert.Equal(t, "100000", subscription.Transactions.MinAmount.String())
+	assert.Equal(t, 1.0, subscription.Transactions.SampleRate)
+	assert.Equal(t, subscription.Transactions, listConnections(t, server, "?user_id=analyst-1").Connections[0].Transactions)
+
+	send(t, viewer, "subscribe", stream)
+	var reply map[string]string
+	viewerReader.expect("error", &reply)
+	assert.Equal(t, "forbidden", reply["error"], "viewers lack stream:transactions")
+
+	hub.BroadcastTransaction(models.Transaction{TxHash: "small", Amount: decimal.NewFromInt(50)})
+	hub.BroadcastTransaction(models.Transaction{TxHash: "large", Amount: decimal.NewFromInt(250000)})
+	hub.BroadcastOutlier(models.Outlier{ID: "outlier-1"})
+
+	var tx models.Transaction
+	var outlier models.Outlier
+	analystReader.expect("transaction", &tx)
+	assert.Equal(t, "large", tx.TxHash)
+	analystReader.expect("outlier", &outlier)
+
+	// The viewer still receives outliers, but no transactions
+	viewerReader.expect("outlier", &outlier)
+	assert.Equal(t, "outlier-1", outlier.ID)
+
+	// Resubscribing replaces the options, and an invalid rate keeps them
+	send(t, analyst, "subscribe", map[string]interface{}{"transactions": map[string]interface{}{"sample_rate": 0.25}})
+	analystReader.expect("subscribed", &subscription)
+	assert.True(t, subscription.Transactions.MinAmount.IsZero())
+	assert.Equal(t, 0.25, subscription.Transactions.SampleRate)
+
+	send(t, analyst, "subscribe", map[string]interface{}{"transactions": map[string]interface{}{"sample_rate": 2}})
+	analystReader.expect("error", &reply)
+	assert.Contains(t, reply["message"], "sample_rate")
+
+	// Null unsubscribes
+	send(t, analyst, "subscribe", map[string]interface{}{"transactions": nil})
+	var unsubscribed internalapi.WebSocketSubscription
+	analystReader.expect("subscribed", &unsubscribed)
+	assert.Nil(t, unsubscribed.Transactions)
+}
+
+func TestWebSocketHandler_ConnectionLimits(t *testing.T) {
+	_, server, connect := setupWebSocketServer(t, ws.HubConfig{MaxConnections: 3, MaxConnectionsPerUser: 2})
+
+	connect("analyst-1", models.RoleAnalyst)
+	connect("analyst-1", models.RoleAnalyst)
+
+	// A third tab from the same user is refused
+	_, _, err := dialWebSocket(t, server, "analyst-1", models.RoleAnalyst).ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), err)
+	assert.Contains(t, err.Error(), "too many connections for this user")
+
+	// Other users may connect until the instance is full
+	connect("viewer-1", models.RoleViewer)
+	_, _, err = dialWebSocket(t, server, "viewer-2", models.RoleViewer).ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.CloseTryAgainLater), err)
+
+	assert.Equal(t, 3, listConnections(t, server, "").Total, "refused connections are not registered")
+}
+
+func TestWebSocketHandler_Audiences(t *testing.T) {
+	hub, server, connect := setupWebSocketServer(t, ws.HubConfig{})
+	readers := map[models.Role]*wsReader{}
+	for _, role := range []models.Role{models.RoleAdmin, models.RoleAnalyst, models.RoleViewer} {
+		readers[role] = &wsReader{t: t, conn: connect(string(role)+"-1", role)}
+	}
+
+	for _, connection := range listConnections(t, server, "").Connections {
+		assert.Equal(t, string(connection.Role), connection.Audience)
+	}
+
+	hub.BroadcastOperational("raphtory_circuit", map[string]interface{}{"from": "closed", "to": "open"})
+	hub.Broadcast("triage", map[string]string{"queue": "busy"}, ws.AudienceAnalyst)
+	hub.BroadcastOutlier(models.Outlier{ID: "outlier-1"})
+
+	// Messages arrive in order, so each client's first message shows what
+	// it was sent
+	var operational map[string]interface{}
+	readers[models.RoleAdmin].expect("operational", &operational)
+	assert.Equal(t, "raphtory_circuit", operational["event"])
+	assert.Equal(t, "open", operational["to"])
+
+	var triage map[string]string
+	readers[models.RoleAdmin].expect("triage", &triage)
+	readers[models.RoleAnalyst].expect("triage", &triage)
+	assert.Equal(t, "busy", triage["queue"])
+
+	var outlier models.Outlier
+	for _, reader := range readers {
+		reader.expect("outlier", &outlier)
+		assert.Equal(t, "outlier-1", outlier.ID)
+	}
+}
+
+func TestWebSocketHandler_BroadcastFanOut(t *testing.T) {
+	hub, _, connect := setupWebSocketServer(t, ws.HubConfig{BroadcastWorkers: 4})
+
+	// Enough clients for the broadcast to be split across workers
+	readers := make([]*wsReader, 200)
+	for i := range readers {
+		readers[i] = &wsReader{t: t, conn: connect(fmt.Sprintf("viewer-%d", i), models.RoleViewer)}
+	}
+
+	hub.BroadcastOutlier(models.Outlier{ID: "outlier-1"})
+	hub.BroadcastOutlier(models.Outlier{ID: "outlier-2"})
+
+	for _, reader := range readers {
+		var outlier models.Outlier
+		reader.expect("outlier", &outlier)
+		assert.Equal(t, "outlier-1", outlier.ID)
+		reader.expect("outlier", &outlier)
+		assert.Equal(t, "outlier-2", outlier.ID, "each client gets broadcasts in order")
+	}
+}
+
+func TestWebSocketHandler_SlowClient(t *testing.T) {
+	hub, _, connect := setupWebSocketServer(t, ws.HubConfig{})
+	connect("slow-1", models.RoleViewer) // Never reads
+	fast := connect("fast-1", models.RoleViewer)
+	slowClients := metrics.WebSocketSlowClients.WithLabelValues().Value()
+
+	// received counts the outliers the fast client reads
+	received := make(chan int, 1024)
+	go func() {
+		for {
+			_, data, err := fast.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- strings.Count(string(data), `"type":"outlier"`)
+		}
+	}()
+	sent, read := 0, 0
+	broadcast := func(outlier models.Outlier) {
+		hub.BroadcastOutlier(outlier)
+		sent++
+		for read < sent {
+			select {
+			case n := <-received:
+				read += n
+			case <-time.After(5 * time.Second):
+				t.Fatal("fast client stopped receiving outliers")
+			}
+		}
+	}
+
+	// Large outliers fill the socket buffers and then the slow client's
+	// queue, until the hub disconnects it. The fast client keeps up.
+	padding := strings.Repeat("x", 64*1024)
+	deadline := time.Now().Add(10 * time.Second)
+	for len(hub.GetClientsByUser("slow-1")) > 0 {
+		require.True(t, time.Now().Before(deadline), "slow client was not disconnected")
+		broadcast(models.Outlier{ID: "padding", Details: map[string]interface{}{"padding": padding}})
+	}
+	assert.Greater(t, metrics.WebSocketSlowClients.WithLabelValues().Value(), slowClients)
+
+	broadcast(models.Outlier{ID: "final"})
+	assert.Equal(t, 1, hub.ClientCount())
+}
+
+func TestWebSocketHandler_Reauth(t *testing.T) {
+	hub, server, _ := setupWebSocketServer(t, ws.HubConfig{})
+
+	// Tokens expiring within the reauth notice are asked to renew at once
+	shortLived := security.NewJWTManager(security.JWTConfig{
+		SecretKey:         "test-secret-key-32-characters!!",
+		Issuer:            "stablerisk-test",
+		Audience:          "stablerisk-api-test",
+		AccessTokenExpiry: 2 * time.Second,
+	})
+	dial := func(userID string) *wsReader {
+		token, err := shortLived.GenerateAccessToken(&models.User{ID: userID, Username: userID, Role: models.RoleViewer})
+		require.NoError(t, err)
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?token="+token, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		reader := &wsReader{t: t, conn: conn}
+		types := map[string]bool{}
+		for len(types) < 2 {
+			messageType, data := reader.next()
+			if messageType == "reauth_required" {
+				var notice map[string]time.Time
+				require.NoError(t, json.Unmarshal(data, &notice))
+				assert.WithinDuration(t, time.Now().Add(2*time.Second), notice["expires_at"], 2*time.Second)
+			}
+			types[messageType] = true
+		}
+		require.Equal(t, map[string]bool{"connected": true, "reauth_required": true}, types)
+		return reader
+	}
+	renewing := dial("viewer-1")
+	expiring := dial("viewer-2")
+
+	// Tokens for another user or role are refused
+	for _, user := range []*models.User{
+		{ID: "viewer-2", Username: "viewer-2", Role: models.RoleViewer},
+		{ID: "viewer-1", Username: "viewer-1", Role: models.RoleAdmin},
+	} {
+		token, err := webSocketJWTManager.GenerateAccessToken(user)
+		require.NoError(t, err)
+		send(t, renewing.conn, "reauth", map[string]string{"token": token})
+		var rejected map[string]string
+		renewing.expect("error", &rejected)
+		assert.Equal(t, "unauthorized", rejected["error"])
+	}
+	send(t, renewing.conn, "reauth", map[string]string{})
+	var rejected map[string]string
+	renewing.expect("error", &rejected)
+	assert.Equal(t, "bad_request", rejected["error"])
+
+	token, err := webSocketJWTManager.GenerateAccessToken(&models.User{ID: "viewer-1", Username: "viewer-1", Role: models.RoleViewer})
+	require.NoError(t, err)
+	send(t, renewing.conn, "reauth", map[string]string{"token": token})
+	var renewed map[string]time.Time
+	renewing.expect("reauthenticated", &renewed)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), renewed["expires_at"], time.Minute)
+
+	// The connection that did not renew is closed when its token expires
+	require.NoError(t, expiring.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, _, err = expiring.conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, websocket.ClosePolicyViolation, closeErr.Code)
+	assert.Equal(t, "token expired", closeErr.Text)
+
+	require.Eventually(t, func() bool {
+		return len(hub.GetClientsByUser("viewer-2")) == 0
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	connections := hub.GetClientsByUser("viewer-1")
+	require.Len(t, connections, 1, "the renewed connection stays open")
+	info := connections[0].Info()
+	require.NotNil(t, info.TokenExpiresAt)
+	assert.WithinDuration(t, renewed["expires_at"], *info.TokenExpiresAt, time.Second)
+}
+
+func TestWebSocketHandler_MessagePack(t *testing.T) {
+	hub, server, connect := setupWebSocketServer(t, ws.HubConfig{})
+	jsonReader := &wsReader{t: t, conn: connect("viewer-1", models.RoleViewer)}
+
+	token, err := webSocketJWTManager.GenerateAccessToken(&models.User{ID: "viewer-2", Username: "viewer-2", Role: models.RoleViewer})
+	require.NoError(t, err)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=" + token
+
+	_, resp, err := websocket.DefaultDialer.Dial(url+"&format=xml", nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"&format=msgpack", nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	// Frames are binary and may hold several messages back to back
+	var pending []map[string]interface{}
+	next := func() map[string]interface{} {
+		if len(pending) == 0 {
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+			frameType, data, err := conn.ReadMessage()
+			require.NoError(t, err)
+			require.Equal(t, websocket.BinaryMessage, frameType)
+
+			handle := &codec.MsgpackHandle{}
+			handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+			handle.RawToString = true
+			decoder := codec.NewDecoder(bytes.NewReader(data), handle)
+			for {
+				var message map[string]interface{}
+				if err := decoder.Decode(&message); err != nil {
+					break
+				}
+				pending = append(pending, message)
+			}
+			require.NotEmpty(t, pending)
+		}
+		message := pending[0]
+		pending = pending[1:]
+		return message
+	}
+	assert.Equal(t, "connected", next()["type"])
+
+	for _, connection := range listConnections(t, server, "").Connections {
+		expected := "json"
+		if connection.UserID == "viewer-2" {
+			expected = "msgpack"
+		}
+		assert.Equal(t, expected, connection.Format)
+	}
+
+	hub.BroadcastOutlier(models.Outlier{
+		ID:       "outlier-1",
+		Severity: models.SeverityHigh,
+		Amount:   decimal.RequireFromString("1234.5"),
+		Details:  map[string]interface{}{"z_score": 4.2, "count": 3},
+	})
+
+	message := next()
+	require.Equal(t, "outlier", message["type"])
+	data := message["data"].(map[string]interface{})
+	assert.Equal(t, "outlier-1", data["id"])
+	assert.Equal(t, "high", data["severity"])
+	assert.Equal(t, "1234.5", data["amount"], "amounts keep their JSON string form")
+	details := data["details"].(map[string]interface{})
+	assert.EqualValues(t, 4.2, details["z_score"])
+	assert.EqualValues(t, 3, details["count"])
+
+	// JSON clients are unaffected
+	var outlier models.Outlier
+	jsonReader.expect("outlier", &outlier)
+	assert.Equal(t, "outlier-1", outlier.ID)
+
+	// Replies are encoded for the client too
+	send(t, conn, "get_filters", nil)
+	assert.Equal(t, "filters", next()["type"])
+}
+
+// memoryBackplane relays broadcasts between hubs in the same process
+type memoryBackplane struct {
+	mu       sync.Mutex
+	handlers []func(data []byte)
+}
+
+func (b *memoryBackplane) Publish(data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, handler := range b.handlers {
+		handler(data)
+	}
+	return nil
+}
+
+func (b *memoryBackplane) Subscribe(handler func(data []byte)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+	return nil
+}
+
+func TestWebSocketHandler_Backplane(t *testing.T) {
+	backplane := &memoryBackplane{}
+	hub1, _, connect1 := setupWebSocketServer(t, ws.HubConfig{})
+	hub2, _, connect2 := setupWebSocketServer(t, ws.HubConfig{})
+	require.NoError(t, hub1.SetBackplane(backplane))
+	require.NoError(t, hub2.SetBackplane(backplane))
+
+	viewer1 := &wsReader{t: t, conn: connect1("viewer-1", models.RoleViewer)}
+	viewer2 := &wsReader{t: t, conn: connect2("viewer-2", models.RoleViewer)}
+	admin2 := &wsReader{t: t, conn: connect2("admin-2", models.RoleAdmin)}
+
+	// Broadcasts reach the clients of both instances, once each. Relayed
+	// broadcasts arrive in their own time, so only the sets are compared.
+	hub1.BroadcastLocal("outlier", models.Outlier{ID: "local"}, ws.AudienceViewer)
+	hub1.BroadcastOutlier(models.Outlier{ID: "relayed", Severity: models.SeverityHigh})
+	hub1.BroadcastOperational("raphtory_circuit", map[string]interface{}{"to": "open"})
+	hub2.BroadcastOutlier(models.Outlier{ID: "from-hub2"})
+
+	received := func(reader *wsReader, count int) []string {
+		var messages []string
+		for i := 0; i < count; i++ {
+			messageType, data := reader.next()
+			var message struct {
+				ID       string          `json:"id"`
+				Event    string          `json:"event"`
+				Severity models.Severity `json:"severity"`
+			}
+			require.NoError(t, json.Unmarshal(data, &message))
+			messages = append(messages, messageType+":"+message.ID+message.Event+":"+string(message.Severity))
+		}
+		return messages
+	}
+	assert.ElementsMatch(t, []string{"outlier:local:", "outlier:relayed:high", "outlier:from-hub2:"}, received(viewer1, 3))
+	assert.ElementsMatch(t, []string{"outlier:relayed:high", "outlier:from-hub2:"}, received(viewer2, 2),
+		"local broadcasts stay on their instance")
+	assert.ElementsMatch(t, []string{"outlier:relayed:high", "operational:raphtory_circuit:", "outlier:from-hub2:"}, received(admin2, 3))
+
+	// Nothing arrives twice
+	hub1.BroadcastSystemMessage("done")
+	for _, reader := range []*wsReader{viewer1, viewer2, admin2} {
+		var system map[string]string
+		reader.expect("system", &system)
+	}
+}
@@ -0,0 +1,144 @@
+package blockchain_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func testTransaction(i int) *models.Transaction {
+	return &models.Transaction{
+		TxHash:    fmt.Sprintf("tx%03d", i),
+		From:      "TFrom",
+		To:        "TTo",
+		Amount:    decimal.NewFromInt(int64(i)),
+		Timestamp: time.Unix(1700000000, 0).UTC(),
+	}
+}
+
+func TestBackpressure_DropCountsLoss(t *testing.T) {
+	out := make(chan *models.Transaction, 1)
+	bp := blockchain.NewBackpressure(blockchain.BackpressureConfig{
+		Strategy: blockchain.OverflowDrop,
+	}, out, zaptest.NewLogger(t))
+	require.NoError(t, bp.Start(context.Background()))
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, bp.Send(context.Background(), testTransaction(i)))
+	}
+
+	assert.Len(t, out, 1)
+	assert.Equal(t, uint64(2), bp.Stats().Dropped)
+}
+
+func TestBackpressure_BlockWaitsForSpace(t *testing.T) {
+	out := make(chan *models.Transaction, 1)
+	bp := blockchain.NewBackpressure(blockchain.BackpressureConfig{
+		Strategy:     blockchain.OverflowBlock,
+		BlockTimeout: time.Second,
+	}, out, zaptest.NewLogger(t))
+
+	require.NoError(t, bp.Send(context.Background(), testTransaction(0)))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		<-out
+	}()
+
+	require.NoError(t, bp.Send(context.Background(), testTransaction(1)))
+	assert.Equal(t, "tx001", (<-out).TxHash)
+	assert.Zero(t, bp.Stats().Dropped)
+}
+
+func TestBackpressure_BlockTimesOut(t *testing.T) {
+	out := make(chan *models.Transaction, 1)
+	bp := blockchain.NewBackpressure(blockchain.BackpressureConfig{
+		Strategy:     blockchain.OverflowBlock,
+		BlockTimeout: 50 * time.Millisecond,
+	}, out, zaptest.NewLogger(t))
+
+	require.NoError(t, bp.Send(context.Background(), testTransaction(0)))
+
+	start := time.Now()
+	require.NoError(t, bp.Send(context.Background(), testTransaction(1)))
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	assert.Equal(t, uint64(1), bp.Stats().Dropped)
+}
+
+func TestBackpressure_SpillDrainsInOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out := make(chan *models.Transaction, 2)
+	bp := blockchain.NewBackpressure(blockchain.BackpressureConfig{
+		Strategy:  blockchain.OverflowSpill,
+		SpillPath: filepath.Join(t.TempDir(), "spill.jsonl"),
+	}, out, zaptest.NewLogger(t))
+	require.NoError(t, bp.Start(ctx))
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, bp.Send(ctx, testTransaction(i)))
+	}
+
+	stats := bp.Stats()
+	assert.Zero(t, stats.Dropped)
+	assert.Equal(t, uint64(8), stats.Spilled)
+
+	for i := 0; i < 10; i++ {
+		select {
+		case tx := <-out:
+			assert.Equal(t, fmt.Sprintf("tx%03d", i), tx.TxHash)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for transaction %d", i)
+		}
+	}
+
+	assert.Eventually(t, func() bool { return bp.Stats().SpillDepth == 0 },
+		time.Second, 10*time.Millisecond)
+}
+
+func TestSpillQueue_SurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spill.jsonl")
+
+	queue, err := blockchain.OpenSpillQueue(path)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, queue.Push(testTransaction(i)))
+	}
+
+	// Consume one record before closing
+	tx, err := queue.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "tx000", tx.TxHash)
+	require.NoError(t, queue.Commit())
+	require.NoError(t, queue.Close())
+
+	// Space is only reclaimed when the queue empties, so the consumed record
+	// is redelivered after a restart
+	queue, err = blockchain.OpenSpillQueue(path)
+	require.NoError(t, err)
+	defer queue.Close()
+	assert.Equal(t, 3, queue.Len())
+
+	for i := 0; i < 3; i++ {
+		tx, err := queue.Peek()
+		require.NoError(t, err)
+		require.NotNil(t, tx)
+		assert.Equal(t, fmt.Sprintf("tx%03d", i), tx.TxHash)
+		assert.True(t, tx.Amount.Equal(decimal.NewFromInt(int64(i))))
+		require.NoError(t, queue.Commit())
+	}
+
+	tx, err = queue.Peek()
+	require.NoError(t, err)
+	assert.Nil(t, tx)
+}
@@ -0,0 +1,144 @@
+package blockchain_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestFileCheckpointStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "checkpoint.json")
+	store := blockchain.NewFileCheckpointStore(path)
+	ctx := context.Background()
+
+	// Missing file means no checkpoint
+	timestamp, err := store.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), timestamp)
+
+	require.NoError(t, store.Save(ctx, 1700000000000))
+	require.NoError(t, store.Save(ctx, 1700000005000))
+
+	timestamp, err = store.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1700000005000), timestamp)
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestFileCheckpointStore_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0o644))
+
+	_, err := blockchain.NewFileCheckpointStore(path).Load(context.Background())
+	assert.Error(t, err)
+}
+
+func TestTronClient_ResumesFromCheckpoint(t *testing.T) {
+	store := blockchain.NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+	require.NoError(t, store.Save(context.Background(), 1700000000000))
+
+	var mu sync.Mutex
+	var minTimestamps []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		minTimestamps = append(minTimestamps, r.URL.Query().Get("min_block_timestamp"))
+		mu.Unlock()
+
+		json.NewEncoder(w).Encode(blockchain.TronEventResponse{
+			Success: true,
+			Data: []models.TronEvent{
+				{TransactionID: "tx1", EventName: "Approval", BlockTimestamp: 1700000009000},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client := blockchain.NewTronClient(blockchain.TronClientConfig{
+		WebSocketURL:    server.URL,
+		USDTContract:    "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t",
+		PingInterval:    20 * time.Millisecond,
+		CheckpointStore: store,
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	assert.Eventually(t, func() bool {
+		timestamp, err := store.Load(context.Background())
+		return err == nil && timestamp == 1700000009000
+	}, 2*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// First request is the connectivity check; the first poll resumes at the
+	// checkpoint, whose block may have been only partly fetched
+	require.GreaterOrEqual(t, len(minTimestamps), 2)
+	assert.Equal(t, "1700000000000", minTimestamps[1])
+}
+
+func TestTronClient_AwaitDeliveryHoldsCheckpointUntilAcknowledged(t *testing.T) {
+	store := blockchain.NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(blockchain.TronEventResponse{
+			Success: true,
+			Data:    []models.TronEvent{transferAtBlock(100), transferAtBlock(101)},
+		})
+	}))
+	defer server.Close()
+
+	client := blockchain.NewTronClient(blockchain.TronClientConfig{
+		WebSocketURL:    server.URL,
+		USDTContract:    testUSDTContract,
+		PingInterval:    20 * time.Millisecond,
+		CheckpointStore: store,
+		AwaitDelivery:   true,
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-client.Transactions():
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected two transactions")
+		}
+	}
+
+	loadCheckpoint := func() int64 {
+		timestamp, err := store.Load(context.Background())
+		require.NoError(t, err)
+		return timestamp
+	}
+
+	// Fetched but not delivered: a crash now must re-fetch both
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int64(0), loadCheckpoint())
+
+	client.Acknowledge(1)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int64(0), loadCheckpoint(), "the page's second transaction is not yet delivered")
+
+	client.Acknowledge(1)
+	assert.Eventually(t, func() bool {
+		return loadCheckpoint() == transferAtBlock(101).BlockTimestamp
+	}, 2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,113 @@
+package blockchain_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func transactionAtBlock(block uint64) *models.Transaction {
+	return &models.Transaction{
+		TxHash:      fmt.Sprintf("tx%d", block),
+		BlockNumber: block,
+		Chain:       models.ChainTron,
+	}
+}
+
+func TestConfirmationTracker_ConfirmsAtDepth(t *testing.T) {
+	tracker := blockchain.NewConfirmationTracker(3)
+
+	first := transactionAtBlock(100)
+	assert.Empty(t, tracker.Track(first))
+	assert.False(t, first.Confirmed)
+
+	second := transactionAtBlock(102)
+	assert.Empty(t, tracker.Track(second))
+	assert.False(t, second.Confirmed)
+
+	// Block 103 puts three blocks on top of block 100
+	updates := tracker.Track(transactionAtBlock(103))
+	require.Len(t, updates, 1)
+	assert.Equal(t, models.ConfirmationUpdate{
+		TxHash:        "tx100",
+		BlockNumber:   100,
+		Confirmations: 3,
+		Chain:         models.ChainTron,
+	}, updates[0])
+
+	// A jump confirms everything that is now deep enough, oldest first
+	updates = tracker.Track(transactionAtBlock(110))
+	require.Len(t, updates, 2)
+	assert.Equal(t, "tx102", updates[0].TxHash)
+	assert.Equal(t, "tx103", updates[1].TxHash)
+
+	stats := tracker.Stats()
+	assert.Equal(t, uint64(110), stats.Head)
+	assert.Equal(t, 1, stats.Pending)
+	assert.Equal(t, uint64(3), stats.Confirmed)
+}
+
+func TestConfirmationTracker_OldTransactionsAreConfirmed(t *testing.T) {
+	tracker := blockchain.NewConfirmationTracker(3)
+	tracker.Track(transactionAtBlock(200))
+
+	// A backfilled transaction already below the depth needs no update
+	backfilled := transactionAtBlock(150)
+	assert.Empty(t, tracker.Track(backfilled))
+	assert.True(t, backfilled.Confirmed)
+}
+
+func TestConfirmationTracker_ZeroDepth(t *testing.T) {
+	tracker := blockchain.NewConfirmationTracker(0)
+
+	tx := transactionAtBlock(100)
+	assert.Empty(t, tracker.Track(tx))
+	assert.True(t, tx.Confirmed)
+	assert.Zero(t, tracker.Stats().Pending)
+}
+
+func TestConfirmationTracker_ForgetsRetractedTransactions(t *testing.T) {
+	tracker := blockchain.NewConfirmationTracker(2)
+	tracker.Track(transactionAtBlock(100))
+	tracker.Track(transactionAtBlock(101))
+
+	tracker.Forget("tx100")
+	assert.Equal(t, 1, tracker.Stats().Pending)
+
+	updates := tracker.Track(transactionAtBlock(103))
+	require.Len(t, updates, 1)
+	assert.Equal(t, "tx101", updates[0].TxHash)
+}
+
+func TestConfirmationTracker_AdvanceConfirmsWithoutNewTransactions(t *testing.T) {
+	tracker := blockchain.NewConfirmationTracker(3)
+	tracker.Track(transactionAtBlock(100))
+
+	assert.Empty(t, tracker.Advance(102))
+	// A stale head does not move it back
+	assert.Empty(t, tracker.Advance(90))
+
+	updates := tracker.Advance(103)
+	require.Len(t, updates, 1)
+	assert.Equal(t, "tx100", updates[0].TxHash)
+	assert.Equal(t, uint64(3), updates[0].Confirmations)
+	assert.Equal(t, uint64(103), tracker.Stats().Head)
+}
+
+func TestConfirmationTracker_SettledStopsAtOldestPending(t *testing.T) {
+	tracker := blockchain.NewConfirmationTracker(3)
+	tracker.Track(transactionAtBlock(200))
+	tracker.Track(transactionAtBlock(150)) // Already deep enough
+	assert.Equal(t, uint64(0), tracker.Settled(), "the first transaction is still pending")
+
+	tracker.Track(transactionAtBlock(201))
+	tracker.Advance(203)
+	assert.Equal(t, uint64(2), tracker.Settled(), "block 201 is still pending")
+
+	tracker.Forget("tx201")
+	assert.Equal(t, uint64(3), tracker.Settled())
+}
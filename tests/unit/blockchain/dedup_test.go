@@ -0,0 +1,186 @@
+package blockchain_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestDedupCache_EvictsLeastRecentlySeen(t *testing.T) {
+	cache := blockchain.NewDedupCache(2)
+
+	assert.False(t, cache.Seen("a"))
+	assert.False(t, cache.Seen("b"))
+	assert.True(t, cache.Seen("a")) // Refreshes a, leaving b the oldest
+
+	assert.False(t, cache.Seen("c"))
+	assert.Equal(t, 2, cache.Len())
+	assert.True(t, cache.Seen("a"))
+	assert.False(t, cache.Seen("b"), "b should have been evicted")
+}
+
+func TestDedupCache_Forget(t *testing.T) {
+	cache := blockchain.NewDedupCache(10)
+
+	assert.False(t, cache.Seen("a"))
+	cache.Forget("a")
+	cache.Forget("missing")
+	assert.False(t, cache.Seen("a"))
+}
+
+func TestEventKey(t *testing.T) {
+	event := models.TronEvent{TransactionID: "tx1", EventIndex: 2}
+	removed := event
+	removed.Removed = true
+
+	assert.Equal(t, "tx1:2", blockchain.EventKey(&event))
+	assert.NotEqual(t, blockchain.EventKey(&event), blockchain.EventKey(&removed))
+}
+
+func TestTronClient_SkipsRedeliveredEvents(t *testing.T) {
+	first := transferAtBlock(100)
+	second := transferAtBlock(100)
+	second.EventIndex = 1
+
+	// Every poll re-delivers both events, as TronGrid does for events sharing
+	// the last block timestamp
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(blockchain.TronEventResponse{
+			Success: true,
+			Data:    []models.TronEvent{first, second, first},
+		})
+	}))
+	defer server.Close()
+
+	client := blockchain.NewTronClient(blockchain.TronClientConfig{
+		WebSocketURL: server.URL,
+		USDTContract: testUSDTContract,
+		PingInterval: 20 * time.Millisecond,
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	require.Eventually(t, func() bool { return client.Stats().Duplicates >= 3 },
+		2*time.Second, 10*time.Millisecond)
+
+	// Both log entries of the transaction are emitted exactly once
+	assert.Len(t, client.Transactions(), 2)
+}
+
+func TestTronClient_DedupDisabled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := blockchain.TronEventResponse{Success: true}
+		if r.URL.Query().Get("min_block_timestamp") == "" {
+			resp.Data = []models.TronEvent{transferAtBlock(100), transferAtBlock(100)}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := blockchain.NewTronClient(blockchain.TronClientConfig{
+		WebSocketURL:   server.URL,
+		USDTContract:   testUSDTContract,
+		PingInterval:   50 * time.Millisecond,
+		DedupCacheSize: -1,
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	require.Eventually(t, func() bool { return len(client.Transactions()) == 2 },
+		2*time.Second, 10*time.Millisecond)
+	assert.Zero(t, client.Stats().Duplicates)
+}
+
+func TestTronClient_ReemitsAfterRetraction(t *testing.T) {
+	added := transferAtBlock(100)
+	removed := added
+	removed.Removed = true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := blockchain.TronEventResponse{Success: true}
+		if r.URL.Query().Get("min_block_timestamp") == "" {
+			// Added, reverted by a reorg, then re-included
+			resp.Data = []models.TronEvent{added, removed, added}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := blockchain.NewTronClient(blockchain.TronClientConfig{
+		WebSocketURL: server.URL,
+		USDTContract: testUSDTContract,
+		PingInterval: 50 * time.Millisecond,
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	select {
+	case txHash := <-client.Retractions():
+		assert.Equal(t, added.TransactionID, txHash)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a retraction")
+	}
+
+	require.Eventually(t, func() bool { return len(client.Transactions()) == 2 },
+		2*time.Second, 10*time.Millisecond)
+	assert.Zero(t, client.Stats().Duplicates)
+}
+
+// recordingArchiver records the pages handed to it
+type recordingArchiver struct {
+	mu      sync.Mutex
+	sources []string
+	events  []models.TronEvent
+}
+
+func (a *recordingArchiver) Archive(source string, events []models.TronEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sources = append(a.sources, source)
+	a.events = append(a.events, events...)
+}
+
+func TestTronClient_ArchivesRawPagesBeforeDedup(t *testing.T) {
+	event := transferAtBlock(100)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := blockchain.TronEventResponse{Success: true}
+		if r.URL.Query().Get("min_block_timestamp") == "" {
+			resp.Data = []models.TronEvent{event, event}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	archiver := &recordingArchiver{}
+	client := blockchain.NewTronClient(blockchain.TronClientConfig{
+		WebSocketURL: server.URL,
+		USDTContract: testUSDTContract,
+		PingInterval: 50 * time.Millisecond,
+		Archiver:     archiver,
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	require.Eventually(t, func() bool { return client.Stats().Duplicates == 1 },
+		2*time.Second, 10*time.Millisecond)
+
+	archiver.mu.Lock()
+	defer archiver.mu.Unlock()
+	assert.Equal(t, "tron-usdt", archiver.sources[0])
+	// The re-delivered event is archived as TronGrid returned it
+	assert.Len(t, archiver.events, 2)
+}
@@ -0,0 +1,107 @@
+package blockchain_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func transferAtBlock(block uint64) models.TronEvent {
+	return models.TronEvent{
+		TransactionID:   fmt.Sprintf("%064d", block),
+		ContractAddress: testUSDTContract,
+		EventName:       "Transfer",
+		Result: map[string]interface{}{
+			"from":  testFromAddress,
+			"to":    testToAddress,
+			"value": "1000000",
+		},
+		BlockNumber:    block,
+		BlockTimestamp: 1700000000000 + int64(block)*3000,
+	}
+}
+
+// gapServer serves blocks 100 and 150 on the first poll and block 120 to
+// any request bounded by max_block_timestamp
+func gapServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		resp := blockchain.TronEventResponse{Success: true}
+
+		switch {
+		case q.Get("max_block_timestamp") != "":
+			resp.Data = []models.TronEvent{transferAtBlock(120)}
+		case q.Get("min_block_timestamp") == "":
+			resp.Data = []models.TronEvent{transferAtBlock(100), transferAtBlock(150)}
+		}
+
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestTronClient_DetectsAndBackfillsGaps(t *testing.T) {
+	server := gapServer()
+	defer server.Close()
+
+	client := blockchain.NewTronClient(blockchain.TronClientConfig{
+		WebSocketURL: server.URL,
+		USDTContract: testUSDTContract,
+		PingInterval: 50 * time.Millisecond,
+		GapThreshold: 20,
+		BackfillGaps: true,
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	var blocks []uint64
+	for len(blocks) < 3 {
+		select {
+		case tx := <-client.Transactions():
+			blocks = append(blocks, tx.BlockNumber)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected three transactions, got blocks %v", blocks)
+		}
+	}
+	assert.Equal(t, []uint64{100, 150, 120}, blocks)
+
+	stats := client.Stats()
+	assert.Equal(t, uint64(1), stats.Gaps)
+	assert.Equal(t, uint64(49), stats.GapBlocks)
+	assert.Equal(t, uint64(1), stats.Backfilled)
+
+	// The backfill does not move the polling position
+	assert.Equal(t, transferAtBlock(150).BlockTimestamp, client.LastTimestamp())
+}
+
+func TestTronClient_GapWithinThreshold(t *testing.T) {
+	server := gapServer()
+	defer server.Close()
+
+	client := blockchain.NewTronClient(blockchain.TronClientConfig{
+		WebSocketURL: server.URL,
+		USDTContract: testUSDTContract,
+		PingInterval: 50 * time.Millisecond,
+		GapThreshold: 100,
+		BackfillGaps: true,
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	assert.Eventually(t, func() bool {
+		return client.LastTimestamp() == transferAtBlock(150).BlockTimestamp
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Zero(t, client.Stats().Gaps)
+	assert.Zero(t, client.Stats().Backfilled)
+}
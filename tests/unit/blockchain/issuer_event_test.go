@@ -0,0 +1,192 @@
+package blockchain_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func issuerEvent(name string, result map[string]interface{}) *models.TronEvent {
+	return &models.TronEvent{
+		TransactionID:   testTxHash,
+		ContractAddress: testUSDTContract,
+		EventName:       name,
+		Result:          result,
+		BlockNumber:     12345,
+		BlockTimestamp:  1700000000000,
+	}
+}
+
+func TestTransactionParser_ParseIssuerEvent(t *testing.T) {
+	parser := blockchain.NewTransactionParser(testUSDTContract)
+
+	tests := []struct {
+		name        string
+		event       *models.TronEvent
+		wantType    models.IssuerEventType
+		wantAddress string
+		wantAmount  string
+	}{
+		{
+			name:        "added to blacklist",
+			event:       issuerEvent("AddedBlackList", map[string]interface{}{"_user": testFromAddress}),
+			wantType:    models.IssuerEventBlacklisted,
+			wantAddress: testFromAddress,
+			wantAmount:  "0",
+		},
+		{
+			name:        "removed from blacklist",
+			event:       issuerEvent("RemovedBlackList", map[string]interface{}{"_user": testFromAddress}),
+			wantType:    models.IssuerEventUnblacklisted,
+			wantAddress: testFromAddress,
+			wantAmount:  "0",
+		},
+		{
+			name: "destroyed black funds",
+			event: issuerEvent("DestroyedBlackFunds", map[string]interface{}{
+				"_blackListedUser": testFromAddress,
+				"_balance":         "2500000000",
+			}),
+			wantType:    models.IssuerEventFundsDestroyed,
+			wantAddress: testFromAddress,
+			wantAmount:  "2500",
+		},
+		{
+			name:       "issue",
+			event:      issuerEvent("Issue", map[string]interface{}{"amount": "1000000000000000"}),
+			wantType:   models.IssuerEventIssue,
+			wantAmount: "1000000000",
+		},
+		{
+			name:       "redeem with positional result keys",
+			event:      issuerEvent("Redeem", map[string]interface{}{"0": "5000000"}),
+			wantType:   models.IssuerEventRedeem,
+			wantAmount: "5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.True(t, blockchain.IsIssuerEvent(tt.event.EventName))
+
+			event, err := parser.ParseIssuerEvent(tt.event)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantType, event.Type)
+			assert.Equal(t, tt.wantAddress, event.Address)
+			assert.Equal(t, tt.wantAmount, event.Amount.String())
+			assert.Equal(t, testTxHash, event.TxHash)
+			assert.Equal(t, uint64(12345), event.BlockNumber)
+			assert.Equal(t, "USDT", event.Token)
+		})
+	}
+
+	assert.False(t, blockchain.IsIssuerEvent("Transfer"))
+
+	_, err := parser.ParseIssuerEvent(issuerEvent("AddedBlackList", map[string]interface{}{}))
+	assert.Error(t, err)
+
+	removed := issuerEvent("AddedBlackList", map[string]interface{}{"_user": testFromAddress})
+	removed.Removed = true
+	_, err = parser.ParseIssuerEvent(removed)
+	assert.ErrorIs(t, err, blockchain.ErrRemovedEvent)
+}
+
+func TestTronClient_EmitsIssuerEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := blockchain.TronEventResponse{Success: true}
+		if r.URL.Query().Get("min_block_timestamp") == "" {
+			blacklist := issuerEvent("AddedBlackList", map[string]interface{}{"_user": testFromAddress})
+			resp.Data = []models.TronEvent{transferAtBlock(100), *blacklist}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := blockchain.NewTronClient(blockchain.TronClientConfig{
+		WebSocketURL: server.URL,
+		USDTContract: testUSDTContract,
+		PingInterval: 50 * time.Millisecond,
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	// Issuer events go to their own channel, not the transfer stream
+	select {
+	case event := <-client.IssuerEvents():
+		assert.Equal(t, models.IssuerEventBlacklisted, event.Type)
+		assert.Equal(t, testFromAddress, event.Address)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected an issuer event")
+	}
+
+	select {
+	case tx := <-client.Transactions():
+		assert.Equal(t, uint64(100), tx.BlockNumber)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a transfer")
+	}
+
+	assert.Equal(t, uint64(1), client.Stats().IssuerEvents)
+}
+
+func TestIssuerEventStore_Save(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE issuer_events (
+			id TEXT PRIMARY KEY,
+			tx_hash TEXT NOT NULL,
+			type TEXT NOT NULL,
+			address TEXT NOT NULL DEFAULT '',
+			amount TEXT NOT NULL,
+			block_number INTEGER NOT NULL,
+			timestamp DATETIME NOT NULL,
+			contract TEXT NOT NULL,
+			token TEXT NOT NULL,
+			chain TEXT NOT NULL,
+			UNIQUE (tx_hash, type, address)
+		)
+	`)
+	require.NoError(t, err)
+
+	store := blockchain.NewIssuerEventStore(db)
+	event := &models.IssuerEvent{
+		TxHash:      testTxHash,
+		Type:        models.IssuerEventFundsDestroyed,
+		Address:     testFromAddress,
+		Amount:      decimal.NewFromInt(2500),
+		BlockNumber: 12345,
+		Timestamp:   time.Unix(1700000000, 0),
+		Contract:    testUSDTContract,
+		Token:       "USDT",
+		Chain:       models.ChainTron,
+	}
+
+	require.NoError(t, store.Save(context.Background(), event))
+	assert.NotEmpty(t, event.ID)
+
+	// Seeing the same event again is not an error and does not duplicate it
+	duplicate := *event
+	duplicate.ID = ""
+	require.NoError(t, store.Save(context.Background(), &duplicate))
+
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM issuer_events`).Scan(&count))
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,116 @@
+package blockchain_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestTronClient_ReportsLagBehindChainHead(t *testing.T) {
+	head := transferAtBlock(400)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/wallet/getnowblock" {
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"block_header": map[string]interface{}{
+					"raw_data": map[string]interface{}{
+						"number":    head.BlockNumber,
+						"timestamp": head.BlockTimestamp,
+					},
+				},
+			})
+			return
+		}
+
+		resp := blockchain.TronEventResponse{Success: true}
+		if r.URL.Query().Get("min_block_timestamp") == "" {
+			resp.Data = []models.TronEvent{transferAtBlock(100)}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := blockchain.NewTronClient(blockchain.TronClientConfig{
+		WebSocketURL: server.URL,
+		USDTContract: testUSDTContract,
+		TokenSymbol:  "LAGUSD",
+		PingInterval: 20 * time.Millisecond,
+		LagInterval:  20 * time.Millisecond,
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	// Block 100 is 300 blocks (900 seconds) behind the head
+	require.Eventually(t, func() bool {
+		stats := client.Stats()
+		return stats.HeadBlock == 400 && stats.BlocksBehind == 300
+	}, 2*time.Second, 10*time.Millisecond)
+
+	stats := client.Stats()
+	assert.Equal(t, head.BlockTimestamp, stats.HeadTimestamp)
+	assert.Equal(t, 900*time.Second, stats.Lag)
+	assert.Equal(t, float64(900), metrics.IngestionLag.WithLabelValues(string(models.ChainTron), "LAGUSD").Value())
+	assert.Equal(t, float64(300), metrics.IngestionBlocksBehind.WithLabelValues(string(models.ChainTron), "LAGUSD").Value())
+}
+
+func TestTronClient_IncludeUnconfirmedReportsHeads(t *testing.T) {
+	queries := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/wallet/getnowblock" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"block_header": map[string]interface{}{
+					"raw_data": map[string]interface{}{"number": 400, "timestamp": transferAtBlock(400).BlockTimestamp},
+				},
+			})
+			return
+		}
+
+		select {
+		case queries <- r.URL.RawQuery:
+		default:
+		}
+		event := transferAtBlock(100)
+		event.Unconfirmed = true
+		json.NewEncoder(w).Encode(blockchain.TronEventResponse{Success: true, Data: []models.TronEvent{event}})
+	}))
+	defer server.Close()
+
+	client := blockchain.NewTronClient(blockchain.TronClientConfig{
+		WebSocketURL:       server.URL,
+		USDTContract:       testUSDTContract,
+		PingInterval:       20 * time.Millisecond,
+		LagInterval:        20 * time.Millisecond,
+		IncludeUnconfirmed: true,
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	select {
+	case tx := <-client.Transactions():
+		assert.False(t, tx.Confirmed)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a transaction")
+	}
+	assert.NotContains(t, <-queries, "only_confirmed")
+
+	select {
+	case head := <-client.Heads():
+		assert.Equal(t, uint64(400), head)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a chain head")
+	}
+}
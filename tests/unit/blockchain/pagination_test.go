@@ -0,0 +1,177 @@
+package blockchain_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// pagedServer serves pages of events linked by fingerprint. Requests without
+// a fingerprint start from the first page.
+func pagedServer(pages int) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var fingerprints []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fingerprint := r.URL.Query().Get("fingerprint")
+
+		mu.Lock()
+		fingerprints = append(fingerprints, fingerprint)
+		mu.Unlock()
+
+		page := 0
+		if fingerprint != "" {
+			fmt.Sscanf(fingerprint, "page-%d", &page)
+		}
+
+		resp := blockchain.TronEventResponse{
+			Success: true,
+			Data: []models.TronEvent{
+				{TransactionID: fmt.Sprintf("tx-%d", page), EventName: "Approval", BlockTimestamp: int64(1700000000000 + page)},
+			},
+		}
+		if page+1 < pages {
+			resp.Meta.Fingerprint = fmt.Sprintf("page-%d", page+1)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), fingerprints...)
+	}
+}
+
+func TestTronClient_FollowsFingerprint(t *testing.T) {
+	server, requests := pagedServer(3)
+	defer server.Close()
+
+	client := blockchain.NewTronClient(blockchain.TronClientConfig{
+		WebSocketURL: server.URL,
+		USDTContract: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t",
+		PingInterval: 50 * time.Millisecond,
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	assert.Eventually(t, func() bool {
+		return client.Stats().PagesFetched >= 3
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// Connectivity check, then the three pages of the first poll
+	got := requests()
+	require.GreaterOrEqual(t, len(got), 4)
+	assert.Equal(t, []string{"", "page-1", "page-2"}, got[1:4])
+	assert.Equal(t, int64(1700000000002), client.LastTimestamp())
+	assert.Equal(t, uint64(0), client.Stats().TruncatedPolls)
+}
+
+func TestTronClient_PageCap(t *testing.T) {
+	server, _ := pagedServer(100)
+	defer server.Close()
+
+	client := blockchain.NewTronClient(blockchain.TronClientConfig{
+		WebSocketURL:    server.URL,
+		USDTContract:    "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t",
+		PingInterval:    50 * time.Millisecond,
+		MaxPagesPerPoll: 2,
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	assert.Eventually(t, func() bool {
+		return client.Stats().TruncatedPolls >= 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, 2, client.Stats().LastPollPages)
+}
+
+// blockServer serves events as TronGrid does: from min_block_timestamp
+// inclusive, two to a page, with the offset of the next page as the
+// fingerprint
+func blockServer(events []models.TronEvent) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var minTimestamp int64
+		fmt.Sscanf(q.Get("min_block_timestamp"), "%d", &minTimestamp)
+		var matching []models.TronEvent
+		for _, event := range events {
+			if event.BlockTimestamp >= minTimestamp {
+				matching = append(matching, event)
+			}
+		}
+
+		offset := 0
+		fmt.Sscanf(q.Get("fingerprint"), "offset-%d", &offset)
+		end := offset + 2
+		if end > len(matching) {
+			end = len(matching)
+		}
+		resp := blockchain.TronEventResponse{Success: true}
+		if offset < end {
+			resp.Data = matching[offset:end]
+		}
+		if end < len(matching) {
+			resp.Meta.Fingerprint = fmt.Sprintf("offset-%d", end)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestTronClient_PageCapMidBlock(t *testing.T) {
+	// Five transfers in block 100, so the page cap cuts the first poll short
+	// partway through the block, then one in block 101
+	var events []models.TronEvent
+	for i := 0; i < 5; i++ {
+		event := transferAtBlock(100)
+		event.TransactionID = fmt.Sprintf("%064d", i)
+		events = append(events, event)
+	}
+	events = append(events, transferAtBlock(101))
+
+	server := blockServer(events)
+	defer server.Close()
+
+	client := blockchain.NewTronClient(blockchain.TronClientConfig{
+		WebSocketURL:    server.URL,
+		USDTContract:    testUSDTContract,
+		PingInterval:    20 * time.Millisecond,
+		MaxPagesPerPoll: 1,
+		DedupCacheSize:  -1, // Nothing is fetched twice, even without the cache
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	seen := make(map[string]int)
+	timeout := time.After(2 * time.Second)
+	for len(seen) < len(events) {
+		select {
+		case tx := <-client.Transactions():
+			seen[tx.TxHash]++
+		case <-timeout:
+			t.Fatalf("received %d of %d transactions", len(seen), len(events))
+		}
+	}
+	assert.GreaterOrEqual(t, client.Stats().TruncatedPolls, uint64(2))
+
+	// Later polls find nothing new
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, client.Transactions())
+	for hash, count := range seen {
+		assert.Equal(t, 1, count, hash)
+	}
+}
@@ -0,0 +1,100 @@
+package blockchain_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRateLimiter_Paces(t *testing.T) {
+	limiter := blockchain.NewRateLimiter(20, 1)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, limiter.Wait(ctx))
+	}
+
+	// One token up front, then one every 50ms
+	assert.GreaterOrEqual(t, time.Since(start), 190*time.Millisecond)
+}
+
+func TestRateLimiter_Pause(t *testing.T) {
+	limiter := blockchain.NewRateLimiter(1000, 10)
+	limiter.Pause(100 * time.Millisecond)
+
+	start := time.Now()
+	require.NoError(t, limiter.Wait(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+}
+
+func TestRateLimiter_WaitCancelled(t *testing.T) {
+	limiter := blockchain.NewRateLimiter(1, 1)
+	limiter.Pause(time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, limiter.Wait(ctx), context.DeadlineExceeded)
+}
+
+func TestRetryHandler_SetRetryAfter(t *testing.T) {
+	handler := blockchain.NewRetryHandler(blockchain.RetryConfig{
+		InitialDelay: 10 * time.Millisecond,
+		MaxDelay:     time.Second,
+		MaxRetries:   3,
+		Multiplier:   2.0,
+	}, zaptest.NewLogger(t))
+
+	handler.SetRetryAfter(500 * time.Millisecond)
+	assert.Equal(t, 500*time.Millisecond, handler.NextDelay())
+
+	// A shorter server delay does not shorten the backoff
+	handler.SetRetryAfter(time.Millisecond)
+	assert.Equal(t, 10*time.Millisecond, handler.NextDelay())
+
+	// The server delay applies to a single wait
+	require.NoError(t, handler.Wait(context.Background()))
+	assert.Equal(t, 20*time.Millisecond, handler.NextDelay())
+}
+
+func TestTronClient_BacksOffOn429(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Allow the connectivity check, then rate limit every poll
+		if requests.Add(1) == 1 {
+			json.NewEncoder(w).Encode(blockchain.TronEventResponse{Success: true})
+			return
+		}
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := blockchain.NewTronClient(blockchain.TronClientConfig{
+		WebSocketURL: server.URL,
+		USDTContract: testUSDTContract,
+		PingInterval: 20 * time.Millisecond,
+		RetryConfig:  blockchain.RetryConfig{InitialDelay: time.Millisecond, MaxDelay: time.Second, MaxRetries: 10, Multiplier: 2.0},
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	require.Eventually(t, func() bool {
+		return client.Stats().RateLimited == 1
+	}, time.Second, 5*time.Millisecond)
+
+	// Polling keeps ticking every 20ms but no request is sent during Retry-After
+	seen := requests.Load()
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, seen, requests.Load())
+}
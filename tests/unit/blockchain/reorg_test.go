@@ -0,0 +1,80 @@
+package blockchain_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func removedTransferEvent() models.TronEvent {
+	return models.TronEvent{
+		TransactionID:   testTxHash,
+		ContractAddress: testUSDTContract,
+		EventName:       "Transfer",
+		Result: map[string]interface{}{
+			"from":  testFromAddress,
+			"to":    testToAddress,
+			"value": "1000000",
+		},
+		BlockNumber:    12345,
+		BlockTimestamp: 1700000000000,
+		Removed:        true,
+	}
+}
+
+func TestTransactionParser_RemovedEvent(t *testing.T) {
+	parser := blockchain.NewTransactionParser(testUSDTContract)
+	event := removedTransferEvent()
+
+	tx, err := parser.ParseEvent(&event)
+	assert.ErrorIs(t, err, blockchain.ErrRemovedEvent)
+	assert.Nil(t, tx)
+}
+
+// TronGrid only reports removed events when unconfirmed events are requested,
+// so retractions need IncludeUnconfirmed; with only_confirmed set the removed
+// path is unreachable
+func TestTronClient_RetractsRemovedEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("only_confirmed") != "" {
+			t.Errorf("unconfirmed events should be requested, got only_confirmed=%s", r.URL.Query().Get("only_confirmed"))
+		}
+		json.NewEncoder(w).Encode(blockchain.TronEventResponse{
+			Success: true,
+			Data:    []models.TronEvent{removedTransferEvent()},
+		})
+	}))
+	defer server.Close()
+
+	client := blockchain.NewTronClient(blockchain.TronClientConfig{
+		WebSocketURL:       server.URL,
+		USDTContract:       testUSDTContract,
+		PingInterval:       50 * time.Millisecond,
+		IncludeUnconfirmed: true,
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	select {
+	case txHash := <-client.Retractions():
+		assert.Equal(t, testTxHash, txHash)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a retraction for the removed event")
+	}
+
+	select {
+	case tx := <-client.Transactions():
+		t.Fatalf("removed event must not be ingested, got %s", tx.TxHash)
+	default:
+	}
+	assert.GreaterOrEqual(t, client.Stats().Retractions, uint64(1))
+}
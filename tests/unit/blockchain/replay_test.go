@@ -0,0 +1,142 @@
+package blockchain_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/archive"
+	"github.com/mikedewar/stablerisk/internal/blockchain"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// writeReplayFile writes one JSON record per line; strings are written verbatim
+func writeReplayFile(t *testing.T, records ...interface{}) string {
+	path := filepath.Join(t.TempDir(), "replay.ndjson")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	for _, record := range records {
+		if line, ok := record.(string); ok {
+			_, err = file.WriteString(line + "\n")
+		} else {
+			err = json.NewEncoder(file).Encode(record)
+		}
+		require.NoError(t, err)
+	}
+	return path
+}
+
+func TestReplaySource_EmitsRecordsInOrder(t *testing.T) {
+	recorded := models.Transaction{
+		TxHash:      "recorded",
+		BlockNumber: 101,
+		Timestamp:   time.UnixMilli(1700000303000).UTC(),
+		From:        testFromAddress,
+		To:          testToAddress,
+		Amount:      decimal.NewFromInt(5),
+		Token:       "USDT",
+		Chain:       models.ChainTron,
+	}
+	approval := transferAtBlock(102)
+	approval.EventName = "Approval"
+
+	path := writeReplayFile(t,
+		transferAtBlock(100),
+		recorded,
+		"not json",
+		approval,
+		removedTransferEvent(),
+	)
+
+	source := blockchain.NewReplaySource(blockchain.ReplayConfig{
+		Path:      path,
+		Contracts: []blockchain.ReplayContract{{Address: testUSDTContract, Symbol: "USDT", Decimals: 6}},
+	}, zaptest.NewLogger(t))
+	require.NoError(t, source.Start())
+	defer source.Close()
+
+	first := <-source.Transactions()
+	assert.Equal(t, transferAtBlock(100).TransactionID, first.TxHash)
+	assert.True(t, first.Amount.Equal(decimal.NewFromInt(1)))
+
+	second := <-source.Transactions()
+	assert.Equal(t, "recorded", second.TxHash)
+	assert.True(t, second.Timestamp.Equal(recorded.Timestamp))
+
+	assert.Equal(t, testTxHash, <-source.Retractions())
+
+	select {
+	case <-source.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected the replay to finish")
+	}
+
+	stats := source.Stats()
+	assert.Equal(t, uint64(5), stats.Lines)
+	assert.Equal(t, uint64(2), stats.Transactions)
+	assert.Equal(t, uint64(1), stats.Retractions)
+	assert.Equal(t, uint64(2), stats.Skipped)
+	assert.False(t, source.IsConnected())
+}
+
+func TestReplaySource_PacesAndRebases(t *testing.T) {
+	// Records one second apart, replayed ten times faster
+	second := transferAtBlock(101)
+	second.BlockTimestamp = transferAtBlock(100).BlockTimestamp + 1000
+	path := writeReplayFile(t, transferAtBlock(100), second)
+
+	source := blockchain.NewReplaySource(blockchain.ReplayConfig{
+		Path:   path,
+		Speed:  10,
+		Rebase: true,
+	}, zaptest.NewLogger(t))
+
+	started := time.Now()
+	require.NoError(t, source.Start())
+	defer source.Close()
+
+	first := <-source.Transactions()
+	next := <-source.Transactions()
+	elapsed := time.Since(started)
+
+	assert.GreaterOrEqual(t, elapsed, 100*time.Millisecond)
+	assert.WithinDuration(t, started, first.Timestamp, time.Second)
+	assert.Equal(t, time.Second, next.Timestamp.Sub(first.Timestamp))
+}
+
+func TestReplaySource_MissingFile(t *testing.T) {
+	source := blockchain.NewReplaySource(blockchain.ReplayConfig{
+		Path: filepath.Join(t.TempDir(), "missing.ndjson"),
+	}, zaptest.NewLogger(t))
+
+	assert.Error(t, source.Start())
+}
+
+func TestReplaySource_ReadsGzippedArchive(t *testing.T) {
+	// Concatenated archive objects decompress as one stream. The second page
+	// re-delivers the first event, as TronGrid does at page boundaries.
+	first, err := archive.Encode([]models.TronEvent{transferAtBlock(100)})
+	require.NoError(t, err)
+	second, err := archive.Encode([]models.TronEvent{transferAtBlock(100), transferAtBlock(101)})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "archive.ndjson.gz")
+	require.NoError(t, os.WriteFile(path, append(first, second...), 0o644))
+
+	source := blockchain.NewReplaySource(blockchain.ReplayConfig{Path: path}, zaptest.NewLogger(t))
+	require.NoError(t, source.Start())
+	defer source.Close()
+
+	assert.Equal(t, uint64(100), (<-source.Transactions()).BlockNumber)
+	assert.Equal(t, uint64(101), (<-source.Transactions()).BlockNumber)
+	<-source.Done()
+	assert.Equal(t, uint64(1), source.Stats().Duplicates)
+}
@@ -33,7 +33,7 @@ func TestTransactionParser_ParseEvent(t *testing.T) {
 				TransactionID:   testTxHash,
 				ContractAddress: testUSDTContract,
 				EventName:       "Transfer",
-				EventData: map[string]interface{}{
+				Result: map[string]interface{}{
 					"from":  testFromAddress,
 					"to":    testToAddress,
 					"value": "1000000", // 1 USDT (6 decimals)
@@ -58,7 +58,7 @@ func TestTransactionParser_ParseEvent(t *testing.T) {
 				TransactionID:   testTxHash,
 				ContractAddress: testUSDTContract,
 				EventName:       "Transfer",
-				EventData: map[string]interface{}{
+				Result: map[string]interface{}{
 					"from":  testFromAddress,
 					"to":    testToAddress,
 					"value": "1000000000000", // 1,000,000 USDT
@@ -79,7 +79,7 @@ func TestTransactionParser_ParseEvent(t *testing.T) {
 				TransactionID:   testTxHash,
 				ContractAddress: testUSDTContract,
 				EventName:       "Transfer",
-				EventData: map[string]interface{}{
+				Result: map[string]interface{}{
 					"from":  testFromAddress,
 					"to":    testToAddress,
 					"value": "0xf4240", // 1000000 in hex = 1 USDT
@@ -104,7 +104,7 @@ func TestTransactionParser_ParseEvent(t *testing.T) {
 				TransactionID:   testTxHash,
 				ContractAddress: testUSDTContract,
 				EventName:       "Approval",
-				EventData:       map[string]interface{}{},
+				Result:          map[string]interface{}{},
 				BlockNumber:     12345,
 				BlockTimestamp:  time.Now().UnixMilli(),
 			},
@@ -116,7 +116,7 @@ func TestTransactionParser_ParseEvent(t *testing.T) {
 				TransactionID:   testTxHash,
 				ContractAddress: "TWrongContract123456789",
 				EventName:       "Transfer",
-				EventData: map[string]interface{}{
+				Result: map[string]interface{}{
 					"from":  testFromAddress,
 					"to":    testToAddress,
 					"value": "1000000",
@@ -132,7 +132,7 @@ func TestTransactionParser_ParseEvent(t *testing.T) {
 				TransactionID:   testTxHash,
 				ContractAddress: testUSDTContract,
 				EventName:       "Transfer",
-				EventData: map[string]interface{}{
+				Result: map[string]interface{}{
 					"from":  testFromAddress,
 					"to":    testToAddress,
 					"value": "1000000",
@@ -149,7 +149,7 @@ func TestTransactionParser_ParseEvent(t *testing.T) {
 				TransactionID:   testTxHash,
 				ContractAddress: testUSDTContract,
 				EventName:       "Transfer",
-				EventData: map[string]interface{}{
+				Result: map[string]interface{}{
 					"to":    testToAddress,
 					"value": "1000000",
 				},
@@ -164,7 +164,7 @@ func TestTransactionParser_ParseEvent(t *testing.T) {
 				TransactionID:   testTxHash,
 				ContractAddress: testUSDTContract,
 				EventName:       "Transfer",
-				EventData: map[string]interface{}{
+				Result: map[string]interface{}{
 					"from":  testFromAddress,
 					"value": "1000000",
 				},
@@ -179,7 +179,7 @@ func TestTransactionParser_ParseEvent(t *testing.T) {
 				TransactionID:   testTxHash,
 				ContractAddress: testUSDTContract,
 				EventName:       "Transfer",
-				EventData: map[string]interface{}{
+				Result: map[string]interface{}{
 					"from": testFromAddress,
 					"to":   testToAddress,
 				},
@@ -362,7 +362,7 @@ func TestTransactionParser_DecimalConversion(t *testing.T) {
 				TransactionID:   testTxHash,
 				ContractAddress: testUSDTContract,
 				EventName:       "Transfer",
-				EventData: map[string]interface{}{
+				Result: map[string]interface{}{
 					"from":  testFromAddress,
 					"to":    testToAddress,
 					"value": tt.rawValue,
@@ -391,7 +391,7 @@ func BenchmarkTransactionParser_ParseEvent(b *testing.B) {
 		TransactionID:   testTxHash,
 		ContractAddress: testUSDTContract,
 		EventName:       "Transfer",
-		EventData: map[string]interface{}{
+		Result: map[string]interface{}{
 			"from":  testFromAddress,
 			"to":    testToAddress,
 			"value": "1000000",
@@ -405,3 +405,33 @@ func BenchmarkTransactionParser_ParseEvent(b *testing.B) {
 		_, _ = parser.ParseEvent(event)
 	}
 }
+
+func TestTokenParser_Decimals(t *testing.T) {
+	const tusdContract = "TUpMhErZL2fhh4sVNULAbNKLokS4GjC1F4"
+	parser := blockchain.NewTokenParser(tusdContract, "TUSD", 18)
+
+	tx, err := parser.ParseEvent(&models.TronEvent{
+		TransactionID:   testTxHash,
+		ContractAddress: tusdContract,
+		EventName:       "Transfer",
+		Result: map[string]interface{}{
+			"from":  testFromAddress,
+			"to":    testToAddress,
+			"value": "2500000000000000000", // 2.5 TUSD (18 decimals)
+		},
+		BlockNumber:    12345,
+		BlockTimestamp: time.Now().UnixMilli(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "TUSD", tx.Token)
+	assert.Equal(t, tusdContract, tx.Contract)
+	assert.True(t, decimal.RequireFromString("2.5").Equal(tx.Amount))
+
+	// USDT events are not parsed by the TUSD parser
+	_, err = parser.ParseEvent(&models.TronEvent{
+		TransactionID:   testTxHash,
+		ContractAddress: testUSDTContract,
+		EventName:       "Transfer",
+	})
+	assert.Error(t, err)
+}
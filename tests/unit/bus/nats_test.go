@@ -0,0 +1,297 @@
+package bus_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/bus"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeNATS is a minimal NATS server with a single JetStream stream over
+// stablerisk.> subjects
+type fakeNATS struct {
+	listener net.Listener
+
+	mu      sync.Mutex
+	conns   map[net.Conn]*bufio.Writer
+	subs    map[net.Conn]map[string]string // sid -> subject
+	streams map[string]bool
+	seq     int
+	reject  bool // Answer publishes with a JetStream error
+}
+
+func newFakeNATS(t *testing.T) *fakeNATS {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	f := &fakeNATS{
+		listener: listener,
+		conns:    make(map[net.Conn]*bufio.Writer),
+		subs:     make(map[net.Conn]map[string]string),
+		streams:  make(map[string]bool),
+	}
+	t.Cleanup(func() {
+		listener.Close()
+		f.dropConnections()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeNATS) url() string {
+	return "nats://" + f.listener.Addr().String()
+}
+
+// dropConnections closes every client connection, as a server restart would
+func (f *fakeNATS) dropConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for conn := range f.conns {
+		conn.Close()
+	}
+}
+
+func (f *fakeNATS) serve(conn net.Conn) {
+	writer := bufio.NewWriter(conn)
+	f.mu.Lock()
+	f.conns[conn] = writer
+	f.subs[conn] = make(map[string]string)
+	writer.WriteString(`INFO {"server_id":"fake","jetstream":true}` + "\r\n")
+	writer.Flush()
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		delete(f.conns, conn)
+		delete(f.subs, conn)
+		f.mu.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "PING":
+			f.write(conn, "PONG\r\n")
+		case "SUB":
+			f.mu.Lock()
+			f.subs[conn][args[len(args)-1]] = args[1]
+			f.mu.Unlock()
+		case "PUB":
+			size, _ := strconv.Atoi(args[len(args)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			reply := ""
+			if len(args) == 4 {
+				reply = args[2]
+			}
+			f.publish(args[1], reply, payload[:size])
+		}
+	}
+}
+
+func (f *fakeNATS) write(conn net.Conn, s string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if writer, ok := f.conns[conn]; ok {
+		writer.WriteString(s)
+		writer.Flush()
+	}
+}
+
+// publish handles the JetStream API, acknowledges stream messages and
+// delivers to matching subscriptions
+func (f *fakeNATS) publish(subject, reply string, data []byte) {
+	var response []byte
+
+	f.mu.Lock()
+	switch {
+	case strings.HasPrefix(subject, "$JS.API.STREAM.CREATE."):
+		name := strings.TrimPrefix(subject, "$JS.API.STREAM.CREATE.")
+		if f.streams[name] {
+			response = []byte(`{"error":{"code":400,"err_code":10058,"description":"stream name already in use"}}`)
+		} else {
+			f.streams[name] = true
+			response = []byte(`{"config":{"name":"` + name + `"}}`)
+		}
+	case strings.HasPrefix(subject, bus.SubjectPrefix):
+		if f.reject {
+			response = []byte(`{"error":{"code":503,"description":"insufficient resources"}}`)
+		} else {
+			f.seq++
+			response = []byte(fmt.Sprintf(`{"stream":"STABLERISK","seq":%d}`, f.seq))
+		}
+	}
+	f.mu.Unlock()
+
+	f.deliver(subject, data)
+	if reply != "" && response != nil {
+		f.deliver(reply, response)
+	}
+}
+
+func (f *fakeNATS) deliver(subject string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for conn, subs := range f.subs {
+		for sid, pattern := range subs {
+			if matches(pattern, subject) {
+				writer := f.conns[conn]
+				fmt.Fprintf(writer, "MSG %s %s %d\r\n%s\r\n", subject, sid, len(data), data)
+				writer.Flush()
+			}
+		}
+	}
+}
+
+// matches supports the trailing * and > wildcards the client uses
+func matches(pattern, subject string) bool {
+	switch {
+	case strings.HasSuffix(pattern, ".>"):
+		return strings.HasPrefix(subject, strings.TrimSuffix(pattern, ">"))
+	case strings.HasSuffix(pattern, ".*"):
+		prefix := strings.TrimSuffix(pattern, "*")
+		return strings.HasPrefix(subject, prefix) && !strings.Contains(subject[len(prefix):], ".")
+	default:
+		return pattern == subject
+	}
+}
+
+func connect(t *testing.T, server *fakeNATS, reconnectWait time.Duration) *bus.Conn {
+	conn, err := bus.Connect(context.Background(), bus.Config{
+		URL:            server.url(),
+		Stream:         "STABLERISK",
+		PublishTimeout: time.Second,
+		ReconnectWait:  reconnectWait,
+	}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestConn_PublishesAndSubscribes(t *testing.T) {
+	server := newFakeNATS(t)
+	conn := connect(t, server, time.Second)
+	ctx := context.Background()
+
+	// Creating the stream is idempotent
+	require.NoError(t, conn.EnsureStream(ctx))
+	require.NoError(t, conn.EnsureStream(ctx))
+
+	received := make(chan models.Outlier, 1)
+	require.NoError(t, conn.Subscribe(bus.SubjectOutliers, "", func(subject string, data []byte) {
+		var outlier models.Outlier
+		json.Unmarshal(data, &outlier)
+		received <- outlier
+	}))
+	require.NoError(t, conn.Flush(ctx))
+
+	require.NoError(t, conn.PublishOutlier(ctx, models.Outlier{ID: "outlier-1", Address: "TAddr"}))
+
+	select {
+	case outlier := <-received:
+		assert.Equal(t, "outlier-1", outlier.ID)
+		assert.Equal(t, "TAddr", outlier.Address)
+	case <-time.After(time.Second):
+		t.Fatal("expected the outlier to be delivered")
+	}
+}
+
+func TestConn_PublishRejected(t *testing.T) {
+	server := newFakeNATS(t)
+	server.reject = true
+	conn := connect(t, server, time.Second)
+
+	err := conn.Publish(context.Background(), bus.SubjectTransactions, map[string]string{"tx_hash": "tx1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "insufficient resources")
+}
+
+func TestConn_ReconnectsAndResubscribes(t *testing.T) {
+	server := newFakeNATS(t)
+	conn := connect(t, server, 200*time.Millisecond)
+	ctx := context.Background()
+
+	received := make(chan string, 1)
+	require.NoError(t, conn.Subscribe(bus.SubjectRetractions, "", func(subject string, data []byte) {
+		received <- string(data)
+	}))
+
+	server.dropConnections()
+	require.Eventually(t, func() bool { return !conn.IsConnected() }, time.Second, 5*time.Millisecond)
+	assert.ErrorIs(t, conn.Publish(ctx, bus.SubjectRetractions, "tx1"), bus.ErrDisconnected)
+
+	require.Eventually(t, conn.IsConnected, 2*time.Second, 10*time.Millisecond)
+	require.NoError(t, conn.Flush(ctx))
+	require.NoError(t, conn.Publish(ctx, bus.SubjectRetractions, "tx2"))
+
+	select {
+	case data := <-received:
+		assert.Equal(t, `"tx2"`, data)
+	case <-time.After(time.Second):
+		t.Fatal("expected the subscription to be restored")
+	}
+}
+
+func TestBackplane_RelaysToEveryInstance(t *testing.T) {
+	server := newFakeNATS(t)
+	ctx := context.Background()
+
+	received := make([]chan string, 2)
+	backplanes := make([]*bus.Backplane, 2)
+	for i := range backplanes {
+		conn := connect(t, server, time.Second)
+		backplanes[i] = bus.NewBackplane(conn)
+		ch := make(chan string, 1)
+		received[i] = ch
+		require.NoError(t, backplanes[i].Subscribe(func(data []byte) { ch <- string(data) }))
+		require.NoError(t, conn.Flush(ctx))
+	}
+
+	require.NoError(t, backplanes[0].Publish([]byte(`{"origin":"api-1"}`)))
+	for i, ch := range received {
+		select {
+		case data := <-ch:
+			assert.Equal(t, `{"origin":"api-1"}`, data)
+		case <-time.After(time.Second):
+			t.Fatalf("instance %d did not receive the broadcast", i)
+		}
+	}
+
+	server.mu.Lock()
+	assert.Zero(t, server.seq, "broadcasts are not stored in the stream")
+	server.mu.Unlock()
+}
@@ -0,0 +1,84 @@
+package detection_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// activityRaphtory serves body from /graph/activity and records min_count
+func activityRaphtory(t *testing.T, body string, minCounts *[]string) *graph.RaphtoryClient {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/graph/activity", r.URL.Path)
+		*minCounts = append(*minCounts, r.URL.Query().Get("min_count"))
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	return graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL}, zaptest.NewLogger(t))
+}
+
+func TestPatternDetector_DetectVelocityFromActivity(t *testing.T) {
+	var minCounts []string
+	client := activityRaphtory(t, `{"addresses": [
+		{"address": "TBusy", "in_degree": 3, "out_degree": 4, "in_count": 30, "out_count": 25,
+		 "received": "3000", "sent": "2500", "unconfirmed_count": 0,
+		 "first_seen": 1704067200, "last_seen": 1704070000, "first_tx_hash": "0xbusy"},
+		{"address": "TPending", "in_degree": 1, "out_degree": 1, "in_count": 40, "out_count": 20,
+		 "received": "400", "sent": "200", "unconfirmed_count": 20,
+		 "first_seen": 1704067200, "last_seen": 1704070000, "first_tx_hash": "0xpending"}
+	]}`, &minCounts)
+
+	detector := detection.NewPatternDetector(detection.PatternDetectorConfig{
+		VelocityWindow:    time.Hour,
+		VelocityThreshold: 50,
+		IgnoreUnconfirmed: true,
+	}, client, zaptest.NewLogger(t))
+
+	outliers, err := detector.DetectVelocity(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"51"}, minCounts, "addresses at the threshold are filtered by Raphtory")
+
+	// TPending falls to 40 once its unconfirmed transfers are left out
+	require.Len(t, outliers, 1)
+	assert.Equal(t, models.OutlierTypePatternVelocity, outliers[0].Type)
+	assert.Equal(t, "TBusy", outliers[0].Address)
+	assert.Equal(t, "0xbusy", outliers[0].TransactionHash)
+	assert.Equal(t, 55, outliers[0].Details["transaction_count"])
+}
+
+func TestPatternDetector_DetectFanInFromActivity(t *testing.T) {
+	var minCounts []string
+	client := activityRaphtory(t, `{"addresses": [
+		{"address": "TCollector", "in_degree": 25, "out_degree": 1, "in_count": 30, "out_count": 1,
+		 "received": "3000", "sent": "2900", "unconfirmed_count": 0,
+		 "first_seen": 1704067200, "last_seen": 1704070000, "first_tx_hash": "0xa"},
+		{"address": "TRepeat", "in_degree": 2, "out_degree": 0, "in_count": 40, "out_count": 0,
+		 "received": "400", "sent": "0", "unconfirmed_count": 0,
+		 "first_seen": 1704067200, "last_seen": 1704070000, "first_tx_hash": "0xb"}
+	]}`, &minCounts)
+
+	detector := detection.NewPatternDetector(detection.PatternDetectorConfig{
+		FanInThreshold: 10,
+	}, client, zaptest.NewLogger(t))
+
+	outliers, err := detector.DetectFanIn(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"11"}, minCounts)
+
+	// Many transfers from two senders is not a fan-in
+	require.Len(t, outliers, 1)
+	assert.Equal(t, "TCollector", outliers[0].Address)
+	assert.Equal(t, 25, outliers[0].Details["counterparties"])
+	assert.Equal(t, 30, outliers[0].Details["transaction_count"])
+	assert.Equal(t, "3000", outliers[0].Amount.String())
+}
@@ -0,0 +1,95 @@
+package detection_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestOutlierArchiver_Archive(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`
+		CREATE TABLE outliers (
+			id TEXT PRIMARY KEY,
+			detected_at DATETIME NOT NULL,
+			severity TEXT NOT NULL
+		);
+		CREATE TABLE outlier_triage (
+			id TEXT PRIMARY KEY,
+			outlier_id TEXT NOT NULL,
+			org_id TEXT NOT NULL,
+			acknowledged BOOLEAN NOT NULL DEFAULT false,
+			archived_at DATETIME,
+			archived_by TEXT
+		)
+	`)
+	require.NoError(t, err)
+
+	old := time.Now().Add(-40 * 24 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+	for _, row := range []struct {
+		id, severity string
+		detectedAt   time.Time
+		acknowledged bool
+	}{
+		{"old-low-1", "low", old, true},
+		{"old-low-2", "low", old.Add(time.Minute), true},
+		{"old-low-3", "low", old.Add(2 * time.Minute), true},
+		{"old-low-open", "low", old, false},
+		{"old-medium", "medium", old, true},
+		{"old-high", "high", old, true},
+		{"recent-low", "low", recent, true},
+	} {
+		_, err := db.Exec(`INSERT INTO outliers (id, detected_at, severity) VALUES (?, ?, ?)`,
+			row.id, row.detectedAt, row.severity)
+		require.NoError(t, err)
+		_, err = db.Exec(`INSERT INTO outlier_triage (id, outlier_id, org_id, acknowledged) VALUES (?, ?, 'org-a', ?)`,
+			"a-"+row.id, row.id, row.acknowledged)
+		require.NoError(t, err)
+	}
+
+	// Another organization's acknowledgement archives it for that
+	// organization only
+	_, err = db.Exec(`INSERT INTO outlier_triage (id, outlier_id, org_id, acknowledged) VALUES ('b-old-low-open', 'old-low-open', 'org-b', true)`)
+	require.NoError(t, err)
+
+	archiver := detection.NewOutlierArchiver(db, detection.OutlierArchiverConfig{
+		After:      30 * 24 * time.Hour,
+		Severities: []models.Severity{models.SeverityLow, models.SeverityMedium},
+		BatchSize:  2,
+	}, zaptest.NewLogger(t))
+
+	// Batches continue until every matching outlier is archived
+	count, err := archiver.Archive(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), count)
+
+	rows, err := db.Query(`SELECT id FROM outlier_triage WHERE archived_at IS NOT NULL AND archived_by = 'system' ORDER BY id`)
+	require.NoError(t, err)
+	defer rows.Close()
+	var archived []string
+	for rows.Next() {
+		var id string
+		require.NoError(t, rows.Scan(&id))
+		archived = append(archived, id)
+	}
+	assert.Equal(t, []string{"a-old-low-1", "a-old-low-2", "a-old-low-3", "a-old-medium", "b-old-low-open"}, archived,
+		"unacknowledged, recent and other severities are kept live")
+
+	count, err = archiver.Archive(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+}
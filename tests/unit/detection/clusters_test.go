@@ -0,0 +1,64 @@
+package detection_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestPatternDetector_DetectClusters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/graph/communities", r.URL.Path)
+		assert.NotEmpty(t, r.URL.Query().Get("start"))
+		w.Write([]byte(`{"count": 4, "communities": [
+			{"id": 0, "members": ["TLoopA", "TLoopB", "TLoopC", "TLoopD"], "size": 4, "internal_edges": 6,
+			 "internal_count": 12, "internal_amount": "5000", "density": 0.5, "entry_points": [], "exit_points": [],
+			 "inflow": "0", "outflow": "0", "has_cycle": true, "first_seen": 1704067200, "last_seen": 1704070000},
+			{"id": 1, "members": ["TFunnelIn", "TMid", "TFunnelOut"], "size": 3, "internal_edges": 3,
+			 "internal_count": 3, "internal_amount": "900", "density": 0.5, "entry_points": ["TFunnelIn"], "exit_points": ["TFunnelOut"],
+			 "inflow": "1000", "outflow": "950", "has_cycle": false, "first_seen": 1704067200, "last_seen": 1704070000},
+			{"id": 2, "members": ["TSparseA", "TSparseB", "TSparseC", "TSparseD"], "size": 4, "internal_edges": 3,
+			 "internal_count": 3, "internal_amount": "300", "density": 0.25, "entry_points": [], "exit_points": [],
+			 "inflow": "0", "outflow": "0", "has_cycle": true, "first_seen": 1704067200, "last_seen": 1704070000},
+			{"id": 3, "members": ["TOpenA", "TOpenB", "TOpenC"], "size": 3, "internal_edges": 2,
+			 "internal_count": 2, "internal_amount": "200", "density": 0.33, "entry_points": ["TOpenA", "TOpenB"], "exit_points": ["TOpenC"],
+			 "inflow": "500", "outflow": "100", "has_cycle": false, "first_seen": 1704067200, "last_seen": 1704070000}
+		]}`))
+	}))
+	defer server.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL}, zaptest.NewLogger(t))
+	detector := detection.NewPatternDetector(detection.PatternDetectorConfig{
+		ClusterWindow:     24 * time.Hour,
+		ClusterMinSize:    3,
+		ClusterMinDensity: 0.3,
+	}, client, zaptest.NewLogger(t))
+
+	outliers, err := detector.DetectClusters(context.Background())
+	require.NoError(t, err)
+
+	// The sparse loop is below the density threshold and the last community
+	// has two entry points
+	require.Len(t, outliers, 2)
+
+	loop := outliers[0]
+	assert.Equal(t, models.OutlierTypePatternCluster, loop.Type)
+	assert.Equal(t, "TLoopA", loop.Address)
+	assert.Equal(t, "circular_cluster", loop.Details["pattern"])
+	assert.Equal(t, []string{"TLoopA", "TLoopB", "TLoopC", "TLoopD"}, loop.Details["members"])
+	assert.Equal(t, models.SeverityMedium, loop.Severity)
+
+	funnel := outliers[1]
+	assert.Equal(t, "TFunnelIn", funnel.Address)
+	assert.Equal(t, "funnel_cluster", funnel.Details["pattern"])
+	assert.Equal(t, "950", funnel.Details["outflow"])
+}
@@ -0,0 +1,78 @@
+package detection_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestAnomalyDetector_IgnoresUnconfirmedTransactions(t *testing.T) {
+	now := time.Now().Unix()
+	confirmed, unconfirmed := true, false
+
+	var txInfos []graph.TransactionInfo
+	for i := 0; i < 50; i++ {
+		txInfos = append(txInfos, graph.TransactionInfo{
+			TxHash:    fmt.Sprintf("tx-%d", i),
+			From:      fmt.Sprintf("Sender%d", i),
+			To:        "Receiver",
+			Amount:    "100",
+			Timestamp: now,
+			Confirmed: &confirmed,
+		})
+	}
+	// Services that predate confirmation tracking omit the field
+	txInfos[0].Confirmed = nil
+	txInfos = append(txInfos, graph.TransactionInfo{
+		TxHash:    "whale",
+		From:      "Whale",
+		To:        "Receiver",
+		Amount:    "1000000",
+		Timestamp: now,
+		Confirmed: &unconfirmed,
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(txInfos)
+	}))
+	defer server.Close()
+
+	detect := func(ignoreUnconfirmed bool) []string {
+		logger := zaptest.NewLogger(t)
+		client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: 5 * time.Second}, logger)
+		detector := detection.NewAnomalyDetector(detection.AnomalyDetectorConfig{
+			Interval:     time.Minute,
+			ZScoreConfig: detection.ZScoreConfig{Threshold: 3.0, MinDataPoints: 30},
+			IQRConfig:    detection.IQRConfig{Multiplier: 1.5, MinDataPoints: 30},
+			PatternDetectorConfig: detection.PatternDetectorConfig{
+				FanOutThreshold:   1000,
+				FanInThreshold:    1000,
+				VelocityWindow:    time.Hour,
+				VelocityThreshold: 1000,
+			},
+			IgnoreUnconfirmed: ignoreUnconfirmed,
+		}, client, logger)
+
+		outliers, err := detector.DetectOnce(context.Background(), detection.DetectOptions{})
+		require.NoError(t, err)
+
+		var hashes []string
+		for _, o := range outliers {
+			hashes = append(hashes, o.TransactionHash)
+		}
+		return hashes
+	}
+
+	assert.Contains(t, detect(false), "whale")
+	assert.NotContains(t, detect(true), "whale")
+}
@@ -0,0 +1,113 @@
+package detection_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestDBSCANDetector_Detect(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	config := detection.DBSCANConfig{
+		Epsilon:        0.75,
+		MinPoints:      4,
+		MinAddresses:   10,
+		WindowDuration: 24 * time.Hour,
+	}
+	detector := detection.NewDBSCANDetector(config, logger)
+
+	t.Run("flags address in sparse region", func(t *testing.T) {
+		transactions := generatePairedTransactions(20)
+
+		// One address sending very large amounts to many counterparties
+		for i := 0; i < 30; i++ {
+			transactions = append(transactions, createTransaction(
+				fmt.Sprintf("whale-%d", i),
+				"Whale",
+				fmt.Sprintf("Sink%d", i%15),
+				"5000000",
+				time.Now(),
+			))
+		}
+
+		outliers, err := detector.Detect(transactions)
+		require.NoError(t, err)
+
+		found := false
+		for _, o := range outliers {
+			assert.Equal(t, models.OutlierTypeDBSCAN, o.Type)
+			if o.Address == "Whale" {
+				found = true
+				assert.NotEmpty(t, o.TransactionHash)
+				assert.Equal(t, 30, o.Details["transaction_count"])
+				assert.Equal(t, 15, o.Details["counterparty_count"])
+			}
+		}
+		assert.True(t, found, "Whale address should be flagged as noise")
+	})
+
+	t.Run("insufficient addresses", func(t *testing.T) {
+		transactions := generatePairedTransactions(2)
+		outliers, err := detector.Detect(transactions)
+		require.NoError(t, err)
+		assert.Nil(t, outliers)
+	})
+
+	t.Run("homogeneous activity has no outliers", func(t *testing.T) {
+		transactions := generatePairedTransactions(20)
+		outliers, err := detector.Detect(transactions)
+		require.NoError(t, err)
+		assert.Empty(t, outliers)
+	})
+}
+
+func TestBuildAddressFeatures(t *testing.T) {
+	transactions := []models.Transaction{
+		createTransaction("tx1", "AddrA", "AddrB", "100", time.Now()),
+		createTransaction("tx2", "AddrA", "AddrC", "250", time.Now()),
+		createTransaction("tx3", "AddrB", "AddrA", "50", time.Now()),
+	}
+
+	features := detection.BuildAddressFeatures(transactions, 2*time.Hour)
+	require.Len(t, features, 3)
+
+	byAddress := make(map[string]detection.AddressFeatures)
+	for _, f := range features {
+		byAddress[f.Address] = f
+	}
+
+	a := byAddress["AddrA"]
+	assert.Equal(t, 3, a.TransactionCount)
+	assert.Equal(t, 2, a.CounterpartyCount)
+	assert.Equal(t, "400", a.TotalAmount.String())
+	assert.InDelta(t, 1.5, a.Velocity, 0.0001)
+	assert.Equal(t, "tx2", a.LargestTxHash)
+
+	c := byAddress["AddrC"]
+	assert.Equal(t, 1, c.TransactionCount)
+	assert.Equal(t, 1, c.CounterpartyCount)
+}
+
+// generatePairedTransactions creates n sender/receiver pairs with identical,
+// modest activity so they form a single dense cluster
+func generatePairedTransactions(n int) []models.Transaction {
+	var transactions []models.Transaction
+	for i := 0; i < n; i++ {
+		for j := 0; j < 3; j++ {
+			transactions = append(transactions, createTransaction(
+				fmt.Sprintf("pair-%d-%d", i, j),
+				fmt.Sprintf("Sender%d", i),
+				fmt.Sprintf("Receiver%d", i),
+				"100",
+				time.Now(),
+			))
+		}
+	}
+	return transactions
+}
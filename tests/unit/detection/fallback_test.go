@@ -0,0 +1,99 @@
+package detection_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// unavailableRaphtory returns a client whose every call fails with 503
+func unavailableRaphtory(t *testing.T) *graph.RaphtoryClient {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	return graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL}, zaptest.NewLogger(t))
+}
+
+// fanOutGraph holds one address paying receivers distinct addresses
+func fanOutGraph(receivers int) *graph.MemoryGraph {
+	g := graph.NewMemoryGraph(graph.MemoryGraphConfig{Capacity: 1000})
+	at := time.Now().Add(-10 * time.Minute)
+	for i := 0; i < receivers; i++ {
+		g.Add(models.Transaction{
+			TxHash:    fmt.Sprintf("fanout-%d", i),
+			From:      "TDistributor",
+			To:        fmt.Sprintf("TReceiver%d", i),
+			Amount:    decimal.NewFromInt(100),
+			Timestamp: at,
+			Confirmed: true,
+		})
+	}
+	return g
+}
+
+func TestPatternDetector_FallsBackWhenRaphtoryDown(t *testing.T) {
+	detector := detection.NewPatternDetector(detection.PatternDetectorConfig{
+		FanOutThreshold:   10,
+		FanInThreshold:    10,
+		VelocityWindow:    time.Hour,
+		VelocityThreshold: 1000,
+		ClusterWindow:     24 * time.Hour,
+	}, unavailableRaphtory(t), zaptest.NewLogger(t))
+
+	// Without a fallback, fan-out detection fails with Raphtory
+	_, err := detector.DetectFanOut(context.Background())
+	require.ErrorIs(t, err, graph.ErrRaphtoryUnavailable)
+
+	detector.SetFallback(fanOutGraph(25))
+	outliers, err := detector.DetectAll(context.Background())
+	require.NoError(t, err)
+	require.Len(t, outliers, 1)
+
+	outlier := outliers[0]
+	assert.Equal(t, models.OutlierTypePatternFanOut, outlier.Type)
+	assert.Equal(t, "TDistributor", outlier.Address)
+	assert.Equal(t, 25, outlier.Details["counterparties"])
+	assert.Equal(t, "2500", outlier.Amount.String())
+	assert.Equal(t, models.SeverityMedium, outlier.Severity)
+}
+
+func TestAnomalyDetector_DetectOnceFallsBackWhenRaphtoryDown(t *testing.T) {
+	detector := detection.NewAnomalyDetector(detection.AnomalyDetectorConfig{
+		Interval: time.Minute,
+		PatternDetectorConfig: detection.PatternDetectorConfig{
+			FanOutThreshold:   10,
+			FanInThreshold:    10,
+			VelocityWindow:    time.Hour,
+			VelocityThreshold: 1000,
+		},
+	}, unavailableRaphtory(t), zaptest.NewLogger(t))
+
+	_, err := detector.DetectOnce(context.Background(), detection.DetectOptions{})
+	require.ErrorIs(t, err, graph.ErrRaphtoryUnavailable)
+
+	detector.SetFallbackGraph(fanOutGraph(12))
+	outliers, err := detector.DetectOnce(context.Background(), detection.DetectOptions{})
+	require.NoError(t, err)
+
+	var fanOut []models.Outlier
+	for _, outlier := range outliers {
+		if outlier.Type == models.OutlierTypePatternFanOut {
+			fanOut = append(fanOut, outlier)
+		}
+	}
+	require.Len(t, fanOut, 1)
+	assert.Equal(t, "TDistributor", fanOut[0].Address)
+}
@@ -0,0 +1,116 @@
+package detection_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestOutlierStore_InvalidateByTransaction(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE outliers (
+			id TEXT PRIMARY KEY,
+			transaction_hash TEXT,
+			invalidated BOOLEAN NOT NULL DEFAULT false,
+			invalidated_at DATETIME,
+			invalid_reason TEXT
+		)
+	`)
+	require.NoError(t, err)
+
+	_, err = db.Exec(`
+		INSERT INTO outliers (id, transaction_hash) VALUES
+			('o1', 'tx-reverted'),
+			('o2', 'tx-reverted'),
+			('o3', 'tx-kept')
+	`)
+	require.NoError(t, err)
+
+	store := detection.NewOutlierStore(db, zaptest.NewLogger(t))
+
+	count, err := store.InvalidateByTransaction(context.Background(), "tx-reverted", models.InvalidReasonChainReorg)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	// Already invalidated outliers are left untouched
+	count, err = store.InvalidateByTransaction(context.Background(), "tx-reverted", models.InvalidReasonChainReorg)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+
+	var invalidated int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM outliers WHERE invalidated AND invalid_reason = ?`,
+		models.InvalidReasonChainReorg).Scan(&invalidated))
+	assert.Equal(t, 2, invalidated)
+
+	var kept bool
+	require.NoError(t, db.QueryRow(`SELECT invalidated FROM outliers WHERE id = 'o3'`).Scan(&kept))
+	assert.False(t, kept)
+}
+
+func TestOutlierStore_IncidentOpen(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE outliers (
+			id TEXT PRIMARY KEY,
+			org_id TEXT,
+			type TEXT NOT NULL,
+			address TEXT NOT NULL,
+			invalidated BOOLEAN NOT NULL DEFAULT false
+		);
+		CREATE TABLE outlier_triage (
+			outlier_id TEXT NOT NULL,
+			org_id TEXT NOT NULL,
+			acknowledged BOOLEAN NOT NULL DEFAULT false
+		);
+		INSERT INTO outliers (id, org_id, type, address, invalidated) VALUES
+			('s1', NULL, 'zscore', 'TA', false),
+			('s2', NULL, 'zscore', 'TA', false),
+			('s3', NULL, 'zscore', 'TA', true),
+			('s4', NULL, 'iqr', 'TA', false),
+			('b1', 'org-b', 'watchlist', 'TB', false),
+			('b2', 'org-b', 'watchlist', 'TB', false);
+		INSERT INTO outlier_triage (outlier_id, org_id, acknowledged) VALUES
+			('s1', '00000000-0000-0000-0000-000000000001', true),
+			('s2', 'org-b', true),
+			('b1', 'org-b', true);
+	`)
+	require.NoError(t, err)
+
+	store := detection.NewOutlierStore(db, zaptest.NewLogger(t))
+	open := func(id, orgID string, outlierType models.OutlierType, address string) bool {
+		t.Helper()
+		result, err := store.IncidentOpen(context.Background(), models.Outlier{ID: id, OrgID: orgID, Type: outlierType, Address: address})
+		require.NoError(t, err)
+		return result
+	}
+
+	// s2 waits for the default organization; another organization's
+	// acknowledgement, the invalidated s3 and the IQR outlier do not count
+	assert.True(t, open("s1", "", models.OutlierTypeZScore, "TA"))
+	_, err = db.Exec(`INSERT INTO outlier_triage (outlier_id, org_id, acknowledged) VALUES ('s2', '00000000-0000-0000-0000-000000000001', true)`)
+	require.NoError(t, err)
+	assert.False(t, open("s1", "", models.OutlierTypeZScore, "TA"))
+
+	assert.True(t, open("b1", "org-b", models.OutlierTypeWatchlist, "TB"))
+	_, err = db.Exec(`INSERT INTO outlier_triage (outlier_id, org_id, acknowledged) VALUES ('b2', 'org-b', true)`)
+	require.NoError(t, err)
+	assert.False(t, open("b1", "org-b", models.OutlierTypeWatchlist, "TB"))
+
+	// An outlier without an address is its own incident
+	assert.False(t, open("x1", "", models.OutlierTypeZScore, ""))
+}
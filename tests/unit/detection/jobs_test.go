@@ -0,0 +1,97 @@
+package detection_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestJobManager_SubmitAndWait(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]graph.TransactionInfo{})
+	}))
+	defer server.Close()
+
+	manager := newJobManager(t, server.URL, 2)
+
+	job, err := manager.Submit(context.Background(), detection.DetectOptions{Addresses: []string{"TAddr"}}, "user-1")
+	require.NoError(t, err)
+	assert.NotEmpty(t, job.ID)
+	assert.Equal(t, "user-1", job.SubmittedBy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	finished, ok := manager.Wait(ctx, job.ID)
+	require.True(t, ok)
+	assert.Equal(t, detection.JobStatusCompleted, finished.Status)
+	assert.Equal(t, 0, finished.OutlierCount)
+	assert.NotNil(t, finished.CompletedAt)
+
+	_, ok = manager.Get("missing")
+	assert.False(t, ok)
+}
+
+func TestJobManager_Failure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	manager := newJobManager(t, server.URL, 2)
+
+	job, err := manager.Submit(context.Background(), detection.DetectOptions{}, "user-1")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	finished, ok := manager.Wait(ctx, job.ID)
+	require.True(t, ok)
+	assert.Equal(t, detection.JobStatusFailed, finished.Status)
+	assert.NotEmpty(t, finished.Error)
+}
+
+func TestJobManager_ConcurrencyLimit(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		json.NewEncoder(w).Encode([]graph.TransactionInfo{})
+	}))
+	defer server.Close()
+	defer close(release)
+
+	manager := newJobManager(t, server.URL, 1)
+
+	_, err := manager.Submit(context.Background(), detection.DetectOptions{}, "user-1")
+	require.NoError(t, err)
+
+	_, err = manager.Submit(context.Background(), detection.DetectOptions{}, "user-2")
+	assert.ErrorIs(t, err, detection.ErrTooManyJobs)
+}
+
+func newJobManager(t *testing.T, baseURL string, maxConcurrent int) *detection.JobManager {
+	logger := zaptest.NewLogger(t)
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{
+		BaseURL: baseURL,
+		Timeout: 5 * time.Second,
+	}, logger)
+	detector := detection.NewAnomalyDetector(detection.AnomalyDetectorConfig{
+		Interval: time.Minute,
+	}, client, logger)
+
+	return detection.NewJobManager(detector, detection.JobManagerConfig{
+		MaxConcurrent: maxConcurrent,
+		Timeout:       5 * time.Second,
+	}, logger)
+}
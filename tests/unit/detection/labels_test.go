@@ -0,0 +1,100 @@
+package detection_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func setupAddressLabels(t *testing.T) *detection.AddressLabels {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE address_labels (
+			address TEXT PRIMARY KEY,
+			label TEXT NOT NULL,
+			category TEXT NOT NULL,
+			source TEXT NOT NULL DEFAULT 'manual',
+			updated_by TEXT NOT NULL DEFAULT '',
+			updated_at DATETIME NOT NULL
+		)
+	`)
+	require.NoError(t, err)
+	for _, row := range []struct{ address, label, category string }{
+		{"TExchange", "Binance hot wallet", "exchange"},
+		{"0xabcdef0000000000000000000000000000000001", "Tornado Cash", "mixer"},
+		{"TMerchant", "Coffee shop", "merchant"},
+	} {
+		_, err := db.Exec(`INSERT INTO address_labels (address, label, category, updated_at) VALUES (?, ?, ?, ?)`,
+			row.address, row.label, row.category, time.Now().UTC())
+		require.NoError(t, err)
+	}
+
+	labels := detection.NewAddressLabels(db, detection.AddressLabelsConfig{
+		ExemptCategories:   []models.LabelCategory{models.LabelCategoryExchange},
+		EscalateCategories: []models.LabelCategory{models.LabelCategoryMixer},
+	}, zaptest.NewLogger(t))
+	require.NoError(t, labels.Refresh(context.Background()))
+	return labels
+}
+
+func TestAddressLabels_Lookup(t *testing.T) {
+	labels := setupAddressLabels(t)
+
+	label, ok := labels.Lookup("0xABCDEF0000000000000000000000000000000001")
+	require.True(t, ok)
+	assert.Equal(t, "Tornado Cash", label.Label)
+
+	_, ok = labels.Lookup("texchange")
+	assert.False(t, ok, "base58 addresses are case-sensitive")
+}
+
+func TestAddressLabels_Apply(t *testing.T) {
+	labels := setupAddressLabels(t)
+
+	outliers := labels.Apply([]models.Outlier{
+		// An exchange's fan-out is normal business
+		{ID: "fanout", Type: models.OutlierTypePatternFanOut, Severity: models.SeverityHigh, Address: "TExchange"},
+		// but its statistical outliers are kept
+		{ID: "zscore", Type: models.OutlierTypeZScore, Severity: models.SeverityMedium, Address: "TExchange"},
+		{ID: "mixer", Type: models.OutlierTypeZScore, Severity: models.SeverityLow, Address: "TUser",
+			Details: map[string]interface{}{"counterparty": "0xAbCdEf0000000000000000000000000000000001"}},
+		{ID: "cluster", Type: models.OutlierTypePatternCluster, Severity: models.SeverityCritical, Address: "TUser",
+			Details: map[string]interface{}{"members": []string{"TMerchant", "TUnknown"}}},
+		{ID: "plain", Type: models.OutlierTypeIQR, Severity: models.SeverityLow, Address: "TUnknown"},
+	})
+	require.Len(t, outliers, 4)
+
+	byID := make(map[string]models.Outlier)
+	for _, outlier := range outliers {
+		byID[outlier.ID] = outlier
+	}
+	assert.NotContains(t, byID, "fanout")
+
+	exchange := byID["zscore"]
+	assert.Equal(t, models.SeverityMedium, exchange.Severity)
+	assert.Equal(t, "Binance hot wallet", exchange.Details["address_label"].(map[string]interface{})["label"])
+
+	// A mixer counterparty raises the severity one level
+	mixer := byID["mixer"]
+	assert.Equal(t, models.SeverityMedium, mixer.Severity)
+	assert.Equal(t, "mixer", mixer.Details["escalated_by_label"])
+	assert.Equal(t, "Tornado Cash", mixer.Details["counterparty_label"].(map[string]interface{})["label"])
+
+	members := byID["cluster"].Details["member_labels"].(map[string]interface{})
+	assert.Len(t, members, 1)
+	assert.Contains(t, members, "TMerchant")
+	assert.Equal(t, models.SeverityCritical, byID["cluster"].Severity)
+
+	assert.Nil(t, byID["plain"].Details)
+}
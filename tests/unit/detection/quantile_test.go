@@ -0,0 +1,119 @@
+package detection_test
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"gonum.org/v1/gonum/stat"
+)
+
+func TestP2Quantile_TracksExactQuantiles(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+
+	q1 := detection.NewP2Quantile(0.25)
+	q3 := detection.NewP2Quantile(0.75)
+	values := make([]float64, 0, 50000)
+
+	for i := 0; i < 50000; i++ {
+		// Exponential amounts are skewed like USDT transfers
+		v := rng.ExpFloat64() * 1000
+		values = append(values, v)
+		q1.Add(v)
+		q3.Add(v)
+	}
+
+	sort.Float64s(values)
+	exactQ1 := stat.Quantile(0.25, stat.Empirical, values, nil)
+	exactQ3 := stat.Quantile(0.75, stat.Empirical, values, nil)
+
+	assert.Equal(t, 50000, q1.Count())
+	assert.InEpsilon(t, exactQ1, q1.Value(), 0.02)
+	assert.InEpsilon(t, exactQ3, q3.Value(), 0.02)
+}
+
+func TestP2Quantile_FewObservations(t *testing.T) {
+	q := detection.NewP2Quantile(0.5)
+	assert.Equal(t, 0.0, q.Value())
+
+	for _, v := range []float64{5, 1, 3} {
+		q.Add(v)
+	}
+	assert.Equal(t, 3.0, q.Value())
+}
+
+func TestIQRDetector_StreamingBaseline(t *testing.T) {
+	detector := detection.NewIQRDetector(detection.IQRConfig{
+		Multiplier:     1.5,
+		MinDataPoints:  10,
+		WindowDuration: 24 * time.Hour,
+		Streaming:      true,
+	}, zaptest.NewLogger(t))
+
+	start := time.Now().Add(-time.Hour)
+	cycle := func(offset, n int) []models.Transaction {
+		var transactions []models.Transaction
+		for i := offset; i < offset+n; i++ {
+			transactions = append(transactions, createTransaction(
+				fmt.Sprintf("tx-%d", i), "From", "To", fmt.Sprintf("%d", 100+i%20),
+				start.Add(time.Duration(i)*time.Second)))
+		}
+		return transactions
+	}
+
+	first := cycle(0, 50)
+	baseline, ok := detector.StreamingBaseline("USDT", first)
+	require.True(t, ok)
+	assert.True(t, baseline.Estimated)
+	assert.Equal(t, 50, baseline.SampleSize)
+
+	// Overlapping window: only the 30 new transactions are added
+	second := append(first[20:], cycle(50, 30)...)
+	baseline, ok = detector.StreamingBaseline("USDT", second)
+	require.True(t, ok)
+	assert.Equal(t, 80, baseline.SampleSize)
+
+	// A transaction backfilled with an older timestamp is still added, once
+	backfilled := append(second, createTransaction("tx-late", "From", "To", "110", start.Add(-time.Minute)))
+	baseline, ok = detector.StreamingBaseline("USDT", backfilled)
+	require.True(t, ok)
+	assert.Equal(t, 81, baseline.SampleSize)
+	baseline, ok = detector.StreamingBaseline("USDT", backfilled)
+	require.True(t, ok)
+	assert.Equal(t, 81, baseline.SampleSize)
+
+	// A small cycle can still be scored against the accumulated baseline
+	whale := []models.Transaction{createTransaction("whale", "Whale", "To", "1000000", start.Add(time.Hour))}
+	baseline, ok = detector.StreamingBaseline("USDT", whale)
+	require.True(t, ok)
+	outliers := detector.Score(whale, baseline)
+	require.Len(t, outliers, 1)
+	assert.Equal(t, true, outliers[0].Details["estimated"])
+
+	// Other tokens have quartiles of their own
+	_, ok = detector.StreamingBaseline("USDC", whale)
+	assert.False(t, ok)
+}
+
+func TestIQRDetector_StreamingDisabledUsesExactBaseline(t *testing.T) {
+	detector := detection.NewIQRDetector(detection.IQRConfig{
+		Multiplier:    1.5,
+		MinDataPoints: 10,
+	}, zaptest.NewLogger(t))
+
+	var transactions []models.Transaction
+	for i := 0; i < 20; i++ {
+		transactions = append(transactions, createTransaction(fmt.Sprintf("tx-%d", i), "From", "To", "100", time.Now()))
+	}
+
+	baseline, ok := detector.StreamingBaseline("USDT", transactions)
+	require.True(t, ok)
+	assert.False(t, baseline.Estimated)
+}
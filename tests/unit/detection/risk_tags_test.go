@@ -0,0 +1,107 @@
+package detection_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestAnomalyDetector_TagsFlaggedAddresses(t *testing.T) {
+	now := time.Now().Unix()
+	var txInfos []graph.TransactionInfo
+	for i := 0; i < 50; i++ {
+		txInfos = append(txInfos, graph.TransactionInfo{
+			TxHash:    fmt.Sprintf("tx-%d", i),
+			From:      fmt.Sprintf("Sender%d", i),
+			To:        "Receiver",
+			Amount:    "100",
+			Timestamp: now,
+		})
+	}
+	txInfos = append(txInfos, graph.TransactionInfo{
+		TxHash:    "whale",
+		From:      "Whale",
+		To:        "Receiver",
+		Amount:    "1000000",
+		Timestamp: now,
+	})
+
+	var mu sync.Mutex
+	tags := make(map[string]map[string]interface{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/graph/window":
+			json.NewEncoder(w).Encode(txInfos)
+		case r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/properties"):
+			var body struct {
+				Properties map[string]interface{} `json:"properties"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			address := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/graph/node/"), "/properties")
+			mu.Lock()
+			tags[address] = body.Properties
+			mu.Unlock()
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	detect := func(tagNodes bool) []models.Outlier {
+		logger := zaptest.NewLogger(t)
+		client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: 5 * time.Second}, logger)
+		detector := detection.NewAnomalyDetector(detection.AnomalyDetectorConfig{
+			Interval:     time.Minute,
+			ZScoreConfig: detection.ZScoreConfig{Threshold: 3.0, MinDataPoints: 30},
+			IQRConfig:    detection.IQRConfig{Multiplier: 1.5, MinDataPoints: 30},
+			PatternDetectorConfig: detection.PatternDetectorConfig{
+				FanOutThreshold:   1000,
+				FanInThreshold:    1000,
+				VelocityWindow:    time.Hour,
+				VelocityThreshold: 1000,
+				ClusterWindow:     time.Hour,
+			},
+			TagNodes: tagNodes,
+		}, client, logger)
+
+		outliers, err := detector.DetectOnce(context.Background(), detection.DetectOptions{})
+		require.NoError(t, err)
+		require.NotEmpty(t, outliers)
+		return outliers
+	}
+
+	detect(false)
+	assert.Empty(t, tags)
+
+	outliers := detect(true)
+	worst := make(map[string]models.Severity)
+	for _, o := range outliers {
+		if o.Severity.RiskScore() > worst[o.Address].RiskScore() {
+			worst[o.Address] = o.Severity
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, tags, len(worst))
+	for address, severity := range worst {
+		require.Contains(t, tags, address)
+		assert.Equal(t, string(severity), tags[address][graph.PropertyRiskSeverity])
+		assert.Equal(t, severity.RiskScore(), tags[address][graph.PropertyRiskScore])
+		assert.NotZero(t, tags[address][graph.PropertyRiskAt])
+	}
+}
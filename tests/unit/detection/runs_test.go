@@ -0,0 +1,178 @@
+package detection_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// memoryRecorder keeps the latest state of each recorded run
+type memoryRecorder struct {
+	mu   sync.Mutex
+	runs map[string]models.DetectionRun
+}
+
+func (r *memoryRecorder) RecordRun(ctx context.Context, run *models.DetectionRun) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs[run.ID] = *run
+	return nil
+}
+
+func TestAnomalyDetector_RecordsRuns(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]graph.TransactionInfo{})
+	}))
+	defer server.Close()
+
+	logger := zaptest.NewLogger(t)
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: 5 * time.Second}, logger)
+	detector := detection.NewAnomalyDetector(detection.AnomalyDetectorConfig{Interval: time.Minute}, client, logger)
+
+	recorder := &memoryRecorder{runs: make(map[string]models.DetectionRun)}
+	detector.SetRunRecorder(recorder)
+
+	_, err := detector.DetectOnce(context.Background(), detection.DetectOptions{TriggeredBy: "user-1"})
+	require.NoError(t, err)
+
+	require.Len(t, recorder.runs, 1)
+	for _, run := range recorder.runs {
+		assert.Equal(t, models.DetectionRunManual, run.Trigger)
+		assert.Equal(t, models.DetectionRunCompleted, run.Status)
+		assert.Equal(t, "user-1", run.TriggeredBy)
+		assert.NotNil(t, run.CompletedAt)
+		assert.Equal(t, detection.ZScoreDetectorVersion, run.DetectorVersions["zscore"])
+		assert.WithinDuration(t, run.WindowEnd.Add(-24*time.Hour), run.WindowStart, time.Second)
+	}
+}
+
+func TestAnomalyDetector_CycleStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]graph.TransactionInfo{})
+	}))
+	defer server.Close()
+
+	logger := zaptest.NewLogger(t)
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: 5 * time.Second}, logger)
+	detector := detection.NewAnomalyDetector(detection.AnomalyDetectorConfig{Interval: time.Minute}, client, logger)
+	assert.Equal(t, detection.CycleStatus{}, detector.CycleStatus())
+
+	// Manual runs are not cycles of the loop
+	_, err := detector.DetectOnce(context.Background(), detection.DetectOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, detector.CycleStatus().LastCycle)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, detector.Start(ctx))
+	defer detector.Stop()
+
+	// The loop runs a cycle as soon as it starts
+	require.Eventually(t, func() bool {
+		return detector.CycleStatus().LastCycle != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	status := detector.CycleStatus()
+	assert.True(t, status.Running)
+	assert.False(t, status.InProgress)
+	assert.Equal(t, models.DetectionRunScheduled, status.LastCycle.Trigger)
+	assert.Equal(t, models.DetectionRunCompleted, status.LastCycle.Status)
+}
+
+func TestRunStore_RecordRun(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE detection_runs (
+			id TEXT PRIMARY KEY,
+			trigger TEXT NOT NULL,
+			triggered_by TEXT,
+			status TEXT NOT NULL,
+			started_at DATETIME NOT NULL,
+			completed_at DATETIME,
+			window_start DATETIME NOT NULL,
+			window_end DATETIME NOT NULL,
+			transactions_analyzed INTEGER NOT NULL DEFAULT 0,
+			outliers_found INTEGER NOT NULL DEFAULT 0,
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			detector_versions TEXT NOT NULL DEFAULT '{}',
+			error TEXT
+		)
+	`)
+	require.NoError(t, err)
+
+	store := detection.NewRunStore(db, zaptest.NewLogger(t))
+	now := time.Now()
+
+	run := &models.DetectionRun{
+		ID:               "run-1",
+		Trigger:          models.DetectionRunScheduled,
+		Status:           models.DetectionRunRunning,
+		StartedAt:        now,
+		WindowStart:      now.Add(-2 * time.Minute),
+		WindowEnd:        now,
+		DetectorVersions: map[string]string{"zscore": "1.0.0"},
+	}
+	require.NoError(t, store.RecordRun(context.Background(), run))
+
+	// Recording the same run again updates its outcome
+	completed := now.Add(time.Second)
+	run.Status = models.DetectionRunCompleted
+	run.CompletedAt = &completed
+	run.TransactionsAnalyzed = 120
+	run.OutliersFound = 3
+	run.DurationMs = 1000
+	require.NoError(t, store.RecordRun(context.Background(), run))
+
+	var count, analyzed, found int
+	var status string
+	err = db.QueryRow(`SELECT COUNT(*), MAX(status), MAX(transactions_analyzed), MAX(outliers_found) FROM detection_runs`).
+		Scan(&count, &status, &analyzed, &found)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, "completed", status)
+	assert.Equal(t, 120, analyzed)
+	assert.Equal(t, 3, found)
+}
+
+func TestAnomalyDetector_DetectOnceTokenFilter(t *testing.T) {
+	now := time.Now().Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]graph.TransactionInfo{
+			{TxHash: "tx-1", From: "TA", To: "TB", Amount: "100", BlockNumber: 1, Timestamp: now, Token: "USDT"},
+			{TxHash: "tx-2", From: "TB", To: "TC", Amount: "100", BlockNumber: 2, Timestamp: now, Token: "USDC"},
+			{TxHash: "tx-3", From: "TC", To: "TA", Amount: "100", BlockNumber: 3, Timestamp: now, Token: "USDC"},
+		})
+	}))
+	defer server.Close()
+
+	logger := zaptest.NewLogger(t)
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: 5 * time.Second}, logger)
+	detector := detection.NewAnomalyDetector(detection.AnomalyDetectorConfig{Interval: time.Minute}, client, logger)
+
+	recorder := &memoryRecorder{runs: make(map[string]models.DetectionRun)}
+	detector.SetRunRecorder(recorder)
+
+	_, err := detector.DetectOnce(context.Background(), detection.DetectOptions{Token: "usdc"})
+	require.NoError(t, err)
+
+	require.Len(t, recorder.runs, 1)
+	for _, run := range recorder.runs {
+		assert.Equal(t, 2, run.TransactionsAnalyzed)
+	}
+}
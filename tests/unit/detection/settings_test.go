@@ -0,0 +1,190 @@
+package detection_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/internal/features"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// setupSettingsDetector returns a detector over 20 ordinary transfers and
+// one large one, with a Z-score threshold too high to flag it
+func setupSettingsDetector(t *testing.T) *detection.AnomalyDetector {
+	now := time.Now().Unix()
+	transactions := []graph.TransactionInfo{
+		{TxHash: "tx-big", From: "TWhale", To: "TB", Amount: "100000", BlockNumber: 1, Timestamp: now},
+	}
+	for i := 0; i < 20; i++ {
+		transactions = append(transactions, graph.TransactionInfo{
+			TxHash: fmt.Sprintf("tx-%d", i), From: "TA", To: "TB", Amount: "100", BlockNumber: i + 2, Timestamp: now,
+		})
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(transactions)
+	}))
+	t.Cleanup(server.Close)
+
+	logger := zaptest.NewLogger(t)
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: 5 * time.Second}, logger)
+	return detection.NewAnomalyDetector(detection.AnomalyDetectorConfig{
+		Interval:     time.Minute,
+		ZScoreConfig: detection.ZScoreConfig{Threshold: 100, MinDataPoints: 10, WindowDuration: time.Hour},
+		IQRConfig:    detection.IQRConfig{Multiplier: 1.5, MinDataPoints: 10, WindowDuration: time.Hour},
+		DBSCANConfig: detection.DBSCANConfig{Epsilon: 0.5, MinPoints: 5},
+		PatternDetectorConfig: detection.PatternDetectorConfig{
+			CirculationWindow: time.Hour,
+			FanOutThreshold:   50,
+			FanInThreshold:    50,
+			VelocityWindow:    time.Hour,
+			VelocityThreshold: 100,
+			ClusterWindow:     time.Hour,
+			ClusterMinSize:    3,
+			ClusterMinDensity: 0.3,
+			FanWindow:         time.Hour,
+		},
+		// Every amount but one is equal, so IQR would flag it at any multiplier
+		Disabled: map[models.OutlierType]bool{models.OutlierTypeIQR: true},
+	}, client, logger)
+}
+
+func TestAnomalyDetector_ApplySettings(t *testing.T) {
+	detector := setupSettingsDetector(t)
+	recorder := &memoryRecorder{runs: make(map[string]models.DetectionRun)}
+	detector.SetRunRecorder(recorder)
+
+	settings := detector.Settings()
+	assert.Equal(t, 100.0, settings.ZScoreThreshold)
+	assert.Equal(t, time.Hour, settings.WindowDuration)
+	assert.True(t, settings.Enabled[models.OutlierTypeZScore])
+	assert.False(t, settings.Enabled[models.OutlierTypeIQR])
+	assert.False(t, settings.Enabled[models.OutlierTypeDBSCAN], "DBSCAN is off unless enabled")
+
+	outliers, err := detector.DetectOnce(context.Background(), detection.DetectOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, outliers)
+
+	// Lowering the threshold takes effect on the next run
+	settings.ZScoreThreshold = 3
+	require.NoError(t, detector.ApplySettings(settings))
+	assert.Equal(t, 3.0, detector.Settings().ZScoreThreshold)
+	outliers, err = detector.DetectOnce(context.Background(), detection.DetectOptions{})
+	require.NoError(t, err)
+	require.Len(t, outliers, 1)
+	assert.Equal(t, models.OutlierTypeZScore, outliers[0].Type)
+	assert.Equal(t, "tx-big", outliers[0].TransactionHash)
+
+	// Disabled detectors neither run nor appear in the run's versions
+	settings.Enabled = map[models.OutlierType]bool{models.OutlierTypeZScore: false}
+	require.NoError(t, detector.ApplySettings(settings))
+	assert.False(t, detector.Settings().Enabled[models.OutlierTypeZScore])
+	recorder.runs = make(map[string]models.DetectionRun)
+	outliers, err = detector.DetectOnce(context.Background(), detection.DetectOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, outliers)
+	for _, run := range recorder.runs {
+		assert.NotContains(t, run.DetectorVersions, "zscore")
+	}
+
+	// Invalid settings are rejected and the current ones kept
+	settings.ZScoreThreshold = 0
+	assert.Error(t, detector.ApplySettings(settings))
+	settings.ZScoreThreshold = 3
+	settings.Enabled = map[models.OutlierType]bool{models.OutlierTypeSanctions: true}
+	assert.Error(t, detector.ApplySettings(settings))
+	assert.Equal(t, 3.0, detector.Settings().ZScoreThreshold)
+}
+
+func TestSettingsStore_Sync(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec(`
+		CREATE TABLE detection_config (
+			id INTEGER PRIMARY KEY,
+			settings TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			updated_by TEXT NOT NULL DEFAULT '',
+			updated_at DATETIME NOT NULL
+		)
+	`)
+	require.NoError(t, err)
+
+	detector := setupSettingsDetector(t)
+	store := detection.NewSettingsStore(db, zaptest.NewLogger(t))
+
+	// Nothing saved leaves the file configuration in effect
+	stored, err := store.Load(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+	require.NoError(t, store.Sync(context.Background(), detector))
+	assert.Equal(t, 100.0, detector.Settings().ZScoreThreshold)
+
+	settings := detector.Settings()
+	settings.ZScoreThreshold = 4
+	stored, err = store.Save(context.Background(), settings, "admin-1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored.Version)
+
+	settings.FanOutThreshold = 25
+	stored, err = store.Save(context.Background(), settings, "admin-2")
+	require.NoError(t, err)
+	assert.Equal(t, 2, stored.Version)
+
+	stored, err = store.Load(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, "admin-2", stored.UpdatedBy)
+	assert.Equal(t, 25, stored.FanOutThreshold)
+	assert.Equal(t, time.Hour, stored.VelocityWindow)
+
+	require.NoError(t, store.Sync(context.Background(), detector))
+	assert.Equal(t, 4.0, detector.Settings().ZScoreThreshold)
+	assert.Equal(t, 25, detector.Settings().FanOutThreshold)
+
+	settings.ZScoreThreshold = -1
+	_, err = store.Save(context.Background(), settings, "admin-1")
+	assert.Error(t, err)
+}
+
+func TestAnomalyDetector_FeatureFlags(t *testing.T) {
+	detector := setupSettingsDetector(t)
+	recorder := &memoryRecorder{runs: make(map[string]models.DetectionRun)}
+	detector.SetRunRecorder(recorder)
+
+	settings := detector.Settings()
+	settings.Enabled = map[models.OutlierType]bool{models.OutlierTypeDBSCAN: true}
+	require.NoError(t, detector.ApplySettings(settings))
+
+	_, err := detector.DetectOnce(context.Background(), detection.DetectOptions{})
+	require.NoError(t, err)
+	require.NotEmpty(t, recorder.runs)
+	for _, run := range recorder.runs {
+		assert.Contains(t, run.DetectorVersions, "dbscan")
+	}
+
+	// The flag gates DBSCAN even where the settings enable it
+	detector.SetFeatureFlags(features.New(nil, features.Config{
+		Environment: "production",
+		Defaults:    map[string]bool{features.DBSCANDetector: false},
+	}, zaptest.NewLogger(t)))
+	recorder.runs = make(map[string]models.DetectionRun)
+	_, err = detector.DetectOnce(context.Background(), detection.DetectOptions{})
+	require.NoError(t, err)
+	require.NotEmpty(t, recorder.runs)
+	for _, run := range recorder.runs {
+		assert.NotContains(t, run.DetectorVersions, "dbscan")
+	}
+}
@@ -0,0 +1,203 @@
+package detection_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestAnomalyDetector_ShardedDetectionMatchesSinglePass(t *testing.T) {
+	now := time.Now().Unix()
+	var txInfos []graph.TransactionInfo
+	for i := 0; i < 2000; i++ {
+		amount := fmt.Sprintf("%d", 100+i%50)
+		if i%250 == 0 {
+			amount = "1000000"
+		}
+		txInfos = append(txInfos, graph.TransactionInfo{
+			TxHash:    fmt.Sprintf("tx-%d", i),
+			From:      fmt.Sprintf("Sender%d", i%300),
+			To:        fmt.Sprintf("Receiver%d", i%120),
+			Amount:    amount,
+			Timestamp: now,
+		})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/graph/window" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(txInfos)
+	}))
+	defer server.Close()
+
+	run := func(shards int) (*detection.AnomalyDetector, []string) {
+		logger := zaptest.NewLogger(t)
+		client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: 5 * time.Second}, logger)
+		detector := detection.NewAnomalyDetector(detection.AnomalyDetectorConfig{
+			Interval:     time.Minute,
+			Shards:       shards,
+			Workers:      4,
+			ZScoreConfig: detection.ZScoreConfig{Threshold: 3.0, MinDataPoints: 30},
+			IQRConfig:    detection.IQRConfig{Multiplier: 1.5, MinDataPoints: 30},
+		}, client, logger)
+
+		outliers, err := detector.DetectOnce(context.Background(), detection.DetectOptions{})
+		require.NoError(t, err)
+
+		var hashes []string
+		for _, o := range outliers {
+			hashes = append(hashes, o.TransactionHash)
+		}
+		sort.Strings(hashes)
+		return detector, hashes
+	}
+
+	_, single := run(1)
+	detector, sharded := run(8)
+
+	require.NotEmpty(t, single)
+	assert.Equal(t, single, sharded)
+
+	timings := detector.ShardTimings()
+	require.Len(t, timings, 8)
+
+	total := 0
+	for _, timing := range timings {
+		total += timing.Transactions
+	}
+	assert.Equal(t, len(txInfos), total)
+}
+
+func TestAnomalyDetector_ShardDurationMetric(t *testing.T) {
+	now := time.Now().Unix()
+	var txInfos []graph.TransactionInfo
+	for i := 0; i < 400; i++ {
+		txInfos = append(txInfos, graph.TransactionInfo{
+			TxHash:    fmt.Sprintf("tx-%d", i),
+			From:      fmt.Sprintf("Sender%d", i%100),
+			To:        "Receiver",
+			Amount:    fmt.Sprintf("%d", 100+i%50),
+			Token:     "SHARDUSD",
+			Timestamp: now,
+		})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(txInfos)
+	}))
+	defer server.Close()
+
+	logger := zaptest.NewLogger(t)
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: 5 * time.Second}, logger)
+	detector := detection.NewAnomalyDetector(detection.AnomalyDetectorConfig{
+		Interval:     time.Minute,
+		Shards:       4,
+		Workers:      2,
+		ZScoreConfig: detection.ZScoreConfig{Threshold: 3.0, MinDataPoints: 30},
+		IQRConfig:    detection.IQRConfig{Multiplier: 1.5, MinDataPoints: 30},
+	}, client, logger)
+
+	before := make([]uint64, 4)
+	for shard := range before {
+		before[shard] = metrics.DetectionShardDuration.WithLabelValues("SHARDUSD", strconv.Itoa(shard)).Count()
+	}
+
+	_, err := detector.DetectOnce(context.Background(), detection.DetectOptions{})
+	require.NoError(t, err)
+
+	for shard := range before {
+		count := metrics.DetectionShardDuration.WithLabelValues("SHARDUSD", strconv.Itoa(shard)).Count()
+		assert.Equal(t, before[shard]+1, count, "shard %d", shard)
+	}
+}
+
+func TestIQRDetector_ScoresEachTransaction(t *testing.T) {
+	detector := detection.NewIQRDetector(detection.IQRConfig{Multiplier: 1.5, MinDataPoints: 10}, zaptest.NewLogger(t))
+
+	var transactions []models.Transaction
+	for i := 0; i < 30; i++ {
+		transactions = append(transactions, createTransaction(fmt.Sprintf("tx-%d", i), "From", "To", "100", time.Now()))
+	}
+	// Outlier in the middle of the slice, not at the end
+	transactions[5] = createTransaction("whale", "Whale", "To", "1000000", time.Now())
+
+	outliers, err := detector.Detect(transactions)
+	require.NoError(t, err)
+	require.Len(t, outliers, 1)
+	assert.Equal(t, "whale", outliers[0].TransactionHash)
+	assert.Equal(t, "Whale", outliers[0].Address)
+}
+
+func TestAnomalyDetector_ScheduledDetectionPerToken(t *testing.T) {
+	now := time.Now().Unix()
+	var txInfos []graph.TransactionInfo
+	for i := 0; i < 200; i++ {
+		txInfos = append(txInfos, graph.TransactionInfo{
+			TxHash: fmt.Sprintf("usdt-%d", i), From: fmt.Sprintf("Sender%d", i), To: "Receiver",
+			Amount: fmt.Sprintf("%d", 100+i%50), Token: "USDT", Timestamp: now,
+		})
+	}
+	// USDC transfers in the window are ordinary for USDC, but 500 times the
+	// size of the USDT ones
+	for i := 0; i < 50; i++ {
+		txInfos = append(txInfos, graph.TransactionInfo{
+			TxHash: fmt.Sprintf("usdc-%d", i), From: fmt.Sprintf("Sender%d", i), To: "Receiver",
+			Amount: fmt.Sprintf("%d", 50000+i%10*1000), Token: "usdc", Timestamp: now,
+		})
+	}
+	txInfos = append(txInfos, graph.TransactionInfo{
+		TxHash: "usdt-whale", From: "Whale", To: "Receiver", Amount: "50000", Token: "USDT", Timestamp: now,
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/graph/window" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(txInfos)
+	}))
+	defer server.Close()
+
+	logger := zaptest.NewLogger(t)
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: 5 * time.Second}, logger)
+	detector := detection.NewAnomalyDetector(detection.AnomalyDetectorConfig{
+		Interval:     time.Hour,
+		ZScoreConfig: detection.ZScoreConfig{Threshold: 3.0, MinDataPoints: 30},
+		IQRConfig:    detection.IQRConfig{Multiplier: 1.5, MinDataPoints: 30, Streaming: true},
+	}, client, logger)
+
+	require.NoError(t, detector.Start(context.Background()))
+	defer detector.Stop()
+	require.Eventually(t, func() bool { return detector.CycleStatus().LastCycle != nil },
+		5*time.Second, 10*time.Millisecond)
+
+	hashes := make(map[string]bool)
+	for len(detector.Outliers()) > 0 {
+		hashes[(<-detector.Outliers()).TransactionHash] = true
+	}
+	assert.Equal(t, map[string]bool{"usdt-whale": true}, hashes,
+		"each token should be scored against its own baseline")
+
+	// Timings cover every token in the cycle, not just the last one scored
+	scored := make(map[string]int)
+	for _, timing := range detector.ShardTimings() {
+		scored[timing.Token] += timing.Transactions
+	}
+	assert.Equal(t, map[string]int{"USDT": 201, "USDC": 50}, scored)
+}
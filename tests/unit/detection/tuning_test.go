@@ -0,0 +1,95 @@
+package detection_test
+
+import (
+	"testing"
+
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildTuningReport(t *testing.T) {
+	current := map[models.OutlierType]float64{
+		models.OutlierTypeZScore: 3.0,
+	}
+
+	t.Run("suggests raising threshold when false positives cluster low", func(t *testing.T) {
+		var samples []detection.FeedbackSample
+		// False positives just above the threshold, true positives well above
+		for _, score := range []float64{3.1, 3.2, 3.3, 3.4, 3.5, 3.6} {
+			samples = append(samples, zscoreSample(score, models.FeedbackFalsePositive))
+		}
+		for _, score := range []float64{4.5, 5.0, 5.5, 6.0, 7.0, 8.0} {
+			samples = append(samples, zscoreSample(score, models.FeedbackTruePositive))
+		}
+
+		report := detection.BuildTuningReport(samples, current, 0.2, 10)
+		require.Len(t, report.Detectors, 1)
+
+		tuning := report.Detectors[0]
+		assert.Equal(t, models.OutlierTypeZScore, tuning.Type)
+		assert.Equal(t, 12, tuning.Labelled)
+		assert.Equal(t, 6, tuning.FalsePositives)
+		assert.InDelta(t, 0.5, tuning.FalsePositiveRate, 0.0001)
+		assert.Equal(t, detection.RecommendationRaise, tuning.Recommendation)
+
+		require.NotNil(t, tuning.SuggestedThreshold)
+		assert.Greater(t, *tuning.SuggestedThreshold, 3.0)
+		assert.LessOrEqual(t, *tuning.SuggestedThreshold, 4.5)
+		require.NotNil(t, tuning.TruePositivesRetained)
+		assert.Equal(t, 6, *tuning.TruePositivesRetained)
+	})
+
+	t.Run("insufficient samples", func(t *testing.T) {
+		samples := []detection.FeedbackSample{
+			zscoreSample(3.5, models.FeedbackFalsePositive),
+		}
+
+		report := detection.BuildTuningReport(samples, current, 0.2, 10)
+		require.Len(t, report.Detectors, 1)
+		assert.Equal(t, detection.RecommendationInsufficientData, report.Detectors[0].Recommendation)
+		assert.Nil(t, report.Detectors[0].SuggestedThreshold)
+	})
+
+	t.Run("unscored detector needs review", func(t *testing.T) {
+		var samples []detection.FeedbackSample
+		for i := 0; i < 10; i++ {
+			samples = append(samples, detection.FeedbackSample{
+				Type:  models.OutlierTypePatternFanOut,
+				Label: models.FeedbackFalsePositive,
+			})
+		}
+
+		report := detection.BuildTuningReport(samples, current, 0.2, 10)
+		require.Len(t, report.Detectors, 1)
+		assert.Equal(t, detection.RecommendationReview, report.Detectors[0].Recommendation)
+	})
+}
+
+func TestFeedbackScore(t *testing.T) {
+	score, ok := detection.FeedbackScore(models.OutlierTypeZScore, map[string]interface{}{
+		"z_score": -4.2,
+	})
+	assert.True(t, ok)
+	assert.InDelta(t, 4.2, score, 0.0001)
+
+	score, ok = detection.FeedbackScore(models.OutlierTypeIQR, map[string]interface{}{
+		"deviation":  2.0,
+		"multiplier": 1.5,
+	})
+	assert.True(t, ok)
+	assert.InDelta(t, 3.5, score, 0.0001)
+
+	_, ok = detection.FeedbackScore(models.OutlierTypePatternDormant, map[string]interface{}{})
+	assert.False(t, ok)
+}
+
+func zscoreSample(score float64, label models.FeedbackLabel) detection.FeedbackSample {
+	return detection.FeedbackSample{
+		Type:     models.OutlierTypeZScore,
+		Label:    label,
+		Score:    score,
+		HasScore: true,
+	}
+}
@@ -0,0 +1,126 @@
+package detection_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mikedewar/stablerisk/internal/detection"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func setupWatchlistDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE watchlists (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001',
+			name TEXT NOT NULL
+		);
+		CREATE TABLE watchlist_entries (
+			id TEXT PRIMARY KEY,
+			watchlist_id TEXT NOT NULL,
+			address TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			expires_at DATETIME,
+			added_by TEXT NOT NULL DEFAULT '',
+			added_at DATETIME NOT NULL
+		);
+		INSERT INTO watchlists (id, name) VALUES ('w1', 'sanctions'), ('w2', 'exploits');
+	`)
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	for _, row := range []struct {
+		id, watchlistID, address string
+		expiresAt                *time.Time
+	}{
+		{"e1", "w1", "TSanctioned", nil},
+		{"e2", "w2", "TSanctioned", nil},
+		{"e3", "w2", "TDrainer", nil},
+		{"e4", "w1", "TExpired", ptrTime(now.Add(-time.Hour))},
+	} {
+		_, err := db.Exec(`INSERT INTO watchlist_entries (id, watchlist_id, address, reason, expires_at, added_at)
+			VALUES (?, ?, ?, 'test', ?, ?)`, row.id, row.watchlistID, row.address, row.expiresAt, now)
+		require.NoError(t, err)
+	}
+	return db
+}
+
+func ptrTime(t time.Time) *time.Time {
+	return &t
+}
+
+func TestWatchlistMatcher_Match(t *testing.T) {
+	matcher := detection.NewWatchlistMatcher(setupWatchlistDB(t), detection.WatchlistConfig{}, zaptest.NewLogger(t))
+
+	tx := func(from, to string) models.Transaction {
+		return models.Transaction{
+			TxHash:    "tx-" + from + "-" + to,
+			From:      from,
+			To:        to,
+			Amount:    decimal.NewFromInt(100),
+			Token:     "USDT",
+			Timestamp: time.Now(),
+		}
+	}
+
+	// Nothing matches before the first refresh
+	assert.Empty(t, matcher.Match(tx("TSanctioned", "TClean")))
+	require.NoError(t, matcher.Refresh(context.Background()))
+
+	outliers := matcher.Match(tx("TSanctioned", "TClean"))
+	require.Len(t, outliers, 1)
+	outlier := outliers[0]
+	assert.Equal(t, models.OutlierTypeWatchlist, outlier.Type)
+	assert.Equal(t, models.SeverityHigh, outlier.Severity)
+	assert.Equal(t, "TSanctioned", outlier.Address)
+	assert.Equal(t, "tx-TSanctioned-TClean", outlier.TransactionHash)
+	assert.Equal(t, []string{"exploits", "sanctions"}, outlier.Details["watchlists"])
+	assert.Equal(t, "sent", outlier.Details["direction"])
+	assert.Equal(t, "TClean", outlier.Details["counterparty"])
+
+	// Both sides watched
+	outliers = matcher.Match(tx("TSanctioned", "TDrainer"))
+	require.Len(t, outliers, 2)
+	assert.Equal(t, "TDrainer", outliers[1].Address)
+	assert.Equal(t, "received", outliers[1].Details["direction"])
+
+	// A self-transfer is reported once
+	assert.Len(t, matcher.Match(tx("TDrainer", "TDrainer")), 1)
+
+	// Expired entries are not loaded
+	assert.Empty(t, matcher.Match(tx("TExpired", "TClean")))
+	assert.Empty(t, matcher.Match(tx("TClean", "TOther")))
+}
+
+func TestWatchlistMatcher_Organizations(t *testing.T) {
+	db := setupWatchlistDB(t)
+	_, err := db.Exec(`
+		INSERT INTO watchlists (id, org_id, name) VALUES ('w3', 'org-b', 'team-b');
+		INSERT INTO watchlist_entries (id, watchlist_id, address, reason, added_at)
+			VALUES ('e5', 'w3', 'TSanctioned', 'test', CURRENT_TIMESTAMP);
+	`)
+	require.NoError(t, err)
+	matcher := detection.NewWatchlistMatcher(db, detection.WatchlistConfig{}, zaptest.NewLogger(t))
+	require.NoError(t, matcher.Refresh(context.Background()))
+
+	// Each organization watching the address gets its own outlier, naming
+	// only its own watchlists
+	outliers := matcher.Match(models.Transaction{TxHash: "tx", From: "TSanctioned", To: "TClean", Timestamp: time.Now()})
+	require.Len(t, outliers, 2)
+	assert.Equal(t, models.DefaultOrganizationID, outliers[0].OrgID)
+	assert.Equal(t, []string{"exploits", "sanctions"}, outliers[0].Details["watchlists"])
+	assert.Equal(t, "org-b", outliers[1].OrgID)
+	assert.Equal(t, []string{"team-b"}, outliers[1].Details["watchlists"])
+	assert.NotEqual(t, outliers[0].ID, outliers[1].ID)
+}
@@ -0,0 +1,42 @@
+package diagnostics_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mikedewar/stablerisk/internal/diagnostics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_ServesRuntimeAndPublishedVars(t *testing.T) {
+	diagnostics.Publish("test_component", func() interface{} {
+		return map[string]int{"queue_depth": 4}
+	})
+	// A second publish under the same name is ignored rather than panicking
+	diagnostics.Publish("test_component", func() interface{} { return nil })
+
+	recorder := httptest.NewRecorder()
+	diagnostics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var vars map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &vars))
+	assert.Contains(t, vars, "memstats")
+	assert.JSONEq(t, `{"queue_depth": 4}`, string(vars["test_component"]))
+
+	var runtimeStats map[string]interface{}
+	require.NoError(t, json.Unmarshal(vars["runtime"], &runtimeStats))
+	assert.Greater(t, runtimeStats["goroutines"], float64(0))
+}
+
+func TestHandler_ServesProfiles(t *testing.T) {
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine?debug=1", "/debug/pprof/heap"} {
+		recorder := httptest.NewRecorder()
+		diagnostics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, recorder.Code, path)
+		assert.NotEmpty(t, recorder.Body.Bytes(), path)
+	}
+}
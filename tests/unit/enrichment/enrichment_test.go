@@ -0,0 +1,294 @@
+package enrichment_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mikedewar/stablerisk/internal/enrichment"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func setupScreeningDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE address_screenings (
+			address TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			category TEXT NOT NULL DEFAULT '',
+			risk TEXT NOT NULL DEFAULT '',
+			entity TEXT NOT NULL DEFAULT '',
+			screened_at DATETIME NOT NULL,
+			PRIMARY KEY (address, provider)
+		)
+	`)
+	require.NoError(t, err)
+	return db
+}
+
+// chainalysisResponses answers like Chainalysis's entity API
+var chainalysisResponses = map[string]string{
+	"TMixer":  `{"address": "TMixer", "risk": "Severe", "cluster": {"name": "Sinbad", "category": "mixing"}, "riskReason": "Identified as mixing"}`,
+	"TUnseen": `{"address": "TUnseen", "risk": "Low", "cluster": null}`,
+}
+
+func TestHTTPProvider_Chainalysis(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "secret", r.Header.Get("Token"))
+		address := r.URL.Path[len("/api/risk/v2/entities/"):]
+		response, ok := chainalysisResponses[address]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	provider, err := enrichment.NewHTTPProvider(enrichment.HTTPConfig{
+		Name:   "chainalysis",
+		URL:    server.URL + "/api/risk/v2/entities/{address}",
+		APIKey: "secret",
+	})
+	require.NoError(t, err)
+
+	screening, err := provider.Screen(context.Background(), "TMixer")
+	require.NoError(t, err)
+	assert.Equal(t, "chainalysis", screening.Provider)
+	assert.Equal(t, "mixing", screening.Category)
+	assert.Equal(t, "Severe", screening.Risk)
+	assert.Equal(t, "Sinbad", screening.Entity)
+
+	// No cluster
+	screening, err = provider.Screen(context.Background(), "TUnseen")
+	require.NoError(t, err)
+	assert.Empty(t, screening.Category)
+	assert.Equal(t, "Low", screening.Risk)
+
+	// Never seen
+	screening, err = provider.Screen(context.Background(), "TNobody")
+	require.NoError(t, err)
+	assert.False(t, screening.Known())
+}
+
+func TestHTTPProvider_PostedBodyAndArrayPaths(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Basic key", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		assert.JSONEq(t, `[{"address": "TScam", "chain": "tron"}]`, string(body))
+		w.Write([]byte(`[{"address": "TScam", "addressRiskIndicators": [
+			{"category": "Scam", "categoryRiskScoreLevelLabel": "High", "riskType": "OWNERSHIP"}
+		], "entities": [{"entity": "Fake exchange", "riskScoreLevel": 10}]}]`))
+	}))
+	defer server.Close()
+
+	provider, err := enrichment.NewHTTPProvider(enrichment.HTTPConfig{
+		Name:          "trm",
+		URL:           server.URL + "/public/v2/screening/addresses",
+		Body:          `[{"address": "{address}", "chain": "tron"}]`,
+		APIKeyHeader:  "Authorization",
+		APIKey:        "Basic key",
+		CategoryField: "0.addressRiskIndicators.0.category",
+		RiskField:     "0.entities.0.riskScoreLevel",
+		EntityField:   "0.entities.0.entity",
+	})
+	require.NoError(t, err)
+
+	screening, err := provider.Screen(context.Background(), "TScam")
+	require.NoError(t, err)
+	assert.Equal(t, "Scam", screening.Category)
+	assert.Equal(t, "10", screening.Risk)
+	assert.Equal(t, "Fake exchange", screening.Entity)
+}
+
+func TestHTTPProvider_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	provider, err := enrichment.NewHTTPProvider(enrichment.HTTPConfig{Name: "chainalysis", URL: server.URL + "/{address}"})
+	require.NoError(t, err)
+	_, err = provider.Screen(context.Background(), "TMixer")
+	assert.ErrorContains(t, err, "status 429")
+
+	_, err = enrichment.NewHTTPProvider(enrichment.HTTPConfig{URL: server.URL})
+	assert.Error(t, err)
+	_, err = enrichment.NewHTTPProvider(enrichment.HTTPConfig{Name: "chainalysis"})
+	assert.Error(t, err)
+}
+
+// fakeProvider answers from a map, counting lookups
+type fakeProvider struct {
+	mu          sync.Mutex
+	screenings  map[string]models.AddressScreening
+	failing     map[string]bool
+	lookups     map[string]int
+	lookupCount int
+}
+
+func newFakeProvider() *fakeProvider {
+	return &fakeProvider{
+		screenings: map[string]models.AddressScreening{
+			"TMixer":    {Category: "mixing", Risk: "Severe", Entity: "Sinbad"},
+			"TExchange": {Category: "exchange", Risk: "Low", Entity: "Kraken"},
+			"TMember":   {Category: "scam", Risk: "High"},
+		},
+		failing: map[string]bool{"TFailing": true},
+		lookups: make(map[string]int),
+	}
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) Screen(ctx context.Context, address string) (*models.AddressScreening, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lookups[address]++
+	p.lookupCount++
+	if p.failing[address] {
+		return nil, errors.New("unavailable")
+	}
+	screening := p.screenings[address]
+	screening.Address = address
+	return &screening, nil
+}
+
+func TestEnricher_Enrich(t *testing.T) {
+	provider := newFakeProvider()
+	enricher := enrichment.NewEnricher(provider, nil, enrichment.Config{}, zaptest.NewLogger(t))
+
+	outliers := enricher.Enrich(context.Background(), []models.Outlier{
+		{ID: "o1", Type: models.OutlierTypePatternFanOut, Address: "TMixer",
+			Details: map[string]interface{}{"counterparty": "TExchange"}},
+		{ID: "o2", Type: models.OutlierTypeZScore, Address: "TClean"},
+		{ID: "o3", Type: models.OutlierTypePatternCluster, Address: "TFailing",
+			Details: map[string]interface{}{"members": []interface{}{"TMember", "TClean"}}},
+	})
+	require.Len(t, outliers, 3)
+
+	risk, ok := outliers[0].Details["external_risk"].(map[string]interface{})
+	require.True(t, ok, outliers[0].Details)
+	assert.Equal(t, "fake", risk["provider"])
+	assert.Equal(t, "mixing", risk["category"])
+	assert.Equal(t, "Severe", risk["risk"])
+	assert.Equal(t, "Sinbad", risk["entity"])
+	assert.NotEmpty(t, risk["screened_at"])
+	counterpartyRisk, ok := outliers[0].Details["counterparty_external_risk"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "exchange", counterpartyRisk["category"])
+
+	// Unknown to the provider
+	assert.Nil(t, outliers[1].Details)
+
+	// The address failed to screen, but its members did
+	assert.NotContains(t, outliers[2].Details, "external_risk")
+	memberRisks, ok := outliers[2].Details["member_external_risk"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Len(t, memberRisks, 1)
+	assert.Contains(t, memberRisks, "TMember")
+
+	// Each address is screened once
+	assert.Equal(t, 5, provider.lookupCount)
+}
+
+func TestEnricher_MaxAddresses(t *testing.T) {
+	provider := newFakeProvider()
+	enricher := enrichment.NewEnricher(provider, nil, enrichment.Config{MaxAddresses: 1}, nil)
+
+	outliers := enricher.Enrich(context.Background(), []models.Outlier{
+		{ID: "o1", Address: "TMixer", Details: map[string]interface{}{"counterparty": "TExchange"}},
+	})
+
+	// The outlier's own address comes first
+	assert.Contains(t, outliers[0].Details, "external_risk")
+	assert.NotContains(t, outliers[0].Details, "counterparty_external_risk")
+	assert.Equal(t, 1, provider.lookupCount)
+}
+
+func TestEnricher_CachesScreenings(t *testing.T) {
+	db := setupScreeningDB(t)
+	store := enrichment.NewStore(db)
+	provider := newFakeProvider()
+	enricher := enrichment.NewEnricher(provider, store, enrichment.Config{CacheTTL: time.Hour}, nil)
+
+	_, err := enricher.Screen(context.Background(), "TMixer")
+	require.NoError(t, err)
+	_, err = enricher.Screen(context.Background(), "TMixer")
+	require.NoError(t, err)
+	assert.Equal(t, 1, provider.lookups["TMixer"])
+
+	// Saved for the other services and the address profile
+	stored, err := store.Latest(context.Background(), "TMixer")
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, "fake", stored.Provider)
+	assert.Equal(t, "mixing", stored.Category)
+
+	// A new enricher, as after a restart, reads the database's copy
+	restarted := enrichment.NewEnricher(provider, store, enrichment.Config{CacheTTL: time.Hour}, nil)
+	screening, err := restarted.Screen(context.Background(), "TMixer")
+	require.NoError(t, err)
+	assert.Equal(t, "Sinbad", screening.Entity)
+	assert.Equal(t, 1, provider.lookups["TMixer"])
+
+	// Failures are not cached
+	_, err = enricher.Screen(context.Background(), "TFailing")
+	assert.Error(t, err)
+	_, err = enricher.Screen(context.Background(), "TFailing")
+	assert.Error(t, err)
+	assert.Equal(t, 2, provider.lookups["TFailing"])
+}
+
+func TestEnricher_RescreensExpiredScreenings(t *testing.T) {
+	db := setupScreeningDB(t)
+	store := enrichment.NewStore(db)
+	require.NoError(t, store.Save(context.Background(), models.AddressScreening{
+		Address: "TMixer", Provider: "fake", Category: "gambling", ScreenedAt: time.Now().Add(-48 * time.Hour),
+	}))
+
+	provider := newFakeProvider()
+	enricher := enrichment.NewEnricher(provider, store, enrichment.Config{CacheTTL: 24 * time.Hour}, nil)
+	screening, err := enricher.Screen(context.Background(), "TMixer")
+	require.NoError(t, err)
+	assert.Equal(t, "mixing", screening.Category)
+	assert.Equal(t, 1, provider.lookups["TMixer"])
+
+	// The stale screening is replaced
+	stored, err := store.Get(context.Background(), "fake", "TMixer")
+	require.NoError(t, err)
+	assert.Equal(t, "mixing", stored.Category)
+}
+
+func TestStore_NormalizesHexAddresses(t *testing.T) {
+	store := enrichment.NewStore(setupScreeningDB(t))
+	require.NoError(t, store.Save(context.Background(), models.AddressScreening{
+		Address: "0xABCDEF", Provider: "fake", Risk: "High", ScreenedAt: time.Now(),
+	}))
+
+	stored, err := store.Latest(context.Background(), "0xabcdef")
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, "High", stored.Risk)
+
+	missing, err := store.Latest(context.Background(), "0x123456")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
@@ -0,0 +1,73 @@
+package errs_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mikedewar/stablerisk/internal/errs"
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errTestKind = errs.New("test_failure", errs.ClassUpstream, "test failure")
+
+func TestWrap_MatchesKindAndCause(t *testing.T) {
+	cause := context.DeadlineExceeded
+	err := fmt.Errorf("fetching page: %w", errs.Wrap(errTestKind, cause))
+
+	assert.True(t, errors.Is(err, errTestKind))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, "fetching page: "+cause.Error(), err.Error())
+	assert.Equal(t, errTestKind, errs.KindOf(err))
+	assert.Equal(t, "test_failure", errs.Code(err))
+
+	assert.Nil(t, errs.Wrap(errTestKind, nil))
+}
+
+func TestWrapf_FormatsMessage(t *testing.T) {
+	err := errs.Wrapf(errTestKind, "status %d: %w", 503, errors.New("boom"))
+
+	assert.Equal(t, "status 503: boom", err.Error())
+	assert.True(t, errors.Is(err, errTestKind))
+}
+
+func TestCode_UnknownWithoutKind(t *testing.T) {
+	assert.Equal(t, "unknown", errs.Code(errors.New("plain")))
+	assert.Nil(t, errs.KindOf(errors.New("plain")))
+}
+
+func TestRecord_CountsByKind(t *testing.T) {
+	typed := metrics.Errors.WithLabelValues("errs_test", "test_failure", "upstream")
+	unknown := metrics.Errors.WithLabelValues("errs_test", "unknown", "internal")
+	typedBefore, unknownBefore := typed.Value(), unknown.Value()
+
+	err := errs.Wrap(errTestKind, errors.New("down"))
+	assert.Equal(t, err, errs.Record("errs_test", err))
+	errs.Record("errs_test", errors.New("plain"))
+	assert.Nil(t, errs.Record("errs_test", nil))
+
+	assert.Equal(t, typedBefore+1, typed.Value())
+	assert.Equal(t, unknownBefore+1, unknown.Value())
+}
+
+func TestRaphtoryClient_ClassifiesUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL}, nil)
+	counter := metrics.Errors.WithLabelValues("raphtory", "raphtory_unavailable", "upstream")
+	before := counter.Value()
+
+	_, err := client.GetStatistics(context.Background())
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, graph.ErrRaphtoryUnavailable))
+	assert.Equal(t, before+1, counter.Value())
+}
@@ -0,0 +1,169 @@
+package ethereum_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/blockchain/ethereum"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+const (
+	usdtAddress = "0xdac17f958d2ee523a2206206994597c13d831ec7"
+	fromTopic   = "0x000000000000000000000000aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	toTopic     = "0x000000000000000000000000bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+)
+
+// memoryCheckpoints is an in-memory checkpoint store
+type memoryCheckpoints struct {
+	mu    sync.Mutex
+	block int64
+}
+
+func (m *memoryCheckpoints) Load(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.block, nil
+}
+
+func (m *memoryCheckpoints) Save(ctx context.Context, block int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.block = block
+	return nil
+}
+
+// rpcServer answers the JSON-RPC methods the client uses and records the
+// requested log ranges
+func rpcServer(t *testing.T, logs []ethereum.Log) (*httptest.Server, func() [][2]string) {
+	var mu sync.Mutex
+	var ranges [][2]string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     uint64            `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		var result interface{}
+		switch req.Method {
+		case "eth_blockNumber":
+			result = "0x70" // 112
+		case "eth_getLogs":
+			var filter struct {
+				FromBlock string `json:"fromBlock"`
+				ToBlock   string `json:"toBlock"`
+			}
+			require.NoError(t, json.Unmarshal(req.Params[0], &filter))
+
+			mu.Lock()
+			first := len(ranges) == 0
+			ranges = append(ranges, [2]string{filter.FromBlock, filter.ToBlock})
+			mu.Unlock()
+
+			if first {
+				result = logs
+			} else {
+				result = []ethereum.Log{}
+			}
+		case "eth_getBlockByNumber":
+			result = map[string]string{"timestamp": "0x65920080"} // 2024-01-01T00:00:00Z
+		default:
+			t.Errorf("unexpected method %s", req.Method)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+
+	return server, func() [][2]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([][2]string(nil), ranges...)
+	}
+}
+
+func TestClient_IngestsTransferLogs(t *testing.T) {
+	logs := []ethereum.Log{
+		{
+			Address:         usdtAddress,
+			Topics:          []string{ethereum.TransferTopic, fromTopic, toTopic},
+			Data:            "0x00000000000000000000000000000000000000000000000000000000004c4b40", // 5 USDT
+			BlockNumber:     "0x60",
+			TransactionHash: "0xTRANSFER",
+		},
+		{
+			// A reorged log of a contract that is not tracked is ignored
+			Address:         "0x1111111111111111111111111111111111111111",
+			Topics:          []string{ethereum.TransferTopic, fromTopic, toTopic},
+			Data:            "0x01",
+			BlockNumber:     "0x60",
+			TransactionHash: "0xUNTRACKED",
+			Removed:         true,
+		},
+		{
+			Address:         usdtAddress,
+			Topics:          []string{ethereum.TransferTopic, fromTopic, toTopic},
+			Data:            "0x01",
+			BlockNumber:     "0x61",
+			TransactionHash: "0xREORGED",
+			Removed:         true,
+		},
+	}
+	server, ranges := rpcServer(t, logs)
+	defer server.Close()
+
+	checkpoints := &memoryCheckpoints{block: 90}
+	client := ethereum.NewClient(ethereum.ClientConfig{
+		RPCURL:          server.URL,
+		Contracts:       []ethereum.Contract{{Address: usdtAddress, Symbol: "USDT", Decimals: 6}},
+		PollInterval:    20 * time.Millisecond,
+		MaxBlockRange:   5,
+		CheckpointStore: checkpoints,
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	select {
+	case tx := <-client.Transactions():
+		assert.Equal(t, "0xtransfer", tx.TxHash)
+		assert.Equal(t, models.ChainEthereum, tx.Chain)
+		assert.Equal(t, "USDT", tx.Token)
+		assert.Equal(t, "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", tx.From)
+		assert.Equal(t, "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", tx.To)
+		assert.True(t, decimal.NewFromInt(5).Equal(tx.Amount))
+		assert.Equal(t, uint64(96), tx.BlockNumber)
+		assert.Equal(t, int64(1704067200), tx.Timestamp.Unix())
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a transaction")
+	}
+
+	select {
+	case txHash := <-client.Retractions():
+		assert.Equal(t, "0xreorged", txHash)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a retraction")
+	}
+	assert.Equal(t, uint64(1), client.Stats().Retractions)
+
+	// Head 112 with 12 confirmations: blocks 91-100 in ranges of 5
+	assert.Eventually(t, func() bool { return client.LastBlock() == 100 }, 2*time.Second, 10*time.Millisecond)
+	got := ranges()
+	require.GreaterOrEqual(t, len(got), 2)
+	assert.Equal(t, [2]string{"0x5b", "0x5f"}, got[0])
+	assert.Equal(t, [2]string{"0x60", "0x64"}, got[1])
+
+	checkpoint, _ := checkpoints.Load(context.Background())
+	assert.Equal(t, int64(100), checkpoint)
+}
@@ -0,0 +1,99 @@
+package features_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mikedewar/stablerisk/internal/features"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func setupFlagsDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec(`
+		CREATE TABLE feature_flags (
+			name TEXT PRIMARY KEY,
+			enabled BOOLEAN NOT NULL,
+			environments TEXT NOT NULL DEFAULT '{}',
+			updated_by TEXT NOT NULL DEFAULT '',
+			updated_at DATETIME NOT NULL
+		)
+	`)
+	require.NoError(t, err)
+	return db
+}
+
+func TestFlags_Defaults(t *testing.T) {
+	flags := features.New(nil, features.Config{
+		Environment: "production",
+		Defaults:    map[string]bool{features.IQRStreaming: false, "no_such_flag": true},
+	}, zaptest.NewLogger(t))
+
+	assert.True(t, flags.Enabled(features.DBSCANDetector))
+	assert.False(t, flags.Enabled(features.IQRStreaming))
+	assert.False(t, flags.Enabled("no_such_flag"))
+
+	flag, ok := flags.Lookup(features.IQRStreaming)
+	require.True(t, ok)
+	assert.Equal(t, features.SourceConfig, flag.Source)
+	flag, _ = flags.Lookup(features.DBSCANDetector)
+	assert.Equal(t, features.SourceDefault, flag.Source)
+	assert.Len(t, flags.List(), len(features.Known))
+
+	// A nil Flags leaves every flag at its built-in default
+	var none *features.Flags
+	assert.True(t, none.Enabled(features.IQRStreaming))
+	assert.False(t, none.Enabled("no_such_flag"))
+
+	// Without a database flags cannot be saved
+	_, err := flags.Set(context.Background(), features.IQRStreaming, true, nil, "admin-1")
+	assert.ErrorIs(t, err, features.ErrNoDatabase)
+}
+
+func TestFlags_SetAndRefresh(t *testing.T) {
+	db := setupFlagsDB(t)
+	logger := zaptest.NewLogger(t)
+	staging := features.New(db, features.Config{Environment: "staging"}, logger)
+	production := features.New(db, features.Config{
+		Environment: "production",
+		Defaults:    map[string]bool{features.WatchlistAlerts: true},
+	}, logger)
+
+	// Rolled out to staging only
+	flag, err := staging.Set(context.Background(), features.WatchlistAlerts, false,
+		map[string]bool{"staging": true}, "admin-1")
+	require.NoError(t, err)
+	assert.True(t, flag.Active)
+	assert.False(t, flag.Enabled)
+	assert.Equal(t, features.SourceDatabase, flag.Source)
+	assert.Equal(t, "admin-1", flag.UpdatedBy)
+	assert.NotNil(t, flag.UpdatedAt)
+	assert.True(t, staging.Enabled(features.WatchlistAlerts))
+
+	// Other services see it after their next refresh
+	assert.True(t, production.Enabled(features.WatchlistAlerts))
+	require.NoError(t, production.Refresh(context.Background()))
+	assert.False(t, production.Enabled(features.WatchlistAlerts))
+	flag, _ = production.Lookup(features.WatchlistAlerts)
+	assert.Equal(t, map[string]bool{"staging": true}, flag.Environments)
+	assert.Equal(t, features.SourceDatabase, flag.Source)
+
+	// Resetting returns the flag to its configured value
+	flag, err = production.Reset(context.Background(), features.WatchlistAlerts)
+	require.NoError(t, err)
+	assert.Equal(t, features.SourceConfig, flag.Source)
+	assert.True(t, flag.Active)
+	require.NoError(t, staging.Refresh(context.Background()))
+	assert.True(t, staging.Enabled(features.WatchlistAlerts))
+
+	_, err = staging.Set(context.Background(), "no_such_flag", true, nil, "admin-1")
+	assert.ErrorIs(t, err, features.ErrUnknownFlag)
+	_, err = staging.Reset(context.Background(), "no_such_flag")
+	assert.ErrorIs(t, err, features.ErrUnknownFlag)
+}
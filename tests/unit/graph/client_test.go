@@ -0,0 +1,407 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRaphtoryClient_RetriesTransientFailures(t *testing.T) {
+	var calls atomic.Int32
+	var lastBody atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lastBody.Store(string(body))
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{
+		BaseURL:    server.URL,
+		Timeout:    time.Second,
+		MaxRetries: 3,
+		RetryDelay: time.Millisecond,
+	}, zaptest.NewLogger(t))
+
+	tx := &models.Transaction{TxHash: "0xabc", From: "TA", To: "TB", Amount: decimal.NewFromInt(5), Timestamp: time.Now()}
+	require.NoError(t, client.AddTransaction(context.Background(), tx))
+
+	assert.Equal(t, int32(3), calls.Load())
+	// The body is sent again on every attempt
+	assert.Contains(t, lastBody.Load(), `"tx_hash":"0xabc"`)
+	assert.Equal(t, graph.CircuitClosed, client.CircuitState())
+}
+
+func TestRaphtoryClient_DoesNotRetryRejections(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{
+		BaseURL:    server.URL,
+		MaxRetries: 3,
+		RetryDelay: time.Millisecond,
+	}, nil)
+
+	err := client.DeleteTransaction(context.Background(), "0xabc")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, graph.ErrRaphtoryRejected))
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestRaphtoryClient_CircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"node_count": 3}`))
+	}))
+	defer server.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{
+		BaseURL:          server.URL,
+		FailureThreshold: 2,
+		OpenTimeout:      50 * time.Millisecond,
+	}, zaptest.NewLogger(t))
+	ctx := context.Background()
+	var changes []string
+	client.OnCircuitStateChange(func(from, to graph.CircuitState) {
+		changes = append(changes, string(from)+">"+string(to))
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GetStatistics(ctx)
+		require.Error(t, err)
+	}
+	assert.Equal(t, graph.CircuitOpen, client.CircuitState())
+
+	// While open, calls fail without reaching Raphtory
+	_, err := client.GetStatistics(ctx)
+	assert.True(t, errors.Is(err, graph.ErrRaphtoryCircuitOpen))
+	assert.True(t, errors.Is(err, graph.ErrRaphtoryUnavailable))
+	assert.Equal(t, int32(2), calls.Load())
+
+	// A failed trial call reopens the circuit
+	time.Sleep(60 * time.Millisecond)
+	_, err = client.GetStatistics(ctx)
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, graph.ErrRaphtoryCircuitOpen))
+	assert.Equal(t, graph.CircuitOpen, client.CircuitState())
+
+	// A successful trial call closes it
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	stats, err := client.GetStatistics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.NodeCount)
+	assert.Equal(t, graph.CircuitClosed, client.CircuitState())
+	assert.Equal(t, int32(4), calls.Load())
+	assert.Equal(t, []string{
+		"closed>open", "open>half_open", "half_open>open", "open>half_open", "half_open>closed",
+	}, changes)
+}
+
+func TestRaphtoryClient_GetNeighbors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/graph/neighbors/TAddrB", r.URL.Path)
+		assert.Equal(t, "2", r.URL.Query().Get("hops"))
+		assert.Equal(t, "both", r.URL.Query().Get("direction"))
+		assert.Equal(t, "1704067200", r.URL.Query().Get("start"))
+		assert.Empty(t, r.URL.Query().Get("end"))
+		w.Write([]byte(`{
+			"address": "TAddrB", "hops": 2, "neighbors": ["TAddrA", "TAddrE"], "count": 2, "truncated": false,
+			"counterparties": [
+				{"address": "TAddrA", "hop": 1, "sent_count": 0, "received_count": 2, "sent": "0", "received": "150.5",
+				 "first_seen": 1704067200, "last_seen": 1704067260},
+				{"address": "TAddrE", "hop": 2, "sent_count": 1, "received_count": 0, "sent": "10", "received": "0",
+				 "first_seen": 1704067440, "last_seen": 1704067440}
+			]
+		}`))
+	}))
+	defer server.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL}, nil)
+	neighborhood, err := client.GetNeighbors(context.Background(), "TAddrB", 2, graph.Window{Start: time.Unix(1704067200, 0)})
+	require.NoError(t, err)
+
+	require.Len(t, neighborhood.Neighbors, 2)
+	first := neighborhood.Neighbors[0]
+	assert.Equal(t, "TAddrA", first.Address)
+	assert.Equal(t, 1, first.Hop)
+	assert.Equal(t, 2, first.ReceivedCount)
+	assert.True(t, decimal.RequireFromString("150.5").Equal(first.Received))
+	assert.Equal(t, 2, neighborhood.Neighbors[1].Hop)
+
+	_, err = client.GetNeighbors(context.Background(), "TAddrB", 0, graph.Window{})
+	assert.Error(t, err)
+}
+
+func TestRaphtoryClient_FindPaths(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/graph/paths", r.URL.Path)
+		assert.Equal(t, "TAddrA", r.URL.Query().Get("from"))
+		assert.Equal(t, "TSanctioned", r.URL.Query().Get("to"))
+		assert.Equal(t, "3", r.URL.Query().Get("max_hops"))
+		assert.Equal(t, "1704067200", r.URL.Query().Get("start"))
+		assert.Equal(t, "1704153600", r.URL.Query().Get("end"))
+		w.Write([]byte(`{
+			"from": "TAddrA", "to": "TSanctioned", "count": 1, "truncated": true,
+			"paths": [["TAddrA", "TAddrB", "TSanctioned"]],
+			"flows": [{
+				"addresses": ["TAddrA", "TAddrB", "TSanctioned"],
+				"hops": [
+					{"from": "TAddrA", "to": "TAddrB", "transactions": [
+						{"tx_hash": "0x1", "from": "TAddrA", "to": "TAddrB", "amount": "900", "block_number": 1, "timestamp": 1704067300, "confirmed": true}
+					]},
+					{"from": "TAddrB", "to": "TSanctioned", "transactions": [
+						{"tx_hash": "0x2", "from": "TAddrB", "to": "TSanctioned", "amount": "850", "block_number": 2, "timestamp": 1704070000, "confirmed": false}
+					]}
+				]
+			}]
+		}`))
+	}))
+	defer server.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL}, nil)
+	start := time.Unix(1704067200, 0)
+	paths, err := client.FindPaths(context.Background(), "TAddrA", "TSanctioned", 3, graph.Window{Start: start, End: start.Add(24 * time.Hour)})
+	require.NoError(t, err)
+
+	assert.True(t, paths.Truncated)
+	require.Len(t, paths.Paths, 1)
+	path := paths.Paths[0]
+	assert.Equal(t, []string{"TAddrA", "TAddrB", "TSanctioned"}, path.Addresses)
+	require.Len(t, path.Hops, 2)
+	assert.Equal(t, "TAddrB", path.Hops[1].From)
+	require.Len(t, path.Hops[1].Transactions, 1)
+	tx := path.Hops[1].Transactions[0]
+	assert.Equal(t, "0x2", tx.TxHash)
+	assert.True(t, decimal.NewFromInt(850).Equal(tx.Amount))
+	assert.Equal(t, int64(1704070000), tx.Timestamp.Unix())
+	assert.False(t, tx.Confirmed)
+}
+
+func TestRaphtoryClient_GetTopDegree(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/graph/degree", r.URL.Path)
+		assert.Equal(t, "in", r.URL.Query().Get("direction"))
+		assert.Equal(t, "10", r.URL.Query().Get("limit"))
+		assert.Equal(t, "1704067200", r.URL.Query().Get("start"))
+		w.Write([]byte(`{"direction": "in", "nodes": [
+			{"address": "THub", "in_degree": 42, "out_degree": 1, "in_count": 60, "out_count": 1, "received": "12500.25", "sent": "12000"}
+		]}`))
+	}))
+	defer server.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL}, nil)
+	nodes, err := client.GetTopDegree(context.Background(), graph.DegreeIn, graph.Window{Start: time.Unix(1704067200, 0)}, 10)
+	require.NoError(t, err)
+
+	require.Len(t, nodes, 1)
+	assert.Equal(t, "THub", nodes[0].Address)
+	assert.Equal(t, 42, nodes[0].InDegree)
+	assert.Equal(t, 60, nodes[0].InCount)
+	assert.True(t, decimal.RequireFromString("12500.25").Equal(nodes[0].Received))
+
+	_, err = client.GetTopDegree(context.Background(), graph.DegreeIn, graph.Window{}, 0)
+	assert.Error(t, err)
+}
+
+func TestRaphtoryClient_QueryTransactions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/graph/transactions":
+			query := r.URL.Query()
+			assert.Equal(t, "TA", query.Get("address"))
+			assert.Equal(t, "10.5", query.Get("min_amount"))
+			assert.Empty(t, query.Get("max_amount"))
+			assert.Equal(t, "1704067200", query.Get("start"))
+			assert.Equal(t, "20", query.Get("limit"))
+			assert.Equal(t, "40", query.Get("offset"))
+			w.Write([]byte(`{"total": 41, "transactions": [
+				{"tx_hash": "0x1", "from": "TA", "to": "TB", "amount": "25", "block_number": 7, "timestamp": 1704067300}
+			]}`))
+		case "/graph/transaction/0x1":
+			w.Write([]byte(`{"tx_hash": "0x1", "from": "TA", "to": "TB", "amount": "25", "block_number": 7, "timestamp": 1704067300}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL}, nil)
+	minAmount := decimal.RequireFromString("10.5")
+	page, err := client.QueryTransactions(context.Background(), graph.TransactionQuery{
+		Window:    graph.Window{Start: time.Unix(1704067200, 0)},
+		Address:   "TA",
+		MinAmount: &minAmount,
+		Limit:     20,
+		Offset:    40,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 41, page.Total)
+	require.Len(t, page.Transactions, 1)
+	assert.Equal(t, "0x1", page.Transactions[0].TxHash)
+	assert.True(t, decimal.NewFromInt(25).Equal(page.Transactions[0].Amount))
+
+	tx, err := client.GetTransaction(context.Background(), "0x1")
+	require.NoError(t, err)
+	require.NotNil(t, tx)
+	assert.Equal(t, uint64(7), tx.BlockNumber)
+
+	// An unknown hash is not an error
+	tx, err = client.GetTransaction(context.Background(), "0x2")
+	require.NoError(t, err)
+	assert.Nil(t, tx)
+
+	_, err = client.QueryTransactions(context.Background(), graph.TransactionQuery{Limit: 1001})
+	assert.Error(t, err)
+	maxAmount := decimal.NewFromInt(5)
+	_, err = client.QueryTransactions(context.Background(), graph.TransactionQuery{Limit: 10, MinAmount: &minAmount, MaxAmount: &maxAmount})
+	assert.Error(t, err)
+}
+
+func TestRaphtoryClient_GetAddressActivity(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/graph/activity", r.URL.Path)
+		assert.Equal(t, "1704067200", r.URL.Query().Get("start"))
+		w.Write([]byte(`{"addresses": [
+			{"address": "THub", "in_degree": 42, "out_degree": 1, "in_count": 60, "out_count": 1,
+			 "received": "12500.25", "sent": "12000", "unconfirmed_count": 3,
+			 "first_seen": 1704067210, "last_seen": 1704070000, "first_tx_hash": "0xfirst"}
+		]}`))
+	}))
+	defer server.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL}, nil)
+	nodes, err := client.GetAddressActivity(context.Background(), graph.Window{Start: time.Unix(1704067200, 0)}, 50)
+	require.NoError(t, err)
+
+	require.Len(t, nodes, 1)
+	assert.Equal(t, "THub", nodes[0].Address)
+	assert.Equal(t, 42, nodes[0].InDegree)
+	assert.Equal(t, 61, nodes[0].TransactionCount())
+	assert.Equal(t, 3, nodes[0].UnconfirmedCount)
+	assert.Equal(t, int64(1704067210), nodes[0].FirstSeen)
+	assert.Equal(t, "0xfirst", nodes[0].FirstTxHash)
+	assert.True(t, decimal.RequireFromString("12500.25").Equal(nodes[0].Received))
+}
+
+func TestRaphtoryClient_GetAddressActivity_MinCount(t *testing.T) {
+	var minCounts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		minCounts = append(minCounts, r.URL.Query().Get("min_count"))
+		w.Write([]byte(`{"addresses": []}`))
+	}))
+	defer server.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL}, nil)
+	_, err := client.GetAddressActivity(context.Background(), graph.Window{}, 50)
+	require.NoError(t, err)
+	_, err = client.GetAddressActivity(context.Background(), graph.Window{}, 0)
+	require.NoError(t, err)
+
+	// The service requires at least one transaction
+	assert.Equal(t, []string{"50", "1"}, minCounts)
+}
+
+func TestRaphtoryClient_GetPageRank(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/graph/centrality", r.URL.Path)
+		assert.Equal(t, "pagerank", r.URL.Query().Get("algorithm"))
+		assert.Equal(t, "2", r.URL.Query().Get("limit"))
+		w.Write([]byte(`{"algorithm": "pagerank", "nodes": [
+			{"address": "THub", "score": 0.41}, {"address": "TAddrA", "score": 0.2}
+		]}`))
+	}))
+	defer server.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL}, nil)
+	nodes, err := client.GetPageRank(context.Background(), graph.Window{}, 2)
+	require.NoError(t, err)
+
+	require.Len(t, nodes, 2)
+	assert.Equal(t, "THub", nodes[0].Address)
+	assert.InDelta(t, 0.41, nodes[0].Score, 1e-9)
+}
+
+func TestRaphtoryClient_GetCommunities(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/graph/communities", r.URL.Path)
+		assert.Equal(t, "1704067200", r.URL.Query().Get("start"))
+		w.Write([]byte(`{"count": 1, "communities": [{
+			"id": 0, "members": ["TAddrA", "TAddrB", "TAddrC"], "size": 3,
+			"internal_edges": 3, "internal_count": 7, "internal_amount": "3000.5", "density": 0.5,
+			"entry_points": ["TAddrA"], "exit_points": [], "inflow": "1000", "outflow": "0",
+			"has_cycle": true, "first_seen": 1704067200, "last_seen": 1704070000
+		}]}`))
+	}))
+	defer server.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL}, nil)
+	communities, err := client.GetCommunities(context.Background(), graph.Window{Start: time.Unix(1704067200, 0)})
+	require.NoError(t, err)
+
+	require.Len(t, communities, 1)
+	community := communities[0]
+	assert.Equal(t, []string{"TAddrA", "TAddrB", "TAddrC"}, community.Members)
+	assert.Equal(t, 7, community.InternalCount)
+	assert.True(t, decimal.RequireFromString("3000.5").Equal(community.InternalAmount))
+	assert.Equal(t, []string{"TAddrA"}, community.EntryPoints)
+	assert.True(t, community.HasCycle)
+	assert.Equal(t, int64(1704070000), community.LastSeen)
+}
+
+func TestRaphtoryClient_NodeProperties(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			assert.Equal(t, "/graph/node/TAddrA/properties", r.URL.Path)
+			body, _ := io.ReadAll(r.Body)
+			assert.JSONEq(t, `{"properties": {"watchlist": "sanctions", "label": null}}`, string(body))
+			w.Write([]byte(`{"address": "TAddrA", "properties": {"watchlist": "sanctions"}}`))
+		default:
+			assert.Equal(t, "/graph/nodes", r.URL.Path)
+			assert.Equal(t, "watchlist", r.URL.Query().Get("property"))
+			assert.Equal(t, "true", r.URL.Query().Get("value"))
+			w.Write([]byte(`{"count": 1, "nodes": [{"address": "TAddrA", "properties": {"watchlist": true, "risk_score": 0.75}}]}`))
+		}
+	}))
+	defer server.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL}, nil)
+	err := client.SetNodeProperties(context.Background(), "TAddrA", map[string]any{
+		graph.PropertyWatchlist: "sanctions",
+		graph.PropertyLabel:     nil,
+	})
+	require.NoError(t, err)
+
+	nodes, err := client.FindNodesByProperty(context.Background(), graph.PropertyWatchlist, true, 100)
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	assert.Equal(t, "TAddrA", nodes[0].Address)
+	assert.Equal(t, 0.75, nodes[0].Properties[graph.PropertyRiskScore])
+}
@@ -0,0 +1,400 @@
+package graph_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newOutboxDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE raphtory_outbox (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			op TEXT NOT NULL,
+			tx_hash TEXT NOT NULL,
+			payload TEXT,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT,
+			created_at DATETIME NOT NULL,
+			dead_lettered_at DATETIME
+		)
+	`)
+	require.NoError(t, err)
+	return db
+}
+
+// fakeRaphtory records graph writes and fails them while down is set
+type fakeRaphtory struct {
+	down    atomic.Bool
+	mu      sync.Mutex
+	ops     []string
+	batches int
+	reject  map[string]bool // Hashes a batch reports as failed and single adds refuse
+}
+
+func (f *fakeRaphtory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.down.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/graph/transactions/batch":
+		var payload struct {
+			Transactions []map[string]interface{} `json:"transactions"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+
+		var failed []string
+		for _, tx := range payload.Transactions {
+			hash := fmt.Sprint(tx["tx_hash"])
+			if f.reject[hash] {
+				failed = append(failed, hash)
+				continue
+			}
+			f.ops = append(f.ops, "add:"+hash)
+		}
+		f.batches++
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": len(failed) == 0,
+			"added":   len(payload.Transactions) - len(failed),
+			"failed":  failed,
+		})
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/confirm"):
+		hash := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/graph/transaction/"), "/confirm")
+		f.ops = append(f.ops, "confirm:"+hash)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPost:
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		if f.reject[fmt.Sprint(payload["tx_hash"])] {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.ops = append(f.ops, fmt.Sprintf("add:%s", payload["tx_hash"]))
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete:
+		f.ops = append(f.ops, "delete:"+r.URL.Path[len("/graph/transaction/"):])
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeRaphtory) recorded() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.ops...)
+}
+
+func newTestTransaction(hash string) *models.Transaction {
+	return &models.Transaction{
+		TxHash:    hash,
+		From:      "TFrom",
+		To:        "TTo",
+		Amount:    decimal.NewFromInt(100),
+		Timestamp: time.Unix(1700000000, 0).UTC(),
+	}
+}
+
+func TestForwarder_QueuesDuringOutageAndDrainsInOrder(t *testing.T) {
+	fake := &fakeRaphtory{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: time.Second}, nil)
+	outbox := graph.NewOutbox(newOutboxDB(t))
+	forwarder := graph.NewForwarder(graph.ForwarderConfig{
+		RetryInterval:    20 * time.Millisecond,
+		MaxRetryInterval: 40 * time.Millisecond,
+		BatchSize:        1,
+	}, client, outbox, zaptest.NewLogger(t))
+	require.NoError(t, forwarder.Start(ctx))
+
+	require.NoError(t, forwarder.AddTransaction(ctx, newTestTransaction("tx1")))
+
+	fake.down.Store(true)
+	require.NoError(t, forwarder.AddTransaction(ctx, newTestTransaction("tx2")))
+	require.NoError(t, forwarder.DeleteTransaction(ctx, "tx1"))
+
+	stats := forwarder.Stats()
+	assert.Equal(t, uint64(2), stats.Queued)
+	assert.Equal(t, int64(2), stats.Depth)
+
+	// Writes queue behind the outbox even once Raphtory recovers
+	fake.down.Store(false)
+	require.NoError(t, forwarder.AddTransaction(ctx, newTestTransaction("tx3")))
+
+	require.Eventually(t, func() bool { return forwarder.Stats().Depth == 0 },
+		2*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, []string{"add:tx1", "add:tx2", "delete:tx1", "add:tx3"}, fake.recorded())
+
+	depth, err := outbox.Len(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, depth)
+}
+
+func TestForwarder_ResumesQueuedWrites(t *testing.T) {
+	fake := &fakeRaphtory{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Writes left behind by a previous run
+	outbox := graph.NewOutbox(newOutboxDB(t))
+	require.NoError(t, outbox.Push(ctx, graph.OutboxAdd, "tx1", newTestTransaction("tx1")))
+	require.NoError(t, outbox.Push(ctx, graph.OutboxAdd, "tx2", newTestTransaction("tx2")))
+
+	entries, err := outbox.Peek(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "tx1", entries[0].Transaction.TxHash)
+	assert.True(t, entries[0].Transaction.Amount.Equal(decimal.NewFromInt(100)))
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: time.Second}, nil)
+	forwarder := graph.NewForwarder(graph.ForwarderConfig{
+		RetryInterval: 20 * time.Millisecond,
+		BatchSize:     1,
+	}, client, outbox, zaptest.NewLogger(t))
+	require.NoError(t, forwarder.Start(ctx))
+
+	require.Eventually(t, func() bool { return forwarder.Stats().Depth == 0 },
+		2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"add:tx1", "add:tx2"}, fake.recorded())
+}
+
+func TestForwarder_WithoutOutboxReturnsErrors(t *testing.T) {
+	fake := &fakeRaphtory{}
+	fake.down.Store(true)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: time.Second}, nil)
+	forwarder := graph.NewForwarder(graph.ForwarderConfig{BatchSize: 1}, client, nil, zaptest.NewLogger(t))
+	require.NoError(t, forwarder.Start(context.Background()))
+
+	assert.Error(t, forwarder.AddTransaction(context.Background(), newTestTransaction("tx1")))
+	assert.Equal(t, uint64(1), forwarder.Stats().Failed)
+}
+
+func TestForwarder_DropsUnsupportedWrites(t *testing.T) {
+	db := newOutboxDB(t)
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{
+		BaseURL:   "http://127.0.0.1:1",
+		Transport: graph.TransportGraphQL,
+	}, nil)
+	forwarder := graph.NewForwarder(graph.ForwarderConfig{BatchSize: 1}, client, graph.NewOutbox(db), zaptest.NewLogger(t))
+	require.NoError(t, forwarder.Start(context.Background()))
+
+	// GraphQL cannot retract by hash; queueing the write would block the outbox forever
+	require.NoError(t, forwarder.DeleteTransaction(context.Background(), "tx1"))
+	assert.Equal(t, int64(0), forwarder.Stats().Depth)
+}
+
+func TestForwarder_Batches(t *testing.T) {
+	fake := &fakeRaphtory{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: time.Second}, nil)
+	forwarder := graph.NewForwarder(graph.ForwarderConfig{
+		BatchSize:     3,
+		FlushInterval: time.Hour,
+	}, client, nil, zaptest.NewLogger(t))
+	require.NoError(t, forwarder.Start(ctx))
+
+	// A full batch is sent immediately
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, forwarder.AddTransaction(ctx, newTestTransaction(fmt.Sprintf("tx%d", i))))
+	}
+	assert.Equal(t, []string{"add:tx1", "add:tx2", "add:tx3"}, fake.recorded())
+
+	// A retraction flushes the partial batch first
+	require.NoError(t, forwarder.DeleteTransaction(ctx, "tx4"))
+	assert.Equal(t, []string{"add:tx1", "add:tx2", "add:tx3", "add:tx4", "delete:tx4"}, fake.recorded())
+	assert.Equal(t, 2, fake.batches)
+	assert.Equal(t, uint64(5), forwarder.Stats().Forwarded)
+}
+
+func TestForwarder_BatchFlushInterval(t *testing.T) {
+	fake := &fakeRaphtory{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: time.Second}, nil)
+	forwarder := graph.NewForwarder(graph.ForwarderConfig{
+		BatchSize:     100,
+		FlushInterval: 20 * time.Millisecond,
+	}, client, nil, zaptest.NewLogger(t))
+	require.NoError(t, forwarder.Start(ctx))
+
+	require.NoError(t, forwarder.AddTransaction(ctx, newTestTransaction("tx1")))
+	require.Eventually(t, func() bool { return len(fake.recorded()) == 1 },
+		time.Second, 10*time.Millisecond)
+}
+
+func TestForwarder_QueuesRejectedBatchEntries(t *testing.T) {
+	fake := &fakeRaphtory{reject: map[string]bool{"tx2": true}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: time.Second}, nil)
+	outbox := graph.NewOutbox(newOutboxDB(t))
+	forwarder := graph.NewForwarder(graph.ForwarderConfig{
+		RetryInterval: time.Hour,
+		BatchSize:     3,
+		FlushInterval: time.Hour,
+	}, client, outbox, zaptest.NewLogger(t))
+	require.NoError(t, forwarder.Start(ctx))
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, forwarder.AddTransaction(ctx, newTestTransaction(fmt.Sprintf("tx%d", i))))
+	}
+
+	// Only the rejected transaction is parked for retry
+	assert.Equal(t, []string{"add:tx1", "add:tx3"}, fake.recorded())
+	entries, err := outbox.Peek(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "tx2", entries[0].TxHash)
+
+	stats := forwarder.Stats()
+	assert.Equal(t, uint64(2), stats.Forwarded)
+	assert.Equal(t, int64(1), stats.Depth)
+}
+
+func TestForwarder_ConfirmationsQueueBehindAdds(t *testing.T) {
+	fake := &fakeRaphtory{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: time.Second}, nil)
+	outbox := graph.NewOutbox(newOutboxDB(t))
+	forwarder := graph.NewForwarder(graph.ForwarderConfig{
+		RetryInterval: 20 * time.Millisecond,
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+	}, client, outbox, zaptest.NewLogger(t))
+	require.NoError(t, forwarder.Start(ctx))
+
+	unconfirmed := newTestTransaction("tx1")
+	require.NoError(t, forwarder.AddTransaction(ctx, unconfirmed))
+
+	// The buffered add is flushed before the confirmation
+	require.NoError(t, forwarder.ConfirmTransaction(ctx, "tx1"))
+	assert.Equal(t, []string{"add:tx1", "confirm:tx1"}, fake.recorded())
+
+	// During an outage the confirmation is queued like any other write
+	fake.down.Store(true)
+	require.NoError(t, forwarder.ConfirmTransaction(ctx, "tx2"))
+	entries, err := outbox.Peek(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, graph.OutboxConfirm, entries[0].Op)
+
+	fake.down.Store(false)
+	require.Eventually(t, func() bool { return forwarder.Stats().Depth == 0 },
+		2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"add:tx1", "confirm:tx1", "confirm:tx2"}, fake.recorded())
+}
+
+func TestForwarder_DeadLettersPoisonEntries(t *testing.T) {
+	fake := &fakeRaphtory{reject: map[string]bool{"tx2": true}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db := newOutboxDB(t)
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: time.Second}, nil)
+	outbox := graph.NewOutbox(db)
+	forwarder := graph.NewForwarder(graph.ForwarderConfig{
+		RetryInterval:    10 * time.Millisecond,
+		MaxRetryInterval: 20 * time.Millisecond,
+		BatchSize:        3,
+		FlushInterval:    time.Hour,
+		MaxAttempts:      3,
+	}, client, outbox, zaptest.NewLogger(t))
+	require.NoError(t, forwarder.Start(ctx))
+
+	// Raphtory refuses tx2 every time. tx4 and tx5 queue behind it and are
+	// batched with it until it reaches its last attempt.
+	fake.down.Store(true)
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, forwarder.AddTransaction(ctx, newTestTransaction(fmt.Sprintf("tx%d", i))))
+	}
+	fake.down.Store(false)
+	require.NoError(t, forwarder.AddTransaction(ctx, newTestTransaction("tx4")))
+	require.NoError(t, forwarder.AddTransaction(ctx, newTestTransaction("tx5")))
+	require.NoError(t, forwarder.Flush(ctx))
+
+	require.Eventually(t, func() bool { return forwarder.Stats().Depth == 0 },
+		2*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, []string{"add:tx1", "add:tx3", "add:tx4", "add:tx5"}, fake.recorded())
+	stats := forwarder.Stats()
+	assert.Equal(t, uint64(1), stats.DeadLettered)
+	assert.Equal(t, uint64(4), stats.Forwarded)
+
+	// The poison entry is kept, but no longer delivered or counted
+	depth, err := outbox.Len(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, depth)
+	entries, err := outbox.Peek(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	var hash string
+	var attempts int
+	var lastError string
+	require.NoError(t, db.QueryRow(`
+		SELECT tx_hash, attempts, last_error FROM raphtory_outbox WHERE dead_lettered_at IS NOT NULL
+	`).Scan(&hash, &attempts, &lastError))
+	assert.Equal(t, "tx2", hash)
+	assert.Equal(t, 3, attempts)
+	assert.Contains(t, lastError, "400")
+}
@@ -0,0 +1,171 @@
+package graph_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+type graphqlRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// graphqlServer answers each GraphQL request with respond's result
+func graphqlServer(t *testing.T, respond func(req graphqlRequest) string) *graph.RaphtoryClient {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		var req graphqlRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		w.Write([]byte(respond(req)))
+	}))
+	t.Cleanup(server.Close)
+
+	return graph.NewRaphtoryClient(graph.RaphtoryConfig{
+		BaseURL:   server.URL,
+		Transport: graph.TransportGraphQL,
+		GraphName: "test-graph",
+	}, zaptest.NewLogger(t))
+}
+
+func TestGraphQLTransport_TransactionsInWindow(t *testing.T) {
+	var requests []graphqlRequest
+	client := graphqlServer(t, func(req graphqlRequest) string {
+		requests = append(requests, req)
+		return `{"data": {"graph": {"window": {"edges": {"explode": {"list": [
+			{"time": 1704067300, "src": {"name": "TB"}, "dst": {"name": "TC"}, "properties": {"values": [
+				{"key": "tx_hash", "value": "0x2"}, {"key": "amount", "value": "7.5"}, {"key": "confirmed", "value": false}]}},
+			{"time": 1704067250, "src": {"name": "TA"}, "dst": {"name": "TB"}, "properties": {"values": [
+				{"key": "tx_hash", "value": "0x1"}, {"key": "amount", "value": "100"}, {"key": "block_number", "value": 42},
+				{"key": "token", "value": "USDT"}]}}
+		]}}}}}}`
+	})
+
+	txs, err := client.GetTransactionsInWindow(context.Background(), 1704067200, 1704070800, 10)
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+	assert.Contains(t, requests[0].Query, "window(start: $start, end: $end)")
+	assert.Equal(t, "test-graph", requests[0].Variables["graph"])
+	assert.Equal(t, float64(1704067200), requests[0].Variables["start"])
+
+	// Oldest first
+	assert.Equal(t, "0x1", txs[0].TxHash)
+	assert.Equal(t, "TA", txs[0].From)
+	assert.Equal(t, uint64(42), txs[0].BlockNumber)
+	assert.Equal(t, "USDT", txs[0].Token)
+	assert.True(t, txs[0].Confirmed, "missing confirmed flag means confirmed")
+	assert.Equal(t, "0x2", txs[1].TxHash)
+	assert.Equal(t, "7.5", txs[1].Amount.String())
+	assert.False(t, txs[1].Confirmed)
+
+	// Degree rankings are computed from the same transactions
+	nodes, err := client.GetTopDegree(context.Background(), graph.DegreeIn, graph.Window{}, 1)
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	assert.Equal(t, "TB", nodes[0].Address)
+	assert.Equal(t, "100", nodes[0].Received.String())
+	assert.Equal(t, float64(0), requests[1].Variables["start"], "an open window starts at zero")
+
+	// So is per-address activity
+	activity, err := client.GetAddressActivity(context.Background(), graph.Window{}, 2)
+	require.NoError(t, err)
+	require.Len(t, activity, 1)
+	assert.Equal(t, "TB", activity[0].Address)
+	assert.Equal(t, 1, activity[0].UnconfirmedCount)
+	assert.Equal(t, "0x1", activity[0].FirstTxHash)
+
+	// Transaction queries are filtered and paged on the client, newest first
+	page, err := client.QueryTransactions(context.Background(), graph.TransactionQuery{Address: "TB", Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 2, page.Total)
+	require.Len(t, page.Transactions, 1)
+	assert.Equal(t, "0x2", page.Transactions[0].TxHash)
+
+	minAmount := decimal.NewFromInt(50)
+	page, err = client.QueryTransactions(context.Background(), graph.TransactionQuery{MinAmount: &minAmount, Limit: 10, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 1, page.Total)
+	assert.Empty(t, page.Transactions)
+}
+
+func TestGraphQLTransport_AddTransactions(t *testing.T) {
+	client := graphqlServer(t, func(req graphqlRequest) string {
+		assert.True(t, strings.HasPrefix(req.Query, "mutation AddTransactions"))
+		assert.Contains(t, req.Query, "tx1: addEdge(time: $t1, src: $s1, dst: $d1, properties: $p1)")
+		assert.Equal(t, "TA", req.Variables["s0"])
+
+		props := req.Variables["p0"].([]interface{})
+		assert.Contains(t, props, map[string]interface{}{"key": "tx_hash", "value": map[string]interface{}{"str": "0xa"}})
+
+		// The second edge fails on its own
+		return `{"data": {"updateGraph": {"tx0": {"success": true}, "tx1": null}},
+			"errors": [{"message": "invalid edge"}]}`
+	})
+
+	now := time.Now()
+	err := client.AddTransactions(context.Background(), []*models.Transaction{
+		{TxHash: "0xa", From: "TA", To: "TB", Amount: decimal.NewFromInt(1), Timestamp: now},
+		{TxHash: "0xb", From: "TB", To: "TC", Amount: decimal.NewFromInt(2), Timestamp: now},
+	})
+
+	var batchErr *graph.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, []string{"0xb"}, batchErr.Failed)
+}
+
+func TestGraphQLTransport_Errors(t *testing.T) {
+	client := graphqlServer(t, func(req graphqlRequest) string {
+		return `{"data": null, "errors": [{"message": "Graph not found test-graph"}]}`
+	})
+
+	_, err := client.GetStatistics(context.Background())
+	require.ErrorIs(t, err, graph.ErrRaphtoryRejected)
+	assert.Contains(t, err.Error(), "Graph not found")
+
+	// Operations GraphQL cannot express fail without a request
+	require.ErrorIs(t, client.DeleteTransaction(context.Background(), "0xa"), graph.ErrRaphtoryUnsupported)
+	_, err = client.GetCommunities(context.Background(), graph.Window{})
+	require.ErrorIs(t, err, graph.ErrRaphtoryUnsupported)
+	require.ErrorIs(t, client.SetNodeProperties(context.Background(), "TA", map[string]any{"label": nil}), graph.ErrRaphtoryUnsupported)
+	_, err = client.GetTransaction(context.Background(), "0xa")
+	require.ErrorIs(t, err, graph.ErrRaphtoryUnsupported)
+}
+
+func TestGraphQLTransport_NodeInfo(t *testing.T) {
+	client := graphqlServer(t, func(req graphqlRequest) string {
+		if req.Variables["name"] == "TUnknown" {
+			return `{"data": {"graph": {"node": null}}}`
+		}
+		return `{"data": {"graph": {"node": {"name": "TA", "earliestTime": 100, "latestTime": 200,
+			"properties": {"values": [{"key": "risk_score", "value": 0.75}]},
+			"outEdges": {"explode": {"list": [
+				{"properties": {"values": [{"key": "amount", "value": "10"}]}},
+				{"properties": {"values": [{"key": "amount", "value": "5.5"}]}}]}},
+			"inEdges": {"explode": {"list": [
+				{"properties": {"values": [{"key": "amount", "value": "3"}]}}]}}}}}}`
+	})
+
+	info, err := client.GetNodeInfo(context.Background(), "TA")
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), info.FirstSeen)
+	assert.Equal(t, 3, info.TransactionCount)
+	assert.Equal(t, 2, info.SentCount)
+	assert.Equal(t, 15.5, info.TotalSent)
+	assert.Equal(t, 3.0, info.TotalReceived)
+	assert.Equal(t, 0.75, info.Properties[graph.PropertyRiskScore])
+
+	info, err = client.GetNodeInfo(context.Background(), "TUnknown")
+	require.NoError(t, err)
+	assert.Nil(t, info)
+}
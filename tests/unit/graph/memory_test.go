@@ -0,0 +1,142 @@
+package graph_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func memoryTx(hash, from, to string, amount int64, at time.Time) models.Transaction {
+	return models.Transaction{
+		TxHash:    hash,
+		From:      from,
+		To:        to,
+		Amount:    decimal.NewFromInt(amount),
+		Timestamp: at,
+	}
+}
+
+func TestMemoryGraph_TransactionsInWindow(t *testing.T) {
+	g := graph.NewMemoryGraph(graph.MemoryGraphConfig{Capacity: 10})
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// Arrivals out of timestamp order come back sorted
+	g.Add(memoryTx("tx2", "TA", "TB", 20, base.Add(2*time.Minute)))
+	g.Add(memoryTx("tx1", "TA", "TC", 10, base.Add(time.Minute)))
+	g.Add(memoryTx("tx3", "TB", "TC", 30, base.Add(3*time.Minute)))
+	g.Add(memoryTx("tx1", "TA", "TC", 10, base.Add(time.Minute))) // Replay
+	assert.Equal(t, 3, g.Len())
+
+	txs, err := g.GetTransactionsInWindow(context.Background(), base.Unix(), base.Add(3*time.Minute).Unix(), 10)
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+	assert.Equal(t, "tx1", txs[0].TxHash)
+	assert.Equal(t, "tx2", txs[1].TxHash)
+
+	txs, err = g.GetTransactionsInWindow(context.Background(), base.Unix(), base.Add(time.Hour).Unix(), 1)
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	assert.Equal(t, "tx1", txs[0].TxHash)
+
+	g.Confirm("tx3")
+	g.Retract("tx2")
+	txs, err = g.GetTransactionsInWindow(context.Background(), base.Unix(), base.Add(time.Hour).Unix(), 10)
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+	assert.Equal(t, "tx1", txs[0].TxHash)
+	assert.True(t, txs[1].Confirmed)
+	assert.Equal(t, []string{"TC"}, g.Neighbors("TA"))
+}
+
+func TestMemoryGraph_TopDegree(t *testing.T) {
+	g := graph.NewMemoryGraph(graph.MemoryGraphConfig{Capacity: 100})
+	base := time.Now().Add(-time.Hour)
+
+	// THub pays five receivers, one of them twice; TSink collects from three senders
+	for i := 0; i < 5; i++ {
+		g.Add(memoryTx(fmt.Sprintf("out%d", i), "THub", fmt.Sprintf("TR%d", i), 100, base))
+	}
+	g.Add(memoryTx("out5", "THub", "TR0", 100, base))
+	for i := 0; i < 3; i++ {
+		g.Add(memoryTx(fmt.Sprintf("in%d", i), fmt.Sprintf("TS%d", i), "TSink", 50, base))
+	}
+
+	nodes, err := g.GetTopDegree(context.Background(), graph.DegreeOut, graph.Window{}, 1)
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	assert.Equal(t, "THub", nodes[0].Address)
+	assert.Equal(t, 5, nodes[0].OutDegree)
+	assert.Equal(t, 6, nodes[0].OutCount)
+	assert.Equal(t, "600", nodes[0].Sent.String())
+
+	nodes, err = g.GetTopDegree(context.Background(), graph.DegreeIn, graph.Window{}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "TSink", nodes[0].Address)
+	assert.Equal(t, 3, nodes[0].InDegree)
+	assert.Equal(t, "150", nodes[0].Received.String())
+
+	// Nothing falls inside a window that ends before the transfers
+	nodes, err = g.GetTopDegree(context.Background(), graph.DegreeTotal, graph.Window{End: base.Add(-time.Minute)}, 10)
+	require.NoError(t, err)
+	assert.Empty(t, nodes)
+}
+
+func TestMemoryGraph_AddressActivity(t *testing.T) {
+	g := graph.NewMemoryGraph(graph.MemoryGraphConfig{Capacity: 100})
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	g.Add(memoryTx("tx2", "TA", "TB", 20, base.Add(2*time.Minute)))
+	g.Add(memoryTx("tx1", "TA", "TB", 10, base.Add(time.Minute)))
+	confirmed := memoryTx("tx3", "TB", "TC", 5, base.Add(3*time.Minute))
+	confirmed.Confirmed = true
+	g.Add(confirmed)
+
+	activity, err := g.GetAddressActivity(context.Background(), graph.Window{}, 0)
+	require.NoError(t, err)
+	require.Len(t, activity, 3)
+
+	// Ordered by address
+	tb := activity[1]
+	assert.Equal(t, "TB", tb.Address)
+	assert.Equal(t, 3, tb.TransactionCount())
+	assert.Equal(t, 1, tb.InDegree)
+	assert.Equal(t, 2, tb.UnconfirmedCount)
+	assert.Equal(t, "30", tb.Received.String())
+	assert.Equal(t, "tx1", tb.FirstTxHash, "earliest by timestamp, not arrival")
+	assert.Equal(t, base.Add(time.Minute).Unix(), tb.FirstSeen)
+	assert.Equal(t, base.Add(3*time.Minute).Unix(), tb.LastSeen)
+
+	activity, err = g.GetAddressActivity(context.Background(), graph.Window{}, 2)
+	require.NoError(t, err)
+	require.Len(t, activity, 2)
+	assert.Equal(t, "TA", activity[0].Address)
+	assert.Equal(t, "TB", activity[1].Address)
+}
+
+func TestMemoryGraph_Eviction(t *testing.T) {
+	g := graph.NewMemoryGraph(graph.MemoryGraphConfig{Capacity: 3, Retention: time.Hour})
+	now := time.Now()
+
+	g.Add(memoryTx("old", "TA", "TB", 1, now.Add(-2*time.Hour)))
+	g.Add(memoryTx("tx1", "TA", "TC", 1, now))
+	assert.Equal(t, 1, g.Len(), "past-retention transaction is dropped on the next add")
+
+	g.Add(memoryTx("tx2", "TA", "TD", 1, now))
+	g.Add(memoryTx("tx3", "TA", "TE", 1, now))
+	g.Add(memoryTx("tx4", "TA", "TF", 1, now))
+	assert.Equal(t, 3, g.Len())
+
+	// The oldest arrival made way, and its edge is gone from the indexes
+	assert.Equal(t, []string{"TD", "TE", "TF"}, g.Neighbors("TA"))
+
+	// An evicted hash can be added again
+	g.Add(memoryTx("tx1", "TA", "TC", 1, now))
+	assert.Equal(t, []string{"TC", "TE", "TF"}, g.Neighbors("TA"))
+}
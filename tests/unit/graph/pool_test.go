@@ -0,0 +1,125 @@
+package graph_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestForwardPool_ForwardsConcurrently(t *testing.T) {
+	var concurrent, peak atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := concurrent.Add(1)
+		defer concurrent.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: time.Second}, nil)
+	forwarder := graph.NewForwarder(graph.ForwarderConfig{BatchSize: 1}, client, nil, zaptest.NewLogger(t))
+	pool := graph.NewForwardPool(graph.PoolConfig{Workers: 4, QueueSize: 10}, forwarder, zaptest.NewLogger(t))
+	pool.Start(ctx)
+
+	start := time.Now()
+	for i := 0; i < 8; i++ {
+		require.NoError(t, pool.Submit(ctx, newTestTransaction(fmt.Sprintf("tx%d", i))))
+	}
+	require.NoError(t, pool.Wait(ctx))
+
+	// Eight 50ms calls across four workers take about two rounds, not eight
+	assert.Less(t, time.Since(start), 300*time.Millisecond)
+	assert.Equal(t, int64(4), peak.Load())
+
+	stats := pool.Stats()
+	assert.Equal(t, uint64(8), stats.Processed)
+	assert.Zero(t, stats.QueueDepth)
+	require.NoError(t, pool.Close(ctx))
+}
+
+func TestForwardPool_OrderByAddress(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			TxHash string `json:"tx_hash"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		received = append(received, payload.TxHash)
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: time.Second}, nil)
+	forwarder := graph.NewForwarder(graph.ForwarderConfig{BatchSize: 1}, client, nil, zaptest.NewLogger(t))
+	pool := graph.NewForwardPool(graph.PoolConfig{
+		Workers:        4,
+		QueueSize:      100,
+		OrderByAddress: true,
+	}, forwarder, zaptest.NewLogger(t))
+	pool.Start(ctx)
+
+	// Every transaction shares a sender, so one worker forwards them in order
+	var want []string
+	for i := 0; i < 20; i++ {
+		hash := fmt.Sprintf("tx%02d", i)
+		want = append(want, hash)
+		require.NoError(t, pool.Submit(ctx, newTestTransaction(hash)))
+	}
+	require.NoError(t, pool.Close(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, want, received)
+}
+
+func TestForwardPool_CloseTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: server.URL, Timeout: 5 * time.Second}, nil)
+	forwarder := graph.NewForwarder(graph.ForwarderConfig{BatchSize: 1}, client, nil, zaptest.NewLogger(t))
+	pool := graph.NewForwardPool(graph.PoolConfig{Workers: 1, QueueSize: 10}, forwarder, zaptest.NewLogger(t))
+	pool.Start(context.Background())
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, pool.Submit(context.Background(), newTestTransaction(fmt.Sprintf("tx%d", i))))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Error(t, pool.Close(ctx))
+}
@@ -0,0 +1,294 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mikedewar/stablerisk/internal/api/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type book struct {
+	ID       string
+	Title    string
+	Pages    int
+	AuthorID string
+	Tags     []string
+}
+
+type author struct {
+	ID   string
+	Name string
+}
+
+var (
+	books = []*book{
+		{ID: "b1", Title: "Dune", Pages: 412, AuthorID: "a1", Tags: []string{"scifi"}},
+		{ID: "b2", Title: "Emma", Pages: 474, AuthorID: "a2"},
+		{ID: "b3", Title: "Orphan", Pages: 10, AuthorID: "missing"},
+	}
+	authors = map[string]*author{
+		"a1": {ID: "a1", Name: "Frank Herbert"},
+		"a2": {ID: "a2", Name: "Jane Austen"},
+	}
+)
+
+var genre = &graphql.Enum{Name: "Genre", Description: "Shelf a book is on", Values: []string{"scifi", "classic"}}
+
+// newSchema is a small library: books, their authors and a field only
+// librarians may read
+func newSchema(t *testing.T) *graphql.Schema {
+	authorType := &graphql.Object{Name: "Author", Fields: []*graphql.Field{
+		{Name: "id", Type: &graphql.NonNull{Of: graphql.ID}},
+		{Name: "name", Type: &graphql.NonNull{Of: graphql.String}},
+	}}
+	bookType := &graphql.Object{Name: "Book", Description: "A book on the shelves", Fields: []*graphql.Field{
+		{Name: "id", Type: &graphql.NonNull{Of: graphql.ID}},
+		{Name: "title", Type: &graphql.NonNull{Of: graphql.String}},
+		{Name: "pages", Type: graphql.Int},
+		{Name: "tags", Type: &graphql.NonNull{Of: &graphql.List{Of: &graphql.NonNull{Of: graphql.String}}}},
+		{
+			Name: "author", Type: &graphql.NonNull{Of: authorType},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return authors[p.Source.(*book).AuthorID], nil
+			},
+		},
+		{
+			Name: "borrower", Type: graphql.String, Permission: "read:loans",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return "alice", nil
+			},
+		},
+	}}
+	query := &graphql.Object{Name: "Query", Fields: []*graphql.Field{
+		{
+			Name: "books", Type: &graphql.NonNull{Of: &graphql.List{Of: &graphql.NonNull{Of: bookType}}},
+			Args: []*graphql.Argument{
+				{Name: "minPages", Type: graphql.Int, Default: 0},
+				{Name: "genre", Type: genre},
+				{Name: "ids", Type: &graphql.List{Of: &graphql.NonNull{Of: graphql.ID}}},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				var matched []*book
+				for _, b := range books {
+					if b.Pages < p.Args["minPages"].(int) {
+						continue
+					}
+					if ids, ok := p.Args["ids"].([]interface{}); ok {
+						found := false
+						for _, id := range ids {
+							found = found || id == b.ID
+						}
+						if !found {
+							continue
+						}
+					}
+					matched = append(matched, b)
+				}
+				return matched, nil
+			},
+		},
+		{
+			Name: "book", Type: bookType,
+			Args: []*graphql.Argument{{Name: "id", Type: &graphql.NonNull{Of: graphql.ID}, Description: "Book ID"}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				for _, b := range books {
+					if b.ID == p.Args["id"] {
+						return b, nil
+					}
+				}
+				return nil, nil
+			},
+		},
+		{
+			Name: "broken", Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return nil, errors.New("shelf collapsed")
+			},
+		},
+	}}
+
+	schema, err := graphql.NewSchema(query)
+	require.NoError(t, err)
+	return schema
+}
+
+// run executes query and returns its response as JSON
+func run(t *testing.T, schema *graphql.Schema, params graphql.Params) string {
+	b, err := json.Marshal(schema.Execute(context.Background(), params))
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestExecute_Selections(t *testing.T) {
+	schema := newSchema(t)
+
+	// Fields come back in the order selected, with aliases
+	assert.JSONEq(t, `{"data": {"long": [{"title": "Dune", "author": {"name": "Frank Herbert"}}, {"title": "Emma", "author": {"name": "Jane Austen"}}]}}`,
+		run(t, schema, graphql.Params{Query: `{ long: books(minPages: 100) { title author { name } } }`}))
+	resp := run(t, schema, graphql.Params{Query: `{ book(id: "b1") { pages, title } }`})
+	assert.Equal(t, `{"data":{"book":{"pages":412,"title":"Dune"}}}`, resp)
+
+	// Nil lists are empty, and missing objects null
+	assert.JSONEq(t, `{"data": {"book": {"tags": []}, "none": null}}`,
+		run(t, schema, graphql.Params{Query: `{ book(id: "b2") { tags } none: book(id: "b9") { id } }`}))
+}
+
+func TestExecute_VariablesFragmentsAndDirectives(t *testing.T) {
+	schema := newSchema(t)
+
+	resp := run(t, schema, graphql.Params{
+		Query: `
+			# Leading comment
+			query Shelf($ids: [ID!], $withAuthor: Boolean!, $min: Int = 400) {
+				books(ids: $ids, minPages: $min) {
+					...BookParts
+					... on Book { author @include(if: $withAuthor) { id } }
+					pages @skip(if: true)
+				}
+			}
+			fragment BookParts on Book { id title }
+			query Other { broken }`,
+		OperationName: "Shelf",
+		Variables:     map[string]interface{}{"ids": []interface{}{"b1", "b3"}, "withAuthor": true},
+	})
+	assert.JSONEq(t, `{"data": {"books": [{"id": "b1", "title": "Dune", "author": {"id": "a1"}}]}}`, resp)
+
+	// Enum, block string and escaped string literals
+	assert.JSONEq(t, `{"data": {"a": [], "b": null}}`, run(t, schema, graphql.Params{
+		Query: `{ a: books(genre: classic, ids: ["""b9"""]) { id } b: book(id: "b\t9") { id } }`,
+	}))
+}
+
+func TestExecute_Errors(t *testing.T) {
+	schema := newSchema(t)
+
+	for query, message := range map[string]string{
+		`{ book(id: "b1") { title `:                               "syntax error",
+		`{ nope }`:                                                `cannot query field "nope" on type Query`,
+		`{ book(id: "b1") }`:                                      "must have a selection",
+		`{ book(id: "b1") { title { x } } }`:                      "has no subfields",
+		`{ book { id } }`:                                         `argument "id" of type ID! is required`,
+		`{ books(genre: horror) { id } }`:                         "Genre",
+		`{ books(minPages: "many") { id } }`:                      "32-bit integer",
+		`mutation { books { id } }`:                               "only queries are supported",
+		`query A { broken } query B { broken }`:                   "operationName is required",
+		`{ books { ...F } } fragment F on Book { ...F }`:          "spreads itself",
+		`{ books { ...Missing } }`:                                "unknown fragment",
+		`{ books { x: id x: title } }`:                            "x",
+		`{ books(minPages: $v) { id } }`:                          "variable $v is not defined",
+		`query($v: Int!) { books(minPages: $v) { id } }`:          "$v",
+		`{ book(id: "b1") { author { id } } nope: broken(a: 1) }`: `unknown argument "a"`,
+	} {
+		resp := schema.Execute(context.Background(), graphql.Params{Query: query})
+		assert.False(t, resp.Executed(), query)
+		require.NotEmpty(t, resp.Errors, query)
+		assert.Contains(t, resp.Errors[0].Message, message, query)
+
+		b, err := json.Marshal(resp)
+		require.NoError(t, err)
+		assert.NotContains(t, string(b), `"data"`, query)
+	}
+}
+
+func TestExecute_FieldErrorsAndNulls(t *testing.T) {
+	schema := newSchema(t)
+
+	// A failed nullable field is null, with an error at its path
+	resp := schema.Execute(context.Background(), graphql.Params{Query: `{ book(id: "b1") { id } broken }`})
+	require.True(t, resp.Executed())
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "shelf collapsed", resp.Errors[0].Message)
+	assert.Equal(t, []interface{}{"broken"}, resp.Errors[0].Path)
+	require.NotEmpty(t, resp.Errors[0].Locations)
+	assert.Equal(t, 1, resp.Errors[0].Locations[0].Line)
+
+	// A null non-null field nulls its nearest nullable parent
+	resp = schema.Execute(context.Background(), graphql.Params{Query: `{ book(id: "b3") { title author { name } } }`})
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, []interface{}{"book", "author"}, resp.Errors[0].Path)
+	b, err := json.Marshal(resp)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"data": {"book": null}, "errors": [{"message": "author must not be null", "locations": [{"line": 1, "column": 26}], "path": ["book", "author"]}]}`, string(b))
+
+	// ... and within a list of non-null items, the whole list
+	resp = schema.Execute(context.Background(), graphql.Params{Query: `{ books { author { name } } }`})
+	assert.Nil(t, resp.Data)
+	assert.Equal(t, []interface{}{"books", 2, "author"}, resp.Errors[0].Path)
+}
+
+func TestExecute_Authorize(t *testing.T) {
+	schema := newSchema(t)
+	var asked []string
+	authorize := func(permission string) bool {
+		asked = append(asked, permission)
+		return false
+	}
+
+	resp := run(t, schema, graphql.Params{Query: `{ book(id: "b1") { title borrower } }`, Authorize: authorize})
+	assert.JSONEq(t, `{"data": {"book": {"title": "Dune", "borrower": null}}, "errors": [{"message": "permission denied: borrower requires the read:loans permission", "locations": [{"line": 1, "column": 26}], "path": ["book", "borrower"]}]}`, resp)
+	assert.Equal(t, []string{"read:loans"}, asked)
+
+	// No hook allows every field
+	assert.JSONEq(t, `{"data": {"book": {"borrower": "alice"}}}`,
+		run(t, schema, graphql.Params{Query: `{ book(id: "b1") { borrower } }`}))
+}
+
+func TestExecute_Limits(t *testing.T) {
+	schema := newSchema(t)
+	schema.MaxDepth = 2
+
+	resp := schema.Execute(context.Background(), graphql.Params{Query: `{ book(id: "b1") { author { name } } }`})
+	assert.False(t, resp.Executed())
+	require.Len(t, resp.Errors, 1)
+	assert.Contains(t, resp.Errors[0].Message, "depth")
+
+	// Fragments count toward depth where they are spread
+	resp = schema.Execute(context.Background(), graphql.Params{Query: `{ book(id: "b1") { ...A } } fragment A on Book { author { id } }`})
+	assert.False(t, resp.Executed())
+
+	schema.MaxDepth = 0
+	schema.MaxResolves = 3
+	resp = schema.Execute(context.Background(), graphql.Params{Query: `{ books { author { name } } }`})
+	assert.True(t, resp.Executed())
+	assert.Nil(t, resp.Data)
+	require.NotEmpty(t, resp.Errors)
+	assert.Contains(t, resp.Errors[len(resp.Errors)-1].Message, "maximum of 3")
+}
+
+func TestNewSchema_Rejects(t *testing.T) {
+	object := &graphql.Object{Name: "Thing", Fields: []*graphql.Field{{Name: "id", Type: graphql.ID}}}
+
+	for name, query := range map[string]*graphql.Object{
+		"no fields": {Name: "Query"},
+		"duplicate field": {Name: "Query", Fields: []*graphql.Field{
+			{Name: "a", Type: graphql.String}, {Name: "a", Type: graphql.Int},
+		}},
+		"object argument": {Name: "Query", Fields: []*graphql.Field{
+			{Name: "a", Type: graphql.String, Args: []*graphql.Argument{{Name: "thing", Type: object}}},
+		}},
+		"name clash": {Name: "Query", Fields: []*graphql.Field{
+			{Name: "a", Type: object},
+			{Name: "b", Type: &graphql.Object{Name: "Thing", Fields: []*graphql.Field{{Name: "x", Type: graphql.Int}}}},
+		}},
+		"invalid name": {Name: "Query", Fields: []*graphql.Field{{Name: "not-valid", Type: graphql.String}}},
+	} {
+		_, err := graphql.NewSchema(query)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestSchema_SDL(t *testing.T) {
+	sdl := newSchema(t).SDL()
+
+	assert.Contains(t, sdl, "type Query {\n")
+	assert.Contains(t, sdl, "  books(minPages: Int = 0, genre: Genre, ids: [ID!]): [Book!]!\n")
+	assert.Contains(t, sdl, "\"A book on the shelves\"\ntype Book {\n")
+	assert.Contains(t, sdl, "enum Genre {\n  scifi\n  classic\n}\n")
+	assert.NotContains(t, sdl, "scalar String")
+	assert.False(t, strings.HasPrefix(sdl, "\n"))
+}
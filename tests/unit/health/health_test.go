@@ -0,0 +1,77 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func status(healthy bool) health.CheckFunc {
+	return func(ctx context.Context) api.ServiceStatus {
+		return api.ServiceStatus{Healthy: healthy, Details: map[string]interface{}{"channel_depth": 3}}
+	}
+}
+
+func get(t *testing.T, handler http.Handler, path string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	return recorder, body
+}
+
+func TestChecker_CriticalFailureIsUnhealthy(t *testing.T) {
+	checker := health.NewChecker("1.2.3", nil)
+	checker.Register("tron:USDT", true, status(false))
+	checker.Register("raphtory", false, status(true))
+	mux := checker.Mux()
+
+	recorder, body := get(t, mux, "/health")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "unhealthy", body["status"])
+	assert.Equal(t, "1.2.3", body["version"])
+
+	services := body["services"].(map[string]interface{})
+	tron := services["tron:USDT"].(map[string]interface{})
+	assert.Equal(t, false, tron["healthy"])
+	assert.Equal(t, float64(3), tron["details"].(map[string]interface{})["channel_depth"])
+
+	recorder, body = get(t, mux, "/readiness")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, false, body["ready"])
+
+	recorder, _ = get(t, mux, "/liveness")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestChecker_NonCriticalFailureDegrades(t *testing.T) {
+	checker := health.NewChecker("", nil)
+	checker.Register("tron:USDT", true, status(true))
+	checker.Register("raphtory", false, health.Ping(func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}))
+
+	response := checker.Check(context.Background())
+	assert.Equal(t, "degraded", response.Status)
+	assert.Equal(t, "dev", response.Version)
+	assert.Equal(t, "connection refused", response.Services["raphtory"].Message)
+
+	recorder, body := get(t, checker.Mux(), "/readiness")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, true, body["ready"])
+
+	// Registering a name again replaces its check
+	checker.Register("raphtory", false, health.Ping(func(ctx context.Context) error { return nil }))
+	assert.Equal(t, "healthy", checker.Check(context.Background()).Status)
+	assert.Len(t, checker.Check(context.Background()).Services, 2)
+}
@@ -0,0 +1,135 @@
+package health_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mikedewar/stablerisk/internal/api"
+	"github.com/mikedewar/stablerisk/internal/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupRegistryDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE component_status (
+			component TEXT NOT NULL,
+			instance TEXT NOT NULL,
+			healthy BOOLEAN NOT NULL,
+			message TEXT NOT NULL DEFAULT '',
+			details TEXT,
+			reported_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (component, instance)
+		)
+	`)
+	require.NoError(t, err)
+	return db
+}
+
+func newRegistry(db *sql.DB, instance string) *health.Registry {
+	return health.NewRegistry(db, health.RegistryConfig{Instance: instance, StaleAfter: time.Minute}, nil)
+}
+
+func TestRegistry_ReportsComponents(t *testing.T) {
+	db := setupRegistryDB(t)
+	monitor := newRegistry(db, "monitor-1")
+	ctx := context.Background()
+
+	require.NoError(t, monitor.Report(ctx, "tron:USDT", api.ServiceStatus{
+		Healthy: false,
+		Message: "stream disconnected",
+		Details: map[string]interface{}{"lag_seconds": 42},
+	}))
+	require.NoError(t, monitor.Report(ctx, "tron:USDT", api.ServiceStatus{
+		Healthy: true,
+		Message: "ok",
+		Details: map[string]interface{}{"lag_seconds": 3},
+	}))
+	require.NoError(t, newRegistry(db, "detector-1").Report(ctx, "detection", api.ServiceStatus{Healthy: true, Message: "ok"}))
+
+	components, err := newRegistry(db, "api-1").Components(ctx)
+	require.NoError(t, err)
+	require.Len(t, components, 2)
+
+	tron := components["tron:USDT"]
+	assert.True(t, tron.Healthy, "the latest report wins")
+	assert.Equal(t, "ok", tron.Message)
+	assert.EqualValues(t, 3, tron.Details["lag_seconds"])
+	assert.Equal(t, "monitor-1", tron.Details["instance"])
+	assert.Contains(t, tron.Details, "reported_at")
+	assert.Equal(t, "detector-1", components["detection"].Details["instance"])
+}
+
+func TestRegistry_StaleReports(t *testing.T) {
+	db := setupRegistryDB(t)
+	registry := newRegistry(db, "api-1")
+	ctx := context.Background()
+
+	old := time.Now().UTC().Add(-5 * time.Minute)
+	for component, instance := range map[string]string{"detection": "detector-old", "tron:USDT": "monitor-old"} {
+		_, err := db.Exec(`
+			INSERT INTO component_status (component, instance, healthy, message, details, reported_at)
+			VALUES (?, ?, 1, 'ok', '{}', ?)
+		`, component, instance, old)
+		require.NoError(t, err)
+	}
+	// A live monitor replaced the old one; the detector stopped reporting
+	require.NoError(t, newRegistry(db, "monitor-new").Report(ctx, "tron:USDT", api.ServiceStatus{Healthy: true, Message: "ok"}))
+
+	components, err := registry.Components(ctx)
+	require.NoError(t, err)
+	require.Len(t, components, 2)
+
+	assert.True(t, components["tron:USDT"].Healthy)
+	assert.Equal(t, "monitor-new", components["tron:USDT"].Details["instance"])
+
+	detection := components["detection"]
+	assert.False(t, detection.Healthy, "a service that stopped reporting is unhealthy")
+	assert.Contains(t, detection.Message, "no report for")
+}
+
+func TestRegistry_MultipleInstances(t *testing.T) {
+	db := setupRegistryDB(t)
+	ctx := context.Background()
+
+	require.NoError(t, newRegistry(db, "monitor-1").Report(ctx, "tron:USDT", api.ServiceStatus{Healthy: true}))
+	require.NoError(t, newRegistry(db, "monitor-2").Report(ctx, "tron:USDT", api.ServiceStatus{Healthy: false, Message: "lagging"}))
+
+	components, err := newRegistry(db, "api-1").Components(ctx)
+	require.NoError(t, err)
+	require.Len(t, components, 2)
+	assert.True(t, components["tron:USDT@monitor-1"].Healthy)
+	assert.False(t, components["tron:USDT@monitor-2"].Healthy)
+}
+
+func TestRegistry_Publish(t *testing.T) {
+	db := setupRegistryDB(t)
+	registry := newRegistry(db, "detector-1")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		registry.Publish(ctx, time.Hour, "detection", status(true))
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		components, err := registry.Components(context.Background())
+		return err == nil && components["detection"].Healthy
+	}, time.Second, 10*time.Millisecond, "the first report is sent immediately")
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish did not stop when its context was cancelled")
+	}
+}
@@ -0,0 +1,78 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WritesTextFormat(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	requests := metrics.NewCounterVec("test_requests_total", "Requests.", "method", "path")
+	requests.WithLabelValues("GET", `/a"b`).Inc()
+	requests.WithLabelValues("GET", `/a"b`).Add(2)
+	requests.WithLabelValues("DELETE", "/c").Inc()
+
+	depth := metrics.NewGaugeVec("test_depth", "Queue depth.")
+	depth.WithLabelValues().Set(7)
+	depth.WithLabelValues().Dec()
+
+	latency := metrics.NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "op")
+	latency.WithLabelValues("read").Observe(0.05)
+	latency.WithLabelValues("read").Observe(0.1)
+	latency.WithLabelValues("read").Observe(5)
+
+	unused := metrics.NewCounterVec("test_unused_total", "Never incremented.", "kind")
+	registry.MustRegister(requests, depth, latency, unused,
+		metrics.NewGaugeFunc("test_func", "Read on scrape.", func() float64 { return 1.5 }))
+
+	var buf bytes.Buffer
+	registry.WriteText(&buf)
+
+	assert.Equal(t, `# HELP test_depth Queue depth.
+# TYPE test_depth gauge
+test_depth 6
+# HELP test_func Read on scrape.
+# TYPE test_func gauge
+test_func 1.5
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{op="read",le="0.1"} 2
+test_latency_seconds_bucket{op="read",le="1"} 2
+test_latency_seconds_bucket{op="read",le="+Inf"} 3
+test_latency_seconds_sum{op="read"} 5.15
+test_latency_seconds_count{op="read"} 3
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{method="DELETE",path="/c"} 1
+test_requests_total{method="GET",path="/a\"b"} 3
+`, buf.String())
+}
+
+func TestRegistry_RejectsDuplicatesAndBadLabels(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.MustRegister(metrics.NewCounterVec("test_total", "Test."))
+
+	assert.Panics(t, func() { registry.MustRegister(metrics.NewCounterVec("test_total", "Again.")) })
+	assert.Panics(t, func() { registry.MustRegister(metrics.NewCounterVec("bad-name", "Bad.")) })
+	assert.Panics(t, func() { metrics.NewCounterVec("test_labels_total", "Labels.", "a").WithLabelValues("x", "y") })
+	assert.Panics(t, func() { metrics.NewCounterVec("test_negative_total", "Negative.").WithLabelValues().Add(-1) })
+}
+
+func TestHandler_ServesDefaultRegistry(t *testing.T) {
+	metrics.OutliersDetected.WithLabelValues("zscore", "high").Inc()
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, metrics.ContentType, recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), `stablerisk_outliers_detected_total{type="zscore",severity="high"}`)
+	assert.Contains(t, recorder.Body.String(), "go_goroutines ")
+}
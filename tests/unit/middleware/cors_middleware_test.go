@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func corsRouter(origins ...string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.CORS(middleware.CORSConfig{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{"get", "post"},
+		MaxAge:         10 * time.Minute,
+	}))
+	router.GET("/outliers", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func corsRequest(router *gin.Engine, method, origin string, preflight bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/outliers", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if preflight {
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORS_AllowedOrigin(t *testing.T) {
+	router := corsRouter("https://dashboard.example.com")
+
+	w := corsRequest(router, http.MethodOptions, "https://dashboard.example.com", true)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://dashboard.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Authorization")
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+
+	w = corsRequest(router, http.MethodGet, "https://dashboard.example.com", false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://dashboard.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+}
+
+func TestCORS_OtherOrigins(t *testing.T) {
+	router := corsRouter("https://dashboard.example.com")
+
+	w := corsRequest(router, http.MethodOptions, "https://evil.example.com", true)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	// Served, but without headers letting the browser expose the response
+	w = corsRequest(router, http.MethodGet, "https://evil.example.com", false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	// Same-origin and non-browser requests carry no Origin
+	w = corsRequest(router, http.MethodGet, "", false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Vary"))
+}
+
+func TestCORS_AnyOriginWithoutCredentials(t *testing.T) {
+	router := corsRouter("*")
+
+	w := corsRequest(router, http.MethodGet, "https://anywhere.example.com", false)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+}
@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupIdempotencyStore(t *testing.T, ttl time.Duration) *security.IdempotencyStore {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE idempotency_keys (
+			principal TEXT NOT NULL,
+			idempotency_key TEXT NOT NULL,
+			request_hash TEXT NOT NULL,
+			status_code INTEGER,
+			content_type TEXT NOT NULL DEFAULT '',
+			response_body BLOB,
+			created_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (principal, idempotency_key)
+		)
+	`)
+	require.NoError(t, err)
+
+	return security.NewIdempotencyStore(db, security.IdempotencyConfig{TTL: ttl}, nil)
+}
+
+// setupIdempotencyRouter serves POST /acknowledge, which counts the times
+// it runs, and answers with status
+func setupIdempotencyRouter(store *security.IdempotencyStore, calls *int, status *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if userID := c.GetHeader("X-Test-User"); userID != "" {
+			c.Set(middleware.ContextKeyUserID, userID)
+		}
+		c.Next()
+	})
+	router.POST("/acknowledge", middleware.Idempotency(store, nil), func(c *gin.Context) {
+		*calls++
+		c.JSON(*status, gin.H{"call": *calls})
+	})
+	return router
+}
+
+func idempotentRequest(router *gin.Engine, userID, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/acknowledge", strings.NewReader(body))
+	req.Header.Set("X-Test-User", userID)
+	if key != "" {
+		req.Header.Set(middleware.IdempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotency_ReplaysResponse(t *testing.T) {
+	calls, status := 0, http.StatusCreated
+	router := setupIdempotencyRouter(setupIdempotencyStore(t, time.Hour), &calls, &status)
+
+	first := idempotentRequest(router, "user-1", "key-1", `{"notes":"done"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(middleware.IdempotentReplayedHeader))
+
+	retry := idempotentRequest(router, "user-1", "key-1", `{"notes":"done"}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get(middleware.IdempotentReplayedHeader))
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Contains(t, retry.Header().Get("Content-Type"), "application/json")
+	assert.Equal(t, 1, calls)
+
+	// Keys belong to their caller, and requests without one always run
+	assert.Equal(t, `{"call":2}`, idempotentRequest(router, "user-2", "key-1", `{"notes":"done"}`).Body.String())
+	idempotentRequest(router, "user-1", "", `{"notes":"done"}`)
+	idempotentRequest(router, "user-1", "", `{"notes":"done"}`)
+	assert.Equal(t, 4, calls)
+}
+
+func TestIdempotency_RejectsReusedKey(t *testing.T) {
+	calls, status := 0, http.StatusOK
+	router := setupIdempotencyRouter(setupIdempotencyStore(t, time.Hour), &calls, &status)
+
+	idempotentRequest(router, "user-1", "key-1", `{"notes":"done"}`)
+	w := idempotentRequest(router, "user-1", "key-1", `{"notes":"other"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, 1, calls)
+
+	w = idempotentRequest(router, "user-1", strings.Repeat("k", 256), `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = idempotentRequest(router, "user-1", "key\x01", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, 1, calls)
+}
+
+func TestIdempotency_RetriesServerErrors(t *testing.T) {
+	calls, status := 0, http.StatusInternalServerError
+	router := setupIdempotencyRouter(setupIdempotencyStore(t, time.Hour), &calls, &status)
+
+	assert.Equal(t, http.StatusInternalServerError, idempotentRequest(router, "user-1", "key-1", `{}`).Code)
+
+	status = http.StatusOK
+	w := idempotentRequest(router, "user-1", "key-1", `{}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(middleware.IdempotentReplayedHeader))
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotency_ConcurrentRequest(t *testing.T) {
+	store := setupIdempotencyStore(t, time.Hour)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(middleware.ContextKeyUserID, "user-1")
+		c.Next()
+	})
+	// The handler retries its own request while the first is still running
+	var inner *httptest.ResponseRecorder
+	router.POST("/acknowledge", middleware.Idempotency(store, nil), func(c *gin.Context) {
+		if inner == nil {
+			inner = idempotentRequest(router, "user-1", "key-1", `{}`)
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	assert.Equal(t, http.StatusNoContent, idempotentRequest(router, "user-1", "key-1", `{}`).Code)
+	require.NotNil(t, inner)
+	assert.Equal(t, http.StatusConflict, inner.Code)
+	assert.Equal(t, "1", inner.Header().Get("Retry-After"))
+}
+
+func TestIdempotency_StoresResponseAfterClientDisconnects(t *testing.T) {
+	store := setupIdempotencyStore(t, time.Hour)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(middleware.ContextKeyUserID, "user-1")
+		c.Next()
+	})
+	// The client gives up after the change is made but before it is answered
+	calls := 0
+	var disconnect context.CancelFunc
+	router.POST("/acknowledge", middleware.Idempotency(store, nil), func(c *gin.Context) {
+		calls++
+		if disconnect != nil {
+			disconnect()
+		}
+		c.JSON(http.StatusOK, gin.H{"call": calls})
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	disconnect = cancel
+	req := httptest.NewRequest(http.MethodPost, "/acknowledge", strings.NewReader(`{}`)).WithContext(ctx)
+	req.Header.Set(middleware.IdempotencyKeyHeader, "key-1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	require.Error(t, ctx.Err())
+
+	// The retry is answered from the stored response
+	disconnect = nil
+	w := idempotentRequest(router, "user-1", "key-1", `{}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get(middleware.IdempotentReplayedHeader))
+	assert.Equal(t, 1, calls)
+}
+
+func TestIdempotency_KeysExpire(t *testing.T) {
+	calls, status := 0, http.StatusOK
+	router := setupIdempotencyRouter(setupIdempotencyStore(t, 10*time.Millisecond), &calls, &status)
+
+	idempotentRequest(router, "user-1", "key-1", `{}`)
+	time.Sleep(20 * time.Millisecond)
+	w := idempotentRequest(router, "user-1", "key-1", `{}`)
+	assert.Empty(t, w.Header().Get(middleware.IdempotentReplayedHeader))
+	assert.Equal(t, `{"call":2}`, w.Body.String())
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsMiddleware_RecordsRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.Metrics())
+	router.GET("/outliers/:id", func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+
+	matched := metrics.HTTPRequestDuration.WithLabelValues("GET", "/outliers/:id", "404")
+	unmatched := metrics.HTTPRequestDuration.WithLabelValues("GET", "unmatched", "404")
+	matchedBefore, unmatchedBefore := matched.Count(), unmatched.Count()
+
+	for _, path := range []string{"/outliers/1", "/outliers/2", "/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, matchedBefore+2, matched.Count())
+	assert.Equal(t, unmatchedBefore+1, unmatched.Count())
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// failingLimiter stands in for an unreachable Redis
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string, ratelimit.Rule) (bool, time.Duration, error) {
+	return false, 0, errors.New("connection refused")
+}
+
+func setupRateLimitRouter(limiter ratelimit.Limiter, config middleware.RateLimitConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if userID := c.GetHeader("X-Test-User"); userID != "" {
+			c.Set(middleware.ContextKeyUserID, userID)
+		}
+		c.Next()
+	})
+	router.Use(middleware.RateLimit(limiter, config, zap.NewNop()))
+	router.GET("/outliers", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func rateLimitRequest(router *gin.Engine, ip, userID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/outliers", nil)
+	req.RemoteAddr = ip + ":12345"
+	if userID != "" {
+		req.Header.Set("X-Test-User", userID)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit_PerIP(t *testing.T) {
+	router := setupRateLimitRouter(ratelimit.NewMemoryLimiter(), middleware.RateLimitConfig{
+		Group: "outliers",
+		PerIP: ratelimit.Rule{PerMinute: 2},
+	})
+	refused := metrics.RateLimited.WithLabelValues("outliers", "ip")
+	before := refused.Value()
+
+	assert.Equal(t, http.StatusOK, rateLimitRequest(router, "10.0.0.1", "").Code)
+	assert.Equal(t, http.StatusOK, rateLimitRequest(router, "10.0.0.1", "").Code)
+
+	w := rateLimitRequest(router, "10.0.0.1", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "too_many_requests")
+	assert.Equal(t, before+1, refused.Value())
+
+	// Another IP is unaffected
+	assert.Equal(t, http.StatusOK, rateLimitRequest(router, "10.0.0.2", "").Code)
+}
+
+func TestRateLimit_PerUserAcrossIPs(t *testing.T) {
+	router := setupRateLimitRouter(ratelimit.NewMemoryLimiter(), middleware.RateLimitConfig{
+		Group:   "outliers",
+		PerIP:   ratelimit.Rule{PerMinute: 100},
+		PerUser: ratelimit.Rule{PerMinute: 1},
+	})
+
+	assert.Equal(t, http.StatusOK, rateLimitRequest(router, "10.0.0.1", "user-1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, rateLimitRequest(router, "10.0.0.2", "user-1").Code)
+	assert.Equal(t, http.StatusOK, rateLimitRequest(router, "10.0.0.2", "user-2").Code)
+
+	// Unauthenticated requests are limited by IP only
+	assert.Equal(t, http.StatusOK, rateLimitRequest(router, "10.0.0.3", "").Code)
+	assert.Equal(t, http.StatusOK, rateLimitRequest(router, "10.0.0.3", "").Code)
+}
+
+func TestRateLimit_GroupsAreSeparate(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter()
+	rule := ratelimit.Rule{PerMinute: 1}
+	auth := setupRateLimitRouter(limiter, middleware.RateLimitConfig{Group: "auth", PerIP: rule})
+	api := setupRateLimitRouter(limiter, middleware.RateLimitConfig{Group: "api", PerIP: rule})
+
+	assert.Equal(t, http.StatusOK, rateLimitRequest(auth, "10.0.0.1", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, rateLimitRequest(auth, "10.0.0.1", "").Code)
+	assert.Equal(t, http.StatusOK, rateLimitRequest(api, "10.0.0.1", "").Code)
+}
+
+func TestRateLimit_AllowsRequestsWhenLimiterFails(t *testing.T) {
+	router := setupRateLimitRouter(failingLimiter{}, middleware.RateLimitConfig{
+		Group: "api",
+		PerIP: ratelimit.Rule{PerMinute: 1},
+	})
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, rateLimitRequest(router, "10.0.0.1", "").Code)
+	}
+}
+
+func TestRateLimit_IgnoresForwardedForFromUntrustedClients(t *testing.T) {
+	router := setupRateLimitRouter(ratelimit.NewMemoryLimiter(), middleware.RateLimitConfig{
+		Group: "outliers",
+		PerIP: ratelimit.Rule{PerMinute: 1},
+	})
+	require.NoError(t, router.SetTrustedProxies(nil))
+
+	spoofed := func(forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/outliers", nil)
+		req.RemoteAddr = "10.0.0.1:12345"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, spoofed("203.0.113.1"))
+	// A new X-Forwarded-For does not buy a new bucket
+	assert.Equal(t, http.StatusTooManyRequests, spoofed("203.0.113.2"))
+	assert.Equal(t, http.StatusTooManyRequests, spoofed("203.0.113.3"))
+}
+
+func TestRateLimit_UsesForwardedForFromTrustedProxies(t *testing.T) {
+	router := setupRateLimitRouter(ratelimit.NewMemoryLimiter(), middleware.RateLimitConfig{
+		Group: "outliers",
+		PerIP: ratelimit.Rule{PerMinute: 1},
+	})
+	require.NoError(t, router.SetTrustedProxies([]string{"10.0.0.0/8"}))
+
+	forwarded := func(forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/outliers", nil)
+		req.RemoteAddr = "10.0.0.1:12345"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Clients behind the proxy are limited separately
+	assert.Equal(t, http.StatusOK, forwarded("203.0.113.1"))
+	assert.Equal(t, http.StatusOK, forwarded("203.0.113.2"))
+	assert.Equal(t, http.StatusTooManyRequests, forwarded("203.0.113.1"))
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func setupRequestIDRouter(logger *zap.Logger) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.RequestID())
+	router.GET("/outliers", func(c *gin.Context) {
+		middleware.RequestLogger(c, logger).Info("Listing outliers")
+		c.JSON(http.StatusOK, gin.H{
+			"gin":     middleware.GetRequestID(c),
+			"context": utils.RequestIDFromContext(c.Request.Context()),
+		})
+	})
+	return router
+}
+
+func TestRequestID_GeneratesID(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	router := setupRequestIDRouter(zap.New(core))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/outliers", nil))
+
+	id := w.Header().Get(middleware.RequestIDHeader)
+	assert.Len(t, id, 36)
+	assert.JSONEq(t, `{"gin":"`+id+`","context":"`+id+`"}`, w.Body.String())
+
+	entries := logs.FilterMessage("Listing outliers").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, id, entries[0].ContextMap()["request_id"])
+
+	// Each request gets its own ID
+	w2 := httptest.NewRecorder()
+	router.ServeHTTP(w2, httptest.NewRequest(http.MethodGet, "/outliers", nil))
+	assert.NotEqual(t, id, w2.Header().Get(middleware.RequestIDHeader))
+}
+
+func TestRequestID_KeepsClientID(t *testing.T) {
+	router := setupRequestIDRouter(zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodGet, "/outliers", nil)
+	req.Header.Set(middleware.RequestIDHeader, "lb-7f3a:42.1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "lb-7f3a:42.1", w.Header().Get(middleware.RequestIDHeader))
+}
+
+func TestRequestID_ReplacesUnsafeClientID(t *testing.T) {
+	router := setupRequestIDRouter(zap.NewNop())
+
+	for _, id := range []string{"has space", "new\nline", `quote"`, strings.Repeat("a", 129)} {
+		req := httptest.NewRequest(http.MethodGet, "/outliers", nil)
+		req.Header.Set(middleware.RequestIDHeader, id)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		got := w.Header().Get(middleware.RequestIDHeader)
+		assert.NotEqual(t, id, got)
+		assert.Len(t, got, 36, id)
+	}
+}
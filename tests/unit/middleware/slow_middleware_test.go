@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSlowRequests_LogsAndCountsSlowRoutes(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.SlowRequests(20*time.Millisecond, zap.New(core)))
+	router.GET("/outliers", func(c *gin.Context) {
+		time.Sleep(30 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	router.GET("/outliers/:id", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	slow := metrics.SlowRequests.WithLabelValues(http.MethodGet, "/outliers")
+	before := slow.Value()
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/outliers?address=TXYZ&limit=50", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/outliers/1", nil))
+
+	assert.Equal(t, before+1, slow.Value())
+
+	entries := logs.FilterMessage("Slow HTTP request").All()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "/outliers", fields["route"])
+	assert.Equal(t, []interface{}{"address", "limit"}, fields["query_params"])
+	assert.NotContains(t, fields["path"], "TXYZ")
+}
+
+func TestSlowRequests_DisabledAtZero(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.SlowRequests(0, zap.New(core)))
+	router.GET("/outliers", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/outliers", nil))
+	assert.Zero(t, logs.Len())
+}
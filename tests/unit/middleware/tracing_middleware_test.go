@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikedewar/stablerisk/internal/api/middleware"
+	"github.com/mikedewar/stablerisk/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracingMiddleware_ContinuesIncomingTrace(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer collector.Close()
+	shutdown := tracing.Init(tracing.Config{ServiceName: "stablerisk-api", Endpoint: collector.URL, SampleRatio: 1}, nil)
+	defer shutdown(context.Background())
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.Tracing())
+
+	var span *tracing.Span
+	router.GET("/outliers/:id", func(c *gin.Context) {
+		span = tracing.SpanFromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/outliers/1", nil)
+	req.Header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	require.NotNil(t, span)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID.String())
+	assert.NotEqual(t, "00f067aa0ba902b7", span.SpanContext().SpanID.String())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", recorder.Header().Get("X-Trace-Id"))
+}
@@ -0,0 +1,356 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mikedewar/stablerisk/internal/migrate"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func setupDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"001_outliers.sql": {Data: []byte(`
+			CREATE TABLE outliers (id TEXT PRIMARY KEY, address TEXT NOT NULL);
+			CREATE INDEX idx_outliers_address ON outliers (address);
+		`)},
+		"002_users.sql": {Data: []byte(`CREATE TABLE users (id TEXT PRIMARY KEY, username TEXT NOT NULL)`)},
+		"003_seed.sql":  {Data: []byte(`INSERT INTO users (id, username) VALUES ('u1', 'admin')`)},
+		"README.md":     {Data: []byte("Not a migration")},
+	}
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&count))
+	return count > 0
+}
+
+func TestLoad(t *testing.T) {
+	loaded, err := migrate.Load(testMigrations())
+	require.NoError(t, err)
+	require.Len(t, loaded, 3)
+	assert.Equal(t, 1, loaded[0].Version)
+	assert.Equal(t, "001_outliers", loaded[0].Name)
+	assert.Equal(t, "003_seed", loaded[2].Name)
+	assert.Len(t, loaded[0].Checksum, 64)
+
+	_, err = migrate.Load(fstest.MapFS{
+		"001_a.sql": {Data: []byte("SELECT 1")},
+		"1_b.sql":   {Data: []byte("SELECT 1")},
+	})
+	assert.ErrorContains(t, err, "same version")
+}
+
+func TestLoad_EmbeddedMigrations(t *testing.T) {
+	fsys, err := fs.Sub(migrations.Postgres, "postgres")
+	require.NoError(t, err)
+
+	loaded, err := migrate.Load(fsys)
+	require.NoError(t, err)
+	require.NotEmpty(t, loaded)
+	chained := false
+	for i, migration := range loaded {
+		assert.Equal(t, i+1, migration.Version, "migrations should be numbered without gaps")
+		if chained {
+			// SQL cannot sign chained audit records; the migrator records these
+			assert.NotContains(t, migration.SQL, "INSERT INTO audit_logs",
+				"%s should leave recording itself to the migrator", migration.Name)
+		} else {
+			assert.Contains(t, migration.SQL, `"migration": "`+migration.Name+`"`,
+				"%s should record itself in audit_logs", migration.Name)
+		}
+		chained = chained || migration.Name == "017_audit_chain"
+	}
+	assert.True(t, chained)
+}
+
+func TestMigrator_Up(t *testing.T) {
+	db := setupDB(t)
+	migrator, err := migrate.New(db, testMigrations(), migrate.Config{}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	applied, err := migrator.Up(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, applied)
+	assert.True(t, tableExists(t, db, "outliers"))
+
+	var username string
+	require.NoError(t, db.QueryRow(`SELECT username FROM users WHERE id = 'u1'`).Scan(&username))
+	assert.Equal(t, "admin", username)
+
+	// Nothing is run twice
+	applied, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, applied)
+
+	statuses, err := migrator.Status(context.Background())
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	for _, status := range statuses {
+		assert.True(t, status.Applied, status.Name)
+		assert.False(t, status.AppliedAt.IsZero(), status.Name)
+		assert.False(t, status.Modified, status.Name)
+	}
+}
+
+func TestMigrator_FailedMigrationRollsBack(t *testing.T) {
+	db := setupDB(t)
+	fsys := testMigrations()
+	fsys["002_users.sql"] = &fstest.MapFile{Data: []byte(`
+		CREATE TABLE users (id TEXT PRIMARY KEY, username TEXT NOT NULL);
+		INSERT INTO missing_table VALUES (1);
+	`)}
+
+	migrator, err := migrate.New(db, fsys, migrate.Config{}, nil)
+	require.NoError(t, err)
+	applied, err := migrator.Up(context.Background())
+	assert.ErrorContains(t, err, "002_users")
+	assert.Equal(t, 1, applied)
+	assert.False(t, tableExists(t, db, "users"), "the failed migration's changes should be rolled back")
+
+	// Fixed, the migration is retried and the rest follow
+	fsys["002_users.sql"] = testMigrations()["002_users.sql"]
+	migrator, err = migrate.New(db, fsys, migrate.Config{}, nil)
+	require.NoError(t, err)
+	applied, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, applied)
+}
+
+func TestMigrator_StatusReportsPendingAndModified(t *testing.T) {
+	db := setupDB(t)
+	fsys := testMigrations()
+	delete(fsys, "003_seed.sql")
+	migrator, err := migrate.New(db, fsys, migrate.Config{}, nil)
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+
+	fsys = testMigrations()
+	fsys["002_users.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE users (id TEXT PRIMARY KEY)`)}
+	migrator, err = migrate.New(db, fsys, migrate.Config{}, nil)
+	require.NoError(t, err)
+
+	statuses, err := migrator.Status(context.Background())
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	assert.False(t, statuses[0].Modified)
+	assert.True(t, statuses[1].Applied)
+	assert.True(t, statuses[1].Modified)
+	assert.False(t, statuses[2].Applied)
+}
+
+func TestMigrator_Baseline(t *testing.T) {
+	db := setupDB(t)
+	_, err := db.Exec(`CREATE TABLE outliers (id TEXT PRIMARY KEY, address TEXT NOT NULL)`)
+	require.NoError(t, err)
+
+	migrator, err := migrate.New(db, testMigrations(), migrate.Config{}, nil)
+	require.NoError(t, err)
+
+	_, err = migrator.Baseline(context.Background(), 9)
+	assert.ErrorContains(t, err, "no migration has version 9")
+
+	recorded, err := migrator.Baseline(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, recorded)
+
+	// Only the migrations after the baseline run
+	applied, err := migrator.Up(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, applied)
+	assert.True(t, tableExists(t, db, "users"))
+}
+
+func TestMigrator_AdoptsInitScriptDatabase(t *testing.T) {
+	db := setupDB(t)
+	fsys := fstest.MapFS{
+		"001_schema.sql": {Data: []byte(`
+			CREATE TABLE audit_logs (id INTEGER PRIMARY KEY, action TEXT NOT NULL, details TEXT);
+			INSERT INTO audit_logs (action, details) VALUES ('migration', '{"migration": "001_schema", "status": "completed"}');
+		`)},
+		"002_outliers.sql": {Data: []byte(`
+			CREATE TABLE outliers (id TEXT PRIMARY KEY);
+			INSERT INTO audit_logs (action, details) VALUES ('migration', '{"migration": "002_outliers"}');
+		`)},
+		"003_users.sql": {Data: []byte(`
+			CREATE TABLE users (id TEXT PRIMARY KEY);
+			INSERT INTO audit_logs (action, details) VALUES ('migration', '{"migration": "003_users"}');
+		`)},
+	}
+
+	// As the Postgres image's init scripts would have, run the first two
+	// without recording them
+	for _, name := range []string{"001_schema.sql", "002_outliers.sql"} {
+		_, err := db.Exec(string(fsys[name].Data))
+		require.NoError(t, err)
+	}
+	_, err := db.Exec(`INSERT INTO audit_logs (action, details) VALUES ('login', '{"migration": "003_users"}')`)
+	require.NoError(t, err)
+
+	migrator, err := migrate.New(db, fsys, migrate.Config{}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	applied, err := migrator.Up(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, applied, "only the migration the database has not run should run")
+	assert.True(t, tableExists(t, db, "users"))
+
+	statuses, err := migrator.Status(context.Background())
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.True(t, status.Applied, status.Name)
+	}
+}
+
+func TestMigrator_RecordsMigrationsInAuditChain(t *testing.T) {
+	db := setupDB(t)
+	fsys := testMigrations()
+	fsys["000_audit.sql"] = &fstest.MapFile{Data: []byte(`
+		CREATE TABLE audit_logs (
+			id TEXT PRIMARY KEY,
+			timestamp DATETIME NOT NULL,
+			user_id TEXT,
+			action TEXT NOT NULL,
+			resource TEXT,
+			status TEXT,
+			ip_address TEXT,
+			details TEXT,
+			signature TEXT NOT NULL,
+			sequence INTEGER UNIQUE,
+			prev_signature TEXT
+		);
+		CREATE TABLE audit_chain_head (id INTEGER PRIMARY KEY, sequence INTEGER NOT NULL, signature TEXT NOT NULL);
+		INSERT INTO audit_chain_head VALUES (1, 0, '');
+		CREATE TABLE audit_anchors (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			sequence INTEGER NOT NULL,
+			signature TEXT NOT NULL,
+			anchor_hash TEXT NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+		CREATE TABLE audit_archives (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			object_key TEXT NOT NULL UNIQUE,
+			records INTEGER NOT NULL,
+			first_sequence INTEGER NOT NULL DEFAULT 0,
+			last_sequence INTEGER NOT NULL DEFAULT 0,
+			last_signature TEXT NOT NULL DEFAULT '',
+			unchained_before DATETIME,
+			first_timestamp DATETIME NOT NULL,
+			last_timestamp DATETIME NOT NULL,
+			sha256 TEXT NOT NULL,
+			signature TEXT NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+	`)}
+
+	auditLogger := security.NewAuditLogger(db, security.AuditLoggerConfig{SecretKey: "test-audit-secret"}, nil)
+	migrator, err := migrate.New(db, fsys, migrate.Config{}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	migrator.SetAuditLogger(auditLogger)
+
+	applied, err := migrator.Up(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 4, applied)
+	require.NoError(t, auditLogger.Close())
+
+	var unchained int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM audit_logs WHERE sequence IS NULL`).Scan(&unchained))
+	assert.Zero(t, unchained)
+
+	verifier := security.NewAuditLogger(db, security.AuditLoggerConfig{SecretKey: "test-audit-secret"}, nil)
+	defer verifier.Close()
+	report, err := verifier.VerifyChain(context.Background())
+	require.NoError(t, err)
+	assert.True(t, report.Valid, "%v", report.Problems)
+	assert.Equal(t, int64(4), report.Records)
+	assert.Equal(t, int64(4), report.Head)
+
+	rows, err := db.Query(`SELECT details FROM audit_logs WHERE action = 'migration' ORDER BY sequence`)
+	require.NoError(t, err)
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var details string
+		require.NoError(t, rows.Scan(&details))
+		var entry struct {
+			Migration string `json:"migration"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(details), &entry))
+		names = append(names, entry.Migration)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"000_audit", "001_outliers", "002_users", "003_seed"}, names)
+}
+
+// TestMigrator_EmbeddedMigrationsKeepAuditChainValid migrates a fresh
+// Postgres database and verifies the audit chain over it. It needs
+// STABLERISK_TEST_POSTGRES_URL, a server URL whose user may create
+// databases.
+func TestMigrator_EmbeddedMigrationsKeepAuditChainValid(t *testing.T) {
+	serverURL := os.Getenv("STABLERISK_TEST_POSTGRES_URL")
+	if serverURL == "" {
+		t.Skip("STABLERISK_TEST_POSTGRES_URL not set")
+	}
+
+	server, err := sql.Open("postgres", serverURL)
+	require.NoError(t, err)
+	defer server.Close()
+	name := fmt.Sprintf("stablerisk_migrate_test_%d", time.Now().UnixNano())
+	_, err = server.Exec(`CREATE DATABASE ` + name)
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Exec(`DROP DATABASE IF EXISTS ` + name) })
+
+	dbURL, err := url.Parse(serverURL)
+	require.NoError(t, err)
+	dbURL.Path = "/" + name
+	db, err := sql.Open("postgres", dbURL.String())
+	require.NoError(t, err)
+	defer db.Close()
+
+	fsys, err := fs.Sub(migrations.Postgres, "postgres")
+	require.NoError(t, err)
+	auditLogger := security.NewAuditLogger(db, security.AuditLoggerConfig{SecretKey: "test-audit-secret"}, nil)
+	migrator, err := migrate.New(db, fsys, migrate.Config{AdvisoryLock: true}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	migrator.SetAuditLogger(auditLogger)
+
+	applied, err := migrator.Up(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, auditLogger.Close())
+
+	verifier := security.NewAuditLogger(db, security.AuditLoggerConfig{SecretKey: "test-audit-secret"}, nil)
+	defer verifier.Close()
+	report, err := verifier.VerifyChain(context.Background())
+	require.NoError(t, err)
+	assert.True(t, report.Valid, "%v", report.Problems)
+	assert.Equal(t, int64(applied), report.Records, "every applied migration should be chained")
+
+	// Only the migrations from before the chain wrote their own entries
+	var unchained int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM audit_logs WHERE sequence IS NULL`).Scan(&unchained))
+	assert.Equal(t, 17, unchained)
+}
@@ -0,0 +1,255 @@
+package notify_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/notify"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// sentEmail is a message accepted by smtpServer
+type sentEmail struct {
+	from       string
+	recipients []string
+	data       string
+}
+
+// smtpServer accepts mail without authentication or TLS and records it
+type smtpServer struct {
+	listener net.Listener
+
+	mu     sync.Mutex
+	emails []sentEmail
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &smtpServer{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	var email sentEmail
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			email = sentEmail{from: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			email.recipients = append(email.recipients, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			email.data = data.String()
+			s.mu.Lock()
+			s.emails = append(s.emails, email)
+			s.mu.Unlock()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *smtpServer) sent() []sentEmail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sentEmail(nil), s.emails...)
+}
+
+func TestEmailNotifier_SendsAlert(t *testing.T) {
+	server := newSMTPServer(t)
+	notifier := notify.NewEmailNotifier(notify.EmailConfig{
+		Host: "127.0.0.1",
+		Port: server.port(),
+		From: "alerts@stablerisk.test",
+		Recipients: map[models.Severity][]string{
+			models.SeverityCritical: {"oncall@stablerisk.test", "compliance@stablerisk.test"},
+		},
+		DefaultRecipients: []string{"team@stablerisk.test"},
+		DashboardURL:      "https://stablerisk.test/",
+		Timeout:           5 * time.Second,
+	}, zaptest.NewLogger(t))
+
+	o := outlier("outlier-1", models.OutlierTypePatternFanOut, models.SeverityCritical, "TFanOut")
+	o.Amount = decimal.NewFromInt(250000)
+	o.Details = map[string]interface{}{"fanout_count": 42}
+	require.NoError(t, notifier.Notify(context.Background(), notify.Alert{Rule: "critical", Outlier: o}))
+
+	emails := server.sent()
+	require.Len(t, emails, 1)
+	assert.Equal(t, "alerts@stablerisk.test", emails[0].from)
+	assert.Equal(t, []string{"compliance@stablerisk.test", "oncall@stablerisk.test"}, emails[0].recipients)
+	assert.Contains(t, emails[0].data, "Subject: [StableRisk] CRITICAL pattern_fanout outlier on TFanOut")
+	assert.Contains(t, emails[0].data, "Content-Type: text/html")
+	assert.Contains(t, emails[0].data, "TFanOut")
+	assert.Contains(t, emails[0].data, "250000")
+	assert.Contains(t, emails[0].data, "fanout_count")
+	assert.Contains(t, emails[0].data, `href="https://stablerisk.test/outliers?id=outlier-1"`)
+
+	// Severities without their own recipients go to the default ones
+	require.NoError(t, notifier.Notify(context.Background(), notify.Alert{
+		Rule:    "high",
+		Outlier: outlier("outlier-2", models.OutlierTypeZScore, models.SeverityHigh, "TOther"),
+	}))
+	emails = server.sent()
+	require.Len(t, emails, 2)
+	assert.Equal(t, []string{"team@stablerisk.test"}, emails[1].recipients)
+}
+
+func TestEmailNotifier_BatchesLessSevereAlerts(t *testing.T) {
+	server := newSMTPServer(t)
+	notifier := notify.NewEmailNotifier(notify.EmailConfig{
+		Host:              "127.0.0.1",
+		Port:              server.port(),
+		From:              "alerts@stablerisk.test",
+		DefaultRecipients: []string{"team@stablerisk.test"},
+		BatchWindow:       time.Hour,
+		Timeout:           5 * time.Second,
+	}, zaptest.NewLogger(t))
+
+	ctx := context.Background()
+	require.NoError(t, notifier.Notify(ctx, notify.Alert{Rule: "all", Outlier: outlier("o1", models.OutlierTypeZScore, models.SeverityHigh, "TA")}))
+	require.NoError(t, notifier.Notify(ctx, notify.Alert{Rule: "all", Outlier: outlier("o2", models.OutlierTypeIQR, models.SeverityMedium, "TB")}))
+
+	// Critical alerts are not held back
+	require.NoError(t, notifier.Notify(ctx, notify.Alert{Rule: "all", Outlier: outlier("o3", models.OutlierTypeZScore, models.SeverityCritical, "TC")}))
+	emails := server.sent()
+	require.Len(t, emails, 1)
+	assert.Contains(t, emails[0].data, "TC")
+
+	notifier.Flush(ctx)
+	emails = server.sent()
+	require.Len(t, emails, 2)
+	assert.Contains(t, emails[1].data, "Subject: [StableRisk] 2 outlier alerts")
+	assert.Contains(t, emails[1].data, "TA")
+	assert.Contains(t, emails[1].data, "TB")
+
+	// Nothing left to send
+	notifier.Flush(ctx)
+	assert.Len(t, server.sent(), 2)
+}
+
+func TestEmailNotifier_ReportsConnectionFailure(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	notifier := notify.NewEmailNotifier(notify.EmailConfig{
+		Host:              "127.0.0.1",
+		Port:              port,
+		From:              "alerts@stablerisk.test",
+		DefaultRecipients: []string{"team@stablerisk.test"},
+		Timeout:           time.Second,
+	}, zaptest.NewLogger(t))
+
+	err = notifier.Notify(context.Background(), notify.Alert{Rule: "all", Outlier: outlier("o1", models.OutlierTypeZScore, models.SeverityHigh, "TA")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "127.0.0.1:"+strconv.Itoa(port))
+}
+
+func TestEmailNotifier_SendsAttachments(t *testing.T) {
+	server := newSMTPServer(t)
+	notifier := notify.NewEmailNotifier(notify.EmailConfig{
+		Host:    "127.0.0.1",
+		Port:    server.port(),
+		From:    "reports@stablerisk.test",
+		Timeout: 5 * time.Second,
+	}, zaptest.NewLogger(t))
+
+	pdf := []byte(strings.Repeat("%PDF-1.4 report ", 20))
+	require.NoError(t, notifier.Send(context.Background(), []string{"compliance@stablerisk.test"},
+		"Daily report", []byte("<p>Summary</p>"),
+		notify.Attachment{Filename: "report.pdf", ContentType: "application/pdf", Content: pdf}))
+
+	emails := server.sent()
+	require.Len(t, emails, 1)
+	assert.Equal(t, []string{"compliance@stablerisk.test"}, emails[0].recipients)
+
+	header, body, found := strings.Cut(emails[0].data, "\r\n\r\n")
+	require.True(t, found)
+	mediaType, params, err := mime.ParseMediaType(readHeader(t, header).Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	parts := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	html, err := parts.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "text/html; charset=UTF-8", html.Header.Get("Content-Type"))
+	content, _ := io.ReadAll(html)
+	assert.Equal(t, "<p>Summary</p>", string(content))
+
+	attachment, err := parts.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "report.pdf", attachment.FileName())
+	assert.Equal(t, "application/pdf", attachment.Header.Get("Content-Type"))
+	content, _ = io.ReadAll(base64.NewDecoder(base64.StdEncoding, attachment))
+	assert.Equal(t, pdf, content)
+}
+
+// readHeader parses an email's header block
+func readHeader(t *testing.T, header string) textproto.MIMEHeader {
+	parsed, err := textproto.NewReader(bufio.NewReader(strings.NewReader(header + "\r\n\r\n"))).ReadMIMEHeader()
+	require.NoError(t, err)
+	return parsed
+}
@@ -0,0 +1,264 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/notify"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// pagingRequest is a request received by pagingServer
+type pagingRequest struct {
+	path          string
+	query         string
+	authorization string
+	body          map[string]interface{}
+}
+
+// pagingServer records JSON requests and replies with status
+type pagingServer struct {
+	*httptest.Server
+	status int
+
+	mu       sync.Mutex
+	requests []pagingRequest
+}
+
+func newPagingServer(t *testing.T, status int) *pagingServer {
+	s := &pagingServer{status: status}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		s.mu.Lock()
+		s.requests = append(s.requests, pagingRequest{
+			path:          r.URL.Path,
+			query:         r.URL.RawQuery,
+			authorization: r.Header.Get("Authorization"),
+			body:          body,
+		})
+		s.mu.Unlock()
+		w.WriteHeader(s.status)
+		w.Write([]byte(`{"status":"success"}`))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *pagingServer) received() []pagingRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]pagingRequest(nil), s.requests...)
+}
+
+func TestPagerDutyNotifier_TriggersAndResolves(t *testing.T) {
+	server := newPagingServer(t, http.StatusAccepted)
+	notifier := notify.NewPagerDutyNotifier(notify.PagerDutyConfig{
+		EventsURL:    server.URL + "/v2/enqueue",
+		RoutingKey:   "default-key",
+		RoutingKeys:  map[models.Severity]string{models.SeverityCritical: "critical-key"},
+		DashboardURL: "https://stablerisk.test",
+	}, zaptest.NewLogger(t))
+	ctx := context.Background()
+
+	critical := outlier("o1", models.OutlierTypePatternFanOut, models.SeverityCritical, "TFanOut")
+	critical.DetectedAt = time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, notifier.Notify(ctx, notify.Alert{Rule: "critical", Outlier: critical}))
+
+	// Below the minimum severity nothing is paged
+	require.NoError(t, notifier.Notify(ctx, notify.Alert{Rule: "all", Outlier: outlier("o2", models.OutlierTypeZScore, models.SeverityHigh, "TA")}))
+
+	// Acknowledging another outlier of the incident resolves it, under
+	// every routing key since a less severe outlier's would miss it
+	repeat := outlier("o3", models.OutlierTypePatternFanOut, models.SeverityHigh, "TFanOut")
+	require.NoError(t, notifier.Resolve(ctx, repeat))
+
+	requests := server.received()
+	require.Len(t, requests, 3)
+
+	trigger := requests[0].body
+	assert.Equal(t, "trigger", trigger["event_action"])
+	assert.Equal(t, "critical-key", trigger["routing_key"])
+	assert.Equal(t, notify.IncidentKey(critical), trigger["dedup_key"])
+	assert.Equal(t, "https://stablerisk.test/outliers?id=o1", trigger["client_url"])
+	payload := trigger["payload"].(map[string]interface{})
+	assert.Equal(t, "StableRisk: CRITICAL pattern_fanout outlier on TFanOut", payload["summary"])
+	assert.Equal(t, "critical", payload["severity"])
+	assert.Equal(t, "2025-01-15T10:00:00Z", payload["timestamp"])
+	assert.Equal(t, "o1", payload["custom_details"].(map[string]interface{})["outlier_id"])
+
+	var routingKeys []interface{}
+	for _, request := range requests[1:] {
+		assert.Equal(t, "resolve", request.body["event_action"])
+		assert.Equal(t, trigger["dedup_key"], request.body["dedup_key"])
+		routingKeys = append(routingKeys, request.body["routing_key"])
+	}
+	assert.ElementsMatch(t, []interface{}{"default-key", "critical-key"}, routingKeys)
+}
+
+func TestPagerDutyNotifier_ReportsRejectedEvents(t *testing.T) {
+	server := newPagingServer(t, http.StatusBadRequest)
+	notifier := notify.NewPagerDutyNotifier(notify.PagerDutyConfig{
+		EventsURL:  server.URL,
+		RoutingKey: "bad-key",
+	}, zaptest.NewLogger(t))
+
+	err := notifier.Notify(context.Background(), notify.Alert{Outlier: outlier("o1", models.OutlierTypeZScore, models.SeverityCritical, "TA")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 400")
+}
+
+func TestOpsgenieNotifier_CreatesAndClosesAlerts(t *testing.T) {
+	server := newPagingServer(t, http.StatusAccepted)
+	notifier := notify.NewOpsgenieNotifier(notify.OpsgenieConfig{
+		APIURL: server.URL,
+		APIKey: "genie-key",
+		Responders: []notify.OpsgenieResponder{
+			{Type: "team", Name: "compliance"},
+			{Type: "user", Name: "oncall@stablerisk.test"},
+		},
+		MinSeverity:  models.SeverityHigh,
+		DashboardURL: "https://stablerisk.test",
+	}, zaptest.NewLogger(t))
+	ctx := context.Background()
+
+	o := outlier("o1", models.OutlierTypeWatchlist, models.SeverityHigh, "TWatched")
+	require.NoError(t, notifier.Notify(ctx, notify.Alert{Rule: "watchlist", Outlier: o}))
+	require.NoError(t, notifier.Resolve(ctx, o))
+
+	requests := server.received()
+	require.Len(t, requests, 2)
+
+	create := requests[0]
+	assert.Equal(t, "/v2/alerts", create.path)
+	assert.Equal(t, "GenieKey genie-key", create.authorization)
+	assert.Equal(t, notify.IncidentKey(o), create.body["alias"])
+	assert.Equal(t, "P2", create.body["priority"])
+	assert.Equal(t, "StableRisk: HIGH watchlist outlier on TWatched", create.body["message"])
+	assert.Contains(t, create.body["description"], "https://stablerisk.test/outliers?id=o1")
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "team", "name": "compliance"},
+		map[string]interface{}{"type": "user", "username": "oncall@stablerisk.test"},
+	}, create.body["responders"])
+
+	closeRequest := requests[1]
+	assert.Equal(t, "/v2/alerts/"+notify.IncidentKey(o)+"/close", closeRequest.path)
+	assert.Equal(t, "identifierType=alias", closeRequest.query)
+	assert.Equal(t, "GenieKey genie-key", closeRequest.authorization)
+}
+
+func TestOpsgenieNotifier_ClosingUnknownAlertSucceeds(t *testing.T) {
+	server := newPagingServer(t, http.StatusNotFound)
+	notifier := notify.NewOpsgenieNotifier(notify.OpsgenieConfig{
+		APIURL: server.URL,
+		APIKey: "genie-key",
+	}, zaptest.NewLogger(t))
+
+	o := outlier("o1", models.OutlierTypeZScore, models.SeverityCritical, "TA")
+	require.NoError(t, notifier.Resolve(context.Background(), o))
+	require.Error(t, notifier.Notify(context.Background(), notify.Alert{Outlier: o}))
+}
+
+// resolvingNotifier is a fakeNotifier that records resolved outliers
+type resolvingNotifier struct {
+	fakeNotifier
+
+	resolvedMu sync.Mutex
+	resolved   []string
+}
+
+func (r *resolvingNotifier) Resolve(ctx context.Context, outlier models.Outlier) error {
+	r.resolvedMu.Lock()
+	defer r.resolvedMu.Unlock()
+	r.resolved = append(r.resolved, outlier.ID)
+	return nil
+}
+
+func (r *resolvingNotifier) resolvedIDs() []string {
+	r.resolvedMu.Lock()
+	defer r.resolvedMu.Unlock()
+	return append([]string(nil), r.resolved...)
+}
+
+func TestRouter_ResolvesOnResolverChannels(t *testing.T) {
+	pager := &resolvingNotifier{fakeNotifier: fakeNotifier{name: "pager"}}
+	chat := &fakeNotifier{name: "chat"}
+	router, err := notify.NewRouter(notify.RouterConfig{
+		Rules:       []notify.Rule{{Name: "all", Channels: []string{"pager", "chat"}}},
+		DedupWindow: time.Hour,
+	}, []notify.Notifier{pager, chat}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	router.Start()
+	defer router.Stop()
+
+	first := outlier("o1", models.OutlierTypeZScore, models.SeverityCritical, "TA")
+	router.Route(first)
+	require.Eventually(t, func() bool { return len(pager.received()) == 1 }, time.Second, 5*time.Millisecond)
+
+	router.Resolve(first)
+	require.Eventually(t, func() bool { return len(pager.resolvedIDs()) == 1 }, time.Second, 5*time.Millisecond)
+
+	// Once resolved the incident pages again, while other channels still
+	// drop the repeat
+	router.Route(outlier("o2", models.OutlierTypeZScore, models.SeverityCritical, "TA"))
+	require.Eventually(t, func() bool { return len(pager.received()) == 2 }, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, chat.received(), 1)
+}
+
+// fakeIncidents reports the incidents of the outliers it holds as open
+type fakeIncidents struct {
+	mu   sync.Mutex
+	open map[string]bool
+}
+
+func (f *fakeIncidents) IncidentOpen(ctx context.Context, outlier models.Outlier) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.open[notify.IncidentKey(outlier)], nil
+}
+
+func (f *fakeIncidents) close(outlier models.Outlier) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.open, notify.IncidentKey(outlier))
+}
+
+func TestRouter_KeepsIncidentsWithUnacknowledgedOutliersOpen(t *testing.T) {
+	pager := &resolvingNotifier{fakeNotifier: fakeNotifier{name: "pager"}}
+	router, err := notify.NewRouter(notify.RouterConfig{
+		Rules:       []notify.Rule{{Name: "all", Channels: []string{"pager"}}},
+		DedupWindow: time.Hour,
+	}, []notify.Notifier{pager}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	first := outlier("o1", models.OutlierTypeZScore, models.SeverityCritical, "TA")
+	incidents := &fakeIncidents{open: map[string]bool{notify.IncidentKey(first): true}}
+	router.SetIncidents(incidents)
+	router.Start()
+	defer router.Stop()
+
+	router.Route(first)
+	require.Eventually(t, func() bool { return len(pager.received()) == 1 }, time.Second, 5*time.Millisecond)
+
+	// o2 of the same incident is still unacknowledged, so acknowledging o1
+	// neither resolves the incident nor lets it page again
+	router.Resolve(first)
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, pager.resolvedIDs())
+	router.Route(outlier("o2", models.OutlierTypeZScore, models.SeverityCritical, "TA"))
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, pager.received(), 1)
+
+	incidents.close(first)
+	router.Resolve(outlier("o2", models.OutlierTypeZScore, models.SeverityCritical, "TA"))
+	require.Eventually(t, func() bool { return len(pager.resolvedIDs()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"o2"}, pager.resolvedIDs())
+}
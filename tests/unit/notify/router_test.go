@@ -0,0 +1,239 @@
+package notify_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/notify"
+	"github.com/mikedewar/stablerisk/internal/ratelimit"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeNotifier records alerts, failing the first failures deliveries
+type fakeNotifier struct {
+	name string
+
+	mu       sync.Mutex
+	failures int
+	attempts int
+	alerts   []notify.Alert
+}
+
+func (f *fakeNotifier) Name() string { return f.name }
+
+func (f *fakeNotifier) Notify(ctx context.Context, alert notify.Alert) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts++
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("channel unavailable")
+	}
+	f.alerts = append(f.alerts, alert)
+	return nil
+}
+
+func (f *fakeNotifier) received() []notify.Alert {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]notify.Alert(nil), f.alerts...)
+}
+
+// fakeWatchlist watches addresses by organization
+type fakeWatchlist map[string]map[string]bool
+
+func (w fakeWatchlist) Watched(orgID, address string) bool {
+	return w[orgID][address]
+}
+
+func outlier(id string, outlierType models.OutlierType, severity models.Severity, address string) models.Outlier {
+	return models.Outlier{
+		ID:       id,
+		OrgID:    models.DefaultOrganizationID,
+		Type:     outlierType,
+		Severity: severity,
+		Address:  address,
+	}
+}
+
+func TestRule_Matches(t *testing.T) {
+	watchlist := fakeWatchlist{models.DefaultOrganizationID: {"TWatched": true}}
+
+	tests := []struct {
+		name    string
+		rule    notify.Rule
+		outlier models.Outlier
+		want    bool
+	}{
+		{
+			name:    "severity at minimum",
+			rule:    notify.Rule{MinSeverity: models.SeverityHigh},
+			outlier: outlier("o1", models.OutlierTypeZScore, models.SeverityHigh, "TA"),
+			want:    true,
+		},
+		{
+			name:    "severity below minimum",
+			rule:    notify.Rule{MinSeverity: models.SeverityHigh},
+			outlier: outlier("o1", models.OutlierTypeZScore, models.SeverityMedium, "TA"),
+			want:    false,
+		},
+		{
+			name:    "type in set",
+			rule:    notify.Rule{Types: []models.OutlierType{models.OutlierTypeIQR, models.OutlierTypePatternFanOut}},
+			outlier: outlier("o1", models.OutlierTypePatternFanOut, models.SeverityLow, "TA"),
+			want:    true,
+		},
+		{
+			name:    "type not in set",
+			rule:    notify.Rule{Types: []models.OutlierType{models.OutlierTypeIQR}},
+			outlier: outlier("o1", models.OutlierTypeZScore, models.SeverityCritical, "TA"),
+			want:    false,
+		},
+		{
+			name:    "watchlist hit",
+			rule:    notify.Rule{Watchlisted: true},
+			outlier: outlier("o1", models.OutlierTypeWatchlist, models.SeverityHigh, "TOther"),
+			want:    true,
+		},
+		{
+			name:    "watched address",
+			rule:    notify.Rule{Watchlisted: true},
+			outlier: outlier("o1", models.OutlierTypeZScore, models.SeverityLow, "TWatched"),
+			want:    true,
+		},
+		{
+			name: "watched counterparty",
+			rule: notify.Rule{Watchlisted: true},
+			outlier: func() models.Outlier {
+				o := outlier("o1", models.OutlierTypePatternVelocity, models.SeverityLow, "TA")
+				o.Details = map[string]interface{}{"counterparty": "TWatched"}
+				return o
+			}(),
+			want: true,
+		},
+		{
+			name:    "unwatched address",
+			rule:    notify.Rule{Watchlisted: true},
+			outlier: outlier("o1", models.OutlierTypeZScore, models.SeverityCritical, "TA"),
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.rule.Matches(tt.outlier, watchlist))
+		})
+	}
+}
+
+func TestNewRouter_RejectsUnknownChannel(t *testing.T) {
+	_, err := notify.NewRouter(notify.RouterConfig{
+		Rules: []notify.Rule{{Name: "high", MinSeverity: models.SeverityHigh, Channels: []string{"email"}}},
+	}, []notify.Notifier{&fakeNotifier{name: "log"}}, zaptest.NewLogger(t))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown channel "email"`)
+}
+
+func TestRouter_RoutesToMatchingChannels(t *testing.T) {
+	pager := &fakeNotifier{name: "pager"}
+	chat := &fakeNotifier{name: "chat"}
+	router, err := notify.NewRouter(notify.RouterConfig{
+		Rules: []notify.Rule{
+			{Name: "critical", MinSeverity: models.SeverityCritical, Channels: []string{"pager", "chat"}},
+			{Name: "high", MinSeverity: models.SeverityHigh, Channels: []string{"chat"}},
+		},
+	}, []notify.Notifier{pager, chat}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	router.Start()
+	defer router.Stop()
+
+	router.Route(outlier("o1", models.OutlierTypeZScore, models.SeverityCritical, "TA"))
+	router.Route(outlier("o2", models.OutlierTypeZScore, models.SeverityHigh, "TB"))
+	router.Route(outlier("o3", models.OutlierTypeZScore, models.SeverityLow, "TC"))
+
+	require.Eventually(t, func() bool { return len(chat.received()) == 2 }, time.Second, 5*time.Millisecond)
+	require.Len(t, pager.received(), 1)
+	assert.Equal(t, "o1", pager.received()[0].Outlier.ID)
+	assert.Equal(t, "critical", pager.received()[0].Rule)
+
+	// A channel gets each outlier once, from the first rule that matches
+	chatAlerts := chat.received()
+	assert.Equal(t, "o1", chatAlerts[0].Outlier.ID)
+	assert.Equal(t, "critical", chatAlerts[0].Rule)
+	assert.Equal(t, "o2", chatAlerts[1].Outlier.ID)
+}
+
+func TestRouter_RetriesFailedDeliveries(t *testing.T) {
+	channel := &fakeNotifier{name: "chat", failures: 2}
+	router, err := notify.NewRouter(notify.RouterConfig{
+		Rules: []notify.Rule{{Name: "all", Channels: []string{"chat"}}},
+		Retry: notify.RetryPolicy{MaxRetries: 3, RetryDelay: 5 * time.Millisecond},
+	}, []notify.Notifier{channel}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	router.Start()
+	defer router.Stop()
+
+	router.Route(outlier("o1", models.OutlierTypeZScore, models.SeverityHigh, "TA"))
+
+	require.Eventually(t, func() bool { return len(channel.received()) == 1 }, 2*time.Second, 5*time.Millisecond)
+	channel.mu.Lock()
+	assert.Equal(t, 3, channel.attempts)
+	channel.mu.Unlock()
+}
+
+func TestRouter_DropsDuplicates(t *testing.T) {
+	channel := &fakeNotifier{name: "chat"}
+	router, err := notify.NewRouter(notify.RouterConfig{
+		Rules:       []notify.Rule{{Name: "all", Channels: []string{"chat"}}},
+		DedupWindow: time.Hour,
+	}, []notify.Notifier{channel}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	router.Start()
+	defer router.Stop()
+
+	router.Route(outlier("o1", models.OutlierTypeZScore, models.SeverityHigh, "TA"))
+	router.Route(outlier("o1", models.OutlierTypeZScore, models.SeverityHigh, "TA"))
+	// Same type and address, raised again
+	router.Route(outlier("o2", models.OutlierTypeZScore, models.SeverityHigh, "TA"))
+	// Different type or address
+	router.Route(outlier("o3", models.OutlierTypeIQR, models.SeverityHigh, "TA"))
+	router.Route(outlier("o4", models.OutlierTypeZScore, models.SeverityHigh, "TB"))
+
+	require.Eventually(t, func() bool { return len(channel.received()) == 3 }, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	var ids []string
+	for _, alert := range channel.received() {
+		ids = append(ids, alert.Outlier.ID)
+	}
+	assert.Equal(t, []string{"o1", "o3", "o4"}, ids)
+}
+
+func TestRouter_ThrottlesEachChannel(t *testing.T) {
+	limited := &fakeNotifier{name: "limited"}
+	other := &fakeNotifier{name: "other"}
+	router, err := notify.NewRouter(notify.RouterConfig{
+		Rules:    []notify.Rule{{Name: "all", Channels: []string{"limited", "other"}}},
+		Throttle: ratelimit.Rule{PerMinute: 1, Burst: 2},
+	}, []notify.Notifier{limited, other}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	router.Start()
+	defer router.Stop()
+
+	for _, address := range []string{"TA", "TB", "TC", "TD"} {
+		router.Route(outlier("o-"+address, models.OutlierTypeZScore, models.SeverityHigh, address))
+	}
+
+	// Each channel has its own allowance
+	require.Eventually(t, func() bool {
+		return len(limited.received()) == 2 && len(other.received()) == 2
+	}, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, limited.received(), 2)
+	assert.Len(t, other.received(), 2)
+}
@@ -0,0 +1,145 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/notify"
+	"github.com/mikedewar/stablerisk/internal/ratelimit"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// telegramMessage is a sendMessage request received by telegramServer
+type telegramMessage struct {
+	path string
+	body map[string]interface{}
+}
+
+// telegramServer records sendMessage requests and replies with status
+type telegramServer struct {
+	*httptest.Server
+	status int
+	reply  string
+
+	mu       sync.Mutex
+	messages []telegramMessage
+}
+
+func newTelegramServer(t *testing.T, status int, reply string) *telegramServer {
+	s := &telegramServer{status: status, reply: reply}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		s.mu.Lock()
+		s.messages = append(s.messages, telegramMessage{path: r.URL.Path, body: body})
+		s.mu.Unlock()
+		w.WriteHeader(s.status)
+		w.Write([]byte(s.reply))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *telegramServer) received() []telegramMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]telegramMessage(nil), s.messages...)
+}
+
+func TestTelegramNotifier_SendsToChatsBySeverity(t *testing.T) {
+	server := newTelegramServer(t, http.StatusOK, `{"ok":true}`)
+	notifier := notify.NewTelegramNotifier(notify.TelegramConfig{
+		APIURL:   server.URL,
+		BotToken: "123:secret",
+		Chats: []notify.TelegramChat{
+			{ID: "-100111"},
+			{ID: "@stablerisk_critical", MinSeverity: models.SeverityCritical},
+		},
+		DashboardURL: "https://stablerisk.test",
+	}, zaptest.NewLogger(t))
+	ctx := context.Background()
+
+	high := outlier("o1", models.OutlierTypeZScore, models.SeverityHigh, "TA")
+	high.Details = map[string]interface{}{"note": "<script>"}
+	require.NoError(t, notifier.Notify(ctx, notify.Alert{Rule: "high-severity", Outlier: high}))
+	require.NoError(t, notifier.Notify(ctx, notify.Alert{Rule: "all", Outlier: outlier("o2", models.OutlierTypeZScore, models.SeverityCritical, "TB")}))
+
+	messages := server.received()
+	require.Len(t, messages, 3)
+	assert.Equal(t, "/bot123:secret/sendMessage", messages[0].path)
+	assert.Equal(t, "-100111", messages[0].body["chat_id"])
+	assert.Equal(t, "HTML", messages[0].body["parse_mode"])
+	text := messages[0].body["text"].(string)
+	assert.Contains(t, text, "<b>HIGH zscore outlier on TA</b>")
+	assert.Contains(t, text, "note: &lt;script&gt;")
+	assert.Contains(t, text, `<a href="https://stablerisk.test/outliers?id=o1">View in StableRisk</a>`)
+
+	// Only the critical alert reaches the critical chat
+	assert.Equal(t, "-100111", messages[1].body["chat_id"])
+	assert.Equal(t, "@stablerisk_critical", messages[2].body["chat_id"])
+}
+
+func TestTelegramNotifier_DropsAlertsOverChatRate(t *testing.T) {
+	server := newTelegramServer(t, http.StatusOK, `{"ok":true}`)
+	notifier := notify.NewTelegramNotifier(notify.TelegramConfig{
+		APIURL:   server.URL,
+		BotToken: "123:secret",
+		Chats:    []notify.TelegramChat{{ID: "1"}, {ID: "2"}},
+		ChatRate: ratelimit.Rule{PerMinute: 1, Burst: 2},
+	}, zaptest.NewLogger(t))
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, notifier.Notify(context.Background(), notify.Alert{
+			Outlier: outlier("o", models.OutlierTypeZScore, models.SeverityHigh, "TA"),
+		}))
+	}
+
+	perChat := map[interface{}]int{}
+	for _, message := range server.received() {
+		perChat[message.body["chat_id"]]++
+	}
+	assert.Equal(t, map[interface{}]int{"1": 2, "2": 2}, perChat)
+}
+
+func TestTelegramNotifier_PausesWhenRateLimited(t *testing.T) {
+	server := newTelegramServer(t, http.StatusTooManyRequests,
+		`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 30","parameters":{"retry_after":30}}`)
+	notifier := notify.NewTelegramNotifier(notify.TelegramConfig{
+		APIURL:   server.URL,
+		BotToken: "123:secret",
+		Chats:    []notify.TelegramChat{{ID: "1"}, {ID: "2"}},
+	}, zaptest.NewLogger(t))
+	alert := notify.Alert{Outlier: outlier("o1", models.OutlierTypeZScore, models.SeverityHigh, "TA")}
+
+	err := notifier.Notify(context.Background(), alert)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 429")
+	assert.NotContains(t, err.Error(), "secret")
+
+	// The second chat is not tried, and nothing is sent while paused
+	err = notifier.Notify(context.Background(), alert)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "wait")
+	assert.Len(t, server.received(), 1)
+}
+
+func TestTelegramNotifier_KeepsTokenOutOfErrors(t *testing.T) {
+	notifier := notify.NewTelegramNotifier(notify.TelegramConfig{
+		APIURL:   "http://127.0.0.1:1",
+		BotToken: "123:secret",
+		Chats:    []notify.TelegramChat{{ID: "1"}},
+		Timeout:  time.Second,
+	}, zaptest.NewLogger(t))
+
+	err := notifier.Notify(context.Background(), notify.Alert{Outlier: outlier("o1", models.OutlierTypeZScore, models.SeverityHigh, "TA")})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+}
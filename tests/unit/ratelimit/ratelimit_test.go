@@ -0,0 +1,200 @@
+package ratelimit_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryLimiter_RefusesOnceBurstIsSpent(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter()
+	rule := ratelimit.Rule{PerMinute: 60, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		allowed, _, err := limiter.Allow(context.Background(), "ip:1.2.3.4", rule)
+		require.NoError(t, err)
+		assert.True(t, allowed, "request %d", i)
+	}
+
+	allowed, retryAfter, err := limiter.Allow(context.Background(), "ip:1.2.3.4", rule)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Greater(t, retryAfter, time.Duration(0))
+	assert.LessOrEqual(t, retryAfter, time.Second)
+
+	// Other keys have their own bucket
+	allowed, _, err = limiter.Allow(context.Background(), "ip:5.6.7.8", rule)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
+func TestMemoryLimiter_Refills(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter()
+	rule := ratelimit.Rule{PerMinute: 6000, Burst: 1} // A token every 10ms
+
+	allowed, _, _ := limiter.Allow(context.Background(), "user:1", rule)
+	require.True(t, allowed)
+	allowed, _, _ = limiter.Allow(context.Background(), "user:1", rule)
+	require.False(t, allowed)
+
+	time.Sleep(20 * time.Millisecond)
+	allowed, _, _ = limiter.Allow(context.Background(), "user:1", rule)
+	assert.True(t, allowed)
+}
+
+func TestMemoryLimiter_DisabledRuleAllowsEverything(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter()
+
+	for i := 0; i < 100; i++ {
+		allowed, _, err := limiter.Allow(context.Background(), "ip:1.2.3.4", ratelimit.Rule{})
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+}
+
+// fakeRedis answers EVALSHA with NOSCRIPT and EVAL with reply, recording
+// the commands it receives
+type fakeRedis struct {
+	listener net.Listener
+	reply    string
+
+	mu       sync.Mutex
+	commands [][]string
+}
+
+func newFakeRedis(t *testing.T, reply string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	f := &fakeRedis{listener: listener, reply: reply}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.commands = append(f.commands, args)
+		f.mu.Unlock()
+
+		switch strings.ToUpper(args[0]) {
+		case "AUTH", "SELECT":
+			fmt.Fprint(conn, "+OK\r\n")
+		case "EVALSHA":
+			fmt.Fprint(conn, "-NOSCRIPT No matching script\r\n")
+		case "EVAL":
+			fmt.Fprint(conn, f.reply)
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+func (f *fakeRedis) names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := make([]string, len(f.commands))
+	for i, args := range f.commands {
+		names[i] = args[0]
+	}
+	return names
+}
+
+// readCommand reads a RESP array of bulk strings, which may hold newlines
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line)[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(header)[1:])
+		if err != nil {
+			return nil, err
+		}
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, arg); err != nil {
+			return nil, err
+		}
+		args[i] = string(arg[:size])
+	}
+	return args, nil
+}
+
+func TestRedisLimiter_LoadsScriptAndParsesReply(t *testing.T) {
+	server := newFakeRedis(t, "*2\r\n:0\r\n$3\r\n2.5\r\n")
+
+	limiter, err := ratelimit.NewRedisLimiter(ratelimit.RedisConfig{
+		URL: "redis://:secret@" + server.listener.Addr().String() + "/2",
+	})
+	require.NoError(t, err)
+	defer limiter.Close()
+
+	allowed, retryAfter, err := limiter.Allow(context.Background(), "auth:ip:1.2.3.4", ratelimit.Rule{PerMinute: 10})
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 2500*time.Millisecond, retryAfter)
+	assert.Equal(t, []string{"AUTH", "SELECT", "EVALSHA", "EVAL"}, server.names())
+
+	// The connection is reused
+	_, _, err = limiter.Allow(context.Background(), "auth:ip:1.2.3.4", ratelimit.Rule{PerMinute: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"AUTH", "SELECT", "EVALSHA", "EVAL", "EVALSHA", "EVAL"}, server.names())
+}
+
+func TestRedisLimiter_ReportsUnreachableRedis(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	limiter, err := ratelimit.NewRedisLimiter(ratelimit.RedisConfig{
+		URL:     "redis://" + addr,
+		Timeout: 100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	_, _, err = limiter.Allow(context.Background(), "api:ip:1.2.3.4", ratelimit.Rule{PerMinute: 10})
+	assert.Error(t, err)
+}
+
+func TestNewRedisLimiter_RejectsInvalidURLs(t *testing.T) {
+	for _, url := range []string{"http://localhost:6379", "redis://localhost:6379/db"} {
+		_, err := ratelimit.NewRedisLimiter(ratelimit.RedisConfig{URL: url})
+		assert.Error(t, err, url)
+	}
+}
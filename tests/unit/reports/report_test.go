@@ -0,0 +1,329 @@
+package reports_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mikedewar/stablerisk/internal/notify"
+	"github.com/mikedewar/stablerisk/internal/reports"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func setupReportDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE outliers (
+			id TEXT PRIMARY KEY,
+			org_id TEXT,
+			detected_at DATETIME NOT NULL,
+			type TEXT NOT NULL,
+			severity TEXT NOT NULL,
+			address TEXT NOT NULL DEFAULT '',
+			transaction_hash TEXT NOT NULL DEFAULT '',
+			amount REAL NOT NULL DEFAULT 0,
+			invalidated BOOLEAN NOT NULL DEFAULT false
+		);
+		CREATE TABLE outlier_triage (
+			outlier_id TEXT NOT NULL,
+			org_id TEXT NOT NULL,
+			acknowledged BOOLEAN NOT NULL DEFAULT false,
+			UNIQUE (outlier_id, org_id)
+		);
+		CREATE TABLE report_deliveries (
+			report TEXT NOT NULL,
+			org_id TEXT NOT NULL,
+			report_date TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'sending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			claimed_at DATETIME NOT NULL,
+			completed_at DATETIME,
+			PRIMARY KEY (report, org_id, report_date)
+		)
+	`)
+	require.NoError(t, err)
+	return db
+}
+
+// testOutlier is a row of the outliers table, acknowledged by its
+// organization
+type testOutlier struct {
+	id, orgID, address, tx string
+	detectedAt             time.Time
+	outlierType            models.OutlierType
+	severity               models.Severity
+	amount                 float64
+	acknowledged           bool
+	invalidated            bool
+}
+
+func addOutliers(t *testing.T, db *sql.DB, outliers ...testOutlier) {
+	for _, o := range outliers {
+		if o.orgID == "" {
+			o.orgID = models.DefaultOrganizationID
+		}
+		_, err := db.Exec(`
+			INSERT INTO outliers (id, org_id, detected_at, type, severity, address, transaction_hash, amount, invalidated)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, o.id, o.orgID, o.detectedAt.UTC(), o.outlierType, o.severity, o.address, o.tx, o.amount, o.invalidated)
+		require.NoError(t, err)
+		if o.acknowledged {
+			acknowledge(t, db, o.id, o.orgID)
+		}
+	}
+}
+
+// acknowledge records orgID's acknowledgement of an outlier
+func acknowledge(t *testing.T, db *sql.DB, id, orgID string) {
+	_, err := db.Exec(`INSERT INTO outlier_triage (outlier_id, org_id, acknowledged) VALUES (?, ?, true)`, id, orgID)
+	require.NoError(t, err)
+}
+
+// reportDay is the day the tests report on
+var reportDay = time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+
+func seedDay(t *testing.T, db *sql.DB) {
+	at := func(hours int) time.Time { return reportDay.Add(time.Duration(hours) * time.Hour) }
+	addOutliers(t, db,
+		// The day's outliers
+		testOutlier{id: "o1", address: "TA", tx: "tx1", detectedAt: at(1), outlierType: models.OutlierTypeZScore, severity: models.SeverityHigh, amount: 500000},
+		testOutlier{id: "o2", address: "TA", tx: "tx1", detectedAt: at(2), outlierType: models.OutlierTypeIQR, severity: models.SeverityCritical, amount: 500000, acknowledged: true},
+		testOutlier{id: "o3", address: "TA", tx: "tx2", detectedAt: at(3), outlierType: models.OutlierTypeZScore, severity: models.SeverityMedium, amount: 1000},
+		testOutlier{id: "o4", address: "TB", tx: "tx3", detectedAt: at(4), outlierType: models.OutlierTypeZScore, severity: models.SeverityLow, amount: 750000},
+		testOutlier{id: "o5", address: "TC", detectedAt: at(5), outlierType: models.OutlierTypePatternDormant, severity: models.SeverityMedium},
+		// Invalidated, another day and another organization are left out
+		testOutlier{id: "o6", address: "TD", tx: "tx4", detectedAt: at(6), outlierType: models.OutlierTypeZScore, severity: models.SeverityCritical, amount: 9000000, invalidated: true},
+		testOutlier{id: "o7", address: "TE", tx: "tx5", detectedAt: at(-5), outlierType: models.OutlierTypeZScore, severity: models.SeverityHigh, amount: 8000000},
+		testOutlier{id: "o8", address: "TF", tx: "tx6", detectedAt: at(26), outlierType: models.OutlierTypeZScore, severity: models.SeverityHigh, amount: 7000000},
+		testOutlier{id: "o9", orgID: "org-2", address: "TG", tx: "tx7", detectedAt: at(7), outlierType: models.OutlierTypeZScore, severity: models.SeverityHigh, amount: 6000000},
+	)
+}
+
+func TestGenerator_Daily(t *testing.T) {
+	db := setupReportDB(t)
+	seedDay(t, db)
+	generator := reports.NewGenerator(db, zaptest.NewLogger(t))
+
+	report, err := generator.Daily(context.Background(), models.DefaultOrganizationID, reportDay.Add(13*time.Hour))
+	require.NoError(t, err)
+
+	assert.Equal(t, "2025-01-15", report.Date)
+	assert.Equal(t, reportDay, report.From)
+	assert.Equal(t, reportDay.AddDate(0, 0, 1), report.To)
+	assert.Equal(t, 5, report.TotalOutliers)
+	assert.Equal(t, map[models.Severity]int{
+		models.SeverityCritical: 1, models.SeverityHigh: 1, models.SeverityMedium: 2, models.SeverityLow: 1,
+	}, report.BySeverity)
+	assert.Equal(t, map[models.OutlierType]int{
+		models.OutlierTypeZScore: 3, models.OutlierTypeIQR: 1, models.OutlierTypePatternDormant: 1,
+	}, report.ByType)
+
+	require.Len(t, report.TopAddresses, 3)
+	assert.Equal(t, reports.AddressSummary{Address: "TA", Outliers: 3, HighestSeverity: models.SeverityCritical}, report.TopAddresses[0])
+	assert.Equal(t, "TC", report.TopAddresses[1].Address)
+	assert.Equal(t, "TB", report.TopAddresses[2].Address)
+
+	// Each transaction once, largest first
+	require.Len(t, report.LargestTransfers, 3)
+	assert.Equal(t, "tx3", report.LargestTransfers[0].TransactionHash)
+	assert.Equal(t, "750000", report.LargestTransfers[0].Amount.String())
+	assert.Equal(t, "tx1", report.LargestTransfers[1].TransactionHash)
+	assert.Equal(t, "o1", report.LargestTransfers[1].OutlierID)
+	assert.Equal(t, "tx2", report.LargestTransfers[2].TransactionHash)
+
+	// Unacknowledged by the end of the day, including earlier days
+	assert.Equal(t, 5, report.Backlog.Unacknowledged)
+	assert.Equal(t, map[models.Severity]int{
+		models.SeverityHigh: 2, models.SeverityMedium: 2, models.SeverityLow: 1,
+	}, report.Backlog.BySeverity)
+	require.NotNil(t, report.Backlog.OldestDetected)
+	assert.Equal(t, reportDay.Add(-5*time.Hour), *report.Backlog.OldestDetected)
+}
+
+func TestGenerator_DailySharedBacklog(t *testing.T) {
+	db := setupReportDB(t)
+	_, err := db.Exec(`INSERT INTO outliers (id, org_id, detected_at, type, severity) VALUES ('s1', NULL, ?, 'zscore', 'critical')`,
+		reportDay.Add(time.Hour))
+	require.NoError(t, err)
+	acknowledge(t, db, "s1", models.DefaultOrganizationID)
+	generator := reports.NewGenerator(db, zaptest.NewLogger(t))
+
+	// A shared outlier stays in each organization's backlog until that
+	// organization acknowledges it
+	report, err := generator.Daily(context.Background(), models.DefaultOrganizationID, reportDay)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.TotalOutliers)
+	assert.Zero(t, report.Backlog.Unacknowledged)
+
+	report, err = generator.Daily(context.Background(), "org-2", reportDay)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.TotalOutliers)
+	assert.Equal(t, 1, report.Backlog.Unacknowledged)
+	assert.Equal(t, map[models.Severity]int{models.SeverityCritical: 1}, report.Backlog.BySeverity)
+}
+
+func TestGenerator_DailyWithoutOutliers(t *testing.T) {
+	db := setupReportDB(t)
+	generator := reports.NewGenerator(db, zaptest.NewLogger(t))
+
+	report, err := generator.Daily(context.Background(), models.DefaultOrganizationID, reportDay)
+	require.NoError(t, err)
+	assert.Zero(t, report.TotalOutliers)
+	assert.Empty(t, report.TopAddresses)
+	assert.Empty(t, report.LargestTransfers)
+	assert.Nil(t, report.Backlog.OldestDetected)
+
+	body, err := report.RenderHTML("")
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "None.")
+}
+
+func TestDailyReport_Render(t *testing.T) {
+	db := setupReportDB(t)
+	seedDay(t, db)
+	addOutliers(t, db, testOutlier{id: "o10", address: "<script>", detectedAt: reportDay, outlierType: models.OutlierTypeZScore, severity: models.SeverityLow})
+	report, err := reports.NewGenerator(db, nil).Daily(context.Background(), models.DefaultOrganizationID, reportDay)
+	require.NoError(t, err)
+
+	assert.Equal(t, "[StableRisk] Daily report for 2025-01-15: 6 outliers, 6 unacknowledged", report.Subject())
+
+	body, err := report.RenderHTML("https://stablerisk.test")
+	require.NoError(t, err)
+	html := string(body)
+	assert.Contains(t, html, "StableRisk daily report for 2025-01-15")
+	assert.Contains(t, html, "<code>TA</code>")
+	assert.Contains(t, html, "750000")
+	assert.Contains(t, html, "&lt;script&gt;")
+	assert.NotContains(t, html, "<script>")
+	assert.Contains(t, html, `href="https://stablerisk.test"`)
+
+	pdf := report.RenderPDF()
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(pdf, []byte("%%EOF\n")))
+	assert.Contains(t, string(pdf), "(StableRisk daily report for 2025-01-15)")
+	assert.Contains(t, string(pdf), "(750000)")
+}
+
+// sentReport is a report emailed through fakeSender
+type sentReport struct {
+	recipients  []string
+	subject     string
+	body        []byte
+	attachments []notify.Attachment
+}
+
+// fakeSender records reports, failing while err is set
+type fakeSender struct {
+	mu   sync.Mutex
+	err  error
+	sent []sentReport
+}
+
+func (s *fakeSender) Send(ctx context.Context, recipients []string, subject string, body []byte, attachments ...notify.Attachment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, sentReport{recipients: recipients, subject: subject, body: body, attachments: attachments})
+	return nil
+}
+
+func newScheduler(t *testing.T, db *sql.DB, sender reports.Sender) *reports.Scheduler {
+	return reports.NewScheduler(db, reports.NewGenerator(db, nil), sender, reports.SchedulerConfig{
+		SendAt:      7 * time.Hour,
+		Recipients:  []string{"compliance@stablerisk.test"},
+		AttachPDF:   true,
+		MaxAttempts: 2,
+	}, zaptest.NewLogger(t))
+}
+
+func TestScheduler_SendsYesterdaysReportOnce(t *testing.T) {
+	db := setupReportDB(t)
+	seedDay(t, db)
+	sender := &fakeSender{}
+	nextDay := reportDay.AddDate(0, 0, 1)
+
+	// Not before the send time
+	sent, err := newScheduler(t, db, sender).SendDue(context.Background(), nextDay.Add(6*time.Hour))
+	require.NoError(t, err)
+	assert.False(t, sent)
+
+	sent, err = newScheduler(t, db, sender).SendDue(context.Background(), nextDay.Add(7*time.Hour))
+	require.NoError(t, err)
+	assert.True(t, sent)
+	require.Len(t, sender.sent, 1)
+	assert.Equal(t, []string{"compliance@stablerisk.test"}, sender.sent[0].recipients)
+	assert.Contains(t, sender.sent[0].subject, "2025-01-15")
+	require.Len(t, sender.sent[0].attachments, 1)
+	assert.Equal(t, "stablerisk-daily-2025-01-15.pdf", sender.sent[0].attachments[0].Filename)
+	assert.Equal(t, "application/pdf", sender.sent[0].attachments[0].ContentType)
+
+	// Another instance, or a later check, does not send it again
+	sent, err = newScheduler(t, db, sender).SendDue(context.Background(), nextDay.Add(8*time.Hour))
+	require.NoError(t, err)
+	assert.False(t, sent)
+	assert.Len(t, sender.sent, 1)
+
+	var status string
+	require.NoError(t, db.QueryRow(`SELECT status FROM report_deliveries WHERE report_date = '2025-01-15'`).Scan(&status))
+	assert.Equal(t, "sent", status)
+}
+
+func TestScheduler_RetriesFailedSends(t *testing.T) {
+	db := setupReportDB(t)
+	sender := &fakeSender{err: errors.New("connection refused")}
+	scheduler := newScheduler(t, db, sender)
+	due := reportDay.AddDate(0, 0, 1).Add(7 * time.Hour)
+
+	_, err := scheduler.SendDue(context.Background(), due)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection refused")
+
+	var status, message string
+	var attempts int
+	require.NoError(t, db.QueryRow(`SELECT status, attempts, error FROM report_deliveries`).Scan(&status, &attempts, &message))
+	assert.Equal(t, "failed", status)
+	assert.Equal(t, 1, attempts)
+	assert.Contains(t, message, "connection refused")
+
+	// Retried at the next check
+	sender.err = nil
+	sent, err := scheduler.SendDue(context.Background(), due.Add(5*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, sent)
+	require.NoError(t, db.QueryRow(`SELECT status, attempts FROM report_deliveries`).Scan(&status, &attempts))
+	assert.Equal(t, "sent", status)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestScheduler_GivesUpAfterMaxAttempts(t *testing.T) {
+	db := setupReportDB(t)
+	sender := &fakeSender{err: errors.New("connection refused")}
+	scheduler := newScheduler(t, db, sender)
+	due := reportDay.AddDate(0, 0, 1).Add(7 * time.Hour)
+
+	_, err := scheduler.SendDue(context.Background(), due)
+	require.Error(t, err)
+	_, err = scheduler.SendDue(context.Background(), due.Add(5*time.Minute))
+	require.Error(t, err)
+
+	sender.err = nil
+	sent, err := scheduler.SendDue(context.Background(), due.Add(10*time.Minute))
+	require.NoError(t, err)
+	assert.False(t, sent)
+	assert.Empty(t, sender.sent)
+}
@@ -0,0 +1,109 @@
+package reports_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/reports"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSARDraft() *reports.SARDraft {
+	at := time.Date(2025, 1, 15, 9, 30, 0, 0, time.UTC)
+	draft := &reports.SARDraft{
+		Reference:    "SAR-20250116-ABCDEF12",
+		OrgID:        models.DefaultOrganizationID,
+		Subject:      "TSubject",
+		IncidentKey:  "stablerisk:" + models.DefaultOrganizationID + ":pattern_fanout:TSubject",
+		GeneratedAt:  at.Add(24 * time.Hour),
+		GeneratedBy:  "analyst",
+		ActivityFrom: at,
+		ActivityTo:   at.Add(2 * time.Hour),
+		Outliers: []models.Outlier{
+			{ID: "o1", DetectedAt: at, Type: models.OutlierTypePatternFanOut, Severity: models.SeverityHigh,
+				Address: "TSubject", Status: models.OutlierStatusOpen},
+			{ID: "o2", DetectedAt: at.Add(2 * time.Hour), Type: models.OutlierTypePatternFanOut, Severity: models.SeverityCritical,
+				Address: "TSubject", TransactionHash: "tx2", Amount: decimal.NewFromInt(90000),
+				Status: models.OutlierStatusConfirmed, Acknowledged: true},
+		},
+		Transactions: []models.Transaction{
+			{TxHash: "tx2", From: "TSubject", To: "TMule", Amount: decimal.NewFromInt(90000), Timestamp: at.Add(2 * time.Hour)},
+			{TxHash: "tx1", From: "TSource", To: "TSubject", Amount: decimal.NewFromInt(100000), Timestamp: at},
+		},
+		Counterparties: []reports.SARCounterparty{
+			{Address: "TMule", TransactionCount: 1, Received: decimal.NewFromInt(90000), Outliers: 2, HighestSeverity: models.SeverityHigh},
+			{Address: "TSource", TransactionCount: 1, Sent: decimal.NewFromInt(100000)},
+		},
+		Flows: []reports.SARFlow{
+			{From: "TSubject", To: "TMule", TransactionCount: 1, Amount: decimal.NewFromInt(90000)},
+		},
+		Notes: []reports.SARNote{
+			{OutlierID: "o2", Author: "analyst", At: at.Add(3 * time.Hour), Text: "Funds moved to a known mule & cashed out"},
+		},
+	}
+	draft.Narrate()
+	return draft
+}
+
+func TestSARDraft_Narrate(t *testing.T) {
+	draft := testSARDraft()
+
+	require.Len(t, draft.Narrative, 5)
+	assert.Equal(t, "Between 2025-01-15 09:30 and 2025-01-15 11:30 UTC, StableRisk flagged 2 outliers on address TSubject as one incident (1 critical, 1 high).", draft.Narrative[0])
+	assert.Equal(t, "pattern_fanout: funds dispersed to many addresses in a short period (2 outliers).", draft.Narrative[1])
+	assert.Equal(t, "Around this activity the address sent 90000 across 1 transfer and received 100000 across 1 transfer. The largest was 100000 in transaction tx1 on 2025-01-15 09:30.", draft.Narrative[2])
+	assert.Equal(t, "The address transacted directly with 2 counterparties. Of these, 1 was flagged in their own right: TMule (2 outliers, highest high).", draft.Narrative[3])
+	assert.Equal(t, "1 of the 2 outliers has been acknowledged by an analyst, and 1 analyst note recorded.", draft.Narrative[4])
+}
+
+func TestSARDraft_NarrateWithoutGraph(t *testing.T) {
+	draft := testSARDraft()
+	draft.Transactions = nil
+	draft.Counterparties = nil
+	draft.Notes = nil
+	draft.Narrate()
+
+	require.Len(t, draft.Narrative, 3)
+	assert.Equal(t, "1 of the 2 outliers has been acknowledged by an analyst, and 0 analyst notes recorded.", draft.Narrative[2])
+}
+
+func TestSARDraft_RenderPDF(t *testing.T) {
+	pdf := testSARDraft().RenderPDF()
+
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-")))
+	assert.True(t, bytes.HasSuffix(bytes.TrimSpace(pdf), []byte("%%EOF")))
+	assert.Contains(t, string(pdf), "Suspicious Activity Report")
+	assert.Contains(t, string(pdf), "SAR-20250116-ABCDEF12")
+}
+
+func TestSARDraft_RenderDOCX(t *testing.T) {
+	docx, err := testSARDraft().RenderDOCX()
+	require.NoError(t, err)
+
+	archive, err := zip.NewReader(bytes.NewReader(docx), int64(len(docx)))
+	require.NoError(t, err)
+	files := make(map[string]string)
+	for _, file := range archive.File {
+		r, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		files[file.Name] = string(content)
+	}
+
+	require.Contains(t, files, "[Content_Types].xml")
+	require.Contains(t, files, "_rels/.rels")
+	document := files["word/document.xml"]
+	assert.Contains(t, document, "Suspicious Activity Report")
+	assert.Contains(t, document, "SAR-20250116-ABCDEF12")
+	assert.Contains(t, document, "pattern_fanout: funds dispersed")
+	// Notes are escaped
+	assert.Contains(t, document, "known mule &amp; cashed out")
+	assert.NotContains(t, document, "Gaps")
+}
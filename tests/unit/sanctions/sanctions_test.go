@@ -0,0 +1,176 @@
+package sanctions_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/sanctions"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+const sdnXML = `<?xml version="1.0" standalone="yes"?>
+<sdnList xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns="https://sanctionslistservice.ofac.treas.gov/api/PublicationPreview/exports/XML">
+  <publshInformation>
+    <Publish_Date>03/14/2026</Publish_Date>
+    <Record_Count>3</Record_Count>
+  </publshInformation>
+  <sdnEntry>
+    <uid>36</uid>
+    <lastName>AEROCARIBBEAN AIRLINES</lastName>
+    <sdnType>Entity</sdnType>
+    <programList><program>CUBA</program></programList>
+  </sdnEntry>
+  <sdnEntry>
+    <uid>41234</uid>
+    <firstName>Ivan</firstName>
+    <lastName>EXAMPLE</lastName>
+    <sdnType>Individual</sdnType>
+    <programList><program>CYBER2</program><program>RUSSIA-EO14024</program></programList>
+    <idList>
+      <id><uid>1</uid><idType>Passport</idType><idNumber>X123</idNumber></id>
+      <id><uid>2</uid><idType>Digital Currency Address - USDT</idType><idNumber>TSanctionedUSDT</idNumber></id>
+      <id><uid>3</uid><idType>Digital Currency Address - ETH</idType><idNumber>0xAbCdEf0000000000000000000000000000000001</idNumber></id>
+    </idList>
+  </sdnEntry>
+</sdnList>`
+
+func TestParseSDN(t *testing.T) {
+	list, err := sanctions.ParseSDN(strings.NewReader(sdnXML))
+	require.NoError(t, err)
+
+	assert.Equal(t, sanctions.OFACListName, list.Name)
+	require.NotNil(t, list.PublishedAt)
+	assert.Equal(t, time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC), *list.PublishedAt)
+
+	// Only digital currency addresses are kept
+	require.Len(t, list.Entries, 2)
+	entry := list.Entries[0]
+	assert.Equal(t, "TSanctionedUSDT", entry.Address)
+	assert.Equal(t, "USDT", entry.Currency)
+	assert.Equal(t, "41234", entry.EntryID)
+	assert.Equal(t, "Ivan EXAMPLE", entry.Name)
+	assert.Equal(t, []string{"CYBER2", "RUSSIA-EO14024"}, entry.Programs)
+	assert.Equal(t, "ETH", list.Entries[1].Currency)
+
+	_, err = sanctions.ParseSDN(strings.NewReader(`<html><body>Maintenance</body></html>`))
+	assert.Error(t, err)
+}
+
+func TestParseCSV(t *testing.T) {
+	list, err := sanctions.ParseCSV(strings.NewReader(
+		"Address,Name,Programs,ID\n"+
+			"TInternal1,Mixer operator,\"INTERNAL; FRAUD\",I-1\n"+
+			",Missing address,,I-2\n"+
+			"0xFEED000000000000000000000000000000000002,,,\n"), "internal")
+	require.NoError(t, err)
+
+	assert.Equal(t, "internal", list.Name)
+	require.Len(t, list.Entries, 2)
+	assert.Equal(t, "TInternal1", list.Entries[0].Address)
+	assert.Equal(t, "Mixer operator", list.Entries[0].Name)
+	assert.Equal(t, "I-1", list.Entries[0].EntryID)
+	assert.Equal(t, []string{"INTERNAL", "FRAUD"}, list.Entries[0].Programs)
+	assert.Equal(t, "internal", list.Entries[1].List)
+
+	_, err = sanctions.ParseCSV(strings.NewReader("wallet,name\nTX,y\n"), "internal")
+	assert.Error(t, err)
+}
+
+// fakeLoader returns list, or err when set
+type fakeLoader struct {
+	name string
+	list *sanctions.List
+	err  error
+}
+
+func (l *fakeLoader) Name() string { return l.name }
+
+func (l *fakeLoader) Load(ctx context.Context) (*sanctions.List, error) {
+	return l.list, l.err
+}
+
+func TestScreener_Screen(t *testing.T) {
+	sdn, err := sanctions.ParseSDN(strings.NewReader(sdnXML))
+	require.NoError(t, err)
+	ofac := &fakeLoader{name: sanctions.OFACListName, list: sdn}
+	internal := &fakeLoader{name: "internal", list: &sanctions.List{
+		Name:     "internal",
+		LoadedAt: time.Now(),
+		Entries:  []sanctions.Entry{{Address: "TSanctionedUSDT", List: "internal", EntryID: "I-9"}},
+	}}
+	screener := sanctions.NewScreener(sanctions.ScreenerConfig{}, []sanctions.Loader{ofac, internal}, zaptest.NewLogger(t))
+
+	tx := func(from, to string) models.Transaction {
+		return models.Transaction{
+			TxHash:    "tx-1",
+			From:      from,
+			To:        to,
+			Amount:    decimal.NewFromInt(5000),
+			Chain:     models.ChainTron,
+			Token:     "USDT",
+			Timestamp: time.Now(),
+		}
+	}
+
+	// Nothing is screened before the first refresh
+	assert.Empty(t, screener.Screen(tx("TSanctionedUSDT", "TClean")))
+	require.NoError(t, screener.Refresh(context.Background()))
+
+	outliers := screener.Screen(tx("TClean", "TSanctionedUSDT"))
+	require.Len(t, outliers, 1)
+	outlier := outliers[0]
+	assert.Equal(t, models.OutlierTypeSanctions, outlier.Type)
+	assert.Equal(t, models.SeverityCritical, outlier.Severity)
+	assert.Equal(t, "TSanctionedUSDT", outlier.Address)
+	assert.Equal(t, "received", outlier.Details["direction"])
+	assert.Equal(t, "TClean", outlier.Details["counterparty"])
+
+	// Provenance from both lists, ordered by list
+	lists := outlier.Details["lists"].([]map[string]interface{})
+	require.Len(t, lists, 2)
+	assert.Equal(t, "internal", lists[0]["list"])
+	assert.Equal(t, sanctions.OFACListName, lists[1]["list"])
+	assert.Equal(t, "41234", lists[1]["entry_id"])
+	assert.Equal(t, "2026-03-14T00:00:00Z", lists[1]["published_at"])
+
+	// Hex addresses match whatever their case
+	outliers = screener.Screen(tx("0xabcdef0000000000000000000000000000000001", "TSanctionedUSDT"))
+	require.Len(t, outliers, 2)
+	assert.Equal(t, "sent", outliers[0].Details["direction"])
+
+	// A list that fails to reload keeps its addresses
+	ofac.list, ofac.err = nil, errors.New("download failed")
+	internal.list = &sanctions.List{Name: "internal", LoadedAt: time.Now()}
+	assert.Error(t, screener.Refresh(context.Background()))
+	outliers = screener.Screen(tx("TSanctionedUSDT", "TSanctionedUSDT"))
+	require.Len(t, outliers, 1)
+	assert.Len(t, outliers[0].Details["lists"], 1)
+}
+
+func TestOFACLoader_Load(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(sdnXML))
+	}))
+	defer server.Close()
+
+	list, err := sanctions.NewOFACLoader(server.URL, time.Second).Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, server.URL, list.Source)
+	assert.Len(t, list.Entries, 2)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	_, err = sanctions.NewOFACLoader(failing.URL, time.Second).Load(context.Background())
+	assert.Error(t, err)
+}
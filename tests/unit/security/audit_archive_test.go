@@ -0,0 +1,109 @@
+package security
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/archive"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditArchiver_ArchivesPastRetention(t *testing.T) {
+	db := setupChainDB(t, 3)
+	_, err := db.Exec(`
+		INSERT INTO audit_logs (id, timestamp, action, resource, details, signature, user_id)
+		VALUES ('legacy-1', ?, 'migration', 'database', '{}', 'digest', 'system')
+	`, time.Now().UTC().Add(-48*time.Hour))
+	require.NoError(t, err)
+
+	retained := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	appendLogs(t, db, 2)
+
+	dir := t.TempDir()
+	auditLogger := security.NewAuditLogger(db, security.AuditLoggerConfig{SecretKey: chainTestKey}, nil)
+	defer auditLogger.Close()
+	archiver := security.NewAuditArchiver(db, archive.NewFileStore(dir), auditLogger, security.AuditArchiverConfig{
+		Retention: time.Since(retained),
+		BatchSize: 2,
+	}, nil)
+
+	archives, err := archiver.Archive(context.Background())
+	require.NoError(t, err)
+	require.Len(t, archives, 3)
+	assert.Equal(t, int64(0), archives[0].FirstSequence, "unchained records go first")
+	assert.Equal(t, "audit/sequence=00000000000000000001-00000000000000000002.ndjson.gz", archives[1].Key)
+	assert.Equal(t, int64(3), archives[2].LastSequence)
+
+	var remaining int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM audit_logs`).Scan(&remaining))
+	assert.Equal(t, 2, remaining)
+
+	// Objects match their manifests
+	body, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(archives[1].Key)))
+	require.NoError(t, err)
+	sum := sha256.Sum256(body)
+	assert.Equal(t, archives[1].SHA256, hex.EncodeToString(sum[:]))
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	decoder := json.NewDecoder(gz)
+	var logs []security.AuditLog
+	for {
+		var log security.AuditLog
+		if err := decoder.Decode(&log); err == io.EOF {
+			break
+		} else {
+			require.NoError(t, err)
+		}
+		assert.True(t, auditLogger.VerifySignature(&log), "archived records keep their signatures")
+		logs = append(logs, log)
+	}
+	assert.Len(t, logs, 2)
+	_, err = os.Stat(filepath.Join(dir, filepath.FromSlash(archives[1].Key)+".manifest.json"))
+	assert.NoError(t, err)
+
+	// The chain continues from the archives
+	report := verifyChain(t, db)
+	assert.True(t, report.Valid, "%+v", report.Problems)
+	assert.Equal(t, int64(3), report.Archived)
+	assert.Equal(t, int64(2), report.Records)
+
+	// Nothing else is past a day's retention
+	archiver = security.NewAuditArchiver(db, archive.NewFileStore(dir), auditLogger, security.AuditArchiverConfig{Retention: 24 * time.Hour}, nil)
+	archives, err = archiver.Archive(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, archives)
+
+	listed, err := security.ListAuditArchives(context.Background(), db)
+	require.NoError(t, err)
+	assert.Len(t, listed, 3)
+}
+
+func TestAuditArchiver_DetectsForgedManifest(t *testing.T) {
+	db := setupChainDB(t, 4)
+
+	auditLogger := security.NewAuditLogger(db, security.AuditLoggerConfig{SecretKey: chainTestKey}, nil)
+	defer auditLogger.Close()
+	archiver := security.NewAuditArchiver(db, archive.NewFileStore(t.TempDir()), auditLogger, security.AuditArchiverConfig{}, nil)
+	_, err := archiver.Archive(context.Background())
+	require.NoError(t, err)
+	assert.True(t, verifyChain(t, db).Valid)
+
+	// Claiming more records were archived does not verify
+	_, err = db.Exec(`UPDATE audit_archives SET last_sequence = 2`)
+	require.NoError(t, err)
+	report := verifyChain(t, db)
+	assert.False(t, report.Valid)
+	assert.Contains(t, report.Problems[0].Problem, "does not verify")
+}
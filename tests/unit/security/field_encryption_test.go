@@ -0,0 +1,145 @@
+package security
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/internal/security/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	oldFieldKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	newFieldKey = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+)
+
+func newCipher(t *testing.T, key string, previous ...string) *crypto.Cipher {
+	cipher, err := crypto.NewCipher(crypto.CipherConfig{Key: key, PreviousKeys: previous, IndexKey: "test-index-key"})
+	require.NoError(t, err)
+	return cipher
+}
+
+func TestCipher_RoundTrip(t *testing.T) {
+	cipher := newCipher(t, newFieldKey)
+
+	first, err := cipher.Encrypt("analyst@example.com")
+	require.NoError(t, err)
+	second, err := cipher.Encrypt("analyst@example.com")
+	require.NoError(t, err)
+	assert.True(t, crypto.IsEncrypted(first))
+	assert.NotContains(t, first, "analyst")
+	assert.NotEqual(t, first, second, "each value gets its own nonce")
+
+	plaintext, err := cipher.Decrypt(first)
+	require.NoError(t, err)
+	assert.Equal(t, "analyst@example.com", plaintext)
+
+	empty, err := cipher.Encrypt("")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	plaintext, err = cipher.Decrypt("written before encryption")
+	require.NoError(t, err)
+	assert.Equal(t, "written before encryption", plaintext)
+
+	// A development key that is not base64 is hashed rather than refused
+	_, err = crypto.NewCipher(crypto.CipherConfig{Key: "dev_encryption_key_change_32b", IndexKey: "x"})
+	assert.NoError(t, err)
+	_, err = crypto.NewCipher(crypto.CipherConfig{IndexKey: "x"})
+	assert.Error(t, err)
+}
+
+func TestCipher_DetectsTampering(t *testing.T) {
+	cipher := newCipher(t, newFieldKey)
+
+	encrypted, err := cipher.Encrypt("suspicious counterparty")
+	require.NoError(t, err)
+	tampered := encrypted[:len(encrypted)-4] + "AAA="
+	_, err = cipher.Decrypt(tampered)
+	assert.ErrorIs(t, err, crypto.ErrMalformed)
+
+	_, err = cipher.Decrypt("enc:v1:no-payload")
+	assert.ErrorIs(t, err, crypto.ErrMalformed)
+}
+
+func TestCipher_KeyRotation(t *testing.T) {
+	old := newCipher(t, oldFieldKey)
+	encrypted, err := old.Encrypt("note under the old key")
+	require.NoError(t, err)
+
+	_, err = newCipher(t, newFieldKey).Decrypt(encrypted)
+	assert.ErrorIs(t, err, crypto.ErrUnknownKey)
+
+	rotated := newCipher(t, newFieldKey, oldFieldKey)
+	plaintext, err := rotated.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "note under the old key", plaintext)
+
+	assert.True(t, rotated.NeedsRotation(encrypted))
+	assert.True(t, rotated.NeedsRotation("plaintext"))
+	assert.False(t, rotated.NeedsRotation(""))
+	reencrypted, err := rotated.Encrypt(plaintext)
+	require.NoError(t, err)
+	assert.False(t, rotated.NeedsRotation(reencrypted))
+	assert.True(t, strings.HasPrefix(reencrypted, rotated.CurrentPrefix()))
+
+	// The blind index does not depend on the encryption key
+	assert.Equal(t, old.BlindIndex("Analyst@Example.com "), rotated.BlindIndex("analyst@example.com"))
+	assert.NotEqual(t, rotated.BlindIndex("a@example.com"), rotated.BlindIndex("b@example.com"))
+	assert.Empty(t, rotated.BlindIndex(""))
+}
+
+func TestEncryptFields(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	old := newCipher(t, oldFieldKey)
+	oldNote, err := old.Encrypt("note under the old key")
+	require.NoError(t, err)
+	lost, err := newCipher(t, base64.StdEncoding.EncodeToString(make([]byte, 32))).Encrypt("note under a lost key")
+	require.NoError(t, err)
+
+	_, err = db.Exec(`
+		CREATE TABLE users (id TEXT PRIMARY KEY, email TEXT UNIQUE, email_hash TEXT UNIQUE);
+		CREATE TABLE outlier_triage (id TEXT PRIMARY KEY, notes TEXT);
+		INSERT INTO users (id, email) VALUES ('u1', 'first@example.com'), ('u2', NULL), ('u3', 'FIRST@example.com');
+		INSERT INTO outlier_triage (id, notes) VALUES ('o1', 'plain note'), ('o2', ?), ('o3', NULL), ('o4', ?);
+	`, oldNote, lost)
+	require.NoError(t, err)
+
+	cipher := newCipher(t, newFieldKey, oldFieldKey)
+	rewritten, err := security.EncryptFields(context.Background(), db, cipher, nil)
+	require.NoError(t, err)
+	// u3 collides with u1 on the case-insensitive index; o4 cannot be decrypted
+	assert.Equal(t, 3, rewritten)
+
+	var email, emailHash string
+	require.NoError(t, db.QueryRow(`SELECT email, email_hash FROM users WHERE id = 'u1'`).Scan(&email, &emailHash))
+	assert.False(t, cipher.NeedsRotation(email))
+	assert.Equal(t, cipher.BlindIndex("first@example.com"), emailHash)
+	plaintext, err := cipher.Decrypt(email)
+	require.NoError(t, err)
+	assert.Equal(t, "first@example.com", plaintext)
+
+	for id, want := range map[string]string{"o1": "plain note", "o2": "note under the old key"} {
+		var notes string
+		require.NoError(t, db.QueryRow(`SELECT notes FROM outlier_triage WHERE id = ?`, id).Scan(&notes))
+		assert.False(t, cipher.NeedsRotation(notes), id)
+		plaintext, err := cipher.Decrypt(notes)
+		require.NoError(t, err)
+		assert.Equal(t, want, plaintext)
+	}
+
+	// Everything that could be rewritten is under the current key
+	rewritten, err = security.EncryptFields(context.Background(), db, cipher, nil)
+	require.NoError(t, err)
+	assert.Zero(t, rewritten)
+}
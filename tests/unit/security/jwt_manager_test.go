@@ -74,6 +74,17 @@ func TestJWTManager_ValidateToken_Success(t *testing.T) {
 	assert.Equal(t, user.ID, claims.UserID)
 	assert.Equal(t, user.Username, claims.Username)
 	assert.Equal(t, user.Role, claims.Role)
+	assert.Empty(t, claims.OrgID)
+
+	// Tokens carry the user's organization
+	user.OrgID = "org-b"
+	for _, generate := range []func(*models.User) (string, error){jwtManager.GenerateAccessToken, jwtManager.GenerateRefreshToken} {
+		token, err := generate(user)
+		require.NoError(t, err)
+		claims, err := jwtManager.ValidateToken(token)
+		require.NoError(t, err)
+		assert.Equal(t, "org-b", claims.OrgID)
+	}
 }
 
 func TestJWTManager_ValidateToken_InvalidToken(t *testing.T) {
@@ -0,0 +1,91 @@
+package security
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2 keeps argon2id cheap in tests
+var testArgon2 = security.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1}
+
+func TestPasswordManager_Argon2id(t *testing.T) {
+	passwords := security.NewPasswordManager(security.PasswordConfig{
+		MinLength: 8,
+		Algorithm: security.PasswordAlgorithmArgon2id,
+		Argon2:    testArgon2,
+	})
+
+	hash, err := passwords.Hash("correct-horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$"), hash)
+
+	assert.True(t, passwords.Compare(hash, "correct-horse"))
+	assert.False(t, passwords.Compare(hash, "wrong-horse"))
+	assert.False(t, passwords.NeedsRehash(hash))
+
+	// Salts are random
+	again, err := passwords.Hash("correct-horse")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, again)
+
+	// argon2id has no 72 byte limit
+	_, err = passwords.Hash(strings.Repeat("a", 100))
+	assert.NoError(t, err)
+
+	_, err = passwords.Hash("short")
+	assert.ErrorIs(t, err, security.ErrPasswordTooShort)
+}
+
+func TestPasswordManager_ComparesEitherAlgorithm(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("correct-horse"), bcrypt.MinCost)
+	require.NoError(t, err)
+	argon2Hash, err := security.NewPasswordManager(security.PasswordConfig{
+		Algorithm: security.PasswordAlgorithmArgon2id,
+		Argon2:    testArgon2,
+	}).Hash("correct-horse")
+	require.NoError(t, err)
+
+	for _, algorithm := range []string{security.PasswordAlgorithmBcrypt, security.PasswordAlgorithmArgon2id} {
+		passwords := security.NewPasswordManager(security.PasswordConfig{
+			Algorithm: algorithm,
+			HashCost:  bcrypt.MinCost,
+			Argon2:    testArgon2,
+		})
+		assert.True(t, passwords.Compare(string(bcryptHash), "correct-horse"), algorithm)
+		assert.True(t, passwords.Compare(argon2Hash, "correct-horse"), algorithm)
+		assert.False(t, passwords.Compare(argon2Hash, "wrong-horse"), algorithm)
+	}
+
+	assert.False(t, security.NewPasswordManager(security.PasswordConfig{}).Compare("$argon2id$garbage", "correct-horse"))
+}
+
+func TestPasswordManager_NeedsRehash(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("correct-horse"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	argon2 := security.NewPasswordManager(security.PasswordConfig{
+		Algorithm: security.PasswordAlgorithmArgon2id,
+		Argon2:    testArgon2,
+	})
+	argon2Hash, err := argon2.Hash("correct-horse")
+	require.NoError(t, err)
+
+	assert.True(t, argon2.NeedsRehash(string(bcryptHash)), "bcrypt moves to argon2id")
+	assert.False(t, argon2.NeedsRehash(argon2Hash))
+
+	stronger := security.NewPasswordManager(security.PasswordConfig{
+		Algorithm: security.PasswordAlgorithmArgon2id,
+		Argon2:    security.Argon2Params{Memory: 128, Iterations: 1, Parallelism: 1},
+	})
+	assert.True(t, stronger.NeedsRehash(argon2Hash), "parameters changed")
+
+	bcryptManager := security.NewPasswordManager(security.PasswordConfig{HashCost: bcrypt.MinCost})
+	assert.False(t, bcryptManager.NeedsRehash(string(bcryptHash)))
+	assert.True(t, bcryptManager.NeedsRehash(argon2Hash), "argon2id moves back to bcrypt")
+	assert.True(t, security.NewPasswordManager(security.PasswordConfig{HashCost: bcrypt.MinCost + 1}).NeedsRehash(string(bcryptHash)), "cost changed")
+}
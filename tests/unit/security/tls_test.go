@@ -0,0 +1,160 @@
+package security
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/graph"
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA issues certificates for TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	return &testCA{cert: cert, key: key, file: file}
+}
+
+// issue writes a certificate and key for name to dir, returning their paths
+func (ca *testCA) issue(t *testing.T, dir, name string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+"-key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func TestCertReloader_PicksUpRenewal(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := ca.issue(t, dir, "server", 10, x509.ExtKeyUsageServerAuth)
+
+	reloader, err := security.NewCertReloader(security.CertReloaderConfig{
+		CertFile:      certFile,
+		KeyFile:       keyFile,
+		CheckInterval: time.Nanosecond,
+	}, nil)
+	require.NoError(t, err)
+	cert, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), cert.Leaf.SerialNumber.Int64())
+
+	// A renewal replaces both files
+	ca.issue(t, dir, "server", 11, x509.ExtKeyUsageServerAuth)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	cert, err = reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), cert.Leaf.SerialNumber.Int64())
+
+	// A broken replacement keeps the last good certificate
+	require.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0o600))
+	later = later.Add(time.Minute)
+	require.NoError(t, os.Chtimes(keyFile, later, later))
+	cert, err = reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), cert.Leaf.SerialNumber.Int64())
+
+	_, err = security.NewCertReloader(security.CertReloaderConfig{CertFile: certFile, KeyFile: filepath.Join(dir, "missing.pem")}, nil)
+	assert.Error(t, err)
+}
+
+func TestClientTLSConfig_MutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	serverCert, serverKey := ca.issue(t, dir, "raphtory", 20, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, dir, "monitor", 21, x509.ExtKeyUsageClientAuth)
+
+	reloader, err := security.NewCertReloader(security.CertReloaderConfig{CertFile: serverCert, KeyFile: serverKey}, nil)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	var clientName string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientName = r.TLS.PeerCertificates[0].Subject.CommonName
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // The refused handshake is expected
+	serverTLS := security.ServerTLSConfig(reloader)
+	serverTLS.ClientAuth = tls.RequireAndVerifyClientCert
+	serverTLS.ClientCAs = pool
+	// StartTLS would substitute its own certificate
+	server.Listener = tls.NewListener(server.Listener, serverTLS)
+	server.Start()
+	defer server.Close()
+	baseURL := strings.Replace(server.URL, "http://", "https://", 1)
+
+	none, err := security.ClientTLSConfig(security.ClientTLSFiles{}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, none)
+
+	// Trusting the server is not enough without a client certificate
+	caOnly, err := security.ClientTLSConfig(security.ClientTLSFiles{CAFile: ca.file}, nil)
+	require.NoError(t, err)
+	client := graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: baseURL, TLS: caOnly, FailureThreshold: -1}, nil)
+	assert.Error(t, client.DeleteTransaction(context.Background(), "0xabc"))
+
+	mutual, err := security.ClientTLSConfig(security.ClientTLSFiles{CertFile: clientCert, KeyFile: clientKey, CAFile: ca.file}, nil)
+	require.NoError(t, err)
+	client = graph.NewRaphtoryClient(graph.RaphtoryConfig{BaseURL: baseURL, TLS: mutual, FailureThreshold: -1}, nil)
+	require.NoError(t, client.DeleteTransaction(context.Background(), "0xabc"))
+	assert.Equal(t, "monitor", clientName)
+}
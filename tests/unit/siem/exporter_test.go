@@ -0,0 +1,335 @@
+package siem_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/security"
+	"github.com/mikedewar/stablerisk/internal/siem"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+var detectedAt = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testOutlier(severity models.Severity) models.Outlier {
+	return models.Outlier{
+		ID:              "o1",
+		DetectedAt:      detectedAt,
+		Type:            models.OutlierTypeZScore,
+		Severity:        severity,
+		Address:         "TAddrA",
+		TransactionHash: "0xabc",
+		Amount:          decimal.NewFromInt(50000),
+		Status:          models.OutlierStatusOpen,
+	}
+}
+
+func testAuditLog(action, status string) security.AuditLog {
+	return security.AuditLog{
+		ID:        "a1",
+		Timestamp: detectedAt,
+		UserID:    "admin",
+		Action:    action,
+		Resource:  "/api/v1/users",
+		Status:    status,
+		IPAddress: "10.0.0.5",
+		Details:   map[string]interface{}{"role": "analyst"},
+		Sequence:  42,
+	}
+}
+
+// listenUDP returns a syslog server's address and the datagrams it receives
+func listenUDP(t *testing.T) (string, <-chan string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	received := make(chan string, 10)
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			received <- string(buf[:n])
+		}
+	}()
+	return conn.LocalAddr().String(), received
+}
+
+// listenTCP returns a syslog server's address and the octet-counted
+// messages it receives
+func listenTCP(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(length))
+			if err != nil {
+				return
+			}
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				return
+			}
+			received <- string(msg)
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func receive(t *testing.T, received <-chan string) string {
+	select {
+	case msg := <-received:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event received")
+		return ""
+	}
+}
+
+func startExporter(t *testing.T, config siem.Config) *siem.Exporter {
+	if config.Hostname == "" {
+		config.Hostname = "api-1"
+	}
+	config.ProductVersion = "1.0.0"
+	exporter, err := siem.NewExporter(config, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	exporter.Start()
+	t.Cleanup(exporter.Stop)
+	return exporter
+}
+
+func TestExporter_SyslogCEF(t *testing.T) {
+	address, received := listenUDP(t)
+	exporter := startExporter(t, siem.Config{
+		Transport: siem.TransportSyslog,
+		Address:   address,
+		Outliers:  siem.EventConfig{Enabled: true},
+		Audit:     siem.EventConfig{Enabled: true},
+	})
+
+	exporter.Outlier(testOutlier(models.SeverityHigh))
+	msg := receive(t, received)
+	// local0 (16) and error (3)
+	assert.True(t, strings.HasPrefix(msg, "<131>1 2026-03-01T12:00:00.000000Z api-1 stablerisk - outlier - "), msg)
+	assert.Contains(t, msg, "CEF:0|StableRisk|StableRisk|1.0.0|outlier:zscore|HIGH zscore outlier on TAddrA|8|")
+	assert.Contains(t, msg, "rt=1772366400000 cat=outlier externalId=o1 act=zscore cs1Label=address cs1=TAddrA")
+	assert.Contains(t, msg, "cs3Label=amount cs3=50000")
+	assert.Contains(t, msg, "cs5Label=incidentKey cs5=stablerisk:"+models.DefaultOrganizationID+":zscore:TAddrA")
+
+	exporter.Audit(testAuditLog("login", "failure"))
+	msg = receive(t, received)
+	// local0 (16) and warning (4), as the login failed
+	assert.True(t, strings.HasPrefix(msg, "<132>1 "), msg)
+	assert.Contains(t, msg, "CEF:0|StableRisk|StableRisk|1.0.0|audit:login|Audit: login|6|")
+	assert.Contains(t, msg, "suser=admin src=10.0.0.5 request=/api/v1/users outcome=failure cn1Label=sequence cn1=42")
+	// Details as JSON
+	assert.Contains(t, msg, `cs1Label=details cs1={"role":"analyst"}`)
+}
+
+func TestExporter_SyslogTCPLEEF(t *testing.T) {
+	address, received := listenTCP(t)
+	exporter := startExporter(t, siem.Config{
+		Transport: siem.TransportSyslog,
+		Network:   "tcp",
+		Address:   address,
+		Outliers:  siem.EventConfig{Enabled: true, Format: siem.FormatLEEF},
+		Audit:     siem.EventConfig{Enabled: true, Format: siem.FormatLEEF},
+	})
+
+	exporter.Outlier(testOutlier(models.SeverityCritical))
+	exporter.Audit(testAuditLog("update_user", "success"))
+
+	msg := receive(t, received)
+	assert.Contains(t, msg, " stablerisk - outlier - LEEF:2.0|StableRisk|StableRisk|1.0.0|outlier:zscore|x09|devTime=2026-03-01T12:00:00.000+0000\t")
+	assert.Contains(t, msg, "\tsev=10\t")
+	assert.Contains(t, msg, "\taddress=TAddrA\t")
+
+	msg = receive(t, received)
+	assert.Contains(t, msg, "LEEF:2.0|StableRisk|StableRisk|1.0.0|audit:update_user|x09|")
+	assert.Contains(t, msg, "\tsev=3\t")
+	assert.Contains(t, msg, "\tusrName=admin\tsrc=10.0.0.5\t")
+}
+
+// collector records the requests of an HTTPS collector
+type collector struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+	status   int
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, r)
+	c.bodies = append(c.bodies, string(body))
+	if c.status != 0 {
+		w.WriteHeader(c.status)
+		c.status = 0
+	}
+}
+
+func (c *collector) received() ([]*http.Request, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*http.Request(nil), c.requests...), append([]string(nil), c.bodies...)
+}
+
+func startCollector(t *testing.T, c *collector, config siem.Config) *siem.Exporter {
+	server := httptest.NewTLSServer(c)
+	t.Cleanup(server.Close)
+
+	config.Transport = siem.TransportHTTPS
+	config.URL = server.URL + "/services/collector"
+	config.TLS = server.Client().Transport.(*http.Transport).TLSClientConfig
+	return startExporter(t, config)
+}
+
+func TestExporter_HTTPSJSON(t *testing.T) {
+	c := &collector{}
+	exporter := startCollector(t, c, siem.Config{
+		Headers:  map[string]string{"Authorization": "Splunk token"},
+		Outliers: siem.EventConfig{Enabled: true, Format: siem.FormatJSON},
+		Audit:    siem.EventConfig{Enabled: true, Format: siem.FormatJSON},
+	})
+
+	exporter.Outlier(testOutlier(models.SeverityMedium))
+	exporter.Audit(testAuditLog("login", "success"))
+
+	var lines []string
+	require.Eventually(t, func() bool {
+		_, bodies := c.received()
+		lines = nil
+		for _, body := range bodies {
+			lines = append(lines, strings.Split(strings.TrimSpace(body), "\n")...)
+		}
+		return len(lines) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	requests, _ := c.received()
+	assert.Equal(t, "/services/collector", requests[0].URL.Path)
+	assert.Equal(t, "application/x-ndjson", requests[0].Header.Get("Content-Type"))
+	assert.Equal(t, "Splunk token", requests[0].Header.Get("Authorization"))
+
+	var outlierEvent struct {
+		Source      string         `json:"source"`
+		Kind        string         `json:"kind"`
+		Severity    int            `json:"severity"`
+		IncidentKey string         `json:"incident_key"`
+		Outlier     models.Outlier `json:"outlier"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &outlierEvent))
+	assert.Equal(t, "stablerisk", outlierEvent.Source)
+	assert.Equal(t, "outlier", outlierEvent.Kind)
+	assert.Equal(t, 5, outlierEvent.Severity)
+	assert.Equal(t, "o1", outlierEvent.Outlier.ID)
+	assert.NotEmpty(t, outlierEvent.IncidentKey)
+
+	var auditEvent struct {
+		Kind  string            `json:"kind"`
+		Audit security.AuditLog `json:"audit"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &auditEvent))
+	assert.Equal(t, "audit", auditEvent.Kind)
+	assert.Equal(t, "login", auditEvent.Audit.Action)
+}
+
+func TestExporter_RetriesFailedSends(t *testing.T) {
+	c := &collector{status: http.StatusServiceUnavailable}
+	exporter := startCollector(t, c, siem.Config{
+		Outliers:   siem.EventConfig{Enabled: true},
+		MaxRetries: 2,
+		RetryDelay: 10 * time.Millisecond,
+	})
+
+	exporter.Outlier(testOutlier(models.SeverityHigh))
+
+	require.Eventually(t, func() bool {
+		requests, _ := c.received()
+		return len(requests) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	requests, bodies := c.received()
+	assert.Equal(t, "text/plain; charset=utf-8", requests[1].Header.Get("Content-Type"))
+	assert.Equal(t, bodies[0], bodies[1])
+}
+
+func TestExporter_Filters(t *testing.T) {
+	address, received := listenUDP(t)
+	exporter := startExporter(t, siem.Config{
+		Transport: siem.TransportSyslog,
+		Address:   address,
+		Outliers:  siem.EventConfig{Enabled: true, MinSeverity: models.SeverityHigh},
+		Audit:     siem.EventConfig{Enabled: true, Actions: []string{"delete_user"}},
+	})
+
+	exporter.Outlier(testOutlier(models.SeverityMedium))
+	exporter.Audit(testAuditLog("login", "success"))
+	exporter.Outlier(testOutlier(models.SeverityCritical))
+	exporter.Audit(testAuditLog("delete_user", "success"))
+
+	assert.Contains(t, receive(t, received), "|CRITICAL zscore outlier on TAddrA|10|")
+	assert.Contains(t, receive(t, received), "|audit:delete_user|")
+	select {
+	case msg := <-received:
+		t.Fatalf("unexpected event %q", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestExporter_DisabledEventTypes(t *testing.T) {
+	address, received := listenUDP(t)
+	exporter := startExporter(t, siem.Config{
+		Transport: siem.TransportSyslog,
+		Address:   address,
+		Audit:     siem.EventConfig{Enabled: true, Format: siem.FormatJSON},
+	})
+
+	exporter.Outlier(testOutlier(models.SeverityCritical))
+	exporter.Audit(testAuditLog("login", "success"))
+
+	msg := receive(t, received)
+	assert.Contains(t, msg, " stablerisk - audit - {")
+}
+
+func TestNewExporter_RejectsInvalidConfig(t *testing.T) {
+	for name, config := range map[string]siem.Config{
+		"no transport":      {Address: "127.0.0.1:514"},
+		"no syslog address": {Transport: siem.TransportSyslog},
+		"unknown network":   {Transport: siem.TransportSyslog, Address: "127.0.0.1:514", Network: "sctp"},
+		"no collector URL":  {Transport: siem.TransportHTTPS},
+		"unknown format":    {Transport: siem.TransportSyslog, Address: "127.0.0.1:514", Outliers: siem.EventConfig{Format: "xml"}},
+	} {
+		_, err := siem.NewExporter(config, nil)
+		assert.Error(t, err, name)
+	}
+}
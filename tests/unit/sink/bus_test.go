@@ -0,0 +1,62 @@
+package sink_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/bus"
+	"github.com/mikedewar/stablerisk/internal/sink"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakePublisher records published messages, failing the first failures calls
+type fakePublisher struct {
+	failures int
+	subjects []string
+	messages []interface{}
+}
+
+func (f *fakePublisher) Publish(ctx context.Context, subject string, v interface{}) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("bus unavailable")
+	}
+	f.subjects = append(f.subjects, subject)
+	f.messages = append(f.messages, v)
+	return nil
+}
+
+func TestBusSink_PublishesToSubjects(t *testing.T) {
+	publisher := &fakePublisher{failures: 1}
+	s := sink.NewBusSink(publisher, sink.RetryPolicy{MaxRetries: 2, RetryDelay: 5 * time.Millisecond}, zaptest.NewLogger(t))
+
+	tx := &models.Transaction{TxHash: "tx1"}
+	require.NoError(t, s.Send(context.Background(), tx))
+	require.NoError(t, s.Retract(context.Background(), "tx1"))
+	update := models.ConfirmationUpdate{TxHash: "tx2", BlockNumber: 100, Confirmations: 19}
+	require.NoError(t, s.Confirm(context.Background(), update))
+
+	assert.Equal(t, []string{bus.SubjectTransactions, bus.SubjectRetractions, bus.SubjectConfirmations}, publisher.subjects)
+	assert.Equal(t, tx, publisher.messages[0])
+	assert.Equal(t, sink.Retraction{TxHash: "tx1"}, publisher.messages[1])
+	assert.Equal(t, update, publisher.messages[2])
+
+	stats := s.Stats()
+	assert.Equal(t, uint64(1), stats.Published)
+	assert.Equal(t, uint64(1), stats.Retracted)
+	assert.Equal(t, uint64(1), stats.Confirmed)
+	assert.Zero(t, stats.Failed)
+}
+
+func TestBusSink_CountsFailures(t *testing.T) {
+	publisher := &fakePublisher{failures: 1}
+	s := sink.NewBusSink(publisher, sink.RetryPolicy{}, zaptest.NewLogger(t))
+
+	assert.Error(t, s.Send(context.Background(), &models.Transaction{TxHash: "tx1"}))
+	assert.Equal(t, uint64(1), s.Stats().Failed)
+}
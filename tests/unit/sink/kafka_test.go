@@ -0,0 +1,157 @@
+package sink_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/sink"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+type produceRequest struct {
+	Records []struct {
+		Key   string            `json:"key"`
+		Value sink.KafkaMessage `json:"value"`
+	} `json:"records"`
+}
+
+// fakeRestProxy records produced records, failing the first failures requests
+type fakeRestProxy struct {
+	failures atomic.Int32
+	mu       sync.Mutex
+	paths    []string
+	records  []produceRequest
+}
+
+func (f *fakeRestProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/vnd.kafka.json.v2+json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	if f.failures.Add(-1) >= 0 {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error_code": 50001, "message": "broker unavailable"})
+		return
+	}
+
+	var req produceRequest
+	json.NewDecoder(r.Body).Decode(&req)
+
+	f.mu.Lock()
+	f.paths = append(f.paths, r.URL.Path)
+	f.records = append(f.records, req)
+	offset := len(f.records) - 1
+	f.mu.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"offsets": []map[string]interface{}{{"partition": 0, "offset": offset, "error": nil}},
+	})
+}
+
+func TestKafkaSink_ProducesTransactionsAndRetractions(t *testing.T) {
+	proxy := &fakeRestProxy{}
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	s := sink.NewKafkaSink(sink.KafkaConfig{
+		RestProxyURL: server.URL + "/",
+		Topic:        "stablerisk.transactions",
+	}, zaptest.NewLogger(t))
+
+	tx := &models.Transaction{
+		TxHash:    "tx1",
+		From:      "TFrom",
+		To:        "TTo",
+		Amount:    decimal.NewFromInt(100),
+		Timestamp: time.Unix(1700000000, 0).UTC(),
+		Token:     "USDT",
+		Chain:     models.ChainTron,
+	}
+	require.NoError(t, s.Send(context.Background(), tx))
+	require.NoError(t, s.Retract(context.Background(), "tx1"))
+
+	require.Len(t, proxy.records, 2)
+	assert.Equal(t, []string{"/topics/stablerisk.transactions", "/topics/stablerisk.transactions"}, proxy.paths)
+
+	sent := proxy.records[0].Records[0]
+	assert.Equal(t, "tx1", sent.Key)
+	assert.Equal(t, sink.KafkaMessageTransaction, sent.Value.Type)
+	require.NotNil(t, sent.Value.Transaction)
+	assert.True(t, sent.Value.Transaction.Amount.Equal(tx.Amount))
+
+	// Retractions share the key so they follow the transaction on its partition
+	retracted := proxy.records[1].Records[0]
+	assert.Equal(t, "tx1", retracted.Key)
+	assert.Equal(t, sink.KafkaMessageRetraction, retracted.Value.Type)
+	assert.Nil(t, retracted.Value.Transaction)
+
+	stats := s.Stats()
+	assert.Equal(t, uint64(1), stats.Published)
+	assert.Equal(t, uint64(1), stats.Retracted)
+	assert.Zero(t, stats.Failed)
+}
+
+func TestKafkaSink_ProducesConfirmations(t *testing.T) {
+	proxy := &fakeRestProxy{}
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	s := sink.NewKafkaSink(sink.KafkaConfig{
+		RestProxyURL: server.URL,
+		Topic:        "stablerisk.transactions",
+	}, zaptest.NewLogger(t))
+
+	update := models.ConfirmationUpdate{TxHash: "tx1", BlockNumber: 100, Confirmations: 19, Chain: models.ChainTron}
+	require.NoError(t, s.Confirm(context.Background(), update))
+
+	require.Len(t, proxy.records, 1)
+	confirmed := proxy.records[0].Records[0]
+	assert.Equal(t, "tx1", confirmed.Key)
+	assert.Equal(t, sink.KafkaMessageConfirmation, confirmed.Value.Type)
+	require.NotNil(t, confirmed.Value.Confirmation)
+	assert.Equal(t, update, *confirmed.Value.Confirmation)
+	assert.Equal(t, uint64(1), s.Stats().Confirmed)
+}
+
+func TestKafkaSink_Retries(t *testing.T) {
+	proxy := &fakeRestProxy{}
+	proxy.failures.Store(2)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	s := sink.NewKafkaSink(sink.KafkaConfig{
+		RestProxyURL: server.URL,
+		Topic:        "transactions",
+		Retry:        sink.RetryPolicy{MaxRetries: 3, RetryDelay: 5 * time.Millisecond},
+	}, zaptest.NewLogger(t))
+
+	require.NoError(t, s.Retract(context.Background(), "tx1"))
+	assert.Len(t, proxy.records, 1)
+}
+
+func TestKafkaSink_FailsWithoutRetries(t *testing.T) {
+	proxy := &fakeRestProxy{}
+	proxy.failures.Store(1)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	s := sink.NewKafkaSink(sink.KafkaConfig{
+		RestProxyURL: server.URL,
+		Topic:        "transactions",
+	}, zaptest.NewLogger(t))
+
+	err := s.Retract(context.Background(), "tx1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "broker unavailable")
+	assert.Equal(t, uint64(1), s.Stats().Failed)
+}
@@ -0,0 +1,74 @@
+package tracing_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/internal/metrics"
+	"github.com/mikedewar/stablerisk/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestOpenDB_LogsSlowQueriesWithRedactedArgs(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	db, err := tracing.OpenDB("sqlite3", ":memory:", tracing.WithSlowQueryLog(time.Nanosecond, zap.New(core)))
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	queries := metrics.SlowQueries.WithLabelValues("query")
+	before := queries.Value()
+
+	ctx := context.Background()
+	_, err = db.ExecContext(ctx, `CREATE TABLE outliers (address TEXT, score REAL)`)
+	require.NoError(t, err)
+	rows, err := db.QueryContext(ctx, `SELECT * FROM outliers WHERE address = ? AND score > ?`, "TXYZsecretaddress", 3.5)
+	require.NoError(t, err)
+	rows.Close()
+
+	assert.Equal(t, before+1, queries.Value())
+
+	slow := logs.FilterMessage("Slow database query").FilterField(zap.String("operation", "query")).All()
+	require.Len(t, slow, 1)
+	fields := slow[0].ContextMap()
+	assert.Equal(t, "SELECT * FROM outliers WHERE address = ? AND score > ?", fields["query"])
+	assert.Equal(t, []interface{}{"$1=[redacted string, 17 bytes]", "$2=3.5"}, fields["args"])
+	assert.NotContains(t, slow[0].Message+fields["query"].(string), "TXYZsecretaddress")
+}
+
+func TestOpenDB_FastQueriesAreNotLogged(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	db, err := tracing.OpenDB("sqlite3", ":memory:", tracing.WithSlowQueryLog(time.Hour, zap.New(core)))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.ExecContext(context.Background(), `CREATE TABLE outliers (id TEXT)`)
+	require.NoError(t, err)
+	assert.Zero(t, logs.Len())
+}
+
+func TestRedactArgs(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	args := []driver.NamedValue{
+		{Ordinal: 1, Value: int64(50)},
+		{Ordinal: 2, Value: true},
+		{Ordinal: 3, Value: at},
+		{Ordinal: 4, Value: nil},
+		{Ordinal: 5, Value: []byte("hash")},
+		{Name: "email", Ordinal: 6, Value: "analyst@example.com"},
+	}
+
+	assert.Equal(t, []string{
+		"$1=50",
+		"$2=true",
+		"$3=2026-01-02T03:04:05Z",
+		"$4=NULL",
+		"$5=[redacted bytes, 4 bytes]",
+		"email=[redacted string, 19 bytes]",
+	}, tracing.RedactArgs(args))
+}
@@ -0,0 +1,251 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/mikedewar/stablerisk/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// exportedSpan is the subset of an OTLP JSON span the tests check
+type exportedSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Kind         int    `json:"kind"`
+	Status       struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+// collector is a fake OTLP/HTTP endpoint recording every span it receives
+type collector struct {
+	mu       sync.Mutex
+	services []string
+	spans    []exportedSpan
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string `json:"key"`
+					Value struct {
+						StringValue string `json:"stringValue"`
+					} `json:"value"`
+				} `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []exportedSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if r.URL.Path != "/v1/traces" || json.NewDecoder(r.Body).Decode(&payload) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range payload.ResourceSpans {
+		for _, attr := range rs.Resource.Attributes {
+			if attr.Key == "service.name" {
+				c.services = append(c.services, attr.Value.StringValue)
+			}
+		}
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+}
+
+func (c *collector) byName() map[string]exportedSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	spans := make(map[string]exportedSpan, len(c.spans))
+	for _, span := range c.spans {
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+// startTracing installs a tracer exporting to a fake collector and returns
+// a function that flushes it
+func startTracing(t *testing.T, sampleRatio float64) (*collector, func()) {
+	t.Helper()
+	c := &collector{}
+	server := httptest.NewServer(c)
+	t.Cleanup(server.Close)
+
+	shutdown := tracing.Init(tracing.Config{
+		ServiceName: "stablerisk-test",
+		Endpoint:    server.URL,
+		SampleRatio: sampleRatio,
+	}, zaptest.NewLogger(t))
+
+	flushed := false
+	flush := func() {
+		if !flushed {
+			flushed = true
+			require.NoError(t, shutdown(context.Background()))
+		}
+	}
+	t.Cleanup(flush)
+	return c, flush
+}
+
+func TestTraceparent_RoundTrip(t *testing.T) {
+	sc, ok := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", tracing.FormatTraceparent(sc))
+
+	// Later versions may append fields
+	_, ok = tracing.ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+	assert.True(t, ok)
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		_, ok := tracing.ParseTraceparent(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestStart_NoopWithoutTracer(t *testing.T) {
+	ctx, span := tracing.Start(context.Background(), "noop")
+	assert.Nil(t, span)
+	assert.Equal(t, context.Background(), ctx)
+
+	// A nil span accepts every call
+	span.SetAttributes(tracing.String("k", "v"))
+	span.RecordError(assert.AnError)
+	span.End()
+}
+
+func TestTracing_PropagatesThroughHTTPAndExportsSpans(t *testing.T) {
+	c, flush := startTracing(t, 1)
+
+	var received string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(tracing.TraceparentHeader)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer downstream.Close()
+
+	// Continue a trace started by a caller
+	header := http.Header{}
+	header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := tracing.Extract(context.Background(), header)
+
+	ctx, root := tracing.Start(ctx, "root", tracing.WithKind(tracing.KindServer))
+	require.NotNil(t, root)
+
+	client := &http.Client{Transport: tracing.Transport(nil)}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downstream.URL+"/graph", nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	root.End()
+
+	flush()
+
+	spans := c.byName()
+	require.Contains(t, spans, "root")
+	require.Contains(t, spans, "HTTP GET")
+
+	rootSpan, clientSpan := spans["root"], spans["HTTP GET"]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", rootSpan.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", rootSpan.ParentSpanID)
+	assert.Equal(t, int(tracing.KindServer), rootSpan.Kind)
+
+	assert.Equal(t, rootSpan.TraceID, clientSpan.TraceID)
+	assert.Equal(t, rootSpan.SpanID, clientSpan.ParentSpanID)
+	assert.Equal(t, int(tracing.KindClient), clientSpan.Kind)
+	assert.Equal(t, int(tracing.StatusError), clientSpan.Status.Code)
+
+	// The downstream service sees the client span as its parent
+	assert.Equal(t, "00-"+clientSpan.TraceID+"-"+clientSpan.SpanID+"-01", received)
+	assert.Equal(t, []string{"stablerisk-test"}, c.services)
+}
+
+func TestTracing_UnsampledTracesAreNotExported(t *testing.T) {
+	c, flush := startTracing(t, 0)
+
+	ctx, span := tracing.Start(context.Background(), "root")
+	assert.Nil(t, span)
+
+	// The decision is still propagated so downstream services agree
+	header := http.Header{}
+	tracing.Inject(ctx, header)
+	sc, ok := tracing.ParseTraceparent(header.Get(tracing.TraceparentHeader))
+	require.True(t, ok)
+	assert.False(t, sc.Sampled)
+
+	_, child := tracing.Start(ctx, "child")
+	assert.Nil(t, child)
+
+	flush()
+	assert.Empty(t, c.byName())
+}
+
+func TestOpenDB_TracesQueries(t *testing.T) {
+	c, flush := startTracing(t, 1)
+
+	db, err := tracing.OpenDB("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ctx, root := tracing.Start(context.Background(), "request")
+	_, err = db.ExecContext(ctx, `CREATE TABLE outliers (id TEXT)`)
+	require.NoError(t, err)
+	var count int
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT   COUNT(*)
+		FROM outliers`).Scan(&count))
+	_, err = db.QueryContext(ctx, `SELECT * FROM missing`)
+	require.Error(t, err)
+	root.End()
+
+	flush()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var queries, failed int
+	for _, span := range c.spans {
+		if span.Name == "request" {
+			continue
+		}
+		assert.Equal(t, root.SpanContext().SpanID.String(), span.ParentSpanID, span.Name)
+		assert.Contains(t, []string{"db.exec", "db.query"}, span.Name)
+		if span.Name == "db.query" {
+			queries++
+		}
+		if span.Status.Code == int(tracing.StatusError) {
+			failed++
+		}
+	}
+	assert.Equal(t, 2, queries)
+	assert.Equal(t, 1, failed)
+}
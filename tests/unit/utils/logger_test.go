@@ -0,0 +1,103 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikedewar/stablerisk/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile_RotatesAtSizeLimit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "monitor.log")
+
+	file, err := utils.NewRotatingFile(path, utils.RotationConfig{MaxSizeMB: 1})
+	require.NoError(t, err)
+
+	line := []byte(strings.Repeat("x", 1023) + "\n")
+	for i := 0; i < 1024; i++ {
+		_, err := file.Write(line)
+		require.NoError(t, err)
+	}
+	// The file is exactly at its limit, so the next line starts a new one
+	_, err = file.Write(line)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	backups, err := filepath.Glob(filepath.Join(dir, "monitor-*.log"))
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+
+	info, err := os.Stat(backups[0])
+	require.NoError(t, err)
+	assert.Equal(t, int64(1024*1024), info.Size())
+
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(line)), info.Size())
+}
+
+func TestRotatingFile_PrunesAndCompressesBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.log")
+
+	// A backup past max_age is removed whatever max_backups allows
+	stale := filepath.Join(dir, "api-"+time.Now().Add(-48*time.Hour).UTC().Format("2006-01-02T15-04-05.000")+".log")
+	require.NoError(t, os.WriteFile(stale, []byte("old\n"), 0644))
+
+	file, err := utils.NewRotatingFile(path, utils.RotationConfig{
+		MaxAge:     24 * time.Hour,
+		MaxBackups: 2,
+		Compress:   true,
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := file.Write([]byte("entry\n"))
+		require.NoError(t, err)
+		require.NoError(t, file.Rotate())
+		time.Sleep(2 * time.Millisecond) // distinct backup timestamps
+	}
+	require.NoError(t, file.Close())
+
+	_, err = os.Stat(stale)
+	assert.True(t, os.IsNotExist(err))
+
+	// Close waits for cleanup, which always runs after the last rotation
+	compressed, err := filepath.Glob(filepath.Join(dir, "api-*.log.gz"))
+	require.NoError(t, err)
+	plain, err := filepath.Glob(filepath.Join(dir, "api-*.log"))
+	require.NoError(t, err)
+	assert.Len(t, compressed, 2)
+	assert.Empty(t, plain)
+}
+
+func TestNewLogger_SamplesDebugButNotWarnings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sampled.log")
+
+	logger, err := utils.NewLogger(utils.LoggerConfig{
+		Level:            "debug",
+		Format:           "json",
+		OutputPath:       path,
+		ErrorPath:        path,
+		SampleInitial:    2,
+		SampleThereafter: 0,
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		logger.Debug("polled page")
+		logger.Warn("rate limited")
+	}
+	require.NoError(t, logger.Sync())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "polled page"))
+	assert.Equal(t, 10, strings.Count(string(data), "rate limited"))
+}
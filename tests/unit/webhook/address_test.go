@@ -0,0 +1,38 @@
+package webhook_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mikedewar/stablerisk/internal/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockedIP(t *testing.T) {
+	blocked := []string{
+		"127.0.0.1", "127.1.2.3", "::1",
+		"10.1.2.3", "172.16.0.1", "172.31.255.255", "192.168.1.1", "fd00::1",
+		"169.254.169.254", "fe80::1",
+		"0.0.0.0", "0.1.2.3", "::",
+		"100.64.0.1", "100.100.100.200",
+		"::ffff:127.0.0.1", "::ffff:169.254.169.254",
+	}
+	for _, address := range blocked {
+		assert.True(t, webhook.BlockedIP(net.ParseIP(address)), address)
+	}
+
+	allowed := []string{"8.8.8.8", "172.32.0.1", "100.128.0.1", "192.169.0.1", "2001:4860:4860::8888"}
+	for _, address := range allowed {
+		assert.False(t, webhook.BlockedIP(net.ParseIP(address)), address)
+	}
+}
+
+func TestBlockedHost(t *testing.T) {
+	assert.True(t, webhook.BlockedHost("localhost"))
+	assert.True(t, webhook.BlockedHost("LOCALHOST."))
+	assert.True(t, webhook.BlockedHost("api.localhost"))
+	assert.True(t, webhook.BlockedHost("169.254.169.254"))
+	assert.True(t, webhook.BlockedHost("::1"))
+	assert.False(t, webhook.BlockedHost("hooks.example.com"))
+	assert.False(t, webhook.BlockedHost("93.184.216.34"))
+}
@@ -0,0 +1,286 @@
+package webhook_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mikedewar/stablerisk/internal/notify"
+	"github.com/mikedewar/stablerisk/internal/webhook"
+	"github.com/mikedewar/stablerisk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func setupWebhookDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE webhooks (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL,
+			url TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			events TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			enabled BOOLEAN NOT NULL DEFAULT 1,
+			created_by TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE webhook_deliveries (
+			id TEXT PRIMARY KEY,
+			webhook_id TEXT NOT NULL,
+			event_id TEXT NOT NULL,
+			event_type TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			response_status INTEGER,
+			error TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			last_attempt_at DATETIME,
+			delivered_at DATETIME
+		)
+	`)
+	require.NoError(t, err)
+	return db
+}
+
+func addWebhook(t *testing.T, db *sql.DB, id, orgID, url, events string, enabled bool) {
+	_, err := db.Exec(`INSERT INTO webhooks (id, org_id, url, events, secret, enabled) VALUES (?, ?, ?, ?, ?, ?)`,
+		id, orgID, url, events, "whsec_"+id, enabled)
+	require.NoError(t, err)
+}
+
+// receivedRequest is a delivery received by endpoint
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// endpoint records deliveries and replies with the next of statuses, then
+// 200 once they run out
+type endpoint struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedRequest
+}
+
+func newEndpoint(t *testing.T, statuses ...int) *endpoint {
+	e := &endpoint{statuses: statuses}
+	e.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		e.mu.Lock()
+		e.requests = append(e.requests, receivedRequest{header: r.Header.Clone(), body: body})
+		status := http.StatusOK
+		if len(e.statuses) > 0 {
+			status, e.statuses = e.statuses[0], e.statuses[1:]
+		}
+		e.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(e.Close)
+	return e
+}
+
+func (e *endpoint) received() []receivedRequest {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]receivedRequest(nil), e.requests...)
+}
+
+func newDispatcher(t *testing.T, db *sql.DB, maxRetries int) *webhook.Dispatcher {
+	dispatcher := webhook.NewDispatcher(db, webhook.Config{
+		MaxRetries:    maxRetries,
+		RetryDelay:    5 * time.Millisecond,
+		MaxRetryDelay: 10 * time.Millisecond,
+
+		// Test endpoints listen on loopback
+		AllowPrivateAddresses: true,
+	}, zaptest.NewLogger(t))
+	dispatcher.Start()
+	t.Cleanup(dispatcher.Stop)
+	return dispatcher
+}
+
+// deliveryStatus reads a delivery's status, attempts and response status
+func deliveryStatus(t *testing.T, db *sql.DB, webhookID string) (string, int, int) {
+	var status string
+	var attempts int
+	var responseStatus sql.NullInt64
+	err := db.QueryRow(`SELECT status, attempts, response_status FROM webhook_deliveries WHERE webhook_id = ?`, webhookID).
+		Scan(&status, &attempts, &responseStatus)
+	if err == sql.ErrNoRows {
+		return "", 0, 0
+	}
+	require.NoError(t, err)
+	return status, attempts, int(responseStatus.Int64)
+}
+
+func outlier(id, orgID string) models.Outlier {
+	return models.Outlier{
+		ID:       id,
+		OrgID:    orgID,
+		Type:     models.OutlierTypeZScore,
+		Severity: models.SeverityHigh,
+		Address:  "TAddr",
+	}
+}
+
+func TestDispatcher_SignsDeliveries(t *testing.T) {
+	db := setupWebhookDB(t)
+	target := newEndpoint(t)
+	addWebhook(t, db, "w1", models.DefaultOrganizationID, target.URL, `["outlier.detected"]`, true)
+
+	dispatcher := newDispatcher(t, db, 0)
+	dispatcher.Outlier(outlier("o1", ""))
+
+	require.Eventually(t, func() bool {
+		status, _, _ := deliveryStatus(t, db, "w1")
+		return status == "delivered"
+	}, time.Second, 5*time.Millisecond)
+
+	requests := target.received()
+	require.Len(t, requests, 1)
+	header := requests[0].header
+	assert.Equal(t, "outlier.detected", header.Get(webhook.HeaderEvent))
+	assert.NotEmpty(t, header.Get(webhook.HeaderDelivery))
+	assert.Equal(t, webhook.Sign("whsec_w1", header.Get(webhook.HeaderTimestamp), requests[0].body), header.Get(webhook.HeaderSignature))
+	assert.NotEqual(t, webhook.Sign("whsec_other", header.Get(webhook.HeaderTimestamp), requests[0].body), header.Get(webhook.HeaderSignature))
+
+	var event struct {
+		Type  string         `json:"type"`
+		OrgID string         `json:"org_id"`
+		Data  models.Outlier `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(requests[0].body, &event))
+	assert.Equal(t, "outlier.detected", event.Type)
+	assert.Empty(t, event.OrgID, "shared detections belong to no organization")
+	assert.Equal(t, "o1", event.Data.ID)
+}
+
+func TestDispatcher_RetriesFailures(t *testing.T) {
+	db := setupWebhookDB(t)
+	flaky := newEndpoint(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	rejecting := newEndpoint(t, http.StatusGone)
+	down := newEndpoint(t, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	addWebhook(t, db, "flaky", models.DefaultOrganizationID, flaky.URL, `["outlier.detected"]`, true)
+	addWebhook(t, db, "rejecting", models.DefaultOrganizationID, rejecting.URL, `["outlier.detected"]`, true)
+	addWebhook(t, db, "down", models.DefaultOrganizationID, down.URL, `["outlier.detected"]`, true)
+
+	dispatcher := newDispatcher(t, db, 2)
+	dispatcher.Outlier(outlier("o1", models.DefaultOrganizationID))
+
+	require.Eventually(t, func() bool {
+		flakyStatus, _, _ := deliveryStatus(t, db, "flaky")
+		rejectingStatus, _, _ := deliveryStatus(t, db, "rejecting")
+		downStatus, _, _ := deliveryStatus(t, db, "down")
+		return flakyStatus == "delivered" && rejectingStatus == "failed" && downStatus == "failed"
+	}, 2*time.Second, 5*time.Millisecond)
+
+	// Succeeds on the third attempt
+	_, attempts, responseStatus := deliveryStatus(t, db, "flaky")
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, http.StatusOK, responseStatus)
+
+	// Client errors are not retried
+	_, attempts, responseStatus = deliveryStatus(t, db, "rejecting")
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, http.StatusGone, responseStatus)
+
+	// Gives up after the retries
+	_, attempts, responseStatus = deliveryStatus(t, db, "down")
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, http.StatusBadGateway, responseStatus)
+	assert.Len(t, down.received(), 3)
+}
+
+func TestDispatcher_OnlySubscribedWebhooks(t *testing.T) {
+	db := setupWebhookDB(t)
+	resolved := newEndpoint(t)
+	detected := newEndpoint(t)
+	disabled := newEndpoint(t)
+	otherOrg := newEndpoint(t)
+	addWebhook(t, db, "resolved", "org-1", resolved.URL, `["incident.resolved"]`, true)
+	addWebhook(t, db, "detected", "org-1", detected.URL, `["outlier.detected"]`, true)
+	addWebhook(t, db, "disabled", "org-1", disabled.URL, `["outlier.detected","incident.resolved"]`, false)
+	addWebhook(t, db, "other", "org-2", otherOrg.URL, `["outlier.detected","incident.resolved"]`, true)
+
+	dispatcher := newDispatcher(t, db, 0)
+	acknowledged := outlier("o1", "org-1")
+	dispatcher.Resolved("org-1", acknowledged)
+
+	require.Eventually(t, func() bool { return len(resolved.received()) == 1 }, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, detected.received())
+	assert.Empty(t, disabled.received())
+	assert.Empty(t, otherOrg.received())
+
+	request := resolved.received()[0]
+	assert.Equal(t, "incident.resolved", request.header.Get(webhook.HeaderEvent))
+	var event struct {
+		Data webhook.IncidentResolved `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(request.body, &event))
+	assert.Equal(t, notify.IncidentKey(acknowledged), event.Data.IncidentKey)
+	assert.Equal(t, "o1", event.Data.Outlier.ID)
+}
+
+func TestDispatcher_SharedOutliersReachEveryOrganization(t *testing.T) {
+	db := setupWebhookDB(t)
+	first := newEndpoint(t)
+	second := newEndpoint(t)
+	addWebhook(t, db, "first", "org-1", first.URL, `["outlier.detected"]`, true)
+	addWebhook(t, db, "second", "org-2", second.URL, `["outlier.detected"]`, true)
+
+	dispatcher := newDispatcher(t, db, 0)
+	dispatcher.Outlier(outlier("shared", ""))
+	dispatcher.Outlier(outlier("watchlist-hit", "org-2"))
+
+	require.Eventually(t, func() bool {
+		return len(first.received()) == 1 && len(second.received()) == 2
+	}, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, first.received(), 1, "org-1 only receives the shared outlier")
+}
+
+func TestDispatcher_RefusesPrivateAddresses(t *testing.T) {
+	db := setupWebhookDB(t)
+	target := newEndpoint(t)
+	port := target.URL[strings.LastIndex(target.URL, ":")+1:]
+	addWebhook(t, db, "loopback", models.DefaultOrganizationID, target.URL, `["outlier.detected"]`, true)
+	addWebhook(t, db, "localhost", models.DefaultOrganizationID, "http://localhost:"+port, `["outlier.detected"]`, true)
+	addWebhook(t, db, "metadata", models.DefaultOrganizationID, "http://169.254.169.254/latest/meta-data/", `["outlier.detected"]`, true)
+
+	dispatcher := webhook.NewDispatcher(db, webhook.Config{}, zaptest.NewLogger(t))
+	dispatcher.Start()
+	t.Cleanup(dispatcher.Stop)
+	dispatcher.Outlier(outlier("o1", models.DefaultOrganizationID))
+
+	for _, id := range []string{"loopback", "localhost", "metadata"} {
+		require.Eventually(t, func() bool {
+			status, _, _ := deliveryStatus(t, db, id)
+			return status == "failed"
+		}, 2*time.Second, 5*time.Millisecond, id)
+
+		var message string
+		require.NoError(t, db.QueryRow(`SELECT error FROM webhook_deliveries WHERE webhook_id = ?`, id).Scan(&message))
+		assert.Contains(t, message, "private, loopback or link-local", id)
+	}
+
+	// Neither the address nor a name resolving to it was reached
+	assert.Empty(t, target.received())
+}
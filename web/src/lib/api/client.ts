@@ -130,8 +130,9 @@ export class APIClient {
 		return this.request<Statistics>('GET', '/statistics');
 	}
 
-	async getTrends(days: number = 7): Promise<any> {
-		return this.request('GET', `/statistics/trends?days=${days}`);
+	async getTrends(days: number = 7, granularity?: 'hour' | 'day' | 'week' | 'month'): Promise<any> {
+		const query = granularity ? `days=${days}&granularity=${granularity}` : `days=${days}`;
+		return this.request('GET', `/statistics/trends?${query}`);
 	}
 
 	// Health